@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/proxy"
+)
+
+func main() {
+	// Parse command line flags
+	port := flag.Int("port", 8090, "HTTP proxy port")
+	backends := flag.String("backends", "", "Comma-separated URLs of the dt_server backends, such as http://10.0.0.1:8080")
+	timeout := flag.Duration("timeout", proxy.DefaultTimeout, "Timeout of the requests of merged twin listings to each backend")
+	flag.Parse()
+
+	var urls []string
+	for _, u := range strings.Split(*backends, ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			urls = append(urls, u)
+		}
+	}
+	p, err := proxy.New(proxy.Options{Backends: urls, Timeout: *timeout})
+	if err != nil {
+		log.Fatalf("Failed to configure proxy: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("OK"))
+	})
+	mux.Handle("/", p)
+
+	server := &http.Server{
+		Addr:    fmt.Sprintf("0.0.0.0:%d", *port),
+		Handler: mux,
+	}
+
+	// Set up graceful shutdown
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		log.Printf("Starting Digital Twin proxy on %s for %d backends", server.Addr, len(urls))
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Error starting proxy: %v", err)
+		}
+	}()
+
+	<-stop
+	log.Println("Shutting down proxy...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Fatalf("Proxy shutdown failed: %v", err)
+	}
+	log.Println("Proxy gracefully stopped")
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/cdc"
+	"github.com/aleka07/go-digital-twin/pkg/config"
+	"github.com/aleka07/go-digital-twin/pkg/edge"
+	"github.com/aleka07/go-digital-twin/pkg/federation"
+	"github.com/aleka07/go-digital-twin/pkg/ingest"
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/objstore"
+	"github.com/aleka07/go-digital-twin/pkg/offline"
+	"github.com/aleka07/go-digital-twin/pkg/oidc"
+	"github.com/aleka07/go-digital-twin/pkg/plugin"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/secret"
+	"github.com/aleka07/go-digital-twin/pkg/selfcheck"
+)
+
+// checkSetup holds the flags the check subcommand verifies
+type checkSetup struct {
+	port            int
+	udpAddr         string
+	configPath      string
+	twinsDir        string
+	seed            string
+	plugins         string
+	timestampPolicy string
+	legacySunset    string
+	loadLimits      ingest.LoadLimits
+}
+
+// runCheck verifies that the server could start with the given setup
+// without starting it, prints a report and returns the exit code
+func runCheck(setup checkSetup) int {
+	checks := []selfcheck.Check{flagsCheck(setup)}
+	checks = append(checks, configChecks(setup.configPath)...)
+
+	if setup.twinsDir != "" {
+		checks = append(checks, selfcheck.Definitions("twin definitions", setup.twinsDir))
+	} else {
+		checks = append(checks, selfcheck.Skipped("twin definitions", "no -twins-dir given"))
+	}
+	if setup.seed != "" {
+		checks = append(checks, selfcheck.Fixtures("seed fixtures", setup.seed))
+	} else {
+		checks = append(checks, selfcheck.Skipped("seed fixtures", "no -seed given"))
+	}
+
+	for _, path := range strings.Split(setup.plugins, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			checks = append(checks, pluginCheck(path))
+		}
+	}
+
+	checks = append(checks, selfcheck.Port("http port", "tcp", fmt.Sprintf("0.0.0.0:%d", setup.port)))
+	if setup.udpAddr != "" {
+		checks = append(checks, selfcheck.Port("udp telemetry", "udp", setup.udpAddr))
+	} else {
+		checks = append(checks, selfcheck.Skipped("udp telemetry", "no -udp-addr given"))
+	}
+
+	report := selfcheck.Run(context.Background(), checks, selfcheck.DefaultTimeout)
+	report.WriteText(os.Stdout)
+	if report.Failed() {
+		return 1
+	}
+	return 0
+}
+
+// flagsCheck validates the command line flags that are parsed at startup
+func flagsCheck(setup checkSetup) selfcheck.Check {
+	return selfcheck.Check{Name: "flags", Run: func(ctx context.Context) (string, error) {
+		if _, err := ingest.ParseTimestampPolicy(setup.timestampPolicy); err != nil {
+			return "", fmt.Errorf("invalid timestamp policy: %w", err)
+		}
+		if setup.legacySunset != "" {
+			if _, err := time.Parse(time.DateOnly, setup.legacySunset); err != nil {
+				return "", fmt.Errorf("invalid legacy sunset date: %w", err)
+			}
+		}
+		if err := setup.loadLimits.Validate(); err != nil {
+			return "", fmt.Errorf("invalid load limits: %w", err)
+		}
+		return "valid", nil
+	}}
+}
+
+// configChecks validate the configuration file and check the storage and
+// endpoints it configures
+func configChecks(path string) []selfcheck.Check {
+	if path == "" {
+		return []selfcheck.Check{selfcheck.Skipped("config", "no -config given")}
+	}
+
+	cfg, err := config.Load(path)
+	if err != nil {
+		return []selfcheck.Check{selfcheck.Failed("config", err)}
+	}
+	checks := []selfcheck.Check{{Name: "config", Run: func(ctx context.Context) (string, error) {
+		return path + " is valid", nil
+	}}}
+
+	// Resolve secret references before the stores and endpoints are created
+	secrets := secret.NewManager()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if s := cfg.Secrets; s != nil {
+		if err := s.Apply(ctx, secrets); err != nil {
+			return append(checks, selfcheck.Failed("secrets", err))
+		}
+	}
+	resolved, err := cfg.ResolveSecrets(ctx, secrets)
+	if err != nil {
+		return append(checks, selfcheck.Failed("secrets", err))
+	}
+	if resolved == 0 {
+		checks = append(checks, selfcheck.Skipped("secrets", "no secret references"))
+	} else {
+		checks = append(checks, selfcheck.Check{Name: "secrets", Run: func(ctx context.Context) (string, error) {
+			return fmt.Sprintf("resolved %d secret references", resolved), nil
+		}})
+	}
+
+	if b := cfg.Backup; b != nil {
+		store, err := objstore.NewS3(b.S3)
+		checks = append(checks, storeCheck("backup storage", store, b.Prefix, err))
+	}
+	if p := cfg.ParquetExport; p != nil {
+		store, err := p.Store()
+		checks = append(checks, storeCheck("parquet export storage", store, p.Prefix, err))
+	}
+	if m := cfg.Memory; m != nil {
+		store, err := m.ObjectStore()
+		if err == nil && store == nil {
+			checks = append(checks, selfcheck.Skipped("evicted twin storage", "memory budget has no dir or s3"))
+		} else {
+			checks = append(checks, storeCheck("evicted twin storage", store, m.Prefix, err))
+		}
+	}
+
+	if a := cfg.Attachments; a != nil {
+		if a.Dir == "" && a.S3 == nil {
+			checks = append(checks, selfcheck.Skipped("attachment storage", "attachments are kept in memory"))
+		} else {
+			store, err := a.Store()
+			checks = append(checks, storeCheck("attachment storage", store, a.Prefix, err))
+		}
+	}
+
+	if o := cfg.OIDC; o != nil {
+		checks = append(checks, selfcheck.Check{Name: "OIDC provider", Run: func(ctx context.Context) (string, error) {
+			p, err := oidc.NewProvider(ctx, o.Options())
+			if err != nil {
+				return "", err
+			}
+			if !p.CanLogin() {
+				return "discovered " + o.Issuer + ", API tokens only", nil
+			}
+			return "discovered " + o.Issuer, nil
+		}})
+	}
+
+	if o := cfg.Offline; o != nil {
+		checks = append(checks, selfcheck.Check{Name: "offline bundle keys", Run: func(ctx context.Context) (string, error) {
+			keys, err := o.Keys()
+			if err != nil {
+				return "", err
+			}
+			if keys.Signing == nil {
+				return fmt.Sprintf("%d trusted keys, bundles are not signed", len(keys.Trusted)), nil
+			}
+			return fmt.Sprintf("%d trusted keys, signing with key %s", len(keys.Trusted), offline.KeyID(keys.Signing.Public().(ed25519.PublicKey))), nil
+		}})
+	}
+
+	// The CDC exporter, edge sync and federation peers are the only bridges
+	// configured from the file
+	if c := cfg.CDC; c != nil {
+		// Creating the exporter validates its options and reads the checkpoint
+		if _, err := cdc.NewExporter(c.Options()); err != nil {
+			checks = append(checks, selfcheck.Failed("cdc endpoint", err))
+		} else {
+			checks = append(checks, selfcheck.Reachable("cdc endpoint", c.URL))
+		}
+	}
+	if e := cfg.Edge; e != nil {
+		// Creating the syncer reads the checkpoint
+		upstream, err := e.Upstream()
+		if err == nil {
+			_, err = edge.NewSyncer(registry.NewRegistry(), messaging_sim.NewPubSub(), upstream, e.Options())
+		}
+		if err != nil {
+			checks = append(checks, selfcheck.Failed("edge central server", err))
+		} else {
+			checks = append(checks, selfcheck.Reachable("edge central server", e.Central))
+		}
+	}
+	if f := cfg.Federation; f != nil {
+		if _, err := federation.NewManager(registry.NewRegistry(), messaging_sim.NewPubSub(), f.Options()); err != nil {
+			checks = append(checks, selfcheck.Failed("federation peers", err))
+		} else {
+			for _, p := range f.Peers {
+				checks = append(checks, selfcheck.Reachable("peer "+p.Name, p.URL))
+			}
+		}
+	}
+	return checks
+}
+
+// storeCheck checks an object store, or reports why it could not be opened
+func storeCheck(name string, store objstore.Store, prefix string, err error) selfcheck.Check {
+	if err != nil {
+		return selfcheck.Failed(name, err)
+	}
+	return selfcheck.Store(name, store, prefix)
+}
+
+// pluginCheck checks that a plugin package can be loaded
+func pluginCheck(path string) selfcheck.Check {
+	return selfcheck.Check{Name: "plugin " + path, Run: func(ctx context.Context) (string, error) {
+		p, err := plugin.Load(path)
+		if err != nil {
+			return "", err
+		}
+		return "loaded " + p.Name(), nil
+	}}
+}
@@ -8,24 +8,426 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/aleka07/go-digital-twin/pkg/api"
+	"github.com/aleka07/go-digital-twin/pkg/attachment"
+	"github.com/aleka07/go-digital-twin/pkg/backup"
+	"github.com/aleka07/go-digital-twin/pkg/cdc"
+	"github.com/aleka07/go-digital-twin/pkg/config"
+	"github.com/aleka07/go-digital-twin/pkg/demo"
+	"github.com/aleka07/go-digital-twin/pkg/edge"
+	"github.com/aleka07/go-digital-twin/pkg/energy"
+	"github.com/aleka07/go-digital-twin/pkg/export"
+	"github.com/aleka07/go-digital-twin/pkg/federation"
+	"github.com/aleka07/go-digital-twin/pkg/fixtures"
+	"github.com/aleka07/go-digital-twin/pkg/freshness"
+	"github.com/aleka07/go-digital-twin/pkg/ingest"
+	"github.com/aleka07/go-digital-twin/pkg/maintenance"
 	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/objstore"
+	"github.com/aleka07/go-digital-twin/pkg/oidc"
+	"github.com/aleka07/go-digital-twin/pkg/plugin"
 	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/replica"
+	"github.com/aleka07/go-digital-twin/pkg/twinsdir"
 )
 
 func main() {
 	// Parse command line flags
 	port := flag.Int("port", 8080, "HTTP server port")
-	flag.Parse()
+	dedupWindow := flag.Duration("dedup-window", ingest.DefaultDedupWindow, "How long telemetry message IDs are remembered for deduplication (0 disables)")
+	timestampPolicy := flag.String("timestamp-policy", string(ingest.DefaultTimestampPolicy), "Timestamp policy for telemetry: device, server or bounded")
+	maxSkew := flag.Duration("max-skew", ingest.DefaultMaxSkew, "Maximum device clock skew accepted by the bounded timestamp policy")
+	maxInFlight := flag.Int("max-inflight", ingest.DefaultMaxInFlight, "Telemetry batches applied concurrently")
+	maxQueued := flag.Int("max-queued", ingest.DefaultMaxQueued, "Telemetry batches waiting to be applied before requests are rejected with 429")
+	maxSaturation := flag.Float64("max-fanout-saturation", ingest.DefaultMaxSaturation, "Event subscriber queue fill ratio beyond which telemetry is rejected with 503 (0 disables)")
+	retryAfter := flag.Duration("retry-after", ingest.DefaultRetryAfter, "Retry delay suggested to clients whose telemetry was rejected")
+	twinCache := flag.Int("twin-cache", api.DefaultTwinCacheSize, "Twins whose JSON encoding is cached for GET /twins/{id} (0 disables)")
+	debugToken := flag.String("debug-token", "", "Bearer token for the /debug profiling endpoints, which are disabled when empty; DT_DEBUG_TOKEN is used when not set")
+	legacySunset := flag.String("legacy-sunset", "", "Date such as 2027-06-30 announced in the Sunset header of the unversioned legacy routes")
+	shareSecret := flag.String("share-secret", "", "Secret for signing share links; links do not survive restarts when empty")
+	adminToken := flag.String("admin-token", "", "Bearer token authenticating as an admin, which makes every request need a credential; DT_ADMIN_TOKEN is used when not set")
+	tokenSecret := flag.String("token-secret", "", "Secret for signing scoped tokens; tokens do not survive restarts when empty")
+	plugins := flag.String("plugins", "", "Comma-separated paths of Go plugin packages to load")
+	configPath := flag.String("config", "", "Path of a JSON configuration file")
+	twinsDir := flag.String("twins-dir", "", "Directory of YAML/JSON twin definitions loaded on startup and reloaded on change")
+	freshnessCheck := flag.Duration("freshness-check", freshness.DefaultCheckInterval, "How often properties are checked against their freshness SLAs (0 disables)")
+	energyInterval := flag.Duration("energy-interval", energy.DefaultInterval, "How often energy and power rollups are recomputed (0 disables)")
+	udpAddr := flag.String("udp-addr", "", "UDP address for high-rate telemetry datagrams, such as :9999 (empty disables)")
+	seed := flag.String("seed", "", "YAML/JSON fixture file or directory of twins and rules created on startup when missing")
+	demoMode := flag.Bool("demo", false, "Seed a sample fleet of buildings, rooms and sensors and simulate sensor readings")
+	replicaOf := flag.String("replica-of", "", "API URL of a primary server, such as http://primary:8080/api/v1, to follow as a read replica")
+
+	// "dt_server check [flags]" verifies the setup instead of serving
+	args := os.Args[1:]
+	checkOnly := len(args) > 0 && args[0] == "check"
+	if checkOnly {
+		args = args[1:]
+	}
+	flag.CommandLine.Parse(args)
+
+	if checkOnly {
+		os.Exit(runCheck(checkSetup{
+			port:            *port,
+			udpAddr:         *udpAddr,
+			configPath:      *configPath,
+			twinsDir:        *twinsDir,
+			seed:            *seed,
+			plugins:         *plugins,
+			timestampPolicy: *timestampPolicy,
+			legacySunset:    *legacySunset,
+			loadLimits: ingest.LoadLimits{
+				MaxInFlight:   *maxInFlight,
+				MaxQueued:     *maxQueued,
+				MaxSaturation: *maxSaturation,
+				RetryAfter:    *retryAfter,
+			},
+		}))
+	}
+
+	policy, err := ingest.ParseTimestampPolicy(*timestampPolicy)
+	if err != nil {
+		log.Fatalf("Invalid timestamp policy: %v", err)
+	}
+
+	if *replicaOf != "" && (*demoMode || *twinsDir != "" || *seed != "" || *udpAddr != "") {
+		log.Fatalf("A read replica cannot seed twins, load twin definitions or receive UDP telemetry")
+	}
+
+	cfg := &config.Config{}
+	if *configPath != "" {
+		if cfg, err = config.Load(*configPath); err != nil {
+			log.Fatalf("Failed to load configuration: %v", err)
+		}
+	}
 
 	// Create components
 	reg := registry.NewRegistry()
 	pubsub := messaging_sim.NewPubSub()
 	server := api.NewServer(reg, pubsub)
 
+	// Resolve secret references in credentials before anything uses them
+	secretsCtx, cancelSecrets := context.WithTimeout(context.Background(), 30*time.Second)
+	if s := cfg.Secrets; s != nil {
+		if err := s.Apply(secretsCtx, server.Secrets); err != nil {
+			log.Fatalf("Failed to configure secrets: %v", err)
+		}
+	}
+	if _, err := cfg.ResolveSecrets(secretsCtx, server.Secrets); err != nil {
+		log.Fatalf("Failed to resolve secrets: %v", err)
+	}
+	cancelSecrets()
+
+	server.Ingester.Deduplicator().SetWindow(*dedupWindow)
+	server.Ingester.SetTimestampPolicy(policy, *maxSkew)
+	server.SetTwinCacheSize(*twinCache)
+	if *debugToken == "" {
+		*debugToken = os.Getenv("DT_DEBUG_TOKEN")
+	}
+	server.SetDebugToken(*debugToken)
+	if *legacySunset != "" {
+		sunset, err := time.Parse(time.DateOnly, *legacySunset)
+		if err != nil {
+			log.Fatalf("Invalid legacy sunset date: %v", err)
+		}
+		server.SetLegacySunset(sunset)
+	}
+	if err := server.Ingester.SetLoadLimits(ingest.LoadLimits{
+		MaxInFlight:   *maxInFlight,
+		MaxQueued:     *maxQueued,
+		MaxSaturation: *maxSaturation,
+		RetryAfter:    *retryAfter,
+	}); err != nil {
+		log.Fatalf("Invalid load limits: %v", err)
+	}
+	if *shareSecret != "" {
+		server.Shares.SetSecret([]byte(*shareSecret))
+	}
+	if *adminToken == "" {
+		*adminToken = os.Getenv("DT_ADMIN_TOKEN")
+	}
+	server.SetAdminToken(*adminToken)
+	if *tokenSecret != "" {
+		server.Tokens.SetSecret([]byte(*tokenSecret))
+	}
+
+	// Load plugin packages
+	for _, path := range strings.Split(*plugins, ",") {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+
+		p, err := plugin.Load(path)
+		if err != nil {
+			log.Fatalf("Failed to load plugin %s: %v", path, err)
+		}
+		if err := server.Plugins.Add(p); err != nil {
+			log.Fatalf("Failed to add plugin %s: %v", path, err)
+		}
+		log.Printf("Loaded plugin %s from %s", p.Name(), path)
+	}
+
+	// Scheduled exports stop before the final backup on shutdown
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	// Restore from and export backups to object storage
+	var exporter *backup.Exporter
+	if cfg.Backup != nil {
+		store, err := objstore.NewS3(cfg.Backup.S3)
+		if err != nil {
+			log.Fatalf("Failed to configure backup storage: %v", err)
+		}
+		exporter = backup.NewExporter(reg, server.History, store, cfg.Backup.Options())
+
+		if cfg.Backup.RestoreOnStartup {
+			result, err := exporter.Restore(backgroundCtx)
+			switch {
+			case err == backup.ErrNoSnapshot:
+				log.Printf("No backup to restore")
+			case err != nil:
+				log.Fatalf("Failed to restore backup: %v", err)
+			default:
+				log.Printf("Restored %d twins from %s and %d history samples", result.Twins, result.Snapshot, result.Samples)
+			}
+		}
+
+		go exporter.Run(backgroundCtx)
+	}
+
+	// Load declarative twin definitions after restoring backups, so the files win
+	if *twinsDir != "" {
+		loader := twinsdir.NewLoader(*twinsDir, reg, pubsub)
+		report, err := loader.Load()
+		if err != nil {
+			log.Fatalf("Failed to load twin definitions: %v", err)
+		}
+		log.Printf("Loaded twin definitions from %s: %d created, %d updated, %d unchanged",
+			*twinsDir, len(report.Created), len(report.Updated), len(report.Unchanged))
+		for _, f := range report.Failed {
+			log.Printf("Twin definition failed: %s %s: %s", f.File, f.ID, f.Error)
+		}
+
+		go func() {
+			if err := loader.Watch(backgroundCtx); err != nil {
+				log.Printf("Failed to watch twin definitions: %v", err)
+			}
+		}()
+	}
+
+	// Seed fixtures after the twin definitions, which they do not overwrite
+	if *seed != "" {
+		f, err := fixtures.Load(*seed)
+		if err != nil {
+			log.Fatalf("Failed to load seed fixtures: %v", err)
+		}
+		report, err := fixtures.Seed(f, reg, pubsub, server.Scripts)
+		if err != nil {
+			log.Fatalf("Failed to seed fixtures: %v", err)
+		}
+		log.Printf("Seeded fixtures from %s: %d twins created, %d already existed, %d rules",
+			*seed, len(report.Created), len(report.Skipped), len(report.Rules))
+	}
+
+	// Seed the sample fleet and simulate its sensors
+	if *demoMode {
+		created, err := demo.Seed(reg, pubsub)
+		if err != nil {
+			log.Fatalf("Failed to seed demo fleet: %v", err)
+		}
+		log.Printf("Demo mode: seeded %d twins; try GET /twins or GET /twins/building-hq/impact", len(created))
+
+		go demo.NewSimulator(reg, server.Ingester, time.Now().UnixNano()).Run(backgroundCtx, demo.DefaultInterval)
+	}
+
+	// Follow the primary as a read replica. Only the primary flags stale
+	// properties and rolls up energy, whose results are replicated.
+	if *replicaOf != "" {
+		server.Replica, err = replica.New(reg, pubsub, server.History, replica.Options{Primary: *replicaOf})
+		if err != nil {
+			log.Fatalf("Failed to configure replica: %v", err)
+		}
+		go server.Replica.Run(backgroundCtx)
+		log.Printf("Following %s as a read replica", *replicaOf)
+		*freshnessCheck, *energyInterval = 0, 0
+	}
+
+	// Flag properties that miss their freshness SLAs
+	if *freshnessCheck > 0 {
+		go server.Freshness.Run(backgroundCtx, *freshnessCheck)
+	}
+
+	// Announce maintenance windows as they start and end
+	go server.Maintenance.Run(backgroundCtx, maintenance.DefaultCheckInterval)
+
+	// Roll energy and power values up the containment hierarchy
+	if *energyInterval > 0 {
+		go server.Energy.Run(backgroundCtx, *energyInterval)
+	}
+
+	// Invoke inference models that run on a schedule
+	go server.Models.RunSchedule(backgroundCtx)
+
+	// Export property history to Parquet files
+	if p := cfg.ParquetExport; p != nil {
+		store, err := p.Store()
+		if err != nil {
+			log.Fatalf("Failed to configure Parquet export: %v", err)
+		}
+		server.Parquet = export.NewParquetExporter(reg, server.History, store, p.Prefix)
+
+		if p.Interval > 0 {
+			go server.Parquet.Schedule(backgroundCtx, time.Duration(p.Interval), time.Duration(p.Delay))
+		}
+	}
+
+	// Keep the registry within its memory budget
+	if m := cfg.Memory; m != nil {
+		store, err := m.Store()
+		if err != nil {
+			log.Fatalf("Failed to open the store for evicted twins: %v", err)
+		}
+		reg.SetBudget(m.Budget(), store)
+
+		// Load checkpointed twins on first access rather than at startup
+		if m.LazyLoad {
+			n, err := reg.LoadLazily()
+			if err != nil {
+				log.Fatalf("Failed to list stored twins: %v", err)
+			}
+			log.Printf("Registered %d stored twins for loading on first access", n)
+		}
+	}
+
+	// Create the configured indexes and build them over the stored twins in
+	// the background; the server is ready once the critical ones are built
+	var criticalIndexes []string
+	for _, x := range cfg.Indexes {
+		if _, err := reg.CreateIndex(x.Path); err != nil {
+			log.Fatalf("Failed to create index %s: %v", x.Path, err)
+		}
+		if x.Critical {
+			criticalIndexes = append(criticalIndexes, x.Path)
+		}
+	}
+	server.SetCriticalIndexes(criticalIndexes)
+	go func() {
+		start := time.Now()
+		n, err := reg.WarmUp(backgroundCtx)
+		if err != nil {
+			log.Printf("Index warm-up failed: %v", err)
+			return
+		}
+		if n > 0 {
+			log.Printf("Warmed up indexes over %d stored twins in %s", n, time.Since(start))
+		}
+	}()
+
+	// Keep attachments in a directory or bucket
+	if a := cfg.Attachments; a != nil {
+		store, err := a.Store()
+		if err != nil {
+			log.Fatalf("Failed to open the attachment store: %v", err)
+		}
+		server.Attachments = attachment.NewManager(store, a.Options())
+	}
+
+	// Sign users in with an OIDC identity provider
+	if o := cfg.OIDC; o != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		server.OIDC, err = oidc.NewProvider(ctx, o.Options())
+		cancel()
+		if err != nil {
+			log.Fatalf("Failed to set up OIDC: %v", err)
+		}
+	}
+
+	// Log reads of sensitive twins
+	if a := cfg.AccessLog; a != nil {
+		if err := a.Apply(server.Access); err != nil {
+			log.Fatalf("Failed to apply access policies: %v", err)
+		}
+		if a.File != "" {
+			f, err := os.OpenFile(a.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+			if err != nil {
+				log.Fatalf("Failed to open the access log: %v", err)
+			}
+			defer f.Close()
+			server.Access.SetWriter(f)
+		}
+	}
+
+	// Reject or offload oversized property values
+	if v := cfg.ValueLimits; v != nil {
+		if err := v.Apply(server.ValueSizes); err != nil {
+			log.Fatalf("Failed to apply value limits: %v", err)
+		}
+	}
+
+	// Sign and verify offline bundles
+	if o := cfg.Offline; o != nil {
+		server.OfflineKeys, err = o.Keys()
+		if err != nil {
+			log.Fatalf("Failed to read offline bundle keys: %v", err)
+		}
+	}
+
+	// Export twin changes to an HTTP endpoint
+	if c := cfg.CDC; c != nil {
+		server.CDC, err = cdc.NewExporter(c.Options())
+		if err != nil {
+			log.Fatalf("Failed to configure CDC export: %v", err)
+		}
+		go server.CDC.Run(pubsub.SubscribeWithBuffer("#", 1024))
+		go server.CDC.Deliver(backgroundCtx)
+	}
+
+	// Sync local changes to a central server
+	if e := cfg.Edge; e != nil {
+		upstream, err := e.Upstream()
+		if err != nil {
+			log.Fatalf("Failed to configure edge sync: %v", err)
+		}
+		server.Edge, err = edge.NewSyncer(reg, pubsub, upstream, e.Options())
+		if err != nil {
+			log.Fatalf("Failed to configure edge sync: %v", err)
+		}
+		server.Edge.SetDeleteHook(server.ForgetTwin)
+		go server.Edge.Run(pubsub.SubscribeWithBuffer("#", 1024))
+		go server.Edge.Deliver(backgroundCtx)
+		log.Printf("Syncing with %s using the %s policy", e.Central, server.Edge.Options().Policy)
+	}
+
+	// Serve twins of peer servers
+	if f := cfg.Federation; f != nil {
+		server.Federation, err = federation.NewManager(reg, pubsub, f.Options())
+		if err != nil {
+			log.Fatalf("Failed to configure federation: %v", err)
+		}
+		server.Federation.SetDeleteHook(server.ForgetTwin)
+		go server.Federation.Run(backgroundCtx)
+	}
+
+	// Receive telemetry datagrams over UDP
+	if *udpAddr != "" {
+		server.UDP, err = ingest.ListenUDP(server.Ingester, *udpAddr, ingest.UDPOptions{Coalesce: true})
+		if err != nil {
+			log.Fatalf("Failed to listen for UDP telemetry: %v", err)
+		}
+		go server.UDP.Serve(backgroundCtx)
+		log.Printf("Receiving UDP telemetry on %s", server.UDP.Addr())
+	}
+
+	// Log failed plugin hooks
+	go func() {
+		for err := range server.Plugins.Errors() {
+			log.Printf("Plugin error: %v", err)
+		}
+	}()
+
 	// Set up graceful shutdown
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
@@ -60,6 +462,36 @@ func main() {
 		log.Fatalf("Server shutdown failed: %v", err)
 	}
 
+	// Export a final backup
+	stopBackground()
+	if exporter != nil {
+		if err := exporter.Export(ctx); err != nil {
+			log.Printf("Final backup export failed: %v", err)
+		}
+	}
+
+	// Keep the twins in memory for lazy loading on the next start
+	if m := cfg.Memory; m != nil && m.LazyLoad {
+		n, err := reg.Checkpoint()
+		if err != nil {
+			log.Printf("Failed to checkpoint twins: %v", err)
+		} else {
+			log.Printf("Checkpointed %d twins", n)
+		}
+	}
+
+	// Keep changes that were not delivered for the next start
+	if server.CDC != nil {
+		if err := server.CDC.Checkpoint(); err != nil {
+			log.Printf("Failed to write CDC checkpoint: %v", err)
+		}
+	}
+	if server.Edge != nil {
+		if err := server.Edge.Checkpoint(); err != nil {
+			log.Printf("Failed to write edge checkpoint: %v", err)
+		}
+	}
+
 	// Close pubsub
 	pubsub.Close()
 
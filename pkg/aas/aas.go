@@ -0,0 +1,528 @@
+package aas
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// Common errors
+var (
+	ErrInvalidIdentifier = errors.New("invalid AAS identifier")
+	ErrElementNotFound   = errors.New("submodel element not found")
+	ErrInvalidValue      = errors.New("invalid submodel element value")
+)
+
+// ShellIDPrefix prefixes the twin ID in the identifiers of shells and their submodels
+const ShellIDPrefix = "urn:dt:aas:"
+
+// Submodel kinds, the last segment of the identifier of a submodel
+const (
+	AttributesSubmodel    = "attributes"
+	RelationshipsSubmodel = "relationships"
+	featuresSegment       = "features/"
+)
+
+// Model types
+const (
+	TypeShell            = "AssetAdministrationShell"
+	TypeSubmodel         = "Submodel"
+	TypeProperty         = "Property"
+	TypeCollection       = "SubmodelElementCollection"
+	TypeMultiLanguage    = "MultiLanguageProperty"
+	TypeRange            = "Range"
+	TypeReferenceElement = "ReferenceElement"
+)
+
+// Key is a key of a reference
+type Key struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// Reference refers to a shell, submodel or element by its keys
+type Reference struct {
+	Type string `json:"type"` // ModelReference or ExternalReference
+	Keys []Key  `json:"keys"`
+}
+
+// modelReference returns a reference to a shell or submodel
+func modelReference(keyType, id string) *Reference {
+	return &Reference{Type: "ModelReference", Keys: []Key{{Type: keyType, Value: id}}}
+}
+
+// AssetInformation describes the asset of a shell
+type AssetInformation struct {
+	AssetKind     string `json:"assetKind"`
+	GlobalAssetID string `json:"globalAssetId,omitempty"`
+	AssetType     string `json:"assetType,omitempty"`
+}
+
+// Shell is an asset administration shell
+type Shell struct {
+	ModelType        string           `json:"modelType"`
+	ID               string           `json:"id"`
+	IDShort          string           `json:"idShort,omitempty"`
+	AssetInformation AssetInformation `json:"assetInformation"`
+	Submodels        []Reference      `json:"submodels,omitempty"`
+}
+
+// Submodel is a submodel of a shell
+type Submodel struct {
+	ModelType        string    `json:"modelType"`
+	ID               string    `json:"id"`
+	IDShort          string    `json:"idShort,omitempty"`
+	Kind             string    `json:"kind,omitempty"`
+	SubmodelElements []Element `json:"submodelElements"`
+}
+
+// LangString is a text in a language
+type LangString struct {
+	Language string `json:"language"`
+	Text     string `json:"text"`
+}
+
+// Element is a submodel element. Value holds a string for properties,
+// []Element for collections, []LangString for multi-language properties
+// and *Reference for reference elements; ranges use Min and Max.
+type Element struct {
+	ModelType string      `json:"modelType"`
+	IDShort   string      `json:"idShort,omitempty"`
+	ValueType string      `json:"valueType,omitempty"`
+	Value     interface{} `json:"value,omitempty"`
+	Min       *string     `json:"min,omitempty"`
+	Max       *string     `json:"max,omitempty"`
+}
+
+// UnmarshalJSON decodes the value of an element according to its model type.
+// Values of unsupported element types are left out.
+func (e *Element) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		ModelType string          `json:"modelType"`
+		IDShort   string          `json:"idShort"`
+		ValueType string          `json:"valueType"`
+		Value     json.RawMessage `json:"value"`
+		Min       *string         `json:"min"`
+		Max       *string         `json:"max"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*e = Element{ModelType: raw.ModelType, IDShort: raw.IDShort, ValueType: raw.ValueType, Min: raw.Min, Max: raw.Max}
+	if len(raw.Value) == 0 || string(raw.Value) == "null" {
+		return nil
+	}
+
+	var value interface{}
+	switch raw.ModelType {
+	case TypeProperty:
+		var s string
+		if err := json.Unmarshal(raw.Value, &s); err != nil {
+			return fmt.Errorf("property %s: %w", raw.IDShort, err)
+		}
+		value = s
+	case TypeCollection, "SubmodelElementList":
+		var elements []Element
+		if err := json.Unmarshal(raw.Value, &elements); err != nil {
+			return err
+		}
+		value = elements
+	case TypeMultiLanguage:
+		var texts []LangString
+		if err := json.Unmarshal(raw.Value, &texts); err != nil {
+			return fmt.Errorf("property %s: %w", raw.IDShort, err)
+		}
+		value = texts
+	case TypeReferenceElement:
+		var ref Reference
+		if err := json.Unmarshal(raw.Value, &ref); err != nil {
+			return fmt.Errorf("reference %s: %w", raw.IDShort, err)
+		}
+		value = &ref
+	}
+	e.Value = value
+	return nil
+}
+
+// EncodeID encodes an identifier for use in a path, as unpadded base64url
+func EncodeID(id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(id))
+}
+
+// DecodeID decodes an identifier from a path. Padding is accepted.
+func DecodeID(encoded string) (string, error) {
+	id, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(encoded, "="))
+	if err != nil || len(id) == 0 {
+		return "", fmt.Errorf("%w: %q is not base64url-encoded", ErrInvalidIdentifier, encoded)
+	}
+	return string(id), nil
+}
+
+// ShellID returns the identifier of a twin's shell
+func ShellID(twinID string) string {
+	return ShellIDPrefix + twinID
+}
+
+// SubmodelID returns the identifier of a twin's attributes or relationships submodel
+func SubmodelID(twinID, kind string) string {
+	return ShellID(twinID) + "/" + kind
+}
+
+// FeatureSubmodelID returns the identifier of the submodel of a feature
+func FeatureSubmodelID(twinID, featureID string) string {
+	return SubmodelID(twinID, featuresSegment+featureID)
+}
+
+// ParseShellID returns the twin ID of a shell identifier
+func ParseShellID(id string) (string, error) {
+	twinID := strings.TrimPrefix(id, ShellIDPrefix)
+	if twinID == id || twinID == "" || strings.Contains(twinID, "/") {
+		return "", fmt.Errorf("%w: %q is not a twin shell", ErrInvalidIdentifier, id)
+	}
+	return twinID, nil
+}
+
+// ParseSubmodelID returns the twin ID and kind of a submodel identifier,
+// with the feature ID for feature submodels
+func ParseSubmodelID(id string) (twinID, kind, featureID string, err error) {
+	rest := strings.TrimPrefix(id, ShellIDPrefix)
+	twinID, kind, ok := strings.Cut(rest, "/")
+	if rest == id || !ok || twinID == "" {
+		return "", "", "", fmt.Errorf("%w: %q is not a twin submodel", ErrInvalidIdentifier, id)
+	}
+
+	switch {
+	case kind == AttributesSubmodel || kind == RelationshipsSubmodel:
+		return twinID, kind, "", nil
+	case strings.HasPrefix(kind, featuresSegment) && len(kind) > len(featuresSegment):
+		return twinID, featuresSegment, strings.TrimPrefix(kind, featuresSegment), nil
+	}
+	return "", "", "", fmt.Errorf("%w: %q is not a twin submodel", ErrInvalidIdentifier, id)
+}
+
+// IDShort turns a name into a valid idShort: a letter followed by letters,
+// digits, underscores and hyphens. Other characters become underscores.
+func IDShort(name string) string {
+	var b strings.Builder
+	for i, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case i > 0 && (c >= '0' && c <= '9' || c == '_' || c == '-'):
+		case i == 0 && c >= '0' && c <= '9':
+			b.WriteString("x")
+		default:
+			c = '_'
+			if i == 0 {
+				b.WriteString("x")
+			}
+		}
+		b.WriteRune(c)
+	}
+	if b.Len() == 0 {
+		return "x"
+	}
+	return b.String()
+}
+
+// NewShell returns the shell of a twin, referring to its submodels
+func NewShell(dt *twin.DigitalTwin) Shell {
+	shell := Shell{
+		ModelType: TypeShell,
+		ID:        ShellID(dt.ID),
+		IDShort:   IDShort(dt.ID),
+		AssetInformation: AssetInformation{
+			AssetKind: "Instance",
+			AssetType: dt.Type,
+		},
+	}
+	if id, ok := dt.GetAttribute("globalAssetId"); ok {
+		shell.AssetInformation.GlobalAssetID, _ = id.(string)
+	}
+
+	for _, sm := range NewSubmodels(nil, dt) {
+		shell.Submodels = append(shell.Submodels, *modelReference(TypeSubmodel, sm.ID))
+	}
+	return shell
+}
+
+// NewSubmodels returns the submodels of a twin: its attributes, its
+// relationships if it has any, and one per feature ordered by ID. Without a
+// registry, submodels only carry their identifiers.
+func NewSubmodels(reg *registry.Registry, dt *twin.DigitalTwin) []Submodel {
+	submodels := []Submodel{newSubmodel(SubmodelID(dt.ID, AttributesSubmodel), "Attributes")}
+	if reg != nil {
+		submodels[0].SubmodelElements = elements(dt.GetAllAttributes())
+	}
+
+	if relationships := dt.GetAllRelationships(); len(relationships) > 0 {
+		sm := newSubmodel(SubmodelID(dt.ID, RelationshipsSubmodel), "Relationships")
+		if reg != nil {
+			sm.SubmodelElements = relationshipElements(relationships)
+		}
+		submodels = append(submodels, sm)
+	}
+
+	features := dt.GetAllFeatures()
+	ids := make([]string, 0, len(features))
+	for id := range features {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		sm := newSubmodel(FeatureSubmodelID(dt.ID, id), IDShort(id))
+		if reg != nil {
+			sm.SubmodelElements = elements(features[id].GetAllProperties())
+		}
+		submodels = append(submodels, sm)
+	}
+	return submodels
+}
+
+// newSubmodel returns an empty submodel
+func newSubmodel(id, idShort string) Submodel {
+	return Submodel{ModelType: TypeSubmodel, ID: id, IDShort: idShort, Kind: "Instance", SubmodelElements: []Element{}}
+}
+
+// GetSubmodel returns a submodel of a twin by its identifier
+func GetSubmodel(reg *registry.Registry, id string) (*twin.DigitalTwin, Submodel, error) {
+	twinID, kind, featureID, err := ParseSubmodelID(id)
+	if err != nil {
+		return nil, Submodel{}, err
+	}
+	dt, err := reg.Get(twinID)
+	if err != nil {
+		return nil, Submodel{}, err
+	}
+
+	switch kind {
+	case AttributesSubmodel:
+		sm := newSubmodel(id, "Attributes")
+		sm.SubmodelElements = elements(dt.GetAllAttributes())
+		return dt, sm, nil
+	case RelationshipsSubmodel:
+		sm := newSubmodel(id, "Relationships")
+		sm.SubmodelElements = relationshipElements(dt.GetAllRelationships())
+		return dt, sm, nil
+	}
+
+	feature, exists := dt.GetFeature(featureID)
+	if !exists {
+		return nil, Submodel{}, twin.ErrFeatureNotFound
+	}
+	sm := newSubmodel(id, IDShort(featureID))
+	sm.SubmodelElements = elements(feature.GetAllProperties())
+	return dt, sm, nil
+}
+
+// elements converts attributes or properties to submodel elements ordered
+// by name. Objects become collections, numbers, booleans and strings
+// properties, and other values JSON-encoded string properties.
+func elements(values map[string]interface{}) []Element {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := make([]Element, 0, len(names))
+	for _, name := range names {
+		result = append(result, NewElement(name, values[name]))
+	}
+	return result
+}
+
+// NewElement converts a value to a submodel element
+func NewElement(name string, value interface{}) Element {
+	e := Element{ModelType: TypeProperty, IDShort: IDShort(name), ValueType: "xs:string"}
+
+	// Normalize values of any Go type to their JSON form
+	if data, err := json.Marshal(value); err == nil {
+		json.Unmarshal(data, &value)
+	}
+
+	switch v := value.(type) {
+	case nil:
+	case string:
+		e.Value = v
+	case float64:
+		e.ValueType = "xs:double"
+		e.Value = strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		e.ValueType = "xs:boolean"
+		e.Value = strconv.FormatBool(v)
+	case map[string]interface{}:
+		e = Element{ModelType: TypeCollection, IDShort: e.IDShort, Value: elements(v)}
+	default:
+		data, _ := json.Marshal(v)
+		e.Value = string(data)
+	}
+	return e
+}
+
+// relationshipElements converts relationships to collections of references
+// to the shells of their targets
+func relationshipElements(relationships map[string][]string) []Element {
+	names := make([]string, 0, len(relationships))
+	for name := range relationships {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := make([]Element, 0, len(names))
+	for _, name := range names {
+		refs := make([]Element, 0, len(relationships[name]))
+		for _, target := range relationships[name] {
+			refs = append(refs, Element{
+				ModelType: TypeReferenceElement,
+				IDShort:   IDShort(target),
+				Value:     modelReference(TypeShell, ShellID(target)),
+			})
+		}
+		result = append(result, Element{ModelType: TypeCollection, IDShort: IDShort(name), Value: refs})
+	}
+	return result
+}
+
+// FindElement returns the element at a dot-separated idShort path
+func FindElement(elements []Element, path string) (Element, error) {
+	idShort, rest, nested := strings.Cut(path, ".")
+	for _, e := range elements {
+		if e.IDShort != idShort {
+			continue
+		}
+		if !nested {
+			return e, nil
+		}
+		if children, ok := e.Value.([]Element); ok {
+			return FindElement(children, rest)
+		}
+		break
+	}
+	return Element{}, ErrElementNotFound
+}
+
+// Value returns the value-only form of an element: typed values for
+// properties, objects for collections and ranges, and the texts by language
+// for multi-language properties
+func Value(e Element) interface{} {
+	switch e.ModelType {
+	case TypeProperty:
+		s, ok := e.Value.(string)
+		if !ok {
+			return nil
+		}
+		return parseValue(e.ValueType, s)
+	case TypeCollection, "SubmodelElementList":
+		children, _ := e.Value.([]Element)
+		values := make(map[string]interface{}, len(children))
+		for _, child := range children {
+			values[child.IDShort] = Value(child)
+		}
+		return values
+	case TypeMultiLanguage:
+		texts, _ := e.Value.([]LangString)
+		values := make(map[string]interface{}, len(texts))
+		for _, t := range texts {
+			values[t.Language] = t.Text
+		}
+		return values
+	case TypeRange:
+		values := make(map[string]interface{})
+		if e.Min != nil {
+			values["min"] = parseValue(e.ValueType, *e.Min)
+		}
+		if e.Max != nil {
+			values["max"] = parseValue(e.ValueType, *e.Max)
+		}
+		return values
+	case TypeReferenceElement:
+		if ref, ok := e.Value.(*Reference); ok && len(ref.Keys) > 0 {
+			return ref.Keys[len(ref.Keys)-1].Value
+		}
+	}
+	return nil
+}
+
+// parseValue converts the lexical form of an XML Schema value to a number,
+// boolean or string
+func parseValue(valueType, s string) interface{} {
+	switch strings.TrimPrefix(valueType, "xs:") {
+	case "double", "float", "decimal", "integer", "int", "long", "short", "byte",
+		"nonNegativeInteger", "positiveInteger", "nonPositiveInteger", "negativeInteger",
+		"unsignedLong", "unsignedInt", "unsignedShort", "unsignedByte":
+		if n, err := strconv.ParseFloat(s, 64); err == nil {
+			return n
+		}
+	case "boolean":
+		switch s {
+		case "true", "1":
+			return true
+		case "false", "0":
+			return false
+		}
+	}
+	return s
+}
+
+// SetValue changes an attribute or feature property of a twin from the
+// value-only form of a property element. The idShort path names the
+// attribute or property; nested collections cannot be written. Strings
+// are converted to the type of the current value, so that clients may send
+// lexical forms. It returns the name of the changed attribute or property.
+func SetValue(dt *twin.DigitalTwin, kind, featureID, path string, value interface{}) (string, error) {
+	if strings.Contains(path, ".") {
+		return "", fmt.Errorf("%w: only top-level properties can be written", ErrInvalidValue)
+	}
+	switch value.(type) {
+	case map[string]interface{}, []interface{}:
+		return "", fmt.Errorf("%w: only property values can be written", ErrInvalidValue)
+	}
+
+	var values map[string]interface{}
+	var feature *twin.FeatureState
+	switch kind {
+	case AttributesSubmodel:
+		values = dt.GetAllAttributes()
+	case featuresSegment:
+		var exists bool
+		if feature, exists = dt.GetFeature(featureID); !exists {
+			return "", twin.ErrFeatureNotFound
+		}
+		values = feature.GetAllProperties()
+	default:
+		return "", fmt.Errorf("%w: relationships cannot be written", ErrInvalidValue)
+	}
+
+	for name, current := range values {
+		if IDShort(name) != path {
+			continue
+		}
+		if _, ok := current.(map[string]interface{}); ok {
+			return "", fmt.Errorf("%w: only property values can be written", ErrInvalidValue)
+		}
+
+		if s, ok := value.(string); ok {
+			switch current.(type) {
+			case float64:
+				value = parseValue("xs:double", s)
+			case bool:
+				value = parseValue("xs:boolean", s)
+			}
+		}
+
+		if feature != nil {
+			feature.SetProperty(name, value)
+		} else {
+			dt.SetAttribute(name, value)
+		}
+		return name, nil
+	}
+	return "", ErrElementNotFound
+}
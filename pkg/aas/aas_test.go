@@ -0,0 +1,222 @@
+package aas
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestIdentifiers(t *testing.T) {
+	id := ShellID("pump-1")
+	if id != "urn:dt:aas:pump-1" {
+		t.Errorf("Unexpected shell ID %q", id)
+	}
+	for _, encoded := range []string{EncodeID(id), EncodeID(id) + "=="} {
+		if decoded, err := DecodeID(encoded); err != nil || decoded != id {
+			t.Errorf("Expected %q to decode to %q, got %q (%v)", encoded, id, decoded, err)
+		}
+	}
+	if _, err := DecodeID("not base64!"); !errors.Is(err, ErrInvalidIdentifier) {
+		t.Errorf("Expected ErrInvalidIdentifier, got %v", err)
+	}
+
+	if twinID, err := ParseShellID(id); err != nil || twinID != "pump-1" {
+		t.Errorf("Unexpected twin ID %q (%v)", twinID, err)
+	}
+	if _, err := ParseShellID("https://example.com/aas/1"); err == nil {
+		t.Error("Expected foreign shell identifiers to be rejected")
+	}
+
+	twinID, kind, featureID, err := ParseSubmodelID(FeatureSubmodelID("pump-1", "motor"))
+	if err != nil || twinID != "pump-1" || kind != featuresSegment || featureID != "motor" {
+		t.Errorf("Unexpected feature submodel %q %q %q (%v)", twinID, kind, featureID, err)
+	}
+	if _, kind, _, err := ParseSubmodelID(SubmodelID("pump-1", AttributesSubmodel)); err != nil || kind != AttributesSubmodel {
+		t.Errorf("Unexpected attributes submodel %q (%v)", kind, err)
+	}
+	for _, invalid := range []string{id, id + "/other", id + "/features/", "urn:other:pump-1/attributes"} {
+		if _, _, _, err := ParseSubmodelID(invalid); !errors.Is(err, ErrInvalidIdentifier) {
+			t.Errorf("Expected ErrInvalidIdentifier for %q, got %v", invalid, err)
+		}
+	}
+}
+
+func TestIDShort(t *testing.T) {
+	for name, expected := range map[string]string{
+		"temperature": "temperature",
+		"set-point_2": "set-point_2",
+		"1st":         "x1st",
+		"_private":    "x_private",
+		"flow rate":   "flow_rate",
+		"":            "x",
+	} {
+		if got := IDShort(name); got != expected {
+			t.Errorf("Expected IDShort(%q) to be %q, got %q", name, expected, got)
+		}
+	}
+}
+
+func newPump() (*registry.Registry, *twin.DigitalTwin) {
+	reg := registry.NewRegistry()
+	dt := twin.NewDigitalTwin("pump-1", "pump")
+	dt.SetAttribute("manufacturer", "Acme")
+	dt.SetAttribute("location", map[string]interface{}{"floor": 2.0})
+	dt.SetAttribute("globalAssetId", "https://acme.example/pumps/42")
+	motor := twin.NewFeatureState()
+	motor.SetProperty("speed", 1450.0)
+	motor.SetProperty("running", true)
+	motor.SetProperty("modes", []interface{}{"eco", "boost"})
+	dt.AddFeature("motor", motor)
+	dt.AddRelationship("feeds", "tank-1")
+	reg.Create(dt)
+	return reg, dt
+}
+
+func TestNewShell(t *testing.T) {
+	_, dt := newPump()
+
+	shell := NewShell(dt)
+	if shell.ID != ShellID("pump-1") || shell.IDShort != "pump-1" || shell.AssetInformation.AssetType != "pump" {
+		t.Errorf("Unexpected shell %+v", shell)
+	}
+	if shell.AssetInformation.GlobalAssetID != "https://acme.example/pumps/42" {
+		t.Errorf("Expected the global asset ID from the attribute, got %q", shell.AssetInformation.GlobalAssetID)
+	}
+
+	var refs []string
+	for _, ref := range shell.Submodels {
+		refs = append(refs, ref.Keys[0].Value)
+	}
+	expected := []string{
+		SubmodelID("pump-1", AttributesSubmodel),
+		SubmodelID("pump-1", RelationshipsSubmodel),
+		FeatureSubmodelID("pump-1", "motor"),
+	}
+	if !reflect.DeepEqual(refs, expected) {
+		t.Errorf("Expected submodel references %v, got %v", expected, refs)
+	}
+}
+
+func TestGetSubmodel(t *testing.T) {
+	reg, _ := newPump()
+
+	_, sm, err := GetSubmodel(reg, FeatureSubmodelID("pump-1", "motor"))
+	if err != nil {
+		t.Fatalf("Failed to get submodel: %v", err)
+	}
+	expected := []Element{
+		{ModelType: TypeProperty, IDShort: "modes", ValueType: "xs:string", Value: `["eco","boost"]`},
+		{ModelType: TypeProperty, IDShort: "running", ValueType: "xs:boolean", Value: "true"},
+		{ModelType: TypeProperty, IDShort: "speed", ValueType: "xs:double", Value: "1450"},
+	}
+	if sm.IDShort != "motor" || !reflect.DeepEqual(sm.SubmodelElements, expected) {
+		t.Errorf("Unexpected submodel %+v", sm)
+	}
+
+	_, sm, _ = GetSubmodel(reg, SubmodelID("pump-1", AttributesSubmodel))
+	floor, err := FindElement(sm.SubmodelElements, "location.floor")
+	if err != nil || Value(floor) != 2.0 {
+		t.Errorf("Expected the nested floor, got %+v (%v)", floor, err)
+	}
+	if _, err := FindElement(sm.SubmodelElements, "manufacturer.name"); err != ErrElementNotFound {
+		t.Errorf("Expected ErrElementNotFound, got %v", err)
+	}
+
+	_, sm, _ = GetSubmodel(reg, SubmodelID("pump-1", RelationshipsSubmodel))
+	if tank, err := FindElement(sm.SubmodelElements, "feeds.tank-1"); err != nil || Value(tank) != ShellID("tank-1") {
+		t.Errorf("Expected a reference to the tank shell, got %+v (%v)", tank, err)
+	}
+
+	if _, _, err := GetSubmodel(reg, FeatureSubmodelID("pump-1", "missing")); err != twin.ErrFeatureNotFound {
+		t.Errorf("Expected ErrFeatureNotFound, got %v", err)
+	}
+	if _, _, err := GetSubmodel(reg, FeatureSubmodelID("missing", "motor")); err != registry.ErrTwinNotFound {
+		t.Errorf("Expected ErrTwinNotFound, got %v", err)
+	}
+}
+
+func TestElementJSON(t *testing.T) {
+	min, max := "0", "10"
+	elements := []Element{
+		{ModelType: TypeProperty, IDShort: "speed", ValueType: "xs:int", Value: "12"},
+		{ModelType: TypeCollection, IDShort: "location", Value: []Element{
+			{ModelType: TypeProperty, IDShort: "floor", ValueType: "xs:string", Value: "2"},
+		}},
+		{ModelType: TypeMultiLanguage, IDShort: "name", Value: []LangString{{Language: "en", Text: "Pump"}, {Language: "de", Text: "Pumpe"}}},
+		{ModelType: TypeRange, IDShort: "limits", ValueType: "xs:double", Min: &min, Max: &max},
+		{ModelType: TypeReferenceElement, IDShort: "tank", Value: modelReference(TypeShell, "urn:tank")},
+		{ModelType: "File", IDShort: "manual"},
+	}
+	data, err := json.Marshal(elements)
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	var decoded []Element
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, elements) {
+		t.Errorf("Expected %+v, got %+v", elements, decoded)
+	}
+
+	values := make(map[string]interface{})
+	for _, e := range decoded {
+		values[e.IDShort] = Value(e)
+	}
+	expected := map[string]interface{}{
+		"speed":    12.0,
+		"location": map[string]interface{}{"floor": "2"},
+		"name":     map[string]interface{}{"en": "Pump", "de": "Pumpe"},
+		"limits":   map[string]interface{}{"min": 0.0, "max": 10.0},
+		"tank":     "urn:tank",
+		"manual":   nil,
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected values %v, got %v", expected, values)
+	}
+
+	var invalid Element
+	if err := json.Unmarshal([]byte(`{"modelType": "Property", "value": 1}`), &invalid); err == nil {
+		t.Error("Expected an error for a non-string property value")
+	}
+}
+
+func TestSetValue(t *testing.T) {
+	_, dt := newPump()
+
+	// Lexical forms are converted to the type of the current value
+	if name, err := SetValue(dt, featuresSegment, "motor", "speed", "1500"); err != nil || name != "speed" {
+		t.Fatalf("Failed to set value: %q %v", name, err)
+	}
+	motor, _ := dt.GetFeature("motor")
+	if speed, _ := motor.GetProperty("speed"); speed != 1500.0 {
+		t.Errorf("Expected speed 1500, got %v", speed)
+	}
+	if _, err := SetValue(dt, AttributesSubmodel, "", "manufacturer", "Globex"); err != nil {
+		t.Fatalf("Failed to set attribute: %v", err)
+	}
+	if manufacturer, _ := dt.GetAttribute("manufacturer"); manufacturer != "Globex" {
+		t.Errorf("Expected the new manufacturer, got %v", manufacturer)
+	}
+
+	for _, c := range []struct {
+		kind, feature, path string
+		value               interface{}
+		err                 error
+	}{
+		{featuresSegment, "motor", "torque", 1.0, ErrElementNotFound},
+		{featuresSegment, "pump", "speed", 1.0, twin.ErrFeatureNotFound},
+		{AttributesSubmodel, "", "location.floor", 3.0, ErrInvalidValue},
+		{AttributesSubmodel, "", "location", 3.0, ErrInvalidValue},
+		{AttributesSubmodel, "", "manufacturer", map[string]interface{}{}, ErrInvalidValue},
+		{RelationshipsSubmodel, "", "feeds", "tank-2", ErrInvalidValue},
+	} {
+		if _, err := SetValue(dt, c.kind, c.feature, c.path, c.value); !errors.Is(err, c.err) {
+			t.Errorf("Expected %v for %s %s, got %v", c.err, c.kind, c.path, err)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package aas
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// ErrInvalidPackage is returned for unreadable AASX packages and environments
+var ErrInvalidPackage = errors.New("invalid AAS package")
+
+// Relationship types of AASX packages
+const (
+	originRelationship = "http://admin-shell.io/aasx/relationships/aasx-origin"
+	specRelationship   = "http://admin-shell.io/aasx/relationships/aas-spec"
+)
+
+// Environment holds the shells and submodels of a package
+type Environment struct {
+	Shells    []Shell    `json:"assetAdministrationShells"`
+	Submodels []Submodel `json:"submodels"`
+}
+
+// Submodel returns a submodel of the environment by its identifier
+func (env *Environment) Submodel(id string) (Submodel, bool) {
+	for _, sm := range env.Submodels {
+		if sm.ID == id {
+			return sm, true
+		}
+	}
+	return Submodel{}, false
+}
+
+// ReadJSON reads an environment in the JSON serialization
+func ReadJSON(r io.Reader) (*Environment, error) {
+	var env Environment
+	if err := json.NewDecoder(r).Decode(&env); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPackage, err)
+	}
+	return &env, nil
+}
+
+// ReadPackage reads the environments of an AASX package, an Open Packaging
+// Conventions archive whose origin part refers to AAS specification parts
+// in the JSON or XML serialization. The shells and submodels of all
+// specification parts are combined.
+func ReadPackage(data []byte) (*Environment, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPackage, err)
+	}
+	files := make(map[string]*zip.File, len(archive.File))
+	for _, f := range archive.File {
+		files[strings.TrimPrefix(f.Name, "/")] = f
+	}
+
+	origins, err := readRelationships(files, "_rels/.rels", "", originRelationship)
+	if err != nil {
+		return nil, err
+	}
+	if len(origins) == 0 {
+		return nil, fmt.Errorf("%w: no aasx-origin relationship", ErrInvalidPackage)
+	}
+	origin := origins[0]
+	specs, err := readRelationships(files, path.Join(path.Dir(origin), "_rels", path.Base(origin)+".rels"), path.Dir(origin), specRelationship)
+	if err != nil {
+		return nil, err
+	}
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("%w: no aas-spec relationship", ErrInvalidPackage)
+	}
+
+	combined := &Environment{}
+	for _, spec := range specs {
+		f, ok := files[spec]
+		if !ok {
+			return nil, fmt.Errorf("%w: missing part %s", ErrInvalidPackage, spec)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPackage, err)
+		}
+
+		var env *Environment
+		switch strings.ToLower(path.Ext(spec)) {
+		case ".json":
+			env, err = ReadJSON(rc)
+		case ".xml":
+			env, err = ReadXML(rc)
+		default:
+			err = fmt.Errorf("%w: unsupported part %s", ErrInvalidPackage, spec)
+		}
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		combined.Shells = append(combined.Shells, env.Shells...)
+		combined.Submodels = append(combined.Submodels, env.Submodels...)
+	}
+	return combined, nil
+}
+
+// readRelationships returns the targets of the relationships of a type in
+// a relationships part, resolved against a directory. A missing part has
+// no relationships.
+func readRelationships(files map[string]*zip.File, name, dir, relType string) ([]string, error) {
+	f, ok := files[name]
+	if !ok {
+		return nil, nil
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPackage, err)
+	}
+	defer rc.Close()
+
+	var rels struct {
+		Relationships []struct {
+			Type   string `xml:"Type,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := xml.NewDecoder(rc).Decode(&rels); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidPackage, name, err)
+	}
+
+	var targets []string
+	for _, rel := range rels.Relationships {
+		if rel.Type != relType {
+			continue
+		}
+		target := rel.Target
+		if !strings.HasPrefix(target, "/") {
+			target = path.Join(dir, target)
+		}
+		targets = append(targets, strings.TrimPrefix(path.Clean(target), "/"))
+	}
+	return targets, nil
+}
+
+// xmlNode is an element of an XML document
+type xmlNode struct {
+	Name     string
+	Text     string
+	Children []*xmlNode
+}
+
+// child returns the first child element with a name
+func (n *xmlNode) child(name string) *xmlNode {
+	for _, c := range n.Children {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// text returns the text of the first child element with a name
+func (n *xmlNode) text(name string) string {
+	if c := n.child(name); c != nil {
+		return c.Text
+	}
+	return ""
+}
+
+// ReadXML reads an environment in the XML serialization
+func ReadXML(r io.Reader) (*Environment, error) {
+	root, err := parseXML(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPackage, err)
+	}
+	if root.Name != "environment" {
+		return nil, fmt.Errorf("%w: unexpected root element %s", ErrInvalidPackage, root.Name)
+	}
+
+	env := &Environment{}
+	if shells := root.child("assetAdministrationShells"); shells != nil {
+		for _, n := range shells.Children {
+			shell := Shell{
+				ModelType: TypeShell,
+				ID:        n.text("id"),
+				IDShort:   n.text("idShort"),
+			}
+			if info := n.child("assetInformation"); info != nil {
+				shell.AssetInformation = AssetInformation{
+					AssetKind:     info.text("assetKind"),
+					GlobalAssetID: info.text("globalAssetId"),
+					AssetType:     info.text("assetType"),
+				}
+			}
+			if refs := n.child("submodels"); refs != nil {
+				for _, ref := range refs.Children {
+					shell.Submodels = append(shell.Submodels, *xmlReference(ref))
+				}
+			}
+			env.Shells = append(env.Shells, shell)
+		}
+	}
+	if submodels := root.child("submodels"); submodels != nil {
+		for _, n := range submodels.Children {
+			sm := Submodel{
+				ModelType:        TypeSubmodel,
+				ID:               n.text("id"),
+				IDShort:          n.text("idShort"),
+				Kind:             n.text("kind"),
+				SubmodelElements: []Element{},
+			}
+			if children := n.child("submodelElements"); children != nil {
+				sm.SubmodelElements = xmlElements(children)
+			}
+			env.Submodels = append(env.Submodels, sm)
+		}
+	}
+	return env, nil
+}
+
+// parseXML reads a document into a tree of elements, ignoring namespaces
+func parseXML(r io.Reader) (*xmlNode, error) {
+	decoder := xml.NewDecoder(r)
+	var stack []*xmlNode
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil, errors.New("no root element")
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			n := &xmlNode{Name: t.Name.Local}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, n)
+			}
+			stack = append(stack, n)
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].Text += string(t)
+			}
+		case xml.EndElement:
+			n := stack[len(stack)-1]
+			n.Text = strings.TrimSpace(n.Text)
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				return n, nil
+			}
+		}
+	}
+}
+
+// xmlReference converts a reference element
+func xmlReference(n *xmlNode) *Reference {
+	ref := &Reference{Type: n.text("type"), Keys: []Key{}}
+	if keys := n.child("keys"); keys != nil {
+		for _, k := range keys.Children {
+			ref.Keys = append(ref.Keys, Key{Type: k.text("type"), Value: k.text("value")})
+		}
+	}
+	return ref
+}
+
+// xmlElements converts the submodel elements of a container. The element
+// name gives the model type, such as property for Property.
+func xmlElements(container *xmlNode) []Element {
+	result := make([]Element, 0, len(container.Children))
+	for _, n := range container.Children {
+		e := Element{
+			ModelType: strings.ToUpper(n.Name[:1]) + n.Name[1:],
+			IDShort:   n.text("idShort"),
+			ValueType: n.text("valueType"),
+		}
+
+		value := n.child("value")
+		switch e.ModelType {
+		case TypeProperty:
+			if value != nil {
+				e.Value = value.Text
+			}
+		case TypeCollection, "SubmodelElementList":
+			if value != nil {
+				e.Value = xmlElements(value)
+			} else {
+				e.Value = []Element{}
+			}
+		case TypeMultiLanguage:
+			texts := []LangString{}
+			if value != nil {
+				for _, s := range value.Children {
+					texts = append(texts, LangString{Language: s.text("language"), Text: s.text("text")})
+				}
+			}
+			e.Value = texts
+		case TypeRange:
+			if min := n.child("min"); min != nil {
+				e.Min = &min.Text
+			}
+			if max := n.child("max"); max != nil {
+				e.Max = &max.Text
+			}
+		case TypeReferenceElement:
+			if value != nil {
+				e.Value = xmlReference(value)
+			}
+		}
+		result = append(result, e)
+	}
+	return result
+}
@@ -0,0 +1,167 @@
+package aas
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// environmentXML is an environment with a shell and a nameplate submodel
+const environmentXML = `<?xml version="1.0" encoding="UTF-8"?>
+<environment xmlns="https://admin-shell.io/aas/3/0">
+  <assetAdministrationShells>
+    <assetAdministrationShell>
+      <idShort>Pump42</idShort>
+      <id>https://acme.example/aas/pump42</id>
+      <assetInformation>
+        <assetKind>Instance</assetKind>
+        <globalAssetId>https://acme.example/pumps/42</globalAssetId>
+        <assetType>pump</assetType>
+      </assetInformation>
+      <submodels>
+        <reference>
+          <type>ModelReference</type>
+          <keys><key><type>Submodel</type><value>https://acme.example/sm/nameplate</value></key></keys>
+        </reference>
+      </submodels>
+    </assetAdministrationShell>
+  </assetAdministrationShells>
+  <submodels>
+    <submodel>
+      <idShort>Nameplate</idShort>
+      <id>https://acme.example/sm/nameplate</id>
+      <kind>Instance</kind>
+      <submodelElements>
+        <multiLanguageProperty>
+          <idShort>ManufacturerName</idShort>
+          <value>
+            <langStringTextType><language>en</language><text>Acme</text></langStringTextType>
+          </value>
+        </multiLanguageProperty>
+        <property>
+          <idShort>YearOfConstruction</idShort>
+          <valueType>xs:integer</valueType>
+          <value>2024</value>
+        </property>
+        <submodelElementCollection>
+          <idShort>Address</idShort>
+          <value>
+            <property><idShort>City</idShort><valueType>xs:string</valueType><value>Berlin</value></property>
+          </value>
+        </submodelElementCollection>
+        <range>
+          <idShort>Pressure</idShort>
+          <valueType>xs:double</valueType>
+          <min>1.5</min>
+          <max>6</max>
+        </range>
+      </submodelElements>
+    </submodel>
+  </submodels>
+</environment>
+`
+
+func TestReadXML(t *testing.T) {
+	env, err := ReadXML(strings.NewReader(environmentXML))
+	if err != nil {
+		t.Fatalf("Failed to read environment: %v", err)
+	}
+	if len(env.Shells) != 1 || len(env.Submodels) != 1 {
+		t.Fatalf("Unexpected environment %+v", env)
+	}
+
+	shell := env.Shells[0]
+	expected := AssetInformation{AssetKind: "Instance", GlobalAssetID: "https://acme.example/pumps/42", AssetType: "pump"}
+	if shell.IDShort != "Pump42" || shell.AssetInformation != expected {
+		t.Errorf("Unexpected shell %+v", shell)
+	}
+	if len(shell.Submodels) != 1 || shell.Submodels[0].Keys[0].Value != "https://acme.example/sm/nameplate" {
+		t.Errorf("Unexpected submodel references %+v", shell.Submodels)
+	}
+
+	sm, ok := env.Submodel("https://acme.example/sm/nameplate")
+	if !ok {
+		t.Fatal("Expected the nameplate submodel")
+	}
+	expectedValues := map[string]interface{}{
+		"ManufacturerName":   map[string]interface{}{"en": "Acme"},
+		"YearOfConstruction": 2024.0,
+		"Address":            map[string]interface{}{"City": "Berlin"},
+		"Pressure":           map[string]interface{}{"min": 1.5, "max": 6.0},
+	}
+	if got := values(sm.SubmodelElements); !reflect.DeepEqual(got, expectedValues) {
+		t.Errorf("Expected values %v, got %v", expectedValues, got)
+	}
+
+	for _, invalid := range []string{"", "<environment>", "<shells/>"} {
+		if _, err := ReadXML(strings.NewReader(invalid)); !errors.Is(err, ErrInvalidPackage) {
+			t.Errorf("Expected ErrInvalidPackage for %q, got %v", invalid, err)
+		}
+	}
+}
+
+// newPackage returns an AASX package with the given parts
+func newPackage(t *testing.T, parts map[string]string) []byte {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for name, content := range parts {
+		f, err := archive.Create(name)
+		if err != nil {
+			t.Fatalf("Failed to create part: %v", err)
+		}
+		f.Write([]byte(content))
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("Failed to write package: %v", err)
+	}
+	return buf.Bytes()
+}
+
+const (
+	rootRels = `<?xml version="1.0" encoding="utf-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+  <Relationship Type="http://admin-shell.io/aasx/relationships/aasx-origin" Target="/aasx/aasx-origin" Id="r0"/>
+</Relationships>`
+	originRels = `<?xml version="1.0" encoding="utf-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+  <Relationship Type="http://admin-shell.io/aasx/relationships/aas-spec" Target="data/pump.aas.xml" Id="r1"/>
+  <Relationship Type="http://admin-shell.io/aasx/relationships/aas-spec" Target="/aasx/tank.aas.json" Id="r2"/>
+</Relationships>`
+	tankJSON = `{"assetAdministrationShells": [{"modelType": "AssetAdministrationShell", "id": "urn:tank", "idShort": "Tank", "assetInformation": {"assetKind": "Instance"}}]}`
+)
+
+func TestReadPackage(t *testing.T) {
+	data := newPackage(t, map[string]string{
+		"[Content_Types].xml":         `<Types/>`,
+		"_rels/.rels":                 rootRels,
+		"aasx/aasx-origin":            "Intentionally empty.",
+		"aasx/_rels/aasx-origin.rels": originRels,
+		"aasx/data/pump.aas.xml":      environmentXML,
+		"aasx/tank.aas.json":          tankJSON,
+	})
+
+	env, err := ReadPackage(data)
+	if err != nil {
+		t.Fatalf("Failed to read package: %v", err)
+	}
+	if len(env.Shells) != 2 || env.Shells[0].IDShort != "Pump42" || env.Shells[1].IDShort != "Tank" || len(env.Submodels) != 1 {
+		t.Errorf("Expected the shells of both parts, got %+v", env)
+	}
+
+	for name, parts := range map[string]map[string]string{
+		"no origin":    {"_rels/.rels": `<Relationships/>`},
+		"no spec":      {"_rels/.rels": rootRels},
+		"missing part": {"_rels/.rels": rootRels, "aasx/_rels/aasx-origin.rels": originRels},
+		"invalid rels": {"_rels/.rels": "<Relationships"},
+	} {
+		if _, err := ReadPackage(newPackage(t, parts)); !errors.Is(err, ErrInvalidPackage) {
+			t.Errorf("Expected ErrInvalidPackage for %s, got %v", name, err)
+		}
+	}
+	if _, err := ReadPackage([]byte("not a zip")); !errors.Is(err, ErrInvalidPackage) {
+		t.Errorf("Expected ErrInvalidPackage, got %v", err)
+	}
+}
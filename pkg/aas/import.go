@@ -0,0 +1,209 @@
+package aas
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/aleka07/go-digital-twin/pkg/reconcile"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// DefaultType is the type of twins imported from shells without an asset type
+const DefaultType = "asset"
+
+// Options configures an import
+type Options struct {
+	Prefix string // Prepended to twin IDs
+	DryRun bool   // Report the changes without applying them
+}
+
+// Report summarizes an import
+type Report struct {
+	Created   []string            `json:"created"`
+	Updated   []string            `json:"updated"`
+	Unchanged []string            `json:"unchanged"`
+	Failed    []reconcile.Failure `json:"failed"`
+	DryRun    bool                `json:"dryRun"`
+}
+
+// Import creates or updates a twin for each shell of an environment.
+//
+// Shells exported by this server keep their twin IDs, attributes,
+// relationships and features. Other shells become twins named after their
+// idShort and typed after their asset type, with the shell and global
+// asset identifiers as attributes and a feature per submodel whose
+// properties are the values of its elements. Imports only add and change
+// values; nothing is removed from existing twins.
+func Import(reg *registry.Registry, env *Environment, opts Options) *Report {
+	report := &Report{
+		Created:   []string{},
+		Updated:   []string{},
+		Unchanged: []string{},
+		Failed:    []reconcile.Failure{},
+		DryRun:    opts.DryRun,
+	}
+
+	for _, shell := range env.Shells {
+		id, err := twinID(shell, opts.Prefix)
+		if err != nil {
+			report.Failed = append(report.Failed, reconcile.Failure{ID: shell.ID, Error: err.Error()})
+			continue
+		}
+
+		dt, err := reg.Get(id)
+		created := errors.Is(err, registry.ErrTwinNotFound)
+		switch {
+		case created:
+			twinType := shell.AssetInformation.AssetType
+			if twinType == "" {
+				twinType = DefaultType
+			}
+			dt = twin.NewDigitalTwin(id, twinType)
+			dt.SetSystem(twin.SystemSource, "aas")
+		case err != nil:
+			report.Failed = append(report.Failed, reconcile.Failure{ID: id, Error: err.Error()})
+			continue
+		default:
+			// The registry returns the stored twin, which must not change in dry runs
+			dt = dt.Clone()
+		}
+
+		before := snapshot(dt)
+		if err := apply(dt, shell, env, opts.Prefix); err != nil {
+			report.Failed = append(report.Failed, reconcile.Failure{ID: id, Error: err.Error()})
+			continue
+		}
+		if !created && reflect.DeepEqual(before, snapshot(dt)) {
+			report.Unchanged = append(report.Unchanged, id)
+			continue
+		}
+
+		if !opts.DryRun {
+			save := reg.Update
+			if created {
+				save = reg.Create
+			}
+			if err := save(dt); err != nil {
+				report.Failed = append(report.Failed, reconcile.Failure{ID: id, Error: err.Error()})
+				continue
+			}
+		}
+		if created {
+			report.Created = append(report.Created, id)
+		} else {
+			report.Updated = append(report.Updated, id)
+		}
+	}
+	return report
+}
+
+// twinID returns the ID of the twin of a shell
+func twinID(shell Shell, prefix string) (string, error) {
+	if id, err := ParseShellID(shell.ID); err == nil {
+		return prefix + id, nil
+	}
+	if shell.IDShort == "" {
+		return "", fmt.Errorf("%w: shell %q has no idShort", ErrInvalidIdentifier, shell.ID)
+	}
+	return prefix + shell.IDShort, nil
+}
+
+// apply sets the attributes, relationships and features of a shell's submodels on a twin
+func apply(dt *twin.DigitalTwin, shell Shell, env *Environment, prefix string) error {
+	if _, err := ParseShellID(shell.ID); err != nil {
+		dt.SetAttribute("aasId", shell.ID)
+	}
+	if shell.AssetInformation.GlobalAssetID != "" {
+		dt.SetAttribute("globalAssetId", shell.AssetInformation.GlobalAssetID)
+	}
+
+	for _, ref := range shell.Submodels {
+		if len(ref.Keys) == 0 {
+			continue
+		}
+		sm, ok := env.Submodel(ref.Keys[len(ref.Keys)-1].Value)
+		if !ok {
+			continue
+		}
+
+		_, kind, featureID, err := ParseSubmodelID(sm.ID)
+		switch {
+		case err == nil && kind == AttributesSubmodel:
+			// System attributes exported by another server are its own
+			for name, value := range values(sm.SubmodelElements) {
+				if !twin.IsReservedAttribute(name) {
+					dt.SetAttribute(name, value)
+				}
+			}
+			continue
+		case err == nil && kind == RelationshipsSubmodel:
+			if err := applyRelationships(dt, sm.SubmodelElements, prefix); err != nil {
+				return err
+			}
+			continue
+		case err != nil:
+			featureID = sm.IDShort
+		}
+		if featureID == "" {
+			return fmt.Errorf("%w: submodel %q has no idShort", ErrInvalidIdentifier, sm.ID)
+		}
+
+		feature, exists := dt.GetFeature(featureID)
+		if !exists {
+			feature = twin.NewFeatureState()
+			if err := dt.AddFeature(featureID, feature); err != nil {
+				return err
+			}
+		}
+		for name, value := range values(sm.SubmodelElements) {
+			if current, ok := feature.GetProperty(name); !ok || !reflect.DeepEqual(current, value) {
+				feature.SetProperty(name, value)
+			}
+		}
+	}
+	return nil
+}
+
+// values returns the value-only form of elements by idShort, leaving out
+// elements without values
+func values(elements []Element) map[string]interface{} {
+	result := make(map[string]interface{}, len(elements))
+	for _, e := range elements {
+		if value := Value(e); value != nil && e.IDShort != "" {
+			result[e.IDShort] = value
+		}
+	}
+	return result
+}
+
+// applyRelationships adds the targets of the references in a relationships submodel
+func applyRelationships(dt *twin.DigitalTwin, elements []Element, prefix string) error {
+	for _, collection := range elements {
+		refs, _ := collection.Value.([]Element)
+		for _, e := range refs {
+			ref, ok := e.Value.(*Reference)
+			if !ok || len(ref.Keys) == 0 {
+				continue
+			}
+			target, err := ParseShellID(ref.Keys[len(ref.Keys)-1].Value)
+			if err != nil {
+				continue
+			}
+			if err := dt.AddRelationship(collection.IDShort, prefix+target); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// snapshot returns the imported state of a twin for change detection
+func snapshot(dt *twin.DigitalTwin) []interface{} {
+	features := make(map[string]map[string]interface{})
+	for id, feature := range dt.GetAllFeatures() {
+		features[id] = feature.GetAllProperties()
+	}
+	return []interface{}{dt.GetAllAttributes(), dt.GetAllRelationships(), features}
+}
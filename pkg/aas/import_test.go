@@ -0,0 +1,113 @@
+package aas
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestImportRoundTrip(t *testing.T) {
+	reg, dt := newPump()
+
+	// Export the pump as an environment
+	env := Environment{Shells: []Shell{NewShell(dt)}, Submodels: NewSubmodels(reg, dt)}
+	data, err := json.Marshal(env)
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	decoded, err := ReadJSON(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to read environment: %v", err)
+	}
+
+	target := registry.NewRegistry()
+	report := Import(target, decoded, Options{DryRun: true})
+	if !reflect.DeepEqual(report.Created, []string{"pump-1"}) || target.Count() != 0 {
+		t.Errorf("Unexpected dry run %+v", report)
+	}
+
+	report = Import(target, decoded, Options{})
+	if !reflect.DeepEqual(report.Created, []string{"pump-1"}) || len(report.Failed) != 0 {
+		t.Fatalf("Unexpected report %+v", report)
+	}
+	imported, err := target.Get("pump-1")
+	if err != nil {
+		t.Fatalf("Expected the imported twin: %v", err)
+	}
+	attributes := imported.GetAllAttributes()
+	delete(attributes, twin.SystemAttribute)
+	if imported.Type != "pump" || !reflect.DeepEqual(attributes, dt.GetAllAttributes()) {
+		t.Errorf("Unexpected attributes %v", imported.GetAllAttributes())
+	}
+	if source, _ := imported.GetSystem(twin.SystemSource); source != "aas" {
+		t.Errorf("Expected the aas source, got %v", source)
+	}
+	if !reflect.DeepEqual(imported.GetAllRelationships(), dt.GetAllRelationships()) {
+		t.Errorf("Unexpected relationships %v", imported.GetAllRelationships())
+	}
+	motor, _ := imported.GetFeature("motor")
+	expected := map[string]interface{}{"speed": 1450.0, "running": true, "modes": `["eco","boost"]`}
+	if motor == nil || !reflect.DeepEqual(motor.GetAllProperties(), expected) {
+		t.Errorf("Expected the motor properties %v, got %+v", expected, motor)
+	}
+
+	// Importing again changes nothing
+	report = Import(target, decoded, Options{})
+	if !reflect.DeepEqual(report.Unchanged, []string{"pump-1"}) {
+		t.Errorf("Expected an unchanged twin, got %+v", report)
+	}
+}
+
+func TestImportForeignShells(t *testing.T) {
+	env, err := ReadXML(strings.NewReader(environmentXML))
+	if err != nil {
+		t.Fatalf("Failed to read environment: %v", err)
+	}
+	env.Shells = append(env.Shells, Shell{ID: "urn:anonymous"})
+
+	reg := registry.NewRegistry()
+	report := Import(reg, env, Options{Prefix: "acme-"})
+	if !reflect.DeepEqual(report.Created, []string{"acme-Pump42"}) || len(report.Failed) != 1 || report.Failed[0].ID != "urn:anonymous" {
+		t.Fatalf("Unexpected report %+v", report)
+	}
+
+	dt, _ := reg.Get("acme-Pump42")
+	if dt.Type != "pump" {
+		t.Errorf("Expected the asset type, got %q", dt.Type)
+	}
+	if id, _ := dt.GetAttribute("aasId"); id != "https://acme.example/aas/pump42" {
+		t.Errorf("Expected the shell identifier, got %v", id)
+	}
+	nameplate, ok := dt.GetFeature("Nameplate")
+	if !ok {
+		t.Fatal("Expected a nameplate feature")
+	}
+	if year, _ := nameplate.GetProperty("YearOfConstruction"); year != 2024.0 {
+		t.Errorf("Expected the year of construction, got %v", year)
+	}
+
+	// Changed values update the twin, leaving other features alone
+	dt.AddFeature("status", twin.NewFeatureState())
+	reg.Update(dt)
+	env.Submodels[0].SubmodelElements[1].Value = "2025"
+	report = Import(reg, env, Options{Prefix: "acme-"})
+	if !reflect.DeepEqual(report.Updated, []string{"acme-Pump42"}) {
+		t.Errorf("Expected an updated twin, got %+v", report)
+	}
+	if year, _ := nameplate.GetProperty("YearOfConstruction"); year != 2024.0 {
+		t.Error("Expected the previous twin to be left unchanged")
+	}
+	dt, _ = reg.Get("acme-Pump42")
+	if _, ok := dt.GetFeature("status"); !ok {
+		t.Error("Expected other features to be kept")
+	}
+	nameplate, _ = dt.GetFeature("Nameplate")
+	if year, _ := nameplate.GetProperty("YearOfConstruction"); year != 2025.0 {
+		t.Errorf("Expected the new year of construction, got %v", year)
+	}
+}
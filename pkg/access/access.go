@@ -0,0 +1,211 @@
+// Package access logs reads of sensitive twins: who fetched what and when.
+// Mutations are attributed on the twins themselves, but some regulated
+// deployments must also be able to tell who looked at a twin. Only twins
+// with a policy are logged, and a policy may sample reads to bound the
+// volume of busy twins.
+package access
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Common errors
+var (
+	ErrPolicyNotFound = errors.New("access policy not found")
+	ErrInvalidPolicy  = errors.New("invalid access policy")
+)
+
+// ReadTopic is the topic of the events published for logged reads
+const ReadTopic = "access.read"
+
+// MaxEntries is the number of entries kept per twin; older entries are
+// dropped, so a log writer should be set where entries must be retained
+const MaxEntries = 1000
+
+// Policy designates a twin whose reads are logged
+type Policy struct {
+	TwinID     string  `json:"twinId"`
+	SampleRate float64 `json:"sampleRate"` // Fraction of reads logged, all of them when 1
+}
+
+// Entry records a read of a twin
+type Entry struct {
+	TwinID     string    `json:"twinId"`
+	User       string    `json:"user,omitempty"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Status     int       `json:"status"`
+	RemoteAddr string    `json:"remoteAddr,omitempty"`
+	Time       time.Time `json:"time"`
+}
+
+// Manager keeps the access policies and the entries logged for them
+type Manager struct {
+	policies map[string]Policy
+	entries  map[string][]Entry // Oldest first, at most MaxEntries per twin
+	writer   io.Writer
+	sample   func() float64
+	mutex    sync.RWMutex
+}
+
+// NewManager creates a new access manager without policies
+func NewManager() *Manager {
+	return &Manager{
+		policies: make(map[string]Policy),
+		entries:  make(map[string][]Entry),
+		sample:   rand.Float64,
+	}
+}
+
+// SetWriter sets a writer every logged entry is written to as a line of
+// JSON, such as an append-only file kept for auditors
+func (m *Manager) SetWriter(w io.Writer) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.writer = w
+}
+
+// Set declares a policy, replacing any previous one of its twin. A zero
+// sample rate logs every read.
+func (m *Manager) Set(p Policy) (Policy, error) {
+	if p.TwinID == "" {
+		return Policy{}, fmt.Errorf("%w: twin ID is required", ErrInvalidPolicy)
+	}
+	if p.SampleRate == 0 {
+		p.SampleRate = 1
+	}
+	if p.SampleRate < 0 || p.SampleRate > 1 {
+		return Policy{}, fmt.Errorf("%w: sample rate must be between 0 and 1", ErrInvalidPolicy)
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.policies[p.TwinID] = p
+	return p, nil
+}
+
+// Get returns the policy of a twin
+func (m *Manager) Get(twinID string) (Policy, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	p, exists := m.policies[twinID]
+	if !exists {
+		return Policy{}, ErrPolicyNotFound
+	}
+	return p, nil
+}
+
+// List returns all policies sorted by twin ID
+func (m *Manager) List() []Policy {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	result := make([]Policy, 0, len(m.policies))
+	for _, p := range m.policies {
+		result = append(result, p)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].TwinID < result[j].TwinID })
+	return result
+}
+
+// Delete removes the policy of a twin. Its logged entries are kept.
+func (m *Manager) Delete(twinID string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, exists := m.policies[twinID]; !exists {
+		return ErrPolicyNotFound
+	}
+	delete(m.policies, twinID)
+	return nil
+}
+
+// Audited reports whether reads of a twin are logged
+func (m *Manager) Audited(twinID string) bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	_, exists := m.policies[twinID]
+	return exists
+}
+
+// Record logs a read if its twin has a policy and the read is sampled, and
+// reports whether it was logged
+func (m *Manager) Record(e Entry) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	p, exists := m.policies[e.TwinID]
+	if !exists || (p.SampleRate < 1 && m.sample() >= p.SampleRate) {
+		return false
+	}
+
+	entries := m.entries[e.TwinID]
+	if len(entries) == MaxEntries {
+		entries = append(entries[:0:0], entries[1:]...)
+	}
+	m.entries[e.TwinID] = append(entries, e)
+
+	if m.writer != nil {
+		if line, err := json.Marshal(e); err == nil {
+			m.writer.Write(append(line, '\n'))
+		}
+	}
+	return true
+}
+
+// Log returns the entries logged for a twin since a time, oldest first
+func (m *Manager) Log(twinID string, since time.Time) []Entry {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	result := []Entry{}
+	for _, e := range m.entries[twinID] {
+		if !e.Time.Before(since) {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+// RenameTwin moves the policy and entries of a twin to its new ID. When
+// both IDs have a policy, as when twins are merged, the higher sample rate
+// is kept.
+func (m *Manager) RenameTwin(oldID, newID string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if p, exists := m.policies[oldID]; exists {
+		if existing, ok := m.policies[newID]; !ok || existing.SampleRate < p.SampleRate {
+			p.TwinID = newID
+			m.policies[newID] = p
+		}
+		delete(m.policies, oldID)
+	}
+
+	list, exists := m.entries[oldID]
+	if !exists {
+		return
+	}
+	delete(m.entries, oldID)
+	for i := range list {
+		list[i].TwinID = newID // The path still shows the ID that was read
+	}
+	list = append(append([]Entry(nil), m.entries[newID]...), list...)
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Time.Before(list[j].Time) })
+	if len(list) > MaxEntries {
+		list = list[len(list)-MaxEntries:]
+	}
+	m.entries[newID] = list
+}
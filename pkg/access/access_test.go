@@ -0,0 +1,102 @@
+package access
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPolicies(t *testing.T) {
+	m := NewManager()
+
+	p, err := m.Set(Policy{TwinID: "vault-door"})
+	if err != nil || p.SampleRate != 1 {
+		t.Fatalf("Failed to set policy: %+v %v", p, err)
+	}
+	m.Set(Policy{TwinID: "patient-monitor", SampleRate: 0.5})
+	if list := m.List(); len(list) != 2 || list[0].TwinID != "patient-monitor" {
+		t.Errorf("Unexpected policies %v", list)
+	}
+	if !m.Audited("vault-door") || m.Audited("pump-1") {
+		t.Error("Expected only twins with a policy to be audited")
+	}
+
+	for _, p := range []Policy{{}, {TwinID: "x", SampleRate: -0.1}, {TwinID: "x", SampleRate: 1.5}} {
+		if _, err := m.Set(p); !errors.Is(err, ErrInvalidPolicy) {
+			t.Errorf("%+v: expected ErrInvalidPolicy, got %v", p, err)
+		}
+	}
+
+	if err := m.Delete("vault-door"); err != nil {
+		t.Fatalf("Failed to delete policy: %v", err)
+	}
+	if _, err := m.Get("vault-door"); err != ErrPolicyNotFound {
+		t.Errorf("Expected ErrPolicyNotFound, got %v", err)
+	}
+}
+
+func TestRecord(t *testing.T) {
+	m := NewManager()
+	var out bytes.Buffer
+	m.SetWriter(&out)
+	m.Set(Policy{TwinID: "vault-door"})
+	m.Set(Policy{TwinID: "busy", SampleRate: 0.25})
+
+	now := time.Now()
+	if !m.Record(Entry{TwinID: "vault-door", User: "alice", Method: "GET", Path: "/api/v1/twins/vault-door", Status: 200, Time: now}) {
+		t.Fatal("Expected the read to be logged")
+	}
+	if m.Record(Entry{TwinID: "pump-1", Method: "GET", Time: now}) {
+		t.Error("Expected reads of twins without a policy not to be logged")
+	}
+
+	var logged Entry
+	if err := json.Unmarshal(out.Bytes(), &logged); err != nil || logged.User != "alice" {
+		t.Errorf("Expected the entry to be written as JSON, got %q", out.String())
+	}
+
+	// Reads are sampled at the rate of the policy
+	samples := []float64{0.1, 0.3, 0.2, 0.9}
+	m.sample = func() float64 {
+		s := samples[0]
+		samples = samples[1:]
+		return s
+	}
+	count := 0
+	for i := 0; i < 4; i++ {
+		if m.Record(Entry{TwinID: "busy", Method: "GET", Time: now}) {
+			count++
+		}
+	}
+	if count != 2 || len(m.Log("busy", time.Time{})) != 2 {
+		t.Errorf("Expected 2 sampled reads, got %d", count)
+	}
+
+	if entries := m.Log("vault-door", now.Add(time.Second)); len(entries) != 0 {
+		t.Errorf("Expected no entries since a later time, got %v", entries)
+	}
+
+	m.RenameTwin("vault-door", "vault-door-2")
+	if entries := m.Log("vault-door-2", time.Time{}); len(entries) != 1 || entries[0].TwinID != "vault-door-2" || !m.Audited("vault-door-2") {
+		t.Errorf("Expected the policy and log to follow the renamed twin, got %v", entries)
+	}
+	if m.Audited("vault-door") {
+		t.Error("Expected the old ID not to be audited")
+	}
+}
+
+func TestRecordKeepsNewest(t *testing.T) {
+	m := NewManager()
+	m.Set(Policy{TwinID: "vault-door"})
+
+	start := time.Now()
+	for i := 0; i < MaxEntries+5; i++ {
+		m.Record(Entry{TwinID: "vault-door", Time: start.Add(time.Duration(i) * time.Second)})
+	}
+	entries := m.Log("vault-door", time.Time{})
+	if len(entries) != MaxEntries || !entries[0].Time.Equal(start.Add(5*time.Second)) {
+		t.Errorf("Expected the newest %d entries, got %d from %v", MaxEntries, len(entries), entries[0].Time)
+	}
+}
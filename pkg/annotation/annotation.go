@@ -0,0 +1,210 @@
+package annotation
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Common errors
+var (
+	ErrAnnotationNotFound = errors.New("annotation not found")
+	ErrInvalidAnnotation  = errors.New("invalid annotation")
+)
+
+// MaxTextLength is the maximum length of an annotation's text in bytes
+const MaxTextLength = 4096
+
+// Annotation is a timestamped note an operator attaches to a twin, e.g.
+// "bearing replaced". Annotations that name a property are shown alongside
+// its history; those that do not apply to the whole twin.
+type Annotation struct {
+	ID        string    `json:"id"`
+	TwinID    string    `json:"twinId"`
+	Time      time.Time `json:"time"` // When the noted event happened, the creation time when not given
+	Text      string    `json:"text"`
+	Author    string    `json:"author"`
+	FeatureID string    `json:"featureId,omitempty"`
+	Property  string    `json:"property,omitempty"`
+	Tags      []string  `json:"tags,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// AppliesTo reports whether the annotation is about a property, either
+// naming it or applying to the whole twin
+func (a Annotation) AppliesTo(featureID, property string) bool {
+	if a.FeatureID == "" {
+		return true
+	}
+	return a.FeatureID == featureID && (a.Property == "" || a.Property == property)
+}
+
+// Filter selects annotations of a twin
+type Filter struct {
+	From      time.Time // Inclusive, unbounded when zero
+	To        time.Time // Inclusive, unbounded when zero
+	FeatureID string    // Only annotations applying to the feature and property
+	Property  string
+	Tag       string // Only annotations with the tag
+}
+
+// matches reports whether an annotation is selected by the filter
+func (f Filter) matches(a *Annotation) bool {
+	if !f.From.IsZero() && a.Time.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && a.Time.After(f.To) {
+		return false
+	}
+	if f.FeatureID != "" && !a.AppliesTo(f.FeatureID, f.Property) {
+		return false
+	}
+	if f.Tag != "" {
+		for _, tag := range a.Tags {
+			if tag == f.Tag {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// Store keeps the annotations of twins, ordered by time
+type Store struct {
+	annotations map[string][]*Annotation // Twin ID -> annotations ordered by time
+	mutex       sync.RWMutex
+	now         func() time.Time
+}
+
+// NewStore creates an empty annotation store
+func NewStore() *Store {
+	return &Store{
+		annotations: make(map[string][]*Annotation),
+		now:         time.Now,
+	}
+}
+
+// Add stores an annotation, assigning its ID and creation time
+func (s *Store) Add(a Annotation) (Annotation, error) {
+	a.Text = strings.TrimSpace(a.Text)
+	switch {
+	case a.TwinID == "":
+		return Annotation{}, fmt.Errorf("%w: twin ID is required", ErrInvalidAnnotation)
+	case a.Author == "":
+		return Annotation{}, fmt.Errorf("%w: author is required", ErrInvalidAnnotation)
+	case a.Text == "":
+		return Annotation{}, fmt.Errorf("%w: text is required", ErrInvalidAnnotation)
+	case len(a.Text) > MaxTextLength:
+		return Annotation{}, fmt.Errorf("%w: text exceeds %d bytes", ErrInvalidAnnotation, MaxTextLength)
+	case a.Property != "" && a.FeatureID == "":
+		return Annotation{}, fmt.Errorf("%w: a property requires a feature", ErrInvalidAnnotation)
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return Annotation{}, err
+	}
+
+	a.ID = hex.EncodeToString(id)
+	a.CreatedAt = s.now()
+	if a.Time.IsZero() {
+		a.Time = a.CreatedAt
+	}
+	a.Tags = append([]string(nil), a.Tags...)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	list := s.annotations[a.TwinID]
+	i := sort.Search(len(list), func(i int) bool { return list[i].Time.After(a.Time) })
+	list = append(list, nil)
+	copy(list[i+1:], list[i:])
+	stored := a
+	list[i] = &stored
+	s.annotations[a.TwinID] = list
+
+	return a, nil
+}
+
+// List returns the annotations of a twin selected by a filter, ordered by time
+func (s *Store) List(twinID string, f Filter) []Annotation {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	result := []Annotation{}
+	for _, a := range s.annotations[twinID] {
+		if f.matches(a) {
+			result = append(result, *a)
+		}
+	}
+	return result
+}
+
+// Get returns an annotation of a twin
+func (s *Store) Get(twinID, id string) (Annotation, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for _, a := range s.annotations[twinID] {
+		if a.ID == id {
+			return *a, nil
+		}
+	}
+	return Annotation{}, ErrAnnotationNotFound
+}
+
+// Delete removes an annotation of a twin
+func (s *Store) Delete(twinID, id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	list := s.annotations[twinID]
+	for i, a := range list {
+		if a.ID == id {
+			list = append(list[:i], list[i+1:]...)
+			if len(list) == 0 {
+				delete(s.annotations, twinID)
+			} else {
+				s.annotations[twinID] = list
+			}
+			return nil
+		}
+	}
+	return ErrAnnotationNotFound
+}
+
+// DeleteTwin removes all annotations of a twin
+func (s *Store) DeleteTwin(twinID string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.annotations, twinID)
+}
+
+// RenameTwin moves all annotations of a twin to its new ID, merging them in
+// time order with the annotations already kept for the new ID, as when twins
+// are merged
+func (s *Store) RenameTwin(oldID, newID string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	list, exists := s.annotations[oldID]
+	if !exists {
+		return
+	}
+	for _, a := range list {
+		a.TwinID = newID
+	}
+	delete(s.annotations, oldID)
+	if existing := s.annotations[newID]; len(existing) > 0 {
+		list = append(append([]*Annotation(nil), existing...), list...)
+		sort.SliceStable(list, func(i, j int) bool { return list[i].Time.Before(list[j].Time) })
+	}
+	s.annotations[newID] = list
+}
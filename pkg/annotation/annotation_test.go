@@ -0,0 +1,85 @@
+package annotation
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAddValidation(t *testing.T) {
+	s := NewStore()
+
+	invalid := []Annotation{
+		{Author: "alice", Text: "bearing replaced"},
+		{TwinID: "pump-1", Text: "bearing replaced"},
+		{TwinID: "pump-1", Author: "alice", Text: "  "},
+		{TwinID: "pump-1", Author: "alice", Text: strings.Repeat("x", MaxTextLength+1)},
+		{TwinID: "pump-1", Author: "alice", Text: "recalibrated", Property: "pressure"},
+	}
+	for _, a := range invalid {
+		if _, err := s.Add(a); !errors.Is(err, ErrInvalidAnnotation) {
+			t.Errorf("Expected ErrInvalidAnnotation for %+v, got %v", a, err)
+		}
+	}
+}
+
+func TestListByTimeAndProperty(t *testing.T) {
+	s := NewStore()
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	added, err := s.Add(Annotation{TwinID: "pump-1", Author: "alice", Text: " bearing replaced "})
+	if err != nil {
+		t.Fatalf("Failed to add annotation: %v", err)
+	}
+	if added.ID == "" || !added.Time.Equal(now) || added.Text != "bearing replaced" {
+		t.Errorf("Unexpected annotation %+v", added)
+	}
+
+	s.Add(Annotation{TwinID: "pump-1", Author: "bob", Text: "sensor recalibrated", Time: now.Add(-2 * time.Hour), FeatureID: "hydraulics", Property: "pressure", Tags: []string{"calibration"}})
+	s.Add(Annotation{TwinID: "pump-1", Author: "bob", Text: "motor inspected", Time: now.Add(-time.Hour), FeatureID: "motor"})
+	s.Add(Annotation{TwinID: "pump-2", Author: "bob", Text: "other twin"})
+
+	all := s.List("pump-1", Filter{})
+	if len(all) != 3 || all[0].Text != "sensor recalibrated" || all[2].Text != "bearing replaced" {
+		t.Errorf("Expected annotations ordered by time, got %+v", all)
+	}
+
+	if got := s.List("pump-1", Filter{From: now.Add(-90 * time.Minute), To: now.Add(-30 * time.Minute)}); len(got) != 1 || got[0].Text != "motor inspected" {
+		t.Errorf("Expected the annotation in the time range, got %+v", got)
+	}
+	if got := s.List("pump-1", Filter{FeatureID: "hydraulics", Property: "pressure"}); len(got) != 2 {
+		t.Errorf("Expected the property and twin-wide annotations, got %+v", got)
+	}
+	if got := s.List("pump-1", Filter{Tag: "calibration"}); len(got) != 1 || got[0].Author != "bob" {
+		t.Errorf("Expected the tagged annotation, got %+v", got)
+	}
+	if got := s.List("missing", Filter{}); got == nil || len(got) != 0 {
+		t.Errorf("Expected an empty list, got %v", got)
+	}
+
+	if err := s.Delete("pump-1", added.ID); err != nil {
+		t.Errorf("Failed to delete annotation: %v", err)
+	}
+	if _, err := s.Get("pump-1", added.ID); err != ErrAnnotationNotFound {
+		t.Errorf("Expected ErrAnnotationNotFound, got %v", err)
+	}
+
+	s.RenameTwin("pump-1", "pump-3")
+	if got := s.List("pump-3", Filter{}); len(got) != 2 || got[0].TwinID != "pump-3" {
+		t.Errorf("Expected the annotations of pump-1 on pump-3, got %+v", got)
+	}
+	if got := s.List("pump-1", Filter{}); len(got) != 0 {
+		t.Errorf("Expected no annotations on pump-1 after renaming it, got %+v", got)
+	}
+	s.RenameTwin("pump-2", "pump-3")
+	if got := s.List("pump-3", Filter{}); len(got) != 3 || got[2].Text != "other twin" {
+		t.Errorf("Expected the annotations of both twins in time order, got %+v", got)
+	}
+
+	s.DeleteTwin("pump-3")
+	if got := s.List("pump-3", Filter{}); len(got) != 0 {
+		t.Errorf("Expected no annotations after deleting the twin, got %+v", got)
+	}
+}
@@ -0,0 +1,347 @@
+package anomaly
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/eventbus"
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+)
+
+// Common errors
+var (
+	ErrHookNotFound      = errors.New("anomaly hook not found")
+	ErrHookAlreadyExists = errors.New("anomaly hook already exists")
+	ErrInvalidHook       = errors.New("invalid anomaly hook")
+)
+
+// Topic is the topic anomaly events are published on
+const Topic = "anomaly.detected"
+
+// DefaultThreshold is the absolute score at or above which a value is anomalous
+const DefaultThreshold = 3.0
+
+// Kind selects the detector of a hook
+type Kind string
+
+// Built-in detector kinds
+const (
+	KindZScore   Kind = "zscore"
+	KindEWMA     Kind = "ewma"
+	KindSeasonal Kind = "seasonal"
+)
+
+// Detector scores the values of one property of one twin. Observe scores a
+// value against the values seen before and then learns from it; ready is
+// false while the detector has too little data to score. Scores are signed,
+// with larger absolute scores being more anomalous. Detectors are called
+// from a single goroutine.
+type Detector interface {
+	Observe(t time.Time, value float64) (score float64, ready bool)
+}
+
+// Factory creates a detector for a twin, validating the settings of the hook
+type Factory func(h Hook) (Detector, error)
+
+// Hook attaches a detector to a property of all twins, or of the twins of
+// a type. Only the settings of the hook's kind are used; unset settings take
+// the defaults of the built-in detectors.
+type Hook struct {
+	Name      string  `json:"name"`
+	Kind      Kind    `json:"kind"`
+	FeatureID string  `json:"featureId"`
+	Property  string  `json:"property"`
+	Type      string  `json:"type,omitempty"`      // Only applies to twins of this type when set
+	Threshold float64 `json:"threshold,omitempty"` // Absolute score at or above which a value is anomalous
+	Window    int     `json:"window,omitempty"`    // Values a z-score is computed over
+	Alpha     float64 `json:"alpha,omitempty"`     // Smoothing factor of EWMA and seasonal baselines
+	Period    string  `json:"period,omitempty"`    // Length of a season such as "24h"
+	Buckets   int     `json:"buckets,omitempty"`   // Slots a season is divided into
+	Warmup    int     `json:"warmup,omitempty"`    // Values observed before scoring starts
+}
+
+// Status counts the values a hook scored
+type Status struct {
+	Observed    int        `json:"observed"`
+	Anomalies   int        `json:"anomalies"`
+	LastAnomaly *time.Time `json:"lastAnomaly,omitempty"`
+}
+
+// hook is a registered hook with the detectors of the twins it observed
+type hook struct {
+	Hook
+	factory   Factory
+	detectors map[string]Detector // Twin ID -> detector
+	status    Status
+}
+
+// Manager feeds property changes to the detectors of hooks and publishes
+// anomaly events
+type Manager struct {
+	registry  *registry.Registry
+	pubsub    eventbus.Publisher
+	factories map[Kind]Factory
+	hooks     map[string]*hook
+	mutex     sync.RWMutex
+	now       func() time.Time
+}
+
+// NewManager creates a manager with the built-in z-score, EWMA and seasonal detectors
+func NewManager(reg *registry.Registry, pubsub eventbus.Publisher) *Manager {
+	m := &Manager{
+		registry:  reg,
+		pubsub:    pubsub,
+		factories: make(map[Kind]Factory),
+		hooks:     make(map[string]*hook),
+		now:       time.Now,
+	}
+	m.RegisterKind(KindZScore, newZScore)
+	m.RegisterKind(KindEWMA, newEWMA)
+	m.RegisterKind(KindSeasonal, newSeasonal)
+	return m
+}
+
+// RegisterKind adds or replaces the factory of a detector kind. Hooks
+// already created keep their factory.
+func (m *Manager) RegisterKind(kind Kind, f Factory) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.factories[kind] = f
+}
+
+// withDefaults fills in unset settings with the defaults of the built-in detectors
+func withDefaults(h Hook) Hook {
+	if h.Threshold == 0 {
+		h.Threshold = DefaultThreshold
+	}
+	switch h.Kind {
+	case KindZScore:
+		if h.Window == 0 {
+			h.Window = DefaultWindow
+		}
+	case KindEWMA, KindSeasonal:
+		if h.Alpha == 0 {
+			h.Alpha = DefaultAlpha
+		}
+	}
+	if h.Kind == KindSeasonal {
+		if h.Period == "" {
+			h.Period = DefaultPeriod.String()
+		}
+		if h.Buckets == 0 {
+			h.Buckets = DefaultBuckets
+		}
+		if h.Warmup == 0 {
+			h.Warmup = SeasonalWarmup
+		}
+		if period, err := time.ParseDuration(h.Period); err == nil {
+			h.Period = period.String()
+		}
+	}
+	if h.Warmup == 0 {
+		h.Warmup = DefaultWarmup
+	}
+	return h
+}
+
+// Create registers a new hook
+func (m *Manager) Create(h Hook) error {
+	if h.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidHook)
+	}
+	if h.FeatureID == "" || h.Property == "" {
+		return fmt.Errorf("%w: featureId and property are required", ErrInvalidHook)
+	}
+	if h.Threshold < 0 || h.Warmup < 0 {
+		return fmt.Errorf("%w: threshold and warmup must not be negative", ErrInvalidHook)
+	}
+	h = withDefaults(h)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, exists := m.hooks[h.Name]; exists {
+		return ErrHookAlreadyExists
+	}
+	factory, exists := m.factories[h.Kind]
+	if !exists {
+		return fmt.Errorf("%w: unknown kind %q", ErrInvalidHook, h.Kind)
+	}
+	if _, err := factory(h); err != nil {
+		return err
+	}
+
+	m.hooks[h.Name] = &hook{Hook: h, factory: factory, detectors: make(map[string]Detector)}
+	return nil
+}
+
+// Delete removes a hook and the state of its detectors
+func (m *Manager) Delete(name string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, exists := m.hooks[name]; !exists {
+		return ErrHookNotFound
+	}
+	delete(m.hooks, name)
+	return nil
+}
+
+// Get returns a hook and its status
+func (m *Manager) Get(name string) (Hook, Status, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	h, exists := m.hooks[name]
+	if !exists {
+		return Hook{}, Status{}, ErrHookNotFound
+	}
+	return h.Hook, h.status, nil
+}
+
+// List returns all hooks sorted by name
+func (m *Manager) List() []Hook {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	result := make([]Hook, 0, len(m.hooks))
+	for _, h := range m.hooks {
+		result = append(result, h.Hook)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// HandleEvent scores the numeric values of property change events with the
+// hooks attached to them, and forgets the detector state of deleted twins.
+// Values are scored at the effective time of the property.
+func (m *Manager) HandleEvent(msg messaging_sim.Message) {
+	payload, ok := msg.Payload.(map[string]interface{})
+
+	switch msg.Topic {
+	case "twin.deleted":
+		if twinID := msg.TwinID(); twinID != "" {
+			m.forget(twinID)
+		}
+	case "property.updated":
+		if !ok {
+			return
+		}
+		featureID, _ := payload["featureId"].(string)
+		key, _ := payload["propertyKey"].(string)
+		m.observe(msg.TwinID(), featureID, map[string]interface{}{key: payload["value"]})
+	case "properties.updated":
+		if u, ok := eventbus.PropertiesOf(msg.Payload); ok {
+			m.observe(msg.TwinID(), u.FeatureID, u.Properties)
+		}
+	}
+}
+
+// Run scores property changes from a subscription until the channel is closed
+func (m *Manager) Run(events <-chan messaging_sim.Message) {
+	for msg := range events {
+		m.HandleEvent(msg)
+	}
+}
+
+// observe feeds changed properties of a twin to the detectors of matching
+// hooks and publishes an event for every anomalous value
+func (m *Manager) observe(twinID, featureID string, props map[string]interface{}) {
+	if twinID == "" || featureID == "" || len(props) == 0 {
+		return
+	}
+	dt, err := m.registry.Get(twinID)
+	if err != nil {
+		return
+	}
+	feature, _ := dt.GetFeature(featureID)
+
+	var events []map[string]interface{}
+
+	m.mutex.Lock()
+	for _, h := range m.hooks {
+		if h.FeatureID != featureID || (h.Type != "" && h.Type != dt.Type) {
+			continue
+		}
+		value, ok := toFloat(props[h.Property])
+		if !ok {
+			continue
+		}
+
+		timestamp := m.now()
+		if feature != nil {
+			if meta, exists := feature.GetPropertyMetadata(h.Property); exists && !meta.Timestamp.IsZero() {
+				timestamp = meta.Timestamp
+			}
+		}
+
+		detector, exists := h.detectors[twinID]
+		if !exists {
+			if detector, err = h.factory(h.Hook); err != nil {
+				continue
+			}
+			h.detectors[twinID] = detector
+		}
+
+		score, ready := detector.Observe(timestamp, value)
+		h.status.Observed++
+		if !ready || math.Abs(score) < h.Threshold {
+			continue
+		}
+
+		h.status.Anomalies++
+		h.status.LastAnomaly = &timestamp
+		events = append(events, map[string]interface{}{
+			"hook":      h.Name,
+			"kind":      string(h.Kind),
+			"twinId":    twinID,
+			"featureId": featureID,
+			"property":  h.Property,
+			"path":      "features." + featureID + ".properties." + h.Property,
+			"value":     value,
+			"score":     score,
+			"threshold": h.Threshold,
+			"timestamp": timestamp,
+		})
+	}
+	m.mutex.Unlock()
+
+	for _, payload := range events {
+		m.pubsub.Publish(Topic, payload)
+	}
+}
+
+// forget drops the detector state of a twin in all hooks
+func (m *Manager) forget(twinID string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, h := range m.hooks {
+		delete(h.detectors, twinID)
+	}
+}
+
+// toFloat converts numeric values to float64
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	default:
+		return 0, false
+	}
+}
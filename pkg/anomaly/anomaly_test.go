@@ -0,0 +1,119 @@
+package anomaly
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestCreateAndList(t *testing.T) {
+	m := NewManager(registry.NewRegistry(), messaging_sim.NewPubSub())
+
+	invalid := []Hook{
+		{Kind: KindZScore, FeatureID: "climate", Property: "temperature"},
+		{Name: "temp", Kind: KindZScore, Property: "temperature"},
+		{Name: "temp", Kind: "unknown", FeatureID: "climate", Property: "temperature"},
+		{Name: "temp", Kind: KindEWMA, FeatureID: "climate", Property: "temperature", Alpha: 2},
+		{Name: "temp", Kind: KindSeasonal, FeatureID: "climate", Property: "temperature", Period: "daily"},
+	}
+	for _, h := range invalid {
+		if err := m.Create(h); !errors.Is(err, ErrInvalidHook) {
+			t.Errorf("Expected ErrInvalidHook for %+v, got %v", h, err)
+		}
+	}
+
+	if err := m.Create(Hook{Name: "temp", Kind: KindSeasonal, FeatureID: "climate", Property: "temperature", Period: "1440m"}); err != nil {
+		t.Fatalf("Failed to create hook: %v", err)
+	}
+	if err := m.Create(Hook{Name: "temp", Kind: KindZScore, FeatureID: "climate", Property: "temperature"}); err != ErrHookAlreadyExists {
+		t.Errorf("Expected ErrHookAlreadyExists, got %v", err)
+	}
+
+	h, _, err := m.Get("temp")
+	if err != nil || h.Period != "24h0m0s" || h.Buckets != DefaultBuckets || h.Threshold != DefaultThreshold {
+		t.Errorf("Expected defaults to be filled in, got %+v (%v)", h, err)
+	}
+
+	m.Create(Hook{Name: "flow", Kind: KindEWMA, FeatureID: "status", Property: "flow"})
+	if list := m.List(); len(list) != 2 || list[0].Name != "flow" {
+		t.Errorf("Expected 2 hooks sorted by name, got %+v", list)
+	}
+
+	if err := m.Delete("flow"); err != nil {
+		t.Errorf("Failed to delete hook: %v", err)
+	}
+	if _, _, err := m.Get("flow"); err != ErrHookNotFound {
+		t.Errorf("Expected ErrHookNotFound, got %v", err)
+	}
+}
+
+// constant is a custom detector that scores every value by itself
+type constant struct{}
+
+func (constant) Observe(t time.Time, value float64) (float64, bool) { return value, true }
+
+func TestHandleEvent(t *testing.T) {
+	reg := registry.NewRegistry()
+	pubsub := messaging_sim.NewPubSub()
+	events := pubsub.SubscribeWithBuffer(Topic, 10)
+
+	for id, twinType := range map[string]string{"pump-1": "pump", "sensor-1": "sensor"} {
+		dt := twin.NewDigitalTwin(id, twinType)
+		dt.AddFeature("status", twin.NewFeatureState())
+		reg.Create(dt)
+	}
+
+	m := NewManager(reg, pubsub)
+	m.RegisterKind("constant", func(h Hook) (Detector, error) { return constant{}, nil })
+	m.Create(Hook{Name: "pressure", Kind: "constant", FeatureID: "status", Property: "pressure", Type: "pump", Threshold: 5})
+
+	m.HandleEvent(messaging_sim.Message{Topic: "property.updated", Payload: map[string]interface{}{
+		"twinId": "pump-1", "featureId": "status", "propertyKey": "pressure", "value": 2.0,
+	}})
+	m.HandleEvent(messaging_sim.Message{Topic: "properties.updated", Payload: map[string]interface{}{
+		"twinId": "pump-1", "featureId": "status", "properties": map[string]interface{}{"pressure": 7, "flow": 100.0},
+	}})
+	// Twins of other types and non-numeric values are not scored
+	m.HandleEvent(messaging_sim.Message{Topic: "properties.updated", Payload: map[string]interface{}{
+		"twinId": "sensor-1", "featureId": "status", "properties": map[string]interface{}{"pressure": 9.0},
+	}})
+	m.HandleEvent(messaging_sim.Message{Topic: "property.updated", Payload: map[string]interface{}{
+		"twinId": "pump-1", "featureId": "status", "propertyKey": "pressure", "value": "high",
+	}})
+
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 anomaly event, got %d", len(events))
+	}
+	payload := (<-events).Payload.(map[string]interface{})
+	if payload["twinId"] != "pump-1" || payload["score"] != 7.0 || payload["hook"] != "pressure" {
+		t.Errorf("Unexpected anomaly event %v", payload)
+	}
+
+	_, status, _ := m.Get("pressure")
+	if status.Observed != 2 || status.Anomalies != 1 || status.LastAnomaly == nil {
+		t.Errorf("Unexpected status %+v", status)
+	}
+}
+
+func TestForgetDeletedTwin(t *testing.T) {
+	reg := registry.NewRegistry()
+	reg.Create(twin.NewDigitalTwin("pump-1", "pump"))
+
+	m := NewManager(reg, messaging_sim.NewPubSub())
+	m.Create(Hook{Name: "pressure", Kind: KindEWMA, FeatureID: "status", Property: "pressure"})
+	m.HandleEvent(messaging_sim.Message{Topic: "property.updated", Payload: map[string]interface{}{
+		"twinId": "pump-1", "featureId": "status", "propertyKey": "pressure", "value": 2.0,
+	}})
+	if len(m.hooks["pressure"].detectors) != 1 {
+		t.Fatal("Expected a detector for the twin")
+	}
+
+	m.HandleEvent(messaging_sim.Message{Topic: "twin.deleted", Payload: map[string]string{"id": "pump-1"}})
+	if len(m.hooks["pressure"].detectors) != 0 {
+		t.Error("Expected the detector of the deleted twin to be dropped")
+	}
+}
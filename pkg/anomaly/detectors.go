@@ -0,0 +1,161 @@
+package anomaly
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Defaults of the built-in detectors
+const (
+	DefaultWindow  = 30             // Values a z-score is computed over
+	DefaultAlpha   = 0.3            // Smoothing factor of EWMA and seasonal baselines
+	DefaultPeriod  = 24 * time.Hour // Length of a season
+	DefaultBuckets = 24             // Slots a season is divided into
+	DefaultWarmup  = 10             // Values observed before z-score and EWMA scoring starts
+	SeasonalWarmup = 3              // Seasons observed before a seasonal slot is scored
+)
+
+// zScore scores a value by its distance from the mean of the preceding
+// values in a sliding window, in standard deviations
+type zScore struct {
+	window []float64
+	size   int
+	warmup int
+}
+
+// newZScore creates a z-score detector
+func newZScore(h Hook) (Detector, error) {
+	if h.Window < 2 {
+		return nil, fmt.Errorf("%w: window must be at least 2", ErrInvalidHook)
+	}
+	warmup := h.Warmup
+	if warmup > h.Window {
+		warmup = h.Window
+	}
+	return &zScore{size: h.Window, warmup: warmup}, nil
+}
+
+// Observe implements Detector. Values are not scored while all values in the
+// window are equal, since any change would be infinitely many deviations away.
+func (z *zScore) Observe(t time.Time, value float64) (float64, bool) {
+	score, ready := 0.0, false
+	if len(z.window) >= z.warmup && len(z.window) >= 2 {
+		mean, std := meanStd(z.window)
+		if std > 0 {
+			score, ready = (value-mean)/std, true
+		}
+	}
+
+	z.window = append(z.window, value)
+	if len(z.window) > z.size {
+		z.window = z.window[1:]
+	}
+	return score, ready
+}
+
+// meanStd returns the mean and population standard deviation of values
+func meanStd(values []float64) (float64, float64) {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+
+	var squares float64
+	for _, v := range values {
+		squares += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(squares / float64(len(values)))
+}
+
+// baseline is an exponentially weighted moving mean and variance
+type baseline struct {
+	mean     float64
+	variance float64
+	samples  int
+}
+
+// score returns the distance of a value from the baseline in standard
+// deviations; it is not ready before warmup values or without variance
+func (b *baseline) score(value float64, warmup int) (float64, bool) {
+	if b.samples < warmup || b.variance <= 0 {
+		return 0, false
+	}
+	return (value - b.mean) / math.Sqrt(b.variance), true
+}
+
+// update adds a value to the baseline
+func (b *baseline) update(value, alpha float64) {
+	if b.samples == 0 {
+		b.mean = value
+		b.samples = 1
+		return
+	}
+	diff := value - b.mean
+	increment := alpha * diff
+	b.mean += increment
+	b.variance = (1 - alpha) * (b.variance + diff*increment)
+	b.samples++
+}
+
+// ewma scores a value against an exponentially weighted moving baseline,
+// which follows slow drifts while flagging sudden changes
+type ewma struct {
+	baseline
+	alpha  float64
+	warmup int
+}
+
+// newEWMA creates an EWMA detector
+func newEWMA(h Hook) (Detector, error) {
+	if h.Alpha <= 0 || h.Alpha >= 1 {
+		return nil, fmt.Errorf("%w: alpha must be between 0 and 1", ErrInvalidHook)
+	}
+	return &ewma{alpha: h.Alpha, warmup: h.Warmup}, nil
+}
+
+// Observe implements Detector
+func (e *ewma) Observe(t time.Time, value float64) (float64, bool) {
+	score, ready := e.score(value, e.warmup)
+	e.update(value, e.alpha)
+	return score, ready
+}
+
+// seasonal scores a value against the baseline of the same slot in earlier
+// seasons, e.g. the same hour on previous days, so that daily load cycles
+// are not flagged. Slots are aligned to the Unix epoch in UTC.
+type seasonal struct {
+	slots  []baseline
+	period time.Duration
+	alpha  float64
+	warmup int
+}
+
+// newSeasonal creates a seasonal baseline detector
+func newSeasonal(h Hook) (Detector, error) {
+	period, err := time.ParseDuration(h.Period)
+	if err != nil || period <= 0 {
+		return nil, fmt.Errorf("%w: invalid period %q", ErrInvalidHook, h.Period)
+	}
+	if h.Buckets <= 0 || period/time.Duration(h.Buckets) <= 0 {
+		return nil, fmt.Errorf("%w: invalid number of buckets %d", ErrInvalidHook, h.Buckets)
+	}
+	if h.Alpha <= 0 || h.Alpha >= 1 {
+		return nil, fmt.Errorf("%w: alpha must be between 0 and 1", ErrInvalidHook)
+	}
+	return &seasonal{slots: make([]baseline, h.Buckets), period: period, alpha: h.Alpha, warmup: h.Warmup}, nil
+}
+
+// Observe implements Detector. Each slot warms up separately.
+func (s *seasonal) Observe(t time.Time, value float64) (float64, bool) {
+	offset := time.Duration(t.UnixNano() % int64(s.period))
+	if offset < 0 {
+		offset += s.period
+	}
+	slot := &s.slots[int(offset/(s.period/time.Duration(len(s.slots))))%len(s.slots)]
+
+	score, ready := slot.score(value, s.warmup)
+	slot.update(value, s.alpha)
+	return score, ready
+}
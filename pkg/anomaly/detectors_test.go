@@ -0,0 +1,82 @@
+package anomaly
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestZScore(t *testing.T) {
+	d, err := newZScore(withDefaults(Hook{Kind: KindZScore, Window: 10, Warmup: 5}))
+	if err != nil {
+		t.Fatalf("Failed to create detector: %v", err)
+	}
+
+	now := time.Now()
+	for i, v := range []float64{10, 11, 9, 10, 11} {
+		if _, ready := d.Observe(now, v); ready {
+			t.Errorf("Expected value %d to be observed during warmup", i)
+		}
+	}
+
+	if score, ready := d.Observe(now, 10.5); !ready || score < 0 || score > 1 {
+		t.Errorf("Expected a small score for a normal value, got %v %v", score, ready)
+	}
+	if score, ready := d.Observe(now, 20); !ready || score < 5 {
+		t.Errorf("Expected a large score for a spike, got %v %v", score, ready)
+	}
+
+	if _, err := newZScore(Hook{Window: 1}); !errors.Is(err, ErrInvalidHook) {
+		t.Errorf("Expected ErrInvalidHook, got %v", err)
+	}
+}
+
+func TestEWMA(t *testing.T) {
+	d, err := newEWMA(withDefaults(Hook{Kind: KindEWMA, Warmup: 3}))
+	if err != nil {
+		t.Fatalf("Failed to create detector: %v", err)
+	}
+
+	now := time.Now()
+	for _, v := range []float64{10, 12, 10, 12, 10, 12} {
+		d.Observe(now, v)
+	}
+	if score, ready := d.Observe(now, 11); !ready || score > 1 || score < -1 {
+		t.Errorf("Expected a small score, got %v %v", score, ready)
+	}
+	if score, ready := d.Observe(now, 0); !ready || score > -3 {
+		t.Errorf("Expected a large negative score for a drop, got %v %v", score, ready)
+	}
+
+	if _, err := newEWMA(Hook{Alpha: 1.5}); !errors.Is(err, ErrInvalidHook) {
+		t.Errorf("Expected ErrInvalidHook, got %v", err)
+	}
+}
+
+func TestSeasonal(t *testing.T) {
+	d, err := newSeasonal(withDefaults(Hook{Kind: KindSeasonal}))
+	if err != nil {
+		t.Fatalf("Failed to create detector: %v", err)
+	}
+
+	// Load is high at noon and low at midnight every day
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for day := 0; day < 5; day++ {
+		midnight := start.AddDate(0, 0, day)
+		d.Observe(midnight, 10+float64(day%2))
+		d.Observe(midnight.Add(12*time.Hour), 100+float64(day%2))
+	}
+
+	noon := start.AddDate(0, 0, 5).Add(12 * time.Hour)
+	if score, ready := d.Observe(noon, 100.5); !ready || score > 1 || score < -1 {
+		t.Errorf("Expected the usual noon load to score low, got %v %v", score, ready)
+	}
+	midnight := start.AddDate(0, 0, 6)
+	if score, ready := d.Observe(midnight, 100); !ready || score < 3 {
+		t.Errorf("Expected noon load at midnight to score high, got %v %v", score, ready)
+	}
+
+	if _, err := newSeasonal(withDefaults(Hook{Kind: KindSeasonal, Period: "1h", Buckets: -1})); !errors.Is(err, ErrInvalidHook) {
+		t.Errorf("Expected ErrInvalidHook, got %v", err)
+	}
+}
@@ -0,0 +1,352 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/aas"
+	"github.com/aleka07/go-digital-twin/pkg/eventbus"
+	"github.com/aleka07/go-digital-twin/pkg/manage"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+	"github.com/go-chi/chi/v5"
+)
+
+// aasBasePath is the prefix of the Asset Administration Shell API
+const aasBasePath = "/aas/v3"
+
+// maxPackageSize is the maximum size of an imported AASX package
+const maxPackageSize = 64 << 20
+
+// aasResult is the paged result of an AAS list operation. Results are not
+// split into pages, so the paging metadata never has a cursor.
+type aasResult struct {
+	PagingMetadata struct{}    `json:"paging_metadata"`
+	Result         interface{} `json:"result"`
+}
+
+// Asset Administration Shell handlers
+
+// ListShells handles GET /aas/v3/shells. The idShort query parameter
+// filters shells by idShort.
+func (s *Server) ListShells(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	idShort := r.URL.Query().Get("idShort")
+	shells := make([]aas.Shell, 0)
+	for _, dt := range s.Twins.List() {
+		shell := aas.NewShell(dt)
+		if idShort != "" && shell.IDShort != idShort {
+			continue
+		}
+		shells = append(shells, shell)
+	}
+
+	respondJSON(w, http.StatusOK, aasResult{Result: shells})
+}
+
+// GetShell handles GET /aas/v3/shells/{aasIdentifier}
+func (s *Server) GetShell(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	dt, ok := s.shellTwin(w, r)
+	if !ok {
+		return
+	}
+
+	respondJSON(w, http.StatusOK, aas.NewShell(dt))
+}
+
+// ListSubmodelRefs handles GET /aas/v3/shells/{aasIdentifier}/submodel-refs
+func (s *Server) ListSubmodelRefs(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	dt, ok := s.shellTwin(w, r)
+	if !ok {
+		return
+	}
+
+	respondJSON(w, http.StatusOK, aasResult{Result: aas.NewShell(dt).Submodels})
+}
+
+// ListSubmodels handles GET /aas/v3/submodels. The idShort query parameter
+// filters submodels by idShort.
+func (s *Server) ListSubmodels(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	idShort := r.URL.Query().Get("idShort")
+	submodels := make([]aas.Submodel, 0)
+	for _, dt := range s.Twins.List() {
+		for _, sm := range aas.NewSubmodels(s.Registry, dt) {
+			if idShort != "" && sm.IDShort != idShort {
+				continue
+			}
+			submodels = append(submodels, sm)
+		}
+	}
+
+	respondJSON(w, http.StatusOK, aasResult{Result: submodels})
+}
+
+// GetSubmodel handles GET /aas/v3/submodels/{submodelIdentifier}
+func (s *Server) GetSubmodel(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	sm, ok := s.submodel(w, r)
+	if !ok {
+		return
+	}
+
+	respondJSON(w, http.StatusOK, sm)
+}
+
+// GetSubmodelValue handles GET /aas/v3/submodels/{submodelIdentifier}/$value
+func (s *Server) GetSubmodelValue(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	sm, ok := s.submodel(w, r)
+	if !ok {
+		return
+	}
+
+	values := make(map[string]interface{}, len(sm.SubmodelElements))
+	for _, e := range sm.SubmodelElements {
+		values[e.IDShort] = aas.Value(e)
+	}
+	respondJSON(w, http.StatusOK, values)
+}
+
+// ListSubmodelElements handles GET /aas/v3/submodels/{submodelIdentifier}/submodel-elements
+func (s *Server) ListSubmodelElements(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	sm, ok := s.submodel(w, r)
+	if !ok {
+		return
+	}
+
+	respondJSON(w, http.StatusOK, aasResult{Result: sm.SubmodelElements})
+}
+
+// GetSubmodelElement handles
+// GET /aas/v3/submodels/{submodelIdentifier}/submodel-elements/{idShortPath}.
+// Paths into collections separate idShorts with dots.
+func (s *Server) GetSubmodelElement(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	e, ok := s.submodelElement(w, r)
+	if !ok {
+		return
+	}
+
+	respondJSON(w, http.StatusOK, e)
+}
+
+// GetSubmodelElementValue handles
+// GET /aas/v3/submodels/{submodelIdentifier}/submodel-elements/{idShortPath}/$value
+func (s *Server) GetSubmodelElementValue(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	e, ok := s.submodelElement(w, r)
+	if !ok {
+		return
+	}
+
+	respondJSON(w, http.StatusOK, aas.Value(e))
+}
+
+// SetSubmodelElementValue handles
+// PATCH /aas/v3/submodels/{submodelIdentifier}/submodel-elements/{idShortPath}/$value.
+// The body is the new value of an attribute or feature property.
+func (s *Server) SetSubmodelElementValue(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	submodelID, err := aas.DecodeID(chi.URLParam(r, "submodelIdentifier"))
+	if err != nil {
+		respondAASError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	twinID, kind, featureID, err := aas.ParseSubmodelID(submodelID)
+	if err != nil {
+		respondAASError(w, http.StatusNotFound, "Submodel not found")
+		return
+	}
+	dt, err := s.Twins.Get(twinID)
+	if err != nil {
+		respondAASError(w, http.StatusNotFound, "Submodel not found")
+		return
+	}
+
+	var value interface{}
+	if err := json.NewDecoder(r.Body).Decode(&value); err != nil {
+		respondAASError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	name, err := aas.SetValue(dt, kind, featureID, chi.URLParam(r, "idShortPath"), value)
+	if err != nil {
+		switch {
+		case errors.Is(err, aas.ErrElementNotFound), errors.Is(err, twin.ErrFeatureNotFound):
+			respondAASError(w, http.StatusNotFound, "Submodel element not found")
+		default:
+			respondAASError(w, http.StatusBadRequest, err.Error())
+		}
+		return
+	}
+
+	if err := s.Twins.Update(dt); err != nil {
+		respondAASError(w, http.StatusInternalServerError, "Failed to update submodel element: "+err.Error())
+		return
+	}
+
+	// Publish event
+	if featureID != "" {
+		feature, _ := dt.GetFeature(featureID)
+		value, _ = feature.GetProperty(name)
+		s.History.Record(dt.ID, featureID, name, value, s.Clock().Now())
+		s.PubSub.Publish("properties.updated", eventbus.PropertiesUpdated{
+			TwinID:     dt.ID,
+			FeatureID:  featureID,
+			Properties: map[string]interface{}{name: value},
+		})
+	} else {
+		s.PubSub.Publish("twin.updated", map[string]string{"id": dt.ID})
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ImportAAS handles POST /import/aas. The body is an AASX package or, with a
+// JSON or XML content type, an environment in that serialization. The prefix
+// query parameter sets the prefix of twin IDs and dryRun=true reports the
+// changes without applying them.
+func (s *Server) ImportAAS(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	dryRun, err := manage.ParseDryRun(r.URL.Query().Get("dryRun"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var env *aas.Environment
+	switch mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType {
+	case "application/json":
+		env, err = aas.ReadJSON(r.Body)
+	case "application/xml", "text/xml":
+		env, err = aas.ReadXML(r.Body)
+	default:
+		var data []byte
+		if data, err = io.ReadAll(http.MaxBytesReader(w, r.Body, maxPackageSize)); err == nil {
+			env, err = aas.ReadPackage(data)
+		}
+	}
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			respondError(w, http.StatusRequestEntityTooLarge, "Package exceeds "+strconv.Itoa(maxPackageSize)+" bytes")
+		} else {
+			respondError(w, http.StatusBadRequest, err.Error())
+		}
+		return
+	}
+
+	report := aas.Import(s.Registry, env, aas.Options{
+		Prefix: r.URL.Query().Get("prefix"),
+		DryRun: dryRun,
+	})
+
+	// Publish events for the applied changes
+	if !report.DryRun {
+		for _, id := range report.Created {
+			s.PubSub.Publish("twin.created", map[string]string{"id": id})
+		}
+		for _, id := range report.Updated {
+			s.PubSub.Publish("twin.updated", map[string]string{"id": id})
+		}
+	}
+
+	respondJSON(w, http.StatusOK, report)
+}
+
+// shellTwin returns the twin of the shell in the request path, responding
+// with an error if there is none
+func (s *Server) shellTwin(w http.ResponseWriter, r *http.Request) (*twin.DigitalTwin, bool) {
+	shellID, err := aas.DecodeID(chi.URLParam(r, "aasIdentifier"))
+	if err != nil {
+		respondAASError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+
+	twinID, err := aas.ParseShellID(shellID)
+	if err != nil {
+		respondAASError(w, http.StatusNotFound, "Shell not found")
+		return nil, false
+	}
+	dt, err := s.Twins.Get(twinID)
+	if err != nil {
+		respondAASError(w, http.StatusNotFound, "Shell not found")
+		return nil, false
+	}
+	return dt, true
+}
+
+// submodel returns the submodel in the request path, responding with an
+// error if there is none
+func (s *Server) submodel(w http.ResponseWriter, r *http.Request) (aas.Submodel, bool) {
+	submodelID, err := aas.DecodeID(chi.URLParam(r, "submodelIdentifier"))
+	if err != nil {
+		respondAASError(w, http.StatusBadRequest, err.Error())
+		return aas.Submodel{}, false
+	}
+
+	_, sm, err := aas.GetSubmodel(s.Registry, submodelID)
+	if err != nil {
+		respondAASError(w, http.StatusNotFound, "Submodel not found")
+		return aas.Submodel{}, false
+	}
+	return sm, true
+}
+
+// submodelElement returns the submodel element in the request path,
+// responding with an error if there is none
+func (s *Server) submodelElement(w http.ResponseWriter, r *http.Request) (aas.Element, bool) {
+	sm, ok := s.submodel(w, r)
+	if !ok {
+		return aas.Element{}, false
+	}
+
+	e, err := aas.FindElement(sm.SubmodelElements, chi.URLParam(r, "idShortPath"))
+	if err != nil {
+		respondAASError(w, http.StatusNotFound, "Submodel element not found")
+		return aas.Element{}, false
+	}
+	return e, true
+}
+
+// respondAASError sends an AAS result with an error message
+func respondAASError(w http.ResponseWriter, status int, text string) {
+	respondJSON(w, status, map[string]interface{}{
+		"messages": []map[string]string{{
+			"code":        strconv.Itoa(status),
+			"messageType": "Error",
+			"text":        text,
+			"timestamp":   time.Now().UTC().Format(time.RFC3339),
+		}},
+	})
+}
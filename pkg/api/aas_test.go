@@ -0,0 +1,125 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/aas"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestAASShells(t *testing.T) {
+	server := setupTestServer()
+	dt := twin.NewDigitalTwin("pump-1", "pump")
+	dt.SetAttribute("manufacturer", "Acme")
+	motor := twin.NewFeatureState()
+	motor.SetProperty("speed", 1450.0)
+	dt.AddFeature("motor", motor)
+	server.Registry.Create(dt)
+	events := server.PubSub.Subscribe("properties.updated")
+
+	serve := serveFunc(server, "")
+
+	w := serve("GET", "/aas/v3/shells", "")
+	var shells struct {
+		Result []aas.Shell `json:"result"`
+	}
+	json.NewDecoder(w.Body).Decode(&shells)
+	if w.Code != http.StatusOK || len(shells.Result) != 1 || shells.Result[0].ID != aas.ShellID("pump-1") {
+		t.Fatalf("Unexpected shells %d %+v", w.Code, shells)
+	}
+
+	shellPath := "/aas/v3/shells/" + aas.EncodeID(aas.ShellID("pump-1"))
+	if w := serve("GET", shellPath, ""); w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	w = serve("GET", shellPath+"/submodel-refs", "")
+	var refs struct {
+		Result []aas.Reference `json:"result"`
+	}
+	json.NewDecoder(w.Body).Decode(&refs)
+	if len(refs.Result) != 2 {
+		t.Errorf("Expected the attributes and motor submodels, got %+v", refs)
+	}
+
+	submodelPath := "/aas/v3/submodels/" + aas.EncodeID(aas.FeatureSubmodelID("pump-1", "motor"))
+	w = serve("GET", submodelPath+"/submodel-elements/speed/$value", "")
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != "1450" {
+		t.Errorf("Unexpected value %d %s", w.Code, w.Body.String())
+	}
+
+	// Values are written to feature properties
+	if w := serve("PATCH", submodelPath+"/submodel-elements/speed/$value", `"1500"`); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusNoContent, w.Code, w.Body.String())
+	}
+	if speed, _ := motor.GetProperty("speed"); speed != 1500.0 {
+		t.Errorf("Expected speed 1500, got %v", speed)
+	}
+	select {
+	case <-events:
+	case <-time.After(time.Second):
+		t.Error("Expected a properties.updated event")
+	}
+	w = serve("GET", submodelPath+"/$value", "")
+	var values map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&values)
+	if values["speed"] != 1500.0 {
+		t.Errorf("Unexpected submodel value %v", values)
+	}
+
+	for _, c := range []struct {
+		method, path, body string
+		status             int
+	}{
+		{"GET", "/aas/v3/shells/" + aas.EncodeID("urn:other"), "", http.StatusNotFound},
+		{"GET", "/aas/v3/shells/not-base64!", "", http.StatusBadRequest},
+		{"GET", "/aas/v3/submodels/" + aas.EncodeID(aas.FeatureSubmodelID("pump-1", "pump")), "", http.StatusNotFound},
+		{"GET", submodelPath + "/submodel-elements/torque", "", http.StatusNotFound},
+		{"PATCH", submodelPath + "/submodel-elements/torque/$value", "1", http.StatusNotFound},
+		{"PATCH", submodelPath + "/submodel-elements/speed/$value", "{}", http.StatusBadRequest},
+	} {
+		if w := serve(c.method, c.path, c.body); w.Code != c.status {
+			t.Errorf("Expected status code %d for %s %s, got %d", c.status, c.method, c.path, w.Code)
+		}
+	}
+}
+
+func TestImportAAS(t *testing.T) {
+	server := setupTestServer()
+
+	env := `{"assetAdministrationShells": [{"modelType": "AssetAdministrationShell", "id": "urn:tank", "idShort": "Tank",
+		"assetInformation": {"assetKind": "Instance", "assetType": "tank"}}]}`
+	serve := func(path, contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		server.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve("/import/aas?dryRun=true", "application/json", env)
+	if w.Code != http.StatusOK || server.Registry.Count() != 0 {
+		t.Fatalf("Expected a dry run to create no twins, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = serve("/import/aas?prefix=site-", "application/json", env)
+	var report aas.Report
+	json.NewDecoder(w.Body).Decode(&report)
+	if len(report.Created) != 1 {
+		t.Fatalf("Unexpected report %+v", report)
+	}
+	if dt, err := server.Registry.Get("site-Tank"); err != nil || dt.Type != "tank" {
+		t.Errorf("Unexpected twin %+v (%v)", dt, err)
+	}
+
+	if w := serve("/import/aas", "application/asset-administration-shell-package", "not a package"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for an invalid package, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w := serve("/import/aas", "application/xml", "<environment"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for an invalid environment, got %d", http.StatusBadRequest, w.Code)
+	}
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/access"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// Read auditing handlers
+
+// auditReads logs reads of twins with an access policy once they are
+// answered, with the user named by the X-User header and the status
+func (s *Server) auditReads(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		twinID := chi.URLParam(r, "twinID")
+		if (r.Method != http.MethodGet && r.Method != http.MethodHead) || !s.Access.Audited(twinID) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		entry := access.Entry{
+			TwinID:     twinID,
+			User:       r.Header.Get(UserHeader),
+			Method:     r.Method,
+			Path:       r.URL.RequestURI(),
+			Status:     ww.Status(),
+			RemoteAddr: r.RemoteAddr,
+			Time:       time.Now().UTC(),
+		}
+		if entry.Status == 0 {
+			entry.Status = http.StatusOK
+		}
+		if s.Access.Record(entry) {
+			s.PubSub.Publish(access.ReadTopic, entry)
+		}
+	})
+}
+
+// ListAccessPolicies handles GET /access-policies
+func (s *Server) ListAccessPolicies(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	respondJSON(w, http.StatusOK, s.Access.List())
+}
+
+// GetAccessPolicy handles GET /access-policies/{twinID}
+func (s *Server) GetAccessPolicy(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	p, err := s.Access.Get(chi.URLParam(r, "twinID"))
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Access policy not found")
+		return
+	}
+	respondJSON(w, http.StatusOK, p)
+}
+
+// SetAccessPolicy handles PUT /access-policies/{twinID}. The twin need not
+// exist yet, so that it is audited from its creation.
+func (s *Server) SetAccessPolicy(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	var p access.Policy
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	// Use the twin ID from the URL
+	p.TwinID = chi.URLParam(r, "twinID")
+
+	p, err := s.Access.Set(p)
+	if err != nil {
+		if errors.Is(err, access.ErrInvalidPolicy) {
+			respondError(w, http.StatusBadRequest, err.Error())
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to set access policy: "+err.Error())
+		}
+		return
+	}
+	respondJSON(w, http.StatusOK, p)
+}
+
+// DeleteAccessPolicy handles DELETE /access-policies/{twinID}
+func (s *Server) DeleteAccessPolicy(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	if err := s.Access.Delete(chi.URLParam(r, "twinID")); err != nil {
+		if err == access.ErrPolicyNotFound {
+			respondError(w, http.StatusNotFound, "Access policy not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to delete access policy: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Access policy deleted"})
+}
+
+// GetAccessLog handles GET /access-policies/{twinID}/log, the logged reads
+// of a twin. The optional since query parameter (RFC 3339) limits the
+// entries to those logged from then on.
+func (s *Server) GetAccessLog(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	since, err := parseTimeParam(r, "since")
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid since parameter: "+err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, s.Access.Log(chi.URLParam(r, "twinID"), since))
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/access"
+	"github.com/aleka07/go-digital-twin/pkg/share"
+)
+
+func TestReadAuditing(t *testing.T) {
+	server := setupTestServer()
+	events := server.PubSub.Subscribe(access.ReadTopic)
+
+	serve := serveAsFunc(server, APIPrefix, "alice")
+
+	serve("POST", "/twins", `{"id": "vault-door", "type": "door"}`)
+	serve("POST", "/twins", `{"id": "pump-1", "type": "pump"}`)
+	if w := serve("PUT", "/access-policies/vault-door", `{}`); w.Code != http.StatusOK {
+		t.Fatalf("Failed to set access policy: %d %s", w.Code, w.Body.String())
+	}
+
+	serve("GET", "/twins/vault-door", "")
+	serve("GET", "/twins/vault-door/features/lock", "")
+	serve("PUT", "/twins/vault-door/attributes/site", `"berlin"`)
+	serve("GET", "/twins/pump-1", "")
+
+	var entries []access.Entry
+	w := serve("GET", "/access-policies/vault-door/log", "")
+	json.Unmarshal(w.Body.Bytes(), &entries)
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 logged reads, got %s", w.Body.String())
+	}
+	if e := entries[0]; e.User != "alice" || e.Path != APIPrefix+"/twins/vault-door" || e.Status != http.StatusOK {
+		t.Errorf("Unexpected entry %+v", e)
+	}
+	if entries[1].Status != http.StatusNotFound {
+		t.Errorf("Expected the failed read to be logged with its status, got %+v", entries[1])
+	}
+
+	select {
+	case msg := <-events:
+		if e, ok := msg.Payload.(access.Entry); !ok || e.TwinID != "vault-door" {
+			t.Errorf("Unexpected event %+v", msg.Payload)
+		}
+	default:
+		t.Error("Expected an event for the logged read")
+	}
+
+	// Reads through share links are logged as the link, whatever X-User says
+	var link share.Link
+	w = serve("POST", "/twins/vault-door/shares", `{"scope": "read", "ttl": "1h"}`)
+	json.Unmarshal(w.Body.Bytes(), &link)
+	if w := serve("GET", "/shared/"+link.Token+"/", ""); w.Code != http.StatusOK {
+		t.Fatalf("Expected the shared read to succeed, got %d %s", w.Code, w.Body.String())
+	}
+	w = serve("GET", "/access-policies/vault-door/log", "")
+	json.Unmarshal(w.Body.Bytes(), &entries)
+	if len(entries) != 3 || entries[2].User != "share:"+link.ID {
+		t.Errorf("Expected the shared read to be logged as share:%s, got %s", link.ID, w.Body.String())
+	}
+
+	for _, tc := range []struct {
+		method, path, body string
+		code               int
+	}{
+		{"PUT", "/access-policies/pump-1", `{"sampleRate": 2}`, http.StatusBadRequest},
+		{"GET", "/access-policies/vault-door/log?since=yesterday", "", http.StatusBadRequest},
+		{"GET", "/access-policies/vault-door", "", http.StatusOK},
+		{"DELETE", "/access-policies/vault-door", "", http.StatusOK},
+		{"GET", "/access-policies/vault-door", "", http.StatusNotFound},
+	} {
+		if w := serve(tc.method, tc.path, tc.body); w.Code != tc.code {
+			t.Errorf("%s %s: expected status code %d, got %d %s", tc.method, tc.path, tc.code, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/aleka07/go-digital-twin/pkg/annotation"
+	"github.com/go-chi/chi/v5"
+)
+
+// Annotation handlers
+
+// parseAnnotationFilter reads the from, to, feature, property and tag query
+// parameters, responding with an error if they are invalid
+func parseAnnotationFilter(w http.ResponseWriter, r *http.Request) (annotation.Filter, bool) {
+	from, err := parseTimeParam(r, "from")
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid from parameter: "+err.Error())
+		return annotation.Filter{}, false
+	}
+
+	to, err := parseTimeParam(r, "to")
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid to parameter: "+err.Error())
+		return annotation.Filter{}, false
+	}
+
+	return annotation.Filter{
+		From:      from,
+		To:        to,
+		FeatureID: r.URL.Query().Get("feature"),
+		Property:  r.URL.Query().Get("property"),
+		Tag:       r.URL.Query().Get("tag"),
+	}, true
+}
+
+// ListAnnotations handles GET /twins/{twinID}/annotations. The optional from
+// and to query parameters (RFC 3339) limit the time range; feature, property
+// and tag select annotations about a property or with a tag.
+func (s *Server) ListAnnotations(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	dt, ok := s.getTwin(w, r)
+	if !ok {
+		return
+	}
+
+	filter, ok := parseAnnotationFilter(w, r)
+	if !ok {
+		return
+	}
+
+	respondJSON(w, http.StatusOK, s.Annotations.List(dt.ID, filter))
+}
+
+// CreateAnnotation handles POST /twins/{twinID}/annotations. The author is
+// the user named by the X-User header.
+func (s *Server) CreateAnnotation(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	author := r.Header.Get(UserHeader)
+	if author == "" {
+		respondError(w, http.StatusBadRequest, UserHeader+" header is required")
+		return
+	}
+
+	dt, ok := s.getTwin(w, r)
+	if !ok {
+		return
+	}
+
+	var req annotation.Annotation
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	req.TwinID = dt.ID
+	req.Author = author
+
+	a, err := s.Annotations.Add(req)
+	if err != nil {
+		if errors.Is(err, annotation.ErrInvalidAnnotation) {
+			respondError(w, http.StatusBadRequest, err.Error())
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to add annotation: "+err.Error())
+		}
+		return
+	}
+
+	// Publish event
+	s.PubSub.Publish("annotation.created", map[string]interface{}{
+		"twinId":       a.TwinID,
+		"annotationId": a.ID,
+		"author":       a.Author,
+		"text":         a.Text,
+		"time":         a.Time,
+	})
+
+	w.Header().Set("Location", apiPath(r, "/twins/"+a.TwinID+"/annotations/"+a.ID))
+	respondJSON(w, http.StatusCreated, a)
+}
+
+// GetAnnotation handles GET /twins/{twinID}/annotations/{annotationID}
+func (s *Server) GetAnnotation(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	twinID := chi.URLParam(r, "twinID")
+	annotationID := chi.URLParam(r, "annotationID")
+	if twinID == "" || annotationID == "" {
+		respondError(w, http.StatusBadRequest, "Twin ID and Annotation ID are required")
+		return
+	}
+
+	a, err := s.Annotations.Get(twinID, annotationID)
+	if err != nil {
+		if err == annotation.ErrAnnotationNotFound {
+			respondError(w, http.StatusNotFound, "Annotation not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to get annotation: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, a)
+}
+
+// DeleteAnnotation handles DELETE /twins/{twinID}/annotations/{annotationID}
+func (s *Server) DeleteAnnotation(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	twinID := chi.URLParam(r, "twinID")
+	annotationID := chi.URLParam(r, "annotationID")
+	if twinID == "" || annotationID == "" {
+		respondError(w, http.StatusBadRequest, "Twin ID and Annotation ID are required")
+		return
+	}
+
+	if err := s.Annotations.Delete(twinID, annotationID); err != nil {
+		if err == annotation.ErrAnnotationNotFound {
+			respondError(w, http.StatusNotFound, "Annotation not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to delete annotation: "+err.Error())
+		}
+		return
+	}
+
+	// Publish event
+	s.PubSub.Publish("annotation.deleted", map[string]string{
+		"twinId":       twinID,
+		"annotationId": annotationID,
+		"deletedBy":    r.Header.Get(UserHeader),
+	})
+
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Annotation deleted"})
+}
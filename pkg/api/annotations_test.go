@@ -0,0 +1,99 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/annotation"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestAnnotationRoutes(t *testing.T) {
+	server := setupTestServer()
+	server.Registry.Create(twin.NewDigitalTwin("pump-1", "pump"))
+	events := server.PubSub.Subscribe("annotation.#")
+
+	serve := func(method, path, user, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if user != "" {
+			req.Header.Set(UserHeader, user)
+		}
+		w := httptest.NewRecorder()
+		server.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := serve("POST", "/twins/pump-1/annotations", "", `{"text": "bearing replaced"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d without a user, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w := serve("POST", "/twins/missing/annotations", "alice", `{"text": "bearing replaced"}`); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d for a missing twin, got %d", http.StatusNotFound, w.Code)
+	}
+
+	w := serve("POST", "/api/v1/twins/pump-1/annotations", "alice", `{"text": "bearing replaced", "time": "2026-05-01T08:00:00Z", "featureId": "motor", "author": "mallory"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var created annotation.Annotation
+	json.NewDecoder(w.Body).Decode(&created)
+	if created.Author != "alice" || created.TwinID != "pump-1" {
+		t.Errorf("Expected the annotation to be attributed to alice, got %+v", created)
+	}
+	if w.Header().Get("Location") != "/api/v1/twins/pump-1/annotations/"+created.ID {
+		t.Errorf("Unexpected Location %q", w.Header().Get("Location"))
+	}
+	select {
+	case msg := <-events:
+		if msg.Topic != "annotation.created" {
+			t.Errorf("Expected annotation.created, got %s", msg.Topic)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected an annotation.created event")
+	}
+
+	serve("POST", "/twins/pump-1/annotations", "bob", `{"text": "shift handover", "time": "2026-05-02T08:00:00Z"}`)
+
+	// Time ranges
+	w = serve("GET", "/twins/pump-1/annotations?from=2026-05-02T00:00:00Z", "", "")
+	var list []annotation.Annotation
+	json.NewDecoder(w.Body).Decode(&list)
+	if len(list) != 1 || list[0].Author != "bob" {
+		t.Errorf("Expected bob's annotation, got %+v", list)
+	}
+	if w := serve("GET", "/twins/pump-1/annotations?to=yesterday", "", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for an invalid time, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	// Annotations alongside property history
+	w = serve("GET", "/twins/pump-1/features/motor/properties/speed/history?annotations=true", "", "")
+	var withNotes struct {
+		Samples     []interface{}           `json:"samples"`
+		Annotations []annotation.Annotation `json:"annotations"`
+	}
+	json.NewDecoder(w.Body).Decode(&withNotes)
+	if w.Code != http.StatusOK || len(withNotes.Annotations) != 2 {
+		t.Errorf("Expected the motor and twin-wide annotations, got %d %+v", w.Code, withNotes.Annotations)
+	}
+	w = serve("GET", "/twins/pump-1/features/hydraulics/properties/pressure/history?annotations=true", "", "")
+	json.NewDecoder(w.Body).Decode(&withNotes)
+	if len(withNotes.Annotations) != 1 {
+		t.Errorf("Expected only the twin-wide annotation, got %+v", withNotes.Annotations)
+	}
+
+	if w := serve("DELETE", "/twins/pump-1/annotations/"+created.ID, "alice", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if w := serve("GET", "/twins/pump-1/annotations/"+created.ID, "", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	// Annotations are removed with their twin
+	serve("DELETE", "/twins/pump-1", "", "")
+	if got := server.Annotations.List("pump-1", annotation.Filter{}); len(got) != 0 {
+		t.Errorf("Expected annotations to be removed with the twin, got %+v", got)
+	}
+}
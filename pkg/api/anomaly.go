@@ -0,0 +1,98 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/aleka07/go-digital-twin/pkg/anomaly"
+	"github.com/go-chi/chi/v5"
+)
+
+// Anomaly hook handlers
+
+// CreateAnomalyHook handles POST /anomaly-hooks
+func (s *Server) CreateAnomalyHook(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	var hook anomaly.Hook
+	if err := json.NewDecoder(r.Body).Decode(&hook); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	if err := s.Anomalies.Create(hook); err != nil {
+		switch {
+		case errors.Is(err, anomaly.ErrHookAlreadyExists):
+			respondError(w, http.StatusConflict, "Anomaly hook already exists")
+		case errors.Is(err, anomaly.ErrInvalidHook):
+			respondError(w, http.StatusBadRequest, err.Error())
+		default:
+			respondError(w, http.StatusInternalServerError, "Failed to create anomaly hook: "+err.Error())
+		}
+		return
+	}
+
+	created, _, _ := s.Anomalies.Get(hook.Name)
+	respondJSON(w, http.StatusCreated, created)
+}
+
+// ListAnomalyHooks handles GET /anomaly-hooks
+func (s *Server) ListAnomalyHooks(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	respondJSON(w, http.StatusOK, s.Anomalies.List())
+}
+
+// GetAnomalyHook handles GET /anomaly-hooks/{hookName} and includes the
+// counts of scored values and anomalies
+func (s *Server) GetAnomalyHook(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	hookName := chi.URLParam(r, "hookName")
+	if hookName == "" {
+		respondError(w, http.StatusBadRequest, "Hook name is required")
+		return
+	}
+
+	hook, status, err := s.Anomalies.Get(hookName)
+	if err != nil {
+		if err == anomaly.ErrHookNotFound {
+			respondError(w, http.StatusNotFound, "Anomaly hook not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to get anomaly hook: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, struct {
+		anomaly.Hook
+		Status anomaly.Status `json:"status"`
+	}{hook, status})
+}
+
+// DeleteAnomalyHook handles DELETE /anomaly-hooks/{hookName}
+func (s *Server) DeleteAnomalyHook(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	hookName := chi.URLParam(r, "hookName")
+	if hookName == "" {
+		respondError(w, http.StatusBadRequest, "Hook name is required")
+		return
+	}
+
+	if err := s.Anomalies.Delete(hookName); err != nil {
+		if err == anomaly.ErrHookNotFound {
+			respondError(w, http.StatusNotFound, "Anomaly hook not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to delete anomaly hook: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Anomaly hook deleted"})
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAnomalyHookManagement(t *testing.T) {
+	server := setupTestServer()
+
+	create := func(body map[string]interface{}) *httptest.ResponseRecorder {
+		jsonData, _ := json.Marshal(body)
+		req := httptest.NewRequest("POST", "/anomaly-hooks", bytes.NewBuffer(jsonData))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		server.CreateAnomalyHook(w, req)
+		return w
+	}
+
+	hook := map[string]interface{}{
+		"name":      "pressure",
+		"kind":      "ewma",
+		"featureId": "status",
+		"property":  "pressure",
+	}
+	w := create(hook)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var created map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &created)
+	if created["alpha"] != 0.3 || created["threshold"] != 3.0 {
+		t.Errorf("Expected defaults in the response, got %v", created)
+	}
+
+	if w := create(hook); w.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d, got %d", http.StatusConflict, w.Code)
+	}
+	if w := create(map[string]interface{}{"name": "flow", "kind": "isolation-forest", "featureId": "status", "property": "flow"}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	req := httptest.NewRequest("GET", "/anomaly-hooks/pressure", nil)
+	req = req.WithContext(setURLParam(req.Context(), "hookName", "pressure"))
+	w = httptest.NewRecorder()
+	server.GetAnomalyHook(w, req)
+
+	var got map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &got)
+	if w.Code != http.StatusOK || got["status"] == nil {
+		t.Errorf("Expected the hook with its status, got %d %s", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest("DELETE", "/anomaly-hooks/pressure", nil)
+	req = req.WithContext(setURLParam(req.Context(), "hookName", "pressure"))
+	w = httptest.NewRecorder()
+	server.DeleteAnomalyHook(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/anomaly-hooks/pressure", nil)
+	req = req.WithContext(setURLParam(req.Context(), "hookName", "pressure"))
+	w = httptest.NewRecorder()
+	server.GetAnomalyHook(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
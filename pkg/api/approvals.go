@@ -0,0 +1,180 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/aleka07/go-digital-twin/pkg/approval"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/go-chi/chi/v5"
+)
+
+// UserHeader names the user making a request. The server does not
+// authenticate users itself; a proxy in front of it is expected to set the
+// header.
+const UserHeader = "X-User"
+
+// Change request handlers
+
+// reviewRequest is the body of approve and reject requests
+type reviewRequest struct {
+	Comment string `json:"comment,omitempty"`
+}
+
+// ListChangeRequests handles GET /change-requests
+func (s *Server) ListChangeRequests(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	state := approval.State(r.URL.Query().Get("state"))
+	switch state {
+	case "", approval.StatePending, approval.StateApproved, approval.StateRejected:
+	default:
+		respondError(w, http.StatusBadRequest, "Invalid state: "+string(state))
+		return
+	}
+
+	respondJSON(w, http.StatusOK, s.Approvals.List(state))
+}
+
+// GetChangeRequest handles GET /change-requests/{requestID}
+func (s *Server) GetChangeRequest(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	requestID := chi.URLParam(r, "requestID")
+	if requestID == "" {
+		respondError(w, http.StatusBadRequest, "Change request ID is required")
+		return
+	}
+
+	cr, err := s.Approvals.Get(requestID)
+	if err != nil {
+		if err == approval.ErrChangeRequestNotFound {
+			respondError(w, http.StatusNotFound, "Change request not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to get change request: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, cr)
+}
+
+// ApproveChangeRequest handles POST /change-requests/{requestID}/approve
+func (s *Server) ApproveChangeRequest(w http.ResponseWriter, r *http.Request) {
+	s.reviewChangeRequest(w, r, s.Approvals.Approve)
+}
+
+// RejectChangeRequest handles POST /change-requests/{requestID}/reject
+func (s *Server) RejectChangeRequest(w http.ResponseWriter, r *http.Request) {
+	s.reviewChangeRequest(w, r, s.Approvals.Reject)
+}
+
+// reviewChangeRequest approves or rejects a change request as the user of the request
+func (s *Server) reviewChangeRequest(w http.ResponseWriter, r *http.Request, review func(id, reviewer, comment string) (approval.ChangeRequest, error)) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	requestID := chi.URLParam(r, "requestID")
+	if requestID == "" {
+		respondError(w, http.StatusBadRequest, "Change request ID is required")
+		return
+	}
+
+	reviewer := r.Header.Get(UserHeader)
+	if reviewer == "" {
+		respondError(w, http.StatusBadRequest, UserHeader+" header is required")
+		return
+	}
+
+	var req reviewRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+			return
+		}
+	}
+
+	cr, err := review(requestID, reviewer, req.Comment)
+	if err != nil {
+		switch {
+		case err == approval.ErrChangeRequestNotFound:
+			respondError(w, http.StatusNotFound, "Change request not found")
+		case errors.Is(err, registry.ErrTwinNotFound):
+			respondError(w, http.StatusNotFound, "Digital twin not found")
+		case err == approval.ErrAlreadyReviewed:
+			respondError(w, http.StatusConflict, "Change request has already been reviewed")
+		case err == approval.ErrSelfReview:
+			respondError(w, http.StatusForbidden, "Change requests must be reviewed by another user")
+		default:
+			respondError(w, http.StatusInternalServerError, "Failed to review change request: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, cr)
+}
+
+// ListApprovalPolicies handles GET /change-requests/policies
+func (s *Server) ListApprovalPolicies(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	respondJSON(w, http.StatusOK, s.Approvals.Policies())
+}
+
+// SetApprovalPolicy handles PUT /change-requests/policies/{featureID}/{propKey}
+func (s *Server) SetApprovalPolicy(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	featureID := chi.URLParam(r, "featureID")
+	propKey := chi.URLParam(r, "propKey")
+
+	if featureID == "" || propKey == "" {
+		respondError(w, http.StatusBadRequest, "Feature ID and Property Key are required")
+		return
+	}
+
+	var policy approval.Policy
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+			return
+		}
+	}
+
+	// Use the feature and property from the URL
+	policy.FeatureID = featureID
+	policy.Property = propKey
+
+	if err := s.Approvals.SetPolicy(policy); err != nil {
+		if errors.Is(err, approval.ErrInvalidPolicy) {
+			respondError(w, http.StatusBadRequest, err.Error())
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to set approval policy: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, policy)
+}
+
+// DeleteApprovalPolicy handles DELETE /change-requests/policies/{featureID}/{propKey}
+func (s *Server) DeleteApprovalPolicy(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	featureID := chi.URLParam(r, "featureID")
+	propKey := chi.URLParam(r, "propKey")
+
+	if featureID == "" || propKey == "" {
+		respondError(w, http.StatusBadRequest, "Feature ID and Property Key are required")
+		return
+	}
+
+	s.Approvals.RemovePolicy(featureID, propKey)
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Approval policy removed"})
+}
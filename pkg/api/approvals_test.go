@@ -0,0 +1,126 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/approval"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestChangeRequests(t *testing.T) {
+	server := setupTestServer()
+
+	dt := twin.NewDigitalTwin("boiler-1", "boiler")
+	control := twin.NewFeatureState()
+	control.SetDesiredProperty("setpoint", 60.0)
+	dt.AddFeature("control", control)
+	server.Registry.Create(dt)
+
+	// Require approval for setpoint changes
+	req := httptest.NewRequest("PUT", "/change-requests/policies/control/setpoint", nil)
+	ctx := setURLParam(req.Context(), "featureID", "control")
+	ctx = setURLParam(ctx, "propKey", "setpoint")
+	req = req.WithContext(ctx)
+	w := httptest.NewRecorder()
+	server.SetApprovalPolicy(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	// A desired setpoint change is held; other changes are applied
+	body, _ := json.Marshal(map[string]interface{}{
+		"desiredProperties": map[string]interface{}{"setpoint": 80.0, "fan": "auto"},
+	})
+	req = httptest.NewRequest("PUT", "/twins/boiler-1/features/control", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(UserHeader, "alice")
+	ctx = setURLParam(req.Context(), "twinID", "boiler-1")
+	ctx = setURLParam(ctx, "featureID", "control")
+	req = req.WithContext(ctx)
+	w = httptest.NewRecorder()
+	server.UpdateFeature(w, req)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusAccepted, w.Code, w.Body.String())
+	}
+
+	var cr approval.ChangeRequest
+	json.Unmarshal(w.Body.Bytes(), &cr)
+	if w.Header().Get("Location") != "/change-requests/"+cr.ID {
+		t.Errorf("Expected Location header for change request %s, got %s", cr.ID, w.Header().Get("Location"))
+	}
+	if cr.State != approval.StatePending || cr.RequestedBy != "alice" || cr.DesiredProperties["setpoint"] != 80.0 {
+		t.Errorf("Unexpected change request: %+v", cr)
+	}
+
+	// Writes replace the stored twin with a changed copy
+	dt, _ = server.Registry.Get("boiler-1")
+	control, _ = dt.GetFeature("control")
+	if val, _ := control.GetDesiredProperty("setpoint"); val != 60.0 {
+		t.Errorf("Expected setpoint 60 before approval, got %v", val)
+	}
+	if val, _ := control.GetDesiredProperty("fan"); val != "auto" {
+		t.Errorf("Expected fan auto to be applied, got %v", val)
+	}
+
+	review := func(user string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"comment": "ok"})
+		req := httptest.NewRequest("POST", "/change-requests/"+cr.ID+"/approve", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		if user != "" {
+			req.Header.Set(UserHeader, user)
+		}
+		req = req.WithContext(setURLParam(req.Context(), "requestID", cr.ID))
+		w := httptest.NewRecorder()
+		server.ApproveChangeRequest(w, req)
+		return w
+	}
+
+	if w := review(""); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w := review("alice"); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, got %d", http.StatusForbidden, w.Code)
+	}
+	if w := review("bob"); w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if w := review("carol"); w.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d, got %d", http.StatusConflict, w.Code)
+	}
+
+	dt, _ = server.Registry.Get("boiler-1")
+	control, _ = dt.GetFeature("control")
+	if val, _ := control.GetDesiredProperty("setpoint"); val != 80.0 {
+		t.Errorf("Expected setpoint 80 after approval, got %v", val)
+	}
+
+	req = httptest.NewRequest("GET", "/change-requests?state=approved", nil)
+	w = httptest.NewRecorder()
+	server.ListChangeRequests(w, req)
+
+	var list []approval.ChangeRequest
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if len(list) != 1 || list[0].ReviewedBy != "bob" || list[0].Comment != "ok" {
+		t.Errorf("Unexpected change requests: %+v", list)
+	}
+
+	req = httptest.NewRequest("GET", "/change-requests?state=unknown", nil)
+	w = httptest.NewRecorder()
+	server.ListChangeRequests(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/change-requests/missing", nil)
+	req = req.WithContext(setURLParam(req.Context(), "requestID", "missing"))
+	w = httptest.NewRecorder()
+	server.GetChangeRequest(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
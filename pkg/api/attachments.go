@@ -0,0 +1,191 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/aleka07/go-digital-twin/pkg/attachment"
+	"github.com/go-chi/chi/v5"
+)
+
+// Attachment handlers
+
+// respondAttachmentError responds with the status of an attachment manager error
+func respondAttachmentError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, attachment.ErrAttachmentNotFound):
+		respondError(w, http.StatusNotFound, "Attachment not found")
+	case errors.Is(err, attachment.ErrInvalidAttachment):
+		respondError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, attachment.ErrTooLarge):
+		respondError(w, http.StatusRequestEntityTooLarge, err.Error())
+	case errors.Is(err, attachment.ErrUnsupportedType):
+		respondError(w, http.StatusUnsupportedMediaType, err.Error())
+	default:
+		respondError(w, http.StatusInternalServerError, "Failed to manage attachment: "+err.Error())
+	}
+}
+
+// attachmentName returns the file name of an upload, taken from the name
+// query parameter or the filename of the Content-Disposition header
+func attachmentName(r *http.Request) string {
+	if name := r.URL.Query().Get("name"); name != "" {
+		return name
+	}
+	if _, params, err := mime.ParseMediaType(r.Header.Get("Content-Disposition")); err == nil {
+		return params["filename"]
+	}
+	return ""
+}
+
+// ListAttachments handles GET /twins/{twinID}/attachments
+func (s *Server) ListAttachments(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	dt, ok := s.getTwin(w, r)
+	if !ok {
+		return
+	}
+
+	attachments, err := s.Attachments.List(r.Context(), dt.ID)
+	if err != nil {
+		respondAttachmentError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, attachments)
+}
+
+// AddAttachment handles POST /twins/{twinID}/attachments. The body is the
+// file itself, described by the Content-Type header; the file name is given
+// by the name query parameter or a Content-Disposition header. The uploader
+// is the user named by the X-User header, if any.
+func (s *Server) AddAttachment(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	dt, ok := s.getTwin(w, r)
+	if !ok {
+		return
+	}
+
+	// Read one byte more than allowed, so that the manager rejects the upload
+	// as too large instead of storing a truncated file
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.Attachments.MaxSize()+1))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			respondAttachmentError(w, attachment.ErrTooLarge)
+		} else {
+			respondError(w, http.StatusBadRequest, "Failed to read request body: "+err.Error())
+		}
+		return
+	}
+
+	meta, err := s.Attachments.Add(r.Context(), dt.ID, attachmentName(r), r.Header.Get("Content-Type"), r.Header.Get(UserHeader), data)
+	if err != nil {
+		respondAttachmentError(w, err)
+		return
+	}
+
+	// Publish event
+	s.PubSub.Publish("attachment.added", map[string]interface{}{
+		"twinId":       meta.TwinID,
+		"attachmentId": meta.ID,
+		"name":         meta.Name,
+		"contentType":  meta.ContentType,
+		"size":         meta.Size,
+		"uploadedBy":   meta.UploadedBy,
+	})
+
+	w.Header().Set("Location", apiPath(r, "/twins/"+meta.TwinID+"/attachments/"+meta.ID))
+	respondJSON(w, http.StatusCreated, meta)
+}
+
+// GetAttachment handles GET /twins/{twinID}/attachments/{attachmentID},
+// returning the metadata of an attachment
+func (s *Server) GetAttachment(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	twinID := chi.URLParam(r, "twinID")
+	attachmentID := chi.URLParam(r, "attachmentID")
+	if twinID == "" || attachmentID == "" {
+		respondError(w, http.StatusBadRequest, "Twin ID and Attachment ID are required")
+		return
+	}
+
+	meta, err := s.Attachments.Get(r.Context(), twinID, attachmentID)
+	if err != nil {
+		respondAttachmentError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, meta)
+}
+
+// GetAttachmentContent handles GET /twins/{twinID}/attachments/{attachmentID}/content.
+// The file is always served as a download so that browsers do not render
+// uploaded content in the API's origin.
+func (s *Server) GetAttachmentContent(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	twinID := chi.URLParam(r, "twinID")
+	attachmentID := chi.URLParam(r, "attachmentID")
+	if twinID == "" || attachmentID == "" {
+		respondError(w, http.StatusBadRequest, "Twin ID and Attachment ID are required")
+		return
+	}
+
+	meta, data, err := s.Attachments.Content(r.Context(), twinID, attachmentID)
+	if err != nil {
+		respondAttachmentError(w, err)
+		return
+	}
+
+	etag := `"` + meta.SHA256 + `"`
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", meta.ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": meta.Name}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// DeleteAttachment handles DELETE /twins/{twinID}/attachments/{attachmentID}
+func (s *Server) DeleteAttachment(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	twinID := chi.URLParam(r, "twinID")
+	attachmentID := chi.URLParam(r, "attachmentID")
+	if twinID == "" || attachmentID == "" {
+		respondError(w, http.StatusBadRequest, "Twin ID and Attachment ID are required")
+		return
+	}
+
+	if err := s.Attachments.Delete(r.Context(), twinID, attachmentID); err != nil {
+		respondAttachmentError(w, err)
+		return
+	}
+
+	// Publish event
+	s.PubSub.Publish("attachment.deleted", map[string]string{
+		"twinId":       twinID,
+		"attachmentId": attachmentID,
+		"deletedBy":    r.Header.Get(UserHeader),
+	})
+
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Attachment deleted"})
+}
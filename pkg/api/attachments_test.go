@@ -0,0 +1,135 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/attachment"
+	"github.com/aleka07/go-digital-twin/pkg/objstore"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestAttachmentRoutes(t *testing.T) {
+	server := setupTestServer()
+	server.Attachments = attachment.NewManager(objstore.NewMemoryStore(), attachment.Options{
+		MaxSize:      64,
+		AllowedTypes: []string{"text/plain", "image/*"},
+	})
+	server.Registry.Create(twin.NewDigitalTwin("pump-1", "pump"))
+	events := server.PubSub.Subscribe("attachment.#")
+
+	serve := func(method, path, contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		req.Header.Set(UserHeader, "alice")
+		w := httptest.NewRecorder()
+		server.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := serve("POST", "/twins/missing/attachments", "text/plain", "hello"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d for a missing twin, got %d", http.StatusNotFound, w.Code)
+	}
+	if w := serve("POST", "/twins/pump-1/attachments", "text/plain", strings.Repeat("x", 65)); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status code %d for a large file, got %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+	if w := serve("POST", "/twins/pump-1/attachments", "application/pdf", "%PDF-1.4"); w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected status code %d for a PDF, got %d", http.StatusUnsupportedMediaType, w.Code)
+	}
+	if w := serve("POST", "/twins/pump-1/attachments", "text/plain", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for an empty file, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	w := serve("POST", "/api/v1/twins/pump-1/attachments?name=../notes.txt", "text/plain; charset=utf-8", "calibrated")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var created attachment.Metadata
+	json.NewDecoder(w.Body).Decode(&created)
+	if created.Name != "notes.txt" || created.UploadedBy != "alice" || created.Size != 10 {
+		t.Errorf("Unexpected metadata %+v", created)
+	}
+	if w.Header().Get("Location") != "/api/v1/twins/pump-1/attachments/"+created.ID {
+		t.Errorf("Unexpected Location %q", w.Header().Get("Location"))
+	}
+	select {
+	case msg := <-events:
+		if msg.Topic != "attachment.added" {
+			t.Errorf("Expected attachment.added, got %s", msg.Topic)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected an attachment.added event")
+	}
+
+	// Metadata and listing
+	w = serve("GET", "/twins/pump-1/attachments", "", "")
+	var list []attachment.Metadata
+	json.NewDecoder(w.Body).Decode(&list)
+	if len(list) != 1 || list[0].ID != created.ID {
+		t.Errorf("Expected the attachment to be listed, got %+v", list)
+	}
+	if w := serve("GET", "/twins/pump-1/attachments/"+created.ID, "", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if w := serve("GET", "/twins/pump-1/attachments/0000000000000000", "", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d for a missing attachment, got %d", http.StatusNotFound, w.Code)
+	}
+
+	// Content is served as a download
+	w = serve("GET", "/twins/pump-1/attachments/"+created.ID+"/content", "", "")
+	if w.Code != http.StatusOK || w.Body.String() != "calibrated" {
+		t.Fatalf("Expected the content, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Type"); got != "text/plain; charset=utf-8" {
+		t.Errorf("Expected the stored content type, got %q", got)
+	}
+	if got := w.Header().Get("Content-Disposition"); got != `attachment; filename=notes.txt` {
+		t.Errorf("Unexpected Content-Disposition %q", got)
+	}
+	if got := w.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+		t.Errorf("Expected nosniff, got %q", got)
+	}
+
+	req := httptest.NewRequest("GET", "/twins/pump-1/attachments/"+created.ID+"/content", nil)
+	req.Header.Set("If-None-Match", w.Header().Get("ETag"))
+	w = httptest.NewRecorder()
+	server.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("Expected status code %d for a matching ETag, got %d", http.StatusNotModified, w.Code)
+	}
+
+	// Deleting
+	if w := serve("DELETE", "/twins/pump-1/attachments/"+created.ID, "", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if w := serve("GET", "/twins/pump-1/attachments/"+created.ID+"/content", "", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d after deleting, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestDeleteTwinRemovesAttachments(t *testing.T) {
+	server := setupTestServer()
+	server.Registry.Create(twin.NewDigitalTwin("pump-1", "pump"))
+
+	if _, err := server.Attachments.Add(context.Background(), "pump-1", "photo.png", "", "", []byte("\x89PNG\r\n\x1a\n")); err != nil {
+		t.Fatalf("Failed to add attachment: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	server.Router.ServeHTTP(w, httptest.NewRequest("DELETE", "/twins/pump-1", nil))
+	if w.Code != http.StatusOK && w.Code != http.StatusNoContent {
+		t.Fatalf("Failed to delete twin: %d", w.Code)
+	}
+
+	list, err := server.Attachments.List(context.Background(), "pump-1")
+	if err != nil || len(list) != 0 {
+		t.Errorf("Expected no attachments after deleting the twin, got %+v (%v)", list, err)
+	}
+}
@@ -0,0 +1,250 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+	"github.com/go-chi/chi/v5"
+)
+
+// Attribute management handlers
+
+// getTwin reads the twin of the twinID URL parameter, responding with an
+// error if there is none. The twin is the stored one; writes change a copy
+// from editTwin instead.
+func (s *Server) getTwin(w http.ResponseWriter, r *http.Request) (*twin.DigitalTwin, bool) {
+	twinID := chi.URLParam(r, "twinID")
+	if twinID == "" {
+		respondError(w, http.StatusBadRequest, "Twin ID is required")
+		return nil, false
+	}
+
+	dt, err := s.Twins.Get(twinID)
+	if err != nil {
+		if err == registry.ErrTwinNotFound {
+			respondError(w, http.StatusNotFound, "Digital twin not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to get digital twin: "+err.Error())
+		}
+		return nil, false
+	}
+	return dt, true
+}
+
+// editTwin reads a copy of the twin of the twinID URL parameter for a write
+// to change, so that a write rejected on the way, such as by the schema of
+// the twin's type, leaves the stored twin as it was. updateTwin stores it.
+func (s *Server) editTwin(w http.ResponseWriter, r *http.Request) (*twin.DigitalTwin, bool) {
+	dt, ok := s.getTwin(w, r)
+	if !ok {
+		return nil, false
+	}
+	return dt.Clone(), true
+}
+
+// updateTwin stores a changed copy of a twin, responding with 409 Conflict
+// if the twin was changed since the copy was taken
+func (s *Server) updateTwin(w http.ResponseWriter, dt *twin.DigitalTwin) bool {
+	if err := s.Twins.Update(dt); err != nil {
+		if errors.Is(err, registry.ErrRevisionConflict) {
+			respondError(w, http.StatusConflict, err.Error())
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to update digital twin: "+err.Error())
+		}
+		return false
+	}
+	return true
+}
+
+// GetAttributes handles GET /twins/{twinID}/attributes
+func (s *Server) GetAttributes(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	dt, ok := s.getTwin(w, r)
+	if !ok {
+		return
+	}
+
+	respondJSON(w, http.StatusOK, dt.GetAllAttributes())
+}
+
+// UpdateAttributes handles PUT /twins/{twinID}/attributes.
+// Attributes that are not given are left unchanged; null values remove
+// the attribute.
+func (s *Server) UpdateAttributes(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	dt, ok := s.editTwin(w, r)
+	if !ok {
+		return
+	}
+
+	var attributes map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&attributes); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	if err := twin.CheckAttributes(attributes); err != nil {
+		respondReservedAttribute(w)
+		return
+	}
+
+	for k, v := range attributes {
+		if v == nil {
+			dt.RemoveAttribute(k)
+		} else {
+			dt.SetAttribute(k, v)
+		}
+	}
+
+	recordModifier(r, dt)
+	warnings, ok := s.checkSchema(w, dt)
+	if !ok {
+		return
+	}
+	if !s.updateTwin(w, dt) {
+		return
+	}
+
+	// Publish event
+	s.PubSub.Publish("attributes.updated", map[string]interface{}{
+		"twinId":     dt.ID,
+		"attributes": attributes,
+	})
+	s.publishSchemaWarnings(dt.ID, warnings)
+
+	respondJSON(w, http.StatusOK, dt.GetAllAttributes())
+}
+
+// GetAttribute handles GET /twins/{twinID}/attributes/{attrKey}
+func (s *Server) GetAttribute(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	attrKey := chi.URLParam(r, "attrKey")
+	if attrKey == "" {
+		respondError(w, http.StatusBadRequest, "Attribute Key is required")
+		return
+	}
+
+	dt, ok := s.getTwin(w, r)
+	if !ok {
+		return
+	}
+
+	value, exists := dt.GetAttribute(attrKey)
+	if !exists {
+		respondError(w, http.StatusNotFound, "Attribute not found")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, value)
+}
+
+// UpdateAttribute handles PUT /twins/{twinID}/attributes/{attrKey}
+func (s *Server) UpdateAttribute(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	attrKey := chi.URLParam(r, "attrKey")
+	if attrKey == "" {
+		respondError(w, http.StatusBadRequest, "Attribute Key is required")
+		return
+	}
+	if twin.IsReservedAttribute(attrKey) {
+		respondReservedAttribute(w)
+		return
+	}
+
+	dt, ok := s.editTwin(w, r)
+	if !ok {
+		return
+	}
+
+	var value interface{}
+	if err := json.NewDecoder(r.Body).Decode(&value); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	if value == nil {
+		respondError(w, http.StatusBadRequest, "Attribute value must not be null; use DELETE to remove the attribute")
+		return
+	}
+
+	dt.SetAttribute(attrKey, value)
+
+	recordModifier(r, dt)
+	warnings, ok := s.checkSchema(w, dt)
+	if !ok {
+		return
+	}
+	if !s.updateTwin(w, dt) {
+		return
+	}
+
+	// Publish event
+	s.PubSub.Publish("attribute.updated", map[string]interface{}{
+		"twinId":       dt.ID,
+		"attributeKey": attrKey,
+		"value":        value,
+	})
+	s.publishSchemaWarnings(dt.ID, warnings)
+
+	respondJSON(w, http.StatusOK, value)
+}
+
+// DeleteAttribute handles DELETE /twins/{twinID}/attributes/{attrKey}
+func (s *Server) DeleteAttribute(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	attrKey := chi.URLParam(r, "attrKey")
+	if attrKey == "" {
+		respondError(w, http.StatusBadRequest, "Attribute Key is required")
+		return
+	}
+	if twin.IsReservedAttribute(attrKey) {
+		respondReservedAttribute(w)
+		return
+	}
+
+	dt, ok := s.editTwin(w, r)
+	if !ok {
+		return
+	}
+
+	if _, exists := dt.GetAttribute(attrKey); !exists {
+		respondError(w, http.StatusNotFound, "Attribute not found")
+		return
+	}
+
+	dt.RemoveAttribute(attrKey)
+
+	recordModifier(r, dt)
+	warnings, ok := s.checkSchema(w, dt)
+	if !ok {
+		return
+	}
+	if !s.updateTwin(w, dt) {
+		return
+	}
+
+	// Publish event
+	s.PubSub.Publish("attribute.deleted", map[string]string{
+		"twinId":       dt.ID,
+		"attributeKey": attrKey,
+	})
+	s.publishSchemaWarnings(dt.ID, warnings)
+
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Attribute deleted"})
+}
+
+// respondReservedAttribute rejects a client write to system attributes
+func respondReservedAttribute(w http.ResponseWriter) {
+	respondError(w, http.StatusBadRequest, "Attribute "+twin.SystemAttribute+" is reserved for the server")
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestAttributeRoutes(t *testing.T) {
+	server := setupTestServer()
+
+	dt := twin.NewDigitalTwin("pump-1", "pump")
+	dt.SetAttribute("serial", "P-100")
+	dt.SetAttribute("site", "north")
+	server.Registry.Create(dt)
+
+	events := server.PubSub.Subscribe("attribute.#")
+	bulkEvents := server.PubSub.Subscribe("attributes.updated")
+
+	serve := serveFunc(server, "")
+
+	// Single attributes
+	if w := serve("GET", "/twins/pump-1/attributes/serial", ""); w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != `"P-100"` {
+		t.Errorf("Expected the serial attribute, got %d %s", w.Code, w.Body.String())
+	}
+	if w := serve("PUT", "/api/v1/twins/pump-1/attributes/ratedFlow", "40"); w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if w := serve("PUT", "/twins/pump-1/attributes/ratedFlow", "null"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for a null value, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	select {
+	case msg := <-events:
+		payload := msg.Payload.(map[string]interface{})
+		if msg.Topic != "attribute.updated" || payload["attributeKey"] != "ratedFlow" || payload["value"] != 40.0 {
+			t.Errorf("Unexpected event %s %v", msg.Topic, payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected an attribute.updated event")
+	}
+
+	if w := serve("DELETE", "/twins/pump-1/attributes/serial", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if w := serve("DELETE", "/twins/pump-1/attributes/serial", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d for a missing attribute, got %d", http.StatusNotFound, w.Code)
+	}
+	select {
+	case msg := <-events:
+		if msg.Topic != "attribute.deleted" {
+			t.Errorf("Expected attribute.deleted, got %s", msg.Topic)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected an attribute.deleted event")
+	}
+
+	// All attributes
+	w := serve("PUT", "/twins/pump-1/attributes", `{"site": null, "owner": "ops"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	var attributes map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&attributes)
+	if len(attributes) != 2 || attributes["owner"] != "ops" || attributes["ratedFlow"] != 40.0 {
+		t.Errorf("Unexpected attributes %v", attributes)
+	}
+	select {
+	case msg := <-bulkEvents:
+		if payload := msg.Payload.(map[string]interface{}); payload["twinId"] != "pump-1" {
+			t.Errorf("Unexpected event payload %v", payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected an attributes.updated event")
+	}
+
+	if w := serve("GET", "/twins/missing/attributes", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d for a missing twin, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestSystemAttributeWrites(t *testing.T) {
+	server := setupTestServer()
+
+	serve := serveFunc(server, "")
+
+	if w := serve("POST", "/api/v1/twins", `{"id": "pump-1", "type": "pump", "attributes": {"site": "north"}}`); w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	dt, _ := server.Registry.Get("pump-1")
+	if source, _ := dt.GetSystem(twin.SystemSource); source != "api" {
+		t.Errorf("Expected the api source, got %v", source)
+	}
+
+	for _, tc := range []struct{ method, path, body string }{
+		{"POST", "/api/v1/twins", `{"id": "pump-2", "type": "pump", "attributes": {"_system": {"owner": "me"}}}`},
+		{"PATCH", "/api/v1/twins/pump-1", `{"attributes": {"_system": null}}`},
+		{"PUT", "/api/v1/twins/pump-1/attributes", `{"_system.lastSeen": "2024-01-01T00:00:00Z"}`},
+		{"PUT", "/api/v1/twins/pump-1/attributes/_system", `{"source": "device"}`},
+		{"DELETE", "/api/v1/twins/pump-1/attributes/_system", ""},
+	} {
+		if w := serve(tc.method, tc.path, tc.body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s %s: expected status code %d, got %d", tc.method, tc.path, http.StatusBadRequest, w.Code)
+		}
+	}
+
+	if source, _ := dt.GetSystem(twin.SystemSource); source != "api" || server.Registry.Count() != 1 {
+		t.Errorf("Expected the system attributes to be unchanged, got %v", source)
+	}
+	if w := serve("GET", "/api/v1/twins/pump-1/attributes/_system", ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"source":"api"`) {
+		t.Errorf("Expected the system attributes to be readable, got %d %s", w.Code, w.Body.String())
+	}
+}
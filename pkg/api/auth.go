@@ -0,0 +1,377 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/auth"
+	"github.com/go-chi/chi/v5"
+)
+
+// Authentication handlers
+
+// Cookies of the dashboard login
+const (
+	sessionCookie = "dt_session" // ID token of the signed in user
+	loginCookie   = "dt_login"   // State, nonce and return path of a login in progress
+)
+
+// loginTimeout is how long a user may take to sign in at the provider
+const loginTimeout = 10 * time.Minute
+
+// publicPaths are served without authentication: probes, the login itself,
+// and routes checking credentials of their own
+var publicPaths = map[string]bool{
+	"/health":        true,
+	"/ready":         true,
+	"/auth/login":    true,
+	"/auth/callback": true,
+	"/auth/logout":   true,
+}
+
+// public reports whether a path is served without authentication
+func public(path string) bool {
+	return publicPaths[path] ||
+		strings.HasPrefix(path, "/debug/") ||
+		strings.HasPrefix(path, "/shared/") ||
+		strings.HasPrefix(path, APIPrefix+"/shared/")
+}
+
+// SetAdminToken sets a bearer token authenticating as an admin, for minting
+// scoped tokens without an identity provider. Like OIDC, it makes every
+// request need a credential. Authentication is off while the token is empty
+// and OIDC is not configured.
+func (s *Server) SetAdminToken(token string) {
+	s.adminMutex.Lock()
+	defer s.adminMutex.Unlock()
+
+	s.adminToken = token
+}
+
+// adminIdentity is the identity of requests carrying the admin token
+var adminIdentity = auth.Identity{Subject: "admin", User: "admin", Role: auth.RoleAdmin}
+
+// authenticate requires a valid credential once OIDC or the admin token is
+// configured: a scoped token or the admin token, a bearer token issued by
+// the provider for API clients, or the session cookie of the dashboard
+// login. The role of the caller must allow the method, where POST routes
+// that only read count as reads, and scoped tokens are further limited to
+// their twins and verbs. The user of the credential replaces any X-User
+// header, so that it cannot be spoofed.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.adminMutex.RLock()
+		adminToken := s.adminToken
+		s.adminMutex.RUnlock()
+
+		if (s.OIDC == nil && adminToken == "") || public(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var id *auth.Identity
+		var err error
+		token, bearer := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		cookie, cookieErr := r.Cookie(sessionCookie)
+		switch {
+		case bearer && strings.HasPrefix(token, auth.TokenPrefix):
+			var grant *auth.Grant
+			if grant, err = s.Tokens.Verify(token); err == nil {
+				id = grant.Identity()
+			}
+		case bearer && adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1:
+			admin := adminIdentity
+			id = &admin
+		case bearer && s.OIDC != nil:
+			id, err = s.OIDC.Verify(r.Context(), token)
+		case bearer:
+			err = auth.ErrInvalidToken
+		case cookieErr == nil && s.OIDC != nil:
+			id, err = s.OIDC.VerifyIDToken(r.Context(), cookie.Value, "")
+		default:
+			w.Header().Set("WWW-Authenticate", `Bearer realm="dt"`)
+			respondError(w, http.StatusUnauthorized, "Authentication is required")
+			return
+		}
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="dt", error="invalid_token"`)
+			respondError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		method := r.Method
+		if method == http.MethodPost && replicaReads[strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, APIPrefix), "/")] {
+			method = http.MethodGet
+		}
+		if !id.Role.Allows(method) {
+			respondError(w, http.StatusForbidden, "The role of "+id.User+" does not allow "+method+" requests")
+			return
+		}
+		if id.Scope != nil && !s.inScope(id.Scope, r.URL.Path, auth.VerbOf(method)) {
+			respondError(w, http.StatusForbidden, "The token of "+id.User+" does not allow "+string(auth.VerbOf(method))+" access to "+r.URL.Path)
+			return
+		}
+
+		r.Header.Set(UserHeader, id.User)
+		next.ServeHTTP(w, r.WithContext(auth.WithIdentity(r.Context(), id)))
+	})
+}
+
+// inScope reports whether a scope allows a verb on a path. Scoped tokens
+// only reach the routes of single twins, below /twins/{twinID}.
+func (s *Server) inScope(scope *auth.Scope, path string, verb auth.Verb) bool {
+	if !scope.Allows(verb) {
+		return false
+	}
+	rest, ok := strings.CutPrefix(strings.TrimPrefix(path, APIPrefix), "/twins/")
+	if !ok {
+		return false
+	}
+	twinID, _, _ := strings.Cut(rest, "/")
+	return twinID != "" && scope.Includes(twinID, s.Groups.GroupsOf(twinID))
+}
+
+// authorizeTwin checks the verbs a request needs on a twin it names in its
+// body rather than its path, such as the source of a merge, responding with
+// 403 if the scoped token of the request does not allow them. Requests
+// without a scoped token are authorized by their role alone.
+func (s *Server) authorizeTwin(w http.ResponseWriter, r *http.Request, twinID string, verbs ...auth.Verb) bool {
+	id := auth.FromContext(r.Context())
+	if id == nil || id.Scope == nil {
+		return true
+	}
+	for _, verb := range verbs {
+		if !id.Scope.Allows(verb) || !id.Scope.Includes(twinID, s.Groups.GroupsOf(twinID)) {
+			respondError(w, http.StatusForbidden, "The token of "+id.User+" does not allow "+string(verb)+" access to twin "+twinID)
+			return false
+		}
+	}
+	return true
+}
+
+// randomToken returns a random hex string for states and nonces
+func randomToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// secureCookies reports whether cookies should be limited to HTTPS
+func secureCookies(r *http.Request) bool {
+	return r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+}
+
+// Login handles GET /auth/login, sending the user to the login page of the
+// identity provider. The optional redirect query parameter is the path the
+// user returns to once signed in.
+func (s *Server) Login(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	if s.OIDC == nil || !s.OIDC.CanLogin() {
+		respondError(w, http.StatusNotFound, "OIDC login is not configured")
+		return
+	}
+
+	// Only local paths, so that the login cannot redirect elsewhere
+	redirect := r.URL.Query().Get("redirect")
+	if !strings.HasPrefix(redirect, "/") || strings.HasPrefix(redirect, "//") || strings.HasPrefix(redirect, "/\\") {
+		redirect = "/"
+	}
+
+	state, nonce := randomToken(), randomToken()
+	http.SetCookie(w, &http.Cookie{
+		Name:     loginCookie,
+		Value:    state + "." + nonce + "." + base64.RawURLEncoding.EncodeToString([]byte(redirect)),
+		Path:     "/auth",
+		MaxAge:   int(loginTimeout / time.Second),
+		HttpOnly: true,
+		Secure:   secureCookies(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, s.OIDC.AuthCodeURL(state, nonce), http.StatusFound)
+}
+
+// LoginCallback handles GET /auth/callback, where the identity provider
+// returns the user with an authorization code. The code is exchanged for an
+// ID token, which becomes the session cookie.
+func (s *Server) LoginCallback(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	if s.OIDC == nil || !s.OIDC.CanLogin() {
+		respondError(w, http.StatusNotFound, "OIDC login is not configured")
+		return
+	}
+
+	query := r.URL.Query()
+	if e := query.Get("error"); e != "" {
+		respondError(w, http.StatusUnauthorized, "Login failed: "+e+" "+query.Get("error_description"))
+		return
+	}
+
+	cookie, err := r.Cookie(loginCookie)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "No login is in progress")
+		return
+	}
+	parts := strings.SplitN(cookie.Value, ".", 3)
+	if len(parts) != 3 || query.Get("state") == "" || query.Get("state") != parts[0] {
+		respondError(w, http.StatusBadRequest, "Login state does not match")
+		return
+	}
+	redirect, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		redirect = []byte("/")
+	}
+
+	idToken, err := s.OIDC.Exchange(r.Context(), query.Get("code"))
+	if err != nil {
+		respondError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	id, err := s.OIDC.VerifyIDToken(r.Context(), idToken, parts[1])
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	secure := secureCookies(r)
+	http.SetCookie(w, &http.Cookie{Name: loginCookie, Path: "/auth", MaxAge: -1, HttpOnly: true, Secure: secure})
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    idToken,
+		Path:     "/",
+		Expires:  id.ExpiresAt,
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, string(redirect), http.StatusFound)
+}
+
+// Logout handles POST /auth/logout, ending the dashboard session
+func (s *Server) Logout(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1, HttpOnly: true, Secure: secureCookies(r)})
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Signed out"})
+}
+
+// GetIdentity handles GET /auth/me, the identity and role of the caller
+func (s *Server) GetIdentity(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	id := auth.FromContext(r.Context())
+	if id == nil {
+		respondError(w, http.StatusNotFound, "Authentication is not configured")
+		return
+	}
+	respondJSON(w, http.StatusOK, id)
+}
+
+// requireAdmin answers 403 unless the caller is an admin, reporting whether it is
+func requireAdmin(w http.ResponseWriter, r *http.Request) (*auth.Identity, bool) {
+	id := auth.FromContext(r.Context())
+	if id == nil || !id.Role.Includes(auth.RoleAdmin) {
+		respondError(w, http.StatusForbidden, "An admin credential is required")
+		return nil, false
+	}
+	return id, true
+}
+
+// IssueToken handles POST /auth/tokens, minting a short-lived token for a
+// service account that is limited to twins, listed or by group, and verbs.
+// Only admins may issue tokens, and the token is only returned in this response.
+func (s *Server) IssueToken(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	id, ok := requireAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Account string `json:"account"`
+		auth.Scope
+		TTL string `json:"ttl"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	var ttl time.Duration
+	if req.TTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(req.TTL); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid ttl: "+err.Error())
+			return
+		}
+	}
+
+	for _, name := range req.Groups {
+		if _, err := s.Groups.Get(name); err != nil {
+			respondError(w, http.StatusBadRequest, "Unknown group "+name)
+			return
+		}
+	}
+
+	grant, err := s.Tokens.Issue(req.Account, req.Scope, ttl, id.User)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidGrant) {
+			respondError(w, http.StatusBadRequest, err.Error())
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to issue token: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, grant)
+}
+
+// ListTokens handles GET /auth/tokens, optionally of the account given by
+// the account query parameter
+func (s *Server) ListTokens(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+
+	respondJSON(w, http.StatusOK, s.Tokens.List(r.URL.Query().Get("account")))
+}
+
+// RevokeToken handles DELETE /auth/tokens/{tokenID}
+func (s *Server) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+
+	if err := s.Tokens.Revoke(chi.URLParam(r, "tokenID")); err != nil {
+		if err == auth.ErrTokenNotFound {
+			respondError(w, http.StatusNotFound, "Token not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to revoke token: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Token revoked"})
+}
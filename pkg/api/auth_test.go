@@ -0,0 +1,281 @@
+package api
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/auth"
+	"github.com/aleka07/go-digital-twin/pkg/oidc"
+	"github.com/aleka07/go-digital-twin/pkg/share"
+)
+
+// setupTestIssuer starts a fake identity provider and returns a provider
+// for it and a function signing tokens with claims. Its token endpoint
+// exchanges any code for the ID token set with the returned function.
+func setupTestIssuer(t *testing.T) (*oidc.Provider, func(claims map[string]interface{}) string, func(idToken string)) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	var idToken string
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 server.URL,
+			"authorization_endpoint": server.URL + "/authorize",
+			"token_endpoint":         server.URL + "/token",
+			"jwks_uri":               server.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		b64 := base64.RawURLEncoding.EncodeToString
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{
+			{"kty": "RSA", "kid": "k1", "n": b64(key.N.Bytes()), "e": b64(big.NewInt(int64(key.E)).Bytes())},
+		}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"id_token": idToken})
+	})
+
+	sign := func(claims map[string]interface{}) string {
+		claims["iss"] = server.URL
+		if _, ok := claims["exp"]; !ok {
+			claims["exp"] = time.Now().Add(time.Hour).Unix()
+		}
+		header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","kid":"k1"}`))
+		payload, _ := json.Marshal(claims)
+		signed := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+		digest := sha256.Sum256([]byte(signed))
+		signature, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+	}
+
+	provider, err := oidc.NewProvider(context.Background(), oidc.Options{
+		Issuer:       server.URL,
+		ClientID:     "dt",
+		ClientSecret: "s3cret",
+		RedirectURL:  "http://dt.example.com/auth/callback",
+		Audience:     "dt-api",
+		Roles:        map[string]auth.Role{"plant-operators": auth.RoleEditor},
+		DefaultRole:  auth.RoleViewer,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+	return provider, sign, func(token string) { idToken = token }
+}
+
+func TestOIDCAuthentication(t *testing.T) {
+	server := setupTestServer()
+	provider, sign, setIDToken := setupTestIssuer(t)
+	server.OIDC = provider
+
+	operator := sign(map[string]interface{}{"sub": "u-1", "email": "alice@example.com", "aud": "dt-api", "groups": []string{"plant-operators"}})
+	visitor := sign(map[string]interface{}{"sub": "u-2", "email": "bob@example.com", "aud": "dt-api"})
+
+	serve := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		req.Header.Set(UserHeader, "mallory")
+		w := httptest.NewRecorder()
+		server.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, tc := range []struct {
+		method, path, token, body string
+		code                      int
+	}{
+		{"GET", "/health", "", "", http.StatusOK},
+		{"GET", APIPrefix + "/twins", "", "", http.StatusUnauthorized},
+		{"GET", APIPrefix + "/twins", "garbage", "", http.StatusUnauthorized},
+		{"POST", APIPrefix + "/twins", operator, `{"id": "pump-1", "type": "pump"}`, http.StatusCreated},
+		{"GET", APIPrefix + "/twins/pump-1", visitor, "", http.StatusOK},
+		{"POST", APIPrefix + "/twins/read-transaction", visitor, `{"ids": ["pump-1"]}`, http.StatusOK},
+		{"PUT", APIPrefix + "/twins/pump-1/attributes/site", visitor, `"berlin"`, http.StatusForbidden},
+		{"GET", "/twins/pump-1", visitor, "", http.StatusOK},
+	} {
+		if w := serve(tc.method, tc.path, tc.token, tc.body); w.Code != tc.code {
+			t.Errorf("%s %s: expected status code %d, got %d %s", tc.method, tc.path, tc.code, w.Code, w.Body.String())
+		}
+	}
+
+	// The user of the token replaces the X-User header
+	dt, _ := server.Registry.Get("pump-1")
+	if owner, _ := dt.GetSystem("createdBy"); owner != "alice@example.com" {
+		t.Errorf("Expected the twin to be created by alice@example.com, got %v", owner)
+	}
+
+	var id auth.Identity
+	w := serve("GET", "/auth/me", visitor, "")
+	json.Unmarshal(w.Body.Bytes(), &id)
+	if id.User != "bob@example.com" || id.Role != auth.RoleViewer {
+		t.Errorf("Unexpected identity %s", w.Body.String())
+	}
+
+	// The dashboard signs in with the authorization code flow
+	w = serve("GET", "/auth/login?redirect=/dashboard", "", "")
+	location, _ := url.Parse(w.Header().Get("Location"))
+	if w.Code != http.StatusFound || location.Query().Get("client_id") != "dt" {
+		t.Fatalf("Expected a redirect to the provider, got %d %s", w.Code, w.Header().Get("Location"))
+	}
+	loginCookie := w.Result().Cookies()[0]
+	setIDToken(sign(map[string]interface{}{"sub": "u-1", "email": "alice@example.com", "aud": "dt", "nonce": strings.Split(loginCookie.Value, ".")[1]}))
+
+	req := httptest.NewRequest("GET", "/auth/callback?code=c1&state="+location.Query().Get("state"), nil)
+	req.AddCookie(loginCookie)
+	w = httptest.NewRecorder()
+	server.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/dashboard" {
+		t.Fatalf("Expected a redirect back to the dashboard, got %d %s", w.Code, w.Body.String())
+	}
+	var session *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == "dt_session" {
+			session = c
+		}
+	}
+	if session == nil || !session.HttpOnly {
+		t.Fatal("Expected an HTTP-only session cookie")
+	}
+
+	req = httptest.NewRequest("GET", APIPrefix+"/twins/pump-1", nil)
+	req.AddCookie(session)
+	w = httptest.NewRecorder()
+	server.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected the session to authenticate, got %d %s", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/auth/callback?code=c1&state=forged", nil)
+	req.AddCookie(loginCookie)
+	w = httptest.NewRecorder()
+	server.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected a forged state to be rejected, got %d", w.Code)
+	}
+}
+
+func TestScopedTokens(t *testing.T) {
+	server := setupTestServer()
+	server.SetAdminToken("admin-secret")
+
+	serve := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		server.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, body := range []string{
+		`{"id": "pump-1", "type": "pump"}`, `{"id": "pump-2", "type": "pump"}`, `{"id": "valve-1", "type": "valve"}`,
+	} {
+		if w := serve("POST", APIPrefix+"/twins", "admin-secret", body); w.Code != http.StatusCreated {
+			t.Fatalf("Failed to create twin: %d %s", w.Code, w.Body.String())
+		}
+	}
+	if w := serve("POST", APIPrefix+"/groups", "admin-secret", `{"name": "line-3", "twins": ["valve-1"]}`); w.Code != http.StatusCreated {
+		t.Fatalf("Failed to create group: %d %s", w.Code, w.Body.String())
+	}
+
+	// Only admins issue tokens
+	request := `{"account": "line-3-gateway", "twins": ["pump-1"], "groups": ["line-3"], "verbs": ["read", "write"], "ttl": "15m"}`
+	for token, code := range map[string]int{"": http.StatusUnauthorized, "wrong": http.StatusUnauthorized} {
+		if w := serve("POST", "/auth/tokens", token, request); w.Code != code {
+			t.Errorf("Expected status code %d without the admin token, got %d", code, w.Code)
+		}
+	}
+	w := serve("POST", "/auth/tokens", "admin-secret", request)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var grant auth.Grant
+	json.Unmarshal(w.Body.Bytes(), &grant)
+
+	for _, tc := range []struct {
+		method, path, body string
+		code               int
+	}{
+		{"GET", APIPrefix + "/twins/pump-1", "", http.StatusOK},
+		{"GET", "/twins/valve-1", "", http.StatusOK},
+		{"PUT", APIPrefix + "/twins/pump-1/attributes/site", `"berlin"`, http.StatusOK},
+		{"GET", APIPrefix + "/twins/pump-2", "", http.StatusForbidden},
+		{"DELETE", APIPrefix + "/twins/pump-1", "", http.StatusForbidden},
+		{"GET", APIPrefix + "/twins", "", http.StatusForbidden},
+		{"POST", "/auth/tokens", request, http.StatusForbidden},
+		// Twins named in the body are checked too
+		{"POST", APIPrefix + "/twins/pump-1/merge", `{"source": "pump-2"}`, http.StatusForbidden},
+		{"POST", APIPrefix + "/twins/pump-1/merge", `{"source": "valve-1"}`, http.StatusForbidden},
+		{"POST", APIPrefix + "/twins/pump-1/rename", `{"id": "pump-9"}`, http.StatusForbidden},
+		{"POST", APIPrefix + "/twins/pump-1/shadows", `{}`, http.StatusForbidden},
+	} {
+		if w := serve(tc.method, tc.path, grant.Token, tc.body); w.Code != tc.code {
+			t.Errorf("%s %s: expected status code %d, got %d %s", tc.method, tc.path, tc.code, w.Code, w.Body.String())
+		}
+	}
+
+	if _, err := server.Registry.Get("pump-2"); err != nil {
+		t.Errorf("Expected the twin out of scope to remain, got %v", err)
+	}
+
+	// Share links expire with the token that created them
+	w = serve("POST", APIPrefix+"/twins/pump-1/shares", grant.Token, `{"scope": "write", "ttl": "720h"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Failed to create share link: %d %s", w.Code, w.Body.String())
+	}
+	var link share.Link
+	json.Unmarshal(w.Body.Bytes(), &link)
+	if link.ExpiresAt.After(grant.ExpiresAt) {
+		t.Errorf("Expected the link to expire by %v, got %v", grant.ExpiresAt, link.ExpiresAt)
+	}
+
+	dt, _ := server.Registry.Get("pump-1")
+	if modifier, _ := dt.GetSystem("modifiedBy"); modifier != "line-3-gateway" {
+		t.Errorf("Expected the twin to be modified by the service account, got %v", modifier)
+	}
+
+	w = serve("GET", "/auth/tokens?account=line-3-gateway", "admin-secret", "")
+	var grants []auth.Grant
+	json.Unmarshal(w.Body.Bytes(), &grants)
+	if len(grants) != 1 || grants[0].Token != "" || grants[0].IssuedBy != "admin" {
+		t.Errorf("Unexpected grants %s", w.Body.String())
+	}
+
+	if w := serve("DELETE", "/auth/tokens/"+grant.ID, "admin-secret", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if w := serve("GET", APIPrefix+"/twins/pump-1", grant.Token, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a revoked token to be rejected, got %d", w.Code)
+	}
+	if w := serve("DELETE", "/auth/tokens/"+grant.ID, "admin-secret", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	for _, body := range []string{
+		`{"account": "svc", "groups": ["no-such-group"], "verbs": ["read"]}`,
+		`{"account": "svc", "twins": ["pump-1"], "verbs": ["read"], "ttl": "48h"}`,
+		`{"account": "svc", "twins": ["pump-1"], "verbs": ["read"], "ttl": "soon"}`,
+		`{"account": "svc", "verbs": ["read"]}`,
+	} {
+		if w := serve("POST", "/auth/tokens", "admin-secret", body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status code %d, got %d", body, http.StatusBadRequest, w.Code)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/aleka07/go-digital-twin/pkg/backfill"
+	"github.com/aleka07/go-digital-twin/pkg/script"
+	"github.com/go-chi/chi/v5"
+)
+
+// Backfill handlers
+
+// StartBackfill handles POST /admin/backfill
+func (s *Server) StartBackfill(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	var req backfill.Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	job, err := s.Backfill.Start(req)
+	if err != nil {
+		switch {
+		case errors.Is(err, script.ErrScriptNotFound):
+			respondError(w, http.StatusNotFound, "Script not found")
+		case errors.Is(err, backfill.ErrInvalidRequest):
+			respondError(w, http.StatusBadRequest, err.Error())
+		default:
+			respondError(w, http.StatusInternalServerError, "Failed to start backfill: "+err.Error())
+		}
+		return
+	}
+
+	w.Header().Set("Location", apiPath(r, "/admin/backfill/"+job.ID))
+	respondJSON(w, http.StatusAccepted, job)
+}
+
+// ListBackfills handles GET /admin/backfill
+func (s *Server) ListBackfills(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	respondJSON(w, http.StatusOK, s.Backfill.List())
+}
+
+// GetBackfill handles GET /admin/backfill/{jobID}
+func (s *Server) GetBackfill(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	jobID := chi.URLParam(r, "jobID")
+	if jobID == "" {
+		respondError(w, http.StatusBadRequest, "Job ID is required")
+		return
+	}
+
+	job, err := s.Backfill.Get(jobID)
+	if err != nil {
+		if err == backfill.ErrJobNotFound {
+			respondError(w, http.StatusNotFound, "Backfill job not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to get backfill job: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, job)
+}
+
+// CancelBackfill handles DELETE /admin/backfill/{jobID}
+func (s *Server) CancelBackfill(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	jobID := chi.URLParam(r, "jobID")
+	if jobID == "" {
+		respondError(w, http.StatusBadRequest, "Job ID is required")
+		return
+	}
+
+	job, err := s.Backfill.Cancel(jobID)
+	if err != nil {
+		switch err {
+		case backfill.ErrJobNotFound:
+			respondError(w, http.StatusNotFound, "Backfill job not found")
+		case backfill.ErrJobFinished:
+			respondError(w, http.StatusConflict, "Backfill job already finished")
+		default:
+			respondError(w, http.StatusInternalServerError, "Failed to cancel backfill job: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, job)
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/backfill"
+	"github.com/aleka07/go-digital-twin/pkg/script"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestBackfill(t *testing.T) {
+	server := setupTestServer()
+
+	dt := twin.NewDigitalTwin("machine-1", "machine")
+	counter := twin.NewFeatureState()
+	counter.SetProperty("good", 9.0)
+	counter.SetProperty("total", 10.0)
+	dt.AddFeature("counter", counter)
+	server.Registry.Create(dt)
+
+	server.Scripts.Create(script.Script{Name: "quality", Kind: script.KindComputed, Feature: "oee", Property: "quality", Source: `
+def compute(twin):
+    c = twin["features"]["counter"]["properties"]
+    return c["good"] / c["total"]
+`})
+
+	start := func(body map[string]interface{}) *httptest.ResponseRecorder {
+		jsonData, _ := json.Marshal(body)
+		req := httptest.NewRequest("POST", "/admin/backfill", bytes.NewBuffer(jsonData))
+		req.Header.Set("Content-Type", "application/json")
+
+		w := httptest.NewRecorder()
+		server.StartBackfill(w, req)
+		return w
+	}
+
+	if w := start(map[string]interface{}{"script": "missing"}); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+	if w := start(map[string]interface{}{}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	w := start(map[string]interface{}{"script": "quality"})
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusAccepted, w.Code, w.Body.String())
+	}
+
+	var job backfill.Job
+	json.Unmarshal(w.Body.Bytes(), &job)
+	if w.Header().Get("Location") != "/admin/backfill/"+job.ID {
+		t.Errorf("Expected Location header for job %s, got %s", job.ID, w.Header().Get("Location"))
+	}
+	server.Backfill.Wait(job.ID)
+
+	req := httptest.NewRequest("GET", "/admin/backfill/"+job.ID, nil)
+	req = req.WithContext(setURLParam(req.Context(), "jobID", job.ID))
+	w = httptest.NewRecorder()
+	server.GetBackfill(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	json.Unmarshal(w.Body.Bytes(), &job)
+	if job.State != backfill.StateCompleted || job.Updated != 1 || job.Progress != 1 {
+		t.Errorf("Unexpected job: %+v", job)
+	}
+
+	dt, _ = server.Registry.Get("machine-1")
+	oee, _ := dt.GetFeature("oee")
+	if oee == nil {
+		t.Fatal("Expected backfill to compute the oee feature")
+	}
+	if val, _ := oee.GetProperty("quality"); val != 0.9 {
+		t.Errorf("Expected quality 0.9, got %v", val)
+	}
+
+	// Finished jobs cannot be cancelled
+	req = httptest.NewRequest("DELETE", "/admin/backfill/"+job.ID, nil)
+	req = req.WithContext(setURLParam(req.Context(), "jobID", job.ID))
+	w = httptest.NewRecorder()
+	server.CancelBackfill(w, req)
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d, got %d", http.StatusConflict, w.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/admin/backfill/missing", nil)
+	req = req.WithContext(setURLParam(req.Context(), "jobID", "missing"))
+	w = httptest.NewRecorder()
+	server.GetBackfill(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/admin/backfill", nil)
+	w = httptest.NewRecorder()
+	server.ListBackfills(w, req)
+
+	var jobs []backfill.Job
+	json.Unmarshal(w.Body.Bytes(), &jobs)
+	if len(jobs) != 1 {
+		t.Errorf("Expected 1 job, got %d", len(jobs))
+	}
+}
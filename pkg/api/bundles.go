@@ -0,0 +1,165 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/aleka07/go-digital-twin/pkg/script"
+	"github.com/go-chi/chi/v5"
+)
+
+// Script bundle handlers
+
+// StageScriptBundle handles POST /script-bundles
+func (s *Server) StageScriptBundle(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	var req script.Bundle
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	if err := s.Scripts.Stage(req); err != nil {
+		switch {
+		case err == script.ErrBundleAlreadyExists:
+			respondError(w, http.StatusConflict, "Script bundle already exists")
+		case errors.Is(err, script.ErrInvalidBundle):
+			respondError(w, http.StatusBadRequest, err.Error())
+		default:
+			respondError(w, http.StatusInternalServerError, "Failed to stage script bundle: "+err.Error())
+		}
+		return
+	}
+
+	b, _ := s.Scripts.GetBundle(req.Version)
+	respondJSON(w, http.StatusCreated, b)
+}
+
+// ListScriptBundles handles GET /script-bundles
+func (s *Server) ListScriptBundles(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	respondJSON(w, http.StatusOK, s.Scripts.Bundles())
+}
+
+// GetScriptBundle handles GET /script-bundles/{version}
+func (s *Server) GetScriptBundle(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	version := chi.URLParam(r, "version")
+	if version == "" {
+		respondError(w, http.StatusBadRequest, "Bundle version is required")
+		return
+	}
+
+	b, err := s.Scripts.GetBundle(version)
+	if err != nil {
+		if err == script.ErrBundleNotFound {
+			respondError(w, http.StatusNotFound, "Script bundle not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to get script bundle: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, b)
+}
+
+// DeleteScriptBundle handles DELETE /script-bundles/{version}
+func (s *Server) DeleteScriptBundle(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	version := chi.URLParam(r, "version")
+	if version == "" {
+		respondError(w, http.StatusBadRequest, "Bundle version is required")
+		return
+	}
+
+	if err := s.Scripts.DeleteBundle(version); err != nil {
+		switch err {
+		case script.ErrBundleNotFound:
+			respondError(w, http.StatusNotFound, "Script bundle not found")
+		case script.ErrBundleActive:
+			respondError(w, http.StatusConflict, "Script bundle is active")
+		default:
+			respondError(w, http.StatusInternalServerError, "Failed to delete script bundle: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Script bundle deleted"})
+}
+
+// ValidateScriptBundle handles POST /script-bundles/{version}/validate. It
+// replays recently ingested telemetry through the bundle and the live scripts.
+func (s *Server) ValidateScriptBundle(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	version := chi.URLParam(r, "version")
+	if version == "" {
+		respondError(w, http.StatusBadRequest, "Bundle version is required")
+		return
+	}
+
+	report, err := s.Scripts.ValidateBundle(version)
+	if err != nil {
+		if err == script.ErrBundleNotFound {
+			respondError(w, http.StatusNotFound, "Script bundle not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to validate script bundle: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, report)
+}
+
+// ActivateScriptBundle handles POST /script-bundles/{version}/activate
+func (s *Server) ActivateScriptBundle(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	version := chi.URLParam(r, "version")
+	if version == "" {
+		respondError(w, http.StatusBadRequest, "Bundle version is required")
+		return
+	}
+
+	if err := s.Scripts.Activate(version); err != nil {
+		if err == script.ErrBundleNotFound {
+			respondError(w, http.StatusNotFound, "Script bundle not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to activate script bundle: "+err.Error())
+		}
+		return
+	}
+
+	b, _ := s.Scripts.GetBundle(version)
+	respondJSON(w, http.StatusOK, b)
+}
+
+// RollbackScriptBundle handles POST /script-bundles/rollback. It restores the
+// scripts that were live before the last switch.
+func (s *Server) RollbackScriptBundle(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	version, err := s.Scripts.Rollback()
+	if err != nil {
+		if err == script.ErrNoPreviousBundle {
+			respondError(w, http.StatusConflict, "No previous scripts to roll back to")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to roll back scripts: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Scripts rolled back", "version": version})
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/script"
+)
+
+func TestScriptBundles(t *testing.T) {
+	server := setupTestServer()
+
+	body := `{"version": "v1", "scripts": [{"name": "hot", "kind": "rule", "source": "def evaluate(twin):\n    return False\n"}]}`
+	req := httptest.NewRequest("POST", "/script-bundles", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+	server.StageScriptBundle(w, req)
+
+	var staged script.Bundle
+	json.Unmarshal(w.Body.Bytes(), &staged)
+	if w.Code != http.StatusCreated || staged.State != script.BundleStaged {
+		t.Fatalf("Unexpected bundle %d %s", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest("POST", "/script-bundles", bytes.NewBufferString(`{"version": "v2", "scripts": [{"name": "hot", "kind": "sensor"}]}`))
+	w = httptest.NewRecorder()
+	server.StageScriptBundle(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/script-bundles/v1/validate", nil)
+	req = req.WithContext(setURLParam(req.Context(), "version", "v1"))
+	w = httptest.NewRecorder()
+	server.ValidateScriptBundle(w, req)
+
+	var report script.ValidationReport
+	json.Unmarshal(w.Body.Bytes(), &report)
+	if w.Code != http.StatusOK || !report.Valid || len(report.Scripts) != 1 {
+		t.Errorf("Unexpected report %d %s", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest("POST", "/script-bundles/v1/activate", nil)
+	req = req.WithContext(setURLParam(req.Context(), "version", "v1"))
+	w = httptest.NewRecorder()
+	server.ActivateScriptBundle(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Failed to activate bundle: %d %s", w.Code, w.Body.String())
+	}
+	if _, err := server.Scripts.Get("hot"); err != nil {
+		t.Errorf("Expected the bundle scripts to be live, got %v", err)
+	}
+
+	req = httptest.NewRequest("DELETE", "/script-bundles/v1", nil)
+	req = req.WithContext(setURLParam(req.Context(), "version", "v1"))
+	w = httptest.NewRecorder()
+	server.DeleteScriptBundle(w, req)
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d, got %d", http.StatusConflict, w.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/script-bundles/rollback", nil)
+	w = httptest.NewRecorder()
+	server.RollbackScriptBundle(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Failed to roll back: %d %s", w.Code, w.Body.String())
+	}
+	if _, err := server.Scripts.Get("hot"); err != script.ErrScriptNotFound {
+		t.Errorf("Expected the previous scripts to be live, got %v", err)
+	}
+
+	req = httptest.NewRequest("GET", "/script-bundles/v9", nil)
+	req = req.WithContext(setURLParam(req.Context(), "version", "v9"))
+	w = httptest.NewRecorder()
+	server.GetScriptBundle(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
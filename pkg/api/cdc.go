@@ -0,0 +1,39 @@
+package api
+
+import (
+	"net/http"
+)
+
+// CDC export handlers
+
+// GetCDCStatus handles GET /admin/cdc
+func (s *Server) GetCDCStatus(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	if s.CDC == nil {
+		respondError(w, http.StatusServiceUnavailable, "CDC export is not configured")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, s.CDC.Status())
+}
+
+// FlushCDC handles POST /admin/cdc/flush. It sends the oldest pending
+// changes right away, without waiting for a backoff to expire.
+func (s *Server) FlushCDC(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	if s.CDC == nil {
+		respondError(w, http.StatusServiceUnavailable, "CDC export is not configured")
+		return
+	}
+
+	if _, err := s.CDC.Flush(r.Context()); err != nil {
+		respondError(w, http.StatusBadGateway, "Failed to deliver changes: "+err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, s.CDC.Status())
+}
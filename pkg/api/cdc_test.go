@@ -0,0 +1,51 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/cdc"
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+)
+
+func TestCDC(t *testing.T) {
+	server := setupTestServer()
+
+	req := httptest.NewRequest("GET", "/admin/cdc", nil)
+	w := httptest.NewRecorder()
+	server.GetCDCStatus(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+
+	fail := true
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+		}
+	}))
+	defer sink.Close()
+
+	server.CDC, _ = cdc.NewExporter(cdc.Options{URL: sink.URL})
+	server.CDC.HandleEvent(messaging_sim.Message{Topic: "twin.created", Payload: map[string]string{"id": "pump-1"}})
+
+	req = httptest.NewRequest("POST", "/admin/cdc/flush", nil)
+	w = httptest.NewRecorder()
+	server.FlushCDC(w, req)
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadGateway, w.Code)
+	}
+
+	fail = false
+	req = httptest.NewRequest("POST", "/admin/cdc/flush", nil)
+	w = httptest.NewRecorder()
+	server.FlushCDC(w, req)
+
+	var status cdc.Status
+	json.Unmarshal(w.Body.Bytes(), &status)
+	if w.Code != http.StatusOK || status.Pending != 0 || status.Acked != 1 || status.Failures != 1 {
+		t.Errorf("Unexpected status %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// Limits of paginated twin listings
+const (
+	maxListLimit      = 10000           // Twins per page
+	cursorTTL         = 5 * time.Minute // Listings not read from for longer expire
+	maxCursorSessions = 100             // Listings kept at once; the least recently read are dropped
+)
+
+// errCursorExpired is returned for cursors of expired or unknown listings
+var errCursorExpired = errors.New("cursor expired")
+
+// cursorSession is a paginated listing. It holds the IDs of the listed twins
+// in their order when the listing started, so that pages are cut from the
+// same ordering however twins are created and deleted in between.
+type cursorSession struct {
+	ids      []string
+	limit    int
+	lastRead time.Time
+}
+
+// cursorStore keeps the sessions of paginated listings. Cursors name a
+// session and an offset into it, so reading a page again, e.g. on a retry,
+// returns the same twins.
+type cursorStore struct {
+	sessions map[string]*cursorSession
+	mutex    sync.Mutex
+}
+
+// newCursorStore creates an empty cursor store
+func newCursorStore() *cursorStore {
+	return &cursorStore{sessions: make(map[string]*cursorSession)}
+}
+
+// start snapshots the IDs of a listing and returns its session ID
+func (c *cursorStore) start(ids []string, limit int) string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	var oldest string
+	for id, session := range c.sessions {
+		if now.Sub(session.lastRead) > cursorTTL {
+			delete(c.sessions, id)
+		} else if oldest == "" || session.lastRead.Before(c.sessions[oldest].lastRead) {
+			oldest = id
+		}
+	}
+	if len(c.sessions) >= maxCursorSessions {
+		delete(c.sessions, oldest)
+	}
+
+	b := make([]byte, 12)
+	rand.Read(b)
+	id := hex.EncodeToString(b)
+	c.sessions[id] = &cursorSession{ids: ids, limit: limit, lastRead: now}
+	return id
+}
+
+// page returns up to limit IDs of a session from offset, or the session's
+// own limit when limit is zero, and the offset of the next page, which is
+// zero after the last page
+func (c *cursorStore) page(id string, offset, limit int) ([]string, int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	session, exists := c.sessions[id]
+	if !exists || time.Since(session.lastRead) > cursorTTL {
+		delete(c.sessions, id)
+		return nil, 0, errCursorExpired
+	}
+	session.lastRead = time.Now()
+
+	if limit == 0 {
+		limit = session.limit
+	}
+	if offset > len(session.ids) {
+		offset = len(session.ids)
+	}
+	end := offset + limit
+	if end >= len(session.ids) {
+		return session.ids[offset:], 0, nil
+	}
+	return session.ids[offset:end], end, nil
+}
+
+// parseListLimit parses the limit query parameter of a listing, which is
+// zero when not given
+func parseListLimit(r *http.Request) (int, error) {
+	raw := r.URL.Query().Get("limit")
+	if raw == "" {
+		return 0, nil
+	}
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit <= 0 || limit > maxListLimit {
+		return 0, fmt.Errorf("invalid limit: %s, expected 1 to %d", raw, maxListLimit)
+	}
+	return limit, nil
+}
+
+// respondTwinPage responds with the first page of a listing of twins, or
+// with all of them when no limit is given
+func (s *Server) respondTwinPage(w http.ResponseWriter, r *http.Request, twins []*twin.DigitalTwin, limit int) {
+	if limit == 0 || len(twins) <= limit {
+		respondJSON(w, http.StatusOK, twinsBody(r, twins))
+		return
+	}
+
+	ids := make([]string, len(twins))
+	for i, dt := range twins {
+		ids[i] = dt.ID
+	}
+	session := s.cursors.start(ids, limit)
+	setNextCursor(w, r, session, limit)
+	respondJSON(w, http.StatusOK, twinsBody(r, twins[:limit]))
+}
+
+// respondCursorPage responds with the page of a listing a cursor points at.
+// Twins deleted since the listing started are left out, and twins created
+// since are not listed.
+func (s *Server) respondCursorPage(w http.ResponseWriter, r *http.Request, cursor string, limit int) {
+	session, raw, _ := strings.Cut(cursor, ".")
+	offset, err := strconv.Atoi(raw)
+	if err != nil || offset < 0 {
+		respondError(w, http.StatusBadRequest, "Invalid cursor: "+cursor)
+		return
+	}
+
+	ids, next, err := s.cursors.page(session, offset, limit)
+	if err != nil {
+		respondError(w, http.StatusGone, "Cursor expired; start the listing again")
+		return
+	}
+
+	twins := make([]*twin.DigitalTwin, 0, len(ids))
+	for _, id := range ids {
+		if dt, err := s.Twins.Get(id); err == nil {
+			twins = append(twins, dt)
+		}
+	}
+	if next > 0 {
+		setNextCursor(w, r, session, next)
+	}
+	respondJSON(w, http.StatusOK, twinsBody(r, twins))
+}
+
+// setNextCursor links the next page of a listing
+func setNextCursor(w http.ResponseWriter, r *http.Request, session string, offset int) {
+	next := url.Values{"cursor": {session + "." + strconv.Itoa(offset)}}
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		next.Set("limit", limit)
+	}
+	w.Header().Add("Link", "<"+r.URL.Path+"?"+next.Encode()+`>; rel="next"`)
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestListTwinsCursor(t *testing.T) {
+	server := setupTestServer()
+	for i := 0; i < 10; i++ {
+		server.Registry.Create(twin.NewDigitalTwin(fmt.Sprintf("pump-%02d", i), "pump"))
+	}
+
+	next := regexp.MustCompile(`<([^>]*)>; rel="next"`)
+	list := func(url string) ([]string, string) {
+		req := httptest.NewRequest("GET", url, nil)
+		w := httptest.NewRecorder()
+		server.ListTwins(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected status code %d, got %d %s", url, http.StatusOK, w.Code, w.Body.String())
+		}
+		var twins []Twin
+		json.Unmarshal(w.Body.Bytes(), &twins)
+		ids := make([]string, len(twins))
+		for i, dt := range twins {
+			ids[i] = dt.ID
+		}
+		var link string
+		if m := next.FindStringSubmatch(w.Header().Get("Link")); m != nil {
+			link = m[1]
+		}
+		return ids, link
+	}
+
+	seen := make(map[string]int)
+	url := "/twins?limit=3"
+	for page := 0; url != ""; page++ {
+		var ids []string
+		ids, url = list(url)
+		for _, id := range ids {
+			seen[id]++
+		}
+
+		// Twins created and deleted while listing shift no page
+		server.Registry.Create(twin.NewDigitalTwin(fmt.Sprintf("pump-%02d-new", page), "pump"))
+		server.Registry.Create(twin.NewDigitalTwin(fmt.Sprintf("a-%d", page), "pump"))
+		if page == 1 {
+			server.Registry.Delete("pump-00")
+			server.Registry.Delete("pump-08")
+		}
+	}
+	for i := 0; i < 10; i++ {
+		if id := fmt.Sprintf("pump-%02d", i); i != 8 && seen[id] != 1 {
+			t.Errorf("Expected %s to be listed once, got %d", id, seen[id])
+		}
+	}
+	if seen["pump-08"] != 0 || len(seen) != 9 {
+		t.Errorf("Unexpected listing %v", seen)
+	}
+
+	// Pages can be read again
+	_, link := list("/twins?limit=4")
+	first, _ := list(link)
+	again, _ := list(link)
+	if fmt.Sprint(first) != fmt.Sprint(again) {
+		t.Errorf("Expected the same page, got %v and %v", first, again)
+	}
+
+	for url, code := range map[string]int{
+		"/twins?limit=0":               http.StatusBadRequest,
+		"/twins?limit=100000":          http.StatusBadRequest,
+		"/twins?cursor=abc":            http.StatusBadRequest,
+		"/twins?cursor=0123456789ab.3": http.StatusGone,
+	} {
+		req := httptest.NewRequest("GET", url, nil)
+		w := httptest.NewRecorder()
+		server.ListTwins(w, req)
+		if w.Code != code {
+			t.Errorf("%s: expected status code %d, got %d", url, code, w.Code)
+		}
+	}
+}
+
+func TestCursorStore(t *testing.T) {
+	c := newCursorStore()
+	first := c.start([]string{"a", "b", "c"}, 2)
+	if ids, next, err := c.page(first, 2, 0); err != nil || fmt.Sprint(ids) != "[c]" || next != 0 {
+		t.Errorf("Unexpected last page %v %d %v", ids, next, err)
+	}
+
+	// The least recently read listing is dropped when full
+	for i := 1; i < maxCursorSessions; i++ {
+		c.start(nil, 1)
+	}
+	c.page(first, 0, 0)
+	c.start(nil, 1)
+	if _, _, err := c.page(first, 0, 0); err != nil {
+		t.Errorf("Expected the listing read last to be kept, got %v", err)
+	}
+	if len(c.sessions) != maxCursorSessions {
+		t.Errorf("Expected %d listings, got %d", maxCursorSessions, len(c.sessions))
+	}
+
+	c.sessions[first].lastRead = time.Now().Add(-cursorTTL - time.Second)
+	if _, _, err := c.page(first, 0, 0); err != errCursorExpired {
+		t.Errorf("Expected errCursorExpired, got %v", err)
+	}
+}
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/cdc"
+	"github.com/aleka07/go-digital-twin/pkg/eventbus"
+	"github.com/aleka07/go-digital-twin/pkg/ingest"
+	"github.com/go-chi/chi/v5"
+)
+
+// Profiling and runtime diagnostics handlers
+
+// GCStats summarize garbage collection
+type GCStats struct {
+	Cycles       uint32  `json:"cycles"`
+	PauseTotal   string  `json:"pauseTotal"`
+	LastPause    string  `json:"lastPause"`
+	LastGC       string  `json:"lastGC,omitempty"`
+	CPUFraction  float64 `json:"cpuFraction"` // Share of CPU time used by the collector since startup
+	NextGCTarget uint64  `json:"nextGCTarget"`
+}
+
+// MemStats summarize the memory of the process
+type MemStats struct {
+	HeapAlloc   uint64 `json:"heapAlloc"`
+	HeapInuse   uint64 `json:"heapInuse"`
+	HeapObjects uint64 `json:"heapObjects"`
+	StackInuse  uint64 `json:"stackInuse"`
+	Sys         uint64 `json:"sys"` // Memory obtained from the OS
+}
+
+// SubsystemGauges are the current queue depths and sizes of the server's components
+type SubsystemGauges struct {
+	Twins     int              `json:"twins"` // Twins in memory
+	Ingestion ingest.Load      `json:"ingestion"`
+	Events    eventbus.Load    `json:"events"`
+	TwinCache TwinCacheStats   `json:"twinCache"`
+	UDP       *ingest.UDPStats `json:"udp,omitempty"`
+	CDC       *cdc.Status      `json:"cdc,omitempty"`
+}
+
+// RuntimeDiagnostics is the response body of GET /debug/runtime
+type RuntimeDiagnostics struct {
+	GoVersion  string          `json:"goVersion"`
+	Uptime     string          `json:"uptime"`
+	CPUs       int             `json:"cpus"`
+	GOMAXPROCS int             `json:"gomaxprocs"`
+	Goroutines int             `json:"goroutines"`
+	Memory     MemStats        `json:"memory"`
+	GC         GCStats         `json:"gc"`
+	Subsystems SubsystemGauges `json:"subsystems"`
+}
+
+// SetDebugToken enables the /debug endpoints for requests carrying the token
+// as a bearer token. They are disabled while the token is empty.
+func (s *Server) SetDebugToken(token string) {
+	s.debugMutex.Lock()
+	defer s.debugMutex.Unlock()
+
+	s.debugToken = token
+}
+
+// requireDebugToken rejects requests to the /debug endpoints without the debug token
+func (s *Server) requireDebugToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.debugMutex.RLock()
+		token := s.debugToken
+		s.debugMutex.RUnlock()
+
+		if token == "" {
+			respondError(w, http.StatusServiceUnavailable, "Debug endpoints are not enabled")
+			return
+		}
+
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="debug"`)
+			respondError(w, http.StatusUnauthorized, "A valid debug token is required")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// debugRoutes returns the /debug routes: pprof profiles under /debug/pprof
+// and runtime diagnostics under /debug/runtime
+func (s *Server) debugRoutes() http.Handler {
+	r := chi.NewRouter()
+	r.Use(s.requireDebugToken)
+
+	r.Get("/runtime", s.GetRuntimeDiagnostics)
+	r.HandleFunc("/pprof/", pprof.Index)
+	r.HandleFunc("/pprof/cmdline", pprof.Cmdline)
+	r.HandleFunc("/pprof/profile", pprof.Profile)
+	r.HandleFunc("/pprof/symbol", pprof.Symbol)
+	r.HandleFunc("/pprof/trace", pprof.Trace)
+	r.HandleFunc("/pprof/{profile}", pprof.Index) // heap, goroutine, allocs, block, mutex, threadcreate
+	return r
+}
+
+// GetRuntimeDiagnostics handles GET /debug/runtime
+func (s *Server) GetRuntimeDiagnostics(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	gc := GCStats{
+		Cycles:       m.NumGC,
+		PauseTotal:   time.Duration(m.PauseTotalNs).String(),
+		LastPause:    time.Duration(m.PauseNs[(m.NumGC+255)%256]).String(),
+		CPUFraction:  m.GCCPUFraction,
+		NextGCTarget: m.NextGC,
+	}
+	if m.LastGC > 0 {
+		gc.LastGC = time.Unix(0, int64(m.LastGC)).UTC().Format(time.RFC3339Nano)
+	}
+
+	gauges := SubsystemGauges{
+		Twins:     s.Twins.Count(),
+		Ingestion: s.Ingester.Load(),
+		Events:    eventbus.LoadOf(s.PubSub),
+		TwinCache: s.TwinCacheStats(),
+	}
+	if s.UDP != nil {
+		stats := s.UDP.Stats()
+		gauges.UDP = &stats
+	}
+	if s.CDC != nil {
+		status := s.CDC.Status()
+		gauges.CDC = &status
+	}
+
+	respondJSON(w, http.StatusOK, RuntimeDiagnostics{
+		GoVersion:  runtime.Version(),
+		Uptime:     time.Since(s.startedAt).Round(time.Second).String(),
+		CPUs:       runtime.NumCPU(),
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+		Goroutines: runtime.NumGoroutine(),
+		Memory: MemStats{
+			HeapAlloc:   m.HeapAlloc,
+			HeapInuse:   m.HeapInuse,
+			HeapObjects: m.HeapObjects,
+			StackInuse:  m.StackInuse,
+			Sys:         m.Sys,
+		},
+		GC:         gc,
+		Subsystems: gauges,
+	})
+}
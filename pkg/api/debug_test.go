@@ -0,0 +1,52 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDebugEndpoints(t *testing.T) {
+	server := setupTestServer()
+
+	get := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		server.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := get("/debug/runtime", "secret"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code %d while disabled, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+
+	server.SetDebugToken("secret")
+	for _, token := range []string{"", "wrong"} {
+		if w := get("/debug/runtime", token); w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status code %d for token %q, got %d", http.StatusUnauthorized, token, w.Code)
+		}
+	}
+
+	w := get("/debug/runtime", "secret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var diagnostics RuntimeDiagnostics
+	if err := json.NewDecoder(w.Body).Decode(&diagnostics); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if diagnostics.Goroutines == 0 || diagnostics.Memory.HeapAlloc == 0 || diagnostics.Subsystems.Events.Subscribers == 0 {
+		t.Errorf("Unexpected diagnostics %+v", diagnostics)
+	}
+
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/goroutine?debug=1", "/debug/pprof/cmdline"} {
+		if w := get(path, "secret"); w.Code != http.StatusOK {
+			t.Errorf("Expected status code %d for %s, got %d", http.StatusOK, path, w.Code)
+		}
+	}
+}
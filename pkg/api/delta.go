@@ -0,0 +1,158 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/aleka07/go-digital-twin/pkg/delta"
+	"github.com/aleka07/go-digital-twin/pkg/query"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// Delta sync handlers
+
+// cborType is the content type of CBOR bodies
+const cborType = "application/cbor"
+
+// maxDeltaRequestSize bounds the decompressed size of a delta sync request
+const maxDeltaRequestSize = 32 << 20
+
+// DeltaSync handles POST /sync/delta. The request carries the revisions of
+// the twins a replica holds; the response the twins changed since, with only
+// their changed fields. Bodies are JSON or, with Content-Type and Accept set
+// to application/cbor, CBOR; both can be gzip-compressed with
+// Content-Encoding and Accept-Encoding.
+func (s *Server) DeltaSync(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	var req delta.Request
+	if err := decodeDeltaRequest(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	q, err := query.Parse(req.Query)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	resp := delta.Response{Epoch: s.Deltas.Epoch(), Twins: []delta.Delta{}}
+	matched := make(map[string]bool)
+	for _, dt := range s.Twins.Find(q) {
+		matched[dt.ID] = true
+
+		since := req.Revisions[dt.ID]
+		if req.Epoch != resp.Epoch {
+			since = 0
+		}
+		if since != 0 && since == dt.GetRevision() {
+			continue
+		}
+
+		doc, revision, err := twinDocument(r, dt)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "Failed to encode twin: "+err.Error())
+			return
+		}
+		resp.Twins = append(resp.Twins, s.Deltas.Diff(dt.ID, revision, doc, since))
+	}
+	sort.Slice(resp.Twins, func(i, j int) bool { return resp.Twins[i].ID < resp.Twins[j].ID })
+
+	for id := range req.Revisions {
+		if !matched[id] {
+			resp.Deleted = append(resp.Deleted, id)
+			if _, err := s.Twins.Get(id); err != nil {
+				s.Deltas.Forget(id)
+			}
+		}
+	}
+	sort.Strings(resp.Deleted)
+
+	writeDeltaResponse(w, r, resp)
+}
+
+// twinDocument returns the representation of a twin as a JSON document,
+// along with the revision it is at
+func twinDocument(r *http.Request, dt *twin.DigitalTwin) (map[string]interface{}, uint64, error) {
+	data, err := json.Marshal(twinBody(r, dt))
+	if err != nil {
+		return nil, 0, err
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, 0, err
+	}
+	revision, _ := doc["revision"].(float64)
+	return doc, uint64(revision), nil
+}
+
+// decodeDeltaRequest decodes a JSON or CBOR request body, gzip-compressed or not
+func decodeDeltaRequest(r *http.Request, req *delta.Request) error {
+	body := io.Reader(r.Body)
+	if strings.EqualFold(r.Header.Get("Content-Encoding"), "gzip") {
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		body = zr
+	}
+	data, err := io.ReadAll(io.LimitReader(body, maxDeltaRequestSize+1))
+	if err != nil {
+		return err
+	}
+	if len(data) > maxDeltaRequestSize {
+		return errors.New("request body too large")
+	}
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), cborType) {
+		value, err := delta.UnmarshalCBOR(data)
+		if err != nil {
+			return err
+		}
+		if data, err = json.Marshal(value); err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal(data, req)
+}
+
+// writeDeltaResponse writes a response as JSON or CBOR, as accepted, and
+// compresses it if gzip is accepted
+func writeDeltaResponse(w http.ResponseWriter, r *http.Request, resp delta.Response) {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	contentType := "application/json"
+	if strings.Contains(r.Header.Get("Accept"), cborType) {
+		var value interface{}
+		json.Unmarshal(data, &value)
+		if data, err = delta.MarshalCBOR(value); err != nil {
+			respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		contentType = cborType
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Vary", "Accept, Accept-Encoding")
+	if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write(data)
+		zw.Close()
+		data = buf.Bytes()
+		w.Header().Set("Content-Encoding", "gzip")
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
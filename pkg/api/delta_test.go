@@ -0,0 +1,97 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/delta"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestDeltaSync(t *testing.T) {
+	server := setupTestServer()
+	for _, id := range []string{"pump-1", "pump-2"} {
+		dt := twin.NewDigitalTwin(id, "pump")
+		dt.SetAttribute("site", "north")
+		server.Registry.Create(dt)
+	}
+	server.Registry.Create(twin.NewDigitalTwin("valve-1", "valve"))
+
+	replica := delta.NewReplica()
+	sync := func() delta.Response {
+		body, _ := json.Marshal(replica.Request("type == pump"))
+		req := httptest.NewRequest("POST", "/sync/delta", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		server.DeltaSync(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		var resp delta.Response
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if err := replica.Apply(resp); err != nil {
+			t.Fatalf("Failed to apply: %v", err)
+		}
+		return resp
+	}
+
+	if resp := sync(); len(resp.Twins) != 2 || resp.Twins[0].Twin == nil {
+		t.Fatalf("Expected both pumps in full, got %+v", resp)
+	}
+	if resp := sync(); len(resp.Twins) != 0 || len(resp.Deleted) != 0 {
+		t.Errorf("Expected no changes, got %+v", resp)
+	}
+
+	dt, _ := server.Registry.Get("pump-1")
+	dt.SetAttribute("site", "south")
+	server.Registry.Update(dt)
+	server.Registry.Delete("pump-2")
+
+	resp := sync()
+	if len(resp.Twins) != 1 || resp.Twins[0].Twin != nil || resp.Twins[0].Set["/attributes/site"] != "south" || len(resp.Deleted) != 1 {
+		t.Errorf("Expected a delta of pump-1 and pump-2 deleted, got %+v", resp)
+	}
+	if attributes := replica.Twins["pump-1"]["attributes"].(map[string]interface{}); attributes["site"] != "south" {
+		t.Errorf("Expected the replica to be updated, got %v", attributes)
+	}
+
+	// CBOR with compression
+	dt.SetAttribute("site", "east")
+	server.Registry.Update(dt)
+	body, _ := delta.MarshalCBOR(map[string]interface{}{"epoch": replica.Epoch, "revisions": map[string]interface{}{"pump-1": float64(replica.Revisions["pump-1"])}})
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write(body)
+	zw.Close()
+	req := httptest.NewRequest("POST", "/sync/delta", &compressed)
+	req.Header.Set("Content-Type", "application/cbor")
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("Accept", "application/cbor")
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	server.DeltaSync(w, req)
+	if w.Header().Get("Content-Type") != "application/cbor" || w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Unexpected headers %v", w.Header())
+	}
+	zr, _ := gzip.NewReader(w.Body)
+	data, _ := io.ReadAll(zr)
+	value, err := delta.UnmarshalCBOR(data)
+	if err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	twins := value.(map[string]interface{})["twins"].([]interface{})
+	if set := twins[0].(map[string]interface{})["set"].(map[string]interface{}); len(twins) != 2 || set["/attributes/site"] != "east" {
+		t.Errorf("Expected pump-1 changed and valve-1 in full, got %v", twins)
+	}
+
+	req = httptest.NewRequest("POST", "/sync/delta", bytes.NewReader([]byte(`{"query": "type =="}`)))
+	w = httptest.NewRecorder()
+	server.DeltaSync(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
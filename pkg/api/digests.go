@@ -0,0 +1,132 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/digest"
+	"github.com/go-chi/chi/v5"
+)
+
+// digestInfo is the JSON representation of a digest subscription
+type digestInfo struct {
+	Name     string         `json:"name"`
+	Interval string         `json:"interval"`
+	Topic    string         `json:"topic"`
+	Latest   *digest.Digest `json:"latest,omitempty"`
+}
+
+// toDigestInfo converts a digester to its JSON representation
+func toDigestInfo(d *digest.Digester, withLatest bool) digestInfo {
+	info := digestInfo{
+		Name:     d.Name(),
+		Interval: d.Interval().String(),
+		Topic:    d.Topic(),
+	}
+	if withLatest {
+		info.Latest = d.Latest()
+	}
+	return info
+}
+
+// Digest management handlers
+
+// CreateDigest handles POST /digests
+func (s *Server) CreateDigest(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	var req struct {
+		Name     string `json:"name"`
+		Interval string `json:"interval"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	interval, err := time.ParseDuration(req.Interval)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid interval: "+err.Error())
+		return
+	}
+
+	d, err := s.Digests.Create(req.Name, interval)
+	if err != nil {
+		switch {
+		case errors.Is(err, digest.ErrDigestAlreadyExists):
+			respondError(w, http.StatusConflict, "Digest already exists")
+		case errors.Is(err, digest.ErrInvalidDigest):
+			respondError(w, http.StatusBadRequest, err.Error())
+		default:
+			respondError(w, http.StatusInternalServerError, "Failed to create digest: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, toDigestInfo(d, false))
+}
+
+// ListDigests handles GET /digests
+func (s *Server) ListDigests(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	digesters := s.Digests.List()
+	result := make([]digestInfo, len(digesters))
+	for i, d := range digesters {
+		result[i] = toDigestInfo(d, false)
+	}
+
+	respondJSON(w, http.StatusOK, result)
+}
+
+// GetDigest handles GET /digests/{digestName} and includes the latest published digest
+func (s *Server) GetDigest(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	digestName := chi.URLParam(r, "digestName")
+	if digestName == "" {
+		respondError(w, http.StatusBadRequest, "Digest name is required")
+		return
+	}
+
+	d, err := s.Digests.Get(digestName)
+	if err != nil {
+		if err == digest.ErrDigestNotFound {
+			respondError(w, http.StatusNotFound, "Digest not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to get digest: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, toDigestInfo(d, true))
+}
+
+// DeleteDigest handles DELETE /digests/{digestName}
+func (s *Server) DeleteDigest(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	digestName := chi.URLParam(r, "digestName")
+	if digestName == "" {
+		respondError(w, http.StatusBadRequest, "Digest name is required")
+		return
+	}
+
+	if err := s.Digests.Delete(digestName); err != nil {
+		if err == digest.ErrDigestNotFound {
+			respondError(w, http.StatusNotFound, "Digest not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to delete digest: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Digest deleted"})
+}
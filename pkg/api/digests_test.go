@@ -0,0 +1,112 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestDigestManagement(t *testing.T) {
+	server := setupTestServer()
+	defer server.Digests.Close()
+
+	// Create a digest
+	jsonData, _ := json.Marshal(map[string]string{"name": "fleet", "interval": "1h"})
+	req := httptest.NewRequest("POST", "/digests", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	server.CreateDigest(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d", http.StatusCreated, w.Code)
+	}
+
+	// Invalid intervals are rejected
+	jsonData, _ = json.Marshal(map[string]string{"name": "other", "interval": "often"})
+	req = httptest.NewRequest("POST", "/digests", bytes.NewBuffer(jsonData))
+	w = httptest.NewRecorder()
+	server.CreateDigest(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	// Change a property through the API
+	dt := twin.NewDigitalTwin("digest-twin", "sensor")
+	dt.AddFeature("temperature", twin.NewFeatureState())
+	server.Registry.Create(dt)
+
+	jsonData, _ = json.Marshal(map[string]interface{}{"value": 21.5})
+	req = httptest.NewRequest("PUT", "/twins/digest-twin/features/temperature/properties", bytes.NewBuffer(jsonData))
+	req = req.WithContext(setURLParam(req.Context(), "twinID", "digest-twin"))
+	req = req.WithContext(setURLParam(req.Context(), "featureID", "temperature"))
+
+	w = httptest.NewRecorder()
+	server.UpdateProperties(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	// Wait for the digester to see the change, then close the period
+	d, _ := server.Digests.Get("fleet")
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if d.Flush(); d.Latest() != nil {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// Read the digest
+	req = httptest.NewRequest("GET", "/digests/fleet", nil)
+	req = req.WithContext(setURLParam(req.Context(), "digestName", "fleet"))
+
+	w = httptest.NewRecorder()
+	server.GetDigest(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var info struct {
+		Topic  string `json:"topic"`
+		Latest struct {
+			Summaries []struct {
+				TwinID      string                            `json:"twinId"`
+				ChangeCount int                               `json:"changeCount"`
+				Latest      map[string]map[string]interface{} `json:"latest"`
+			} `json:"summaries"`
+		} `json:"latest"`
+	}
+	json.NewDecoder(w.Body).Decode(&info)
+
+	if info.Topic != "digest.fleet" {
+		t.Errorf("Expected topic digest.fleet, got %s", info.Topic)
+	}
+
+	if len(info.Latest.Summaries) != 1 {
+		t.Fatalf("Expected 1 summary, got %d", len(info.Latest.Summaries))
+	}
+
+	if summary := info.Latest.Summaries[0]; summary.TwinID != "digest-twin" || summary.Latest["temperature"]["value"] != 21.5 {
+		t.Errorf("Unexpected summary: %+v", summary)
+	}
+
+	// Delete the digest
+	req = httptest.NewRequest("DELETE", "/digests/fleet", nil)
+	req = req.WithContext(setURLParam(req.Context(), "digestName", "fleet"))
+
+	w = httptest.NewRecorder()
+	server.DeleteDigest(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/aleka07/go-digital-twin/pkg/edge"
+)
+
+// Edge sync handlers
+
+// GetEdgeStatus handles GET /admin/edge
+func (s *Server) GetEdgeStatus(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	if s.Edge == nil {
+		respondError(w, http.StatusServiceUnavailable, "Edge sync is not configured")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, s.Edge.Status())
+}
+
+// SyncEdge handles POST /admin/edge/sync. It pushes pending changes to the
+// central server right away, without waiting for the interval or a backoff.
+func (s *Server) SyncEdge(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	if s.Edge == nil {
+		respondError(w, http.StatusServiceUnavailable, "Edge sync is not configured")
+		return
+	}
+
+	if _, err := s.Edge.Sync(r.Context()); err != nil {
+		respondError(w, http.StatusBadGateway, "Failed to sync with the central server: "+err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, s.Edge.Status())
+}
+
+// ReceiveEdgeChanges handles POST /edge/changes, where edge servers push the
+// changes made locally. Each change is applied only when it is based on the
+// current revision; otherwise the current twin is returned as a conflict for
+// the edge to resolve.
+func (s *Server) ReceiveEdgeChanges(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	var req edge.PushRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	results := edge.Receive(s.Registry, s.PubSub, req.Changes)
+	for i, c := range req.Changes {
+		if c.Deleted && results[i].Status == edge.Applied {
+			s.forgetTwin(r.Context(), c.TwinID)
+		}
+	}
+
+	respondJSON(w, http.StatusOK, edge.PushResponse{Results: results})
+}
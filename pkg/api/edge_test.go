@@ -0,0 +1,81 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/edge"
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/share"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestEdgeSync(t *testing.T) {
+	central := setupTestServer()
+	ts := httptest.NewServer(central.Router)
+	defer ts.Close()
+
+	server := setupTestServer()
+	req := httptest.NewRequest("GET", "/admin/edge", nil)
+	w := httptest.NewRecorder()
+	server.GetEdgeStatus(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+
+	upstream, _ := edge.NewHTTPUpstream(ts.URL+"/api/v1", "edge-1", nil)
+	server.Edge, _ = edge.NewSyncer(server.Registry, server.PubSub, upstream, edge.Options{})
+	server.Registry.Create(twin.NewDigitalTwin("pump-1", "pump"))
+	server.Edge.HandleEvent(messaging_sim.Message{Topic: "twin.created", Payload: map[string]string{"id": "pump-1"}})
+
+	req = httptest.NewRequest("POST", "/admin/edge/sync", nil)
+	w = httptest.NewRecorder()
+	server.SyncEdge(w, req)
+
+	var status edge.Status
+	json.Unmarshal(w.Body.Bytes(), &status)
+	if w.Code != http.StatusOK || !status.Online || status.Pending != 0 || status.Synced != 1 {
+		t.Errorf("Unexpected status %d %s", w.Code, w.Body.String())
+	}
+	if _, err := central.Registry.Get("pump-1"); err != nil {
+		t.Errorf("Expected the twin on the central server: %v", err)
+	}
+
+	// Stale changes conflict
+	body, _ := json.Marshal(edge.PushRequest{Edge: "edge-2", Changes: []edge.Change{{TwinID: "pump-1", Deleted: true}}})
+	req = httptest.NewRequest("POST", "/edge/changes", bytes.NewReader(body))
+	w = httptest.NewRecorder()
+	central.ReceiveEdgeChanges(w, req)
+
+	var response edge.PushResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if w.Code != http.StatusOK || len(response.Results) != 1 || response.Results[0].Status != edge.Conflict {
+		t.Errorf("Expected a conflict, got %d %s", w.Code, w.Body.String())
+	}
+
+	// Twins deleted from the edge lose their share links, as with DeleteTwin
+	link, _ := central.Shares.Create("pump-1", share.ScopeRead, time.Hour)
+	dt, _ := central.Registry.Get("pump-1")
+	body, _ = json.Marshal(edge.PushRequest{Edge: "edge-1", Changes: []edge.Change{{TwinID: "pump-1", BaseRevision: dt.GetRevision(), Deleted: true}}})
+	req = httptest.NewRequest("POST", "/edge/changes", bytes.NewReader(body))
+	w = httptest.NewRecorder()
+	central.ReceiveEdgeChanges(w, req)
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if len(response.Results) != 1 || response.Results[0].Status != edge.Applied {
+		t.Fatalf("Expected the delete to be applied, got %d %s", w.Code, w.Body.String())
+	}
+	if _, err := central.Shares.Verify(link.Token); err == nil {
+		t.Error("Expected the share link of the deleted twin to be revoked")
+	}
+
+	req = httptest.NewRequest("POST", "/edge/changes", bytes.NewReader([]byte("{")))
+	w = httptest.NewRecorder()
+	central.ReceiveEdgeChanges(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
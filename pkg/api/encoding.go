@@ -0,0 +1,50 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"sync/atomic"
+)
+
+// JSONEncoder encodes response bodies. encoding/json is used by default; a
+// faster implementation such as jsoniter or sonic can be plugged in with
+// SetJSONEncoder, as long as it produces the same JSON for the same values.
+type JSONEncoder interface {
+	// Encode writes the JSON encoding of v followed by a newline
+	Encode(w io.Writer, v interface{}) error
+}
+
+// JSONEncoderFunc adapts a function to a JSONEncoder
+type JSONEncoderFunc func(w io.Writer, v interface{}) error
+
+// Encode calls f
+func (f JSONEncoderFunc) Encode(w io.Writer, v interface{}) error {
+	return f(w, v)
+}
+
+// StandardJSON is the JSONEncoder based on encoding/json
+var StandardJSON JSONEncoder = JSONEncoderFunc(func(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+})
+
+// jsonEncoder holds the JSONEncoder used for responses
+var jsonEncoder atomic.Value
+
+func init() {
+	jsonEncoder.Store(&StandardJSON)
+}
+
+// SetJSONEncoder replaces the encoder of all response bodies; nil restores
+// StandardJSON. It should be called before the server starts, since cached
+// twin representations are not re-encoded.
+func SetJSONEncoder(e JSONEncoder) {
+	if e == nil {
+		e = StandardJSON
+	}
+	jsonEncoder.Store(&e)
+}
+
+// encodeJSON writes v with the current encoder
+func encodeJSON(w io.Writer, v interface{}) error {
+	return (*jsonEncoder.Load().(*JSONEncoder)).Encode(w, v)
+}
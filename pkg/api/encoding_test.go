@@ -0,0 +1,25 @@
+package api
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSetJSONEncoder(t *testing.T) {
+	calls := 0
+	SetJSONEncoder(JSONEncoderFunc(func(w io.Writer, v interface{}) error {
+		calls++
+		return StandardJSON.Encode(w, v)
+	}))
+	defer SetJSONEncoder(nil)
+
+	w := httptest.NewRecorder()
+	respondJSON(w, 200, map[string]string{"status": "ok"})
+	if calls != 1 || w.Body.String() != "{\"status\":\"ok\"}\n" {
+		t.Errorf("Expected the encoder to be used, got %d calls and %q", calls, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Length"); got != "16" {
+		t.Errorf("Expected Content-Length 16, got %q", got)
+	}
+}
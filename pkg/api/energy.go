@@ -0,0 +1,85 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/aleka07/go-digital-twin/pkg/energy"
+	"github.com/go-chi/chi/v5"
+)
+
+// Energy rollup handlers
+
+// GetEnergyConfig handles GET /energy/config
+func (s *Server) GetEnergyConfig(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	respondJSON(w, http.StatusOK, s.Energy.Config())
+}
+
+// SetEnergyConfig handles PUT /energy/config
+func (s *Server) SetEnergyConfig(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	var config energy.Config
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	if err := s.Energy.SetConfig(config); err != nil {
+		if errors.Is(err, energy.ErrInvalidConfig) {
+			respondError(w, http.StatusBadRequest, err.Error())
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to set energy rollup configuration: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, config)
+}
+
+// ListEnergyRollups handles GET /energy/rollups and returns the rollups of
+// the last recomputation
+func (s *Server) ListEnergyRollups(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	respondJSON(w, http.StatusOK, s.Energy.List())
+}
+
+// RecomputeEnergyRollups handles POST /energy/rollups and recomputes all
+// rollups without waiting for the next scheduled run
+func (s *Server) RecomputeEnergyRollups(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	respondJSON(w, http.StatusOK, s.Energy.Recompute())
+}
+
+// GetEnergyRollup handles GET /energy/rollups/{twinID}
+func (s *Server) GetEnergyRollup(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	twinID := chi.URLParam(r, "twinID")
+	if twinID == "" {
+		respondError(w, http.StatusBadRequest, "Twin ID is required")
+		return
+	}
+
+	rollup, err := s.Energy.Get(twinID)
+	if err != nil {
+		if err == energy.ErrRollupNotFound {
+			respondError(w, http.StatusNotFound, "Energy rollup not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to get energy rollup: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, rollup)
+}
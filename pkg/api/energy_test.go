@@ -0,0 +1,84 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/energy"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestEnergyRollups(t *testing.T) {
+	server := setupTestServer()
+
+	floor := twin.NewDigitalTwin("floor-1", "floor")
+	floor.AddRelationship("contains", "room-1")
+	floor.AddRelationship("contains", "room-2")
+	server.Registry.Create(floor)
+	for i, id := range []string{"room-1", "room-2"} {
+		room := twin.NewDigitalTwin(id, "room")
+		meter := twin.NewFeatureState()
+		meter.SetProperty("power", float64(i+1))
+		room.AddFeature("energy", meter)
+		server.Registry.Create(room)
+	}
+
+	req := httptest.NewRequest("POST", "/energy/rollups", nil)
+	w := httptest.NewRecorder()
+	server.RecomputeEnergyRollups(w, req)
+
+	var rollups []energy.Rollup
+	json.Unmarshal(w.Body.Bytes(), &rollups)
+	if w.Code != http.StatusOK || len(rollups) != 1 || rollups[0].Values["power"] != 3 {
+		t.Fatalf("Unexpected rollups %d %s", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/energy/rollups/floor-1", nil)
+	req = req.WithContext(setURLParam(req.Context(), "twinID", "floor-1"))
+	w = httptest.NewRecorder()
+	server.GetEnergyRollup(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/energy/rollups/room-1", nil)
+	req = req.WithContext(setURLParam(req.Context(), "twinID", "room-1"))
+	w = httptest.NewRecorder()
+	server.GetEnergyRollup(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestEnergyConfig(t *testing.T) {
+	server := setupTestServer()
+
+	body, _ := json.Marshal(energy.Config{Relationship: "contains", SourceFeature: "energy", Properties: []string{"power"}, TargetFeature: "energy"})
+	req := httptest.NewRequest("PUT", "/energy/config", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	server.SetEnergyConfig(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	body, _ = json.Marshal(energy.Config{Relationship: "hasPart", SourceFeature: "meter", Properties: []string{"kw"}, TargetFeature: "total"})
+	req = httptest.NewRequest("PUT", "/energy/config", bytes.NewReader(body))
+	w = httptest.NewRecorder()
+	server.SetEnergyConfig(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/energy/config", nil)
+	w = httptest.NewRecorder()
+	server.GetEnergyConfig(w, req)
+
+	var config energy.Config
+	json.Unmarshal(w.Body.Bytes(), &config)
+	if config.Relationship != "hasPart" {
+		t.Errorf("Expected the new config, got %s", w.Body.String())
+	}
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/aleka07/go-digital-twin/pkg/export"
+	"github.com/aleka07/go-digital-twin/pkg/query"
+	"github.com/go-chi/chi/v5"
+)
+
+// Export handlers
+
+// ExportTwinsCSV handles GET /twins/export.csv?query=...&columns=...
+func (s *Server) ExportTwinsCSV(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	q, err := query.Parse(r.URL.Query().Get("query"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	columns, err := export.ParseColumns(r.URL.Query().Get("columns"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	twins := s.Twins.Find(q)
+
+	w.Header().Set("Content-Type", export.CSVContentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="twins.csv"`)
+	w.WriteHeader(http.StatusOK)
+	export.WriteCSV(w, twins, columns)
+}
+
+// StartParquetExport handles POST /admin/exports/parquet
+func (s *Server) StartParquetExport(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	if s.Parquet == nil {
+		respondError(w, http.StatusServiceUnavailable, "Parquet export is not configured")
+		return
+	}
+
+	var req export.Request
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+			return
+		}
+	}
+
+	job, err := s.Parquet.Start(req)
+	if err != nil {
+		if errors.Is(err, export.ErrInvalidRequest) {
+			respondError(w, http.StatusBadRequest, err.Error())
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to start export: "+err.Error())
+		}
+		return
+	}
+
+	w.Header().Set("Location", apiPath(r, "/admin/exports/parquet/"+job.ID))
+	respondJSON(w, http.StatusAccepted, job)
+}
+
+// ListParquetExports handles GET /admin/exports/parquet
+func (s *Server) ListParquetExports(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	if s.Parquet == nil {
+		respondJSON(w, http.StatusOK, []export.Job{})
+		return
+	}
+
+	respondJSON(w, http.StatusOK, s.Parquet.List())
+}
+
+// GetParquetExport handles GET /admin/exports/parquet/{jobID}
+func (s *Server) GetParquetExport(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	jobID := chi.URLParam(r, "jobID")
+	if jobID == "" {
+		respondError(w, http.StatusBadRequest, "Job ID is required")
+		return
+	}
+
+	if s.Parquet == nil {
+		respondError(w, http.StatusNotFound, "Export job not found")
+		return
+	}
+
+	job, err := s.Parquet.Get(jobID)
+	if err != nil {
+		if err == export.ErrJobNotFound {
+			respondError(w, http.StatusNotFound, "Export job not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to get export job: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, job)
+}
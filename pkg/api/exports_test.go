@@ -0,0 +1,122 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/export"
+	"github.com/aleka07/go-digital-twin/pkg/objstore"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestExportTwinsCSV(t *testing.T) {
+	server := setupTestServer()
+
+	for _, id := range []string{"pump-2", "pump-1", "valve-1"} {
+		dt := twin.NewDigitalTwin(id, strings.Split(id, "-")[0])
+		dt.SetAttribute("location", "hall-"+id)
+		server.Registry.Create(dt)
+	}
+
+	get := func(params url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/twins/export.csv?"+params.Encode(), nil)
+		w := httptest.NewRecorder()
+		server.ExportTwinsCSV(w, req)
+		return w
+	}
+
+	w := get(url.Values{"query": {"type == pump"}, "columns": {"id,attributes.location"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != export.CSVContentType {
+		t.Errorf("Expected content type %s, got %s", export.CSVContentType, ct)
+	}
+
+	expected := "id,attributes.location\npump-1,hall-pump-1\npump-2,hall-pump-2\n"
+	if w.Body.String() != expected {
+		t.Errorf("Expected CSV %q, got %q", expected, w.Body.String())
+	}
+
+	if w := get(url.Values{"query": {"type ~ pump"}}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for invalid query, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w := get(url.Values{"columns": {"owner"}}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for invalid column, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestParquetExport(t *testing.T) {
+	server := setupTestServer()
+
+	req := httptest.NewRequest("POST", "/admin/exports/parquet", nil)
+	w := httptest.NewRecorder()
+	server.StartParquetExport(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+
+	store := objstore.NewMemoryStore()
+	server.Parquet = export.NewParquetExporter(server.Registry, server.History, store, "")
+	server.History.Record("pump-1", "sensor", "pressure", 2.5, time.Now().Add(-time.Minute))
+
+	jsonData, _ := json.Marshal(map[string]interface{}{"from": "2024-01-02T00:00:00Z", "to": "2024-01-01T00:00:00Z"})
+	req = httptest.NewRequest("POST", "/admin/exports/parquet", bytes.NewBuffer(jsonData))
+	w = httptest.NewRecorder()
+	server.StartParquetExport(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/admin/exports/parquet", nil)
+	w = httptest.NewRecorder()
+	server.StartParquetExport(w, req)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusAccepted, w.Code, w.Body.String())
+	}
+
+	var job export.Job
+	json.Unmarshal(w.Body.Bytes(), &job)
+	server.Parquet.Wait(job.ID)
+
+	req = httptest.NewRequest("GET", "/admin/exports/parquet/"+job.ID, nil)
+	req = req.WithContext(setURLParam(req.Context(), "jobID", job.ID))
+	w = httptest.NewRecorder()
+	server.GetParquetExport(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	json.Unmarshal(w.Body.Bytes(), &job)
+	if job.State != export.StateCompleted || job.Rows != 1 || len(job.Files) != 1 {
+		t.Errorf("Unexpected job: %+v", job)
+	}
+
+	req = httptest.NewRequest("GET", "/admin/exports/parquet/missing", nil)
+	req = req.WithContext(setURLParam(req.Context(), "jobID", "missing"))
+	w = httptest.NewRecorder()
+	server.GetParquetExport(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/admin/exports/parquet", nil)
+	w = httptest.NewRecorder()
+	server.ListParquetExports(w, req)
+
+	var jobs []export.Job
+	json.Unmarshal(w.Body.Bytes(), &jobs)
+	if len(jobs) != 1 {
+		t.Errorf("Expected 1 job, got %d", len(jobs))
+	}
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// GetTwinByExternalID handles GET /twins/by-external-id/{system}/{externalID},
+// returning the twin an external system, such as an ERP, knows by an ID kept
+// in the twin's externalIds attribute. IDs shared by several twins are
+// answered with 409 Conflict and the IDs of the twins.
+func (s *Server) GetTwinByExternalID(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	system := chi.URLParam(r, "system")
+	externalID := chi.URLParam(r, "externalID")
+	if system == "" || externalID == "" {
+		respondError(w, http.StatusBadRequest, "System and external ID are required")
+		return
+	}
+
+	ids := s.Registry.ResolveExternalID(system, externalID)
+	switch len(ids) {
+	case 0:
+		respondError(w, http.StatusNotFound, "No digital twin has external ID "+externalID+" in "+system)
+		return
+	case 1:
+	default:
+		respondJSON(w, http.StatusConflict, map[string]interface{}{
+			"error": "Several digital twins have external ID " + externalID + " in " + system,
+			"twins": ids,
+		})
+		return
+	}
+
+	dt, err := s.Twins.Get(ids[0])
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Digital twin not found")
+		return
+	}
+	respondJSON(w, http.StatusOK, twinBody(r, dt))
+}
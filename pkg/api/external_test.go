@@ -0,0 +1,48 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestGetTwinByExternalID(t *testing.T) {
+	server := setupTestServer()
+
+	serve := serveFunc(server, APIPrefix)
+
+	serve("POST", "/twins", `{"id": "pump-1", "type": "pump", "attributes": {"externalIds": {"erp": "4711", "mac": ["00:1a:2b:3c:4d:5e"]}}}`)
+	serve("POST", "/twins", `{"id": "pump-2", "type": "pump"}`)
+	if w := serve("PUT", "/twins/pump-2/attributes/externalIds", `{"erp": 4712, "serial": "SN-2"}`); w.Code >= 300 {
+		t.Fatalf("Failed to set external IDs: %d %s", w.Code, w.Body.String())
+	}
+
+	for path, want := range map[string]string{
+		"/twins/by-external-id/erp/4711":              "pump-1",
+		"/twins/by-external-id/mac/00:1a:2b:3c:4d:5e": "pump-1",
+		"/twins/by-external-id/erp/4712":              "pump-2",
+		"/twins/by-external-id/serial/SN-2":           "pump-2",
+	} {
+		w := serve("GET", path, "")
+		var dt Twin
+		json.Unmarshal(w.Body.Bytes(), &dt)
+		if w.Code != http.StatusOK || dt.ID != want {
+			t.Errorf("%s: expected %s, got %d %s", path, want, w.Code, w.Body.String())
+		}
+	}
+
+	if w := serve("GET", "/twins/by-external-id/erp/9999", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	// Shared external IDs are ambiguous
+	serve("PUT", "/twins/pump-2/attributes/externalIds", `{"erp": "4711"}`)
+	w := serve("GET", "/twins/by-external-id/erp/4711", "")
+	var conflict struct {
+		Twins []string `json:"twins"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &conflict)
+	if w.Code != http.StatusConflict || len(conflict.Twins) != 2 {
+		t.Errorf("Expected a conflict listing both twins, got %d %s", w.Code, w.Body.String())
+	}
+}
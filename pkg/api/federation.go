@@ -0,0 +1,83 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/aleka07/go-digital-twin/pkg/federation"
+	"github.com/go-chi/chi/v5"
+)
+
+// Federation handlers
+
+// forwardedHeaders are the response headers of a peer passed on to the client
+var forwardedHeaders = []string{"Content-Type", "ETag", "Location"}
+
+// federated serves the twins of peer servers under /twins/{twinID}. Reads
+// bring the local copy up to date first, so the regular handlers can serve
+// it; writes are delegated to the peer, or rejected when it does not accept
+// delegated writes.
+func (s *Server) federated(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.Federation == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		twinID := chi.URLParam(r, "twinID")
+
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			if err := s.Federation.Fetch(r.Context(), twinID); err != nil {
+				respondError(w, http.StatusBadGateway, err.Error())
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if s.Federation.Peer(twinID) == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// The path below the API prefix is the same on the peer
+		target := r.URL.EscapedPath()
+		target = target[strings.Index(target, "/twins/"):]
+		if r.URL.RawQuery != "" {
+			target += "?" + r.URL.RawQuery
+		}
+
+		resp, err := s.Federation.Forward(r, twinID, target)
+		switch {
+		case errors.Is(err, federation.ErrReadOnly):
+			respondError(w, http.StatusForbidden, err.Error())
+			return
+		case err != nil:
+			respondError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+		defer resp.Body.Close()
+
+		for _, name := range forwardedHeaders {
+			if value := resp.Header.Get(name); value != "" {
+				w.Header().Set(name, value)
+			}
+		}
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	})
+}
+
+// GetFederationStatus handles GET /admin/federation
+func (s *Server) GetFederationStatus(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	if s.Federation == nil {
+		respondError(w, http.StatusServiceUnavailable, "Federation is not configured")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, s.Federation.Status())
+}
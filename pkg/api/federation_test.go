@@ -0,0 +1,80 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/federation"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestFederation(t *testing.T) {
+	peer := setupTestServer()
+	peer.Registry.Create(twin.NewDigitalTwin("b-pump-1", "pump"))
+	peer.Registry.Create(twin.NewDigitalTwin("c-pump-1", "pump"))
+	ts := httptest.NewServer(peer.Router)
+	defer ts.Close()
+
+	server := setupTestServer()
+	req := httptest.NewRequest("GET", "/api/v1/admin/federation", nil)
+	w := httptest.NewRecorder()
+	server.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+
+	server.Federation, _ = federation.NewManager(server.Registry, server.PubSub, []federation.PeerOptions{
+		{Name: "site-b", URL: ts.URL + "/api/v1", Twins: []string{"b-*"}, DelegateWrites: true},
+		{Name: "site-c", URL: ts.URL + "/api/v1", Twins: []string{"c-*"}},
+	})
+
+	// Reads go through to the peer
+	req = httptest.NewRequest("GET", "/api/v1/twins/b-pump-1", nil)
+	w = httptest.NewRecorder()
+	server.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"id":"b-pump-1"`) {
+		t.Fatalf("Expected the twin of the peer, got %d %s", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/api/v1/twins/b-pump-9", nil)
+	w = httptest.NewRecorder()
+	server.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	// Writes are delegated to the peer
+	req = httptest.NewRequest("PUT", "/api/v1/twins/b-pump-1/attributes/site", strings.NewReader(`"south"`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	server.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected the write to be delegated, got %d %s", w.Code, w.Body.String())
+	}
+	for name, s := range map[string]*Server{"peer": peer, "local copy": server} {
+		dt, _ := s.Registry.Get("b-pump-1")
+		if site, _ := dt.GetAttribute("site"); site != "south" {
+			t.Errorf("Expected the attribute at the %s, got %v", name, site)
+		}
+	}
+
+	req = httptest.NewRequest("DELETE", "/api/v1/twins/c-pump-1", nil)
+	w = httptest.NewRecorder()
+	server.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, got %d", http.StatusForbidden, w.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/api/v1/admin/federation", nil)
+	w = httptest.NewRecorder()
+	server.Router.ServeHTTP(w, req)
+
+	var status []federation.PeerStatus
+	json.Unmarshal(w.Body.Bytes(), &status)
+	if w.Code != http.StatusOK || len(status) != 2 || status[0].Twins != 1 || status[0].Forwarded != 1 {
+		t.Errorf("Unexpected status %d %s", w.Code, w.Body.String())
+	}
+}
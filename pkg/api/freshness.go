@@ -0,0 +1,90 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/aleka07/go-digital-twin/pkg/freshness"
+	"github.com/go-chi/chi/v5"
+)
+
+// Freshness SLA handlers
+
+// ListFreshnessSLAs handles GET /freshness
+func (s *Server) ListFreshnessSLAs(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	respondJSON(w, http.StatusOK, s.Freshness.List())
+}
+
+// ListStaleProperties handles GET /freshness/stale and returns the properties
+// flagged by the last freshness check
+func (s *Server) ListStaleProperties(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	respondJSON(w, http.StatusOK, s.Freshness.Stale())
+}
+
+// SetFreshnessSLA handles PUT /freshness/{featureID}/{propKey}
+func (s *Server) SetFreshnessSLA(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	featureID := chi.URLParam(r, "featureID")
+	propKey := chi.URLParam(r, "propKey")
+
+	if featureID == "" || propKey == "" {
+		respondError(w, http.StatusBadRequest, "Feature ID and Property Key are required")
+		return
+	}
+
+	var sla freshness.SLA
+	if err := json.NewDecoder(r.Body).Decode(&sla); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	// Use the feature and property from the URL
+	sla.FeatureID = featureID
+	sla.Property = propKey
+
+	if err := s.Freshness.Set(sla); err != nil {
+		if errors.Is(err, freshness.ErrInvalidSLA) {
+			respondError(w, http.StatusBadRequest, err.Error())
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to set freshness SLA: "+err.Error())
+		}
+		return
+	}
+
+	sla, _ = s.Freshness.Get(featureID, propKey)
+	respondJSON(w, http.StatusOK, sla)
+}
+
+// DeleteFreshnessSLA handles DELETE /freshness/{featureID}/{propKey}
+func (s *Server) DeleteFreshnessSLA(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	featureID := chi.URLParam(r, "featureID")
+	propKey := chi.URLParam(r, "propKey")
+
+	if featureID == "" || propKey == "" {
+		respondError(w, http.StatusBadRequest, "Feature ID and Property Key are required")
+		return
+	}
+
+	if err := s.Freshness.Delete(featureID, propKey); err != nil {
+		if err == freshness.ErrSLANotFound {
+			respondError(w, http.StatusNotFound, "Freshness SLA not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to delete freshness SLA: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Freshness SLA deleted"})
+}
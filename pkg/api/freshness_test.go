@@ -0,0 +1,83 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/freshness"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestFreshnessSLAs(t *testing.T) {
+	server := setupTestServer()
+
+	dt := twin.NewDigitalTwin("sensor-1", "sensor")
+	climate := twin.NewFeatureState()
+	climate.SetPropertyAt("temperature", 21.0, time.Now().Add(-time.Hour))
+	dt.AddFeature("climate", climate)
+	server.Registry.Create(dt)
+
+	set := func(body map[string]interface{}) *httptest.ResponseRecorder {
+		jsonData, _ := json.Marshal(body)
+		req := httptest.NewRequest("PUT", "/freshness/climate/temperature", bytes.NewBuffer(jsonData))
+		ctx := setURLParam(req.Context(), "featureID", "climate")
+		ctx = setURLParam(ctx, "propKey", "temperature")
+		req = req.WithContext(ctx)
+		w := httptest.NewRecorder()
+		server.SetFreshnessSLA(w, req)
+		return w
+	}
+
+	if w := set(map[string]interface{}{"interval": "soon"}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	w := set(map[string]interface{}{"interval": "15m"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var sla freshness.SLA
+	json.Unmarshal(w.Body.Bytes(), &sla)
+	if sla.FeatureID != "climate" || sla.Property != "temperature" || sla.Interval != "15m0s" {
+		t.Errorf("Unexpected SLA %+v", sla)
+	}
+
+	server.Freshness.Check()
+
+	req := httptest.NewRequest("GET", "/freshness/stale", nil)
+	w = httptest.NewRecorder()
+	server.ListStaleProperties(w, req)
+
+	var stale []freshness.StaleProperty
+	json.Unmarshal(w.Body.Bytes(), &stale)
+	if len(stale) != 1 || stale[0].TwinID != "sensor-1" {
+		t.Errorf("Expected sensor-1 to be stale, got %+v", stale)
+	}
+
+	// The flag shows in the property metadata
+	if meta, _ := climate.GetPropertyMetadata("temperature"); !meta.Stale {
+		t.Error("Expected the property to be flagged stale")
+	}
+
+	del := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("DELETE", "/freshness/climate/temperature", nil)
+		ctx := setURLParam(req.Context(), "featureID", "climate")
+		ctx = setURLParam(ctx, "propKey", "temperature")
+		req = req.WithContext(ctx)
+		w := httptest.NewRecorder()
+		server.DeleteFreshnessSLA(w, req)
+		return w
+	}
+
+	if w := del(); w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if w := del(); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/aleka07/go-digital-twin/pkg/golden"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/go-chi/chi/v5"
+)
+
+// Golden twin handlers
+
+// ListGoldens handles GET /golden
+func (s *Server) ListGoldens(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	respondJSON(w, http.StatusOK, s.Golden.List())
+}
+
+// SetGolden handles PUT /golden/{twinType}
+func (s *Server) SetGolden(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	twinType := chi.URLParam(r, "twinType")
+	if twinType == "" {
+		respondError(w, http.StatusBadRequest, "Twin type is required")
+		return
+	}
+
+	var g golden.Golden
+	if err := json.NewDecoder(r.Body).Decode(&g); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	// Use the type from the URL
+	g.Type = twinType
+
+	if err := s.Golden.Set(g); err != nil {
+		switch {
+		case err == registry.ErrTwinNotFound:
+			respondError(w, http.StatusNotFound, "Digital twin not found")
+		case errors.Is(err, golden.ErrInvalidGolden):
+			respondError(w, http.StatusBadRequest, err.Error())
+		default:
+			respondError(w, http.StatusInternalServerError, "Failed to set golden twin: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, g)
+}
+
+// GetGolden handles GET /golden/{twinType}
+func (s *Server) GetGolden(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	twinType := chi.URLParam(r, "twinType")
+	if twinType == "" {
+		respondError(w, http.StatusBadRequest, "Twin type is required")
+		return
+	}
+
+	g, err := s.Golden.Get(twinType)
+	if err != nil {
+		if err == golden.ErrGoldenNotFound {
+			respondError(w, http.StatusNotFound, "Golden twin not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to get golden twin: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, g)
+}
+
+// DeleteGolden handles DELETE /golden/{twinType}
+func (s *Server) DeleteGolden(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	twinType := chi.URLParam(r, "twinType")
+	if twinType == "" {
+		respondError(w, http.StatusBadRequest, "Twin type is required")
+		return
+	}
+
+	if err := s.Golden.Delete(twinType); err != nil {
+		if err == golden.ErrGoldenNotFound {
+			respondError(w, http.StatusNotFound, "Golden twin not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to delete golden twin: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Golden twin deleted"})
+}
+
+// GetDrift handles GET /twins/{twinID}/drift
+func (s *Server) GetDrift(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	twinID := chi.URLParam(r, "twinID")
+	if twinID == "" {
+		respondError(w, http.StatusBadRequest, "Twin ID is required")
+		return
+	}
+
+	report, err := s.Golden.Check(twinID)
+	if err != nil {
+		switch {
+		case err == registry.ErrTwinNotFound:
+			respondError(w, http.StatusNotFound, "Digital twin not found")
+		case errors.Is(err, golden.ErrGoldenNotFound):
+			respondError(w, http.StatusNotFound, "No golden twin for the twin's type")
+		default:
+			respondError(w, http.StatusInternalServerError, "Failed to check drift: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, report)
+}
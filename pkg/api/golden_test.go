@@ -0,0 +1,96 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/golden"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestGoldenAndDrift(t *testing.T) {
+	server := setupTestServer()
+
+	for id, setpoint := range map[string]float64{"pump-ref": 10, "pump-1": 12} {
+		dt := twin.NewDigitalTwin(id, "pump")
+		control := twin.NewFeatureState()
+		control.SetDesiredProperty("setpoint", setpoint)
+		dt.AddFeature("control", control)
+		server.Registry.Create(dt)
+	}
+
+	drift := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/twins/pump-1/drift", nil)
+		req = req.WithContext(setURLParam(req.Context(), "twinID", "pump-1"))
+		w := httptest.NewRecorder()
+		server.GetDrift(w, req)
+		return w
+	}
+
+	if w := drift(); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d without a golden twin, got %d", http.StatusNotFound, w.Code)
+	}
+
+	set := func(body map[string]interface{}) *httptest.ResponseRecorder {
+		jsonData, _ := json.Marshal(body)
+		req := httptest.NewRequest("PUT", "/golden/pump", bytes.NewBuffer(jsonData))
+		req.Header.Set("Content-Type", "application/json")
+		req = req.WithContext(setURLParam(req.Context(), "twinType", "pump"))
+		w := httptest.NewRecorder()
+		server.SetGolden(w, req)
+		return w
+	}
+
+	if w := set(map[string]interface{}{"twinId": "missing"}); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+	if w := set(map[string]interface{}{"twinId": "pump-ref", "tolerance": -1}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w := set(map[string]interface{}{"twinId": "pump-ref"}); w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	req := httptest.NewRequest("GET", "/golden/pump", nil)
+	req = req.WithContext(setURLParam(req.Context(), "twinType", "pump"))
+	w := httptest.NewRecorder()
+	server.GetGolden(w, req)
+
+	var g golden.Golden
+	json.Unmarshal(w.Body.Bytes(), &g)
+	if w.Code != http.StatusOK || g.Type != "pump" || g.TwinID != "pump-ref" {
+		t.Errorf("Unexpected golden twin %d %+v", w.Code, g)
+	}
+
+	w = drift()
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var report golden.Report
+	json.Unmarshal(w.Body.Bytes(), &report)
+	if !report.Drifted || len(report.Deviations) != 1 || report.Deviations[0].Path != "features.control.desiredProperties.setpoint" {
+		t.Errorf("Unexpected drift report: %+v", report)
+	}
+
+	req = httptest.NewRequest("DELETE", "/golden/pump", nil)
+	req = req.WithContext(setURLParam(req.Context(), "twinType", "pump"))
+	w = httptest.NewRecorder()
+	server.DeleteGolden(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/golden", nil)
+	w = httptest.NewRecorder()
+	server.ListGoldens(w, req)
+
+	var list []golden.Golden
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if len(list) != 0 {
+		t.Errorf("Expected no golden twins, got %+v", list)
+	}
+}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/aleka07/go-digital-twin/pkg/graph"
+)
+
+// Graph query handlers
+
+// QueryGraph handles POST /graph/query
+func (s *Server) QueryGraph(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	var q graph.Query
+	if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	result, err := graph.Evaluate(s.Registry, q)
+	if err != nil {
+		if errors.Is(err, graph.ErrInvalidQuery) {
+			respondError(w, http.StatusBadRequest, err.Error())
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to evaluate query: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/graph"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestQueryGraph(t *testing.T) {
+	server := setupTestServer()
+
+	building := twin.NewDigitalTwin("B", "building")
+	building.AddRelationship("contains", "s-1")
+	server.Registry.Create(building)
+	server.Registry.Create(twin.NewDigitalTwin("s-1", "sensor"))
+
+	query := func(q graph.Query) *httptest.ResponseRecorder {
+		jsonData, _ := json.Marshal(q)
+		req := httptest.NewRequest("POST", "/graph/query", bytes.NewBuffer(jsonData))
+		w := httptest.NewRecorder()
+		server.QueryGraph(w, req)
+		return w
+	}
+
+	w := query(graph.Query{
+		Match:  []graph.Pattern{{From: "b", Rel: "contains", To: "s"}},
+		Where:  map[string]string{"s": "type == sensor"},
+		Return: []string{"s"},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var result graph.Result
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if len(result.Bindings) != 1 || result.Bindings[0]["s"] != "s-1" {
+		t.Errorf("Expected sensor s-1, got %v", result.Bindings)
+	}
+
+	if w := query(graph.Query{}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
@@ -0,0 +1,262 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/aleka07/go-digital-twin/pkg/group"
+	"github.com/aleka07/go-digital-twin/pkg/query"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+	"github.com/go-chi/chi/v5"
+)
+
+// Twin group handlers
+
+// respondGroupError responds with the status of a group manager error
+func respondGroupError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, group.ErrGroupNotFound):
+		respondError(w, http.StatusNotFound, "Group not found")
+	case errors.Is(err, group.ErrGroupAlreadyExists):
+		respondError(w, http.StatusConflict, "Group already exists")
+	case errors.Is(err, group.ErrInvalidDefinition):
+		respondError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, group.ErrNotStatic):
+		respondError(w, http.StatusConflict, err.Error())
+	default:
+		respondError(w, http.StatusInternalServerError, "Failed to manage group: "+err.Error())
+	}
+}
+
+// selectTwins returns the twins in a group or, without a group, the twins
+// matching a query. Giving both is an error.
+func (s *Server) selectTwins(w http.ResponseWriter, groupName, q string) ([]*twin.DigitalTwin, bool) {
+	if groupName != "" {
+		if q != "" {
+			respondError(w, http.StatusBadRequest, "Either a group or a query can be given, not both")
+			return nil, false
+		}
+		twins, err := s.Groups.Members(groupName)
+		if err != nil {
+			respondGroupError(w, err)
+			return nil, false
+		}
+		return twins, true
+	}
+
+	parsed, err := query.Parse(q)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+
+	var twins []*twin.DigitalTwin
+	for _, dt := range s.Twins.List() {
+		if parsed.Matches(dt) {
+			twins = append(twins, dt)
+		}
+	}
+	return twins, true
+}
+
+// CreateGroup handles POST /groups
+func (s *Server) CreateGroup(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	var def group.Definition
+	if err := json.NewDecoder(r.Body).Decode(&def); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	if err := s.Groups.Create(def); err != nil {
+		respondGroupError(w, err)
+		return
+	}
+
+	def, _ = s.Groups.Get(def.Name)
+	w.Header().Set("Location", apiPath(r, "/groups/"+def.Name))
+	respondJSON(w, http.StatusCreated, def)
+}
+
+// ListGroups handles GET /groups
+func (s *Server) ListGroups(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	respondJSON(w, http.StatusOK, s.Groups.Definitions())
+}
+
+// GetGroup handles GET /groups/{groupName}
+func (s *Server) GetGroup(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	name := chi.URLParam(r, "groupName")
+	if name == "" {
+		respondError(w, http.StatusBadRequest, "Group name is required")
+		return
+	}
+
+	def, err := s.Groups.Get(name)
+	if err != nil {
+		respondGroupError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, def)
+}
+
+// UpdateGroup handles PUT /groups/{groupName}, replacing the definition
+func (s *Server) UpdateGroup(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	name := chi.URLParam(r, "groupName")
+	if name == "" {
+		respondError(w, http.StatusBadRequest, "Group name is required")
+		return
+	}
+
+	var def group.Definition
+	if err := json.NewDecoder(r.Body).Decode(&def); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	if def.Name != "" && def.Name != name {
+		respondError(w, http.StatusBadRequest, "Group name does not match the path")
+		return
+	}
+	def.Name = name
+
+	if err := s.Groups.Update(def); err != nil {
+		respondGroupError(w, err)
+		return
+	}
+
+	def, _ = s.Groups.Get(name)
+	respondJSON(w, http.StatusOK, def)
+}
+
+// DeleteGroup handles DELETE /groups/{groupName}
+func (s *Server) DeleteGroup(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	name := chi.URLParam(r, "groupName")
+	if name == "" {
+		respondError(w, http.StatusBadRequest, "Group name is required")
+		return
+	}
+
+	if err := s.Groups.Delete(name); err != nil {
+		respondGroupError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Group deleted"})
+}
+
+// ListGroupTwins handles GET /groups/{groupName}/twins
+func (s *Server) ListGroupTwins(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	name := chi.URLParam(r, "groupName")
+	if name == "" {
+		respondError(w, http.StatusBadRequest, "Group name is required")
+		return
+	}
+
+	twins, err := s.Groups.Members(name)
+	if err != nil {
+		respondGroupError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, twinsBody(r, twins))
+}
+
+// UpdateGroupTwins handles PATCH /groups/{groupName}/twins. The body is
+// applied to every twin in the group like an update of a single twin; the
+// response lists the updated twins and the errors of those that failed.
+func (s *Server) UpdateGroupTwins(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	name := chi.URLParam(r, "groupName")
+	if name == "" {
+		respondError(w, http.StatusBadRequest, "Group name is required")
+		return
+	}
+
+	var req twinPatch
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	twins, err := s.Groups.Members(name)
+	if err != nil {
+		respondGroupError(w, err)
+		return
+	}
+
+	updated := make([]string, 0, len(twins))
+	failed := make(map[string]string)
+	for _, dt := range twins {
+		if err := req.apply(dt, APIVersion(r)); err != nil {
+			respondPatchError(w, err)
+			return
+		}
+		recordModifier(r, dt)
+		if err := s.Twins.Update(dt); err != nil {
+			failed[dt.ID] = err.Error()
+			continue
+		}
+		s.PubSub.Publish("twin.updated", map[string]string{"id": dt.ID})
+		updated = append(updated, dt.ID)
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"updated": updated,
+		"failed":  failed,
+	})
+}
+
+// AddGroupTwin handles PUT /groups/{groupName}/twins/{twinID} for static groups
+func (s *Server) AddGroupTwin(w http.ResponseWriter, r *http.Request) {
+	s.editGroupTwin(w, r, s.Groups.AddTwin)
+}
+
+// RemoveGroupTwin handles DELETE /groups/{groupName}/twins/{twinID} for static groups
+func (s *Server) RemoveGroupTwin(w http.ResponseWriter, r *http.Request) {
+	s.editGroupTwin(w, r, s.Groups.RemoveTwin)
+}
+
+// editGroupTwin adds a twin to or removes it from a static group
+func (s *Server) editGroupTwin(w http.ResponseWriter, r *http.Request, edit func(name, twinID string) error) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	name := chi.URLParam(r, "groupName")
+	if name == "" {
+		respondError(w, http.StatusBadRequest, "Group name is required")
+		return
+	}
+	twinID := chi.URLParam(r, "twinID")
+	if twinID == "" {
+		respondError(w, http.StatusBadRequest, "Twin ID is required")
+		return
+	}
+
+	if err := edit(name, twinID); err != nil {
+		respondGroupError(w, err)
+		return
+	}
+
+	def, _ := s.Groups.Get(name)
+	respondJSON(w, http.StatusOK, def)
+}
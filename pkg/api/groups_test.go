@@ -0,0 +1,116 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/group"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestGroupRoutes(t *testing.T) {
+	server := setupTestServer()
+	for _, id := range []string{"pump-1", "pump-2", "valve-1"} {
+		server.Registry.Create(twin.NewDigitalTwin(id, id[:len(id)-2]))
+	}
+
+	serve := serveFunc(server, "")
+	memberIDs := func(name string) []string {
+		w := serve("GET", "/api/v1/groups/"+name+"/twins", "")
+		var twins []map[string]interface{}
+		json.NewDecoder(w.Body).Decode(&twins)
+		ids := make([]string, len(twins))
+		for i, dt := range twins {
+			ids[i], _ = dt["id"].(string)
+		}
+		return ids
+	}
+
+	// Static groups
+	w := serve("POST", "/api/v1/groups", `{"name": "line-a", "twins": ["valve-1", "pump-1"]}`)
+	if w.Code != http.StatusCreated || w.Header().Get("Location") != "/api/v1/groups/line-a" {
+		t.Fatalf("Expected status code %d with a Location, got %d %q", http.StatusCreated, w.Code, w.Header().Get("Location"))
+	}
+	if w := serve("POST", "/groups", `{"name": "line-a"}`); w.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d for a duplicate group, got %d", http.StatusConflict, w.Code)
+	}
+	if w := serve("PUT", "/groups/line-a/twins/pump-2", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	serve("DELETE", "/groups/line-a/twins/valve-1", "")
+	if ids := memberIDs("line-a"); strings.Join(ids, ",") != "pump-1,pump-2" {
+		t.Errorf("Expected members pump-1 and pump-2, got %v", ids)
+	}
+
+	// Dynamic groups
+	if w := serve("POST", "/groups", `{"name": "valves", "query": "type == valve"}`); w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d", http.StatusCreated, w.Code)
+	}
+	if w := serve("PUT", "/groups/valves/twins/pump-1", ""); w.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d for a dynamic group, got %d", http.StatusConflict, w.Code)
+	}
+	if w := serve("POST", "/groups", `{"name": "bad", "query": "type ~ valve"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for an invalid query, got %d", http.StatusBadRequest, w.Code)
+	}
+	if ids := memberIDs("valves"); strings.Join(ids, ",") != "valve-1" {
+		t.Errorf("Expected member valve-1, got %v", ids)
+	}
+
+	// Bulk updates
+	w = serve("PATCH", "/api/v1/groups/line-a/twins", `{"attributes": {"site": "north"}}`)
+	var result struct {
+		Updated []string `json:"updated"`
+	}
+	json.NewDecoder(w.Body).Decode(&result)
+	if w.Code != http.StatusOK || len(result.Updated) != 2 {
+		t.Fatalf("Expected 2 twins to be updated, got %d %v", w.Code, result.Updated)
+	}
+	if dt, _ := server.Registry.Get("pump-2"); dt.Attributes["site"] != "north" {
+		t.Errorf("Expected pump-2 to be updated, got %v", dt.Attributes)
+	}
+	if w := serve("PATCH", "/api/v1/groups/line-a/twins", `{"type": null}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for a null type, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	// Redefining and deleting groups
+	if w := serve("PUT", "/groups/valves", `{"query": "type == pump"}`); w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if ids := memberIDs("valves"); len(ids) != 2 {
+		t.Errorf("Expected the redefined group to have 2 members, got %v", ids)
+	}
+	if w := serve("PUT", "/groups/valves", `{"name": "other"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for a mismatched name, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w := serve("DELETE", "/groups/valves", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if w := serve("GET", "/groups/valves", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestSelectTwinsByGroup(t *testing.T) {
+	server := setupTestServer()
+	server.Registry.Create(twin.NewDigitalTwin("pump-1", "pump"))
+	server.Groups.Create(group.Definition{Name: "line-a", Twins: []string{"pump-1"}})
+
+	for _, tc := range []struct {
+		path string
+		code int
+	}{
+		{"/kpi/twins?group=line-a", http.StatusOK},
+		{"/kpi/twins?group=missing", http.StatusNotFound},
+		{"/kpi/twins?group=line-a&query=type+%3D%3D+pump", http.StatusBadRequest},
+	} {
+		req := httptest.NewRequest("GET", tc.path, nil)
+		w := httptest.NewRecorder()
+		server.Router.ServeHTTP(w, req)
+		if w.Code != tc.code {
+			t.Errorf("Expected status code %d for %s, got %d: %s", tc.code, tc.path, w.Code, w.Body.String())
+		}
+	}
+}
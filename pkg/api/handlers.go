@@ -1,9 +1,14 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"sort"
 
+	"github.com/aleka07/go-digital-twin/pkg/eventbus"
+	"github.com/aleka07/go-digital-twin/pkg/query"
 	"github.com/aleka07/go-digital-twin/pkg/registry"
 	"github.com/aleka07/go-digital-twin/pkg/twin"
 	"github.com/go-chi/chi/v5"
@@ -33,9 +38,13 @@ func (s *Server) CreateTwin(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusBadRequest, "ID and Type are required")
 		return
 	}
+	if err := twin.CheckAttributes(req.Attributes); err != nil {
+		respondReservedAttribute(w)
+		return
+	}
 
 	// Create the digital twin
-	dt := twin.NewDigitalTwin(req.ID, req.Type)
+	dt := twin.NewDigitalTwinWithClock(req.ID, req.Type, s.Clock())
 
 	// Set optional fields
 	if req.Definition != "" {
@@ -45,11 +54,20 @@ func (s *Server) CreateTwin(w http.ResponseWriter, r *http.Request) {
 	for k, v := range req.Attributes {
 		dt.SetAttribute(k, v)
 	}
+	dt.SetSystem(twin.SystemSource, "api")
+	recordCreator(r, dt)
+
+	warnings, ok := s.checkSchema(w, dt)
+	if !ok {
+		return
+	}
 
 	// Add to registry
-	if err := s.Registry.Create(dt); err != nil {
+	if err := s.Twins.Create(dt); err != nil {
 		if err == registry.ErrTwinAlreadyExists {
 			respondError(w, http.StatusConflict, "Digital twin already exists")
+		} else if errors.Is(err, registry.ErrMemoryBudgetExceeded) {
+			respondError(w, http.StatusInsufficientStorage, err.Error())
 		} else {
 			respondError(w, http.StatusInternalServerError, "Failed to create digital twin: "+err.Error())
 		}
@@ -58,9 +76,10 @@ func (s *Server) CreateTwin(w http.ResponseWriter, r *http.Request) {
 
 	// Publish event
 	s.PubSub.Publish("twin.created", map[string]string{"id": dt.ID})
+	s.publishSchemaWarnings(dt.ID, warnings)
 
 	// Return the created twin
-	respondJSON(w, http.StatusCreated, dt)
+	respondJSON(w, http.StatusCreated, twinBody(r, dt))
 }
 
 // GetTwin handles GET /twins/{twinID}
@@ -74,7 +93,7 @@ func (s *Server) GetTwin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	dt, err := s.Registry.Get(twinID)
+	dt, err := s.Twins.Get(twinID)
 	if err != nil {
 		if err == registry.ErrTwinNotFound {
 			respondError(w, http.StatusNotFound, "Digital twin not found")
@@ -84,10 +103,12 @@ func (s *Server) GetTwin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	respondJSON(w, http.StatusOK, dt)
+	s.respondTwin(w, r, dt)
 }
 
-// UpdateTwin handles PUT /twins/{twinID}
+// UpdateTwin handles PUT and PATCH /twins/{twinID}.
+// Absent fields are left unchanged, null clears the definition and null
+// attribute values remove the attribute.
 func (s *Server) UpdateTwin(w http.ResponseWriter, r *http.Request) {
 	s.wg.Add(1)
 	defer s.wg.Done()
@@ -99,7 +120,7 @@ func (s *Server) UpdateTwin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get existing twin
-	dt, err := s.Registry.Get(twinID)
+	dt, err := s.Twins.Get(twinID)
 	if err != nil {
 		if err == registry.ErrTwinNotFound {
 			respondError(w, http.StatusNotFound, "Digital twin not found")
@@ -108,44 +129,39 @@ func (s *Server) UpdateTwin(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	// Changes go to a copy until they pass the schema; see editTwin
+	dt = dt.Clone()
 
 	// Parse update request
-	var req struct {
-		Type       string                 `json:"type,omitempty"`
-		Definition string                 `json:"definition,omitempty"`
-		Attributes map[string]interface{} `json:"attributes,omitempty"`
-	}
-
+	var req twinPatch
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
 		return
 	}
 
 	// Update fields
-	if req.Type != "" {
-		dt.Type = req.Type
+	if err := req.apply(dt, APIVersion(r)); err != nil {
+		respondPatchError(w, err)
+		return
 	}
 
-	if req.Definition != "" {
-		dt.SetDefinition(req.Definition)
-	}
+	recordModifier(r, dt)
 
-	if req.Attributes != nil {
-		for k, v := range req.Attributes {
-			dt.SetAttribute(k, v)
-		}
+	warnings, ok := s.checkSchema(w, dt)
+	if !ok {
+		return
 	}
 
 	// Update in registry
-	if err := s.Registry.Update(dt); err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to update digital twin: "+err.Error())
+	if !s.updateTwin(w, dt) {
 		return
 	}
 
 	// Publish event
 	s.PubSub.Publish("twin.updated", map[string]string{"id": dt.ID})
+	s.publishSchemaWarnings(dt.ID, warnings)
 
-	respondJSON(w, http.StatusOK, dt)
+	respondJSON(w, http.StatusOK, twinBody(r, dt))
 }
 
 // DeleteTwin handles DELETE /twins/{twinID}
@@ -159,7 +175,7 @@ func (s *Server) DeleteTwin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := s.Registry.Delete(twinID); err != nil {
+	if err := s.Twins.Delete(twinID); err != nil {
 		if err == registry.ErrTwinNotFound {
 			respondError(w, http.StatusNotFound, "Digital twin not found")
 		} else {
@@ -168,19 +184,106 @@ func (s *Server) DeleteTwin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.forgetTwin(r.Context(), twinID)
+
 	// Publish event
 	s.PubSub.Publish("twin.deleted", map[string]string{"id": twinID})
 
 	respondJSON(w, http.StatusOK, map[string]string{"message": "Digital twin deleted"})
 }
 
-// ListTwins handles GET /twins
+// forgetTwin drops what the server keeps about a deleted twin besides the
+// twin itself: its history, share links, annotations and attachments
+func (s *Server) forgetTwin(ctx context.Context, twinID string) {
+	s.History.DeleteTwin(twinID)
+	s.Shares.RevokeTwin(twinID)
+	s.Annotations.DeleteTwin(twinID)
+	s.Attachments.DeleteTwin(ctx, twinID)
+}
+
+// ForgetTwin drops what the server keeps about a twin deleted other than
+// through its API, such as by edge sync or federation
+func (s *Server) ForgetTwin(twinID string) {
+	s.forgetTwin(context.Background(), twinID)
+}
+
+// ListTwins handles GET /twins.
+// The optional modifiedSince, modifiedBefore and createdSince query parameters
+// (RFC 3339) return only the twins changed or created in that time range,
+// ordered by modification time, for incremental synchronization. The query
+// parameter returns only the twins matching a query, using the indexes, and
+// the owner parameter only the twins owned by a user.
+//
+// With limit, twins are listed in pages, ordered by ID unless filtered by
+// time; a Link header with rel="next" points at the next page. Pages are cut
+// from the IDs listed when the first page was read, so twins existing
+// throughout are listed exactly once, however twins are created and deleted
+// in between.
 func (s *Server) ListTwins(w http.ResponseWriter, r *http.Request) {
 	s.wg.Add(1)
 	defer s.wg.Done()
 
-	twins := s.Registry.List()
-	respondJSON(w, http.StatusOK, twins)
+	limit, err := parseListLimit(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+		s.respondCursorPage(w, r, cursor, limit)
+		return
+	}
+
+	modifiedSince, err := parseTimeParam(r, "modifiedSince")
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid modifiedSince parameter: "+err.Error())
+		return
+	}
+
+	modifiedBefore, err := parseTimeParam(r, "modifiedBefore")
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid modifiedBefore parameter: "+err.Error())
+		return
+	}
+
+	createdSince, err := parseTimeParam(r, "createdSince")
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid createdSince parameter: "+err.Error())
+		return
+	}
+
+	q, err := query.Parse(r.URL.Query().Get("query"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if owner := r.URL.Query().Get("owner"); owner != "" {
+		q.Conditions = append(q.Conditions, query.Condition{Path: ownerPath, Op: query.OpEqual, Value: owner})
+	}
+
+	if modifiedSince.IsZero() && modifiedBefore.IsZero() && createdSince.IsZero() {
+		twins := s.Twins.Find(q)
+		if limit > 0 {
+			sort.Slice(twins, func(i, j int) bool { return twins[i].ID < twins[j].ID })
+		}
+		s.respondTwinPage(w, r, twins, limit)
+		return
+	}
+
+	// Twins are last modified no earlier than they were created, so only
+	// twins modified since createdSince need to be checked
+	since := modifiedSince
+	if createdSince.After(since) {
+		since = createdSince
+	}
+
+	twins := s.Twins.ModifiedBetween(since, modifiedBefore)
+	matched := twins[:0]
+	for _, dt := range twins {
+		if !dt.CreatedAt.Before(createdSince) && q.Matches(dt) {
+			matched = append(matched, dt)
+		}
+	}
+	s.respondTwinPage(w, r, matched, limit)
 }
 
 // Feature management handlers
@@ -196,7 +299,7 @@ func (s *Server) GetFeatures(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	dt, err := s.Registry.Get(twinID)
+	dt, err := s.Twins.Get(twinID)
 	if err != nil {
 		if err == registry.ErrTwinNotFound {
 			respondError(w, http.StatusNotFound, "Digital twin not found")
@@ -207,7 +310,7 @@ func (s *Server) GetFeatures(w http.ResponseWriter, r *http.Request) {
 	}
 
 	features := dt.GetAllFeatures()
-	respondJSON(w, http.StatusOK, features)
+	respondJSON(w, http.StatusOK, featuresBody(r, features))
 }
 
 // GetFeature handles GET /twins/{twinID}/features/{featureID}
@@ -223,7 +326,7 @@ func (s *Server) GetFeature(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	dt, err := s.Registry.Get(twinID)
+	dt, err := s.Twins.Get(twinID)
 	if err != nil {
 		if err == registry.ErrTwinNotFound {
 			respondError(w, http.StatusNotFound, "Digital twin not found")
@@ -239,7 +342,7 @@ func (s *Server) GetFeature(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	respondJSON(w, http.StatusOK, &feature)
+	respondJSON(w, http.StatusOK, featureBody(r, feature))
 }
 
 // UpdateFeature handles PUT /twins/{twinID}/features/{featureID}
@@ -255,7 +358,7 @@ func (s *Server) UpdateFeature(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	dt, err := s.Registry.Get(twinID)
+	dt, err := s.Twins.Get(twinID)
 	if err != nil {
 		if err == registry.ErrTwinNotFound {
 			respondError(w, http.StatusNotFound, "Digital twin not found")
@@ -264,6 +367,8 @@ func (s *Server) UpdateFeature(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	// Changes go to a copy until they pass the schema; see editTwin
+	dt = dt.Clone()
 
 	var req struct {
 		Properties   map[string]interface{} `json:"properties,omitempty"`
@@ -276,19 +381,29 @@ func (s *Server) UpdateFeature(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !s.limitValueSizes(w, r, twinID, featureID, req.Properties) {
+		return
+	}
+
+	// Desired changes that require approval become a change request instead
+	var held map[string]interface{}
+	if req.DesiredProps != nil {
+		held = s.Approvals.Hold(dt, featureID, req.DesiredProps)
+	}
+
 	// Check if feature exists
 	feature, exists := dt.GetFeature(featureID)
 
 	// If feature doesn't exist, create a new one
 	if !exists {
-		feature = *twin.NewFeatureState()
+		feature = twin.NewFeatureStateWithClock(dt.Clock())
+		recordFeatureCreator(r, feature)
 	}
 
 	// Update feature fields
-	if req.Properties != nil {
-		for k, v := range req.Properties {
-			feature.SetProperty(k, v)
-		}
+	now := s.Clock().Now()
+	for k, v := range req.Properties {
+		feature.SetPropertyAt(k, v, now)
 	}
 
 	if req.DesiredProps != nil {
@@ -314,9 +429,19 @@ func (s *Server) UpdateFeature(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	recordModifier(r, dt, feature)
+
+	// Values rejected by the schema stay out of the history
+	warnings, ok := s.checkSchema(w, dt)
+	if !ok {
+		return
+	}
+	for k, v := range req.Properties {
+		s.History.Record(twinID, featureID, k, v, now)
+	}
+
 	// Update the twin in the registry
-	if err := s.Registry.Update(dt); err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to update digital twin: "+err.Error())
+	if !s.updateTwin(w, dt) {
 		return
 	}
 
@@ -325,8 +450,21 @@ func (s *Server) UpdateFeature(w http.ResponseWriter, r *http.Request) {
 		"twinId":    twinID,
 		"featureId": featureID,
 	})
+	s.publishSchemaWarnings(twinID, warnings)
+
+	if len(held) > 0 {
+		cr, err := s.Approvals.Submit(twinID, featureID, held, r.Header.Get(UserHeader))
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "Failed to create change request: "+err.Error())
+			return
+		}
+
+		w.Header().Set("Location", apiPath(r, "/change-requests/"+cr.ID))
+		respondJSON(w, http.StatusAccepted, cr)
+		return
+	}
 
-	respondJSON(w, http.StatusOK, feature)
+	respondJSON(w, http.StatusOK, featureBody(r, feature))
 }
 
 // DeleteFeature handles DELETE /twins/{twinID}/features/{featureID}
@@ -342,7 +480,7 @@ func (s *Server) DeleteFeature(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	dt, err := s.Registry.Get(twinID)
+	dt, err := s.Twins.Get(twinID)
 	if err != nil {
 		if err == registry.ErrTwinNotFound {
 			respondError(w, http.StatusNotFound, "Digital twin not found")
@@ -351,6 +489,8 @@ func (s *Server) DeleteFeature(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	// Changes go to a copy until they pass the schema; see editTwin
+	dt = dt.Clone()
 
 	if err := dt.RemoveFeature(featureID); err != nil {
 		if err == twin.ErrFeatureNotFound {
@@ -361,9 +501,15 @@ func (s *Server) DeleteFeature(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	recordModifier(r, dt)
+
+	warnings, ok := s.checkSchema(w, dt)
+	if !ok {
+		return
+	}
+
 	// Update the twin in the registry
-	if err := s.Registry.Update(dt); err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to update digital twin: "+err.Error())
+	if !s.updateTwin(w, dt) {
 		return
 	}
 
@@ -372,6 +518,7 @@ func (s *Server) DeleteFeature(w http.ResponseWriter, r *http.Request) {
 		"twinId":    twinID,
 		"featureId": featureID,
 	})
+	s.publishSchemaWarnings(twinID, warnings)
 
 	respondJSON(w, http.StatusOK, map[string]string{"message": "Feature deleted"})
 }
@@ -391,7 +538,7 @@ func (s *Server) GetProperties(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	dt, err := s.Registry.Get(twinID)
+	dt, err := s.Twins.Get(twinID)
 	if err != nil {
 		if err == registry.ErrTwinNotFound {
 			respondError(w, http.StatusNotFound, "Digital twin not found")
@@ -424,7 +571,7 @@ func (s *Server) UpdateProperties(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	dt, err := s.Registry.Get(twinID)
+	dt, err := s.Twins.Get(twinID)
 	if err != nil {
 		if err == registry.ErrTwinNotFound {
 			respondError(w, http.StatusNotFound, "Digital twin not found")
@@ -433,6 +580,8 @@ func (s *Server) UpdateProperties(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	// Changes go to a copy until they pass the schema; see editTwin
+	dt = dt.Clone()
 
 	feature, exists := dt.GetFeature(featureID)
 	if !exists {
@@ -445,10 +594,14 @@ func (s *Server) UpdateProperties(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
 		return
 	}
+	if !s.limitValueSizes(w, r, twinID, featureID, properties) {
+		return
+	}
 
 	// Update properties
+	now := s.Clock().Now()
 	for k, v := range properties {
-		feature.SetProperty(k, v)
+		feature.SetPropertyAt(k, v, now)
 	}
 
 	// Update the feature
@@ -457,22 +610,52 @@ func (s *Server) UpdateProperties(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	recordModifier(r, dt, feature)
+
+	warnings, ok := s.checkSchema(w, dt)
+	if !ok {
+		return
+	}
+	for k, v := range properties {
+		s.History.Record(twinID, featureID, k, v, now)
+	}
+
 	// Update the twin in the registry
-	if err := s.Registry.Update(dt); err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to update digital twin: "+err.Error())
+	if !s.updateTwin(w, dt) {
 		return
 	}
 
 	// Publish event
-	s.PubSub.Publish("properties.updated", map[string]string{
-		"twinId":    twinID,
-		"featureId": featureID,
+	s.PubSub.Publish("properties.updated", eventbus.PropertiesUpdated{
+		TwinID:     twinID,
+		FeatureID:  featureID,
+		Properties: properties,
 	})
+	s.publishSchemaWarnings(twinID, warnings)
 
 	respondJSON(w, http.StatusOK, feature.GetAllProperties())
 }
 
+// propertyPath returns the keys of the path below a property, such as
+// network/ip of /properties/config/network/ip, responding with 400 if the
+// path is invalid. Properties themselves are addressed without a path.
+func propertyPath(w http.ResponseWriter, r *http.Request) ([]string, bool) {
+	path, err := twin.ParsePath(chi.URLParam(r, "*"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	return path, true
+}
+
+// fullPath returns the path of a nested value from the property key on
+func fullPath(propKey string, path []string) string {
+	return propKey + "/" + twin.FormatPath(path)
+}
+
 // GetProperty handles GET /twins/{twinID}/features/{featureID}/properties/{propKey}
+// and GET .../properties/{propKey}/*, which returns the value at a path into
+// the property, such as .../properties/config/network/ip
 func (s *Server) GetProperty(w http.ResponseWriter, r *http.Request) {
 	s.wg.Add(1)
 	defer s.wg.Done()
@@ -485,8 +668,12 @@ func (s *Server) GetProperty(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusBadRequest, "Twin ID, Feature ID, and Property Key are required")
 		return
 	}
+	path, ok := propertyPath(w, r)
+	if !ok {
+		return
+	}
 
-	dt, err := s.Registry.Get(twinID)
+	dt, err := s.Twins.Get(twinID)
 	if err != nil {
 		if err == registry.ErrTwinNotFound {
 			respondError(w, http.StatusNotFound, "Digital twin not found")
@@ -507,11 +694,18 @@ func (s *Server) GetProperty(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusNotFound, "Property not found")
 		return
 	}
+	if propValue, exists = twin.ValueAt(propValue, path); !exists {
+		respondError(w, http.StatusNotFound, "Property path not found")
+		return
+	}
 
 	respondJSON(w, http.StatusOK, propValue)
 }
 
 // UpdateProperty handles PUT /twins/{twinID}/features/{featureID}/properties/{propKey}
+// and PUT .../properties/{propKey}/*, which sets the value at a path into the
+// property, creating missing objects along it. The whole property is
+// recorded in its history either way.
 func (s *Server) UpdateProperty(w http.ResponseWriter, r *http.Request) {
 	s.wg.Add(1)
 	defer s.wg.Done()
@@ -524,8 +718,12 @@ func (s *Server) UpdateProperty(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusBadRequest, "Twin ID, Feature ID, and Property Key are required")
 		return
 	}
+	path, ok := propertyPath(w, r)
+	if !ok {
+		return
+	}
 
-	dt, err := s.Registry.Get(twinID)
+	dt, err := s.Twins.Get(twinID)
 	if err != nil {
 		if err == registry.ErrTwinNotFound {
 			respondError(w, http.StatusNotFound, "Digital twin not found")
@@ -534,6 +732,8 @@ func (s *Server) UpdateProperty(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	// Changes go to a copy until they pass the schema; see editTwin
+	dt = dt.Clone()
 
 	feature, exists := dt.GetFeature(featureID)
 	if !exists {
@@ -546,9 +746,22 @@ func (s *Server) UpdateProperty(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
 		return
 	}
+	if len(path) > 0 {
+		current, _ := feature.GetProperty(propKey)
+		if propValue, err = twin.WithValueAt(current, path, propValue); err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	properties := map[string]interface{}{propKey: propValue}
+	if !s.limitValueSizes(w, r, twinID, featureID, properties) {
+		return
+	}
+	propValue = properties[propKey]
 
 	// Update property
-	feature.SetProperty(propKey, propValue)
+	now := s.Clock().Now()
+	feature.SetPropertyAt(propKey, propValue, now)
 
 	// Update the feature
 	if err := dt.UpdateFeature(featureID, feature); err != nil {
@@ -556,24 +769,40 @@ func (s *Server) UpdateProperty(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	recordModifier(r, dt, feature)
+
+	warnings, ok := s.checkSchema(w, dt)
+	if !ok {
+		return
+	}
+	s.History.Record(twinID, featureID, propKey, propValue, now)
+
 	// Update the twin in the registry
-	if err := s.Registry.Update(dt); err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to update digital twin: "+err.Error())
+	if !s.updateTwin(w, dt) {
 		return
 	}
 
-	// Publish event
-	s.PubSub.Publish("property.updated", map[string]interface{}{
+	// Publish event; the value is that of the whole property
+	event := map[string]interface{}{
 		"twinId":      twinID,
 		"featureId":   featureID,
 		"propertyKey": propKey,
 		"value":       propValue,
-	})
+	}
+	if len(path) > 0 {
+		propValue, _ = twin.ValueAt(propValue, path)
+		event["path"] = fullPath(propKey, path)
+		event["pathValue"] = propValue
+	}
+	s.PubSub.Publish("property.updated", event)
+	s.publishSchemaWarnings(twinID, warnings)
 
 	respondJSON(w, http.StatusOK, propValue)
 }
 
 // DeleteProperty handles DELETE /twins/{twinID}/features/{featureID}/properties/{propKey}
+// and DELETE .../properties/{propKey}/*, which removes the value at a path
+// into the property, such as a key of an object or an element of an array
 func (s *Server) DeleteProperty(w http.ResponseWriter, r *http.Request) {
 	s.wg.Add(1)
 	defer s.wg.Done()
@@ -586,8 +815,12 @@ func (s *Server) DeleteProperty(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusBadRequest, "Twin ID, Feature ID, and Property Key are required")
 		return
 	}
+	path, ok := propertyPath(w, r)
+	if !ok {
+		return
+	}
 
-	dt, err := s.Registry.Get(twinID)
+	dt, err := s.Twins.Get(twinID)
 	if err != nil {
 		if err == registry.ErrTwinNotFound {
 			respondError(w, http.StatusNotFound, "Digital twin not found")
@@ -596,6 +829,8 @@ func (s *Server) DeleteProperty(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	// Changes go to a copy until they pass the schema; see editTwin
+	dt = dt.Clone()
 
 	feature, exists := dt.GetFeature(featureID)
 	if !exists {
@@ -604,11 +839,15 @@ func (s *Server) DeleteProperty(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if property exists
-	_, exists = feature.GetProperty(propKey)
+	propValue, exists := feature.GetProperty(propKey)
 	if !exists {
 		respondError(w, http.StatusNotFound, "Property not found")
 		return
 	}
+	if len(path) > 0 {
+		s.deletePropertyPath(w, r, dt, featureID, feature, propKey, propValue, path)
+		return
+	}
 
 	// Remove property
 	feature.RemoveProperty(propKey)
@@ -619,9 +858,15 @@ func (s *Server) DeleteProperty(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	recordModifier(r, dt, feature)
+
+	warnings, ok := s.checkSchema(w, dt)
+	if !ok {
+		return
+	}
+
 	// Update the twin in the registry
-	if err := s.Registry.Update(dt); err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to update digital twin: "+err.Error())
+	if !s.updateTwin(w, dt) {
 		return
 	}
 
@@ -631,6 +876,49 @@ func (s *Server) DeleteProperty(w http.ResponseWriter, r *http.Request) {
 		"featureId":   featureID,
 		"propertyKey": propKey,
 	})
+	s.publishSchemaWarnings(twinID, warnings)
 
 	respondJSON(w, http.StatusOK, map[string]string{"message": "Property deleted"})
 }
+
+// deletePropertyPath removes the value at a path into a property. The
+// property remains, so the change is published as property.updated with the
+// remaining value and the path that was removed.
+func (s *Server) deletePropertyPath(w http.ResponseWriter, r *http.Request, dt *twin.DigitalTwin, featureID string, feature *twin.FeatureState, propKey string, propValue interface{}, path []string) {
+	propValue, exists := twin.WithoutValueAt(propValue, path)
+	if !exists {
+		respondError(w, http.StatusNotFound, "Property path not found")
+		return
+	}
+
+	now := s.Clock().Now()
+	feature.SetPropertyAt(propKey, propValue, now)
+	if err := dt.UpdateFeature(featureID, feature); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to update feature: "+err.Error())
+		return
+	}
+
+	recordModifier(r, dt, feature)
+
+	warnings, ok := s.checkSchema(w, dt)
+	if !ok {
+		return
+	}
+	s.History.Record(dt.ID, featureID, propKey, propValue, now)
+
+	if !s.updateTwin(w, dt) {
+		return
+	}
+
+	s.PubSub.Publish("property.updated", map[string]interface{}{
+		"twinId":      dt.ID,
+		"featureId":   featureID,
+		"propertyKey": propKey,
+		"value":       propValue,
+		"path":        fullPath(propKey, path),
+		"removed":     true,
+	})
+	s.publishSchemaWarnings(dt.ID, warnings)
+
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Property path deleted"})
+}
@@ -4,13 +4,19 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/aleka07/go-digital-twin/pkg/ingest"
 	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
 	"github.com/aleka07/go-digital-twin/pkg/registry"
 	"github.com/aleka07/go-digital-twin/pkg/twin"
+	"github.com/go-chi/chi/v5"
 )
 
 func setupTestServer() *Server {
@@ -19,6 +25,25 @@ func setupTestServer() *Server {
 	return NewServer(reg, pubsub)
 }
 
+// serveFunc returns a function serving requests through the router of a
+// server, at paths under a prefix
+func serveFunc(server *Server, prefix string) func(method, path, body string) *httptest.ResponseRecorder {
+	return serveAsFunc(server, prefix, "")
+}
+
+// serveAsFunc is serveFunc for requests of a user
+func serveAsFunc(server *Server, prefix, user string) func(method, path, body string) *httptest.ResponseRecorder {
+	return func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, prefix+path, strings.NewReader(body))
+		if user != "" {
+			req.Header.Set(UserHeader, user)
+		}
+		w := httptest.NewRecorder()
+		server.Router.ServeHTTP(w, req)
+		return w
+	}
+}
+
 func TestCreateTwin(t *testing.T) {
 	server := setupTestServer()
 
@@ -227,7 +252,7 @@ func TestFeatureManagement(t *testing.T) {
 	tempFeature.SetProperty("value", 22.5)
 	tempFeature.SetProperty("unit", "celsius")
 
-	dt.AddFeature("temperature", *tempFeature)
+	dt.AddFeature("temperature", tempFeature)
 	server.Registry.Create(dt)
 
 	// Test getting features
@@ -324,7 +349,7 @@ func TestPropertyManagement(t *testing.T) {
 	lightFeature.SetProperty("brightness", 80)
 	lightFeature.SetProperty("color", "white")
 
-	dt.AddFeature("light", *lightFeature)
+	dt.AddFeature("light", lightFeature)
 	server.Registry.Create(dt)
 
 	// Test getting properties
@@ -425,7 +450,164 @@ func TestPropertyManagement(t *testing.T) {
 // Helper function to set URL parameters in the request context
 // In a real application, this would be handled by the router
 func setURLParam(ctx context.Context, key, value string) context.Context {
-	return context.WithValue(ctx, contextKey(key), value)
+	rctx := chi.RouteContext(ctx)
+	if rctx == nil {
+		rctx = chi.NewRouteContext()
+	}
+	rctx.URLParams.Add(key, value)
+	return context.WithValue(ctx, chi.RouteCtxKey, rctx)
+}
+
+func TestListTwinsByTime(t *testing.T) {
+	server := setupTestServer()
+
+	server.Registry.Create(twin.NewDigitalTwin("old", "sensor"))
+	old, _ := server.Registry.Get("old")
+	checkpoint := old.GetModifiedAt().Add(time.Nanosecond)
+
+	server.Registry.Create(twin.NewDigitalTwin("new", "sensor"))
+	old.SetAttribute("room", "lobby")
+	server.Registry.Update(old)
+
+	list := func(query string) (int, []string) {
+		req := httptest.NewRequest("GET", "/twins?"+query, nil)
+		w := httptest.NewRecorder()
+		server.ListTwins(w, req)
+
+		var twins []map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &twins)
+		ids := []string{}
+		for _, dt := range twins {
+			ids = append(ids, dt["id"].(string))
+		}
+		return w.Code, ids
+	}
+
+	since := url.QueryEscape(checkpoint.Format(time.RFC3339Nano))
+
+	if code, ids := list("modifiedSince=" + since); code != http.StatusOK || len(ids) != 2 || ids[0] != "new" || ids[1] != "old" {
+		t.Errorf("Expected [new old], got %d %v", code, ids)
+	}
+	if code, ids := list("createdSince=" + since); code != http.StatusOK || len(ids) != 1 || ids[0] != "new" {
+		t.Errorf("Expected [new], got %d %v", code, ids)
+	}
+	if code, ids := list("modifiedBefore=" + since); code != http.StatusOK || len(ids) != 0 {
+		t.Errorf("Expected no twins, got %d %v", code, ids)
+	}
+	if code, _ := list("modifiedSince=yesterday"); code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, code)
+	}
 }
 
-type contextKey string
+// failingTwins is a registry whose updates fail
+type failingTwins struct {
+	registry.Twins
+}
+
+func (failingTwins) Update(dt *twin.DigitalTwin) error {
+	return errors.New("disk full")
+}
+
+func TestReplacedTwins(t *testing.T) {
+	server := setupTestServer()
+	server.Registry.Create(twin.NewDigitalTwin("pump-1", "pump"))
+	server.Twins = failingTwins{server.Registry}
+	events := server.PubSub.Subscribe("twin.updated")
+
+	req := httptest.NewRequest("PATCH", "/twins/pump-1", bytes.NewBufferString(`{"attributes": {"site": 1}}`))
+	w := httptest.NewRecorder()
+	server.Router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status code %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+	select {
+	case msg := <-events:
+		t.Errorf("Unexpected event %v", msg.Payload)
+	default:
+	}
+
+	// Telemetry is written through the replaced registry too
+	if _, err := server.Ingester.Apply(ingest.Telemetry{TwinID: "pump-1", Features: map[string]map[string]interface{}{"status": {"rpm": 1200}}}); err == nil {
+		t.Error("Expected the ingested telemetry to fail")
+	}
+}
+
+func TestPropertyPaths(t *testing.T) {
+	server := setupTestServer()
+	events := server.PubSub.Subscribe("property.updated")
+
+	serve := serveFunc(server, APIPrefix)
+
+	serve("POST", "/twins", `{"id": "gw-1", "type": "gateway"}`)
+	serve("PUT", "/twins/gw-1/features/device", `{"properties": {"config": {"network": {"ip": "10.0.0.2"}, "ports": [80]}}}`)
+	const config = "/twins/gw-1/features/device/properties/config"
+
+	w := serve("GET", config+"/network/ip", "")
+	if w.Code != http.StatusOK || w.Body.String() != `"10.0.0.2"`+"\n" {
+		t.Errorf("Expected the nested ip, got %d %s", w.Code, w.Body.String())
+	}
+
+	// Setting a nested value keeps its siblings and creates missing objects
+	if w := serve("PUT", config+"/network/ip", `"10.0.0.3"`); w.Code != http.StatusOK || w.Body.String() != `"10.0.0.3"`+"\n" {
+		t.Fatalf("Failed to set nested value: %d %s", w.Code, w.Body.String())
+	}
+	msg := <-events
+	event := msg.Payload.(map[string]interface{})
+	if event["path"] != "config/network/ip" || event["pathValue"] != "10.0.0.3" {
+		t.Errorf("Expected the path in the event, got %v", event)
+	}
+	if value, _ := twin.ValueAt(event["value"], []string{"ports", "0"}); value != 80.0 {
+		t.Errorf("Expected the event to carry the whole property, got %v", event["value"])
+	}
+	if w := serve("PUT", config+"/wifi/ssid", `"plant"`); w.Code != http.StatusOK {
+		t.Fatalf("Failed to create nested objects: %d %s", w.Code, w.Body.String())
+	}
+	<-events
+
+	var value map[string]interface{}
+	w = serve("GET", config, "")
+	json.Unmarshal(w.Body.Bytes(), &value)
+	if ip, _ := twin.ValueAt(value, []string{"network", "ip"}); ip != "10.0.0.3" {
+		t.Errorf("Expected ip 10.0.0.3, got %v", value)
+	}
+	if ssid, _ := twin.ValueAt(value, []string{"wifi", "ssid"}); ssid != "plant" {
+		t.Errorf("Expected ssid plant, got %v", value)
+	}
+
+	// Deleting a nested value keeps the property
+	if w := serve("DELETE", config+"/ports/0", ""); w.Code != http.StatusOK {
+		t.Fatalf("Failed to delete nested value: %d %s", w.Code, w.Body.String())
+	}
+	msg = <-events
+	event = msg.Payload.(map[string]interface{})
+	if event["path"] != "config/ports/0" || event["removed"] != true {
+		t.Errorf("Expected a removal event, got %v", event)
+	}
+	w = serve("GET", config+"/ports", "")
+	if w.Code != http.StatusOK || w.Body.String() != "[]\n" {
+		t.Errorf("Expected no ports, got %d %s", w.Code, w.Body.String())
+	}
+
+	for _, tc := range []struct {
+		method, path, body string
+		code               int
+	}{
+		{"GET", config + "/network/mask", "", http.StatusNotFound},
+		{"GET", "/twins/gw-1/features/device/properties/missing/ip", "", http.StatusNotFound},
+		{"DELETE", config + "/network/mask", "", http.StatusNotFound},
+		{"PUT", config + "/network/ip/octet", `1`, http.StatusBadRequest},
+		{"PUT", config + "/ports/3", `1`, http.StatusBadRequest},
+		{"GET", config + "/network//ip", "", http.StatusBadRequest},
+	} {
+		if w := serve(tc.method, tc.path, tc.body); w.Code != tc.code {
+			t.Errorf("%s %s: expected status code %d, got %d %s", tc.method, tc.path, tc.code, w.Code, w.Body.String())
+		}
+	}
+
+	// History records the whole property
+	w = serve("GET", config+"/history", "")
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected the history of the property, got %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,208 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/annotation"
+	"github.com/aleka07/go-digital-twin/pkg/history"
+	"github.com/aleka07/go-digital-twin/pkg/query"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/go-chi/chi/v5"
+)
+
+// parseTimeParam parses an optional RFC 3339 query parameter
+func parseTimeParam(r *http.Request, name string) (time.Time, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339Nano, value)
+}
+
+// History handlers
+
+// GetPropertyHistory handles GET /twins/{twinID}/features/{featureID}/properties/{propKey}/history.
+// The optional from and to query parameters limit the time range (RFC 3339).
+// With annotations=true the samples are returned along with the annotations
+// about the property in the same range.
+func (s *Server) GetPropertyHistory(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	twinID := chi.URLParam(r, "twinID")
+	featureID := chi.URLParam(r, "featureID")
+	propKey := chi.URLParam(r, "propKey")
+
+	if twinID == "" || featureID == "" || propKey == "" {
+		respondError(w, http.StatusBadRequest, "Twin ID, Feature ID, and Property Key are required")
+		return
+	}
+
+	if _, err := s.Twins.Get(twinID); err != nil {
+		if err == registry.ErrTwinNotFound {
+			respondError(w, http.StatusNotFound, "Digital twin not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to get digital twin: "+err.Error())
+		}
+		return
+	}
+
+	from, err := parseTimeParam(r, "from")
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid from parameter: "+err.Error())
+		return
+	}
+
+	to, err := parseTimeParam(r, "to")
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid to parameter: "+err.Error())
+		return
+	}
+
+	samples := s.History.Query(twinID, featureID, propKey, from, to)
+	if r.URL.Query().Get("annotations") != "true" {
+		respondJSON(w, http.StatusOK, samples)
+		return
+	}
+
+	// Include the notes about the property, and the twin, in the same range
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"samples": samples,
+		"annotations": s.Annotations.List(twinID, annotation.Filter{
+			From:      from,
+			To:        to,
+			FeatureID: featureID,
+			Property:  propKey,
+		}),
+	})
+}
+
+// GetPropertyAt handles GET /twins/{twinID}/features/{featureID}/properties/{propKey}/at.
+// The timestamp query parameter (RFC 3339) selects the instant; the optional
+// method parameter selects "previous" (last known value, the default) or
+// "linear" interpolation of numeric values.
+func (s *Server) GetPropertyAt(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	twinID := chi.URLParam(r, "twinID")
+	featureID := chi.URLParam(r, "featureID")
+	propKey := chi.URLParam(r, "propKey")
+
+	if twinID == "" || featureID == "" || propKey == "" {
+		respondError(w, http.StatusBadRequest, "Twin ID, Feature ID, and Property Key are required")
+		return
+	}
+
+	if _, err := s.Twins.Get(twinID); err != nil {
+		if err == registry.ErrTwinNotFound {
+			respondError(w, http.StatusNotFound, "Digital twin not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to get digital twin: "+err.Error())
+		}
+		return
+	}
+
+	timestamp, err := parseTimeParam(r, "timestamp")
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid timestamp parameter: "+err.Error())
+		return
+	}
+	if timestamp.IsZero() {
+		respondError(w, http.StatusBadRequest, "Timestamp parameter is required")
+		return
+	}
+
+	method, err := history.ParseMethod(r.URL.Query().Get("method"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	point, err := s.History.At(twinID, featureID, propKey, timestamp, method)
+	if err != nil {
+		if err == history.ErrNoValue {
+			respondError(w, http.StatusNotFound, "No value recorded at or before the timestamp")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to get property value: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, point)
+}
+
+// QueryFleetHistory handles POST /history/query. It returns the history of a
+// property of every twin matching the query or in the group, aggregated into buckets of the
+// given interval so that the series of all twins share the same timestamps.
+func (s *Server) QueryFleetHistory(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	var req struct {
+		Query       string    `json:"query"` // Twin filter, matches every twin when empty
+		Group       string    `json:"group"` // Group of twins, instead of a query
+		Path        string    `json:"path"`  // features.<feature>.properties.<key>
+		From        time.Time `json:"from"`
+		To          time.Time `json:"to"`
+		Interval    string    `json:"interval"`
+		Aggregation string    `json:"aggregation"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	parts := strings.SplitN(req.Path, ".", 4)
+	if query.ValidatePath(req.Path) != nil || parts[0] != "features" || parts[2] != "properties" {
+		respondError(w, http.StatusBadRequest, "Path must have the form features.<feature>.properties.<key>")
+		return
+	}
+
+	if req.Interval == "" {
+		respondError(w, http.StatusBadRequest, "Interval is required")
+		return
+	}
+	interval, err := time.ParseDuration(req.Interval)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid interval: "+err.Error())
+		return
+	}
+
+	agg, err := history.ParseAggregation(req.Aggregation)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	twins, ok := s.selectTwins(w, req.Group, req.Query)
+	if !ok {
+		return
+	}
+	twinIDs := make([]string, len(twins))
+	for i, dt := range twins {
+		twinIDs[i] = dt.ID
+	}
+
+	timestamps, series, err := s.History.Aligned(twinIDs, parts[1], parts[3], req.From, req.To, interval, agg)
+	if err != nil {
+		if errors.Is(err, history.ErrInvalidRange) {
+			respondError(w, http.StatusBadRequest, err.Error())
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to query history: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"path":        req.Path,
+		"interval":    interval.String(),
+		"aggregation": agg,
+		"timestamps":  timestamps,
+		"series":      series,
+	})
+}
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/history"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestPropertyHistory(t *testing.T) {
+	server := setupTestServer()
+
+	dt := twin.NewDigitalTwin("history-twin", "sensor")
+	dt.AddFeature("temperature", twin.NewFeatureState())
+	server.Registry.Create(dt)
+
+	now := time.Now().UTC()
+
+	// Telemetry arriving late is kept in history without replacing the current value
+	for _, sample := range []struct {
+		ts    time.Time
+		value float64
+	}{
+		{now, 22.0},
+		{now.Add(-time.Minute), 20.0},
+	} {
+		jsonData, _ := json.Marshal(map[string]interface{}{
+			"timestamp": sample.ts,
+			"features":  map[string]interface{}{"temperature": map[string]interface{}{"value": sample.value}},
+		})
+		req := httptest.NewRequest("POST", "/twins/history-twin/telemetry", bytes.NewBuffer(jsonData))
+		req = req.WithContext(setURLParam(req.Context(), "twinID", "history-twin"))
+
+		w := httptest.NewRecorder()
+		server.IngestTelemetry(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+		}
+	}
+
+	dt, _ = server.Registry.Get("history-twin")
+	feature, _ := dt.GetFeature("temperature")
+	if val, _ := feature.GetProperty("value"); val != 22.0 {
+		t.Errorf("Expected current value 22.0, got %v", val)
+	}
+
+	getHistory := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/twins/history-twin/features/temperature/properties/value/history"+query, nil)
+		req = req.WithContext(setURLParam(req.Context(), "twinID", "history-twin"))
+		req = req.WithContext(setURLParam(req.Context(), "featureID", "temperature"))
+		req = req.WithContext(setURLParam(req.Context(), "propKey", "value"))
+
+		w := httptest.NewRecorder()
+		server.GetPropertyHistory(w, req)
+		return w
+	}
+
+	w := getHistory("")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var samples []struct {
+		Timestamp time.Time   `json:"timestamp"`
+		Value     interface{} `json:"value"`
+	}
+	json.NewDecoder(w.Body).Decode(&samples)
+
+	if len(samples) != 2 || samples[0].Value != 20.0 || samples[1].Value != 22.0 {
+		t.Errorf("Expected history [20, 22], got %v", samples)
+	}
+
+	// Time range filtering
+	w = getHistory("?from=" + now.Add(-30*time.Second).Format(time.RFC3339Nano))
+	json.NewDecoder(w.Body).Decode(&samples)
+
+	if len(samples) != 1 || samples[0].Value != 22.0 {
+		t.Errorf("Expected only the latest sample, got %v", samples)
+	}
+
+	if w := getHistory("?to=yesterday"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestPropertyAt(t *testing.T) {
+	server := setupTestServer()
+
+	dt := twin.NewDigitalTwin("pump-1", "pump")
+	server.Registry.Create(dt)
+
+	base := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	server.History.Record("pump-1", "status", "pressure", 2.0, base)
+	server.History.Record("pump-1", "status", "pressure", 4.0, base.Add(2*time.Minute))
+
+	getAt := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/twins/pump-1/features/status/properties/pressure/at"+query, nil)
+		req = req.WithContext(setURLParam(req.Context(), "twinID", "pump-1"))
+		req = req.WithContext(setURLParam(req.Context(), "featureID", "status"))
+		req = req.WithContext(setURLParam(req.Context(), "propKey", "pressure"))
+
+		w := httptest.NewRecorder()
+		server.GetPropertyAt(w, req)
+		return w
+	}
+
+	at := "?timestamp=" + base.Add(time.Minute).Format(time.RFC3339Nano)
+
+	var point history.Point
+	w := getAt(at)
+	json.NewDecoder(w.Body).Decode(&point)
+	if w.Code != http.StatusOK || point.Value != 2.0 || point.Method != history.MethodPrevious {
+		t.Errorf("Expected the last known value 2, got %d %+v", w.Code, point)
+	}
+
+	w = getAt(at + "&method=linear")
+	json.NewDecoder(w.Body).Decode(&point)
+	if w.Code != http.StatusOK || point.Value != 3.0 || point.Method != history.MethodLinear {
+		t.Errorf("Expected the interpolated value 3, got %d %+v", w.Code, point)
+	}
+
+	if w := getAt("?timestamp=" + base.Add(-time.Minute).Format(time.RFC3339Nano)); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d before the history, got %d", http.StatusNotFound, w.Code)
+	}
+	for _, query := range []string{"", "?timestamp=noon", at + "&method=cubic"} {
+		if w := getAt(query); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d for %q, got %d", http.StatusBadRequest, query, w.Code)
+		}
+	}
+}
+
+func TestQueryFleetHistory(t *testing.T) {
+	server := setupTestServer()
+	base := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for i, id := range []string{"pump-1", "pump-2", "fan-1"} {
+		twinType := "pump"
+		if id == "fan-1" {
+			twinType = "fan"
+		}
+		server.Registry.Create(twin.NewDigitalTwin(id, twinType))
+		server.History.Record(id, "status", "pressure", float64(i+1), base.Add(time.Minute))
+	}
+
+	body := `{"query": "type==pump", "path": "features.status.properties.pressure", "from": "2025-01-01T12:00:00Z", "to": "2025-01-01T12:05:00Z", "interval": "5m", "aggregation": "max"}`
+	req := httptest.NewRequest("POST", "/history/query", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+	server.QueryFleetHistory(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var result struct {
+		Timestamps []time.Time      `json:"timestamps"`
+		Series     []history.Series `json:"series"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if len(result.Timestamps) != 1 || len(result.Series) != 2 || result.Series[1].TwinID != "pump-2" || result.Series[1].Values[0] != 2.0 {
+		t.Errorf("Unexpected result %s", w.Body.String())
+	}
+
+	invalid := []string{
+		`{"path": "attributes.site", "from": "2025-01-01T12:00:00Z", "to": "2025-01-01T12:05:00Z", "interval": "1m"}`,
+		`{"path": "features.status.properties.pressure", "from": "2025-01-01T12:00:00Z", "to": "2025-01-01T12:05:00Z"}`,
+		`{"path": "features.status.properties.pressure", "from": "2025-01-01T12:00:00Z", "to": "2025-01-01T12:05:00Z", "interval": "1m", "aggregation": "median"}`,
+		`{"path": "features.status.properties.pressure", "to": "2025-01-01T12:05:00Z", "interval": "1m"}`,
+	}
+	for _, body := range invalid {
+		req := httptest.NewRequest("POST", "/history/query", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		server.QueryFleetHistory(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d for %s, got %d", http.StatusBadRequest, body, w.Code)
+		}
+	}
+}
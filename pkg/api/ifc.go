@@ -0,0 +1,54 @@
+package api
+
+import (
+	"mime"
+	"net/http"
+
+	"github.com/aleka07/go-digital-twin/pkg/ifc"
+	"github.com/aleka07/go-digital-twin/pkg/manage"
+)
+
+// Building model import handlers
+
+// ImportIFC handles POST /import/ifc. The body is an IFC file in the STEP
+// format or, with a JSON content type, a model in the simplified export
+// format. The prefix query parameter sets the prefix of twin IDs and
+// dryRun=true reports the changes without applying them.
+func (s *Server) ImportIFC(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	dryRun, err := manage.ParseDryRun(r.URL.Query().Get("dryRun"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	parse := ifc.Parse
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" {
+		parse = ifc.ParseJSON
+	}
+
+	model, err := parse(r.Body)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	report := ifc.Import(s.Registry, model, ifc.Options{
+		Prefix: r.URL.Query().Get("prefix"),
+		DryRun: dryRun,
+	})
+
+	// Publish events for the applied changes
+	if !report.DryRun {
+		for _, id := range report.Created {
+			s.PubSub.Publish("twin.created", map[string]string{"id": id})
+		}
+		for _, id := range report.Updated {
+			s.PubSub.Publish("twin.updated", map[string]string{"id": id})
+		}
+	}
+
+	respondJSON(w, http.StatusOK, report)
+}
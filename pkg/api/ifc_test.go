@@ -0,0 +1,73 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/ifc"
+)
+
+func TestImportIFC(t *testing.T) {
+	server := setupTestServer()
+	events := server.PubSub.Subscribe("twin.created")
+
+	file := `ISO-10303-21;
+HEADER;
+ENDSEC;
+DATA;
+#1=IFCBUILDING('bldg',$,'HQ',$,$,$,$,$,.ELEMENT.,$,$,$);
+#2=IFCBUILDINGSTOREY('fl1',$,'Level 1',$,$,$,$,$,.ELEMENT.,0.);
+#3=IFCRELAGGREGATES('r1',$,$,$,#1,(#2));
+ENDSEC;
+END-ISO-10303-21;
+`
+	serve := func(path, contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		server.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve("/import/ifc?dryRun=true", "application/x-step", file)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if server.Registry.Count() != 0 {
+		t.Error("Expected a dry run to create no twins")
+	}
+
+	w = serve("/import/ifc?prefix=hq-", "application/x-step", file)
+	var report ifc.Report
+	json.NewDecoder(w.Body).Decode(&report)
+	if len(report.Created) != 2 || report.Relationships != 1 {
+		t.Fatalf("Unexpected report %+v", report)
+	}
+	building, err := server.Registry.Get("hq-bldg")
+	if err != nil || len(building.GetRelationship("contains")) != 1 {
+		t.Errorf("Expected the building to contain its floor, got %+v (%v)", building, err)
+	}
+	select {
+	case <-events:
+	case <-time.After(time.Second):
+		t.Error("Expected twin.created events")
+	}
+
+	// Simplified export
+	w = serve("/import/ifc?prefix=hq-", "application/json", `{"elements": [{"globalId": "room", "class": "IfcSpace", "parent": "fl1"}]}`)
+	json.NewDecoder(w.Body).Decode(&report)
+	if len(report.Created) != 1 || len(report.Updated) != 1 {
+		t.Errorf("Expected the room to be created and linked, got %+v", report)
+	}
+
+	if w := serve("/import/ifc", "application/x-step", "not an IFC file"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for an invalid file, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w := serve("/import/ifc?dryRun=maybe", "application/x-step", file); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for an invalid dryRun, got %d", http.StatusBadRequest, w.Code)
+	}
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/aleka07/go-digital-twin/pkg/impact"
+	"github.com/aleka07/go-digital-twin/pkg/query"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/script"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+	"github.com/aleka07/go-digital-twin/pkg/webhook"
+	"github.com/go-chi/chi/v5"
+)
+
+// Impact analysis handlers
+
+// GetImpact handles GET /twins/{twinID}/impact.
+// The optional depth query parameter limits the dependent twins followed.
+func (s *Server) GetImpact(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	twinID := chi.URLParam(r, "twinID")
+	if twinID == "" {
+		respondError(w, http.StatusBadRequest, "Twin ID is required")
+		return
+	}
+
+	depth := 0
+	if raw := r.URL.Query().Get("depth"); raw != "" {
+		var err error
+		if depth, err = strconv.Atoi(raw); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid depth: "+raw)
+			return
+		}
+	}
+
+	report, err := s.Impact.Analyze(twinID, depth)
+	if err != nil {
+		switch {
+		case err == registry.ErrTwinNotFound:
+			respondError(w, http.StatusNotFound, "Digital twin not found")
+		case errors.Is(err, impact.ErrInvalidDepth):
+			respondError(w, http.StatusBadRequest, err.Error())
+		default:
+			respondError(w, http.StatusInternalServerError, "Failed to analyze impact: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, report)
+}
+
+// registerImpactSources reports the views, scripts, subscriptions, webhooks
+// and share links that depend on a twin
+func (s *Server) registerImpactSources() {
+	s.Impact.AddSource("views", impact.SourceFunc(func(dt *twin.DigitalTwin) []impact.Item {
+		var items []impact.Item
+		for _, def := range s.Views.Definitions() {
+			if q, err := query.Parse(def.Query); err == nil && q.Matches(dt) {
+				items = append(items, impact.Item{Kind: impact.KindView, ID: def.Name, Reason: "twin matches the view query"})
+			}
+		}
+		return items
+	}))
+
+	s.Impact.AddSource("scripts", impact.SourceFunc(func(dt *twin.DigitalTwin) []impact.Item {
+		kinds := map[script.Kind]impact.Kind{
+			script.KindRule:     impact.KindRule,
+			script.KindComputed: impact.KindComputed,
+		}
+
+		var items []impact.Item
+		for _, st := range s.Scripts.List() {
+			kind, ok := kinds[st.Kind]
+			if !ok || (st.TwinType != "" && st.TwinType != dt.Type) {
+				continue
+			}
+
+			reason := "runs for all twins"
+			if st.TwinType != "" {
+				reason = "runs for twins of type " + st.TwinType
+			}
+			items = append(items, impact.Item{Kind: kind, ID: st.Name, Reason: reason})
+		}
+		return items
+	}))
+
+	s.Impact.AddSource("subscriptions", impact.SourceFunc(func(dt *twin.DigitalTwin) []impact.Item {
+		var items []impact.Item
+		for _, sub := range s.NGSILD.List() {
+			if sub.Matches(dt, "") {
+				items = append(items, impact.Item{Kind: impact.KindSubscription, ID: sub.ID, Reason: "notified of changes to the entity"})
+			}
+		}
+		return items
+	}))
+
+	s.Impact.AddSource("webhooks", impact.SourceFunc(func(dt *twin.DigitalTwin) []impact.Item {
+		var items []impact.Item
+		for _, h := range s.Webhooks.List() {
+			subscribed := len(h.Events) == 0
+			for _, e := range h.Events {
+				subscribed = subscribed || e == webhook.EventDecommissioned || e == webhook.EventDeleted
+			}
+			if subscribed {
+				items = append(items, impact.Item{Kind: impact.KindWebhook, ID: h.Name, Reason: "notified when the twin is decommissioned or deleted"})
+			}
+		}
+		return items
+	}))
+
+	s.Impact.AddSource("shares", impact.SourceFunc(func(dt *twin.DigitalTwin) []impact.Item {
+		var items []impact.Item
+		for _, link := range s.Shares.List(dt.ID) {
+			items = append(items, impact.Item{Kind: impact.KindShare, ID: link.ID, Reason: "revoked when the twin is deleted"})
+		}
+		return items
+	}))
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/impact"
+	"github.com/aleka07/go-digital-twin/pkg/script"
+	"github.com/aleka07/go-digital-twin/pkg/share"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+	"github.com/aleka07/go-digital-twin/pkg/views"
+	"github.com/aleka07/go-digital-twin/pkg/webhook"
+)
+
+func TestGetImpact(t *testing.T) {
+	server := setupTestServer()
+
+	server.Registry.Create(twin.NewDigitalTwin("pump-1", "pump"))
+	controller := twin.NewDigitalTwin("controller-1", "controller")
+	controller.AddRelationship("controls", "pump-1")
+	server.Registry.Create(controller)
+
+	server.Views.Create(views.Definition{Name: "pumps", Query: "type == pump"})
+	server.Views.Create(views.Definition{Name: "valves", Query: "type == valve"})
+	server.Scripts.Create(script.Script{Name: "overheat", Kind: script.KindRule, TwinType: "pump", Source: "def evaluate(twin):\n    return False\n"})
+	server.Webhooks.Create(webhook.Hook{Name: "erp", URL: "http://example.com", Events: []webhook.Event{webhook.EventDecommissioned}})
+	server.Shares.Create("pump-1", share.ScopeRead, time.Hour)
+
+	getImpact := func(twinID, depth string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/twins/"+twinID+"/impact?depth="+depth, nil)
+		req = req.WithContext(setURLParam(req.Context(), "twinID", twinID))
+		w := httptest.NewRecorder()
+		server.GetImpact(w, req)
+		return w
+	}
+
+	w := getImpact("pump-1", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var report impact.Report
+	json.Unmarshal(w.Body.Bytes(), &report)
+
+	found := make(map[impact.Kind][]string)
+	for _, item := range report.Items {
+		found[item.Kind] = append(found[item.Kind], item.ID)
+	}
+
+	expected := map[impact.Kind]string{
+		impact.KindTwin:    "controller-1",
+		impact.KindView:    "pumps",
+		impact.KindRule:    "overheat",
+		impact.KindWebhook: "erp",
+	}
+	for kind, id := range expected {
+		if ids := found[kind]; len(ids) != 1 || ids[0] != id {
+			t.Errorf("Expected %s %s to be affected, got %v", kind, id, ids)
+		}
+	}
+	if len(found[impact.KindShare]) != 1 {
+		t.Errorf("Expected one share link to be affected, got %v", found[impact.KindShare])
+	}
+
+	if w := getImpact("pump-1", "abc"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w := getImpact("unknown", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
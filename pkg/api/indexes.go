@@ -0,0 +1,110 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/aleka07/go-digital-twin/pkg/query"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/go-chi/chi/v5"
+)
+
+// Index management handlers
+
+// CreateIndex handles POST /indexes with {"path": "attributes.serialNumber"}.
+// The twins in memory are indexed before the response, and queries comparing
+// the path for equality use the index from then on. Twins in the memory
+// store are indexed in the background.
+func (s *Server) CreateIndex(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	var req struct {
+		Path string `json:"path"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	stats, err := s.Registry.CreateIndex(req.Path)
+	if err != nil {
+		switch {
+		case errors.Is(err, registry.ErrIndexExists):
+			respondError(w, http.StatusConflict, "Index already exists")
+		case errors.Is(err, query.ErrInvalidQuery):
+			respondError(w, http.StatusBadRequest, err.Error())
+		default:
+			respondError(w, http.StatusInternalServerError, "Failed to create index: "+err.Error())
+		}
+		return
+	}
+
+	if !stats.Warm {
+		go s.Registry.WarmUp(context.Background())
+	}
+	respondJSON(w, http.StatusCreated, stats)
+}
+
+// ListIndexes handles GET /indexes
+func (s *Server) ListIndexes(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	respondJSON(w, http.StatusOK, s.Registry.Indexes())
+}
+
+// GetIndex handles GET /indexes/{path}
+func (s *Server) GetIndex(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	stats, err := s.Registry.Index(chi.URLParam(r, "path"))
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Index not found")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, stats)
+}
+
+// DeleteIndex handles DELETE /indexes/{path}
+func (s *Server) DeleteIndex(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	if err := s.Registry.DropIndex(chi.URLParam(r, "path")); err != nil {
+		respondError(w, http.StatusNotFound, "Index not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ExplainQuery handles POST /twins/query/explain with {"query": "..."}. It
+// runs the query and returns how it was run: the indexed conditions and the
+// one used, the twins expected and actually evaluated, and the time spent
+// planning and evaluating.
+func (s *Server) ExplainQuery(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	var req struct {
+		Query string `json:"query"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	q, err := query.Parse(req.Query)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	_, explanation := s.Registry.Explain(q)
+	respondJSON(w, http.StatusOK, explanation)
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestIndexes(t *testing.T) {
+	server := setupTestServer()
+	for _, id := range []string{"pump-1", "pump-2", "pump-3"} {
+		dt := twin.NewDigitalTwin(id, "pump")
+		dt.SetAttribute("serialNumber", "SN-"+id)
+		server.Registry.Create(dt)
+	}
+	ts := httptest.NewServer(server.Router)
+	defer ts.Close()
+
+	do := func(method, path, body string) *http.Response {
+		req, _ := http.NewRequest(method, ts.URL+"/api/v1"+path, strings.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, path, err)
+		}
+		return resp
+	}
+
+	resp := do("POST", "/indexes", `{"path": "attributes.serialNumber"}`)
+	var stats registry.IndexStats
+	json.NewDecoder(resp.Body).Decode(&stats)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated || stats.Entries != 3 {
+		t.Errorf("Expected the index to be created, got %d %+v", resp.StatusCode, stats)
+	}
+	for _, tc := range []struct {
+		body string
+		code int
+	}{
+		{`{"path": "attributes.serialNumber"}`, http.StatusConflict},
+		{`{"path": "attributes"}`, http.StatusBadRequest},
+		{`{"path": `, http.StatusBadRequest},
+	} {
+		if resp := do("POST", "/indexes", tc.body); resp.StatusCode != tc.code {
+			t.Errorf("%s: expected status code %d, got %d", tc.body, tc.code, resp.StatusCode)
+		}
+	}
+
+	resp = do("GET", "/twins?query=attributes.serialNumber+%3D%3D+SN-pump-2", "")
+	var twins []Twin
+	json.NewDecoder(resp.Body).Decode(&twins)
+	resp.Body.Close()
+	if len(twins) != 1 || twins[0].ID != "pump-2" {
+		t.Errorf("Expected pump-2, got %+v", twins)
+	}
+	if resp := do("GET", "/twins?query=attributes.serialNumber+%3D%3D", ""); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for an invalid query, got %d", http.StatusBadRequest, resp.StatusCode)
+	}
+
+	resp = do("GET", "/indexes/attributes.serialNumber", "")
+	json.NewDecoder(resp.Body).Decode(&stats)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || stats.Lookups != 1 {
+		t.Errorf("Expected the index to have been used, got %d %+v", resp.StatusCode, stats)
+	}
+
+	if resp := do("DELETE", "/indexes/attributes.serialNumber", ""); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected status code %d, got %d", http.StatusNoContent, resp.StatusCode)
+	}
+	if resp := do("GET", "/indexes/attributes.serialNumber", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, resp.StatusCode)
+	}
+	if resp := do("DELETE", "/indexes/attributes.serialNumber", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, resp.StatusCode)
+	}
+}
+
+func TestExplainQuery(t *testing.T) {
+	server := setupTestServer()
+	for _, id := range []string{"pump-1", "pump-2", "pump-3"} {
+		dt := twin.NewDigitalTwin(id, "pump")
+		dt.SetAttribute("serialNumber", "SN-"+id)
+		server.Registry.Create(dt)
+	}
+	server.Registry.CreateIndex("attributes.serialNumber")
+
+	explain := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/twins/query/explain", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		server.ExplainQuery(w, req)
+		return w
+	}
+
+	w := explain(`{"query": "attributes.serialNumber == SN-pump-2 and type == pump"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var resp registry.Explanation
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Strategy != registry.StrategyIndex || resp.Estimated != 1 || resp.Scanned != 1 || resp.Matched != 1 {
+		t.Errorf("Unexpected explanation %+v", resp)
+	}
+	if len(resp.Indexes) != 1 || resp.Indexes[0].Path != "attributes.serialNumber" || !resp.Indexes[0].Used {
+		t.Errorf("Unexpected indexes %+v", resp.Indexes)
+	}
+
+	for _, body := range []string{`{"query": "type =="}`, `{"query": `} {
+		if w := explain(body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status code %d, got %d", body, http.StatusBadRequest, w.Code)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/kpi"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/go-chi/chi/v5"
+)
+
+// KPI handlers
+
+// parseKPIWindow parses the from, to (RFC 3339) and interval query parameters
+func parseKPIWindow(w http.ResponseWriter, r *http.Request) (from, to time.Time, interval time.Duration, ok bool) {
+	from, err := parseTimeParam(r, "from")
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid from parameter: "+err.Error())
+		return
+	}
+
+	to, err = parseTimeParam(r, "to")
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid to parameter: "+err.Error())
+		return
+	}
+
+	if value := r.URL.Query().Get("interval"); value != "" {
+		if interval, err = time.ParseDuration(value); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid interval parameter: "+err.Error())
+			return
+		}
+	}
+	return from, to, interval, true
+}
+
+// GetTwinKPIs handles GET /kpi/twins/{twinID}. The optional from and to
+// parameters select the time range, the last 24 hours by default, and
+// interval splits it into windows.
+func (s *Server) GetTwinKPIs(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	twinID := chi.URLParam(r, "twinID")
+	if twinID == "" {
+		respondError(w, http.StatusBadRequest, "Twin ID is required")
+		return
+	}
+
+	from, to, interval, ok := parseKPIWindow(w, r)
+	if !ok {
+		return
+	}
+
+	report, err := s.KPI.Twin(twinID, from, to, interval)
+	if err != nil {
+		switch {
+		case err == registry.ErrTwinNotFound:
+			respondError(w, http.StatusNotFound, "Digital twin not found")
+		case errors.Is(err, kpi.ErrInvalidWindow):
+			respondError(w, http.StatusBadRequest, err.Error())
+		default:
+			respondError(w, http.StatusInternalServerError, "Failed to compute KPIs: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, report)
+}
+
+// GetGroupKPIs handles GET /kpi/twins?query=... and computes the KPIs of all
+// twins matching the query as a group. The twins of a group are selected
+// with ?group=... instead.
+func (s *Server) GetGroupKPIs(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	twins, ok := s.selectTwins(w, r.URL.Query().Get("group"), r.URL.Query().Get("query"))
+	if !ok {
+		return
+	}
+
+	from, to, interval, ok := parseKPIWindow(w, r)
+	if !ok {
+		return
+	}
+
+	report, err := s.KPI.Group(twins, from, to, interval)
+	if err != nil {
+		if errors.Is(err, kpi.ErrInvalidWindow) {
+			respondError(w, http.StatusBadRequest, err.Error())
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to compute KPIs: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, report)
+}
+
+// GetKPIConventions handles GET /kpi/conventions
+func (s *Server) GetKPIConventions(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	respondJSON(w, http.StatusOK, s.KPI.Conventions())
+}
+
+// SetKPIConventions handles PUT /kpi/conventions
+func (s *Server) SetKPIConventions(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	var conv kpi.Conventions
+	if err := json.NewDecoder(r.Body).Decode(&conv); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	if err := s.KPI.SetConventions(conv); err != nil {
+		if errors.Is(err, kpi.ErrInvalidConventions) {
+			respondError(w, http.StatusBadRequest, err.Error())
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to set KPI conventions: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, conv)
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/kpi"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestKPIs(t *testing.T) {
+	server := setupTestServer()
+
+	base := time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC)
+	for _, id := range []string{"press-1", "press-2"} {
+		dt := twin.NewDigitalTwin(id, "press")
+		dt.SetAttribute("idealCycleTime", 60.0)
+		server.Registry.Create(dt)
+
+		server.History.Record(id, "machine", "state", "running", base)
+		server.History.Record(id, "machine", "state", "down", base.Add(30*time.Minute))
+		server.History.Record(id, "counters", "total", 0.0, base)
+		server.History.Record(id, "counters", "total", 30.0, base.Add(30*time.Minute))
+		server.History.Record(id, "counters", "good", 0.0, base)
+		server.History.Record(id, "counters", "good", 27.0, base.Add(30*time.Minute))
+	}
+
+	window := "from=" + url.QueryEscape(base.Format(time.RFC3339)) + "&to=" + url.QueryEscape(base.Add(time.Hour).Format(time.RFC3339))
+
+	req := httptest.NewRequest("GET", "/kpi/twins/press-1?"+window+"&interval=30m", nil)
+	req = req.WithContext(setURLParam(req.Context(), "twinID", "press-1"))
+	w := httptest.NewRecorder()
+	server.GetTwinKPIs(w, req)
+
+	var report kpi.Report
+	json.Unmarshal(w.Body.Bytes(), &report)
+	if w.Code != http.StatusOK || report.TwinID != "press-1" || len(report.Windows) != 2 {
+		t.Fatalf("Unexpected report %d %s", w.Code, w.Body.String())
+	}
+	if report.Availability == nil || *report.Availability != 0.5 || report.Quality == nil || *report.Quality != 0.9 {
+		t.Errorf("Unexpected metrics %s", w.Body.String())
+	}
+	if report.OEE == nil || *report.OEE != 0.45 {
+		t.Errorf("Expected OEE 0.45, got %s", w.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/kpi/twins?query="+url.QueryEscape("type == press")+"&"+window, nil)
+	w = httptest.NewRecorder()
+	server.GetGroupKPIs(w, req)
+
+	report = kpi.Report{}
+	json.Unmarshal(w.Body.Bytes(), &report)
+	if w.Code != http.StatusOK || len(report.Twins) != 2 || report.TotalCount != 60 {
+		t.Errorf("Unexpected group report %d %s", w.Code, w.Body.String())
+	}
+
+	for _, query := range []string{"interval=soon", "from=yesterday", window + "&interval=-1h"} {
+		req := httptest.NewRequest("GET", "/kpi/twins/press-1?"+query, nil)
+		req = req.WithContext(setURLParam(req.Context(), "twinID", "press-1"))
+		w := httptest.NewRecorder()
+		server.GetTwinKPIs(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d for %q, got %d", http.StatusBadRequest, query, w.Code)
+		}
+	}
+
+	req = httptest.NewRequest("GET", "/kpi/twins/missing", nil)
+	req = req.WithContext(setURLParam(req.Context(), "twinID", "missing"))
+	w = httptest.NewRecorder()
+	server.GetTwinKPIs(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	conv := kpi.DefaultConventions
+	conv.RunningStates = nil
+	jsonData, _ := json.Marshal(conv)
+	req = httptest.NewRequest("PUT", "/kpi/conventions", bytes.NewBuffer(jsonData))
+	w = httptest.NewRecorder()
+	server.SetKPIConventions(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+	"github.com/aleka07/go-digital-twin/pkg/webhook"
+	"github.com/go-chi/chi/v5"
+)
+
+// lifecycleEvents maps the target state of a transition to the event it publishes
+var lifecycleEvents = map[twin.LifecycleState]webhook.Event{
+	twin.LifecycleActive:         webhook.EventActivated,
+	twin.LifecycleDecommissioned: webhook.EventDecommissioned,
+}
+
+// Lifecycle handlers
+
+// SetLifecycle handles PUT /twins/{twinID}/lifecycle.
+// Successful transitions are published as twin.activated or twin.decommissioned events.
+func (s *Server) SetLifecycle(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	twinID := chi.URLParam(r, "twinID")
+	if twinID == "" {
+		respondError(w, http.StatusBadRequest, "Twin ID is required")
+		return
+	}
+
+	var req struct {
+		State string `json:"state"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	state, err := twin.ParseLifecycleState(req.State)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	dt, err := s.Twins.Get(twinID)
+	if err != nil {
+		if err == registry.ErrTwinNotFound {
+			respondError(w, http.StatusNotFound, "Digital twin not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to get digital twin: "+err.Error())
+		}
+		return
+	}
+
+	if err := dt.SetLifecycle(state); err != nil {
+		if errors.Is(err, twin.ErrInvalidTransition) {
+			respondError(w, http.StatusConflict, err.Error())
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to change lifecycle: "+err.Error())
+		}
+		return
+	}
+
+	recordModifier(r, dt)
+	if err := s.Twins.Update(dt); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to update digital twin: "+err.Error())
+		return
+	}
+
+	// Publish event
+	s.PubSub.Publish(webhook.Topic(lifecycleEvents[state]), map[string]string{"id": dt.ID})
+
+	respondJSON(w, http.StatusOK, twinBody(r, dt))
+}
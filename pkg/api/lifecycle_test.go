@@ -0,0 +1,55 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestSetLifecycle(t *testing.T) {
+	server := setupTestServer()
+	server.Registry.Create(twin.NewDigitalTwin("pump-1", "pump"))
+
+	events := server.PubSub.Subscribe("twin.activated")
+
+	setState := func(twinID, state string) *httptest.ResponseRecorder {
+		jsonData, _ := json.Marshal(map[string]string{"state": state})
+		req := httptest.NewRequest("PUT", "/twins/"+twinID+"/lifecycle", bytes.NewBuffer(jsonData))
+		req = req.WithContext(setURLParam(req.Context(), "twinID", twinID))
+
+		w := httptest.NewRecorder()
+		server.SetLifecycle(w, req)
+		return w
+	}
+
+	if w := setState("pump-1", "active"); w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	select {
+	case msg := <-events:
+		if msg.Payload.(map[string]string)["id"] != "pump-1" {
+			t.Errorf("Unexpected event payload: %v", msg.Payload)
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected twin.activated event")
+	}
+
+	// Invalid transitions and states are rejected
+	if w := setState("pump-1", "active"); w.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d, got %d", http.StatusConflict, w.Code)
+	}
+
+	if w := setState("pump-1", "retired"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	if w := setState("unknown", "active"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
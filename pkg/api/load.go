@@ -0,0 +1,55 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/aleka07/go-digital-twin/pkg/ingest"
+)
+
+// Load shedding handlers
+
+// loadResponse is the response body of GET /admin/load
+type loadResponse struct {
+	ingest.Load
+	Saturation float64 `json:"saturation"` // Highest fill ratio of the ingestion queue and the event fan-out
+	RetryAfter string  `json:"retryAfter"` // Delay suggested to rejected clients
+}
+
+// GetLoad handles GET /admin/load
+func (s *Server) GetLoad(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	load := s.Ingester.Load()
+	respondJSON(w, http.StatusOK, loadResponse{
+		Load:       load,
+		Saturation: load.Saturation(),
+		RetryAfter: load.Limits.RetryAfter.String(),
+	})
+}
+
+// respondShed responds to telemetry rejected by load shedding with 429 when
+// the ingestion queue is full and 503 when the event fan-out is saturated,
+// telling the client when to retry. It reports whether err was such a
+// rejection.
+func (s *Server) respondShed(w http.ResponseWriter, err error) bool {
+	var status int
+	switch err {
+	case ingest.ErrOverloaded:
+		status = http.StatusTooManyRequests
+	case ingest.ErrSaturated:
+		status = http.StatusServiceUnavailable
+	default:
+		return false
+	}
+
+	seconds := math.Ceil(s.Ingester.LoadLimits().RetryAfter.Seconds())
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(seconds)))
+	respondError(w, status, "Ingestion is overloaded: "+err.Error())
+	return true
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/ingest"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestLoadShedding(t *testing.T) {
+	server := setupTestServer()
+	server.Registry.Create(twin.NewDigitalTwin("pump-1", "pump"))
+	server.Ingester.SetLoadLimits(ingest.LoadLimits{MaxInFlight: 4, MaxSaturation: 0.9, RetryAfter: 2500 * time.Millisecond})
+
+	// A subscriber that does not read saturates the fan-out
+	server.PubSub.SubscribeWithBuffer("alarm.#", 1)
+	server.PubSub.Publish("alarm.raised", map[string]string{"twinId": "pump-1"})
+
+	req := httptest.NewRequest("POST", "/twins/pump-1/telemetry", bytes.NewBufferString(`{"features": {"status": {"pressure": 2.5}}}`))
+	req = req.WithContext(setURLParam(req.Context(), "twinID", "pump-1"))
+	w := httptest.NewRecorder()
+	server.IngestTelemetry(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "3" {
+		t.Errorf("Expected Retry-After 3, got %q", got)
+	}
+
+	w = httptest.NewRecorder()
+	if !server.respondShed(w, ingest.ErrOverloaded) || w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status code %d, got %d", http.StatusTooManyRequests, w.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/admin/load", nil)
+	w = httptest.NewRecorder()
+	server.GetLoad(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var load map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&load)
+	if load["saturation"] != 1.0 || load["shed"] != 1.0 || load["retryAfter"] != "2.5s" {
+		t.Errorf("Unexpected load %v", load)
+	}
+	if fanOut, _ := load["fanOut"].(map[string]interface{}); fanOut["saturation"] != 1.0 {
+		t.Errorf("Expected fan-out saturation 1, got %v", load["fanOut"])
+	}
+}
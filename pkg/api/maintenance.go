@@ -0,0 +1,128 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/aleka07/go-digital-twin/pkg/maintenance"
+	"github.com/go-chi/chi/v5"
+)
+
+// Maintenance window handlers
+
+// CreateMaintenanceWindow handles POST /maintenance
+func (s *Server) CreateMaintenanceWindow(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	var req maintenance.Window
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	window, err := s.Maintenance.Create(req)
+	if err != nil {
+		if errors.Is(err, maintenance.ErrInvalidWindow) {
+			respondError(w, http.StatusBadRequest, err.Error())
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to create maintenance window: "+err.Error())
+		}
+		return
+	}
+
+	w.Header().Set("Location", apiPath(r, "/maintenance/"+window.ID))
+	respondJSON(w, http.StatusCreated, window)
+}
+
+// ListMaintenanceWindows handles GET /maintenance. With ?twin=... only the
+// windows currently active for the twin are listed.
+func (s *Server) ListMaintenanceWindows(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	if twinID := r.URL.Query().Get("twin"); twinID != "" {
+		windows := s.Maintenance.Active(twinID)
+		if windows == nil {
+			windows = []maintenance.Window{}
+		}
+		respondJSON(w, http.StatusOK, windows)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, s.Maintenance.List())
+}
+
+// GetMaintenanceWindow handles GET /maintenance/{windowID}
+func (s *Server) GetMaintenanceWindow(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	windowID := chi.URLParam(r, "windowID")
+	if windowID == "" {
+		respondError(w, http.StatusBadRequest, "Window ID is required")
+		return
+	}
+
+	window, err := s.Maintenance.Get(windowID)
+	if err != nil {
+		if err == maintenance.ErrWindowNotFound {
+			respondError(w, http.StatusNotFound, "Maintenance window not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to get maintenance window: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, window)
+}
+
+// DeleteMaintenanceWindow handles DELETE /maintenance/{windowID}, ending
+// the window early if it is active
+func (s *Server) DeleteMaintenanceWindow(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	windowID := chi.URLParam(r, "windowID")
+	if windowID == "" {
+		respondError(w, http.StatusBadRequest, "Window ID is required")
+		return
+	}
+
+	if err := s.Maintenance.Delete(windowID); err != nil {
+		if err == maintenance.ErrWindowNotFound {
+			respondError(w, http.StatusNotFound, "Maintenance window not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to delete maintenance window: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Maintenance window deleted"})
+}
+
+// ListSuppressedEvents handles GET /maintenance/{windowID}/suppressed and
+// returns the audit of the events the window suppressed
+func (s *Server) ListSuppressedEvents(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	windowID := chi.URLParam(r, "windowID")
+	if windowID == "" {
+		respondError(w, http.StatusBadRequest, "Window ID is required")
+		return
+	}
+
+	events, err := s.Maintenance.Audit(windowID)
+	if err != nil {
+		if err == maintenance.ErrWindowNotFound {
+			respondError(w, http.StatusNotFound, "Maintenance window not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to get suppressed events: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, events)
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/group"
+	"github.com/aleka07/go-digital-twin/pkg/maintenance"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestMaintenanceRoutes(t *testing.T) {
+	server := setupTestServer()
+	server.Registry.Create(twin.NewDigitalTwin("pump-1", "pump"))
+	server.Groups.Create(group.Definition{Name: "line-a", Twins: []string{"pump-1"}})
+
+	serve := serveFunc(server, "")
+
+	start := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	end := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	w := serve("POST", "/api/v1/maintenance", `{"groups": ["line-a"], "start": "`+start+`", "end": "`+end+`", "reason": "valve swap"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var window maintenance.Window
+	json.NewDecoder(w.Body).Decode(&window)
+	if w.Header().Get("Location") != "/api/v1/maintenance/"+window.ID {
+		t.Errorf("Expected the Location of the window, got %q", w.Header().Get("Location"))
+	}
+
+	if w := serve("POST", "/maintenance", `{"twins": ["pump-1"], "start": "`+end+`", "end": "`+start+`"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for an inverted window, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	// Rule events of twins in the window are suppressed and audited
+	if !server.Maintenance.Suppress("rule.triggered", "pump-1", nil) {
+		t.Error("Expected pump-1 to be under maintenance")
+	}
+	w = serve("GET", "/maintenance/"+window.ID+"/suppressed", "")
+	var audit []maintenance.SuppressedEvent
+	json.NewDecoder(w.Body).Decode(&audit)
+	if w.Code != http.StatusOK || len(audit) != 1 || audit[0].TwinID != "pump-1" {
+		t.Errorf("Unexpected audit %d %+v", w.Code, audit)
+	}
+
+	w = serve("GET", "/maintenance?twin=pump-1", "")
+	var active []maintenance.Window
+	json.NewDecoder(w.Body).Decode(&active)
+	if len(active) != 1 || active[0].Suppressed != 1 {
+		t.Errorf("Expected 1 active window with 1 suppressed event, got %+v", active)
+	}
+	if w := serve("GET", "/maintenance?twin=pump-2", ""); strings.TrimSpace(w.Body.String()) != "[]" {
+		t.Errorf("Expected no active windows for pump-2, got %s", w.Body.String())
+	}
+
+	if w := serve("DELETE", "/maintenance/"+window.ID, ""); w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if w := serve("GET", "/maintenance/"+window.ID, ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
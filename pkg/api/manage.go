@@ -0,0 +1,481 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/aleka07/go-digital-twin/pkg/manage"
+	"github.com/aleka07/go-digital-twin/pkg/ngsild"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/script"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+	"github.com/go-chi/chi/v5"
+)
+
+// Management handlers for infrastructure-as-code tools. Resources are
+// addressed by client-chosen IDs, PUT creates or replaces them, DELETE
+// succeeds for missing resources, and GET returns the normalized state that
+// PUT accepts, so reading back an applied state shows no drift. All writes
+// support ?dryRun=true, which returns the plan without applying it.
+
+// GetManagedTwin handles GET /manage/twins/{twinID}
+func (s *Server) GetManagedTwin(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	twinID := chi.URLParam(r, "twinID")
+	if twinID == "" {
+		respondError(w, http.StatusBadRequest, "Twin ID is required")
+		return
+	}
+
+	dt, err := s.Twins.Get(twinID)
+	if err != nil {
+		if err == registry.ErrTwinNotFound {
+			respondError(w, http.StatusNotFound, "Digital twin not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to get digital twin: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, manage.NormalizeTwin(dt))
+}
+
+// PutManagedTwin handles PUT /manage/twins/{twinID}
+func (s *Server) PutManagedTwin(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	twinID := chi.URLParam(r, "twinID")
+	if twinID == "" {
+		respondError(w, http.StatusBadRequest, "Twin ID is required")
+		return
+	}
+
+	dryRun, err := manage.ParseDryRun(r.URL.Query().Get("dryRun"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var desired manage.Twin
+	if err := json.NewDecoder(r.Body).Decode(&desired); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	if desired.ID == "" {
+		desired.ID = twinID
+	}
+	if desired.ID != twinID {
+		respondError(w, http.StatusBadRequest, "Twin ID does not match the URL")
+		return
+	}
+	if err := manage.ValidateTwin(desired); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	current, err := s.Twins.Get(twinID)
+	if err != nil && err != registry.ErrTwinNotFound {
+		respondError(w, http.StatusInternalServerError, "Failed to get digital twin: "+err.Error())
+		return
+	}
+
+	// Create
+	if current == nil {
+		dt := twin.NewDigitalTwinWithClock(twinID, desired.Type, s.Clock())
+		manage.ApplyTwin(dt, desired)
+		dt.SetSystem(twin.SystemSource, "manage")
+		recordCreator(r, dt)
+
+		result := manage.Plan(nil, manage.NormalizeTwin(dt))
+		result.DryRun = dryRun
+		if dryRun {
+			respondJSON(w, http.StatusOK, result)
+			return
+		}
+
+		if err := s.Twins.Create(dt); err != nil {
+			if err == registry.ErrTwinAlreadyExists {
+				respondError(w, http.StatusConflict, "Digital twin was created concurrently")
+			} else if errors.Is(err, registry.ErrMemoryBudgetExceeded) {
+				respondError(w, http.StatusInsufficientStorage, err.Error())
+			} else {
+				respondError(w, http.StatusInternalServerError, "Failed to create digital twin: "+err.Error())
+			}
+			return
+		}
+
+		s.PubSub.Publish("twin.created", map[string]string{"id": twinID})
+		respondJSON(w, http.StatusCreated, result)
+		return
+	}
+
+	// Update a copy, so that nothing changes for dry runs and failed updates
+	dt := current.Clone()
+	manage.ApplyTwin(dt, desired)
+
+	result := manage.Plan(manage.NormalizeTwin(current), manage.NormalizeTwin(dt))
+	result.DryRun = dryRun
+	if dryRun || result.Action == manage.ActionNone {
+		respondJSON(w, http.StatusOK, result)
+		return
+	}
+
+	// Sensitive changes go through the approval workflow of the feature API
+	for featureID, f := range desired.Features {
+		if held := s.Approvals.Hold(current, featureID, copyMap(f.DesiredProperties)); len(held) > 0 {
+			respondError(w, http.StatusConflict, "Changes to feature "+featureID+" require approval")
+			return
+		}
+	}
+
+	recordModifier(r, dt)
+	if err := s.Twins.Update(dt); err != nil {
+		if errors.Is(err, registry.ErrRevisionConflict) {
+			respondError(w, http.StatusConflict, err.Error())
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to update digital twin: "+err.Error())
+		}
+		return
+	}
+
+	s.PubSub.Publish("twin.updated", map[string]string{"id": twinID})
+	respondJSON(w, http.StatusOK, result)
+}
+
+// DeleteManagedTwin handles DELETE /manage/twins/{twinID}
+func (s *Server) DeleteManagedTwin(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	twinID := chi.URLParam(r, "twinID")
+	if twinID == "" {
+		respondError(w, http.StatusBadRequest, "Twin ID is required")
+		return
+	}
+
+	dryRun, err := manage.ParseDryRun(r.URL.Query().Get("dryRun"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	dt, err := s.Twins.Get(twinID)
+	if err != nil {
+		if err == registry.ErrTwinNotFound {
+			respondJSON(w, http.StatusOK, manage.Result{Action: manage.ActionNone, Changes: []manage.Change{}, DryRun: dryRun})
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to get digital twin: "+err.Error())
+		}
+		return
+	}
+
+	result := manage.Plan(manage.NormalizeTwin(dt), nil)
+	result.DryRun = dryRun
+	if dryRun {
+		respondJSON(w, http.StatusOK, result)
+		return
+	}
+
+	if err := s.Twins.Delete(twinID); err != nil && err != registry.ErrTwinNotFound {
+		respondError(w, http.StatusInternalServerError, "Failed to delete digital twin: "+err.Error())
+		return
+	}
+
+	s.forgetTwin(r.Context(), twinID)
+	s.PubSub.Publish("twin.deleted", map[string]string{"id": twinID})
+
+	respondJSON(w, http.StatusOK, result)
+}
+
+// GetManagedScript handles GET /manage/scripts/{scriptName}
+func (s *Server) GetManagedScript(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	scriptName := chi.URLParam(r, "scriptName")
+	if scriptName == "" {
+		respondError(w, http.StatusBadRequest, "Script name is required")
+		return
+	}
+
+	status, err := s.Scripts.Get(scriptName)
+	if err != nil {
+		if err == script.ErrScriptNotFound {
+			respondError(w, http.StatusNotFound, "Script not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to get script: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, manage.NormalizeScript(status.Script))
+}
+
+// PutManagedScript handles PUT /manage/scripts/{scriptName}
+func (s *Server) PutManagedScript(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	scriptName := chi.URLParam(r, "scriptName")
+	if scriptName == "" {
+		respondError(w, http.StatusBadRequest, "Script name is required")
+		return
+	}
+
+	dryRun, err := manage.ParseDryRun(r.URL.Query().Get("dryRun"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var desired script.Script
+	if err := json.NewDecoder(r.Body).Decode(&desired); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	if desired.Name == "" {
+		desired.Name = scriptName
+	}
+	if desired.Name != scriptName {
+		respondError(w, http.StatusBadRequest, "Script name does not match the URL")
+		return
+	}
+
+	// Scripts are compiled for dry runs too, so plans catch errors
+	if err := s.Scripts.Validate(desired); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var result manage.Result
+	status, err := s.Scripts.Get(scriptName)
+	switch {
+	case err == script.ErrScriptNotFound:
+		result = manage.Plan(nil, manage.NormalizeScript(desired))
+	case err != nil:
+		respondError(w, http.StatusInternalServerError, "Failed to get script: "+err.Error())
+		return
+	default:
+		result = manage.Plan(manage.NormalizeScript(status.Script), manage.NormalizeScript(desired))
+	}
+	result.DryRun = dryRun
+
+	if dryRun || result.Action == manage.ActionNone {
+		respondJSON(w, http.StatusOK, result)
+		return
+	}
+
+	if result.Action == manage.ActionCreate {
+		err = s.Scripts.Create(desired)
+	} else {
+		err = s.Scripts.Replace(desired)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, script.ErrScriptAlreadyExists), errors.Is(err, script.ErrScriptNotFound):
+			respondError(w, http.StatusConflict, "Script was changed concurrently")
+		case errors.Is(err, script.ErrInvalidScript):
+			respondError(w, http.StatusBadRequest, err.Error())
+		default:
+			respondError(w, http.StatusInternalServerError, "Failed to apply script: "+err.Error())
+		}
+		return
+	}
+
+	if result.Action == manage.ActionCreate {
+		respondJSON(w, http.StatusCreated, result)
+	} else {
+		respondJSON(w, http.StatusOK, result)
+	}
+}
+
+// DeleteManagedScript handles DELETE /manage/scripts/{scriptName}
+func (s *Server) DeleteManagedScript(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	scriptName := chi.URLParam(r, "scriptName")
+	if scriptName == "" {
+		respondError(w, http.StatusBadRequest, "Script name is required")
+		return
+	}
+
+	dryRun, err := manage.ParseDryRun(r.URL.Query().Get("dryRun"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	status, err := s.Scripts.Get(scriptName)
+	if err != nil {
+		if err == script.ErrScriptNotFound {
+			respondJSON(w, http.StatusOK, manage.Result{Action: manage.ActionNone, Changes: []manage.Change{}, DryRun: dryRun})
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to get script: "+err.Error())
+		}
+		return
+	}
+
+	result := manage.Plan(manage.NormalizeScript(status.Script), nil)
+	result.DryRun = dryRun
+	if !dryRun {
+		if err := s.Scripts.Delete(scriptName); err != nil && err != script.ErrScriptNotFound {
+			respondError(w, http.StatusInternalServerError, "Failed to delete script: "+err.Error())
+			return
+		}
+	}
+
+	respondJSON(w, http.StatusOK, result)
+}
+
+// GetManagedSubscription handles GET /manage/subscriptions/{subscriptionID}
+func (s *Server) GetManagedSubscription(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	subscriptionID := chi.URLParam(r, "subscriptionID")
+	if subscriptionID == "" {
+		respondError(w, http.StatusBadRequest, "Subscription ID is required")
+		return
+	}
+
+	sub, err := s.NGSILD.Get(subscriptionID)
+	if err != nil {
+		if err == ngsild.ErrSubscriptionNotFound {
+			respondError(w, http.StatusNotFound, "Subscription not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to get subscription: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, manage.NormalizeSubscription(sub))
+}
+
+// PutManagedSubscription handles PUT /manage/subscriptions/{subscriptionID}
+func (s *Server) PutManagedSubscription(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	subscriptionID := chi.URLParam(r, "subscriptionID")
+	if subscriptionID == "" {
+		respondError(w, http.StatusBadRequest, "Subscription ID is required")
+		return
+	}
+
+	dryRun, err := manage.ParseDryRun(r.URL.Query().Get("dryRun"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var desired ngsild.Subscription
+	if err := json.NewDecoder(r.Body).Decode(&desired); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	if desired.ID == "" {
+		desired.ID = subscriptionID
+	}
+	if desired.ID != subscriptionID {
+		respondError(w, http.StatusBadRequest, "Subscription ID does not match the URL")
+		return
+	}
+	if err := ngsild.Validate(&desired); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var result manage.Result
+	sub, err := s.NGSILD.Get(subscriptionID)
+	switch {
+	case err == ngsild.ErrSubscriptionNotFound:
+		result = manage.Plan(nil, manage.NormalizeSubscription(desired))
+	case err != nil:
+		respondError(w, http.StatusInternalServerError, "Failed to get subscription: "+err.Error())
+		return
+	default:
+		result = manage.Plan(manage.NormalizeSubscription(sub), manage.NormalizeSubscription(desired))
+	}
+	result.DryRun = dryRun
+
+	if dryRun || result.Action == manage.ActionNone {
+		respondJSON(w, http.StatusOK, result)
+		return
+	}
+
+	if result.Action == manage.ActionCreate {
+		_, err = s.NGSILD.Create(desired)
+	} else {
+		_, err = s.NGSILD.Replace(desired)
+	}
+	if err != nil {
+		switch {
+		case err == ngsild.ErrSubscriptionAlreadyExists, err == ngsild.ErrSubscriptionNotFound:
+			respondError(w, http.StatusConflict, "Subscription was changed concurrently")
+		case errors.Is(err, ngsild.ErrInvalidSubscription):
+			respondError(w, http.StatusBadRequest, err.Error())
+		default:
+			respondError(w, http.StatusInternalServerError, "Failed to apply subscription: "+err.Error())
+		}
+		return
+	}
+
+	if result.Action == manage.ActionCreate {
+		respondJSON(w, http.StatusCreated, result)
+	} else {
+		respondJSON(w, http.StatusOK, result)
+	}
+}
+
+// DeleteManagedSubscription handles DELETE /manage/subscriptions/{subscriptionID}
+func (s *Server) DeleteManagedSubscription(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	subscriptionID := chi.URLParam(r, "subscriptionID")
+	if subscriptionID == "" {
+		respondError(w, http.StatusBadRequest, "Subscription ID is required")
+		return
+	}
+
+	dryRun, err := manage.ParseDryRun(r.URL.Query().Get("dryRun"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	sub, err := s.NGSILD.Get(subscriptionID)
+	if err != nil {
+		if err == ngsild.ErrSubscriptionNotFound {
+			respondJSON(w, http.StatusOK, manage.Result{Action: manage.ActionNone, Changes: []manage.Change{}, DryRun: dryRun})
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to get subscription: "+err.Error())
+		}
+		return
+	}
+
+	result := manage.Plan(manage.NormalizeSubscription(sub), nil)
+	result.DryRun = dryRun
+	if !dryRun {
+		if err := s.NGSILD.Delete(subscriptionID); err != nil && err != ngsild.ErrSubscriptionNotFound {
+			respondError(w, http.StatusInternalServerError, "Failed to delete subscription: "+err.Error())
+			return
+		}
+	}
+
+	respondJSON(w, http.StatusOK, result)
+}
+
+// copyMap returns a shallow copy of a map
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,204 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/approval"
+	"github.com/aleka07/go-digital-twin/pkg/manage"
+)
+
+func TestManagedTwin(t *testing.T) {
+	server := setupTestServer()
+
+	put := func(query string, body map[string]interface{}) (*httptest.ResponseRecorder, manage.Result) {
+		jsonData, _ := json.Marshal(body)
+		req := httptest.NewRequest("PUT", "/manage/twins/pump-1"+query, bytes.NewBuffer(jsonData))
+		req = req.WithContext(setURLParam(req.Context(), "twinID", "pump-1"))
+		w := httptest.NewRecorder()
+		server.PutManagedTwin(w, req)
+
+		var result manage.Result
+		json.Unmarshal(w.Body.Bytes(), &result)
+		return w, result
+	}
+
+	desired := map[string]interface{}{
+		"type":       "pump",
+		"attributes": map[string]interface{}{"serial": "P-100"},
+		"features": map[string]interface{}{
+			"control": map[string]interface{}{"desiredProperties": map[string]interface{}{"setpoint": 10}},
+		},
+	}
+
+	// Dry runs plan without applying
+	w, result := put("?dryRun=true", desired)
+	if w.Code != http.StatusOK || result.Action != manage.ActionCreate || !result.DryRun {
+		t.Fatalf("Expected a create plan, got %d %+v", w.Code, result)
+	}
+	if _, err := server.Registry.Get("pump-1"); err == nil {
+		t.Fatal("Expected the dry run not to create the twin")
+	}
+
+	w, result = put("", desired)
+	if w.Code != http.StatusCreated || result.Action != manage.ActionCreate {
+		t.Fatalf("Expected status code %d and a create, got %d %+v", http.StatusCreated, w.Code, result)
+	}
+
+	// Reported properties do not show up as drift
+	dt, _ := server.Registry.Get("pump-1")
+	control, _ := dt.GetFeature("control")
+	control.SetProperty("pressure", 2.5)
+
+	w, result = put("", desired)
+	if w.Code != http.StatusOK || result.Action != manage.ActionNone || len(result.Changes) != 0 {
+		t.Errorf("Expected an idempotent apply, got %d %+v", w.Code, result)
+	}
+
+	req := httptest.NewRequest("GET", "/manage/twins/pump-1", nil)
+	req = req.WithContext(setURLParam(req.Context(), "twinID", "pump-1"))
+	w = httptest.NewRecorder()
+	server.GetManagedTwin(w, req)
+
+	var state manage.Twin
+	json.Unmarshal(w.Body.Bytes(), &state)
+	if w.Code != http.StatusOK || state.ID != "pump-1" || state.Features["control"].DesiredProperties["setpoint"] != 10.0 {
+		t.Errorf("Unexpected state %d %+v", w.Code, state)
+	}
+
+	desired["attributes"] = map[string]interface{}{"serial": "P-200"}
+	w, result = put("", desired)
+	if w.Code != http.StatusOK || result.Action != manage.ActionUpdate || len(result.Changes) != 1 || result.Changes[0].Path != "attributes.serial" {
+		t.Errorf("Expected an update of the serial, got %d %+v", w.Code, result)
+	}
+
+	// Sensitive changes require approval
+	server.Approvals.SetPolicy(approval.Policy{FeatureID: "control", Property: "setpoint"})
+	desired["features"] = map[string]interface{}{
+		"control": map[string]interface{}{"desiredProperties": map[string]interface{}{"setpoint": 50}},
+	}
+	if w, _ := put("", desired); w.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d, got %d", http.StatusConflict, w.Code)
+	}
+
+	if w, _ := put("", map[string]interface{}{"id": "pump-2", "type": "pump"}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for a mismatched ID, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	del := func() manage.Result {
+		req := httptest.NewRequest("DELETE", "/manage/twins/pump-1", nil)
+		req = req.WithContext(setURLParam(req.Context(), "twinID", "pump-1"))
+		w := httptest.NewRecorder()
+		server.DeleteManagedTwin(w, req)
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+		}
+
+		var result manage.Result
+		json.Unmarshal(w.Body.Bytes(), &result)
+		return result
+	}
+
+	if result := del(); result.Action != manage.ActionDelete {
+		t.Errorf("Expected a delete, got %+v", result)
+	}
+	if result := del(); result.Action != manage.ActionNone {
+		t.Errorf("Expected deleting a missing twin to do nothing, got %+v", result)
+	}
+}
+
+func TestManagedScript(t *testing.T) {
+	server := setupTestServer()
+
+	put := func(body map[string]interface{}) (*httptest.ResponseRecorder, manage.Result) {
+		jsonData, _ := json.Marshal(body)
+		req := httptest.NewRequest("PUT", "/manage/scripts/hot", bytes.NewBuffer(jsonData))
+		req = req.WithContext(setURLParam(req.Context(), "scriptName", "hot"))
+		w := httptest.NewRecorder()
+		server.PutManagedScript(w, req)
+
+		var result manage.Result
+		json.Unmarshal(w.Body.Bytes(), &result)
+		return w, result
+	}
+
+	rule := map[string]interface{}{"kind": "rule", "source": "def evaluate(twin): return False", "timeout": "1000ms"}
+	if w, result := put(rule); w.Code != http.StatusCreated || result.Action != manage.ActionCreate {
+		t.Fatalf("Expected status code %d and a create, got %d %+v", http.StatusCreated, w.Code, result)
+	}
+
+	// The timeout reads back in canonical form and does not cause drift
+	if w, result := put(rule); w.Code != http.StatusOK || result.Action != manage.ActionNone {
+		t.Errorf("Expected an idempotent apply, got %d %+v", w.Code, result)
+	}
+
+	rule["source"] = "def evaluate(twin): return True"
+	if w, result := put(rule); w.Code != http.StatusOK || result.Action != manage.ActionUpdate {
+		t.Errorf("Expected an update, got %d %+v", w.Code, result)
+	}
+
+	rule["source"] = "def evaluate(twin) return True"
+	if w, _ := put(rule); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	req := httptest.NewRequest("GET", "/manage/scripts/hot", nil)
+	req = req.WithContext(setURLParam(req.Context(), "scriptName", "hot"))
+	w := httptest.NewRecorder()
+	server.GetManagedScript(w, req)
+
+	var state map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &state)
+	if state["source"] != "def evaluate(twin): return True" || state["timeout"] != "1s" {
+		t.Errorf("Unexpected state %v", state)
+	}
+}
+
+func TestManagedSubscription(t *testing.T) {
+	server := setupTestServer()
+
+	put := func(body map[string]interface{}) (*httptest.ResponseRecorder, manage.Result) {
+		jsonData, _ := json.Marshal(body)
+		req := httptest.NewRequest("PUT", "/manage/subscriptions/urn:ngsi-ld:Subscription:s", bytes.NewBuffer(jsonData))
+		req = req.WithContext(setURLParam(req.Context(), "subscriptionID", "urn:ngsi-ld:Subscription:s"))
+		w := httptest.NewRecorder()
+		server.PutManagedSubscription(w, req)
+
+		var result manage.Result
+		json.Unmarshal(w.Body.Bytes(), &result)
+		return w, result
+	}
+
+	sub := map[string]interface{}{
+		"entities":     []map[string]string{{"type": "Pump"}},
+		"notification": map[string]interface{}{"endpoint": map[string]string{"uri": "http://example.com/notify"}},
+	}
+	if w, result := put(sub); w.Code != http.StatusCreated || result.Action != manage.ActionCreate {
+		t.Fatalf("Expected status code %d and a create, got %d %+v", http.StatusCreated, w.Code, result)
+	}
+	if w, result := put(sub); w.Code != http.StatusOK || result.Action != manage.ActionNone {
+		t.Errorf("Expected an idempotent apply, got %d %+v", w.Code, result)
+	}
+
+	sub["watchedAttributes"] = []string{"temperature"}
+	if w, result := put(sub); w.Code != http.StatusOK || result.Action != manage.ActionUpdate {
+		t.Errorf("Expected an update, got %d %+v", w.Code, result)
+	}
+	if stored, _ := server.NGSILD.Get("urn:ngsi-ld:Subscription:s"); len(stored.WatchedAttributes) != 1 {
+		t.Errorf("Expected the watched attributes to be replaced, got %+v", stored)
+	}
+
+	req := httptest.NewRequest("DELETE", "/manage/subscriptions/urn:ngsi-ld:Subscription:s?dryRun=true", nil)
+	req = req.WithContext(setURLParam(req.Context(), "subscriptionID", "urn:ngsi-ld:Subscription:s"))
+	w := httptest.NewRecorder()
+	server.DeleteManagedSubscription(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if _, err := server.NGSILD.Get("urn:ngsi-ld:Subscription:s"); err != nil {
+		t.Errorf("Expected the dry run not to delete the subscription, got %v", err)
+	}
+}
@@ -0,0 +1,205 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/aleka07/go-digital-twin/pkg/ingest"
+	"github.com/aleka07/go-digital-twin/pkg/mapping"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/schema"
+	"github.com/aleka07/go-digital-twin/pkg/valuesize"
+	"github.com/go-chi/chi/v5"
+)
+
+// Topic mapping handlers
+
+// ListMappings handles GET /mappings
+func (s *Server) ListMappings(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	respondJSON(w, http.StatusOK, s.Mappings.List())
+}
+
+// GetMapping handles GET /mappings/{mappingID}
+func (s *Server) GetMapping(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	rule, err := s.Mappings.Get(chi.URLParam(r, "mappingID"))
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Mapping not found")
+		return
+	}
+	respondJSON(w, http.StatusOK, rule)
+}
+
+// SetMapping handles PUT /mappings/{mappingID}
+func (s *Server) SetMapping(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	mappingID := chi.URLParam(r, "mappingID")
+	if mappingID == "" {
+		respondError(w, http.StatusBadRequest, "Mapping ID is required")
+		return
+	}
+
+	var rule mapping.Rule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	// Use the ID from the URL
+	rule.ID = mappingID
+
+	if err := s.Mappings.Set(rule); err != nil {
+		if errors.Is(err, mapping.ErrInvalidMapping) {
+			respondError(w, http.StatusBadRequest, err.Error())
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to set mapping: "+err.Error())
+		}
+		return
+	}
+
+	rule, _ = s.Mappings.Get(mappingID)
+	respondJSON(w, http.StatusOK, rule)
+}
+
+// DeleteMapping handles DELETE /mappings/{mappingID}
+func (s *Server) DeleteMapping(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	if err := s.Mappings.Delete(chi.URLParam(r, "mappingID")); err != nil {
+		if err == mapping.ErrMappingNotFound {
+			respondError(w, http.StatusNotFound, "Mapping not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to delete mapping: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Mapping deleted"})
+}
+
+// ListCodecs handles GET /mappings/codecs, the codecs rules may decode
+// payloads with
+func (s *Server) ListCodecs(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	respondJSON(w, http.StatusOK, s.Mappings.Codecs())
+}
+
+// TestMapping handles POST /mappings/test, a dry run returning the telemetry
+// a message would be mapped to without applying it
+func (s *Server) TestMapping(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	var req struct {
+		Topic         string          `json:"topic"`
+		Payload       json.RawMessage `json:"payload"`
+		PayloadBase64 string          `json:"payloadBase64"` // Binary payloads such as CBOR
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	if req.Topic == "" {
+		respondError(w, http.StatusBadRequest, "Topic is required")
+		return
+	}
+
+	// Payloads given as JSON strings are tested as their text
+	payload := []byte(req.Payload)
+	var text string
+	if json.Unmarshal(req.Payload, &text) == nil {
+		payload = []byte(text)
+	}
+	if req.PayloadBase64 != "" {
+		decoded, err := base64.StdEncoding.DecodeString(req.PayloadBase64)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid base64 payload: "+err.Error())
+			return
+		}
+		payload = decoded
+	}
+
+	match, err := s.Mappings.Map(req.Topic, payload)
+	if err != nil {
+		respondMappingError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, match)
+}
+
+// IngestTopic handles POST /ingest/topics/*, the reverse ingestion of a
+// message forwarded from a broker topic. The path after /ingest/topics/ is
+// the topic and the body the payload; the mapping rules decide which twin
+// receives it. The message ID used for deduplication may be given in the
+// X-Message-Id header.
+func (s *Server) IngestTopic(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	topic := chi.URLParam(r, "*")
+	if topic == "" {
+		respondError(w, http.StatusBadRequest, "Topic is required")
+		return
+	}
+
+	payload, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	match, err := s.Mappings.Map(topic, payload)
+	if err != nil {
+		respondMappingError(w, err)
+		return
+	}
+
+	telemetry := match.Telemetry
+	telemetry.MessageID = r.Header.Get("X-Message-Id")
+	result, err := s.Ingester.Apply(telemetry)
+	if err != nil {
+		if s.respondShed(w, err) {
+			return
+		}
+		switch {
+		case err == registry.ErrTwinNotFound:
+			respondError(w, http.StatusNotFound, "Digital twin "+telemetry.TwinID+" not found")
+		case err == ingest.ErrEmptyTelemetry:
+			respondError(w, http.StatusBadRequest, "Telemetry contains no properties")
+		case errors.Is(err, valuesize.ErrTooLarge):
+			respondError(w, http.StatusRequestEntityTooLarge, err.Error())
+		case errors.Is(err, ingest.ErrTransformFailed), errors.Is(err, schema.ErrViolation):
+			respondError(w, http.StatusUnprocessableEntity, err.Error())
+		default:
+			respondError(w, http.StatusInternalServerError, "Failed to ingest telemetry: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, result)
+}
+
+// respondMappingError answers messages that cannot be mapped
+func respondMappingError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, mapping.ErrNoMatch):
+		respondError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, mapping.ErrInvalidPayload):
+		respondError(w, http.StatusBadRequest, err.Error())
+	default:
+		respondError(w, http.StatusInternalServerError, "Failed to map message: "+err.Error())
+	}
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/mapping"
+)
+
+func TestTopicMappings(t *testing.T) {
+	server := setupTestServer()
+
+	serve := serveFunc(server, APIPrefix)
+
+	serve("POST", "/twins", `{"id": "line1-m2", "type": "machine"}`)
+	w := serve("PUT", "/mappings/temperature", `{"topic": "factory/{line}/{machine}/temp", "twin": "{line}-{machine}", "feature": "temperature", "property": "value"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Failed to set mapping: %d %s", w.Code, w.Body.String())
+	}
+
+	// Dry runs map messages without applying them
+	w = serve("POST", "/mappings/test", `{"topic": "factory/line1/m2/temp", "payload": 21.5}`)
+	var match mapping.Match
+	json.Unmarshal(w.Body.Bytes(), &match)
+	if w.Code != http.StatusOK || match.Telemetry.TwinID != "line1-m2" || match.Variables["machine"] != "m2" {
+		t.Fatalf("Failed to test mapping: %d %s", w.Code, w.Body.String())
+	}
+	dt, _ := server.Registry.Get("line1-m2")
+	if _, exists := dt.GetFeature("temperature"); exists {
+		t.Error("Expected the dry run not to write the twin")
+	}
+
+	if w := serve("POST", "/ingest/topics/factory/line1/m2/temp", "21.5"); w.Code != http.StatusOK {
+		t.Fatalf("Failed to ingest topic: %d %s", w.Code, w.Body.String())
+	}
+	dt, _ = server.Registry.Get("line1-m2")
+	feature, _ := dt.GetFeature("temperature")
+	if value, _ := feature.GetProperty("value"); value != 21.5 {
+		t.Errorf("Expected the temperature to be 21.5, got %v", value)
+	}
+
+	for _, tc := range []struct {
+		method, path, body string
+		code               int
+	}{
+		{"POST", "/ingest/topics/factory/line1/m2/humidity", "40", http.StatusNotFound},
+		{"POST", "/ingest/topics/factory/line9/m2/temp", "21.5", http.StatusNotFound},
+		{"POST", "/mappings/test", `{"payload": 1}`, http.StatusBadRequest},
+		{"PUT", "/mappings/broken", `{"topic": "a/{x}", "twin": "{y}", "feature": "f"}`, http.StatusBadRequest},
+		{"GET", "/mappings/temperature", "", http.StatusOK},
+		{"DELETE", "/mappings/temperature", "", http.StatusOK},
+		{"GET", "/mappings/temperature", "", http.StatusNotFound},
+	} {
+		if w := serve(tc.method, tc.path, tc.body); w.Code != tc.code {
+			t.Errorf("%s %s: expected status code %d, got %d %s", tc.method, tc.path, tc.code, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestBinaryTopicMappings(t *testing.T) {
+	server := setupTestServer()
+
+	serve := serveFunc(server, APIPrefix)
+
+	serve("POST", "/twins", `{"id": "press-1", "type": "machine"}`)
+	if w := serve("PUT", "/mappings/motor", `{"topic": "cbor/{machine}", "twin": "{machine}", "feature": "motor", "codec": "cbor"}`); w.Code != http.StatusOK {
+		t.Fatalf("Failed to set mapping: %d %s", w.Code, w.Body.String())
+	}
+	if w := serve("PUT", "/mappings/broken", `{"topic": "x", "twin": "t", "feature": "f", "codec": "avro"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected an unknown codec to be rejected, got %d", w.Code)
+	}
+
+	var codecs []string
+	w := serve("GET", "/mappings/codecs", "")
+	json.Unmarshal(w.Body.Bytes(), &codecs)
+	if len(codecs) != 3 || codecs[0] != "cbor" {
+		t.Errorf("Unexpected codecs %s", w.Body.String())
+	}
+
+	// {"rpm": 1430} in CBOR
+	payload := "\xa1\x63rpm\x19\x05\x96"
+	if w := serve("POST", "/mappings/test", `{"topic": "cbor/press-1", "payloadBase64": "oWNycG0ZBZY="}`); w.Code != http.StatusOK {
+		t.Errorf("Failed to test binary payload: %d %s", w.Code, w.Body.String())
+	}
+	if w := serve("POST", "/mappings/test", `{"topic": "cbor/press-1", "payloadBase64": "%%%"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected invalid base64 to be rejected, got %d", w.Code)
+	}
+	if w := serve("POST", "/ingest/topics/cbor/press-1", payload); w.Code != http.StatusOK {
+		t.Fatalf("Failed to ingest CBOR: %d %s", w.Code, w.Body.String())
+	}
+	dt, _ := server.Registry.Get("press-1")
+	feature, _ := dt.GetFeature("motor")
+	if value, _ := feature.GetProperty("rpm"); value != 1430.0 {
+		t.Errorf("Expected rpm to be 1430, got %v", value)
+	}
+	if w := serve("POST", "/ingest/topics/cbor/press-1", "\xa1"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected truncated CBOR to be rejected, got %d", w.Code)
+	}
+}
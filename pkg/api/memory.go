@@ -0,0 +1,28 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+)
+
+// Memory accounting handlers
+
+// memoryResponse is the response body of GET /admin/memory
+type memoryResponse struct {
+	registry.MemoryUsage
+	MinIdle string `json:"minIdle,omitempty"` // Twins used more recently are never evicted
+}
+
+// GetMemoryUsage handles GET /admin/memory
+func (s *Server) GetMemoryUsage(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	usage := s.Registry.MemoryUsage()
+	resp := memoryResponse{MemoryUsage: usage}
+	if usage.Budget.MinIdle > 0 {
+		resp.MinIdle = usage.Budget.MinIdle.String()
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
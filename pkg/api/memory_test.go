@@ -0,0 +1,42 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestMemoryBudget(t *testing.T) {
+	server := setupTestServer()
+	server.Registry.Create(twin.NewDigitalTwin("pump-1", "pump"))
+	server.Registry.SetBudget(registry.Budget{MaxTwins: 1, MinIdle: time.Minute}, nil)
+
+	req := httptest.NewRequest("POST", "/twins", bytes.NewBufferString(`{"id": "pump-2", "type": "pump"}`))
+	w := httptest.NewRecorder()
+	server.CreateTwin(w, req)
+	if w.Code != http.StatusInsufficientStorage {
+		t.Errorf("Expected status code %d, got %d", http.StatusInsufficientStorage, w.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/admin/memory", nil)
+	w = httptest.NewRecorder()
+	server.GetMemoryUsage(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var usage map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&usage)
+	if usage["twins"] != 1.0 || usage["rejected"] != 1.0 || usage["minIdle"] != "1m0s" {
+		t.Errorf("Unexpected usage %v", usage)
+	}
+	if types, _ := usage["types"].(map[string]interface{}); types["pump"] == nil {
+		t.Errorf("Expected usage of the pump type, got %v", usage["types"])
+	}
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/aleka07/go-digital-twin/pkg/auth"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/go-chi/chi/v5"
+)
+
+// MergeTwin handles POST /twins/{twinID}/merge, merging a duplicate twin
+// into the twin of the path: {"source": "pump-1b", "strategy": "newest-wins"}.
+// The strategy decides the attributes and properties both twins have; see
+// registry.MergeStrategy. The source is deleted, and requests to it are
+// redirected to the twin it was merged into. Its history, annotations,
+// attachments and static group memberships move to the target. Scoped
+// tokens need read and delete access to the source.
+func (s *Server) MergeTwin(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	twinID := chi.URLParam(r, "twinID")
+	if twinID == "" {
+		respondError(w, http.StatusBadRequest, "Twin ID is required")
+		return
+	}
+
+	var req struct {
+		Source   string `json:"source"`
+		Strategy string `json:"strategy"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	if req.Source == "" {
+		respondError(w, http.StatusBadRequest, "Source twin ID is required")
+		return
+	}
+	strategy, err := registry.ParseMergeStrategy(req.Strategy)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !s.authorizeTwin(w, r, req.Source, auth.VerbRead, auth.VerbDelete) {
+		return
+	}
+
+	referrers, err := s.Registry.Merge(twinID, req.Source, strategy)
+	if err != nil {
+		switch {
+		case err == registry.ErrTwinNotFound:
+			respondError(w, http.StatusNotFound, "Digital twin not found")
+		case errors.Is(err, registry.ErrInvalidID):
+			respondError(w, http.StatusBadRequest, err.Error())
+		default:
+			respondError(w, http.StatusInternalServerError, "Failed to merge digital twins: "+err.Error())
+		}
+		return
+	}
+
+	dt, err := s.Twins.Get(twinID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get merged digital twin: "+err.Error())
+		return
+	}
+
+	s.History.RenameTwin(req.Source, twinID)
+	s.Annotations.RenameTwin(req.Source, twinID)
+	s.Shares.RevokeTwin(req.Source)
+	s.Groups.RenameTwin(req.Source, twinID)
+	s.Access.RenameTwin(req.Source, twinID)
+	attachmentErr := s.Attachments.RenameTwin(r.Context(), req.Source, twinID)
+
+	// Publish events
+	s.PubSub.Publish("twin.deleted", map[string]string{"id": req.Source})
+	s.PubSub.Publish("twin.updated", map[string]string{"id": twinID})
+	for _, id := range referrers {
+		s.PubSub.Publish("twin.updated", map[string]string{"id": id})
+	}
+	s.PubSub.Publish("twin.merged", map[string]string{"sourceId": req.Source, "targetId": twinID})
+
+	if attachmentErr != nil {
+		respondError(w, http.StatusInternalServerError, "Merged digital twins, but failed to move attachments: "+attachmentErr.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, twinBody(r, dt))
+}
+
+// redirectMerged redirects requests to twins merged into another twin to
+// the same path of that twin with 308 Permanent Redirect, which clients
+// follow with the same method and body
+func (s *Server) redirectMerged(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target, merged := s.Registry.Redirect(chi.URLParam(r, "twinID"))
+		if !merged {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		path := r.URL.EscapedPath()
+		i := strings.Index(path, "/twins/") + len("/twins/")
+		_, below, _ := strings.Cut(path[i:], "/")
+		location := path[:i] + url.PathEscape(target)
+		if below != "" {
+			location += "/" + below
+		}
+		if r.URL.RawQuery != "" {
+			location += "?" + r.URL.RawQuery
+		}
+
+		w.Header().Set("Location", location)
+		respondJSON(w, http.StatusPermanentRedirect, map[string]string{"message": "Digital twin merged into " + target})
+	})
+}
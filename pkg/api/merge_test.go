@@ -0,0 +1,61 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestMergeTwin(t *testing.T) {
+	server := setupTestServer()
+	events := server.PubSub.Subscribe("twin.merged")
+
+	serve := serveFunc(server, APIPrefix)
+
+	serve("POST", "/twins", `{"id": "pump-1", "type": "pump", "attributes": {"site": "north"}}`)
+	serve("POST", "/twins", `{"id": "pump-1b", "type": "pump", "attributes": {"site": "south", "vendor": "acme"}}`)
+	server.History.Record("pump-1b", "motor", "rpm", 1450.0, time.Now())
+
+	w := serve("POST", "/twins/pump-1/merge", `{"source": "pump-1b"}`)
+	var merged Twin
+	json.Unmarshal(w.Body.Bytes(), &merged)
+	if w.Code != http.StatusOK || merged.Attributes["site"] != "north" || merged.Attributes["vendor"] != "acme" {
+		t.Fatalf("Failed to merge twins: %d %s", w.Code, w.Body.String())
+	}
+
+	select {
+	case msg := <-events:
+		if payload := msg.Payload.(map[string]string); payload["sourceId"] != "pump-1b" || payload["targetId"] != "pump-1" {
+			t.Errorf("Unexpected event %v", msg.Payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected a twin.merged event")
+	}
+	if props := server.History.Properties("pump-1"); len(props) != 1 {
+		t.Errorf("Expected the history of pump-1b for pump-1, got %v", props)
+	}
+
+	// Requests to the merged twin are redirected
+	w = serve("GET", "/twins/pump-1b/attributes/site?format=json", "")
+	if location := w.Header().Get("Location"); w.Code != http.StatusPermanentRedirect || location != APIPrefix+"/twins/pump-1/attributes/site?format=json" {
+		t.Errorf("Expected a redirect to pump-1, got %d %q", w.Code, location)
+	}
+
+	serve("POST", "/twins", `{"id": "valve-1", "type": "valve"}`)
+	for _, tc := range []struct {
+		path, body string
+		code       int
+	}{
+		{"/twins/pump-1/merge", `{"source": "missing"}`, http.StatusNotFound},
+		{"/twins/missing/merge", `{"source": "valve-1"}`, http.StatusNotFound},
+		{"/twins/pump-1/merge", `{"source": "pump-1"}`, http.StatusBadRequest},
+		{"/twins/pump-1/merge", `{"source": "valve-1", "strategy": "oldest-wins"}`, http.StatusBadRequest},
+		{"/twins/pump-1/merge", `{}`, http.StatusBadRequest},
+		{"/twins/pump-1/merge", `{"source": `, http.StatusBadRequest},
+	} {
+		if w := serve("POST", tc.path, tc.body); w.Code != tc.code {
+			t.Errorf("%s %s: expected status code %d, got %d %s", tc.path, tc.body, tc.code, w.Code, w.Body.String())
+		}
+	}
+}
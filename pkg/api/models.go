@@ -0,0 +1,133 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/aleka07/go-digital-twin/pkg/inference"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/go-chi/chi/v5"
+)
+
+// Inference model handlers
+
+// CreateModel handles POST /models
+func (s *Server) CreateModel(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	var model inference.Model
+	if err := json.NewDecoder(r.Body).Decode(&model); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	if err := s.Models.Create(model); err != nil {
+		switch {
+		case errors.Is(err, inference.ErrModelAlreadyExists):
+			respondError(w, http.StatusConflict, "Model already exists")
+		case errors.Is(err, inference.ErrInvalidModel):
+			respondError(w, http.StatusBadRequest, err.Error())
+		default:
+			respondError(w, http.StatusInternalServerError, "Failed to create model: "+err.Error())
+		}
+		return
+	}
+
+	created, _, _ := s.Models.Get(model.Name)
+	respondJSON(w, http.StatusCreated, created)
+}
+
+// ListModels handles GET /models
+func (s *Server) ListModels(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	respondJSON(w, http.StatusOK, s.Models.List())
+}
+
+// GetModel handles GET /models/{modelName} and includes the invocation status
+func (s *Server) GetModel(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	modelName := chi.URLParam(r, "modelName")
+	if modelName == "" {
+		respondError(w, http.StatusBadRequest, "Model name is required")
+		return
+	}
+
+	model, status, err := s.Models.Get(modelName)
+	if err != nil {
+		if err == inference.ErrModelNotFound {
+			respondError(w, http.StatusNotFound, "Model not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to get model: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, struct {
+		inference.Model
+		Status inference.Status `json:"status"`
+	}{model, status})
+}
+
+// DeleteModel handles DELETE /models/{modelName}
+func (s *Server) DeleteModel(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	modelName := chi.URLParam(r, "modelName")
+	if modelName == "" {
+		respondError(w, http.StatusBadRequest, "Model name is required")
+		return
+	}
+
+	if err := s.Models.Delete(modelName); err != nil {
+		if err == inference.ErrModelNotFound {
+			respondError(w, http.StatusNotFound, "Model not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to delete model: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Model deleted"})
+}
+
+// PredictTwin handles POST /models/{modelName}/twins/{twinID}/predict, which
+// invokes a model for a twin right away and returns the stored predictions
+func (s *Server) PredictTwin(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	modelName := chi.URLParam(r, "modelName")
+	if modelName == "" {
+		respondError(w, http.StatusBadRequest, "Model name is required")
+		return
+	}
+	twinID := chi.URLParam(r, "twinID")
+	if twinID == "" {
+		respondError(w, http.StatusBadRequest, "Twin ID is required")
+		return
+	}
+
+	predictions, err := s.Models.Predict(r.Context(), modelName, twinID)
+	if err != nil {
+		switch {
+		case err == inference.ErrModelNotFound:
+			respondError(w, http.StatusNotFound, "Model not found")
+		case err == registry.ErrTwinNotFound:
+			respondError(w, http.StatusNotFound, "Digital twin not found")
+		case err == inference.ErrNotApplicable:
+			respondError(w, http.StatusBadRequest, "Model does not apply to twins of this type")
+		default:
+			respondError(w, http.StatusBadGateway, "Failed to invoke model: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, predictions)
+}
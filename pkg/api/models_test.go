@@ -0,0 +1,88 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestModels(t *testing.T) {
+	server := setupTestServer()
+
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"failureProbability": 0.2}`))
+	}))
+	defer endpoint.Close()
+
+	pump := twin.NewDigitalTwin("pump-1", "pump")
+	status := twin.NewFeatureState()
+	status.SetProperty("vibration", 4.2)
+	pump.AddFeature("status", status)
+	server.Registry.Create(pump)
+
+	create := func(body map[string]interface{}) *httptest.ResponseRecorder {
+		jsonData, _ := json.Marshal(body)
+		req := httptest.NewRequest("POST", "/models", bytes.NewBuffer(jsonData))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		server.CreateModel(w, req)
+		return w
+	}
+
+	model := map[string]interface{}{"name": "failure", "kind": "http", "url": endpoint.URL, "type": "pump", "onChange": true}
+	if w := create(model); w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	if w := create(model); w.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d, got %d", http.StatusConflict, w.Code)
+	}
+	if w := create(map[string]interface{}{"name": "rul", "kind": "onnx", "path": "rul.onnx", "onChange": true}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d without an ONNX runtime, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	req := httptest.NewRequest("POST", "/models/failure/twins/pump-1/predict", nil)
+	req = req.WithContext(setURLParam(req.Context(), "modelName", "failure"))
+	req = req.WithContext(setURLParam(req.Context(), "twinID", "pump-1"))
+	w := httptest.NewRecorder()
+	server.PredictTwin(w, req)
+
+	var predictions map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &predictions)
+	if w.Code != http.StatusOK || predictions["failureProbability"] != 0.2 {
+		t.Fatalf("Unexpected predictions %d %s", w.Code, w.Body.String())
+	}
+
+	dt, _ := server.Registry.Get("pump-1")
+	if feature, exists := dt.GetFeature("predictions"); !exists {
+		t.Error("Expected the predictions feature")
+	} else if value, _ := feature.GetProperty("failureProbability"); value != 0.2 {
+		t.Errorf("Expected the stored prediction, got %v", value)
+	}
+
+	req = httptest.NewRequest("GET", "/models/failure", nil)
+	req = req.WithContext(setURLParam(req.Context(), "modelName", "failure"))
+	w = httptest.NewRecorder()
+	server.GetModel(w, req)
+
+	var got struct {
+		Status struct {
+			Invocations int `json:"invocations"`
+		} `json:"status"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &got)
+	if w.Code != http.StatusOK || got.Status.Invocations < 1 {
+		t.Errorf("Expected the model with its status, got %d %s", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest("DELETE", "/models/failure", nil)
+	req = req.WithContext(setURLParam(req.Context(), "modelName", "failure"))
+	w = httptest.NewRecorder()
+	server.DeleteModel(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+}
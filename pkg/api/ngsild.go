@@ -0,0 +1,292 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/aleka07/go-digital-twin/pkg/eventbus"
+	"github.com/aleka07/go-digital-twin/pkg/ngsild"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+	"github.com/go-chi/chi/v5"
+)
+
+// NGSI-LD problem types
+const (
+	problemBadRequestData   = "https://uri.etsi.org/ngsi-ld/errors/BadRequestData"
+	problemInvalidRequest   = "https://uri.etsi.org/ngsi-ld/errors/InvalidRequest"
+	problemAlreadyExists    = "https://uri.etsi.org/ngsi-ld/errors/AlreadyExists"
+	problemResourceNotFound = "https://uri.etsi.org/ngsi-ld/errors/ResourceNotFound"
+	problemInternalError    = "https://uri.etsi.org/ngsi-ld/errors/InternalError"
+)
+
+// ngsiBasePath is the prefix of the NGSI-LD API
+const ngsiBasePath = "/ngsi-ld/v1"
+
+// NGSI-LD entity handlers
+
+// CreateEntity handles POST /ngsi-ld/v1/entities
+func (s *Server) CreateEntity(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	var entity ngsild.Entity
+	if err := json.NewDecoder(r.Body).Decode(&entity); err != nil {
+		respondProblem(w, http.StatusBadRequest, problemInvalidRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	dt, err := ngsild.NewTwin(entity)
+	if err != nil {
+		respondProblem(w, http.StatusBadRequest, problemBadRequestData, err.Error())
+		return
+	}
+	dt.SetSystem(twin.SystemSource, "ngsild")
+
+	if err := s.Twins.Create(dt); err != nil {
+		if err == registry.ErrTwinAlreadyExists {
+			respondProblem(w, http.StatusConflict, problemAlreadyExists, "Entity already exists")
+		} else {
+			respondProblem(w, http.StatusInternalServerError, problemInternalError, "Failed to create entity: "+err.Error())
+		}
+		return
+	}
+
+	// Publish event
+	s.PubSub.Publish("twin.created", map[string]string{"id": dt.ID})
+
+	w.Header().Set("Location", ngsiBasePath+"/entities/"+ngsild.EntityID(dt))
+	w.WriteHeader(http.StatusCreated)
+}
+
+// ListEntities handles GET /ngsi-ld/v1/entities.
+// The type, id and attrs query parameters take comma-separated lists.
+func (s *Server) ListEntities(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	query := r.URL.Query()
+	types := splitList(query.Get("type"))
+	ids := splitList(query.Get("id"))
+	attrs := splitList(query.Get("attrs"))
+
+	entities := make([]ngsild.Entity, 0)
+	for _, dt := range s.Twins.List() {
+		if len(types) > 0 && !contains(types, dt.Type) {
+			continue
+		}
+		if len(ids) > 0 && !contains(ids, ngsild.EntityID(dt)) {
+			continue
+		}
+		entities = append(entities, ngsild.ToEntity(s.Registry, dt, attrs))
+	}
+
+	respondJSON(w, http.StatusOK, entities)
+}
+
+// GetEntity handles GET /ngsi-ld/v1/entities/{entityID}
+func (s *Server) GetEntity(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	entityID := chi.URLParam(r, "entityID")
+	if entityID == "" {
+		respondProblem(w, http.StatusBadRequest, problemBadRequestData, "Entity ID is required")
+		return
+	}
+
+	dt, err := ngsild.Resolve(s.Registry, entityID)
+	if err != nil {
+		respondProblem(w, http.StatusNotFound, problemResourceNotFound, "Entity not found")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, ngsild.ToEntity(s.Registry, dt, splitList(r.URL.Query().Get("attrs"))))
+}
+
+// UpdateEntityAttrs handles PATCH /ngsi-ld/v1/entities/{entityID}/attrs
+func (s *Server) UpdateEntityAttrs(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	entityID := chi.URLParam(r, "entityID")
+	if entityID == "" {
+		respondProblem(w, http.StatusBadRequest, problemBadRequestData, "Entity ID is required")
+		return
+	}
+
+	dt, err := ngsild.Resolve(s.Registry, entityID)
+	if err != nil {
+		respondProblem(w, http.StatusNotFound, problemResourceNotFound, "Entity not found")
+		return
+	}
+
+	var fragment ngsild.Entity
+	if err := json.NewDecoder(r.Body).Decode(&fragment); err != nil {
+		respondProblem(w, http.StatusBadRequest, problemInvalidRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	attrs := ngsild.Attributes(fragment)
+	changed, err := ngsild.Apply(dt, attrs)
+	if err != nil {
+		if errors.Is(err, ngsild.ErrInvalidEntity) {
+			respondProblem(w, http.StatusBadRequest, problemBadRequestData, err.Error())
+		} else {
+			respondProblem(w, http.StatusInternalServerError, problemInternalError, "Failed to update entity: "+err.Error())
+		}
+		return
+	}
+
+	if err := s.Twins.Update(dt); err != nil {
+		respondProblem(w, http.StatusInternalServerError, problemInternalError, "Failed to update entity: "+err.Error())
+		return
+	}
+
+	// Publish events, one per changed feature and one for twin attributes
+	now := s.Clock().Now()
+	for _, featureID := range changed {
+		properties := attrs[featureID].(map[string]interface{})["value"].(map[string]interface{})
+		for k, v := range properties {
+			s.History.Record(dt.ID, featureID, k, v, now)
+		}
+
+		s.PubSub.Publish("properties.updated", eventbus.PropertiesUpdated{
+			TwinID:     dt.ID,
+			FeatureID:  featureID,
+			Properties: properties,
+		})
+	}
+	if len(changed) < len(attrs) {
+		s.PubSub.Publish("twin.updated", map[string]string{"id": dt.ID})
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteEntity handles DELETE /ngsi-ld/v1/entities/{entityID}
+func (s *Server) DeleteEntity(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	entityID := chi.URLParam(r, "entityID")
+	if entityID == "" {
+		respondProblem(w, http.StatusBadRequest, problemBadRequestData, "Entity ID is required")
+		return
+	}
+
+	dt, err := ngsild.Resolve(s.Registry, entityID)
+	if err != nil {
+		respondProblem(w, http.StatusNotFound, problemResourceNotFound, "Entity not found")
+		return
+	}
+
+	if err := s.Twins.Delete(dt.ID); err != nil {
+		respondProblem(w, http.StatusInternalServerError, problemInternalError, "Failed to delete entity: "+err.Error())
+		return
+	}
+
+	s.forgetTwin(r.Context(), dt.ID)
+
+	// Publish event
+	s.PubSub.Publish("twin.deleted", map[string]string{"id": dt.ID})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// NGSI-LD subscription handlers
+
+// CreateSubscription handles POST /ngsi-ld/v1/subscriptions
+func (s *Server) CreateSubscription(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	var sub ngsild.Subscription
+	if err := json.NewDecoder(r.Body).Decode(&sub); err != nil {
+		respondProblem(w, http.StatusBadRequest, problemInvalidRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	created, err := s.NGSILD.Create(sub)
+	if err != nil {
+		switch {
+		case err == ngsild.ErrSubscriptionAlreadyExists:
+			respondProblem(w, http.StatusConflict, problemAlreadyExists, "Subscription already exists")
+		case errors.Is(err, ngsild.ErrInvalidSubscription):
+			respondProblem(w, http.StatusBadRequest, problemBadRequestData, err.Error())
+		default:
+			respondProblem(w, http.StatusInternalServerError, problemInternalError, "Failed to create subscription: "+err.Error())
+		}
+		return
+	}
+
+	w.Header().Set("Location", ngsiBasePath+"/subscriptions/"+created.ID)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// ListSubscriptions handles GET /ngsi-ld/v1/subscriptions
+func (s *Server) ListSubscriptions(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	respondJSON(w, http.StatusOK, s.NGSILD.List())
+}
+
+// GetSubscription handles GET /ngsi-ld/v1/subscriptions/{subscriptionID}
+func (s *Server) GetSubscription(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	sub, err := s.NGSILD.Get(chi.URLParam(r, "subscriptionID"))
+	if err != nil {
+		respondProblem(w, http.StatusNotFound, problemResourceNotFound, "Subscription not found")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, sub)
+}
+
+// DeleteSubscription handles DELETE /ngsi-ld/v1/subscriptions/{subscriptionID}
+func (s *Server) DeleteSubscription(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	if err := s.NGSILD.Delete(chi.URLParam(r, "subscriptionID")); err != nil {
+		respondProblem(w, http.StatusNotFound, problemResourceNotFound, "Subscription not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// respondProblem sends an NGSI-LD problem details response
+func respondProblem(w http.ResponseWriter, status int, problemType, detail string) {
+	respondJSON(w, status, map[string]string{
+		"type":   problemType,
+		"title":  http.StatusText(status),
+		"detail": detail,
+	})
+}
+
+// splitList splits a comma-separated query parameter, ignoring empty items
+func splitList(s string) []string {
+	var result []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// contains reports whether a list contains a string
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/ngsild"
+)
+
+func TestNGSILDEntities(t *testing.T) {
+	server := setupTestServer()
+
+	entity := map[string]interface{}{
+		"id":    "urn:ngsi-ld:Pump:pump-1",
+		"type":  "Pump",
+		"name":  map[string]interface{}{"type": "Property", "value": "Main pump"},
+		"motor": map[string]interface{}{"type": "Property", "value": map[string]interface{}{"rpm": 1450.0}},
+	}
+
+	create := func() *httptest.ResponseRecorder {
+		jsonData, _ := json.Marshal(entity)
+		req := httptest.NewRequest("POST", "/ngsi-ld/v1/entities", bytes.NewBuffer(jsonData))
+		w := httptest.NewRecorder()
+		server.CreateEntity(w, req)
+		return w
+	}
+
+	w := create()
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	if location := w.Header().Get("Location"); location != "/ngsi-ld/v1/entities/urn:ngsi-ld:Pump:pump-1" {
+		t.Errorf("Unexpected location: %s", location)
+	}
+
+	if _, err := server.Registry.Get("pump-1"); err != nil {
+		t.Fatalf("Expected twin pump-1 to be created: %v", err)
+	}
+
+	if w := create(); w.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d, got %d", http.StatusConflict, w.Code)
+	}
+
+	// Update a feature through its attribute
+	jsonData, _ := json.Marshal(map[string]interface{}{
+		"motor": map[string]interface{}{"type": "Property", "value": map[string]interface{}{"rpm": 1500.0}},
+	})
+	req := httptest.NewRequest("PATCH", "/ngsi-ld/v1/entities/urn:ngsi-ld:Pump:pump-1/attrs", bytes.NewBuffer(jsonData))
+	req = req.WithContext(setURLParam(req.Context(), "entityID", "urn:ngsi-ld:Pump:pump-1"))
+	w = httptest.NewRecorder()
+	server.UpdateEntityAttrs(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusNoContent, w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/ngsi-ld/v1/entities/urn:ngsi-ld:Pump:pump-1?attrs=motor", nil)
+	req = req.WithContext(setURLParam(req.Context(), "entityID", "urn:ngsi-ld:Pump:pump-1"))
+	w = httptest.NewRecorder()
+	server.GetEntity(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var got map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &got)
+	motor := got["motor"].(map[string]interface{})["value"].(map[string]interface{})
+	if motor["rpm"] != 1500.0 || got["name"] != nil {
+		t.Errorf("Unexpected entity: %v", got)
+	}
+
+	// Entities can be filtered by type
+	req = httptest.NewRequest("GET", "/ngsi-ld/v1/entities?type=Valve", nil)
+	w = httptest.NewRecorder()
+	server.ListEntities(w, req)
+
+	var entities []map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &entities)
+	if len(entities) != 0 {
+		t.Errorf("Expected no valves, got %d entities", len(entities))
+	}
+
+	req = httptest.NewRequest("DELETE", "/ngsi-ld/v1/entities/urn:ngsi-ld:Pump:pump-1", nil)
+	req = req.WithContext(setURLParam(req.Context(), "entityID", "urn:ngsi-ld:Pump:pump-1"))
+	w = httptest.NewRecorder()
+	server.DeleteEntity(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected status code %d, got %d", http.StatusNoContent, w.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/ngsi-ld/v1/entities/urn:ngsi-ld:Pump:pump-1", nil)
+	req = req.WithContext(setURLParam(req.Context(), "entityID", "urn:ngsi-ld:Pump:pump-1"))
+	w = httptest.NewRecorder()
+	server.GetEntity(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	var problem map[string]string
+	json.Unmarshal(w.Body.Bytes(), &problem)
+	if problem["type"] != problemResourceNotFound {
+		t.Errorf("Expected problem type %s, got %s", problemResourceNotFound, problem["type"])
+	}
+}
+
+func TestNGSILDSubscriptions(t *testing.T) {
+	server := setupTestServer()
+
+	jsonData, _ := json.Marshal(ngsild.Subscription{
+		ID:       "urn:ngsi-ld:Subscription:pumps",
+		Entities: []ngsild.EntitySelector{{Type: "Pump"}},
+		Notification: ngsild.NotificationParams{
+			Endpoint: ngsild.Endpoint{URI: "http://localhost:1026/notify"},
+		},
+	})
+	req := httptest.NewRequest("POST", "/ngsi-ld/v1/subscriptions", bytes.NewBuffer(jsonData))
+	w := httptest.NewRecorder()
+	server.CreateSubscription(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/ngsi-ld/v1/subscriptions/urn:ngsi-ld:Subscription:pumps", nil)
+	req = req.WithContext(setURLParam(req.Context(), "subscriptionID", "urn:ngsi-ld:Subscription:pumps"))
+	w = httptest.NewRecorder()
+	server.GetSubscription(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	// Subscriptions without an endpoint are rejected
+	req = httptest.NewRequest("POST", "/ngsi-ld/v1/subscriptions", bytes.NewBufferString(`{"type":"Subscription"}`))
+	w = httptest.NewRecorder()
+	server.CreateSubscription(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	req = httptest.NewRequest("DELETE", "/ngsi-ld/v1/subscriptions/urn:ngsi-ld:Subscription:pumps", nil)
+	req = req.WithContext(setURLParam(req.Context(), "subscriptionID", "urn:ngsi-ld:Subscription:pumps"))
+	w = httptest.NewRecorder()
+	server.DeleteSubscription(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected status code %d, got %d", http.StatusNoContent, w.Code)
+	}
+}
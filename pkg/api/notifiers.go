@@ -0,0 +1,123 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/aleka07/go-digital-twin/pkg/notify"
+	"github.com/go-chi/chi/v5"
+)
+
+// Notification channel handlers
+
+// CreateNotifier handles POST /notifiers
+func (s *Server) CreateNotifier(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	var channel notify.Channel
+	if err := json.NewDecoder(r.Body).Decode(&channel); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	if err := s.Notifiers.Create(channel); err != nil {
+		switch {
+		case errors.Is(err, notify.ErrChannelAlreadyExists):
+			respondError(w, http.StatusConflict, "Notification channel already exists")
+		case errors.Is(err, notify.ErrInvalidChannel):
+			respondError(w, http.StatusBadRequest, err.Error())
+		default:
+			respondError(w, http.StatusInternalServerError, "Failed to create notification channel: "+err.Error())
+		}
+		return
+	}
+
+	created, _, _ := s.Notifiers.Get(channel.Name)
+	respondJSON(w, http.StatusCreated, created)
+}
+
+// ListNotifiers handles GET /notifiers
+func (s *Server) ListNotifiers(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	respondJSON(w, http.StatusOK, s.Notifiers.List())
+}
+
+// GetNotifier handles GET /notifiers/{channelName} and includes the delivery status
+func (s *Server) GetNotifier(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	channelName := chi.URLParam(r, "channelName")
+	if channelName == "" {
+		respondError(w, http.StatusBadRequest, "Channel name is required")
+		return
+	}
+
+	channel, status, err := s.Notifiers.Get(channelName)
+	if err != nil {
+		if err == notify.ErrChannelNotFound {
+			respondError(w, http.StatusNotFound, "Notification channel not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to get notification channel: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, struct {
+		notify.Channel
+		Status notify.Status `json:"status"`
+	}{channel, status})
+}
+
+// DeleteNotifier handles DELETE /notifiers/{channelName}
+func (s *Server) DeleteNotifier(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	channelName := chi.URLParam(r, "channelName")
+	if channelName == "" {
+		respondError(w, http.StatusBadRequest, "Channel name is required")
+		return
+	}
+
+	if err := s.Notifiers.Delete(channelName); err != nil {
+		if err == notify.ErrChannelNotFound {
+			respondError(w, http.StatusNotFound, "Notification channel not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to delete notification channel: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Notification channel deleted"})
+}
+
+// TestNotifier handles POST /notifiers/{channelName}/test
+func (s *Server) TestNotifier(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	channelName := chi.URLParam(r, "channelName")
+	if channelName == "" {
+		respondError(w, http.StatusBadRequest, "Channel name is required")
+		return
+	}
+
+	if err := s.Notifiers.Test(channelName); err != nil {
+		switch {
+		case err == notify.ErrChannelNotFound:
+			respondError(w, http.StatusNotFound, "Notification channel not found")
+		case err == notify.ErrRateLimited:
+			respondError(w, http.StatusTooManyRequests, "Notification rate limit exceeded")
+		default:
+			respondError(w, http.StatusBadGateway, "Failed to send notification: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Test notification sent"})
+}
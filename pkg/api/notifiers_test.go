@@ -0,0 +1,91 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNotifierManagement(t *testing.T) {
+	server := setupTestServer()
+
+	var received []map[string]string
+	slack := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg map[string]string
+		json.NewDecoder(r.Body).Decode(&msg)
+		received = append(received, msg)
+	}))
+	defer slack.Close()
+
+	create := func(body map[string]interface{}) *httptest.ResponseRecorder {
+		jsonData, _ := json.Marshal(body)
+		req := httptest.NewRequest("POST", "/notifiers", bytes.NewBuffer(jsonData))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		server.CreateNotifier(w, req)
+		return w
+	}
+
+	channel := map[string]interface{}{
+		"name":  "ops",
+		"kind":  "slack",
+		"slack": map[string]string{"webhookUrl": slack.URL},
+	}
+	if w := create(channel); w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	} else if strings.Contains(w.Body.String(), slack.URL) {
+		t.Error("Expected the webhook URL to be redacted")
+	}
+	if w := create(channel); w.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d, got %d", http.StatusConflict, w.Code)
+	}
+	if w := create(map[string]interface{}{"name": "sms", "kind": "sms"}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	req := httptest.NewRequest("POST", "/notifiers/ops/test", nil)
+	req = req.WithContext(setURLParam(req.Context(), "channelName", "ops"))
+	w := httptest.NewRecorder()
+	server.TestNotifier(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if len(received) != 1 || !strings.HasPrefix(received[0]["text"], "notify.test") {
+		t.Errorf("Unexpected Slack messages %v", received)
+	}
+
+	req = httptest.NewRequest("GET", "/notifiers/ops", nil)
+	req = req.WithContext(setURLParam(req.Context(), "channelName", "ops"))
+	w = httptest.NewRecorder()
+	server.GetNotifier(w, req)
+
+	var result struct {
+		Name   string `json:"name"`
+		Status struct {
+			Sent int `json:"sent"`
+		} `json:"status"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if w.Code != http.StatusOK || result.Name != "ops" || result.Status.Sent != 1 {
+		t.Errorf("Unexpected channel %d %+v", w.Code, result)
+	}
+
+	req = httptest.NewRequest("DELETE", "/notifiers/ops", nil)
+	req = req.WithContext(setURLParam(req.Context(), "channelName", "ops"))
+	w = httptest.NewRecorder()
+	server.DeleteNotifier(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/notifiers/ops/test", nil)
+	req = req.WithContext(setURLParam(req.Context(), "channelName", "ops"))
+	w = httptest.NewRecorder()
+	server.TestNotifier(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aleka07/go-digital-twin/pkg/manage"
+	"github.com/aleka07/go-digital-twin/pkg/offline"
+)
+
+// Offline bundle handlers
+
+// ExportOfflineBundle handles POST /offline/export. The optional body selects
+// the twins by ID and query and whether, and which range of, their history is
+// included. The response is the bundle, signed if a signing key is
+// configured.
+func (s *Server) ExportOfflineBundle(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	var opts offline.ExportOptions
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+			return
+		}
+	}
+
+	var bundle bytes.Buffer
+	manifest, err := offline.Export(&bundle, s.Registry, s.History, s.OfflineKeys, opts)
+	if err != nil {
+		if errors.Is(err, offline.ErrInvalidOptions) {
+			respondError(w, http.StatusBadRequest, err.Error())
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to export bundle: "+err.Error())
+		}
+		return
+	}
+
+	filename := "twins-" + manifest.CreatedAt.Format("20060102T150405Z") + ".tar.gz"
+	w.Header().Set("Content-Type", offline.ContentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.WriteHeader(http.StatusOK)
+	w.Write(bundle.Bytes())
+}
+
+// ImportOfflineBundle handles POST /offline/import. The body is a bundle
+// written by ExportOfflineBundle, which is verified before anything is
+// imported. The prefix query parameter prefixes the IDs of the twins, remap
+// parameters of the form old=new rename single twins, onConflict is skip,
+// replace or fail, and dryRun=true reports the changes without applying them.
+func (s *Server) ImportOfflineBundle(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	dryRun, err := manage.ParseDryRun(r.URL.Query().Get("dryRun"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	opts := offline.ImportOptions{
+		Prefix:     r.URL.Query().Get("prefix"),
+		OnConflict: r.URL.Query().Get("onConflict"),
+		DryRun:     dryRun,
+	}
+	for _, remap := range r.URL.Query()["remap"] {
+		from, to, ok := strings.Cut(remap, "=")
+		if !ok || from == "" || to == "" {
+			respondError(w, http.StatusBadRequest, "Invalid remap "+strconv.Quote(remap)+", expected old=new")
+			return
+		}
+		if opts.Remap == nil {
+			opts.Remap = make(map[string]string)
+		}
+		opts.Remap[from] = to
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, offline.MaxSize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			respondError(w, http.StatusRequestEntityTooLarge, "Bundle exceeds "+strconv.Itoa(offline.MaxSize)+" bytes")
+		} else {
+			respondError(w, http.StatusBadRequest, err.Error())
+		}
+		return
+	}
+
+	result, err := offline.Import(bytes.NewReader(data), s.Registry, s.History, s.OfflineKeys, opts)
+	if err != nil {
+		switch {
+		case errors.Is(err, offline.ErrInvalidOptions), errors.Is(err, offline.ErrInvalidBundle):
+			respondError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, offline.ErrUntrusted):
+			respondError(w, http.StatusForbidden, err.Error())
+		case errors.Is(err, offline.ErrConflict):
+			respondError(w, http.StatusConflict, err.Error())
+		default:
+			respondError(w, http.StatusInternalServerError, "Failed to import bundle: "+err.Error())
+		}
+		return
+	}
+
+	// Publish events for the applied changes
+	if !result.DryRun {
+		for _, id := range result.Created {
+			s.PubSub.Publish("twin.created", map[string]string{"id": id})
+		}
+		for _, id := range result.Replaced {
+			s.PubSub.Publish("twin.updated", map[string]string{"id": id})
+		}
+	}
+
+	respondJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/offline"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestOfflineBundle(t *testing.T) {
+	_, key, _ := ed25519.GenerateKey(nil)
+	site := setupTestServer()
+	site.OfflineKeys.Signing = key
+	for _, id := range []string{"pump-1", "valve-1"} {
+		site.Registry.Create(twin.NewDigitalTwin(id, strings.TrimSuffix(id, "-1")))
+		site.History.Record(id, "sensor", "value", 1.0, time.Now())
+	}
+
+	req := httptest.NewRequest("POST", "/offline/export", strings.NewReader(`{"query": "type == pump", "history": true, "source": "site-a"}`))
+	w := httptest.NewRecorder()
+	site.ExportOfflineBundle(w, req)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != offline.ContentType {
+		t.Fatalf("Expected a bundle, got %d %s", w.Code, w.Body.String())
+	}
+	bundle := w.Body.Bytes()
+
+	central := setupTestServer()
+	central.OfflineKeys.Trusted = []ed25519.PublicKey{key.Public().(ed25519.PublicKey)}
+	events := central.PubSub.SubscribeWithBuffer("twin.+", 10)
+
+	req = httptest.NewRequest("POST", "/offline/import?prefix=site-a-&remap=pump-1%3Dsite-a-main-pump", bytes.NewReader(bundle))
+	w = httptest.NewRecorder()
+	central.ImportOfflineBundle(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var result offline.Result
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if !result.Trusted || len(result.Created) != 1 || result.Samples != 1 || result.Manifest.Source != "site-a" {
+		t.Errorf("Unexpected result %+v", result)
+	}
+	if _, err := central.Registry.Get("site-a-main-pump"); err != nil {
+		t.Errorf("Expected the remapped twin: %v", err)
+	}
+	if msg := <-events; msg.Topic != "twin.created" {
+		t.Errorf("Unexpected event %+v", msg)
+	}
+
+	for _, test := range []struct {
+		url  string
+		body []byte
+		code int
+	}{
+		{"/offline/import?onConflict=fail&remap=pump-1%3Dsite-a-main-pump", bundle, http.StatusConflict},
+		{"/offline/import?onConflict=merge", bundle, http.StatusBadRequest},
+		{"/offline/import?remap=pump-1", bundle, http.StatusBadRequest},
+		{"/offline/import", []byte("bundle"), http.StatusBadRequest},
+	} {
+		req := httptest.NewRequest("POST", test.url, bytes.NewReader(test.body))
+		w := httptest.NewRecorder()
+		central.ImportOfflineBundle(w, req)
+		if w.Code != test.code {
+			t.Errorf("%s: expected status code %d, got %d %s", test.url, test.code, w.Code, w.Body.String())
+		}
+	}
+
+	// Bundles of unknown keys are rejected
+	_, other, _ := ed25519.GenerateKey(nil)
+	central.OfflineKeys.Trusted = []ed25519.PublicKey{other.Public().(ed25519.PublicKey)}
+	req = httptest.NewRequest("POST", "/offline/import?prefix=site-b-", bytes.NewReader(bundle))
+	w = httptest.NewRecorder()
+	central.ImportOfflineBundle(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, got %d", http.StatusForbidden, w.Code)
+	}
+}
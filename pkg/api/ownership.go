@@ -0,0 +1,53 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// Ownership of twins and features. The user named by the X-User header of
+// a request is recorded in the system attributes of the twins it creates
+// and changes, and on the features, where clients can read but not write it.
+
+// ownerPath is the query path of the owner of a twin
+const ownerPath = "attributes." + twin.SystemAttribute + "." + twin.SystemOwner
+
+// recordCreator records the user of a request as the owner, creator and
+// last modifier of a new twin
+func recordCreator(r *http.Request, dt *twin.DigitalTwin) {
+	user := r.Header.Get(UserHeader)
+	if user == "" {
+		return
+	}
+	dt.SetSystem(twin.SystemOwner, user)
+	dt.SetSystem(twin.SystemCreatedBy, user)
+	dt.SetSystem(twin.SystemModifiedBy, user)
+	for _, fs := range dt.GetAllFeatures() {
+		fs.SetCreatedBy(user)
+		fs.SetModifiedBy(user)
+	}
+}
+
+// recordModifier records the user of a request as the last modifier of a
+// twin and of the changed features. Without a user the last modifier is
+// cleared rather than left to name someone else.
+func recordModifier(r *http.Request, dt *twin.DigitalTwin, features ...*twin.FeatureState) {
+	user := r.Header.Get(UserHeader)
+	if user == "" {
+		if _, exists := dt.GetSystem(twin.SystemModifiedBy); exists {
+			dt.SetSystem(twin.SystemModifiedBy, nil)
+		}
+	} else {
+		dt.SetSystem(twin.SystemModifiedBy, user)
+	}
+	for _, fs := range features {
+		fs.SetModifiedBy(user)
+	}
+}
+
+// recordFeatureCreator records the user of a request as the creator of a
+// new feature
+func recordFeatureCreator(r *http.Request, fs *twin.FeatureState) {
+	fs.SetCreatedBy(r.Header.Get(UserHeader))
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestOwnership(t *testing.T) {
+	server := setupTestServer()
+
+	serve := func(method, path, user, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if user != "" {
+			req.Header.Set(UserHeader, user)
+		}
+		w := httptest.NewRecorder()
+		server.Router.ServeHTTP(w, req)
+		if w.Code >= 300 {
+			t.Fatalf("%s %s: unexpected status code %d %s", method, path, w.Code, w.Body.String())
+		}
+		return w
+	}
+
+	serve("POST", "/api/v1/twins", "alice", `{"id": "pump-1", "type": "pump"}`)
+	serve("POST", "/api/v1/twins", "bob", `{"id": "pump-2", "type": "pump"}`)
+	serve("PUT", "/api/v1/twins/pump-1/features/motor", "bob", `{"properties": {"speed": 1450}}`)
+	serve("PUT", "/api/v1/twins/pump-1/features/motor/properties/speed", "carol", `1500`)
+
+	dt, _ := server.Registry.Get("pump-1")
+	for key, expected := range map[string]string{twin.SystemOwner: "alice", twin.SystemCreatedBy: "alice", twin.SystemModifiedBy: "carol"} {
+		if v, _ := dt.GetSystem(key); v != expected {
+			t.Errorf("Expected %s %s, got %v", key, expected, v)
+		}
+	}
+
+	var feature Feature
+	json.Unmarshal(serve("GET", "/api/v1/twins/pump-1/features/motor", "", "").Body.Bytes(), &feature)
+	if feature.CreatedBy != "bob" || feature.ModifiedBy != "carol" {
+		t.Errorf("Unexpected feature authors %q and %q", feature.CreatedBy, feature.ModifiedBy)
+	}
+
+	// Changes without a user leave the last modifier unknown
+	serve("PUT", "/api/v1/twins/pump-1/attributes/site", "", `"north"`)
+	dt, _ = server.Registry.Get("pump-1")
+	if v, exists := dt.GetSystem(twin.SystemModifiedBy); exists {
+		t.Errorf("Expected no last modifier, got %v", v)
+	}
+	if v, _ := dt.GetSystem(twin.SystemOwner); v != "alice" {
+		t.Errorf("Expected the owner to be kept, got %v", v)
+	}
+
+	var twins []Twin
+	json.Unmarshal(serve("GET", "/api/v1/twins?owner=bob", "", "").Body.Bytes(), &twins)
+	if len(twins) != 1 || twins[0].ID != "pump-2" {
+		t.Errorf("Expected the twins of bob, got %+v", twins)
+	}
+}
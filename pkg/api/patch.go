@@ -0,0 +1,90 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// Patch semantics of twin updates
+
+// errEmptyType is returned for updates that would leave a twin without a type
+var errEmptyType = errors.New("type cannot be cleared")
+
+// optionalString is a string field of an update that tells an absent field,
+// which leaves the value unchanged, from an explicit null
+type optionalString struct {
+	Set   bool    // The field was present
+	Value *string // Nil for null
+}
+
+// UnmarshalJSON records that the field was present, along with its value
+func (o *optionalString) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	if string(data) == "null" {
+		o.Value = nil
+		return nil
+	}
+	return json.Unmarshal(data, &o.Value)
+}
+
+// cleared reports whether the field asks to clear the value. Null always
+// clears; the empty string only does from API version 1 on, since legacy
+// clients send it to mean unchanged.
+func (o optionalString) cleared(version int) bool {
+	if !o.Set {
+		return false
+	}
+	return o.Value == nil || (*o.Value == "" && version != LegacyAPIVersion)
+}
+
+// twinPatch is the request body of PUT and PATCH /twins/{twinID}, applied
+// with JSON merge patch semantics: absent fields are unchanged, null clears
+// a field and null attribute values remove the attribute
+type twinPatch struct {
+	Type       optionalString         `json:"type"`
+	Definition optionalString         `json:"definition"`
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+// apply changes a twin according to the patch. Patches writing system
+// attributes are rejected before anything is changed.
+func (p twinPatch) apply(dt *twin.DigitalTwin, version int) error {
+	if err := twin.CheckAttributes(p.Attributes); err != nil {
+		return err
+	}
+
+	switch {
+	case p.Type.cleared(version):
+		return errEmptyType
+	case p.Type.Set && *p.Type.Value != "":
+		dt.Type = *p.Type.Value
+	}
+
+	switch {
+	case p.Definition.cleared(version):
+		dt.SetDefinition("")
+	case p.Definition.Set && *p.Definition.Value != "":
+		dt.SetDefinition(*p.Definition.Value)
+	}
+
+	for k, v := range p.Attributes {
+		if v == nil {
+			dt.RemoveAttribute(k)
+		} else {
+			dt.SetAttribute(k, v)
+		}
+	}
+	return nil
+}
+
+// respondPatchError responds with the error of a patch that cannot be applied
+func respondPatchError(w http.ResponseWriter, err error) {
+	if errors.Is(err, twin.ErrReservedAttribute) {
+		respondReservedAttribute(w)
+		return
+	}
+	respondError(w, http.StatusBadRequest, "Type cannot be cleared")
+}
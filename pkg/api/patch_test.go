@@ -0,0 +1,69 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestUpdateTwinPatch(t *testing.T) {
+	server := setupTestServer()
+
+	dt := twin.NewDigitalTwin("pump-1", "pump")
+	dt.SetDefinition("org.example:Pump:1.0")
+	dt.SetAttribute("serial", "P-100")
+	dt.SetAttribute("site", "north")
+	server.Registry.Create(dt)
+
+	update := func(method, path, body string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		server.Router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Absent fields are unchanged; null attributes are removed
+	if code := update("PATCH", "/api/v1/twins/pump-1", `{"attributes": {"serial": null, "rated": 40}}`); code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, code)
+	}
+	got, _ := server.Registry.Get("pump-1")
+	if _, exists := got.GetAttribute("serial"); exists {
+		t.Errorf("Expected the serial attribute to be removed")
+	}
+	if v, _ := got.GetAttribute("site"); v != "north" || got.Type != "pump" || got.GetDefinition() != "org.example:Pump:1.0" {
+		t.Errorf("Expected other fields to be unchanged, got %+v", got)
+	}
+
+	// The empty string keeps the definition on legacy routes but clears it in version 1
+	update("PUT", "/twins/pump-1", `{"definition": ""}`)
+	if got, _ := server.Registry.Get("pump-1"); got.GetDefinition() != "org.example:Pump:1.0" {
+		t.Errorf("Expected legacy routes to keep the definition, got %q", got.GetDefinition())
+	}
+	update("PUT", "/api/v1/twins/pump-1", `{"definition": ""}`)
+	if got, _ := server.Registry.Get("pump-1"); got.GetDefinition() != "" {
+		t.Errorf("Expected the definition to be cleared, got %q", got.GetDefinition())
+	}
+
+	// Null clears on all routes
+	update("PUT", "/twins/pump-1", `{"definition": "org.example:Pump:2.0"}`)
+	update("PUT", "/twins/pump-1", `{"definition": null}`)
+	if got, _ := server.Registry.Get("pump-1"); got.GetDefinition() != "" {
+		t.Errorf("Expected null to clear the definition, got %q", got.GetDefinition())
+	}
+
+	// Twins always have a type
+	for _, body := range []string{`{"type": null}`, `{"type": ""}`} {
+		if code := update("PATCH", "/api/v1/twins/pump-1", body); code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d for %s, got %d", http.StatusBadRequest, body, code)
+		}
+	}
+	if code := update("PUT", "/twins/pump-1", `{"type": "", "attributes": {"site": "south"}}`); code != http.StatusOK {
+		t.Errorf("Expected legacy routes to ignore an empty type, got %d", code)
+	}
+	if got, _ := server.Registry.Get("pump-1"); got.Type != "pump" {
+		t.Errorf("Expected type pump, got %q", got.Type)
+	}
+}
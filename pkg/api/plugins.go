@@ -0,0 +1,59 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/aleka07/go-digital-twin/pkg/plugin"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/go-chi/chi/v5"
+)
+
+// Plugin handlers
+
+// ListPlugins handles GET /plugins
+func (s *Server) ListPlugins(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	respondJSON(w, http.StatusOK, s.Plugins.Names())
+}
+
+// SendCommand handles POST /twins/{twinID}/commands/{commandName}.
+// The command is handled by the first plugin that implements it.
+func (s *Server) SendCommand(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	twinID := chi.URLParam(r, "twinID")
+	commandName := chi.URLParam(r, "commandName")
+
+	if twinID == "" || commandName == "" {
+		respondError(w, http.StatusBadRequest, "Twin ID and Command name are required")
+		return
+	}
+
+	var cmd plugin.Command
+	if err := json.NewDecoder(r.Body).Decode(&cmd); err != nil && err != io.EOF {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	cmd.Name = commandName
+
+	result, err := s.Plugins.Command(twinID, cmd)
+	if err != nil {
+		switch {
+		case err == registry.ErrTwinNotFound:
+			respondError(w, http.StatusNotFound, "Digital twin not found")
+		case errors.Is(err, plugin.ErrUnhandled):
+			respondError(w, http.StatusNotImplemented, "No plugin handles command "+commandName)
+		default:
+			respondError(w, http.StatusInternalServerError, "Command failed: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, result)
+}
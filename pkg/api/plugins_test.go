@@ -0,0 +1,73 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/plugin"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// echoPlugin answers the echo command with its payload
+type echoPlugin struct {
+	plugin.Base
+}
+
+func (echoPlugin) Name() string { return "echo" }
+
+func (echoPlugin) OnCommand(dt *twin.DigitalTwin, cmd plugin.Command) (interface{}, error) {
+	if cmd.Name != "echo" {
+		return nil, plugin.ErrUnhandled
+	}
+	return map[string]interface{}{"twinId": dt.ID, "payload": cmd.Payload}, nil
+}
+
+func TestSendCommand(t *testing.T) {
+	server := setupTestServer()
+	server.Registry.Create(twin.NewDigitalTwin("machine-1", "machine"))
+	server.Plugins.Add(echoPlugin{})
+
+	send := func(twinID, command string, body interface{}) *httptest.ResponseRecorder {
+		jsonData, _ := json.Marshal(body)
+		req := httptest.NewRequest("POST", "/twins/"+twinID+"/commands/"+command, bytes.NewBuffer(jsonData))
+		req = req.WithContext(setURLParam(req.Context(), "twinID", twinID))
+		req = req.WithContext(setURLParam(req.Context(), "commandName", command))
+
+		w := httptest.NewRecorder()
+		server.SendCommand(w, req)
+		return w
+	}
+
+	w := send("machine-1", "echo", map[string]interface{}{"payload": "hello"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var result map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&result)
+	if result["twinId"] != "machine-1" || result["payload"] != "hello" {
+		t.Errorf("Unexpected command result: %v", result)
+	}
+
+	if w := send("machine-1", "reboot", nil); w.Code != http.StatusNotImplemented {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotImplemented, w.Code)
+	}
+
+	if w := send("unknown", "echo", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	// List plugins
+	req := httptest.NewRequest("GET", "/plugins", nil)
+	w = httptest.NewRecorder()
+	server.ListPlugins(w, req)
+
+	var names []string
+	json.NewDecoder(w.Body).Decode(&names)
+	if len(names) != 1 || names[0] != "echo" {
+		t.Errorf("Expected echo plugin, got %v", names)
+	}
+}
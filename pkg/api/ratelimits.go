@@ -0,0 +1,158 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/go-chi/chi/v5"
+)
+
+// Twin event rate limit handlers
+
+// rateLimit is the JSON form of the event rate limit of a twin
+type rateLimit struct {
+	TwinID string                   `json:"twinId"`
+	Events int                      `json:"events"`
+	Window string                   `json:"window"` // Such as "1s"
+	Stats  *messaging_sim.RateStats `json:"stats,omitempty"`
+}
+
+// rateLimiter is implemented by event buses that rate limit the change
+// events of twins, such as messaging_sim.PubSub
+type rateLimiter interface {
+	TwinRateLimits() []messaging_sim.TwinRateLimit
+	TwinRateLimitOf(twinID string) (messaging_sim.TwinRateLimit, bool)
+	SetTwinRateLimit(twinID string, limit messaging_sim.RateLimit) error
+	RemoveTwinRateLimit(twinID string)
+}
+
+// rateLimiter returns the event bus as a rate limiter, responding with 501
+// if it does not rate limit events
+func (s *Server) rateLimiter(w http.ResponseWriter) (rateLimiter, bool) {
+	limiter, ok := s.PubSub.(rateLimiter)
+	if !ok {
+		respondError(w, http.StatusNotImplemented, "The event bus does not support rate limits")
+	}
+	return limiter, ok
+}
+
+// newRateLimit converts a twin rate limit to its JSON form
+func newRateLimit(l messaging_sim.TwinRateLimit) rateLimit {
+	return rateLimit{
+		TwinID: l.TwinID,
+		Events: l.Limit.Events,
+		Window: l.Limit.Window.String(),
+		Stats:  &l.Stats,
+	}
+}
+
+// ListRateLimits handles GET /rate-limits
+func (s *Server) ListRateLimits(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	limiter, ok := s.rateLimiter(w)
+	if !ok {
+		return
+	}
+
+	limits := limiter.TwinRateLimits()
+	result := make([]rateLimit, len(limits))
+	for i, l := range limits {
+		result[i] = newRateLimit(l)
+	}
+	respondJSON(w, http.StatusOK, result)
+}
+
+// GetRateLimit handles GET /twins/{twinID}/rate-limit and includes the
+// counters of published and suppressed events
+func (s *Server) GetRateLimit(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	twinID := chi.URLParam(r, "twinID")
+	if twinID == "" {
+		respondError(w, http.StatusBadRequest, "Twin ID is required")
+		return
+	}
+
+	limiter, ok := s.rateLimiter(w)
+	if !ok {
+		return
+	}
+
+	l, exists := limiter.TwinRateLimitOf(twinID)
+	if !exists {
+		respondError(w, http.StatusNotFound, "Rate limit not found")
+		return
+	}
+	respondJSON(w, http.StatusOK, newRateLimit(l))
+}
+
+// SetRateLimit handles PUT /twins/{twinID}/rate-limit. The twin does not
+// need to exist yet.
+func (s *Server) SetRateLimit(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	twinID := chi.URLParam(r, "twinID")
+	if twinID == "" {
+		respondError(w, http.StatusBadRequest, "Twin ID is required")
+		return
+	}
+
+	var req rateLimit
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	window, err := time.ParseDuration(req.Window)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid window: "+err.Error())
+		return
+	}
+
+	limiter, ok := s.rateLimiter(w)
+	if !ok {
+		return
+	}
+	if err := limiter.SetTwinRateLimit(twinID, messaging_sim.RateLimit{Events: req.Events, Window: window}); err != nil {
+		if err == messaging_sim.ErrInvalidRateLimit {
+			respondError(w, http.StatusBadRequest, "Events and window must be positive")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to set rate limit: "+err.Error())
+		}
+		return
+	}
+
+	l, _ := limiter.TwinRateLimitOf(twinID)
+	respondJSON(w, http.StatusOK, newRateLimit(l))
+}
+
+// DeleteRateLimit handles DELETE /twins/{twinID}/rate-limit. Held events are
+// published immediately.
+func (s *Server) DeleteRateLimit(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	twinID := chi.URLParam(r, "twinID")
+	if twinID == "" {
+		respondError(w, http.StatusBadRequest, "Twin ID is required")
+		return
+	}
+
+	limiter, ok := s.rateLimiter(w)
+	if !ok {
+		return
+	}
+	if _, exists := limiter.TwinRateLimitOf(twinID); !exists {
+		respondError(w, http.StatusNotFound, "Rate limit not found")
+		return
+	}
+
+	limiter.RemoveTwinRateLimit(twinID)
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Rate limit removed"})
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRateLimits(t *testing.T) {
+	server := setupTestServer()
+
+	request := func(method string, body map[string]interface{}) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buf).Encode(body)
+		}
+		req := httptest.NewRequest(method, "/twins/pump-1/rate-limit", &buf)
+		req = req.WithContext(setURLParam(req.Context(), "twinID", "pump-1"))
+		w := httptest.NewRecorder()
+
+		switch method {
+		case "GET":
+			server.GetRateLimit(w, req)
+		case "PUT":
+			server.SetRateLimit(w, req)
+		case "DELETE":
+			server.DeleteRateLimit(w, req)
+		}
+		return w
+	}
+
+	if w := request("GET", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+	if w := request("PUT", map[string]interface{}{"events": 0, "window": "1s"}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w := request("PUT", map[string]interface{}{"events": 1, "window": "often"}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w := request("PUT", map[string]interface{}{"events": 1, "window": "1h"}); w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	for i := 0; i < 3; i++ {
+		server.PubSub.Publish("twin.updated", map[string]string{"id": "pump-1"})
+	}
+
+	var limit rateLimit
+	json.Unmarshal(request("GET", nil).Body.Bytes(), &limit)
+	if limit.Window != "1h0m0s" || limit.Stats == nil || limit.Stats.Published != 1 || limit.Stats.Suppressed != 1 || limit.Stats.Pending != 1 {
+		t.Errorf("Unexpected rate limit %+v %+v", limit, limit.Stats)
+	}
+
+	req := httptest.NewRequest("GET", "/rate-limits", nil)
+	w := httptest.NewRecorder()
+	server.ListRateLimits(w, req)
+
+	var limits []rateLimit
+	json.Unmarshal(w.Body.Bytes(), &limits)
+	if len(limits) != 1 || limits[0].TwinID != "pump-1" {
+		t.Errorf("Expected the rate limit of pump-1, got %+v", limits)
+	}
+
+	if w := request("DELETE", nil); w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if w := request("DELETE", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
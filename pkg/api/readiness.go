@@ -0,0 +1,52 @@
+package api
+
+import (
+	"net/http"
+)
+
+// Readiness handlers
+
+// readiness is the response of GET /ready
+type readiness struct {
+	Ready    bool     `json:"ready"`
+	Pending  []string `json:"pending,omitempty"`  // Critical indexes not covering the stored twins yet
+	EventBus string   `json:"eventBus,omitempty"` // State of the event bus once it is closing
+}
+
+// SetCriticalIndexes sets the paths of the indexes that must cover the
+// twins in the store, as well as those in memory, before the server reports
+// ready. Queries relying on them would miss twins until then.
+func (s *Server) SetCriticalIndexes(paths []string) {
+	s.readyMutex.Lock()
+	defer s.readyMutex.Unlock()
+
+	s.readyIndexes = paths
+}
+
+// Ready handles GET /ready for load balancers and orchestrators. It responds
+// with 503 Service Unavailable until the critical indexes exist and are warm,
+// and once the event bus is closing.
+func (s *Server) Ready(w http.ResponseWriter, r *http.Request) {
+	s.readyMutex.RLock()
+	paths := s.readyIndexes
+	s.readyMutex.RUnlock()
+
+	resp := readiness{Ready: true}
+	for _, path := range paths {
+		if stats, err := s.Registry.Index(path); err != nil || !stats.Warm {
+			resp.Ready = false
+			resp.Pending = append(resp.Pending, path)
+		}
+	}
+
+	if s.PubSub.Err() != nil {
+		resp.Ready = false
+		resp.EventBus = s.PubSub.State().String()
+	}
+
+	if !resp.Ready {
+		respondJSON(w, http.StatusServiceUnavailable, resp)
+		return
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
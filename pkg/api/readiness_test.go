@@ -0,0 +1,52 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/objstore"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestReady(t *testing.T) {
+	server := setupTestServer()
+	store := registry.NewObjectStore(objstore.NewMemoryStore(), "")
+	store.Save(twin.NewDigitalTwin("pump-1", "pump"))
+	server.Registry.SetBudget(registry.Budget{MaxTwins: 10}, store)
+	server.Registry.LoadLazily()
+
+	ready := func() (int, readiness) {
+		w := httptest.NewRecorder()
+		server.Router.ServeHTTP(w, httptest.NewRequest("GET", "/ready", nil))
+		var resp readiness
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+
+	if code, _ := ready(); code != http.StatusOK {
+		t.Errorf("Expected status code %d without critical indexes, got %d", http.StatusOK, code)
+	}
+
+	server.SetCriticalIndexes([]string{"type"})
+	if code, resp := ready(); code != http.StatusServiceUnavailable || len(resp.Pending) != 1 {
+		t.Errorf("Expected the missing index to be pending, got %d %+v", code, resp)
+	}
+	server.Registry.CreateIndex("type")
+	if code, resp := ready(); code != http.StatusServiceUnavailable || resp.Ready {
+		t.Errorf("Expected the cold index to be pending, got %d %+v", code, resp)
+	}
+
+	server.Registry.WarmUp(context.Background())
+	if code, resp := ready(); code != http.StatusOK || !resp.Ready {
+		t.Errorf("Expected the server to be ready, got %d %+v", code, resp)
+	}
+
+	server.PubSub.Close()
+	if code, resp := ready(); code != http.StatusServiceUnavailable || resp.EventBus != "closed" {
+		t.Errorf("Expected the closed event bus to be reported, got %d %+v", code, resp)
+	}
+}
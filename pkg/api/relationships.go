@@ -0,0 +1,126 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+	"github.com/go-chi/chi/v5"
+)
+
+// Relationship handlers
+
+// GetRelationships handles GET /twins/{twinID}/relationships
+func (s *Server) GetRelationships(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	twinID := chi.URLParam(r, "twinID")
+	if twinID == "" {
+		respondError(w, http.StatusBadRequest, "Twin ID is required")
+		return
+	}
+
+	dt, err := s.Twins.Get(twinID)
+	if err != nil {
+		if err == registry.ErrTwinNotFound {
+			respondError(w, http.StatusNotFound, "Digital twin not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to get digital twin: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, dt.GetAllRelationships())
+}
+
+// AddRelationship handles PUT /twins/{twinID}/relationships/{relName}/{targetID}
+func (s *Server) AddRelationship(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	twinID := chi.URLParam(r, "twinID")
+	relName := chi.URLParam(r, "relName")
+	targetID := chi.URLParam(r, "targetID")
+
+	if twinID == "" || relName == "" || targetID == "" {
+		respondError(w, http.StatusBadRequest, "Twin ID, relationship name and target ID are required")
+		return
+	}
+
+	dt, err := s.Twins.Get(twinID)
+	if err != nil {
+		if err == registry.ErrTwinNotFound {
+			respondError(w, http.StatusNotFound, "Digital twin not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to get digital twin: "+err.Error())
+		}
+		return
+	}
+
+	if _, err := s.Twins.Get(targetID); err != nil {
+		respondError(w, http.StatusNotFound, "Target twin not found")
+		return
+	}
+
+	if err := dt.AddRelationship(relName, targetID); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	recordModifier(r, dt)
+	if err := s.Twins.Update(dt); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to update digital twin: "+err.Error())
+		return
+	}
+
+	// Publish event
+	s.PubSub.Publish("twin.updated", map[string]string{"id": dt.ID})
+
+	respondJSON(w, http.StatusOK, dt.GetAllRelationships())
+}
+
+// RemoveRelationship handles DELETE /twins/{twinID}/relationships/{relName}/{targetID}
+func (s *Server) RemoveRelationship(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	twinID := chi.URLParam(r, "twinID")
+	relName := chi.URLParam(r, "relName")
+	targetID := chi.URLParam(r, "targetID")
+
+	if twinID == "" || relName == "" || targetID == "" {
+		respondError(w, http.StatusBadRequest, "Twin ID, relationship name and target ID are required")
+		return
+	}
+
+	dt, err := s.Twins.Get(twinID)
+	if err != nil {
+		if err == registry.ErrTwinNotFound {
+			respondError(w, http.StatusNotFound, "Digital twin not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to get digital twin: "+err.Error())
+		}
+		return
+	}
+
+	if err := dt.RemoveRelationship(relName, targetID); err != nil {
+		if err == twin.ErrRelationshipNotFound {
+			respondError(w, http.StatusNotFound, "Relationship not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to remove relationship: "+err.Error())
+		}
+		return
+	}
+
+	recordModifier(r, dt)
+	if err := s.Twins.Update(dt); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to update digital twin: "+err.Error())
+		return
+	}
+
+	// Publish event
+	s.PubSub.Publish("twin.updated", map[string]string{"id": dt.ID})
+
+	respondJSON(w, http.StatusOK, dt.GetAllRelationships())
+}
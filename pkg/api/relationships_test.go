@@ -0,0 +1,57 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestRelationships(t *testing.T) {
+	server := setupTestServer()
+	server.Registry.Create(twin.NewDigitalTwin("floor-1", "floor"))
+	server.Registry.Create(twin.NewDigitalTwin("sensor-1", "sensor"))
+
+	request := func(method, targetID string, handler http.HandlerFunc) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/twins/floor-1/relationships/contains/"+targetID, nil)
+		ctx := setURLParam(req.Context(), "twinID", "floor-1")
+		ctx = setURLParam(ctx, "relName", "contains")
+		ctx = setURLParam(ctx, "targetID", targetID)
+
+		w := httptest.NewRecorder()
+		handler(w, req.WithContext(ctx))
+		return w
+	}
+
+	if w := request("PUT", "sensor-1", server.AddRelationship); w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	// Targets must exist
+	if w := request("PUT", "unknown", server.AddRelationship); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	dt, _ := server.Registry.Get("floor-1")
+	if targets := dt.GetRelationship("contains"); len(targets) != 1 || targets[0] != "sensor-1" {
+		t.Errorf("Expected relationship to sensor-1, got %v", targets)
+	}
+
+	req := httptest.NewRequest("GET", "/twins/floor-1/relationships", nil)
+	req = req.WithContext(setURLParam(context.Background(), "twinID", "floor-1"))
+	w := httptest.NewRecorder()
+	server.GetRelationships(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	if w := request("DELETE", "sensor-1", server.RemoveRelationship); w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if w := request("DELETE", "sensor-1", server.RemoveRelationship); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/aleka07/go-digital-twin/pkg/auth"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/go-chi/chi/v5"
+)
+
+// RenameTwin handles POST /twins/{twinID}/rename. The body gives the new ID
+// of the twin: {"id": "pump-42"}. The twin and the relationships of other
+// twins to it change atomically; static group lists, rule state, NGSI-LD
+// subscriptions of the entity, history, annotations and attachments then
+// follow the new ID. Share links of the twin are revoked, as they are signed
+// for the old ID. A twin.renamed event gives the old and new ID. Scoped
+// tokens need write access to the new ID as well.
+func (s *Server) RenameTwin(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	twinID := chi.URLParam(r, "twinID")
+	if twinID == "" {
+		respondError(w, http.StatusBadRequest, "Twin ID is required")
+		return
+	}
+
+	var req struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	if req.ID == "" {
+		respondError(w, http.StatusBadRequest, "New twin ID is required")
+		return
+	}
+	if !s.authorizeTwin(w, r, req.ID, auth.VerbWrite) {
+		return
+	}
+
+	referrers, err := s.Registry.Rename(twinID, req.ID)
+	if err != nil {
+		switch {
+		case err == registry.ErrTwinNotFound:
+			respondError(w, http.StatusNotFound, "Digital twin not found")
+		case err == registry.ErrTwinAlreadyExists:
+			respondError(w, http.StatusConflict, "Digital twin already exists")
+		case errors.Is(err, registry.ErrInvalidID):
+			respondError(w, http.StatusBadRequest, err.Error())
+		default:
+			respondError(w, http.StatusInternalServerError, "Failed to rename digital twin: "+err.Error())
+		}
+		return
+	}
+
+	dt, err := s.Twins.Get(req.ID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get renamed digital twin: "+err.Error())
+		return
+	}
+
+	s.History.RenameTwin(twinID, dt.ID)
+	s.Annotations.RenameTwin(twinID, dt.ID)
+	s.Shares.RevokeTwin(twinID)
+	s.Groups.RenameTwin(twinID, dt.ID)
+	s.Access.RenameTwin(twinID, dt.ID)
+	s.Scripts.RenameTwin(twinID, dt.ID)
+	s.NGSILD.RenameTwin(twinID, dt)
+	attachmentErr := s.Attachments.RenameTwin(r.Context(), twinID, dt.ID)
+
+	// Publish events
+	for _, id := range referrers {
+		s.PubSub.Publish("twin.updated", map[string]string{"id": id})
+	}
+	s.PubSub.Publish("twin.renamed", map[string]string{"oldId": twinID, "newId": dt.ID})
+
+	if attachmentErr != nil {
+		respondError(w, http.StatusInternalServerError, "Renamed digital twin, but failed to move its attachments: "+attachmentErr.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, twinBody(r, dt))
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/annotation"
+	"github.com/aleka07/go-digital-twin/pkg/group"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestRenameTwin(t *testing.T) {
+	server := setupTestServer()
+	events := server.PubSub.Subscribe("twin.renamed")
+
+	serve := serveFunc(server, APIPrefix)
+
+	serve("POST", "/twins", `{"id": "pump-1", "type": "pump"}`)
+	serve("POST", "/twins", `{"id": "line-1", "type": "line"}`)
+	serve("PUT", "/twins/line-1/relationships/feeds/pump-1", "")
+	server.Groups.Create(group.Definition{Name: "north", Twins: []string{"pump-1"}})
+	server.History.Record("pump-1", "motor", "rpm", 1450.0, time.Now())
+	server.Annotations.Add(annotation.Annotation{TwinID: "pump-1", Author: "alice", Text: "bearing replaced"})
+
+	w := serve("POST", "/twins/pump-1/rename", `{"id": "pump-42"}`)
+	var renamed Twin
+	json.Unmarshal(w.Body.Bytes(), &renamed)
+	if w.Code != http.StatusOK || renamed.ID != "pump-42" || renamed.Type != "pump" {
+		t.Fatalf("Failed to rename twin: %d %s", w.Code, w.Body.String())
+	}
+
+	select {
+	case msg := <-events:
+		if payload := msg.Payload.(map[string]string); payload["oldId"] != "pump-1" || payload["newId"] != "pump-42" {
+			t.Errorf("Unexpected event %v", msg.Payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected a twin.renamed event")
+	}
+
+	if w := serve("GET", "/twins/pump-1", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected pump-1 to be gone, got %d", w.Code)
+	}
+	line, _ := server.Registry.Get("line-1")
+	if feeds := line.GetRelationship("feeds"); !reflect.DeepEqual(feeds, []string{"pump-42"}) {
+		t.Errorf("Expected line-1 to feed pump-42, got %v", feeds)
+	}
+	if groups := server.Groups.GroupsOf("pump-42"); !reflect.DeepEqual(groups, []string{"north"}) {
+		t.Errorf("Expected pump-42 in the group of pump-1, got %v", groups)
+	}
+	if props := server.History.Properties("pump-42"); len(props) != 1 {
+		t.Errorf("Expected the history of pump-1 for pump-42, got %v", props)
+	}
+	if notes := server.Annotations.List("pump-42", annotation.Filter{}); len(notes) != 1 {
+		t.Errorf("Expected the annotation of pump-1 on pump-42, got %v", notes)
+	}
+
+	server.Registry.Create(twin.NewDigitalTwin("pump-2", "pump"))
+	for _, tc := range []struct {
+		path, body string
+		code       int
+	}{
+		{"/twins/pump-1/rename", `{"id": "pump-3"}`, http.StatusNotFound},
+		{"/twins/pump-42/rename", `{"id": "pump-2"}`, http.StatusConflict},
+		{"/twins/pump-42/rename", `{"id": "pump-42"}`, http.StatusBadRequest},
+		{"/twins/pump-42/rename", `{}`, http.StatusBadRequest},
+		{"/twins/pump-42/rename", `{"id": `, http.StatusBadRequest},
+	} {
+		if w := serve("POST", tc.path, tc.body); w.Code != tc.code {
+			t.Errorf("%s %s: expected status code %d, got %d %s", tc.path, tc.body, tc.code, w.Code, w.Body.String())
+		}
+	}
+}
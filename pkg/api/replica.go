@@ -0,0 +1,52 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Read replica handlers
+
+// replicaReads are the POST routes that only read, which replicas serve
+var replicaReads = map[string]bool{
+	"/twins/query/explain":    true,
+	"/twins/read-transaction": true,
+	"/history/query":          true,
+	"/graph/query":            true,
+}
+
+// readOnly rejects writes while the server is a read replica, since its
+// registry only follows the primary's
+func (s *Server) readOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.Replica == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		case http.MethodPost:
+			if replicaReads[strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, APIPrefix), "/")] {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		respondError(w, http.StatusForbidden, "This server is a read replica; send writes to the primary at "+s.Replica.Primary())
+	})
+}
+
+// GetReplicaStatus handles GET /admin/replica
+func (s *Server) GetReplicaStatus(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	if s.Replica == nil {
+		respondError(w, http.StatusServiceUnavailable, "The server is not a read replica")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, s.Replica.Status())
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/replica"
+)
+
+func TestReplica(t *testing.T) {
+	primary := setupTestServer()
+	primaryServer := httptest.NewServer(primary.Router)
+	defer primaryServer.Close()
+	defer primary.Shutdown(context.Background())
+
+	reg := registry.NewRegistry()
+	server := NewServer(reg, messaging_sim.NewPubSub())
+	var err error
+	server.Replica, err = replica.New(reg, server.PubSub, server.History, replica.Options{Primary: primaryServer.URL + APIPrefix})
+	if err != nil {
+		t.Fatalf("Failed to create replica: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go server.Replica.Run(ctx)
+
+	serve := func(target *Server, method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, APIPrefix+path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		target.Router.ServeHTTP(w, req)
+		return w
+	}
+	waitFor := func(what string, cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("Timed out waiting for %s", what)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	serve(primary, "POST", "/twins", `{"id": "pump-1", "type": "pump", "attributes": {"site": "north"}}`)
+	serve(primary, "PUT", "/twins/pump-1/features/motor", `{"properties": {}}`)
+	serve(primary, "POST", "/twins", `{"id": "pump-2", "type": "pump"}`)
+	waitFor("the twins to be copied", func() bool { return reg.Count() == 2 })
+
+	// Changes committed on the primary are followed
+	if w := serve(primary, "PUT", "/twins/pump-1/features/motor/properties/rpm", `1450`); w.Code >= 300 {
+		t.Fatalf("Failed to update the primary: %d %s", w.Code, w.Body.String())
+	}
+	serve(primary, "DELETE", "/twins/pump-2", "")
+	waitFor("the changes to be followed", func() bool {
+		_, err := reg.Get("pump-2")
+		return err == registry.ErrTwinNotFound && len(server.History.Query("pump-1", "motor", "rpm", time.Time{}, time.Time{})) == 1
+	})
+
+	w := serve(server, "GET", "/twins?query=attributes.site+%3D%3D+north", "")
+	var twins []Twin
+	json.Unmarshal(w.Body.Bytes(), &twins)
+	if len(twins) != 1 || twins[0].ID != "pump-1" || twins[0].Features["motor"].Properties["rpm"] != 1450.0 {
+		t.Errorf("Expected pump-1 from the replica, got %s", w.Body.String())
+	}
+	if w := serve(server, "POST", "/twins/query/explain", `{"query": "type == pump"}`); w.Code != http.StatusOK {
+		t.Errorf("Expected the replica to explain queries, got %d %s", w.Code, w.Body.String())
+	}
+
+	// Writes are rejected
+	for _, path := range []string{"/twins", "/twins/pump-1/attributes/site"} {
+		if w := serve(server, "PUT", path, `"south"`); w.Code != http.StatusForbidden {
+			t.Errorf("%s: expected status code %d, got %d", path, http.StatusForbidden, w.Code)
+		}
+	}
+
+	w = serve(server, "GET", "/admin/replica", "")
+	var status replica.Status
+	json.Unmarshal(w.Body.Bytes(), &status)
+	if w.Code != http.StatusOK || !status.Connected || status.Twins != 1 || status.Copies != 1 {
+		t.Errorf("Unexpected replica status %d %s", w.Code, w.Body.String())
+	}
+	if w := serve(primary, "GET", "/admin/replica", ""); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code %d on the primary, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+}
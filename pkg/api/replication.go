@@ -0,0 +1,159 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+)
+
+// Replication log handlers
+
+// Limits of the number of changes in a replication log response
+const (
+	defaultReplicationLimit = 1000
+	maxReplicationLimit     = 10000
+)
+
+// replicationLog is the response of GET /replication/log
+type replicationLog struct {
+	registry.LogInfo
+	Next    uint64              `json:"next"` // Sequence number to read from next
+	Changes []replicationChange `json:"changes"`
+}
+
+// replicationChange is a change of the replication log
+type replicationChange struct {
+	Seq       uint64      `json:"seq"`
+	Op        string      `json:"op"`
+	TwinID    string      `json:"twinId"`
+	Twin      interface{} `json:"twin,omitempty"`
+	Timestamp time.Time   `json:"timestamp"`
+}
+
+// GetReplicationLog handles GET /replication/log?from=seq&limit=n. It returns
+// the registry changes after sequence number from, which is the registry
+// version they were committed at. The log is compacted to the latest change
+// of each twin, so reading from 0 yields every twin, and puts carry the twin
+// as it is now. Readers behind the compacted sequence number may have missed
+// deletions and get 410 Gone; they must read from 0 again.
+//
+// With Accept: text/event-stream the changes are streamed as server-sent
+// events named after their operation, with the sequence number as event ID,
+// and new changes follow as they are committed. Streams resume from the
+// Last-Event-ID header when from is not given, and end with a reset event
+// when the reader falls behind compaction.
+func (s *Server) GetReplicationLog(w http.ResponseWriter, r *http.Request) {
+	var from uint64
+	raw := r.URL.Query().Get("from")
+	if raw == "" {
+		raw = r.Header.Get("Last-Event-ID")
+	}
+	if raw != "" {
+		var err error
+		if from, err = strconv.ParseUint(raw, 10, 64); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid from: "+raw)
+			return
+		}
+	}
+
+	limit := defaultReplicationLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		var err error
+		if limit, err = strconv.Atoi(raw); err != nil || limit <= 0 || limit > maxReplicationLimit {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("Invalid limit: %s, expected 1 to %d", raw, maxReplicationLimit))
+			return
+		}
+	}
+
+	if isEventStream(r) {
+		s.streamReplicationLog(w, r, from)
+		return
+	}
+
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	changes, info := s.Registry.Changes(from, limit)
+	if from > 0 && from < info.Compacted {
+		respondError(w, http.StatusGone, fmt.Sprintf("Changes after %d were compacted; read from 0 again", from))
+		return
+	}
+
+	resp := replicationLog{LogInfo: info, Next: info.Seq, Changes: make([]replicationChange, 0, len(changes))}
+	for _, change := range changes {
+		resp.Changes = append(resp.Changes, s.replicationChange(r, change))
+	}
+	if len(changes) >= limit {
+		resp.Next = changes[len(changes)-1].Seq
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// streamReplicationLog streams the changes after from as server-sent events.
+// Like other event streams it is not counted as an in-flight request.
+func (s *Server) streamReplicationLog(w http.ResponseWriter, r *http.Request, from uint64) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		respondError(w, http.StatusInternalServerError, "Streaming is not supported")
+		return
+	}
+	if info := s.Registry.LogInfo(); from > 0 && from < info.Compacted {
+		respondError(w, http.StatusGone, fmt.Sprintf("Changes after %d were compacted; read from 0 again", from))
+		return
+	}
+
+	w.Header().Set("Content-Type", eventStreamType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	keepAlive := time.NewTicker(watchKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		changes, info := s.Registry.Changes(from, maxReplicationLimit)
+		if from > 0 && from < info.Compacted {
+			writeEvent(w, "reset", info)
+			flusher.Flush()
+			return
+		}
+		for _, change := range changes {
+			fmt.Fprintf(w, "id: %d\n", change.Seq)
+			writeEvent(w, change.Op, s.replicationChange(r, change))
+		}
+		if len(changes) >= maxReplicationLimit {
+			from = changes[len(changes)-1].Seq
+			flusher.Flush()
+			continue
+		}
+		from = info.Seq
+		flusher.Flush()
+
+		wait := s.Registry.WaitChanges(from)
+		for waiting := true; waiting; {
+			select {
+			case <-wait:
+				waiting = false
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+				flusher.Flush()
+			case <-r.Context().Done():
+				return
+			case <-s.closing:
+				return
+			}
+		}
+	}
+}
+
+// replicationChange returns the representation of a change
+func (s *Server) replicationChange(r *http.Request, change registry.Change) replicationChange {
+	c := replicationChange{Seq: change.Seq, Op: change.Op, TwinID: change.TwinID, Timestamp: change.Timestamp}
+	if change.Twin != nil {
+		c.Twin = twinBody(r, change.Twin)
+	}
+	return c
+}
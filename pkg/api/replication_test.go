@@ -0,0 +1,87 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestGetReplicationLog(t *testing.T) {
+	server := setupTestServer()
+	for _, id := range []string{"pump-1", "pump-2", "pump-3"} {
+		server.Registry.Create(twin.NewDigitalTwin(id, "pump"))
+	}
+	server.Registry.Delete("pump-2")
+
+	read := func(url string) replicationLog {
+		req := httptest.NewRequest("GET", url, nil)
+		w := httptest.NewRecorder()
+		server.GetReplicationLog(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		var resp replicationLog
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp
+	}
+
+	resp := read("/replication/log?limit=2")
+	if len(resp.Changes) != 2 || resp.Changes[0].TwinID != "pump-1" || resp.Changes[0].Twin == nil || resp.Next != 3 {
+		t.Errorf("Unexpected first page %+v", resp)
+	}
+	resp = read("/replication/log?from=3")
+	if len(resp.Changes) != 1 || resp.Changes[0].Op != "delete" || resp.Changes[0].Twin != nil || resp.Next != 4 || resp.Seq != 4 {
+		t.Errorf("Unexpected second page %+v", resp)
+	}
+
+	for _, url := range []string{"/replication/log?from=-1", "/replication/log?limit=0", "/replication/log?limit=100000"} {
+		req := httptest.NewRequest("GET", url, nil)
+		w := httptest.NewRecorder()
+		server.GetReplicationLog(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status code %d, got %d", url, http.StatusBadRequest, w.Code)
+		}
+	}
+}
+
+func TestStreamReplicationLog(t *testing.T) {
+	server := setupTestServer()
+	server.Registry.Create(twin.NewDigitalTwin("pump-1", "pump"))
+	server.Registry.Create(twin.NewDigitalTwin("pump-2", "pump"))
+	ts := httptest.NewServer(server.Router)
+	defer ts.Close()
+
+	req, _ := http.NewRequest("GET", ts.URL+"/api/v1/replication/log", nil)
+	req.Header.Set("Accept", eventStreamType)
+	req.Header.Set("Last-Event-ID", "1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	lines := bufio.NewScanner(resp.Body)
+	next := func() string {
+		var event []string
+		for lines.Scan() && lines.Text() != "" {
+			if !strings.HasPrefix(lines.Text(), ":") {
+				event = append(event, lines.Text())
+			}
+		}
+		return strings.Join(event, "|")
+	}
+
+	if event := next(); !strings.HasPrefix(event, "id: 2|event: put|") || !strings.Contains(event, `"twinId":"pump-2"`) {
+		t.Errorf("Expected the backlog after the last event ID, got %s", event)
+	}
+
+	server.Registry.Delete("pump-1")
+	if event := next(); !strings.HasPrefix(event, "id: 3|event: delete|") {
+		t.Errorf("Expected the new change, got %s", event)
+	}
+}
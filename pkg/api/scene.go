@@ -0,0 +1,159 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// 3D scene reference handlers
+
+// sceneNode is a feature bound to a node of a twin's model, with the live
+// values frontends bind to the geometry
+type sceneNode struct {
+	Node       string                 `json:"node"`
+	Matrix     [16]float64            `json:"matrix"` // Offset from the node, column-major
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// sceneTwin is a twin placed in a scene
+type sceneTwin struct {
+	TwinID   string               `json:"twinId"`
+	Type     string               `json:"type"`
+	Model    string               `json:"model"`
+	Node     string               `json:"node,omitempty"`
+	Matrix   [16]float64          `json:"matrix"` // Placement of the model, column-major
+	Features map[string]sceneNode `json:"features"`
+}
+
+// GetTwinScene handles GET /twins/{twinID}/scene
+func (s *Server) GetTwinScene(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	dt, ok := s.getTwin(w, r)
+	if !ok {
+		return
+	}
+
+	scene := dt.GetScene()
+	if scene == nil {
+		respondError(w, http.StatusNotFound, "Digital twin has no scene reference")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, scene)
+}
+
+// SetTwinScene handles PUT /twins/{twinID}/scene. Feature bindings may name
+// features the twin does not have yet; they are left out of the scene until
+// the features are added.
+func (s *Server) SetTwinScene(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	var scene twin.SceneReference
+	if err := json.NewDecoder(r.Body).Decode(&scene); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	if err := scene.Validate(); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	dt, ok := s.getTwin(w, r)
+	if !ok {
+		return
+	}
+
+	dt.SetScene(&scene)
+	recordModifier(r, dt)
+	s.updateScene(w, dt)
+}
+
+// DeleteTwinScene handles DELETE /twins/{twinID}/scene
+func (s *Server) DeleteTwinScene(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	dt, ok := s.getTwin(w, r)
+	if !ok {
+		return
+	}
+
+	if dt.GetScene() == nil {
+		respondError(w, http.StatusNotFound, "Digital twin has no scene reference")
+		return
+	}
+
+	dt.SetScene(nil)
+	recordModifier(r, dt)
+	s.updateScene(w, dt)
+}
+
+// updateScene stores a twin whose scene reference changed
+func (s *Server) updateScene(w http.ResponseWriter, dt *twin.DigitalTwin) {
+	if err := s.Twins.Update(dt); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to update digital twin: "+err.Error())
+		return
+	}
+
+	// Publish event
+	s.PubSub.Publish("twin.updated", map[string]string{"id": dt.ID})
+
+	if scene := dt.GetScene(); scene != nil {
+		respondJSON(w, http.StatusOK, scene)
+	} else {
+		respondJSON(w, http.StatusOK, map[string]string{"message": "Scene reference deleted"})
+	}
+}
+
+// GetScene handles GET /scene. It returns the twins with a scene reference,
+// optionally selected by a group or query parameter, with their transforms
+// as matrices and the current properties of their bound features, so that a
+// frontend can build the scene in one request and then follow
+// /twins/watch for changes.
+func (s *Server) GetScene(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	twins, ok := s.selectTwins(w, r.URL.Query().Get("group"), r.URL.Query().Get("query"))
+	if !ok {
+		return
+	}
+
+	result := []sceneTwin{}
+	for _, dt := range twins {
+		scene := dt.GetScene()
+		if scene == nil {
+			continue
+		}
+
+		placed := sceneTwin{
+			TwinID:   dt.ID,
+			Type:     dt.Type,
+			Model:    scene.Model,
+			Node:     scene.Node,
+			Matrix:   scene.Transform.Matrix(),
+			Features: make(map[string]sceneNode, len(scene.Features)),
+		}
+		for id, binding := range scene.Features {
+			feature, exists := dt.GetFeature(id)
+			if !exists {
+				continue
+			}
+			placed.Features[id] = sceneNode{
+				Node:       binding.Node,
+				Matrix:     binding.Transform.Matrix(),
+				Properties: feature.GetAllProperties(),
+			}
+		}
+		result = append(result, placed)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].TwinID < result[j].TwinID })
+	respondJSON(w, http.StatusOK, result)
+}
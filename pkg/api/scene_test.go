@@ -0,0 +1,77 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestSceneRoutes(t *testing.T) {
+	server := setupTestServer()
+	robot := twin.NewDigitalTwin("robot-1", "robot")
+	arm := twin.NewFeatureState()
+	arm.SetProperty("angle", 42.0)
+	robot.AddFeature("arm", arm)
+	server.Registry.Create(robot)
+	server.Registry.Create(twin.NewDigitalTwin("robot-2", "robot"))
+
+	serve := serveFunc(server, "")
+
+	if w := serve("GET", "/twins/robot-1/scene", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d without a scene, got %d", http.StatusNotFound, w.Code)
+	}
+	if w := serve("PUT", "/twins/robot-1/scene", `{"model": "robot.glb"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for a relative model, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w := serve("PUT", "/twins/missing/scene", `{"model": "https://cdn/robot.glb"}`); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d for a missing twin, got %d", http.StatusNotFound, w.Code)
+	}
+
+	w := serve("PUT", "/twins/robot-1/scene", `{
+		"model": "https://cdn/robot.glb",
+		"node": "Robot",
+		"transform": {"translation": [4, 0, 1]},
+		"features": {"arm": {"node": "Arm_01"}, "gripper": {"node": "Gripper"}}
+	}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	// The scene is part of the twin
+	w = serve("GET", "/api/v1/twins/robot-1", "")
+	var body Twin
+	json.NewDecoder(w.Body).Decode(&body)
+	if body.Scene == nil || body.Scene.Features["arm"].Node != "Arm_01" {
+		t.Errorf("Expected the twin to carry its scene, got %+v", body.Scene)
+	}
+
+	// Only twins with a scene are placed, with live values of existing features
+	w = serve("GET", "/scene?query="+url.QueryEscape("type == robot"), "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var placed []sceneTwin
+	json.NewDecoder(w.Body).Decode(&placed)
+	if len(placed) != 1 || placed[0].TwinID != "robot-1" {
+		t.Fatalf("Expected robot-1 to be placed, got %+v", placed)
+	}
+	if placed[0].Matrix[12] != 4 || placed[0].Matrix[15] != 1 {
+		t.Errorf("Unexpected placement %v", placed[0].Matrix)
+	}
+	if f, ok := placed[0].Features["arm"]; !ok || f.Node != "Arm_01" || f.Properties["angle"] != 42.0 {
+		t.Errorf("Expected the arm with its angle, got %+v", placed[0].Features)
+	}
+	if _, ok := placed[0].Features["gripper"]; ok {
+		t.Error("Expected the gripper to be left out until the feature exists")
+	}
+
+	if w := serve("DELETE", "/twins/robot-1/scene", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if w := serve("DELETE", "/twins/robot-1/scene", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d after deleting, got %d", http.StatusNotFound, w.Code)
+	}
+}
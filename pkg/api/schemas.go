@@ -0,0 +1,111 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/aleka07/go-digital-twin/pkg/schema"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+	"github.com/go-chi/chi/v5"
+)
+
+// Twin type schema handlers
+
+// ListSchemas handles GET /schemas
+func (s *Server) ListSchemas(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	respondJSON(w, http.StatusOK, s.Schemas.List())
+}
+
+// GetSchema handles GET /schemas/{twinType}
+func (s *Server) GetSchema(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	sc, err := s.Schemas.Get(chi.URLParam(r, "twinType"))
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Schema not found")
+		return
+	}
+	respondJSON(w, http.StatusOK, sc)
+}
+
+// SetSchema handles PUT /schemas/{twinType}. Twins are checked against it
+// as they are written, not when it is set.
+func (s *Server) SetSchema(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	twinType := chi.URLParam(r, "twinType")
+	if twinType == "" {
+		respondError(w, http.StatusBadRequest, "Twin type is required")
+		return
+	}
+
+	var sc schema.Schema
+	if err := json.NewDecoder(r.Body).Decode(&sc); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	// Use the type from the URL
+	sc.Type = twinType
+
+	if err := s.Schemas.Set(sc); err != nil {
+		if errors.Is(err, schema.ErrInvalidSchema) {
+			respondError(w, http.StatusBadRequest, err.Error())
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to set schema: "+err.Error())
+		}
+		return
+	}
+
+	sc, _ = s.Schemas.Get(twinType)
+	respondJSON(w, http.StatusOK, sc)
+}
+
+// DeleteSchema handles DELETE /schemas/{twinType}
+func (s *Server) DeleteSchema(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	if err := s.Schemas.Delete(chi.URLParam(r, "twinType")); err != nil {
+		if err == schema.ErrSchemaNotFound {
+			respondError(w, http.StatusNotFound, "Schema not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to delete schema: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Schema deleted"})
+}
+
+// checkSchema checks a twin about to be written against the schema of its
+// type. Violations of a Strict schema are answered with 422 Unprocessable
+// Entity and false. Those of a Warn schema are recorded in the system
+// metadata of the twin, replacing the warnings of its last write, and
+// returned to be published once the write commits.
+func (s *Server) checkSchema(w http.ResponseWriter, dt *twin.DigitalTwin) ([]schema.Violation, bool) {
+	violations, err := s.Schemas.Validate(dt)
+	if err != nil {
+		respondJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+			"error":      "Digital twin violates the schema of type " + dt.Type,
+			"violations": violations,
+		})
+		return nil, false
+	}
+	return violations, true
+}
+
+// publishSchemaWarnings publishes the violations of a twin written under a
+// Warn schema
+func (s *Server) publishSchemaWarnings(twinID string, violations []schema.Violation) {
+	if len(violations) == 0 {
+		return
+	}
+	s.PubSub.Publish(schema.WarningTopic, schema.Warning(twinID, violations))
+}
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/schema"
+)
+
+func TestSchemaValidation(t *testing.T) {
+	server := setupTestServer()
+	warnings := server.PubSub.Subscribe(schema.WarningTopic)
+
+	serve := serveFunc(server, APIPrefix)
+
+	w := serve("PUT", "/schemas/pump", `{"attributes": {"site": {"type": "string", "required": true}}, "features": {"motor": {"properties": {"rpm": {"type": "number", "min": 0}}}}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Failed to set schema: %d %s", w.Code, w.Body.String())
+	}
+
+	// Strict schemas reject writes violating them
+	if w := serve("POST", "/twins", `{"id": "pump-1", "type": "pump"}`); w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), "attributes.site") {
+		t.Errorf("Expected the twin to be rejected, got %d %s", w.Code, w.Body.String())
+	}
+	serve("POST", "/twins", `{"id": "pump-1", "type": "pump", "attributes": {"site": "north"}}`)
+	if w := serve("PUT", "/twins/pump-1/features/motor", `{"properties": {"rpm": -5}}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected the property to be rejected, got %d %s", w.Code, w.Body.String())
+	}
+	if props := server.History.Properties("pump-1"); len(props) != 0 {
+		t.Errorf("Expected rejected values to stay out of the history, got %v", props)
+	}
+
+	// Rejected writes leave the twin as it was
+	for _, tc := range []struct{ method, path, body string }{
+		{"PUT", "/twins/pump-1/attributes/site", `42`},
+		{"PUT", "/twins/pump-1/attributes", `{"site": null}`},
+		{"DELETE", "/twins/pump-1/attributes/site", ""},
+		{"PATCH", "/twins/pump-1", `{"attributes": {"site": null}}`},
+	} {
+		if w := serve(tc.method, tc.path, tc.body); w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("%s %s: expected status code %d, got %d %s", tc.method, tc.path, http.StatusUnprocessableEntity, w.Code, w.Body.String())
+		}
+		if w := serve("GET", "/twins/pump-1/attributes/site", ""); w.Body.String() != `"north"`+"\n" {
+			t.Errorf("%s %s: expected site north after the rejection, got %d %s", tc.method, tc.path, w.Code, w.Body.String())
+		}
+	}
+	if w := serve("GET", "/twins/pump-1/features/motor", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected the rejected feature not to be added, got %d %s", w.Code, w.Body.String())
+	}
+
+	// Warn schemas record violations on the twin and publish them
+	serve("PUT", "/schemas/pump", `{"mode": "warn", "attributes": {"site": {"type": "string", "required": true}}}`)
+	if w := serve("PUT", "/twins/pump-1/attributes/site", `42`); w.Code != http.StatusOK {
+		t.Fatalf("Expected the attribute to be written, got %d %s", w.Code, w.Body.String())
+	}
+	select {
+	case msg := <-warnings:
+		payload := msg.Payload.(map[string]interface{})
+		if violations := payload["violations"].([]schema.Violation); payload["twinId"] != "pump-1" || len(violations) != 1 || violations[0].Path != "attributes.site" {
+			t.Errorf("Unexpected event %v", msg.Payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected a schema warning")
+	}
+	pump, _ := server.Registry.Get("pump-1")
+	if recorded, _ := pump.GetSystem(schema.WarningsKey); len(recorded.([]interface{})) != 1 {
+		t.Errorf("Expected the warning to be recorded, got %v", recorded)
+	}
+
+	// A write that conforms clears the warnings
+	serve("PUT", "/twins/pump-1/attributes/site", `"north"`)
+	pump, _ = server.Registry.Get("pump-1")
+	if recorded, warned := pump.GetSystem(schema.WarningsKey); warned {
+		t.Errorf("Expected the warnings to be cleared, got %v", recorded)
+	}
+
+	for _, tc := range []struct {
+		method, path, body string
+		code               int
+	}{
+		{"GET", "/schemas/pump", "", http.StatusOK},
+		{"GET", "/schemas/valve", "", http.StatusNotFound},
+		{"PUT", "/schemas/pump", `{"mode": "lenient"}`, http.StatusBadRequest},
+		{"PUT", "/schemas/pump", `{"mode": `, http.StatusBadRequest},
+		{"DELETE", "/schemas/pump", "", http.StatusOK},
+		{"DELETE", "/schemas/pump", "", http.StatusNotFound},
+	} {
+		if w := serve(tc.method, tc.path, tc.body); w.Code != tc.code {
+			t.Errorf("%s %s: expected status code %d, got %d %s", tc.method, tc.path, tc.code, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestSchemaValidationTelemetryAndDeletes(t *testing.T) {
+	server := setupTestServer()
+	warnings := server.PubSub.Subscribe(schema.WarningTopic)
+
+	serve := serveFunc(server, APIPrefix)
+
+	serve("POST", "/twins", `{"id": "valve-1", "type": "valve"}`)
+	if w := serve("PUT", "/twins/valve-1/features/actuator", `{"properties": {"position": 10}}`); w.Code != http.StatusOK {
+		t.Fatalf("Failed to set feature: %d %s", w.Code, w.Body.String())
+	}
+	serve("PUT", "/schemas/valve", `{"features": {"actuator": {"required": true, "properties": {"position": {"type": "number", "min": 0, "required": true}}}}}`)
+
+	// Telemetry, feature and property deletes are rejected like other writes
+	for _, tc := range []struct{ method, path, body string }{
+		{"POST", "/twins/valve-1/telemetry", `{"features": {"actuator": {"position": -5}}}`},
+		{"DELETE", "/twins/valve-1/features/actuator", ""},
+		{"DELETE", "/twins/valve-1/features/actuator/properties/position", ""},
+	} {
+		if w := serve(tc.method, tc.path, tc.body); w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("%s %s: expected status code %d, got %d %s", tc.method, tc.path, http.StatusUnprocessableEntity, w.Code, w.Body.String())
+		}
+		if w := serve("GET", "/twins/valve-1/features/actuator/properties/position", ""); w.Body.String() != "10\n" {
+			t.Errorf("%s %s: expected position 10 after the rejection, got %d %s", tc.method, tc.path, w.Code, w.Body.String())
+		}
+	}
+	if samples := server.History.Query("valve-1", "actuator", "position", time.Time{}, time.Now().Add(time.Minute)); len(samples) != 1 {
+		t.Errorf("Expected rejected telemetry to stay out of the history, got %v", samples)
+	}
+
+	// Telemetry violating a Warn schema is stored with warnings
+	serve("PUT", "/schemas/valve", `{"mode": "warn", "features": {"actuator": {"required": true, "properties": {"position": {"type": "number", "min": 0}}}}}`)
+	if w := serve("POST", "/twins/valve-1/telemetry", `{"features": {"actuator": {"position": -5}}}`); w.Code != http.StatusOK {
+		t.Fatalf("Expected the telemetry to be stored, got %d %s", w.Code, w.Body.String())
+	}
+	select {
+	case msg := <-warnings:
+		payload := msg.Payload.(map[string]interface{})
+		if violations := payload["violations"].([]schema.Violation); payload["twinId"] != "valve-1" || len(violations) != 1 || violations[0].Path != "features.actuator.properties.position" {
+			t.Errorf("Unexpected event %v", msg.Payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected a schema warning")
+	}
+	valve, _ := server.Registry.Get("valve-1")
+	if recorded, _ := valve.GetSystem(schema.WarningsKey); len(recorded.([]interface{})) != 1 {
+		t.Errorf("Expected the warning to be recorded, got %v", recorded)
+	}
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/aleka07/go-digital-twin/pkg/script"
+	"github.com/go-chi/chi/v5"
+)
+
+// Script management handlers
+
+// CreateScript handles POST /scripts
+func (s *Server) CreateScript(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	var req script.Script
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	if err := s.Scripts.Create(req); err != nil {
+		switch {
+		case errors.Is(err, script.ErrScriptAlreadyExists):
+			respondError(w, http.StatusConflict, "Script already exists")
+		case errors.Is(err, script.ErrInvalidScript):
+			respondError(w, http.StatusBadRequest, err.Error())
+		default:
+			respondError(w, http.StatusInternalServerError, "Failed to create script: "+err.Error())
+		}
+		return
+	}
+
+	status, _ := s.Scripts.Get(req.Name)
+	respondJSON(w, http.StatusCreated, status)
+}
+
+// ListScripts handles GET /scripts
+func (s *Server) ListScripts(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	respondJSON(w, http.StatusOK, s.Scripts.List())
+}
+
+// GetScript handles GET /scripts/{scriptName}
+func (s *Server) GetScript(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	scriptName := chi.URLParam(r, "scriptName")
+	if scriptName == "" {
+		respondError(w, http.StatusBadRequest, "Script name is required")
+		return
+	}
+
+	status, err := s.Scripts.Get(scriptName)
+	if err != nil {
+		if err == script.ErrScriptNotFound {
+			respondError(w, http.StatusNotFound, "Script not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to get script: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, status)
+}
+
+// DeleteScript handles DELETE /scripts/{scriptName}
+func (s *Server) DeleteScript(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	scriptName := chi.URLParam(r, "scriptName")
+	if scriptName == "" {
+		respondError(w, http.StatusBadRequest, "Script name is required")
+		return
+	}
+
+	if err := s.Scripts.Delete(scriptName); err != nil {
+		if err == script.ErrScriptNotFound {
+			respondError(w, http.StatusNotFound, "Script not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to delete script: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Script deleted"})
+}
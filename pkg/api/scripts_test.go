@@ -0,0 +1,84 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestScriptManagement(t *testing.T) {
+	server := setupTestServer()
+
+	create := func(body map[string]interface{}) *httptest.ResponseRecorder {
+		jsonData, _ := json.Marshal(body)
+		req := httptest.NewRequest("POST", "/scripts", bytes.NewBuffer(jsonData))
+		req.Header.Set("Content-Type", "application/json")
+
+		w := httptest.NewRecorder()
+		server.CreateScript(w, req)
+		return w
+	}
+
+	transform := map[string]interface{}{
+		"name":   "scale",
+		"kind":   "transform",
+		"source": "def transform(t):\n    return {f: {k: v * 10 for k, v in p.items()} for f, p in t[\"features\"].items()}\n",
+	}
+
+	if w := create(transform); w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	if w := create(transform); w.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d, got %d", http.StatusConflict, w.Code)
+	}
+
+	if w := create(map[string]interface{}{"name": "broken", "kind": "rule", "source": "def"}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	// Transform scripts run on ingested telemetry
+	server.Registry.Create(twin.NewDigitalTwin("sensor-1", "sensor"))
+	jsonData, _ := json.Marshal(map[string]interface{}{
+		"features": map[string]interface{}{"level": map[string]interface{}{"value": 2}},
+	})
+	req := httptest.NewRequest("POST", "/twins/sensor-1/telemetry", bytes.NewBuffer(jsonData))
+	req = req.WithContext(setURLParam(req.Context(), "twinID", "sensor-1"))
+	w := httptest.NewRecorder()
+	server.IngestTelemetry(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	dt, _ := server.Registry.Get("sensor-1")
+	feature, _ := dt.GetFeature("level")
+	if val, _ := feature.GetProperty("value"); val != 20.0 {
+		t.Errorf("Expected transformed value 20, got %v", val)
+	}
+
+	// Get and delete the script
+	req = httptest.NewRequest("GET", "/scripts/scale", nil)
+	req = req.WithContext(setURLParam(req.Context(), "scriptName", "scale"))
+	w = httptest.NewRecorder()
+	server.GetScript(w, req)
+
+	var status map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&status)
+	if status["runs"] != 1.0 {
+		t.Errorf("Expected one run, got %v", status)
+	}
+
+	req = httptest.NewRequest("DELETE", "/scripts/scale", nil)
+	req = req.WithContext(setURLParam(req.Context(), "scriptName", "scale"))
+	w = httptest.NewRecorder()
+	server.DeleteScript(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/aleka07/go-digital-twin/pkg/jsonld"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+	"github.com/go-chi/chi/v5"
+)
+
+// Semantic annotation handlers
+
+// SetTwinSemantics handles PUT /twins/{twinID}/semantics
+func (s *Server) SetTwinSemantics(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	twinID := chi.URLParam(r, "twinID")
+	if twinID == "" {
+		respondError(w, http.StatusBadRequest, "Twin ID is required")
+		return
+	}
+
+	annotation, ok := decodeAnnotation(w, r)
+	if !ok {
+		return
+	}
+
+	dt, err := s.Twins.Get(twinID)
+	if err != nil {
+		if err == registry.ErrTwinNotFound {
+			respondError(w, http.StatusNotFound, "Digital twin not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to get digital twin: "+err.Error())
+		}
+		return
+	}
+
+	dt.SetSemantics(annotation)
+
+	recordModifier(r, dt)
+	if err := s.Twins.Update(dt); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to update digital twin: "+err.Error())
+		return
+	}
+
+	// Publish event
+	s.PubSub.Publish("twin.updated", map[string]string{"id": dt.ID})
+
+	respondJSON(w, http.StatusOK, dt.GetSemantics())
+}
+
+// SetFeatureSemantics handles PUT /twins/{twinID}/features/{featureID}/semantics
+func (s *Server) SetFeatureSemantics(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	twinID := chi.URLParam(r, "twinID")
+	featureID := chi.URLParam(r, "featureID")
+
+	if twinID == "" || featureID == "" {
+		respondError(w, http.StatusBadRequest, "Twin ID and Feature ID are required")
+		return
+	}
+
+	annotation, ok := decodeAnnotation(w, r)
+	if !ok {
+		return
+	}
+
+	dt, err := s.Twins.Get(twinID)
+	if err != nil {
+		if err == registry.ErrTwinNotFound {
+			respondError(w, http.StatusNotFound, "Digital twin not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to get digital twin: "+err.Error())
+		}
+		return
+	}
+
+	feature, exists := dt.GetFeature(featureID)
+	if !exists {
+		respondError(w, http.StatusNotFound, "Feature not found")
+		return
+	}
+
+	feature.SetSemantics(annotation)
+
+	recordModifier(r, dt, feature)
+	if err := s.Twins.Update(dt); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to update digital twin: "+err.Error())
+		return
+	}
+
+	// Publish event
+	s.PubSub.Publish("feature.updated", map[string]string{
+		"twinId":    twinID,
+		"featureId": featureID,
+	})
+
+	respondJSON(w, http.StatusOK, feature.GetSemantics())
+}
+
+// ExportJSONLD handles GET /twins/{twinID}/jsonld.
+// The optional base query parameter sets the prefix of node IDs.
+func (s *Server) ExportJSONLD(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	twinID := chi.URLParam(r, "twinID")
+	if twinID == "" {
+		respondError(w, http.StatusBadRequest, "Twin ID is required")
+		return
+	}
+
+	dt, err := s.Twins.Get(twinID)
+	if err != nil {
+		if err == registry.ErrTwinNotFound {
+			respondError(w, http.StatusNotFound, "Digital twin not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to get digital twin: "+err.Error())
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", jsonld.ContentType)
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(jsonld.Export(dt, r.URL.Query().Get("base"))); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// decodeAnnotation reads and validates a semantic annotation from a request body.
+// An empty annotation removes the current one.
+func decodeAnnotation(w http.ResponseWriter, r *http.Request) (*twin.SemanticAnnotation, bool) {
+	var annotation twin.SemanticAnnotation
+	if err := json.NewDecoder(r.Body).Decode(&annotation); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return nil, false
+	}
+
+	if err := jsonld.Validate(&annotation); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+
+	if len(annotation.Context) == 0 && len(annotation.Types) == 0 {
+		return nil, true
+	}
+	return &annotation, true
+}
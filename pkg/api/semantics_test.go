@@ -0,0 +1,84 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/jsonld"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestSemanticsAndJSONLDExport(t *testing.T) {
+	server := setupTestServer()
+
+	dt := twin.NewDigitalTwin("ahu-1", "airHandler")
+	dt.AddFeature("supplyTemp", twin.NewFeatureState())
+	server.Registry.Create(dt)
+
+	put := func(handler http.HandlerFunc, featureID string, body interface{}) *httptest.ResponseRecorder {
+		jsonData, _ := json.Marshal(body)
+		req := httptest.NewRequest("PUT", "/twins/ahu-1/semantics", bytes.NewBuffer(jsonData))
+		ctx := setURLParam(req.Context(), "twinID", "ahu-1")
+		if featureID != "" {
+			ctx = setURLParam(ctx, "featureID", featureID)
+		}
+
+		w := httptest.NewRecorder()
+		handler(w, req.WithContext(ctx))
+		return w
+	}
+
+	w := put(server.SetTwinSemantics, "", map[string]interface{}{"types": []string{"brick:AHU"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	w = put(server.SetFeatureSemantics, "supplyTemp", map[string]interface{}{"types": []string{"brick:Supply_Air_Temperature_Sensor"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	// Unknown prefixes and features are rejected
+	if w := put(server.SetTwinSemantics, "", map[string]interface{}{"types": []string{"ex:Pump"}}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w := put(server.SetFeatureSemantics, "unknown", map[string]interface{}{"types": []string{"saref:Sensor"}}); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	req := httptest.NewRequest("GET", "/twins/ahu-1/jsonld", nil)
+	req = req.WithContext(setURLParam(req.Context(), "twinID", "ahu-1"))
+	w = httptest.NewRecorder()
+	server.ExportJSONLD(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != jsonld.ContentType {
+		t.Errorf("Expected content type %s, got %s", jsonld.ContentType, ct)
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("Failed to parse document: %v", err)
+	}
+
+	if doc["@type"].([]interface{})[0] != "brick:AHU" {
+		t.Errorf("Expected type brick:AHU, got %v", doc["@type"])
+	}
+	feature := doc["hasFeature"].([]interface{})[0].(map[string]interface{})
+	if feature["@type"].([]interface{})[0] != "brick:Supply_Air_Temperature_Sensor" {
+		t.Errorf("Unexpected feature type: %v", feature["@type"])
+	}
+
+	// An empty annotation removes the semantics
+	if w := put(server.SetTwinSemantics, "", map[string]interface{}{}); w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if stored, _ := server.Registry.Get("ahu-1"); stored.GetSemantics() != nil {
+		t.Errorf("Expected semantics to be removed, got %+v", stored.GetSemantics())
+	}
+}
@@ -1,38 +1,222 @@
 package api
 
 import (
+	"bytes"
 	"context"
-	"encoding/json"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
-	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/access"
+	"github.com/aleka07/go-digital-twin/pkg/annotation"
+	"github.com/aleka07/go-digital-twin/pkg/anomaly"
+	"github.com/aleka07/go-digital-twin/pkg/approval"
+	"github.com/aleka07/go-digital-twin/pkg/attachment"
+	"github.com/aleka07/go-digital-twin/pkg/auth"
+	"github.com/aleka07/go-digital-twin/pkg/backfill"
+	"github.com/aleka07/go-digital-twin/pkg/cdc"
+	"github.com/aleka07/go-digital-twin/pkg/clock"
+	"github.com/aleka07/go-digital-twin/pkg/delta"
+	"github.com/aleka07/go-digital-twin/pkg/edge"
+	"github.com/aleka07/go-digital-twin/pkg/federation"
+	"github.com/aleka07/go-digital-twin/pkg/digest"
+	"github.com/aleka07/go-digital-twin/pkg/energy"
+	"github.com/aleka07/go-digital-twin/pkg/eventbus"
+	"github.com/aleka07/go-digital-twin/pkg/export"
+	"github.com/aleka07/go-digital-twin/pkg/freshness"
+	"github.com/aleka07/go-digital-twin/pkg/golden"
+	"github.com/aleka07/go-digital-twin/pkg/group"
+	"github.com/aleka07/go-digital-twin/pkg/history"
+	"github.com/aleka07/go-digital-twin/pkg/impact"
+	"github.com/aleka07/go-digital-twin/pkg/inference"
+	"github.com/aleka07/go-digital-twin/pkg/ingest"
+	"github.com/aleka07/go-digital-twin/pkg/kpi"
+	"github.com/aleka07/go-digital-twin/pkg/maintenance"
+	"github.com/aleka07/go-digital-twin/pkg/ngsild"
+	"github.com/aleka07/go-digital-twin/pkg/offline"
+	"github.com/aleka07/go-digital-twin/pkg/oidc"
+	"github.com/aleka07/go-digital-twin/pkg/notify"
+	"github.com/aleka07/go-digital-twin/pkg/objstore"
+	"github.com/aleka07/go-digital-twin/pkg/plugin"
 	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/replica"
+	"github.com/aleka07/go-digital-twin/pkg/script"
+	"github.com/aleka07/go-digital-twin/pkg/shadow"
+	"github.com/aleka07/go-digital-twin/pkg/mapping"
+	"github.com/aleka07/go-digital-twin/pkg/schema"
+	"github.com/aleka07/go-digital-twin/pkg/secret"
+	"github.com/aleka07/go-digital-twin/pkg/share"
+	"github.com/aleka07/go-digital-twin/pkg/valuesize"
+	"github.com/aleka07/go-digital-twin/pkg/views"
+	"github.com/aleka07/go-digital-twin/pkg/wasm"
+	"github.com/aleka07/go-digital-twin/pkg/webhook"
 )
 
 // Server represents the HTTP API server
 type Server struct {
-	Router   *chi.Mux
-	Registry *registry.Registry
-	PubSub   *messaging_sim.PubSub
-	wg       sync.WaitGroup
+	Router      *chi.Mux
+	Registry    *registry.Registry
+	Twins       registry.Twins // Read and written by the twin handlers, the ingester and views; Registry unless replaced
+	PubSub      eventbus.Bus
+	Views       *views.Manager
+	Groups      *group.Manager
+	Maintenance *maintenance.Manager
+	Digests     *digest.Manager
+	Ingester    *ingest.Ingester
+	History     *history.Store
+	Annotations *annotation.Store
+	Attachments *attachment.Manager
+	Access      *access.Manager
+	ValueSizes  *valuesize.Manager
+	Webhooks    *webhook.Manager
+	Plugins     *plugin.Manager
+	Scripts     *script.Manager
+	Wasm        *wasm.Manager
+	Shares      *share.Manager
+	Tokens      *auth.Tokens
+	Secrets     *secret.Manager
+	NGSILD      *ngsild.Manager
+	Impact      *impact.Analyzer
+	Backfill    *backfill.Manager
+	Golden      *golden.Manager
+	Approvals   *approval.Manager
+	Notifiers   *notify.Manager
+	Freshness   *freshness.Manager
+	Schemas     *schema.Manager
+	Mappings    *mapping.Manager
+	KPI         *kpi.Calculator
+	Energy      *energy.Aggregator
+	Anomalies   *anomaly.Manager
+	Models      *inference.Manager
+	Shadows     *shadow.Manager
+	Deltas      *delta.Tracker
+	OfflineKeys offline.Keys            // Sign exported and verify imported offline bundles
+	Parquet     *export.ParquetExporter // Set when Parquet export is configured
+	CDC         *cdc.Exporter           // Set when CDC export is configured
+	Edge        *edge.Syncer            // Set when edge sync is configured
+	Federation  *federation.Manager     // Set when peer servers are configured
+	Replica     *replica.Replica        // Set when following a primary as a read replica
+	OIDC        *oidc.Provider          // Set when OIDC sign-in is configured
+	UDP         *ingest.UDPListener     // Set when the UDP listener is enabled
+	wg          sync.WaitGroup
+
+	twinCache      *twinCache
+	cursors        *cursorStore
+	twinCacheMutex sync.RWMutex
+	debugToken     string
+	debugMutex     sync.RWMutex
+	adminToken     string
+	adminMutex     sync.RWMutex
+	readyIndexes   []string
+	readyMutex     sync.RWMutex
+	startedAt      time.Time
+	clock          clock.Clock // Handlers timestamp writes with it; see SetClock
+	clockMutex     sync.RWMutex
+	legacySunset   time.Time
+	versionMutex   sync.RWMutex
+	closing        chan struct{} // Closed when shutting down, to end event streams
+	closeOnce      sync.Once
 }
 
-// NewServer creates a new API server
-func NewServer(reg *registry.Registry, pubsub *messaging_sim.PubSub) *Server {
+// NewServer creates a new API server publishing and subscribing to twin
+// events on a bus, usually a messaging_sim.PubSub
+func NewServer(reg *registry.Registry, pubsub eventbus.Bus) *Server {
 	s := &Server{
-		Router:   chi.NewRouter(),
-		Registry: reg,
-		PubSub:   pubsub,
+		Router:    chi.NewRouter(),
+		closing:   make(chan struct{}),
+		Registry:  reg,
+		Twins:     reg,
+		PubSub:    pubsub,
+		Groups:    group.NewManager(reg, pubsub),
+		Digests:   digest.NewManager(pubsub),
+		History:   history.NewStore(history.DefaultCapacity),
+		Webhooks:  webhook.NewManager(reg),
+		Plugins:   plugin.NewManager(reg),
+		Scripts:   script.NewManager(reg, pubsub),
+		Wasm:      wasm.NewManager(),
+		Shares:    share.NewManager(),
+		Tokens:    auth.NewTokens(),
+		Secrets:   secret.NewManager(),
+		NGSILD:    ngsild.NewManager(reg),
+		Impact:    impact.NewAnalyzer(reg),
+		Golden:    golden.NewManager(reg, pubsub),
+		Approvals: approval.NewManager(reg, pubsub),
+		Notifiers: notify.NewManager(reg),
+		Freshness: freshness.NewManager(reg, pubsub),
+		Schemas:   schema.NewManager(),
+		Access:    access.NewManager(),
+		Mappings:  mapping.NewManager(),
+		Anomalies: anomaly.NewManager(reg, pubsub),
+		Deltas:    delta.NewTracker(),
+		twinCache: newTwinCache(DefaultTwinCacheSize),
+		cursors:   newCursorStore(),
+		startedAt: time.Now(),
+		clock:     clock.System,
 	}
+	s.Views = views.NewManager(serverTwins{s})
+	s.Annotations = annotation.NewStore()
+	s.Attachments = attachment.NewManager(objstore.NewMemoryStore(), attachment.Options{})
+	s.ValueSizes = valuesize.NewManager(valuesize.StoreFunc(s.offloadValue))
+	s.Backfill = backfill.NewManager(reg, s.Scripts, s.History)
+	s.KPI = kpi.NewCalculator(reg, s.History)
+	s.Energy = energy.NewAggregator(reg, pubsub, s.History)
+	s.Models = inference.NewManager(reg, pubsub, s.History)
+	s.Ingester = ingest.NewIngester(serverTwins{s}, pubsub, s.History)
+	s.Ingester.AddTransform("scripts", s.Scripts)
+	s.Ingester.SetValueSizes(s.ValueSizes)
+	s.Ingester.SetSchemas(s.Schemas)
+	s.Shadows = shadow.NewManager(reg, s.Ingester, pubsub)
+	s.Maintenance = maintenance.NewManager(pubsub, s.Groups)
+	s.Notifiers.SetSuppressor(s.Maintenance)
+	s.Notifiers.SetSecrets(s.Secrets)
+	s.Webhooks.SetSecrets(s.Secrets)
+	s.Scripts.SetSuppressor(s.Maintenance)
+	s.registerImpactSources()
+
+	// Keep materialized views up to date with twin changes
+	go s.Views.Run(pubsub.SubscribeWithBuffer("#", 1024))
+
+	// Keep the members of dynamic groups up to date
+	go s.Groups.Run(pubsub.SubscribeWithBuffer("#", 1024))
+
+	// Notify external systems of twin lifecycle transitions
+	go s.Webhooks.Run(pubsub.SubscribeWithBuffer("twin.+", 1024))
+
+	// Call plugin hooks for twin changes
+	go s.Plugins.Run(pubsub.SubscribeWithPriority("#", 1024))
+
+	// Run rule and computed property scripts
+	go s.Scripts.Run(pubsub.SubscribeWithPriority("#", 1024))
+
+	// Send NGSI-LD subscription notifications. A FIFO subscription keeps
+	// the events of a twin in publish order, which priority lanes would not.
+	go s.NGSILD.Run(pubsub.SubscribeWithBuffer("#", 1024))
+
+	// Raise drift alerts when twins deviate from their golden twin
+	go s.Golden.Run(pubsub.SubscribeWithBuffer("#", 1024))
+
+	// Score property changes with anomaly detectors. Detectors learn from
+	// values in order, so the subscription is FIFO.
+	go s.Anomalies.Run(pubsub.SubscribeWithBuffer("#", 1024))
+
+	// Invoke inference models when the properties they use change
+	go s.Models.Run(pubsub.SubscribeWithPriority("#", 1024))
+
+	// Count the events of shadow twins and their sources for comparison
+	go s.Shadows.Run(pubsub.SubscribeWithBuffer("#", 1024))
+
+	// Send alerts to Slack, email and PagerDuty
+	go s.Notifiers.Run(pubsub.SubscribeWithPriority("#", 1024))
 
 	// Set up middleware
 	s.Router.Use(middleware.Logger)
 	s.Router.Use(middleware.Recoverer)
-	s.Router.Use(middleware.Timeout(30 * time.Second))
+	s.Router.Use(timeout(30 * time.Second))
+	s.Router.Use(s.authenticate)
+	s.Router.Use(s.readOnly)
 
 	// Register routes
 	s.registerRoutes()
@@ -40,36 +224,228 @@ func NewServer(reg *registry.Registry, pubsub *messaging_sim.PubSub) *Server {
 	return s
 }
 
-// registerRoutes sets up all API routes
+// registerRoutes sets up all API routes. The API is served under /api/v1
+// and, deprecated, under the unprefixed legacy paths.
 func (s *Server) registerRoutes() {
+	s.Router.Route(APIPrefix, func(r chi.Router) {
+		r.Use(s.versioned(CurrentAPIVersion))
+		s.apiRoutes(r)
+	})
+	s.Router.Group(func(r chi.Router) {
+		r.Use(s.legacy)
+		s.apiRoutes(r)
+	})
+
+	// Sign-in with an OIDC identity provider and scoped tokens
+	s.Router.Route("/auth", func(r chi.Router) {
+		r.Get("/login", s.Login)
+		r.Get("/callback", s.LoginCallback)
+		r.Post("/logout", s.Logout)
+		r.Get("/me", s.GetIdentity)
+		r.Route("/tokens", func(r chi.Router) {
+			r.Get("/", s.ListTokens)
+			r.Post("/", s.IssueToken)
+			r.Delete("/{tokenID}", s.RevokeToken)
+		})
+	})
+
+	// Profiling and runtime diagnostics, protected by the debug token
+	s.Router.Mount("/debug", s.debugRoutes())
+
+	// NGSI-LD compatibility
+	s.Router.Route(ngsiBasePath, func(r chi.Router) {
+		r.Route("/entities", func(r chi.Router) {
+			r.Post("/", s.CreateEntity)
+			r.Get("/", s.ListEntities)
+
+			r.Route("/{entityID}", func(r chi.Router) {
+				r.Get("/", s.GetEntity)
+				r.Delete("/", s.DeleteEntity)
+				r.Patch("/attrs", s.UpdateEntityAttrs)
+			})
+		})
+
+		r.Route("/subscriptions", func(r chi.Router) {
+			r.Post("/", s.CreateSubscription)
+			r.Get("/", s.ListSubscriptions)
+
+			r.Route("/{subscriptionID}", func(r chi.Router) {
+				r.Get("/", s.GetSubscription)
+				r.Delete("/", s.DeleteSubscription)
+			})
+		})
+	})
+
+	// Asset Administration Shell compatibility
+	s.Router.Route(aasBasePath, func(r chi.Router) {
+		r.Get("/shells", s.ListShells)
+		r.Route("/shells/{aasIdentifier}", func(r chi.Router) {
+			r.Get("/", s.GetShell)
+			r.Get("/submodel-refs", s.ListSubmodelRefs)
+		})
+
+		r.Get("/submodels", s.ListSubmodels)
+		r.Route("/submodels/{submodelIdentifier}", func(r chi.Router) {
+			r.Get("/", s.GetSubmodel)
+			r.Get("/$value", s.GetSubmodelValue)
+			r.Get("/submodel-elements", s.ListSubmodelElements)
+
+			r.Route("/submodel-elements/{idShortPath}", func(r chi.Router) {
+				r.Get("/", s.GetSubmodelElement)
+				r.Get("/$value", s.GetSubmodelElementValue)
+				r.Patch("/$value", s.SetSubmodelElementValue)
+			})
+		})
+	})
+
+	// Health check
+	s.Router.Get("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("OK"))
+	})
+
+	// Readiness once critical indexes are built
+	s.Router.Get("/ready", s.Ready)
+}
+
+// apiRoutes registers the routes of the versioned API on r
+func (s *Server) apiRoutes(r chi.Router) {
 	// Twin management
-	s.Router.Route("/twins", func(r chi.Router) {
+	r.Route("/twins", func(r chi.Router) {
 		r.Post("/", s.CreateTwin)
 		r.Get("/", s.ListTwins)
-		
+		r.Post("/read-transaction", s.ReadTransaction)
+		r.Get("/export.csv", s.ExportTwinsCSV)
+		r.Get("/watch", s.WatchTwins)
+		r.Post("/query/explain", s.ExplainQuery)
+
+		// Twins by their IDs in external systems
+		r.Get("/by-external-id/{system}/{externalID}", s.GetTwinByExternalID)
+
 		r.Route("/{twinID}", func(r chi.Router) {
+			// Twins of peer servers
+			r.Use(s.federated)
+
+			// Twins merged into others
+			r.Use(s.redirectMerged)
+
+			// Reads of sensitive twins
+			r.Use(s.auditReads)
+
 			r.Get("/", s.GetTwin)
 			r.Put("/", s.UpdateTwin)
+			r.Patch("/", s.UpdateTwin)
 			r.Delete("/", s.DeleteTwin)
-			
+
+			// Changing the ID of the twin
+			r.Post("/rename", s.RenameTwin)
+
+			// Merging a duplicate twin into the twin
+			r.Post("/merge", s.MergeTwin)
+
+			// Attribute management
+			r.Route("/attributes", func(r chi.Router) {
+				r.Get("/", s.GetAttributes)
+				r.Put("/", s.UpdateAttributes)
+
+				r.Route("/{attrKey}", func(r chi.Router) {
+					r.Get("/", s.GetAttribute)
+					r.Put("/", s.UpdateAttribute)
+					r.Delete("/", s.DeleteAttribute)
+				})
+			})
+
+			// Operator notes
+			r.Route("/annotations", func(r chi.Router) {
+				r.Get("/", s.ListAnnotations)
+				r.Post("/", s.CreateAnnotation)
+				r.Get("/{annotationID}", s.GetAnnotation)
+				r.Delete("/{annotationID}", s.DeleteAnnotation)
+			})
+
+			// Files such as photos and certificates
+			r.Route("/attachments", func(r chi.Router) {
+				r.Get("/", s.ListAttachments)
+				r.Post("/", s.AddAttachment)
+				r.Get("/{attachmentID}", s.GetAttachment)
+				r.Get("/{attachmentID}/content", s.GetAttachmentContent)
+				r.Delete("/{attachmentID}", s.DeleteAttachment)
+			})
+
+			// Lifecycle transitions
+			r.Put("/lifecycle", s.SetLifecycle)
+
+			// Shadow copies for trying out configuration changes
+			r.Post("/shadows", s.CreateShadow)
+
+			// Event rate limit
+			r.Get("/rate-limit", s.GetRateLimit)
+			r.Put("/rate-limit", s.SetRateLimit)
+			r.Delete("/rate-limit", s.DeleteRateLimit)
+
+			// Relationships to other twins
+			r.Route("/relationships", func(r chi.Router) {
+				r.Get("/", s.GetRelationships)
+				r.Put("/{relName}/{targetID}", s.AddRelationship)
+				r.Delete("/{relName}/{targetID}", s.RemoveRelationship)
+			})
+
+			// Impact analysis
+			r.Get("/impact", s.GetImpact)
+
+			// Configuration drift from the golden twin of the type
+			r.Get("/drift", s.GetDrift)
+
+			// Semantic annotations and JSON-LD export
+			r.Put("/semantics", s.SetTwinSemantics)
+			r.Get("/jsonld", s.ExportJSONLD)
+
+			// 3D model and node bindings for visualization frontends
+			r.Get("/scene", s.GetTwinScene)
+			r.Put("/scene", s.SetTwinScene)
+			r.Delete("/scene", s.DeleteTwinScene)
+
+			// Share links
+			r.Route("/shares", func(r chi.Router) {
+				r.Post("/", s.CreateShare)
+				r.Get("/", s.ListShares)
+				r.Delete("/{shareID}", s.RevokeShare)
+			})
+
+			// Plugin commands
+			r.Post("/commands/{commandName}", s.SendCommand)
+
+			// Telemetry ingestion
+			r.Post("/telemetry", s.IngestTelemetry)
+
 			// Feature management
 			r.Route("/features", func(r chi.Router) {
 				r.Get("/", s.GetFeatures)
-				
+
 				r.Route("/{featureID}", func(r chi.Router) {
 					r.Get("/", s.GetFeature)
 					r.Put("/", s.UpdateFeature)
 					r.Delete("/", s.DeleteFeature)
-					
+					r.Put("/semantics", s.SetFeatureSemantics)
+
 					// Property management
 					r.Route("/properties", func(r chi.Router) {
 						r.Get("/", s.GetProperties)
 						r.Put("/", s.UpdateProperties)
-						
+
 						r.Route("/{propKey}", func(r chi.Router) {
 							r.Get("/", s.GetProperty)
 							r.Put("/", s.UpdateProperty)
 							r.Delete("/", s.DeleteProperty)
+							r.Get("/history", s.GetPropertyHistory)
+							r.Get("/at", s.GetPropertyAt)
+
+							// Values nested in the property, such as config/network/ip.
+							// The routes above take precedence over top-level keys
+							// named history or at.
+							r.Get("/*", s.GetProperty)
+							r.Put("/*", s.UpdateProperty)
+							r.Delete("/*", s.DeleteProperty)
 						})
 					})
 				})
@@ -77,10 +453,364 @@ func (s *Server) registerRoutes() {
 		})
 	})
 
-	// Health check
-	s.Router.Get("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("OK"))
+	// Access to a single twin through a share link
+	r.Route("/shared/{token}", func(r chi.Router) {
+		r.Use(s.shareAccess)
+		r.Use(s.auditReads)
+		r.Get("/", s.GetTwin)
+		r.Get("/features", s.GetFeatures)
+		r.Get("/features/{featureID}", s.GetFeature)
+		r.Get("/features/{featureID}/properties", s.GetProperties)
+		r.Put("/features/{featureID}/properties", s.UpdateProperties)
+		r.Get("/features/{featureID}/properties/{propKey}", s.GetProperty)
+		r.Put("/features/{featureID}/properties/{propKey}", s.UpdateProperty)
+		r.Get("/features/{featureID}/properties/{propKey}/history", s.GetPropertyHistory)
+		r.Get("/features/{featureID}/properties/{propKey}/at", s.GetPropertyAt)
+		r.Get("/features/{featureID}/properties/{propKey}/*", s.GetProperty)
+		r.Put("/features/{featureID}/properties/{propKey}/*", s.UpdateProperty)
+	})
+
+	// Twins placed in 3D scenes, with live values of bound features
+	r.Get("/scene", s.GetScene)
+
+	// Maintenance windows suppressing alerts and rule actions
+	r.Route("/maintenance", func(r chi.Router) {
+		r.Post("/", s.CreateMaintenanceWindow)
+		r.Get("/", s.ListMaintenanceWindows)
+		r.Get("/{windowID}", s.GetMaintenanceWindow)
+		r.Delete("/{windowID}", s.DeleteMaintenanceWindow)
+		r.Get("/{windowID}/suppressed", s.ListSuppressedEvents)
+	})
+
+	// Static and dynamic groups of twins
+	r.Route("/groups", func(r chi.Router) {
+		r.Post("/", s.CreateGroup)
+		r.Get("/", s.ListGroups)
+
+		r.Route("/{groupName}", func(r chi.Router) {
+			r.Get("/", s.GetGroup)
+			r.Put("/", s.UpdateGroup)
+			r.Delete("/", s.DeleteGroup)
+			r.Get("/twins", s.ListGroupTwins)
+			r.Patch("/twins", s.UpdateGroupTwins)
+			r.Put("/twins/{twinID}", s.AddGroupTwin)
+			r.Delete("/twins/{twinID}", s.RemoveGroupTwin)
+		})
+	})
+
+	// Materialized views
+	r.Route("/views", func(r chi.Router) {
+		r.Post("/", s.CreateView)
+		r.Get("/", s.ListViews)
+
+		r.Route("/{viewName}", func(r chi.Router) {
+			r.Get("/", s.GetView)
+			r.Delete("/", s.DeleteView)
+			r.Post("/refresh", s.RefreshView)
+		})
+	})
+
+	// Indexes of twin paths used by queries
+	r.Route("/indexes", func(r chi.Router) {
+		r.Post("/", s.CreateIndex)
+		r.Get("/", s.ListIndexes)
+		r.Get("/{path}", s.GetIndex)
+		r.Delete("/{path}", s.DeleteIndex)
+	})
+
+	// Ingestion settings
+	r.Route("/ingest/policies", func(r chi.Router) {
+		r.Get("/", s.GetLatePolicies)
+		r.Put("/default", s.SetDefaultLatePolicy)
+		r.Put("/{featureID}/{propKey}", s.SetLatePolicy)
+		r.Delete("/{featureID}/{propKey}", s.DeleteLatePolicy)
+	})
+
+	// Size limits of property values
+	r.Route("/value-limits", func(r chi.Router) {
+		r.Get("/", s.GetValueLimits)
+		r.Put("/default", s.SetDefaultValueLimit)
+		r.Put("/{featureID}/{propKey}", s.SetValueLimit)
+		r.Delete("/{featureID}/{propKey}", s.DeleteValueLimit)
+	})
+
+	// Broker topics mapped to twin telemetry
+	r.Route("/mappings", func(r chi.Router) {
+		r.Get("/", s.ListMappings)
+		r.Post("/test", s.TestMapping)
+		r.Get("/codecs", s.ListCodecs)
+		r.Get("/{mappingID}", s.GetMapping)
+		r.Put("/{mappingID}", s.SetMapping)
+		r.Delete("/{mappingID}", s.DeleteMapping)
+	})
+	r.Post("/ingest/topics/*", s.IngestTopic)
+
+	// Payload transforms of topic mappings and webhooks
+	r.Post("/transforms/test", s.TestTransform)
+
+	// Change notification digests
+	r.Route("/digests", func(r chi.Router) {
+		r.Post("/", s.CreateDigest)
+		r.Get("/", s.ListDigests)
+
+		r.Route("/{digestName}", func(r chi.Router) {
+			r.Get("/", s.GetDigest)
+			r.Delete("/", s.DeleteDigest)
+		})
+	})
+
+	// Scripts
+	r.Route("/scripts", func(r chi.Router) {
+		r.Post("/", s.CreateScript)
+		r.Get("/", s.ListScripts)
+
+		r.Route("/{scriptName}", func(r chi.Router) {
+			r.Get("/", s.GetScript)
+			r.Delete("/", s.DeleteScript)
+		})
+	})
+
+	// Versioned script bundles
+	r.Route("/script-bundles", func(r chi.Router) {
+		r.Post("/", s.StageScriptBundle)
+		r.Get("/", s.ListScriptBundles)
+		r.Post("/rollback", s.RollbackScriptBundle)
+
+		r.Route("/{version}", func(r chi.Router) {
+			r.Get("/", s.GetScriptBundle)
+			r.Delete("/", s.DeleteScriptBundle)
+			r.Post("/validate", s.ValidateScriptBundle)
+			r.Post("/activate", s.ActivateScriptBundle)
+		})
+	})
+
+	// WASM bridge transformation hooks
+	r.Route("/wasm", func(r chi.Router) {
+		r.Get("/", s.ListWasmHooks)
+
+		r.Route("/{hookName}", func(r chi.Router) {
+			r.Put("/", s.UploadWasmHook)
+			r.Get("/", s.GetWasmHook)
+			r.Delete("/", s.DeleteWasmHook)
+			r.Post("/messages", s.BridgeMessage)
+		})
+	})
+
+	// Golden twins per type
+	r.Route("/golden", func(r chi.Router) {
+		r.Get("/", s.ListGoldens)
+
+		r.Route("/{twinType}", func(r chi.Router) {
+			r.Put("/", s.SetGolden)
+			r.Get("/", s.GetGolden)
+			r.Delete("/", s.DeleteGolden)
+		})
+	})
+
+	// Approval of sensitive desired-state changes
+	r.Route("/change-requests", func(r chi.Router) {
+		r.Get("/", s.ListChangeRequests)
+
+		r.Route("/policies", func(r chi.Router) {
+			r.Get("/", s.ListApprovalPolicies)
+			r.Put("/{featureID}/{propKey}", s.SetApprovalPolicy)
+			r.Delete("/{featureID}/{propKey}", s.DeleteApprovalPolicy)
+		})
+
+		r.Route("/{requestID}", func(r chi.Router) {
+			r.Get("/", s.GetChangeRequest)
+			r.Post("/approve", s.ApproveChangeRequest)
+			r.Post("/reject", s.RejectChangeRequest)
+		})
+	})
+
+	// Administration
+	r.Route("/admin/backfill", func(r chi.Router) {
+		r.Post("/", s.StartBackfill)
+		r.Get("/", s.ListBackfills)
+
+		r.Route("/{jobID}", func(r chi.Router) {
+			r.Get("/", s.GetBackfill)
+			r.Delete("/", s.CancelBackfill)
+		})
+	})
+	r.Route("/admin/exports/parquet", func(r chi.Router) {
+		r.Post("/", s.StartParquetExport)
+		r.Get("/", s.ListParquetExports)
+		r.Get("/{jobID}", s.GetParquetExport)
+	})
+
+	// Continuous export of twin changes
+	r.Get("/admin/cdc", s.GetCDCStatus)
+	r.Post("/admin/cdc/flush", s.FlushCDC)
+
+	// Store-and-forward sync from edge servers
+	r.Get("/admin/edge", s.GetEdgeStatus)
+	r.Post("/admin/edge/sync", s.SyncEdge)
+	r.Post("/edge/changes", s.ReceiveEdgeChanges)
+
+	// Twins federated from peer servers
+	r.Get("/admin/federation", s.GetFederationStatus)
+
+	// Read replica following a primary
+	r.Get("/admin/replica", s.GetReplicaStatus)
+
+	// Ingestion load and saturation
+	r.Get("/admin/load", s.GetLoad)
+
+	// Registry memory accounting
+	r.Get("/admin/memory", s.GetMemoryUsage)
+
+	// Cached twin encodings
+	r.Get("/admin/twin-cache", s.GetTwinCacheStats)
+
+	// UDP telemetry listener
+	r.Get("/ingest/udp", s.GetUDPStats)
+
+	// Atomic multi-twin transactions
+	r.Post("/transactions", s.Transaction)
+
+	// Aligned history of a property across many twins
+	r.Post("/history/query", s.QueryFleetHistory)
+
+	// Relationship graph queries
+	r.Post("/graph/query", s.QueryGraph)
+
+	// Plugins
+	r.Get("/plugins", s.ListPlugins)
+
+	// Asset master synchronization
+	r.Post("/sync", s.SyncTwins)
+
+	// Delta sync of replicas over constrained links
+	r.Post("/sync/delta", s.DeltaSync)
+
+	// Sequence-numbered change log for custom replicas
+	r.Get("/replication/log", s.GetReplicationLog)
+
+	// Building twins from IFC models
+	r.Post("/import/ifc", s.ImportIFC)
+
+	// Twins from Asset Administration Shell packages
+	r.Post("/import/aas", s.ImportAAS)
+
+	// Offline bundles for air-gapped transfer
+	r.Post("/offline/export", s.ExportOfflineBundle)
+	r.Post("/offline/import", s.ImportOfflineBundle)
+
+	// Lifecycle webhooks
+	r.Route("/webhooks", func(r chi.Router) {
+		r.Post("/", s.CreateWebhook)
+		r.Get("/", s.ListWebhooks)
+
+		r.Route("/{hookName}", func(r chi.Router) {
+			r.Get("/", s.GetWebhook)
+			r.Delete("/", s.DeleteWebhook)
+		})
+	})
+
+	// Idempotent management for infrastructure-as-code tools
+	r.Route("/manage", func(r chi.Router) {
+		r.Route("/twins/{twinID}", func(r chi.Router) {
+			r.Get("/", s.GetManagedTwin)
+			r.Put("/", s.PutManagedTwin)
+			r.Delete("/", s.DeleteManagedTwin)
+		})
+		r.Route("/scripts/{scriptName}", func(r chi.Router) {
+			r.Get("/", s.GetManagedScript)
+			r.Put("/", s.PutManagedScript)
+			r.Delete("/", s.DeleteManagedScript)
+		})
+		r.Route("/subscriptions/{subscriptionID}", func(r chi.Router) {
+			r.Get("/", s.GetManagedSubscription)
+			r.Put("/", s.PutManagedSubscription)
+			r.Delete("/", s.DeleteManagedSubscription)
+		})
+	})
+
+	// Alert notification channels
+	r.Route("/notifiers", func(r chi.Router) {
+		r.Post("/", s.CreateNotifier)
+		r.Get("/", s.ListNotifiers)
+
+		r.Route("/{channelName}", func(r chi.Router) {
+			r.Get("/", s.GetNotifier)
+			r.Delete("/", s.DeleteNotifier)
+			r.Post("/test", s.TestNotifier)
+		})
+	})
+
+	// Industrial KPIs such as OEE
+	r.Route("/kpi", func(r chi.Router) {
+		r.Get("/conventions", s.GetKPIConventions)
+		r.Put("/conventions", s.SetKPIConventions)
+		r.Get("/twins", s.GetGroupKPIs)
+		r.Get("/twins/{twinID}", s.GetTwinKPIs)
+	})
+
+	// Anomaly detection hooks on properties
+	r.Route("/anomaly-hooks", func(r chi.Router) {
+		r.Post("/", s.CreateAnomalyHook)
+		r.Get("/", s.ListAnomalyHooks)
+		r.Get("/{hookName}", s.GetAnomalyHook)
+		r.Delete("/{hookName}", s.DeleteAnomalyHook)
+	})
+
+	// Shadow twins and their comparison with their sources
+	r.Route("/shadows", func(r chi.Router) {
+		r.Get("/", s.ListShadows)
+		r.Get("/{shadowID}", s.GetShadow)
+		r.Get("/{shadowID}/report", s.GetShadowReport)
+		r.Delete("/{shadowID}", s.DeleteShadow)
+	})
+
+	// Inference models writing predictions to twins
+	r.Route("/models", func(r chi.Router) {
+		r.Post("/", s.CreateModel)
+		r.Get("/", s.ListModels)
+
+		r.Route("/{modelName}", func(r chi.Router) {
+			r.Get("/", s.GetModel)
+			r.Delete("/", s.DeleteModel)
+			r.Post("/twins/{twinID}/predict", s.PredictTwin)
+		})
+	})
+
+	// Energy and power rollups along the containment hierarchy
+	r.Route("/energy", func(r chi.Router) {
+		r.Get("/config", s.GetEnergyConfig)
+		r.Put("/config", s.SetEnergyConfig)
+		r.Get("/rollups", s.ListEnergyRollups)
+		r.Post("/rollups", s.RecomputeEnergyRollups)
+		r.Get("/rollups/{twinID}", s.GetEnergyRollup)
+	})
+
+	// Event rate limits of all twins
+	r.Get("/rate-limits", s.ListRateLimits)
+
+	// Read auditing of sensitive twins
+	r.Route("/access-policies", func(r chi.Router) {
+		r.Get("/", s.ListAccessPolicies)
+		r.Get("/{twinID}", s.GetAccessPolicy)
+		r.Put("/{twinID}", s.SetAccessPolicy)
+		r.Delete("/{twinID}", s.DeleteAccessPolicy)
+		r.Get("/{twinID}/log", s.GetAccessLog)
+	})
+
+	// Freshness SLAs of properties
+	r.Route("/freshness", func(r chi.Router) {
+		r.Get("/", s.ListFreshnessSLAs)
+		r.Get("/stale", s.ListStaleProperties)
+		r.Put("/{featureID}/{propKey}", s.SetFreshnessSLA)
+		r.Delete("/{featureID}/{propKey}", s.DeleteFreshnessSLA)
+	})
+
+	// Schemas of twin types
+	r.Route("/schemas", func(r chi.Router) {
+		r.Get("/", s.ListSchemas)
+		r.Get("/{twinType}", s.GetSchema)
+		r.Put("/{twinType}", s.SetSchema)
+		r.Delete("/{twinType}", s.DeleteSchema)
 	})
 }
 
@@ -96,6 +826,9 @@ func (s *Server) Start(addr string) error {
 
 // Shutdown gracefully shuts down the server
 func (s *Server) Shutdown(ctx context.Context) error {
+	// End event streams, which would otherwise stay open
+	s.closeOnce.Do(func() { close(s.closing) })
+
 	// Wait for all in-flight requests to complete
 	waitCh := make(chan struct{})
 	go func() {
@@ -105,22 +838,75 @@ func (s *Server) Shutdown(ctx context.Context) error {
 
 	select {
 	case <-waitCh:
+		s.Views.Close()
+		s.Digests.Close()
+		s.Wasm.Close(ctx)
 		return nil
 	case <-ctx.Done():
 		return ctx.Err()
 	}
 }
 
-// respondJSON sends a JSON response
+// SetClock sets the clock that the registry commits, twins are created and
+// modified, telemetry is timestamped and recorded in history, views are
+// refreshed, webhooks are delivered, backfill jobs run and scheduled models
+// run with; nil restores the system clock
+func (s *Server) SetClock(c clock.Clock) {
+	s.clockMutex.Lock()
+	s.clock = clock.OrSystem(c)
+	s.clockMutex.Unlock()
+
+	s.Registry.SetClock(c)
+	s.Ingester.SetClock(c)
+	s.Models.SetClock(c)
+	s.Views.SetClock(c)
+	s.Webhooks.SetClock(c)
+	s.Backfill.SetClock(c)
+}
+
+// Clock returns the clock of the server
+func (s *Server) Clock() clock.Clock {
+	s.clockMutex.RLock()
+	defer s.clockMutex.RUnlock()
+
+	return s.clock
+}
+
+// maxPooledBuffer is the capacity beyond which response buffers are not
+// returned to the pool, so that one large response does not pin its memory
+const maxPooledBuffer = 64 << 10
+
+// bufferPool holds buffers that responses are encoded into
+var bufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// respondJSON sends a JSON response. The body is encoded into a pooled
+// buffer first, so that encoding errors still result in a 500 response.
 func respondJSON(w http.ResponseWriter, status int, data interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	
-	if data != nil {
-		if err := json.NewEncoder(w).Encode(data); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+	if data == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		return
+	}
+
+	buf := bufferPool.Get().(*bytes.Buffer)
+	defer func() {
+		if buf.Cap() <= maxPooledBuffer {
+			buf.Reset()
+			bufferPool.Put(buf)
 		}
+	}()
+
+	if err := encodeJSON(buf, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
 }
 
 // respondError sends an error response
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/aleka07/go-digital-twin/pkg/auth"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/shadow"
+	"github.com/go-chi/chi/v5"
+)
+
+// Shadow twin handlers
+
+// CreateShadow handles POST /twins/{twinID}/shadows. The body may set the
+// ID and type of the shadow; both are derived from the source when omitted.
+// Scoped tokens need write access to the ID of the shadow as well.
+func (s *Server) CreateShadow(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	twinID := chi.URLParam(r, "twinID")
+	if twinID == "" {
+		respondError(w, http.StatusBadRequest, "Twin ID is required")
+		return
+	}
+
+	var req shadow.Shadow
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	shadowID := req.ID
+	if shadowID == "" {
+		shadowID = twinID + shadow.TypeSuffix
+	}
+	if !s.authorizeTwin(w, r, shadowID, auth.VerbWrite) {
+		return
+	}
+
+	created, err := s.Shadows.Create(twinID, req)
+	if err != nil {
+		switch {
+		case err == registry.ErrTwinNotFound:
+			respondError(w, http.StatusNotFound, "Digital twin not found")
+		case err == registry.ErrTwinAlreadyExists:
+			respondError(w, http.StatusConflict, "Digital twin already exists")
+		case errors.Is(err, shadow.ErrInvalidShadow):
+			respondError(w, http.StatusBadRequest, err.Error())
+		default:
+			respondError(w, http.StatusInternalServerError, "Failed to create shadow twin: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, created)
+}
+
+// ListShadows handles GET /shadows
+func (s *Server) ListShadows(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	respondJSON(w, http.StatusOK, s.Shadows.List())
+}
+
+// GetShadow handles GET /shadows/{shadowID}
+func (s *Server) GetShadow(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	shadowID := chi.URLParam(r, "shadowID")
+	if shadowID == "" {
+		respondError(w, http.StatusBadRequest, "Shadow ID is required")
+		return
+	}
+
+	sh, err := s.Shadows.Get(shadowID)
+	if err != nil {
+		if err == shadow.ErrShadowNotFound {
+			respondError(w, http.StatusNotFound, "Shadow twin not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to get shadow twin: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, sh)
+}
+
+// GetShadowReport handles GET /shadows/{shadowID}/report and compares the
+// shadow with its source
+func (s *Server) GetShadowReport(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	shadowID := chi.URLParam(r, "shadowID")
+	if shadowID == "" {
+		respondError(w, http.StatusBadRequest, "Shadow ID is required")
+		return
+	}
+
+	report, err := s.Shadows.Compare(shadowID)
+	if err != nil {
+		switch {
+		case err == shadow.ErrShadowNotFound:
+			respondError(w, http.StatusNotFound, "Shadow twin not found")
+		case err == registry.ErrTwinNotFound:
+			respondError(w, http.StatusNotFound, "Source twin not found")
+		default:
+			respondError(w, http.StatusInternalServerError, "Failed to compare shadow twin: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, report)
+}
+
+// DeleteShadow handles DELETE /shadows/{shadowID} and deletes the shadow twin
+func (s *Server) DeleteShadow(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	shadowID := chi.URLParam(r, "shadowID")
+	if shadowID == "" {
+		respondError(w, http.StatusBadRequest, "Shadow ID is required")
+		return
+	}
+
+	if err := s.Shadows.Delete(shadowID); err != nil {
+		if err == shadow.ErrShadowNotFound {
+			respondError(w, http.StatusNotFound, "Shadow twin not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to delete shadow twin: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Shadow twin deleted"})
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/shadow"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestShadows(t *testing.T) {
+	server := setupTestServer()
+	server.Registry.Create(twin.NewDigitalTwin("pump-1", "pump"))
+
+	req := httptest.NewRequest("POST", "/twins/pump-1/shadows", bytes.NewBufferString(`{"type": "pump-v2"}`))
+	req = req.WithContext(setURLParam(req.Context(), "twinID", "pump-1"))
+	w := httptest.NewRecorder()
+	server.CreateShadow(w, req)
+
+	var created shadow.Shadow
+	json.Unmarshal(w.Body.Bytes(), &created)
+	if w.Code != http.StatusCreated || created.ID != "pump-1-shadow" || created.Type != "pump-v2" {
+		t.Fatalf("Unexpected shadow %d %s", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest("POST", "/twins/pump-1/shadows", nil)
+	req = req.WithContext(setURLParam(req.Context(), "twinID", "pump-1"))
+	w = httptest.NewRecorder()
+	server.CreateShadow(w, req)
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d, got %d", http.StatusConflict, w.Code)
+	}
+
+	// Telemetry of the source reaches the shadow
+	req = httptest.NewRequest("POST", "/twins/pump-1/telemetry", bytes.NewBufferString(`{"features": {"status": {"pressure": 3.5}}}`))
+	req = req.WithContext(setURLParam(req.Context(), "twinID", "pump-1"))
+	w = httptest.NewRecorder()
+	server.IngestTelemetry(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Failed to ingest telemetry: %d %s", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/shadows/pump-1-shadow/report", nil)
+	req = req.WithContext(setURLParam(req.Context(), "shadowID", "pump-1-shadow"))
+	w = httptest.NewRecorder()
+	server.GetShadowReport(w, req)
+
+	var report shadow.Report
+	json.Unmarshal(w.Body.Bytes(), &report)
+	if w.Code != http.StatusOK || report.Mirrored != 1 || report.Properties != 1 || len(report.Differences) != 0 {
+		t.Errorf("Unexpected report %d %s", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest("DELETE", "/shadows/pump-1-shadow", nil)
+	req = req.WithContext(setURLParam(req.Context(), "shadowID", "pump-1-shadow"))
+	w = httptest.NewRecorder()
+	server.DeleteShadow(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/shadows/pump-1-shadow", nil)
+	req = req.WithContext(setURLParam(req.Context(), "shadowID", "pump-1-shadow"))
+	w = httptest.NewRecorder()
+	server.GetShadow(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
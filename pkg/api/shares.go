@@ -0,0 +1,155 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/auth"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/share"
+	"github.com/go-chi/chi/v5"
+)
+
+// Share link handlers
+
+// CreateShare handles POST /twins/{twinID}/shares.
+// The token of the created link is only returned in this response. Links
+// created with a scoped token grant no more than the token: its verbs must
+// include those of the link's scope, and the link expires with the token.
+func (s *Server) CreateShare(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	twinID := chi.URLParam(r, "twinID")
+	if twinID == "" {
+		respondError(w, http.StatusBadRequest, "Twin ID is required")
+		return
+	}
+
+	var req struct {
+		Scope string `json:"scope"`
+		TTL   string `json:"ttl"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	if req.Scope == "" {
+		req.Scope = string(share.ScopeRead)
+	}
+
+	ttl, err := time.ParseDuration(req.TTL)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid ttl: "+err.Error())
+		return
+	}
+
+	if id := auth.FromContext(r.Context()); id != nil && id.Scope != nil {
+		verbs := []auth.Verb{auth.VerbRead}
+		if share.Scope(req.Scope) == share.ScopeWrite {
+			verbs = append(verbs, auth.VerbWrite)
+		}
+		if !s.authorizeTwin(w, r, twinID, verbs...) {
+			return
+		}
+		if remaining := time.Until(id.ExpiresAt); ttl > remaining {
+			ttl = remaining
+		}
+	}
+
+	if _, err := s.Twins.Get(twinID); err != nil {
+		if err == registry.ErrTwinNotFound {
+			respondError(w, http.StatusNotFound, "Digital twin not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to get digital twin: "+err.Error())
+		}
+		return
+	}
+
+	link, err := s.Shares.Create(twinID, share.Scope(req.Scope), ttl)
+	if err != nil {
+		if errors.Is(err, share.ErrInvalidLink) {
+			respondError(w, http.StatusBadRequest, err.Error())
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to create share link: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, link)
+}
+
+// ListShares handles GET /twins/{twinID}/shares
+func (s *Server) ListShares(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	twinID := chi.URLParam(r, "twinID")
+	if twinID == "" {
+		respondError(w, http.StatusBadRequest, "Twin ID is required")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, s.Shares.List(twinID))
+}
+
+// RevokeShare handles DELETE /twins/{twinID}/shares/{shareID}
+func (s *Server) RevokeShare(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	twinID := chi.URLParam(r, "twinID")
+	shareID := chi.URLParam(r, "shareID")
+
+	if twinID == "" || shareID == "" {
+		respondError(w, http.StatusBadRequest, "Twin ID and Share ID are required")
+		return
+	}
+
+	if err := s.Shares.Revoke(twinID, shareID); err != nil {
+		if err == share.ErrLinkNotFound {
+			respondError(w, http.StatusNotFound, "Share link not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to revoke share link: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Share link revoked"})
+}
+
+// shareUserPrefix precedes the link ID in the user of share link requests
+const shareUserPrefix = "share:"
+
+// shareAccess authorizes requests under /shared/{token}. It verifies the token,
+// checks that its scope allows the request method and exposes the shared twin
+// as the twinID URL parameter, so that the regular twin handlers can serve it.
+// Requests are made as the user share:<link ID>, which replaces any X-User
+// header, so that audit logs and modifiers name the link.
+func (s *Server) shareAccess(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		link, err := s.Shares.Verify(chi.URLParam(r, "token"))
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		scope := share.ScopeWrite
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			scope = share.ScopeRead
+		}
+
+		if !link.Allows(scope) {
+			respondError(w, http.StatusForbidden, "Share link does not allow "+string(scope)+" access")
+			return
+		}
+
+		chi.RouteContext(r.Context()).URLParams.Add("twinID", link.TwinID)
+		r.Header.Set(UserHeader, shareUserPrefix+link.ID)
+		next.ServeHTTP(w, r)
+	})
+}
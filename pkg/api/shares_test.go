@@ -0,0 +1,103 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/share"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestShareLinks(t *testing.T) {
+	server := setupTestServer()
+
+	dt := twin.NewDigitalTwin("machine-1", "machine")
+	status := twin.NewFeatureState()
+	status.SetProperty("state", "running")
+	dt.AddFeature("status", status)
+	server.Registry.Create(dt)
+	server.Registry.Create(twin.NewDigitalTwin("machine-2", "machine"))
+
+	createShare := func(scope, ttl string) *httptest.ResponseRecorder {
+		jsonData, _ := json.Marshal(map[string]string{"scope": scope, "ttl": ttl})
+		req := httptest.NewRequest("POST", "/twins/machine-1/shares", bytes.NewBuffer(jsonData))
+		req = req.WithContext(setURLParam(req.Context(), "twinID", "machine-1"))
+
+		w := httptest.NewRecorder()
+		server.CreateShare(w, req)
+		return w
+	}
+
+	w := createShare("read", "1h")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d", http.StatusCreated, w.Code)
+	}
+
+	var link share.Link
+	json.NewDecoder(w.Body).Decode(&link)
+
+	if w := createShare("admin", "1h"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	// The share link grants read access to the shared twin through the router
+	serve := func(method, path string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBuffer(body))
+		w := httptest.NewRecorder()
+		server.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	w = serve("GET", "/shared/"+link.Token+"/features/status/properties/state", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var state string
+	json.NewDecoder(w.Body).Decode(&state)
+	if state != "running" {
+		t.Errorf("Expected state running, got %s", state)
+	}
+
+	// Read links do not allow writing
+	if w := serve("PUT", "/shared/"+link.Token+"/features/status/properties/state", []byte(`"stopped"`)); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, got %d", http.StatusForbidden, w.Code)
+	}
+
+	// Invalid tokens are rejected
+	if w := serve("GET", "/shared/invalid/", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	// Write links allow updating properties
+	var writeLink share.Link
+	json.NewDecoder(createShare("write", "10m").Body).Decode(&writeLink)
+
+	if w := serve("PUT", "/shared/"+writeLink.Token+"/features/status/properties/state", []byte(`"stopped"`)); w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	dt, _ = server.Registry.Get("machine-1")
+	status, _ = dt.GetFeature("status")
+	if val, _ := status.GetProperty("state"); val != "stopped" {
+		t.Errorf("Expected state stopped, got %v", val)
+	}
+
+	// Revoked links stop working
+	req := httptest.NewRequest("DELETE", "/twins/machine-1/shares/"+link.ID, nil)
+	req = req.WithContext(setURLParam(req.Context(), "twinID", "machine-1"))
+	req = req.WithContext(setURLParam(req.Context(), "shareID", link.ID))
+	w = httptest.NewRecorder()
+	server.RevokeShare(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	if w := serve("GET", "/shared/"+link.Token+"/", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
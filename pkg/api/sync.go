@@ -0,0 +1,46 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/aleka07/go-digital-twin/pkg/reconcile"
+	"github.com/aleka07/go-digital-twin/pkg/webhook"
+)
+
+// Asset master synchronization handlers
+
+// SyncTwins handles POST /sync.
+// The request carries the authoritative asset list of an external system
+// together with the reconciliation options and returns a reconciliation report.
+func (s *Server) SyncTwins(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	var req struct {
+		Assets []reconcile.Asset `json:"assets"`
+		reconcile.Options
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	report := reconcile.Reconcile(s.Registry, req.Assets, req.Options)
+
+	// Publish events for the applied changes
+	if !report.DryRun {
+		for _, id := range report.Created {
+			s.PubSub.Publish("twin.created", map[string]string{"id": id})
+		}
+		for _, id := range report.Updated {
+			s.PubSub.Publish("twin.updated", map[string]string{"id": id})
+		}
+		for _, id := range report.Deactivated {
+			s.PubSub.Publish(webhook.Topic(webhook.EventDecommissioned), map[string]string{"id": id})
+		}
+	}
+
+	respondJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/reconcile"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestSyncTwins(t *testing.T) {
+	server := setupTestServer()
+	server.Registry.Create(twin.NewDigitalTwin("old-pump", "pump"))
+
+	events := server.PubSub.Subscribe("twin.created")
+
+	body := map[string]interface{}{
+		"assets": []map[string]interface{}{
+			{"id": "pump-1", "type": "pump", "attributes": map[string]interface{}{"serial": "SN-1"}},
+		},
+		"deactivateAbsent": true,
+	}
+
+	jsonData, _ := json.Marshal(body)
+	req := httptest.NewRequest("POST", "/sync", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	server.SyncTwins(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var report reconcile.Report
+	json.NewDecoder(w.Body).Decode(&report)
+
+	if len(report.Created) != 1 || len(report.Deactivated) != 1 || report.Deactivated[0] != "old-pump" {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+
+	if msg := <-events; msg.Payload.(map[string]string)["id"] != "pump-1" {
+		t.Errorf("Expected twin.created event for pump-1, got %v", msg.Payload)
+	}
+
+	// Invalid bodies are rejected
+	req = httptest.NewRequest("POST", "/sync", bytes.NewBufferString("{"))
+	w = httptest.NewRecorder()
+	server.SyncTwins(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
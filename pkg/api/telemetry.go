@@ -0,0 +1,149 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/aleka07/go-digital-twin/pkg/ingest"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/schema"
+	"github.com/aleka07/go-digital-twin/pkg/valuesize"
+	"github.com/go-chi/chi/v5"
+)
+
+// Telemetry ingestion handlers
+
+// IngestTelemetry handles POST /twins/{twinID}/telemetry.
+// The message ID used for deduplication may be given in the body or in the
+// X-Message-Id header.
+func (s *Server) IngestTelemetry(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	twinID := chi.URLParam(r, "twinID")
+	if twinID == "" {
+		respondError(w, http.StatusBadRequest, "Twin ID is required")
+		return
+	}
+
+	var telemetry ingest.Telemetry
+	if err := json.NewDecoder(r.Body).Decode(&telemetry); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	telemetry.TwinID = twinID
+	if telemetry.MessageID == "" {
+		telemetry.MessageID = r.Header.Get("X-Message-Id")
+	}
+
+	result, err := s.Ingester.Apply(telemetry)
+	if err != nil {
+		if s.respondShed(w, err) {
+			return
+		}
+		switch {
+		case err == registry.ErrTwinNotFound:
+			respondError(w, http.StatusNotFound, "Digital twin not found")
+		case err == ingest.ErrEmptyTelemetry:
+			respondError(w, http.StatusBadRequest, "Telemetry contains no properties")
+		case errors.Is(err, valuesize.ErrTooLarge):
+			respondError(w, http.StatusRequestEntityTooLarge, err.Error())
+		case errors.Is(err, ingest.ErrTransformFailed), errors.Is(err, schema.ErrViolation):
+			respondError(w, http.StatusUnprocessableEntity, err.Error())
+		default:
+			respondError(w, http.StatusInternalServerError, "Failed to ingest telemetry: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, result)
+}
+
+// lateRequest is the request body for setting a late policy
+type lateRequest struct {
+	LatePolicy string `json:"latePolicy"`
+}
+
+// decodeLatePolicy reads and validates a late policy from the request body
+func decodeLatePolicy(w http.ResponseWriter, r *http.Request) (ingest.LatePolicy, bool) {
+	var req lateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return "", false
+	}
+
+	policy, err := ingest.ParseLatePolicy(req.LatePolicy)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return "", false
+	}
+
+	return policy, true
+}
+
+// GetLatePolicies handles GET /ingest/policies
+func (s *Server) GetLatePolicies(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	def, policies := s.Ingester.LatePolicies()
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"default":    def,
+		"properties": policies,
+	})
+}
+
+// SetDefaultLatePolicy handles PUT /ingest/policies/default
+func (s *Server) SetDefaultLatePolicy(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	policy, ok := decodeLatePolicy(w, r)
+	if !ok {
+		return
+	}
+
+	s.Ingester.SetDefaultLatePolicy(policy)
+	respondJSON(w, http.StatusOK, lateRequest{LatePolicy: string(policy)})
+}
+
+// SetLatePolicy handles PUT /ingest/policies/{featureID}/{propKey}
+func (s *Server) SetLatePolicy(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	featureID := chi.URLParam(r, "featureID")
+	propKey := chi.URLParam(r, "propKey")
+
+	if featureID == "" || propKey == "" {
+		respondError(w, http.StatusBadRequest, "Feature ID and Property Key are required")
+		return
+	}
+
+	policy, ok := decodeLatePolicy(w, r)
+	if !ok {
+		return
+	}
+
+	s.Ingester.SetLatePolicy(featureID, propKey, policy)
+	respondJSON(w, http.StatusOK, lateRequest{LatePolicy: string(policy)})
+}
+
+// DeleteLatePolicy handles DELETE /ingest/policies/{featureID}/{propKey}
+func (s *Server) DeleteLatePolicy(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	featureID := chi.URLParam(r, "featureID")
+	propKey := chi.URLParam(r, "propKey")
+
+	if featureID == "" || propKey == "" {
+		respondError(w, http.StatusBadRequest, "Feature ID and Property Key are required")
+		return
+	}
+
+	s.Ingester.RemoveLatePolicy(featureID, propKey)
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Late policy removed"})
+}
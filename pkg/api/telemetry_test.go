@@ -0,0 +1,124 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestIngestTelemetry(t *testing.T) {
+	server := setupTestServer()
+	server.Registry.Create(twin.NewDigitalTwin("telemetry-twin", "machine"))
+
+	send := func(twinID, messageID string, body map[string]interface{}) *httptest.ResponseRecorder {
+		jsonData, _ := json.Marshal(body)
+		req := httptest.NewRequest("POST", "/twins/"+twinID+"/telemetry", bytes.NewBuffer(jsonData))
+		req.Header.Set("Content-Type", "application/json")
+		if messageID != "" {
+			req.Header.Set("X-Message-Id", messageID)
+		}
+		req = req.WithContext(setURLParam(req.Context(), "twinID", twinID))
+
+		w := httptest.NewRecorder()
+		server.IngestTelemetry(w, req)
+		return w
+	}
+
+	body := map[string]interface{}{
+		"features": map[string]interface{}{
+			"counter": map[string]interface{}{"parts": 10},
+		},
+	}
+
+	// First delivery is applied
+	w := send("telemetry-twin", "msg-1", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var result map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&result)
+	if result["duplicate"] != false || result["applied"] != 1.0 {
+		t.Errorf("Expected one applied value, got %v", result)
+	}
+
+	// A retry with the same message ID is acknowledged but ignored
+	body["features"] = map[string]interface{}{"counter": map[string]interface{}{"parts": 20}}
+	w = send("telemetry-twin", "msg-1", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	json.NewDecoder(w.Body).Decode(&result)
+	if result["duplicate"] != true {
+		t.Errorf("Expected duplicate result, got %v", result)
+	}
+
+	dt, _ := server.Registry.Get("telemetry-twin")
+	feature, _ := dt.GetFeature("counter")
+	if val, _ := feature.GetProperty("parts"); val != 10.0 {
+		t.Errorf("Expected parts to remain 10, got %v", val)
+	}
+
+	// Unknown twins and empty batches are rejected
+	if w := send("unknown-twin", "", body); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	if w := send("telemetry-twin", "", map[string]interface{}{}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestLatePolicyManagement(t *testing.T) {
+	server := setupTestServer()
+
+	setPolicy := func(featureID, propKey, policy string) *httptest.ResponseRecorder {
+		jsonData, _ := json.Marshal(map[string]string{"latePolicy": policy})
+		req := httptest.NewRequest("PUT", "/ingest/policies/"+featureID+"/"+propKey, bytes.NewBuffer(jsonData))
+		req = req.WithContext(setURLParam(req.Context(), "featureID", featureID))
+		req = req.WithContext(setURLParam(req.Context(), "propKey", propKey))
+
+		w := httptest.NewRecorder()
+		server.SetLatePolicy(w, req)
+		return w
+	}
+
+	if w := setPolicy("counter", "parts", "drop"); w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	if w := setPolicy("counter", "parts", "later"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	req := httptest.NewRequest("GET", "/ingest/policies", nil)
+	w := httptest.NewRecorder()
+	server.GetLatePolicies(w, req)
+
+	var policies struct {
+		Default    string            `json:"default"`
+		Properties map[string]string `json:"properties"`
+	}
+	json.NewDecoder(w.Body).Decode(&policies)
+
+	if policies.Default != "historyOnly" || policies.Properties["counter/parts"] != "drop" {
+		t.Errorf("Unexpected policies: %+v", policies)
+	}
+
+	// Remove the policy again
+	req = httptest.NewRequest("DELETE", "/ingest/policies/counter/parts", nil)
+	req = req.WithContext(setURLParam(req.Context(), "featureID", "counter"))
+	req = req.WithContext(setURLParam(req.Context(), "propKey", "parts"))
+
+	w = httptest.NewRecorder()
+	server.DeleteLatePolicy(w, req)
+
+	if p := server.Ingester.LatePolicy("counter", "parts"); p != "historyOnly" {
+		t.Errorf("Expected default policy after removal, got %s", p)
+	}
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/eventbus"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+	"github.com/aleka07/go-digital-twin/pkg/txn"
+)
+
+// MaxTransactionTwins is the largest number of twins in a single transaction
+const MaxTransactionTwins = 1000
+
+// Transaction handlers
+
+// ReadTransaction handles POST /twins/read-transaction.
+// All twins are read at the same registry version, so that no change is
+// committed between reading one twin and the next.
+func (s *Server) ReadTransaction(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	var req struct {
+		IDs []string `json:"ids"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	if len(req.IDs) == 0 || len(req.IDs) > MaxTransactionTwins {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("Between 1 and %d twin IDs are required", MaxTransactionTwins))
+		return
+	}
+
+	seen := make(map[string]bool, len(req.IDs))
+	for _, id := range req.IDs {
+		if id == "" || seen[id] {
+			respondError(w, http.StatusBadRequest, "Twin IDs must be non-empty and unique")
+			return
+		}
+		seen[id] = true
+	}
+
+	twins, version, err := s.Twins.Snapshot(req.IDs)
+	if err != nil {
+		if errors.Is(err, registry.ErrTwinNotFound) {
+			respondError(w, http.StatusNotFound, err.Error())
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to read digital twins: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"version": version,
+		"readAt":  time.Now(),
+		"twins":   twinsBody(r, twins),
+	})
+}
+
+// Transaction handles POST /transactions.
+// The mutations are applied atomically; events for the changed twins are
+// published after the transaction commits.
+func (s *Server) Transaction(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	var req struct {
+		Mutations []txn.Mutation `json:"mutations"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	result, err := txn.Apply(s.Registry, req.Mutations)
+	if err != nil {
+		switch {
+		case errors.Is(err, txn.ErrInvalidMutation), errors.Is(err, twin.ErrInvalidRelationship):
+			respondError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, registry.ErrRevisionConflict), errors.Is(err, registry.ErrTwinAlreadyExists):
+			respondError(w, http.StatusConflict, err.Error())
+		case errors.Is(err, registry.ErrTwinNotFound), errors.Is(err, twin.ErrRelationshipNotFound):
+			respondError(w, http.StatusNotFound, err.Error())
+		default:
+			respondError(w, http.StatusInternalServerError, "Failed to apply transaction: "+err.Error())
+		}
+		return
+	}
+
+	// Properties set per twin and feature, in mutation order
+	properties := make(map[string]map[string]map[string]interface{})
+	for _, m := range req.Mutations {
+		if m.Op != txn.OpSetProperties {
+			continue
+		}
+		if properties[m.TwinID] == nil {
+			properties[m.TwinID] = make(map[string]map[string]interface{})
+		}
+		if properties[m.TwinID][m.Feature] == nil {
+			properties[m.TwinID][m.Feature] = make(map[string]interface{})
+		}
+		for k, v := range m.Properties {
+			properties[m.TwinID][m.Feature][k] = v
+		}
+	}
+
+	// Publish events
+	now := s.Clock().Now()
+	for _, c := range result.Changes {
+		switch {
+		case c.Deleted:
+			s.forgetTwin(r.Context(), c.TwinID)
+			s.PubSub.Publish("twin.deleted", map[string]string{"id": c.TwinID})
+			continue
+		case c.Created:
+			s.PubSub.Publish("twin.created", map[string]string{"id": c.TwinID})
+		case c.Updated:
+			s.PubSub.Publish("twin.updated", map[string]string{"id": c.TwinID})
+		}
+
+		for _, featureID := range c.Features {
+			props := properties[c.TwinID][featureID]
+			for k, v := range props {
+				s.History.Record(c.TwinID, featureID, k, v, now)
+			}
+
+			s.PubSub.Publish("properties.updated", eventbus.PropertiesUpdated{
+				TwinID:     c.TwinID,
+				FeatureID:  featureID,
+				Properties: props,
+			})
+		}
+	}
+
+	respondJSON(w, http.StatusOK, result)
+}
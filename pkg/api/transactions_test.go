@@ -0,0 +1,111 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestReadTransaction(t *testing.T) {
+	server := setupTestServer()
+	server.Registry.Create(twin.NewDigitalTwin("gateway-1", "gateway"))
+	server.Registry.Create(twin.NewDigitalTwin("gateway-2", "gateway"))
+
+	read := func(ids []string) *httptest.ResponseRecorder {
+		jsonData, _ := json.Marshal(map[string]interface{}{"ids": ids})
+		req := httptest.NewRequest("POST", "/twins/read-transaction", bytes.NewBuffer(jsonData))
+		w := httptest.NewRecorder()
+		server.ReadTransaction(w, req)
+		return w
+	}
+
+	w := read([]string{"gateway-2", "gateway-1"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var result struct {
+		Version uint64              `json:"version"`
+		Twins   []*twin.DigitalTwin `json:"twins"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &result)
+
+	if result.Version != server.Registry.Version() {
+		t.Errorf("Expected version %d, got %d", server.Registry.Version(), result.Version)
+	}
+	if len(result.Twins) != 2 || result.Twins[0].ID != "gateway-2" || result.Twins[1].ID != "gateway-1" {
+		t.Errorf("Expected twins in request order, got %v", result.Twins)
+	}
+
+	if w := read([]string{"gateway-1", "missing"}); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+	if w := read(nil); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w := read([]string{"gateway-1", "gateway-1"}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestTransaction(t *testing.T) {
+	server := setupTestServer()
+	server.Registry.Create(twin.NewDigitalTwin("gateway-1", "gateway"))
+	server.Registry.Create(twin.NewDigitalTwin("gateway-2", "gateway"))
+	server.Registry.Create(twin.NewDigitalTwin("device-1", "device"))
+
+	events := server.PubSub.Subscribe("#")
+
+	apply := func(mutations []map[string]interface{}) *httptest.ResponseRecorder {
+		jsonData, _ := json.Marshal(map[string]interface{}{"mutations": mutations})
+		req := httptest.NewRequest("POST", "/transactions", bytes.NewBuffer(jsonData))
+		w := httptest.NewRecorder()
+		server.Transaction(w, req)
+		return w
+	}
+
+	w := apply([]map[string]interface{}{
+		{"op": "addRelationship", "twinId": "gateway-2", "name": "hosts", "target": "device-1", "ifRevision": 1},
+		{"op": "setProperties", "twinId": "device-1", "feature": "link", "properties": map[string]interface{}{"gateway": "gateway-2"}},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	topics := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		select {
+		case msg := <-events:
+			topics[msg.Topic] = true
+		case <-time.After(time.Second):
+			t.Fatal("Expected transaction events")
+		}
+	}
+	if !topics["twin.updated"] || !topics["properties.updated"] {
+		t.Errorf("Expected twin.updated and properties.updated events, got %v", topics)
+	}
+
+	if values := server.History.Query("device-1", "link", "gateway", time.Time{}, time.Time{}); len(values) != 1 {
+		t.Errorf("Expected property history to be recorded, got %v", values)
+	}
+
+	// The revision of gateway-2 has moved on
+	w = apply([]map[string]interface{}{
+		{"op": "removeRelationship", "twinId": "gateway-2", "name": "hosts", "target": "device-1", "ifRevision": 1},
+	})
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d, got %d", http.StatusConflict, w.Code)
+	}
+
+	if w := apply([]map[string]interface{}{{"op": "delete", "twinId": "missing"}}); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+	if w := apply(nil); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/aleka07/go-digital-twin/pkg/reshape"
+)
+
+// TestTransform handles POST /transforms/test, evaluating a jq-style
+// expression, as used by the transforms of topic mappings and webhooks,
+// for a sample input
+func (s *Server) TestTransform(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	var req struct {
+		Expression string      `json:"expression"`
+		Input      interface{} `json:"input"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	expr, err := reshape.Compile(req.Expression)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	output, err := expr.Eval(req.Input)
+	if err != nil {
+		respondError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"output": output})
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTestTransform(t *testing.T) {
+	server := setupTestServer()
+
+	serve := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", APIPrefix+"/transforms/test", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		server.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve(`{"expression": "{temperature: (.t / 10), running: (.st == \"RUN\")}", "input": {"t": 215, "st": "RUN"}}`)
+	var result struct {
+		Output map[string]interface{} `json:"output"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if w.Code != http.StatusOK || result.Output["temperature"] != 21.5 || result.Output["running"] != true {
+		t.Fatalf("Failed to test transform: %d %s", w.Code, w.Body.String())
+	}
+
+	for _, tc := range []struct {
+		body string
+		code int
+	}{
+		{`{"expression": "{a: ", "input": {}}`, http.StatusBadRequest},
+		{`{"expression": ".t + \"x\"", "input": {"t": 1}}`, http.StatusUnprocessableEntity},
+		{`{"expression": `, http.StatusBadRequest},
+	} {
+		if w := serve(tc.body); w.Code != tc.code {
+			t.Errorf("%s: expected status code %d, got %d %s", tc.body, tc.code, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package api
+
+import (
+	"bytes"
+	"container/list"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// Defaults for the twin cache
+const (
+	DefaultTwinCacheSize = 10000     // Twins whose encoding is cached
+	maxCachedTwin        = 256 << 10 // Larger encodings are not cached
+)
+
+// TwinCacheStats count the lookups of the twin cache
+type TwinCacheStats struct {
+	Size    int    `json:"size"`    // Twins with a cached encoding
+	Entries int    `json:"entries"` // Twins tracked per API version, including those read only once
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+}
+
+// twinKey identifies the encoding of a twin in one API version
+type twinKey struct {
+	id      string
+	version int
+}
+
+// cachedTwin is the encoding of a twin at one revision
+type cachedTwin struct {
+	key        twinKey
+	revision   uint64
+	modifiedAt time.Time // Tells apart twins recreated with the same ID
+	body       []byte    // Nil until the twin is read twice at this revision
+}
+
+// twinCache keeps the JSON encoding of rarely changing twins, so that
+// GET /twins/{id} can skip encoding them. A twin is encoded into the cache
+// the second time it is read at the same revision; twins that change more
+// often than they are read are never cached. Entries are dropped least
+// recently used first. Each API version is cached separately.
+type twinCache struct {
+	capacity int
+	entries  map[twinKey]*list.Element
+	lru      *list.List
+	size     int
+	hits     uint64
+	misses   uint64
+	mutex    sync.Mutex
+}
+
+// newTwinCache creates a twin cache for up to capacity twins; zero disables it
+func newTwinCache(capacity int) *twinCache {
+	return &twinCache{
+		capacity: capacity,
+		entries:  make(map[twinKey]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+// get returns the cached encoding of a twin at its current revision in an
+// API version, or nil if the caller has to encode it. When remember is true
+// on return, the caller should store the encoding with put.
+func (c *twinCache) get(dt *twin.DigitalTwin, version int) (body []byte, remember bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.capacity <= 0 {
+		return nil, false
+	}
+
+	key := twinKey{id: dt.ID, version: version}
+	revision, modifiedAt := dt.GetRevision(), dt.GetModifiedAt()
+	if e, exists := c.entries[key]; exists {
+		entry := e.Value.(*cachedTwin)
+		c.lru.MoveToFront(e)
+		if entry.revision == revision && entry.modifiedAt.Equal(modifiedAt) {
+			if entry.body != nil {
+				c.hits++
+				return entry.body, false
+			}
+			c.misses++
+			return nil, true
+		}
+
+		// The twin changed since it was last read
+		c.drop(entry)
+		*entry = cachedTwin{key: key, revision: revision, modifiedAt: modifiedAt}
+		c.misses++
+		return nil, false
+	}
+
+	c.entries[key] = c.lru.PushFront(&cachedTwin{key: key, revision: revision, modifiedAt: modifiedAt})
+	for c.lru.Len() > c.capacity {
+		oldest := c.lru.Back()
+		entry := oldest.Value.(*cachedTwin)
+		c.drop(entry)
+		c.lru.Remove(oldest)
+		delete(c.entries, entry.key)
+	}
+	c.misses++
+	return nil, false
+}
+
+// put stores the encoding of a twin at the given revision, unless the twin
+// has changed or was dropped in the meantime
+func (c *twinCache) put(key twinKey, revision uint64, modifiedAt time.Time, body []byte) {
+	if len(body) > maxCachedTwin {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	e, exists := c.entries[key]
+	if !exists {
+		return
+	}
+	entry := e.Value.(*cachedTwin)
+	if entry.revision == revision && entry.modifiedAt.Equal(modifiedAt) && entry.body == nil {
+		entry.body = body
+		c.size++
+	}
+}
+
+// drop forgets the encoding of an entry; the caller must hold the mutex
+func (c *twinCache) drop(entry *cachedTwin) {
+	if entry.body != nil {
+		entry.body = nil
+		c.size--
+	}
+}
+
+// stats returns the counters of the cache
+func (c *twinCache) stats() TwinCacheStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return TwinCacheStats{Size: c.size, Entries: c.lru.Len(), Hits: c.hits, Misses: c.misses}
+}
+
+// SetTwinCacheSize sets how many twins GET /twins/{id} keeps encoded,
+// dropping all cached encodings; zero disables the cache
+func (s *Server) SetTwinCacheSize(capacity int) {
+	cache := newTwinCache(capacity)
+
+	s.twinCacheMutex.Lock()
+	s.twinCache = cache
+	s.twinCacheMutex.Unlock()
+}
+
+// TwinCacheStats returns the counters of the twin cache
+func (s *Server) TwinCacheStats() TwinCacheStats {
+	s.twinCacheMutex.RLock()
+	cache := s.twinCache
+	s.twinCacheMutex.RUnlock()
+
+	return cache.stats()
+}
+
+// respondTwin sends a twin as JSON in the API version of the request, from
+// the twin cache when possible
+func (s *Server) respondTwin(w http.ResponseWriter, r *http.Request, dt *twin.DigitalTwin) {
+	s.twinCacheMutex.RLock()
+	cache := s.twinCache
+	s.twinCacheMutex.RUnlock()
+
+	version := APIVersion(r)
+	body, remember := cache.get(dt, version)
+	if body == nil {
+		// Encode a copy so that the encoding matches a single revision
+		c := dt.Clone()
+		var buf bytes.Buffer
+		if err := encodeJSON(&buf, twinBody(r, c)); err != nil {
+			respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		body = buf.Bytes()
+		if remember {
+			cache.put(twinKey{id: c.ID, version: version}, c.Revision, c.ModifiedAt, body)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// GetTwinCacheStats handles GET /admin/twin-cache
+func (s *Server) GetTwinCacheStats(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	respondJSON(w, http.StatusOK, s.TwinCacheStats())
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestTwinCache(t *testing.T) {
+	server := setupTestServer()
+	server.SetTwinCacheSize(1)
+
+	dt := twin.NewDigitalTwin("pump-1", "pump")
+	dt.SetAttribute("serial", "P-100")
+	server.Registry.Create(dt)
+	server.Registry.Create(twin.NewDigitalTwin("pump-2", "pump"))
+
+	get := func(id string) string {
+		req := httptest.NewRequest("GET", "/twins/"+id, nil)
+		req = req.WithContext(setURLParam(req.Context(), "twinID", id))
+		w := httptest.NewRecorder()
+		server.GetTwin(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+		}
+		return w.Body.String()
+	}
+
+	// The second read at the same revision is cached, the third is served from the cache
+	first := get("pump-1")
+	get("pump-1")
+	if cached := get("pump-1"); cached != first {
+		t.Errorf("Expected the cached body to match, got %s and %s", cached, first)
+	}
+	if stats := server.TwinCacheStats(); stats.Hits != 1 || stats.Size != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	// A new revision invalidates the cached body
+	dt.SetAttribute("serial", "P-200")
+	server.Registry.Update(dt)
+	get("pump-1")
+	if body := get("pump-1"); body == first {
+		t.Error("Expected the body of the new revision")
+	}
+	if stats := server.TwinCacheStats(); stats.Hits != 1 {
+		t.Errorf("Expected no further hits, got %+v", stats)
+	}
+
+	// Reading another twin drops the least recently used one
+	get("pump-2")
+	if stats := server.TwinCacheStats(); stats.Entries != 1 || stats.Size != 0 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	// A twin recreated with the same ID is not served from the cache
+	get("pump-2")
+	get("pump-2")
+	server.Registry.Delete("pump-2")
+	server.Registry.Create(twin.NewDigitalTwin("pump-2", "valve"))
+	if stats := server.TwinCacheStats(); stats.Hits != 2 {
+		t.Fatalf("Unexpected stats %+v", stats)
+	}
+	get("pump-2")
+	if stats := server.TwinCacheStats(); stats.Hits != 2 {
+		t.Errorf("Expected the recreated twin to miss, got %+v", stats)
+	}
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/query"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// serverTwins are the twins of the components a server creates, such as
+// the ingester and the views. Every call goes through Server.Twins, so that
+// replacing it is not bypassed by components created before.
+type serverTwins struct {
+	s *Server
+}
+
+func (t serverTwins) Create(dt *twin.DigitalTwin) error {
+	return t.s.Twins.Create(dt)
+}
+
+func (t serverTwins) Get(id string) (*twin.DigitalTwin, error) {
+	return t.s.Twins.Get(id)
+}
+
+func (t serverTwins) Update(dt *twin.DigitalTwin) error {
+	return t.s.Twins.Update(dt)
+}
+
+func (t serverTwins) Delete(id string) error {
+	return t.s.Twins.Delete(id)
+}
+
+func (t serverTwins) Snapshot(ids []string) ([]*twin.DigitalTwin, uint64, error) {
+	return t.s.Twins.Snapshot(ids)
+}
+
+func (t serverTwins) Version() uint64 {
+	return t.s.Twins.Version()
+}
+
+func (t serverTwins) List() []*twin.DigitalTwin {
+	return t.s.Twins.List()
+}
+
+func (t serverTwins) Count() int {
+	return t.s.Twins.Count()
+}
+
+func (t serverTwins) Find(q *query.Query) []*twin.DigitalTwin {
+	return t.s.Twins.Find(q)
+}
+
+func (t serverTwins) ModifiedBetween(since, before time.Time) []*twin.DigitalTwin {
+	return t.s.Twins.ModifiedBetween(since, before)
+}
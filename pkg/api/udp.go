@@ -0,0 +1,20 @@
+package api
+
+import (
+	"net/http"
+)
+
+// UDP telemetry handlers
+
+// GetUDPStats handles GET /ingest/udp
+func (s *Server) GetUDPStats(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	if s.UDP == nil {
+		respondError(w, http.StatusServiceUnavailable, "UDP listener is not enabled")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, s.UDP.Stats())
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/ingest"
+)
+
+func TestGetUDPStats(t *testing.T) {
+	server := setupTestServer()
+
+	req := httptest.NewRequest("GET", "/ingest/udp", nil)
+	w := httptest.NewRecorder()
+	server.GetUDPStats(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+
+	var err error
+	server.UDP, err = ingest.ListenUDP(server.Ingester, "127.0.0.1:0", ingest.UDPOptions{})
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go server.UDP.Serve(ctx)
+
+	w = httptest.NewRecorder()
+	server.GetUDPStats(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var stats ingest.UDPStats
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if stats.Received != 0 {
+		t.Errorf("Expected no datagrams, got %d", stats.Received)
+	}
+}
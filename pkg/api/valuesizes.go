@@ -0,0 +1,122 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/aleka07/go-digital-twin/pkg/attachment"
+	"github.com/aleka07/go-digital-twin/pkg/valuesize"
+	"github.com/go-chi/chi/v5"
+)
+
+// Value size limit handlers
+
+// offloadValue stores an oversized property value as an attachment of its twin
+func (s *Server) offloadValue(ctx context.Context, twinID, name string, data []byte) (valuesize.Reference, error) {
+	meta, err := s.Attachments.Add(ctx, twinID, name, "application/json", "", data)
+	if err != nil {
+		if errors.Is(err, attachment.ErrTooLarge) {
+			return valuesize.Reference{}, fmt.Errorf("%w: %v", valuesize.ErrTooLarge, err)
+		}
+		return valuesize.Reference{}, err
+	}
+
+	// Publish event
+	s.PubSub.Publish("attachment.added", map[string]interface{}{
+		"twinId":       meta.TwinID,
+		"attachmentId": meta.ID,
+		"name":         meta.Name,
+		"contentType":  meta.ContentType,
+		"size":         meta.Size,
+	})
+
+	return valuesize.Reference{AttachmentID: meta.ID, Size: meta.Size, SHA256: meta.SHA256}, nil
+}
+
+// limitValueSizes enforces the size limits of properties about to be
+// written to a feature, replacing offloaded values in properties. It
+// responds and returns false if a value is rejected.
+func (s *Server) limitValueSizes(w http.ResponseWriter, r *http.Request, twinID, featureID string, properties map[string]interface{}) bool {
+	if _, err := s.ValueSizes.Enforce(r.Context(), twinID, featureID, properties); err != nil {
+		if errors.Is(err, valuesize.ErrTooLarge) {
+			respondError(w, http.StatusRequestEntityTooLarge, err.Error())
+		} else {
+			respondError(w, http.StatusInternalServerError, err.Error())
+		}
+		return false
+	}
+	return true
+}
+
+// decodeValueLimit reads and validates a limit from the request body
+func decodeValueLimit(w http.ResponseWriter, r *http.Request) (valuesize.Limit, bool) {
+	var limit valuesize.Limit
+	if err := json.NewDecoder(r.Body).Decode(&limit); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return valuesize.Limit{}, false
+	}
+	return limit, true
+}
+
+// GetValueLimits handles GET /value-limits
+func (s *Server) GetValueLimits(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"default":    s.ValueSizes.Default(),
+		"properties": s.ValueSizes.Limits(),
+	})
+}
+
+// SetDefaultValueLimit handles PUT /value-limits/default
+func (s *Server) SetDefaultValueLimit(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	limit, ok := decodeValueLimit(w, r)
+	if !ok {
+		return
+	}
+
+	limit, err := s.ValueSizes.SetDefault(limit)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, limit)
+}
+
+// SetValueLimit handles PUT /value-limits/{featureID}/{propKey}
+func (s *Server) SetValueLimit(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	limit, ok := decodeValueLimit(w, r)
+	if !ok {
+		return
+	}
+
+	limit, err := s.ValueSizes.Set(chi.URLParam(r, "featureID"), chi.URLParam(r, "propKey"), limit)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, limit)
+}
+
+// DeleteValueLimit handles DELETE /value-limits/{featureID}/{propKey}
+func (s *Server) DeleteValueLimit(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	if err := s.ValueSizes.Delete(chi.URLParam(r, "featureID"), chi.URLParam(r, "propKey")); err != nil {
+		respondError(w, http.StatusNotFound, "Value size limit not found")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Value size limit removed"})
+}
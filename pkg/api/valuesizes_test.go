@@ -0,0 +1,75 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/valuesize"
+)
+
+func TestValueSizeLimits(t *testing.T) {
+	server := setupTestServer()
+
+	serve := serveFunc(server, APIPrefix)
+
+	serve("POST", "/twins", `{"id": "cam-1", "type": "camera"}`)
+	serve("PUT", "/twins/cam-1/features/camera", `{"properties": {"fps": 25}}`)
+	if w := serve("PUT", "/value-limits/default", `{"maxBytes": 64}`); w.Code != http.StatusOK {
+		t.Fatalf("Failed to set default limit: %d %s", w.Code, w.Body.String())
+	}
+	if w := serve("PUT", "/value-limits/camera/frame", `{"maxBytes": 64, "action": "offload"}`); w.Code != http.StatusOK {
+		t.Fatalf("Failed to set limit: %d %s", w.Code, w.Body.String())
+	}
+
+	large := `"` + strings.Repeat("x", 100) + `"`
+	for _, tc := range []struct {
+		method, path, body string
+		code               int
+	}{
+		{"PUT", "/twins/cam-1/features/camera/properties/label", large, http.StatusRequestEntityTooLarge},
+		{"PUT", "/twins/cam-1/features/camera/properties", `{"label": ` + large + `}`, http.StatusRequestEntityTooLarge},
+		{"POST", "/twins/cam-1/telemetry", `{"features": {"camera": {"label": ` + large + `}}}`, http.StatusRequestEntityTooLarge},
+		{"PUT", "/value-limits/camera/frame", `{"maxBytes": -1}`, http.StatusBadRequest},
+		{"PUT", "/value-limits/default", `{"maxBytes": 64, "action": "truncate"}`, http.StatusBadRequest},
+	} {
+		if w := serve(tc.method, tc.path, tc.body); w.Code != tc.code {
+			t.Errorf("%s %s: expected status code %d, got %d %s", tc.method, tc.path, tc.code, w.Code, w.Body.String())
+		}
+	}
+
+	// Offloaded values become attachments referenced by the property
+	if w := serve("PUT", "/twins/cam-1/features/camera/properties/frame", large); w.Code != http.StatusOK {
+		t.Fatalf("Failed to offload value: %d %s", w.Code, w.Body.String())
+	}
+	dt, _ := server.Registry.Get("cam-1")
+	feature, _ := dt.GetFeature("camera")
+	value, _ := feature.GetProperty("frame")
+	id, ok := valuesize.Offloaded(value)
+	if !ok {
+		t.Fatalf("Expected a reference, got %v", value)
+	}
+	_, data, err := server.Attachments.Content(context.Background(), "cam-1", id)
+	if err != nil || string(data) != large {
+		t.Errorf("Expected the attachment to hold the value, got %s %v", data, err)
+	}
+
+	var limits struct {
+		Default    valuesize.Limit            `json:"default"`
+		Properties map[string]valuesize.Limit `json:"properties"`
+	}
+	w := serve("GET", "/value-limits", "")
+	json.Unmarshal(w.Body.Bytes(), &limits)
+	if limits.Default.MaxBytes != 64 || limits.Properties["camera/frame"].Action != valuesize.Offload {
+		t.Errorf("Unexpected limits %s", w.Body.String())
+	}
+
+	if w := serve("DELETE", "/value-limits/camera/frame", ""); w.Code != http.StatusOK {
+		t.Errorf("Failed to delete limit: %d", w.Code)
+	}
+	if w := serve("DELETE", "/value-limits/camera/frame", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a deleted limit, got %d", w.Code)
+	}
+}
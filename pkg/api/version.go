@@ -0,0 +1,142 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// API versioning
+
+// API versions. Breaking changes to representations or errors ship in a new
+// version; handlers branch on APIVersion where versions differ.
+const (
+	LegacyAPIVersion  = 0 // Unprefixed routes that predate versioning
+	CurrentAPIVersion = 1
+)
+
+// APIPrefix is the path prefix of the current API version
+const APIPrefix = "/api/v1"
+
+// APIVersionHeader is the request header negotiating the API version and the
+// response header reporting the version a request was served with
+const APIVersionHeader = "API-Version"
+
+// LegacyDeprecation is when the unprefixed legacy routes were deprecated in
+// favor of the versioned API, announced in their Deprecation header
+var LegacyDeprecation = time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC)
+
+// versionKey is the request context key of the API version
+type versionKey struct{}
+
+// APIVersion returns the API version a request is served with. Requests that
+// did not pass through the router, such as in handler tests, are served with
+// the legacy version.
+func APIVersion(r *http.Request) int {
+	if version, ok := r.Context().Value(versionKey{}).(int); ok {
+		return version
+	}
+	return LegacyAPIVersion
+}
+
+// apiPath returns a path under the prefix of the request's API version, for
+// Location headers pointing at other resources
+func apiPath(r *http.Request, path string) string {
+	if APIVersion(r) == LegacyAPIVersion {
+		return path
+	}
+	return versionPrefix(APIVersion(r)) + path
+}
+
+// versionPrefix returns the path prefix of an API version
+func versionPrefix(version int) string {
+	return "/api/v" + strconv.Itoa(version)
+}
+
+// parseAPIVersion parses the API-Version header, given as "1" or "v1", and
+// reports whether the version is served. Zero means the header was not set.
+func parseAPIVersion(header string) (int, bool) {
+	if header == "" {
+		return 0, true
+	}
+
+	version, err := strconv.Atoi(strings.TrimPrefix(strings.ToLower(strings.TrimSpace(header)), "v"))
+	if err != nil || version < 1 || version > CurrentAPIVersion {
+		return 0, false
+	}
+	return version, true
+}
+
+// respondUnsupportedVersion rejects a request for an API version that is not served
+func respondUnsupportedVersion(w http.ResponseWriter, header string) {
+	respondError(w, http.StatusBadRequest, fmt.Sprintf("Unsupported API version %q; the current version is %d", header, CurrentAPIVersion))
+}
+
+// SetLegacySunset sets when the legacy routes are going to be removed,
+// announced in their Sunset header; the zero time announces no date
+func (s *Server) SetLegacySunset(sunset time.Time) {
+	s.versionMutex.Lock()
+	defer s.versionMutex.Unlock()
+
+	s.legacySunset = sunset
+}
+
+// withVersion serves a request with an API version and reports it in the response
+func withVersion(w http.ResponseWriter, r *http.Request, version int) *http.Request {
+	if version != LegacyAPIVersion {
+		w.Header().Set(APIVersionHeader, strconv.Itoa(version))
+	}
+	return r.WithContext(context.WithValue(r.Context(), versionKey{}, version))
+}
+
+// versioned serves the routes under the prefix of an API version. Requests
+// asking for another version in the API-Version header are rejected, since
+// the path already selects the version.
+func (s *Server) versioned(version int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get(APIVersionHeader)
+			requested, ok := parseAPIVersion(header)
+			if !ok {
+				respondUnsupportedVersion(w, header)
+				return
+			}
+			if requested != 0 && requested != version {
+				respondError(w, http.StatusBadRequest, fmt.Sprintf("API version %d was requested from %s", requested, versionPrefix(version)))
+				return
+			}
+
+			next.ServeHTTP(w, withVersion(w, r, version))
+		})
+	}
+}
+
+// legacy serves the unprefixed routes. Their responses carry Deprecation,
+// Sunset and successor Link headers. Clients can opt into a versioned
+// representation before moving to the versioned paths by sending the
+// API-Version header.
+func (s *Server) legacy(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get(APIVersionHeader)
+		version, ok := parseAPIVersion(header)
+		if !ok {
+			respondUnsupportedVersion(w, header)
+			return
+		}
+
+		s.versionMutex.RLock()
+		sunset := s.legacySunset
+		s.versionMutex.RUnlock()
+
+		w.Header().Set("Deprecation", "@"+strconv.FormatInt(LegacyDeprecation.Unix(), 10))
+		if !sunset.IsZero() {
+			w.Header().Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+		}
+		w.Header().Add("Link", "<"+APIPrefix+r.URL.Path+`>; rel="successor-version"`)
+
+		next.ServeHTTP(w, withVersion(w, r, version))
+	})
+}
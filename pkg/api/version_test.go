@@ -0,0 +1,90 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestAPIVersions(t *testing.T) {
+	server := setupTestServer()
+	server.SetLegacySunset(time.Date(2027, time.June, 30, 0, 0, 0, 0, time.UTC))
+
+	serve := func(method, path, version string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		if version != "" {
+			req.Header.Set(APIVersionHeader, version)
+		}
+		w := httptest.NewRecorder()
+		server.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Versioned routes
+	w := serve("POST", "/api/v1/twins", "", []byte(`{"id": "pump-1", "type": "pump"}`))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	w = serve("GET", "/api/v1/twins/pump-1", "", nil)
+	if w.Code != http.StatusOK || w.Header().Get(APIVersionHeader) != "1" {
+		t.Errorf("Expected version 1 response, got %d with version %q", w.Code, w.Header().Get(APIVersionHeader))
+	}
+	if w.Header().Get("Deprecation") != "" {
+		t.Errorf("Expected no Deprecation header on versioned routes")
+	}
+	if w := serve("GET", "/api/v1/twins/pump-1", "v1", nil); w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d for a matching version, got %d", http.StatusOK, w.Code)
+	}
+	for _, version := range []string{"2", "latest"} {
+		if w := serve("GET", "/api/v1/twins/pump-1", version, nil); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d for version %q, got %d", http.StatusBadRequest, version, w.Code)
+		}
+	}
+
+	// Legacy routes serve the same twins with deprecation headers
+	w = serve("GET", "/twins/pump-1", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if got, want := w.Header().Get("Deprecation"), "@"+strconv.FormatInt(LegacyDeprecation.Unix(), 10); got != want {
+		t.Errorf("Expected Deprecation %q, got %q", want, got)
+	}
+	if got := w.Header().Get("Sunset"); got != "Wed, 30 Jun 2027 00:00:00 GMT" {
+		t.Errorf("Unexpected Sunset %q", got)
+	}
+	if got := w.Header().Get("Link"); got != `</api/v1/twins/pump-1>; rel="successor-version"` {
+		t.Errorf("Unexpected Link %q", got)
+	}
+	if got := w.Header().Get(APIVersionHeader); got != "" {
+		t.Errorf("Expected no version on legacy responses, got %q", got)
+	}
+
+	// Legacy routes can opt into a version
+	if w := serve("GET", "/twins/pump-1", "1", nil); w.Header().Get(APIVersionHeader) != "1" || w.Header().Get("Deprecation") == "" {
+		t.Errorf("Expected a deprecated version 1 response, got headers %v", w.Header())
+	}
+	if w := serve("GET", "/twins/pump-1", "3", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for an unsupported version, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	// Unversioned endpoints
+	if w := serve("GET", "/health", "", nil); w.Code != http.StatusOK || w.Header().Get("Deprecation") != "" {
+		t.Errorf("Expected the health check to stay unversioned, got %d %v", w.Code, w.Header())
+	}
+}
+
+func TestAPIPath(t *testing.T) {
+	req := httptest.NewRequest("GET", "/admin/backfill", nil)
+	if got := apiPath(req, "/admin/backfill/1"); got != "/admin/backfill/1" {
+		t.Errorf("Expected legacy path, got %q", got)
+	}
+
+	w := httptest.NewRecorder()
+	req = withVersion(w, req, 1)
+	if got := apiPath(req, "/admin/backfill/1"); got != "/api/v1/admin/backfill/1" {
+		t.Errorf("Expected versioned path, got %q", got)
+	}
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/views"
+	"github.com/go-chi/chi/v5"
+)
+
+// viewDefinition is the JSON representation of a view definition
+type viewDefinition struct {
+	Name       string              `json:"name"`
+	Query      string              `json:"query,omitempty"`
+	Projection []string            `json:"projection,omitempty"`
+	Refresh    views.RefreshPolicy `json:"refresh,omitempty"`
+	Interval   string              `json:"interval,omitempty"`
+}
+
+// toViewDefinition converts a view definition to its JSON representation
+func toViewDefinition(def views.Definition) viewDefinition {
+	vd := viewDefinition{
+		Name:       def.Name,
+		Query:      def.Query,
+		Projection: def.Projection,
+		Refresh:    def.Refresh,
+	}
+	if def.Interval > 0 {
+		vd.Interval = def.Interval.String()
+	}
+	return vd
+}
+
+// View management handlers
+
+// CreateView handles POST /views
+func (s *Server) CreateView(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	var req viewDefinition
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	def := views.Definition{
+		Name:       req.Name,
+		Query:      req.Query,
+		Projection: req.Projection,
+		Refresh:    req.Refresh,
+	}
+
+	if req.Interval != "" {
+		interval, err := time.ParseDuration(req.Interval)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid interval: "+err.Error())
+			return
+		}
+		def.Interval = interval
+	}
+
+	if err := s.Views.Create(def); err != nil {
+		switch {
+		case errors.Is(err, views.ErrViewAlreadyExists):
+			respondError(w, http.StatusConflict, "View already exists")
+		case errors.Is(err, views.ErrInvalidDefinition):
+			respondError(w, http.StatusBadRequest, err.Error())
+		default:
+			respondError(w, http.StatusInternalServerError, "Failed to create view: "+err.Error())
+		}
+		return
+	}
+
+	if def.Refresh == "" {
+		def.Refresh = views.RefreshOnChange
+	}
+
+	respondJSON(w, http.StatusCreated, toViewDefinition(def))
+}
+
+// ListViews handles GET /views
+func (s *Server) ListViews(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	defs := s.Views.Definitions()
+	result := make([]viewDefinition, len(defs))
+	for i, def := range defs {
+		result[i] = toViewDefinition(def)
+	}
+
+	respondJSON(w, http.StatusOK, result)
+}
+
+// GetView handles GET /views/{viewName}
+func (s *Server) GetView(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	viewName := chi.URLParam(r, "viewName")
+	if viewName == "" {
+		respondError(w, http.StatusBadRequest, "View name is required")
+		return
+	}
+
+	result, err := s.Views.Get(viewName)
+	if err != nil {
+		if err == views.ErrViewNotFound {
+			respondError(w, http.StatusNotFound, "View not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to get view: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, result)
+}
+
+// DeleteView handles DELETE /views/{viewName}
+func (s *Server) DeleteView(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	viewName := chi.URLParam(r, "viewName")
+	if viewName == "" {
+		respondError(w, http.StatusBadRequest, "View name is required")
+		return
+	}
+
+	if err := s.Views.Delete(viewName); err != nil {
+		if err == views.ErrViewNotFound {
+			respondError(w, http.StatusNotFound, "View not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to delete view: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{"message": "View deleted"})
+}
+
+// RefreshView handles POST /views/{viewName}/refresh
+func (s *Server) RefreshView(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	viewName := chi.URLParam(r, "viewName")
+	if viewName == "" {
+		respondError(w, http.StatusBadRequest, "View name is required")
+		return
+	}
+
+	if err := s.Views.Refresh(viewName); err != nil {
+		if err == views.ErrViewNotFound {
+			respondError(w, http.StatusNotFound, "View not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to refresh view: "+err.Error())
+		}
+		return
+	}
+
+	result, _ := s.Views.Get(viewName)
+	respondJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestViewManagement(t *testing.T) {
+	server := setupTestServer()
+
+	dt := twin.NewDigitalTwin("view-twin-1", "sensor")
+	dt.SetAttribute("location", "hall")
+	server.Registry.Create(dt)
+	server.Registry.Create(twin.NewDigitalTwin("view-twin-2", "actuator"))
+
+	// Create a view
+	viewData := map[string]interface{}{
+		"name":       "sensors",
+		"query":      "type==sensor",
+		"projection": []string{"attributes.location"},
+		"refresh":    "manual",
+	}
+
+	jsonData, _ := json.Marshal(viewData)
+	req := httptest.NewRequest("POST", "/views", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	server.CreateView(w, req)
+
+	resp := w.Result()
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("Expected status code %d, got %d", http.StatusCreated, resp.StatusCode)
+	}
+
+	// Creating the same view again conflicts
+	req = httptest.NewRequest("POST", "/views", bytes.NewBuffer(jsonData))
+	w = httptest.NewRecorder()
+	server.CreateView(w, req)
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d, got %d", http.StatusConflict, w.Code)
+	}
+
+	// Invalid definitions are rejected
+	jsonData, _ = json.Marshal(map[string]interface{}{"name": "bad", "refresh": "periodic", "interval": "soon"})
+	req = httptest.NewRequest("POST", "/views", bytes.NewBuffer(jsonData))
+	w = httptest.NewRecorder()
+	server.CreateView(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	// Read the view
+	req = httptest.NewRequest("GET", "/views/sensors", nil)
+	req = req.WithContext(setURLParam(req.Context(), "viewName", "sensors"))
+
+	w = httptest.NewRecorder()
+	server.GetView(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var result struct {
+		Name string                   `json:"name"`
+		Rows []map[string]interface{} `json:"rows"`
+	}
+	json.NewDecoder(w.Body).Decode(&result)
+
+	if len(result.Rows) != 1 || result.Rows[0]["attributes.location"] != "hall" {
+		t.Errorf("Expected a single row located in the hall, got %v", result.Rows)
+	}
+
+	// Refresh picks up new twins
+	server.Registry.Create(twin.NewDigitalTwin("view-twin-3", "sensor"))
+
+	req = httptest.NewRequest("POST", "/views/sensors/refresh", nil)
+	req = req.WithContext(setURLParam(req.Context(), "viewName", "sensors"))
+
+	w = httptest.NewRecorder()
+	server.RefreshView(w, req)
+
+	json.NewDecoder(w.Body).Decode(&result)
+	if len(result.Rows) != 2 {
+		t.Errorf("Expected 2 rows after refresh, got %d", len(result.Rows))
+	}
+
+	// Delete the view
+	req = httptest.NewRequest("DELETE", "/views/sensors", nil)
+	req = req.WithContext(setURLParam(req.Context(), "viewName", "sensors"))
+
+	w = httptest.NewRecorder()
+	server.DeleteView(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/views/sensors", nil)
+	req = req.WithContext(setURLParam(req.Context(), "viewName", "sensors"))
+
+	w = httptest.NewRecorder()
+	server.GetView(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
@@ -0,0 +1,234 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/ingest"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/schema"
+	"github.com/aleka07/go-digital-twin/pkg/valuesize"
+	"github.com/aleka07/go-digital-twin/pkg/wasm"
+	"github.com/go-chi/chi/v5"
+)
+
+// maxModuleSize is the maximum size of an uploaded WASM module
+const maxModuleSize = 16 << 20
+
+// wasmHookInfo is the JSON representation of a WASM hook
+type wasmHookInfo struct {
+	wasm.Info
+	MemoryPages uint32 `json:"memoryPages"`
+	Timeout     string `json:"timeout"`
+	MaxOutput   uint32 `json:"maxOutput"`
+}
+
+// toWasmHookInfo converts hook information to its JSON representation
+func toWasmHookInfo(info wasm.Info) wasmHookInfo {
+	return wasmHookInfo{
+		Info:        info,
+		MemoryPages: info.Limits.MemoryPages,
+		Timeout:     info.Limits.Timeout.String(),
+		MaxOutput:   info.Limits.MaxOutput,
+	}
+}
+
+// parseWasmLimits reads the optional memoryPages, timeout and maxOutput query parameters
+func parseWasmLimits(r *http.Request) (wasm.Limits, error) {
+	var limits wasm.Limits
+	query := r.URL.Query()
+
+	if v := query.Get("memoryPages"); v != "" {
+		pages, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return limits, err
+		}
+		limits.MemoryPages = uint32(pages)
+	}
+
+	if v := query.Get("timeout"); v != "" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil {
+			return limits, err
+		}
+		limits.Timeout = timeout
+	}
+
+	if v := query.Get("maxOutput"); v != "" {
+		size, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return limits, err
+		}
+		limits.MaxOutput = uint32(size)
+	}
+
+	return limits, nil
+}
+
+// WASM hook handlers
+
+// UploadWasmHook handles PUT /wasm/{hookName}.
+// The request body is the binary module; limits are given as query parameters.
+func (s *Server) UploadWasmHook(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	hookName := chi.URLParam(r, "hookName")
+	if hookName == "" {
+		respondError(w, http.StatusBadRequest, "Hook name is required")
+		return
+	}
+
+	limits, err := parseWasmLimits(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid limits: "+err.Error())
+		return
+	}
+
+	binary, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxModuleSize))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	if err := s.Wasm.Upload(r.Context(), hookName, binary, limits); err != nil {
+		switch {
+		case errors.Is(err, wasm.ErrHookAlreadyExists):
+			respondError(w, http.StatusConflict, "WASM hook already exists")
+		case errors.Is(err, wasm.ErrInvalidModule):
+			respondError(w, http.StatusBadRequest, err.Error())
+		default:
+			respondError(w, http.StatusInternalServerError, "Failed to upload WASM hook: "+err.Error())
+		}
+		return
+	}
+
+	info, _ := s.Wasm.Get(hookName)
+	respondJSON(w, http.StatusCreated, toWasmHookInfo(info))
+}
+
+// ListWasmHooks handles GET /wasm
+func (s *Server) ListWasmHooks(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	hooks := s.Wasm.List()
+	result := make([]wasmHookInfo, len(hooks))
+	for i, info := range hooks {
+		result[i] = toWasmHookInfo(info)
+	}
+
+	respondJSON(w, http.StatusOK, result)
+}
+
+// GetWasmHook handles GET /wasm/{hookName}
+func (s *Server) GetWasmHook(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	hookName := chi.URLParam(r, "hookName")
+	if hookName == "" {
+		respondError(w, http.StatusBadRequest, "Hook name is required")
+		return
+	}
+
+	info, err := s.Wasm.Get(hookName)
+	if err != nil {
+		if err == wasm.ErrHookNotFound {
+			respondError(w, http.StatusNotFound, "WASM hook not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to get WASM hook: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, toWasmHookInfo(info))
+}
+
+// DeleteWasmHook handles DELETE /wasm/{hookName}
+func (s *Server) DeleteWasmHook(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	hookName := chi.URLParam(r, "hookName")
+	if hookName == "" {
+		respondError(w, http.StatusBadRequest, "Hook name is required")
+		return
+	}
+
+	if err := s.Wasm.Delete(r.Context(), hookName); err != nil {
+		if err == wasm.ErrHookNotFound {
+			respondError(w, http.StatusNotFound, "WASM hook not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to delete WASM hook: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{"message": "WASM hook deleted"})
+}
+
+// BridgeMessage handles POST /wasm/{hookName}/messages.
+// The raw request body is a message from a broker bridge, the optional topic
+// query parameter its topic. The hook converts it to telemetry, which is ingested.
+func (s *Server) BridgeMessage(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	hookName := chi.URLParam(r, "hookName")
+	if hookName == "" {
+		respondError(w, http.StatusBadRequest, "Hook name is required")
+		return
+	}
+
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxModuleSize))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	telemetry, err := s.Wasm.Transform(r.Context(), hookName, r.URL.Query().Get("topic"), payload)
+	if err != nil {
+		if err == wasm.ErrHookNotFound {
+			respondError(w, http.StatusNotFound, "WASM hook not found")
+		} else {
+			respondError(w, http.StatusUnprocessableEntity, err.Error())
+		}
+		return
+	}
+
+	if telemetry == nil {
+		respondJSON(w, http.StatusOK, map[string]string{"message": "Message skipped by hook"})
+		return
+	}
+
+	if telemetry.TwinID == "" {
+		respondError(w, http.StatusUnprocessableEntity, "Hook output contains no twin ID")
+		return
+	}
+
+	result, err := s.Ingester.Apply(*telemetry)
+	if err != nil {
+		if s.respondShed(w, err) {
+			return
+		}
+		switch {
+		case err == registry.ErrTwinNotFound:
+			respondError(w, http.StatusNotFound, "Digital twin not found")
+		case err == ingest.ErrEmptyTelemetry:
+			respondError(w, http.StatusUnprocessableEntity, "Hook output contains no properties")
+		case errors.Is(err, valuesize.ErrTooLarge):
+			respondError(w, http.StatusRequestEntityTooLarge, err.Error())
+		case errors.Is(err, ingest.ErrTransformFailed), errors.Is(err, schema.ErrViolation):
+			respondError(w, http.StatusUnprocessableEntity, err.Error())
+		default:
+			respondError(w, http.StatusInternalServerError, "Failed to ingest telemetry: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, result)
+}
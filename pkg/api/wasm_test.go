@@ -0,0 +1,84 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+	"github.com/aleka07/go-digital-twin/pkg/wasm"
+)
+
+func TestWasmHooks(t *testing.T) {
+	server := setupTestServer()
+	server.Registry.Create(twin.NewDigitalTwin("sensor-1", "sensor"))
+
+	upload := func(name string, binary []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PUT", "/wasm/"+name+"?timeout=50ms", bytes.NewBuffer(binary))
+		req.Header.Set("Content-Type", "application/wasm")
+		req = req.WithContext(setURLParam(req.Context(), "hookName", name))
+
+		w := httptest.NewRecorder()
+		server.UploadWasmHook(w, req)
+		return w
+	}
+
+	w := upload("passthrough", wasm.Passthrough)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	var info map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&info)
+	if info["timeout"] != "50ms" {
+		t.Errorf("Expected timeout 50ms, got %v", info["timeout"])
+	}
+
+	if w := upload("broken", []byte("not wasm")); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	send := func(payload string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/wasm/passthrough/messages?topic=plant/sensor-1", bytes.NewBufferString(payload))
+		req = req.WithContext(setURLParam(req.Context(), "hookName", "passthrough"))
+
+		w := httptest.NewRecorder()
+		server.BridgeMessage(w, req)
+		return w
+	}
+
+	w = send(`{"twinId":"sensor-1","features":{"temperature":{"value":21.5}}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	dt, _ := server.Registry.Get("sensor-1")
+	feature, _ := dt.GetFeature("temperature")
+	if val, _ := feature.GetProperty("value"); val != 21.5 {
+		t.Errorf("Expected value 21.5, got %v", val)
+	}
+
+	if w := send(`{"features":{"temperature":{"value":21.5}}}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status code %d, got %d", http.StatusUnprocessableEntity, w.Code)
+	}
+
+	if w := send("21.5"); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status code %d, got %d", http.StatusUnprocessableEntity, w.Code)
+	}
+
+	// Delete the hook
+	req := httptest.NewRequest("DELETE", "/wasm/passthrough", nil)
+	req = req.WithContext(setURLParam(req.Context(), "hookName", "passthrough"))
+	w = httptest.NewRecorder()
+	server.DeleteWasmHook(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	if w := send("{}"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/eventbus"
+	"github.com/aleka07/go-digital-twin/pkg/query"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// Query-scoped event streams
+
+// watchKeepAlive is how often an idle stream sends a comment, so that
+// proxies do not close the connection
+const watchKeepAlive = 15 * time.Second
+
+// watchBuffer is the number of events buffered for a stream. Events
+// published while the buffer is full are dropped by PubSub.
+const watchBuffer = 1024
+
+// eventStreamType is the content type of server-sent events
+const eventStreamType = "text/event-stream"
+
+// isEventStream reports whether a request opens a server-sent event stream
+func isEventStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), eventStreamType) ||
+		strings.HasSuffix(r.URL.Path, "/twins/watch")
+}
+
+// timeout limits the time to handle a request, except for event streams,
+// which stay open until the client disconnects or the server shuts down
+func timeout(d time.Duration) func(http.Handler) http.Handler {
+	limit := middleware.Timeout(d)
+	return func(next http.Handler) http.Handler {
+		limited := limit(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isEventStream(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			limited.ServeHTTP(w, r)
+		})
+	}
+}
+
+// WatchTwins handles GET /twins/watch?query=... It streams the twins
+// matching the query as server-sent events: an add event for every
+// initial match followed by a synced event, then add, update and remove
+// events as twins enter, change within or leave the result set. Add and
+// update events carry the twin, remove events its ID.
+//
+// Events about a twin that were dropped because the stream fell behind are
+// reported with a gap event carrying the twin ID and the number missed,
+// followed by the current state of the twin as an add, update or remove
+// event.
+//
+// Streams are not counted as in-flight requests, since they do not end on
+// their own; Shutdown ends them instead.
+func (s *Server) WatchTwins(w http.ResponseWriter, r *http.Request) {
+	q, err := query.Parse(r.URL.Query().Get("query"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		respondError(w, http.StatusInternalServerError, "Streaming is not supported")
+		return
+	}
+
+	// Subscribe before reading the initial matches, so that no change in
+	// between is missed. The subscription ends with the request.
+	events := s.PubSub.SubscribeContext(r.Context(), "#", watchBuffer)
+
+	w.Header().Set("Content-Type", eventStreamType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	gaps := eventbus.NewGaps()
+	matched := make(map[string]bool)
+	for _, dt := range s.Twins.Find(q) {
+		matched[dt.ID] = true
+		writeEvent(w, "add", twinBody(r, dt))
+	}
+	writeEvent(w, "synced", map[string]int{"count": len(matched)})
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(watchKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case msg, ok := <-events:
+			if !ok {
+				return
+			}
+			// Missed events may have changed the twin, so a gap is followed
+			// by its current state whatever the event revealing it
+			missed := gaps.Missed(msg)
+			if missed > 0 {
+				writeEvent(w, "gap", map[string]interface{}{"id": msg.TwinID(), "missed": missed})
+			} else if strings.HasPrefix(msg.Topic, "group.") {
+				// Group membership changes leave the twin unchanged
+				continue
+			}
+			twinID := msg.TwinID()
+			if twinID == "" {
+				continue
+			}
+
+			dt, err := s.Twins.Get(twinID)
+			switch {
+			case err == nil && q.Matches(dt):
+				event := "update"
+				if !matched[twinID] {
+					event = "add"
+					matched[twinID] = true
+				}
+				writeEvent(w, event, twinBody(r, dt))
+			case (err == nil || err == registry.ErrTwinNotFound) && matched[twinID]:
+				delete(matched, twinID)
+				writeEvent(w, "remove", map[string]string{"id": twinID})
+			default:
+				continue
+			}
+			flusher.Flush()
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		case <-s.closing:
+			return
+		}
+	}
+}
+
+// writeEvent writes a server-sent event with a JSON data field
+func writeEvent(w http.ResponseWriter, event string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+}
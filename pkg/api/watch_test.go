@@ -0,0 +1,138 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// streamEvent is a server-sent event read by a test
+type streamEvent struct {
+	name string
+	data map[string]interface{}
+}
+
+// readEvents sends the events of a stream to a channel until it ends
+func readEvents(body *bufio.Reader, events chan<- streamEvent) {
+	defer close(events)
+	var event streamEvent
+	for {
+		line, err := body.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event.data)
+		case line == "" && event.name != "":
+			events <- event
+			event = streamEvent{}
+		}
+	}
+}
+
+func TestWatchTwins(t *testing.T) {
+	server := setupTestServer()
+	pump := twin.NewDigitalTwin("pump-1", "pump")
+	pump.SetAttribute("site", "north")
+	server.Registry.Create(pump)
+	valve := twin.NewDigitalTwin("valve-1", "valve")
+	valve.SetAttribute("site", "north")
+	server.Registry.Create(valve)
+
+	ts := httptest.NewServer(server.Router)
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", ts.URL+"/api/v1/twins/watch?query=type+%3D%3D+pump", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Expected content type text/event-stream, got %q", ct)
+	}
+
+	events := make(chan streamEvent, 16)
+	go readEvents(bufio.NewReader(resp.Body), events)
+	next := func() streamEvent {
+		t.Helper()
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for an event")
+			return streamEvent{}
+		}
+	}
+
+	// Initial matches
+	if event := next(); event.name != "add" || event.data["id"] != "pump-1" {
+		t.Errorf("Expected pump-1 to be added, got %s %v", event.name, event.data)
+	}
+	if event := next(); event.name != "synced" || event.data["count"] != 1.0 {
+		t.Errorf("Expected synced with 1 twin, got %s %v", event.name, event.data)
+	}
+
+	request := serveFunc(server, "")
+	serve := func(method, path, body string) {
+		if w := request(method, path, body); w.Code >= 300 {
+			t.Fatalf("Expected %s %s to succeed, got %d", method, path, w.Code)
+		}
+	}
+
+	// A changed twin in the result set is updated
+	serve("PUT", "/twins/pump-1/attributes/site", `"south"`)
+	if event := next(); event.name != "update" || event.data["attributes"].(map[string]interface{})["site"] != "south" {
+		t.Errorf("Expected pump-1 to be updated, got %s %v", event.name, event.data)
+	}
+
+	// Twins enter and leave the result set
+	serve("PATCH", "/api/v1/twins/valve-1", `{"type": "pump"}`)
+	if event := next(); event.name != "add" || event.data["id"] != "valve-1" {
+		t.Errorf("Expected valve-1 to be added, got %s %v", event.name, event.data)
+	}
+	serve("PATCH", "/api/v1/twins/valve-1", `{"type": "valve"}`)
+	if event := next(); event.name != "remove" || event.data["id"] != "valve-1" {
+		t.Errorf("Expected valve-1 to be removed, got %s %v", event.name, event.data)
+	}
+	serve("DELETE", "/twins/pump-1", "")
+	if event := next(); event.name != "remove" || event.data["id"] != "pump-1" {
+		t.Errorf("Expected pump-1 to be removed, got %s %v", event.name, event.data)
+	}
+
+	// Shutting down ends the stream
+	server.Shutdown(context.Background())
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Errorf("Expected no more events")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Expected the stream to end on shutdown")
+	}
+}
+
+func TestWatchTwinsInvalidQuery(t *testing.T) {
+	server := setupTestServer()
+
+	req := httptest.NewRequest("GET", "/twins/watch?query=type+~+pump", nil)
+	w := httptest.NewRecorder()
+	server.Router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/aleka07/go-digital-twin/pkg/webhook"
+	"github.com/go-chi/chi/v5"
+)
+
+// Webhook management handlers
+
+// CreateWebhook handles POST /webhooks
+func (s *Server) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	var hook webhook.Hook
+	if err := json.NewDecoder(r.Body).Decode(&hook); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	if err := s.Webhooks.Create(hook); err != nil {
+		switch {
+		case errors.Is(err, webhook.ErrHookAlreadyExists):
+			respondError(w, http.StatusConflict, "Webhook already exists")
+		case errors.Is(err, webhook.ErrInvalidHook):
+			respondError(w, http.StatusBadRequest, err.Error())
+		default:
+			respondError(w, http.StatusInternalServerError, "Failed to create webhook: "+err.Error())
+		}
+		return
+	}
+
+	created, _, _ := s.Webhooks.Get(hook.Name)
+	respondJSON(w, http.StatusCreated, created)
+}
+
+// ListWebhooks handles GET /webhooks
+func (s *Server) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	respondJSON(w, http.StatusOK, s.Webhooks.List())
+}
+
+// GetWebhook handles GET /webhooks/{hookName} and includes the last delivery
+func (s *Server) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	hookName := chi.URLParam(r, "hookName")
+	if hookName == "" {
+		respondError(w, http.StatusBadRequest, "Webhook name is required")
+		return
+	}
+
+	hook, last, err := s.Webhooks.Get(hookName)
+	if err != nil {
+		if err == webhook.ErrHookNotFound {
+			respondError(w, http.StatusNotFound, "Webhook not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to get webhook: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, struct {
+		webhook.Hook
+		LastDelivery *webhook.Delivery `json:"lastDelivery,omitempty"`
+	}{hook, last})
+}
+
+// DeleteWebhook handles DELETE /webhooks/{hookName}
+func (s *Server) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	hookName := chi.URLParam(r, "hookName")
+	if hookName == "" {
+		respondError(w, http.StatusBadRequest, "Webhook name is required")
+		return
+	}
+
+	if err := s.Webhooks.Delete(hookName); err != nil {
+		if err == webhook.ErrHookNotFound {
+			respondError(w, http.StatusNotFound, "Webhook not found")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to delete webhook: "+err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Webhook deleted"})
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWebhookManagement(t *testing.T) {
+	server := setupTestServer()
+
+	create := func(body map[string]interface{}) *httptest.ResponseRecorder {
+		jsonData, _ := json.Marshal(body)
+		req := httptest.NewRequest("POST", "/webhooks", bytes.NewBuffer(jsonData))
+		req.Header.Set("Content-Type", "application/json")
+
+		w := httptest.NewRecorder()
+		server.CreateWebhook(w, req)
+		return w
+	}
+
+	hook := map[string]interface{}{
+		"name":     "erp",
+		"url":      "http://erp.example.com/assets",
+		"events":   []string{"created", "decommissioned"},
+		"template": `{"assetId":"{{.Twin.id}}"}`,
+	}
+
+	if w := create(hook); w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d", http.StatusCreated, w.Code)
+	}
+
+	if w := create(hook); w.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d, got %d", http.StatusConflict, w.Code)
+	}
+
+	if w := create(map[string]interface{}{"name": "bad", "url": "http://erp", "events": []string{"updated"}}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	// Get the webhook
+	req := httptest.NewRequest("GET", "/webhooks/erp", nil)
+	req = req.WithContext(setURLParam(req.Context(), "hookName", "erp"))
+	w := httptest.NewRecorder()
+	server.GetWebhook(w, req)
+
+	var result map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&result)
+	if w.Code != http.StatusOK || result["url"] != "http://erp.example.com/assets" {
+		t.Errorf("Unexpected webhook: %d %v", w.Code, result)
+	}
+
+	// Delete the webhook
+	req = httptest.NewRequest("DELETE", "/webhooks/erp", nil)
+	req = req.WithContext(setURLParam(req.Context(), "hookName", "erp"))
+	w = httptest.NewRecorder()
+	server.DeleteWebhook(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	if hooks := server.Webhooks.List(); len(hooks) != 0 {
+		t.Errorf("Expected no webhooks, got %v", hooks)
+	}
+}
@@ -0,0 +1,183 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// Wire representations of twins
+
+// Twin is the JSON representation of a digital twin from API version 1 on.
+// Unlike the legacy representation, which serializes the Go field names of
+// features, all field names are lowerCamelCase.
+type Twin struct {
+	ID            string                   `json:"id"`
+	Type          string                   `json:"type"`
+	Definition    string                   `json:"definition,omitempty"`
+	Lifecycle     twin.LifecycleState      `json:"lifecycle"`
+	Semantics     *twin.SemanticAnnotation `json:"semantics,omitempty"`
+	Scene         *twin.SceneReference     `json:"scene,omitempty"`
+	Attributes    map[string]interface{}   `json:"attributes"`
+	Features      map[string]Feature       `json:"features"`
+	Relationships map[string][]string      `json:"relationships,omitempty"`
+	Revision      uint64                   `json:"revision"`
+	CreatedAt     time.Time                `json:"createdAt"`
+	ModifiedAt    time.Time                `json:"modifiedAt"`
+}
+
+// Feature is the JSON representation of a twin feature from API version 1 on
+type Feature struct {
+	Properties        map[string]interface{}           `json:"properties"`
+	DesiredProperties map[string]interface{}           `json:"desiredProperties"`
+	Definition        []string                         `json:"definition"`
+	Metadata          map[string]twin.PropertyMetadata `json:"metadata"`
+	Semantics         *twin.SemanticAnnotation         `json:"semantics,omitempty"`
+	LastModified      time.Time                        `json:"lastModified"`
+	CreatedBy         string                           `json:"createdBy,omitempty"`  // Read-only
+	ModifiedBy        string                           `json:"modifiedBy,omitempty"` // Read-only
+}
+
+// NewTwin returns the wire representation of a twin
+func NewTwin(dt *twin.DigitalTwin) Twin {
+	c := dt.Clone()
+	return Twin{
+		ID:            c.ID,
+		Type:          c.Type,
+		Definition:    c.Definition,
+		Lifecycle:     c.Lifecycle,
+		Semantics:     c.Semantics,
+		Scene:         c.Scene,
+		Attributes:    c.Attributes,
+		Features:      newFeatures(c.Features),
+		Relationships: c.Relationships,
+		Revision:      c.Revision,
+		CreatedAt:     c.CreatedAt,
+		ModifiedAt:    c.ModifiedAt,
+	}
+}
+
+// NewFeature returns the wire representation of a feature
+func NewFeature(fs *twin.FeatureState) Feature {
+	return newFeature(fs.Clone())
+}
+
+// newFeature converts a feature the caller owns
+func newFeature(c *twin.FeatureState) Feature {
+	return Feature{
+		Properties:        c.Properties,
+		DesiredProperties: c.DesiredProps,
+		Definition:        c.Definition,
+		Metadata:          c.Metadata,
+		Semantics:         c.Semantics,
+		LastModified:      c.LastModified,
+		CreatedBy:         c.CreatedBy,
+		ModifiedBy:        c.ModifiedBy,
+	}
+}
+
+// newFeatures converts features the caller owns
+func newFeatures(features map[string]*twin.FeatureState) map[string]Feature {
+	result := make(map[string]Feature, len(features))
+	for id, fs := range features {
+		result[id] = newFeature(fs)
+	}
+	return result
+}
+
+// ToDigitalTwin converts a wire representation back into a twin, such as
+// one read from another server's API
+func (t Twin) ToDigitalTwin() *twin.DigitalTwin {
+	dt := &twin.DigitalTwin{
+		ID:            t.ID,
+		Type:          t.Type,
+		Definition:    t.Definition,
+		Lifecycle:     t.Lifecycle,
+		Semantics:     t.Semantics,
+		Scene:         t.Scene,
+		Attributes:    t.Attributes,
+		Features:      make(map[string]*twin.FeatureState, len(t.Features)),
+		Relationships: t.Relationships,
+		Revision:      t.Revision,
+		CreatedAt:     t.CreatedAt,
+		ModifiedAt:    t.ModifiedAt,
+	}
+	if dt.Attributes == nil {
+		dt.Attributes = make(map[string]interface{})
+	}
+	for id, f := range t.Features {
+		dt.Features[id] = f.ToFeatureState()
+	}
+	return dt
+}
+
+// ToFeatureState converts a wire representation back into a feature
+func (f Feature) ToFeatureState() *twin.FeatureState {
+	fs := &twin.FeatureState{
+		Properties:   f.Properties,
+		DesiredProps: f.DesiredProperties,
+		Definition:   f.Definition,
+		Metadata:     f.Metadata,
+		Semantics:    f.Semantics,
+		LastModified: f.LastModified,
+		CreatedBy:    f.CreatedBy,
+		ModifiedBy:   f.ModifiedBy,
+	}
+	if fs.Properties == nil {
+		fs.Properties = make(map[string]interface{})
+	}
+	if fs.DesiredProps == nil {
+		fs.DesiredProps = make(map[string]interface{})
+	}
+	if fs.Definition == nil {
+		fs.Definition = []string{}
+	}
+	if fs.Metadata == nil {
+		fs.Metadata = make(map[string]twin.PropertyMetadata)
+	}
+	return fs
+}
+
+// twinBody returns the representation of a twin for the API version of a request
+func twinBody(r *http.Request, dt *twin.DigitalTwin) interface{} {
+	if APIVersion(r) == LegacyAPIVersion {
+		return dt
+	}
+	return NewTwin(dt)
+}
+
+// twinsBody returns the representation of twins for the API version of a request
+func twinsBody(r *http.Request, twins []*twin.DigitalTwin) interface{} {
+	if APIVersion(r) == LegacyAPIVersion {
+		return twins
+	}
+
+	result := make([]Twin, len(twins))
+	for i, dt := range twins {
+		result[i] = NewTwin(dt)
+	}
+	return result
+}
+
+// featureBody returns the representation of a feature for the API version of a request
+func featureBody(r *http.Request, fs *twin.FeatureState) interface{} {
+	if APIVersion(r) == LegacyAPIVersion {
+		return fs
+	}
+	return NewFeature(fs)
+}
+
+// featuresBody returns the representation of the features of a twin for the
+// API version of a request
+func featuresBody(r *http.Request, features map[string]*twin.FeatureState) interface{} {
+	if APIVersion(r) == LegacyAPIVersion {
+		return features
+	}
+
+	result := make(map[string]Feature, len(features))
+	for id, fs := range features {
+		result[id] = NewFeature(fs)
+	}
+	return result
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestWireTwin(t *testing.T) {
+	dt := twin.NewDigitalTwin("pump-1", "pump")
+	dt.SetDefinition("org.example:Pump:1.0")
+	dt.SetAttribute("serial", "P-100")
+	feature := twin.NewFeatureState()
+	feature.SetProperty("pressure", 2.5)
+	feature.SetDesiredProperty("setpoint", 10.0)
+	feature.SetDefinition([]string{"org.example:Control:1.0"})
+	dt.AddFeature("control", feature)
+
+	data, err := json.Marshal(NewTwin(dt))
+	if err != nil {
+		t.Fatalf("Failed to encode twin: %v", err)
+	}
+
+	var fields map[string]interface{}
+	json.Unmarshal(data, &fields)
+	control := fields["features"].(map[string]interface{})["control"].(map[string]interface{})
+	for _, key := range []string{"properties", "desiredProperties", "definition", "metadata", "lastModified"} {
+		if _, exists := control[key]; !exists {
+			t.Errorf("Expected feature field %q, got %v", key, control)
+		}
+	}
+	for _, key := range []string{"Properties", "DesiredProps", "LastModified"} {
+		if _, exists := control[key]; exists {
+			t.Errorf("Expected no Go field name %q", key)
+		}
+	}
+	for _, key := range []string{"id", "type", "definition", "attributes", "createdAt", "modifiedAt"} {
+		if _, exists := fields[key]; !exists {
+			t.Errorf("Expected twin field %q, got %v", key, fields)
+		}
+	}
+
+	// Converting back restores the twin
+	var decoded Twin
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to decode twin: %v", err)
+	}
+	restored := decoded.ToDigitalTwin()
+	f, exists := restored.GetFeature("control")
+	if !exists {
+		t.Fatalf("Expected the control feature to be restored")
+	}
+	if v, _ := f.GetDesiredProperty("setpoint"); v != 10.0 {
+		t.Errorf("Expected setpoint 10, got %v", v)
+	}
+	if restored.Definition != dt.Definition || !reflect.DeepEqual(f.GetDefinition(), feature.GetDefinition()) {
+		t.Errorf("Expected definitions to be restored, got %q and %v", restored.Definition, f.GetDefinition())
+	}
+	if !restored.ModifiedAt.Equal(dt.ModifiedAt) {
+		t.Errorf("Expected modification time %v, got %v", dt.ModifiedAt, restored.ModifiedAt)
+	}
+}
+
+func TestWireRepresentationPerVersion(t *testing.T) {
+	server := setupTestServer()
+	dt := twin.NewDigitalTwin("pump-1", "pump")
+	dt.AddFeature("control", twin.NewFeatureState())
+	server.Registry.Create(dt)
+
+	get := func(path string) string {
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		server.Router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d for %s, got %d", http.StatusOK, path, w.Code)
+		}
+		return w.Body.String()
+	}
+
+	// Read twice so that the second read comes from the twin cache
+	for i := 0; i < 3; i++ {
+		if body := get("/api/v1/twins/pump-1"); !strings.Contains(body, `"desiredProperties"`) || strings.Contains(body, `"DesiredProps"`) {
+			t.Errorf("Expected the version 1 representation, got %s", body)
+		}
+		if body := get("/twins/pump-1"); !strings.Contains(body, `"DesiredProps"`) {
+			t.Errorf("Expected the legacy representation, got %s", body)
+		}
+	}
+
+	if body := get("/api/v1/twins"); !strings.Contains(body, `"lastModified"`) {
+		t.Errorf("Expected the version 1 representation in lists, got %s", body)
+	}
+	if body := get("/api/v1/twins/pump-1/features/control"); !strings.Contains(body, `"properties"`) {
+		t.Errorf("Expected the version 1 feature representation, got %s", body)
+	}
+	if body := get("/twins/pump-1/features"); !strings.Contains(body, `"Properties"`) {
+		t.Errorf("Expected the legacy feature representation, got %s", body)
+	}
+}
@@ -0,0 +1,373 @@
+package approval
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/eventbus"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// Common errors
+var (
+	ErrChangeRequestNotFound = errors.New("change request not found")
+	ErrInvalidChangeRequest  = errors.New("invalid change request")
+	ErrInvalidPolicy         = errors.New("invalid approval policy")
+	ErrAlreadyReviewed       = errors.New("change request already reviewed")
+	ErrSelfReview            = errors.New("change requests must be reviewed by another user")
+)
+
+// State is the state of a change request
+type State string
+
+// Change request states
+const (
+	StatePending  State = "pending"
+	StateApproved State = "approved"
+	StateRejected State = "rejected"
+)
+
+// Change request topics
+const (
+	CreatedTopic  = "change-request.created"
+	ApprovedTopic = "change-request.approved"
+	RejectedTopic = "change-request.rejected"
+)
+
+// MaxRequests is the number of change requests kept; the oldest reviewed requests are removed first
+const MaxRequests = 1000
+
+// Policy marks a desired property as requiring approval
+type Policy struct {
+	FeatureID string `json:"featureId"`
+	Property  string `json:"property"`
+	TwinType  string `json:"twinType,omitempty"` // Only twins of this type, all twins when empty
+}
+
+// ChangeRequest is a desired-state change waiting for approval
+type ChangeRequest struct {
+	ID                string                 `json:"id"`
+	TwinID            string                 `json:"twinId"`
+	FeatureID         string                 `json:"featureId"`
+	DesiredProperties map[string]interface{} `json:"desiredProperties"`
+	State             State                  `json:"state"`
+	RequestedBy       string                 `json:"requestedBy,omitempty"`
+	ReviewedBy        string                 `json:"reviewedBy,omitempty"`
+	Comment           string                 `json:"comment,omitempty"`
+	CreatedAt         time.Time              `json:"createdAt"`
+	ReviewedAt        *time.Time             `json:"reviewedAt,omitempty"`
+}
+
+// policyKey identifies a policy
+type policyKey struct {
+	featureID string
+	property  string
+}
+
+// Manager holds approval policies and change requests. Approved changes are
+// applied to the twin and published as feature updates, so they propagate
+// like any other desired-state change.
+type Manager struct {
+	registry *registry.Registry
+	pubsub   eventbus.Publisher
+	policies map[policyKey]Policy
+	requests map[string]*ChangeRequest
+	mutex    sync.RWMutex
+}
+
+// NewManager creates a new approval manager
+func NewManager(reg *registry.Registry, pubsub eventbus.Publisher) *Manager {
+	return &Manager{
+		registry: reg,
+		pubsub:   pubsub,
+		policies: make(map[policyKey]Policy),
+		requests: make(map[string]*ChangeRequest),
+	}
+}
+
+// SetPolicy requires approval for changes to a desired property
+func (m *Manager) SetPolicy(p Policy) error {
+	if p.FeatureID == "" || p.Property == "" {
+		return fmt.Errorf("%w: featureId and property are required", ErrInvalidPolicy)
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.policies[policyKey{p.FeatureID, p.Property}] = p
+	return nil
+}
+
+// RemovePolicy stops requiring approval for a desired property
+func (m *Manager) RemovePolicy(featureID, property string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.policies, policyKey{featureID, property})
+}
+
+// Policies returns all policies sorted by feature and property
+func (m *Manager) Policies() []Policy {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	result := make([]Policy, 0, len(m.policies))
+	for _, p := range m.policies {
+		result = append(result, p)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].FeatureID != result[j].FeatureID {
+			return result[i].FeatureID < result[j].FeatureID
+		}
+		return result[i].Property < result[j].Property
+	})
+	return result
+}
+
+// RequiresApproval reports whether changing a desired property of a twin requires approval
+func (m *Manager) RequiresApproval(dt *twin.DigitalTwin, featureID, property string) bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	p, exists := m.policies[policyKey{featureID, property}]
+	return exists && (p.TwinType == "" || p.TwinType == dt.Type)
+}
+
+// Hold removes the changes that require approval from desired and returns
+// them. Values equal to the current desired value are not held.
+func (m *Manager) Hold(dt *twin.DigitalTwin, featureID string, desired map[string]interface{}) map[string]interface{} {
+	held := make(map[string]interface{})
+	feature, _ := dt.GetFeature(featureID)
+
+	for key, value := range desired {
+		if !m.RequiresApproval(dt, featureID, key) {
+			continue
+		}
+		if feature != nil {
+			if current, exists := feature.GetDesiredProperty(key); exists && reflect.DeepEqual(current, value) {
+				continue
+			}
+		}
+		held[key] = value
+		delete(desired, key)
+	}
+	return held
+}
+
+// Submit creates a pending change request
+func (m *Manager) Submit(twinID, featureID string, desired map[string]interface{}, requestedBy string) (ChangeRequest, error) {
+	if twinID == "" || featureID == "" || len(desired) == 0 {
+		return ChangeRequest{}, fmt.Errorf("%w: twin, feature and desired properties are required", ErrInvalidChangeRequest)
+	}
+	if _, err := m.registry.Get(twinID); err != nil {
+		return ChangeRequest{}, err
+	}
+
+	id, err := newID()
+	if err != nil {
+		return ChangeRequest{}, err
+	}
+
+	cr := &ChangeRequest{
+		ID:                id,
+		TwinID:            twinID,
+		FeatureID:         featureID,
+		DesiredProperties: copyMap(desired),
+		State:             StatePending,
+		RequestedBy:       requestedBy,
+		CreatedAt:         time.Now(),
+	}
+
+	m.mutex.Lock()
+	m.requests[id] = cr
+	m.prune()
+	result := cr.snapshot()
+	m.mutex.Unlock()
+
+	m.pubsub.Publish(CreatedTopic, map[string]interface{}{
+		"id":        result.ID,
+		"twinId":    result.TwinID,
+		"featureId": result.FeatureID,
+	})
+	return result, nil
+}
+
+// Get returns a change request by ID
+func (m *Manager) Get(id string) (ChangeRequest, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	cr, exists := m.requests[id]
+	if !exists {
+		return ChangeRequest{}, ErrChangeRequestNotFound
+	}
+	return cr.snapshot(), nil
+}
+
+// List returns the change requests in a state, or all when state is empty, newest first
+func (m *Manager) List(state State) []ChangeRequest {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	result := make([]ChangeRequest, 0, len(m.requests))
+	for _, cr := range m.requests {
+		if state == "" || cr.State == state {
+			result = append(result, cr.snapshot())
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.After(result[j].CreatedAt) })
+	return result
+}
+
+// Approve applies the desired values of a pending change request to the twin.
+// The reviewer must differ from the requester. The request stays pending when
+// the change cannot be applied.
+func (m *Manager) Approve(id, reviewer, comment string) (ChangeRequest, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	cr, err := m.pending(id, reviewer)
+	if err != nil {
+		return ChangeRequest{}, err
+	}
+
+	dt, err := m.registry.Get(cr.TwinID)
+	if err != nil {
+		return ChangeRequest{}, err
+	}
+
+	feature, exists := dt.GetFeature(cr.FeatureID)
+	if !exists {
+		feature = twin.NewFeatureState()
+	}
+	for key, value := range cr.DesiredProperties {
+		feature.SetDesiredProperty(key, value)
+	}
+
+	if exists {
+		err = dt.UpdateFeature(cr.FeatureID, feature)
+	} else {
+		err = dt.AddFeature(cr.FeatureID, feature)
+	}
+	if err == nil {
+		err = m.registry.Update(dt)
+	}
+	if err != nil {
+		return ChangeRequest{}, fmt.Errorf("apply change request: %w", err)
+	}
+
+	cr.review(StateApproved, reviewer, comment)
+
+	m.pubsub.Publish("feature.updated", map[string]string{
+		"twinId":    cr.TwinID,
+		"featureId": cr.FeatureID,
+	})
+	m.pubsub.Publish(ApprovedTopic, map[string]interface{}{
+		"id":         cr.ID,
+		"twinId":     cr.TwinID,
+		"featureId":  cr.FeatureID,
+		"reviewedBy": reviewer,
+	})
+	return cr.snapshot(), nil
+}
+
+// Reject discards a pending change request
+func (m *Manager) Reject(id, reviewer, comment string) (ChangeRequest, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	cr, err := m.pending(id, reviewer)
+	if err != nil {
+		return ChangeRequest{}, err
+	}
+
+	cr.review(StateRejected, reviewer, comment)
+
+	m.pubsub.Publish(RejectedTopic, map[string]interface{}{
+		"id":         cr.ID,
+		"twinId":     cr.TwinID,
+		"featureId":  cr.FeatureID,
+		"reviewedBy": reviewer,
+	})
+	return cr.snapshot(), nil
+}
+
+// pending returns a change request that the reviewer may review; the caller must hold the mutex
+func (m *Manager) pending(id, reviewer string) (*ChangeRequest, error) {
+	cr, exists := m.requests[id]
+	if !exists {
+		return nil, ErrChangeRequestNotFound
+	}
+	if cr.State != StatePending {
+		return nil, ErrAlreadyReviewed
+	}
+	if reviewer == "" || reviewer == cr.RequestedBy {
+		return nil, ErrSelfReview
+	}
+	return cr, nil
+}
+
+// review records the outcome of a review
+func (cr *ChangeRequest) review(state State, reviewer, comment string) {
+	now := time.Now()
+	cr.State = state
+	cr.ReviewedBy = reviewer
+	cr.Comment = comment
+	cr.ReviewedAt = &now
+}
+
+// prune removes the oldest reviewed requests beyond MaxRequests; the caller must hold the mutex
+func (m *Manager) prune() {
+	if len(m.requests) <= MaxRequests {
+		return
+	}
+
+	var reviewed []*ChangeRequest
+	for _, cr := range m.requests {
+		if cr.State != StatePending {
+			reviewed = append(reviewed, cr)
+		}
+	}
+
+	sort.Slice(reviewed, func(a, b int) bool { return reviewed[a].CreatedAt.Before(reviewed[b].CreatedAt) })
+	for _, cr := range reviewed {
+		if len(m.requests) <= MaxRequests {
+			break
+		}
+		delete(m.requests, cr.ID)
+	}
+}
+
+// snapshot returns a copy of the change request; the caller must hold the mutex
+func (cr *ChangeRequest) snapshot() ChangeRequest {
+	result := *cr
+	result.DesiredProperties = copyMap(cr.DesiredProperties)
+	return result
+}
+
+// copyMap returns a shallow copy of a map
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		result[k] = v
+	}
+	return result
+}
+
+// newID generates a random change request ID
+func newID() (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
@@ -0,0 +1,210 @@
+package approval
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func setupManager(t *testing.T) (*Manager, *registry.Registry, *messaging_sim.PubSub) {
+	t.Helper()
+
+	reg := registry.NewRegistry()
+	dt := twin.NewDigitalTwin("boiler-1", "boiler")
+	control := twin.NewFeatureState()
+	control.SetDesiredProperty("setpoint", 60.0)
+	dt.AddFeature("control", control)
+	reg.Create(dt)
+	reg.Create(twin.NewDigitalTwin("pump-1", "pump"))
+
+	pubsub := messaging_sim.NewPubSub()
+	m := NewManager(reg, pubsub)
+	if err := m.SetPolicy(Policy{FeatureID: "control", Property: "setpoint", TwinType: "boiler"}); err != nil {
+		t.Fatalf("Failed to set policy: %v", err)
+	}
+	return m, reg, pubsub
+}
+
+func TestPolicies(t *testing.T) {
+	m, reg, _ := setupManager(t)
+
+	if err := m.SetPolicy(Policy{FeatureID: "control"}); !errors.Is(err, ErrInvalidPolicy) {
+		t.Errorf("Expected ErrInvalidPolicy, got %v", err)
+	}
+	m.SetPolicy(Policy{FeatureID: "control", Property: "mode"})
+
+	boiler, _ := reg.Get("boiler-1")
+	pump, _ := reg.Get("pump-1")
+	if !m.RequiresApproval(boiler, "control", "setpoint") || m.RequiresApproval(pump, "control", "setpoint") {
+		t.Error("Expected the setpoint policy to apply to boilers only")
+	}
+	if !m.RequiresApproval(pump, "control", "mode") {
+		t.Error("Expected the mode policy to apply to all twins")
+	}
+
+	policies := m.Policies()
+	if len(policies) != 2 || policies[0].Property != "mode" {
+		t.Errorf("Expected policies sorted by property, got %+v", policies)
+	}
+
+	m.RemovePolicy("control", "mode")
+	if m.RequiresApproval(pump, "control", "mode") {
+		t.Error("Expected removed policy not to apply")
+	}
+}
+
+func TestHold(t *testing.T) {
+	m, reg, _ := setupManager(t)
+	boiler, _ := reg.Get("boiler-1")
+
+	desired := map[string]interface{}{"setpoint": 80.0, "fan": "auto"}
+	held := m.Hold(boiler, "control", desired)
+	if len(held) != 1 || held["setpoint"] != 80.0 {
+		t.Errorf("Expected setpoint to be held, got %v", held)
+	}
+	if len(desired) != 1 || desired["fan"] != "auto" {
+		t.Errorf("Expected fan to remain, got %v", desired)
+	}
+
+	// Unchanged values need no approval
+	desired = map[string]interface{}{"setpoint": 60.0}
+	if held := m.Hold(boiler, "control", desired); len(held) != 0 || len(desired) != 1 {
+		t.Errorf("Expected unchanged setpoint not to be held, got %v", held)
+	}
+}
+
+func TestApprove(t *testing.T) {
+	m, reg, pubsub := setupManager(t)
+	events := pubsub.Subscribe("#")
+
+	if _, err := m.Submit("boiler-1", "control", nil, "alice"); !errors.Is(err, ErrInvalidChangeRequest) {
+		t.Errorf("Expected ErrInvalidChangeRequest, got %v", err)
+	}
+	if _, err := m.Submit("missing", "control", map[string]interface{}{"setpoint": 1.0}, "alice"); err != registry.ErrTwinNotFound {
+		t.Errorf("Expected ErrTwinNotFound, got %v", err)
+	}
+
+	cr, err := m.Submit("boiler-1", "control", map[string]interface{}{"setpoint": 80.0}, "alice")
+	if err != nil {
+		t.Fatalf("Failed to submit change request: %v", err)
+	}
+	if cr.State != StatePending {
+		t.Errorf("Expected pending change request, got %s", cr.State)
+	}
+	if msg := <-events; msg.Topic != CreatedTopic {
+		t.Errorf("Expected %s, got %s", CreatedTopic, msg.Topic)
+	}
+
+	// The value is not applied before approval
+	boiler, _ := reg.Get("boiler-1")
+	control, _ := boiler.GetFeature("control")
+	if val, _ := control.GetDesiredProperty("setpoint"); val != 60.0 {
+		t.Errorf("Expected setpoint 60 before approval, got %v", val)
+	}
+
+	if _, err := m.Approve(cr.ID, "alice", ""); err != ErrSelfReview {
+		t.Errorf("Expected ErrSelfReview, got %v", err)
+	}
+	if _, err := m.Approve(cr.ID, "", ""); err != ErrSelfReview {
+		t.Errorf("Expected ErrSelfReview without a reviewer, got %v", err)
+	}
+	if _, err := m.Approve("missing", "bob", ""); err != ErrChangeRequestNotFound {
+		t.Errorf("Expected ErrChangeRequestNotFound, got %v", err)
+	}
+
+	cr, err = m.Approve(cr.ID, "bob", "checked with operations")
+	if err != nil {
+		t.Fatalf("Failed to approve change request: %v", err)
+	}
+	if cr.State != StateApproved || cr.ReviewedBy != "bob" || cr.ReviewedAt == nil {
+		t.Errorf("Unexpected change request: %+v", cr)
+	}
+	if val, _ := control.GetDesiredProperty("setpoint"); val != 80.0 {
+		t.Errorf("Expected setpoint 80 after approval, got %v", val)
+	}
+
+	for _, topic := range []string{"feature.updated", ApprovedTopic} {
+		select {
+		case msg := <-events:
+			if msg.Topic != topic {
+				t.Errorf("Expected %s, got %s", topic, msg.Topic)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for %s", topic)
+		}
+	}
+
+	if _, err := m.Reject(cr.ID, "carol", ""); err != ErrAlreadyReviewed {
+		t.Errorf("Expected ErrAlreadyReviewed, got %v", err)
+	}
+}
+
+func TestReject(t *testing.T) {
+	m, reg, _ := setupManager(t)
+
+	cr, _ := m.Submit("boiler-1", "control", map[string]interface{}{"setpoint": 95.0}, "alice")
+	cr, err := m.Reject(cr.ID, "bob", "too hot")
+	if err != nil {
+		t.Fatalf("Failed to reject change request: %v", err)
+	}
+	if cr.State != StateRejected || cr.Comment != "too hot" {
+		t.Errorf("Unexpected change request: %+v", cr)
+	}
+
+	boiler, _ := reg.Get("boiler-1")
+	control, _ := boiler.GetFeature("control")
+	if val, _ := control.GetDesiredProperty("setpoint"); val != 60.0 {
+		t.Errorf("Expected setpoint to stay 60, got %v", val)
+	}
+}
+
+func TestApproveDeletedTwin(t *testing.T) {
+	m, reg, _ := setupManager(t)
+
+	cr, _ := m.Submit("boiler-1", "control", map[string]interface{}{"setpoint": 80.0}, "alice")
+	reg.Delete("boiler-1")
+
+	if _, err := m.Approve(cr.ID, "bob", ""); err != registry.ErrTwinNotFound {
+		t.Errorf("Expected ErrTwinNotFound, got %v", err)
+	}
+	if cr, _ := m.Get(cr.ID); cr.State != StatePending {
+		t.Errorf("Expected change request to stay pending, got %s", cr.State)
+	}
+}
+
+func TestListAndPrune(t *testing.T) {
+	m, _, _ := setupManager(t)
+
+	var first ChangeRequest
+	for i := 0; i < MaxRequests+5; i++ {
+		cr, err := m.Submit("boiler-1", "control", map[string]interface{}{"setpoint": float64(i)}, "alice")
+		if err != nil {
+			t.Fatalf("Failed to submit change request: %v", err)
+		}
+		if i == 0 {
+			first = cr
+			m.Reject(cr.ID, "bob", "")
+		}
+	}
+
+	if _, err := m.Get(first.ID); err != ErrChangeRequestNotFound {
+		t.Errorf("Expected the reviewed request to be pruned, got %v", err)
+	}
+	if pending := m.List(StatePending); len(pending) != MaxRequests+4 {
+		t.Errorf("Expected pending requests to be kept, got %d", len(pending))
+	}
+	if rejected := m.List(StateRejected); len(rejected) != 0 {
+		t.Errorf("Expected no rejected requests, got %d", len(rejected))
+	}
+
+	list := m.List("")
+	for i := 1; i < len(list); i++ {
+		if list[i].CreatedAt.After(list[i-1].CreatedAt) {
+			t.Fatalf("Expected newest first at %d", i)
+		}
+	}
+}
@@ -0,0 +1,336 @@
+package attachment
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/objstore"
+)
+
+// Common errors
+var (
+	ErrAttachmentNotFound = errors.New("attachment not found")
+	ErrInvalidAttachment  = errors.New("invalid attachment")
+	ErrTooLarge           = errors.New("attachment too large")
+	ErrUnsupportedType    = errors.New("unsupported attachment content type")
+)
+
+// DefaultMaxSize is the largest attachment accepted when no limit is configured
+const DefaultMaxSize = 10 << 20
+
+// MaxNameLength is the maximum length of an attachment's file name in bytes
+const MaxNameLength = 255
+
+// Metadata describes a stored attachment
+type Metadata struct {
+	ID          string    `json:"id"`
+	TwinID      string    `json:"twinId"`
+	Name        string    `json:"name"`
+	ContentType string    `json:"contentType"`
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256"`
+	UploadedBy  string    `json:"uploadedBy,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// Options configure where attachments are stored and what is accepted
+type Options struct {
+	Prefix       string   // Prefix of the object keys
+	MaxSize      int64    // Largest attachment in bytes, DefaultMaxSize when zero
+	AllowedTypes []string // Media types such as "application/pdf" or "image/*"; any type when empty
+}
+
+// Manager stores small binary artifacts of twins, such as photos and
+// calibration certificates, in an object store. Each attachment is kept as
+// two objects: its content and a JSON metadata object written after it, so
+// that an attachment exists once its metadata does.
+type Manager struct {
+	store   objstore.Store
+	options Options
+	now     func() time.Time
+}
+
+// NewManager creates a manager keeping attachments in a store
+func NewManager(store objstore.Store, options Options) *Manager {
+	if options.MaxSize <= 0 {
+		options.MaxSize = DefaultMaxSize
+	}
+	return &Manager{
+		store:   store,
+		options: options,
+		now:     time.Now,
+	}
+}
+
+// MaxSize returns the largest attachment accepted, in bytes
+func (m *Manager) MaxSize() int64 {
+	return m.options.MaxSize
+}
+
+// twinPrefix returns the key prefix of a twin's attachments
+func (m *Manager) twinPrefix(twinID string) string {
+	return m.options.Prefix + "attachments/" + url.PathEscape(twinID) + "/"
+}
+
+// contentKey returns the object key of an attachment's content
+func (m *Manager) contentKey(twinID, id string) string {
+	return m.twinPrefix(twinID) + id
+}
+
+// metadataKey returns the object key of an attachment's metadata
+func (m *Manager) metadataKey(twinID, id string) string {
+	return m.contentKey(twinID, id) + ".json"
+}
+
+// Add stores an attachment. A missing or generic content type is detected
+// from the content.
+func (m *Manager) Add(ctx context.Context, twinID, name, contentType, uploadedBy string, data []byte) (Metadata, error) {
+	if twinID == "" {
+		return Metadata{}, fmt.Errorf("%w: twin ID is required", ErrInvalidAttachment)
+	}
+	if len(data) == 0 {
+		return Metadata{}, fmt.Errorf("%w: content is empty", ErrInvalidAttachment)
+	}
+	if int64(len(data)) > m.options.MaxSize {
+		return Metadata{}, fmt.Errorf("%w: %d bytes exceed the limit of %d", ErrTooLarge, len(data), m.options.MaxSize)
+	}
+
+	name = path.Base(strings.ReplaceAll(strings.TrimSpace(name), "\\", "/"))
+	if name == "." || name == "/" {
+		name = ""
+	}
+	if len(name) > MaxNameLength {
+		return Metadata{}, fmt.Errorf("%w: name exceeds %d bytes", ErrInvalidAttachment, MaxNameLength)
+	}
+
+	contentType, err := m.contentType(contentType, data)
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return Metadata{}, err
+	}
+
+	sum := sha256.Sum256(data)
+	meta := Metadata{
+		ID:          hex.EncodeToString(id),
+		TwinID:      twinID,
+		Name:        name,
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		SHA256:      hex.EncodeToString(sum[:]),
+		UploadedBy:  uploadedBy,
+		CreatedAt:   m.now().UTC(),
+	}
+	if meta.Name == "" {
+		meta.Name = meta.ID
+	}
+
+	encoded, err := json.Marshal(meta)
+	if err != nil {
+		return Metadata{}, err
+	}
+	if err := m.store.Put(ctx, m.contentKey(twinID, meta.ID), data); err != nil {
+		return Metadata{}, err
+	}
+	if err := m.store.Put(ctx, m.metadataKey(twinID, meta.ID), encoded); err != nil {
+		m.store.Delete(ctx, m.contentKey(twinID, meta.ID))
+		return Metadata{}, err
+	}
+	return meta, nil
+}
+
+// contentType normalizes the given content type, detecting it from the
+// content when it is missing or generic, and checks that it is allowed
+func (m *Manager) contentType(given string, data []byte) (string, error) {
+	mediaType, params := "", map[string]string(nil)
+	if given != "" {
+		var err error
+		if mediaType, params, err = mime.ParseMediaType(given); err != nil {
+			return "", fmt.Errorf("%w: %v", ErrInvalidAttachment, err)
+		}
+	}
+	if mediaType == "" || mediaType == "application/octet-stream" {
+		detected, detectedParams, err := mime.ParseMediaType(http.DetectContentType(data))
+		if err == nil {
+			mediaType, params = detected, detectedParams
+		}
+	}
+
+	if !m.allowed(mediaType) {
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedType, mediaType)
+	}
+	return mime.FormatMediaType(mediaType, params), nil
+}
+
+// allowed reports whether a media type matches the allowed types
+func (m *Manager) allowed(mediaType string) bool {
+	if len(m.options.AllowedTypes) == 0 {
+		return true
+	}
+	for _, pattern := range m.options.AllowedTypes {
+		pattern = strings.ToLower(pattern)
+		if pattern == mediaType || (strings.HasSuffix(pattern, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(pattern, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// List returns the attachments of a twin ordered by creation time
+func (m *Manager) List(ctx context.Context, twinID string) ([]Metadata, error) {
+	keys, err := m.store.List(ctx, m.twinPrefix(twinID))
+	if err != nil {
+		return nil, err
+	}
+
+	attachments := []Metadata{}
+	for _, key := range keys {
+		if !strings.HasSuffix(key, ".json") {
+			continue
+		}
+		meta, err := m.readMetadata(ctx, key)
+		if err == ErrAttachmentNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, meta)
+	}
+
+	sort.Slice(attachments, func(i, j int) bool {
+		if !attachments[i].CreatedAt.Equal(attachments[j].CreatedAt) {
+			return attachments[i].CreatedAt.Before(attachments[j].CreatedAt)
+		}
+		return attachments[i].ID < attachments[j].ID
+	})
+	return attachments, nil
+}
+
+// Get returns the metadata of an attachment
+func (m *Manager) Get(ctx context.Context, twinID, id string) (Metadata, error) {
+	if !validID(id) {
+		return Metadata{}, ErrAttachmentNotFound
+	}
+	return m.readMetadata(ctx, m.metadataKey(twinID, id))
+}
+
+// Content returns the metadata and content of an attachment
+func (m *Manager) Content(ctx context.Context, twinID, id string) (Metadata, []byte, error) {
+	meta, err := m.Get(ctx, twinID, id)
+	if err != nil {
+		return Metadata{}, nil, err
+	}
+
+	data, err := m.store.Get(ctx, m.contentKey(twinID, id))
+	if err == objstore.ErrObjectNotFound {
+		return Metadata{}, nil, ErrAttachmentNotFound
+	}
+	if err != nil {
+		return Metadata{}, nil, err
+	}
+	return meta, data, nil
+}
+
+// Delete removes an attachment
+func (m *Manager) Delete(ctx context.Context, twinID, id string) error {
+	if _, err := m.Get(ctx, twinID, id); err != nil {
+		return err
+	}
+
+	if err := m.store.Delete(ctx, m.metadataKey(twinID, id)); err != nil {
+		return err
+	}
+	return m.store.Delete(ctx, m.contentKey(twinID, id))
+}
+
+// DeleteTwin removes all attachments of a twin
+func (m *Manager) DeleteTwin(ctx context.Context, twinID string) error {
+	keys, err := m.store.List(ctx, m.twinPrefix(twinID))
+	if err != nil {
+		return err
+	}
+
+	// Metadata first, so that no attachment is left without its content
+	sort.Slice(keys, func(i, j int) bool {
+		return strings.HasSuffix(keys[i], ".json") && !strings.HasSuffix(keys[j], ".json")
+	})
+	for _, key := range keys {
+		if err := m.store.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RenameTwin moves all attachments of a twin to its new ID. Each attachment
+// is copied before the attachments under the old ID are removed, so none is
+// lost if moving fails halfway. Attachment IDs are unique, so attachments
+// already kept for the new ID, as when twins are merged, stay as they are.
+func (m *Manager) RenameTwin(ctx context.Context, oldID, newID string) error {
+	list, err := m.List(ctx, oldID)
+	if err != nil {
+		return err
+	}
+
+	for _, meta := range list {
+		_, data, err := m.Content(ctx, oldID, meta.ID)
+		if err != nil {
+			return err
+		}
+		meta.TwinID = newID
+		encoded, err := json.Marshal(meta)
+		if err != nil {
+			return err
+		}
+		if err := m.store.Put(ctx, m.contentKey(newID, meta.ID), data); err != nil {
+			return err
+		}
+		if err := m.store.Put(ctx, m.metadataKey(newID, meta.ID), encoded); err != nil {
+			return err
+		}
+	}
+	return m.DeleteTwin(ctx, oldID)
+}
+
+// readMetadata reads a metadata object
+func (m *Manager) readMetadata(ctx context.Context, key string) (Metadata, error) {
+	data, err := m.store.Get(ctx, key)
+	if err == objstore.ErrObjectNotFound {
+		return Metadata{}, ErrAttachmentNotFound
+	}
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	var meta Metadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return Metadata{}, fmt.Errorf("invalid attachment metadata %s: %v", key, err)
+	}
+	return meta, nil
+}
+
+// validID reports whether an ID can have been assigned by Add, so that IDs
+// from requests cannot address other objects
+func validID(id string) bool {
+	if len(id) != 16 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
@@ -0,0 +1,101 @@
+package attachment
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/objstore"
+)
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func TestAddAndRead(t *testing.T) {
+	ctx := context.Background()
+	store := objstore.NewMemoryStore()
+	m := NewManager(store, Options{Prefix: "dt/"})
+
+	meta, err := m.Add(ctx, "pump-1", "photos/../front.png", "", "alice", pngHeader)
+	if err != nil {
+		t.Fatalf("Failed to add attachment: %v", err)
+	}
+	if meta.Name != "front.png" || meta.ContentType != "image/png" || meta.Size != int64(len(pngHeader)) || meta.UploadedBy != "alice" {
+		t.Errorf("Unexpected metadata %+v", meta)
+	}
+	if keys, _ := store.List(ctx, "dt/attachments/pump-1/"); len(keys) != 2 {
+		t.Errorf("Expected content and metadata objects, got %v", keys)
+	}
+
+	cert, _ := m.Add(ctx, "pump-1", "", "text/plain; charset=UTF-8", "bob", []byte("calibrated"))
+	if cert.Name != cert.ID || cert.ContentType != "text/plain; charset=UTF-8" {
+		t.Errorf("Expected the ID as name and the given content type, got %+v", cert)
+	}
+
+	list, err := m.List(ctx, "pump-1")
+	if err != nil || len(list) != 2 || list[0].ID != meta.ID {
+		t.Errorf("Expected 2 attachments in creation order, got %+v, %v", list, err)
+	}
+
+	got, data, err := m.Content(ctx, "pump-1", cert.ID)
+	if err != nil || string(data) != "calibrated" || got.SHA256 != cert.SHA256 {
+		t.Errorf("Unexpected content %q, %+v, %v", data, got, err)
+	}
+	for _, id := range []string{"missing", "../../x", meta.ID[:15] + "0"} {
+		if _, err := m.Get(ctx, "pump-1", id); err != ErrAttachmentNotFound {
+			t.Errorf("Expected ErrAttachmentNotFound for %q, got %v", id, err)
+		}
+	}
+	if _, err := m.Get(ctx, "pump-2", meta.ID); err != ErrAttachmentNotFound {
+		t.Errorf("Expected attachments to belong to their twin, got %v", err)
+	}
+
+	if err := m.Delete(ctx, "pump-1", meta.ID); err != nil {
+		t.Errorf("Failed to delete attachment: %v", err)
+	}
+	if err := m.Delete(ctx, "pump-1", meta.ID); err != ErrAttachmentNotFound {
+		t.Errorf("Expected ErrAttachmentNotFound, got %v", err)
+	}
+
+	if err := m.RenameTwin(ctx, "pump-1", "pump-3"); err != nil {
+		t.Fatalf("Failed to rename twin: %v", err)
+	}
+	if list, _ := m.List(ctx, "pump-1"); len(list) != 0 {
+		t.Errorf("Expected no attachments of pump-1 after renaming it, got %+v", list)
+	}
+	list, _ = m.List(ctx, "pump-3")
+	if len(list) != 1 || list[0].TwinID != "pump-3" || list[0].ID != cert.ID {
+		t.Fatalf("Expected the attachment of pump-1 on pump-3, got %+v", list)
+	}
+	if _, data, err := m.Content(ctx, "pump-3", cert.ID); err != nil || string(data) != "calibrated" {
+		t.Errorf("Unexpected content %q after renaming: %v", data, err)
+	}
+
+	m.DeleteTwin(ctx, "pump-3")
+	if keys, _ := store.List(ctx, "dt/"); len(keys) != 0 {
+		t.Errorf("Expected no objects after deleting the twin, got %v", keys)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	ctx := context.Background()
+	m := NewManager(objstore.NewMemoryStore(), Options{MaxSize: 16, AllowedTypes: []string{"image/*", "application/pdf"}})
+
+	if _, err := m.Add(ctx, "pump-1", "big.png", "image/png", "", make([]byte, 17)); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Expected ErrTooLarge, got %v", err)
+	}
+	if _, err := m.Add(ctx, "pump-1", "notes.txt", "text/plain", "", []byte("notes")); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("Expected ErrUnsupportedType, got %v", err)
+	}
+	if _, err := m.Add(ctx, "pump-1", "dump.bin", "application/octet-stream", "", []byte("plain text")); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("Expected the detected type to be checked, got %v", err)
+	}
+	if _, err := m.Add(ctx, "pump-1", "empty.png", "image/png", "", nil); !errors.Is(err, ErrInvalidAttachment) {
+		t.Errorf("Expected ErrInvalidAttachment for empty content, got %v", err)
+	}
+	if _, err := m.Add(ctx, "pump-1", "x.png", "not a type", "", pngHeader[:8]); !errors.Is(err, ErrInvalidAttachment) {
+		t.Errorf("Expected ErrInvalidAttachment for an invalid content type, got %v", err)
+	}
+	if _, err := m.Add(ctx, "pump-1", "front.png", "IMAGE/PNG", "", pngHeader[:8]); err != nil {
+		t.Errorf("Expected an allowed image, got %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+// Package auth describes the authenticated callers of the API: who they are
+// and what their role allows them to do. Identities are established by
+// providers such as package oidc and travel with the request context.
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Common errors
+var (
+	ErrInvalidRole = errors.New("invalid role")
+)
+
+// Role is the access a caller is granted
+type Role string
+
+// Supported roles, each allowing what the previous one does
+const (
+	RoleViewer Role = "viewer" // Read twins and settings
+	RoleEditor Role = "editor" // Read and change twins and settings
+	RoleAdmin  Role = "admin"  // Everything, including managing credentials
+)
+
+// rank orders the roles; unknown roles rank below all
+var rank = map[Role]int{RoleViewer: 1, RoleEditor: 2, RoleAdmin: 3}
+
+// ParseRole validates a role name
+func ParseRole(s string) (Role, error) {
+	if _, ok := rank[Role(s)]; !ok {
+		return "", fmt.Errorf("%w: %q", ErrInvalidRole, s)
+	}
+	return Role(s), nil
+}
+
+// Includes reports whether the role allows everything other allows
+func (r Role) Includes(other Role) bool {
+	return rank[r] > 0 && rank[r] >= rank[other]
+}
+
+// Allows reports whether the role allows requests with a method. Reads need
+// the viewer role, anything else the editor role.
+func (r Role) Allows(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return r.Includes(RoleViewer)
+	}
+	return r.Includes(RoleEditor)
+}
+
+// Highest returns the highest of roles, empty if there are none
+func Highest(roles ...Role) Role {
+	var highest Role
+	for _, r := range roles {
+		if rank[r] > rank[highest] {
+			highest = r
+		}
+	}
+	return highest
+}
+
+// Identity is an authenticated caller
+type Identity struct {
+	Subject   string    `json:"subject"`
+	User      string    `json:"user"` // Name recorded as the X-User of requests
+	Email     string    `json:"email,omitempty"`
+	Groups    []string  `json:"groups,omitempty"`
+	Role      Role      `json:"role,omitempty"`
+	Issuer    string    `json:"issuer,omitempty"`
+	Scope     *Scope    `json:"scope,omitempty"` // Set for scoped tokens, limiting the twins and verbs
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type contextKey struct{}
+
+// WithIdentity returns a context carrying an identity
+func WithIdentity(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the identity of a context, nil if there is none
+func FromContext(ctx context.Context) *Identity {
+	id, _ := ctx.Value(contextKey{}).(*Identity)
+	return id
+}
@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestRoles(t *testing.T) {
+	if _, err := ParseRole("root"); !errors.Is(err, ErrInvalidRole) {
+		t.Errorf("Expected ErrInvalidRole, got %v", err)
+	}
+
+	for _, tc := range []struct {
+		role          Role
+		read, write   bool
+		includesAdmin bool
+	}{
+		{"", false, false, false},
+		{RoleViewer, true, false, false},
+		{RoleEditor, true, true, false},
+		{RoleAdmin, true, true, true},
+	} {
+		if tc.role.Allows(http.MethodGet) != tc.read || tc.role.Allows(http.MethodDelete) != tc.write || tc.role.Includes(RoleAdmin) != tc.includesAdmin {
+			t.Errorf("Unexpected permissions of role %q", tc.role)
+		}
+	}
+
+	if r := Highest(RoleViewer, "", RoleAdmin, RoleEditor); r != RoleAdmin {
+		t.Errorf("Expected admin to be the highest role, got %q", r)
+	}
+	if r := Highest(); r != "" {
+		t.Errorf("Expected no role, got %q", r)
+	}
+}
+
+func TestContext(t *testing.T) {
+	if FromContext(context.Background()) != nil {
+		t.Error("Expected no identity")
+	}
+	id := &Identity{Subject: "u-42", User: "alice"}
+	if got := FromContext(WithIdentity(context.Background(), id)); got != id {
+		t.Errorf("Expected the identity, got %+v", got)
+	}
+}
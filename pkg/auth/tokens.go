@@ -0,0 +1,331 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Token errors
+var (
+	ErrInvalidToken  = errors.New("invalid scoped token")
+	ErrExpiredToken  = errors.New("scoped token expired")
+	ErrRevokedToken  = errors.New("scoped token revoked")
+	ErrTokenNotFound = errors.New("scoped token not found")
+	ErrInvalidGrant  = errors.New("invalid token grant")
+)
+
+// TokenPrefix starts every scoped token, telling them apart from tokens of
+// identity providers
+const TokenPrefix = "dt_"
+
+// Token lifetimes
+const (
+	DefaultTTL = time.Hour
+	MaxTTL     = 24 * time.Hour
+)
+
+// Verb is a kind of request a scoped token may make
+type Verb string
+
+// Supported verbs
+const (
+	VerbRead   Verb = "read"   // GET and HEAD
+	VerbWrite  Verb = "write"  // POST, PUT and PATCH
+	VerbDelete Verb = "delete" // DELETE
+)
+
+// VerbOf returns the verb of a request method
+func VerbOf(method string) Verb {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return VerbRead
+	case http.MethodDelete:
+		return VerbDelete
+	}
+	return VerbWrite
+}
+
+// Scope limits a scoped token to twins, listed or by group, and verbs
+type Scope struct {
+	Twins  []string `json:"twins,omitempty"`
+	Groups []string `json:"groups,omitempty"`
+	Verbs  []Verb   `json:"verbs"`
+}
+
+// Allows reports whether the scope allows a verb
+func (s *Scope) Allows(verb Verb) bool {
+	for _, v := range s.Verbs {
+		if v == verb {
+			return true
+		}
+	}
+	return false
+}
+
+// Includes reports whether the scope includes a twin, given the groups it
+// is a member of
+func (s *Scope) Includes(twinID string, groups []string) bool {
+	for _, id := range s.Twins {
+		if id == twinID {
+			return true
+		}
+	}
+	for _, g := range groups {
+		for _, name := range s.Groups {
+			if g == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Role returns the role of callers with the scope: editor if it allows
+// changes, viewer otherwise
+func (s *Scope) Role() Role {
+	if s.Allows(VerbWrite) || s.Allows(VerbDelete) {
+		return RoleEditor
+	}
+	return RoleViewer
+}
+
+// validate checks that a scope names twins or groups and known verbs
+func (s *Scope) validate() error {
+	if len(s.Twins) == 0 && len(s.Groups) == 0 {
+		return fmt.Errorf("%w: at least one twin or group is required", ErrInvalidGrant)
+	}
+	if len(s.Verbs) == 0 {
+		return fmt.Errorf("%w: at least one verb is required", ErrInvalidGrant)
+	}
+	for _, v := range s.Verbs {
+		if v != VerbRead && v != VerbWrite && v != VerbDelete {
+			return fmt.Errorf("%w: unknown verb %q", ErrInvalidGrant, v)
+		}
+	}
+	return nil
+}
+
+// Grant is a scoped token issued to a service account
+type Grant struct {
+	ID        string    `json:"id"`
+	Account   string    `json:"account"` // Service account, recorded as the X-User of its requests
+	Scope     Scope     `json:"scope"`
+	IssuedBy  string    `json:"issuedBy,omitempty"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	CreatedAt time.Time `json:"createdAt"`
+	Token     string    `json:"token,omitempty"`
+}
+
+// Identity returns the identity of requests made with the grant
+func (g *Grant) Identity() *Identity {
+	scope := g.Scope
+	return &Identity{
+		Subject:   g.ID,
+		User:      g.Account,
+		Role:      scope.Role(),
+		Scope:     &scope,
+		ExpiresAt: g.ExpiresAt,
+	}
+}
+
+// claims is the signed content of a token
+type claims struct {
+	ID        string `json:"jti"`
+	Account   string `json:"sub"`
+	Scope     Scope  `json:"scope"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// Tokens issues and verifies scoped tokens. Tokens are signed with
+// HMAC-SHA256, so they can be verified without storage. Issued grants are
+// remembered so that they can be listed and revoked; revoked IDs are kept
+// until the grant expires.
+type Tokens struct {
+	secret  []byte
+	grants  map[string]*Grant
+	revoked map[string]time.Time // Grant ID -> expiry
+	mutex   sync.RWMutex
+}
+
+// NewTokens creates a token issuer signing tokens with a random secret.
+// Tokens only stay valid across restarts if the secret is set with SetSecret.
+func NewTokens() *Tokens {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(err)
+	}
+
+	return &Tokens{
+		secret:  secret,
+		grants:  make(map[string]*Grant),
+		revoked: make(map[string]time.Time),
+	}
+}
+
+// SetSecret replaces the signing secret. Tokens signed with the previous secret become invalid.
+func (t *Tokens) SetSecret(secret []byte) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.secret = append([]byte(nil), secret...)
+}
+
+// Issue mints a token for a service account limited to a scope, expiring
+// after ttl, or DefaultTTL when zero
+func (t *Tokens) Issue(account string, scope Scope, ttl time.Duration, issuedBy string) (*Grant, error) {
+	if account == "" {
+		return nil, fmt.Errorf("%w: account is required", ErrInvalidGrant)
+	}
+	if err := scope.validate(); err != nil {
+		return nil, err
+	}
+	if ttl == 0 {
+		ttl = DefaultTTL
+	}
+	if ttl < 0 || ttl > MaxTTL {
+		return nil, fmt.Errorf("%w: ttl must be positive and at most %s", ErrInvalidGrant, MaxTTL)
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	grant := &Grant{
+		ID:        hex.EncodeToString(id),
+		Account:   account,
+		Scope:     scope,
+		IssuedBy:  issuedBy,
+		ExpiresAt: now.Add(ttl).Truncate(time.Second),
+		CreatedAt: now,
+	}
+
+	payload, err := json.Marshal(claims{
+		ID:        grant.ID,
+		Account:   grant.Account,
+		Scope:     grant.Scope,
+		ExpiresAt: grant.ExpiresAt.Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	grant.Token = TokenPrefix + encoded + "." + t.sign(encoded)
+
+	t.pruneExpired(now)
+	t.grants[grant.ID] = grant
+
+	return grant, nil
+}
+
+// Verify checks a token and returns the grant it carries
+func (t *Tokens) Verify(token string) (*Grant, error) {
+	token, ok := strings.CutPrefix(token, TokenPrefix)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	if !hmac.Equal([]byte(signature), []byte(t.sign(encoded))) {
+		return nil, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var c claims
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	expiresAt := time.Unix(c.ExpiresAt, 0)
+	if !time.Now().Before(expiresAt) {
+		return nil, ErrExpiredToken
+	}
+
+	if _, revoked := t.revoked[c.ID]; revoked {
+		return nil, ErrRevokedToken
+	}
+
+	return &Grant{ID: c.ID, Account: c.Account, Scope: c.Scope, ExpiresAt: expiresAt}, nil
+}
+
+// List returns the unexpired grants, of an account unless empty, oldest
+// first, without their tokens
+func (t *Tokens) List(account string) []Grant {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	now := time.Now()
+	result := make([]Grant, 0)
+	for _, grant := range t.grants {
+		if (account == "" || grant.Account == account) && now.Before(grant.ExpiresAt) {
+			g := *grant
+			g.Token = ""
+			result = append(result, g)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.Before(result[j].CreatedAt) })
+	return result
+}
+
+// Revoke invalidates a grant before it expires
+func (t *Tokens) Revoke(id string) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	grant, exists := t.grants[id]
+	if !exists {
+		return ErrTokenNotFound
+	}
+
+	delete(t.grants, id)
+	t.revoked[id] = grant.ExpiresAt
+	return nil
+}
+
+// sign returns the signature of an encoded payload
+func (t *Tokens) sign(encoded string) string {
+	mac := hmac.New(sha256.New, t.secret)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// pruneExpired forgets expired grants and revocations
+func (t *Tokens) pruneExpired(now time.Time) {
+	for id, grant := range t.grants {
+		if !now.Before(grant.ExpiresAt) {
+			delete(t.grants, id)
+		}
+	}
+	for id, expiresAt := range t.revoked {
+		if !now.Before(expiresAt) {
+			delete(t.revoked, id)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokens(t *testing.T) {
+	tokens := NewTokens()
+	scope := Scope{Twins: []string{"pump-1"}, Groups: []string{"line-3"}, Verbs: []Verb{VerbRead, VerbWrite}}
+
+	grant, err := tokens.Issue("line-3-gateway", scope, 0, "admin")
+	if err != nil {
+		t.Fatalf("Failed to issue token: %v", err)
+	}
+	if !strings.HasPrefix(grant.Token, TokenPrefix) || time.Until(grant.ExpiresAt) > DefaultTTL {
+		t.Errorf("Unexpected grant %+v", grant)
+	}
+
+	verified, err := tokens.Verify(grant.Token)
+	if err != nil {
+		t.Fatalf("Failed to verify token: %v", err)
+	}
+	id := verified.Identity()
+	if id.User != "line-3-gateway" || id.Role != RoleEditor || id.Scope == nil {
+		t.Errorf("Unexpected identity %+v", id)
+	}
+	if !id.Scope.Includes("pump-1", nil) || !id.Scope.Includes("valve-9", []string{"line-3"}) || id.Scope.Includes("valve-9", []string{"line-4"}) {
+		t.Error("Expected the scope to include the listed twins and the members of its groups")
+	}
+	if !id.Scope.Allows(VerbOf(http.MethodPatch)) || id.Scope.Allows(VerbOf(http.MethodDelete)) {
+		t.Error("Expected the scope to allow writes but not deletes")
+	}
+
+	if list := tokens.List("line-3-gateway"); len(list) != 1 || list[0].Token != "" || list[0].IssuedBy != "admin" {
+		t.Errorf("Unexpected grants %+v", list)
+	}
+	if list := tokens.List("other"); len(list) != 0 {
+		t.Errorf("Expected no grants of another account, got %+v", list)
+	}
+
+	if err := tokens.Revoke(grant.ID); err != nil {
+		t.Fatalf("Failed to revoke token: %v", err)
+	}
+	if _, err := tokens.Verify(grant.Token); err != ErrRevokedToken {
+		t.Errorf("Expected ErrRevokedToken, got %v", err)
+	}
+	if err := tokens.Revoke(grant.ID); err != ErrTokenNotFound {
+		t.Errorf("Expected ErrTokenNotFound, got %v", err)
+	}
+
+	readOnly, _ := tokens.Issue("dashboard", Scope{Twins: []string{"pump-1"}, Verbs: []Verb{VerbRead}}, time.Minute, "")
+	for name, token := range map[string]string{
+		"tampered":  readOnly.Token[:len(readOnly.Token)-2] + "xx",
+		"no prefix": strings.TrimPrefix(readOnly.Token, TokenPrefix),
+		"malformed": TokenPrefix + "abc",
+	} {
+		if _, err := tokens.Verify(token); err != ErrInvalidToken {
+			t.Errorf("%s: expected ErrInvalidToken, got %v", name, err)
+		}
+	}
+	if verified, _ := tokens.Verify(readOnly.Token); verified.Identity().Role != RoleViewer {
+		t.Error("Expected a read-only token to have the viewer role")
+	}
+
+	tokens.SetSecret([]byte("rotated"))
+	if _, err := tokens.Verify(readOnly.Token); err != ErrInvalidToken {
+		t.Errorf("Expected tokens of the previous secret to become invalid, got %v", err)
+	}
+}
+
+func TestIssueInvalid(t *testing.T) {
+	tokens := NewTokens()
+	read := []Verb{VerbRead}
+
+	for name, tc := range map[string]struct {
+		account string
+		scope   Scope
+		ttl     time.Duration
+	}{
+		"no account":   {"", Scope{Twins: []string{"pump-1"}, Verbs: read}, 0},
+		"no twins":     {"svc", Scope{Verbs: read}, 0},
+		"no verbs":     {"svc", Scope{Twins: []string{"pump-1"}}, 0},
+		"unknown verb": {"svc", Scope{Twins: []string{"pump-1"}, Verbs: []Verb{"admin"}}, 0},
+		"too long":     {"svc", Scope{Twins: []string{"pump-1"}, Verbs: read}, MaxTTL + time.Hour},
+		"negative ttl": {"svc", Scope{Twins: []string{"pump-1"}, Verbs: read}, -time.Hour},
+	} {
+		if _, err := tokens.Issue(tc.account, tc.scope, tc.ttl, ""); !errors.Is(err, ErrInvalidGrant) {
+			t.Errorf("%s: expected ErrInvalidGrant, got %v", name, err)
+		}
+	}
+}
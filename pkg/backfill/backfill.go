@@ -0,0 +1,462 @@
+package backfill
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/clock"
+	"github.com/aleka07/go-digital-twin/pkg/history"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/script"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// Common errors
+var (
+	ErrJobNotFound    = errors.New("backfill job not found")
+	ErrInvalidRequest = errors.New("invalid backfill request")
+	ErrJobFinished    = errors.New("backfill job already finished")
+)
+
+// State is the state of a backfill job
+type State string
+
+// Job states
+const (
+	StatePending   State = "pending"
+	StateRunning   State = "running"
+	StateCompleted State = "completed"
+	StateFailed    State = "failed"
+	StateCancelled State = "cancelled"
+)
+
+// MaxJobs is the number of jobs kept; the oldest finished jobs are removed first
+const MaxJobs = 100
+
+// MaxErrors is the number of per-twin errors kept in a job
+const MaxErrors = 20
+
+// Request selects the script to re-evaluate and the twins to re-evaluate it for
+type Request struct {
+	Script  string    `json:"script"`
+	TwinIDs []string  `json:"twinIds,omitempty"` // All twins of the script's type when empty
+	History bool      `json:"history,omitempty"` // Also recompute the history of computed properties
+	From    time.Time `json:"from,omitempty"`    // Start of the history range, open when zero
+	To      time.Time `json:"to,omitempty"`      // End of the history range, open when zero
+}
+
+// Job reports the progress of a backfill
+type Job struct {
+	ID         string     `json:"id"`
+	Request    Request    `json:"request"`
+	State      State      `json:"state"`
+	Total      int        `json:"total"`
+	Processed  int        `json:"processed"`
+	Updated    int        `json:"updated"`  // Twins whose computed value changed or whose rule triggered
+	Samples    int        `json:"samples"`  // History samples written
+	Failed     int        `json:"failed"`   // Twins the script failed for
+	Progress   float64    `json:"progress"` // Fraction of twins processed, between 0 and 1
+	Errors     []string   `json:"errors,omitempty"`
+	Error      string     `json:"error,omitempty"` // Reason the whole job failed
+	CreatedAt  time.Time  `json:"createdAt"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+// finished reports whether the job has stopped running
+func (j Job) finished() bool {
+	return j.State == StateCompleted || j.State == StateFailed || j.State == StateCancelled
+}
+
+// job is a registered backfill job
+type job struct {
+	Job
+	cancel chan struct{}
+	done   chan struct{}
+}
+
+// Manager runs backfill jobs in the background. Each job re-evaluates a rule
+// or computed property script over existing twins and, for computed
+// properties, optionally over their recorded history.
+type Manager struct {
+	registry *registry.Registry
+	scripts  *script.Manager
+	history  *history.Store
+	jobs     map[string]*job
+	clock    clock.Clock
+	mutex    sync.RWMutex
+}
+
+// NewManager creates a new backfill manager
+func NewManager(reg *registry.Registry, scripts *script.Manager, hist *history.Store) *Manager {
+	return &Manager{
+		registry: reg,
+		scripts:  scripts,
+		history:  hist,
+		jobs:     make(map[string]*job),
+		clock:    clock.System,
+	}
+}
+
+// SetClock sets the clock that job times are read from; nil restores the
+// system clock
+func (m *Manager) SetClock(c clock.Clock) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.clock = clock.OrSystem(c)
+}
+
+// now returns the time of the manager clock
+func (m *Manager) now() time.Time {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return m.clock.Now()
+}
+
+// Start validates a request and starts a job for it in the background
+func (m *Manager) Start(req Request) (Job, error) {
+	if req.Script == "" {
+		return Job{}, fmt.Errorf("%w: script is required", ErrInvalidRequest)
+	}
+	if !req.From.IsZero() && !req.To.IsZero() && req.To.Before(req.From) {
+		return Job{}, fmt.Errorf("%w: to must not be before from", ErrInvalidRequest)
+	}
+
+	status, err := m.scripts.Get(req.Script)
+	if err != nil {
+		return Job{}, err
+	}
+	switch status.Kind {
+	case script.KindComputed:
+	case script.KindRule:
+		if req.History {
+			return Job{}, fmt.Errorf("%w: history can only be backfilled for computed scripts", ErrInvalidRequest)
+		}
+	default:
+		return Job{}, fmt.Errorf("%w: %s scripts cannot be backfilled", ErrInvalidRequest, status.Kind)
+	}
+	if req.History && m.history == nil {
+		return Job{}, fmt.Errorf("%w: history is not available", ErrInvalidRequest)
+	}
+
+	id, err := newID()
+	if err != nil {
+		return Job{}, err
+	}
+
+	j := &job{
+		Job: Job{
+			ID:        id,
+			Request:   req,
+			State:     StatePending,
+			CreatedAt: m.now(),
+		},
+		cancel: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	m.mutex.Lock()
+	m.jobs[id] = j
+	m.prune()
+	snapshot := j.snapshot()
+	m.mutex.Unlock()
+
+	go m.run(j, status)
+	return snapshot, nil
+}
+
+// Get returns a job by ID
+func (m *Manager) Get(id string) (Job, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	j, exists := m.jobs[id]
+	if !exists {
+		return Job{}, ErrJobNotFound
+	}
+	return j.snapshot(), nil
+}
+
+// List returns all jobs, newest first
+func (m *Manager) List() []Job {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	result := make([]Job, 0, len(m.jobs))
+	for _, j := range m.jobs {
+		result = append(result, j.snapshot())
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.After(result[j].CreatedAt) })
+	return result
+}
+
+// Cancel stops a pending or running job
+func (m *Manager) Cancel(id string) (Job, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	j, exists := m.jobs[id]
+	if !exists {
+		return Job{}, ErrJobNotFound
+	}
+	if j.finished() {
+		return j.snapshot(), ErrJobFinished
+	}
+
+	select {
+	case <-j.cancel:
+	default:
+		close(j.cancel)
+	}
+	return j.snapshot(), nil
+}
+
+// Wait blocks until a job has finished and returns it
+func (m *Manager) Wait(id string) (Job, error) {
+	m.mutex.RLock()
+	j, exists := m.jobs[id]
+	m.mutex.RUnlock()
+
+	if !exists {
+		return Job{}, ErrJobNotFound
+	}
+
+	<-j.done
+	return m.Get(id)
+}
+
+// run processes the twins of a job
+func (m *Manager) run(j *job, status script.Status) {
+	defer close(j.done)
+
+	twins := m.twins(j.Request, status.TwinType)
+
+	now := m.now()
+	m.mutex.Lock()
+	j.State = StateRunning
+	j.StartedAt = &now
+	j.Total = len(twins)
+	m.mutex.Unlock()
+
+	for _, dt := range twins {
+		select {
+		case <-j.cancel:
+			m.finish(j, StateCancelled, "")
+			return
+		default:
+		}
+
+		updated, samples, err := m.backfill(j.Request, status, dt)
+		if errors.Is(err, script.ErrScriptNotFound) {
+			m.finish(j, StateFailed, "script was deleted")
+			return
+		}
+
+		m.mutex.Lock()
+		j.Processed++
+		j.Samples += samples
+		if updated {
+			j.Updated++
+		}
+		if err != nil {
+			j.Failed++
+			if len(j.Errors) < MaxErrors {
+				j.Errors = append(j.Errors, fmt.Sprintf("%s: %v", dt.ID, err))
+			}
+		}
+		m.mutex.Unlock()
+	}
+
+	m.finish(j, StateCompleted, "")
+}
+
+// twins returns the twins a job applies to, sorted by ID
+func (m *Manager) twins(req Request, twinType string) []*twin.DigitalTwin {
+	var candidates []*twin.DigitalTwin
+	if len(req.TwinIDs) == 0 {
+		candidates = m.registry.List()
+	} else {
+		for _, id := range req.TwinIDs {
+			if dt, err := m.registry.Get(id); err == nil {
+				candidates = append(candidates, dt)
+			}
+		}
+	}
+
+	result := make([]*twin.DigitalTwin, 0, len(candidates))
+	for _, dt := range candidates {
+		if twinType == "" || dt.Type == twinType {
+			result = append(result, dt)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// backfill re-evaluates a script for a single twin and, when requested,
+// recomputes the history of its computed property
+func (m *Manager) backfill(req Request, status script.Status, dt *twin.DigitalTwin) (bool, int, error) {
+	updated, err := m.scripts.Reevaluate(status.Name, dt)
+	if err != nil {
+		return false, 0, err
+	}
+
+	if !req.History {
+		return updated, 0, nil
+	}
+
+	samples, err := m.backfillHistory(req, status, dt)
+	return updated, samples, err
+}
+
+// event is a recorded property change replayed during a history backfill
+type event struct {
+	property history.Property
+	sample   history.Sample
+}
+
+// backfillHistory replays the recorded property changes of a twin in time order
+// and replaces the history of the computed property with the values the script
+// computes after each change
+func (m *Manager) backfillHistory(req Request, status script.Status, dt *twin.DigitalTwin) (int, error) {
+	target := history.Property{FeatureID: status.Feature, Key: status.Property}
+	state := dt.Clone()
+
+	var events []event
+	for _, p := range m.history.Properties(dt.ID) {
+		if p == target {
+			continue
+		}
+
+		// Start from the last value recorded before the range
+		if !req.From.IsZero() {
+			before := m.history.Query(dt.ID, p.FeatureID, p.Key, time.Time{}, req.From.Add(-time.Nanosecond))
+			if len(before) > 0 {
+				setProperty(state, p, before[len(before)-1].Value)
+			}
+		}
+
+		for _, sample := range m.history.Query(dt.ID, p.FeatureID, p.Key, req.From, req.To) {
+			events = append(events, event{property: p, sample: sample})
+		}
+	}
+
+	if len(events) == 0 {
+		return 0, nil
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].sample.Timestamp.Before(events[j].sample.Timestamp)
+	})
+
+	type result struct {
+		timestamp time.Time
+		value     interface{}
+	}
+	var results []result
+	var lastErr error
+
+	for i := 0; i < len(events); {
+		// Apply all changes recorded at the same time before computing
+		timestamp := events[i].sample.Timestamp
+		for ; i < len(events) && events[i].sample.Timestamp.Equal(timestamp); i++ {
+			setProperty(state, events[i].property, events[i].sample.Value)
+		}
+
+		value, err := m.scripts.Value(status.Name, state)
+		if err != nil {
+			if errors.Is(err, script.ErrScriptNotFound) {
+				return 0, err
+			}
+			lastErr = err
+			continue
+		}
+		results = append(results, result{timestamp: timestamp, value: value})
+	}
+
+	m.history.DeleteRange(dt.ID, target.FeatureID, target.Key, events[0].sample.Timestamp, events[len(events)-1].sample.Timestamp)
+	for _, r := range results {
+		m.history.Record(dt.ID, target.FeatureID, target.Key, r.value, r.timestamp)
+	}
+
+	if lastErr != nil {
+		return len(results), fmt.Errorf("history: %v", lastErr)
+	}
+	return len(results), nil
+}
+
+// finish records the final state of a job
+func (m *Manager) finish(j *job, state State, reason string) {
+	now := m.now()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	j.State = state
+	j.Error = reason
+	j.FinishedAt = &now
+}
+
+// prune removes the oldest finished jobs beyond MaxJobs; the caller must hold the mutex
+func (m *Manager) prune() {
+	if len(m.jobs) <= MaxJobs {
+		return
+	}
+
+	var finished []*job
+	for _, j := range m.jobs {
+		if j.finished() {
+			finished = append(finished, j)
+		}
+	}
+
+	sort.Slice(finished, func(i, k int) bool { return finished[i].CreatedAt.Before(finished[k].CreatedAt) })
+	for _, j := range finished {
+		if len(m.jobs) <= MaxJobs {
+			break
+		}
+		delete(m.jobs, j.ID)
+	}
+}
+
+// snapshot returns a copy of the job; the caller must hold the mutex
+func (j *job) snapshot() Job {
+	result := j.Job
+	result.Errors = append([]string(nil), j.Errors...)
+
+	switch {
+	case j.Total > 0:
+		result.Progress = float64(j.Processed) / float64(j.Total)
+	case j.finished():
+		result.Progress = 1
+	}
+	return result
+}
+
+// setProperty sets a property on a twin, creating the feature if needed
+func setProperty(dt *twin.DigitalTwin, p history.Property, value interface{}) {
+	feature, exists := dt.GetFeature(p.FeatureID)
+	if !exists {
+		feature = twin.NewFeatureStateWithClock(dt.Clock())
+		dt.AddFeature(p.FeatureID, feature)
+	}
+	feature.SetProperty(p.Key, value)
+}
+
+// newID generates a random job ID
+func newID() (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
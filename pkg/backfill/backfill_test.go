@@ -0,0 +1,204 @@
+package backfill
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/history"
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/script"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+const qualitySource = `
+def compute(twin):
+    c = twin["features"]["counter"]["properties"]
+    return c["good"] / c["total"]
+`
+
+func setupManager(t *testing.T) (*Manager, *registry.Registry, *script.Manager, *history.Store) {
+	t.Helper()
+
+	reg := registry.NewRegistry()
+	for i := 1; i <= 3; i++ {
+		dt := twin.NewDigitalTwin(fmt.Sprintf("machine-%d", i), "machine")
+		counter := twin.NewFeatureState()
+		counter.SetProperty("good", float64(50+10*i))
+		counter.SetProperty("total", 100.0)
+		dt.AddFeature("counter", counter)
+		reg.Create(dt)
+	}
+	reg.Create(twin.NewDigitalTwin("pump-1", "pump"))
+
+	scripts := script.NewManager(reg, messaging_sim.NewPubSub())
+	err := scripts.Create(script.Script{Name: "quality", Kind: script.KindComputed, TwinType: "machine", Feature: "oee", Property: "quality", Source: qualitySource})
+	if err != nil {
+		t.Fatalf("Failed to create script: %v", err)
+	}
+
+	hist := history.NewStore(history.DefaultCapacity)
+	return NewManager(reg, scripts, hist), reg, scripts, hist
+}
+
+func TestStartValidation(t *testing.T) {
+	m, _, scripts, _ := setupManager(t)
+	scripts.Create(script.Script{Name: "rule", Kind: script.KindRule, Source: "def evaluate(twin): return True"})
+	scripts.Create(script.Script{Name: "transform", Kind: script.KindTransform, Source: "def transform(t): return t[\"features\"]"})
+
+	now := time.Now()
+	invalid := []Request{
+		{},
+		{Script: "quality", From: now, To: now.Add(-time.Hour)},
+		{Script: "rule", History: true},
+		{Script: "transform"},
+	}
+	for _, req := range invalid {
+		if _, err := m.Start(req); !errors.Is(err, ErrInvalidRequest) {
+			t.Errorf("Expected ErrInvalidRequest for %+v, got %v", req, err)
+		}
+	}
+
+	if _, err := m.Start(Request{Script: "missing"}); err != script.ErrScriptNotFound {
+		t.Errorf("Expected ErrScriptNotFound, got %v", err)
+	}
+}
+
+func TestBackfillTwins(t *testing.T) {
+	m, reg, _, _ := setupManager(t)
+
+	job, err := m.Start(Request{Script: "quality"})
+	if err != nil {
+		t.Fatalf("Failed to start job: %v", err)
+	}
+
+	job, err = m.Wait(job.ID)
+	if err != nil {
+		t.Fatalf("Failed to wait for job: %v", err)
+	}
+	if job.State != StateCompleted {
+		t.Errorf("Expected state %s, got %s", StateCompleted, job.State)
+	}
+	if job.Total != 3 || job.Processed != 3 || job.Updated != 3 || job.Progress != 1 {
+		t.Errorf("Unexpected progress: %+v", job)
+	}
+
+	dt, _ := reg.Get("machine-2")
+	oee, exists := dt.GetFeature("oee")
+	if !exists {
+		t.Fatal("Expected oee feature to be computed")
+	}
+	if val, _ := oee.GetProperty("quality"); val != 0.7 {
+		t.Errorf("Expected quality 0.7, got %v", val)
+	}
+
+	pump, _ := reg.Get("pump-1")
+	if _, exists := pump.GetFeature("oee"); exists {
+		t.Error("Expected twins of other types to be skipped")
+	}
+
+	// Selected twins only
+	job, _ = m.Start(Request{Script: "quality", TwinIDs: []string{"machine-1", "missing"}})
+	job, _ = m.Wait(job.ID)
+	if job.Total != 1 || job.Updated != 0 {
+		t.Errorf("Expected one unchanged twin, got %+v", job)
+	}
+
+	if jobs := m.List(); len(jobs) != 2 || jobs[0].ID != job.ID {
+		t.Errorf("Expected 2 jobs newest first, got %v", jobs)
+	}
+	if _, err := m.Cancel(job.ID); err != ErrJobFinished {
+		t.Errorf("Expected ErrJobFinished, got %v", err)
+	}
+	if _, err := m.Get("missing"); err != ErrJobNotFound {
+		t.Errorf("Expected ErrJobNotFound, got %v", err)
+	}
+}
+
+func TestBackfillErrors(t *testing.T) {
+	m, reg, _, _ := setupManager(t)
+
+	// The script fails for a twin without a counter
+	reg.Create(twin.NewDigitalTwin("machine-4", "machine"))
+
+	job, _ := m.Start(Request{Script: "quality"})
+	job, _ = m.Wait(job.ID)
+
+	if job.State != StateCompleted || job.Failed != 1 || len(job.Errors) != 1 {
+		t.Errorf("Expected one failed twin, got %+v", job)
+	}
+}
+
+func TestBackfillHistory(t *testing.T) {
+	m, reg, _, hist := setupManager(t)
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	hist.Record("machine-1", "counter", "good", 80.0, base)
+	hist.Record("machine-1", "counter", "total", 100.0, base)
+	hist.Record("machine-1", "counter", "good", 40.0, base.Add(time.Minute))
+	hist.Record("machine-1", "counter", "total", 50.0, base.Add(2*time.Minute))
+
+	// Stale derived values are replaced
+	hist.Record("machine-1", "oee", "quality", 0.1, base.Add(time.Minute))
+
+	job, _ := m.Start(Request{Script: "quality", TwinIDs: []string{"machine-1"}, History: true})
+	job, _ = m.Wait(job.ID)
+
+	if job.State != StateCompleted || job.Samples != 3 {
+		t.Fatalf("Expected 3 history samples, got %+v", job)
+	}
+
+	samples := hist.Query("machine-1", "oee", "quality", time.Time{}, time.Time{})
+	expected := []float64{0.8, 0.4, 0.8}
+	if len(samples) != len(expected) {
+		t.Fatalf("Expected %d samples, got %v", len(expected), samples)
+	}
+	for i, want := range expected {
+		if samples[i].Value != want || !samples[i].Timestamp.Equal(base.Add(time.Duration(i)*time.Minute)) {
+			t.Errorf("Expected %v at minute %d, got %v", want, i, samples[i])
+		}
+	}
+
+	// A range starts from the last values recorded before it
+	job, _ = m.Start(Request{Script: "quality", TwinIDs: []string{"machine-1"}, History: true, From: base.Add(2 * time.Minute)})
+	job, _ = m.Wait(job.ID)
+
+	samples = hist.Query("machine-1", "oee", "quality", time.Time{}, time.Time{})
+	if job.Samples != 1 || len(samples) != 3 || samples[2].Value != 0.8 {
+		t.Errorf("Expected last sample to be recomputed from earlier values, got %+v %v", job, samples)
+	}
+
+	dt, _ := reg.Get("machine-1")
+	if counter, _ := dt.GetFeature("counter"); counter != nil {
+		if good, _ := counter.GetProperty("good"); good != 60.0 {
+			t.Errorf("Expected history backfill to leave the twin unchanged, got good %v", good)
+		}
+	}
+}
+
+func TestCancel(t *testing.T) {
+	m, reg, _, _ := setupManager(t)
+	for i := 10; i < 500; i++ {
+		dt := twin.NewDigitalTwin(fmt.Sprintf("machine-%d", i), "machine")
+		counter := twin.NewFeatureState()
+		counter.SetProperty("good", 1.0)
+		counter.SetProperty("total", 2.0)
+		dt.AddFeature("counter", counter)
+		reg.Create(dt)
+	}
+
+	job, _ := m.Start(Request{Script: "quality"})
+	if _, err := m.Cancel(job.ID); err != nil && err != ErrJobFinished {
+		t.Fatalf("Failed to cancel job: %v", err)
+	}
+
+	job, _ = m.Wait(job.ID)
+	if job.State != StateCancelled && job.State != StateCompleted {
+		t.Errorf("Expected job to be cancelled, got %s", job.State)
+	}
+	if job.State == StateCancelled && job.FinishedAt == nil {
+		t.Error("Expected cancelled job to have finished")
+	}
+}
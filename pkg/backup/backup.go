@@ -0,0 +1,344 @@
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/history"
+	"github.com/aleka07/go-digital-twin/pkg/objstore"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// ErrNoSnapshot is returned by Restore when the store holds no snapshot
+var ErrNoSnapshot = errors.New("no snapshot found")
+
+// Object key layout. Objects are grouped by kind and then by UTC date, so
+// bucket lifecycle rules can expire or archive snapshots and history
+// separately by prefix, and keys of the same kind sort chronologically:
+//
+//	<prefix>snapshots/2024/01/02/snapshot-20240102T150405Z.json.gz
+//	<prefix>history/2024/01/02/history-20240102T140405Z-20240102T150405Z.json.gz
+const (
+	SnapshotDir = "snapshots/"
+	HistoryDir  = "history/"
+)
+
+// keyTimeFormat formats times in object keys
+const keyTimeFormat = "20060102T150405Z"
+
+// Defaults for exporter options
+const (
+	DefaultInterval     = time.Hour
+	DefaultHistoryDelay = time.Minute
+)
+
+// Options configure an Exporter
+type Options struct {
+	Prefix       string        // Key prefix, e.g. "production/"
+	Interval     time.Duration // Time between scheduled exports
+	HistoryDelay time.Duration // How long to wait for late telemetry before exporting history
+}
+
+// Snapshot is the exported state of the registry
+type Snapshot struct {
+	Version   uint64              `json:"version"`
+	CreatedAt time.Time           `json:"createdAt"`
+	Twins     []*twin.DigitalTwin `json:"twins"`
+}
+
+// Segment is the exported property history of a time range
+type Segment struct {
+	From    time.Time       `json:"from"` // Inclusive, zero for the first segment
+	To      time.Time       `json:"to"`   // Exclusive
+	Samples []history.Entry `json:"samples"`
+}
+
+// RestoreResult reports what Restore loaded
+type RestoreResult struct {
+	Snapshot string `json:"snapshot"`
+	Twins    int    `json:"twins"`
+	Skipped  int    `json:"skipped"` // Twins that already existed
+	Segments int    `json:"segments"`
+	Samples  int    `json:"samples"`
+}
+
+// Exporter exports registry snapshots and history segments to object storage
+// and restores them
+type Exporter struct {
+	registry    *registry.Registry
+	history     *history.Store
+	store       objstore.Store
+	options     Options
+	lastHistory time.Time // End of the last exported history segment
+	mutex       sync.Mutex
+	now         func() time.Time
+}
+
+// NewExporter creates an exporter. The history store may be nil to export
+// snapshots only.
+func NewExporter(reg *registry.Registry, hist *history.Store, store objstore.Store, options Options) *Exporter {
+	if options.Interval <= 0 {
+		options.Interval = DefaultInterval
+	}
+	if options.HistoryDelay <= 0 {
+		options.HistoryDelay = DefaultHistoryDelay
+	}
+
+	return &Exporter{
+		registry: reg,
+		history:  hist,
+		store:    store,
+		options:  options,
+		now:      time.Now,
+	}
+}
+
+// SnapshotKey returns the object key of a snapshot created at t
+func (e *Exporter) SnapshotKey(t time.Time) string {
+	t = t.UTC()
+	return e.options.Prefix + SnapshotDir + t.Format("2006/01/02/") + "snapshot-" + t.Format(keyTimeFormat) + ".json.gz"
+}
+
+// HistoryKey returns the object key of a history segment ending at to
+func (e *Exporter) HistoryKey(from, to time.Time) string {
+	to = to.UTC()
+	start := "0"
+	if !from.IsZero() {
+		start = from.UTC().Format(keyTimeFormat)
+	}
+	return e.options.Prefix + HistoryDir + to.Format("2006/01/02/") + "history-" + start + "-" + to.Format(keyTimeFormat) + ".json.gz"
+}
+
+// ExportSnapshot writes a consistent snapshot of the registry and returns its key
+func (e *Exporter) ExportSnapshot(ctx context.Context) (string, error) {
+	var twins []*twin.DigitalTwin
+	var version uint64
+
+	// Retry when a twin is deleted between listing and cloning
+	for attempt := 0; ; attempt++ {
+		var ids []string
+		for _, dt := range e.registry.List() {
+			ids = append(ids, dt.ID)
+		}
+
+		var err error
+		twins, version, err = e.registry.Snapshot(ids)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, registry.ErrTwinNotFound) || attempt == 2 {
+			return "", fmt.Errorf("snapshot registry: %w", err)
+		}
+	}
+
+	sort.Slice(twins, func(i, j int) bool { return twins[i].ID < twins[j].ID })
+
+	now := e.now()
+	snapshot := Snapshot{Version: version, CreatedAt: now.UTC(), Twins: twins}
+	if snapshot.Twins == nil {
+		snapshot.Twins = []*twin.DigitalTwin{}
+	}
+
+	key := e.SnapshotKey(now)
+	if err := e.put(ctx, key, snapshot); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// ExportHistory writes the history recorded since the last segment, up to the
+// history delay before now, and returns its key. No object is written when
+// there are no new samples.
+func (e *Exporter) ExportHistory(ctx context.Context) (string, error) {
+	if e.history == nil {
+		return "", nil
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	to := e.now().Add(-e.options.HistoryDelay).UTC().Truncate(time.Second)
+	if !to.After(e.lastHistory) {
+		return "", nil
+	}
+
+	segment := Segment{From: e.lastHistory, To: to, Samples: e.history.Range(e.lastHistory, to)}
+	if len(segment.Samples) == 0 {
+		e.lastHistory = to
+		return "", nil
+	}
+
+	key := e.HistoryKey(segment.From, segment.To)
+	if err := e.put(ctx, key, segment); err != nil {
+		return "", err
+	}
+
+	e.lastHistory = to
+	return key, nil
+}
+
+// Export writes a snapshot and a history segment
+func (e *Exporter) Export(ctx context.Context) error {
+	if _, err := e.ExportSnapshot(ctx); err != nil {
+		return err
+	}
+	_, err := e.ExportHistory(ctx)
+	return err
+}
+
+// Run exports at the configured interval until the context is cancelled
+func (e *Exporter) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.options.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := e.Export(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("Backup export failed: %v", err)
+			}
+		}
+	}
+}
+
+// Restore loads the latest snapshot into the registry and all history
+// segments into the history store. Twins that already exist are kept.
+// Restored twins keep their exported revision. Later history exports continue
+// after the last restored segment.
+func (e *Exporter) Restore(ctx context.Context) (RestoreResult, error) {
+	var result RestoreResult
+
+	keys, err := e.store.List(ctx, e.options.Prefix+SnapshotDir)
+	if err != nil {
+		return result, fmt.Errorf("list snapshots: %w", err)
+	}
+	keys = filterSuffix(keys, ".json.gz")
+	if len(keys) == 0 {
+		return result, ErrNoSnapshot
+	}
+
+	// Keys sort chronologically, so the latest snapshot is last
+	result.Snapshot = keys[len(keys)-1]
+
+	var snapshot Snapshot
+	if err := e.get(ctx, result.Snapshot, &snapshot); err != nil {
+		return result, err
+	}
+
+	for _, dt := range snapshot.Twins {
+		if dt == nil || dt.ID == "" {
+			continue
+		}
+		if dt.Attributes == nil {
+			dt.Attributes = make(map[string]interface{})
+		}
+		if dt.Features == nil {
+			dt.Features = make(map[string]*twin.FeatureState)
+		}
+
+		// Keep the exported revision so clients can keep using it for conflict detection
+		revision := dt.GetRevision()
+		if err := e.registry.Create(dt); err == registry.ErrTwinAlreadyExists {
+			result.Skipped++
+			continue
+		} else if err != nil {
+			return result, fmt.Errorf("restore twin %s: %w", dt.ID, err)
+		}
+		if revision > 0 {
+			dt.SetRevision(revision)
+		}
+		result.Twins++
+	}
+
+	if e.history == nil {
+		return result, nil
+	}
+
+	keys, err = e.store.List(ctx, e.options.Prefix+HistoryDir)
+	if err != nil {
+		return result, fmt.Errorf("list history: %w", err)
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	for _, key := range filterSuffix(keys, ".json.gz") {
+		var segment Segment
+		if err := e.get(ctx, key, &segment); err != nil {
+			return result, err
+		}
+
+		for _, entry := range segment.Samples {
+			e.history.Record(entry.TwinID, entry.FeatureID, entry.Key, entry.Value, entry.Timestamp)
+		}
+		if segment.To.After(e.lastHistory) {
+			e.lastHistory = segment.To
+		}
+
+		result.Segments++
+		result.Samples += len(segment.Samples)
+	}
+
+	return result, nil
+}
+
+// put writes a gzip-compressed JSON object
+func (e *Exporter) put(ctx context.Context, key string, v interface{}) error {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(zw).Encode(v); err != nil {
+		return fmt.Errorf("encode %s: %w", key, err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("compress %s: %w", key, err)
+	}
+
+	if err := e.store.Put(ctx, key, buf.Bytes()); err != nil {
+		return fmt.Errorf("upload %s: %w", key, err)
+	}
+	return nil
+}
+
+// get reads a gzip-compressed JSON object
+func (e *Exporter) get(ctx context.Context, key string, v interface{}) error {
+	data, err := e.store.Get(ctx, key)
+	if err != nil {
+		return fmt.Errorf("download %s: %w", key, err)
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("decompress %s: %w", key, err)
+	}
+	defer zr.Close()
+
+	if err := json.NewDecoder(zr).Decode(v); err != nil {
+		return fmt.Errorf("decode %s: %w", key, err)
+	}
+	return nil
+}
+
+// filterSuffix returns the keys whose file name ends with suffix
+func filterSuffix(keys []string, suffix string) []string {
+	var result []string
+	for _, key := range keys {
+		if strings.HasSuffix(path.Base(key), suffix) {
+			result = append(result, key)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,137 @@
+package backup
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/history"
+	"github.com/aleka07/go-digital-twin/pkg/objstore"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func setupExporter(store objstore.Store) (*Exporter, *registry.Registry, *history.Store, *time.Time) {
+	reg := registry.NewRegistry()
+	hist := history.NewStore(history.DefaultCapacity)
+	e := NewExporter(reg, hist, store, Options{Prefix: "dt/"})
+
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	e.now = func() time.Time { return now }
+	return e, reg, hist, &now
+}
+
+func TestKeys(t *testing.T) {
+	e := NewExporter(registry.NewRegistry(), nil, objstore.NewMemoryStore(), Options{Prefix: "prod/"})
+	at := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	if key := e.SnapshotKey(at); key != "prod/snapshots/2024/01/02/snapshot-20240102T150405Z.json.gz" {
+		t.Errorf("Unexpected snapshot key %s", key)
+	}
+	if key := e.HistoryKey(at.Add(-time.Hour), at); key != "prod/history/2024/01/02/history-20240102T140405Z-20240102T150405Z.json.gz" {
+		t.Errorf("Unexpected history key %s", key)
+	}
+	if key := e.HistoryKey(time.Time{}, at); !strings.Contains(key, "history-0-20240102T150405Z") {
+		t.Errorf("Unexpected first history key %s", key)
+	}
+}
+
+func TestExportAndRestore(t *testing.T) {
+	ctx := context.Background()
+	store := objstore.NewMemoryStore()
+	e, reg, hist, now := setupExporter(store)
+
+	dt := twin.NewDigitalTwin("pump-1", "pump")
+	dt.SetAttribute("location", "hall-1")
+	feature := twin.NewFeatureState()
+	feature.SetProperty("pressure", 2.5)
+	dt.AddFeature("sensor", feature)
+	reg.Create(dt)
+	reg.Update(dt)
+	reg.Create(twin.NewDigitalTwin("pump-2", "pump"))
+
+	hist.Record("pump-1", "sensor", "pressure", 2.0, now.Add(-time.Hour))
+	hist.Record("pump-1", "sensor", "pressure", 2.5, now.Add(-30*time.Second)) // Within the history delay
+
+	key, err := e.ExportSnapshot(ctx)
+	if err != nil {
+		t.Fatalf("Failed to export snapshot: %v", err)
+	}
+	if key != e.SnapshotKey(*now) {
+		t.Errorf("Unexpected snapshot key %s", key)
+	}
+
+	key, err = e.ExportHistory(ctx)
+	if err != nil || key == "" {
+		t.Fatalf("Failed to export history: %q, %v", key, err)
+	}
+
+	// Nothing new to export
+	if key, _ := e.ExportHistory(ctx); key != "" {
+		t.Errorf("Expected no segment without new samples, got %s", key)
+	}
+
+	// The delayed sample goes into the next segment
+	*now = now.Add(time.Hour)
+	key, err = e.ExportHistory(ctx)
+	if err != nil || key == "" {
+		t.Fatalf("Failed to export second segment: %q, %v", key, err)
+	}
+	if err := e.Export(ctx); err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+
+	keys, _ := store.List(ctx, "dt/")
+	if len(keys) != 4 {
+		t.Errorf("Expected 2 snapshots and 2 history segments, got %v", keys)
+	}
+
+	// Restore into an empty server
+	restored, rreg, rhist, _ := setupExporter(store)
+	rreg.Create(twin.NewDigitalTwin("pump-2", "pump"))
+
+	result, err := restored.Restore(ctx)
+	if err != nil {
+		t.Fatalf("Failed to restore: %v", err)
+	}
+	if result.Snapshot != keys[len(keys)-1] || result.Twins != 1 || result.Skipped != 1 || result.Segments != 2 || result.Samples != 2 {
+		t.Errorf("Unexpected restore result: %+v", result)
+	}
+
+	pump, err := rreg.Get("pump-1")
+	if err != nil {
+		t.Fatalf("Expected pump-1 to be restored: %v", err)
+	}
+	if loc, _ := pump.GetAttribute("location"); loc != "hall-1" {
+		t.Errorf("Expected location hall-1, got %v", loc)
+	}
+	if pump.GetRevision() != 2 {
+		t.Errorf("Expected revision 2 to be kept, got %d", pump.GetRevision())
+	}
+	sensor, exists := pump.GetFeature("sensor")
+	if !exists {
+		t.Fatal("Expected sensor feature to be restored")
+	}
+	if val, _ := sensor.GetProperty("pressure"); val != 2.5 {
+		t.Errorf("Expected pressure 2.5, got %v", val)
+	}
+
+	samples := rhist.Query("pump-1", "sensor", "pressure", time.Time{}, time.Time{})
+	if len(samples) != 2 {
+		t.Errorf("Expected 2 restored samples, got %v", samples)
+	}
+
+	// Exports continue after the restored segments
+	if key, _ := restored.ExportHistory(ctx); key != "" {
+		t.Errorf("Expected restored samples not to be exported again, got %s", key)
+	}
+}
+
+func TestRestoreWithoutSnapshot(t *testing.T) {
+	e, _, _, _ := setupExporter(objstore.NewMemoryStore())
+
+	if _, err := e.Restore(context.Background()); err != ErrNoSnapshot {
+		t.Errorf("Expected ErrNoSnapshot, got %v", err)
+	}
+}
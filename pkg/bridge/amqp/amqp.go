@@ -0,0 +1,292 @@
+// Package amqp bridges twin events and telemetry to AMQP 1.0 brokers such as
+// Azure Service Bus or ActiveMQ. The bridge works on sender and receiver links
+// provided by an AMQP 1.0 client library, so any client can be adapted to the
+// Sender, Receiver and Delivery interfaces.
+package amqp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/aleka07/go-digital-twin/pkg/ingest"
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+)
+
+// Common errors
+var (
+	ErrInvalidMessage = errors.New("invalid telemetry message")
+)
+
+// Defaults for options left empty
+const (
+	DefaultQueueSize = 1024 // Events waiting for link credit
+	DefaultCredit    = 100  // Telemetry messages in flight
+)
+
+// DefaultTopics are the event topic patterns published when the options do not set their own
+var DefaultTopics = []string{"twin.#", "property.updated", "properties.updated", "rule.triggered", "alarm.#"}
+
+// Message is an AMQP 1.0 message as seen by the bridge
+type Message struct {
+	Subject     string
+	ContentType string
+	Properties  map[string]interface{} // Application properties
+	Body        []byte                 // Single data section
+}
+
+// Sender sends messages over a sender link. Send blocks while the link has
+// no credit and returns once the broker settled the message.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Delivery is a received message awaiting settlement
+type Delivery interface {
+	Message() Message
+	Accept(ctx context.Context) error
+	Reject(ctx context.Context, reason string) error // The broker does not redeliver the message
+	Release(ctx context.Context) error               // The broker redelivers the message
+}
+
+// Receiver receives messages over a receiver link whose credit is managed by
+// the bridge
+type Receiver interface {
+	IssueCredit(n uint32) error
+	Receive(ctx context.Context) (Delivery, error)
+}
+
+// Options configure a bridge
+type Options struct {
+	Topics    []string // Event topic patterns published, DefaultTopics when empty
+	QueueSize int      // Events queued while the sender has no credit, DefaultQueueSize when zero
+	Credit    uint32   // Telemetry messages in flight, DefaultCredit when zero
+}
+
+// Stats count the messages handled by a bridge
+type Stats struct {
+	Published int    `json:"published"` // Events settled by the broker
+	Failed    int    `json:"failed"`    // Events the broker refused or that could not be sent
+	Dropped   int    `json:"dropped"`   // Events dropped because the queue was full
+	Received  int    `json:"received"`  // Telemetry messages received
+	Accepted  int    `json:"accepted"`  // Telemetry applied to twins
+	Rejected  int    `json:"rejected"`  // Telemetry that can never be applied
+	Released  int    `json:"released"`  // Telemetry returned to the broker for redelivery
+	LastError string `json:"lastError,omitempty"`
+}
+
+// Bridge publishes events to a sender link and applies telemetry received on
+// a receiver link. Backpressure is handled on both sides: events wait in a
+// bounded queue while the sender has no credit, and the receiver is only
+// granted credit for as many messages as the bridge is willing to have in
+// flight.
+type Bridge struct {
+	ingester *ingest.Ingester
+	sender   Sender
+	receiver Receiver
+	opts     Options
+	queue    chan Message
+	stats    Stats
+	mutex    sync.Mutex
+}
+
+// NewBridge creates a bridge. Either link may be nil to only publish events
+// or only consume telemetry.
+func NewBridge(ingester *ingest.Ingester, sender Sender, receiver Receiver, opts Options) *Bridge {
+	if len(opts.Topics) == 0 {
+		opts.Topics = DefaultTopics
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = DefaultQueueSize
+	}
+	if opts.Credit == 0 {
+		opts.Credit = DefaultCredit
+	}
+
+	return &Bridge{
+		ingester: ingester,
+		sender:   sender,
+		receiver: receiver,
+		opts:     opts,
+		queue:    make(chan Message, opts.QueueSize),
+	}
+}
+
+// HandleEvent queues an event for publishing when its topic matches one of
+// the topic patterns. Events are dropped while the queue is full.
+func (b *Bridge) HandleEvent(msg messaging_sim.Message) {
+	if b.sender == nil || !b.matches(msg.Topic) {
+		return
+	}
+
+	body, err := json.Marshal(msg.Payload)
+	if err != nil {
+		b.fail(&b.stats.Failed, err)
+		return
+	}
+
+	properties := map[string]interface{}{"topic": msg.Topic}
+	if id := msg.TwinID(); id != "" {
+		properties["twinId"] = id
+	}
+
+	select {
+	case b.queue <- Message{Subject: msg.Topic, ContentType: "application/json", Properties: properties, Body: body}:
+	default:
+		b.mutex.Lock()
+		b.stats.Dropped++
+		b.mutex.Unlock()
+	}
+}
+
+// matches reports whether a topic is published
+func (b *Bridge) matches(topic string) bool {
+	for _, pattern := range b.opts.Topics {
+		if messaging_sim.TopicMatches(pattern, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// Run queues events from a subscription until the channel is closed
+func (b *Bridge) Run(events <-chan messaging_sim.Message) {
+	for msg := range events {
+		b.HandleEvent(msg)
+	}
+}
+
+// Publish sends queued events to the sender link until the context is cancelled
+func (b *Bridge) Publish(ctx context.Context) {
+	if b.sender == nil {
+		return
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-b.queue:
+			if err := b.sender.Send(ctx, msg); err != nil {
+				b.fail(&b.stats.Failed, err)
+				continue
+			}
+			b.mutex.Lock()
+			b.stats.Published++
+			b.mutex.Unlock()
+		}
+	}
+}
+
+// Consume applies telemetry received on the receiver link until the context
+// is cancelled or the link fails. Message bodies are ingest.Telemetry
+// documents; the twinId application property or the subject names the twin
+// when the body does not. Messages are accepted once applied, rejected when
+// they can never be applied and released for redelivery otherwise. Credit is
+// replenished when half of it has been used.
+func (b *Bridge) Consume(ctx context.Context) error {
+	if b.receiver == nil {
+		return nil
+	}
+
+	if err := b.receiver.IssueCredit(b.opts.Credit); err != nil {
+		return err
+	}
+	outstanding := b.opts.Credit
+
+	for {
+		d, err := b.receiver.Receive(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		outstanding--
+
+		b.mutex.Lock()
+		b.stats.Received++
+		b.mutex.Unlock()
+
+		b.settle(ctx, d)
+
+		if outstanding <= b.opts.Credit/2 {
+			if err := b.receiver.IssueCredit(b.opts.Credit - outstanding); err != nil {
+				return err
+			}
+			outstanding = b.opts.Credit
+		}
+	}
+}
+
+// settle applies a received message and settles it with the broker
+func (b *Bridge) settle(ctx context.Context, d Delivery) {
+	err := b.apply(d.Message())
+
+	switch {
+	case err == nil:
+		if err := d.Accept(ctx); err != nil {
+			b.fail(nil, err)
+			return
+		}
+		b.mutex.Lock()
+		b.stats.Accepted++
+		b.mutex.Unlock()
+	case permanent(err):
+		b.fail(&b.stats.Rejected, err)
+		d.Reject(ctx, err.Error())
+	default:
+		b.fail(&b.stats.Released, err)
+		d.Release(ctx)
+	}
+}
+
+// apply converts a message to telemetry and applies it
+func (b *Bridge) apply(msg Message) error {
+	var t ingest.Telemetry
+	if err := json.Unmarshal(msg.Body, &t); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+	}
+	if t.TwinID == "" {
+		t.TwinID, _ = msg.Properties["twinId"].(string)
+	}
+	if t.TwinID == "" {
+		t.TwinID = msg.Subject
+	}
+	if t.TwinID == "" {
+		return fmt.Errorf("%w: no twin ID", ErrInvalidMessage)
+	}
+
+	_, err := b.ingester.Apply(t)
+	return err
+}
+
+// permanent reports whether applying a message fails the same way every time
+func permanent(err error) bool {
+	return errors.Is(err, ErrInvalidMessage) ||
+		errors.Is(err, ingest.ErrEmptyTelemetry) ||
+		errors.Is(err, ingest.ErrTransformFailed) ||
+		errors.Is(err, registry.ErrTwinNotFound)
+}
+
+// fail records an error and increments a counter, if any
+func (b *Bridge) fail(counter *int, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if counter != nil {
+		*counter++
+	}
+	b.stats.LastError = err.Error()
+}
+
+// Stats returns the message counters of the bridge
+func (b *Bridge) Stats() Stats {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.stats
+}
@@ -0,0 +1,137 @@
+package amqp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/history"
+	"github.com/aleka07/go-digital-twin/pkg/ingest"
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// sender is a test sender link
+type sender struct {
+	sent chan Message
+	err  error
+}
+
+func (s *sender) Send(ctx context.Context, msg Message) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.sent <- msg
+	return nil
+}
+
+// delivery is a test delivery recording how it was settled
+type delivery struct {
+	msg     Message
+	settled string
+}
+
+func (d *delivery) Message() Message                           { return d.msg }
+func (d *delivery) Accept(ctx context.Context) error           { d.settled = "accepted"; return nil }
+func (d *delivery) Reject(ctx context.Context, _ string) error { d.settled = "rejected"; return nil }
+func (d *delivery) Release(ctx context.Context) error          { d.settled = "released"; return nil }
+
+// receiver is a test receiver link that only delivers messages it has credit for
+type receiver struct {
+	deliveries []*delivery
+	credit     uint32
+	issued     []uint32
+}
+
+func (r *receiver) IssueCredit(n uint32) error {
+	r.credit += n
+	r.issued = append(r.issued, n)
+	return nil
+}
+
+func (r *receiver) Receive(ctx context.Context) (Delivery, error) {
+	if len(r.deliveries) == 0 {
+		return nil, errors.New("link detached")
+	}
+	if r.credit == 0 {
+		return nil, errors.New("no credit")
+	}
+	r.credit--
+	d := r.deliveries[0]
+	r.deliveries = r.deliveries[1:]
+	return d, nil
+}
+
+func setupIngester() *ingest.Ingester {
+	reg := registry.NewRegistry()
+	reg.Create(twin.NewDigitalTwin("pump-1", "pump"))
+	return ingest.NewIngester(reg, messaging_sim.NewPubSub(), history.NewStore(10))
+}
+
+func TestPublish(t *testing.T) {
+	s := &sender{sent: make(chan Message, 10)}
+	b := NewBridge(nil, s, nil, Options{Topics: []string{"property.updated"}, QueueSize: 1})
+
+	b.HandleEvent(messaging_sim.Message{Topic: "property.updated", Payload: map[string]interface{}{"twinId": "pump-1", "value": 2.5}})
+	b.HandleEvent(messaging_sim.Message{Topic: "property.updated", Payload: map[string]interface{}{"twinId": "pump-1", "value": 3.0}})
+	b.HandleEvent(messaging_sim.Message{Topic: "twin.created", Payload: map[string]string{"id": "pump-2"}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.Publish(ctx)
+
+	select {
+	case msg := <-s.sent:
+		var payload map[string]interface{}
+		json.Unmarshal(msg.Body, &payload)
+		if msg.Subject != "property.updated" || msg.Properties["twinId"] != "pump-1" || payload["value"] != 2.5 {
+			t.Errorf("Unexpected message %+v", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the event to be sent")
+	}
+
+	// The second event did not fit into the queue
+	if stats := b.Stats(); stats.Dropped != 1 {
+		t.Errorf("Expected 1 dropped event, got %+v", stats)
+	}
+}
+
+func TestConsume(t *testing.T) {
+	r := &receiver{}
+	bodies := []string{
+		`{"features": {"status": {"pressure": 2.5}}}`,
+		`{"twinId": "pump-9", "features": {"status": {"pressure": 1.0}}}`,
+		`not json`,
+		`{"twinId": "pump-1", "features": {"status": {"pressure": 2.6}}}`,
+		`{"twinId": "pump-1", "features": {"status": {"pressure": 2.7}}}`,
+	}
+	for _, body := range bodies {
+		r.deliveries = append(r.deliveries, &delivery{msg: Message{Properties: map[string]interface{}{"twinId": "pump-1"}, Body: []byte(body)}})
+	}
+	all := append([]*delivery(nil), r.deliveries...)
+
+	b := NewBridge(setupIngester(), nil, r, Options{Credit: 4})
+	if err := b.Consume(context.Background()); err == nil || err.Error() != "link detached" {
+		t.Errorf("Expected the link error, got %v", err)
+	}
+
+	for i, want := range []string{"accepted", "rejected", "rejected", "accepted", "accepted"} {
+		if all[i].settled != want {
+			t.Errorf("Expected message %d to be %s, got %q", i, want, all[i].settled)
+		}
+	}
+
+	// Credit is replenished after half of it was used
+	if len(r.issued) != 3 || r.issued[0] != 4 || r.issued[1] != 2 {
+		t.Errorf("Unexpected credit %v", r.issued)
+	}
+
+	stats := b.Stats()
+	if stats.Received != 5 || stats.Accepted != 3 || stats.Rejected != 2 || stats.LastError == "" {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
@@ -0,0 +1,508 @@
+// Package bacnet bridges BACnet/IP building automation devices to twins. It
+// discovers devices and their objects and maps the present values of bound
+// objects to twin feature properties, through change-of-value (COV)
+// subscriptions where devices support them and polling otherwise. The bridge
+// works on a client provided by a BACnet stack, so any stack can be adapted
+// to the Client interface.
+package bacnet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/ingest"
+)
+
+// Common errors
+var (
+	ErrInvalidBinding       = errors.New("invalid BACnet binding")
+	ErrBindingAlreadyExists = errors.New("BACnet binding already exists")
+	ErrBindingNotFound      = errors.New("BACnet binding not found")
+	ErrCOVNotSupported      = errors.New("COV subscriptions not supported") // Returned by clients for devices or objects without COV
+)
+
+// Defaults for options left empty
+const (
+	DefaultPollInterval = time.Minute
+	DefaultCOVLifetime  = 10 * time.Minute
+	DefaultProperty     = "presentValue"
+)
+
+// ObjectType is a BACnet object type, named as in the standard, such as analog-input
+type ObjectType string
+
+// Object types with a present value
+const (
+	AnalogInput      ObjectType = "analog-input"
+	AnalogOutput     ObjectType = "analog-output"
+	AnalogValue      ObjectType = "analog-value"
+	BinaryInput      ObjectType = "binary-input"
+	BinaryOutput     ObjectType = "binary-output"
+	BinaryValue      ObjectType = "binary-value"
+	MultiStateInput  ObjectType = "multi-state-input"
+	MultiStateOutput ObjectType = "multi-state-output"
+	MultiStateValue  ObjectType = "multi-state-value"
+)
+
+// presentValueTypes are the object types bound by DefaultBindings
+var presentValueTypes = []ObjectType{
+	AnalogInput, AnalogOutput, AnalogValue,
+	BinaryInput, BinaryOutput, BinaryValue,
+	MultiStateInput, MultiStateOutput, MultiStateValue,
+}
+
+// ObjectID identifies an object of a device
+type ObjectID struct {
+	Type     ObjectType `json:"type"`
+	Instance uint32     `json:"instance"`
+}
+
+// String returns the object ID as type:instance, such as analog-input:1
+func (id ObjectID) String() string {
+	return string(id.Type) + ":" + strconv.FormatUint(uint64(id.Instance), 10)
+}
+
+// Device is a device that answered a Who-Is
+type Device struct {
+	Instance uint32
+	Address  string // BACnet/IP address, such as 192.168.1.20:47808
+	VendorID uint16
+}
+
+// Object describes an object of a device
+type Object struct {
+	ID          ObjectID
+	Name        string
+	Description string
+	Units       string
+}
+
+// Notification is a COV notification for an object
+type Notification struct {
+	Device uint32
+	Object ObjectID
+	Value  interface{} // Present value
+}
+
+// Client is a BACnet/IP client
+type Client interface {
+	// WhoIs broadcasts a Who-Is for a range of device instances and returns
+	// the devices that answered with an I-Am before the context is done
+	WhoIs(ctx context.Context, low, high uint32) ([]Device, error)
+
+	// Objects reads the object list of a device with the name, description
+	// and units of each object
+	Objects(ctx context.Context, device Device) ([]Object, error)
+
+	// ReadPresentValues reads the present values of objects of a device,
+	// with ReadPropertyMultiple where supported. Objects whose value cannot
+	// be read are left out.
+	ReadPresentValues(ctx context.Context, device Device, objects []ObjectID) (map[ObjectID]interface{}, error)
+
+	// SubscribeCOV subscribes to changes of an object's present value for a
+	// lifetime. Notifications are passed to Bridge.HandleCOV. It returns
+	// ErrCOVNotSupported when the device refuses the subscription.
+	SubscribeCOV(ctx context.Context, device Device, object ObjectID, lifetime time.Duration) error
+}
+
+// Binding maps the present value of an object to a twin property
+type Binding struct {
+	Device   uint32   `json:"device"`
+	Object   ObjectID `json:"object"`
+	TwinID   string   `json:"twinId"`
+	Feature  string   `json:"feature"`
+	Property string   `json:"property"` // DefaultProperty when empty
+}
+
+// key returns the key identifying the object of a binding
+func (b Binding) key() string {
+	return strconv.FormatUint(uint64(b.Device), 10) + "/" + b.Object.String()
+}
+
+// BindingStatus reports how a binding receives values
+type BindingStatus struct {
+	Binding
+	COV        bool        `json:"cov"`                  // Values arrive by COV notifications
+	COVExpires time.Time   `json:"covExpires,omitempty"` // End of the current subscription
+	LastValue  interface{} `json:"lastValue,omitempty"`
+	LastUpdate time.Time   `json:"lastUpdate,omitempty"`
+}
+
+// Options configure a bridge
+type Options struct {
+	PollInterval time.Duration // Polling and renewal interval, DefaultPollInterval when zero
+	COVLifetime  time.Duration // Lifetime of COV subscriptions, DefaultCOVLifetime when zero
+	DisableCOV   bool          // Poll all objects
+}
+
+// Stats count the values handled by a bridge
+type Stats struct {
+	Polls         int    `json:"polls"`
+	Notifications int    `json:"notifications"`
+	Applied       int    `json:"applied"` // Values applied to twins
+	Failed        int    `json:"failed"`  // Failed reads, subscriptions and applications
+	LastError     string `json:"lastError,omitempty"`
+}
+
+// Bridge applies the present values of bound objects to twins
+type Bridge struct {
+	ingester *ingest.Ingester
+	client   Client
+	opts     Options
+	devices  map[uint32]Device
+	bindings map[string]*BindingStatus
+	covOff   map[uint32]bool // Devices that refused COV subscriptions
+	stats    Stats
+	mutex    sync.Mutex
+}
+
+// NewBridge creates a bridge
+func NewBridge(ingester *ingest.Ingester, client Client, opts Options) *Bridge {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultPollInterval
+	}
+	if opts.COVLifetime <= 0 {
+		opts.COVLifetime = DefaultCOVLifetime
+	}
+	if opts.COVLifetime < 2*opts.PollInterval {
+		// Subscriptions are renewed on the polling schedule and must outlive a round
+		opts.COVLifetime = 2 * opts.PollInterval
+	}
+
+	return &Bridge{
+		ingester: ingester,
+		client:   client,
+		opts:     opts,
+		devices:  make(map[uint32]Device),
+		bindings: make(map[string]*BindingStatus),
+		covOff:   make(map[uint32]bool),
+	}
+}
+
+// Discover finds the devices in a range of instances and reads their
+// objects. Discovered devices are remembered for reading bound objects.
+func (b *Bridge) Discover(ctx context.Context, low, high uint32) (map[Device][]Object, error) {
+	devices, err := b.client.WhoIs(ctx, low, high)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[Device][]Object, len(devices))
+	for _, d := range devices {
+		objects, err := b.client.Objects(ctx, d)
+		if err != nil {
+			return nil, fmt.Errorf("reading objects of device %d: %w", d.Instance, err)
+		}
+		result[d] = objects
+
+		b.mutex.Lock()
+		b.devices[d.Instance] = d
+		b.mutex.Unlock()
+	}
+	return result, nil
+}
+
+// DefaultBindings binds the analog, binary and multi-state objects of a
+// device to a twin, with a feature per object named after its type and
+// instance, such as analog-input-1
+func DefaultBindings(device Device, objects []Object, twinID string) []Binding {
+	var bindings []Binding
+	for _, o := range objects {
+		if !isPresentValueType(o.ID.Type) {
+			continue
+		}
+		bindings = append(bindings, Binding{
+			Device:   device.Instance,
+			Object:   o.ID,
+			TwinID:   twinID,
+			Feature:  string(o.ID.Type) + "-" + strconv.FormatUint(uint64(o.ID.Instance), 10),
+			Property: DefaultProperty,
+		})
+	}
+	return bindings
+}
+
+// isPresentValueType reports whether objects of a type are bound by default
+func isPresentValueType(t ObjectType) bool {
+	for _, pt := range presentValueTypes {
+		if pt == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Bind adds a binding, subscribed or polled from the next round
+func (b *Bridge) Bind(binding Binding) error {
+	if binding.TwinID == "" || binding.Feature == "" || binding.Object.Type == "" {
+		return fmt.Errorf("%w: object, twin and feature are required", ErrInvalidBinding)
+	}
+	if binding.Property == "" {
+		binding.Property = DefaultProperty
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if _, exists := b.bindings[binding.key()]; exists {
+		return ErrBindingAlreadyExists
+	}
+	b.bindings[binding.key()] = &BindingStatus{Binding: binding}
+	return nil
+}
+
+// Unbind removes the binding of an object. Its COV subscription expires on its own.
+func (b *Bridge) Unbind(device uint32, object ObjectID) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	key := Binding{Device: device, Object: object}.key()
+	if _, exists := b.bindings[key]; !exists {
+		return ErrBindingNotFound
+	}
+	delete(b.bindings, key)
+	return nil
+}
+
+// Bindings returns the status of the bindings ordered by device and object
+func (b *Bridge) Bindings() []BindingStatus {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	result := make([]BindingStatus, 0, len(b.bindings))
+	for _, s := range b.bindings {
+		result = append(result, *s)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Device != result[j].Device {
+			return result[i].Device < result[j].Device
+		}
+		return result[i].Object.String() < result[j].Object.String()
+	})
+	return result
+}
+
+// Stats returns the counters of the bridge
+func (b *Bridge) Stats() Stats {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.stats
+}
+
+// Run subscribes to and polls the bound objects every poll interval until
+// the context is cancelled
+func (b *Bridge) Run(ctx context.Context) {
+	ticker := time.NewTicker(b.opts.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		b.Refresh(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh runs a round: it subscribes to objects without a COV
+// subscription that lasts until the next round, unless their device refused
+// subscriptions before, and polls the other objects. Objects refusing a
+// subscription are polled.
+func (b *Bridge) Refresh(ctx context.Context) {
+	now := time.Now()
+	renewBefore := now.Add(b.opts.PollInterval * 3 / 2)
+
+	b.mutex.Lock()
+	var subscribe []Binding
+	polled := make(map[uint32][]Binding)
+	for _, s := range b.bindings {
+		switch {
+		case b.opts.DisableCOV || b.covOff[s.Device]:
+			polled[s.Device] = append(polled[s.Device], s.Binding)
+		case !s.COV || s.COVExpires.Before(renewBefore):
+			subscribe = append(subscribe, s.Binding)
+		}
+	}
+	b.mutex.Unlock()
+
+	for _, binding := range subscribe {
+		device := b.device(binding.Device)
+		err := b.client.SubscribeCOV(ctx, device, binding.Object, b.opts.COVLifetime)
+
+		b.mutex.Lock()
+		s, exists := b.bindings[binding.key()]
+		switch {
+		case !exists:
+		case err == nil:
+			s.COV = true
+			s.COVExpires = now.Add(b.opts.COVLifetime)
+		default:
+			s.COV = false
+			s.COVExpires = time.Time{}
+			if errors.Is(err, ErrCOVNotSupported) {
+				b.covOff[binding.Device] = true
+			} else {
+				b.fail(err)
+			}
+			polled[binding.Device] = append(polled[binding.Device], binding)
+		}
+		b.mutex.Unlock()
+	}
+
+	for instance, bindings := range polled {
+		b.poll(ctx, b.device(instance), bindings, now)
+	}
+}
+
+// device returns a discovered device, or a device known only by its instance
+// for the client to resolve
+func (b *Bridge) device(instance uint32) Device {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if d, ok := b.devices[instance]; ok {
+		return d
+	}
+	return Device{Instance: instance}
+}
+
+// poll reads the present values of bound objects of a device and applies them
+func (b *Bridge) poll(ctx context.Context, device Device, bindings []Binding, now time.Time) {
+	objects := make([]ObjectID, 0, len(bindings))
+	for _, binding := range bindings {
+		objects = append(objects, binding.Object)
+	}
+
+	values, err := b.client.ReadPresentValues(ctx, device, objects)
+
+	b.mutex.Lock()
+	b.stats.Polls++
+	if err != nil {
+		b.fail(fmt.Errorf("reading device %d: %w", device.Instance, err))
+		b.mutex.Unlock()
+		return
+	}
+	b.mutex.Unlock()
+
+	var updates []update
+	for _, binding := range bindings {
+		if value, ok := values[binding.Object]; ok {
+			updates = append(updates, update{binding, value})
+		}
+	}
+	b.apply(updates, now)
+}
+
+// HandleCOV applies a COV notification to the bound twin property. Unbound
+// objects are ignored.
+func (b *Bridge) HandleCOV(n Notification) {
+	b.mutex.Lock()
+	b.stats.Notifications++
+	s, exists := b.bindings[Binding{Device: n.Device, Object: n.Object}.key()]
+	var binding Binding
+	if exists {
+		binding = s.Binding
+	}
+	b.mutex.Unlock()
+
+	if exists {
+		b.apply([]update{{binding, n.Value}}, time.Now())
+	}
+}
+
+// update is a present value of a bound object
+type update struct {
+	binding Binding
+	value   interface{}
+}
+
+// apply writes present values to their twins, one telemetry batch per twin
+func (b *Bridge) apply(updates []update, now time.Time) {
+	batches := make(map[string]*ingest.Telemetry)
+	for _, u := range updates {
+		t, ok := batches[u.binding.TwinID]
+		if !ok {
+			t = &ingest.Telemetry{TwinID: u.binding.TwinID, Timestamp: now, Features: make(map[string]map[string]interface{})}
+			batches[u.binding.TwinID] = t
+		}
+		if t.Features[u.binding.Feature] == nil {
+			t.Features[u.binding.Feature] = make(map[string]interface{})
+		}
+		t.Features[u.binding.Feature][u.binding.Property] = convert(u.binding.Object.Type, u.value)
+	}
+
+	for _, t := range batches {
+		result, err := b.ingester.Apply(*t)
+
+		b.mutex.Lock()
+		if err != nil {
+			b.fail(fmt.Errorf("applying to %s: %w", t.TwinID, err))
+		} else {
+			b.stats.Applied += result.Applied
+		}
+		b.mutex.Unlock()
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for _, u := range updates {
+		if s, exists := b.bindings[u.binding.key()]; exists {
+			s.LastValue = convert(u.binding.Object.Type, u.value)
+			s.LastUpdate = now
+		}
+	}
+}
+
+// fail records an error; the caller holds the mutex
+func (b *Bridge) fail(err error) {
+	b.stats.Failed++
+	b.stats.LastError = err.Error()
+}
+
+// convert turns a present value into a property value: booleans for binary
+// objects, whose values are active or inactive, and floats for numbers
+func convert(objectType ObjectType, value interface{}) interface{} {
+	var n float64
+	switch v := value.(type) {
+	case bool:
+		return v
+	case string:
+		if strings.HasPrefix(string(objectType), "binary-") {
+			return v == "active"
+		}
+		return v
+	case float32:
+		// Keep the decimal value a device reports as a REAL, e.g. 21.3 rather than 21.299999237060547
+		n, _ = strconv.ParseFloat(strconv.FormatFloat(float64(v), 'g', -1, 32), 64)
+	case float64:
+		n = v
+	case int:
+		n = float64(v)
+	case int32:
+		n = float64(v)
+	case int64:
+		n = float64(v)
+	case uint:
+		n = float64(v)
+	case uint32:
+		n = float64(v)
+	case uint64:
+		n = float64(v)
+	default:
+		return fmt.Sprint(v)
+	}
+
+	if strings.HasPrefix(string(objectType), "binary-") {
+		return n != 0
+	}
+	return n
+}
@@ -0,0 +1,226 @@
+package bacnet
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/history"
+	"github.com/aleka07/go-digital-twin/pkg/ingest"
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// network is a test BACnet network
+type network struct {
+	devices    []Device
+	objects    map[uint32][]Object
+	values     map[ObjectID]interface{}
+	cov        map[uint32]bool // Devices supporting COV
+	subscribed []ObjectID
+	reads      int
+	err        error
+	mutex      sync.Mutex
+}
+
+func (n *network) WhoIs(ctx context.Context, low, high uint32) ([]Device, error) {
+	var result []Device
+	for _, d := range n.devices {
+		if d.Instance >= low && d.Instance <= high {
+			result = append(result, d)
+		}
+	}
+	return result, nil
+}
+
+func (n *network) Objects(ctx context.Context, device Device) ([]Object, error) {
+	return n.objects[device.Instance], nil
+}
+
+func (n *network) ReadPresentValues(ctx context.Context, device Device, objects []ObjectID) (map[ObjectID]interface{}, error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	if n.err != nil {
+		return nil, n.err
+	}
+	n.reads++
+	result := make(map[ObjectID]interface{})
+	for _, id := range objects {
+		if v, ok := n.values[id]; ok {
+			result[id] = v
+		}
+	}
+	return result, nil
+}
+
+func (n *network) SubscribeCOV(ctx context.Context, device Device, object ObjectID, lifetime time.Duration) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	if !n.cov[device.Instance] {
+		return ErrCOVNotSupported
+	}
+	n.subscribed = append(n.subscribed, object)
+	return nil
+}
+
+var (
+	temperature = ObjectID{AnalogInput, 1}
+	fan         = ObjectID{BinaryOutput, 2}
+	mode        = ObjectID{MultiStateValue, 3}
+)
+
+func newNetwork() *network {
+	return &network{
+		devices: []Device{{Instance: 1001, Address: "192.168.1.20:47808"}, {Instance: 2001, Address: "192.168.1.30:47808"}},
+		objects: map[uint32][]Object{
+			1001: {
+				{ID: ObjectID{"device", 1001}, Name: "AHU-1"},
+				{ID: temperature, Name: "Supply Temp", Units: "degrees-celsius"},
+				{ID: fan, Name: "Fan"},
+				{ID: mode, Name: "Mode"},
+			},
+		},
+		values: map[ObjectID]interface{}{temperature: float32(21.3), fan: "active", mode: uint32(2)},
+		cov:    map[uint32]bool{},
+	}
+}
+
+func newBridge(n *network, opts Options) (*Bridge, *registry.Registry) {
+	reg := registry.NewRegistry()
+	reg.Create(twin.NewDigitalTwin("ahu-1", "ahu"))
+	in := ingest.NewIngester(reg, messaging_sim.NewPubSub(), history.NewStore(10))
+	return NewBridge(in, n, opts), reg
+}
+
+func TestDiscover(t *testing.T) {
+	n := newNetwork()
+	b, _ := newBridge(n, Options{})
+
+	found, err := b.Discover(context.Background(), 1000, 1999)
+	if err != nil || len(found) != 1 {
+		t.Fatalf("Expected one device, got %v (%v)", found, err)
+	}
+	device := n.devices[0]
+	bindings := DefaultBindings(device, found[device], "ahu-1")
+	expected := []Binding{
+		{Device: 1001, Object: temperature, TwinID: "ahu-1", Feature: "analog-input-1", Property: DefaultProperty},
+		{Device: 1001, Object: fan, TwinID: "ahu-1", Feature: "binary-output-2", Property: DefaultProperty},
+		{Device: 1001, Object: mode, TwinID: "ahu-1", Feature: "multi-state-value-3", Property: DefaultProperty},
+	}
+	if !reflect.DeepEqual(bindings, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, bindings)
+	}
+	if b.device(1001).Address != "192.168.1.20:47808" {
+		t.Error("Expected the discovered device to be remembered")
+	}
+}
+
+func TestPolling(t *testing.T) {
+	n := newNetwork()
+	b, reg := newBridge(n, Options{})
+	for _, binding := range DefaultBindings(n.devices[0], n.objects[1001], "ahu-1") {
+		if err := b.Bind(binding); err != nil {
+			t.Fatalf("Failed to bind: %v", err)
+		}
+	}
+	if err := b.Bind(Binding{Device: 1001, Object: fan, TwinID: "ahu-1", Feature: "fan"}); err != ErrBindingAlreadyExists {
+		t.Errorf("Expected ErrBindingAlreadyExists, got %v", err)
+	}
+	if err := b.Bind(Binding{Device: 1001, Object: fan}); !errors.Is(err, ErrInvalidBinding) {
+		t.Errorf("Expected ErrInvalidBinding, got %v", err)
+	}
+
+	// The device refuses COV, so its objects are polled
+	b.Refresh(context.Background())
+	dt, _ := reg.Get("ahu-1")
+	values := make(map[string]interface{})
+	for id, f := range dt.GetAllFeatures() {
+		values[id], _ = f.GetProperty(DefaultProperty)
+	}
+	expected := map[string]interface{}{"analog-input-1": 21.3, "binary-output-2": true, "multi-state-value-3": 2.0}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected %v, got %v", expected, values)
+	}
+	if stats := b.Stats(); stats.Polls != 1 || stats.Applied != 3 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	if status := b.Bindings()[0]; status.COV || status.LastValue != 21.3 {
+		t.Errorf("Unexpected binding status %+v", status)
+	}
+
+	// Later rounds do not try to subscribe again
+	b.Refresh(context.Background())
+	if n.reads != 2 {
+		t.Errorf("Expected a read per round, got %d", n.reads)
+	}
+
+	n.err = errors.New("timeout")
+	b.Refresh(context.Background())
+	if stats := b.Stats(); stats.Failed != 1 || stats.LastError == "" {
+		t.Errorf("Expected a failed poll, got %+v", stats)
+	}
+
+	if err := b.Unbind(1001, fan); err != nil || len(b.Bindings()) != 2 {
+		t.Errorf("Expected the binding to be removed, got %v", err)
+	}
+	if err := b.Unbind(1001, fan); err != ErrBindingNotFound {
+		t.Errorf("Expected ErrBindingNotFound, got %v", err)
+	}
+}
+
+func TestCOV(t *testing.T) {
+	n := newNetwork()
+	n.cov[1001] = true
+	b, reg := newBridge(n, Options{PollInterval: time.Minute, COVLifetime: time.Minute})
+	b.Bind(Binding{Device: 1001, Object: temperature, TwinID: "ahu-1", Feature: "supply", Property: "temperature"})
+
+	b.Refresh(context.Background())
+	status := b.Bindings()[0]
+	if !status.COV || len(n.subscribed) != 1 || n.reads != 0 {
+		t.Fatalf("Expected a COV subscription instead of polling, got %+v", status)
+	}
+	if lifetime := time.Until(status.COVExpires); lifetime < time.Minute {
+		t.Errorf("Expected the lifetime to outlast two rounds, got %s", lifetime)
+	}
+
+	// Subscriptions lasting past the next round are not renewed
+	b.Refresh(context.Background())
+	if len(n.subscribed) != 1 {
+		t.Errorf("Expected no renewal, got %d subscriptions", len(n.subscribed))
+	}
+
+	b.HandleCOV(Notification{Device: 1001, Object: temperature, Value: float32(22.5)})
+	b.HandleCOV(Notification{Device: 1001, Object: fan, Value: "active"})
+	dt, _ := reg.Get("ahu-1")
+	supply, _ := dt.GetFeature("supply")
+	if value, _ := supply.GetProperty("temperature"); value != 22.5 {
+		t.Errorf("Expected the notified value, got %v", value)
+	}
+	if stats := b.Stats(); stats.Notifications != 2 || stats.Applied != 1 {
+		t.Errorf("Expected unbound objects to be ignored, got %+v", stats)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	for _, c := range []struct {
+		objectType ObjectType
+		value      interface{}
+		expected   interface{}
+	}{
+		{AnalogValue, float32(0.1), 0.1},
+		{AnalogValue, 42.0, 42.0},
+		{BinaryInput, "inactive", false},
+		{BinaryValue, uint32(1), true},
+		{BinaryValue, false, false},
+		{MultiStateInput, uint32(4), 4.0},
+		{"characterstring-value", "hello", "hello"},
+	} {
+		if got := convert(c.objectType, c.value); got != c.expected {
+			t.Errorf("Expected %v for %s %v, got %v", c.expected, c.objectType, c.value, got)
+		}
+	}
+}
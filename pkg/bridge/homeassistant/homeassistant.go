@@ -0,0 +1,626 @@
+// Package homeassistant integrates twins with Home Assistant over MQTT. Twin
+// properties are announced through MQTT discovery, so that they show up as
+// Home Assistant entities grouped into a device per twin, and their values
+// are published as entity states. Commands sent to writable entities and
+// state changes of Home Assistant entities published by its MQTT statestream
+// integration are applied back to twins through the ingester. The bridge
+// works on a client provided by an MQTT library, so any library can be
+// adapted to the Client interface.
+package homeassistant
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aleka07/go-digital-twin/pkg/ingest"
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// Common errors
+var (
+	ErrInvalidImport       = errors.New("invalid Home Assistant import")
+	ErrImportAlreadyExists = errors.New("Home Assistant import already exists")
+	ErrImportNotFound      = errors.New("Home Assistant import not found")
+	ErrInvalidCommand      = errors.New("invalid Home Assistant command")
+)
+
+// Defaults for options left empty
+const (
+	DefaultDiscoveryPrefix   = "homeassistant"
+	DefaultStatestreamPrefix = "homeassistant/statestream"
+	DefaultBaseTopic         = "dt"
+)
+
+// Payloads of availability and boolean states
+const (
+	PayloadOnline  = "online"
+	PayloadOffline = "offline" // To be set as the client's last will on the status topic
+	PayloadOn      = "ON"
+	PayloadOff     = "OFF"
+)
+
+// Entity components used for twin properties
+const (
+	BinarySensor = "binary_sensor"
+	Sensor       = "sensor"
+	Switch       = "switch"
+	Number       = "number"
+	Text         = "text"
+)
+
+// Client is an MQTT client connected to the broker used by Home Assistant.
+// Messages received on subscribed topics are passed to Bridge.HandleMessage.
+type Client interface {
+	Publish(ctx context.Context, topic string, payload []byte, retain bool) error
+	Subscribe(ctx context.Context, topics ...string) error
+}
+
+// Options configure a bridge
+type Options struct {
+	DiscoveryPrefix   string   // Prefix of discovery topics, DefaultDiscoveryPrefix when empty
+	StatestreamPrefix string   // Base topic of the statestream integration, DefaultStatestreamPrefix when empty
+	BaseTopic         string   // Prefix of state and command topics, DefaultBaseTopic when empty
+	Types             []string // Twin types exposed, all twins when empty
+	Writable          []string // "featureId/property" patterns, matched with path.Match, whose entities accept commands
+}
+
+// Import applies the state of a Home Assistant entity to a twin property
+type Import struct {
+	EntityID string `json:"entityId"` // Such as sensor.outdoor_temperature
+	TwinID   string `json:"twinId"`
+	Feature  string `json:"feature"`
+	Property string `json:"property"`
+}
+
+// Stats count the messages handled by a bridge
+type Stats struct {
+	Entities  int    `json:"entities"`  // Entities currently announced
+	Published int    `json:"published"` // Discovery and state messages published
+	Commands  int    `json:"commands"`  // Commands received for writable entities
+	States    int    `json:"states"`    // State changes received for imported entities
+	Applied   int    `json:"applied"`   // Commands and state changes applied to twins
+	Failed    int    `json:"failed"`
+	LastError string `json:"lastError,omitempty"`
+}
+
+// entity is a twin property announced to Home Assistant
+type entity struct {
+	twinID      string
+	feature     string
+	property    string
+	component   string
+	configTopic string
+	config      []byte
+	state       string
+}
+
+// Bridge exposes twins to Home Assistant and applies its state changes
+type Bridge struct {
+	registry *registry.Registry
+	ingester *ingest.Ingester
+	client   Client
+	opts     Options
+	entities map[string]map[string]*entity // Twin ID -> unique ID -> announced entity
+	imports  map[string]Import             // Entity ID -> import
+	stats    Stats
+	mutex    sync.Mutex
+}
+
+// NewBridge creates a bridge
+func NewBridge(reg *registry.Registry, ingester *ingest.Ingester, client Client, opts Options) *Bridge {
+	if opts.DiscoveryPrefix == "" {
+		opts.DiscoveryPrefix = DefaultDiscoveryPrefix
+	}
+	if opts.StatestreamPrefix == "" {
+		opts.StatestreamPrefix = DefaultStatestreamPrefix
+	}
+	if opts.BaseTopic == "" {
+		opts.BaseTopic = DefaultBaseTopic
+	}
+
+	return &Bridge{
+		registry: reg,
+		ingester: ingester,
+		client:   client,
+		opts:     opts,
+		entities: make(map[string]map[string]*entity),
+		imports:  make(map[string]Import),
+	}
+}
+
+// StatusTopic returns the availability topic of all entities. Clients should
+// set PayloadOffline as their last will on it, retained.
+func (b *Bridge) StatusTopic() string {
+	return b.opts.BaseTopic + "/status"
+}
+
+// Start marks the entities available, subscribes to commands, Home Assistant
+// status changes and the statestream, and announces all twins
+func (b *Bridge) Start(ctx context.Context) error {
+	if err := b.client.Publish(ctx, b.StatusTopic(), []byte(PayloadOnline), true); err != nil {
+		return err
+	}
+	err := b.client.Subscribe(ctx,
+		b.opts.BaseTopic+"/+/+/+/set",
+		b.opts.DiscoveryPrefix+"/status",
+		b.opts.StatestreamPrefix+"/+/+/state",
+	)
+	if err != nil {
+		return err
+	}
+
+	b.SyncAll(ctx)
+	return nil
+}
+
+// Run announces the changes of twins from a subscription until the channel
+// is closed or the context is cancelled. The subscription should cover all
+// topics that change twins, such as "#".
+func (b *Bridge) Run(ctx context.Context, events <-chan messaging_sim.Message) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-events:
+			if !ok {
+				return
+			}
+			if id := msg.TwinID(); id != "" {
+				b.Sync(ctx, id)
+			}
+		}
+	}
+}
+
+// SyncAll announces all twins and removes the entities of twins that no
+// longer exist
+func (b *Bridge) SyncAll(ctx context.Context) {
+	ids := make(map[string]bool)
+	for _, dt := range b.registry.List() {
+		ids[dt.ID] = true
+	}
+	b.mutex.Lock()
+	for id := range b.entities {
+		ids[id] = true
+	}
+	b.mutex.Unlock()
+
+	sorted := make([]string, 0, len(ids))
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Strings(sorted)
+
+	for _, id := range sorted {
+		b.Sync(ctx, id)
+	}
+}
+
+// Sync brings the entities of a twin in line with its properties. Discovery
+// configurations and states are only published when they changed; entities
+// of removed properties or twins are removed from Home Assistant.
+func (b *Bridge) Sync(ctx context.Context, twinID string) {
+	var wanted map[string]*entity
+	if dt, err := b.registry.Get(twinID); err == nil && b.exposed(dt) {
+		wanted = b.entitiesOf(dt)
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	announced := b.entities[twinID]
+	if announced == nil {
+		announced = make(map[string]*entity)
+	}
+
+	for uid, old := range announced {
+		if _, ok := wanted[uid]; ok {
+			continue
+		}
+		if b.publish(ctx, old.configTopic, nil) && b.publish(ctx, b.stateTopic(old), nil) {
+			delete(announced, uid)
+		}
+	}
+
+	for uid, e := range wanted {
+		old := announced[uid]
+		if old != nil && old.configTopic != e.configTopic {
+			// The component changed with the type of the value
+			if !b.publish(ctx, old.configTopic, nil) {
+				continue
+			}
+			old = nil
+		}
+		if old == nil || !bytes.Equal(old.config, e.config) {
+			if !b.publish(ctx, e.configTopic, e.config) {
+				continue
+			}
+			old = nil
+		}
+		if old == nil || old.state != e.state {
+			if !b.publish(ctx, b.stateTopic(e), []byte(e.state)) {
+				e.state = ""
+			}
+		}
+		announced[uid] = e
+	}
+
+	if len(announced) == 0 {
+		delete(b.entities, twinID)
+	} else {
+		b.entities[twinID] = announced
+	}
+
+	b.stats.Entities = 0
+	for _, entities := range b.entities {
+		b.stats.Entities += len(entities)
+	}
+}
+
+// publish sends a retained message, recording failures. An empty payload
+// clears the retained message. The caller must hold the mutex.
+func (b *Bridge) publish(ctx context.Context, topic string, payload []byte) bool {
+	if err := b.client.Publish(ctx, topic, payload, true); err != nil {
+		b.stats.Failed++
+		b.stats.LastError = err.Error()
+		return false
+	}
+	b.stats.Published++
+	return true
+}
+
+// exposed reports whether a twin is announced to Home Assistant
+func (b *Bridge) exposed(dt *twin.DigitalTwin) bool {
+	if len(b.opts.Types) == 0 {
+		return true
+	}
+	for _, t := range b.opts.Types {
+		if dt.Type == t {
+			return true
+		}
+	}
+	return false
+}
+
+// writable reports whether the entity of a property accepts commands
+func (b *Bridge) writable(feature, property string) bool {
+	for _, pattern := range b.opts.Writable {
+		if ok, _ := path.Match(pattern, feature+"/"+property); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// entitiesOf returns the entities of the scalar properties of a twin by unique ID
+func (b *Bridge) entitiesOf(dt *twin.DigitalTwin) map[string]*entity {
+	device := map[string]interface{}{
+		"identifiers":  []string{"dt:" + dt.ID},
+		"name":         dt.ID,
+		"model":        dt.Type,
+		"manufacturer": "go-digital-twin",
+	}
+
+	result := make(map[string]*entity)
+	for featureID, feature := range dt.GetAllFeatures() {
+		for key, value := range feature.GetAllProperties() {
+			state, kind, ok := encodeState(value)
+			if !ok {
+				continue
+			}
+
+			e := &entity{twinID: dt.ID, feature: featureID, property: key, state: state}
+			uid := "dt:" + dt.ID + "/" + featureID + "/" + key
+			config := map[string]interface{}{
+				"name":                  featureID + " " + key,
+				"unique_id":             uid,
+				"object_id":             slug(dt.ID + "_" + featureID + "_" + key),
+				"state_topic":           b.stateTopic(e),
+				"availability_topic":    b.StatusTopic(),
+				"payload_available":     PayloadOnline,
+				"payload_not_available": PayloadOffline,
+				"device":                device,
+			}
+
+			writable := b.writable(featureID, key)
+			if writable {
+				config["command_topic"] = b.commandTopic(e)
+			}
+			switch {
+			case kind == Switch && writable:
+				e.component = Switch
+				config["payload_on"], config["payload_off"] = PayloadOn, PayloadOff
+			case kind == Switch:
+				e.component = BinarySensor
+				config["payload_on"], config["payload_off"] = PayloadOn, PayloadOff
+			case kind == Number && writable:
+				e.component = Number
+				config["min"], config["max"], config["step"], config["mode"] = -1e9, 1e9, 0.001, "box"
+			case kind == Number:
+				e.component = Sensor
+				config["state_class"] = "measurement"
+			case writable:
+				e.component = Text
+			default:
+				e.component = Sensor
+			}
+
+			e.configTopic = fmt.Sprintf("%s/%s/%s/%s/config", b.opts.DiscoveryPrefix, e.component, slug(dt.ID), objectID(uid, featureID, key))
+			e.config, _ = json.Marshal(config)
+			result[uid] = e
+		}
+	}
+	return result
+}
+
+// stateTopic returns the topic the state of an entity is published on
+func (b *Bridge) stateTopic(e *entity) string {
+	return b.propertyTopic(e) + "/state"
+}
+
+// commandTopic returns the topic commands for an entity are received on
+func (b *Bridge) commandTopic(e *entity) string {
+	return b.propertyTopic(e) + "/set"
+}
+
+// propertyTopic returns the topic prefix of an entity
+func (b *Bridge) propertyTopic(e *entity) string {
+	return b.opts.BaseTopic + "/" + escape(e.twinID) + "/" + escape(e.feature) + "/" + escape(e.property)
+}
+
+// HandleMessage handles a message received on a subscribed topic: commands
+// for writable entities and statestream states of imported entities are
+// applied to twins, and all twins are announced again when Home Assistant
+// comes online, since it may have lost its entities
+func (b *Bridge) HandleMessage(ctx context.Context, topic string, payload []byte) {
+	switch {
+	case topic == b.opts.DiscoveryPrefix+"/status":
+		if string(payload) == PayloadOnline {
+			b.mutex.Lock()
+			b.entities = make(map[string]map[string]*entity)
+			b.mutex.Unlock()
+			b.SyncAll(ctx)
+		}
+	case strings.HasPrefix(topic, b.opts.BaseTopic+"/") && strings.HasSuffix(topic, "/set"):
+		b.handleCommand(topic, payload)
+	case strings.HasPrefix(topic, b.opts.StatestreamPrefix+"/") && strings.HasSuffix(topic, "/state"):
+		b.handleState(topic, payload)
+	}
+}
+
+// handleCommand applies a command sent to a writable entity. The new state
+// is published once the twin changed.
+func (b *Bridge) handleCommand(topic string, payload []byte) {
+	b.mutex.Lock()
+	b.stats.Commands++
+	b.mutex.Unlock()
+
+	parts := strings.Split(strings.TrimPrefix(topic, b.opts.BaseTopic+"/"), "/")
+	if len(parts) != 4 {
+		return
+	}
+	var ids [3]string
+	for i := range ids {
+		id, err := url.PathUnescape(parts[i])
+		if err != nil {
+			b.fail(fmt.Errorf("%w: %v", ErrInvalidCommand, err))
+			return
+		}
+		ids[i] = id
+	}
+
+	b.mutex.Lock()
+	e := b.entities[ids[0]]["dt:"+ids[0]+"/"+ids[1]+"/"+ids[2]]
+	b.mutex.Unlock()
+	if e == nil || !b.writable(e.feature, e.property) {
+		b.fail(fmt.Errorf("%w: %s is not writable", ErrInvalidCommand, topic))
+		return
+	}
+
+	value, err := decodeCommand(e.component, string(payload))
+	if err != nil {
+		b.fail(err)
+		return
+	}
+	b.apply(e.twinID, e.feature, e.property, value)
+}
+
+// handleState applies a statestream state change of an imported entity.
+// Unavailable and unknown states are ignored.
+func (b *Bridge) handleState(topic string, payload []byte) {
+	parts := strings.Split(strings.TrimPrefix(topic, b.opts.StatestreamPrefix+"/"), "/")
+	if len(parts) != 3 {
+		return
+	}
+
+	b.mutex.Lock()
+	imp, ok := b.imports[parts[0]+"."+parts[1]]
+	if ok {
+		b.stats.States++
+	}
+	b.mutex.Unlock()
+
+	state := string(payload)
+	if !ok || state == "unavailable" || state == "unknown" {
+		return
+	}
+	b.apply(imp.TwinID, imp.Feature, imp.Property, decodeState(state))
+}
+
+// apply writes a value received from Home Assistant to a twin property
+func (b *Bridge) apply(twinID, feature, property string, value interface{}) {
+	_, err := b.ingester.Apply(ingest.Telemetry{
+		TwinID:   twinID,
+		Features: map[string]map[string]interface{}{feature: {property: value}},
+	})
+	if err != nil {
+		b.fail(err)
+		return
+	}
+
+	b.mutex.Lock()
+	b.stats.Applied++
+	b.mutex.Unlock()
+}
+
+// AddImport applies the statestream states of a Home Assistant entity to a
+// twin property
+func (b *Bridge) AddImport(imp Import) error {
+	domain, object, ok := strings.Cut(imp.EntityID, ".")
+	if !ok || domain == "" || object == "" || strings.ContainsAny(imp.EntityID, "/+#") {
+		return fmt.Errorf("%w: invalid entity ID %q", ErrInvalidImport, imp.EntityID)
+	}
+	if imp.TwinID == "" || imp.Feature == "" || imp.Property == "" {
+		return fmt.Errorf("%w: twin, feature and property are required", ErrInvalidImport)
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if _, exists := b.imports[imp.EntityID]; exists {
+		return ErrImportAlreadyExists
+	}
+	b.imports[imp.EntityID] = imp
+	return nil
+}
+
+// RemoveImport stops applying the states of a Home Assistant entity
+func (b *Bridge) RemoveImport(entityID string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if _, exists := b.imports[entityID]; !exists {
+		return ErrImportNotFound
+	}
+	delete(b.imports, entityID)
+	return nil
+}
+
+// Imports returns the imports sorted by entity ID
+func (b *Bridge) Imports() []Import {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	result := make([]Import, 0, len(b.imports))
+	for _, imp := range b.imports {
+		result = append(result, imp)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].EntityID < result[j].EntityID })
+	return result
+}
+
+// Stats returns the message counters of the bridge
+func (b *Bridge) Stats() Stats {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.stats
+}
+
+// fail records an error
+func (b *Bridge) fail(err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.stats.Failed++
+	b.stats.LastError = err.Error()
+}
+
+// encodeState returns the state payload of a property value and the kind of
+// entity it needs, one of Switch, Number or Text. Values other than booleans,
+// numbers and strings are not exposed.
+func encodeState(value interface{}) (string, string, bool) {
+	switch v := value.(type) {
+	case bool:
+		if v {
+			return PayloadOn, Switch, true
+		}
+		return PayloadOff, Switch, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), Number, true
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), Number, true
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, json.Number:
+		return fmt.Sprint(v), Number, true
+	case string:
+		return v, Text, true
+	}
+	return "", "", false
+}
+
+// decodeCommand converts a command payload to a property value
+func decodeCommand(component, payload string) (interface{}, error) {
+	switch component {
+	case Switch:
+		switch payload {
+		case PayloadOn:
+			return true, nil
+		case PayloadOff:
+			return false, nil
+		}
+	case Number:
+		if f, err := strconv.ParseFloat(payload, 64); err == nil {
+			return f, nil
+		}
+	case Text:
+		return payload, nil
+	}
+	return nil, fmt.Errorf("%w: %q for a %s", ErrInvalidCommand, payload, component)
+}
+
+// decodeState converts a statestream state to a property value: on and off
+// become booleans and numbers float64
+func decodeState(state string) interface{} {
+	switch state {
+	case "on":
+		return true
+	case "off":
+		return false
+	}
+	if f, err := strconv.ParseFloat(state, 64); err == nil {
+		return f
+	}
+	return state
+}
+
+// escape makes an ID usable as a topic level
+func escape(id string) string {
+	return strings.NewReplacer("%", "%25", "/", "%2F", "+", "%2B", "#", "%23").Replace(id)
+}
+
+// slug returns an ID made of lowercase letters, digits and underscores, as
+// used by Home Assistant for entity IDs and discovery topics
+func slug(s string) string {
+	var sb strings.Builder
+	underscore := false
+	for _, r := range strings.ToLower(s) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			sb.WriteRune(r)
+			underscore = false
+		} else if !underscore && sb.Len() > 0 {
+			sb.WriteByte('_')
+			underscore = true
+		}
+	}
+	return strings.TrimSuffix(sb.String(), "_")
+}
+
+// objectID returns the discovery object ID of a property. A hash of the
+// unique ID keeps properties whose slugs collide apart.
+func objectID(uid, feature, property string) string {
+	h := fnv.New32a()
+	h.Write([]byte(uid))
+	return fmt.Sprintf("%s_%08x", slug(feature+"_"+property), h.Sum32())
+}
@@ -0,0 +1,281 @@
+package homeassistant
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/history"
+	"github.com/aleka07/go-digital-twin/pkg/ingest"
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// broker is a test broker keeping retained messages
+type broker struct {
+	retained  map[string]string
+	published int
+	topics    []string
+	err       error
+	mutex     sync.Mutex
+}
+
+func (b *broker) Publish(ctx context.Context, topic string, payload []byte, retain bool) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.err != nil {
+		return b.err
+	}
+	b.published++
+	if len(payload) == 0 {
+		delete(b.retained, topic)
+	} else {
+		b.retained[topic] = string(payload)
+	}
+	return nil
+}
+
+// state returns a retained message
+func (b *broker) state(topic string) string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.retained[topic]
+}
+
+// fail makes publishing fail with an error, or succeed again when nil
+func (b *broker) fail(err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.err = err
+}
+
+func (b *broker) Subscribe(ctx context.Context, topics ...string) error {
+	b.topics = append(b.topics, topics...)
+	return nil
+}
+
+// configs returns the discovery configurations retained for a component
+func (b *broker) configs(t *testing.T, component string) map[string]map[string]interface{} {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	result := make(map[string]map[string]interface{})
+	for topic, payload := range b.retained {
+		if !strings.HasPrefix(topic, "homeassistant/"+component+"/") {
+			continue
+		}
+		var config map[string]interface{}
+		if err := json.Unmarshal([]byte(payload), &config); err != nil {
+			t.Fatalf("Invalid configuration on %s: %v", topic, err)
+		}
+		result[config["unique_id"].(string)] = config
+	}
+	return result
+}
+
+func newBridge(opts Options) (*Bridge, *broker, *registry.Registry) {
+	reg := registry.NewRegistry()
+	lamp := twin.NewDigitalTwin("lamp/1", "lamp")
+	light := twin.NewFeatureState()
+	light.SetProperty("on", true)
+	light.SetProperty("brightness", 80.0)
+	light.SetProperty("scene", "evening")
+	light.SetProperty("rgb", []interface{}{255.0, 200.0, 0.0})
+	lamp.AddFeature("light", light)
+	reg.Create(lamp)
+	reg.Create(twin.NewDigitalTwin("pump-1", "pump"))
+
+	in := ingest.NewIngester(reg, messaging_sim.NewPubSub(), history.NewStore(10))
+	mqtt := &broker{retained: make(map[string]string)}
+	return NewBridge(reg, in, mqtt, opts), mqtt, reg
+}
+
+func TestDiscovery(t *testing.T) {
+	b, mqtt, _ := newBridge(Options{Types: []string{"lamp"}})
+	if err := b.Start(context.Background()); err != nil {
+		t.Fatalf("Failed to start: %v", err)
+	}
+	if mqtt.retained["dt/status"] != PayloadOnline || len(mqtt.topics) != 3 {
+		t.Errorf("Expected the bridge to be online and subscribed, got %v", mqtt.topics)
+	}
+
+	sensors := mqtt.configs(t, Sensor)
+	binary := mqtt.configs(t, BinarySensor)
+	if len(sensors) != 2 || len(binary) != 1 || b.Stats().Entities != 3 {
+		t.Fatalf("Expected two sensors and a binary sensor for the lamp only, got %v and %v", sensors, binary)
+	}
+	brightness := sensors["dt:lamp/1/light/brightness"]
+	if brightness["state_topic"] != "dt/lamp%2F1/light/brightness/state" || brightness["object_id"] != "lamp_1_light_brightness" || brightness["state_class"] != "measurement" {
+		t.Errorf("Unexpected configuration %v", brightness)
+	}
+	if device := brightness["device"].(map[string]interface{}); device["name"] != "lamp/1" || device["model"] != "lamp" {
+		t.Errorf("Unexpected device %v", device)
+	}
+	if _, ok := brightness["command_topic"]; ok {
+		t.Error("Expected read-only entities without a command topic")
+	}
+
+	expected := map[string]string{"light/on": PayloadOn, "light/brightness": "80", "light/scene": "evening"}
+	for key, state := range expected {
+		if got := mqtt.retained["dt/lamp%2F1/"+key+"/state"]; got != state {
+			t.Errorf("Expected state %q for %s, got %q", state, key, got)
+		}
+	}
+
+	// Unchanged twins are not published again
+	published := mqtt.published
+	b.SyncAll(context.Background())
+	if mqtt.published != published {
+		t.Errorf("Expected no messages for unchanged twins, got %d", mqtt.published-published)
+	}
+}
+
+func TestSync(t *testing.T) {
+	b, mqtt, reg := newBridge(Options{})
+	ps := messaging_sim.NewPubSub()
+	events := ps.SubscribeWithBuffer("#", 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b.Start(ctx)
+	go b.Run(ctx, events)
+
+	dt, _ := reg.Get("lamp/1")
+	light, _ := dt.GetFeature("light")
+	light.SetProperty("brightness", 40.0)
+	light.SetProperty("on", "yes") // Becomes a text sensor
+	light.RemoveProperty("scene")
+	dt.UpdateFeature("light", light)
+	reg.Update(dt)
+	ps.Publish("properties.updated", map[string]interface{}{"twinId": "lamp/1", "featureId": "light"})
+
+	deadline := time.Now().Add(time.Second)
+	for mqtt.state("dt/lamp%2F1/light/brightness/state") != "40" {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the twin to be synced")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if len(mqtt.configs(t, BinarySensor)) != 0 || len(mqtt.configs(t, Sensor)) != 2 || b.Stats().Entities != 2 {
+		t.Errorf("Expected the binary sensor to be replaced, got %v", mqtt.retained)
+	}
+	if mqtt.state("dt/lamp%2F1/light/scene/state") != "" || mqtt.state("dt/lamp%2F1/light/on/state") != "yes" {
+		t.Errorf("Expected the removed state to be cleared, got %v", mqtt.retained)
+	}
+
+	// Failed messages are retried on the next sync
+	mqtt.fail(errors.New("disconnected"))
+	light.SetProperty("brightness", 50.0)
+	dt.UpdateFeature("light", light)
+	reg.Update(dt)
+	b.Sync(ctx, "lamp/1")
+	mqtt.fail(nil)
+	b.Sync(ctx, "lamp/1")
+	if stats := b.Stats(); stats.Failed != 1 || mqtt.state("dt/lamp%2F1/light/brightness/state") != "50" {
+		t.Errorf("Expected the state to be published after a failure, got %+v", stats)
+	}
+
+	// Home Assistant coming online gets all entities again
+	published := mqtt.published
+	b.HandleMessage(ctx, "homeassistant/status", []byte(PayloadOnline))
+	if mqtt.published-published != 4 {
+		t.Errorf("Expected two configurations and states, got %d messages", mqtt.published-published)
+	}
+
+	reg.Delete("lamp/1")
+	b.Sync(ctx, "lamp/1")
+	if len(mqtt.retained) != 1 || b.Stats().Entities != 0 {
+		t.Errorf("Expected only the status to be retained, got %v", mqtt.retained)
+	}
+}
+
+func TestCommands(t *testing.T) {
+	b, mqtt, reg := newBridge(Options{Writable: []string{"light/*"}})
+	ctx := context.Background()
+	b.Start(ctx)
+
+	switches := mqtt.configs(t, Switch)
+	if config := switches["dt:lamp/1/light/on"]; config == nil || config["command_topic"] != "dt/lamp%2F1/light/on/set" {
+		t.Fatalf("Expected a switch with a command topic, got %v", switches)
+	}
+	if len(mqtt.configs(t, Number)) != 1 || len(mqtt.configs(t, Text)) != 1 {
+		t.Errorf("Expected a number and a text entity, got %v", mqtt.retained)
+	}
+
+	b.HandleMessage(ctx, "dt/lamp%2F1/light/on/set", []byte(PayloadOff))
+	b.HandleMessage(ctx, "dt/lamp%2F1/light/brightness/set", []byte("12.5"))
+	b.HandleMessage(ctx, "dt/lamp%2F1/light/scene/set", []byte("night"))
+	b.HandleMessage(ctx, "dt/lamp%2F1/light/brightness/set", []byte("bright"))
+	b.HandleMessage(ctx, "dt/lamp%2F1/light/rgb/set", []byte("0,0,0"))
+
+	dt, _ := reg.Get("lamp/1")
+	light, _ := dt.GetFeature("light")
+	expected := map[string]interface{}{"on": false, "brightness": 12.5, "scene": "night", "rgb": []interface{}{255.0, 200.0, 0.0}}
+	if !reflect.DeepEqual(light.GetAllProperties(), expected) {
+		t.Errorf("Expected %v, got %v", expected, light.GetAllProperties())
+	}
+	if stats := b.Stats(); stats.Commands != 5 || stats.Applied != 3 || stats.Failed != 2 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestImports(t *testing.T) {
+	b, _, reg := newBridge(Options{})
+	ctx := context.Background()
+
+	if err := b.AddImport(Import{EntityID: "sensor.outdoor_temperature", TwinID: "pump-1", Feature: "weather", Property: "temperature"}); err != nil {
+		t.Fatalf("Failed to add import: %v", err)
+	}
+	b.AddImport(Import{EntityID: "binary_sensor.rain", TwinID: "pump-1", Feature: "weather", Property: "rain"})
+	if err := b.AddImport(Import{EntityID: "binary_sensor.rain", TwinID: "pump-1", Feature: "weather", Property: "rain"}); err != ErrImportAlreadyExists {
+		t.Errorf("Expected ErrImportAlreadyExists, got %v", err)
+	}
+	for _, invalid := range []Import{
+		{EntityID: "rain", TwinID: "pump-1", Feature: "weather", Property: "rain"},
+		{EntityID: "sensor.a/b", TwinID: "pump-1", Feature: "weather", Property: "rain"},
+		{EntityID: "sensor.rain", Feature: "weather", Property: "rain"},
+	} {
+		if err := b.AddImport(invalid); !errors.Is(err, ErrInvalidImport) {
+			t.Errorf("Expected ErrInvalidImport for %+v, got %v", invalid, err)
+		}
+	}
+
+	b.HandleMessage(ctx, "homeassistant/statestream/sensor/outdoor_temperature/state", []byte("7.5"))
+	b.HandleMessage(ctx, "homeassistant/statestream/binary_sensor/rain/state", []byte("on"))
+	b.HandleMessage(ctx, "homeassistant/statestream/binary_sensor/rain/state", []byte("unavailable"))
+	b.HandleMessage(ctx, "homeassistant/statestream/sensor/outdoor_temperature/friendly_name", []byte("Outdoor"))
+	b.HandleMessage(ctx, "homeassistant/statestream/sensor/other/state", []byte("1"))
+
+	dt, _ := reg.Get("pump-1")
+	weather, _ := dt.GetFeature("weather")
+	if expected := map[string]interface{}{"temperature": 7.5, "rain": true}; !reflect.DeepEqual(weather.GetAllProperties(), expected) {
+		t.Errorf("Expected %v, got %v", expected, weather.GetAllProperties())
+	}
+	if stats := b.Stats(); stats.States != 3 || stats.Applied != 2 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	if err := b.RemoveImport("binary_sensor.rain"); err != nil || len(b.Imports()) != 1 {
+		t.Errorf("Expected the import to be removed, got %v", err)
+	}
+	if err := b.RemoveImport("binary_sensor.rain"); err != ErrImportNotFound {
+		t.Errorf("Expected ErrImportNotFound, got %v", err)
+	}
+}
+
+func TestSlug(t *testing.T) {
+	for s, expected := range map[string]string{
+		"lamp/1_light_on": "lamp_1_light_on",
+		"Pump-01 (North)": "pump_01_north",
+		"--x--":           "x",
+	} {
+		if got := slug(s); got != expected {
+			t.Errorf("Expected %q for %q, got %q", expected, s, got)
+		}
+	}
+}
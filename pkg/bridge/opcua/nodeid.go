@@ -0,0 +1,81 @@
+package opcua
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidNodeID is returned for node IDs that cannot be parsed
+var ErrInvalidNodeID = errors.New("invalid node ID")
+
+// NodeID identifies a node by namespace index and a numeric or string identifier
+type NodeID struct {
+	Namespace uint16
+	Numeric   uint32 // Used when Name is empty
+	Name      string
+}
+
+// Standard nodes and types of namespace 0
+var (
+	ObjectsFolder        = NodeID{Numeric: 85}
+	FolderType           = NodeID{Numeric: 61}
+	BaseObjectType       = NodeID{Numeric: 58}
+	BaseDataVariableType = NodeID{Numeric: 63}
+	PropertyType         = NodeID{Numeric: 68}
+
+	Organizes    = NodeID{Numeric: 35}
+	HasComponent = NodeID{Numeric: 47}
+	HasProperty  = NodeID{Numeric: 46}
+
+	BooleanType  = NodeID{Numeric: 1}
+	DoubleType   = NodeID{Numeric: 11}
+	StringType   = NodeID{Numeric: 12}
+	BaseDataType = NodeID{Numeric: 24}
+)
+
+// String returns the node ID in the standard notation, such as ns=2;s=twins
+// or i=85. The namespace is left out for namespace 0.
+func (id NodeID) String() string {
+	var b strings.Builder
+	if id.Namespace != 0 {
+		b.WriteString("ns=" + strconv.Itoa(int(id.Namespace)) + ";")
+	}
+	if id.Name != "" {
+		b.WriteString("s=" + id.Name)
+	} else {
+		b.WriteString("i=" + strconv.FormatUint(uint64(id.Numeric), 10))
+	}
+	return b.String()
+}
+
+// ParseNodeID parses a node ID in the standard notation. Only numeric and
+// string identifiers are supported.
+func ParseNodeID(s string) (NodeID, error) {
+	var id NodeID
+	rest := s
+	if strings.HasPrefix(rest, "ns=") {
+		ns, identifier, ok := strings.Cut(rest[3:], ";")
+		n, err := strconv.ParseUint(ns, 10, 16)
+		if !ok || err != nil {
+			return NodeID{}, fmt.Errorf("%w: %q", ErrInvalidNodeID, s)
+		}
+		id.Namespace = uint16(n)
+		rest = identifier
+	}
+
+	switch {
+	case strings.HasPrefix(rest, "i="):
+		n, err := strconv.ParseUint(rest[2:], 10, 32)
+		if err != nil {
+			return NodeID{}, fmt.Errorf("%w: %q", ErrInvalidNodeID, s)
+		}
+		id.Numeric = uint32(n)
+	case strings.HasPrefix(rest, "s=") && len(rest) > 2:
+		id.Name = rest[2:]
+	default:
+		return NodeID{}, fmt.Errorf("%w: %q", ErrInvalidNodeID, s)
+	}
+	return id, nil
+}
@@ -0,0 +1,29 @@
+package opcua
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNodeID(t *testing.T) {
+	for s, expected := range map[string]NodeID{
+		"i=85":                        ObjectsFolder,
+		"ns=2;s=twins":                {Namespace: 2, Name: "twins"},
+		"ns=3;i=1001":                 {Namespace: 3, Numeric: 1001},
+		"ns=2;s=twins/a;b/attributes": {Namespace: 2, Name: "twins/a;b/attributes"},
+	} {
+		id, err := ParseNodeID(s)
+		if err != nil || id != expected {
+			t.Errorf("Expected %q to parse to %+v, got %+v (%v)", s, expected, id, err)
+		}
+		if id.String() != s {
+			t.Errorf("Expected %+v to format as %q, got %q", id, s, id.String())
+		}
+	}
+
+	for _, invalid := range []string{"", "s=", "ns=x;s=a", "ns=2", "ns=70000;i=1", "i=-1", "g=abc"} {
+		if _, err := ParseNodeID(invalid); !errors.Is(err, ErrInvalidNodeID) {
+			t.Errorf("Expected ErrInvalidNodeID for %q, got %v", invalid, err)
+		}
+	}
+}
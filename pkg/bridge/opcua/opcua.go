@@ -0,0 +1,544 @@
+// Package opcua exposes twins as an OPC UA address space, so that SCADA and
+// HMI tools can browse twin data and subscribe to it natively. The address
+// space implements the Browse and Read services and monitored items over the
+// registry; an OPC UA server stack serves it by adapting its namespace
+// interface to the AddressSpace methods, the way the AMQP bridge works on
+// links provided by a client library.
+//
+// Twins are objects organized by a Twins folder below the Objects folder.
+// Attributes are properties of their twin, features are components of their
+// twin and feature properties are variables of their feature. Node IDs follow
+// the REST API paths, such as ns=2;s=twins/pump-1/features/motor/properties/speed.
+package opcua
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// Common errors
+var (
+	ErrNodeNotFound = errors.New("node not found")
+	ErrNotVariable  = errors.New("node is not a variable")
+)
+
+// NamespaceURI is the URI of the twin namespace, registered with the server
+// stack to obtain the namespace index
+const NamespaceURI = "urn:go-digital-twin:twins"
+
+// Defaults for options left empty
+const (
+	DefaultNamespace = 2  // Namespace index of twin nodes
+	DefaultQueueSize = 10 // Values queued per monitored item
+)
+
+// NodeClass is the class of a node
+type NodeClass uint32
+
+// Node classes
+const (
+	NodeClassObject   NodeClass = 1
+	NodeClassVariable NodeClass = 2
+)
+
+// StatusCode is the status of a value or operation
+type StatusCode uint32
+
+// Status codes
+const (
+	StatusGood                     StatusCode = 0x00000000
+	StatusUncertainLastUsableValue StatusCode = 0x40900000 // The property is stale
+	StatusBadNodeIDUnknown         StatusCode = 0x80340000
+	StatusBadAttributeIDInvalid    StatusCode = 0x80350000
+)
+
+// StatusOf returns the status code reported for an error of the address space
+func StatusOf(err error) StatusCode {
+	switch {
+	case err == nil:
+		return StatusGood
+	case errors.Is(err, ErrNotVariable):
+		return StatusBadAttributeIDInvalid
+	default:
+		return StatusBadNodeIDUnknown
+	}
+}
+
+// Node holds the attributes of a node. DataType and ValueRank follow the
+// current value of variables.
+type Node struct {
+	ID             NodeID
+	Class          NodeClass
+	BrowseName     string // In the namespace of the node
+	DisplayName    string
+	Description    string
+	TypeDefinition NodeID
+	DataType       NodeID
+	ValueRank      int32 // -1 for scalars, 1 for arrays
+}
+
+// Reference is a forward hierarchical reference returned by Browse
+type Reference struct {
+	Type   NodeID
+	Target Node
+}
+
+// DataValue is the value of a variable
+type DataValue struct {
+	Value           interface{} // bool, float64, string, []float64 or nil
+	Status          StatusCode
+	SourceTimestamp time.Time
+	ServerTimestamp time.Time
+}
+
+// Options configure an address space
+type Options struct {
+	Namespace uint16 // Namespace index of twin nodes, DefaultNamespace when zero
+	QueueSize int    // Values queued per monitored item, DefaultQueueSize when zero
+}
+
+// AddressSpace maps twins to OPC UA nodes
+type AddressSpace struct {
+	registry *registry.Registry
+	opts     Options
+	monitors map[string][]*monitor // By twin ID
+	mutex    sync.Mutex
+}
+
+// monitor is a monitored variable
+type monitor struct {
+	id     NodeID
+	values chan DataValue
+	last   DataValue
+}
+
+// NewAddressSpace creates an address space over a registry
+func NewAddressSpace(reg *registry.Registry, opts Options) *AddressSpace {
+	if opts.Namespace == 0 {
+		opts.Namespace = DefaultNamespace
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = DefaultQueueSize
+	}
+
+	return &AddressSpace{
+		registry: reg,
+		opts:     opts,
+		monitors: make(map[string][]*monitor),
+	}
+}
+
+// Namespace returns the namespace index of twin nodes
+func (a *AddressSpace) Namespace() uint16 {
+	return a.opts.Namespace
+}
+
+// TwinsFolder returns the ID of the folder organizing the twins
+func (a *AddressSpace) TwinsFolder() NodeID {
+	return NodeID{Namespace: a.opts.Namespace, Name: "twins"}
+}
+
+// TwinNode returns the ID of a twin's object
+func (a *AddressSpace) TwinNode(twinID string) NodeID {
+	return NodeID{Namespace: a.opts.Namespace, Name: "twins/" + twinID}
+}
+
+// AttributeNode returns the ID of a twin attribute's variable
+func (a *AddressSpace) AttributeNode(twinID, name string) NodeID {
+	return NodeID{Namespace: a.opts.Namespace, Name: "twins/" + twinID + "/attributes/" + name}
+}
+
+// FeatureNode returns the ID of a feature's object
+func (a *AddressSpace) FeatureNode(twinID, featureID string) NodeID {
+	return NodeID{Namespace: a.opts.Namespace, Name: "twins/" + twinID + "/features/" + featureID}
+}
+
+// PropertyNode returns the ID of a feature property's variable
+func (a *AddressSpace) PropertyNode(twinID, featureID, key string) NodeID {
+	return NodeID{Namespace: a.opts.Namespace, Name: "twins/" + twinID + "/features/" + featureID + "/properties/" + key}
+}
+
+// path is a parsed twin node ID
+type path struct {
+	twinID    string
+	attribute string
+	featureID string
+	property  string
+	feature   bool // A feature or feature property
+}
+
+// parse splits a node ID into the twin, attribute, feature and property it
+// names. The folder and twins have only a twin ID, empty for the folder.
+func (a *AddressSpace) parse(id NodeID) (path, bool) {
+	if id.Namespace != a.opts.Namespace || id.Name == "" {
+		return path{}, false
+	}
+	if id.Name == "twins" {
+		return path{}, true
+	}
+
+	rest, ok := strings.CutPrefix(id.Name, "twins/")
+	if !ok {
+		return path{}, false
+	}
+	twinID, rest, nested := strings.Cut(rest, "/")
+	if twinID == "" {
+		return path{}, false
+	}
+	if !nested {
+		return path{twinID: twinID}, true
+	}
+
+	if name, ok := strings.CutPrefix(rest, "attributes/"); ok && name != "" {
+		return path{twinID: twinID, attribute: name}, true
+	}
+	rest, ok = strings.CutPrefix(rest, "features/")
+	if !ok {
+		return path{}, false
+	}
+	featureID, rest, nested := strings.Cut(rest, "/")
+	if featureID == "" {
+		return path{}, false
+	}
+	if !nested {
+		return path{twinID: twinID, featureID: featureID, feature: true}, true
+	}
+	key, ok := strings.CutPrefix(rest, "properties/")
+	if !ok || key == "" {
+		return path{}, false
+	}
+	return path{twinID: twinID, featureID: featureID, property: key, feature: true}, true
+}
+
+// Node returns the attributes of a node
+func (a *AddressSpace) Node(id NodeID) (Node, error) {
+	p, ok := a.parse(id)
+	if !ok {
+		return Node{}, ErrNodeNotFound
+	}
+	if p.twinID == "" {
+		return Node{
+			ID:             id,
+			Class:          NodeClassObject,
+			BrowseName:     "Twins",
+			DisplayName:    "Twins",
+			TypeDefinition: FolderType,
+		}, nil
+	}
+
+	dt, err := a.registry.Get(p.twinID)
+	if err != nil {
+		return Node{}, ErrNodeNotFound
+	}
+	return a.node(dt, p)
+}
+
+// node returns the attributes of a twin node
+func (a *AddressSpace) node(dt *twin.DigitalTwin, p path) (Node, error) {
+	switch {
+	case p.attribute != "":
+		value, ok := dt.GetAttribute(p.attribute)
+		if !ok {
+			return Node{}, ErrNodeNotFound
+		}
+		return variable(a.AttributeNode(dt.ID, p.attribute), p.attribute, PropertyType, value), nil
+	case p.property != "":
+		feature, ok := dt.GetFeature(p.featureID)
+		if !ok {
+			return Node{}, ErrNodeNotFound
+		}
+		value, ok := feature.GetProperty(p.property)
+		if !ok {
+			return Node{}, ErrNodeNotFound
+		}
+		return variable(a.PropertyNode(dt.ID, p.featureID, p.property), p.property, BaseDataVariableType, value), nil
+	case p.feature:
+		if _, ok := dt.GetFeature(p.featureID); !ok {
+			return Node{}, ErrNodeNotFound
+		}
+		return Node{
+			ID:             a.FeatureNode(dt.ID, p.featureID),
+			Class:          NodeClassObject,
+			BrowseName:     p.featureID,
+			DisplayName:    p.featureID,
+			TypeDefinition: BaseObjectType,
+		}, nil
+	}
+	return Node{
+		ID:             a.TwinNode(dt.ID),
+		Class:          NodeClassObject,
+		BrowseName:     dt.ID,
+		DisplayName:    dt.ID,
+		Description:    dt.Type,
+		TypeDefinition: BaseObjectType,
+	}, nil
+}
+
+// variable returns the attributes of a variable holding a value
+func variable(id NodeID, name string, typeDefinition NodeID, value interface{}) Node {
+	_, dataType, valueRank := variant(value)
+	return Node{
+		ID:             id,
+		Class:          NodeClassVariable,
+		BrowseName:     name,
+		DisplayName:    name,
+		TypeDefinition: typeDefinition,
+		DataType:       dataType,
+		ValueRank:      valueRank,
+	}
+}
+
+// variant converts a value to an OPC UA value with its data type and value
+// rank. Numbers, booleans and strings keep their type and arrays of numbers
+// become arrays of doubles; objects and other arrays become JSON strings.
+func variant(value interface{}) (interface{}, NodeID, int32) {
+	// Normalize values of any Go type to their JSON form
+	if data, err := json.Marshal(value); err == nil {
+		json.Unmarshal(data, &value)
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return nil, BaseDataType, -1
+	case bool:
+		return v, BooleanType, -1
+	case float64:
+		return v, DoubleType, -1
+	case string:
+		return v, StringType, -1
+	case []interface{}:
+		numbers := make([]float64, 0, len(v))
+		for _, item := range v {
+			n, ok := item.(float64)
+			if !ok {
+				break
+			}
+			numbers = append(numbers, n)
+		}
+		if len(numbers) == len(v) {
+			return numbers, DoubleType, 1
+		}
+	}
+	data, _ := json.Marshal(value)
+	return string(data), StringType, -1
+}
+
+// Browse returns the nodes a node refers to: the Twins folder for the
+// Objects folder, twins ordered by ID for the Twins folder, attributes and
+// features for twins and properties for features. Names are ordered.
+func (a *AddressSpace) Browse(id NodeID) ([]Reference, error) {
+	if id == ObjectsFolder {
+		folder, _ := a.Node(a.TwinsFolder())
+		return []Reference{{Type: Organizes, Target: folder}}, nil
+	}
+
+	p, ok := a.parse(id)
+	if !ok {
+		return nil, ErrNodeNotFound
+	}
+	if p.twinID == "" {
+		twins := a.registry.List()
+		sort.Slice(twins, func(i, j int) bool { return twins[i].ID < twins[j].ID })
+		refs := make([]Reference, 0, len(twins))
+		for _, dt := range twins {
+			node, _ := a.node(dt, path{twinID: dt.ID})
+			refs = append(refs, Reference{Type: Organizes, Target: node})
+		}
+		return refs, nil
+	}
+
+	dt, err := a.registry.Get(p.twinID)
+	if err != nil {
+		return nil, ErrNodeNotFound
+	}
+	if _, err := a.node(dt, p); err != nil {
+		return nil, err
+	}
+
+	var refs []Reference
+	switch {
+	case p.attribute != "" || p.property != "":
+		return []Reference{}, nil
+	case p.feature:
+		feature, _ := dt.GetFeature(p.featureID)
+		for _, key := range sortedKeys(feature.GetAllProperties()) {
+			node, _ := a.node(dt, path{twinID: dt.ID, featureID: p.featureID, property: key, feature: true})
+			refs = append(refs, Reference{Type: HasComponent, Target: node})
+		}
+	default:
+		for _, name := range sortedKeys(dt.GetAllAttributes()) {
+			node, _ := a.node(dt, path{twinID: dt.ID, attribute: name})
+			refs = append(refs, Reference{Type: HasProperty, Target: node})
+		}
+		features := dt.GetAllFeatures()
+		ids := make([]string, 0, len(features))
+		for featureID := range features {
+			ids = append(ids, featureID)
+		}
+		sort.Strings(ids)
+		for _, featureID := range ids {
+			node, _ := a.node(dt, path{twinID: dt.ID, featureID: featureID, feature: true})
+			refs = append(refs, Reference{Type: HasComponent, Target: node})
+		}
+	}
+	if refs == nil {
+		refs = []Reference{}
+	}
+	return refs, nil
+}
+
+// sortedKeys returns the keys of a map in order
+func sortedKeys(values map[string]interface{}) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Read returns the value of a variable. Feature properties carry their
+// effective and server timestamps and are uncertain while stale; attributes
+// carry the modification time of their twin.
+func (a *AddressSpace) Read(id NodeID) (DataValue, error) {
+	p, ok := a.parse(id)
+	if !ok {
+		return DataValue{}, ErrNodeNotFound
+	}
+	if p.attribute == "" && p.property == "" {
+		if _, err := a.Node(id); err != nil {
+			return DataValue{}, err
+		}
+		return DataValue{}, ErrNotVariable
+	}
+
+	dt, err := a.registry.Get(p.twinID)
+	if err != nil {
+		return DataValue{}, ErrNodeNotFound
+	}
+	now := time.Now()
+
+	if p.attribute != "" {
+		value, ok := dt.GetAttribute(p.attribute)
+		if !ok {
+			return DataValue{}, ErrNodeNotFound
+		}
+		v, _, _ := variant(value)
+		return DataValue{Value: v, SourceTimestamp: dt.GetModifiedAt(), ServerTimestamp: now}, nil
+	}
+
+	feature, ok := dt.GetFeature(p.featureID)
+	if !ok {
+		return DataValue{}, ErrNodeNotFound
+	}
+	value, ok := feature.GetProperty(p.property)
+	if !ok {
+		return DataValue{}, ErrNodeNotFound
+	}
+	v, _, _ := variant(value)
+	dv := DataValue{Value: v, ServerTimestamp: now}
+	if meta, ok := feature.GetPropertyMetadata(p.property); ok {
+		dv.SourceTimestamp = meta.Timestamp
+		if !meta.ServerTimestamp.IsZero() {
+			dv.ServerTimestamp = meta.ServerTimestamp
+		}
+		if meta.Stale {
+			dv.Status = StatusUncertainLastUsableValue
+		}
+	}
+	return dv, nil
+}
+
+// Monitor returns a channel receiving the current value of a variable and
+// then every change of its value or status, until the context is cancelled
+// and the channel closed. A variable whose twin, feature or property is
+// removed reports StatusBadNodeIDUnknown. When a client falls behind, the
+// oldest queued values are discarded.
+func (a *AddressSpace) Monitor(ctx context.Context, id NodeID) (<-chan DataValue, error) {
+	dv, err := a.Read(id)
+	if err != nil {
+		return nil, err
+	}
+	p, _ := a.parse(id)
+
+	m := &monitor{id: id, values: make(chan DataValue, a.opts.QueueSize), last: dv}
+	m.values <- dv
+
+	a.mutex.Lock()
+	a.monitors[p.twinID] = append(a.monitors[p.twinID], m)
+	a.mutex.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		a.mutex.Lock()
+		defer a.mutex.Unlock()
+
+		monitors := a.monitors[p.twinID]
+		for i, other := range monitors {
+			if other == m {
+				a.monitors[p.twinID] = append(monitors[:i:i], monitors[i+1:]...)
+				break
+			}
+		}
+		if len(a.monitors[p.twinID]) == 0 {
+			delete(a.monitors, p.twinID)
+		}
+		close(m.values)
+	}()
+
+	return m.values, nil
+}
+
+// HandleEvent notifies the monitors of the twin an event is about of
+// changed values
+func (a *AddressSpace) HandleEvent(msg messaging_sim.Message) {
+	id := msg.TwinID()
+	if id == "" {
+		return
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	for _, m := range a.monitors[id] {
+		dv, err := a.Read(m.id)
+		if err != nil {
+			dv = DataValue{Status: StatusOf(err), ServerTimestamp: time.Now()}
+		}
+		if dv.Status == m.last.Status && reflect.DeepEqual(dv.Value, m.last.Value) {
+			continue
+		}
+		m.last = dv
+
+		select {
+		case m.values <- dv:
+		default:
+			// Discard the oldest value to make room
+			select {
+			case <-m.values:
+			default:
+			}
+			m.values <- dv
+		}
+	}
+}
+
+// Run notifies monitors of events from a subscription until the channel is
+// closed. The subscription should cover all topics that change twins, such
+// as "#".
+func (a *AddressSpace) Run(events <-chan messaging_sim.Message) {
+	for msg := range events {
+		a.HandleEvent(msg)
+	}
+}
@@ -0,0 +1,171 @@
+package opcua
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func newAddressSpace() (*AddressSpace, *twin.DigitalTwin) {
+	reg := registry.NewRegistry()
+	dt := twin.NewDigitalTwin("pump-1", "pump")
+	dt.SetAttribute("manufacturer", "Acme")
+	dt.SetAttribute("location", map[string]interface{}{"floor": 2})
+	motor := twin.NewFeatureState()
+	motor.SetPropertyAt("speed", 1450.0, time.Date(2026, 5, 1, 8, 0, 0, 0, time.UTC))
+	motor.SetProperty("running", true)
+	motor.SetProperty("harmonics", []interface{}{1.0, 0.5})
+	dt.AddFeature("motor", motor)
+	reg.Create(dt)
+	reg.Create(twin.NewDigitalTwin("tank-1", "tank"))
+	return NewAddressSpace(reg, Options{}), dt
+}
+
+// names returns the browse names of references
+func names(refs []Reference) []string {
+	result := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		result = append(result, ref.Target.BrowseName)
+	}
+	return result
+}
+
+func TestBrowse(t *testing.T) {
+	a, _ := newAddressSpace()
+
+	refs, err := a.Browse(ObjectsFolder)
+	if err != nil || len(refs) != 1 || refs[0].Target.ID != a.TwinsFolder() || refs[0].Type != Organizes {
+		t.Fatalf("Expected the Objects folder to organize the Twins folder, got %+v (%v)", refs, err)
+	}
+
+	refs, _ = a.Browse(a.TwinsFolder())
+	if !reflect.DeepEqual(names(refs), []string{"pump-1", "tank-1"}) || refs[0].Target.Description != "pump" {
+		t.Errorf("Unexpected twins %+v", refs)
+	}
+
+	refs, _ = a.Browse(a.TwinNode("pump-1"))
+	if !reflect.DeepEqual(names(refs), []string{"location", "manufacturer", "motor"}) {
+		t.Fatalf("Unexpected twin references %+v", refs)
+	}
+	if refs[0].Type != HasProperty || refs[0].Target.TypeDefinition != PropertyType || refs[2].Type != HasComponent {
+		t.Errorf("Expected attributes as properties and features as components, got %+v", refs)
+	}
+
+	refs, _ = a.Browse(a.FeatureNode("pump-1", "motor"))
+	if !reflect.DeepEqual(names(refs), []string{"harmonics", "running", "speed"}) {
+		t.Fatalf("Unexpected feature references %+v", refs)
+	}
+	if speed := refs[2].Target; speed.Class != NodeClassVariable || speed.DataType != DoubleType || speed.ValueRank != -1 {
+		t.Errorf("Unexpected speed variable %+v", speed)
+	}
+	if harmonics := refs[0].Target; harmonics.DataType != DoubleType || harmonics.ValueRank != 1 {
+		t.Errorf("Expected an array of doubles, got %+v", harmonics)
+	}
+
+	for _, id := range []NodeID{
+		a.TwinNode("missing"),
+		a.FeatureNode("pump-1", "missing"),
+		{Namespace: 3, Name: "twins"},
+		{Namespace: a.Namespace(), Name: "twins/pump-1/other"},
+	} {
+		if _, err := a.Browse(id); err != ErrNodeNotFound {
+			t.Errorf("Expected ErrNodeNotFound for %s, got %v", id, err)
+		}
+	}
+}
+
+func TestRead(t *testing.T) {
+	a, dt := newAddressSpace()
+
+	dv, err := a.Read(a.PropertyNode("pump-1", "motor", "speed"))
+	if err != nil || dv.Value != 1450.0 || dv.Status != StatusGood || !dv.SourceTimestamp.Equal(time.Date(2026, 5, 1, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected speed %+v (%v)", dv, err)
+	}
+
+	dv, _ = a.Read(a.AttributeNode("pump-1", "location"))
+	if dv.Value != `{"floor":2}` {
+		t.Errorf("Expected objects as JSON strings, got %+v", dv)
+	}
+	if node, _ := a.Node(a.AttributeNode("pump-1", "location")); node.DataType != StringType {
+		t.Errorf("Expected a string data type, got %+v", node)
+	}
+
+	motor, _ := dt.GetFeature("motor")
+	motor.SetPropertyStale("speed", true)
+	if dv, _ := a.Read(a.PropertyNode("pump-1", "motor", "speed")); dv.Status != StatusUncertainLastUsableValue {
+		t.Errorf("Expected stale values to be uncertain, got %+v", dv)
+	}
+
+	if _, err := a.Read(a.TwinNode("pump-1")); err != ErrNotVariable || StatusOf(err) != StatusBadAttributeIDInvalid {
+		t.Errorf("Expected ErrNotVariable for objects, got %v", err)
+	}
+	if _, err := a.Read(a.PropertyNode("pump-1", "motor", "torque")); err != ErrNodeNotFound || StatusOf(err) != StatusBadNodeIDUnknown {
+		t.Errorf("Expected ErrNodeNotFound, got %v", err)
+	}
+}
+
+func TestMonitor(t *testing.T) {
+	a, dt := newAddressSpace()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	values, err := a.Monitor(ctx, a.PropertyNode("pump-1", "motor", "speed"))
+	if err != nil {
+		t.Fatalf("Failed to monitor: %v", err)
+	}
+	if dv := <-values; dv.Value != 1450.0 {
+		t.Errorf("Expected the current value first, got %+v", dv)
+	}
+
+	event := messaging_sim.Message{Topic: "properties.updated", Payload: map[string]interface{}{"twinId": "pump-1"}}
+	motor, _ := dt.GetFeature("motor")
+	motor.SetProperty("speed", 1500.0)
+	a.HandleEvent(event)
+	a.HandleEvent(event) // Unchanged values are not reported again
+	if dv := <-values; dv.Value != 1500.0 {
+		t.Errorf("Expected the new value, got %+v", dv)
+	}
+	select {
+	case dv := <-values:
+		t.Errorf("Expected no value for an unchanged property, got %+v", dv)
+	default:
+	}
+
+	// Clients falling behind receive the latest values
+	for i := 0; i < DefaultQueueSize+5; i++ {
+		motor.SetProperty("speed", float64(i))
+		a.HandleEvent(event)
+	}
+	var last DataValue
+	for i := 0; i < DefaultQueueSize; i++ {
+		last = <-values
+	}
+	if last.Value != float64(DefaultQueueSize+4) {
+		t.Errorf("Expected the latest value, got %+v", last)
+	}
+
+	motor.RemoveProperty("speed")
+	a.HandleEvent(messaging_sim.Message{Topic: "property.deleted", Payload: map[string]string{"twinId": "pump-1"}})
+	if dv := <-values; dv.Status != StatusBadNodeIDUnknown {
+		t.Errorf("Expected a removed property to be reported, got %+v", dv)
+	}
+
+	cancel()
+	select {
+	case _, ok := <-values:
+		if ok {
+			t.Error("Expected the channel to be closed")
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected the channel to be closed")
+	}
+
+	if _, err := a.Monitor(context.Background(), a.TwinNode("pump-1")); err != ErrNotVariable {
+		t.Errorf("Expected ErrNotVariable, got %v", err)
+	}
+}
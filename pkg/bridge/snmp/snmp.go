@@ -0,0 +1,497 @@
+// Package snmp polls network equipment such as switches and UPSes over SNMP
+// and applies the values of mapped OIDs to twin properties, so that devices
+// can be modeled without custom agents. The poller works on clients provided
+// by an SNMP library, so any library can be adapted to the Client interface
+// and a Dialer.
+package snmp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/aleka07/go-digital-twin/pkg/ingest"
+)
+
+// Common errors
+var (
+	ErrInvalidTarget       = errors.New("invalid SNMP target")
+	ErrTargetNotFound      = errors.New("SNMP target not found")
+	ErrTargetAlreadyExists = errors.New("SNMP target already exists")
+	ErrNoValues            = errors.New("no mapped OID returned a value")
+)
+
+// Defaults for target settings left empty
+const (
+	DefaultPort     = 161
+	DefaultInterval = time.Minute
+	DefaultTimeout  = 5 * time.Second
+	MinInterval     = time.Second
+)
+
+// maxOIDsPerRequest bounds the variable bindings of a Get, since agents
+// refuse responses that exceed their maximum message size
+const maxOIDsPerRequest = 32
+
+// Version is an SNMP protocol version
+type Version string
+
+// Supported versions
+const (
+	V2c Version = "2c"
+	V3  Version = "3"
+)
+
+// Security levels of SNMPv3
+const (
+	NoAuthNoPriv = "noAuthNoPriv"
+	AuthNoPriv   = "authNoPriv"
+	AuthPriv     = "authPriv"
+)
+
+// authProtocols and privProtocols are the supported SNMPv3 protocols
+var (
+	authProtocols = []string{"MD5", "SHA", "SHA224", "SHA256", "SHA384", "SHA512"}
+	privProtocols = []string{"DES", "AES", "AES192", "AES256"}
+)
+
+// Auth holds the credentials of a target: the community for SNMPv2c, or
+// the user-based security model parameters for SNMPv3
+type Auth struct {
+	Community      string
+	Username       string
+	SecurityLevel  string // NoAuthNoPriv, AuthNoPriv or AuthPriv
+	AuthProtocol   string // MD5, SHA, SHA224, SHA256, SHA384 or SHA512
+	AuthPassphrase string
+	PrivProtocol   string // DES, AES, AES192 or AES256
+	PrivPassphrase string
+	ContextName    string
+}
+
+// Mapping maps an OID to a twin property
+type Mapping struct {
+	OID      string // Numeric, such as 1.3.6.1.2.1.1.3.0
+	Feature  string
+	Property string
+	Scale    float64 // Multiplies numeric values, such as 0.01 for TimeTicks in seconds; 1 when zero
+}
+
+// Target is an SNMP agent polled for the properties of a twin
+type Target struct {
+	Name     string
+	TwinID   string
+	Address  string // Host with an optional port, DefaultPort when missing
+	Version  Version
+	Auth     Auth
+	Interval time.Duration // DefaultInterval when zero
+	Timeout  time.Duration // DefaultTimeout when zero
+	Mappings []Mapping
+}
+
+// Variable is a variable binding returned by an agent
+type Variable struct {
+	OID   string
+	Value interface{} // Integer, float, string or []byte; nil for noSuchObject and noSuchInstance
+}
+
+// Client gets variables from an agent
+type Client interface {
+	Get(ctx context.Context, oids []string) ([]Variable, error)
+	Close() error
+}
+
+// Dialer connects to the agent of a target
+type Dialer func(ctx context.Context, target Target) (Client, error)
+
+// Status reports the polls of a target
+type Status struct {
+	Name      string    `json:"name"`
+	TwinID    string    `json:"twinId"`
+	Polls     int       `json:"polls"`
+	Failures  int       `json:"failures"`
+	LastPoll  time.Time `json:"lastPoll,omitempty"`
+	NextPoll  time.Time `json:"nextPoll,omitempty"`
+	Missing   []string  `json:"missing,omitempty"` // OIDs without a value in the last poll
+	LastError string    `json:"lastError,omitempty"`
+}
+
+// Poller polls targets on their intervals and applies the values to twins
+type Poller struct {
+	ingester *ingest.Ingester
+	dial     Dialer
+	targets  map[string]*target
+	wake     chan struct{}
+	mutex    sync.Mutex
+}
+
+// target is a registered target with its connection and status
+type target struct {
+	Target
+	client  Client
+	status  Status
+	polling bool
+	poll    sync.Mutex // Serializes polls of the target
+}
+
+// NewPoller creates a poller connecting to agents with a dialer
+func NewPoller(ingester *ingest.Ingester, dial Dialer) *Poller {
+	return &Poller{
+		ingester: ingester,
+		dial:     dial,
+		targets:  make(map[string]*target),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Add registers a target, to be polled immediately when the poller runs
+func (p *Poller) Add(t Target) error {
+	if err := normalize(&t); err != nil {
+		return err
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if _, exists := p.targets[t.Name]; exists {
+		return ErrTargetAlreadyExists
+	}
+	p.targets[t.Name] = &target{Target: t, status: Status{Name: t.Name, TwinID: t.TwinID, NextPoll: time.Now()}}
+
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Remove unregisters a target and closes its connection
+func (p *Poller) Remove(name string) error {
+	p.mutex.Lock()
+	t, exists := p.targets[name]
+	delete(p.targets, name)
+	p.mutex.Unlock()
+
+	if !exists {
+		return ErrTargetNotFound
+	}
+
+	t.poll.Lock()
+	defer t.poll.Unlock()
+	if t.client != nil {
+		t.client.Close()
+		t.client = nil
+	}
+	return nil
+}
+
+// Targets returns the status of the targets ordered by name
+func (p *Poller) Targets() []Status {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	result := make([]Status, 0, len(p.targets))
+	for _, t := range p.targets {
+		result = append(result, t.status)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// normalize validates a target and fills in defaults
+func normalize(t *Target) error {
+	if t.Name == "" || t.TwinID == "" || t.Address == "" {
+		return fmt.Errorf("%w: name, twin ID and address are required", ErrInvalidTarget)
+	}
+	if _, _, err := net.SplitHostPort(t.Address); err != nil {
+		t.Address = net.JoinHostPort(strings.Trim(t.Address, "[]"), strconv.Itoa(DefaultPort))
+	}
+	if t.Interval == 0 {
+		t.Interval = DefaultInterval
+	}
+	if t.Interval < MinInterval {
+		return fmt.Errorf("%w: interval must be at least %s", ErrInvalidTarget, MinInterval)
+	}
+	if t.Timeout == 0 {
+		t.Timeout = DefaultTimeout
+	}
+	if t.Timeout < 0 {
+		return fmt.Errorf("%w: timeout must not be negative", ErrInvalidTarget)
+	}
+
+	if err := validateAuth(t.Version, t.Auth); err != nil {
+		return err
+	}
+
+	if len(t.Mappings) == 0 {
+		return fmt.Errorf("%w: at least one mapping is required", ErrInvalidTarget)
+	}
+	mappings := make([]Mapping, len(t.Mappings))
+	seen := make(map[string]bool, len(t.Mappings))
+	for i, m := range t.Mappings {
+		m.OID = strings.TrimPrefix(m.OID, ".")
+		if !validOID(m.OID) {
+			return fmt.Errorf("%w: invalid OID %q", ErrInvalidTarget, m.OID)
+		}
+		if m.Feature == "" || m.Property == "" {
+			return fmt.Errorf("%w: mapping of %s needs a feature and property", ErrInvalidTarget, m.OID)
+		}
+		key := m.Feature + "/" + m.Property
+		if seen[key] {
+			return fmt.Errorf("%w: %s is mapped twice", ErrInvalidTarget, key)
+		}
+		seen[key] = true
+		if m.Scale == 0 {
+			m.Scale = 1
+		}
+		mappings[i] = m
+	}
+	t.Mappings = mappings
+	return nil
+}
+
+// validateAuth checks the credentials of a version
+func validateAuth(version Version, auth Auth) error {
+	switch version {
+	case V2c:
+		if auth.Community == "" {
+			return fmt.Errorf("%w: SNMPv2c requires a community", ErrInvalidTarget)
+		}
+		return nil
+	case V3:
+	default:
+		return fmt.Errorf("%w: unsupported version %q", ErrInvalidTarget, version)
+	}
+
+	if auth.Username == "" {
+		return fmt.Errorf("%w: SNMPv3 requires a username", ErrInvalidTarget)
+	}
+	switch auth.SecurityLevel {
+	case NoAuthNoPriv:
+		return nil
+	case AuthNoPriv, AuthPriv:
+	default:
+		return fmt.Errorf("%w: invalid security level %q", ErrInvalidTarget, auth.SecurityLevel)
+	}
+
+	// USM passphrases have at least 8 characters
+	if !contains(authProtocols, auth.AuthProtocol) {
+		return fmt.Errorf("%w: invalid authentication protocol %q", ErrInvalidTarget, auth.AuthProtocol)
+	}
+	if len(auth.AuthPassphrase) < 8 {
+		return fmt.Errorf("%w: authentication passphrase must have at least 8 characters", ErrInvalidTarget)
+	}
+	if auth.SecurityLevel == AuthPriv {
+		if !contains(privProtocols, auth.PrivProtocol) {
+			return fmt.Errorf("%w: invalid privacy protocol %q", ErrInvalidTarget, auth.PrivProtocol)
+		}
+		if len(auth.PrivPassphrase) < 8 {
+			return fmt.Errorf("%w: privacy passphrase must have at least 8 characters", ErrInvalidTarget)
+		}
+	}
+	return nil
+}
+
+// contains reports whether a list holds a value
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// validOID reports whether an OID is a dotted sequence of at least two numbers
+func validOID(oid string) bool {
+	parts := strings.Split(oid, ".")
+	if len(parts) < 2 {
+		return false
+	}
+	for _, part := range parts {
+		if _, err := strconv.ParseUint(part, 10, 32); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Run polls the targets when they are due until the context is cancelled.
+// Targets are polled concurrently; a target whose poll is still running
+// when it is due again skips that poll.
+func (p *Poller) Run(ctx context.Context) {
+	for {
+		now := time.Now()
+		next := now.Add(DefaultInterval)
+
+		p.mutex.Lock()
+		for _, t := range p.targets {
+			if !t.polling && !t.status.NextPoll.After(now) {
+				t.polling = true
+				t.status.NextPoll = now.Add(t.Interval)
+				go func(t *target) {
+					p.poll(ctx, t)
+					p.mutex.Lock()
+					t.polling = false
+					p.mutex.Unlock()
+				}(t)
+			}
+			if t.status.NextPoll.Before(next) {
+				next = t.status.NextPoll
+			}
+		}
+		p.mutex.Unlock()
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-p.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// Poll polls a target once and applies the values to its twin
+func (p *Poller) Poll(ctx context.Context, name string) (*ingest.Result, error) {
+	p.mutex.Lock()
+	t, exists := p.targets[name]
+	p.mutex.Unlock()
+	if !exists {
+		return nil, ErrTargetNotFound
+	}
+	return p.poll(ctx, t)
+}
+
+// poll gets the mapped OIDs of a target, applies their values and records
+// the outcome. Connections are kept between polls and dropped on errors.
+func (p *Poller) poll(ctx context.Context, t *target) (*ingest.Result, error) {
+	t.poll.Lock()
+	defer t.poll.Unlock()
+
+	now := time.Now()
+	result, missing, err := p.get(ctx, t, now)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	t.status.Polls++
+	t.status.LastPoll = now
+	t.status.Missing = missing
+	t.status.LastError = ""
+	if err != nil {
+		t.status.Failures++
+		t.status.LastError = err.Error()
+	}
+	return result, err
+}
+
+// get reads the mapped OIDs of a target and applies them as telemetry
+func (p *Poller) get(ctx context.Context, t *target, now time.Time) (*ingest.Result, []string, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.Timeout)
+	defer cancel()
+
+	if t.client == nil {
+		client, err := p.dial(ctx, t.Target)
+		if err != nil {
+			return nil, nil, fmt.Errorf("connecting to %s: %w", t.Address, err)
+		}
+		t.client = client
+	}
+
+	values := make(map[string]interface{}, len(t.Mappings))
+	for start := 0; start < len(t.Mappings); start += maxOIDsPerRequest {
+		end := start + maxOIDsPerRequest
+		if end > len(t.Mappings) {
+			end = len(t.Mappings)
+		}
+		oids := make([]string, 0, end-start)
+		for _, m := range t.Mappings[start:end] {
+			oids = append(oids, m.OID)
+		}
+
+		vars, err := t.client.Get(ctx, oids)
+		if err != nil {
+			t.client.Close()
+			t.client = nil
+			return nil, nil, fmt.Errorf("polling %s: %w", t.Address, err)
+		}
+		for _, v := range vars {
+			if v.Value != nil {
+				values[strings.TrimPrefix(v.OID, ".")] = v.Value
+			}
+		}
+	}
+
+	telemetry := ingest.Telemetry{
+		TwinID:    t.TwinID,
+		Timestamp: now,
+		Features:  make(map[string]map[string]interface{}),
+	}
+	var missing []string
+	for _, m := range t.Mappings {
+		raw, ok := values[m.OID]
+		if !ok {
+			missing = append(missing, m.OID)
+			continue
+		}
+		if telemetry.Features[m.Feature] == nil {
+			telemetry.Features[m.Feature] = make(map[string]interface{})
+		}
+		telemetry.Features[m.Feature][m.Property] = convert(raw, m.Scale)
+	}
+	if len(telemetry.Features) == 0 {
+		return nil, missing, ErrNoValues
+	}
+
+	result, err := p.ingester.Apply(telemetry)
+	return result, missing, err
+}
+
+// convert turns an SNMP value into a property value. Numbers are scaled
+// floats, printable octet strings strings and other octet strings
+// colon-separated hex, as for MAC addresses.
+func convert(value interface{}, scale float64) interface{} {
+	var n float64
+	switch v := value.(type) {
+	case int:
+		n = float64(v)
+	case int32:
+		n = float64(v)
+	case int64:
+		n = float64(v)
+	case uint:
+		n = float64(v)
+	case uint32:
+		n = float64(v)
+	case uint64:
+		n = float64(v)
+	case float32:
+		n = float64(v)
+	case float64:
+		n = v
+	case string:
+		return v
+	case []byte:
+		if utf8.Valid(v) && strings.IndexFunc(string(v), func(r rune) bool { return !unicode.IsPrint(r) }) < 0 {
+			return string(v)
+		}
+		hex := make([]string, len(v))
+		for i, b := range v {
+			hex[i] = fmt.Sprintf("%02x", b)
+		}
+		return strings.Join(hex, ":")
+	default:
+		return fmt.Sprint(v)
+	}
+	return n * scale
+}
@@ -0,0 +1,236 @@
+package snmp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/history"
+	"github.com/aleka07/go-digital-twin/pkg/ingest"
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// agent is a test agent serving fixed values
+type agent struct {
+	values  map[string]interface{}
+	err     error
+	dials   int
+	gets    int
+	maxOIDs int
+	closed  int
+	mutex   sync.Mutex
+}
+
+func (a *agent) dial(ctx context.Context, target Target) (Client, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.dials++
+	return a, nil
+}
+
+func (a *agent) Get(ctx context.Context, oids []string) ([]Variable, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.err != nil {
+		return nil, a.err
+	}
+	a.gets++
+	if len(oids) > a.maxOIDs {
+		a.maxOIDs = len(oids)
+	}
+	vars := make([]Variable, 0, len(oids))
+	for _, oid := range oids {
+		vars = append(vars, Variable{OID: "." + oid, Value: a.values[oid]})
+	}
+	return vars, nil
+}
+
+func (a *agent) Close() error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.closed++
+	return nil
+}
+
+func newPoller(a *agent) (*Poller, *registry.Registry) {
+	reg := registry.NewRegistry()
+	reg.Create(twin.NewDigitalTwin("ups-1", "ups"))
+	pubsub := messaging_sim.NewPubSub()
+	return NewPoller(ingest.NewIngester(reg, pubsub, history.NewStore(10)), a.dial), reg
+}
+
+// upsTarget polls the battery and identity of a UPS
+var upsTarget = Target{
+	Name:    "ups-1",
+	TwinID:  "ups-1",
+	Address: "10.0.0.5",
+	Version: V2c,
+	Auth:    Auth{Community: "public"},
+	Mappings: []Mapping{
+		{OID: "1.3.6.1.2.1.33.1.2.4.0", Feature: "battery", Property: "charge"},
+		{OID: ".1.3.6.1.2.1.33.1.2.3.0", Feature: "battery", Property: "runtime", Scale: 60},
+		{OID: "1.3.6.1.2.1.1.3.0", Feature: "system", Property: "uptime", Scale: 0.01},
+		{OID: "1.3.6.1.2.1.1.5.0", Feature: "system", Property: "name"},
+		{OID: "1.3.6.1.2.1.2.2.1.6.1", Feature: "system", Property: "mac"},
+		{OID: "1.3.6.1.2.1.33.1.1.1.0", Feature: "system", Property: "manufacturer"},
+	},
+}
+
+func TestAdd(t *testing.T) {
+	p, _ := newPoller(&agent{})
+	if err := p.Add(upsTarget); err != nil {
+		t.Fatalf("Failed to add target: %v", err)
+	}
+	if err := p.Add(upsTarget); err != ErrTargetAlreadyExists {
+		t.Errorf("Expected ErrTargetAlreadyExists, got %v", err)
+	}
+
+	p.mutex.Lock()
+	added := p.targets["ups-1"]
+	p.mutex.Unlock()
+	if added.Address != "10.0.0.5:161" || added.Interval != DefaultInterval || added.Mappings[1].OID != "1.3.6.1.2.1.33.1.2.3.0" || added.Mappings[0].Scale != 1 {
+		t.Errorf("Expected defaults to be filled in, got %+v", added.Target)
+	}
+
+	v3 := upsTarget
+	v3.Name = "v3"
+	v3.Version = V3
+	v3.Auth = Auth{Username: "monitor", SecurityLevel: AuthPriv, AuthProtocol: "SHA256", AuthPassphrase: "authsecret", PrivProtocol: "AES", PrivPassphrase: "privsecret"}
+	if err := p.Add(v3); err != nil {
+		t.Errorf("Failed to add SNMPv3 target: %v", err)
+	}
+
+	invalid := map[string]func(*Target){
+		"no twin":        func(t *Target) { t.TwinID = "" },
+		"no community":   func(t *Target) { t.Auth.Community = "" },
+		"version 1":      func(t *Target) { t.Version = "1" },
+		"short interval": func(t *Target) { t.Interval = time.Millisecond },
+		"no mappings":    func(t *Target) { t.Mappings = nil },
+		"invalid OID":    func(t *Target) { t.Mappings = []Mapping{{OID: "1.3.x", Feature: "f", Property: "p"}} },
+		"no property":    func(t *Target) { t.Mappings = []Mapping{{OID: "1.3.6", Feature: "f"}} },
+		"duplicate":      func(t *Target) { t.Mappings = append(t.Mappings, t.Mappings[0]) },
+		"no user":        func(t *Target) { t.Version = V3; t.Auth = Auth{SecurityLevel: NoAuthNoPriv} },
+		"invalid level":  func(t *Target) { t.Version = V3; t.Auth = Auth{Username: "u", SecurityLevel: "none"} },
+		"short auth": func(t *Target) {
+			t.Version = V3
+			t.Auth = Auth{Username: "u", SecurityLevel: AuthNoPriv, AuthProtocol: "SHA", AuthPassphrase: "short"}
+		},
+		"invalid privacy": func(t *Target) { t.Version = V3; t.Auth = v3.Auth; t.Auth.PrivProtocol = "3DES" },
+	}
+	for name, change := range invalid {
+		target := upsTarget
+		target.Name = name
+		target.Mappings = append([]Mapping(nil), upsTarget.Mappings...)
+		change(&target)
+		if err := p.Add(target); !errors.Is(err, ErrInvalidTarget) {
+			t.Errorf("Expected ErrInvalidTarget for %s, got %v", name, err)
+		}
+	}
+}
+
+func TestPoll(t *testing.T) {
+	a := &agent{values: map[string]interface{}{
+		"1.3.6.1.2.1.33.1.2.4.0": 97,
+		"1.3.6.1.2.1.33.1.2.3.0": uint32(42),
+		"1.3.6.1.2.1.1.3.0":      uint32(123456),
+		"1.3.6.1.2.1.1.5.0":      []byte("ups-lab"),
+		"1.3.6.1.2.1.2.2.1.6.1":  []byte{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e},
+	}}
+	p, reg := newPoller(a)
+	p.Add(upsTarget)
+
+	result, err := p.Poll(context.Background(), "ups-1")
+	if err != nil || result.Applied != 5 {
+		t.Fatalf("Unexpected poll %+v (%v)", result, err)
+	}
+
+	dt, _ := reg.Get("ups-1")
+	battery, _ := dt.GetFeature("battery")
+	if !reflect.DeepEqual(battery.GetAllProperties(), map[string]interface{}{"charge": 97.0, "runtime": 2520.0}) {
+		t.Errorf("Unexpected battery %v", battery.GetAllProperties())
+	}
+	system, _ := dt.GetFeature("system")
+	expected := map[string]interface{}{"uptime": 1234.56, "name": "ups-lab", "mac": "00:1a:2b:3c:4d:5e"}
+	if !reflect.DeepEqual(system.GetAllProperties(), expected) {
+		t.Errorf("Expected %v, got %v", expected, system.GetAllProperties())
+	}
+
+	status := p.Targets()[0]
+	if status.Polls != 1 || status.Failures != 0 || !reflect.DeepEqual(status.Missing, []string{"1.3.6.1.2.1.33.1.1.1.0"}) {
+		t.Errorf("Unexpected status %+v", status)
+	}
+
+	// Failed requests drop the connection, which is redialed on the next poll
+	a.err = errors.New("timeout")
+	if _, err := p.Poll(context.Background(), "ups-1"); err == nil {
+		t.Error("Expected the poll to fail")
+	}
+	a.err = nil
+	p.Poll(context.Background(), "ups-1")
+	if a.dials != 2 || a.closed != 1 {
+		t.Errorf("Expected a new connection after a failure, got %d dials and %d closes", a.dials, a.closed)
+	}
+	if status := p.Targets()[0]; status.Polls != 3 || status.Failures != 1 || status.LastError != "" {
+		t.Errorf("Unexpected status %+v", status)
+	}
+
+	if _, err := p.Poll(context.Background(), "missing"); err != ErrTargetNotFound {
+		t.Errorf("Expected ErrTargetNotFound, got %v", err)
+	}
+	if err := p.Remove("ups-1"); err != nil || a.closed != 2 {
+		t.Errorf("Expected the connection to be closed on removal, got %v", err)
+	}
+}
+
+func TestPollBatches(t *testing.T) {
+	a := &agent{values: map[string]interface{}{}}
+	p, _ := newPoller(a)
+
+	target := upsTarget
+	target.Mappings = nil
+	for i := 1; i <= 70; i++ {
+		oid := fmt.Sprintf("1.3.6.1.2.1.2.2.1.10.%d", i)
+		a.values[oid] = uint64(i)
+		target.Mappings = append(target.Mappings, Mapping{OID: oid, Feature: "ports", Property: fmt.Sprintf("in%d", i)})
+	}
+	p.Add(target)
+
+	if result, err := p.Poll(context.Background(), "ups-1"); err != nil || result.Applied != 70 {
+		t.Fatalf("Unexpected poll %+v (%v)", result, err)
+	}
+	if a.gets != 3 || a.maxOIDs != maxOIDsPerRequest {
+		t.Errorf("Expected 3 requests of at most %d OIDs, got %d of up to %d", maxOIDsPerRequest, a.gets, a.maxOIDs)
+	}
+
+	a.values = map[string]interface{}{}
+	if _, err := p.Poll(context.Background(), "ups-1"); err != ErrNoValues {
+		t.Errorf("Expected ErrNoValues, got %v", err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	a := &agent{values: map[string]interface{}{"1.3.6.1.2.1.33.1.2.4.0": 97}}
+	p, _ := newPoller(a)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.Run(ctx)
+
+	// Targets added while running are polled immediately
+	p.Add(upsTarget)
+	deadline := time.Now().Add(time.Second)
+	for p.Targets()[0].Polls == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the target to be polled")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if status := p.Targets()[0]; status.NextPoll.Sub(status.LastPoll) < DefaultInterval-time.Second {
+		t.Errorf("Expected the next poll after the interval, got %+v", status)
+	}
+}
@@ -0,0 +1,382 @@
+package cdc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+)
+
+// Common errors
+var (
+	ErrInvalidOptions = errors.New("invalid CDC options")
+)
+
+// Defaults for options left empty
+const (
+	DefaultBatchSize     = 100
+	DefaultFlushInterval = time.Second
+	DefaultMinBackoff    = time.Second
+	DefaultMaxBackoff    = time.Minute
+	DefaultMaxPending    = 100000
+)
+
+// DefaultTopics are the topic patterns captured when the options do not set their own
+var DefaultTopics = []string{"twin.#", "attribute.#", "attributes.#", "feature.#", "property.#", "properties.#"}
+
+// sendTimeout bounds a single delivery
+const sendTimeout = 10 * time.Second
+
+// Options configure a CDC exporter
+type Options struct {
+	URL            string            // Endpoint batches are POSTed to
+	Topics         []string          // Topic patterns captured, DefaultTopics when empty
+	Headers        map[string]string // Extra request headers, e.g. Authorization
+	BatchSize      int               // Maximum changes per request
+	FlushInterval  time.Duration     // How often pending changes are sent
+	MinBackoff     time.Duration     // Delay after the first failed delivery
+	MaxBackoff     time.Duration     // Upper bound of the doubling delay between failed deliveries
+	MaxPending     int               // Pending changes kept; the oldest are dropped beyond it
+	CheckpointPath string            // File keeping pending changes across restarts, none when empty
+}
+
+// Change is a twin change captured from the event bus. Sequence numbers
+// increase by one per change and survive restarts with a checkpoint, so
+// receivers can discard changes delivered twice.
+type Change struct {
+	Seq       uint64      `json:"seq"`
+	Topic     string      `json:"topic"`
+	TwinID    string      `json:"twinId,omitempty"`
+	Payload   interface{} `json:"payload"`
+	Timestamp time.Time   `json:"timestamp"`
+}
+
+// Batch is the request body POSTed to the endpoint
+type Batch struct {
+	Changes []Change `json:"changes"`
+}
+
+// Status reports the progress of an exporter
+type Status struct {
+	URL         string     `json:"url"`
+	Pending     int        `json:"pending"`             // Changes captured but not acknowledged
+	Acked       uint64     `json:"acked"`               // Sequence number of the last acknowledged change
+	Exported    int        `json:"exported"`            // Changes acknowledged since startup
+	Failures    int        `json:"failures"`            // Failed deliveries since startup
+	Dropped     int        `json:"dropped"`             // Changes dropped because too many were pending
+	LastError   string     `json:"lastError,omitempty"` // Error of the last failed delivery
+	LastSuccess *time.Time `json:"lastSuccess,omitempty"`
+	RetryAt     *time.Time `json:"retryAt,omitempty"` // Set while backing off after a failure
+}
+
+// checkpoint is the file format of the checkpoint
+type checkpoint struct {
+	Acked   uint64   `json:"acked"`
+	NextSeq uint64   `json:"nextSeq"`
+	Pending []Change `json:"pending"`
+}
+
+// Exporter captures twin changes from the event bus and POSTs them in
+// batches to an HTTP endpoint. Changes are removed only after the endpoint
+// acknowledged them with a 2xx status, so every change is delivered at least
+// once; failed deliveries are retried with exponential backoff.
+type Exporter struct {
+	opts    Options
+	client  *http.Client
+	pending []Change
+	nextSeq uint64
+	status  Status
+	backoff time.Duration
+	dirty   bool // Pending changes differ from the checkpoint
+	mutex   sync.Mutex
+	sending sync.Mutex // Serializes deliveries
+	now     func() time.Time
+}
+
+// NewExporter creates an exporter and restores pending changes from its checkpoint
+func NewExporter(opts Options) (*Exporter, error) {
+	u, err := url.Parse(opts.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%w: url must be an http or https URL", ErrInvalidOptions)
+	}
+	if opts.BatchSize < 0 || opts.FlushInterval < 0 || opts.MinBackoff < 0 || opts.MaxBackoff < 0 || opts.MaxPending < 0 {
+		return nil, fmt.Errorf("%w: sizes and durations must not be negative", ErrInvalidOptions)
+	}
+
+	if len(opts.Topics) == 0 {
+		opts.Topics = DefaultTopics
+	}
+	if opts.BatchSize == 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if opts.FlushInterval == 0 {
+		opts.FlushInterval = DefaultFlushInterval
+	}
+	if opts.MinBackoff == 0 {
+		opts.MinBackoff = DefaultMinBackoff
+	}
+	if opts.MaxBackoff == 0 {
+		opts.MaxBackoff = DefaultMaxBackoff
+	}
+	if opts.MaxBackoff < opts.MinBackoff {
+		opts.MaxBackoff = opts.MinBackoff
+	}
+	if opts.MaxPending == 0 {
+		opts.MaxPending = DefaultMaxPending
+	}
+
+	e := &Exporter{
+		opts:    opts,
+		client:  &http.Client{Timeout: sendTimeout},
+		nextSeq: 1,
+		status:  Status{URL: opts.URL},
+		now:     time.Now,
+	}
+
+	if opts.CheckpointPath != "" {
+		data, err := os.ReadFile(opts.CheckpointPath)
+		switch {
+		case os.IsNotExist(err):
+		case err != nil:
+			return nil, err
+		default:
+			var cp checkpoint
+			if err := json.Unmarshal(data, &cp); err != nil {
+				return nil, fmt.Errorf("checkpoint %s: %v", opts.CheckpointPath, err)
+			}
+			e.pending = cp.Pending
+			e.status.Acked = cp.Acked
+			if cp.NextSeq > e.nextSeq {
+				e.nextSeq = cp.NextSeq
+			}
+		}
+	}
+	return e, nil
+}
+
+// Options returns the options of the exporter with defaults applied
+func (e *Exporter) Options() Options {
+	return e.opts
+}
+
+// HandleEvent captures an event when its topic matches one of the topic patterns
+func (e *Exporter) HandleEvent(msg messaging_sim.Message) {
+	captured := false
+	for _, pattern := range e.opts.Topics {
+		if messaging_sim.TopicMatches(pattern, msg.Topic) {
+			captured = true
+			break
+		}
+	}
+	if !captured {
+		return
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.pending = append(e.pending, Change{
+		Seq:       e.nextSeq,
+		Topic:     msg.Topic,
+		TwinID:    msg.TwinID(),
+		Payload:   msg.Payload,
+		Timestamp: e.now(),
+	})
+	e.nextSeq++
+	e.dirty = true
+
+	if over := len(e.pending) - e.opts.MaxPending; over > 0 {
+		e.pending = append([]Change(nil), e.pending[over:]...)
+		e.status.Dropped += over
+	}
+}
+
+// Run captures events from a subscription until the channel is closed
+func (e *Exporter) Run(events <-chan messaging_sim.Message) {
+	for msg := range events {
+		e.HandleEvent(msg)
+	}
+}
+
+// Deliver sends pending changes every flush interval until the context is
+// cancelled, waiting out the backoff after failed deliveries. Full batches
+// are sent back to back. The checkpoint is saved after every delivery.
+func (e *Exporter) Deliver(ctx context.Context) {
+	ticker := time.NewTicker(e.opts.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for e.due() {
+				sent, err := e.Flush(ctx)
+				if err != nil || sent < e.opts.BatchSize {
+					break
+				}
+			}
+			e.Checkpoint()
+		}
+	}
+}
+
+// due reports whether changes are pending and no backoff is in effect
+func (e *Exporter) due() bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if len(e.pending) == 0 {
+		return false
+	}
+	return e.status.RetryAt == nil || !e.now().Before(*e.status.RetryAt)
+}
+
+// Flush sends the oldest pending changes, up to a batch, regardless of any
+// backoff, and returns the number of changes acknowledged
+func (e *Exporter) Flush(ctx context.Context) (int, error) {
+	e.sending.Lock()
+	defer e.sending.Unlock()
+
+	e.mutex.Lock()
+	n := len(e.pending)
+	if n > e.opts.BatchSize {
+		n = e.opts.BatchSize
+	}
+	batch := append([]Change(nil), e.pending[:n]...)
+	e.mutex.Unlock()
+	if n == 0 {
+		return 0, nil
+	}
+
+	err := e.send(ctx, batch)
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if err != nil {
+		e.status.Failures++
+		e.status.LastError = err.Error()
+		if e.backoff == 0 {
+			e.backoff = e.opts.MinBackoff
+		} else if e.backoff *= 2; e.backoff > e.opts.MaxBackoff {
+			e.backoff = e.opts.MaxBackoff
+		}
+		retryAt := e.now().Add(e.backoff)
+		e.status.RetryAt = &retryAt
+		return 0, err
+	}
+
+	// Changes dropped for exceeding MaxPending during the request are not removed twice
+	last := batch[len(batch)-1].Seq
+	i := 0
+	for i < len(e.pending) && e.pending[i].Seq <= last {
+		i++
+	}
+	e.pending = e.pending[i:]
+	e.dirty = true
+
+	now := e.now()
+	e.status.Acked = last
+	e.status.Exported += n
+	e.status.LastSuccess = &now
+	e.status.RetryAt = nil
+	e.backoff = 0
+	return n, nil
+}
+
+// send POSTs a batch to the endpoint
+func (e *Exporter) send(ctx context.Context, changes []Change) error {
+	body, err := json.Marshal(Batch{Changes: changes})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.opts.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.opts.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// Checkpoint writes the pending changes and sequence numbers to the
+// checkpoint file when they changed since the last checkpoint. The file is
+// replaced atomically.
+func (e *Exporter) Checkpoint() error {
+	if e.opts.CheckpointPath == "" {
+		return nil
+	}
+
+	e.mutex.Lock()
+	if !e.dirty {
+		e.mutex.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(checkpoint{Acked: e.status.Acked, NextSeq: e.nextSeq, Pending: e.pending})
+	e.dirty = false
+	e.mutex.Unlock()
+
+	if err == nil {
+		err = writeFile(e.opts.CheckpointPath, data)
+	}
+	if err != nil {
+		e.mutex.Lock()
+		e.dirty = true
+		e.mutex.Unlock()
+	}
+	return err
+}
+
+// writeFile replaces a file atomically
+func writeFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".cdc-checkpoint-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Status returns the progress of the exporter
+func (e *Exporter) Status() Status {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	s := e.status
+	s.Pending = len(e.pending)
+	return s
+}
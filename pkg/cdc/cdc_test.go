@@ -0,0 +1,157 @@
+package cdc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+)
+
+// endpoint is a test receiver that fails while down is set
+type endpoint struct {
+	mutex   sync.Mutex
+	down    bool
+	batches []Batch
+}
+
+func (e *endpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.down {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	var b Batch
+	json.NewDecoder(r.Body).Decode(&b)
+	e.batches = append(e.batches, b)
+}
+
+func updated(twinID string) messaging_sim.Message {
+	return messaging_sim.Message{Topic: "property.updated", Payload: map[string]interface{}{"twinId": twinID, "featureId": "status", "propertyKey": "on", "value": true}}
+}
+
+func TestNewExporter(t *testing.T) {
+	invalid := []Options{
+		{},
+		{URL: "ftp://example.com"},
+		{URL: "http://example.com", BatchSize: -1},
+	}
+	for _, opts := range invalid {
+		if _, err := NewExporter(opts); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("Expected ErrInvalidOptions for %+v, got %v", opts, err)
+		}
+	}
+
+	e, err := NewExporter(Options{URL: "http://example.com/changes", MinBackoff: time.Minute, MaxBackoff: time.Second})
+	if err != nil {
+		t.Fatalf("Failed to create exporter: %v", err)
+	}
+	if opts := e.Options(); opts.BatchSize != DefaultBatchSize || len(opts.Topics) != len(DefaultTopics) || opts.MaxBackoff != time.Minute {
+		t.Errorf("Expected defaults, got %+v", opts)
+	}
+}
+
+func TestFlush(t *testing.T) {
+	receiver := &endpoint{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	e, _ := NewExporter(Options{URL: server.URL, BatchSize: 2, MaxPending: 3})
+	e.HandleEvent(updated("pump-1"))
+	e.HandleEvent(messaging_sim.Message{Topic: "rule.triggered", Payload: map[string]interface{}{"twinId": "pump-1"}})
+	e.HandleEvent(messaging_sim.Message{Topic: "twin.created", Payload: map[string]string{"id": "pump-2"}})
+	e.HandleEvent(updated("pump-2"))
+
+	if n, err := e.Flush(context.Background()); n != 2 || err != nil {
+		t.Fatalf("Expected 2 changes to be sent, got %d (%v)", n, err)
+	}
+	if len(receiver.batches) != 1 {
+		t.Fatalf("Expected 1 batch, got %d", len(receiver.batches))
+	}
+	changes := receiver.batches[0].Changes
+	if changes[0].Seq != 1 || changes[1].Topic != "twin.created" || changes[1].TwinID != "pump-2" {
+		t.Errorf("Unexpected changes %+v", changes)
+	}
+
+	status := e.Status()
+	if status.Pending != 1 || status.Acked != 2 || status.Exported != 2 || status.LastSuccess == nil {
+		t.Errorf("Unexpected status %+v", status)
+	}
+
+	// Pending changes beyond MaxPending are dropped, oldest first
+	for i := 0; i < 3; i++ {
+		e.HandleEvent(updated("pump-3"))
+	}
+	if status := e.Status(); status.Pending != 3 || status.Dropped != 1 {
+		t.Errorf("Expected the oldest change to be dropped, got %+v", status)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	receiver := &endpoint{down: true}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	now := time.Now()
+	e, _ := NewExporter(Options{URL: server.URL, MinBackoff: time.Second, MaxBackoff: 3 * time.Second})
+	e.now = func() time.Time { return now }
+	e.HandleEvent(updated("pump-1"))
+
+	for _, want := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second} {
+		if _, err := e.Flush(context.Background()); err == nil {
+			t.Fatal("Expected the delivery to fail")
+		}
+		if status := e.Status(); status.RetryAt == nil || !status.RetryAt.Equal(now.Add(want)) {
+			t.Errorf("Expected a retry after %v, got %+v", want, status)
+		}
+	}
+	if e.due() {
+		t.Error("Expected no delivery during the backoff")
+	}
+
+	// The same change is delivered once the endpoint recovers
+	receiver.down = false
+	e.now = func() time.Time { return now.Add(3 * time.Second) }
+	if !e.due() {
+		t.Fatal("Expected a delivery after the backoff")
+	}
+	e.Flush(context.Background())
+	if status := e.Status(); status.Failures != 3 || status.Pending != 0 || status.RetryAt != nil || status.LastError == "" {
+		t.Errorf("Unexpected status %+v", status)
+	}
+	if len(receiver.batches) != 1 || receiver.batches[0].Changes[0].Seq != 1 {
+		t.Errorf("Expected the change to be delivered, got %+v", receiver.batches)
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cdc.json")
+
+	e, _ := NewExporter(Options{URL: "http://127.0.0.1:1/changes", CheckpointPath: path})
+	e.HandleEvent(updated("pump-1"))
+	e.HandleEvent(updated("pump-2"))
+	if err := e.Checkpoint(); err != nil {
+		t.Fatalf("Failed to write checkpoint: %v", err)
+	}
+
+	// Pending changes and sequence numbers survive a restart
+	restarted, err := NewExporter(Options{URL: "http://127.0.0.1:1/changes", CheckpointPath: path})
+	if err != nil {
+		t.Fatalf("Failed to restore checkpoint: %v", err)
+	}
+	restarted.HandleEvent(updated("pump-3"))
+	if status := restarted.Status(); status.Pending != 3 {
+		t.Errorf("Expected 3 pending changes, got %+v", status)
+	}
+	if seq := restarted.pending[2].Seq; seq != 3 {
+		t.Errorf("Expected sequence numbers to continue, got %d", seq)
+	}
+}
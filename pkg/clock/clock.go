@@ -0,0 +1,164 @@
+// Package clock abstracts reading the time and waiting for it, so that
+// modification times, history timestamps, expiry and schedules can be
+// tested with a clock the test moves forward itself.
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time and creates tickers
+type Clock interface {
+	Now() time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker delivers ticks at intervals, like time.Ticker
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// System is the wall clock
+var System Clock = systemClock{}
+
+// systemClock reads the time from the time package
+type systemClock struct{}
+
+// Now returns the current time
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// NewTicker returns a time.Ticker
+func (systemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+// systemTicker adapts time.Ticker to Ticker
+type systemTicker struct {
+	*time.Ticker
+}
+
+// C returns the channel of the ticks
+func (t systemTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+// OrSystem returns c, or the system clock when c is nil
+func OrSystem(c Clock) Clock {
+	if c == nil {
+		return System
+	}
+	return c
+}
+
+// Fake is a clock that only moves when told to. Its tickers fire as
+// Advance or Set pass their next tick, dropping ticks that are not received
+// like time.Ticker does.
+type Fake struct {
+	now     time.Time
+	tickers []*fakeTicker
+	mutex   sync.Mutex
+}
+
+// NewFake creates a fake clock set to a time
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+// Now returns the time of the clock
+func (f *Fake) Now() time.Time {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.now
+}
+
+// Advance moves the clock forward and fires the tickers that are due
+func (f *Fake) Advance(d time.Duration) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.set(f.now.Add(d))
+}
+
+// Set moves the clock to a time and fires the tickers that are due. The
+// clock may be set back, which fires no ticker.
+func (f *Fake) Set(now time.Time) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.set(now)
+}
+
+// set moves the clock; the caller holds the mutex
+func (f *Fake) set(now time.Time) {
+	f.now = now
+
+	for _, t := range f.tickers {
+		if t.next.After(now) {
+			continue
+		}
+		select {
+		case t.ch <- t.next:
+		default:
+		}
+		// Skip the ticks that were passed, as a slow receiver of a
+		// time.Ticker would
+		for !t.next.After(now) {
+			t.next = t.next.Add(t.interval)
+		}
+	}
+}
+
+// NewTicker creates a ticker firing every d of clock time
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	t := &fakeTicker{clock: f, ch: make(chan time.Time, 1), interval: d, next: f.now.Add(d)}
+	f.tickers = append(f.tickers, t)
+	return t
+}
+
+// Tickers returns the number of running tickers, so that tests can wait
+// for a schedule to start before advancing the clock
+func (f *Fake) Tickers() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return len(f.tickers)
+}
+
+// fakeTicker is a ticker of a fake clock
+type fakeTicker struct {
+	clock    *Fake
+	ch       chan time.Time
+	interval time.Duration
+	next     time.Time
+}
+
+// C returns the channel of the ticks
+func (t *fakeTicker) C() <-chan time.Time {
+	return t.ch
+}
+
+// Stop stops the ticker
+func (t *fakeTicker) Stop() {
+	f := t.clock
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for i, other := range f.tickers {
+		if other == t {
+			f.tickers = append(f.tickers[:i], f.tickers[i+1:]...)
+			return
+		}
+	}
+}
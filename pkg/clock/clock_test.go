@@ -0,0 +1,83 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFake(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := NewFake(start)
+	if !f.Now().Equal(start) {
+		t.Errorf("Expected %v, got %v", start, f.Now())
+	}
+
+	ticker := f.NewTicker(time.Minute)
+	if f.Tickers() != 1 {
+		t.Errorf("Expected 1 ticker, got %d", f.Tickers())
+	}
+
+	f.Advance(30 * time.Second)
+	select {
+	case tick := <-ticker.C():
+		t.Errorf("Unexpected tick at %v", tick)
+	default:
+	}
+
+	f.Advance(30 * time.Second)
+	select {
+	case tick := <-ticker.C():
+		if !tick.Equal(start.Add(time.Minute)) {
+			t.Errorf("Expected a tick at one minute, got %v", tick)
+		}
+	default:
+		t.Error("Expected a tick")
+	}
+
+	// Passed ticks are dropped while one is pending
+	f.Advance(5 * time.Minute)
+	<-ticker.C()
+	select {
+	case tick := <-ticker.C():
+		t.Errorf("Unexpected second tick at %v", tick)
+	default:
+	}
+	f.Advance(time.Minute)
+	select {
+	case <-ticker.C():
+	default:
+		t.Error("Expected a tick after the skipped ones")
+	}
+
+	// Setting the clock back fires nothing
+	f.Set(start)
+	if !f.Now().Equal(start) {
+		t.Errorf("Expected the clock to be set back, got %v", f.Now())
+	}
+	select {
+	case tick := <-ticker.C():
+		t.Errorf("Unexpected tick at %v", tick)
+	default:
+	}
+
+	ticker.Stop()
+	if f.Tickers() != 0 {
+		t.Errorf("Expected no tickers, got %d", f.Tickers())
+	}
+}
+
+func TestSystem(t *testing.T) {
+	if OrSystem(nil) != System {
+		t.Error("Expected the system clock for nil")
+	}
+	if now := System.Now(); time.Since(now) > time.Second {
+		t.Errorf("Unexpected system time %v", now)
+	}
+	ticker := System.NewTicker(time.Millisecond)
+	defer ticker.Stop()
+	select {
+	case <-ticker.C():
+	case <-time.After(time.Second):
+		t.Error("Expected a tick")
+	}
+}
@@ -0,0 +1,678 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/access"
+	"github.com/aleka07/go-digital-twin/pkg/attachment"
+	"github.com/aleka07/go-digital-twin/pkg/auth"
+	"github.com/aleka07/go-digital-twin/pkg/backup"
+	"github.com/aleka07/go-digital-twin/pkg/cdc"
+	"github.com/aleka07/go-digital-twin/pkg/edge"
+	"github.com/aleka07/go-digital-twin/pkg/federation"
+	"github.com/aleka07/go-digital-twin/pkg/objstore"
+	"github.com/aleka07/go-digital-twin/pkg/offline"
+	"github.com/aleka07/go-digital-twin/pkg/oidc"
+	"github.com/aleka07/go-digital-twin/pkg/query"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/secret"
+	"github.com/aleka07/go-digital-twin/pkg/valuesize"
+)
+
+// ErrInvalidConfig is returned for configuration files that cannot be used
+var ErrInvalidConfig = errors.New("invalid configuration")
+
+// Duration is a time.Duration written as a string such as "15m" in configuration files
+type Duration time.Duration
+
+// UnmarshalJSON parses a duration string
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"15m\"")
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalJSON formats a duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Config is the server configuration file
+type Config struct {
+	Backup        *BackupConfig        `json:"backup,omitempty"`
+	ParquetExport *ParquetExportConfig `json:"parquetExport,omitempty"`
+	CDC           *CDCConfig           `json:"cdc,omitempty"`
+	Edge          *EdgeConfig          `json:"edge,omitempty"`
+	Federation    *FederationConfig    `json:"federation,omitempty"`
+	Offline       *OfflineConfig       `json:"offline,omitempty"`
+	Memory        *MemoryConfig        `json:"memory,omitempty"`
+	Attachments   *AttachmentsConfig   `json:"attachments,omitempty"`
+	ValueLimits   *ValueLimitsConfig   `json:"valueLimits,omitempty"`
+	AccessLog     *AccessLogConfig     `json:"accessLog,omitempty"`
+	OIDC          *OIDCConfig          `json:"oidc,omitempty"`
+	Secrets       *SecretsConfig       `json:"secrets,omitempty"`
+	Indexes       []IndexConfig        `json:"indexes,omitempty"`
+}
+
+// BackupConfig configures scheduled export to, and restore from, S3-compatible storage
+type BackupConfig struct {
+	S3               objstore.S3Config `json:"s3"`
+	Prefix           string            `json:"prefix,omitempty"`
+	Interval         Duration          `json:"interval,omitempty"`
+	HistoryDelay     Duration          `json:"historyDelay,omitempty"`
+	RestoreOnStartup bool              `json:"restoreOnStartup,omitempty"`
+}
+
+// Options returns the exporter options of the backup configuration
+func (b *BackupConfig) Options() backup.Options {
+	return backup.Options{
+		Prefix:       b.Prefix,
+		Interval:     time.Duration(b.Interval),
+		HistoryDelay: time.Duration(b.HistoryDelay),
+	}
+}
+
+// ParquetExportConfig configures where Parquet history exports are written
+// and, optionally, how often they run
+type ParquetExportConfig struct {
+	Dir      string             `json:"dir,omitempty"` // Local directory
+	S3       *objstore.S3Config `json:"s3,omitempty"`  // S3-compatible bucket
+	Prefix   string             `json:"prefix,omitempty"`
+	Interval Duration           `json:"interval,omitempty"` // Scheduled exports are disabled when zero
+	Delay    Duration           `json:"delay,omitempty"`    // How long to wait for late telemetry
+}
+
+// Store opens the configured export target
+func (p *ParquetExportConfig) Store() (objstore.Store, error) {
+	if p.S3 != nil {
+		return objstore.NewS3(*p.S3)
+	}
+	return objstore.NewDir(p.Dir)
+}
+
+// CDCConfig configures continuous export of twin changes to an HTTP endpoint
+type CDCConfig struct {
+	URL           string            `json:"url"`
+	Topics        []string          `json:"topics,omitempty"`
+	Headers       map[string]string `json:"headers,omitempty"`
+	BatchSize     int               `json:"batchSize,omitempty"`
+	FlushInterval Duration          `json:"flushInterval,omitempty"`
+	MinBackoff    Duration          `json:"minBackoff,omitempty"`
+	MaxBackoff    Duration          `json:"maxBackoff,omitempty"`
+	MaxPending    int               `json:"maxPending,omitempty"`
+	Checkpoint    string            `json:"checkpoint,omitempty"` // Path of the checkpoint file
+}
+
+// Options returns the exporter options of the CDC configuration
+func (c *CDCConfig) Options() cdc.Options {
+	return cdc.Options{
+		URL:            c.URL,
+		Topics:         c.Topics,
+		Headers:        c.Headers,
+		BatchSize:      c.BatchSize,
+		FlushInterval:  time.Duration(c.FlushInterval),
+		MinBackoff:     time.Duration(c.MinBackoff),
+		MaxBackoff:     time.Duration(c.MaxBackoff),
+		MaxPending:     c.MaxPending,
+		CheckpointPath: c.Checkpoint,
+	}
+}
+
+// EdgeConfig runs the server at the edge, pushing local changes to a central server
+type EdgeConfig struct {
+	Central    string            `json:"central"`        // API URL of the central server, e.g. https://central.example.com/api/v1
+	Name       string            `json:"name,omitempty"` // Identifies the edge to the central server
+	Policy     string            `json:"policy,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Interval   Duration          `json:"interval,omitempty"`
+	BatchSize  int               `json:"batchSize,omitempty"`
+	MaxBackoff Duration          `json:"maxBackoff,omitempty"`
+	Checkpoint string            `json:"checkpoint,omitempty"` // Path of the checkpoint file
+}
+
+// Options returns the syncer options of the edge configuration
+func (e *EdgeConfig) Options() edge.Options {
+	return edge.Options{
+		Policy:         edge.Policy(e.Policy),
+		Interval:       time.Duration(e.Interval),
+		BatchSize:      e.BatchSize,
+		MaxBackoff:     time.Duration(e.MaxBackoff),
+		CheckpointPath: e.Checkpoint,
+	}
+}
+
+// Upstream returns the connection to the central server
+func (e *EdgeConfig) Upstream() (*edge.HTTPUpstream, error) {
+	return edge.NewHTTPUpstream(e.Central, e.Name, e.Headers)
+}
+
+// FederationConfig lists the peer servers whose twins are served locally
+type FederationConfig struct {
+	Peers []PeerConfig `json:"peers"`
+}
+
+// PeerConfig configures a peer server
+type PeerConfig struct {
+	Name           string            `json:"name"`
+	URL            string            `json:"url"` // API URL of the peer, e.g. https://site-b.example.com/api/v1
+	Headers        map[string]string `json:"headers,omitempty"`
+	Twins          []string          `json:"twins,omitempty"` // Patterns of twin IDs read through from the peer
+	Mirror         bool              `json:"mirror,omitempty"`
+	Query          string            `json:"query,omitempty"` // Twins mirrored, all when empty
+	DelegateWrites bool              `json:"delegateWrites,omitempty"`
+	TTL            Duration          `json:"ttl,omitempty"`
+}
+
+// Options returns the peer options of the federation configuration
+func (f *FederationConfig) Options() []federation.PeerOptions {
+	peers := make([]federation.PeerOptions, len(f.Peers))
+	for i, p := range f.Peers {
+		peers[i] = federation.PeerOptions{
+			Name:           p.Name,
+			URL:            p.URL,
+			Headers:        p.Headers,
+			Twins:          p.Twins,
+			Mirror:         p.Mirror,
+			Query:          p.Query,
+			DelegateWrites: p.DelegateWrites,
+			TTL:            time.Duration(p.TTL),
+		}
+	}
+	return peers
+}
+
+// OfflineConfig configures the keys offline bundles are signed with and
+// verified against
+type OfflineConfig struct {
+	SigningKey  string   `json:"signingKey,omitempty"`  // PEM file of the Ed25519 private key exported bundles are signed with
+	TrustedKeys []string `json:"trustedKeys,omitempty"` // PEM files of the Ed25519 public keys imported bundles must be signed with
+}
+
+// Keys reads the configured keys
+func (o *OfflineConfig) Keys() (offline.Keys, error) {
+	var keys offline.Keys
+	if o.SigningKey != "" {
+		data, err := os.ReadFile(o.SigningKey)
+		if err != nil {
+			return keys, err
+		}
+		if keys.Signing, err = offline.ParsePrivateKey(data); err != nil {
+			return keys, fmt.Errorf("%s: %w", o.SigningKey, err)
+		}
+	}
+	for _, path := range o.TrustedKeys {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return keys, err
+		}
+		key, err := offline.ParsePublicKey(data)
+		if err != nil {
+			return keys, fmt.Errorf("%s: %w", path, err)
+		}
+		keys.Trusted = append(keys.Trusted, key)
+	}
+	return keys, nil
+}
+
+// MemoryConfig configures the memory budget of the registry and where
+// evicted twins are kept. Without dir or s3, creates beyond the budget fail.
+type MemoryConfig struct {
+	MaxBytes int64              `json:"maxBytes,omitempty"`
+	MaxTwins int                `json:"maxTwins,omitempty"`
+	MinIdle  Duration           `json:"minIdle,omitempty"` // Twins used more recently are never evicted
+	Dir      string             `json:"dir,omitempty"`     // Local directory for evicted twins
+	S3       *objstore.S3Config `json:"s3,omitempty"`      // S3-compatible bucket for evicted twins
+	Prefix   string             `json:"prefix,omitempty"`
+	LazyLoad bool               `json:"lazyLoad,omitempty"` // Checkpoint twins on shutdown and load them on first access after startup
+}
+
+// IndexConfig configures an index created on startup
+type IndexConfig struct {
+	Path     string `json:"path"`
+	Critical bool   `json:"critical,omitempty"` // The server is not ready until the index covers the stored twins
+}
+
+// Budget returns the registry budget of the memory configuration
+func (m *MemoryConfig) Budget() registry.Budget {
+	return registry.Budget{
+		MaxBytes: m.MaxBytes,
+		MaxTwins: m.MaxTwins,
+		MinIdle:  time.Duration(m.MinIdle),
+	}
+}
+
+// Store opens the configured store for evicted twins, nil if there is none
+func (m *MemoryConfig) Store() (registry.Store, error) {
+	store, err := m.ObjectStore()
+	if err != nil || store == nil {
+		return nil, err
+	}
+	return registry.NewObjectStore(store, m.Prefix), nil
+}
+
+// ObjectStore opens the bucket or directory evicted twins are written to,
+// nil if there is none
+func (m *MemoryConfig) ObjectStore() (objstore.Store, error) {
+	var store objstore.Store
+	var err error
+	switch {
+	case m.S3 != nil:
+		store, err = objstore.NewS3(*m.S3)
+	case m.Dir != "":
+		store, err = objstore.NewDir(m.Dir)
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// AttachmentsConfig configures where twin attachments are stored and which
+// are accepted. Without dir or s3, attachments are kept in memory.
+type AttachmentsConfig struct {
+	Dir          string             `json:"dir,omitempty"` // Local directory
+	S3           *objstore.S3Config `json:"s3,omitempty"`  // S3-compatible bucket
+	Prefix       string             `json:"prefix,omitempty"`
+	MaxSize      int64              `json:"maxSize,omitempty"`      // Bytes, attachment.DefaultMaxSize when zero
+	AllowedTypes []string           `json:"allowedTypes,omitempty"` // Media types or patterns such as "image/*"
+}
+
+// Options returns the attachment options of the configuration
+func (a *AttachmentsConfig) Options() attachment.Options {
+	return attachment.Options{
+		Prefix:       a.Prefix,
+		MaxSize:      a.MaxSize,
+		AllowedTypes: a.AllowedTypes,
+	}
+}
+
+// Store opens the configured attachment storage
+func (a *AttachmentsConfig) Store() (objstore.Store, error) {
+	switch {
+	case a.S3 != nil:
+		return objstore.NewS3(*a.S3)
+	case a.Dir != "":
+		return objstore.NewDir(a.Dir)
+	default:
+		return objstore.NewMemoryStore(), nil
+	}
+}
+
+// ValueLimitsConfig configures the size limits of property values. Limits
+// of properties are keyed by "featureID/propertyKey".
+type ValueLimitsConfig struct {
+	Default    *valuesize.Limit           `json:"default,omitempty"`
+	Properties map[string]valuesize.Limit `json:"properties,omitempty"`
+}
+
+// Apply sets the limits of the configuration
+func (v *ValueLimitsConfig) Apply(m *valuesize.Manager) error {
+	if v.Default != nil {
+		if _, err := m.SetDefault(*v.Default); err != nil {
+			return err
+		}
+	}
+	for key, limit := range v.Properties {
+		featureID, propKey, _ := strings.Cut(key, "/")
+		if _, err := m.Set(featureID, propKey, limit); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// AccessLogConfig configures the twins whose reads are logged and the file
+// logged reads are appended to as lines of JSON
+type AccessLogConfig struct {
+	File     string          `json:"file,omitempty"`
+	Policies []access.Policy `json:"policies,omitempty"`
+}
+
+// Apply sets the policies of the configuration
+func (a *AccessLogConfig) Apply(m *access.Manager) error {
+	for _, p := range a.Policies {
+		if _, err := m.Set(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OIDCConfig configures sign-in with an OpenID Connect identity provider.
+// Without a redirect URL only API tokens are accepted, without dashboard
+// login.
+type OIDCConfig struct {
+	Issuer       string            `json:"issuer"`
+	ClientID     string            `json:"clientId"`
+	ClientSecret string            `json:"clientSecret,omitempty"`
+	RedirectURL  string            `json:"redirectUrl,omitempty"` // Such as https://dt.example.com/auth/callback
+	Scopes       []string          `json:"scopes,omitempty"`
+	Audience     string            `json:"audience,omitempty"`    // Of API tokens, the client ID when empty
+	UserClaim    string            `json:"userClaim,omitempty"`   // oidc.DefaultUserClaim when empty
+	GroupsClaim  string            `json:"groupsClaim,omitempty"` // oidc.DefaultGroupsClaim when empty
+	Roles        map[string]string `json:"roles,omitempty"`       // Group -> viewer, editor or admin
+	DefaultRole  string            `json:"defaultRole,omitempty"` // Of users in no mapped group
+}
+
+// Options returns the provider options of the configuration
+func (o *OIDCConfig) Options() oidc.Options {
+	roles := make(map[string]auth.Role, len(o.Roles))
+	for group, role := range o.Roles {
+		roles[group] = auth.Role(role)
+	}
+	return oidc.Options{
+		Issuer:       o.Issuer,
+		ClientID:     o.ClientID,
+		ClientSecret: o.ClientSecret,
+		RedirectURL:  o.RedirectURL,
+		Scopes:       o.Scopes,
+		Audience:     o.Audience,
+		UserClaim:    o.UserClaim,
+		GroupsClaim:  o.GroupsClaim,
+		Roles:        roles,
+		DefaultRole:  auth.Role(o.DefaultRole),
+	}
+}
+
+// SecretsConfig configures where secret references in credentials are
+// resolved from, besides environment variables and files
+type SecretsConfig struct {
+	Vault *VaultConfig `json:"vault,omitempty"`
+}
+
+// VaultConfig configures a HashiCorp Vault server secrets are read from
+type VaultConfig struct {
+	Address   string `json:"address"`             // Such as https://vault.example.com:8200
+	Token     string `json:"token,omitempty"`     // VAULT_TOKEN when empty; may reference an env or file secret
+	Namespace string `json:"namespace,omitempty"` // Vault Enterprise namespace
+}
+
+// Apply registers the resolvers of the configuration
+func (s *SecretsConfig) Apply(ctx context.Context, m *secret.Manager) error {
+	if v := s.Vault; v != nil {
+		token := v.Token
+		if token == "" {
+			token = os.Getenv("VAULT_TOKEN")
+		}
+		token, err := m.Resolve(ctx, token)
+		if err != nil {
+			return fmt.Errorf("vault token: %w", err)
+		}
+		vault, err := secret.NewVault(secret.VaultOptions{Address: v.Address, Token: token, Namespace: v.Namespace})
+		if err != nil {
+			return err
+		}
+		m.Register(secret.SchemeVault, vault)
+	}
+	return nil
+}
+
+// ResolveSecrets replaces secret references such as ${env:S3_SECRET} in the
+// credentials of the configuration: the keys of S3 buckets, the OIDC client
+// secret and the request headers of CDC, edge and federation endpoints. It
+// returns how many values held references.
+func (c *Config) ResolveSecrets(ctx context.Context, m *secret.Manager) (int, error) {
+	var values []*string
+	var headers []map[string]string
+	addS3 := func(s3 *objstore.S3Config) {
+		if s3 != nil {
+			values = append(values, &s3.AccessKeyID, &s3.SecretAccessKey)
+		}
+	}
+
+	if b := c.Backup; b != nil {
+		addS3(&b.S3)
+	}
+	if p := c.ParquetExport; p != nil {
+		addS3(p.S3)
+	}
+	if mem := c.Memory; mem != nil {
+		addS3(mem.S3)
+	}
+	if a := c.Attachments; a != nil {
+		addS3(a.S3)
+	}
+	if o := c.OIDC; o != nil {
+		values = append(values, &o.ClientSecret)
+	}
+	if cdc := c.CDC; cdc != nil {
+		headers = append(headers, cdc.Headers)
+	}
+	if e := c.Edge; e != nil {
+		headers = append(headers, e.Headers)
+	}
+	if f := c.Federation; f != nil {
+		for _, p := range f.Peers {
+			headers = append(headers, p.Headers)
+		}
+	}
+
+	resolved := 0
+	resolve := func(value *string) error {
+		if !secret.IsReference(*value) {
+			return nil
+		}
+		s, err := m.Resolve(ctx, *value)
+		if err != nil {
+			return err
+		}
+		*value = s
+		resolved++
+		return nil
+	}
+	for _, v := range values {
+		if err := resolve(v); err != nil {
+			return resolved, err
+		}
+	}
+	for _, h := range headers {
+		for k, v := range h {
+			if err := resolve(&v); err != nil {
+				return resolved, fmt.Errorf("header %s: %w", k, err)
+			}
+			h[k] = v
+		}
+	}
+	return resolved, nil
+}
+
+// Load reads a JSON configuration file. Unknown fields are rejected so that
+// typos do not silently disable settings.
+func Load(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var config Config
+	decoder := json.NewDecoder(f)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidConfig, path, err)
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &config, nil
+}
+
+// Validate checks the configuration for missing or conflicting settings
+func (c *Config) Validate() error {
+	if b := c.Backup; b != nil {
+		if b.S3.Bucket == "" {
+			return fmt.Errorf("%w: backup.s3.bucket is required", ErrInvalidConfig)
+		}
+		if b.Interval < 0 || b.HistoryDelay < 0 {
+			return fmt.Errorf("%w: backup durations must not be negative", ErrInvalidConfig)
+		}
+	}
+
+	if p := c.ParquetExport; p != nil {
+		if (p.Dir == "") == (p.S3 == nil) {
+			return fmt.Errorf("%w: parquetExport needs either dir or s3", ErrInvalidConfig)
+		}
+		if p.S3 != nil && p.S3.Bucket == "" {
+			return fmt.Errorf("%w: parquetExport.s3.bucket is required", ErrInvalidConfig)
+		}
+		if p.Interval < 0 || p.Delay < 0 {
+			return fmt.Errorf("%w: parquetExport durations must not be negative", ErrInvalidConfig)
+		}
+	}
+
+	if c := c.CDC; c != nil {
+		if c.URL == "" {
+			return fmt.Errorf("%w: cdc.url is required", ErrInvalidConfig)
+		}
+		if c.BatchSize < 0 || c.MaxPending < 0 || c.FlushInterval < 0 || c.MinBackoff < 0 || c.MaxBackoff < 0 {
+			return fmt.Errorf("%w: cdc sizes and durations must not be negative", ErrInvalidConfig)
+		}
+	}
+
+	if e := c.Edge; e != nil {
+		if e.Central == "" {
+			return fmt.Errorf("%w: edge.central is required", ErrInvalidConfig)
+		}
+		if e.Policy != "" {
+			if _, err := edge.ParsePolicy(e.Policy); err != nil {
+				return fmt.Errorf("%w: edge.policy: %v", ErrInvalidConfig, err)
+			}
+		}
+		if e.BatchSize < 0 || e.Interval < 0 || e.MaxBackoff < 0 {
+			return fmt.Errorf("%w: edge sizes and durations must not be negative", ErrInvalidConfig)
+		}
+	}
+
+	if f := c.Federation; f != nil {
+		if len(f.Peers) == 0 {
+			return fmt.Errorf("%w: federation needs peers", ErrInvalidConfig)
+		}
+		names := make(map[string]bool)
+		for _, p := range f.Peers {
+			if p.Name == "" || p.URL == "" {
+				return fmt.Errorf("%w: federation peers need a name and url", ErrInvalidConfig)
+			}
+			if names[p.Name] {
+				return fmt.Errorf("%w: federation peer %s is listed twice", ErrInvalidConfig, p.Name)
+			}
+			names[p.Name] = true
+			if len(p.Twins) == 0 && !p.Mirror {
+				return fmt.Errorf("%w: federation peer %s needs twins or mirror", ErrInvalidConfig, p.Name)
+			}
+			if p.TTL < 0 {
+				return fmt.Errorf("%w: federation peer %s: ttl must not be negative", ErrInvalidConfig, p.Name)
+			}
+		}
+	}
+
+	if o := c.Offline; o != nil {
+		if o.SigningKey == "" && len(o.TrustedKeys) == 0 {
+			return fmt.Errorf("%w: offline needs a signingKey or trustedKeys", ErrInvalidConfig)
+		}
+	}
+
+	if m := c.Memory; m != nil {
+		if m.MaxBytes <= 0 && m.MaxTwins <= 0 {
+			return fmt.Errorf("%w: memory needs maxBytes or maxTwins", ErrInvalidConfig)
+		}
+		if m.MaxBytes < 0 || m.MaxTwins < 0 || m.MinIdle < 0 {
+			return fmt.Errorf("%w: memory limits must not be negative", ErrInvalidConfig)
+		}
+		if m.Dir != "" && m.S3 != nil {
+			return fmt.Errorf("%w: memory needs either dir or s3", ErrInvalidConfig)
+		}
+		if m.S3 != nil && m.S3.Bucket == "" {
+			return fmt.Errorf("%w: memory.s3.bucket is required", ErrInvalidConfig)
+		}
+		if m.LazyLoad && m.Dir == "" && m.S3 == nil {
+			return fmt.Errorf("%w: memory.lazyLoad needs dir or s3", ErrInvalidConfig)
+		}
+	}
+
+	paths := make(map[string]bool)
+	for _, x := range c.Indexes {
+		if err := query.ValidatePath(x.Path); err != nil {
+			return fmt.Errorf("%w: indexes: %v", ErrInvalidConfig, err)
+		}
+		if paths[x.Path] {
+			return fmt.Errorf("%w: index %s is listed twice", ErrInvalidConfig, x.Path)
+		}
+		paths[x.Path] = true
+	}
+
+	if a := c.Attachments; a != nil {
+		if a.Dir != "" && a.S3 != nil {
+			return fmt.Errorf("%w: attachments needs either dir or s3", ErrInvalidConfig)
+		}
+		if a.S3 != nil && a.S3.Bucket == "" {
+			return fmt.Errorf("%w: attachments.s3.bucket is required", ErrInvalidConfig)
+		}
+		if a.MaxSize < 0 {
+			return fmt.Errorf("%w: attachments.maxSize must not be negative", ErrInvalidConfig)
+		}
+		for _, t := range a.AllowedTypes {
+			if !strings.Contains(t, "/") {
+				return fmt.Errorf("%w: attachments.allowedTypes: %q is not a media type", ErrInvalidConfig, t)
+			}
+		}
+	}
+
+	if a := c.AccessLog; a != nil {
+		if a.File == "" && len(a.Policies) == 0 {
+			return fmt.Errorf("%w: accessLog needs a file or policies", ErrInvalidConfig)
+		}
+		if err := a.Apply(access.NewManager()); err != nil {
+			return fmt.Errorf("%w: accessLog: %v", ErrInvalidConfig, err)
+		}
+	}
+
+	if o := c.OIDC; o != nil {
+		if o.Issuer == "" || o.ClientID == "" {
+			return fmt.Errorf("%w: oidc needs an issuer and clientId", ErrInvalidConfig)
+		}
+		if u, err := url.Parse(o.RedirectURL); o.RedirectURL != "" && (err != nil || !u.IsAbs()) {
+			return fmt.Errorf("%w: oidc.redirectUrl must be an absolute URL", ErrInvalidConfig)
+		}
+		for group, role := range o.Roles {
+			if _, err := auth.ParseRole(role); err != nil {
+				return fmt.Errorf("%w: oidc.roles: %s: %v", ErrInvalidConfig, group, err)
+			}
+		}
+		if o.DefaultRole != "" {
+			if _, err := auth.ParseRole(o.DefaultRole); err != nil {
+				return fmt.Errorf("%w: oidc.defaultRole: %v", ErrInvalidConfig, err)
+			}
+		}
+	}
+
+	if s := c.Secrets; s != nil && s.Vault != nil {
+		if u, err := url.Parse(s.Vault.Address); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%w: secrets.vault.address must be an absolute http or https URL", ErrInvalidConfig)
+		}
+	}
+
+	if v := c.ValueLimits; v != nil {
+		if err := v.Apply(valuesize.NewManager(nil)); err != nil {
+			return fmt.Errorf("%w: valueLimits: %v", ErrInvalidConfig, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,352 @@
+package config
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/access"
+	"github.com/aleka07/go-digital-twin/pkg/auth"
+	"github.com/aleka07/go-digital-twin/pkg/edge"
+	"github.com/aleka07/go-digital-twin/pkg/secret"
+	"github.com/aleka07/go-digital-twin/pkg/valuesize"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	path := writeConfig(t, `{
+		"backup": {
+			"s3": {"endpoint": "http://minio:9000", "bucket": "twins", "pathStyle": true},
+			"prefix": "prod/",
+			"interval": "15m",
+			"restoreOnStartup": true
+		}
+	}`)
+
+	config, err := Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	b := config.Backup
+	if b == nil || b.S3.Bucket != "twins" || !b.S3.PathStyle || !b.RestoreOnStartup {
+		t.Fatalf("Unexpected backup config: %+v", b)
+	}
+
+	options := b.Options()
+	if options.Prefix != "prod/" || options.Interval != 15*time.Minute || options.HistoryDelay != 0 {
+		t.Errorf("Unexpected options: %+v", options)
+	}
+}
+
+func TestLoadParquetExport(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "parquet")
+	path := writeConfig(t, `{"parquetExport": {"dir": "`+dir+`", "interval": "1h"}}`)
+
+	config, err := Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	p := config.ParquetExport
+	if p == nil || time.Duration(p.Interval) != time.Hour {
+		t.Fatalf("Unexpected parquet export config: %+v", p)
+	}
+
+	if _, err := p.Store(); err != nil {
+		t.Errorf("Failed to open store: %v", err)
+	}
+	if _, err := os.Stat(dir); err != nil {
+		t.Errorf("Expected export directory to be created: %v", err)
+	}
+}
+
+func TestLoadCDC(t *testing.T) {
+	path := writeConfig(t, `{"cdc": {"url": "http://sink/changes", "batchSize": 50, "maxBackoff": "30s", "checkpoint": "/var/lib/dt/cdc.json"}}`)
+
+	config, err := Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	options := config.CDC.Options()
+	if options.URL != "http://sink/changes" || options.BatchSize != 50 || options.MaxBackoff != 30*time.Second || options.CheckpointPath != "/var/lib/dt/cdc.json" {
+		t.Errorf("Unexpected options: %+v", options)
+	}
+}
+
+func TestLoadEdge(t *testing.T) {
+	path := writeConfig(t, `{"edge": {"central": "https://central/api/v1", "name": "plant-7", "policy": "merge", "interval": "10s"}}`)
+
+	config, err := Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	options := config.Edge.Options()
+	if options.Policy != edge.Merge || options.Interval != 10*time.Second || options.BatchSize != 0 {
+		t.Errorf("Unexpected options: %+v", options)
+	}
+	if _, err := config.Edge.Upstream(); err != nil {
+		t.Errorf("Failed to create upstream: %v", err)
+	}
+}
+
+func TestLoadFederation(t *testing.T) {
+	path := writeConfig(t, `{"federation": {"peers": [
+		{"name": "site-b", "url": "https://site-b/api/v1", "mirror": true, "query": "type == pump"},
+		{"name": "site-c", "url": "https://site-c/api/v1", "twins": ["c-*"], "delegateWrites": true, "ttl": "1m"}
+	]}}`)
+
+	config, err := Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	peers := config.Federation.Options()
+	if len(peers) != 2 || !peers[0].Mirror || peers[0].Query != "type == pump" || !peers[1].DelegateWrites || peers[1].TTL != time.Minute {
+		t.Errorf("Unexpected peers: %+v", peers)
+	}
+}
+
+func TestLoadOffline(t *testing.T) {
+	dir := t.TempDir()
+	public, private, _ := ed25519.GenerateKey(nil)
+	der, _ := x509.MarshalPKCS8PrivateKey(private)
+	os.WriteFile(filepath.Join(dir, "site.key"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+	der, _ = x509.MarshalPKIXPublicKey(public)
+	os.WriteFile(filepath.Join(dir, "site.pub"), pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0644)
+	path := writeConfig(t, `{"offline": {"signingKey": "`+dir+`/site.key", "trustedKeys": ["`+dir+`/site.pub"]}}`)
+
+	config, err := Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	keys, err := config.Offline.Keys()
+	if err != nil {
+		t.Fatalf("Failed to read keys: %v", err)
+	}
+	if !keys.Signing.Equal(private) || len(keys.Trusted) != 1 || !keys.Trusted[0].Equal(public) {
+		t.Errorf("Unexpected keys: %+v", keys)
+	}
+
+	config.Offline.TrustedKeys = []string{dir + "/site.key"}
+	if _, err := config.Offline.Keys(); err == nil {
+		t.Error("Expected an error for a private key listed as trusted")
+	}
+}
+
+func TestLoadMemory(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfig(t, `{"memory": {"maxBytes": 1048576, "minIdle": "10m", "dir": "`+dir+`"}}`)
+
+	config, err := Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	budget := config.Memory.Budget()
+	if budget.MaxBytes != 1048576 || budget.MaxTwins != 0 || budget.MinIdle != 10*time.Minute {
+		t.Errorf("Unexpected budget: %+v", budget)
+	}
+	if store, err := config.Memory.Store(); err != nil || store == nil {
+		t.Errorf("Expected a store, got %v (%v)", store, err)
+	}
+}
+
+func TestLoadLazyIndexes(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfig(t, `{"memory": {"maxTwins": 100000, "dir": "`+dir+`", "lazyLoad": true},
+		"indexes": [{"path": "attributes.serialNumber", "critical": true}, {"path": "type"}]}`)
+
+	config, err := Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if !config.Memory.LazyLoad || len(config.Indexes) != 2 || !config.Indexes[0].Critical {
+		t.Errorf("Unexpected config: %+v %+v", config.Memory, config.Indexes)
+	}
+
+	for _, body := range []string{
+		`{"memory": {"maxTwins": 10, "lazyLoad": true}}`,
+		`{"indexes": [{"path": "attributes"}]}`,
+		`{"indexes": [{"path": "type"}, {"path": "type"}]}`,
+	} {
+		if _, err := Load(writeConfig(t, body)); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("%s: expected ErrInvalidConfig, got %v", body, err)
+		}
+	}
+}
+
+func TestLoadAttachments(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfig(t, `{"attachments": {"dir": "`+dir+`", "maxSize": 1048576, "allowedTypes": ["image/*", "application/pdf"]}}`)
+
+	config, err := Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	options := config.Attachments.Options()
+	if options.MaxSize != 1048576 || len(options.AllowedTypes) != 2 {
+		t.Errorf("Unexpected options: %+v", options)
+	}
+	if store, err := config.Attachments.Store(); err != nil || store == nil {
+		t.Errorf("Expected a store, got %v (%v)", store, err)
+	}
+}
+
+func TestLoadValueLimits(t *testing.T) {
+	path := writeConfig(t, `{"valueLimits": {"default": {"maxBytes": 65536}, "properties": {"camera/frame": {"maxBytes": 1024, "action": "offload"}}}}`)
+
+	config, err := Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	limits := valuesize.NewManager(nil)
+	if err := config.ValueLimits.Apply(limits); err != nil {
+		t.Fatalf("Failed to apply value limits: %v", err)
+	}
+	if limit := limits.Default(); limit.MaxBytes != 65536 || limit.Action != valuesize.Reject {
+		t.Errorf("Unexpected default limit %+v", limit)
+	}
+	if limit := limits.Limit("camera", "frame"); limit.MaxBytes != 1024 || limit.Action != valuesize.Offload {
+		t.Errorf("Unexpected property limit %+v", limit)
+	}
+}
+
+func TestLoadAccessLog(t *testing.T) {
+	path := writeConfig(t, `{"accessLog": {"file": "access.log", "policies": [{"twinId": "patient-monitor-7"}, {"twinId": "vault-door", "sampleRate": 0.1}]}}`)
+
+	config, err := Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	policies := access.NewManager()
+	if err := config.AccessLog.Apply(policies); err != nil {
+		t.Fatalf("Failed to apply access policies: %v", err)
+	}
+	if p, err := policies.Get("patient-monitor-7"); err != nil || p.SampleRate != 1 {
+		t.Errorf("Unexpected policy %+v %v", p, err)
+	}
+}
+
+func TestLoadOIDC(t *testing.T) {
+	path := writeConfig(t, `{"oidc": {"issuer": "https://login.example.com", "clientId": "dt", "redirectUrl": "https://dt.example.com/auth/callback", "roles": {"plant-operators": "editor"}, "defaultRole": "viewer"}}`)
+
+	config, err := Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	options := config.OIDC.Options()
+	if options.Roles["plant-operators"] != auth.RoleEditor || options.DefaultRole != auth.RoleViewer {
+		t.Errorf("Unexpected options: %+v", options)
+	}
+}
+
+func TestResolveSecrets(t *testing.T) {
+	t.Setenv("DT_TEST_S3_SECRET", "s3-secret")
+	t.Setenv("DT_TEST_VAULT_TOKEN", "root")
+	tokenFile := filepath.Join(t.TempDir(), "cdc-token")
+	os.WriteFile(tokenFile, []byte("cdc-token\n"), 0600)
+
+	path := writeConfig(t, `{
+		"backup": {"s3": {"bucket": "b", "accessKeyId": "AKIA", "secretAccessKey": "${env:DT_TEST_S3_SECRET}"}},
+		"cdc": {"url": "http://sink/changes", "headers": {"Authorization": "Bearer ${file:`+tokenFile+`}", "X-Source": "dt"}},
+		"secrets": {"vault": {"address": "https://vault.example.com:8200", "token": "${env:DT_TEST_VAULT_TOKEN}"}}
+	}`)
+	config, err := Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	secrets := secret.NewManager()
+	if err := config.Secrets.Apply(context.Background(), secrets); err != nil {
+		t.Fatalf("Failed to apply secrets config: %v", err)
+	}
+	if schemes := secrets.Schemes(); len(schemes) != 3 || schemes[2] != secret.SchemeVault {
+		t.Errorf("Expected the vault scheme to be registered, got %v", schemes)
+	}
+
+	n, err := config.ResolveSecrets(context.Background(), secrets)
+	if err != nil || n != 2 {
+		t.Fatalf("Expected 2 resolved values, got %d %v", n, err)
+	}
+	if config.Backup.S3.SecretAccessKey != "s3-secret" || config.Backup.S3.AccessKeyID != "AKIA" {
+		t.Errorf("Unexpected S3 credentials %+v", config.Backup.S3)
+	}
+	if h := config.CDC.Headers; h["Authorization"] != "Bearer cdc-token" || h["X-Source"] != "dt" {
+		t.Errorf("Unexpected CDC headers %v", h)
+	}
+
+	config.OIDC = &OIDCConfig{Issuer: "https://login.example.com", ClientID: "dt", ClientSecret: "${env:DT_TEST_MISSING}"}
+	if _, err := config.ResolveSecrets(context.Background(), secrets); !errors.Is(err, secret.ErrSecretNotFound) {
+		t.Errorf("Expected ErrSecretNotFound, got %v", err)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	invalid := []string{
+		`{"backup": {"s3": {}}}`,
+		`{"backup": {"s3": {"bucket": "b"}, "interval": "often"}}`,
+		`{"backup": {"s3": {"bucket": "b"}, "interval": 60}}`,
+		`{"backup": {"s3": {"bucket": "b"}, "interval": "-1m"}}`,
+		`{"backups": {}}`,
+		`{"parquetExport": {}}`,
+		`{"parquetExport": {"dir": "out", "s3": {"bucket": "b"}}}`,
+		`{"parquetExport": {"s3": {}}}`,
+		`{"cdc": {"batchSize": 10}}`,
+		`{"cdc": {"url": "http://sink/changes", "maxBackoff": "-1s"}}`,
+		`{"edge": {"policy": "merge"}}`,
+		`{"edge": {"central": "https://central/api/v1", "policy": "edge-wins"}}`,
+		`{"edge": {"central": "https://central/api/v1", "interval": "-1s"}}`,
+		`{"federation": {"peers": []}}`,
+		`{"federation": {"peers": [{"name": "b", "mirror": true}]}}`,
+		`{"federation": {"peers": [{"name": "b", "url": "http://b/api/v1"}]}}`,
+		`{"federation": {"peers": [{"name": "b", "url": "http://b/api/v1", "mirror": true}, {"name": "b", "url": "http://c/api/v1", "mirror": true}]}}`,
+		`{"offline": {}}`,
+		`{"memory": {}}`,
+		`{"memory": {"maxTwins": 10, "minIdle": "-1m"}}`,
+		`{"memory": {"maxTwins": 10, "dir": "out", "s3": {"bucket": "b"}}}`,
+		`{"attachments": {"dir": "out", "s3": {"bucket": "b"}}}`,
+		`{"attachments": {"maxSize": -1}}`,
+		`{"attachments": {"allowedTypes": ["pdf"]}}`,
+		`{"valueLimits": {"default": {"maxBytes": 0}}}`,
+		`{"accessLog": {}}`,
+		`{"oidc": {"issuer": "https://login.example.com"}}`,
+		`{"oidc": {"issuer": "https://login.example.com", "clientId": "dt", "redirectUrl": "/auth/callback"}}`,
+		`{"oidc": {"issuer": "https://login.example.com", "clientId": "dt", "roles": {"ops": "root"}}}`,
+		`{"secrets": {"vault": {"address": "vault:8200"}}}`,
+		`{"accessLog": {"policies": [{"twinId": "vault-door", "sampleRate": 2}]}}`,
+		`{"valueLimits": {"properties": {"frame": {"maxBytes": 1024}}}}`,
+		`{"valueLimits": {"properties": {"camera/frame": {"maxBytes": 1024, "action": "truncate"}}}}`,
+	}
+	for _, content := range invalid {
+		if _, err := Load(writeConfig(t, content)); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("Expected ErrInvalidConfig for %s, got %v", content, err)
+		}
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.json")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected not exist error, got %v", err)
+	}
+}
@@ -0,0 +1,242 @@
+package convert
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Common errors
+var (
+	ErrUnknownUnit      = errors.New("unknown unit")
+	ErrIncompatible     = errors.New("incompatible units")
+	ErrInvalidTransform = errors.New("invalid value transform")
+)
+
+// MaxPrecision is the largest number of decimals values can be rounded to
+const MaxPrecision = 10
+
+// unit converts to the base unit of its dimension as base = value*Factor + Offset
+type unit struct {
+	Dimension string
+	Factor    float64
+	Offset    float64
+}
+
+// units lists the supported units by symbol
+var units = map[string]unit{
+	// Temperature, base kelvin
+	"K":    {"temperature", 1, 0},
+	"degC": {"temperature", 1, 273.15},
+	"degF": {"temperature", 5.0 / 9, 273.15 - 32*5.0/9},
+
+	// Length, base metre
+	"mm": {"length", 0.001, 0},
+	"cm": {"length", 0.01, 0},
+	"m":  {"length", 1, 0},
+	"km": {"length", 1000, 0},
+	"in": {"length", 0.0254, 0},
+	"ft": {"length", 0.3048, 0},
+	"mi": {"length", 1609.344, 0},
+
+	// Pressure, base pascal
+	"Pa":  {"pressure", 1, 0},
+	"hPa": {"pressure", 100, 0},
+	"kPa": {"pressure", 1000, 0},
+	"bar": {"pressure", 100000, 0},
+	"psi": {"pressure", 6894.757293168, 0},
+
+	// Power, base watt
+	"W":  {"power", 1, 0},
+	"kW": {"power", 1000, 0},
+	"MW": {"power", 1e6, 0},
+	"hp": {"power", 745.69987158227, 0},
+
+	// Energy, base joule
+	"J":   {"energy", 1, 0},
+	"kJ":  {"energy", 1000, 0},
+	"Wh":  {"energy", 3600, 0},
+	"kWh": {"energy", 3.6e6, 0},
+	"MWh": {"energy", 3.6e9, 0},
+
+	// Speed, base metre per second
+	"m/s":  {"speed", 1, 0},
+	"km/h": {"speed", 1000.0 / 3600, 0},
+	"mph":  {"speed", 1609.344 / 3600, 0},
+	"kn":   {"speed", 1852.0 / 3600, 0},
+
+	// Volume, base cubic metre
+	"L":   {"volume", 0.001, 0},
+	"m3":  {"volume", 1, 0},
+	"gal": {"volume", 0.003785411784, 0},
+
+	// Mass, base kilogram
+	"g":  {"mass", 0.001, 0},
+	"kg": {"mass", 1, 0},
+	"t":  {"mass", 1000, 0},
+	"lb": {"mass", 0.45359237, 0},
+
+	// Ratio, base one
+	"1": {"ratio", 1, 0},
+	"%": {"ratio", 0.01, 0},
+}
+
+// Units returns the symbols of the supported units in order. Temperatures
+// are written degC and degF, but °C, celsius, °F and fahrenheit are accepted.
+func Units() []string {
+	symbols := make([]string, 0, len(units))
+	for symbol := range units {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	return symbols
+}
+
+// Convert converts a value between two units of the same dimension
+func Convert(value float64, from, to string) (float64, error) {
+	f, ok := lookup(from)
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrUnknownUnit, from)
+	}
+	t, ok := lookup(to)
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrUnknownUnit, to)
+	}
+	if f.Dimension != t.Dimension {
+		return 0, fmt.Errorf("%w: %s is %s, %s is %s", ErrIncompatible, from, f.Dimension, to, t.Dimension)
+	}
+
+	base := value*f.Factor + f.Offset
+	return (base - t.Offset) / t.Factor, nil
+}
+
+// Round rounds a value to a number of decimals
+func Round(value float64, precision int) float64 {
+	scale := math.Pow(10, float64(precision))
+	return math.Round(value*scale) / scale
+}
+
+// Transform converts a value before it is delivered to a consumer. Enum
+// mapping is applied first, then unit conversion, then rounding. Unit
+// conversion and rounding leave non-numeric values unchanged.
+type Transform struct {
+	Attribute string                 `json:"attribute"`          // Twin attribute or feature
+	Property  string                 `json:"property,omitempty"` // Property of the feature, if Attribute is a feature
+	From      string                 `json:"from,omitempty"`     // Unit the value is stored in
+	To        string                 `json:"to,omitempty"`       // Unit the value is delivered in
+	Precision *int                   `json:"precision,omitempty"`
+	Enum      map[string]interface{} `json:"enum,omitempty"` // Stored value, as text -> delivered value
+}
+
+// Validate checks a transform
+func (t Transform) Validate() error {
+	if t.Attribute == "" {
+		return fmt.Errorf("%w: attribute is required", ErrInvalidTransform)
+	}
+	if (t.From == "") != (t.To == "") {
+		return fmt.Errorf("%w: from and to units must be given together", ErrInvalidTransform)
+	}
+	if t.From != "" {
+		if _, err := Convert(0, t.From, t.To); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidTransform, err)
+		}
+	}
+	if t.Precision != nil && (*t.Precision < 0 || *t.Precision > MaxPrecision) {
+		return fmt.Errorf("%w: precision must be between 0 and %d", ErrInvalidTransform, MaxPrecision)
+	}
+	if t.From == "" && t.Precision == nil && len(t.Enum) == 0 {
+		return fmt.Errorf("%w: %s has no unit conversion, precision or enum mapping", ErrInvalidTransform, t.path())
+	}
+	return nil
+}
+
+// Apply transforms a value
+func (t Transform) Apply(value interface{}) interface{} {
+	if len(t.Enum) > 0 {
+		if mapped, ok := t.Enum[fmt.Sprint(value)]; ok {
+			value = mapped
+		}
+	}
+
+	number, ok := toFloat(value)
+	if !ok {
+		return value
+	}
+
+	if t.From != "" {
+		converted, err := Convert(number, t.From, t.To)
+		if err != nil {
+			return value
+		}
+		number = converted
+		value = number
+	}
+
+	if t.Precision != nil {
+		value = Round(number, *t.Precision)
+	}
+	return value
+}
+
+// path returns the attribute and property a transform applies to
+func (t Transform) path() string {
+	if t.Property == "" {
+		return t.Attribute
+	}
+	return t.Attribute + "." + t.Property
+}
+
+// ValidateAll checks a list of transforms and rejects duplicates
+func ValidateAll(transforms []Transform) error {
+	seen := make(map[string]bool, len(transforms))
+	for _, t := range transforms {
+		if err := t.Validate(); err != nil {
+			return err
+		}
+		if seen[t.path()] {
+			return fmt.Errorf("%w: %s is transformed twice", ErrInvalidTransform, t.path())
+		}
+		seen[t.path()] = true
+	}
+	return nil
+}
+
+// lookup finds a unit by symbol or by a common spelling such as "°C" or "celsius"
+func lookup(symbol string) (unit, bool) {
+	if u, ok := units[symbol]; ok {
+		return u, true
+	}
+	u, ok := units[aliases[strings.ToLower(symbol)]]
+	return u, ok
+}
+
+// aliases maps other spellings of units to their symbols
+var aliases = map[string]string{
+	"°c": "degC", "celsius": "degC",
+	"°f": "degF", "fahrenheit": "degF",
+	"kelvin":  "K",
+	"percent": "%",
+}
+
+// toFloat returns the numeric value of JSON and Go numbers
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	}
+	return 0, false
+}
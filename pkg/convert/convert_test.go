@@ -0,0 +1,92 @@
+package convert
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		value    float64
+		from, to string
+		want     float64
+	}{
+		{100, "degC", "degF", 212},
+		{32, "°F", "celsius", 0},
+		{0, "degC", "K", 273.15},
+		{1, "bar", "psi", 14.5038},
+		{2.5, "kWh", "J", 9e6},
+		{100, "km/h", "m/s", 27.7778},
+		{45, "%", "1", 0.45},
+	}
+
+	for _, tt := range tests {
+		got, err := Convert(tt.value, tt.from, tt.to)
+		if err != nil {
+			t.Errorf("Failed to convert %v %s to %s: %v", tt.value, tt.from, tt.to, err)
+			continue
+		}
+		if math.Abs(got-tt.want) > 1e-4 {
+			t.Errorf("Expected %v %s to be %v %s, got %v", tt.value, tt.from, tt.want, tt.to, got)
+		}
+	}
+
+	if _, err := Convert(1, "furlong", "m"); !errors.Is(err, ErrUnknownUnit) {
+		t.Errorf("Expected ErrUnknownUnit, got %v", err)
+	}
+	if _, err := Convert(1, "kg", "m"); !errors.Is(err, ErrIncompatible) {
+		t.Errorf("Expected ErrIncompatible, got %v", err)
+	}
+}
+
+func TestTransform(t *testing.T) {
+	one := 1
+	zero := 0
+
+	fahrenheit := Transform{Attribute: "climate", Property: "temperature", From: "degC", To: "degF", Precision: &one}
+	if got := fahrenheit.Apply(21.37); got != 70.5 {
+		t.Errorf("Expected 70.5, got %v", got)
+	}
+	if got := fahrenheit.Apply("n/a"); got != "n/a" {
+		t.Errorf("Expected non-numeric values to be kept, got %v", got)
+	}
+
+	rounded := Transform{Attribute: "level", Precision: &zero}
+	if got := rounded.Apply(41.6); got != 42.0 {
+		t.Errorf("Expected 42, got %v", got)
+	}
+
+	mode := Transform{Attribute: "status", Property: "mode", Enum: map[string]interface{}{"0": "off", "1": "heating", "2": "cooling"}}
+	if got := mode.Apply(1.0); got != "heating" {
+		t.Errorf("Expected heating, got %v", got)
+	}
+	if got := mode.Apply(7.0); got != 7.0 {
+		t.Errorf("Expected unmapped values to be kept, got %v", got)
+	}
+}
+
+func TestValidateAll(t *testing.T) {
+	eleven := 11
+	invalid := [][]Transform{
+		{{From: "degC", To: "degF"}},
+		{{Attribute: "climate", From: "degC"}},
+		{{Attribute: "climate", From: "degC", To: "kg"}},
+		{{Attribute: "climate", Precision: &eleven}},
+		{{Attribute: "climate"}},
+		{{Attribute: "climate", From: "degC", To: "K"}, {Attribute: "climate", From: "degC", To: "degF"}},
+	}
+	for _, transforms := range invalid {
+		if err := ValidateAll(transforms); !errors.Is(err, ErrInvalidTransform) {
+			t.Errorf("Expected ErrInvalidTransform for %+v, got %v", transforms, err)
+		}
+	}
+
+	valid := []Transform{
+		{Attribute: "climate", Property: "temperature", From: "degC", To: "degF"},
+		{Attribute: "climate", Property: "humidity", Enum: map[string]interface{}{"100": "saturated"}},
+	}
+	if err := ValidateAll(valid); err != nil {
+		t.Errorf("Expected valid transforms, got %v", err)
+	}
+}
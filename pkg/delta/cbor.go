@@ -0,0 +1,292 @@
+package delta
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// ErrInvalidCBOR is returned for CBOR data that cannot be decoded
+var ErrInvalidCBOR = errors.New("invalid CBOR")
+
+// CBOR major types
+const (
+	cborUnsigned = 0 << 5
+	cborNegative = 1 << 5
+	cborBytes    = 2 << 5
+	cborText     = 3 << 5
+	cborArray    = 4 << 5
+	cborMap      = 5 << 5
+	cborTag      = 6 << 5
+	cborSimple   = 7 << 5
+)
+
+// maxCBORDepth bounds the nesting of decoded CBOR values
+const maxCBORDepth = 64
+
+// MarshalCBOR encodes a JSON-like value (nil, bool, numbers, strings, and
+// maps and slices of them) as CBOR (RFC 8949). Map keys are sorted, and
+// integral floats are encoded as integers, which keeps encodings compact and
+// deterministic.
+func MarshalCBOR(v interface{}) ([]byte, error) {
+	return appendCBOR(nil, v)
+}
+
+// appendCBOR appends the encoding of a value
+func appendCBOR(b []byte, v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return append(b, cborSimple|22), nil
+	case bool:
+		if v {
+			return append(b, cborSimple|21), nil
+		}
+		return append(b, cborSimple|20), nil
+	case string:
+		return append(appendHead(b, cborText, uint64(len(v))), v...), nil
+	case []byte:
+		return append(appendHead(b, cborBytes, uint64(len(v))), v...), nil
+	case int:
+		return appendInt(b, int64(v)), nil
+	case int64:
+		return appendInt(b, v), nil
+	case uint64:
+		return appendHead(b, cborUnsigned, v), nil
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return appendInt(b, int64(v)), nil
+		}
+		if float64(float32(v)) == v {
+			b = append(b, cborSimple|26)
+			return binary.BigEndian.AppendUint32(b, math.Float32bits(float32(v))), nil
+		}
+		b = append(b, cborSimple|27)
+		return binary.BigEndian.AppendUint64(b, math.Float64bits(v)), nil
+	case []interface{}:
+		b = appendHead(b, cborArray, uint64(len(v)))
+		for _, item := range v {
+			var err error
+			if b, err = appendCBOR(b, item); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		b = appendHead(b, cborMap, uint64(len(v)))
+		for _, key := range keys {
+			b = append(appendHead(b, cborText, uint64(len(key))), key...)
+			var err error
+			if b, err = appendCBOR(b, v[key]); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("cannot encode %T as CBOR", v)
+}
+
+// appendInt appends a signed integer
+func appendInt(b []byte, v int64) []byte {
+	if v < 0 {
+		return appendHead(b, cborNegative, uint64(-1-v))
+	}
+	return appendHead(b, cborUnsigned, uint64(v))
+}
+
+// appendHead appends the head of a data item with its argument in the
+// shortest form
+func appendHead(b []byte, major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return append(b, major|byte(n))
+	case n <= math.MaxUint8:
+		return append(b, major|24, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, major|25), uint16(n))
+	case n <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, major|26), uint32(n))
+	}
+	return binary.BigEndian.AppendUint64(append(b, major|27), n)
+}
+
+// UnmarshalCBOR decodes CBOR into JSON-like values: maps with text keys
+// become map[string]interface{}, arrays []interface{}, and numbers float64,
+// except integers beyond the float64 range, which stay uint64 or int64. Tags
+// are ignored; indefinite lengths are not supported.
+func UnmarshalCBOR(data []byte) (interface{}, error) {
+	d := &cborDecoder{data: data}
+	v, err := d.value(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(data) {
+		return nil, fmt.Errorf("%w: trailing data", ErrInvalidCBOR)
+	}
+	return v, nil
+}
+
+// cborDecoder reads data items from a buffer
+type cborDecoder struct {
+	data []byte
+	pos  int
+}
+
+// head reads the head of a data item
+func (d *cborDecoder) head() (major byte, info byte, n uint64, err error) {
+	if d.pos >= len(d.data) {
+		return 0, 0, 0, fmt.Errorf("%w: unexpected end", ErrInvalidCBOR)
+	}
+	major, info = d.data[d.pos]&0xe0, d.data[d.pos]&0x1f
+	d.pos++
+
+	size := 0
+	switch {
+	case info < 24:
+		return major, info, uint64(info), nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	default:
+		return 0, 0, 0, fmt.Errorf("%w: unsupported additional information %d", ErrInvalidCBOR, info)
+	}
+	if len(d.data)-d.pos < size {
+		return 0, 0, 0, fmt.Errorf("%w: unexpected end", ErrInvalidCBOR)
+	}
+	for _, c := range d.data[d.pos : d.pos+size] {
+		n = n<<8 | uint64(c)
+	}
+	d.pos += size
+	return major, info, n, nil
+}
+
+// bytes reads n bytes
+func (d *cborDecoder) bytes(n uint64) ([]byte, error) {
+	if uint64(len(d.data)-d.pos) < n {
+		return nil, fmt.Errorf("%w: unexpected end", ErrInvalidCBOR)
+	}
+	b := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return b, nil
+}
+
+// value reads a data item
+func (d *cborDecoder) value(depth int) (interface{}, error) {
+	if depth > maxCBORDepth {
+		return nil, fmt.Errorf("%w: nested too deeply", ErrInvalidCBOR)
+	}
+	major, info, n, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case cborUnsigned:
+		if n > 1<<53 {
+			return n, nil
+		}
+		return float64(n), nil
+	case cborNegative:
+		if n >= 1<<53 {
+			if n > math.MaxInt64 {
+				return nil, fmt.Errorf("%w: integer out of range", ErrInvalidCBOR)
+			}
+			return -1 - int64(n), nil
+		}
+		return -1 - float64(n), nil
+	case cborBytes:
+		b, err := d.bytes(n)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), b...), nil
+	case cborText:
+		b, err := d.bytes(n)
+		return string(b), err
+	case cborArray:
+		if n > uint64(len(d.data)) {
+			return nil, fmt.Errorf("%w: unexpected end", ErrInvalidCBOR)
+		}
+		items := make([]interface{}, 0, n)
+		for i := uint64(0); i < n; i++ {
+			item, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case cborMap:
+		if n > uint64(len(d.data)) {
+			return nil, fmt.Errorf("%w: unexpected end", ErrInvalidCBOR)
+		}
+		m := make(map[string]interface{}, n)
+		for i := uint64(0); i < n; i++ {
+			key, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			k, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("%w: map keys must be text", ErrInvalidCBOR)
+			}
+			if m[k], err = d.value(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case cborTag:
+		return d.value(depth + 1)
+	}
+
+	// Simple values and floats
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23:
+		return nil, nil
+	case 25:
+		return halfToFloat(uint16(n)), nil
+	case 26:
+		return float64(math.Float32frombits(uint32(n))), nil
+	case 27:
+		return math.Float64frombits(n), nil
+	}
+	return nil, fmt.Errorf("%w: unsupported simple value %d", ErrInvalidCBOR, n)
+}
+
+// halfToFloat converts an IEEE 754 half-precision float
+func halfToFloat(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 31:
+		if mant == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		return -f
+	}
+	return f
+}
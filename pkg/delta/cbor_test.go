@@ -0,0 +1,68 @@
+package delta
+
+import (
+	"encoding/hex"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestMarshalCBOR(t *testing.T) {
+	// Examples from RFC 8949, appendix A
+	for _, c := range []struct {
+		value   interface{}
+		encoded string
+	}{
+		{0.0, "00"},
+		{23.0, "17"},
+		{24.0, "1818"},
+		{1000.0, "1903e8"},
+		{1000000.0, "1a000f4240"},
+		{-1.0, "20"},
+		{-1000.0, "3903e7"},
+		{1.5, "fa3fc00000"},
+		{1.1, "fb3ff199999999999a"},
+		{false, "f4"},
+		{nil, "f6"},
+		{"IETF", "6449455446"},
+		{[]interface{}{1.0, []interface{}{2.0, 3.0}}, "8201820203"},
+		{map[string]interface{}{"b": []interface{}{2.0}, "a": 1.0}, "a261610161628102"},
+	} {
+		encoded, err := MarshalCBOR(c.value)
+		if err != nil || hex.EncodeToString(encoded) != c.encoded {
+			t.Errorf("Expected %v to encode as %s, got %x (%v)", c.value, c.encoded, encoded, err)
+		}
+		decoded, err := UnmarshalCBOR(encoded)
+		if err != nil || !reflect.DeepEqual(decoded, c.value) {
+			t.Errorf("Expected %x to decode as %v, got %v (%v)", encoded, c.value, decoded, err)
+		}
+	}
+
+	if _, err := MarshalCBOR(struct{}{}); err == nil {
+		t.Error("Expected an error for a struct")
+	}
+}
+
+func TestUnmarshalCBOR(t *testing.T) {
+	for encoded, expected := range map[string]interface{}{
+		"f93c00":             1.0,
+		"f9c400":             -4.0,
+		"f97c00":             math.Inf(1),
+		"1b0020000000000001": uint64(1<<53 + 1),
+		"c074323031332d30332d32315432303a30343a30305a": "2013-03-21T20:04:00Z",
+		"4401020304": []byte{1, 2, 3, 4},
+	} {
+		data, _ := hex.DecodeString(encoded)
+		if decoded, err := UnmarshalCBOR(data); err != nil || !reflect.DeepEqual(decoded, expected) {
+			t.Errorf("Expected %s to decode as %v, got %v (%v)", encoded, expected, decoded, err)
+		}
+	}
+
+	for _, encoded := range []string{"", "19", "62ff", "a10102", "9f01ff", "0000", "9b7fffffffffffffff"} {
+		data, _ := hex.DecodeString(encoded)
+		if _, err := UnmarshalCBOR(data); !errors.Is(err, ErrInvalidCBOR) {
+			t.Errorf("Expected ErrInvalidCBOR for %q, got %v", encoded, err)
+		}
+	}
+}
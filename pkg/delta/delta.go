@@ -0,0 +1,328 @@
+// Package delta implements a compact sync protocol for bandwidth-constrained
+// links. A replica sends the revisions of the twins it holds; the server
+// answers with the twins that changed since, carrying only the fields that
+// changed, addressed by JSON pointer. Twins the replica does not have yet, or
+// whose base revision is no longer tracked, are sent whole.
+package delta
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Common errors
+var (
+	ErrInvalidPointer = errors.New("invalid JSON pointer")
+)
+
+// DefaultMaxRemoved is the number of removed fields remembered per twin.
+// Replicas based on revisions older than the forgotten removals get the
+// whole twin.
+const DefaultMaxRemoved = 256
+
+// Request is sent by a replica to get the changes since its revisions
+type Request struct {
+	Epoch     string            `json:"epoch,omitempty"` // Epoch of the previous response, if any
+	Revisions map[string]uint64 `json:"revisions"`       // Revisions of the twins the replica holds
+	Query     string            `json:"query,omitempty"` // Twins to sync, all when empty
+}
+
+// Response carries the changes since the revisions of a request. Twins
+// unchanged since are left out.
+type Response struct {
+	Epoch   string   `json:"epoch"`             // Identifies the server's revisions; a new epoch invalidates all of them
+	Twins   []Delta  `json:"twins"`             // Changed twins, by ID
+	Deleted []string `json:"deleted,omitempty"` // Twins of the request that were deleted or no longer match the query
+}
+
+// Delta is the change of a single twin
+type Delta struct {
+	ID       string                 `json:"id"`
+	Revision uint64                 `json:"revision"`
+	Twin     map[string]interface{} `json:"twin,omitempty"`    // The whole twin, when the replica's revision is not tracked
+	Set      map[string]interface{} `json:"set,omitempty"`     // Changed fields by JSON pointer
+	Removed  []string               `json:"removed,omitempty"` // JSON pointers of removed fields
+}
+
+// field is the state of a leaf field of a twin
+type field struct {
+	revision uint64 // Revision the field was last seen changed at
+	hash     uint64 // Hash of the field's JSON encoding
+}
+
+// tracked is the field history of a twin
+type tracked struct {
+	revision uint64            // Revision last observed
+	floor    uint64            // Changes up to this revision are not tracked
+	fields   map[string]field  // Current fields by JSON pointer
+	removed  map[string]uint64 // Removed fields by JSON pointer, with the revision they were seen removed at
+}
+
+// Tracker records at which revision the fields of twins changed, so that
+// deltas can be computed against any tracked revision without keeping old
+// twins. Twins are observed lazily when a delta is requested; a field is
+// attributed to the revision it was observed changed at, which is never
+// earlier than its actual change, so deltas may repeat a field but never miss
+// one.
+type Tracker struct {
+	epoch      string
+	maxRemoved int
+	twins      map[string]*tracked
+	mutex      sync.Mutex
+}
+
+// NewTracker creates a tracker with a new epoch
+func NewTracker() *Tracker {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return &Tracker{
+		epoch:      hex.EncodeToString(b),
+		maxRemoved: DefaultMaxRemoved,
+		twins:      make(map[string]*tracked),
+	}
+}
+
+// Epoch identifies the revisions of this tracker. Revisions of another epoch,
+// e.g. from before a restart, cannot be compared.
+func (t *Tracker) Epoch() string {
+	return t.epoch
+}
+
+// Diff observes a twin document at a revision and returns its changes since
+// a base revision, or the whole document if the base revision is zero or
+// not tracked.
+func (t *Tracker) Diff(id string, revision uint64, doc map[string]interface{}, since uint64) Delta {
+	leaves := make(map[string]interface{})
+	flatten("", doc, leaves)
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	tr := t.observe(id, revision, leaves)
+	d := Delta{ID: id, Revision: revision}
+	if since == 0 || since < tr.floor || since > revision {
+		d.Twin = doc
+		return d
+	}
+
+	d.Set = make(map[string]interface{})
+	for pointer, f := range tr.fields {
+		if f.revision > since {
+			d.Set[pointer] = leaves[pointer]
+		}
+	}
+	for pointer, removedAt := range tr.removed {
+		if removedAt > since {
+			d.Removed = append(d.Removed, pointer)
+		}
+	}
+	sort.Strings(d.Removed)
+	return d
+}
+
+// observe updates the field history of a twin; the caller must hold the mutex
+func (t *Tracker) observe(id string, revision uint64, leaves map[string]interface{}) *tracked {
+	tr, exists := t.twins[id]
+	if !exists || revision < tr.revision {
+		// New twins, and twins recreated since, are tracked from here on
+		tr = &tracked{revision: revision, floor: revision, fields: make(map[string]field), removed: make(map[string]uint64)}
+		for pointer, value := range leaves {
+			tr.fields[pointer] = field{revision: revision, hash: hash(value)}
+		}
+		t.twins[id] = tr
+		return tr
+	}
+	if revision == tr.revision {
+		return tr
+	}
+
+	for pointer, value := range leaves {
+		h := hash(value)
+		if f, exists := tr.fields[pointer]; !exists || f.hash != h {
+			tr.fields[pointer] = field{revision: revision, hash: h}
+			delete(tr.removed, pointer)
+		}
+	}
+	for pointer := range tr.fields {
+		if _, exists := leaves[pointer]; !exists {
+			delete(tr.fields, pointer)
+			tr.removed[pointer] = revision
+		}
+	}
+	tr.revision = revision
+
+	// Forget the oldest removals, and with them the revisions they happened at
+	for len(tr.removed) > t.maxRemoved {
+		oldest, at := "", uint64(0)
+		for pointer, removedAt := range tr.removed {
+			if oldest == "" || removedAt < at || (removedAt == at && pointer < oldest) {
+				oldest, at = pointer, removedAt
+			}
+		}
+		delete(tr.removed, oldest)
+		if at > tr.floor {
+			tr.floor = at
+		}
+	}
+	return tr
+}
+
+// Forget stops tracking a twin, e.g. when it was deleted
+func (t *Tracker) Forget(id string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	delete(t.twins, id)
+}
+
+// Tracked returns the number of tracked twins
+func (t *Tracker) Tracked() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return len(t.twins)
+}
+
+// flatten collects the leaves of a JSON document by JSON pointer. Objects are
+// descended into; arrays, scalars and empty objects are leaves.
+func flatten(prefix string, value interface{}, leaves map[string]interface{}) {
+	if obj, ok := value.(map[string]interface{}); ok && (len(obj) > 0 || prefix == "") {
+		for key, v := range obj {
+			flatten(prefix+"/"+escape(key), v, leaves)
+		}
+		return
+	}
+	leaves[prefix] = value
+}
+
+// hash hashes the JSON encoding of a value, which has sorted object keys
+func hash(value interface{}) uint64 {
+	data, _ := json.Marshal(value)
+	h := fnv.New64a()
+	h.Write(data)
+	return h.Sum64()
+}
+
+// escape escapes a key for a JSON pointer
+func escape(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
+
+// unescape reverses escape
+func unescape(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+}
+
+// Apply applies a delta to the document of a twin a replica holds, which may
+// be nil for twins it does not have yet, and returns the updated document
+func Apply(doc map[string]interface{}, d Delta) (map[string]interface{}, error) {
+	if d.Twin != nil {
+		return d.Twin, nil
+	}
+	if doc == nil {
+		return nil, fmt.Errorf("delta for %s needs the twin at its base revision", d.ID)
+	}
+
+	for _, pointer := range d.Removed {
+		tokens, err := split(pointer)
+		if err != nil {
+			return nil, err
+		}
+		parent := doc
+		for _, token := range tokens[:len(tokens)-1] {
+			if parent, _ = parent[token].(map[string]interface{}); parent == nil {
+				break
+			}
+		}
+		if parent != nil {
+			delete(parent, tokens[len(tokens)-1])
+		}
+	}
+
+	// Parents are set before their children, replacing leaves they held
+	pointers := make([]string, 0, len(d.Set))
+	for pointer := range d.Set {
+		pointers = append(pointers, pointer)
+	}
+	sort.Strings(pointers)
+	for _, pointer := range pointers {
+		tokens, err := split(pointer)
+		if err != nil {
+			return nil, err
+		}
+		parent := doc
+		for _, token := range tokens[:len(tokens)-1] {
+			child, ok := parent[token].(map[string]interface{})
+			if !ok {
+				child = make(map[string]interface{})
+				parent[token] = child
+			}
+			parent = child
+		}
+		parent[tokens[len(tokens)-1]] = d.Set[pointer]
+	}
+	return doc, nil
+}
+
+// split splits a JSON pointer into its unescaped tokens
+func split(pointer string) ([]string, error) {
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidPointer, pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = unescape(token)
+	}
+	return tokens, nil
+}
+
+// Replica holds twins synced from a server
+type Replica struct {
+	Epoch     string                            `json:"epoch"`
+	Twins     map[string]map[string]interface{} `json:"twins"`
+	Revisions map[string]uint64                 `json:"revisions"`
+}
+
+// NewReplica creates an empty replica
+func NewReplica() *Replica {
+	return &Replica{Twins: make(map[string]map[string]interface{}), Revisions: make(map[string]uint64)}
+}
+
+// Request returns the request for the changes to the replica's twins
+func (r *Replica) Request(query string) Request {
+	revisions := make(map[string]uint64, len(r.Revisions))
+	for id, revision := range r.Revisions {
+		revisions[id] = revision
+	}
+	return Request{Epoch: r.Epoch, Revisions: revisions, Query: query}
+}
+
+// Apply applies a response to the replica
+func (r *Replica) Apply(resp Response) error {
+	if resp.Epoch != r.Epoch {
+		// Every twin is sent whole in a new epoch
+		r.Twins = make(map[string]map[string]interface{})
+		r.Revisions = make(map[string]uint64)
+		r.Epoch = resp.Epoch
+	}
+	for _, id := range resp.Deleted {
+		delete(r.Twins, id)
+		delete(r.Revisions, id)
+	}
+	for _, d := range resp.Twins {
+		doc, err := Apply(r.Twins[d.ID], d)
+		if err != nil {
+			return err
+		}
+		r.Twins[d.ID] = doc
+		r.Revisions[d.ID] = d.Revision
+	}
+	return nil
+}
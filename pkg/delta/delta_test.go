@@ -0,0 +1,153 @@
+package delta
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// doc parses a JSON document
+func doc(s string) map[string]interface{} {
+	var d map[string]interface{}
+	if err := json.Unmarshal([]byte(s), &d); err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func TestDiff(t *testing.T) {
+	tracker := NewTracker()
+	v1 := doc(`{"id": "pump-1", "attributes": {"site": "north", "a/b": 1}, "features": {"motor": {"properties": {"speed": 10}, "desiredProperties": {}}}}`)
+	v3 := doc(`{"id": "pump-1", "attributes": {"site": "north"}, "features": {"motor": {"properties": {"speed": 20}, "desiredProperties": {"speed": 25}}}}`)
+	v4 := doc(`{"id": "pump-1", "attributes": {"site": "south"}, "features": {"motor": {"properties": {"speed": 20}, "desiredProperties": {"speed": 25}}}}`)
+
+	if d := tracker.Diff("pump-1", 1, v1, 0); !reflect.DeepEqual(d.Twin, v1) || d.Set != nil {
+		t.Errorf("Expected the whole twin for a replica without it, got %+v", d)
+	}
+	tracker.Diff("pump-1", 3, v3, 0)
+
+	d := tracker.Diff("pump-1", 4, v4, 1)
+	expected := map[string]interface{}{
+		"/attributes/site":                        "south",
+		"/features/motor/properties/speed":        20.0,
+		"/features/motor/desiredProperties/speed": 25.0,
+	}
+	if d.Twin != nil || d.Revision != 4 || !reflect.DeepEqual(d.Set, expected) {
+		t.Errorf("Expected the fields changed since revision 1, got %+v", d)
+	}
+	if removed := []string{"/attributes/a~1b", "/features/motor/desiredProperties"}; !reflect.DeepEqual(d.Removed, removed) {
+		t.Errorf("Expected removed fields %v, got %v", removed, d.Removed)
+	}
+
+	d = tracker.Diff("pump-1", 4, v4, 3)
+	if !reflect.DeepEqual(d.Set, map[string]interface{}{"/attributes/site": "south"}) || d.Removed != nil {
+		t.Errorf("Expected the fields changed since revision 3, got %+v", d)
+	}
+
+	// Revisions from before tracking started, or from a recreated twin, get the whole twin
+	for _, since := range []uint64{0, 5} {
+		if d := tracker.Diff("pump-1", 4, v4, since); d.Twin == nil {
+			t.Errorf("Expected the whole twin since revision %d", since)
+		}
+	}
+	tracker.Diff("pump-1", 1, v1, 0)
+	if d := tracker.Diff("pump-1", 2, v3, 1); d.Twin != nil || len(d.Set) != 2 {
+		t.Errorf("Expected a recreated twin to be tracked again, got %+v", d)
+	}
+
+	tracker.Forget("pump-1")
+	if tracker.Tracked() != 0 {
+		t.Error("Expected the twin to be forgotten")
+	}
+}
+
+func TestForgetRemovals(t *testing.T) {
+	tracker := NewTracker()
+	tracker.maxRemoved = 1
+	tracker.Diff("pump-1", 1, doc(`{"attributes": {"a": 1, "b": 2, "c": 3}}`), 0)
+	tracker.Diff("pump-1", 2, doc(`{"attributes": {"b": 2, "c": 3}}`), 0)
+	tracker.Diff("pump-1", 3, doc(`{"attributes": {"c": 3}}`), 0)
+
+	if d := tracker.Diff("pump-1", 3, doc(`{"attributes": {"c": 3}}`), 1); d.Twin == nil {
+		t.Error("Expected the whole twin once the removals since were forgotten")
+	}
+	if d := tracker.Diff("pump-1", 3, doc(`{"attributes": {"c": 3}}`), 2); !reflect.DeepEqual(d.Removed, []string{"/attributes/b"}) {
+		t.Errorf("Expected the remembered removal, got %+v", d)
+	}
+}
+
+func TestReplica(t *testing.T) {
+	tracker := NewTracker()
+	twins := map[string]map[string]interface{}{
+		"pump-1": doc(`{"id": "pump-1", "attributes": {"x": {"y": 1}}, "features": {"motor": {"properties": {}}}}`),
+		"pump-2": doc(`{"id": "pump-2", "attributes": {}}`),
+	}
+	revisions := map[string]uint64{"pump-1": 1, "pump-2": 1}
+
+	// serve answers a request like the sync endpoint
+	serve := func(req Request) Response {
+		resp := Response{Epoch: tracker.Epoch(), Twins: []Delta{}}
+		for id, revision := range revisions {
+			since := req.Revisions[id]
+			if req.Epoch != resp.Epoch {
+				since = 0
+			}
+			if since != revision {
+				// Documents are copied, like twins encoded for a response
+				data, _ := json.Marshal(twins[id])
+				resp.Twins = append(resp.Twins, tracker.Diff(id, revision, doc(string(data)), since))
+			}
+		}
+		for id := range req.Revisions {
+			if _, exists := twins[id]; !exists {
+				resp.Deleted = append(resp.Deleted, id)
+			}
+		}
+		return resp
+	}
+
+	replica := NewReplica()
+	sync := func() Response {
+		resp := serve(replica.Request(""))
+		if err := replica.Apply(resp); err != nil {
+			t.Fatalf("Failed to apply: %v", err)
+		}
+		if !reflect.DeepEqual(replica.Twins, twins) {
+			t.Fatalf("Expected the replica to match the server, got %v", replica.Twins)
+		}
+		return resp
+	}
+
+	if resp := sync(); len(resp.Twins) != 2 {
+		t.Errorf("Expected both twins, got %+v", resp)
+	}
+	if resp := sync(); len(resp.Twins) != 0 {
+		t.Errorf("Expected no changes, got %+v", resp)
+	}
+
+	twins["pump-1"] = doc(`{"id": "pump-1", "attributes": {"x": 5}, "features": {"motor": {"properties": {"speed": 10}}}}`)
+	revisions["pump-1"] = 2
+	delete(twins, "pump-2")
+	delete(revisions, "pump-2")
+	resp := sync()
+	if len(resp.Twins) != 1 || resp.Twins[0].Twin != nil || !reflect.DeepEqual(resp.Deleted, []string{"pump-2"}) {
+		t.Errorf("Expected a delta and a deletion, got %+v", resp)
+	}
+
+	twins["pump-1"] = doc(`{"id": "pump-1", "attributes": {"x": {"z": 2}}, "features": {"motor": {"properties": {}}}}`)
+	revisions["pump-1"] = 3
+	sync()
+
+	// A new epoch resends every twin
+	tracker = NewTracker()
+	if resp := sync(); len(resp.Twins) != 1 || resp.Twins[0].Twin == nil {
+		t.Errorf("Expected the whole twin in a new epoch, got %+v", resp)
+	}
+
+	if _, err := Apply(nil, Delta{ID: "pump-9", Set: map[string]interface{}{"/a": 1}}); err == nil {
+		t.Error("Expected an error for a delta without a base")
+	}
+	if _, err := Apply(map[string]interface{}{}, Delta{ID: "pump-9", Set: map[string]interface{}{"a": 1}}); err == nil {
+		t.Error("Expected an error for an invalid pointer")
+	}
+}
@@ -0,0 +1,221 @@
+package demo
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/eventbus"
+	"github.com/aleka07/go-digital-twin/pkg/ingest"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// DefaultInterval is how often the simulator reports sensor readings
+const DefaultInterval = 5 * time.Second
+
+// Sensor kinds
+const (
+	KindClimate = "climate"
+	KindAir     = "air"
+)
+
+// FeatureID is the feature holding the readings of sensors
+const FeatureID = "measurements"
+
+// signal describes a simulated reading as a bounded random walk
+type signal struct {
+	Property string
+	Min      float64
+	Max      float64
+	Step     float64 // Largest change between two readings
+}
+
+// signals lists the readings of each sensor kind
+var signals = map[string][]signal{
+	KindClimate: {
+		{Property: "temperature", Min: 18, Max: 26, Step: 0.3},
+		{Property: "humidity", Min: 30, Max: 60, Step: 1},
+	},
+	KindAir: {
+		{Property: "co2", Min: 400, Max: 1400, Step: 40},
+	},
+}
+
+// buildings lists the sample sites and their rooms
+var buildings = []struct {
+	ID    string
+	Name  string
+	City  string
+	Rooms []string
+}{
+	{ID: "building-hq", Name: "Headquarters", City: "Almaty", Rooms: []string{"lobby", "office-1", "office-2", "meeting"}},
+	{ID: "building-lab", Name: "Research Lab", City: "Astana", Rooms: []string{"lab-1", "lab-2", "server-room"}},
+}
+
+// Fleet returns the sample fleet: buildings containing rooms, which contain a
+// climate and an air quality sensor each. Rooms have a desired temperature.
+func Fleet() []*twin.DigitalTwin {
+	var fleet []*twin.DigitalTwin
+
+	for _, b := range buildings {
+		building := twin.NewDigitalTwin(b.ID, "building")
+		building.SetAttribute("name", b.Name)
+		building.SetAttribute("city", b.City)
+		fleet = append(fleet, building)
+
+		for floor, name := range b.Rooms {
+			roomID := b.ID + "-" + name
+			building.AddRelationship("contains", roomID)
+
+			room := twin.NewDigitalTwin(roomID, "room")
+			room.SetAttribute("name", name)
+			room.SetAttribute("floor", float64(floor/2+1))
+
+			hvac := twin.NewFeatureState()
+			hvac.SetDesiredProperty("setpoint", 21.0)
+			room.AddFeature("hvac", hvac)
+			fleet = append(fleet, room)
+
+			for _, kind := range []string{KindClimate, KindAir} {
+				sensorID := roomID + "-" + kind
+				room.AddRelationship("contains", sensorID)
+
+				sensor := twin.NewDigitalTwin(sensorID, "sensor")
+				sensor.SetAttribute("kind", kind)
+				sensor.SetAttribute("room", roomID)
+				sensor.AddFeature(FeatureID, twin.NewFeatureState())
+				fleet = append(fleet, sensor)
+			}
+		}
+	}
+
+	for _, dt := range fleet {
+		dt.SetLifecycle(twin.LifecycleActive)
+	}
+	return fleet
+}
+
+// Seed creates the twins of the sample fleet that do not exist yet and
+// returns the IDs of the created twins
+func Seed(reg *registry.Registry, pubsub eventbus.Publisher) ([]string, error) {
+	created := []string{}
+
+	for _, dt := range Fleet() {
+		dt.SetSystem(twin.SystemSource, "demo")
+		if err := reg.Create(dt); err != nil {
+			if err == registry.ErrTwinAlreadyExists {
+				continue
+			}
+			return created, fmt.Errorf("failed to create %s: %w", dt.ID, err)
+		}
+		created = append(created, dt.ID)
+		pubsub.Publish("twin.created", map[string]string{"id": dt.ID})
+	}
+	return created, nil
+}
+
+// Simulator reports readings for the sensors of the sample fleet through the
+// ingester, so they flow through transforms, history and events like real
+// device telemetry
+type Simulator struct {
+	registry *registry.Registry
+	ingester *ingest.Ingester
+	rand     *rand.Rand
+	values   map[string]float64 // Sensor ID and property -> last reading
+	mutex    sync.Mutex
+}
+
+// NewSimulator creates a simulator. The seed makes the readings reproducible.
+func NewSimulator(reg *registry.Registry, ingester *ingest.Ingester, seed int64) *Simulator {
+	return &Simulator{
+		registry: reg,
+		ingester: ingester,
+		rand:     rand.New(rand.NewSource(seed)),
+		values:   make(map[string]float64),
+	}
+}
+
+// Step reports one reading for every simulated sensor in the registry.
+// Sensors that fail are skipped and reported in the returned error.
+func (s *Simulator) Step() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var sensors []*twin.DigitalTwin
+	for _, dt := range s.registry.List() {
+		if dt.Type != "sensor" || dt.GetLifecycle() == twin.LifecycleDecommissioned {
+			continue
+		}
+		sensors = append(sensors, dt)
+	}
+	sort.Slice(sensors, func(i, j int) bool { return sensors[i].ID < sensors[j].ID })
+
+	now := time.Now()
+	var failed []string
+	for _, dt := range sensors {
+		kind, _ := dt.GetAttribute("kind")
+		sigs, ok := signals[fmt.Sprint(kind)]
+		if !ok {
+			continue
+		}
+
+		readings := make(map[string]interface{}, len(sigs))
+		for _, sig := range sigs {
+			readings[sig.Property] = s.next(dt.ID, sig)
+		}
+
+		_, err := s.ingester.Apply(ingest.Telemetry{
+			TwinID:    dt.ID,
+			Timestamp: now,
+			Features:  map[string]map[string]interface{}{FeatureID: readings},
+		})
+		if err != nil {
+			failed = append(failed, dt.ID+": "+err.Error())
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("simulated readings failed for %d sensors: %v", len(failed), failed)
+	}
+	return nil
+}
+
+// Run reports readings at the given interval until the context is cancelled
+func (s *Simulator) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Step(); err != nil {
+			log.Printf("Demo simulation: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// next advances the random walk of a reading, starting in the middle of its range
+func (s *Simulator) next(sensorID string, sig signal) float64 {
+	key := sensorID + "/" + sig.Property
+
+	value, exists := s.values[key]
+	if !exists {
+		value = (sig.Min + sig.Max) / 2
+	} else {
+		value += (s.rand.Float64()*2 - 1) * sig.Step
+	}
+	value = math.Max(sig.Min, math.Min(sig.Max, value))
+
+	s.values[key] = value
+	return math.Round(value*10) / 10
+}
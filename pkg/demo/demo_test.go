@@ -0,0 +1,80 @@
+package demo
+
+import (
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/history"
+	"github.com/aleka07/go-digital-twin/pkg/ingest"
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestSeed(t *testing.T) {
+	reg := registry.NewRegistry()
+	pubsub := messaging_sim.NewPubSub()
+
+	created, err := Seed(reg, pubsub)
+	if err != nil {
+		t.Fatalf("Failed to seed: %v", err)
+	}
+	// 2 buildings, 7 rooms and 2 sensors per room
+	if len(created) != 23 {
+		t.Errorf("Expected 23 twins, got %d", len(created))
+	}
+
+	building, err := reg.Get("building-hq")
+	if err != nil {
+		t.Fatalf("Expected the headquarters building: %v", err)
+	}
+	rooms := building.GetRelationship("contains")
+	if len(rooms) != 4 {
+		t.Fatalf("Expected 4 rooms, got %v", rooms)
+	}
+	room, _ := reg.Get(rooms[0])
+	if sensors := room.GetRelationship("contains"); len(sensors) != 2 {
+		t.Errorf("Expected 2 sensors in %s, got %v", room.ID, sensors)
+	}
+
+	// Seeding again keeps existing twins
+	if created, err := Seed(reg, pubsub); err != nil || len(created) != 0 {
+		t.Errorf("Expected no new twins, got %v (%v)", created, err)
+	}
+}
+
+func TestSimulator(t *testing.T) {
+	reg := registry.NewRegistry()
+	hist := history.NewStore(history.DefaultCapacity)
+	Seed(reg, messaging_sim.NewPubSub())
+
+	decommissioned, _ := reg.Get("building-lab-lab-1-climate")
+	decommissioned.SetLifecycle(twin.LifecycleDecommissioned)
+
+	sim := NewSimulator(reg, ingest.NewIngester(reg, messaging_sim.NewPubSub(), hist), 1)
+	for i := 0; i < 50; i++ {
+		if err := sim.Step(); err != nil {
+			t.Fatalf("Step %d failed: %v", i, err)
+		}
+	}
+
+	sensor, _ := reg.Get("building-hq-office-1-climate")
+	feature, _ := sensor.GetFeature(FeatureID)
+	temperature, ok := feature.GetProperty("temperature")
+	if v, isFloat := temperature.(float64); !ok || !isFloat || v < 18 || v > 26 {
+		t.Errorf("Expected a temperature between 18 and 26, got %v", temperature)
+	}
+	if _, ok := feature.GetProperty("humidity"); !ok {
+		t.Error("Expected a humidity reading")
+	}
+
+	air, _ := reg.Get("building-hq-office-1-air")
+	feature, _ = air.GetFeature(FeatureID)
+	if co2, ok := feature.GetProperty("co2"); !ok || co2.(float64) < 400 || co2.(float64) > 1400 {
+		t.Errorf("Expected a CO2 reading between 400 and 1400, got %v", co2)
+	}
+
+	feature, _ = decommissioned.GetFeature(FeatureID)
+	if _, ok := feature.GetProperty("temperature"); ok {
+		t.Error("Expected decommissioned sensors not to report")
+	}
+}
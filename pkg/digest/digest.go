@@ -0,0 +1,310 @@
+package digest
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/eventbus"
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+)
+
+// Common errors
+var (
+	ErrDigestNotFound      = errors.New("digest not found")
+	ErrDigestAlreadyExists = errors.New("digest already exists")
+	ErrInvalidDigest       = errors.New("invalid digest")
+)
+
+// TopicPrefix is prepended to the digest name to form the topic digests are published on
+const TopicPrefix = "digest."
+
+// eventBufferSize is the subscription buffer used to absorb bursts of property changes
+const eventBufferSize = 1024
+
+// Summary coalesces all property changes of a single twin within a digest period
+type Summary struct {
+	TwinID      string                            `json:"twinId"`
+	ChangeCount int                               `json:"changeCount"`
+	FirstChange time.Time                         `json:"firstChange"`
+	LastChange  time.Time                         `json:"lastChange"`
+	Latest      map[string]map[string]interface{} `json:"latest"` // Feature ID -> property key -> latest value
+}
+
+// Digest is the batched summary of one period, published on TopicPrefix + Name
+type Digest struct {
+	Name      string    `json:"name"`
+	From      time.Time `json:"from"`
+	To        time.Time `json:"to"`
+	Summaries []Summary `json:"summaries"`
+}
+
+// Digester collects property change events and periodically publishes a digest
+type Digester struct {
+	name     string
+	interval time.Duration
+	pubsub   eventbus.Bus
+	events   chan messaging_sim.Message
+	stop     chan struct{}
+	pending  map[string]*Summary
+	since    time.Time
+	latest   *Digest
+	mutex    sync.Mutex
+}
+
+// NewDigester creates a digester that publishes a digest every interval.
+// It does not consume events until Start is called.
+func NewDigester(name string, interval time.Duration, pubsub eventbus.Bus) (*Digester, error) {
+	if name == "" || strings.ContainsAny(name, ".+#") {
+		return nil, fmt.Errorf("%w: name must be non-empty and must not contain '.', '+' or '#'", ErrInvalidDigest)
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("%w: interval must be positive", ErrInvalidDigest)
+	}
+
+	return &Digester{
+		name:     name,
+		interval: interval,
+		pubsub:   pubsub,
+		pending:  make(map[string]*Summary),
+		since:    time.Now(),
+	}, nil
+}
+
+// Name returns the name of the digest
+func (d *Digester) Name() string {
+	return d.name
+}
+
+// Interval returns the period covered by each digest
+func (d *Digester) Interval() time.Duration {
+	return d.interval
+}
+
+// Topic returns the topic the digests are published on
+func (d *Digester) Topic() string {
+	return TopicPrefix + d.name
+}
+
+// Latest returns the most recently published digest, or nil if none was published yet
+func (d *Digester) Latest() *Digest {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return d.latest
+}
+
+// Start subscribes to property change events and publishes digests until Stop is called
+func (d *Digester) Start() {
+	d.events = d.pubsub.SubscribeWithBuffer("#", eventBufferSize)
+	d.stop = make(chan struct{})
+	go d.run(d.events, d.stop)
+}
+
+// Stop ends the subscription without publishing the pending changes
+func (d *Digester) Stop() {
+	if d.stop == nil {
+		return
+	}
+	d.pubsub.Unsubscribe("#", d.events)
+	close(d.stop)
+	d.stop = nil
+}
+
+// HandleEvent records a property change event in the pending digest
+func (d *Digester) HandleEvent(msg messaging_sim.Message) {
+	twinID := msg.TwinID()
+	var featureID string
+	var changes map[string]interface{}
+
+	switch msg.Topic {
+	case "property.updated":
+		payload, ok := msg.Payload.(map[string]interface{})
+		if !ok {
+			return
+		}
+		featureID, _ = payload["featureId"].(string)
+		key, _ := payload["propertyKey"].(string)
+		changes = map[string]interface{}{key: payload["value"]}
+	case "properties.updated":
+		u, ok := eventbus.PropertiesOf(msg.Payload)
+		if !ok {
+			return
+		}
+		featureID, changes = u.FeatureID, u.Properties
+	default:
+		return
+	}
+
+	if twinID == "" || featureID == "" {
+		return
+	}
+
+	now := time.Now()
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	summary, exists := d.pending[twinID]
+	if !exists {
+		summary = &Summary{
+			TwinID:      twinID,
+			FirstChange: now,
+			Latest:      make(map[string]map[string]interface{}),
+		}
+		d.pending[twinID] = summary
+	}
+
+	if summary.Latest[featureID] == nil {
+		summary.Latest[featureID] = make(map[string]interface{})
+	}
+	for k, v := range changes {
+		summary.Latest[featureID][k] = v
+	}
+
+	summary.ChangeCount++
+	summary.LastChange = now
+}
+
+// Flush publishes the pending changes as a digest and starts a new period.
+// Nothing is published when no changes happened during the period.
+func (d *Digester) Flush() *Digest {
+	d.mutex.Lock()
+
+	now := time.Now()
+	digest := &Digest{
+		Name:      d.name,
+		From:      d.since,
+		To:        now,
+		Summaries: make([]Summary, 0, len(d.pending)),
+	}
+
+	for _, summary := range d.pending {
+		digest.Summaries = append(digest.Summaries, *summary)
+	}
+	sort.Slice(digest.Summaries, func(i, j int) bool {
+		return digest.Summaries[i].TwinID < digest.Summaries[j].TwinID
+	})
+
+	d.pending = make(map[string]*Summary)
+	d.since = now
+	if len(digest.Summaries) > 0 {
+		d.latest = digest
+	}
+
+	d.mutex.Unlock()
+
+	if len(digest.Summaries) > 0 {
+		d.pubsub.Publish(d.Topic(), digest)
+	}
+
+	return digest
+}
+
+// run consumes events and flushes on every tick until stopped
+func (d *Digester) run(events <-chan messaging_sim.Message, stop <-chan struct{}) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case msg, ok := <-events:
+			if !ok {
+				return
+			}
+			d.HandleEvent(msg)
+		case <-ticker.C:
+			d.Flush()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Manager keeps track of the configured digest subscriptions
+type Manager struct {
+	pubsub    eventbus.Bus
+	digesters map[string]*Digester
+	mutex     sync.RWMutex
+}
+
+// NewManager creates a new digest manager
+func NewManager(pubsub eventbus.Bus) *Manager {
+	return &Manager{
+		pubsub:    pubsub,
+		digesters: make(map[string]*Digester),
+	}
+}
+
+// Create configures and starts a new digest
+func (m *Manager) Create(name string, interval time.Duration) (*Digester, error) {
+	d, err := NewDigester(name, interval, m.pubsub)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, exists := m.digesters[name]; exists {
+		return nil, ErrDigestAlreadyExists
+	}
+
+	d.Start()
+	m.digesters[name] = d
+	return d, nil
+}
+
+// Get returns a digest by name
+func (m *Manager) Get(name string) (*Digester, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	d, exists := m.digesters[name]
+	if !exists {
+		return nil, ErrDigestNotFound
+	}
+	return d, nil
+}
+
+// List returns all digests ordered by name
+func (m *Manager) List() []*Digester {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	digesters := make([]*Digester, 0, len(m.digesters))
+	for _, d := range m.digesters {
+		digesters = append(digesters, d)
+	}
+
+	sort.Slice(digesters, func(i, j int) bool { return digesters[i].name < digesters[j].name })
+	return digesters
+}
+
+// Delete stops and removes a digest
+func (m *Manager) Delete(name string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	d, exists := m.digesters[name]
+	if !exists {
+		return ErrDigestNotFound
+	}
+
+	d.Stop()
+	delete(m.digesters, name)
+	return nil
+}
+
+// Close stops all digests
+func (m *Manager) Close() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, d := range m.digesters {
+		d.Stop()
+	}
+}
@@ -0,0 +1,178 @@
+package digest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+)
+
+func propertyEvent(twinID, featureID, key string, value interface{}) messaging_sim.Message {
+	return messaging_sim.Message{
+		Topic: "property.updated",
+		Payload: map[string]interface{}{
+			"twinId":      twinID,
+			"featureId":   featureID,
+			"propertyKey": key,
+			"value":       value,
+		},
+	}
+}
+
+func TestNewDigester(t *testing.T) {
+	ps := messaging_sim.NewPubSub()
+
+	if _, err := NewDigester("", time.Second, ps); err == nil {
+		t.Error("Expected error for empty name")
+	}
+
+	if _, err := NewDigester("a.b", time.Second, ps); err == nil {
+		t.Error("Expected error for name containing a topic separator")
+	}
+
+	if _, err := NewDigester("fleet", 0, ps); err == nil {
+		t.Error("Expected error for non-positive interval")
+	}
+
+	d, err := NewDigester("fleet", 10*time.Second, ps)
+	if err != nil {
+		t.Fatalf("Failed to create digester: %v", err)
+	}
+
+	if d.Topic() != "digest.fleet" {
+		t.Errorf("Expected topic digest.fleet, got %s", d.Topic())
+	}
+}
+
+func TestDigesterCoalescesChanges(t *testing.T) {
+	ps := messaging_sim.NewPubSub()
+	d, _ := NewDigester("fleet", time.Hour, ps)
+
+	ch := ps.Subscribe(d.Topic())
+
+	// Several ticks for the same twin collapse into one summary
+	d.HandleEvent(propertyEvent("twin-1", "temperature", "value", 20.0))
+	d.HandleEvent(propertyEvent("twin-1", "temperature", "value", 21.0))
+	d.HandleEvent(messaging_sim.Message{
+		Topic: "properties.updated",
+		Payload: map[string]interface{}{
+			"twinId":     "twin-1",
+			"featureId":  "humidity",
+			"properties": map[string]interface{}{"value": 40.0},
+		},
+	})
+	d.HandleEvent(propertyEvent("twin-0", "temperature", "value", 18.0))
+
+	// Unrelated events are ignored
+	d.HandleEvent(messaging_sim.Message{Topic: "twin.created", Payload: map[string]string{"id": "twin-2"}})
+
+	digest := d.Flush()
+	if len(digest.Summaries) != 2 {
+		t.Fatalf("Expected 2 summaries, got %d", len(digest.Summaries))
+	}
+
+	first, second := digest.Summaries[0], digest.Summaries[1]
+	if first.TwinID != "twin-0" || second.TwinID != "twin-1" {
+		t.Errorf("Expected summaries ordered by twin ID, got %s, %s", first.TwinID, second.TwinID)
+	}
+
+	if second.ChangeCount != 3 {
+		t.Errorf("Expected 3 changes for twin-1, got %d", second.ChangeCount)
+	}
+
+	if second.Latest["temperature"]["value"] != 21.0 {
+		t.Errorf("Expected latest temperature 21.0, got %v", second.Latest["temperature"]["value"])
+	}
+
+	if second.Latest["humidity"]["value"] != 40.0 {
+		t.Errorf("Expected latest humidity 40.0, got %v", second.Latest["humidity"]["value"])
+	}
+
+	// The digest is published on its topic
+	select {
+	case msg := <-ch:
+		if published, ok := msg.Payload.(*Digest); !ok || published != digest {
+			t.Errorf("Expected the flushed digest to be published, got %v", msg.Payload)
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Error("Timed out waiting for digest")
+	}
+
+	if d.Latest() != digest {
+		t.Error("Expected Latest to return the flushed digest")
+	}
+
+	// Empty periods are not published
+	if empty := d.Flush(); len(empty.Summaries) != 0 {
+		t.Errorf("Expected empty digest, got %d summaries", len(empty.Summaries))
+	}
+
+	select {
+	case msg := <-ch:
+		t.Errorf("Expected no digest for an empty period, got %v", msg.Payload)
+	default:
+	}
+
+	if d.Latest() != digest {
+		t.Error("Expected Latest to keep the last non-empty digest")
+	}
+}
+
+func TestDigesterPublishesPeriodically(t *testing.T) {
+	ps := messaging_sim.NewPubSub()
+	m := NewManager(ps)
+	defer m.Close()
+
+	d, err := m.Create("fast", 20*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Failed to create digest: %v", err)
+	}
+
+	ch := ps.Subscribe(d.Topic())
+
+	ps.Publish("property.updated", map[string]interface{}{
+		"twinId":      "twin-1",
+		"featureId":   "temperature",
+		"propertyKey": "value",
+		"value":       22.0,
+	})
+
+	select {
+	case msg := <-ch:
+		digest := msg.Payload.(*Digest)
+		if len(digest.Summaries) != 1 || digest.Summaries[0].ChangeCount != 1 {
+			t.Errorf("Expected a single change in the digest, got %+v", digest.Summaries)
+		}
+	case <-time.After(time.Second):
+		t.Error("Timed out waiting for periodic digest")
+	}
+}
+
+func TestDigestManager(t *testing.T) {
+	m := NewManager(messaging_sim.NewPubSub())
+	defer m.Close()
+
+	m.Create("b", time.Hour)
+	m.Create("a", time.Hour)
+
+	if _, err := m.Create("a", time.Hour); err != ErrDigestAlreadyExists {
+		t.Errorf("Expected ErrDigestAlreadyExists, got %v", err)
+	}
+
+	list := m.List()
+	if len(list) != 2 || list[0].Name() != "a" || list[1].Name() != "b" {
+		t.Errorf("Expected digests a and b, got %v", list)
+	}
+
+	if err := m.Delete("a"); err != nil {
+		t.Errorf("Failed to delete digest: %v", err)
+	}
+
+	if _, err := m.Get("a"); err != ErrDigestNotFound {
+		t.Errorf("Expected ErrDigestNotFound, got %v", err)
+	}
+
+	if err := m.Delete("a"); err != ErrDigestNotFound {
+		t.Errorf("Expected ErrDigestNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,164 @@
+// Package edge synchronizes a server running at the edge with a central
+// server over an intermittent link. Local changes to twins are queued and
+// pushed when the central server is reachable; changes the central server
+// made in the meantime are detected by revision and resolved with a conflict
+// policy.
+package edge
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aleka07/go-digital-twin/pkg/eventbus"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// Common errors
+var (
+	ErrInvalidPolicy  = errors.New("invalid conflict policy")
+	ErrInvalidOptions = errors.New("invalid edge sync options")
+	ErrInvalidChange  = errors.New("invalid edge change")
+)
+
+// Policy decides how a twin changed both at the edge and centrally is resolved
+type Policy string
+
+// Conflict policies
+const (
+	LastWriterWins Policy = "last-writer-wins" // The side modified last keeps its twin
+	CentralWins    Policy = "central-wins"     // The central twin replaces the local one
+	Merge          Policy = "merge"            // Fields changed on one side are combined; last writer wins for fields changed on both
+)
+
+// ParsePolicy parses a conflict policy
+func ParsePolicy(s string) (Policy, error) {
+	switch p := Policy(s); p {
+	case LastWriterWins, CentralWins, Merge:
+		return p, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrInvalidPolicy, s)
+}
+
+// Change is a local change of a twin pushed to the central server
+type Change struct {
+	TwinID       string            `json:"twinId"`
+	BaseRevision uint64            `json:"baseRevision"`      // Central revision the change is based on, 0 for twins never synced
+	Deleted      bool              `json:"deleted,omitempty"` // The twin was deleted at the edge
+	Twin         *twin.DigitalTwin `json:"twin,omitempty"`
+}
+
+// Outcomes of a pushed change
+const (
+	Applied  = "applied"
+	Conflict = "conflict"
+	Failed   = "failed"
+)
+
+// Result reports what the central server did with a change
+type Result struct {
+	TwinID   string            `json:"twinId"`
+	Status   string            `json:"status"`             // Applied, Conflict or Failed
+	Revision uint64            `json:"revision,omitempty"` // Central revision after applying the change
+	Twin     *twin.DigitalTwin `json:"twin,omitempty"`     // Central twin of a conflict, none when it was deleted
+	Error    string            `json:"error,omitempty"`
+}
+
+// PushRequest is the body of a push to the central server
+type PushRequest struct {
+	Edge    string   `json:"edge,omitempty"` // Name of the pushing edge, for logging
+	Changes []Change `json:"changes"`
+}
+
+// PushResponse is the reply of the central server to a push
+type PushResponse struct {
+	Results []Result `json:"results"`
+}
+
+// Receive applies changes pushed by an edge to the central registry. A change
+// is applied only when the central twin is still at the change's base
+// revision; otherwise the current central twin is returned as a conflict for
+// the edge to resolve. Events are published for applied changes.
+func Receive(reg *registry.Registry, pubsub eventbus.Publisher, changes []Change) []Result {
+	results := make([]Result, 0, len(changes))
+	for _, c := range changes {
+		result := receive(reg, pubsub, c)
+		result.TwinID = c.TwinID
+		results = append(results, result)
+	}
+	return results
+}
+
+// receive applies a single change
+func receive(reg *registry.Registry, pubsub eventbus.Publisher, c Change) Result {
+	if c.TwinID == "" || (!c.Deleted && (c.Twin == nil || c.Twin.ID != c.TwinID || c.Twin.Type == "")) {
+		return Result{Status: Failed, Error: ErrInvalidChange.Error()}
+	}
+
+	current, err := reg.Get(c.TwinID)
+	switch {
+	case err == registry.ErrTwinNotFound:
+		if c.Deleted {
+			return Result{Status: Applied}
+		}
+		if c.BaseRevision != 0 {
+			// Deleted centrally since the edge last synced
+			return Result{Status: Conflict}
+		}
+		dt := prepare(c.Twin)
+		if err := reg.Create(dt); err == registry.ErrTwinAlreadyExists {
+			return conflict(reg, c.TwinID)
+		} else if err != nil {
+			return Result{Status: Failed, Error: err.Error()}
+		}
+		pubsub.Publish("twin.created", map[string]string{"id": c.TwinID})
+		return Result{Status: Applied, Revision: dt.GetRevision()}
+	case err != nil:
+		return Result{Status: Failed, Error: err.Error()}
+	}
+
+	if current.GetRevision() != c.BaseRevision {
+		return Result{Status: Conflict, Twin: current.Clone()}
+	}
+
+	if c.Deleted {
+		if err := reg.Delete(c.TwinID); err != nil {
+			return Result{Status: Failed, Error: err.Error()}
+		}
+		pubsub.Publish("twin.deleted", map[string]string{"id": c.TwinID})
+		return Result{Status: Applied}
+	}
+
+	dt := prepare(c.Twin)
+	dt.SetRevision(c.BaseRevision)
+	if err := reg.Update(dt); errors.Is(err, registry.ErrRevisionConflict) {
+		return conflict(reg, c.TwinID)
+	} else if err != nil {
+		return Result{Status: Failed, Error: err.Error()}
+	}
+	pubsub.Publish("twin.updated", map[string]string{"id": c.TwinID})
+	return Result{Status: Applied, Revision: dt.GetRevision()}
+}
+
+// conflict reports the current central twin after losing a race
+func conflict(reg *registry.Registry, id string) Result {
+	current, err := reg.Get(id)
+	if err != nil {
+		return Result{Status: Conflict}
+	}
+	return Result{Status: Conflict, Twin: current.Clone()}
+}
+
+// prepare returns a copy of a received twin with its maps initialized
+func prepare(received *twin.DigitalTwin) *twin.DigitalTwin {
+	for id, feature := range received.Features {
+		if feature == nil {
+			received.Features[id] = twin.NewFeatureState()
+		}
+	}
+	dt := received.Clone()
+	if dt.Lifecycle == "" {
+		dt.Lifecycle = twin.LifecycleProvisioned
+	}
+	return dt
+}
@@ -0,0 +1,78 @@
+package edge
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestParsePolicy(t *testing.T) {
+	for _, s := range []string{"last-writer-wins", "central-wins", "merge"} {
+		if p, err := ParsePolicy(s); err != nil || string(p) != s {
+			t.Errorf("Expected %q to parse, got %q (%v)", s, p, err)
+		}
+	}
+	if _, err := ParsePolicy("edge-wins"); !errors.Is(err, ErrInvalidPolicy) {
+		t.Errorf("Expected ErrInvalidPolicy, got %v", err)
+	}
+}
+
+func TestReceive(t *testing.T) {
+	reg := registry.NewRegistry()
+	pubsub := messaging_sim.NewPubSub()
+	events := pubsub.SubscribeWithBuffer("twin.+", 10)
+
+	pump := twin.NewDigitalTwin("pump-1", "pump")
+	pump.SetAttribute("site", "north")
+	results := Receive(reg, pubsub, []Change{
+		{TwinID: "pump-1", Twin: pump},
+		{TwinID: "pump-2", Twin: twin.NewDigitalTwin("pump-3", "pump")},
+		{TwinID: "gone", Deleted: true, BaseRevision: 3},
+	})
+	if results[0].Status != Applied || results[0].Revision != 1 {
+		t.Errorf("Expected the twin to be created, got %+v", results[0])
+	}
+	if results[1].Status != Failed {
+		t.Errorf("Expected a mismatched ID to fail, got %+v", results[1])
+	}
+	if results[2].Status != Applied {
+		t.Errorf("Expected deleting a missing twin to succeed, got %+v", results[2])
+	}
+	if msg := <-events; msg.Topic != "twin.created" {
+		t.Errorf("Expected twin.created, got %s", msg.Topic)
+	}
+
+	// Changes based on the current revision are applied
+	pump.SetAttribute("site", "south")
+	results = Receive(reg, pubsub, []Change{{TwinID: "pump-1", BaseRevision: 1, Twin: pump}})
+	stored, _ := reg.Get("pump-1")
+	if site, _ := stored.GetAttribute("site"); results[0].Status != Applied || results[0].Revision != 2 || site != "south" {
+		t.Errorf("Expected the twin to be updated, got %+v", results[0])
+	}
+
+	// Changes based on an older revision conflict with the central twin
+	for _, c := range []Change{
+		{TwinID: "pump-1", BaseRevision: 1, Twin: pump},
+		{TwinID: "pump-1", Twin: pump},
+		{TwinID: "pump-1", BaseRevision: 1, Deleted: true},
+	} {
+		r := Receive(reg, pubsub, []Change{c})[0]
+		if r.Status != Conflict || r.Twin == nil || r.Twin.GetRevision() != 2 {
+			t.Errorf("Expected a conflict with revision 2 for %+v, got %+v", c, r)
+		}
+	}
+
+	// Twins deleted centrally conflict without a twin
+	r := Receive(reg, pubsub, []Change{{TwinID: "pump-9", BaseRevision: 4, Twin: twin.NewDigitalTwin("pump-9", "pump")}})[0]
+	if r.Status != Conflict || r.Twin != nil {
+		t.Errorf("Expected a conflict without a twin, got %+v", r)
+	}
+
+	r = Receive(reg, pubsub, []Change{{TwinID: "pump-1", BaseRevision: 2, Deleted: true}})[0]
+	if _, err := reg.Get("pump-1"); r.Status != Applied || err != registry.ErrTwinNotFound {
+		t.Errorf("Expected the twin to be deleted, got %+v", r)
+	}
+}
@@ -0,0 +1,104 @@
+package edge
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// bookkeeping are the twin fields maintained by the registry, which are not merged
+var bookkeeping = map[string]bool{"revision": true, "createdAt": true, "modifiedAt": true}
+
+// merge combines the changes made to a twin at the edge and centrally since
+// their common base, which is nil for twins created on both sides. Fields
+// changed on one side only take that side's value, and nested objects such as
+// attributes, features and properties are merged field by field. Fields
+// changed on both sides take the value of the twin modified last.
+func merge(base, local, central *twin.DigitalTwin) (*twin.DigitalTwin, error) {
+	b, err := document(base)
+	if err != nil {
+		return nil, err
+	}
+	l, err := document(local)
+	if err != nil {
+		return nil, err
+	}
+	c, err := document(central)
+	if err != nil {
+		return nil, err
+	}
+
+	localWins := local.GetModifiedAt().After(central.GetModifiedAt())
+	merged := mergeObjects(b, l, c, localWins)
+	for key := range bookkeeping {
+		merged[key] = c[key]
+	}
+	if localWins {
+		merged["modifiedAt"] = l["modifiedAt"]
+	}
+
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return nil, err
+	}
+	result := &twin.DigitalTwin{}
+	if err := json.Unmarshal(data, result); err != nil {
+		return nil, err
+	}
+	return prepare(result), nil
+}
+
+// document returns the JSON object form of a twin, empty for nil
+func document(dt *twin.DigitalTwin) (map[string]interface{}, error) {
+	doc := make(map[string]interface{})
+	if dt == nil {
+		return doc, nil
+	}
+	data, err := json.Marshal(dt.Clone())
+	if err != nil {
+		return nil, err
+	}
+	return doc, json.Unmarshal(data, &doc)
+}
+
+// mergeObjects merges two versions of an object three ways
+func mergeObjects(base, local, central map[string]interface{}, localWins bool) map[string]interface{} {
+	merged := make(map[string]interface{})
+	keys := make(map[string]bool)
+	for _, m := range []map[string]interface{}{base, local, central} {
+		for key := range m {
+			keys[key] = true
+		}
+	}
+
+	for key := range keys {
+		b, inBase := base[key]
+		l, inLocal := local[key]
+		c, inCentral := central[key]
+
+		switch {
+		case inLocal == inCentral && reflect.DeepEqual(l, c):
+			// Same on both sides
+		case inLocal == inBase && reflect.DeepEqual(l, b):
+			// Changed centrally only
+			l, inLocal = c, inCentral
+		case inCentral == inBase && reflect.DeepEqual(c, b):
+			// Changed at the edge only
+		default:
+			lm, lok := l.(map[string]interface{})
+			cm, cok := c.(map[string]interface{})
+			if lok && cok {
+				bm, _ := b.(map[string]interface{})
+				l = mergeObjects(bm, lm, cm, localWins)
+			} else if !localWins {
+				l, inLocal = c, inCentral
+			}
+		}
+
+		if inLocal {
+			merged[key] = l
+		}
+	}
+	return merged
+}
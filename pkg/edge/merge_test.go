@@ -0,0 +1,69 @@
+package edge
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestMerge(t *testing.T) {
+	base := twin.NewDigitalTwin("ahu-1", "ahu")
+	base.SetAttribute("site", "north")
+	base.SetAttribute("floor", 2.0)
+	fan := twin.NewFeatureState()
+	fan.SetProperty("speed", 10.0)
+	fan.SetProperty("mode", "auto")
+	base.AddFeature("fan", fan)
+	base.SetRevision(3)
+
+	local := base.Clone()
+	local.SetAttribute("floor", 3.0) // Changed at the edge only
+	localFan, _ := local.GetFeature("fan")
+	localFan.SetProperty("speed", 20.0) // Changed on both sides
+	local.AddFeature("filter", twin.NewFeatureState())
+
+	central := base.Clone()
+	central.SetAttribute("site", "south") // Changed centrally only
+	central.RemoveAttribute("floor")
+	centralFan, _ := central.GetFeature("fan")
+	centralFan.SetProperty("speed", 30.0)
+	centralFan.SetProperty("mode", "manual")
+	central.SetRevision(5)
+
+	central.SetModifiedAt(time.Now())
+	local.SetModifiedAt(central.GetModifiedAt().Add(time.Second))
+
+	merged, err := merge(base, local, central)
+	if err != nil {
+		t.Fatalf("Failed to merge: %v", err)
+	}
+	if expected := map[string]interface{}{"site": "south", "floor": 3.0}; !reflect.DeepEqual(merged.GetAllAttributes(), expected) {
+		t.Errorf("Expected attributes %v, got %v", expected, merged.GetAllAttributes())
+	}
+	mergedFan, _ := merged.GetFeature("fan")
+	if expected := map[string]interface{}{"speed": 20.0, "mode": "manual"}; !reflect.DeepEqual(mergedFan.GetAllProperties(), expected) {
+		t.Errorf("Expected properties %v, got %v", expected, mergedFan.GetAllProperties())
+	}
+	if _, ok := merged.GetFeature("filter"); !ok {
+		t.Error("Expected the feature added at the edge")
+	}
+	if merged.GetRevision() != 5 {
+		t.Errorf("Expected the central revision, got %d", merged.GetRevision())
+	}
+
+	// Fields changed on both sides take the value of the twin modified last
+	local.SetModifiedAt(central.GetModifiedAt().Add(-time.Second))
+	merged, _ = merge(base, local, central)
+	mergedFan, _ = merged.GetFeature("fan")
+	if speed, _ := mergedFan.GetProperty("speed"); speed != 30.0 {
+		t.Errorf("Expected the central speed, got %v", speed)
+	}
+
+	// Without a base, everything present on one side only is kept
+	merged, _ = merge(nil, local, central)
+	if _, ok := merged.GetFeature("filter"); !ok {
+		t.Error("Expected the feature added at the edge without a base")
+	}
+}
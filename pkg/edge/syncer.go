@@ -0,0 +1,671 @@
+package edge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/eventbus"
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// Defaults for options left empty
+const (
+	DefaultPolicy     = LastWriterWins
+	DefaultInterval   = 30 * time.Second
+	DefaultBatchSize  = 100
+	DefaultMaxBackoff = 5 * time.Minute
+)
+
+// ChangesPath is the path of the push endpoint below the central API URL
+const ChangesPath = "/edge/changes"
+
+// maxResolutions is the number of recent conflict resolutions kept for the status
+const maxResolutions = 50
+
+// pushTimeout bounds a single push
+const pushTimeout = 30 * time.Second
+
+// Upstream is the connection to the central server
+type Upstream interface {
+	Push(ctx context.Context, changes []Change) ([]Result, error)
+}
+
+// HTTPUpstream pushes changes to the API of a central server
+type HTTPUpstream struct {
+	url     string
+	name    string
+	headers map[string]string
+	client  *http.Client
+}
+
+// NewHTTPUpstream creates an upstream for the API at a URL such as
+// https://central.example.com/api/v1. The name identifies the edge to the
+// central server; headers are added to every request, e.g. Authorization.
+func NewHTTPUpstream(apiURL, name string, headers map[string]string) (*HTTPUpstream, error) {
+	u, err := url.Parse(apiURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%w: central must be an http or https URL", ErrInvalidOptions)
+	}
+	return &HTTPUpstream{
+		url:     strings.TrimSuffix(apiURL, "/") + ChangesPath,
+		name:    name,
+		headers: headers,
+		client:  &http.Client{Timeout: pushTimeout},
+	}, nil
+}
+
+// Push sends changes to the central server and returns its results
+func (u *HTTPUpstream) Push(ctx context.Context, changes []Change) ([]Result, error) {
+	body, err := json.Marshal(PushRequest{Edge: u.name, Changes: changes})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range u.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var result PushResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	return result.Results, nil
+}
+
+// Options configure a syncer
+type Options struct {
+	Policy         Policy        // Conflict policy, DefaultPolicy when empty
+	Interval       time.Duration // How often pending changes are pushed, DefaultInterval when zero
+	BatchSize      int           // Changes per push, DefaultBatchSize when zero
+	MaxBackoff     time.Duration // Upper bound of the doubling delay after failed pushes, DefaultMaxBackoff when zero
+	CheckpointPath string        // File keeping pending changes and sync state across restarts, none when empty
+}
+
+// Resolution records how a conflict was resolved
+type Resolution struct {
+	TwinID string    `json:"twinId"`
+	Policy Policy    `json:"policy"`
+	Winner string    `json:"winner"` // "edge", "central" or "merged"
+	At     time.Time `json:"at"`
+}
+
+// Status reports the progress of a syncer
+type Status struct {
+	Policy    Policy       `json:"policy"`
+	Online    bool         `json:"online"`              // The last push reached the central server
+	Pending   int          `json:"pending"`             // Twins with changes not yet accepted centrally
+	Synced    int          `json:"synced"`              // Twins known to the central server
+	Pushed    int          `json:"pushed"`              // Changes applied centrally since startup
+	Conflicts int          `json:"conflicts"`           // Conflicts resolved since startup
+	Failures  int          `json:"failures"`            // Failed pushes and changes since startup
+	LastError string       `json:"lastError,omitempty"` // Error of the last failure
+	LastSync  *time.Time   `json:"lastSync,omitempty"`  // Time of the last successful push
+	RetryAt   *time.Time   `json:"retryAt,omitempty"`   // Set while backing off after a failed push
+	Recent    []Resolution `json:"recent"`              // Recent conflict resolutions, newest last
+}
+
+// state is the sync state of a twin
+type state struct {
+	Base          *twin.DigitalTwin `json:"base"`          // Central twin as of the last sync
+	LocalRevision uint64            `json:"localRevision"` // Local revision that matched it
+}
+
+// checkpoint is the file format of the checkpoint
+type checkpoint struct {
+	NextSeq uint64            `json:"nextSeq"`
+	Pending map[string]uint64 `json:"pending"`
+	States  map[string]*state `json:"states"`
+}
+
+// Syncer queues the changes of local twins and pushes them to the central
+// server. A change carries the central revision it is based on; when the
+// central twin changed since, the conflict is resolved with the policy.
+// Deletions win over concurrent changes, except that with CentralWins a
+// twin deleted at the edge is restored from the central server. Twins that
+// are missing after a restart are not deleted centrally; only deletions
+// observed while running are pushed.
+type Syncer struct {
+	registry *registry.Registry
+	pubsub   eventbus.Publisher
+	upstream Upstream
+	opts     Options
+	states   map[string]*state
+	pending  map[string]uint64 // Twin ID -> sequence number of the latest change
+	nextSeq  uint64
+	status   Status
+	backoff  time.Duration
+	dirty    bool // Sync state differs from the checkpoint
+	mutex    sync.Mutex
+	syncing  sync.Mutex // Serializes pushes
+	now      func() time.Time
+	onDelete func(twinID string)
+}
+
+// NewSyncer creates a syncer, restores its checkpoint and queues the local
+// twins changed since they were last synced
+func NewSyncer(reg *registry.Registry, pubsub eventbus.Publisher, upstream Upstream, opts Options) (*Syncer, error) {
+	if opts.Policy == "" {
+		opts.Policy = DefaultPolicy
+	}
+	if _, err := ParsePolicy(string(opts.Policy)); err != nil {
+		return nil, err
+	}
+	if opts.Interval < 0 || opts.BatchSize < 0 || opts.MaxBackoff < 0 {
+		return nil, fmt.Errorf("%w: sizes and durations must not be negative", ErrInvalidOptions)
+	}
+	if opts.Interval == 0 {
+		opts.Interval = DefaultInterval
+	}
+	if opts.BatchSize == 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if opts.MaxBackoff == 0 {
+		opts.MaxBackoff = DefaultMaxBackoff
+	}
+	if opts.MaxBackoff < opts.Interval {
+		opts.MaxBackoff = opts.Interval
+	}
+
+	s := &Syncer{
+		registry: reg,
+		pubsub:   pubsub,
+		upstream: upstream,
+		opts:     opts,
+		states:   make(map[string]*state),
+		pending:  make(map[string]uint64),
+		nextSeq:  1,
+		status:   Status{Policy: opts.Policy, Recent: []Resolution{}},
+		now:      time.Now,
+	}
+
+	if opts.CheckpointPath != "" {
+		data, err := os.ReadFile(opts.CheckpointPath)
+		switch {
+		case os.IsNotExist(err):
+		case err != nil:
+			return nil, err
+		default:
+			var cp checkpoint
+			if err := json.Unmarshal(data, &cp); err != nil {
+				return nil, fmt.Errorf("checkpoint %s: %v", opts.CheckpointPath, err)
+			}
+			for id, st := range cp.States {
+				if st != nil && st.Base != nil {
+					st.Base = prepare(st.Base)
+					s.states[id] = st
+				}
+			}
+			for id, seq := range cp.Pending {
+				s.pending[id] = seq
+			}
+			if cp.NextSeq > s.nextSeq {
+				s.nextSeq = cp.NextSeq
+			}
+		}
+	}
+
+	for _, dt := range reg.List() {
+		if st := s.states[dt.ID]; st == nil || st.LocalRevision != dt.GetRevision() {
+			s.queue(dt.ID)
+		}
+	}
+	return s, nil
+}
+
+// Options returns the options of the syncer with defaults applied
+func (s *Syncer) Options() Options {
+	return s.opts
+}
+
+// queue marks a twin as changed. The caller must hold the mutex.
+func (s *Syncer) queue(id string) {
+	s.pending[id] = s.nextSeq
+	s.nextSeq++
+	s.dirty = true
+}
+
+// HandleEvent queues the twin an event is about
+func (s *Syncer) HandleEvent(msg messaging_sim.Message) {
+	id := msg.TwinID()
+	if id == "" {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.queue(id)
+}
+
+// Run queues twins from a subscription until the channel is closed. The
+// subscription should cover all topics that change twins, such as "#".
+func (s *Syncer) Run(events <-chan messaging_sim.Message) {
+	for msg := range events {
+		s.HandleEvent(msg)
+	}
+}
+
+// Deliver pushes pending changes every interval until the context is
+// cancelled, waiting out the backoff after failed pushes. The checkpoint is
+// saved after every push.
+func (s *Syncer) Deliver(ctx context.Context) {
+	ticker := time.NewTicker(s.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if s.due() {
+				s.Sync(ctx)
+				s.Checkpoint()
+			}
+		}
+	}
+}
+
+// due reports whether changes are pending and no backoff is in effect
+func (s *Syncer) due() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.pending) == 0 {
+		return false
+	}
+	return s.status.RetryAt == nil || !s.now().Before(*s.status.RetryAt)
+}
+
+// pushed is a change in flight with what it was built from
+type pushed struct {
+	change        Change
+	seq           uint64 // Sequence number of the queued change
+	localRevision uint64
+}
+
+// Sync pushes all pending changes regardless of any backoff and returns the
+// number of changes applied centrally. Twins whose conflicts resolve in
+// favour of the edge are pushed again within the same sync.
+func (s *Syncer) Sync(ctx context.Context) (int, error) {
+	s.syncing.Lock()
+	defer s.syncing.Unlock()
+
+	applied := 0
+	attempts := make(map[string]int)
+	for {
+		batch := s.nextBatch(attempts)
+		if len(batch) == 0 {
+			return applied, nil
+		}
+
+		changes := make([]Change, len(batch))
+		byID := make(map[string]pushed, len(batch))
+		for i, p := range batch {
+			changes[i] = p.change
+			byID[p.change.TwinID] = p
+		}
+
+		results, err := s.upstream.Push(ctx, changes)
+		if err != nil {
+			s.failed(err)
+			return applied, err
+		}
+		s.reached()
+
+		for _, r := range results {
+			p, ok := byID[r.TwinID]
+			if !ok {
+				continue
+			}
+			switch r.Status {
+			case Applied:
+				s.applied(p, r)
+				applied++
+			case Conflict:
+				s.resolve(p, r.Twin)
+			default:
+				s.mutex.Lock()
+				s.status.Failures++
+				s.status.LastError = fmt.Sprintf("%s: %s", r.TwinID, r.Error)
+				s.mutex.Unlock()
+			}
+		}
+	}
+}
+
+// nextBatch builds the changes of the oldest pending twins not yet attempted
+// twice. Twins without local changes are dropped from the queue.
+func (s *Syncer) nextBatch(attempts map[string]int) []pushed {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	ids := make([]string, 0, len(s.pending))
+	for id := range s.pending {
+		if attempts[id] < 2 {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return s.pending[ids[i]] < s.pending[ids[j]] })
+
+	var batch []pushed
+	for _, id := range ids {
+		if len(batch) == s.opts.BatchSize {
+			break
+		}
+		attempts[id]++
+
+		p := pushed{change: Change{TwinID: id}, seq: s.pending[id]}
+		st := s.states[id]
+		if st != nil {
+			p.change.BaseRevision = st.Base.GetRevision()
+		}
+
+		dt, err := s.registry.Get(id)
+		switch {
+		case err == registry.ErrTwinNotFound:
+			if st == nil {
+				// Created and deleted before it was ever synced
+				delete(s.pending, id)
+				s.dirty = true
+				continue
+			}
+			p.change.Deleted = true
+		case err != nil:
+			continue
+		case st != nil && st.LocalRevision == dt.GetRevision():
+			delete(s.pending, id)
+			s.dirty = true
+			continue
+		default:
+			p.change.Twin = dt.Clone()
+			p.localRevision = p.change.Twin.GetRevision()
+		}
+		batch = append(batch, p)
+	}
+	return batch
+}
+
+// applied records a change applied centrally
+func (s *Syncer) applied(p pushed, r Result) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if p.change.Deleted {
+		delete(s.states, p.change.TwinID)
+	} else {
+		base := p.change.Twin
+		base.SetRevision(r.Revision)
+		s.states[p.change.TwinID] = &state{Base: base, LocalRevision: p.localRevision}
+	}
+	s.done(p)
+	s.status.Pushed++
+}
+
+// done removes a twin from the queue unless it changed again while it was
+// pushed. The caller must hold the mutex.
+func (s *Syncer) done(p pushed) {
+	if s.pending[p.change.TwinID] == p.seq {
+		delete(s.pending, p.change.TwinID)
+	}
+	s.dirty = true
+}
+
+// resolve settles a conflict with the central twin, which is nil when it was
+// deleted centrally
+func (s *Syncer) resolve(p pushed, central *twin.DigitalTwin) {
+	id := p.change.TwinID
+	if central != nil {
+		central = prepare(central)
+	}
+
+	s.mutex.Lock()
+	var base *twin.DigitalTwin
+	if st := s.states[id]; st != nil {
+		base = st.Base
+	}
+	s.mutex.Unlock()
+
+	var winner string
+	switch {
+	case central == nil && p.change.Deleted:
+		// Deleted on both sides
+		s.mutex.Lock()
+		delete(s.states, id)
+		s.done(p)
+		s.mutex.Unlock()
+		return
+	case central == nil:
+		winner = "central"
+	case p.change.Deleted && s.opts.Policy != CentralWins:
+		winner = "edge"
+	case p.change.Deleted || s.opts.Policy == CentralWins:
+		winner = "central"
+	case s.opts.Policy == LastWriterWins:
+		winner = "central"
+		if p.change.Twin.GetModifiedAt().After(central.GetModifiedAt()) {
+			winner = "edge"
+		}
+	default:
+		merged, err := merge(base, p.change.Twin, central)
+		if err != nil {
+			s.fail(err)
+			return
+		}
+		merged.SetRevision(p.localRevision)
+		if err := s.registry.Update(merged); err != nil {
+			// Changed locally meanwhile; the next sync resolves again
+			s.fail(err)
+			return
+		}
+		s.pubsub.Publish("twin.updated", map[string]string{"id": id})
+		winner = "merged"
+	}
+
+	switch winner {
+	case "central":
+		if err := s.takeCentral(p, central); err != nil {
+			s.fail(err)
+			return
+		}
+	default:
+		// Push again on top of the central twin
+		s.mutex.Lock()
+		if central == nil {
+			delete(s.states, id)
+		} else {
+			s.states[id] = &state{Base: central, LocalRevision: 0}
+		}
+		s.dirty = true
+		s.mutex.Unlock()
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.status.Conflicts++
+	s.status.Recent = append(s.status.Recent, Resolution{TwinID: id, Policy: s.opts.Policy, Winner: winner, At: s.now()})
+	if over := len(s.status.Recent) - maxResolutions; over > 0 {
+		s.status.Recent = append([]Resolution(nil), s.status.Recent[over:]...)
+	}
+}
+
+// SetDeleteHook sets a function called with the ID of every local twin the
+// syncer deletes because it was deleted centrally, so that the server can
+// drop what it keeps about the twin, as it does for deletes through its API
+func (s *Syncer) SetDeleteHook(fn func(twinID string)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.onDelete = fn
+}
+
+// takeCentral replaces or deletes the local twin with the central one
+func (s *Syncer) takeCentral(p pushed, central *twin.DigitalTwin) error {
+	id := p.change.TwinID
+
+	if central == nil {
+		if err := s.registry.Delete(id); err != nil && err != registry.ErrTwinNotFound {
+			return err
+		}
+
+		s.mutex.Lock()
+		onDelete := s.onDelete
+		s.mutex.Unlock()
+		if onDelete != nil {
+			onDelete(id)
+		}
+		s.pubsub.Publish("twin.deleted", map[string]string{"id": id})
+
+		s.mutex.Lock()
+		delete(s.states, id)
+		s.done(p)
+		s.mutex.Unlock()
+		return nil
+	}
+
+	local := central.Clone()
+	if p.change.Deleted {
+		if err := s.registry.Create(local); err != nil {
+			return err
+		}
+		s.pubsub.Publish("twin.created", map[string]string{"id": id})
+	} else {
+		local.SetRevision(p.localRevision)
+		if err := s.registry.Update(local); err != nil {
+			return err
+		}
+		s.pubsub.Publish("twin.updated", map[string]string{"id": id})
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.states[id] = &state{Base: central, LocalRevision: local.GetRevision()}
+	s.done(p)
+	return nil
+}
+
+// reached records that the central server answered
+func (s *Syncer) reached() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.now()
+	s.status.Online = true
+	s.status.LastSync = &now
+	s.status.RetryAt = nil
+	s.backoff = 0
+}
+
+// failed records a failed push and backs off
+func (s *Syncer) failed(err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.status.Online = false
+	s.status.Failures++
+	s.status.LastError = err.Error()
+	if s.backoff == 0 {
+		s.backoff = s.opts.Interval
+	} else if s.backoff *= 2; s.backoff > s.opts.MaxBackoff {
+		s.backoff = s.opts.MaxBackoff
+	}
+	retryAt := s.now().Add(s.backoff)
+	s.status.RetryAt = &retryAt
+}
+
+// fail records an error resolving a conflict
+func (s *Syncer) fail(err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.status.Failures++
+	s.status.LastError = err.Error()
+}
+
+// Status returns the progress of the syncer
+func (s *Syncer) Status() Status {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	status := s.status
+	status.Pending = len(s.pending)
+	status.Synced = len(s.states)
+	status.Recent = append([]Resolution{}, s.status.Recent...)
+	return status
+}
+
+// Checkpoint writes the pending changes and sync state to the checkpoint
+// file when they changed since the last checkpoint. The file is replaced
+// atomically.
+func (s *Syncer) Checkpoint() error {
+	if s.opts.CheckpointPath == "" {
+		return nil
+	}
+
+	s.mutex.Lock()
+	if !s.dirty {
+		s.mutex.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(checkpoint{NextSeq: s.nextSeq, Pending: s.pending, States: s.states})
+	s.dirty = false
+	s.mutex.Unlock()
+
+	if err == nil {
+		err = writeFile(s.opts.CheckpointPath, data)
+	}
+	if err != nil {
+		s.mutex.Lock()
+		s.dirty = true
+		s.mutex.Unlock()
+	}
+	return err
+}
+
+// writeFile replaces a file atomically
+func writeFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".edge-checkpoint-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,285 @@
+package edge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// central is a central server reached in process
+type central struct {
+	registry *registry.Registry
+	pubsub   *messaging_sim.PubSub
+	offline  bool
+	pushes   int
+}
+
+func newCentral() *central {
+	return &central{registry: registry.NewRegistry(), pubsub: messaging_sim.NewPubSub()}
+}
+
+func (c *central) Push(ctx context.Context, changes []Change) ([]Result, error) {
+	if c.offline {
+		return nil, errors.New("network unreachable")
+	}
+	c.pushes++
+
+	// Send the changes through JSON like a remote server
+	data, _ := json.Marshal(changes)
+	var received []Change
+	json.Unmarshal(data, &received)
+	results := Receive(c.registry, c.pubsub, received)
+	data, _ = json.Marshal(results)
+	results = nil
+	json.Unmarshal(data, &results)
+	return results, nil
+}
+
+// edge is an edge server syncing with a central server
+type edge struct {
+	registry *registry.Registry
+	syncer   *Syncer
+}
+
+func newEdge(t *testing.T, c *central, opts Options) *edge {
+	reg := registry.NewRegistry()
+	pubsub := messaging_sim.NewPubSub()
+	s, err := NewSyncer(reg, pubsub, c, opts)
+	if err != nil {
+		t.Fatalf("Failed to create syncer: %v", err)
+	}
+	return &edge{registry: reg, syncer: s}
+}
+
+// set writes an attribute at the edge
+func (e *edge) set(id, key string, value interface{}) {
+	dt, err := e.registry.Get(id)
+	if err == registry.ErrTwinNotFound {
+		dt = twin.NewDigitalTwin(id, "pump")
+		e.registry.Create(dt)
+	}
+	dt.SetAttribute(key, value)
+	e.registry.Update(dt)
+	e.syncer.HandleEvent(messaging_sim.Message{Topic: "twin.updated", Payload: map[string]string{"id": id}})
+}
+
+// set writes an attribute on the central server
+func (c *central) set(id, key string, value interface{}) {
+	dt, _ := c.registry.Get(id)
+	dt.SetAttribute(key, value)
+	c.registry.Update(dt)
+}
+
+func attribute(reg *registry.Registry, id, key string) interface{} {
+	dt, err := reg.Get(id)
+	if err != nil {
+		return nil
+	}
+	value, _ := dt.GetAttribute(key)
+	return value
+}
+
+func TestStoreAndForward(t *testing.T) {
+	c := newCentral()
+	c.offline = true
+	e := newEdge(t, c, Options{})
+
+	e.set("pump-1", "speed", 10.0)
+	e.set("pump-1", "speed", 20.0)
+	e.set("pump-2", "speed", 5.0)
+	if _, err := e.syncer.Sync(context.Background()); err == nil {
+		t.Fatal("Expected the push to fail while offline")
+	}
+	status := e.syncer.Status()
+	if status.Online || status.Pending != 2 || status.RetryAt == nil || e.syncer.due() {
+		t.Errorf("Expected the changes to be kept while backing off, got %+v", status)
+	}
+
+	c.offline = false
+	if n, err := e.syncer.Sync(context.Background()); err != nil || n != 2 {
+		t.Fatalf("Expected two changes to be pushed, got %d (%v)", n, err)
+	}
+	if attribute(c.registry, "pump-1", "speed") != 20.0 || attribute(c.registry, "pump-2", "speed") != 5.0 {
+		t.Error("Expected the latest values on the central server")
+	}
+	status = e.syncer.Status()
+	if !status.Online || status.Pending != 0 || status.Synced != 2 || status.RetryAt != nil {
+		t.Errorf("Unexpected status %+v", status)
+	}
+
+	// Unchanged twins are not pushed again
+	e.syncer.HandleEvent(messaging_sim.Message{Topic: "twin.updated", Payload: map[string]string{"id": "pump-1"}})
+	pushes := c.pushes
+	e.syncer.Sync(context.Background())
+	if c.pushes != pushes {
+		t.Error("Expected no push for an unchanged twin")
+	}
+
+	// Deletions are pushed
+	e.registry.Delete("pump-2")
+	e.syncer.HandleEvent(messaging_sim.Message{Topic: "twin.deleted", Payload: map[string]string{"id": "pump-2"}})
+	e.syncer.Sync(context.Background())
+	if _, err := c.registry.Get("pump-2"); err != registry.ErrTwinNotFound {
+		t.Error("Expected the twin to be deleted centrally")
+	}
+}
+
+func TestConflicts(t *testing.T) {
+	for _, c := range []struct {
+		policy  Policy
+		edgeNew bool
+		speed   float64
+		site    interface{}
+		winner  string
+	}{
+		{LastWriterWins, true, 20, "north", "edge"},
+		{LastWriterWins, false, 30, "south", "central"},
+		{CentralWins, true, 30, "south", "central"},
+		{Merge, true, 20, "south", "merged"},
+		{Merge, false, 30, "south", "merged"},
+	} {
+		central := newCentral()
+		e := newEdge(t, central, Options{Policy: c.policy})
+		e.set("pump-1", "speed", 10.0)
+		e.set("pump-1", "site", "north")
+		e.syncer.Sync(context.Background())
+
+		// Both sides change the twin while disconnected
+		if c.edgeNew {
+			central.set("pump-1", "speed", 30.0)
+			central.set("pump-1", "site", "south")
+			time.Sleep(time.Millisecond)
+			e.set("pump-1", "speed", 20.0)
+		} else {
+			e.set("pump-1", "speed", 20.0)
+			time.Sleep(time.Millisecond)
+			central.set("pump-1", "speed", 30.0)
+			central.set("pump-1", "site", "south")
+		}
+
+		if _, err := e.syncer.Sync(context.Background()); err != nil {
+			t.Fatalf("%s: sync failed: %v", c.policy, err)
+		}
+		for name, reg := range map[string]*registry.Registry{"edge": e.registry, "central": central.registry} {
+			if speed := attribute(reg, "pump-1", "speed"); speed != c.speed {
+				t.Errorf("%s: expected speed %v at the %s, got %v", c.policy, c.speed, name, speed)
+			}
+			if site := attribute(reg, "pump-1", "site"); site != c.site {
+				t.Errorf("%s: expected site %v at the %s, got %v", c.policy, c.site, name, site)
+			}
+		}
+		status := e.syncer.Status()
+		if status.Conflicts != 1 || status.Recent[0].Winner != c.winner || status.Pending != 0 {
+			t.Errorf("%s: unexpected status %+v", c.policy, status)
+		}
+
+		// Nothing is left to push
+		pushes := central.pushes
+		e.syncer.HandleEvent(messaging_sim.Message{Topic: "twin.updated", Payload: map[string]string{"id": "pump-1"}})
+		e.syncer.Sync(context.Background())
+		if central.pushes != pushes {
+			t.Errorf("%s: expected both sides to agree after the sync", c.policy)
+		}
+	}
+}
+
+func TestDeletionConflicts(t *testing.T) {
+	c := newCentral()
+	e := newEdge(t, c, Options{Policy: Merge})
+	var deleted []string
+	e.syncer.SetDeleteHook(func(twinID string) { deleted = append(deleted, twinID) })
+	e.set("pump-1", "speed", 10.0)
+	e.set("pump-2", "speed", 10.0)
+	e.syncer.Sync(context.Background())
+
+	// Deleted centrally while changed at the edge
+	c.registry.Delete("pump-1")
+	e.set("pump-1", "speed", 20.0)
+
+	// Deleted at the edge while changed centrally
+	c.set("pump-2", "speed", 30.0)
+	e.registry.Delete("pump-2")
+	e.syncer.HandleEvent(messaging_sim.Message{Topic: "twin.deleted", Payload: map[string]string{"id": "pump-2"}})
+
+	e.syncer.Sync(context.Background())
+	for _, id := range []string{"pump-1", "pump-2"} {
+		if _, err := e.registry.Get(id); err != registry.ErrTwinNotFound {
+			t.Errorf("Expected %s to be deleted at the edge", id)
+		}
+		if _, err := c.registry.Get(id); err != registry.ErrTwinNotFound {
+			t.Errorf("Expected %s to be deleted centrally", id)
+		}
+	}
+	if status := e.syncer.Status(); status.Pending != 0 || status.Synced != 0 {
+		t.Errorf("Unexpected status %+v", status)
+	}
+
+	// The server forgets the twin deleted by the syncer
+	if len(deleted) != 1 || deleted[0] != "pump-1" {
+		t.Errorf("Expected the delete hook to be called for pump-1, got %v", deleted)
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	c := newCentral()
+	path := filepath.Join(t.TempDir(), "edge.json")
+	e := newEdge(t, c, Options{CheckpointPath: path})
+	e.set("pump-1", "speed", 10.0)
+	e.syncer.Sync(context.Background())
+	c.offline = true
+	e.set("pump-1", "speed", 20.0)
+	if err := e.syncer.Checkpoint(); err != nil {
+		t.Fatalf("Failed to write checkpoint: %v", err)
+	}
+
+	// A restarted edge keeps the base revision and the queued change
+	restarted, err := NewSyncer(e.registry, messaging_sim.NewPubSub(), c, Options{CheckpointPath: path})
+	if err != nil {
+		t.Fatalf("Failed to restore checkpoint: %v", err)
+	}
+	if status := restarted.Status(); status.Pending != 1 || status.Synced != 1 {
+		t.Errorf("Unexpected status %+v", status)
+	}
+	c.offline = false
+	if n, _ := restarted.Sync(context.Background()); n != 1 || attribute(c.registry, "pump-1", "speed") != 20.0 {
+		t.Errorf("Expected the queued change to be pushed without a conflict, got %+v", restarted.Status())
+	}
+}
+
+func TestHTTPUpstream(t *testing.T) {
+	reg := registry.NewRegistry()
+	central := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/edge/changes" || r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		var req PushRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		json.NewEncoder(w).Encode(PushResponse{Results: Receive(reg, messaging_sim.NewPubSub(), req.Changes)})
+	}))
+	defer central.Close()
+
+	if _, err := NewHTTPUpstream("ftp://central", "edge-1", nil); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("Expected ErrInvalidOptions, got %v", err)
+	}
+
+	upstream, _ := NewHTTPUpstream(central.URL+"/api/v1/", "edge-1", map[string]string{"Authorization": "Bearer secret"})
+	results, err := upstream.Push(context.Background(), []Change{{TwinID: "pump-1", Twin: twin.NewDigitalTwin("pump-1", "pump")}})
+	if err != nil || len(results) != 1 || results[0].Status != Applied {
+		t.Fatalf("Unexpected results %+v (%v)", results, err)
+	}
+
+	upstream, _ = NewHTTPUpstream(central.URL, "edge-1", nil)
+	if _, err := upstream.Push(context.Background(), nil); err == nil {
+		t.Error("Expected an error for a failed request")
+	}
+}
@@ -0,0 +1,335 @@
+package energy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/eventbus"
+	"github.com/aleka07/go-digital-twin/pkg/history"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// Common errors
+var (
+	ErrRollupNotFound = errors.New("energy rollup not found")
+	ErrInvalidConfig  = errors.New("invalid energy rollup configuration")
+)
+
+// DefaultInterval is how often rollups are recomputed
+const DefaultInterval = time.Minute
+
+// SourcesProperty is the property of the target feature holding the number of
+// contained twins that contributed a value
+const SourcesProperty = "sources"
+
+// Config names the containment relationship and the features and properties
+// that are rolled up along it
+type Config struct {
+	Relationship  string   `json:"relationship"`  // Relationship from a parent to the twins it contains
+	SourceFeature string   `json:"sourceFeature"` // Feature holding measured values, such as meters of rooms
+	Properties    []string `json:"properties"`    // Numeric properties summed up the hierarchy
+	TargetFeature string   `json:"targetFeature"` // Computed feature written to parent twins
+}
+
+// DefaultConfig is used until another configuration is set
+var DefaultConfig = Config{
+	Relationship:  "contains",
+	SourceFeature: "energy",
+	Properties:    []string{"power", "energy"},
+	TargetFeature: "energyRollup",
+}
+
+// Validate checks that all names are set and the target feature differs from
+// the source feature, so rollups never feed into themselves
+func (c Config) Validate() error {
+	names := []struct{ field, value string }{
+		{"relationship", c.Relationship},
+		{"sourceFeature", c.SourceFeature},
+		{"targetFeature", c.TargetFeature},
+	}
+	for _, n := range names {
+		if n.value == "" {
+			return fmt.Errorf("%w: %s is required", ErrInvalidConfig, n.field)
+		}
+	}
+	if c.TargetFeature == c.SourceFeature {
+		return fmt.Errorf("%w: targetFeature must differ from sourceFeature", ErrInvalidConfig)
+	}
+	if len(c.Properties) == 0 {
+		return fmt.Errorf("%w: at least one property is required", ErrInvalidConfig)
+	}
+	for _, p := range c.Properties {
+		if p == "" || p == SourcesProperty {
+			return fmt.Errorf("%w: invalid property %q", ErrInvalidConfig, p)
+		}
+	}
+	return nil
+}
+
+// Rollup is the computed total of a parent twin over all twins it contains,
+// directly or through intermediate twins
+type Rollup struct {
+	TwinID     string             `json:"twinId"`
+	Values     map[string]float64 `json:"values"`
+	Sources    int                `json:"sources"`  // Contained twins that contributed a value
+	Children   []string           `json:"children"` // Directly contained twins
+	ComputedAt time.Time          `json:"computedAt"`
+}
+
+// Aggregator rolls energy and power values up the containment hierarchy,
+// e.g. from rooms to floors to buildings, and stores the totals as a computed
+// feature of every parent twin
+type Aggregator struct {
+	registry *registry.Registry
+	pubsub   eventbus.Publisher
+	history  *history.Store
+	config   Config
+	rollups  map[string]Rollup // Parent twin ID -> last computed rollup
+	mutex    sync.RWMutex
+	now      func() time.Time
+}
+
+// NewAggregator creates an aggregator using DefaultConfig
+func NewAggregator(reg *registry.Registry, pubsub eventbus.Publisher, hist *history.Store) *Aggregator {
+	return &Aggregator{
+		registry: reg,
+		pubsub:   pubsub,
+		history:  hist,
+		config:   DefaultConfig,
+		rollups:  make(map[string]Rollup),
+		now:      time.Now,
+	}
+}
+
+// Config returns the configuration rollups are computed with
+func (a *Aggregator) Config() Config {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	return a.config
+}
+
+// SetConfig replaces the configuration rollups are computed with. It takes
+// effect with the next recomputation.
+func (a *Aggregator) SetConfig(config Config) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.config = config
+	return nil
+}
+
+// Get returns the last computed rollup of a parent twin
+func (a *Aggregator) Get(twinID string) (Rollup, error) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	rollup, exists := a.rollups[twinID]
+	if !exists {
+		return Rollup{}, ErrRollupNotFound
+	}
+	return rollup, nil
+}
+
+// List returns the last computed rollups sorted by twin ID
+func (a *Aggregator) List() []Rollup {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	result := make([]Rollup, 0, len(a.rollups))
+	for _, rollup := range a.rollups {
+		result = append(result, rollup)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].TwinID < result[j].TwinID })
+	return result
+}
+
+// Recompute computes the rollups of all twins that contain other twins. Each
+// contained twin counts once per parent, even when it is reachable along
+// several paths, and cycles terminate. The values of decommissioned twins
+// and relationships to twins that do not exist are ignored. Totals that
+// changed are written to the target feature of the parent, recorded in
+// history and published as a properties.updated event.
+func (a *Aggregator) Recompute() []Rollup {
+	config := a.Config()
+	now := a.now()
+
+	twins := make(map[string]*twin.DigitalTwin)
+	for _, dt := range a.registry.List() {
+		twins[dt.ID] = dt
+	}
+
+	// Values measured by each twin
+	measured := make(map[string]map[string]float64)
+	for id, dt := range twins {
+		if dt.GetLifecycle() == twin.LifecycleDecommissioned {
+			continue
+		}
+		feature, exists := dt.GetFeature(config.SourceFeature)
+		if !exists {
+			continue
+		}
+		values := make(map[string]float64)
+		for _, key := range config.Properties {
+			if value, exists := feature.GetProperty(key); exists {
+				if f, ok := toFloat(value); ok {
+					values[key] = f
+				}
+			}
+		}
+		if len(values) > 0 {
+			measured[id] = values
+		}
+	}
+
+	rollups := make(map[string]Rollup)
+	for id, dt := range twins {
+		children := existing(twins, dt.GetRelationship(config.Relationship))
+		if len(children) == 0 {
+			continue
+		}
+
+		rollup := Rollup{
+			TwinID:     id,
+			Values:     make(map[string]float64, len(config.Properties)),
+			Children:   children,
+			ComputedAt: now,
+		}
+		for _, key := range config.Properties {
+			rollup.Values[key] = 0
+		}
+		for _, contained := range descendants(twins, id, config.Relationship) {
+			values, exists := measured[contained]
+			if !exists {
+				continue
+			}
+			for key, value := range values {
+				rollup.Values[key] += value
+			}
+			rollup.Sources++
+		}
+
+		a.store(dt, config, rollup)
+		rollups[id] = rollup
+	}
+
+	a.mutex.Lock()
+	a.rollups = rollups
+	a.mutex.Unlock()
+
+	return a.List()
+}
+
+// store writes a rollup to the target feature of its twin if it changed
+func (a *Aggregator) store(dt *twin.DigitalTwin, config Config, rollup Rollup) {
+	feature, exists := dt.GetFeature(config.TargetFeature)
+	if !exists {
+		feature = twin.NewFeatureState()
+		if err := dt.AddFeature(config.TargetFeature, feature); err == twin.ErrFeatureAlreadyExists {
+			feature, _ = dt.GetFeature(config.TargetFeature)
+		}
+	}
+
+	changed := make(map[string]interface{})
+	set := func(key string, value interface{}) {
+		if current, exists := feature.GetProperty(key); exists && fmt.Sprint(current) == fmt.Sprint(value) {
+			return
+		}
+		feature.SetPropertyAt(key, value, rollup.ComputedAt)
+		a.history.Record(dt.ID, config.TargetFeature, key, value, rollup.ComputedAt)
+		changed[key] = value
+	}
+	for _, key := range config.Properties {
+		set(key, rollup.Values[key])
+	}
+	set(SourcesProperty, rollup.Sources)
+
+	if len(changed) == 0 {
+		return
+	}
+	a.registry.Update(dt)
+
+	a.pubsub.Publish("properties.updated", eventbus.PropertiesUpdated{
+		TwinID:     dt.ID,
+		FeatureID:  config.TargetFeature,
+		Properties: changed,
+	})
+}
+
+// existing returns the IDs that refer to twins in the snapshot, sorted
+func existing(twins map[string]*twin.DigitalTwin, ids []string) []string {
+	var result []string
+	for _, id := range ids {
+		if _, exists := twins[id]; exists {
+			result = append(result, id)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// descendants returns every twin reachable from start along the relationship,
+// excluding start itself
+func descendants(twins map[string]*twin.DigitalTwin, start, relationship string) []string {
+	visited := map[string]bool{start: true}
+	queue := []string{start}
+	var result []string
+
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+
+		for _, child := range existing(twins, twins[id].GetRelationship(relationship)) {
+			if visited[child] {
+				continue
+			}
+			visited[child] = true
+			result = append(result, child)
+			queue = append(queue, child)
+		}
+	}
+	return result
+}
+
+// Run recomputes rollups at the given interval until the context is cancelled
+func (a *Aggregator) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.Recompute()
+		}
+	}
+}
+
+// toFloat converts numeric values to float64
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	default:
+		return 0, false
+	}
+}
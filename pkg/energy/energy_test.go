@@ -0,0 +1,156 @@
+package energy
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/history"
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// newBuilding creates a building with two floors of rooms with meters
+func newBuilding(t *testing.T, reg *registry.Registry) {
+	add := func(id, twinType string, power float64, children ...string) {
+		dt := twin.NewDigitalTwin(id, twinType)
+		if power > 0 {
+			meter := twin.NewFeatureState()
+			meter.SetProperty("power", power)
+			meter.SetProperty("energy", power*10)
+			dt.AddFeature("energy", meter)
+		}
+		for _, child := range children {
+			dt.AddRelationship("contains", child)
+		}
+		if err := reg.Create(dt); err != nil {
+			t.Fatalf("Failed to create twin %s: %v", id, err)
+		}
+	}
+
+	add("building", "building", 0, "floor-1", "floor-2")
+	add("floor-1", "floor", 0, "room-1", "room-2")
+	add("floor-2", "floor", 0, "room-3", "missing")
+	add("room-1", "room", 1.5)
+	add("room-2", "room", 2.5)
+	add("room-3", "room", 4)
+}
+
+func TestConfig(t *testing.T) {
+	a := NewAggregator(registry.NewRegistry(), messaging_sim.NewPubSub(), history.NewStore(10))
+
+	invalid := []Config{
+		{SourceFeature: "energy", Properties: []string{"power"}, TargetFeature: "rollup"},
+		{Relationship: "contains", SourceFeature: "energy", Properties: []string{"power"}, TargetFeature: "energy"},
+		{Relationship: "contains", SourceFeature: "energy", TargetFeature: "rollup"},
+		{Relationship: "contains", SourceFeature: "energy", Properties: []string{SourcesProperty}, TargetFeature: "rollup"},
+	}
+	for _, config := range invalid {
+		if err := a.SetConfig(config); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("Expected ErrInvalidConfig for %+v, got %v", config, err)
+		}
+	}
+
+	config := Config{Relationship: "hasPart", SourceFeature: "meter", Properties: []string{"kw"}, TargetFeature: "total"}
+	if err := a.SetConfig(config); err != nil {
+		t.Fatalf("Failed to set config: %v", err)
+	}
+	if got := a.Config(); got.Relationship != "hasPart" || got.TargetFeature != "total" {
+		t.Errorf("Expected the new config, got %+v", got)
+	}
+}
+
+func TestRecompute(t *testing.T) {
+	reg := registry.NewRegistry()
+	pubsub := messaging_sim.NewPubSub()
+	events := pubsub.SubscribeWithBuffer("properties.updated", 10)
+	hist := history.NewStore(10)
+	newBuilding(t, reg)
+
+	now := time.Now()
+	a := NewAggregator(reg, pubsub, hist)
+	a.now = func() time.Time { return now }
+
+	rollups := a.Recompute()
+	if len(rollups) != 3 {
+		t.Fatalf("Expected rollups of the building and both floors, got %+v", rollups)
+	}
+
+	building, err := a.Get("building")
+	if err != nil {
+		t.Fatalf("Failed to get rollup: %v", err)
+	}
+	if building.Values["power"] != 8 || building.Values["energy"] != 80 || building.Sources != 3 {
+		t.Errorf("Expected the building to total all rooms, got %+v", building)
+	}
+	if floor, _ := a.Get("floor-2"); floor.Values["power"] != 4 || len(floor.Children) != 1 {
+		t.Errorf("Expected missing twins to be ignored, got %+v", floor)
+	}
+	if _, err := a.Get("room-1"); err != ErrRollupNotFound {
+		t.Errorf("Expected ErrRollupNotFound for a room, got %v", err)
+	}
+
+	dt, _ := reg.Get("building")
+	feature, exists := dt.GetFeature("energyRollup")
+	if !exists {
+		t.Fatal("Expected the computed feature on the building")
+	}
+	if power, _ := feature.GetProperty("power"); power != 8.0 {
+		t.Errorf("Expected computed power 8, got %v", power)
+	}
+	if samples := hist.Query("building", "energyRollup", "power", now.Add(-time.Second), now.Add(time.Second)); len(samples) != 1 {
+		t.Errorf("Expected 1 history sample, got %d", len(samples))
+	}
+	if len(events) != 3 {
+		t.Errorf("Expected 3 events, got %d", len(events))
+	}
+
+	// Unchanged totals are not written again
+	for len(events) > 0 {
+		<-events
+	}
+	a.Recompute()
+	if len(events) != 0 {
+		t.Errorf("Expected no events for unchanged totals, got %d", len(events))
+	}
+
+	// A changed meter updates the floor and the building
+	room, _ := reg.Get("room-1")
+	meter, _ := room.GetFeature("energy")
+	meter.SetProperty("power", 3.5)
+	a.now = func() time.Time { return now.Add(time.Minute) }
+	a.Recompute()
+
+	if building, _ := a.Get("building"); building.Values["power"] != 10 {
+		t.Errorf("Expected building power 10, got %v", building.Values["power"])
+	}
+	if len(events) != 2 {
+		t.Errorf("Expected events for floor-1 and the building, got %d", len(events))
+	}
+	if samples := hist.Query("building", "energyRollup", "power", now.Add(-time.Second), now.Add(time.Hour)); len(samples) != 2 {
+		t.Errorf("Expected 2 history samples, got %d", len(samples))
+	}
+}
+
+func TestRecomputeCountsTwinsOnce(t *testing.T) {
+	reg := registry.NewRegistry()
+	newBuilding(t, reg)
+
+	// room-1 is reachable along two paths and the building is in a cycle
+	building, _ := reg.Get("building")
+	building.AddRelationship("contains", "room-1")
+	room, _ := reg.Get("room-1")
+	room.AddRelationship("contains", "building")
+
+	retired, _ := reg.Get("room-2")
+	retired.SetLifecycle(twin.LifecycleDecommissioned)
+
+	a := NewAggregator(reg, messaging_sim.NewPubSub(), history.NewStore(10))
+	a.Recompute()
+
+	rollup, _ := a.Get("building")
+	if rollup.Values["power"] != 5.5 || rollup.Sources != 2 {
+		t.Errorf("Expected each active room to count once, got %+v", rollup)
+	}
+}
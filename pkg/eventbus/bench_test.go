@@ -0,0 +1,48 @@
+package eventbus
+
+import (
+	"testing"
+)
+
+// BenchmarkBridgePublish measures publishing a property event on a bridge
+// and encoding it for the broker
+func BenchmarkBridgePublish(b *testing.B) {
+	bus, err := NewBridge(newMemoryBroker(), MQTT)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer bus.Close()
+
+	payload := PropertiesUpdated{TwinID: "pump-1", FeatureID: "status", Properties: map[string]interface{}{"pressure": 2.5}}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bus.Publish("properties.updated", payload)
+	}
+}
+
+// BenchmarkBridgeReceive measures decoding an event received from the broker
+// and delivering it to a subscriber
+func BenchmarkBridgeReceive(b *testing.B) {
+	broker := newMemoryBroker()
+	bus, err := NewBridge(broker, MQTT)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer bus.Close()
+
+	ch := bus.SubscribeWithBuffer("properties.updated", 1024)
+	go func() {
+		for range ch {
+		}
+	}()
+
+	data := []byte(`{"topic":"properties.updated","payload":{"twinId":"pump-1","featureId":"status","properties":{"pressure":2.5}},"priority":1,"origin":"remote"}`)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		broker.Publish("dt/properties/updated", data)
+	}
+}
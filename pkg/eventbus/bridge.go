@@ -0,0 +1,398 @@
+package eventbus
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// defaultBuffer is the buffer of subscriptions made with Subscribe
+const defaultBuffer = 10
+
+// Transport carries encoded events to and from a message broker. Adapters
+// of MQTT, NATS or Kafka clients implement it around the publish and
+// subscribe calls of the client, in topics and patterns of its Dialect.
+type Transport interface {
+	Publish(topic string, data []byte) error
+	// Subscribe calls handle for the messages of the topics matching a
+	// pattern until the returned function is called
+	Subscribe(pattern string, handle func(topic string, data []byte)) (func(), error)
+	Close() error
+}
+
+// Dialect maps event topics and subscription patterns to those of a broker
+type Dialect struct {
+	Name        string
+	Prefix      string // Topic level prepended to event topics, such as "dt"
+	Separator   string // Separates topic levels
+	SingleLevel string // Wildcard matching one level
+	MultiLevel  string // Trailing wildcard matching the remaining levels
+	Regexp      bool   // Patterns are regular expressions rather than wildcards
+}
+
+// Dialects of common brokers
+var (
+	MQTT  = Dialect{Name: "mqtt", Prefix: "dt", Separator: "/", SingleLevel: "+", MultiLevel: "#"}
+	NATS  = Dialect{Name: "nats", Prefix: "dt", Separator: ".", SingleLevel: "*", MultiLevel: ">"}
+	Kafka = Dialect{Name: "kafka", Prefix: "dt", Separator: ".", Regexp: true}
+)
+
+// Topic returns the broker topic of an event topic
+func (d Dialect) Topic(topic string) string {
+	topic = strings.ReplaceAll(topic, ".", d.Separator)
+	if d.Prefix != "" {
+		topic = d.Prefix + d.Separator + topic
+	}
+	return topic
+}
+
+// Pattern returns the broker pattern of a subscription pattern. Patterns
+// ending in "#" also match their parent level, as on the in-process bus;
+// where the broker wildcard does not, events of the parent level are missed.
+func (d Dialect) Pattern(pattern string) string {
+	levels := strings.Split(pattern, ".")
+	if d.Prefix != "" {
+		levels = append([]string{d.Prefix}, levels...)
+	}
+
+	if d.Regexp {
+		var b strings.Builder
+		b.WriteString("^")
+		for i, level := range levels {
+			sep := ""
+			if i > 0 {
+				sep = regexp.QuoteMeta(d.Separator)
+			}
+			switch level {
+			case "#":
+				b.WriteString("(" + sep + ".*)?")
+			case "+":
+				b.WriteString(sep + "[^" + regexp.QuoteMeta(d.Separator) + "]+")
+			default:
+				b.WriteString(sep + regexp.QuoteMeta(level))
+			}
+		}
+		b.WriteString("$")
+		return b.String()
+	}
+
+	for i, level := range levels {
+		switch level {
+		case "#":
+			levels[i] = d.MultiLevel
+		case "+":
+			levels[i] = d.SingleLevel
+		}
+	}
+	return strings.Join(levels, d.Separator)
+}
+
+// EventTopic returns the event topic of a broker topic, and false for
+// topics outside of the prefix
+func (d Dialect) EventTopic(topic string) (string, bool) {
+	if d.Prefix != "" {
+		rest, ok := strings.CutPrefix(topic, d.Prefix+d.Separator)
+		if !ok {
+			return "", false
+		}
+		topic = rest
+	}
+	return strings.ReplaceAll(topic, d.Separator, "."), topic != ""
+}
+
+// envelope is the wire format of an event
+type envelope struct {
+	Topic    string          `json:"topic"`
+	Payload  json.RawMessage `json:"payload"`
+	Priority Priority        `json:"priority"`
+	Origin   string          `json:"origin"` // Bridge that published the event
+}
+
+// outgoing is an envelope to send, whose payload is encoded along with it
+type outgoing struct {
+	Topic    string      `json:"topic"`
+	Payload  interface{} `json:"payload"`
+	Priority Priority    `json:"priority"`
+	Origin   string      `json:"origin"`
+}
+
+// bridgeSub is a subscription of a bridge
+type bridgeSub struct {
+	pattern string
+	ch      chan Message
+	stop    func() bool // Stops the cleanup of a subscription bound to a context
+	seq     *Sequencer
+}
+
+// Bridge is a Bus whose events are exchanged with other servers through a
+// message broker. Events published on a bridge are delivered to its own
+// subscribers right away and sent to the broker as JSON; events received
+// from the broker are delivered with their payload decoded from JSON, so
+// subscribers see maps rather than the Go types they were published with.
+// Bridges do not prioritize; priority subscriptions deliver in order.
+type Bridge struct {
+	transport   Transport
+	dialect     Dialect
+	origin      string
+	unsubscribe func()
+	subs        []bridgeSub
+	state       State
+	done        chan struct{} // Closed once the bridge is closed
+	dropped     atomic.Uint64
+	failed      atomic.Uint64
+	mutex       sync.RWMutex
+}
+
+// NewBridge creates a bridge exchanging all events under the prefix of a
+// dialect through a transport
+func NewBridge(transport Transport, dialect Dialect) (*Bridge, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	b := &Bridge{transport: transport, dialect: dialect, origin: hex.EncodeToString(id), done: make(chan struct{})}
+	unsubscribe, err := transport.Subscribe(dialect.Pattern("#"), b.receive)
+	if err != nil {
+		return nil, err
+	}
+	b.unsubscribe = unsubscribe
+	return b, nil
+}
+
+// Publish delivers an event to the subscribers of the bridge and sends it
+// to the broker. The receipt covers the subscribers of the bridge only.
+// Send failures are logged, counted and returned after local delivery.
+// Publishing to a closed bridge does nothing and returns ErrBusClosed.
+func (b *Bridge) Publish(topic string, payload interface{}) (Receipt, error) {
+	if err := b.Err(); err != nil {
+		return Receipt{}, err
+	}
+	receipt := b.deliver(Message{Topic: topic, Payload: payload, Priority: PriorityNormal})
+
+	if err := b.send(topic, payload); err != nil {
+		b.failed.Add(1)
+		log.Printf("Failed to send event %s to the %s broker: %v", topic, b.dialect.Name, err)
+		return receipt, err
+	}
+	return receipt, nil
+}
+
+// send encodes an event and publishes it through the transport
+func (b *Bridge) send(topic string, payload interface{}) error {
+	data, err := json.Marshal(outgoing{Topic: topic, Payload: payload, Priority: PriorityNormal, Origin: b.origin})
+	if err != nil {
+		return err
+	}
+	return b.transport.Publish(b.dialect.Topic(topic), data)
+}
+
+// receive delivers an event received from the broker, unless the bridge
+// published it itself
+func (b *Bridge) receive(topic string, data []byte) {
+	var e envelope
+	if err := json.Unmarshal(data, &e); err != nil {
+		log.Printf("Ignoring invalid event on %s: %v", topic, err)
+		return
+	}
+	if e.Origin == b.origin {
+		return
+	}
+	if e.Topic == "" {
+		var ok bool
+		if e.Topic, ok = b.dialect.EventTopic(topic); !ok {
+			return
+		}
+	}
+
+	var payload interface{}
+	if len(e.Payload) > 0 {
+		if err := json.Unmarshal(e.Payload, &payload); err != nil {
+			log.Printf("Ignoring invalid payload of event %s: %v", e.Topic, err)
+			return
+		}
+	}
+	b.deliver(Message{Topic: e.Topic, Payload: payload, Priority: e.Priority})
+}
+
+// deliver sends a message to the matching subscriptions without blocking,
+// numbering it for each of them
+func (b *Bridge) deliver(msg Message) Receipt {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	var receipt Receipt
+	for _, sub := range b.subs {
+		if !TopicMatches(sub.pattern, msg.Topic) {
+			continue
+		}
+		ch := sub.ch
+		queued := sub.seq.Deliver(msg, func(msg Message) bool {
+			select {
+			case ch <- msg:
+				return true
+			default:
+				return false
+			}
+		})
+		if queued {
+			receipt.Delivered++
+		} else {
+			receipt.Dropped++
+			b.dropped.Add(1)
+		}
+	}
+	return receipt
+}
+
+// Subscribe subscribes with a small buffer
+func (b *Bridge) Subscribe(pattern string) chan Message {
+	return b.SubscribeWithBuffer(pattern, defaultBuffer)
+}
+
+// SubscribeWithBuffer subscribes with a buffer of size messages
+func (b *Bridge) SubscribeWithBuffer(pattern string, size int) chan Message {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	ch := make(chan Message, size)
+	if b.state != StateRunning {
+		close(ch)
+		return ch
+	}
+	b.subs = append(b.subs, bridgeSub{pattern: pattern, ch: ch, seq: NewSequencer()})
+	return ch
+}
+
+// SubscribeWithPriority subscribes with a buffer of size messages per
+// priority, delivered in order
+func (b *Bridge) SubscribeWithPriority(pattern string, size int) chan Message {
+	return b.SubscribeWithBuffer(pattern, size*(int(PriorityHigh)+1))
+}
+
+// SubscribeContext subscribes with a buffer of size messages until ctx is
+// done, then unsubscribes and closes the channel
+func (b *Bridge) SubscribeContext(ctx context.Context, pattern string, size int) chan Message {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	ch := make(chan Message, size)
+	if b.state != StateRunning {
+		close(ch)
+		return ch
+	}
+	stop := context.AfterFunc(ctx, func() {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+
+		if _, ok := b.remove(pattern, ch); ok {
+			close(ch)
+		}
+	})
+	b.subs = append(b.subs, bridgeSub{pattern: pattern, ch: ch, stop: stop, seq: NewSequencer()})
+	return ch
+}
+
+// Unsubscribe ends a subscription without closing its channel
+func (b *Bridge) Unsubscribe(pattern string, ch chan Message) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if sub, ok := b.remove(pattern, ch); ok && sub.stop != nil {
+		sub.stop()
+	}
+}
+
+// remove removes a subscription and returns it; the caller must hold the
+// mutex
+func (b *Bridge) remove(pattern string, ch chan Message) (bridgeSub, bool) {
+	for i, sub := range b.subs {
+		if sub.pattern == pattern && sub.ch == ch {
+			b.subs = append(b.subs[:i], b.subs[i+1:]...)
+			return sub, true
+		}
+	}
+	return bridgeSub{}, false
+}
+
+// Close stops receiving from the broker, closes the transport and the
+// channels of all subscriptions. Closing a closed bridge does nothing.
+func (b *Bridge) Close() {
+	b.mutex.Lock()
+	if b.state != StateRunning {
+		b.mutex.Unlock()
+		<-b.done
+		return
+	}
+	b.state = StateClosing
+	subs := b.subs
+	b.subs = nil
+	b.mutex.Unlock()
+
+	b.unsubscribe()
+	if err := b.transport.Close(); err != nil {
+		log.Printf("Failed to close the %s transport: %v", b.dialect.Name, err)
+	}
+	for _, sub := range subs {
+		if sub.stop != nil {
+			sub.stop()
+		}
+		close(sub.ch)
+	}
+
+	b.mutex.Lock()
+	b.state = StateClosed
+	b.mutex.Unlock()
+	close(b.done)
+}
+
+// State returns the lifecycle state of the bridge
+func (b *Bridge) State() State {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	return b.state
+}
+
+// Done returns a channel that is closed once the bridge is closed
+func (b *Bridge) Done() <-chan struct{} {
+	return b.done
+}
+
+// Err returns ErrBusClosed once the bridge is closing, nil before
+func (b *Bridge) Err() error {
+	if b.State() != StateRunning {
+		return ErrBusClosed
+	}
+	return nil
+}
+
+// Load returns the queue depths of the subscriptions
+func (b *Bridge) Load() Load {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	load := Load{Subscribers: len(b.subs), Dropped: b.dropped.Load()}
+	for _, sub := range b.subs {
+		queued, capacity := len(sub.ch), cap(sub.ch)
+		load.Queued += queued
+		load.Capacity += capacity
+		if capacity > 0 {
+			if s := float64(queued) / float64(capacity); s > load.Saturation {
+				load.Saturation = s
+			}
+		}
+	}
+	return load
+}
+
+// Failed returns the number of events that could not be sent to the broker
+func (b *Bridge) Failed() uint64 {
+	return b.failed.Load()
+}
@@ -0,0 +1,198 @@
+// Package eventbus defines the interfaces through which the server and its
+// components publish and subscribe to twin events, so that the in-process
+// bus of messaging_sim can be replaced by a broker such as MQTT, NATS or
+// Kafka, or by a mock in tests.
+//
+// Topics are dot-separated, such as twin.updated. Subscription patterns may
+// use "+" to match exactly one level and a trailing "#" to match any number
+// of remaining levels.
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// ErrBusClosed is returned by the operations of a closed bus
+var ErrBusClosed = errors.New("event bus closed")
+
+// Message is an event published on a topic. Sequence numbers the events
+// about a twin that a subscription was sent, from 1; see Sequencer. It is
+// zero on priority subscriptions that may reorder the events of a twin.
+type Message struct {
+	Topic    string
+	Payload  interface{}
+	Priority Priority
+	Sequence uint64
+}
+
+// Priority orders messages on contended priority subscriptions
+type Priority int
+
+// Message priorities, from bulk traffic to critical events
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+)
+
+// String returns the name of the priority
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityNormal:
+		return "normal"
+	case PriorityHigh:
+		return "high"
+	default:
+		return "unknown"
+	}
+}
+
+// TopicMatches reports whether a topic matches a subscription pattern. It
+// walks both strings level by level without allocating, since every publish
+// matches its topic against all subscription and priority patterns.
+func TopicMatches(pattern, topic string) bool {
+	if pattern == topic {
+		return true
+	}
+
+	for {
+		level, patternRest, patternMore := strings.Cut(pattern, ".")
+		if level == "#" {
+			return !patternMore
+		}
+
+		topicLevel, topicRest, topicMore := strings.Cut(topic, ".")
+		if level != "+" && level != topicLevel {
+			return false
+		}
+		if !topicMore {
+			// A trailing "#" also matches the parent level
+			return !patternMore || patternRest == "#"
+		}
+		if !patternMore {
+			return false
+		}
+		pattern, topic = patternRest, topicRest
+	}
+}
+
+// Receipt reports what became of a published event on the bus it was
+// published to
+type Receipt struct {
+	Delivered int  `json:"delivered"` // Subscriptions the event was queued for
+	Dropped   int  `json:"dropped"`   // Subscriptions whose queue was full
+	Held      bool `json:"held"`      // Held back by a rate limit, to be delivered later
+}
+
+// Publisher publishes events. Publishing never blocks on slow subscribers;
+// events are dropped for subscribers whose queue is full, as the receipt
+// reports. Publishing to a closed bus returns ErrBusClosed.
+type Publisher interface {
+	Publish(topic string, payload interface{}) (Receipt, error)
+}
+
+// SyncPublisher is implemented by buses that can deliver an event without
+// dropping it, for tests and critical events
+type SyncPublisher interface {
+	// PublishAndWait delivers an event to every matching subscription,
+	// waiting for room in full queues until ctx is done. Subscriptions whose
+	// queue stays full are counted as dropped and the error of ctx returned.
+	PublishAndWait(ctx context.Context, topic string, payload interface{}) (Receipt, error)
+}
+
+// PublishAndWait publishes an event with the PublishAndWait of buses that
+// implement SyncPublisher, and with Publish on others
+func PublishAndWait(ctx context.Context, p Publisher, topic string, payload interface{}) (Receipt, error) {
+	if sp, ok := p.(SyncPublisher); ok {
+		return sp.PublishAndWait(ctx, topic, payload)
+	}
+	return p.Publish(topic, payload)
+}
+
+// Subscriber delivers the events published on topics matching a pattern to
+// channels. Events are dropped for subscribers whose channel is full.
+type Subscriber interface {
+	// Subscribe subscribes with a small default buffer
+	Subscribe(pattern string) chan Message
+	// SubscribeWithBuffer subscribes with a buffer of size messages,
+	// delivered in publish order
+	SubscribeWithBuffer(pattern string, size int) chan Message
+	// SubscribeWithPriority subscribes with a lane of size messages per
+	// priority, delivering higher priorities first. Buses without
+	// priorities may deliver in publish order.
+	SubscribeWithPriority(pattern string, size int) chan Message
+	// SubscribeContext subscribes with a buffer of size messages until ctx
+	// is done, then unsubscribes and closes the channel
+	SubscribeContext(ctx context.Context, pattern string, size int) chan Message
+	// Unsubscribe ends a subscription without closing its channel
+	Unsubscribe(pattern string, ch chan Message)
+}
+
+// State is the lifecycle state of a bus
+type State int
+
+// Bus states. A bus runs until Close is called, is closing while it ends
+// subscriptions and is then closed for good.
+const (
+	StateRunning State = iota
+	StateClosing
+	StateClosed
+)
+
+// String returns the name of the state
+func (s State) String() string {
+	switch s {
+	case StateRunning:
+		return "running"
+	case StateClosing:
+		return "closing"
+	case StateClosed:
+		return "closed"
+	default:
+		return "unknown"
+	}
+}
+
+// Bus publishes and delivers events. Once closed, publishing does nothing
+// and subscribing returns a closed channel.
+type Bus interface {
+	Publisher
+	Subscriber
+	// Close ends all subscriptions, closing their channels, and returns
+	// once the bus is closed. Closing a closed bus does nothing.
+	Close()
+	// State returns the lifecycle state of the bus
+	State() State
+	// Done returns a channel that is closed once the bus is closed, so
+	// components can stop after the events they depend on
+	Done() <-chan struct{}
+	// Err returns ErrBusClosed once the bus is closing, and nil before
+	Err() error
+}
+
+// Load describes how far subscribers are behind on delivered messages
+type Load struct {
+	Subscribers int     `json:"subscribers"`
+	Queued      int     `json:"queued"`     // Messages waiting in subscriber queues
+	Capacity    int     `json:"capacity"`   // Total size of subscriber queues
+	Saturation  float64 `json:"saturation"` // Fill ratio of the fullest subscriber queue, from 0 to 1
+	Dropped     uint64  `json:"dropped"`    // Messages dropped because a subscriber queue was full
+}
+
+// LoadReporter is implemented by buses that report the queue depths of
+// their subscribers, which ingestion backpressure is based on
+type LoadReporter interface {
+	Load() Load
+}
+
+// LoadOf returns the load of a bus, or no load if it does not report it
+func LoadOf(bus interface{}) Load {
+	if r, ok := bus.(LoadReporter); ok {
+		return r.Load()
+	}
+	return Load{}
+}
@@ -0,0 +1,225 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryBroker is a broker shared by the transports of a test. Patterns are
+// matched by converting the MQTT dialect back to event patterns.
+type memoryBroker struct {
+	subs  map[int]memorySub
+	next  int
+	fail  error
+	mutex sync.Mutex
+}
+
+type memorySub struct {
+	pattern string
+	handle  func(topic string, data []byte)
+}
+
+func newMemoryBroker() *memoryBroker {
+	return &memoryBroker{subs: make(map[int]memorySub)}
+}
+
+func (m *memoryBroker) Publish(topic string, data []byte) error {
+	m.mutex.Lock()
+	if m.fail != nil {
+		m.mutex.Unlock()
+		return m.fail
+	}
+	var handlers []func(string, []byte)
+	for _, sub := range m.subs {
+		event, ok := MQTT.EventTopic(topic)
+		pattern, _ := MQTT.EventTopic(sub.pattern)
+		if ok && TopicMatches(pattern, event) {
+			handlers = append(handlers, sub.handle)
+		}
+	}
+	m.mutex.Unlock()
+
+	for _, handle := range handlers {
+		handle(topic, data)
+	}
+	return nil
+}
+
+func (m *memoryBroker) Subscribe(pattern string, handle func(string, []byte)) (func(), error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	id := m.next
+	m.next++
+	m.subs[id] = memorySub{pattern: pattern, handle: handle}
+	return func() {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+		delete(m.subs, id)
+	}, nil
+}
+
+func (m *memoryBroker) Close() error {
+	return nil
+}
+
+func receive(t *testing.T, ch chan Message) Message {
+	t.Helper()
+	select {
+	case msg := <-ch:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("Expected a message")
+		return Message{}
+	}
+}
+
+func expectNone(t *testing.T, ch chan Message) {
+	t.Helper()
+	select {
+	case msg := <-ch:
+		t.Errorf("Unexpected message %s %v", msg.Topic, msg.Payload)
+	default:
+	}
+}
+
+func TestDialects(t *testing.T) {
+	cases := []struct {
+		dialect Dialect
+		topic   string
+		pattern string
+	}{
+		{MQTT, "dt/twin/updated", "dt/twin/+/#"},
+		{NATS, "dt.twin.updated", "dt.twin.*.>"},
+		{Kafka, "dt.twin.updated", `^dt\.twin\.[^\.]+(\..*)?$`},
+	}
+	for _, c := range cases {
+		if got := c.dialect.Topic("twin.updated"); got != c.topic {
+			t.Errorf("%s: expected topic %s, got %s", c.dialect.Name, c.topic, got)
+		}
+		if got := c.dialect.Pattern("twin.+.#"); got != c.pattern {
+			t.Errorf("%s: expected pattern %s, got %s", c.dialect.Name, c.pattern, got)
+		}
+		if got, ok := c.dialect.EventTopic(c.topic); !ok || got != "twin.updated" {
+			t.Errorf("%s: expected event topic twin.updated, got %s", c.dialect.Name, got)
+		}
+	}
+
+	if _, ok := MQTT.EventTopic("other/twin/updated"); ok {
+		t.Error("Expected topics outside of the prefix to be ignored")
+	}
+
+	re := regexp.MustCompile(Kafka.Pattern("twin.#"))
+	for topic, want := range map[string]bool{"dt.twin": true, "dt.twin.updated": true, "dt.twins": false, "dt.alarm.raised": false} {
+		if got := re.MatchString(topic); got != want {
+			t.Errorf("Kafka pattern on %s: expected %v, got %v", topic, want, got)
+		}
+	}
+}
+
+func TestBridge(t *testing.T) {
+	broker := newMemoryBroker()
+	a, err := NewBridge(broker, MQTT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	b, err := NewBridge(broker, MQTT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	local := a.Subscribe("twin.#")
+	remote := b.Subscribe("twin.+")
+	other := b.Subscribe("alarm.#")
+
+	if receipt, err := a.Publish("twin.updated", map[string]string{"id": "pump-1"}); err != nil || receipt.Delivered != 1 {
+		t.Errorf("Expected 1 local delivery, got %+v (%v)", receipt, err)
+	}
+
+	msg := receive(t, local)
+	if p, ok := msg.Payload.(map[string]string); !ok || p["id"] != "pump-1" {
+		t.Errorf("Expected the published payload locally, got %#v", msg.Payload)
+	}
+	expectNone(t, local)
+
+	msg = receive(t, remote)
+	if msg.Topic != "twin.updated" || msg.Priority != PriorityNormal {
+		t.Errorf("Unexpected message %+v", msg)
+	}
+	if p, ok := msg.Payload.(map[string]interface{}); !ok || p["id"] != "pump-1" {
+		t.Errorf("Expected the payload decoded from JSON, got %#v", msg.Payload)
+	}
+	expectNone(t, other)
+
+	b.Unsubscribe("twin.+", remote)
+	a.Publish("twin.deleted", nil)
+	receive(t, local)
+	expectNone(t, remote)
+	if load := b.Load(); load.Subscribers != 1 {
+		t.Errorf("Expected 1 subscriber, got %d", load.Subscribers)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	bound := b.SubscribeContext(ctx, "twin.#", 4)
+	a.Publish("twin.updated", nil)
+	receive(t, bound)
+	cancel()
+	select {
+	case _, ok := <-bound:
+		if ok {
+			t.Error("Expected the channel to be closed")
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected the channel to be closed when the context is cancelled")
+	}
+	if load := b.Load(); load.Subscribers != 1 {
+		t.Errorf("Expected the subscription to be removed, got %d subscribers", load.Subscribers)
+	}
+}
+
+func TestBridgeSendFailure(t *testing.T) {
+	broker := newMemoryBroker()
+	broker.fail = errors.New("disconnected")
+	bus, err := NewBridge(broker, NATS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ch := bus.Subscribe("#")
+	if receipt, err := bus.Publish("twin.updated", nil); err == nil || receipt.Delivered != 1 {
+		t.Errorf("Expected local delivery and the send error, got %+v (%v)", receipt, err)
+	}
+	receive(t, ch)
+	if bus.Failed() != 1 {
+		t.Errorf("Expected 1 failed send, got %d", bus.Failed())
+	}
+
+	bus.Close()
+	if _, ok := <-ch; ok {
+		t.Error("Expected the subscription to be closed")
+	}
+	if _, err := bus.Publish("twin.updated", nil); err != ErrBusClosed {
+		t.Errorf("Expected %v, got %v", ErrBusClosed, err)
+	}
+	if bus.Failed() != 1 {
+		t.Errorf("Expected publishing after close to do nothing, got %d failures", bus.Failed())
+	}
+	if bus.State() != StateClosed || bus.Err() != ErrBusClosed {
+		t.Errorf("Expected a closed bridge, got %v and %v", bus.State(), bus.Err())
+	}
+	select {
+	case <-bus.Done():
+	default:
+		t.Error("Expected Done to be closed")
+	}
+	if _, ok := <-bus.Subscribe("#"); ok {
+		t.Error("Expected subscriptions to a closed bridge to be closed")
+	}
+	bus.Close()
+}
@@ -0,0 +1,48 @@
+package eventbus
+
+// PropertiesUpdated is the payload of properties.updated events, which are
+// published for every batch of ingested telemetry. Publishing a struct
+// rather than a map takes one allocation instead of one per field. Events
+// received through a bridge carry the map decoded from their JSON instead,
+// so subscribers read the payload with PropertiesOf.
+type PropertiesUpdated struct {
+	TwinID     string                 `json:"twinId"`
+	FeatureID  string                 `json:"featureId"`
+	Properties map[string]interface{} `json:"properties"` // Changed properties and their new values
+}
+
+// PropertiesOf returns the payload of a properties.updated event, whether it
+// was published as PropertiesUpdated or decoded from JSON as a map
+func PropertiesOf(payload interface{}) (PropertiesUpdated, bool) {
+	switch p := payload.(type) {
+	case PropertiesUpdated:
+		return p, true
+	case map[string]interface{}:
+		var u PropertiesUpdated
+		u.TwinID, _ = p["twinId"].(string)
+		u.FeatureID, _ = p["featureId"].(string)
+		u.Properties, _ = p["properties"].(map[string]interface{})
+		return u, true
+	}
+	return PropertiesUpdated{}, false
+}
+
+// PayloadField returns a string field of a map or PropertiesUpdated payload
+// by its JSON name, or an empty string
+func PayloadField(payload interface{}, key string) string {
+	switch p := payload.(type) {
+	case map[string]string:
+		return p[key]
+	case map[string]interface{}:
+		s, _ := p[key].(string)
+		return s
+	case PropertiesUpdated:
+		switch key {
+		case "twinId":
+			return p.TwinID
+		case "featureId":
+			return p.FeatureID
+		}
+	}
+	return ""
+}
@@ -0,0 +1,30 @@
+package eventbus
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPropertiesOf(t *testing.T) {
+	published := PropertiesUpdated{TwinID: "pump-1", FeatureID: "status", Properties: map[string]interface{}{"pressure": 2.5}}
+
+	// Bridged events carry the payload decoded from JSON
+	data, _ := json.Marshal(published)
+	var decoded interface{}
+	json.Unmarshal(data, &decoded)
+
+	for _, payload := range []interface{}{published, decoded} {
+		u, ok := PropertiesOf(payload)
+		if !ok || u.TwinID != "pump-1" || u.FeatureID != "status" || u.Properties["pressure"] != 2.5 {
+			t.Errorf("Unexpected properties %+v of %#v", u, payload)
+		}
+		msg := Message{Topic: "properties.updated", Payload: payload}
+		if msg.TwinID() != "pump-1" || PayloadField(payload, "featureId") != "status" {
+			t.Errorf("Expected the twin and feature of %#v", payload)
+		}
+	}
+
+	if _, ok := PropertiesOf(map[string]string{"id": "pump-1"}); ok {
+		t.Error("Expected other payloads to be rejected")
+	}
+}
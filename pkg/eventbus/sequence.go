@@ -0,0 +1,109 @@
+package eventbus
+
+import (
+	"strings"
+	"sync"
+)
+
+// TwinID returns the twin an event is about, from the "twinId" field of its
+// payload or the "id" field of twin events, or an empty string
+func (m Message) TwinID() string {
+	if id := PayloadField(m.Payload, "twinId"); id != "" {
+		return id
+	}
+	if strings.HasPrefix(m.Topic, "twin.") {
+		return PayloadField(m.Payload, "id")
+	}
+	return ""
+}
+
+// Sequencer numbers the events about each twin that are published to a
+// subscription. Numbers are assigned as events are queued for the
+// subscription, and taken by events dropped because its queue was full, so
+// the subscriber sees a gap for every event it missed. Events that are not
+// about a twin are not numbered.
+type Sequencer struct {
+	twins map[string]uint64 // Twin ID -> sequence of the last event
+	mutex sync.Mutex
+}
+
+// NewSequencer creates a sequencer for a subscription
+func NewSequencer() *Sequencer {
+	return &Sequencer{twins: make(map[string]uint64)}
+}
+
+// Queue numbers a message and passes it to queue, which reports whether
+// the message was queued without blocking. The sequence of the twin only
+// advances if it was, so that numbers follow the order of the queue.
+func (s *Sequencer) Queue(msg Message, queue func(Message) bool) bool {
+	twinID := msg.TwinID()
+	if twinID == "" {
+		return queue(msg)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	msg.Sequence = s.twins[twinID] + 1
+	if !queue(msg) {
+		return false
+	}
+	s.twins[twinID] = msg.Sequence
+	return true
+}
+
+// Skip takes the next number of the twin of a message that was dropped
+func (s *Sequencer) Skip(msg Message) {
+	twinID := msg.TwinID()
+	if twinID == "" {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.twins[twinID]++
+}
+
+// Deliver queues a message like Queue and skips it if it was not queued
+func (s *Sequencer) Deliver(msg Message, queue func(Message) bool) bool {
+	if s.Queue(msg, queue) {
+		return true
+	}
+	s.Skip(msg)
+	return false
+}
+
+// Gaps detects the events a subscriber missed from the sequence numbers of
+// the events it received. The events of a twin arrive in sequence on
+// subscriptions that deliver in publish order. Priority subscriptions that
+// reorder events across lanes leave them unnumbered, so Gaps reports no
+// gaps on them.
+type Gaps struct {
+	last  map[string]uint64 // Twin ID -> sequence of the last event received
+	mutex sync.Mutex
+}
+
+// NewGaps creates a gap detector for a subscription
+func NewGaps() *Gaps {
+	return &Gaps{last: make(map[string]uint64)}
+}
+
+// Missed records a received message and returns how many events about its
+// twin were missed since the previous one. Unnumbered messages miss none.
+func (g *Gaps) Missed(msg Message) uint64 {
+	twinID := msg.TwinID()
+	if twinID == "" || msg.Sequence == 0 {
+		return 0
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	last := g.last[twinID]
+	if msg.Sequence <= last {
+		return 0
+	}
+	g.last[twinID] = msg.Sequence
+	return msg.Sequence - last - 1
+}
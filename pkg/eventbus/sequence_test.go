@@ -0,0 +1,108 @@
+package eventbus
+
+import "testing"
+
+func TestMessageTwinID(t *testing.T) {
+	tests := []struct {
+		msg  Message
+		want string
+	}{
+		{Message{Topic: "property.updated", Payload: map[string]interface{}{"twinId": "pump-1"}}, "pump-1"},
+		{Message{Topic: "twin.created", Payload: map[string]string{"id": "pump-1"}}, "pump-1"},
+		{Message{Topic: "rule.fired", Payload: map[string]string{"id": "rule-1"}}, ""},
+		{Message{Topic: "twin.updated", Payload: "pump-1"}, ""},
+	}
+	for _, tt := range tests {
+		if got := tt.msg.TwinID(); got != tt.want {
+			t.Errorf("Expected twin %q of %s, got %q", tt.want, tt.msg.Topic, got)
+		}
+	}
+}
+
+func TestSequencer(t *testing.T) {
+	seq := NewSequencer()
+	ch := make(chan Message, 1)
+	queue := func(msg Message) bool {
+		select {
+		case ch <- msg:
+			return true
+		default:
+			return false
+		}
+	}
+	pump := Message{Topic: "twin.updated", Payload: map[string]string{"id": "pump-1"}}
+	valve := Message{Topic: "twin.updated", Payload: map[string]string{"id": "valve-1"}}
+
+	seq.Deliver(pump, queue)
+	seq.Deliver(pump, queue)  // Dropped
+	seq.Deliver(valve, queue) // Dropped
+	if msg := <-ch; msg.Sequence != 1 {
+		t.Errorf("Expected sequence 1, got %d", msg.Sequence)
+	}
+
+	// Queue leaves the sequence for a retry, Skip gives the number up
+	seq.Deliver(valve, queue)
+	if seq.Queue(pump, queue) {
+		t.Fatal("Expected the full queue to refuse the message")
+	}
+	if msg := <-ch; msg.Sequence != 2 || msg.TwinID() != "valve-1" {
+		t.Errorf("Expected valve-1 at sequence 2, got %s at %d", msg.TwinID(), msg.Sequence)
+	}
+	seq.Queue(pump, queue)
+	if msg := <-ch; msg.Sequence != 3 {
+		t.Errorf("Expected sequence 3 after the dropped message, got %d", msg.Sequence)
+	}
+
+	// Events that are not about a twin are not numbered
+	seq.Deliver(Message{Topic: "rule.fired"}, queue)
+	if msg := <-ch; msg.Sequence != 0 {
+		t.Errorf("Expected no sequence, got %d", msg.Sequence)
+	}
+}
+
+func TestGaps(t *testing.T) {
+	gaps := NewGaps()
+	msg := func(id string, sequence uint64) Message {
+		return Message{Topic: "property.updated", Payload: map[string]interface{}{"twinId": id}, Sequence: sequence}
+	}
+
+	steps := []struct {
+		msg    Message
+		missed uint64
+	}{
+		{msg("pump-1", 1), 0},
+		{msg("pump-1", 2), 0},
+		{msg("valve-1", 3), 2},
+		{msg("pump-1", 5), 2},
+		{msg("pump-1", 4), 0}, // Out of sequence
+		{msg("pump-1", 0), 0}, // Unnumbered
+		{msg("pump-1", 6), 0},
+	}
+	for i, step := range steps {
+		if missed := gaps.Missed(step.msg); missed != step.missed {
+			t.Errorf("Step %d: expected %d missed, got %d", i, step.missed, missed)
+		}
+	}
+}
+
+func TestBridgeSequences(t *testing.T) {
+	bus, err := NewBridge(newMemoryBroker(), MQTT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bus.Close()
+
+	ch := bus.SubscribeWithBuffer("twin.#", 1)
+	gaps := NewGaps()
+	for i := 0; i < 3; i++ {
+		bus.Publish("twin.updated", map[string]string{"id": "pump-1"})
+	}
+	if msg := receive(t, ch); msg.Sequence != 1 || gaps.Missed(msg) != 0 {
+		t.Errorf("Expected sequence 1, got %d", msg.Sequence)
+	}
+
+	bus.Publish("twin.updated", map[string]string{"id": "pump-1"})
+	if msg := receive(t, ch); msg.Sequence != 4 || gaps.Missed(msg) != 2 {
+		t.Errorf("Expected sequence 4 after 2 dropped events, got %d", msg.Sequence)
+	}
+}
@@ -0,0 +1,106 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/query"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// CSVContentType is the content type of CSV exports
+const CSVContentType = "text/csv; charset=utf-8"
+
+// MaxColumns is the maximum number of columns of a CSV export
+const MaxColumns = 200
+
+// DefaultColumns are exported when no columns are requested
+var DefaultColumns = []string{"id", "type"}
+
+// ParseColumns parses a comma-separated list of twin paths, as accepted by
+// query.Lookup. An empty list selects DefaultColumns.
+func ParseColumns(s string) ([]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return append([]string(nil), DefaultColumns...), nil
+	}
+
+	var columns []string
+	for _, column := range strings.Split(s, ",") {
+		column = strings.TrimSpace(column)
+		if err := query.ValidatePath(column); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+		}
+		columns = append(columns, column)
+	}
+
+	if len(columns) > MaxColumns {
+		return nil, fmt.Errorf("%w: at most %d columns can be exported", ErrInvalidRequest, MaxColumns)
+	}
+	return columns, nil
+}
+
+// WriteCSV writes one row per twin, sorted by ID, with a header row naming the
+// columns. Missing values are left empty, objects and arrays are written as
+// JSON and text that a spreadsheet would evaluate as a formula is prefixed
+// with a single quote.
+func WriteCSV(w io.Writer, twins []*twin.DigitalTwin, columns []string) error {
+	sorted := append([]*twin.DigitalTwin(nil), twins...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(columns); err != nil {
+		return err
+	}
+
+	record := make([]string, len(columns))
+	for _, dt := range sorted {
+		for i, column := range columns {
+			value, _ := query.Lookup(dt, column)
+			record[i] = formatCell(value)
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// formatCell renders a value as CSV cell text
+func formatCell(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return escapeFormula(value)
+	case bool:
+		return strconv.FormatBool(value)
+	case time.Time:
+		return value.UTC().Format(time.RFC3339Nano)
+	}
+
+	if f, ok := toFloat(v); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return escapeFormula(fmt.Sprint(v))
+	}
+	return escapeFormula(string(data))
+}
+
+// escapeFormula prevents spreadsheets from evaluating text as a formula
+func escapeFormula(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
@@ -0,0 +1,72 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestParseColumns(t *testing.T) {
+	columns, err := ParseColumns("")
+	if err != nil || len(columns) != 2 || columns[0] != "id" {
+		t.Errorf("Expected default columns, got %v, %v", columns, err)
+	}
+
+	columns, err = ParseColumns(" id , attributes.location,features.sensor.properties.value")
+	if err != nil || len(columns) != 3 || columns[1] != "attributes.location" {
+		t.Errorf("Unexpected columns %v, %v", columns, err)
+	}
+
+	for _, s := range []string{"id,,type", "features.sensor", "owner"} {
+		if _, err := ParseColumns(s); !errors.Is(err, ErrInvalidRequest) {
+			t.Errorf("Expected ErrInvalidRequest for %q, got %v", s, err)
+		}
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	pump := twin.NewDigitalTwin("pump-2", "pump")
+	pump.CreatedAt = created
+	pump.SetAttribute("location", "hall, north")
+	pump.SetAttribute("tags", []interface{}{"a", "b"})
+	sensor := twin.NewFeatureState()
+	sensor.SetProperty("pressure", 1500000.0)
+	sensor.SetProperty("ok", true)
+	pump.AddFeature("sensor", sensor)
+
+	other := twin.NewDigitalTwin("pump-1", "pump")
+	other.SetAttribute("location", "=HYPERLINK(\"http://evil\")")
+
+	var buf bytes.Buffer
+	columns := []string{"id", "createdAt", "attributes.location", "attributes.tags", "features.sensor.properties.pressure", "features.sensor.properties.ok"}
+	if err := WriteCSV(&buf, []*twin.DigitalTwin{pump, other}, columns); err != nil {
+		t.Fatalf("Failed to write CSV: %v", err)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to read CSV: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("Expected header and 2 rows, got %v", records)
+	}
+
+	expected := [][]string{
+		columns,
+		{"pump-1", records[1][1], "'=HYPERLINK(\"http://evil\")", "", "", ""},
+		{"pump-2", "2024-01-02T03:04:05Z", "hall, north", `["a","b"]`, "1500000", "true"},
+	}
+	for i := range expected {
+		for j := range expected[i] {
+			if records[i][j] != expected[i][j] {
+				t.Errorf("Expected %q at row %d column %d, got %q", expected[i][j], i, j, records[i][j])
+			}
+		}
+	}
+}
@@ -0,0 +1,438 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/history"
+	"github.com/aleka07/go-digital-twin/pkg/objstore"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/parquet-go/parquet-go"
+)
+
+// Common errors
+var (
+	ErrJobNotFound    = errors.New("export job not found")
+	ErrInvalidRequest = errors.New("invalid export request")
+)
+
+// State is the state of an export job
+type State string
+
+// Job states
+const (
+	StatePending   State = "pending"
+	StateRunning   State = "running"
+	StateCompleted State = "completed"
+	StateFailed    State = "failed"
+)
+
+// MaxJobs is the number of export jobs kept; the oldest finished jobs are removed first
+const MaxJobs = 100
+
+// DefaultDelay is how long scheduled exports wait for late telemetry
+const DefaultDelay = time.Minute
+
+// defaultPartition is the Hive partition value used for an empty twin type
+const defaultPartition = "__HIVE_DEFAULT_PARTITION__"
+
+// Row is a history sample as written to Parquet files. The value is stored in
+// the column matching its type; other value columns are null.
+type Row struct {
+	TwinID      string    `parquet:"twin_id,dict"`
+	FeatureID   string    `parquet:"feature_id,dict"`
+	Property    string    `parquet:"property,dict"`
+	Timestamp   time.Time `parquet:"timestamp,timestamp(millisecond)"`
+	ValueDouble *float64  `parquet:"value_double,optional"`
+	ValueString *string   `parquet:"value_string,optional"`
+	ValueBool   *bool     `parquet:"value_bool,optional"`
+	ValueJSON   *string   `parquet:"value_json,optional"` // Objects and arrays encoded as JSON
+}
+
+// Request selects the history to export by sample timestamp
+type Request struct {
+	From time.Time `json:"from,omitempty"` // Inclusive, open when zero
+	To   time.Time `json:"to,omitempty"`   // Exclusive, now when zero
+}
+
+// Job reports the progress of a Parquet export
+type Job struct {
+	ID         string     `json:"id"`
+	Request    Request    `json:"request"`
+	Scheduled  bool       `json:"scheduled"`
+	State      State      `json:"state"`
+	Rows       int        `json:"rows"`
+	Files      []string   `json:"files"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+// job is a registered export job
+type job struct {
+	Job
+	done chan struct{}
+}
+
+// ParquetExporter writes property history to Parquet files partitioned by
+// twin type and day in Hive layout, which Spark and DuckDB read directly:
+//
+//	<prefix>twin_type=pump/date=2024-01-02/part-<job>.parquet
+//
+// Every job writes its own part files, so exports of overlapping ranges
+// duplicate rows.
+type ParquetExporter struct {
+	registry *registry.Registry
+	history  *history.Store
+	store    objstore.Store
+	prefix   string
+	jobs     map[string]*job
+	mutex    sync.RWMutex
+	now      func() time.Time
+}
+
+// NewParquetExporter creates an exporter writing below prefix in store
+func NewParquetExporter(reg *registry.Registry, hist *history.Store, store objstore.Store, prefix string) *ParquetExporter {
+	return &ParquetExporter{
+		registry: reg,
+		history:  hist,
+		store:    store,
+		prefix:   prefix,
+		jobs:     make(map[string]*job),
+		now:      time.Now,
+	}
+}
+
+// Start validates a request and starts an export job in the background
+func (e *ParquetExporter) Start(req Request) (Job, error) {
+	return e.start(req, false)
+}
+
+// start registers and runs an export job
+func (e *ParquetExporter) start(req Request, scheduled bool) (Job, error) {
+	if req.To.IsZero() {
+		req.To = e.now()
+	}
+	if !req.From.IsZero() && !req.To.After(req.From) {
+		return Job{}, fmt.Errorf("%w: to must be after from", ErrInvalidRequest)
+	}
+
+	id, err := newID()
+	if err != nil {
+		return Job{}, err
+	}
+
+	j := &job{
+		Job: Job{
+			ID:        id,
+			Request:   req,
+			Scheduled: scheduled,
+			State:     StatePending,
+			Files:     []string{},
+			CreatedAt: e.now(),
+		},
+		done: make(chan struct{}),
+	}
+
+	e.mutex.Lock()
+	e.jobs[id] = j
+	e.prune()
+	snapshot := j.snapshot()
+	e.mutex.Unlock()
+
+	go e.run(j)
+	return snapshot, nil
+}
+
+// Get returns a job by ID
+func (e *ParquetExporter) Get(id string) (Job, error) {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+
+	j, exists := e.jobs[id]
+	if !exists {
+		return Job{}, ErrJobNotFound
+	}
+	return j.snapshot(), nil
+}
+
+// List returns all jobs, newest first
+func (e *ParquetExporter) List() []Job {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+
+	result := make([]Job, 0, len(e.jobs))
+	for _, j := range e.jobs {
+		result = append(result, j.snapshot())
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.After(result[j].CreatedAt) })
+	return result
+}
+
+// Wait blocks until a job has finished and returns it
+func (e *ParquetExporter) Wait(id string) (Job, error) {
+	e.mutex.RLock()
+	j, exists := e.jobs[id]
+	e.mutex.RUnlock()
+
+	if !exists {
+		return Job{}, ErrJobNotFound
+	}
+
+	<-j.done
+	return e.Get(id)
+}
+
+// Schedule exports the history recorded since the previous scheduled export at
+// every interval until the context is cancelled. Samples newer than delay are
+// left for the next run so that late telemetry is not missed.
+func (e *ParquetExporter) Schedule(ctx context.Context, interval, delay time.Duration) {
+	if delay <= 0 {
+		delay = DefaultDelay
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var from time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		to := e.now().Add(-delay).Truncate(time.Second)
+		if !to.After(from) {
+			continue
+		}
+
+		j, err := e.start(Request{From: from, To: to}, true)
+		if err == nil {
+			j, err = e.Wait(j.ID)
+		}
+		if err == nil && j.State == StateFailed {
+			err = errors.New(j.Error)
+		}
+		if err != nil {
+			log.Printf("Scheduled Parquet export failed: %v", err)
+			continue
+		}
+		from = to
+	}
+}
+
+// run exports the history of a job
+func (e *ParquetExporter) run(j *job) {
+	defer close(j.done)
+
+	now := e.now()
+	e.mutex.Lock()
+	j.State = StateRunning
+	j.StartedAt = &now
+	e.mutex.Unlock()
+
+	err := e.export(j)
+
+	finished := e.now()
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	j.FinishedAt = &finished
+	if err != nil {
+		j.State = StateFailed
+		j.Error = err.Error()
+		return
+	}
+	j.State = StateCompleted
+}
+
+// partition identifies a Parquet file of a job
+type partition struct {
+	twinType string
+	date     string
+}
+
+// export writes one Parquet file per twin type and day
+func (e *ParquetExporter) export(j *job) error {
+	types := make(map[string]string)
+	partitions := make(map[partition][]Row)
+
+	for _, entry := range e.history.Range(j.Request.From, j.Request.To) {
+		twinType, cached := types[entry.TwinID]
+		if !cached {
+			if dt, err := e.registry.Get(entry.TwinID); err == nil {
+				twinType = dt.Type
+			}
+			types[entry.TwinID] = twinType
+		}
+
+		p := partition{twinType: twinType, date: entry.Timestamp.UTC().Format("2006-01-02")}
+		partitions[p] = append(partitions[p], toRow(entry))
+	}
+
+	keys := make([]partition, 0, len(partitions))
+	for p := range partitions {
+		keys = append(keys, p)
+	}
+	sort.Slice(keys, func(a, b int) bool {
+		if keys[a].twinType != keys[b].twinType {
+			return keys[a].twinType < keys[b].twinType
+		}
+		return keys[a].date < keys[b].date
+	})
+
+	for _, p := range keys {
+		rows := partitions[p]
+		data, err := encodeRows(rows)
+		if err != nil {
+			return fmt.Errorf("encode %s/%s: %v", p.twinType, p.date, err)
+		}
+
+		key := e.prefix + "twin_type=" + escapePartition(p.twinType) + "/date=" + p.date + "/part-" + j.ID + ".parquet"
+		if err := e.store.Put(context.Background(), key, data); err != nil {
+			return fmt.Errorf("upload %s: %v", key, err)
+		}
+
+		e.mutex.Lock()
+		j.Files = append(j.Files, key)
+		j.Rows += len(rows)
+		e.mutex.Unlock()
+	}
+	return nil
+}
+
+// encodeRows writes rows to a Snappy-compressed Parquet file
+func encodeRows(rows []Row) ([]byte, error) {
+	var buf bytes.Buffer
+	w := parquet.NewGenericWriter[Row](&buf, parquet.Compression(&parquet.Snappy))
+	if _, err := w.Write(rows); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// toRow converts a history entry to a Parquet row
+func toRow(entry history.Entry) Row {
+	row := Row{
+		TwinID:    entry.TwinID,
+		FeatureID: entry.FeatureID,
+		Property:  entry.Key,
+		Timestamp: entry.Timestamp.UTC(),
+	}
+
+	switch v := entry.Value.(type) {
+	case nil:
+	case string:
+		row.ValueString = &v
+	case bool:
+		row.ValueBool = &v
+	default:
+		if f, ok := toFloat(v); ok {
+			row.ValueDouble = &f
+		} else if data, err := json.Marshal(v); err == nil {
+			s := string(data)
+			row.ValueJSON = &s
+		}
+	}
+	return row
+}
+
+// toFloat converts numeric values to float64
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// escapePartition escapes a Hive partition value
+func escapePartition(value string) string {
+	if value == "" {
+		return defaultPartition
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// prune removes the oldest finished jobs beyond MaxJobs; the caller must hold the mutex
+func (e *ParquetExporter) prune() {
+	if len(e.jobs) <= MaxJobs {
+		return
+	}
+
+	var finished []*job
+	for _, j := range e.jobs {
+		if j.State == StateCompleted || j.State == StateFailed {
+			finished = append(finished, j)
+		}
+	}
+
+	sort.Slice(finished, func(a, b int) bool { return finished[a].CreatedAt.Before(finished[b].CreatedAt) })
+	for _, j := range finished {
+		if len(e.jobs) <= MaxJobs {
+			break
+		}
+		delete(e.jobs, j.ID)
+	}
+}
+
+// snapshot returns a copy of the job; the caller must hold the mutex
+func (j *job) snapshot() Job {
+	result := j.Job
+	result.Files = append([]string{}, j.Files...)
+	return result
+}
+
+// newID generates a random job ID
+func newID() (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
@@ -0,0 +1,161 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/history"
+	"github.com/aleka07/go-digital-twin/pkg/objstore"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+	"github.com/parquet-go/parquet-go"
+)
+
+func readRows(t *testing.T, store objstore.Store, key string) []Row {
+	t.Helper()
+
+	data, err := store.Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Failed to get %s: %v", key, err)
+	}
+	rows, err := parquet.Read[Row](bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", key, err)
+	}
+	return rows
+}
+
+func TestParquetExport(t *testing.T) {
+	reg := registry.NewRegistry()
+	reg.Create(twin.NewDigitalTwin("pump-1", "pump"))
+	reg.Create(twin.NewDigitalTwin("valve-1", "valve/v2"))
+
+	hist := history.NewStore(history.DefaultCapacity)
+	day1 := time.Date(2024, 1, 1, 23, 0, 0, 0, time.UTC)
+	day2 := day1.Add(2 * time.Hour)
+
+	hist.Record("pump-1", "sensor", "pressure", 2.5, day1)
+	hist.Record("pump-1", "sensor", "pressure", 3, day2)
+	hist.Record("pump-1", "sensor", "status", "ok", day2)
+	hist.Record("valve-1", "state", "open", true, day1)
+	hist.Record("valve-1", "state", "config", map[string]interface{}{"mode": "auto"}, day1)
+	hist.Record("gone-1", "sensor", "value", nil, day1)
+
+	store := objstore.NewMemoryStore()
+	e := NewParquetExporter(reg, hist, store, "history/")
+
+	job, err := e.Start(Request{})
+	if err != nil {
+		t.Fatalf("Failed to start export: %v", err)
+	}
+	job, _ = e.Wait(job.ID)
+
+	if job.State != StateCompleted || job.Rows != 6 {
+		t.Fatalf("Unexpected job: %+v", job)
+	}
+
+	expected := []string{
+		"history/twin_type=__HIVE_DEFAULT_PARTITION__/date=2024-01-01/part-" + job.ID + ".parquet",
+		"history/twin_type=pump/date=2024-01-01/part-" + job.ID + ".parquet",
+		"history/twin_type=pump/date=2024-01-02/part-" + job.ID + ".parquet",
+		"history/twin_type=valve%2Fv2/date=2024-01-01/part-" + job.ID + ".parquet",
+	}
+	if strings.Join(job.Files, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected files %v, got %v", expected, job.Files)
+	}
+
+	rows := readRows(t, store, expected[2])
+	if len(rows) != 2 || rows[0].Property != "pressure" || *rows[0].ValueDouble != 3 || *rows[1].ValueString != "ok" {
+		t.Errorf("Unexpected pump rows: %+v", rows)
+	}
+	if !rows[0].Timestamp.Equal(day2) {
+		t.Errorf("Expected timestamp %v, got %v", day2, rows[0].Timestamp)
+	}
+
+	rows = readRows(t, store, expected[3])
+	if len(rows) != 2 {
+		t.Fatalf("Expected 2 valve rows, got %d", len(rows))
+	}
+	for _, row := range rows {
+		switch row.Property {
+		case "open":
+			if row.ValueBool == nil || !*row.ValueBool || row.ValueDouble != nil {
+				t.Errorf("Unexpected bool row: %+v", row)
+			}
+		case "config":
+			if row.ValueJSON == nil || *row.ValueJSON != `{"mode":"auto"}` {
+				t.Errorf("Unexpected JSON row: %+v", row)
+			}
+		}
+	}
+
+	// Ranges select samples by timestamp
+	job, _ = e.Start(Request{From: day2, To: day2.Add(time.Hour)})
+	job, _ = e.Wait(job.ID)
+	if job.Rows != 2 || len(job.Files) != 1 {
+		t.Errorf("Expected 2 rows in 1 file, got %+v", job)
+	}
+
+	if jobs := e.List(); len(jobs) != 2 {
+		t.Errorf("Expected 2 jobs, got %d", len(jobs))
+	}
+	if _, err := e.Get("missing"); err != ErrJobNotFound {
+		t.Errorf("Expected ErrJobNotFound, got %v", err)
+	}
+	if _, err := e.Start(Request{From: day2, To: day1}); !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("Expected ErrInvalidRequest, got %v", err)
+	}
+}
+
+func TestParquetExportFailure(t *testing.T) {
+	hist := history.NewStore(history.DefaultCapacity)
+	hist.Record("pump-1", "sensor", "pressure", 1.0, time.Now())
+
+	e := NewParquetExporter(registry.NewRegistry(), hist, objstore.NewMemoryStore(), "/invalid/")
+	job, _ := e.Start(Request{})
+	job, _ = e.Wait(job.ID)
+
+	if job.State != StateFailed || job.Error == "" || job.FinishedAt == nil {
+		t.Errorf("Expected failed job, got %+v", job)
+	}
+}
+
+func TestParquetSchedule(t *testing.T) {
+	hist := history.NewStore(history.DefaultCapacity)
+	store := objstore.NewMemoryStore()
+	e := NewParquetExporter(registry.NewRegistry(), hist, store, "")
+
+	now := time.Now()
+	hist.Record("pump-1", "sensor", "pressure", 1.0, now.Add(-time.Hour))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go e.Schedule(ctx, 10*time.Millisecond, time.Minute)
+
+	deadline := time.After(5 * time.Second)
+	for {
+		jobs := e.List()
+		if len(jobs) > 0 && jobs[len(jobs)-1].State == StateCompleted {
+			first := jobs[len(jobs)-1]
+			if !first.Scheduled || first.Rows != 1 {
+				t.Errorf("Unexpected scheduled job: %+v", first)
+			}
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatal("Timed out waiting for scheduled export")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	cancel()
+	keys, _ := store.List(context.Background(), "")
+	if len(keys) != 1 {
+		t.Errorf("Expected the sample to be exported once, got %v", keys)
+	}
+}
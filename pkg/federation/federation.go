@@ -0,0 +1,433 @@
+// Package federation serves twins of peer servers alongside local ones, so
+// that multi-site deployments can present a global view. Selected remote
+// twins are mirrored into the local registry over the peers' watch streams
+// or read through on access, their changes are published as local events,
+// and writes to them can be delegated to the peer that owns them.
+package federation
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/eventbus"
+	"github.com/aleka07/go-digital-twin/pkg/query"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// Common errors
+var (
+	ErrInvalidOptions  = errors.New("invalid federation options")
+	ErrReadOnly        = errors.New("federated twin is read-only")
+	ErrPeerUnavailable = errors.New("peer is unavailable")
+	ErrLocalTwin       = errors.New("a local twin has the same ID")
+)
+
+// DefaultTTL is how long twins read through from a peer are served without
+// fetching them again
+const DefaultTTL = 30 * time.Second
+
+// requestTimeout bounds reads and delegated writes; watch streams stay open
+const requestTimeout = 10 * time.Second
+
+// maxForwardedBody bounds the response of a delegated write kept in memory
+const maxForwardedBody = 16 << 20
+
+// PeerOptions configure a peer server
+type PeerOptions struct {
+	Name           string            // Identifies the peer in events and status
+	URL            string            // API URL, e.g. https://site-b.example.com/api/v1
+	Headers        map[string]string // Added to every request, e.g. Authorization
+	Twins          []string          // path.Match patterns of twin IDs read through from the peer
+	Mirror         bool              // Mirror the twins matching Query continuously
+	Query          string            // Query selecting the mirrored twins, all when empty
+	DelegateWrites bool              // Forward writes to the peer's twins instead of rejecting them
+	TTL            time.Duration     // How long read-through twins are fresh, DefaultTTL when zero
+}
+
+// PeerStatus reports the state of a peer
+type PeerStatus struct {
+	Name      string     `json:"name"`
+	URL       string     `json:"url"`
+	Mirror    bool       `json:"mirror"`
+	Connected bool       `json:"connected"`           // The watch stream is open and synced
+	Twins     int        `json:"twins"`               // Local copies of the peer's twins
+	Events    uint64     `json:"events"`              // Changes received over the watch stream
+	Fetched   uint64     `json:"fetched"`             // Twins read through
+	Forwarded uint64     `json:"forwarded"`           // Writes delegated to the peer
+	Failures  uint64     `json:"failures"`            // Failed requests and rejected twins
+	LastError string     `json:"lastError,omitempty"` // Error of the last failure
+	LastEvent *time.Time `json:"lastEvent,omitempty"` // Time of the last change received
+}
+
+// peer is a configured peer server
+type peer struct {
+	opts   PeerOptions
+	url    string
+	status PeerStatus
+}
+
+// entry records the origin of a local copy of a remote twin
+type entry struct {
+	peer     *peer
+	revision uint64    // Revision of the twin at the peer
+	fetched  time.Time // When the copy was last brought up to date
+	mirrored bool      // The copy is kept up to date by the watch stream
+}
+
+// Manager serves the twins of peer servers
+type Manager struct {
+	registry *registry.Registry
+	pubsub   eventbus.Publisher
+	peers    []*peer
+	twins    map[string]*entry
+	client   *http.Client
+	stream   *http.Client
+	onDelete func(twinID string)
+	mutex    sync.Mutex
+}
+
+// NewManager creates a manager for the given peers
+func NewManager(reg *registry.Registry, pubsub eventbus.Publisher, peers []PeerOptions) (*Manager, error) {
+	m := &Manager{
+		registry: reg,
+		pubsub:   pubsub,
+		twins:    make(map[string]*entry),
+		client:   &http.Client{Timeout: requestTimeout},
+		stream:   &http.Client{},
+	}
+
+	names := make(map[string]bool)
+	for _, opts := range peers {
+		if opts.Name == "" || names[opts.Name] {
+			return nil, fmt.Errorf("%w: peers need unique names", ErrInvalidOptions)
+		}
+		names[opts.Name] = true
+
+		u, err := url.Parse(opts.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("%w: peer %s needs an http or https URL", ErrInvalidOptions, opts.Name)
+		}
+		if len(opts.Twins) == 0 && !opts.Mirror {
+			return nil, fmt.Errorf("%w: peer %s needs twin patterns or mirroring", ErrInvalidOptions, opts.Name)
+		}
+		for _, pattern := range opts.Twins {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("%w: peer %s: invalid pattern %q", ErrInvalidOptions, opts.Name, pattern)
+			}
+		}
+		if _, err := query.Parse(opts.Query); err != nil {
+			return nil, fmt.Errorf("%w: peer %s: %v", ErrInvalidOptions, opts.Name, err)
+		}
+		if opts.TTL < 0 {
+			return nil, fmt.Errorf("%w: peer %s: ttl must not be negative", ErrInvalidOptions, opts.Name)
+		}
+		if opts.TTL == 0 {
+			opts.TTL = DefaultTTL
+		}
+
+		m.peers = append(m.peers, &peer{
+			opts:   opts,
+			url:    strings.TrimSuffix(opts.URL, "/"),
+			status: PeerStatus{Name: opts.Name, URL: opts.URL, Mirror: opts.Mirror},
+		})
+	}
+	return m, nil
+}
+
+// Run mirrors the twins of peers with mirroring enabled until the context
+// is canceled
+func (m *Manager) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, p := range m.peers {
+		if p.opts.Mirror {
+			wg.Add(1)
+			go func(p *peer) {
+				defer wg.Done()
+				m.mirror(ctx, p)
+			}(p)
+		}
+	}
+	wg.Wait()
+}
+
+// Peer returns the name of the peer serving a twin, or "" for local twins
+// and IDs no peer serves
+func (m *Manager) Peer(id string) string {
+	if p, _ := m.lookup(id); p != nil {
+		return p.opts.Name
+	}
+	return ""
+}
+
+// lookup returns the peer serving a twin and its local copy, if any
+func (m *Manager) lookup(id string) (*peer, *entry) {
+	m.mutex.Lock()
+	e, exists := m.twins[id]
+	m.mutex.Unlock()
+	if exists {
+		return e.peer, e
+	}
+
+	if _, err := m.registry.Get(id); err == nil {
+		return nil, nil
+	}
+	for _, p := range m.peers {
+		for _, pattern := range p.opts.Twins {
+			if ok, _ := path.Match(pattern, id); ok {
+				return p, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// Fetch brings the local copy of a twin served by a peer up to date, so that
+// it can be read from the registry. Copies kept up to date by a connected
+// watch stream, or read through within the TTL, are used as they are. When
+// the peer no longer has the twin, the local copy is removed. When the peer
+// cannot be reached, a stale copy is served; without one, Fetch fails with
+// ErrPeerUnavailable. Local twins are left alone.
+func (m *Manager) Fetch(ctx context.Context, id string) error {
+	p, e := m.lookup(id)
+	if p == nil {
+		return nil
+	}
+
+	m.mutex.Lock()
+	mirrored := e != nil && e.mirrored
+	fresh := e != nil && ((mirrored && p.status.Connected) || time.Since(e.fetched) < p.opts.TTL)
+	m.mutex.Unlock()
+	if fresh {
+		return nil
+	}
+
+	dt, err := m.get(ctx, p, id)
+	switch {
+	case err == registry.ErrTwinNotFound:
+		m.remove(p, id)
+		return nil
+	case err != nil:
+		m.fail(p, err)
+		if e != nil {
+			return nil
+		}
+		return fmt.Errorf("%w: %s: %v", ErrPeerUnavailable, p.opts.Name, err)
+	}
+
+	m.mutex.Lock()
+	p.status.Fetched++
+	m.mutex.Unlock()
+	return m.store(p, dt, mirrored)
+}
+
+// get reads a twin from a peer
+func (m *Manager) get(ctx context.Context, p *peer, id string) (*twin.DigitalTwin, error) {
+	req, err := m.request(ctx, p, http.MethodGet, "/twins/"+url.PathEscape(id), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, registry.ErrTwinNotFound
+	default:
+		return nil, responseError(resp)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return twin.Decode(data)
+}
+
+// Forward delegates a write to a twin served by a peer, such as
+// PUT /twins/pump-1/attributes/site. The target path is relative to the API
+// URL.
+// The local copy is brought up to date once the peer accepted the write.
+// Forward fails with ErrReadOnly if the peer does not accept delegated writes.
+func (m *Manager) Forward(r *http.Request, id, target string) (*http.Response, error) {
+	p, _ := m.lookup(id)
+	if p == nil {
+		return nil, fmt.Errorf("%s is not served by a peer", id)
+	}
+	if !p.opts.DelegateWrites {
+		return nil, fmt.Errorf("%w: %s is served by peer %s", ErrReadOnly, id, p.opts.Name)
+	}
+
+	req, err := m.request(r.Context(), p, r.Method, target, r.Body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		m.fail(p, err)
+		return nil, fmt.Errorf("%w: %s: %v", ErrPeerUnavailable, p.opts.Name, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxForwardedBody))
+	if err != nil {
+		m.fail(p, err)
+		return nil, fmt.Errorf("%w: %s: %v", ErrPeerUnavailable, p.opts.Name, err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	m.mutex.Lock()
+	p.status.Forwarded++
+	if e, exists := m.twins[id]; exists {
+		e.fetched = time.Time{}
+	}
+	m.mutex.Unlock()
+
+	if resp.StatusCode < 300 {
+		m.Fetch(r.Context(), id)
+	}
+	return resp, nil
+}
+
+// request creates a request to a peer
+func (m *Manager) request(ctx context.Context, p *peer, method, target string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, p.url+target, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range p.opts.Headers {
+		req.Header.Set(k, v)
+	}
+	return req, nil
+}
+
+// store keeps a copy of a peer's twin in the registry and publishes the change
+func (m *Manager) store(p *peer, dt *twin.DigitalTwin, mirrored bool) error {
+	m.mutex.Lock()
+	e, exists := m.twins[dt.ID]
+	if exists && e.peer != p {
+		m.mutex.Unlock()
+		err := fmt.Errorf("%w: %s is served by peer %s", ErrLocalTwin, dt.ID, e.peer.opts.Name)
+		m.fail(p, err)
+		return err
+	}
+	if exists && e.revision == dt.GetRevision() {
+		e.fetched = time.Now()
+		e.mirrored = e.mirrored || mirrored
+		m.mutex.Unlock()
+		return nil
+	}
+
+	revision := dt.GetRevision()
+	dt.SetRevision(0)
+	topic := "twin.updated"
+	err := registry.ErrTwinNotFound
+	if exists {
+		err = m.registry.Update(dt)
+	}
+	if err == registry.ErrTwinNotFound {
+		topic = "twin.created"
+		err = m.registry.Create(dt)
+	}
+	if err == registry.ErrTwinAlreadyExists {
+		err = fmt.Errorf("%w: %s", ErrLocalTwin, dt.ID)
+	}
+	if err == nil {
+		m.twins[dt.ID] = &entry{peer: p, revision: revision, fetched: time.Now(), mirrored: exists && e.mirrored || mirrored}
+	}
+	m.mutex.Unlock()
+
+	if err != nil {
+		m.fail(p, err)
+		return err
+	}
+	m.pubsub.Publish(topic, map[string]string{"id": dt.ID, "peer": p.opts.Name})
+	return nil
+}
+
+// SetDeleteHook sets a function called with the ID of every local copy of a
+// peer's twin the manager deletes, so that the server can drop what it keeps
+// about the twin, as it does for deletes through its API
+func (m *Manager) SetDeleteHook(fn func(twinID string)) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.onDelete = fn
+}
+
+// remove deletes the local copy of a peer's twin
+func (m *Manager) remove(p *peer, id string) {
+	m.mutex.Lock()
+	e, exists := m.twins[id]
+	if !exists || e.peer != p {
+		m.mutex.Unlock()
+		return
+	}
+	delete(m.twins, id)
+	err := m.registry.Delete(id)
+	onDelete := m.onDelete
+	m.mutex.Unlock()
+
+	if err == nil {
+		if onDelete != nil {
+			onDelete(id)
+		}
+		m.pubsub.Publish("twin.deleted", map[string]string{"id": id, "peer": p.opts.Name})
+	}
+}
+
+// fail records a failure with a peer
+func (m *Manager) fail(p *peer, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	p.status.Failures++
+	p.status.LastError = err.Error()
+}
+
+// Status reports the state of every peer
+func (m *Manager) Status() []PeerStatus {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	counts := make(map[*peer]int)
+	for _, e := range m.twins {
+		counts[e.peer]++
+	}
+
+	result := make([]PeerStatus, 0, len(m.peers))
+	for _, p := range m.peers {
+		status := p.status
+		status.Twins = counts[p]
+		if status.LastEvent != nil {
+			at := *status.LastEvent
+			status.LastEvent = &at
+		}
+		result = append(result, status)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// responseError describes an unexpected response of a peer
+func responseError(resp *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+}
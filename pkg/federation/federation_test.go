@@ -0,0 +1,241 @@
+package federation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// fakePeer serves twins like the API of another server
+type fakePeer struct {
+	twins   map[string]*twin.DigitalTwin
+	changes chan string // Events written to watch streams, as "event data"
+	writes  []string
+	down    bool
+	mutex   sync.Mutex
+	server  *httptest.Server
+}
+
+func newFakePeer(t *testing.T, twins ...*twin.DigitalTwin) *fakePeer {
+	p := &fakePeer{twins: make(map[string]*twin.DigitalTwin), changes: make(chan string, 10)}
+	for _, dt := range twins {
+		dt.SetRevision(1)
+		p.twins[dt.ID] = dt
+	}
+	p.server = httptest.NewServer(http.HandlerFunc(p.serve))
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+func (p *fakePeer) serve(w http.ResponseWriter, r *http.Request) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.down {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+		return
+	}
+	rest := strings.TrimPrefix(r.URL.Path, "/api/v1/twins/")
+	id := strings.Split(rest, "/")[0]
+
+	switch {
+	case r.Method == http.MethodGet && rest == "watch":
+		p.watch(w, r)
+	case r.Method == http.MethodGet:
+		dt, exists := p.twins[id]
+		if !exists {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		w.Write(wire(dt))
+	case r.Method == http.MethodDelete && rest == id:
+		p.writes = append(p.writes, r.Method+" "+r.URL.Path)
+		delete(p.twins, id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		body, _ := io.ReadAll(r.Body)
+		p.writes = append(p.writes, r.Method+" "+r.URL.Path+" "+string(body))
+		if dt, exists := p.twins[id]; exists {
+			dt.SetAttribute("site", "written")
+			dt.SetRevision(dt.GetRevision() + 1)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true}`))
+	}
+}
+
+// watch streams the twins and then the queued changes; the caller holds the mutex
+func (p *fakePeer) watch(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	for _, dt := range p.twins {
+		fmt.Fprintf(w, "event: add\ndata: %s\n\n", wire(dt))
+	}
+	fmt.Fprintf(w, "event: synced\ndata: {\"count\":%d}\n\n", len(p.twins))
+	w.(http.Flusher).Flush()
+	p.mutex.Unlock()
+	defer p.mutex.Lock()
+
+	for {
+		select {
+		case change := <-p.changes:
+			event, data, _ := strings.Cut(change, " ")
+			fmt.Fprintf(w, ": keep-alive\n\nevent: %s\ndata: %s\n\n", event, data)
+			w.(http.Flusher).Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// wire encodes a twin in the representation of API version 1
+func wire(dt *twin.DigitalTwin) []byte {
+	data, _ := json.Marshal(dt)
+	var doc map[string]interface{}
+	json.Unmarshal(data, &doc)
+	for _, f := range doc["features"].(map[string]interface{}) {
+		feature := f.(map[string]interface{})
+		feature["desiredProperties"] = feature["DesiredProps"]
+		delete(feature, "DesiredProps")
+	}
+	data, _ = json.Marshal(doc)
+	return data
+}
+
+func newPump(id, site string) *twin.DigitalTwin {
+	dt := twin.NewDigitalTwin(id, "pump")
+	dt.SetAttribute("site", site)
+	fs := twin.NewFeatureState()
+	fs.SetDesiredProperty("speed", 10.0)
+	dt.AddFeature("motor", fs)
+	return dt
+}
+
+func TestNewManager(t *testing.T) {
+	for _, peers := range [][]PeerOptions{
+		{{URL: "http://b"}},
+		{{Name: "b", URL: "ftp://b", Mirror: true}},
+		{{Name: "b", URL: "http://b"}},
+		{{Name: "b", URL: "http://b", Twins: []string{"["}}},
+		{{Name: "b", URL: "http://b", Mirror: true, Query: "type =="}},
+		{{Name: "b", URL: "http://b", Mirror: true}, {Name: "b", URL: "http://c", Mirror: true}},
+	} {
+		if _, err := NewManager(registry.NewRegistry(), messaging_sim.NewPubSub(), peers); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("Expected ErrInvalidOptions for %+v, got %v", peers, err)
+		}
+	}
+}
+
+func TestReadThrough(t *testing.T) {
+	peer := newFakePeer(t, newPump("b-pump-1", "south"))
+	reg := registry.NewRegistry()
+	reg.Create(newPump("b-local", "north"))
+	pubsub := messaging_sim.NewPubSub()
+	events := pubsub.SubscribeWithBuffer("twin.+", 10)
+	m, err := NewManager(reg, pubsub, []PeerOptions{{Name: "site-b", URL: peer.server.URL + "/api/v1/", Twins: []string{"b-*"}, TTL: time.Hour}})
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+
+	if m.Peer("b-pump-1") != "site-b" || m.Peer("b-local") != "" || m.Peer("a-pump-1") != "" {
+		t.Error("Expected only unknown IDs matching the patterns to be served by the peer")
+	}
+
+	if err := m.Fetch(context.Background(), "b-pump-1"); err != nil {
+		t.Fatalf("Failed to fetch: %v", err)
+	}
+	dt, err := reg.Get("b-pump-1")
+	if err != nil {
+		t.Fatalf("Expected a local copy: %v", err)
+	}
+	fs, _ := dt.GetFeature("motor")
+	if speed, _ := fs.GetDesiredProperty("speed"); speed != 10.0 {
+		t.Errorf("Expected desired properties to be decoded, got %v", speed)
+	}
+	if msg := <-events; msg.Topic != "twin.created" || msg.Payload.(map[string]string)["peer"] != "site-b" {
+		t.Errorf("Unexpected event %+v", msg)
+	}
+
+	// Fresh copies are served while the peer is down
+	peer.mutex.Lock()
+	peer.down = true
+	peer.mutex.Unlock()
+	if err := m.Fetch(context.Background(), "b-pump-1"); err != nil {
+		t.Errorf("Expected the copy to be served, got %v", err)
+	}
+	if err := m.Fetch(context.Background(), "b-pump-2"); !errors.Is(err, ErrPeerUnavailable) {
+		t.Errorf("Expected ErrPeerUnavailable, got %v", err)
+	}
+	if err := m.Fetch(context.Background(), "a-pump-2"); err != nil {
+		t.Errorf("Expected IDs of no peer to be left alone, got %v", err)
+	}
+
+	// Twins deleted at the peer are removed
+	peer.mutex.Lock()
+	peer.down = false
+	delete(peer.twins, "b-pump-1")
+	peer.mutex.Unlock()
+	m.mutex.Lock()
+	m.twins["b-pump-1"].fetched = time.Time{}
+	m.mutex.Unlock()
+	m.Fetch(context.Background(), "b-pump-1")
+	if _, err := reg.Get("b-pump-1"); err != registry.ErrTwinNotFound {
+		t.Error("Expected the copy to be removed")
+	}
+
+	status := m.Status()[0]
+	if status.Fetched != 1 || status.Failures != 1 || status.Twins != 0 {
+		t.Errorf("Unexpected status %+v", status)
+	}
+}
+
+func TestForward(t *testing.T) {
+	peer := newFakePeer(t, newPump("b-pump-1", "south"), newPump("c-pump-1", "east"))
+	reg := registry.NewRegistry()
+	m, _ := NewManager(reg, messaging_sim.NewPubSub(), []PeerOptions{
+		{Name: "site-b", URL: peer.server.URL + "/api/v1", Twins: []string{"b-*"}, DelegateWrites: true},
+		{Name: "site-c", URL: peer.server.URL + "/api/v1", Twins: []string{"c-*"}},
+	})
+	m.Fetch(context.Background(), "b-pump-1")
+
+	r := httptest.NewRequest("PUT", "/api/v1/twins/b-pump-1/attributes/site", strings.NewReader(`"north"`))
+	resp, err := m.Forward(r, "b-pump-1", "/twins/b-pump-1/attributes/site")
+	if err != nil {
+		t.Fatalf("Failed to forward: %v", err)
+	}
+	if body, _ := io.ReadAll(resp.Body); resp.StatusCode != http.StatusOK || string(body) != `{"ok":true}` {
+		t.Errorf("Unexpected response %d %s", resp.StatusCode, body)
+	}
+	if len(peer.writes) != 1 || !strings.HasSuffix(peer.writes[0], `/attributes/site "north"`) {
+		t.Errorf("Unexpected writes %v", peer.writes)
+	}
+	dt, _ := reg.Get("b-pump-1")
+	if site, _ := dt.GetAttribute("site"); site != "written" {
+		t.Errorf("Expected the copy to be refreshed, got %v", site)
+	}
+
+	r = httptest.NewRequest("DELETE", "/api/v1/twins/b-pump-1", nil)
+	m.Forward(r, "b-pump-1", "/twins/b-pump-1")
+	if _, err := reg.Get("b-pump-1"); err != registry.ErrTwinNotFound {
+		t.Error("Expected the copy to be removed after a delegated delete")
+	}
+
+	r = httptest.NewRequest("PUT", "/api/v1/twins/c-pump-1/attributes/site", strings.NewReader(`"north"`))
+	if _, err := m.Forward(r, "c-pump-1", "/twins/c-pump-1/attributes/site"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Expected ErrReadOnly, got %v", err)
+	}
+	if status := m.Status(); status[0].Forwarded != 2 || status[1].Forwarded != 0 {
+		t.Errorf("Unexpected status %+v", status)
+	}
+}
@@ -0,0 +1,160 @@
+package federation
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// Backoff between attempts to open a peer's watch stream
+const (
+	minBackoff = time.Second
+	maxBackoff = time.Minute
+)
+
+// maxEventSize bounds a single event of a watch stream
+const maxEventSize = 4 << 20
+
+// mirror keeps the local copies of a peer's twins up to date over its watch
+// stream, reconnecting with backoff until the context is canceled
+func (m *Manager) mirror(ctx context.Context, p *peer) {
+	backoff := minBackoff
+	for {
+		synced, err := m.watch(ctx, p)
+
+		m.mutex.Lock()
+		p.status.Connected = false
+		m.mutex.Unlock()
+		if ctx.Err() != nil {
+			return
+		}
+		m.fail(p, err)
+
+		if synced {
+			backoff = minBackoff
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// watch applies the events of a peer's watch stream until it ends. It
+// reports whether the stream got past the initial matches.
+func (m *Manager) watch(ctx context.Context, p *peer) (bool, error) {
+	req, err := m.request(ctx, p, http.MethodGet, "/twins/watch?query="+url.QueryEscape(p.opts.Query), nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := m.stream.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, responseError(resp)
+	}
+
+	// Twins matched initially are collected, so that copies of twins the
+	// peer deleted while disconnected can be removed once synced
+	initial := make(map[string]bool)
+	synced := false
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), maxEventSize)
+	var event string
+	var data []byte
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		switch {
+		case len(line) == 0:
+			if event != "" {
+				m.apply(p, event, data, initial, synced)
+				if event == "synced" {
+					synced = true
+					m.prune(p, initial)
+					m.mutex.Lock()
+					p.status.Connected = true
+					m.mutex.Unlock()
+				}
+			}
+			event, data = "", nil
+		case bytes.HasPrefix(line, []byte(":")):
+			// Keep-alive comment
+		case bytes.HasPrefix(line, []byte("event:")):
+			event = string(bytes.TrimSpace(line[len("event:"):]))
+		case bytes.HasPrefix(line, []byte("data:")):
+			data = append(data, bytes.TrimSpace(line[len("data:"):])...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return synced, err
+	}
+	return synced, errors.New("watch stream closed")
+}
+
+// apply applies an event of a peer's watch stream
+func (m *Manager) apply(p *peer, event string, data []byte, initial map[string]bool, synced bool) {
+	switch event {
+	case "add", "update":
+		dt, err := twin.Decode(data)
+		if err != nil {
+			m.fail(p, err)
+			return
+		}
+		if !synced {
+			initial[dt.ID] = true
+		}
+		m.received(p)
+		m.store(p, dt, true)
+	case "remove":
+		var removed struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(data, &removed); err != nil {
+			m.fail(p, err)
+			return
+		}
+		m.received(p)
+		m.remove(p, removed.ID)
+	}
+}
+
+// received counts a change received from a peer
+func (m *Manager) received(p *peer) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := time.Now()
+	p.status.Events++
+	p.status.LastEvent = &now
+}
+
+// prune removes mirrored copies of a peer's twins that no longer match
+func (m *Manager) prune(p *peer, initial map[string]bool) {
+	var stale []string
+	m.mutex.Lock()
+	for id, e := range m.twins {
+		if e.peer == p && e.mirrored && !initial[id] {
+			stale = append(stale, id)
+		}
+	}
+	m.mutex.Unlock()
+
+	for _, id := range stale {
+		m.remove(p, id)
+	}
+}
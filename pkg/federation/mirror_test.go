@@ -0,0 +1,109 @@
+package federation
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+)
+
+// waitFor polls a condition until it holds or a second has passed
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestMirror(t *testing.T) {
+	peer := newFakePeer(t, newPump("b-pump-1", "south"), newPump("b-pump-2", "south"), newPump("local", "south"))
+	reg := registry.NewRegistry()
+	reg.Create(newPump("local", "north"))
+	reg.Create(newPump("b-pump-3", "north"))
+	pubsub := messaging_sim.NewPubSub()
+	events := pubsub.SubscribeWithBuffer("twin.+", 10)
+	m, _ := NewManager(reg, pubsub, []PeerOptions{{Name: "site-b", URL: peer.server.URL + "/api/v1", Mirror: true}})
+	var deleted []string
+	var deletedMutex sync.Mutex
+	m.SetDeleteHook(func(twinID string) {
+		deletedMutex.Lock()
+		defer deletedMutex.Unlock()
+		deleted = append(deleted, twinID)
+	})
+
+	// A copy of a twin the peer deleted while disconnected is pruned
+	m.twins["b-pump-3"] = &entry{peer: m.peers[0], mirrored: true}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		m.Run(ctx)
+		close(done)
+	}()
+
+	waitFor(t, "the initial matches", func() bool { return m.Status()[0].Connected })
+	for _, id := range []string{"b-pump-1", "b-pump-2"} {
+		if _, err := reg.Get(id); err != nil {
+			t.Errorf("Expected %s to be mirrored: %v", id, err)
+		}
+	}
+	if _, err := reg.Get("b-pump-3"); err != registry.ErrTwinNotFound {
+		t.Error("Expected the stale copy to be pruned")
+	}
+	if dt, _ := reg.Get("local"); dt != nil {
+		if site, _ := dt.GetAttribute("site"); site != "north" {
+			t.Error("Expected the local twin to be kept")
+		}
+	}
+
+	// Changes are applied and published locally
+	updated := newPump("b-pump-1", "east")
+	updated.SetRevision(2)
+	peer.changes <- "update " + string(wire(updated))
+	peer.changes <- `remove {"id":"b-pump-2"}`
+	waitFor(t, "the changes", func() bool { return m.Status()[0].Events == 5 })
+
+	dt, _ := reg.Get("b-pump-1")
+	if site, _ := dt.GetAttribute("site"); site != "east" {
+		t.Errorf("Expected the update to be applied, got %v", site)
+	}
+	if _, err := reg.Get("b-pump-2"); err != registry.ErrTwinNotFound {
+		t.Error("Expected the removed twin to be deleted")
+	}
+
+	topics := make(map[string]int)
+	for len(events) > 0 {
+		topics[(<-events).Topic]++
+	}
+	if topics["twin.created"] != 2 || topics["twin.updated"] != 1 || topics["twin.deleted"] != 2 {
+		t.Errorf("Unexpected events %v", topics)
+	}
+	deletedMutex.Lock()
+	if len(deleted) != 2 || deleted[0] != "b-pump-3" || deleted[1] != "b-pump-2" {
+		t.Errorf("Expected the delete hook to be called for the deleted copies, got %v", deleted)
+	}
+	deletedMutex.Unlock()
+
+	// Mirrored copies are fresh while connected
+	peer.mutex.Lock()
+	peer.down = true
+	peer.mutex.Unlock()
+	if err := m.Fetch(context.Background(), "b-pump-1"); err != nil {
+		t.Errorf("Expected the mirrored copy to be served, got %v", err)
+	}
+
+	status := m.Status()[0]
+	if status.Twins != 1 || status.Failures != 1 || status.LastEvent == nil {
+		t.Errorf("Unexpected status %+v", status)
+	}
+
+	cancel()
+	<-done
+}
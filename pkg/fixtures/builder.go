@@ -0,0 +1,133 @@
+package fixtures
+
+import (
+	"github.com/aleka07/go-digital-twin/pkg/script"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// Builder declares a fixture in Go code:
+//
+//	b := fixtures.NewBuilder()
+//	b.Twin("pump-1", "pump").Attribute("site", "berlin").Property("status", "rpm", 1200.0).Relate("feeds", "valve-1")
+//	b.Twin("valve-1", "valve").Desired("position", "open", true)
+//	b.Rule("overspeed", "def evaluate(twin):\n    return twin['features']['status']['properties']['rpm'] > 3000")
+//	report, err := fixtures.Seed(b.Fixture(), reg, pubsub, scripts)
+type Builder struct {
+	fixture Fixture
+}
+
+// NewBuilder creates an empty fixture builder
+func NewBuilder() *Builder {
+	return &Builder{}
+}
+
+// Twin declares a twin and returns a builder for its contents
+func (b *Builder) Twin(id, twinType string) *TwinBuilder {
+	b.fixture.Twins = append(b.fixture.Twins, Twin{ID: id, Type: twinType})
+	return &TwinBuilder{builder: b, index: len(b.fixture.Twins) - 1}
+}
+
+// Rule declares a rule script
+func (b *Builder) Rule(name, source string) *Builder {
+	return b.Script(script.Script{Name: name, Kind: script.KindRule, Source: source})
+}
+
+// Script declares a script of any kind
+func (b *Builder) Script(s script.Script) *Builder {
+	b.fixture.Rules = append(b.fixture.Rules, s)
+	return b
+}
+
+// Fixture returns a copy of the declared fixture
+func (b *Builder) Fixture() *Fixture {
+	f := &Fixture{}
+	f.Merge(&b.fixture)
+	return f
+}
+
+// TwinBuilder declares the contents of a twin
+type TwinBuilder struct {
+	builder *Builder
+	index   int
+}
+
+// twin returns the declaration being built
+func (tb *TwinBuilder) twin() *Twin {
+	return &tb.builder.fixture.Twins[tb.index]
+}
+
+// feature returns a feature of the declaration, declaring it if needed
+func (tb *TwinBuilder) feature(id string) Feature {
+	t := tb.twin()
+	if t.Features == nil {
+		t.Features = make(map[string]Feature)
+	}
+	return t.Features[id]
+}
+
+// Definition sets the definition of the twin
+func (tb *TwinBuilder) Definition(definition string) *TwinBuilder {
+	tb.twin().Definition = definition
+	return tb
+}
+
+// Lifecycle sets the lifecycle state of the twin
+func (tb *TwinBuilder) Lifecycle(state twin.LifecycleState) *TwinBuilder {
+	tb.twin().Lifecycle = state
+	return tb
+}
+
+// Attribute sets an attribute
+func (tb *TwinBuilder) Attribute(key string, value interface{}) *TwinBuilder {
+	t := tb.twin()
+	if t.Attributes == nil {
+		t.Attributes = make(map[string]interface{})
+	}
+	t.Attributes[key] = value
+	return tb
+}
+
+// Feature declares a feature with definitions
+func (tb *TwinBuilder) Feature(id string, definition ...string) *TwinBuilder {
+	f := tb.feature(id)
+	f.Definition = append(f.Definition, definition...)
+	tb.twin().Features[id] = f
+	return tb
+}
+
+// Property sets a reported property of a feature, declaring the feature if needed
+func (tb *TwinBuilder) Property(featureID, key string, value interface{}) *TwinBuilder {
+	f := tb.feature(featureID)
+	if f.Properties == nil {
+		f.Properties = make(map[string]interface{})
+	}
+	f.Properties[key] = value
+	tb.twin().Features[featureID] = f
+	return tb
+}
+
+// Desired sets a desired property of a feature, declaring the feature if needed
+func (tb *TwinBuilder) Desired(featureID, key string, value interface{}) *TwinBuilder {
+	f := tb.feature(featureID)
+	if f.DesiredProperties == nil {
+		f.DesiredProperties = make(map[string]interface{})
+	}
+	f.DesiredProperties[key] = value
+	tb.twin().Features[featureID] = f
+	return tb
+}
+
+// Relate links the twin to target twins under a relationship name
+func (tb *TwinBuilder) Relate(name string, targets ...string) *TwinBuilder {
+	t := tb.twin()
+	if t.Relationships == nil {
+		t.Relationships = make(map[string][]string)
+	}
+	t.Relationships[name] = append(t.Relationships[name], targets...)
+	return tb
+}
+
+// Twin declares another twin
+func (tb *TwinBuilder) Twin(id, twinType string) *TwinBuilder {
+	return tb.builder.Twin(id, twinType)
+}
@@ -0,0 +1,269 @@
+// Package fixtures declares twins, with their features and relationships,
+// and rules to seed a server with, so that demos and integration tests start
+// from reproducible data. Fixtures are built in Go code with a Builder or
+// read from YAML or JSON files, and seeding skips what already exists.
+package fixtures
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aleka07/go-digital-twin/pkg/eventbus"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/script"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrInvalidFixture is returned for fixtures that cannot be seeded
+var ErrInvalidFixture = errors.New("invalid fixture")
+
+// Source is the _system source of seeded twins
+const Source = "seed"
+
+// Fixture is a set of twins and rules
+type Fixture struct {
+	Twins []Twin          `json:"twins,omitempty"`
+	Rules []script.Script `json:"rules,omitempty"` // Scripts of any kind, rules when the kind is empty
+}
+
+// Twin declares a twin
+type Twin struct {
+	ID            string                 `json:"id"`
+	Type          string                 `json:"type"`
+	Definition    string                 `json:"definition,omitempty"`
+	Lifecycle     twin.LifecycleState    `json:"lifecycle,omitempty"` // Provisioned when empty
+	Attributes    map[string]interface{} `json:"attributes,omitempty"`
+	Features      map[string]Feature     `json:"features,omitempty"`
+	Relationships map[string][]string    `json:"relationships,omitempty"` // Name -> target twin IDs
+}
+
+// Feature declares a feature of a twin
+type Feature struct {
+	Definition        []string               `json:"definition,omitempty"`
+	Properties        map[string]interface{} `json:"properties,omitempty"`
+	DesiredProperties map[string]interface{} `json:"desiredProperties,omitempty"`
+}
+
+// Report lists what seeding created and skipped
+type Report struct {
+	Created []string `json:"created"` // Twins
+	Skipped []string `json:"skipped"` // Twins that already existed
+	Rules   []string `json:"rules"`   // Created or replaced rules
+}
+
+// Validate checks that twins and rules have IDs and names, unique within
+// the fixture, and valid lifecycle states
+func (f *Fixture) Validate() error {
+	ids := make(map[string]bool, len(f.Twins))
+	for _, t := range f.Twins {
+		if t.ID == "" || t.Type == "" {
+			return fmt.Errorf("%w: twins need an id and type", ErrInvalidFixture)
+		}
+		if ids[t.ID] {
+			return fmt.Errorf("%w: twin %s is declared twice", ErrInvalidFixture, t.ID)
+		}
+		ids[t.ID] = true
+
+		if t.Lifecycle != "" {
+			if _, err := twin.ParseLifecycleState(string(t.Lifecycle)); err != nil {
+				return fmt.Errorf("%w: twin %s: %v", ErrInvalidFixture, t.ID, err)
+			}
+		}
+		for name, targets := range t.Relationships {
+			for _, target := range targets {
+				if name == "" || target == "" {
+					return fmt.Errorf("%w: twin %s has an empty relationship", ErrInvalidFixture, t.ID)
+				}
+			}
+		}
+	}
+
+	names := make(map[string]bool, len(f.Rules))
+	for _, r := range f.Rules {
+		if r.Name == "" {
+			return fmt.Errorf("%w: rules need a name", ErrInvalidFixture)
+		}
+		if names[r.Name] {
+			return fmt.Errorf("%w: rule %s is declared twice", ErrInvalidFixture, r.Name)
+		}
+		names[r.Name] = true
+	}
+	return nil
+}
+
+// Merge appends the twins and rules of other fixtures
+func (f *Fixture) Merge(others ...*Fixture) {
+	for _, o := range others {
+		f.Twins = append(f.Twins, o.Twins...)
+		f.Rules = append(f.Rules, o.Rules...)
+	}
+}
+
+// build returns the digital twin a declaration describes
+func (t Twin) build() (*twin.DigitalTwin, error) {
+	dt := twin.NewDigitalTwin(t.ID, t.Type)
+	if t.Definition != "" {
+		dt.SetDefinition(t.Definition)
+	}
+	for k, v := range t.Attributes {
+		dt.SetAttribute(k, v)
+	}
+
+	for id, f := range t.Features {
+		feature := twin.NewFeatureState()
+		if len(f.Definition) > 0 {
+			feature.SetDefinition(f.Definition)
+		}
+		for k, v := range f.Properties {
+			feature.SetProperty(k, v)
+		}
+		for k, v := range f.DesiredProperties {
+			feature.SetDesiredProperty(k, v)
+		}
+		if err := dt.AddFeature(id, feature); err != nil {
+			return nil, err
+		}
+	}
+
+	for name, targets := range t.Relationships {
+		if err := dt.SetRelationship(name, targets); err != nil {
+			return nil, err
+		}
+	}
+
+	if t.Lifecycle != "" && t.Lifecycle != twin.LifecycleProvisioned {
+		if err := dt.SetLifecycle(t.Lifecycle); err != nil {
+			return nil, err
+		}
+	}
+	dt.SetSystem(twin.SystemSource, Source)
+	return dt, nil
+}
+
+// Seed creates the twins of a fixture that do not exist yet, in the order
+// they are declared, and creates or replaces its rules. Rules are only
+// seeded when a script manager is given. Twins that already exist are left
+// unchanged, so seeding again has no effect.
+func Seed(f *Fixture, reg *registry.Registry, pubsub eventbus.Publisher, scripts *script.Manager) (Report, error) {
+	report := Report{Created: []string{}, Skipped: []string{}, Rules: []string{}}
+	if err := f.Validate(); err != nil {
+		return report, err
+	}
+
+	for _, t := range f.Twins {
+		dt, err := t.build()
+		if err != nil {
+			return report, fmt.Errorf("%w: twin %s: %v", ErrInvalidFixture, t.ID, err)
+		}
+		if err := reg.Create(dt); err != nil {
+			if err == registry.ErrTwinAlreadyExists {
+				report.Skipped = append(report.Skipped, t.ID)
+				continue
+			}
+			return report, fmt.Errorf("failed to create %s: %w", t.ID, err)
+		}
+		report.Created = append(report.Created, t.ID)
+		if pubsub != nil {
+			pubsub.Publish("twin.created", map[string]string{"id": t.ID})
+		}
+	}
+
+	if scripts == nil {
+		return report, nil
+	}
+	for _, r := range f.Rules {
+		if r.Kind == "" {
+			r.Kind = script.KindRule
+		}
+		err := scripts.Create(r)
+		if err == script.ErrScriptAlreadyExists {
+			err = scripts.Replace(r)
+		}
+		if err != nil {
+			return report, fmt.Errorf("failed to create rule %s: %w", r.Name, err)
+		}
+		report.Rules = append(report.Rules, r.Name)
+	}
+	return report, nil
+}
+
+// Parse decodes a fixture file. YAML is converted to JSON first, so both
+// formats produce the same values as the JSON API.
+func Parse(name string, data []byte) (*Fixture, error) {
+	if ext := strings.ToLower(filepath.Ext(name)); ext == ".yaml" || ext == ".yml" {
+		var doc interface{}
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidFixture, name, err)
+		}
+
+		var err error
+		if data, err = json.Marshal(doc); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidFixture, name, err)
+		}
+	}
+
+	var f Fixture
+	if trimmed := strings.TrimSpace(string(data)); trimmed == "" || trimmed == "null" {
+		return &f, nil
+	}
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidFixture, name, err)
+	}
+	return &f, nil
+}
+
+// Load reads a fixture file, or the YAML and JSON fixture files of a
+// directory and its subdirectories merged in the order of their paths
+func Load(path string) (*Fixture, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	if info.IsDir() {
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			switch strings.ToLower(filepath.Ext(p)) {
+			case ".yaml", ".yml", ".json":
+				if !d.IsDir() {
+					files = append(files, p)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(files)
+	} else {
+		files = []string{path}
+	}
+
+	fixture := &Fixture{}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		f, err := Parse(file, data)
+		if err != nil {
+			return nil, err
+		}
+		fixture.Merge(f)
+	}
+
+	if err := fixture.Validate(); err != nil {
+		return nil, err
+	}
+	return fixture, nil
+}
@@ -0,0 +1,154 @@
+package fixtures
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/script"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestBuilderSeed(t *testing.T) {
+	reg := registry.NewRegistry()
+	pubsub := messaging_sim.NewPubSub()
+	scripts := script.NewManager(reg, pubsub)
+	events := pubsub.SubscribeWithBuffer("twin.created", 10)
+
+	b := NewBuilder()
+	b.Twin("pump-1", "pump").
+		Attribute("site", "berlin").
+		Feature("status", "org.example:Status:1.0.0").
+		Property("status", "rpm", 1200.0).
+		Desired("control", "speed", 1500.0).
+		Relate("feeds", "valve-1", "valve-2").
+		Twin("valve-1", "valve").
+		Lifecycle(twin.LifecycleActive)
+	b.Rule("overspeed", "def evaluate(twin): return True")
+
+	report, err := Seed(b.Fixture(), reg, pubsub, scripts)
+	if err != nil {
+		t.Fatalf("Failed to seed: %v", err)
+	}
+	if len(report.Created) != 2 || len(report.Skipped) != 0 || len(report.Rules) != 1 {
+		t.Errorf("Unexpected report %+v", report)
+	}
+	if len(events) != 2 {
+		t.Errorf("Expected 2 twin.created events, got %d", len(events))
+	}
+
+	pump, err := reg.Get("pump-1")
+	if err != nil {
+		t.Fatalf("Expected the pump: %v", err)
+	}
+	if site, _ := pump.GetAttribute("site"); site != "berlin" {
+		t.Errorf("Expected site berlin, got %v", site)
+	}
+	status, _ := pump.GetFeature("status")
+	if rpm, _ := status.GetProperty("rpm"); rpm != 1200.0 || len(status.GetDefinition()) != 1 {
+		t.Errorf("Unexpected status feature %v %v", rpm, status.GetDefinition())
+	}
+	control, _ := pump.GetFeature("control")
+	if speed, _ := control.GetDesiredProperty("speed"); speed != 1500.0 {
+		t.Errorf("Expected desired speed 1500, got %v", speed)
+	}
+	if feeds := pump.GetRelationship("feeds"); len(feeds) != 2 {
+		t.Errorf("Expected 2 relationships, got %v", feeds)
+	}
+	if source, _ := pump.GetSystem(twin.SystemSource); source != Source {
+		t.Errorf("Expected source %s, got %v", Source, source)
+	}
+	valve, _ := reg.Get("valve-1")
+	if valve.GetLifecycle() != twin.LifecycleActive {
+		t.Errorf("Expected an active valve, got %s", valve.GetLifecycle())
+	}
+	if _, err := scripts.Get("overspeed"); err != nil {
+		t.Errorf("Expected the rule: %v", err)
+	}
+
+	// Seeding again keeps existing twins and replaces rules
+	report, err = Seed(b.Fixture(), reg, pubsub, scripts)
+	if err != nil || len(report.Created) != 0 || len(report.Skipped) != 2 || len(report.Rules) != 1 {
+		t.Errorf("Unexpected second report %+v (%v)", report, err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "01-plant.yaml"), []byte(`
+twins:
+  - id: line-1
+    type: line
+    relationships:
+      contains: [robot-1]
+  - id: robot-1
+    type: robot
+    features:
+      arm:
+        properties:
+          angle: 90
+`), 0644)
+	os.MkdirAll(filepath.Join(dir, "rules"), 0755)
+	os.WriteFile(filepath.Join(dir, "rules", "limits.json"), []byte(
+		`{"rules": [{"name": "angle", "source": "def evaluate(twin): return False"}]}`), 0644)
+	os.WriteFile(filepath.Join(dir, "README.md"), []byte("# not a fixture"), 0644)
+
+	f, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	if len(f.Twins) != 2 || len(f.Rules) != 1 {
+		t.Fatalf("Unexpected fixture %+v", f)
+	}
+	if angle := f.Twins[1].Features["arm"].Properties["angle"]; angle != 90.0 {
+		t.Errorf("Expected YAML numbers to decode like JSON, got %T %v", angle, angle)
+	}
+
+	reg := registry.NewRegistry()
+	scripts := script.NewManager(reg, messaging_sim.NewPubSub())
+	if _, err := Seed(f, reg, nil, scripts); err != nil {
+		t.Fatalf("Failed to seed: %v", err)
+	}
+	if status, err := scripts.Get("angle"); err != nil || status.Kind != script.KindRule {
+		t.Errorf("Expected a rule, got %+v (%v)", status, err)
+	}
+
+	// Single files load too
+	if f, err := Load(filepath.Join(dir, "01-plant.yaml")); err != nil || len(f.Twins) != 2 {
+		t.Errorf("Failed to load a single file: %v", err)
+	}
+	if _, err := Load(filepath.Join(dir, "missing")); err == nil {
+		t.Error("Expected an error for a missing path")
+	}
+}
+
+func TestInvalidFixtures(t *testing.T) {
+	for name, data := range map[string]string{
+		"type.json":      `{"twins": [{"id": "a"}]}`,
+		"duplicate.json": `{"twins": [{"id": "a", "type": "t"}, {"id": "a", "type": "t"}]}`,
+		"lifecycle.json": `{"twins": [{"id": "a", "type": "t", "lifecycle": "retired"}]}`,
+		"relation.json":  `{"twins": [{"id": "a", "type": "t", "relationships": {"feeds": [""]}}]}`,
+		"rule.json":      `{"rules": [{"source": "def evaluate(twin): return True"}]}`,
+		"syntax.yaml":    "twins: [",
+	} {
+		f, err := Parse(name, []byte(data))
+		if err == nil {
+			err = f.Validate()
+		}
+		if !errors.Is(err, ErrInvalidFixture) {
+			t.Errorf("%s: expected ErrInvalidFixture, got %v", name, err)
+		}
+	}
+
+	// Rules that do not compile fail seeding
+	reg := registry.NewRegistry()
+	scripts := script.NewManager(reg, messaging_sim.NewPubSub())
+	b := NewBuilder()
+	b.Rule("broken", "def evaluate(twin) return True")
+	if _, err := Seed(b.Fixture(), reg, nil, scripts); err == nil {
+		t.Error("Expected an invalid rule to fail")
+	}
+}
@@ -0,0 +1,280 @@
+package freshness
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/eventbus"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// Common errors
+var (
+	ErrSLANotFound = errors.New("freshness SLA not found")
+	ErrInvalidSLA  = errors.New("invalid freshness SLA")
+)
+
+// Freshness alert topics
+const (
+	StaleTopic    = "freshness.stale"
+	ResolvedTopic = "freshness.resolved"
+)
+
+// DefaultCheckInterval is how often the watchdog checks properties
+const DefaultCheckInterval = 10 * time.Second
+
+// SLA declares how often a property is expected to update. A property is
+// stale when the effective time of its current value is older than the interval.
+type SLA struct {
+	FeatureID string `json:"featureId"`
+	Property  string `json:"property"`
+	Interval  string `json:"interval"`       // Expected update interval such as "5m"
+	Type      string `json:"type,omitempty"` // Only applies to twins of this type when set
+
+	interval time.Duration
+}
+
+// StaleProperty is a property that has not updated within the interval of its SLA
+type StaleProperty struct {
+	TwinID     string    `json:"twinId"`
+	FeatureID  string    `json:"featureId"`
+	Property   string    `json:"property"`
+	Interval   string    `json:"interval"`
+	LastUpdate time.Time `json:"lastUpdate"`
+	Since      time.Time `json:"since"` // When the watchdog flagged the property
+}
+
+// Manager keeps the freshness SLAs of properties and flags properties that
+// miss them
+type Manager struct {
+	registry *registry.Registry
+	pubsub   eventbus.Publisher
+	slas     map[string]SLA           // "featureID/property" -> SLA
+	stale    map[string]StaleProperty // "twinID/featureID/property" -> stale property
+	mutex    sync.RWMutex
+	now      func() time.Time
+}
+
+// NewManager creates a new freshness manager
+func NewManager(reg *registry.Registry, pubsub eventbus.Publisher) *Manager {
+	return &Manager{
+		registry: reg,
+		pubsub:   pubsub,
+		slas:     make(map[string]SLA),
+		stale:    make(map[string]StaleProperty),
+		now:      time.Now,
+	}
+}
+
+// slaKey identifies a property across all twins
+func slaKey(featureID, property string) string {
+	return featureID + "/" + property
+}
+
+// Set declares the SLA of a property, replacing any previous one
+func (m *Manager) Set(sla SLA) error {
+	if sla.FeatureID == "" || sla.Property == "" {
+		return fmt.Errorf("%w: featureId and property are required", ErrInvalidSLA)
+	}
+
+	interval, err := time.ParseDuration(sla.Interval)
+	if err != nil || interval <= 0 {
+		return fmt.Errorf("%w: invalid interval %q", ErrInvalidSLA, sla.Interval)
+	}
+	sla.interval = interval
+	sla.Interval = interval.String()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.slas[slaKey(sla.FeatureID, sla.Property)] = sla
+	return nil
+}
+
+// Get returns the SLA of a property
+func (m *Manager) Get(featureID, property string) (SLA, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	sla, exists := m.slas[slaKey(featureID, property)]
+	if !exists {
+		return SLA{}, ErrSLANotFound
+	}
+	return sla, nil
+}
+
+// List returns all SLAs sorted by feature and property
+func (m *Manager) List() []SLA {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	result := make([]SLA, 0, len(m.slas))
+	for _, sla := range m.slas {
+		result = append(result, sla)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return slaKey(result[i].FeatureID, result[i].Property) < slaKey(result[j].FeatureID, result[j].Property)
+	})
+	return result
+}
+
+// Delete removes the SLA of a property. Properties flagged stale under it
+// are cleared by the next check.
+func (m *Manager) Delete(featureID, property string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	key := slaKey(featureID, property)
+	if _, exists := m.slas[key]; !exists {
+		return ErrSLANotFound
+	}
+	delete(m.slas, key)
+	return nil
+}
+
+// Stale returns the properties flagged by the last check, sorted by twin,
+// feature and property
+func (m *Manager) Stale() []StaleProperty {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	result := make([]StaleProperty, 0, len(m.stale))
+	for _, sp := range m.stale {
+		result = append(result, sp)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return staleKey(result[i]) < staleKey(result[j]) })
+	return result
+}
+
+// staleKey identifies a property of a twin
+func staleKey(sp StaleProperty) string {
+	return sp.TwinID + "/" + sp.FeatureID + "/" + sp.Property
+}
+
+// Check compares all properties with an SLA against the current time. It
+// sets the stale flag in the metadata of properties that missed their
+// interval, clears it for properties that caught up, and publishes an alert
+// whenever a property becomes stale or fresh again. Properties that never had
+// a value and decommissioned twins are not checked.
+func (m *Manager) Check() []StaleProperty {
+	now := m.now()
+
+	m.mutex.Lock()
+	slas := make([]SLA, 0, len(m.slas))
+	for _, sla := range m.slas {
+		slas = append(slas, sla)
+	}
+	m.mutex.Unlock()
+
+	found := make(map[string]StaleProperty)
+	for _, dt := range m.registry.List() {
+		if dt.GetLifecycle() == twin.LifecycleDecommissioned {
+			continue
+		}
+
+		for _, sla := range slas {
+			if sla.Type != "" && dt.Type != sla.Type {
+				continue
+			}
+
+			feature, exists := dt.GetFeature(sla.FeatureID)
+			if !exists {
+				continue
+			}
+			meta, exists := feature.GetPropertyMetadata(sla.Property)
+			if !exists {
+				continue
+			}
+
+			if now.Sub(meta.Timestamp) <= sla.interval {
+				feature.SetPropertyStale(sla.Property, false)
+				continue
+			}
+
+			feature.SetPropertyStale(sla.Property, true)
+			sp := StaleProperty{
+				TwinID:     dt.ID,
+				FeatureID:  sla.FeatureID,
+				Property:   sla.Property,
+				Interval:   sla.Interval,
+				LastUpdate: meta.Timestamp,
+				Since:      now,
+			}
+			found[staleKey(sp)] = sp
+		}
+	}
+
+	m.mutex.Lock()
+	var detected, resolved []StaleProperty
+	for key, sp := range found {
+		if previous, exists := m.stale[key]; exists {
+			sp.Since = previous.Since
+			found[key] = sp
+		} else {
+			detected = append(detected, sp)
+		}
+	}
+	for key, sp := range m.stale {
+		if _, exists := found[key]; !exists {
+			resolved = append(resolved, sp)
+		}
+	}
+	m.stale = found
+	m.mutex.Unlock()
+
+	for _, sp := range resolved {
+		m.clear(sp)
+		m.pubsub.Publish(ResolvedTopic, payload(sp))
+	}
+	for _, sp := range detected {
+		m.pubsub.Publish(StaleTopic, payload(sp))
+	}
+
+	return m.Stale()
+}
+
+// clear removes the stale flag of a property that is no longer checked, e.g.
+// because its SLA was deleted
+func (m *Manager) clear(sp StaleProperty) {
+	dt, err := m.registry.Get(sp.TwinID)
+	if err != nil {
+		return
+	}
+	if feature, exists := dt.GetFeature(sp.FeatureID); exists {
+		feature.SetPropertyStale(sp.Property, false)
+	}
+}
+
+// payload returns the event payload of a freshness alert
+func payload(sp StaleProperty) map[string]interface{} {
+	return map[string]interface{}{
+		"twinId":     sp.TwinID,
+		"featureId":  sp.FeatureID,
+		"property":   sp.Property,
+		"path":       "features." + sp.FeatureID + ".properties." + sp.Property,
+		"interval":   sp.Interval,
+		"lastUpdate": sp.LastUpdate,
+	}
+}
+
+// Run checks properties at the given interval until the context is cancelled
+func (m *Manager) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.Check()
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package freshness
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestSetAndList(t *testing.T) {
+	m := NewManager(registry.NewRegistry(), messaging_sim.NewPubSub())
+
+	invalid := []SLA{
+		{Property: "temperature", Interval: "5m"},
+		{FeatureID: "climate", Property: "temperature"},
+		{FeatureID: "climate", Property: "temperature", Interval: "-1m"},
+	}
+	for _, sla := range invalid {
+		if err := m.Set(sla); !errors.Is(err, ErrInvalidSLA) {
+			t.Errorf("Expected ErrInvalidSLA for %+v, got %v", sla, err)
+		}
+	}
+
+	m.Set(SLA{FeatureID: "climate", Property: "temperature", Interval: "300s"})
+	m.Set(SLA{FeatureID: "climate", Property: "humidity", Interval: "1h"})
+
+	sla, err := m.Get("climate", "temperature")
+	if err != nil || sla.Interval != "5m0s" {
+		t.Errorf("Expected the interval in canonical form, got %+v (%v)", sla, err)
+	}
+
+	list := m.List()
+	if len(list) != 2 || list[0].Property != "humidity" {
+		t.Errorf("Expected 2 SLAs sorted by property, got %+v", list)
+	}
+
+	if err := m.Delete("climate", "humidity"); err != nil {
+		t.Errorf("Failed to delete SLA: %v", err)
+	}
+	if _, err := m.Get("climate", "humidity"); err != ErrSLANotFound {
+		t.Errorf("Expected ErrSLANotFound, got %v", err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	reg := registry.NewRegistry()
+	pubsub := messaging_sim.NewPubSub()
+	events := pubsub.Subscribe("freshness.+")
+
+	now := time.Now()
+	for _, id := range []string{"sensor-1", "sensor-2"} {
+		dt := twin.NewDigitalTwin(id, "sensor")
+		climate := twin.NewFeatureState()
+		climate.SetPropertyAt("temperature", 21.0, now.Add(-10*time.Minute))
+		dt.AddFeature("climate", climate)
+		reg.Create(dt)
+	}
+	fresh, _ := reg.Get("sensor-2")
+	climate, _ := fresh.GetFeature("climate")
+	climate.SetPropertyAt("temperature", 21.0, now)
+
+	m := NewManager(reg, pubsub)
+	m.now = func() time.Time { return now }
+	m.Set(SLA{FeatureID: "climate", Property: "temperature", Interval: "5m"})
+
+	stale := m.Check()
+	if len(stale) != 1 || stale[0].TwinID != "sensor-1" {
+		t.Fatalf("Expected sensor-1 to be stale, got %+v", stale)
+	}
+
+	dt, _ := reg.Get("sensor-1")
+	climate, _ = dt.GetFeature("climate")
+	if meta, _ := climate.GetPropertyMetadata("temperature"); !meta.Stale {
+		t.Error("Expected the stale flag to be set in the metadata")
+	}
+
+	msg := <-events
+	if payload := msg.Payload.(map[string]interface{}); msg.Topic != StaleTopic || payload["twinId"] != "sensor-1" {
+		t.Errorf("Expected a stale alert for sensor-1, got %s %v", msg.Topic, msg.Payload)
+	}
+
+	// Checking again does not alert again
+	m.now = func() time.Time { return now.Add(time.Minute) }
+	if stale := m.Check(); len(stale) != 1 || !stale[0].Since.Equal(now) {
+		t.Errorf("Expected sensor-1 to stay stale since the first check, got %+v", stale)
+	}
+
+	// A new value resolves the alert
+	climate.SetPropertyAt("temperature", 22.0, now.Add(time.Minute))
+	if stale := m.Check(); len(stale) != 0 {
+		t.Errorf("Expected no stale properties, got %+v", stale)
+	}
+
+	msg = <-events
+	if payload := msg.Payload.(map[string]interface{}); msg.Topic != ResolvedTopic || payload["twinId"] != "sensor-1" {
+		t.Errorf("Expected a resolved alert for sensor-1, got %s %v", msg.Topic, msg.Payload)
+	}
+
+	// Deleting the SLA clears the flag
+	m.now = func() time.Time { return now.Add(time.Hour) }
+	if stale := m.Check(); len(stale) != 2 {
+		t.Fatalf("Expected both sensors to be stale, got %+v", stale)
+	}
+	m.Delete("climate", "temperature")
+	m.Check()
+	if meta, _ := climate.GetPropertyMetadata("temperature"); meta.Stale {
+		t.Error("Expected the stale flag to be cleared with the SLA")
+	}
+}
+
+func TestCheckScope(t *testing.T) {
+	reg := registry.NewRegistry()
+	now := time.Now()
+
+	for id, twinType := range map[string]string{"pump-1": "pump", "sensor-1": "sensor", "sensor-2": "sensor"} {
+		dt := twin.NewDigitalTwin(id, twinType)
+		status := twin.NewFeatureState()
+		status.SetPropertyAt("online", true, now.Add(-time.Hour))
+		dt.AddFeature("status", status)
+		reg.Create(dt)
+	}
+	retired, _ := reg.Get("sensor-2")
+	retired.SetLifecycle(twin.LifecycleDecommissioned)
+
+	m := NewManager(reg, messaging_sim.NewPubSub())
+	m.Set(SLA{FeatureID: "status", Property: "online", Interval: "1m", Type: "sensor"})
+
+	if stale := m.Check(); len(stale) != 1 || stale[0].TwinID != "sensor-1" {
+		t.Errorf("Expected only active sensors to be checked, got %+v", stale)
+	}
+}
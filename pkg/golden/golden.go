@@ -0,0 +1,321 @@
+package golden
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/eventbus"
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/query"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// Common errors
+var (
+	ErrGoldenNotFound = errors.New("golden twin not found")
+	ErrInvalidGolden  = errors.New("invalid golden twin")
+)
+
+// Drift alert topics
+const (
+	DriftDetectedTopic = "drift.detected"
+	DriftResolvedTopic = "drift.resolved"
+)
+
+// Golden designates a twin as the reference configuration for its type
+type Golden struct {
+	Type      string   `json:"type"`
+	TwinID    string   `json:"twinId"`
+	Paths     []string `json:"paths,omitempty"`     // Compared paths, all attributes and desired properties of the golden twin when empty
+	Tolerance float64  `json:"tolerance,omitempty"` // Allowed absolute difference of numeric values
+	Alert     bool     `json:"alert,omitempty"`     // Publish drift events when twins start or stop deviating
+}
+
+// Deviation is a configuration value that differs from the golden twin
+type Deviation struct {
+	Path     string      `json:"path"`
+	Expected interface{} `json:"expected,omitempty"`
+	Actual   interface{} `json:"actual,omitempty"`
+	Missing  bool        `json:"missing,omitempty"` // The twin has no value at the path
+}
+
+// Report is the result of comparing a twin with the golden twin of its type
+type Report struct {
+	TwinID       string      `json:"twinId"`
+	Type         string      `json:"type"`
+	GoldenTwinID string      `json:"goldenTwinId"`
+	Drifted      bool        `json:"drifted"`
+	Deviations   []Deviation `json:"deviations"`
+	CheckedAt    time.Time   `json:"checkedAt"`
+}
+
+// Manager keeps the golden twin of each type and checks twins for drift
+type Manager struct {
+	registry *registry.Registry
+	pubsub   eventbus.Publisher
+	goldens  map[string]Golden // Twin type -> golden
+	drifted  map[string]bool   // Twin ID -> last alerted drift state
+	mutex    sync.RWMutex
+}
+
+// NewManager creates a new golden twin manager
+func NewManager(reg *registry.Registry, pubsub eventbus.Publisher) *Manager {
+	return &Manager{
+		registry: reg,
+		pubsub:   pubsub,
+		goldens:  make(map[string]Golden),
+		drifted:  make(map[string]bool),
+	}
+}
+
+// Set designates the golden twin of a type, replacing any previous one.
+// The golden twin must exist and be of that type.
+func (m *Manager) Set(g Golden) error {
+	if g.Type == "" || g.TwinID == "" {
+		return fmt.Errorf("%w: type and twinId are required", ErrInvalidGolden)
+	}
+	if g.Tolerance < 0 || math.IsNaN(g.Tolerance) {
+		return fmt.Errorf("%w: tolerance must not be negative", ErrInvalidGolden)
+	}
+	for _, path := range g.Paths {
+		if err := query.ValidatePath(path); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidGolden, err)
+		}
+	}
+
+	dt, err := m.registry.Get(g.TwinID)
+	if err != nil {
+		return err
+	}
+	if dt.Type != g.Type {
+		return fmt.Errorf("%w: twin %s is of type %s", ErrInvalidGolden, g.TwinID, dt.Type)
+	}
+
+	m.mutex.Lock()
+	m.goldens[g.Type] = g
+	m.mutex.Unlock()
+
+	if g.Alert {
+		m.checkType(g.Type)
+	}
+	return nil
+}
+
+// Get returns the golden twin of a type
+func (m *Manager) Get(twinType string) (Golden, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	g, exists := m.goldens[twinType]
+	if !exists {
+		return Golden{}, ErrGoldenNotFound
+	}
+	return g, nil
+}
+
+// List returns all golden twins sorted by type
+func (m *Manager) List() []Golden {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	result := make([]Golden, 0, len(m.goldens))
+	for _, g := range m.goldens {
+		result = append(result, g)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Type < result[j].Type })
+	return result
+}
+
+// Delete removes the golden twin of a type
+func (m *Manager) Delete(twinType string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, exists := m.goldens[twinType]; !exists {
+		return ErrGoldenNotFound
+	}
+	delete(m.goldens, twinType)
+	return nil
+}
+
+// Check compares a twin with the golden twin of its type
+func (m *Manager) Check(twinID string) (Report, error) {
+	dt, err := m.registry.Get(twinID)
+	if err != nil {
+		return Report{}, err
+	}
+
+	g, err := m.Get(dt.Type)
+	if err != nil {
+		return Report{}, err
+	}
+
+	golden, err := m.registry.Get(g.TwinID)
+	if err != nil {
+		return Report{}, fmt.Errorf("%w: golden twin %s of type %s no longer exists", ErrGoldenNotFound, g.TwinID, g.Type)
+	}
+
+	return compare(g, golden, dt), nil
+}
+
+// compare reports the deviations of a twin from the golden twin
+func compare(g Golden, golden, dt *twin.DigitalTwin) Report {
+	report := Report{
+		TwinID:       dt.ID,
+		Type:         dt.Type,
+		GoldenTwinID: golden.ID,
+		Deviations:   []Deviation{},
+		CheckedAt:    time.Now(),
+	}
+
+	paths := g.Paths
+	if len(paths) == 0 {
+		paths = configurationPaths(golden)
+	}
+
+	for _, path := range paths {
+		expected, hasExpected := query.Lookup(golden, path)
+		actual, hasActual := query.Lookup(dt, path)
+
+		switch {
+		case !hasExpected && !hasActual:
+			continue
+		case !hasActual:
+			report.Deviations = append(report.Deviations, Deviation{Path: path, Expected: expected, Missing: true})
+		case !hasExpected || !equal(expected, actual, g.Tolerance):
+			report.Deviations = append(report.Deviations, Deviation{Path: path, Expected: expected, Actual: actual})
+		}
+	}
+
+	report.Drifted = len(report.Deviations) > 0
+	return report
+}
+
+// configurationPaths returns the paths of all attributes and desired properties of a twin, sorted
+func configurationPaths(dt *twin.DigitalTwin) []string {
+	var paths []string
+	for key := range dt.GetAllAttributes() {
+		paths = append(paths, "attributes."+key)
+	}
+	for featureID, feature := range dt.GetAllFeatures() {
+		for key := range feature.GetAllDesiredProperties() {
+			paths = append(paths, "features."+featureID+".desiredProperties."+key)
+		}
+	}
+
+	sort.Strings(paths)
+	return paths
+}
+
+// equal compares configuration values. Numbers are compared numerically and
+// may differ by tolerance; other values must be deeply equal.
+func equal(expected, actual interface{}, tolerance float64) bool {
+	if ef, ok := toFloat(expected); ok {
+		if af, ok := toFloat(actual); ok {
+			return math.Abs(ef-af) <= tolerance
+		}
+	}
+	return reflect.DeepEqual(expected, actual)
+}
+
+// toFloat converts numeric values to float64
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	default:
+		return 0, false
+	}
+}
+
+// HandleEvent re-checks twins with drift alerts after they or their golden twin change
+func (m *Manager) HandleEvent(msg messaging_sim.Message) {
+	twinID := msg.TwinID()
+	if twinID == "" || strings.HasPrefix(msg.Topic, "drift.") {
+		return
+	}
+
+	if msg.Topic == "twin.deleted" {
+		m.mutex.Lock()
+		delete(m.drifted, twinID)
+		m.mutex.Unlock()
+		return
+	}
+
+	dt, err := m.registry.Get(twinID)
+	if err != nil {
+		return
+	}
+
+	g, err := m.Get(dt.Type)
+	if err != nil || !g.Alert {
+		return
+	}
+
+	if g.TwinID == twinID {
+		m.checkType(dt.Type)
+		return
+	}
+	m.alert(twinID)
+}
+
+// Run checks twins for events from a subscription until the channel is closed
+func (m *Manager) Run(events <-chan messaging_sim.Message) {
+	for msg := range events {
+		m.HandleEvent(msg)
+	}
+}
+
+// checkType re-checks all twins of a type
+func (m *Manager) checkType(twinType string) {
+	for _, dt := range m.registry.List() {
+		if dt.Type == twinType {
+			m.alert(dt.ID)
+		}
+	}
+}
+
+// alert checks a twin and publishes an event when its drift state changes
+func (m *Manager) alert(twinID string) {
+	report, err := m.Check(twinID)
+	if err != nil || report.TwinID == report.GoldenTwinID {
+		return
+	}
+
+	m.mutex.Lock()
+	previous := m.drifted[twinID]
+	m.drifted[twinID] = report.Drifted
+	m.mutex.Unlock()
+
+	switch {
+	case report.Drifted && !previous:
+		m.pubsub.Publish(DriftDetectedTopic, map[string]interface{}{
+			"twinId":       report.TwinID,
+			"type":         report.Type,
+			"goldenTwinId": report.GoldenTwinID,
+			"deviations":   report.Deviations,
+		})
+	case !report.Drifted && previous:
+		m.pubsub.Publish(DriftResolvedTopic, map[string]interface{}{
+			"twinId":       report.TwinID,
+			"type":         report.Type,
+			"goldenTwinId": report.GoldenTwinID,
+		})
+	}
+}
@@ -0,0 +1,237 @@
+package golden
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func newPump(id string, setpoint float64, firmware string) *twin.DigitalTwin {
+	dt := twin.NewDigitalTwin(id, "pump")
+	dt.SetAttribute("firmware", firmware)
+	control := twin.NewFeatureState()
+	control.SetDesiredProperty("setpoint", setpoint)
+	control.SetProperty("pressure", 2.5)
+	dt.AddFeature("control", control)
+	return dt
+}
+
+func setupManager(t *testing.T) (*Manager, *registry.Registry, *messaging_sim.PubSub) {
+	t.Helper()
+
+	reg := registry.NewRegistry()
+	reg.Create(newPump("pump-ref", 10, "1.2.0"))
+	reg.Create(newPump("pump-1", 10, "1.2.0"))
+	reg.Create(newPump("pump-2", 12, "1.1.0"))
+	reg.Create(twin.NewDigitalTwin("valve-1", "valve"))
+
+	pubsub := messaging_sim.NewPubSub()
+	return NewManager(reg, pubsub), reg, pubsub
+}
+
+func TestSetValidation(t *testing.T) {
+	m, _, _ := setupManager(t)
+
+	invalid := []Golden{
+		{},
+		{Type: "pump"},
+		{Type: "valve", TwinID: "pump-ref"},
+		{Type: "pump", TwinID: "pump-ref", Tolerance: -1},
+		{Type: "pump", TwinID: "pump-ref", Paths: []string{"features.control"}},
+	}
+	for _, g := range invalid {
+		if err := m.Set(g); !errors.Is(err, ErrInvalidGolden) {
+			t.Errorf("Expected ErrInvalidGolden for %+v, got %v", g, err)
+		}
+	}
+
+	if err := m.Set(Golden{Type: "pump", TwinID: "missing"}); err != registry.ErrTwinNotFound {
+		t.Errorf("Expected ErrTwinNotFound, got %v", err)
+	}
+}
+
+func TestSetGetListDelete(t *testing.T) {
+	m, _, _ := setupManager(t)
+
+	if _, err := m.Get("pump"); err != ErrGoldenNotFound {
+		t.Errorf("Expected ErrGoldenNotFound, got %v", err)
+	}
+
+	if err := m.Set(Golden{Type: "valve", TwinID: "valve-1"}); err != nil {
+		t.Fatalf("Failed to set golden twin: %v", err)
+	}
+	if err := m.Set(Golden{Type: "pump", TwinID: "pump-ref"}); err != nil {
+		t.Fatalf("Failed to set golden twin: %v", err)
+	}
+
+	g, err := m.Get("pump")
+	if err != nil || g.TwinID != "pump-ref" {
+		t.Errorf("Expected golden twin pump-ref, got %+v (%v)", g, err)
+	}
+
+	list := m.List()
+	if len(list) != 2 || list[0].Type != "pump" || list[1].Type != "valve" {
+		t.Errorf("Expected golden twins sorted by type, got %+v", list)
+	}
+
+	if err := m.Delete("pump"); err != nil {
+		t.Errorf("Failed to delete golden twin: %v", err)
+	}
+	if err := m.Delete("pump"); err != ErrGoldenNotFound {
+		t.Errorf("Expected ErrGoldenNotFound, got %v", err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	m, reg, _ := setupManager(t)
+	m.Set(Golden{Type: "pump", TwinID: "pump-ref"})
+
+	report, err := m.Check("pump-1")
+	if err != nil {
+		t.Fatalf("Failed to check twin: %v", err)
+	}
+	if report.Drifted || len(report.Deviations) != 0 {
+		t.Errorf("Expected no drift, got %+v", report)
+	}
+
+	report, err = m.Check("pump-2")
+	if err != nil {
+		t.Fatalf("Failed to check twin: %v", err)
+	}
+	if !report.Drifted || report.GoldenTwinID != "pump-ref" {
+		t.Errorf("Expected drift from pump-ref, got %+v", report)
+	}
+	// Reported properties are not configuration and are not compared
+	if len(report.Deviations) != 2 {
+		t.Fatalf("Expected 2 deviations, got %+v", report.Deviations)
+	}
+	if d := report.Deviations[0]; d.Path != "attributes.firmware" || d.Expected != "1.2.0" || d.Actual != "1.1.0" {
+		t.Errorf("Unexpected deviation %+v", d)
+	}
+	if d := report.Deviations[1]; d.Path != "features.control.desiredProperties.setpoint" || d.Expected != 10.0 || d.Actual != 12.0 {
+		t.Errorf("Unexpected deviation %+v", d)
+	}
+
+	// Missing values are reported
+	dt, _ := reg.Get("pump-1")
+	dt.RemoveAttribute("firmware")
+	report, _ = m.Check("pump-1")
+	if len(report.Deviations) != 1 || !report.Deviations[0].Missing {
+		t.Errorf("Expected a missing deviation, got %+v", report.Deviations)
+	}
+
+	if _, err := m.Check("valve-1"); err != ErrGoldenNotFound {
+		t.Errorf("Expected ErrGoldenNotFound, got %v", err)
+	}
+	if _, err := m.Check("missing"); err != registry.ErrTwinNotFound {
+		t.Errorf("Expected ErrTwinNotFound, got %v", err)
+	}
+
+	reg.Delete("pump-ref")
+	if _, err := m.Check("pump-2"); !errors.Is(err, ErrGoldenNotFound) {
+		t.Errorf("Expected ErrGoldenNotFound after deleting the golden twin, got %v", err)
+	}
+}
+
+func TestCheckPathsAndTolerance(t *testing.T) {
+	m, _, _ := setupManager(t)
+	m.Set(Golden{Type: "pump", TwinID: "pump-ref", Paths: []string{"features.control.desiredProperties.setpoint"}, Tolerance: 2})
+
+	report, _ := m.Check("pump-2")
+	if report.Drifted {
+		t.Errorf("Expected setpoint within tolerance and firmware ignored, got %+v", report.Deviations)
+	}
+
+	m.Set(Golden{Type: "pump", TwinID: "pump-ref", Paths: []string{"features.control.desiredProperties.setpoint"}, Tolerance: 1})
+	report, _ = m.Check("pump-2")
+	if !report.Drifted {
+		t.Error("Expected setpoint outside tolerance to drift")
+	}
+}
+
+func TestEqual(t *testing.T) {
+	tests := []struct {
+		expected, actual interface{}
+		tolerance        float64
+		want             bool
+	}{
+		{10.0, 10, 0, true},
+		{10.0, 10.5, 0, false},
+		{10.0, 10.5, 0.5, true},
+		{"1", 1.0, 0, false},
+		{"on", "on", 1, true},
+		{map[string]interface{}{"a": 1.0}, map[string]interface{}{"a": 1.0}, 0, true},
+		{[]interface{}{1.0, 2.0}, []interface{}{2.0, 1.0}, 0, false},
+	}
+	for _, tt := range tests {
+		if got := equal(tt.expected, tt.actual, tt.tolerance); got != tt.want {
+			t.Errorf("equal(%v, %v, %v) = %v, want %v", tt.expected, tt.actual, tt.tolerance, got, tt.want)
+		}
+	}
+}
+
+func receive(t *testing.T, ch chan messaging_sim.Message) messaging_sim.Message {
+	t.Helper()
+	select {
+	case msg := <-ch:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for drift event")
+		return messaging_sim.Message{}
+	}
+}
+
+func TestDriftAlerts(t *testing.T) {
+	m, reg, pubsub := setupManager(t)
+	events := pubsub.Subscribe("drift.#")
+
+	// Setting a golden twin with alerts checks all twins of the type
+	m.Set(Golden{Type: "pump", TwinID: "pump-ref", Alert: true})
+	msg := receive(t, events)
+	payload := msg.Payload.(map[string]interface{})
+	if msg.Topic != DriftDetectedTopic || payload["twinId"] != "pump-2" {
+		t.Errorf("Expected drift.detected for pump-2, got %s %v", msg.Topic, payload)
+	}
+
+	// Repeated checks do not raise the alert again
+	m.HandleEvent(messaging_sim.Message{Topic: "twin.updated", Payload: map[string]string{"id": "pump-2"}})
+
+	// Fixing the configuration resolves the drift
+	dt, _ := reg.Get("pump-2")
+	dt.SetAttribute("firmware", "1.2.0")
+	control, _ := dt.GetFeature("control")
+	control.SetDesiredProperty("setpoint", 10.0)
+	m.HandleEvent(messaging_sim.Message{Topic: "feature.updated", Payload: map[string]string{"twinId": "pump-2", "featureId": "control"}})
+
+	msg = receive(t, events)
+	if msg.Topic != DriftResolvedTopic {
+		t.Errorf("Expected drift.resolved, got %s", msg.Topic)
+	}
+
+	// Changing the golden twin re-checks every twin of its type
+	ref, _ := reg.Get("pump-ref")
+	ref.SetAttribute("firmware", "1.3.0")
+	m.HandleEvent(messaging_sim.Message{Topic: "twin.updated", Payload: map[string]string{"id": "pump-ref"}})
+
+	drifted := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		msg := receive(t, events)
+		if msg.Topic != DriftDetectedTopic {
+			t.Errorf("Expected drift.detected, got %s", msg.Topic)
+		}
+		drifted[msg.Payload.(map[string]interface{})["twinId"].(string)] = true
+	}
+	if !drifted["pump-1"] || !drifted["pump-2"] {
+		t.Errorf("Expected pump-1 and pump-2 to drift, got %v", drifted)
+	}
+
+	select {
+	case msg := <-events:
+		t.Errorf("Unexpected event %s %v", msg.Topic, msg.Payload)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
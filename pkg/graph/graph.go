@@ -0,0 +1,291 @@
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aleka07/go-digital-twin/pkg/query"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// Common errors
+var (
+	ErrInvalidQuery = errors.New("invalid graph query")
+)
+
+// Limits of a graph query
+const (
+	MaxDepth     = 10   // Longest path a single pattern may follow
+	DefaultLimit = 1000 // Maximum number of results unless a query sets its own
+)
+
+// Pattern matches paths from one variable to another along a relationship.
+// The path must be at least MinDepth and at most MaxDepth relationships long;
+// both default to 1. The depth of a twin is its shortest distance from the
+// start, so every twin is visited once per start and cycles terminate.
+type Pattern struct {
+	From     string `json:"from"`               // Variable of the start twin
+	Rel      string `json:"rel,omitempty"`      // Relationship name, any relationship when empty
+	To       string `json:"to"`                 // Variable of the end twin
+	MinDepth int    `json:"minDepth,omitempty"` // Minimum path length
+	MaxDepth int    `json:"maxDepth,omitempty"` // Maximum path length
+}
+
+// Query finds bindings of variables to twins such that every pattern holds
+// and every bound twin satisfies the condition of its variable. Conditions
+// use the syntax of the query package, e.g. "type == sensor".
+//
+// "All sensors contained in building B connected to HVAC H" is:
+//
+//	match: [{from: b, rel: contains, to: s, maxDepth: 5}, {from: s, rel: connectedTo, to: h}]
+//	where: {b: "id == B", s: "type == sensor", h: "id == H"}
+//	return: [s]
+type Query struct {
+	Match  []Pattern         `json:"match"`
+	Where  map[string]string `json:"where,omitempty"`
+	Return []string          `json:"return,omitempty"` // Returned variables, all when empty
+	Limit  int               `json:"limit,omitempty"`
+}
+
+// Result holds the distinct bindings of the returned variables, sorted
+type Result struct {
+	Variables []string            `json:"variables"`
+	Bindings  []map[string]string `json:"bindings"`
+	Truncated bool                `json:"truncated,omitempty"` // The limit was reached
+}
+
+// compiled is a validated query with parsed conditions over a registry snapshot
+type compiled struct {
+	Query
+	conditions map[string]*query.Query
+	twins      map[string]*twin.DigitalTwin
+	ids        []string                       // Sorted twin IDs
+	out        map[string]map[string][]string // Twin ID -> relationship -> targets
+	in         map[string]map[string][]string // Twin ID -> relationship -> sources
+}
+
+// Evaluate runs a graph query over the relationships of the twins in a registry.
+// Relationships to twins that do not exist are ignored.
+func Evaluate(reg *registry.Registry, q Query) (*Result, error) {
+	c, err := compile(q)
+	if err != nil {
+		return nil, err
+	}
+	c.load(reg.List())
+
+	result := &Result{Variables: c.Return, Bindings: make([]map[string]string, 0)}
+	seen := make(map[string]bool)
+
+	c.solve(0, make(map[string]string), func(binding map[string]string) bool {
+		projected := make(map[string]string, len(c.Return))
+		keys := make([]string, len(c.Return))
+		for i, v := range c.Return {
+			projected[v] = binding[v]
+			keys[i] = binding[v]
+		}
+
+		key := strings.Join(keys, "\x00")
+		if seen[key] {
+			return true
+		}
+		seen[key] = true
+
+		if len(result.Bindings) == c.Limit {
+			result.Truncated = true
+			return false
+		}
+		result.Bindings = append(result.Bindings, projected)
+		return true
+	})
+
+	sort.Slice(result.Bindings, func(i, j int) bool {
+		for _, v := range result.Variables {
+			if a, b := result.Bindings[i][v], result.Bindings[j][v]; a != b {
+				return a < b
+			}
+		}
+		return false
+	})
+	return result, nil
+}
+
+// compile validates a query and applies its defaults
+func compile(q Query) (*compiled, error) {
+	if len(q.Match) == 0 {
+		return nil, fmt.Errorf("%w: at least one pattern is required", ErrInvalidQuery)
+	}
+
+	variables := make(map[string]bool)
+	var order []string
+	for i := range q.Match {
+		p := &q.Match[i]
+		if p.From == "" || p.To == "" {
+			return nil, fmt.Errorf("%w: pattern %d requires from and to variables", ErrInvalidQuery, i)
+		}
+
+		if p.MinDepth == 0 {
+			p.MinDepth = 1
+		}
+		if p.MaxDepth == 0 {
+			p.MaxDepth = p.MinDepth
+		}
+		if p.MinDepth < 0 || p.MaxDepth < p.MinDepth || p.MaxDepth > MaxDepth {
+			return nil, fmt.Errorf("%w: pattern %d depth must satisfy 1 <= minDepth <= maxDepth <= %d", ErrInvalidQuery, i, MaxDepth)
+		}
+
+		for _, v := range []string{p.From, p.To} {
+			if !variables[v] {
+				variables[v] = true
+				order = append(order, v)
+			}
+		}
+	}
+
+	c := &compiled{Query: q, conditions: make(map[string]*query.Query)}
+	for v, condition := range q.Where {
+		if !variables[v] {
+			return nil, fmt.Errorf("%w: condition on unknown variable %s", ErrInvalidQuery, v)
+		}
+		parsed, err := query.Parse(condition)
+		if err != nil {
+			return nil, fmt.Errorf("%w: variable %s: %v", ErrInvalidQuery, v, err)
+		}
+		c.conditions[v] = parsed
+	}
+
+	if len(c.Return) == 0 {
+		c.Return = order
+	}
+	for _, v := range c.Return {
+		if !variables[v] {
+			return nil, fmt.Errorf("%w: cannot return unknown variable %s", ErrInvalidQuery, v)
+		}
+	}
+
+	if c.Limit <= 0 {
+		c.Limit = DefaultLimit
+	}
+	return c, nil
+}
+
+// load indexes the twins and their relationships in both directions
+func (c *compiled) load(twins []*twin.DigitalTwin) {
+	c.twins = make(map[string]*twin.DigitalTwin, len(twins))
+	for _, dt := range twins {
+		c.twins[dt.ID] = dt
+		c.ids = append(c.ids, dt.ID)
+	}
+	sort.Strings(c.ids)
+
+	c.out = make(map[string]map[string][]string)
+	c.in = make(map[string]map[string][]string)
+	for _, id := range c.ids {
+		for rel, targets := range c.twins[id].GetAllRelationships() {
+			for _, target := range targets {
+				if _, exists := c.twins[target]; !exists {
+					continue
+				}
+				addEdge(c.out, id, rel, target)
+				addEdge(c.in, target, rel, id)
+			}
+		}
+	}
+}
+
+// solve binds the variables of the patterns from index i on, calling emit
+// for every complete binding until emit returns false
+func (c *compiled) solve(i int, binding map[string]string, emit func(map[string]string) bool) bool {
+	if i == len(c.Match) {
+		return emit(binding)
+	}
+
+	p := c.Match[i]
+	from, fromBound := binding[p.From]
+	to, toBound := binding[p.To]
+	next := func() bool { return c.solve(i+1, binding, emit) }
+
+	switch {
+	case fromBound:
+		for _, id := range reachable(c.out, from, p) {
+			if toBound {
+				if id == to && !next() {
+					return false
+				}
+				continue
+			}
+			if !c.bind(binding, p.To, id, next) {
+				return false
+			}
+		}
+	case toBound:
+		for _, id := range reachable(c.in, to, p) {
+			if !c.bind(binding, p.From, id, next) {
+				return false
+			}
+		}
+	default:
+		// Try every twin as the start and solve the pattern again
+		for _, id := range c.ids {
+			if !c.bind(binding, p.From, id, func() bool { return c.solve(i, binding, emit) }) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// bind binds a variable to a twin for the duration of next if the twin
+// satisfies the condition of the variable
+func (c *compiled) bind(binding map[string]string, v, id string, next func() bool) bool {
+	if condition, ok := c.conditions[v]; ok && !condition.Matches(c.twins[id]) {
+		return true
+	}
+
+	binding[v] = id
+	ok := next()
+	delete(binding, v)
+	return ok
+}
+
+// reachable returns the twins whose shortest distance from start along the
+// edges of a pattern lies within its depth bounds, in order of distance and ID
+func reachable(edges map[string]map[string][]string, start string, p Pattern) []string {
+	visited := map[string]bool{start: true}
+	frontier := []string{start}
+	var result []string
+
+	for depth := 1; depth <= p.MaxDepth && len(frontier) > 0; depth++ {
+		var next []string
+		for _, id := range frontier {
+			for rel, targets := range edges[id] {
+				if p.Rel != "" && rel != p.Rel {
+					continue
+				}
+				for _, target := range targets {
+					if !visited[target] {
+						visited[target] = true
+						next = append(next, target)
+					}
+				}
+			}
+		}
+		sort.Strings(next)
+
+		if depth >= p.MinDepth {
+			result = append(result, next...)
+		}
+		frontier = next
+	}
+	return result
+}
+
+// addEdge adds an edge to an adjacency index
+func addEdge(edges map[string]map[string][]string, from, rel, to string) {
+	if edges[from] == nil {
+		edges[from] = make(map[string][]string)
+	}
+	edges[from][rel] = append(edges[from][rel], to)
+}
@@ -0,0 +1,119 @@
+package graph
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// buildingGraph creates building B with two floors, sensors on each floor
+// and two HVAC units. Floor 2 contains floor 1, which contains floor 2 again
+// to form a cycle.
+func buildingGraph() *registry.Registry {
+	reg := registry.NewRegistry()
+
+	add := func(id, twinType string, rels map[string][]string) {
+		dt := twin.NewDigitalTwin(id, twinType)
+		for name, targets := range rels {
+			dt.SetRelationship(name, targets)
+		}
+		reg.Create(dt)
+	}
+
+	add("B", "building", map[string][]string{"contains": {"floor-1"}})
+	add("floor-1", "floor", map[string][]string{"contains": {"floor-2", "s-1", "s-2"}})
+	add("floor-2", "floor", map[string][]string{"contains": {"floor-1", "s-3", "missing"}})
+	add("s-1", "sensor", map[string][]string{"connectedTo": {"H"}})
+	add("s-2", "sensor", map[string][]string{"connectedTo": {"H2"}})
+	add("s-3", "sensor", map[string][]string{"connectedTo": {"H"}})
+	add("H", "hvac", nil)
+	add("H2", "hvac", nil)
+	return reg
+}
+
+func TestEvaluate(t *testing.T) {
+	reg := buildingGraph()
+
+	result, err := Evaluate(reg, Query{
+		Match: []Pattern{
+			{From: "b", Rel: "contains", To: "s", MaxDepth: 5},
+			{From: "s", Rel: "connectedTo", To: "h"},
+		},
+		Where: map[string]string{
+			"b": "id == B",
+			"s": "type == sensor",
+			"h": "id == H",
+		},
+		Return: []string{"s"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to evaluate query: %v", err)
+	}
+
+	if len(result.Bindings) != 2 || result.Bindings[0]["s"] != "s-1" || result.Bindings[1]["s"] != "s-3" {
+		t.Errorf("Expected sensors s-1 and s-3, got %v", result.Bindings)
+	}
+
+	// Depth limits exclude the sensor on floor 2
+	result, _ = Evaluate(reg, Query{
+		Match: []Pattern{{From: "b", Rel: "contains", To: "s", MaxDepth: 2}},
+		Where: map[string]string{"b": "id == B", "s": "type == sensor"},
+	})
+	if len(result.Bindings) != 2 {
+		t.Errorf("Expected 2 sensors within depth 2, got %v", result.Bindings)
+	}
+
+	// Patterns can start from a bound end and follow relationships backwards
+	result, _ = Evaluate(reg, Query{
+		Match: []Pattern{
+			{From: "s", Rel: "connectedTo", To: "h"},
+			{From: "f", Rel: "contains", To: "s"},
+		},
+		Where:  map[string]string{"h": "id == H2"},
+		Return: []string{"f"},
+	})
+	if len(result.Bindings) != 1 || result.Bindings[0]["f"] != "floor-1" {
+		t.Errorf("Expected floor-1, got %v", result.Bindings)
+	}
+}
+
+func TestEvaluateCyclesAndLimits(t *testing.T) {
+	reg := buildingGraph()
+
+	// The floor cycle is followed once per start
+	result, err := Evaluate(reg, Query{
+		Match: []Pattern{{From: "a", Rel: "contains", To: "b", MinDepth: 1, MaxDepth: MaxDepth}},
+		Where: map[string]string{"a": "id == floor-1"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to evaluate query: %v", err)
+	}
+	if len(result.Bindings) != 4 {
+		t.Errorf("Expected 4 twins reachable from floor-1, got %v", result.Bindings)
+	}
+
+	result, _ = Evaluate(reg, Query{
+		Match: []Pattern{{From: "a", To: "b"}},
+		Limit: 3,
+	})
+	if len(result.Bindings) != 3 || !result.Truncated {
+		t.Errorf("Expected 3 truncated bindings, got %d (truncated %v)", len(result.Bindings), result.Truncated)
+	}
+
+	invalid := []Query{
+		{},
+		{Match: []Pattern{{From: "a"}}},
+		{Match: []Pattern{{From: "a", To: "b", MaxDepth: MaxDepth + 1}}},
+		{Match: []Pattern{{From: "a", To: "b", MinDepth: 3, MaxDepth: 2}}},
+		{Match: []Pattern{{From: "a", To: "b"}}, Where: map[string]string{"c": "id == x"}},
+		{Match: []Pattern{{From: "a", To: "b"}}, Where: map[string]string{"a": "id"}},
+		{Match: []Pattern{{From: "a", To: "b"}}, Return: []string{"c"}},
+	}
+	for _, q := range invalid {
+		if _, err := Evaluate(reg, q); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("Expected ErrInvalidQuery for %+v, got %v", q, err)
+		}
+	}
+}
@@ -0,0 +1,403 @@
+package group
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aleka07/go-digital-twin/pkg/eventbus"
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/query"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// Common errors
+var (
+	ErrGroupNotFound      = errors.New("group not found")
+	ErrGroupAlreadyExists = errors.New("group already exists")
+	ErrInvalidDefinition  = errors.New("invalid group definition")
+	ErrNotStatic          = errors.New("members can only be added to or removed from static groups")
+)
+
+// Event topics published when the membership of a group changes
+const (
+	TopicMemberAdded   = "group.member.added"
+	TopicMemberRemoved = "group.member.removed"
+)
+
+// Definition describes a named group of twins. Static groups list their
+// twins; dynamic groups contain the twins matching a query.
+type Definition struct {
+	Name  string   `json:"name"`
+	Twins []string `json:"twins,omitempty"` // Members of a static group
+	Query string   `json:"query,omitempty"` // Query selecting the members of a dynamic group
+}
+
+// Dynamic reports whether the group's members are selected by a query
+func (d Definition) Dynamic() bool {
+	return d.Query != ""
+}
+
+// group holds a definition and its current members
+type group struct {
+	def     Definition
+	query   *query.Query // Nil for static groups
+	members map[string]bool
+}
+
+// Manager maintains the membership of groups of twins and publishes
+// membership changes
+type Manager struct {
+	registry *registry.Registry
+	pubsub   eventbus.Publisher
+	groups   map[string]*group
+	mutex    sync.RWMutex
+}
+
+// NewManager creates a new group manager
+func NewManager(reg *registry.Registry, pubsub eventbus.Publisher) *Manager {
+	return &Manager{
+		registry: reg,
+		pubsub:   pubsub,
+		groups:   make(map[string]*group),
+	}
+}
+
+// Create defines a new group. A group is either static or dynamic, so
+// exactly one of Twins and Query must be given; a static group may start
+// empty.
+func (m *Manager) Create(def Definition) error {
+	g, err := newGroup(def)
+	if err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, exists := m.groups[def.Name]; exists {
+		return ErrGroupAlreadyExists
+	}
+
+	m.groups[def.Name] = g
+	m.refresh(g)
+	return nil
+}
+
+// newGroup validates a definition
+func newGroup(def Definition) (*group, error) {
+	if def.Name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidDefinition)
+	}
+	if def.Query != "" && len(def.Twins) > 0 {
+		return nil, fmt.Errorf("%w: a group has either twins or a query", ErrInvalidDefinition)
+	}
+
+	g := &group{members: make(map[string]bool)}
+	if def.Dynamic() {
+		q, err := query.Parse(def.Query)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidDefinition, err)
+		}
+		g.query = q
+	}
+
+	twins := make([]string, 0, len(def.Twins))
+	seen := make(map[string]bool)
+	for _, id := range def.Twins {
+		if id == "" {
+			return nil, fmt.Errorf("%w: empty twin ID", ErrInvalidDefinition)
+		}
+		if !seen[id] {
+			seen[id] = true
+			twins = append(twins, id)
+		}
+	}
+	sort.Strings(twins)
+	def.Twins = twins
+	g.def = def
+	return g, nil
+}
+
+// Update replaces the definition of a group, publishing the resulting
+// membership changes
+func (m *Manager) Update(def Definition) error {
+	updated, err := newGroup(def)
+	if err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	g, exists := m.groups[def.Name]
+	if !exists {
+		return ErrGroupNotFound
+	}
+
+	g.def = updated.def
+	g.query = updated.query
+	m.refresh(g)
+	return nil
+}
+
+// Delete removes a group
+func (m *Manager) Delete(name string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, exists := m.groups[name]; !exists {
+		return ErrGroupNotFound
+	}
+
+	delete(m.groups, name)
+	return nil
+}
+
+// Get returns the definition of a group
+func (m *Manager) Get(name string) (Definition, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	g, exists := m.groups[name]
+	if !exists {
+		return Definition{}, ErrGroupNotFound
+	}
+	return g.definition(), nil
+}
+
+// Definitions returns the definitions of all groups ordered by name
+func (m *Manager) Definitions() []Definition {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	defs := make([]Definition, 0, len(m.groups))
+	for _, g := range m.groups {
+		defs = append(defs, g.definition())
+	}
+
+	sort.Slice(defs, func(i, j int) bool { return defs[i].Name < defs[j].Name })
+	return defs
+}
+
+// definition returns a copy of the group's definition
+func (g *group) definition() Definition {
+	def := g.def
+	def.Twins = append([]string(nil), g.def.Twins...)
+	return def
+}
+
+// MemberIDs returns the IDs of the twins in a group, in order. Static
+// groups only report listed twins that exist.
+func (m *Manager) MemberIDs(name string) ([]string, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	g, exists := m.groups[name]
+	if !exists {
+		return nil, ErrGroupNotFound
+	}
+
+	ids := make([]string, 0, len(g.members))
+	for id := range g.members {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// Members returns the twins in a group ordered by ID
+func (m *Manager) Members(name string) ([]*twin.DigitalTwin, error) {
+	ids, err := m.MemberIDs(name)
+	if err != nil {
+		return nil, err
+	}
+
+	twins := make([]*twin.DigitalTwin, 0, len(ids))
+	for _, id := range ids {
+		if dt, err := m.registry.Get(id); err == nil {
+			twins = append(twins, dt)
+		}
+	}
+	return twins, nil
+}
+
+// Contains reports whether a twin is a member of a group
+func (m *Manager) Contains(name, twinID string) (bool, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	g, exists := m.groups[name]
+	if !exists {
+		return false, ErrGroupNotFound
+	}
+	return g.members[twinID], nil
+}
+
+// GroupsOf returns the names of the groups a twin is a member of, in order
+func (m *Manager) GroupsOf(twinID string) []string {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	var names []string
+	for name, g := range m.groups {
+		if g.members[twinID] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AddTwin adds a twin to a static group
+func (m *Manager) AddTwin(name, twinID string) error {
+	return m.editTwins(name, func(g *group) {
+		i := sort.SearchStrings(g.def.Twins, twinID)
+		if i < len(g.def.Twins) && g.def.Twins[i] == twinID {
+			return
+		}
+		g.def.Twins = append(g.def.Twins, "")
+		copy(g.def.Twins[i+1:], g.def.Twins[i:])
+		g.def.Twins[i] = twinID
+	})
+}
+
+// RemoveTwin removes a twin from a static group
+func (m *Manager) RemoveTwin(name, twinID string) error {
+	return m.editTwins(name, func(g *group) {
+		i := sort.SearchStrings(g.def.Twins, twinID)
+		if i < len(g.def.Twins) && g.def.Twins[i] == twinID {
+			g.def.Twins = append(g.def.Twins[:i], g.def.Twins[i+1:]...)
+		}
+	})
+}
+
+// RenameTwin replaces the old ID of a renamed twin with its new ID in the
+// twin lists of static groups and moves its membership to the new ID,
+// publishing the removal of the old ID and the addition of the new one. The
+// new ID may be listed already, as when twins are merged.
+func (m *Manager) RenameTwin(oldID, newID string) {
+	dt, err := m.registry.Get(newID)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, g := range m.groups {
+		i := sort.SearchStrings(g.def.Twins, oldID)
+		if !g.def.Dynamic() && i < len(g.def.Twins) && g.def.Twins[i] == oldID {
+			g.def.Twins = append(g.def.Twins[:i], g.def.Twins[i+1:]...)
+			j := sort.SearchStrings(g.def.Twins, newID)
+			if j == len(g.def.Twins) || g.def.Twins[j] != newID {
+				g.def.Twins = append(g.def.Twins, "")
+				copy(g.def.Twins[j+1:], g.def.Twins[j:])
+				g.def.Twins[j] = newID
+			}
+		}
+		m.setMember(g, oldID, false)
+		m.setMember(g, newID, err == nil && g.matches(dt))
+	}
+}
+
+// editTwins changes the twin list of a static group
+func (m *Manager) editTwins(name string, edit func(g *group)) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	g, exists := m.groups[name]
+	if !exists {
+		return ErrGroupNotFound
+	}
+	if g.def.Dynamic() {
+		return ErrNotStatic
+	}
+
+	edit(g)
+	m.refresh(g)
+	return nil
+}
+
+// HandleEvent updates the membership of all groups for a changed twin
+func (m *Manager) HandleEvent(msg messaging_sim.Message) {
+	if strings.HasPrefix(msg.Topic, "group.") {
+		return
+	}
+
+	twinID := msg.TwinID()
+	if twinID == "" {
+		return
+	}
+
+	dt, err := m.registry.Get(twinID)
+	if err != nil && err != registry.ErrTwinNotFound {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, g := range m.groups {
+		m.setMember(g, twinID, dt != nil && g.matches(dt))
+	}
+}
+
+// Run applies change events from a subscription until the channel is closed
+func (m *Manager) Run(events <-chan messaging_sim.Message) {
+	for msg := range events {
+		m.HandleEvent(msg)
+	}
+}
+
+// matches reports whether an existing twin belongs to the group
+func (g *group) matches(dt *twin.DigitalTwin) bool {
+	if g.query != nil {
+		return g.query.Matches(dt)
+	}
+	i := sort.SearchStrings(g.def.Twins, dt.ID)
+	return i < len(g.def.Twins) && g.def.Twins[i] == dt.ID
+}
+
+// refresh recomputes the members of a group. The caller must hold the
+// write lock.
+func (m *Manager) refresh(g *group) {
+	members := make(map[string]bool)
+	for _, dt := range m.registry.List() {
+		if g.matches(dt) {
+			members[dt.ID] = true
+		}
+	}
+
+	for id := range g.members {
+		if !members[id] {
+			m.setMember(g, id, false)
+		}
+	}
+	for id := range members {
+		m.setMember(g, id, true)
+	}
+}
+
+// setMember records whether a twin is a member of a group, publishing an
+// event when that changes. The caller must hold the write lock.
+func (m *Manager) setMember(g *group, twinID string, member bool) {
+	if g.members[twinID] == member {
+		return
+	}
+
+	topic := TopicMemberAdded
+	if member {
+		g.members[twinID] = true
+	} else {
+		delete(g.members, twinID)
+		topic = TopicMemberRemoved
+	}
+
+	if m.pubsub != nil {
+		m.pubsub.Publish(topic, map[string]string{
+			"group":  g.def.Name,
+			"twinId": twinID,
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package group
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func setupManager(t *testing.T) (*Manager, *registry.Registry, chan messaging_sim.Message) {
+	t.Helper()
+	reg := registry.NewRegistry()
+	for _, id := range []string{"pump-1", "pump-2", "valve-1"} {
+		dt := twin.NewDigitalTwin(id, id[:len(id)-2])
+		dt.SetAttribute("site", "north")
+		reg.Create(dt)
+	}
+
+	pubsub := messaging_sim.NewPubSub()
+	events := pubsub.Subscribe("group.#")
+	return NewManager(reg, pubsub), reg, events
+}
+
+func receive(t *testing.T, events chan messaging_sim.Message) messaging_sim.Message {
+	t.Helper()
+	select {
+	case msg := <-events:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for a membership event")
+		return messaging_sim.Message{}
+	}
+}
+
+func TestCreateValidation(t *testing.T) {
+	m, _, _ := setupManager(t)
+
+	invalid := []Definition{
+		{},
+		{Name: "both", Twins: []string{"pump-1"}, Query: "type == pump"},
+		{Name: "bad-query", Query: "type ~ pump"},
+		{Name: "empty-id", Twins: []string{""}},
+	}
+	for _, def := range invalid {
+		if err := m.Create(def); !errors.Is(err, ErrInvalidDefinition) {
+			t.Errorf("Expected ErrInvalidDefinition for %+v, got %v", def, err)
+		}
+	}
+
+	if err := m.Create(Definition{Name: "empty"}); err != nil {
+		t.Errorf("Expected an empty static group to be valid, got %v", err)
+	}
+	if err := m.Create(Definition{Name: "empty"}); err != ErrGroupAlreadyExists {
+		t.Errorf("Expected ErrGroupAlreadyExists, got %v", err)
+	}
+}
+
+func TestStaticGroup(t *testing.T) {
+	m, _, events := setupManager(t)
+
+	if err := m.Create(Definition{Name: "line-a", Twins: []string{"valve-1", "pump-1", "missing", "pump-1"}}); err != nil {
+		t.Fatalf("Failed to create group: %v", err)
+	}
+
+	def, _ := m.Get("line-a")
+	if !reflect.DeepEqual(def.Twins, []string{"missing", "pump-1", "valve-1"}) {
+		t.Errorf("Expected sorted, unique twins, got %v", def.Twins)
+	}
+	if ids, _ := m.MemberIDs("line-a"); !reflect.DeepEqual(ids, []string{"pump-1", "valve-1"}) {
+		t.Errorf("Expected existing twins as members, got %v", ids)
+	}
+	receive(t, events)
+	receive(t, events)
+
+	if err := m.AddTwin("line-a", "pump-2"); err != nil {
+		t.Fatalf("Failed to add twin: %v", err)
+	}
+	msg := receive(t, events)
+	if payload := msg.Payload.(map[string]string); msg.Topic != TopicMemberAdded || payload["twinId"] != "pump-2" || payload["group"] != "line-a" {
+		t.Errorf("Unexpected event %s %v", msg.Topic, msg.Payload)
+	}
+
+	m.RemoveTwin("line-a", "valve-1")
+	if msg := receive(t, events); msg.Topic != TopicMemberRemoved {
+		t.Errorf("Expected %s, got %s", TopicMemberRemoved, msg.Topic)
+	}
+	if groups := m.GroupsOf("pump-2"); !reflect.DeepEqual(groups, []string{"line-a"}) {
+		t.Errorf("Expected pump-2 to be in line-a, got %v", groups)
+	}
+
+	// A listed twin becomes a member once it is created
+	m.registry.Create(twin.NewDigitalTwin("missing", "pump"))
+	m.HandleEvent(messaging_sim.Message{Topic: "twin.created", Payload: map[string]string{"id": "missing"}})
+	if ok, _ := m.Contains("line-a", "missing"); !ok {
+		t.Errorf("Expected the created twin to be a member")
+	}
+	receive(t, events)
+
+	// Renamed twins stay members under their new ID
+	m.registry.Rename("pump-1", "pump-0")
+	m.RenameTwin("pump-1", "pump-0")
+	def, _ = m.Get("line-a")
+	if !reflect.DeepEqual(def.Twins, []string{"missing", "pump-0", "pump-2"}) {
+		t.Errorf("Expected the new ID in the twin list, got %v", def.Twins)
+	}
+	if ids, _ := m.MemberIDs("line-a"); !reflect.DeepEqual(ids, []string{"missing", "pump-0", "pump-2"}) {
+		t.Errorf("Expected the renamed twin as member, got %v", ids)
+	}
+	if removed, added := receive(t, events), receive(t, events); removed.Topic != TopicMemberRemoved || added.Topic != TopicMemberAdded {
+		t.Errorf("Expected %s and %s, got %s and %s", TopicMemberRemoved, TopicMemberAdded, removed.Topic, added.Topic)
+	}
+
+	// Merged twins leave a single member
+	m.registry.Merge("pump-0", "pump-2", registry.TargetWins)
+	m.RenameTwin("pump-2", "pump-0")
+	if ids, _ := m.MemberIDs("line-a"); !reflect.DeepEqual(ids, []string{"missing", "pump-0"}) {
+		t.Errorf("Expected the merged twin once, got %v", ids)
+	}
+	def, _ = m.Get("line-a")
+	if !reflect.DeepEqual(def.Twins, []string{"missing", "pump-0"}) {
+		t.Errorf("Expected the ID of the merged twin once in the twin list, got %v", def.Twins)
+	}
+}
+
+func TestDynamicGroup(t *testing.T) {
+	m, reg, events := setupManager(t)
+
+	if err := m.Create(Definition{Name: "pumps", Query: "type == pump"}); err != nil {
+		t.Fatalf("Failed to create group: %v", err)
+	}
+	if ids, _ := m.MemberIDs("pumps"); !reflect.DeepEqual(ids, []string{"pump-1", "pump-2"}) {
+		t.Errorf("Expected the pumps as members, got %v", ids)
+	}
+	receive(t, events)
+	receive(t, events)
+
+	if err := m.AddTwin("pumps", "valve-1"); err != ErrNotStatic {
+		t.Errorf("Expected ErrNotStatic, got %v", err)
+	}
+
+	// Twins leave the group when they stop matching or are deleted
+	dt, _ := reg.Get("pump-1")
+	dt.Type = "valve"
+	reg.Update(dt)
+	m.HandleEvent(messaging_sim.Message{Topic: "twin.updated", Payload: map[string]string{"id": "pump-1"}})
+	if msg := receive(t, events); msg.Topic != TopicMemberRemoved || msg.Payload.(map[string]string)["twinId"] != "pump-1" {
+		t.Errorf("Expected pump-1 to be removed, got %s %v", msg.Topic, msg.Payload)
+	}
+
+	reg.Delete("pump-2")
+	m.HandleEvent(messaging_sim.Message{Topic: "twin.deleted", Payload: map[string]string{"id": "pump-2"}})
+	if ids, _ := m.MemberIDs("pumps"); len(ids) != 0 {
+		t.Errorf("Expected no members, got %v", ids)
+	}
+
+	// Changing the query recomputes the members
+	if err := m.Update(Definition{Name: "pumps", Query: "attributes.site == north"}); err != nil {
+		t.Fatalf("Failed to update group: %v", err)
+	}
+	if members, _ := m.Members("pumps"); len(members) != 2 {
+		t.Errorf("Expected 2 members, got %d", len(members))
+	}
+
+	if err := m.Delete("pumps"); err != nil {
+		t.Errorf("Failed to delete group: %v", err)
+	}
+	if _, err := m.MemberIDs("pumps"); err != ErrGroupNotFound {
+		t.Errorf("Expected ErrGroupNotFound, got %v", err)
+	}
+}
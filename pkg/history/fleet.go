@@ -0,0 +1,144 @@
+package history
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Fleet query errors
+var (
+	ErrInvalidAggregation = errors.New("invalid aggregation")
+	ErrInvalidRange       = errors.New("invalid time range")
+)
+
+// MaxBuckets is the maximum number of buckets of an aligned series
+const MaxBuckets = 10000
+
+// Aggregation combines the samples of a bucket into a single value
+type Aggregation string
+
+// Aggregations. Mean, sum, min and max ignore non-numeric values.
+const (
+	AggregateMean  Aggregation = "mean"
+	AggregateMin   Aggregation = "min"
+	AggregateMax   Aggregation = "max"
+	AggregateSum   Aggregation = "sum"
+	AggregateCount Aggregation = "count"
+	AggregateFirst Aggregation = "first"
+	AggregateLast  Aggregation = "last"
+)
+
+// ParseAggregation validates an aggregation name; empty selects AggregateMean
+func ParseAggregation(s string) (Aggregation, error) {
+	switch a := Aggregation(s); a {
+	case "":
+		return AggregateMean, nil
+	case AggregateMean, AggregateMin, AggregateMax, AggregateSum, AggregateCount, AggregateFirst, AggregateLast:
+		return a, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrInvalidAggregation, s)
+}
+
+// Series is the aggregated history of a property of one twin. Values are
+// aligned with the bucket timestamps of the query; empty buckets are nil.
+type Series struct {
+	TwinID string        `json:"twinId"`
+	Values []interface{} `json:"values"`
+}
+
+// Aligned aggregates the history of the same property of several twins into
+// buckets of equal width starting at from. Bucket i covers
+// [from+i*interval, from+(i+1)*interval); the last bucket ends at to,
+// inclusive. It returns the start of each bucket and one series per twin,
+// sorted by twin ID.
+func (s *Store) Aligned(twinIDs []string, featureID, key string, from, to time.Time, interval time.Duration, agg Aggregation) ([]time.Time, []Series, error) {
+	if from.IsZero() || to.IsZero() || !to.After(from) {
+		return nil, nil, fmt.Errorf("%w: from and to are required and from must be before to", ErrInvalidRange)
+	}
+	if interval <= 0 {
+		return nil, nil, fmt.Errorf("%w: interval must be positive", ErrInvalidRange)
+	}
+
+	span := to.Sub(from)
+	buckets := int(span / interval)
+	if span%interval != 0 {
+		buckets++
+	}
+	if buckets > MaxBuckets {
+		return nil, nil, fmt.Errorf("%w: %d buckets exceed the maximum of %d", ErrInvalidRange, buckets, MaxBuckets)
+	}
+
+	timestamps := make([]time.Time, buckets)
+	for i := range timestamps {
+		timestamps[i] = from.Add(time.Duration(i) * interval)
+	}
+
+	ids := append([]string(nil), twinIDs...)
+	sort.Strings(ids)
+
+	series := make([]Series, 0, len(ids))
+	for _, id := range ids {
+		grouped := make([][]interface{}, buckets)
+		for _, sample := range s.Query(id, featureID, key, from, to) {
+			i := int(sample.Timestamp.Sub(from) / interval)
+			if i >= buckets {
+				i = buckets - 1
+			}
+			grouped[i] = append(grouped[i], sample.Value)
+		}
+
+		values := make([]interface{}, buckets)
+		for i, group := range grouped {
+			values[i] = aggregate(group, agg)
+		}
+		series = append(series, Series{TwinID: id, Values: values})
+	}
+	return timestamps, series, nil
+}
+
+// aggregate combines the values of a bucket in chronological order; it
+// returns nil when there is nothing to aggregate
+func aggregate(values []interface{}, agg Aggregation) interface{} {
+	switch agg {
+	case AggregateCount:
+		return len(values)
+	case AggregateFirst:
+		if len(values) == 0 {
+			return nil
+		}
+		return values[0]
+	case AggregateLast:
+		if len(values) == 0 {
+			return nil
+		}
+		return values[len(values)-1]
+	}
+
+	var result float64
+	n := 0
+	for _, v := range values {
+		f, ok := toFloat(v)
+		if !ok {
+			continue
+		}
+		switch {
+		case n == 0:
+			result = f
+		case agg == AggregateMin && f < result, agg == AggregateMax && f > result:
+			result = f
+		case agg == AggregateMean, agg == AggregateSum:
+			result += f
+		}
+		n++
+	}
+
+	if n == 0 {
+		return nil
+	}
+	if agg == AggregateMean {
+		return result / float64(n)
+	}
+	return result
+}
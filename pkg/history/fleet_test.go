@@ -0,0 +1,78 @@
+package history
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAligned(t *testing.T) {
+	s := NewStore(0)
+	base := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	s.Record("pump-2", "status", "pressure", 4.0, base.Add(30*time.Second))
+	s.Record("pump-1", "status", "pressure", 2.0, base)
+	s.Record("pump-1", "status", "pressure", 3.0, base.Add(50*time.Second))
+	s.Record("pump-1", "status", "pressure", "offline", base.Add(55*time.Second))
+	s.Record("pump-1", "status", "pressure", 5.0, base.Add(3*time.Minute)) // End of the range is inclusive
+	s.Record("pump-1", "status", "pressure", 9.0, base.Add(4*time.Minute))
+
+	ids := []string{"pump-2", "pump-1", "pump-3"}
+	timestamps, series, err := s.Aligned(ids, "status", "pressure", base, base.Add(3*time.Minute), time.Minute, AggregateMean)
+	if err != nil {
+		t.Fatalf("Failed to query aligned series: %v", err)
+	}
+	if len(timestamps) != 3 || !timestamps[2].Equal(base.Add(2*time.Minute)) {
+		t.Errorf("Unexpected bucket timestamps %v", timestamps)
+	}
+	if len(series) != 3 || series[0].TwinID != "pump-1" || series[2].TwinID != "pump-3" {
+		t.Fatalf("Expected one series per twin sorted by ID, got %+v", series)
+	}
+
+	for i, want := range []interface{}{2.5, nil, 5.0} {
+		if series[0].Values[i] != want {
+			t.Errorf("Expected bucket %d of pump-1 to be %v, got %v", i, want, series[0].Values[i])
+		}
+	}
+	if series[1].Values[0] != 4.0 || series[2].Values[0] != nil {
+		t.Errorf("Unexpected series %+v", series[1:])
+	}
+
+	tests := map[Aggregation]interface{}{
+		AggregateMin:   2.0,
+		AggregateMax:   3.0,
+		AggregateSum:   5.0,
+		AggregateCount: 3,
+		AggregateFirst: 2.0,
+		AggregateLast:  "offline",
+	}
+	for agg, want := range tests {
+		_, series, _ := s.Aligned([]string{"pump-1"}, "status", "pressure", base, base.Add(time.Minute), time.Minute, agg)
+		if series[0].Values[0] != want {
+			t.Errorf("Expected %s to be %v, got %v", agg, want, series[0].Values[0])
+		}
+	}
+}
+
+func TestAlignedValidation(t *testing.T) {
+	s := NewStore(0)
+	base := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	ranges := [][3]time.Duration{
+		{0, 0, time.Minute},
+		{0, time.Hour, 0},
+		{0, time.Hour, time.Millisecond},
+	}
+	for _, r := range ranges {
+		if _, _, err := s.Aligned(nil, "status", "pressure", base.Add(r[0]), base.Add(r[1]), r[2], AggregateMean); !errors.Is(err, ErrInvalidRange) {
+			t.Errorf("Expected ErrInvalidRange for %v, got %v", r, err)
+		}
+	}
+
+	if agg, err := ParseAggregation(""); err != nil || agg != AggregateMean {
+		t.Errorf("Expected the mean by default, got %q (%v)", agg, err)
+	}
+	if _, err := ParseAggregation("median"); !errors.Is(err, ErrInvalidAggregation) {
+		t.Errorf("Expected ErrInvalidAggregation, got %v", err)
+	}
+}
@@ -0,0 +1,334 @@
+package history
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Common errors
+var (
+	ErrNoValue       = errors.New("no value recorded at or before the instant")
+	ErrInvalidMethod = errors.New("invalid interpolation method")
+)
+
+// DefaultCapacity is the number of samples kept per property unless configured otherwise
+const DefaultCapacity = 1000
+
+// Sample is a property value at a point in time
+type Sample struct {
+	Timestamp time.Time   `json:"timestamp"`
+	Value     interface{} `json:"value"`
+}
+
+// seriesKey identifies the history of a single property
+type seriesKey struct {
+	twinID    string
+	featureID string
+	key       string
+}
+
+// Store keeps a bounded, time-ordered history of property values in memory
+type Store struct {
+	capacity int
+	series   map[seriesKey][]Sample
+	mutex    sync.RWMutex
+}
+
+// NewStore creates a history store keeping up to capacity samples per property
+func NewStore(capacity int) *Store {
+	if capacity <= 0 {
+		capacity = DefaultCapacity
+	}
+
+	return &Store{
+		capacity: capacity,
+		series:   make(map[seriesKey][]Sample),
+	}
+}
+
+// Record adds a sample to the history of a property. Samples may arrive out of
+// order; they are inserted at their position in time. When the history is full
+// the oldest sample is discarded.
+func (s *Store) Record(twinID, featureID, key string, value interface{}, timestamp time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	sk := seriesKey{twinID, featureID, key}
+	samples := s.series[sk]
+
+	// Insert after all samples with the same or an earlier timestamp
+	i := sort.Search(len(samples), func(i int) bool {
+		return samples[i].Timestamp.After(timestamp)
+	})
+
+	samples = append(samples, Sample{})
+	copy(samples[i+1:], samples[i:])
+	samples[i] = Sample{Timestamp: timestamp, Value: value}
+
+	if len(samples) > s.capacity {
+		samples = samples[len(samples)-s.capacity:]
+	}
+
+	s.series[sk] = samples
+}
+
+// Query returns the samples of a property between from and to (both inclusive)
+// in chronological order. A zero from or to leaves that end of the range open.
+func (s *Store) Query(twinID, featureID, key string, from, to time.Time) []Sample {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	samples := s.series[seriesKey{twinID, featureID, key}]
+
+	start := 0
+	if !from.IsZero() {
+		start = sort.Search(len(samples), func(i int) bool {
+			return !samples[i].Timestamp.Before(from)
+		})
+	}
+
+	end := len(samples)
+	if !to.IsZero() {
+		end = sort.Search(len(samples), func(i int) bool {
+			return samples[i].Timestamp.After(to)
+		})
+	}
+
+	if start >= end {
+		return []Sample{}
+	}
+
+	result := make([]Sample, end-start)
+	copy(result, samples[start:end])
+	return result
+}
+
+// Method selects how the value of a property between two samples is determined
+type Method string
+
+// Interpolation methods
+const (
+	MethodPrevious Method = "previous" // Last value recorded at or before the instant
+	MethodLinear   Method = "linear"   // Linear interpolation between the surrounding numeric samples
+)
+
+// ParseMethod validates an interpolation method name; empty selects MethodPrevious
+func ParseMethod(s string) (Method, error) {
+	switch m := Method(s); m {
+	case "":
+		return MethodPrevious, nil
+	case MethodPrevious, MethodLinear:
+		return m, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrInvalidMethod, s)
+}
+
+// Point is the value of a property at an instant
+type Point struct {
+	Timestamp time.Time   `json:"timestamp"`
+	Value     interface{} `json:"value"`
+	Method    Method      `json:"method"`  // Method that produced the value
+	Samples   []Sample    `json:"samples"` // Samples the value was derived from
+}
+
+// At returns the value of a property at an instant. With MethodLinear,
+// numeric values between two samples are interpolated; at a sample, after the
+// last sample or for non-numeric values the last known value is returned and
+// the point reports MethodPrevious. ErrNoValue is returned for instants before
+// the oldest sample kept.
+func (s *Store) At(twinID, featureID, key string, t time.Time, method Method) (Point, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	samples := s.series[seriesKey{twinID, featureID, key}]
+
+	// Index of the first sample after t
+	i := sort.Search(len(samples), func(i int) bool {
+		return samples[i].Timestamp.After(t)
+	})
+	if i == 0 {
+		return Point{}, ErrNoValue
+	}
+
+	previous := samples[i-1]
+	point := Point{Timestamp: t, Value: previous.Value, Method: MethodPrevious, Samples: []Sample{previous}}
+
+	if method != MethodLinear || i == len(samples) || previous.Timestamp.Equal(t) {
+		return point, nil
+	}
+
+	next := samples[i]
+	from, ok := toFloat(previous.Value)
+	if !ok {
+		return point, nil
+	}
+	to, ok := toFloat(next.Value)
+	if !ok {
+		return point, nil
+	}
+
+	fraction := float64(t.Sub(previous.Timestamp)) / float64(next.Timestamp.Sub(previous.Timestamp))
+	point.Value = from + (to-from)*fraction
+	point.Method = MethodLinear
+	point.Samples = append(point.Samples, next)
+	return point, nil
+}
+
+// toFloat converts numeric values to float64
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	default:
+		return 0, false
+	}
+}
+
+// DeleteTwin removes the history of all properties of a twin
+func (s *Store) DeleteTwin(twinID string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for sk := range s.series {
+		if sk.twinID == twinID {
+			delete(s.series, sk)
+		}
+	}
+}
+
+// RenameTwin moves the history of all properties of a twin to its new ID.
+// History already kept for the new ID, as when twins are merged, is merged
+// with it in time order, keeping the latest samples.
+func (s *Store) RenameTwin(oldID, newID string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for sk, samples := range s.series {
+		if sk.twinID != oldID {
+			continue
+		}
+		delete(s.series, sk)
+		sk.twinID = newID
+		if existing := s.series[sk]; len(existing) > 0 {
+			samples = append(append([]Sample(nil), existing...), samples...)
+			sort.SliceStable(samples, func(i, j int) bool {
+				return samples[i].Timestamp.Before(samples[j].Timestamp)
+			})
+			if len(samples) > s.capacity {
+				samples = samples[len(samples)-s.capacity:]
+			}
+		}
+		s.series[sk] = samples
+	}
+}
+
+// Property identifies a property of a twin with recorded history
+type Property struct {
+	FeatureID string `json:"featureId"`
+	Key       string `json:"key"`
+}
+
+// Properties returns the properties of a twin with recorded history, sorted
+// by feature and key
+func (s *Store) Properties(twinID string) []Property {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var result []Property
+	for sk := range s.series {
+		if sk.twinID == twinID {
+			result = append(result, Property{FeatureID: sk.featureID, Key: sk.key})
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].FeatureID != result[j].FeatureID {
+			return result[i].FeatureID < result[j].FeatureID
+		}
+		return result[i].Key < result[j].Key
+	})
+	return result
+}
+
+// DeleteRange removes the samples of a property between from and to (both
+// inclusive) and returns the number removed. A zero from or to leaves that end
+// of the range open.
+func (s *Store) DeleteRange(twinID, featureID, key string, from, to time.Time) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	sk := seriesKey{twinID, featureID, key}
+	samples := s.series[sk]
+
+	kept := samples[:0]
+	for _, sample := range samples {
+		if (from.IsZero() || !sample.Timestamp.Before(from)) && (to.IsZero() || !sample.Timestamp.After(to)) {
+			continue
+		}
+		kept = append(kept, sample)
+	}
+
+	removed := len(samples) - len(kept)
+	if len(kept) == 0 {
+		delete(s.series, sk)
+	} else {
+		s.series[sk] = kept
+	}
+	return removed
+}
+
+// Entry is a sample of a property of a twin
+type Entry struct {
+	TwinID    string `json:"twinId"`
+	FeatureID string `json:"featureId"`
+	Key       string `json:"key"`
+	Sample
+}
+
+// Range returns the samples of all properties recorded with a timestamp from
+// from (inclusive) up to to (exclusive), ordered by time. A zero from or to
+// leaves that end of the range open. Consecutive ranges never overlap, so they
+// can be exported as separate segments.
+func (s *Store) Range(from, to time.Time) []Entry {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	result := []Entry{}
+	for sk, samples := range s.series {
+		for _, sample := range samples {
+			if !from.IsZero() && sample.Timestamp.Before(from) {
+				continue
+			}
+			if !to.IsZero() && !sample.Timestamp.Before(to) {
+				continue
+			}
+			result = append(result, Entry{TwinID: sk.twinID, FeatureID: sk.featureID, Key: sk.key, Sample: sample})
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if !a.Timestamp.Equal(b.Timestamp) {
+			return a.Timestamp.Before(b.Timestamp)
+		}
+		if a.TwinID != b.TwinID {
+			return a.TwinID < b.TwinID
+		}
+		if a.FeatureID != b.FeatureID {
+			return a.FeatureID < b.FeatureID
+		}
+		return a.Key < b.Key
+	})
+	return result
+}
@@ -0,0 +1,218 @@
+package history
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStoreRecordAndQuery(t *testing.T) {
+	s := NewStore(0)
+	base := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// Record samples out of order
+	s.Record("twin-1", "temperature", "value", 21.0, base.Add(2*time.Minute))
+	s.Record("twin-1", "temperature", "value", 20.0, base)
+	s.Record("twin-1", "temperature", "value", 20.5, base.Add(time.Minute))
+	s.Record("twin-1", "temperature", "unit", "C", base)
+
+	samples := s.Query("twin-1", "temperature", "value", time.Time{}, time.Time{})
+	if len(samples) != 3 {
+		t.Fatalf("Expected 3 samples, got %d", len(samples))
+	}
+
+	for i, want := range []float64{20.0, 20.5, 21.0} {
+		if samples[i].Value != want {
+			t.Errorf("Expected sample %d to be %v, got %v", i, want, samples[i].Value)
+		}
+	}
+
+	// Query a time range
+	samples = s.Query("twin-1", "temperature", "value", base.Add(time.Minute), base.Add(2*time.Minute))
+	if len(samples) != 2 || samples[0].Value != 20.5 {
+		t.Errorf("Expected 2 samples starting at 20.5, got %v", samples)
+	}
+
+	samples = s.Query("twin-1", "temperature", "value", base.Add(time.Hour), time.Time{})
+	if len(samples) != 0 {
+		t.Errorf("Expected no samples after the last one, got %v", samples)
+	}
+
+	// Unknown series are empty
+	if samples := s.Query("twin-2", "temperature", "value", time.Time{}, time.Time{}); len(samples) != 0 {
+		t.Errorf("Expected no samples for unknown twin, got %v", samples)
+	}
+}
+
+func TestStoreCapacity(t *testing.T) {
+	s := NewStore(3)
+	base := time.Now()
+
+	for i := 0; i < 5; i++ {
+		s.Record("twin-1", "counter", "count", i, base.Add(time.Duration(i)*time.Second))
+	}
+
+	samples := s.Query("twin-1", "counter", "count", time.Time{}, time.Time{})
+	if len(samples) != 3 {
+		t.Fatalf("Expected 3 samples, got %d", len(samples))
+	}
+
+	if samples[0].Value != 2 {
+		t.Errorf("Expected the oldest samples to be discarded, got %v first", samples[0].Value)
+	}
+}
+
+func TestStoreDeleteTwin(t *testing.T) {
+	s := NewStore(10)
+	now := time.Now()
+
+	s.Record("twin-1", "temperature", "value", 1, now)
+	s.Record("twin-2", "temperature", "value", 2, now)
+
+	s.DeleteTwin("twin-1")
+
+	if samples := s.Query("twin-1", "temperature", "value", time.Time{}, time.Time{}); len(samples) != 0 {
+		t.Errorf("Expected history of twin-1 to be deleted, got %v", samples)
+	}
+
+	if samples := s.Query("twin-2", "temperature", "value", time.Time{}, time.Time{}); len(samples) != 1 {
+		t.Errorf("Expected history of twin-2 to be kept, got %v", samples)
+	}
+}
+
+func TestStoreRenameTwin(t *testing.T) {
+	s := NewStore(10)
+	now := time.Now()
+
+	s.Record("twin-1", "temperature", "value", 1, now)
+	s.Record("twin-2", "temperature", "value", 2, now)
+
+	s.RenameTwin("twin-1", "twin-3")
+
+	if samples := s.Query("twin-1", "temperature", "value", time.Time{}, time.Time{}); len(samples) != 0 {
+		t.Errorf("Expected no history of twin-1, got %v", samples)
+	}
+	if samples := s.Query("twin-3", "temperature", "value", time.Time{}, time.Time{}); len(samples) != 1 || samples[0].Value != 1 {
+		t.Errorf("Expected the history of twin-1 for twin-3, got %v", samples)
+	}
+	if samples := s.Query("twin-2", "temperature", "value", time.Time{}, time.Time{}); len(samples) != 1 {
+		t.Errorf("Expected history of twin-2 to be kept, got %v", samples)
+	}
+
+	// Renaming onto a twin with history merges the samples in time order
+	s.Record("twin-3", "temperature", "value", 3, now.Add(-time.Minute))
+	s.RenameTwin("twin-2", "twin-3")
+	samples := s.Query("twin-3", "temperature", "value", time.Time{}, time.Time{})
+	if len(samples) != 3 || samples[0].Value != 3 || samples[1].Value != 1 || samples[2].Value != 2 {
+		t.Errorf("Expected the samples of both twins in time order, got %v", samples)
+	}
+}
+
+func TestStoreProperties(t *testing.T) {
+	s := NewStore(10)
+	now := time.Now()
+
+	s.Record("twin-1", "temperature", "value", 1, now)
+	s.Record("twin-1", "counter", "good", 2, now)
+	s.Record("twin-1", "counter", "bad", 3, now)
+	s.Record("twin-2", "temperature", "value", 4, now)
+
+	props := s.Properties("twin-1")
+	expected := []Property{{"counter", "bad"}, {"counter", "good"}, {"temperature", "value"}}
+	if len(props) != len(expected) {
+		t.Fatalf("Expected %d properties, got %v", len(expected), props)
+	}
+	for i := range expected {
+		if props[i] != expected[i] {
+			t.Errorf("Expected %v at %d, got %v", expected[i], i, props[i])
+		}
+	}
+}
+
+func TestStoreDeleteRange(t *testing.T) {
+	s := NewStore(10)
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 5; i++ {
+		s.Record("twin-1", "counter", "count", i, base.Add(time.Duration(i)*time.Second))
+	}
+
+	if removed := s.DeleteRange("twin-1", "counter", "count", base.Add(time.Second), base.Add(3*time.Second)); removed != 3 {
+		t.Errorf("Expected 3 samples removed, got %d", removed)
+	}
+
+	samples := s.Query("twin-1", "counter", "count", time.Time{}, time.Time{})
+	if len(samples) != 2 || samples[0].Value != 0 || samples[1].Value != 4 {
+		t.Errorf("Expected samples 0 and 4 to be kept, got %v", samples)
+	}
+
+	s.DeleteRange("twin-1", "counter", "count", time.Time{}, time.Time{})
+	if props := s.Properties("twin-1"); len(props) != 0 {
+		t.Errorf("Expected empty history to be removed, got %v", props)
+	}
+}
+
+func TestStoreRange(t *testing.T) {
+	s := NewStore(10)
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	s.Record("twin-2", "temperature", "value", 20, base.Add(time.Second))
+	s.Record("twin-1", "temperature", "value", 10, base.Add(time.Second))
+	s.Record("twin-1", "counter", "count", 1, base)
+	s.Record("twin-1", "counter", "count", 2, base.Add(2*time.Second))
+
+	entries := s.Range(base, base.Add(2*time.Second))
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 entries, got %v", entries)
+	}
+	if entries[0].Value != 1 || entries[1].TwinID != "twin-1" || entries[2].TwinID != "twin-2" {
+		t.Errorf("Unexpected order: %v", entries)
+	}
+
+	if entries := s.Range(base.Add(2*time.Second), time.Time{}); len(entries) != 1 || entries[0].Value != 2 {
+		t.Errorf("Expected the last sample in an open range, got %v", entries)
+	}
+}
+
+func TestStoreAt(t *testing.T) {
+	s := NewStore(10)
+	base := time.Now()
+
+	s.Record("twin-1", "climate", "temperature", 20.0, base)
+	s.Record("twin-1", "climate", "temperature", 24.0, base.Add(4*time.Minute))
+	s.Record("twin-1", "status", "mode", "idle", base)
+	s.Record("twin-1", "status", "mode", "running", base.Add(time.Minute))
+
+	if _, err := s.At("twin-1", "climate", "temperature", base.Add(-time.Second), MethodPrevious); err != ErrNoValue {
+		t.Errorf("Expected ErrNoValue before the first sample, got %v", err)
+	}
+
+	p, err := s.At("twin-1", "climate", "temperature", base.Add(time.Minute), MethodPrevious)
+	if err != nil || p.Value != 20.0 || p.Method != MethodPrevious {
+		t.Errorf("Expected the last known value 20, got %+v (%v)", p, err)
+	}
+
+	p, _ = s.At("twin-1", "climate", "temperature", base.Add(time.Minute), MethodLinear)
+	if p.Value != 21.0 || p.Method != MethodLinear || len(p.Samples) != 2 {
+		t.Errorf("Expected the interpolated value 21, got %+v", p)
+	}
+
+	// After the last sample the last known value is kept
+	p, _ = s.At("twin-1", "climate", "temperature", base.Add(time.Hour), MethodLinear)
+	if p.Value != 24.0 || p.Method != MethodPrevious {
+		t.Errorf("Expected the last known value 24, got %+v", p)
+	}
+
+	// Non-numeric values are not interpolated
+	p, _ = s.At("twin-1", "status", "mode", base.Add(30*time.Second), MethodLinear)
+	if p.Value != "idle" || p.Method != MethodPrevious {
+		t.Errorf("Expected the last known mode, got %+v", p)
+	}
+
+	if _, err := ParseMethod("cubic"); !errors.Is(err, ErrInvalidMethod) {
+		t.Errorf("Expected ErrInvalidMethod, got %v", err)
+	}
+	if m, err := ParseMethod(""); err != nil || m != MethodPrevious {
+		t.Errorf("Expected the previous method by default, got %v (%v)", m, err)
+	}
+}
@@ -0,0 +1,517 @@
+package ifc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/aleka07/go-digital-twin/pkg/reconcile"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+)
+
+// ContainsRelationship links spatial elements to what they contain:
+// buildings to floors, floors to rooms and equipment, rooms to equipment
+const ContainsRelationship = "contains"
+
+// DefaultPrefix is prepended to IFC GlobalIds to form twin IDs
+const DefaultPrefix = "ifc-"
+
+// Class describes an imported IFC class
+type Class struct {
+	Name string // IFC class name, such as IfcBuildingStorey
+	Type string // Twin type
+}
+
+// SpatialClasses are the imported spatial structure elements
+var SpatialClasses = []Class{
+	{"IfcSite", "site"},
+	{"IfcBuilding", "building"},
+	{"IfcBuildingStorey", "floor"},
+	{"IfcSpace", "room"},
+}
+
+// EquipmentClasses are the imported distribution elements, IFC 2x3 and IFC 4.
+// Building elements such as walls and doors are not imported.
+var EquipmentClasses = []Class{
+	{"IfcActuator", "actuator"},
+	{"IfcAirTerminal", "airTerminal"},
+	{"IfcAirTerminalBox", "airTerminalBox"},
+	{"IfcAirToAirHeatRecovery", "heatRecovery"},
+	{"IfcAlarm", "alarm"},
+	{"IfcAudioVisualAppliance", "audioVisualAppliance"},
+	{"IfcBoiler", "boiler"},
+	{"IfcBurner", "burner"},
+	{"IfcChiller", "chiller"},
+	{"IfcCoil", "coil"},
+	{"IfcCommunicationsAppliance", "communicationsAppliance"},
+	{"IfcCompressor", "compressor"},
+	{"IfcCondenser", "condenser"},
+	{"IfcController", "controller"},
+	{"IfcCooledBeam", "cooledBeam"},
+	{"IfcCoolingTower", "coolingTower"},
+	{"IfcDamper", "damper"},
+	{"IfcDistributionControlElement", "controlElement"},
+	{"IfcElectricAppliance", "electricAppliance"},
+	{"IfcElectricDistributionBoard", "distributionBoard"},
+	{"IfcElectricFlowStorageDevice", "electricStorage"},
+	{"IfcElectricGenerator", "generator"},
+	{"IfcElectricMotor", "motor"},
+	{"IfcEnergyConversionDevice", "energyConversionDevice"},
+	{"IfcEngine", "engine"},
+	{"IfcEvaporativeCooler", "evaporativeCooler"},
+	{"IfcEvaporator", "evaporator"},
+	{"IfcFan", "fan"},
+	{"IfcFilter", "filter"},
+	{"IfcFireSuppressionTerminal", "fireSuppressionTerminal"},
+	{"IfcFlowController", "flowController"},
+	{"IfcFlowInstrument", "flowInstrument"},
+	{"IfcFlowMeter", "flowMeter"},
+	{"IfcFlowMovingDevice", "flowMovingDevice"},
+	{"IfcFlowStorageDevice", "flowStorageDevice"},
+	{"IfcFlowTerminal", "flowTerminal"},
+	{"IfcFlowTreatmentDevice", "flowTreatmentDevice"},
+	{"IfcHeatExchanger", "heatExchanger"},
+	{"IfcHumidifier", "humidifier"},
+	{"IfcLamp", "lamp"},
+	{"IfcLightFixture", "lightFixture"},
+	{"IfcOutlet", "outlet"},
+	{"IfcProtectiveDevice", "protectiveDevice"},
+	{"IfcPump", "pump"},
+	{"IfcSanitaryTerminal", "sanitaryTerminal"},
+	{"IfcSensor", "sensor"},
+	{"IfcSolarDevice", "solarDevice"},
+	{"IfcSpaceHeater", "spaceHeater"},
+	{"IfcSwitchingDevice", "switchingDevice"},
+	{"IfcTank", "tank"},
+	{"IfcTransformer", "transformer"},
+	{"IfcUnitaryControlElement", "unitaryControlElement"},
+	{"IfcUnitaryEquipment", "unitaryEquipment"},
+	{"IfcValve", "valve"},
+}
+
+// classes indexes the imported classes by upper-cased name
+var classes = func() map[string]Class {
+	m := make(map[string]Class)
+	for _, c := range append(append([]Class(nil), SpatialClasses...), EquipmentClasses...) {
+		m[strings.ToUpper(c.Name)] = c
+	}
+	return m
+}()
+
+// Element is a spatial element or piece of equipment of a building model.
+// A list of elements is also the simplified export format, for tools that
+// extract models with other means than IFC files.
+type Element struct {
+	GlobalID     string                            `json:"globalId"`
+	Class        string                            `json:"class"` // Such as IfcSpace; case-insensitive
+	Name         string                            `json:"name,omitempty"`
+	Description  string                            `json:"description,omitempty"`
+	LongName     string                            `json:"longName,omitempty"`
+	ObjectType   string                            `json:"objectType,omitempty"`
+	Tag          string                            `json:"tag,omitempty"`       // Equipment tag
+	Elevation    *float64                          `json:"elevation,omitempty"` // Floors, in meters
+	Latitude     *float64                          `json:"latitude,omitempty"`  // Sites, in decimal degrees
+	Longitude    *float64                          `json:"longitude,omitempty"`
+	Parent       string                            `json:"parent,omitempty"` // GlobalId of the containing element
+	PropertySets map[string]map[string]interface{} `json:"propertySets,omitempty"`
+}
+
+// Model is a building model reduced to the elements that become twins
+type Model struct {
+	Elements []Element `json:"elements"`
+}
+
+// Parse reads an IFC file in the STEP physical format and extracts its
+// spatial structure and equipment
+func Parse(in io.Reader) (*Model, error) {
+	records, err := ReadRecords(in)
+	if err != nil {
+		return nil, err
+	}
+	return extract(records), nil
+}
+
+// ParseJSON reads a model in the simplified export format
+func ParseJSON(in io.Reader) (*Model, error) {
+	var model Model
+	if err := json.NewDecoder(in).Decode(&model); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFile, err)
+	}
+	return &model, nil
+}
+
+// extract builds the model from the records of an IFC file
+func extract(records map[Ref]*Record) *Model {
+	// Length unit, to convert elevations to meters
+	scale := 1.0
+	for _, r := range records {
+		if r.Type == "IFCSIUNIT" && r.Arg(1) == Enum("LENGTHUNIT") {
+			if factor, ok := siPrefixes[r.Arg(2)]; ok {
+				scale = factor
+			}
+		}
+	}
+
+	// Containment, from child to parent record
+	parents := make(map[Ref]Ref)
+	for _, r := range records {
+		switch r.Type {
+		case "IFCRELAGGREGATES":
+			if parent, ok := r.Arg(4).(Ref); ok {
+				for _, child := range refs(r.Arg(5)) {
+					parents[child] = parent
+				}
+			}
+		case "IFCRELCONTAINEDINSPATIALSTRUCTURE":
+			if parent, ok := r.Arg(5).(Ref); ok {
+				for _, child := range refs(r.Arg(4)) {
+					parents[child] = parent
+				}
+			}
+		}
+	}
+
+	// Property sets of objects
+	psets := make(map[Ref]map[string]map[string]interface{})
+	for _, r := range records {
+		if r.Type != "IFCRELDEFINESBYPROPERTIES" {
+			continue
+		}
+		ref, _ := r.Arg(5).(Ref)
+		pset := records[ref]
+		if pset == nil || pset.Type != "IFCPROPERTYSET" || pset.String(2) == "" {
+			continue
+		}
+
+		values := make(map[string]interface{})
+		for _, p := range refs(pset.Arg(4)) {
+			prop := records[p]
+			if prop == nil || prop.Type != "IFCPROPERTYSINGLEVALUE" || prop.String(0) == "" {
+				continue
+			}
+			if v := propertyValue(prop.Arg(2)); v != nil {
+				values[prop.String(0)] = v
+			}
+		}
+		if len(values) == 0 {
+			continue
+		}
+
+		for _, object := range refs(r.Arg(4)) {
+			if psets[object] == nil {
+				psets[object] = make(map[string]map[string]interface{})
+			}
+			psets[object][pset.String(2)] = values
+		}
+	}
+
+	ids := make([]Ref, 0, len(records))
+	for id, r := range records {
+		if _, ok := classes[r.Type]; ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	model := &Model{Elements: make([]Element, 0, len(ids))}
+	for _, id := range ids {
+		r := records[id]
+		e := Element{
+			GlobalID:     r.String(0),
+			Class:        classes[r.Type].Name,
+			Name:         r.String(2),
+			Description:  r.String(3),
+			ObjectType:   r.String(4),
+			PropertySets: psets[id],
+		}
+
+		// Spatial structure elements have a long name where elements have a tag
+		if isSpatial(r.Type) {
+			e.LongName = r.String(7)
+		} else {
+			e.Tag = r.String(7)
+		}
+		switch r.Type {
+		case "IFCBUILDINGSTOREY":
+			if elevation, ok := number(r.Arg(9)); ok {
+				elevation *= scale
+				e.Elevation = &elevation
+			}
+		case "IFCSITE":
+			e.Latitude = angle(r.Arg(9))
+			e.Longitude = angle(r.Arg(10))
+		}
+
+		// The parent is the nearest imported ancestor
+		for parent, seen := parents[id], 0; parent != 0 && seen < len(records); parent, seen = parents[parent], seen+1 {
+			if p := records[parent]; p != nil {
+				if _, ok := classes[p.Type]; ok {
+					e.Parent = p.String(0)
+					break
+				}
+			}
+		}
+		model.Elements = append(model.Elements, e)
+	}
+	return model
+}
+
+// siPrefixes are the scale factors of SI prefixes of length units
+var siPrefixes = map[interface{}]float64{
+	nil:           1,
+	Enum("KILO"):  1e3,
+	Enum("HECTO"): 1e2,
+	Enum("DECA"):  1e1,
+	Enum("DECI"):  1e-1,
+	Enum("CENTI"): 1e-2,
+	Enum("MILLI"): 1e-3,
+	Enum("MICRO"): 1e-6,
+}
+
+// isSpatial reports whether an upper-cased class is a spatial structure element
+func isSpatial(class string) bool {
+	for _, c := range SpatialClasses {
+		if strings.ToUpper(c.Name) == class {
+			return true
+		}
+	}
+	return false
+}
+
+// refs returns the references of a list argument
+func refs(v interface{}) []Ref {
+	list, _ := v.([]interface{})
+	result := make([]Ref, 0, len(list))
+	for _, item := range list {
+		if ref, ok := item.(Ref); ok {
+			result = append(result, ref)
+		}
+	}
+	return result
+}
+
+// number returns a numeric argument, unwrapping typed values
+func number(v interface{}) (float64, bool) {
+	if typed, ok := v.(Typed); ok {
+		v = typed.Value
+	}
+	n, ok := v.(float64)
+	return n, ok
+}
+
+// angle converts a compound plane angle, degrees, minutes, seconds and
+// optionally millionths of seconds, to decimal degrees
+func angle(v interface{}) *float64 {
+	list, _ := v.([]interface{})
+	if len(list) < 3 {
+		return nil
+	}
+
+	divisors := []float64{1, 60, 3600, 3600e6}
+	degrees := 0.0
+	for i, part := range list {
+		n, ok := number(part)
+		if !ok || i >= len(divisors) {
+			return nil
+		}
+		degrees += n / divisors[i]
+	}
+	degrees = math.Round(degrees*1e7) / 1e7
+	return &degrees
+}
+
+// propertyValue converts the nominal value of a property to JSON: numbers,
+// strings and booleans. Unknown logical values are left out.
+func propertyValue(v interface{}) interface{} {
+	if typed, ok := v.(Typed); ok {
+		v = typed.Value
+	}
+	switch v := v.(type) {
+	case string, float64:
+		return v
+	case Enum:
+		switch v {
+		case "T":
+			return true
+		case "F":
+			return false
+		}
+	}
+	return nil
+}
+
+// Options control how a model is imported
+type Options struct {
+	Prefix string `json:"prefix,omitempty"` // Prepended to GlobalIds to form twin IDs, DefaultPrefix when empty
+	DryRun bool   `json:"dryRun"`           // Report the changes without applying them
+}
+
+// Report summarizes an import
+type Report struct {
+	reconcile.Report
+	Relationships int      `json:"relationships"` // Containment links added
+	Skipped       []string `json:"skipped"`       // GlobalIds of elements of classes that are not imported
+}
+
+// Import creates or updates a twin for every element of a model and links
+// containers to their contents. Twins are reconciled like an asset list:
+// attributes from the model are overwritten, others are kept, and
+// containment links are added without removing existing ones.
+func Import(reg *registry.Registry, model *Model, opts Options) *Report {
+	if opts.Prefix == "" {
+		opts.Prefix = DefaultPrefix
+	}
+
+	var assets []reconcile.Asset
+	var skipped []string
+	imported := make(map[string]bool)
+	for _, e := range model.Elements {
+		class, ok := classes[strings.ToUpper(e.Class)]
+		if !ok || e.GlobalID == "" {
+			skipped = append(skipped, e.GlobalID)
+			continue
+		}
+		imported[e.GlobalID] = true
+		assets = append(assets, reconcile.Asset{
+			ID:         opts.Prefix + e.GlobalID,
+			Type:       class.Type,
+			Attributes: attributes(e, class),
+		})
+	}
+
+	result := reconcile.Reconcile(reg, assets, reconcile.Options{DryRun: opts.DryRun, Source: "ifc"})
+	report := &Report{Report: *result, Skipped: skipped}
+	if report.Skipped == nil {
+		report.Skipped = []string{}
+	}
+
+	failed := make(map[string]bool)
+	for _, f := range result.Failed {
+		failed[f.ID] = true
+	}
+	created := make(map[string]bool)
+	for _, id := range result.Created {
+		created[id] = true
+	}
+	updated := make(map[string]bool)
+	for _, id := range result.Updated {
+		updated[id] = true
+	}
+
+	// Containment, grouped by parent so that each parent is updated once.
+	// Parents imported earlier are linked too, so that models can be
+	// imported in parts.
+	children := make(map[string][]string)
+	for _, e := range model.Elements {
+		if !imported[e.GlobalID] || e.Parent == "" {
+			continue
+		}
+		parent, child := opts.Prefix+e.Parent, opts.Prefix+e.GlobalID
+		if !imported[e.Parent] {
+			if _, err := reg.Get(parent); err != nil {
+				continue
+			}
+		}
+		if !failed[parent] && !failed[child] {
+			children[parent] = append(children[parent], child)
+		}
+	}
+
+	parents := make([]string, 0, len(children))
+	for id := range children {
+		parents = append(parents, id)
+	}
+	sort.Strings(parents)
+
+	for _, id := range parents {
+		if opts.DryRun && created[id] {
+			report.Relationships += len(children[id])
+			continue
+		}
+
+		dt, err := reg.Get(id)
+		if err != nil {
+			report.Failed = append(report.Failed, reconcile.Failure{ID: id, Error: err.Error()})
+			continue
+		}
+
+		existing := make(map[string]bool)
+		for _, target := range dt.GetRelationship(ContainsRelationship) {
+			existing[target] = true
+		}
+		var added []string
+		for _, child := range children[id] {
+			if !existing[child] {
+				added = append(added, child)
+			}
+		}
+		if len(added) == 0 {
+			continue
+		}
+
+		// The registry returns the stored twin, so a dry run must not touch it
+		if !opts.DryRun {
+			for _, child := range added {
+				dt.AddRelationship(ContainsRelationship, child)
+			}
+			if err := reg.Update(dt); err != nil {
+				report.Failed = append(report.Failed, reconcile.Failure{ID: id, Error: err.Error()})
+				continue
+			}
+		}
+		report.Relationships += len(added)
+		if !created[id] && !updated[id] {
+			updated[id] = true
+			report.Updated = append(report.Updated, id)
+		}
+	}
+
+	// Twins that only gained links were reported unchanged by the reconciliation
+	unchanged := report.Unchanged[:0]
+	for _, id := range report.Unchanged {
+		if !updated[id] {
+			unchanged = append(unchanged, id)
+		}
+	}
+	report.Unchanged = unchanged
+	sort.Strings(report.Updated)
+	return report
+}
+
+// attributes returns the twin attributes of an element
+func attributes(e Element, class Class) map[string]interface{} {
+	attrs := map[string]interface{}{
+		"ifcGlobalId": e.GlobalID,
+		"ifcClass":    class.Name,
+	}
+	for key, value := range map[string]string{
+		"name":        e.Name,
+		"description": e.Description,
+		"longName":    e.LongName,
+		"objectType":  e.ObjectType,
+		"tag":         e.Tag,
+	} {
+		if value != "" {
+			attrs[key] = value
+		}
+	}
+	if e.Elevation != nil {
+		attrs["elevation"] = *e.Elevation
+	}
+	if e.Latitude != nil && e.Longitude != nil {
+		attrs["latitude"] = *e.Latitude
+		attrs["longitude"] = *e.Longitude
+	}
+	if len(e.PropertySets) > 0 {
+		// Attributes hold JSON values, so nested maps use the generic type
+		psets := make(map[string]interface{}, len(e.PropertySets))
+		for name, values := range e.PropertySets {
+			psets[name] = values
+		}
+		attrs["propertySets"] = psets
+	}
+	return attrs
+}
@@ -0,0 +1,158 @@
+package ifc
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// building is a reduced IFC 2x3 file with a site, a building, two floors,
+// a room, an air terminal in the room, a pump on a floor and a wall
+const building = `ISO-10303-21;
+HEADER;
+FILE_SCHEMA(('IFC2X3'));
+ENDSEC;
+DATA;
+#1=IFCPROJECT('0proj',$,'Project',$,$,$,$,(#2),#3);
+#3=IFCUNITASSIGNMENT((#4));
+#4=IFCSIUNIT(*,.LENGTHUNIT.,.MILLI.,.METRE.);
+#10=IFCSITE('0site',$,'Site',$,$,$,$,$,.ELEMENT.,(52,30,36,0),(13,24,0),$,$,$);
+#11=IFCBUILDING('0bldg',$,'HQ','Head office',$,$,$,'Headquarters',.ELEMENT.,$,$,$);
+#12=IFCBUILDINGSTOREY('0fl1',$,'Level 1',$,$,$,$,$,.ELEMENT.,3000.);
+#13=IFCBUILDINGSTOREY('0fl2',$,'Level 2',$,$,$,$,$,.ELEMENT.,6000.);
+#14=IFCSPACE('0room',$,'101',$,$,$,$,'Meeting room',.ELEMENT.,.INTERNAL.,$);
+#20=IFCFLOWTERMINAL('0term',$,'Diffuser',$,'Supply',$,$,'AT-101');
+#21=IFCPUMP('0pump',$,'Pump',$,$,$,$,'P-1',$);
+#22=IFCWALL('0wall',$,'Wall',$,$,$,$,$);
+#30=IFCRELAGGREGATES('r1',$,$,$,#1,(#10));
+#31=IFCRELAGGREGATES('r2',$,$,$,#10,(#11));
+#32=IFCRELAGGREGATES('r3',$,$,$,#11,(#12,#13));
+#33=IFCRELAGGREGATES('r4',$,$,$,#12,(#14));
+#34=IFCRELCONTAINEDINSPATIALSTRUCTURE('r5',$,$,$,(#20),#14);
+#35=IFCRELCONTAINEDINSPATIALSTRUCTURE('r6',$,$,$,(#21,#22),#13);
+#40=IFCPROPERTYSINGLEVALUE('IsExternal',$,IFCBOOLEAN(.F.),$);
+#41=IFCPROPERTYSINGLEVALUE('OccupancyNumber',$,IFCCOUNTMEASURE(8.),$);
+#42=IFCPROPERTYSET('pset',$,'Pset_SpaceCommon',$,(#40,#41));
+#43=IFCRELDEFINESBYPROPERTIES('r7',$,$,$,(#14),#42);
+ENDSEC;
+END-ISO-10303-21;
+`
+
+func TestParse(t *testing.T) {
+	model, err := Parse(strings.NewReader(building))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	elements := make(map[string]Element)
+	for _, e := range model.Elements {
+		elements[e.GlobalID] = e
+	}
+	if len(elements) != 7 {
+		t.Fatalf("Expected the site, building, floors, room, terminal and pump, got %+v", model.Elements)
+	}
+
+	if e := elements["0site"]; e.Parent != "" || e.Latitude == nil || *e.Latitude != 52.51 || *e.Longitude != 13.4 {
+		t.Errorf("Unexpected site %+v", e)
+	}
+	if e := elements["0bldg"]; e.Class != "IfcBuilding" || e.LongName != "Headquarters" || e.Description != "Head office" || e.Parent != "0site" {
+		t.Errorf("Unexpected building %+v", e)
+	}
+	if e := elements["0fl2"]; e.Elevation == nil || *e.Elevation != 6 || e.Parent != "0bldg" {
+		t.Errorf("Expected the elevation in meters, got %+v", e)
+	}
+	room := elements["0room"]
+	if room.Parent != "0fl1" || room.LongName != "Meeting room" {
+		t.Errorf("Unexpected room %+v", room)
+	}
+	if !reflect.DeepEqual(room.PropertySets, map[string]map[string]interface{}{
+		"Pset_SpaceCommon": {"IsExternal": false, "OccupancyNumber": 8.0},
+	}) {
+		t.Errorf("Unexpected property sets %+v", room.PropertySets)
+	}
+	if e := elements["0term"]; e.Class != "IfcFlowTerminal" || e.Tag != "AT-101" || e.ObjectType != "Supply" || e.Parent != "0room" {
+		t.Errorf("Unexpected terminal %+v", e)
+	}
+	if e := elements["0pump"]; e.Parent != "0fl2" {
+		t.Errorf("Expected the pump on level 2, got %+v", e)
+	}
+}
+
+func TestImport(t *testing.T) {
+	reg := registry.NewRegistry()
+	model, err := Parse(strings.NewReader(building))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	// Dry runs change nothing
+	report := Import(reg, model, Options{DryRun: true})
+	if len(report.Created) != 7 || report.Relationships != 6 || reg.Count() != 0 {
+		t.Errorf("Unexpected dry run %+v", report)
+	}
+
+	report = Import(reg, model, Options{})
+	if len(report.Created) != 7 || report.Relationships != 6 || len(report.Failed) != 0 {
+		t.Fatalf("Unexpected report %+v", report)
+	}
+
+	floor, err := reg.Get("ifc-0fl1")
+	if err != nil {
+		t.Fatalf("Expected the floor twin: %v", err)
+	}
+	if floor.Type != "floor" || !reflect.DeepEqual(floor.GetRelationship(ContainsRelationship), []string{"ifc-0room"}) {
+		t.Errorf("Unexpected floor %+v", floor)
+	}
+	if elevation, _ := floor.GetAttribute("elevation"); elevation != 3.0 {
+		t.Errorf("Expected elevation 3, got %v", elevation)
+	}
+	if room, _ := reg.Get("ifc-0room"); room.Type != "room" || !reflect.DeepEqual(room.GetRelationship(ContainsRelationship), []string{"ifc-0term"}) {
+		t.Errorf("Unexpected room %+v", room)
+	}
+	if pump, _ := reg.Get("ifc-0pump"); pump.Type != "pump" {
+		t.Errorf("Unexpected pump %+v", pump)
+	}
+
+	// Importing again changes nothing, and links are only added
+	floor.AddRelationship(ContainsRelationship, "manual")
+	reg.Update(floor)
+	report = Import(reg, model, Options{})
+	if len(report.Unchanged) != 7 || len(report.Updated) != 0 || report.Relationships != 0 {
+		t.Errorf("Expected a repeated import to change nothing, got %+v", report)
+	}
+	if links := floor.GetRelationship(ContainsRelationship); len(links) != 2 {
+		t.Errorf("Expected manual links to be kept, got %v", links)
+	}
+}
+
+func TestImportJSON(t *testing.T) {
+	reg := registry.NewRegistry()
+	reg.Create(twin.NewDigitalTwin("b-floor", "floor"))
+
+	model, err := ParseJSON(strings.NewReader(`{"elements": [
+		{"globalId": "floor", "class": "IFCBUILDINGSTOREY", "name": "Level 1"},
+		{"globalId": "ahu", "class": "IfcUnitaryEquipment", "tag": "AHU-1", "parent": "floor"},
+		{"globalId": "door", "class": "IfcDoor", "parent": "floor"}
+	]}`))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	report := Import(reg, model, Options{Prefix: "b-"})
+	if !reflect.DeepEqual(report.Created, []string{"b-ahu"}) || !reflect.DeepEqual(report.Updated, []string{"b-floor"}) {
+		t.Errorf("Unexpected report %+v", report)
+	}
+	if !reflect.DeepEqual(report.Skipped, []string{"door"}) {
+		t.Errorf("Expected the door to be skipped, got %v", report.Skipped)
+	}
+	if ahu, _ := reg.Get("b-ahu"); ahu.Type != "unitaryEquipment" {
+		t.Errorf("Unexpected twin %+v", ahu)
+	}
+
+	if _, err := ParseJSON(strings.NewReader(`{"elements": {}}`)); err == nil {
+		t.Error("Expected an error for an invalid model")
+	}
+}
@@ -0,0 +1,393 @@
+package ifc
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// ErrInvalidFile is returned for files that are not valid STEP physical files
+var ErrInvalidFile = errors.New("invalid IFC file")
+
+// Ref is a reference to another record, #12 in the file
+type Ref int
+
+// Enum is an enumeration value such as .ELEMENT.; booleans are .T. and .F.
+type Enum string
+
+// Typed is a value wrapped in its type, such as IFCLABEL('Pump')
+type Typed struct {
+	Type  string
+	Value interface{}
+}
+
+// Record is an entity instance of the DATA section. Arguments are strings,
+// float64 numbers, Refs, Enums, Typed values, nested []interface{} lists,
+// or nil for unset ($) and derived (*) values.
+type Record struct {
+	ID   Ref
+	Type string // Upper case, such as IFCBUILDINGSTOREY
+	Args []interface{}
+}
+
+// Arg returns an argument, or nil if the record has fewer arguments
+func (r *Record) Arg(i int) interface{} {
+	if i < len(r.Args) {
+		return r.Args[i]
+	}
+	return nil
+}
+
+// String returns a string argument, or "" if it is not a string
+func (r *Record) String(i int) string {
+	s, _ := r.Arg(i).(string)
+	return s
+}
+
+// ReadRecords reads the records of the DATA sections of a STEP physical
+// file (ISO 10303-21), the format of .ifc files
+func ReadRecords(in io.Reader) (map[Ref]*Record, error) {
+	reader := bufio.NewReader(in)
+	records := make(map[Ref]*Record)
+
+	inData := false
+	for {
+		statement, err := readStatement(reader)
+		if err == io.EOF {
+			if strings.TrimSpace(statement) != "" {
+				return nil, fmt.Errorf("%w: unterminated statement", ErrInvalidFile)
+			}
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		statement = strings.TrimSpace(statement)
+		switch {
+		case statement == "DATA" || strings.HasPrefix(statement, "DATA("):
+			inData = true
+		case statement == "ENDSEC":
+			inData = false
+		case inData && strings.HasPrefix(statement, "#"):
+			record, err := parseRecord(statement)
+			if err != nil {
+				return nil, err
+			}
+			records[record.ID] = record
+		}
+	}
+
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%w: no DATA records", ErrInvalidFile)
+	}
+	return records, nil
+}
+
+// readStatement reads up to the next semicolon outside strings and
+// comments, returning the statement without it
+func readStatement(r *bufio.Reader) (string, error) {
+	var b strings.Builder
+	inString, inComment := false, false
+	var prev byte
+
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return b.String(), err
+		}
+
+		switch {
+		case inComment:
+			if prev == '*' && c == '/' {
+				inComment = false
+				c = 0
+			}
+		case inString:
+			b.WriteByte(c)
+			if c == '\'' {
+				// A doubled quote is an escaped quote
+				if next, err := r.Peek(1); err == nil && next[0] == '\'' {
+					r.ReadByte()
+					b.WriteByte('\'')
+				} else {
+					inString = false
+				}
+			}
+		case c == '\'':
+			inString = true
+			b.WriteByte(c)
+		case c == '*' && prev == '/':
+			inComment = true
+			s := b.String()
+			b.Reset()
+			b.WriteString(s[:len(s)-1])
+			c = 0
+		case c == ';':
+			return b.String(), nil
+		case c == '\r' || c == '\n':
+			// Records may be wrapped anywhere outside strings
+		default:
+			b.WriteByte(c)
+		}
+		prev = c
+	}
+}
+
+// parseRecord parses an entity instance such as #5=IFCSPACE('2Hk',#4,'101',$);
+func parseRecord(statement string) (*Record, error) {
+	eq := strings.IndexByte(statement, '=')
+	if eq < 0 {
+		return nil, fmt.Errorf("%w: missing = in %.40q", ErrInvalidFile, statement)
+	}
+
+	id, err := strconv.Atoi(strings.TrimSpace(statement[1:eq]))
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid instance name in %.40q", ErrInvalidFile, statement)
+	}
+
+	p := &parser{s: strings.TrimSpace(statement[eq+1:])}
+	record := &Record{ID: Ref(id)}
+
+	// Complex instances, (IFCA(...)IFCB(...)), are not used by the
+	// entities the importer reads and are kept without a type
+	if !strings.HasPrefix(p.s, "(") {
+		record.Type = p.name()
+		p.skipSpace()
+		if p.pos >= len(p.s) || p.s[p.pos] != '(' {
+			return nil, fmt.Errorf("%w: #%d: expected (", ErrInvalidFile, id)
+		}
+		args, err := p.list()
+		if err != nil {
+			return nil, fmt.Errorf("%w: #%d: %v", ErrInvalidFile, id, err)
+		}
+		record.Args = args
+		p.skipSpace()
+		if p.pos != len(p.s) {
+			return nil, fmt.Errorf("%w: #%d: unexpected %q", ErrInvalidFile, id, p.s[p.pos:])
+		}
+	}
+	return record, nil
+}
+
+// parser reads the parameter values of a record
+type parser struct {
+	s   string
+	pos int
+}
+
+// skipSpace skips whitespace
+func (p *parser) skipSpace() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// value parses a single parameter
+func (p *parser) value() (interface{}, error) {
+	p.skipSpace()
+	if p.pos >= len(p.s) {
+		return nil, errors.New("unexpected end of record")
+	}
+
+	switch c := p.s[p.pos]; {
+	case c == '$' || c == '*':
+		p.pos++
+		return nil, nil
+	case c == '#':
+		p.pos++
+		start := p.pos
+		for p.pos < len(p.s) && p.s[p.pos] >= '0' && p.s[p.pos] <= '9' {
+			p.pos++
+		}
+		id, err := strconv.Atoi(p.s[start:p.pos])
+		if err != nil {
+			return nil, fmt.Errorf("invalid reference at %d", start)
+		}
+		return Ref(id), nil
+	case c == '\'':
+		return p.string()
+	case c == '.':
+		end := strings.IndexByte(p.s[p.pos+1:], '.')
+		if end < 0 {
+			return nil, errors.New("unterminated enumeration")
+		}
+		value := p.s[p.pos+1 : p.pos+1+end]
+		p.pos += end + 2
+		return Enum(value), nil
+	case c == '(':
+		return p.list()
+	case c == '"':
+		// Binary values are not used by the importer
+		end := strings.IndexByte(p.s[p.pos+1:], '"')
+		if end < 0 {
+			return nil, errors.New("unterminated binary")
+		}
+		p.pos += end + 2
+		return nil, nil
+	case c == '-' || c == '+' || (c >= '0' && c <= '9'):
+		start := p.pos
+		p.pos++
+		for p.pos < len(p.s) && strings.IndexByte("0123456789.eE+-", p.s[p.pos]) >= 0 {
+			p.pos++
+		}
+		n, err := strconv.ParseFloat(p.s[start:p.pos], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", p.s[start:p.pos])
+		}
+		return n, nil
+	case c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c == '_':
+		// Typed parameter wrapping a single value
+		name := p.name()
+		p.skipSpace()
+		if p.pos >= len(p.s) || p.s[p.pos] != '(' {
+			return nil, fmt.Errorf("expected ( after %s", name)
+		}
+		args, err := p.list()
+		if err != nil {
+			return nil, err
+		}
+		if len(args) == 1 {
+			return Typed{Type: name, Value: args[0]}, nil
+		}
+		return Typed{Type: name, Value: args}, nil
+	default:
+		return nil, fmt.Errorf("unexpected %q", c)
+	}
+}
+
+// name parses an upper-cased entity or type name
+func (p *parser) name() string {
+	start := p.pos
+	for p.pos < len(p.s) && (isAlnum(p.s[p.pos]) || p.s[p.pos] == '_') {
+		p.pos++
+	}
+	return strings.ToUpper(p.s[start:p.pos])
+}
+
+// list parses a parenthesized list of values
+func (p *parser) list() ([]interface{}, error) {
+	p.pos++ // (
+	values := []interface{}{}
+
+	p.skipSpace()
+	if p.pos < len(p.s) && p.s[p.pos] == ')' {
+		p.pos++
+		return values, nil
+	}
+
+	for {
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+
+		p.skipSpace()
+		if p.pos >= len(p.s) {
+			return nil, errors.New("unterminated list")
+		}
+		switch p.s[p.pos] {
+		case ',':
+			p.pos++
+		case ')':
+			p.pos++
+			return values, nil
+		default:
+			return nil, fmt.Errorf("unexpected %q in list", p.s[p.pos])
+		}
+	}
+}
+
+// string parses a quoted string, decoding its escapes
+func (p *parser) string() (interface{}, error) {
+	p.pos++ // '
+	var raw strings.Builder
+	for {
+		if p.pos >= len(p.s) {
+			return nil, errors.New("unterminated string")
+		}
+		c := p.s[p.pos]
+		p.pos++
+		if c == '\'' {
+			if p.pos < len(p.s) && p.s[p.pos] == '\'' {
+				raw.WriteByte('\'')
+				p.pos++
+				continue
+			}
+			return decodeString(raw.String()), nil
+		}
+		raw.WriteByte(c)
+	}
+}
+
+// decodeString decodes the control directives of STEP strings: \X2\ and
+// \X4\ for UTF-16 and UTF-32 code points, \X\ for ISO 8859-1 bytes, \S\ for
+// upper half characters and \\ for a backslash
+func decodeString(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		rest := s[i:]
+		switch {
+		case strings.HasPrefix(rest, "\\\\"):
+			b.WriteByte('\\')
+			i += 2
+		case strings.HasPrefix(rest, "\\X2\\"), strings.HasPrefix(rest, "\\X4\\"):
+			width := 4
+			if rest[2] == '4' {
+				width = 8
+			}
+			end := strings.Index(rest[4:], "\\X0\\")
+			if end < 0 {
+				b.WriteString(rest)
+				return b.String()
+			}
+			hex := rest[4 : 4+end]
+			var units []uint16
+			for j := 0; j+width <= len(hex); j += width {
+				n, err := strconv.ParseUint(hex[j:j+width], 16, 32)
+				if err != nil {
+					break
+				}
+				if width == 8 {
+					b.WriteRune(rune(n))
+				} else {
+					units = append(units, uint16(n))
+				}
+			}
+			b.WriteString(string(utf16.Decode(units)))
+			i += 4 + end + 4
+		case strings.HasPrefix(rest, "\\X\\") && len(rest) >= 5:
+			if n, err := strconv.ParseUint(rest[3:5], 16, 8); err == nil {
+				b.WriteRune(rune(n))
+				i += 5
+			} else {
+				b.WriteByte('\\')
+				i++
+			}
+		case strings.HasPrefix(rest, "\\S\\") && len(rest) >= 4:
+			b.WriteRune(rune(rest[3]) + 128)
+			i += 4
+		case strings.HasPrefix(rest, "\\P") && len(rest) >= 4 && rest[3] == '\\':
+			// Code page switches only affect \S\, which is decoded as Latin-1
+			i += 4
+		default:
+			b.WriteByte(s[i])
+			i++
+		}
+	}
+	return b.String()
+}
+
+// isAlnum reports whether a byte is an ASCII letter or digit
+func isAlnum(c byte) bool {
+	return c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9'
+}
@@ -0,0 +1,59 @@
+package ifc
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadRecords(t *testing.T) {
+	file := `ISO-10303-21;
+HEADER;
+FILE_DESCRIPTION(('ViewDefinition [CoordinationView]'),'2;1');
+FILE_NAME('a;b.ifc','2026-05-01T08:00:00',(''),(''),'','','');
+ENDSEC;
+DATA;
+/* A comment; with a semicolon */
+#1=IFCSPACE('2Hk$x',#2,'101','It''s \X2\00E400DF\X0\ \X\E9',$,
+  #3,$,'Meeting; room',.ELEMENT.,.INTERNAL.,-1.5E2);
+#2 = IFCPROPERTYSINGLEVALUE('Area',$,IFCAREAMEASURE(42.5),$);
+#3=(IFCA()IFCB());
+ENDSEC;
+END-ISO-10303-21;
+`
+	records, err := ReadRecords(strings.NewReader(file))
+	if err != nil {
+		t.Fatalf("Failed to read records: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("Expected 3 records, got %d", len(records))
+	}
+
+	space := records[1]
+	expected := []interface{}{"2Hk$x", Ref(2), "101", "It's äß é", nil, Ref(3), nil, "Meeting; room", Enum("ELEMENT"), Enum("INTERNAL"), -150.0}
+	if space.Type != "IFCSPACE" || !reflect.DeepEqual(space.Args, expected) {
+		t.Errorf("Unexpected record %+v", space)
+	}
+	if got := records[2].Arg(2); got != (Typed{Type: "IFCAREAMEASURE", Value: 42.5}) {
+		t.Errorf("Expected a typed area, got %#v", got)
+	}
+	if records[3].Type != "" {
+		t.Errorf("Expected complex instances to have no type, got %q", records[3].Type)
+	}
+	if space.Arg(20) != nil || space.String(1) != "" {
+		t.Error("Expected missing and non-string arguments to be empty")
+	}
+
+	for _, invalid := range []string{
+		"",
+		"DATA;\n#1=IFCSPACE('unterminated);\nENDSEC;",
+		"DATA;\n#1=IFCSPACE(#);\nENDSEC;",
+		"DATA;\n#x=IFCSPACE();\nENDSEC;",
+		"DATA;\n#1=IFCSPACE((1,2);\nENDSEC;",
+	} {
+		if _, err := ReadRecords(strings.NewReader(invalid)); !errors.Is(err, ErrInvalidFile) {
+			t.Errorf("Expected ErrInvalidFile for %q, got %v", invalid, err)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package impact
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// Common errors
+var (
+	ErrInvalidDepth = errors.New("invalid depth")
+)
+
+// MaxDepth is the deepest chain of dependent twins followed
+const MaxDepth = 10
+
+// Kind is the kind of an affected item
+type Kind string
+
+// Item kinds
+const (
+	KindTwin         Kind = "twin"
+	KindRule         Kind = "rule"
+	KindComputed     Kind = "computed"
+	KindView         Kind = "view"
+	KindSubscription Kind = "subscription"
+	KindWebhook      Kind = "webhook"
+	KindShare        Kind = "share"
+)
+
+// Item is something affected by a change or the deletion of a twin
+type Item struct {
+	Kind   Kind   `json:"kind"`
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+	Depth  int    `json:"depth,omitempty"` // Distance of dependent twins
+}
+
+// Report lists everything affected by a twin, sorted by kind and ID
+type Report struct {
+	TwinID string `json:"twinId"`
+	Items  []Item `json:"items"`
+}
+
+// Source reports the items of a subsystem that depend on a twin
+type Source interface {
+	Impact(dt *twin.DigitalTwin) []Item
+}
+
+// SourceFunc adapts a function to the Source interface
+type SourceFunc func(dt *twin.DigitalTwin) []Item
+
+// Impact calls f(dt)
+func (f SourceFunc) Impact(dt *twin.DigitalTwin) []Item {
+	return f(dt)
+}
+
+// Analyzer computes the impact of changing or deleting a twin. Twins are
+// affected if they have relationships to it, directly or through other
+// dependent twins; other items are reported by the sources.
+type Analyzer struct {
+	registry *registry.Registry
+	sources  map[string]Source
+	mutex    sync.RWMutex
+}
+
+// NewAnalyzer creates a new impact analyzer without sources
+func NewAnalyzer(reg *registry.Registry) *Analyzer {
+	return &Analyzer{
+		registry: reg,
+		sources:  make(map[string]Source),
+	}
+}
+
+// AddSource registers a source under a name, replacing any source of that name
+func (a *Analyzer) AddSource(name string, s Source) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.sources[name] = s
+}
+
+// Analyze reports the items affected by a twin. Dependent twins are
+// followed up to depth relationships away, MaxDepth if depth is 0.
+func (a *Analyzer) Analyze(twinID string, depth int) (*Report, error) {
+	if depth == 0 {
+		depth = MaxDepth
+	}
+	if depth < 0 || depth > MaxDepth {
+		return nil, fmt.Errorf("%w: depth must be between 1 and %d", ErrInvalidDepth, MaxDepth)
+	}
+
+	dt, err := a.registry.Get(twinID)
+	if err != nil {
+		return nil, err
+	}
+
+	items := a.dependents(twinID, depth)
+
+	a.mutex.RLock()
+	for _, s := range a.sources {
+		items = append(items, s.Impact(dt)...)
+	}
+	a.mutex.RUnlock()
+
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Kind != items[j].Kind {
+			return items[i].Kind < items[j].Kind
+		}
+		return items[i].ID < items[j].ID
+	})
+
+	return &Report{TwinID: twinID, Items: items}, nil
+}
+
+// dependents returns the twins with relationship chains to a twin
+func (a *Analyzer) dependents(twinID string, depth int) []Item {
+	// Reverse index: target -> source -> relationship names
+	incoming := make(map[string]map[string][]string)
+	for _, dt := range a.registry.List() {
+		for name, targets := range dt.GetAllRelationships() {
+			for _, target := range targets {
+				if incoming[target] == nil {
+					incoming[target] = make(map[string][]string)
+				}
+				incoming[target][dt.ID] = append(incoming[target][dt.ID], name)
+			}
+		}
+	}
+
+	items := make([]Item, 0)
+	visited := map[string]bool{twinID: true}
+	frontier := []string{twinID}
+
+	for d := 1; d <= depth && len(frontier) > 0; d++ {
+		var next []string
+		for _, target := range frontier {
+			for source, names := range incoming[target] {
+				if visited[source] {
+					continue
+				}
+				visited[source] = true
+				next = append(next, source)
+
+				sort.Strings(names)
+				items = append(items, Item{
+					Kind:   KindTwin,
+					ID:     source,
+					Reason: fmt.Sprintf("relationship %s to %s", strings.Join(names, ", "), target),
+					Depth:  d,
+				})
+			}
+		}
+		frontier = next
+	}
+	return items
+}
@@ -0,0 +1,74 @@
+package impact
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestAnalyze(t *testing.T) {
+	reg := registry.NewRegistry()
+
+	add := func(id string, rels map[string][]string) {
+		dt := twin.NewDigitalTwin(id, "equipment")
+		for name, targets := range rels {
+			dt.SetRelationship(name, targets)
+		}
+		reg.Create(dt)
+	}
+
+	// pump <- valve <- controller <- dashboard, plus a cycle back to valve
+	add("pump", map[string][]string{"feeds": {"valve"}})
+	add("valve", map[string][]string{"connectedTo": {"pump"}})
+	add("controller", map[string][]string{"controls": {"valve"}})
+	add("dashboard", map[string][]string{"shows": {"controller"}})
+	add("unrelated", nil)
+
+	a := NewAnalyzer(reg)
+	a.AddSource("views", SourceFunc(func(dt *twin.DigitalTwin) []Item {
+		return []Item{{Kind: KindView, ID: "equipment", Reason: "twin matches the view query"}}
+	}))
+
+	report, err := a.Analyze("valve", 0)
+	if err != nil {
+		t.Fatalf("Failed to analyze impact: %v", err)
+	}
+
+	depths := make(map[string]int)
+	for _, item := range report.Items {
+		if item.Kind == KindTwin {
+			depths[item.ID] = item.Depth
+		}
+	}
+
+	expected := map[string]int{"pump": 1, "controller": 1, "dashboard": 2}
+	if len(depths) != len(expected) {
+		t.Errorf("Expected dependents %v, got %v", expected, depths)
+	}
+	for id, depth := range expected {
+		if depths[id] != depth {
+			t.Errorf("Expected %s at depth %d, got %d", id, depth, depths[id])
+		}
+	}
+
+	if last := report.Items[len(report.Items)-1]; last.Kind != KindView || last.ID != "equipment" {
+		t.Errorf("Expected view item from source, got %+v", last)
+	}
+
+	// The depth limits the dependents followed
+	report, _ = a.Analyze("valve", 1)
+	for _, item := range report.Items {
+		if item.ID == "dashboard" {
+			t.Error("Expected dashboard to be beyond depth 1")
+		}
+	}
+
+	if _, err := a.Analyze("valve", MaxDepth+1); !errors.Is(err, ErrInvalidDepth) {
+		t.Errorf("Expected ErrInvalidDepth, got %v", err)
+	}
+	if _, err := a.Analyze("missing", 0); err != registry.ErrTwinNotFound {
+		t.Errorf("Expected ErrTwinNotFound, got %v", err)
+	}
+}
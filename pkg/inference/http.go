@@ -0,0 +1,71 @@
+package inference
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// maxResponseBody bounds the predictions read from an endpoint
+const maxResponseBody = 1 << 20
+
+// httpPredictor posts the input of a model as JSON to an endpoint, which
+// responds with a JSON object of predictions, e.g.
+//
+//	{"failureProbability": 0.12, "remainingUsefulLife": 340}
+type httpPredictor struct {
+	url    string
+	client *http.Client
+}
+
+// newHTTP creates the predictor of an HTTP model
+func newHTTP(m Model) (Predictor, error) {
+	u, err := url.Parse(m.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errors.New("url must be an absolute http or https URL")
+	}
+	return &httpPredictor{url: m.URL, client: &http.Client{}}, nil
+}
+
+// Predict implements Predictor
+func (p *httpPredictor) Predict(ctx context.Context, in Input) (map[string]interface{}, error) {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	detail, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		if msg := strings.TrimSpace(string(detail)); msg != "" {
+			return nil, fmt.Errorf("%s: %s", resp.Status, msg)
+		}
+		return nil, errors.New(resp.Status)
+	}
+
+	var predictions map[string]interface{}
+	if err := json.Unmarshal(detail, &predictions); err != nil {
+		return nil, fmt.Errorf("invalid predictions: %v", err)
+	}
+	return predictions, nil
+}
@@ -0,0 +1,44 @@
+package inference
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPPredictor(t *testing.T) {
+	var received Input
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+		if received.TwinID == "broken" {
+			http.Error(w, "model not loaded", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"failureProbability": 0.12}`))
+	}))
+	defer endpoint.Close()
+
+	p, err := newHTTP(Model{URL: endpoint.URL})
+	if err != nil {
+		t.Fatalf("Failed to create predictor: %v", err)
+	}
+
+	in := Input{TwinID: "pump-1", Features: map[string]map[string]interface{}{"status": {"vibration": 4.2}}}
+	predictions, err := p.Predict(context.Background(), in)
+	if err != nil || predictions["failureProbability"] != 0.12 {
+		t.Errorf("Unexpected predictions %v (%v)", predictions, err)
+	}
+	if received.Features["status"]["vibration"] != 4.2 {
+		t.Errorf("Expected the properties to be posted, got %+v", received)
+	}
+
+	if _, err := p.Predict(context.Background(), Input{TwinID: "broken"}); err == nil || err.Error() != "503 Service Unavailable: model not loaded" {
+		t.Errorf("Expected the endpoint error, got %v", err)
+	}
+
+	if _, err := newHTTP(Model{URL: "ftp://models"}); err == nil {
+		t.Error("Expected an error for a non-HTTP URL")
+	}
+}
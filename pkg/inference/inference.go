@@ -0,0 +1,446 @@
+package inference
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/clock"
+	"github.com/aleka07/go-digital-twin/pkg/eventbus"
+	"github.com/aleka07/go-digital-twin/pkg/history"
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// Common errors
+var (
+	ErrModelNotFound      = errors.New("model not found")
+	ErrModelAlreadyExists = errors.New("model already exists")
+	ErrInvalidModel       = errors.New("invalid model")
+	ErrNotApplicable      = errors.New("model does not apply to twin")
+)
+
+// Kind selects the runtime that invokes a model
+type Kind string
+
+// Model kinds. Only HTTP endpoints are built in; gRPC endpoints and ONNX
+// models are invoked by runtimes registered with Register or RegisterKind,
+// so the server does not depend on gRPC or an ONNX runtime.
+const (
+	KindHTTP Kind = "http"
+	KindGRPC Kind = "grpc"
+	KindONNX Kind = "onnx"
+)
+
+// DefaultFeature is the feature predictions are written to
+const DefaultFeature = "predictions"
+
+// DefaultTimeout bounds a single invocation
+const DefaultTimeout = 5 * time.Second
+
+// scheduleTick is how often scheduled models are checked for being due
+const scheduleTick = time.Second
+
+// Model configures an inference endpoint or model file and when it is invoked
+type Model struct {
+	Name     string   `json:"name"`
+	Kind     Kind     `json:"kind"`
+	URL      string   `json:"url,omitempty"`      // Endpoint of HTTP and gRPC models
+	Path     string   `json:"path,omitempty"`     // File of ONNX models
+	Type     string   `json:"type,omitempty"`     // Only applies to twins of this type when set
+	Features []string `json:"features,omitempty"` // Features passed to the model, all but the prediction feature when empty
+	Feature  string   `json:"feature,omitempty"`  // Feature predictions are written to, DefaultFeature when empty
+	OnChange bool     `json:"onChange,omitempty"` // Invoke when a passed feature changes
+	Interval string   `json:"interval,omitempty"` // Invoke for all matching twins at this interval when set
+	Timeout  string   `json:"timeout,omitempty"`  // Bound of a single invocation, DefaultTimeout when empty
+
+	interval time.Duration
+	timeout  time.Duration
+}
+
+// Input is what a model is invoked with: the latest properties of a twin
+type Input struct {
+	TwinID     string                            `json:"twinId"`
+	Type       string                            `json:"type"`
+	Attributes map[string]interface{}            `json:"attributes,omitempty"`
+	Features   map[string]map[string]interface{} `json:"features"` // Feature ID -> property values
+	Timestamp  time.Time                         `json:"timestamp"`
+}
+
+// Predictor invokes a model. The returned predictions become properties of
+// the prediction feature of the twin.
+type Predictor interface {
+	Predict(ctx context.Context, in Input) (map[string]interface{}, error)
+}
+
+// Factory creates the predictor of a model, validating its settings
+type Factory func(m Model) (Predictor, error)
+
+// Compile-time registration of runtimes, in the style of database/sql drivers
+var (
+	runtimes   = map[Kind]Factory{}
+	runtimesMu sync.Mutex
+)
+
+// Register makes a runtime available to all managers created afterwards.
+// It is meant to be called from the init function of the package
+// implementing the runtime, e.g. a gRPC client or an ONNX runtime binding.
+func Register(kind Kind, f Factory) {
+	runtimesMu.Lock()
+	defer runtimesMu.Unlock()
+
+	runtimes[kind] = f
+}
+
+// Status reports the invocations of a model
+type Status struct {
+	Invocations int        `json:"invocations"`
+	Failed      int        `json:"failed"`
+	LastInvoked *time.Time `json:"lastInvoked,omitempty"`
+	LastError   string     `json:"lastError,omitempty"`
+}
+
+// model is a registered model with its predictor and invocation state
+type model struct {
+	Model
+	predictor Predictor
+	status    Status
+	lastRun   time.Time // Last scheduled run
+}
+
+// Manager invokes models with the properties of twins and writes their
+// predictions back to the twins
+type Manager struct {
+	registry  *registry.Registry
+	pubsub    eventbus.Publisher
+	history   *history.Store
+	factories map[Kind]Factory
+	models    map[string]*model
+	mutex     sync.RWMutex
+	clock     clock.Clock
+}
+
+// NewManager creates a manager with the built-in HTTP runtime and the
+// runtimes registered at compile time
+func NewManager(reg *registry.Registry, pubsub eventbus.Publisher, hist *history.Store) *Manager {
+	m := &Manager{
+		registry:  reg,
+		pubsub:    pubsub,
+		history:   hist,
+		factories: make(map[Kind]Factory),
+		models:    make(map[string]*model),
+		clock:     clock.System,
+	}
+	m.RegisterKind(KindHTTP, newHTTP)
+
+	runtimesMu.Lock()
+	for kind, f := range runtimes {
+		m.factories[kind] = f
+	}
+	runtimesMu.Unlock()
+	return m
+}
+
+// SetClock sets the clock that schedules run on and predictions are
+// timestamped with; nil restores the system clock. It must be called before
+// models are invoked.
+func (m *Manager) SetClock(c clock.Clock) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.clock = clock.OrSystem(c)
+}
+
+// RegisterKind adds or replaces the runtime of a model kind
+func (m *Manager) RegisterKind(kind Kind, f Factory) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.factories[kind] = f
+}
+
+// Create registers a new model
+func (m *Manager) Create(md Model) error {
+	if md.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidModel)
+	}
+	if md.Feature == "" {
+		md.Feature = DefaultFeature
+	}
+	for _, f := range md.Features {
+		if f == md.Feature {
+			return fmt.Errorf("%w: the prediction feature %q cannot be passed to the model", ErrInvalidModel, f)
+		}
+	}
+	if md.Interval != "" {
+		interval, err := time.ParseDuration(md.Interval)
+		if err != nil || interval <= 0 {
+			return fmt.Errorf("%w: invalid interval %q", ErrInvalidModel, md.Interval)
+		}
+		md.interval = interval
+		md.Interval = interval.String()
+	}
+	if !md.OnChange && md.interval == 0 {
+		return fmt.Errorf("%w: onChange or interval is required", ErrInvalidModel)
+	}
+	md.timeout = DefaultTimeout
+	if md.Timeout != "" {
+		timeout, err := time.ParseDuration(md.Timeout)
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("%w: invalid timeout %q", ErrInvalidModel, md.Timeout)
+		}
+		md.timeout = timeout
+		md.Timeout = timeout.String()
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, exists := m.models[md.Name]; exists {
+		return ErrModelAlreadyExists
+	}
+	factory, exists := m.factories[md.Kind]
+	if !exists {
+		return fmt.Errorf("%w: no runtime for kind %q is available", ErrInvalidModel, md.Kind)
+	}
+	predictor, err := factory(md)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidModel, err)
+	}
+
+	m.models[md.Name] = &model{Model: md, predictor: predictor, lastRun: m.clock.Now()}
+	return nil
+}
+
+// Delete removes a model. Predictions already written are kept.
+func (m *Manager) Delete(name string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, exists := m.models[name]; !exists {
+		return ErrModelNotFound
+	}
+	delete(m.models, name)
+	return nil
+}
+
+// Get returns a model and its status
+func (m *Manager) Get(name string) (Model, Status, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	md, exists := m.models[name]
+	if !exists {
+		return Model{}, Status{}, ErrModelNotFound
+	}
+	return md.Model, md.status, nil
+}
+
+// List returns all models sorted by name
+func (m *Manager) List() []Model {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	result := make([]Model, 0, len(m.models))
+	for _, md := range m.models {
+		result = append(result, md.Model)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// Predict invokes a model for a twin and writes its predictions to the twin
+func (m *Manager) Predict(ctx context.Context, name, twinID string) (map[string]interface{}, error) {
+	m.mutex.RLock()
+	md, exists := m.models[name]
+	m.mutex.RUnlock()
+	if !exists {
+		return nil, ErrModelNotFound
+	}
+
+	dt, err := m.registry.Get(twinID)
+	if err != nil {
+		return nil, err
+	}
+	if md.Type != "" && dt.Type != md.Type {
+		return nil, ErrNotApplicable
+	}
+	return m.invoke(ctx, md, dt)
+}
+
+// invoke calls the predictor of a model with the latest properties of a twin,
+// stores the predictions and updates the status of the model
+func (m *Manager) invoke(ctx context.Context, md *model, dt *twin.DigitalTwin) (map[string]interface{}, error) {
+	now := m.clock.Now()
+	ctx, cancel := context.WithTimeout(ctx, md.timeout)
+	defer cancel()
+
+	predictions, err := md.predictor.Predict(ctx, input(md.Model, dt, now))
+
+	m.mutex.Lock()
+	md.status.Invocations++
+	md.status.LastInvoked = &now
+	if err != nil {
+		md.status.Failed++
+		md.status.LastError = err.Error()
+	}
+	m.mutex.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+	if len(predictions) == 0 {
+		return predictions, nil
+	}
+
+	feature, exists := dt.GetFeature(md.Feature)
+	if !exists {
+		feature = twin.NewFeatureStateWithClock(dt.Clock())
+		if err := dt.AddFeature(md.Feature, feature); err == twin.ErrFeatureAlreadyExists {
+			feature, _ = dt.GetFeature(md.Feature)
+		}
+	}
+	for key, value := range predictions {
+		feature.SetPropertyAt(key, value, now)
+		m.history.Record(dt.ID, md.Feature, key, value, now)
+	}
+	m.registry.Update(dt)
+
+	m.pubsub.Publish("properties.updated", map[string]interface{}{
+		"twinId":     dt.ID,
+		"featureId":  md.Feature,
+		"properties": predictions,
+		"model":      md.Name,
+	})
+	return predictions, nil
+}
+
+// input collects the properties of a twin passed to a model
+func input(md Model, dt *twin.DigitalTwin, now time.Time) Input {
+	in := Input{
+		TwinID:     dt.ID,
+		Type:       dt.Type,
+		Attributes: dt.GetAllAttributes(),
+		Features:   make(map[string]map[string]interface{}),
+		Timestamp:  now,
+	}
+	for featureID, feature := range dt.GetAllFeatures() {
+		if passes(md, featureID) {
+			in.Features[featureID] = feature.GetAllProperties()
+		}
+	}
+	return in
+}
+
+// passes reports whether a feature is passed to a model
+func passes(md Model, featureID string) bool {
+	if featureID == md.Feature {
+		return false
+	}
+	if len(md.Features) == 0 {
+		return true
+	}
+	for _, f := range md.Features {
+		if f == featureID {
+			return true
+		}
+	}
+	return false
+}
+
+// HandleEvent invokes the on-change models of a twin whose passed features
+// changed. Changes of prediction features never trigger a model, so models
+// cannot trigger each other endlessly.
+func (m *Manager) HandleEvent(msg messaging_sim.Message) {
+	if msg.Topic != "properties.updated" && msg.Topic != "property.updated" {
+		return
+	}
+	twinID := eventbus.PayloadField(msg.Payload, "twinId")
+	featureID := eventbus.PayloadField(msg.Payload, "featureId")
+	if twinID == "" {
+		return
+	}
+
+	m.mutex.RLock()
+	var targets []*model
+	for _, md := range m.models {
+		if md.Feature == featureID {
+			// A prediction feature of any model
+			m.mutex.RUnlock()
+			return
+		}
+		if md.OnChange && passes(md.Model, featureID) {
+			targets = append(targets, md)
+		}
+	}
+	m.mutex.RUnlock()
+
+	if len(targets) == 0 {
+		return
+	}
+	dt, err := m.registry.Get(twinID)
+	if err != nil {
+		return
+	}
+	for _, md := range targets {
+		if md.Type == "" || dt.Type == md.Type {
+			m.invoke(context.Background(), md, dt)
+		}
+	}
+}
+
+// Run invokes on-change models for events from a subscription until the channel is closed
+func (m *Manager) Run(events <-chan messaging_sim.Message) {
+	for msg := range events {
+		m.HandleEvent(msg)
+	}
+}
+
+// RunSchedule invokes scheduled models for all matching twins whenever their
+// interval has elapsed, until the context is cancelled
+func (m *Manager) RunSchedule(ctx context.Context) {
+	ticker := m.clock.NewTicker(scheduleTick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			m.runDue(ctx)
+		}
+	}
+}
+
+// runDue invokes the scheduled models whose interval has elapsed
+func (m *Manager) runDue(ctx context.Context) {
+	m.mutex.Lock()
+	now := m.clock.Now()
+	var due []*model
+	for _, md := range m.models {
+		if md.interval > 0 && now.Sub(md.lastRun) >= md.interval {
+			md.lastRun = now
+			due = append(due, md)
+		}
+	}
+	m.mutex.Unlock()
+
+	if len(due) == 0 {
+		return
+	}
+	for _, dt := range m.registry.List() {
+		if dt.GetLifecycle() == twin.LifecycleDecommissioned {
+			continue
+		}
+		for _, md := range due {
+			if md.Type == "" || dt.Type == md.Type {
+				m.invoke(ctx, md, dt)
+			}
+		}
+	}
+}
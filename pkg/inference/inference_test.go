@@ -0,0 +1,198 @@
+package inference
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/clock"
+	"github.com/aleka07/go-digital-twin/pkg/history"
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// wear is a test runtime predicting wear from the running hours of a pump
+type wear struct {
+	calls  int
+	inputs []Input
+}
+
+func (w *wear) Predict(ctx context.Context, in Input) (map[string]interface{}, error) {
+	w.calls++
+	w.inputs = append(w.inputs, in)
+	hours, _ := in.Features["status"]["hours"].(float64)
+	return map[string]interface{}{"wear": hours / 1000}, nil
+}
+
+func newTestManager(t *testing.T) (*Manager, *wear) {
+	reg := registry.NewRegistry()
+	for id, twinType := range map[string]string{"pump-1": "pump", "fan-1": "fan"} {
+		dt := twin.NewDigitalTwin(id, twinType)
+		status := twin.NewFeatureState()
+		status.SetProperty("hours", 500.0)
+		dt.AddFeature("status", status)
+		reg.Create(dt)
+	}
+
+	w := &wear{}
+	m := NewManager(reg, messaging_sim.NewPubSub(), history.NewStore(10))
+	m.RegisterKind("wear", func(Model) (Predictor, error) { return w, nil })
+	return m, w
+}
+
+func TestCreateAndList(t *testing.T) {
+	m, _ := newTestManager(t)
+
+	invalid := []Model{
+		{Kind: "wear", OnChange: true},
+		{Name: "rul", Kind: "wear"},
+		{Name: "rul", Kind: "wear", Interval: "soon"},
+		{Name: "rul", Kind: "wear", OnChange: true, Features: []string{"predictions"}},
+		{Name: "rul", Kind: KindONNX, Path: "rul.onnx", OnChange: true},
+		{Name: "rul", Kind: KindHTTP, URL: "not a url", OnChange: true},
+	}
+	for _, md := range invalid {
+		if err := m.Create(md); !errors.Is(err, ErrInvalidModel) {
+			t.Errorf("Expected ErrInvalidModel for %+v, got %v", md, err)
+		}
+	}
+
+	if err := m.Create(Model{Name: "rul", Kind: "wear", Interval: "3600s"}); err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+	if err := m.Create(Model{Name: "rul", Kind: "wear", OnChange: true}); err != ErrModelAlreadyExists {
+		t.Errorf("Expected ErrModelAlreadyExists, got %v", err)
+	}
+
+	md, _, err := m.Get("rul")
+	if err != nil || md.Interval != "1h0m0s" || md.Feature != DefaultFeature {
+		t.Errorf("Expected defaults and canonical durations, got %+v (%v)", md, err)
+	}
+
+	m.Create(Model{Name: "anomaly", Kind: "wear", OnChange: true})
+	if list := m.List(); len(list) != 2 || list[0].Name != "anomaly" {
+		t.Errorf("Expected 2 models sorted by name, got %+v", list)
+	}
+
+	if err := m.Delete("anomaly"); err != nil {
+		t.Errorf("Failed to delete model: %v", err)
+	}
+	if _, _, err := m.Get("anomaly"); err != ErrModelNotFound {
+		t.Errorf("Expected ErrModelNotFound, got %v", err)
+	}
+}
+
+func TestPredict(t *testing.T) {
+	m, w := newTestManager(t)
+	m.Create(Model{Name: "wear", Kind: "wear", Type: "pump", OnChange: true})
+
+	predictions, err := m.Predict(context.Background(), "wear", "pump-1")
+	if err != nil || predictions["wear"] != 0.5 {
+		t.Fatalf("Unexpected predictions %v (%v)", predictions, err)
+	}
+
+	dt, _ := m.registry.Get("pump-1")
+	feature, exists := dt.GetFeature(DefaultFeature)
+	if !exists {
+		t.Fatal("Expected the predictions feature")
+	}
+	if value, _ := feature.GetProperty("wear"); value != 0.5 {
+		t.Errorf("Expected the prediction to be stored, got %v", value)
+	}
+	if samples := m.history.Query("pump-1", DefaultFeature, "wear", time.Time{}, time.Now().Add(time.Second)); len(samples) != 1 {
+		t.Errorf("Expected 1 history sample, got %d", len(samples))
+	}
+
+	// Predictions are not passed back to the model
+	m.Predict(context.Background(), "wear", "pump-1")
+	if _, exists := w.inputs[1].Features[DefaultFeature]; exists {
+		t.Error("Expected the predictions feature not to be passed to the model")
+	}
+
+	if _, err := m.Predict(context.Background(), "wear", "fan-1"); err != ErrNotApplicable {
+		t.Errorf("Expected ErrNotApplicable, got %v", err)
+	}
+	if _, err := m.Predict(context.Background(), "wear", "pump-9"); err != registry.ErrTwinNotFound {
+		t.Errorf("Expected ErrTwinNotFound, got %v", err)
+	}
+
+	_, status, _ := m.Get("wear")
+	if status.Invocations != 2 || status.Failed != 0 || status.LastInvoked == nil {
+		t.Errorf("Unexpected status %+v", status)
+	}
+}
+
+func TestHandleEvent(t *testing.T) {
+	m, w := newTestManager(t)
+	m.Create(Model{Name: "wear", Kind: "wear", Features: []string{"status"}, OnChange: true})
+
+	m.HandleEvent(messaging_sim.Message{Topic: "properties.updated", Payload: map[string]interface{}{
+		"twinId": "pump-1", "featureId": "status", "properties": map[string]interface{}{"hours": 500.0},
+	}})
+	// Changes of features not passed to the model and of predictions are ignored
+	m.HandleEvent(messaging_sim.Message{Topic: "property.updated", Payload: map[string]interface{}{
+		"twinId": "pump-1", "featureId": "location", "propertyKey": "room", "value": "B2",
+	}})
+	m.HandleEvent(messaging_sim.Message{Topic: "properties.updated", Payload: map[string]interface{}{
+		"twinId": "pump-1", "featureId": DefaultFeature, "properties": map[string]interface{}{"wear": 0.5},
+	}})
+
+	if w.calls != 1 {
+		t.Errorf("Expected 1 invocation, got %d", w.calls)
+	}
+}
+
+func TestRunDue(t *testing.T) {
+	m, w := newTestManager(t)
+	fake := clock.NewFake(time.Now())
+	m.SetClock(fake)
+	m.Create(Model{Name: "wear", Kind: "wear", Interval: "1m"})
+
+	m.runDue(context.Background())
+	if w.calls != 0 {
+		t.Fatalf("Expected no invocations before the interval, got %d", w.calls)
+	}
+
+	fake.Advance(time.Minute)
+	m.runDue(context.Background())
+	if w.calls != 2 {
+		t.Errorf("Expected both twins to be predicted, got %d invocations", w.calls)
+	}
+
+	m.runDue(context.Background())
+	if w.calls != 2 {
+		t.Errorf("Expected no invocations until the next interval, got %d", w.calls)
+	}
+}
+
+func TestRunSchedule(t *testing.T) {
+	m, _ := newTestManager(t)
+	fake := clock.NewFake(time.Now())
+	m.SetClock(fake)
+	m.Create(Model{Name: "wear", Kind: "wear", Interval: "1m"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.RunSchedule(ctx)
+	for fake.Tickers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	fake.Advance(time.Minute)
+	deadline := time.Now().Add(time.Second)
+	for {
+		_, status, _ := m.Get("wear")
+		if status.Invocations == 2 {
+			if !status.LastInvoked.Equal(fake.Now()) {
+				t.Errorf("Expected predictions at %v, got %v", fake.Now(), status.LastInvoked)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the schedule to predict both twins, got %d invocations", status.Invocations)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
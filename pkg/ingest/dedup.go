@@ -0,0 +1,160 @@
+package ingest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/clock"
+)
+
+// DefaultDedupWindow is how long message IDs are remembered unless configured otherwise
+const DefaultDedupWindow = 5 * time.Minute
+
+// Deduplicator remembers recently seen message keys per twin so that retried
+// deliveries are applied only once. Keys are expired in the order they were
+// seen, so a check costs the same however many keys are remembered.
+type Deduplicator struct {
+	window time.Duration
+	seen   map[string]map[string]seenKey // Twin ID -> message key -> when it was seen
+	order  []seenKey                     // Keys in the order they were seen
+	next   uint64                        // Generation of the next key seen
+	clock  clock.Clock
+	mutex  sync.Mutex
+}
+
+// seenKey is a message key remembered for a twin. Keys removed and seen
+// again get a new generation, so that the entries of the order left behind
+// by removed keys never expire them.
+type seenKey struct {
+	twinID     string
+	key        string
+	seenAt     time.Time
+	generation uint64
+}
+
+// NewDeduplicator creates a deduplicator that remembers keys for the given window.
+// A non-positive window disables deduplication.
+func NewDeduplicator(window time.Duration) *Deduplicator {
+	return &Deduplicator{
+		window: window,
+		seen:   make(map[string]map[string]seenKey),
+		clock:  clock.System,
+	}
+}
+
+// SetClock sets the clock the window is measured with; nil restores the
+// system clock
+func (d *Deduplicator) SetClock(c clock.Clock) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.clock = clock.OrSystem(c)
+}
+
+// Window returns the deduplication window
+func (d *Deduplicator) Window() time.Duration {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return d.window
+}
+
+// SetWindow changes the deduplication window
+func (d *Deduplicator) SetWindow(window time.Duration) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.window = window
+	if window <= 0 {
+		d.seen = make(map[string]map[string]seenKey)
+		d.order = nil
+	}
+}
+
+// Check records a message key for a twin and reports whether it was already
+// seen within the window. Empty keys are never considered duplicates. A
+// caller that fails to apply the message should Remove the key again, so
+// that a retry is not taken for a duplicate.
+func (d *Deduplicator) Check(twinID, key string) bool {
+	d.mutex.Lock()
+	now := d.clock.Now()
+	d.mutex.Unlock()
+
+	return d.checkAt(twinID, key, now)
+}
+
+// Forget drops all remembered keys of a twin
+func (d *Deduplicator) Forget(twinID string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	delete(d.seen, twinID)
+}
+
+// Remove forgets a single message key of a twin
+func (d *Deduplicator) Remove(twinID, key string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if keys, exists := d.seen[twinID]; exists {
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(d.seen, twinID)
+		}
+	}
+}
+
+// checkAt implements Check for a given point in time
+func (d *Deduplicator) checkAt(twinID, key string, now time.Time) bool {
+	if key == "" {
+		return false
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.window <= 0 {
+		return false
+	}
+
+	d.expire(now)
+
+	keys, exists := d.seen[twinID]
+	if !exists {
+		keys = make(map[string]seenKey)
+		d.seen[twinID] = keys
+	}
+
+	// A key may outlive the window while older keys before it in the order
+	// were seen at a later time, such as after the clock was set back
+	if seen, duplicate := keys[key]; duplicate && now.Sub(seen.seenAt) <= d.window {
+		return true
+	}
+
+	entry := seenKey{twinID: twinID, key: key, seenAt: now, generation: d.next}
+	d.next++
+	keys[key] = entry
+	d.order = append(d.order, entry)
+	return false
+}
+
+// expire drops the keys that fell out of the window, oldest first
+func (d *Deduplicator) expire(now time.Time) {
+	n := 0
+	for ; n < len(d.order); n++ {
+		entry := d.order[n]
+		if now.Sub(entry.seenAt) <= d.window {
+			break
+		}
+
+		// The key may have been removed, or seen again since
+		keys := d.seen[entry.twinID]
+		if seen, exists := keys[entry.key]; exists && seen.generation == entry.generation {
+			delete(keys, entry.key)
+			if len(keys) == 0 {
+				delete(d.seen, entry.twinID)
+			}
+		}
+	}
+	d.order = d.order[n:]
+}
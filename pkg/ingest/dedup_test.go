@@ -0,0 +1,109 @@
+package ingest
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDeduplicatorCheck(t *testing.T) {
+	d := NewDeduplicator(time.Minute)
+	now := time.Now()
+
+	if d.checkAt("twin-1", "id:a", now) {
+		t.Error("Expected first delivery not to be a duplicate")
+	}
+
+	if !d.checkAt("twin-1", "id:a", now.Add(10*time.Second)) {
+		t.Error("Expected retry within the window to be a duplicate")
+	}
+
+	// Keys are tracked per twin
+	if d.checkAt("twin-2", "id:a", now) {
+		t.Error("Expected the same key on another twin not to be a duplicate")
+	}
+
+	// Keys expire after the window
+	if d.checkAt("twin-1", "id:a", now.Add(2*time.Minute)) {
+		t.Error("Expected key to be forgotten after the window")
+	}
+
+	// Empty keys are never duplicates
+	if d.checkAt("twin-1", "", now) || d.checkAt("twin-1", "", now) {
+		t.Error("Expected empty keys not to be deduplicated")
+	}
+}
+
+func TestDeduplicatorWindow(t *testing.T) {
+	d := NewDeduplicator(0)
+
+	if d.Check("twin-1", "id:a") || d.Check("twin-1", "id:a") {
+		t.Error("Expected deduplication to be disabled with a zero window")
+	}
+
+	d.SetWindow(time.Minute)
+	if d.Window() != time.Minute {
+		t.Errorf("Expected window of 1m, got %v", d.Window())
+	}
+
+	d.Check("twin-1", "id:a")
+	if !d.Check("twin-1", "id:a") {
+		t.Error("Expected duplicate after enabling deduplication")
+	}
+
+	d.Forget("twin-1")
+	if d.Check("twin-1", "id:a") {
+		t.Error("Expected key to be forgotten")
+	}
+}
+
+func TestDeduplicatorRemove(t *testing.T) {
+	d := NewDeduplicator(time.Minute)
+	now := time.Now()
+
+	d.checkAt("twin-1", "id:a", now)
+	d.Remove("twin-1", "id:a")
+	if d.checkAt("twin-1", "id:a", now.Add(time.Second)) {
+		t.Error("Expected removed key not to be a duplicate")
+	}
+
+	// The key seen again outlives the expiry of its first sighting
+	if !d.checkAt("twin-1", "id:a", now.Add(time.Minute+500*time.Millisecond)) {
+		t.Error("Expected key seen again to be remembered for its own window")
+	}
+}
+
+func TestDeduplicatorForget(t *testing.T) {
+	d := NewDeduplicator(time.Minute)
+	now := time.Now()
+
+	d.checkAt("twin-1", "id:a", now)
+	d.Forget("twin-1")
+	if d.checkAt("twin-1", "id:a", now) {
+		t.Error("Expected forgotten key not to be a duplicate")
+	}
+	d.Forget("twin-1")
+	d.checkAt("twin-1", "id:a", now.Add(30*time.Second))
+
+	// The entries left by the forgotten keys do not expire the key seen again
+	if !d.checkAt("twin-1", "id:a", now.Add(time.Minute+time.Second)) {
+		t.Error("Expected key seen again to be remembered for its own window")
+	}
+	if len(d.order) != 1 {
+		t.Errorf("Expected the entries of forgotten keys to expire, got %d", len(d.order))
+	}
+}
+
+func TestDeduplicatorExpiry(t *testing.T) {
+	d := NewDeduplicator(time.Minute)
+	now := time.Now()
+
+	for i := 0; i < 100; i++ {
+		d.checkAt("twin-1", fmt.Sprintf("seq:%d", i), now)
+	}
+	d.checkAt("twin-2", "id:a", now.Add(2*time.Minute))
+
+	if len(d.order) != 1 || len(d.seen) != 1 || len(d.seen["twin-2"]) != 1 {
+		t.Errorf("Expected expired keys to be dropped, got %d in order and %v", len(d.order), d.seen)
+	}
+}
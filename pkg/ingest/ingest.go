@@ -0,0 +1,349 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/clock"
+	"github.com/aleka07/go-digital-twin/pkg/eventbus"
+	"github.com/aleka07/go-digital-twin/pkg/history"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/schema"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+	"github.com/aleka07/go-digital-twin/pkg/valuesize"
+)
+
+// Common errors
+var (
+	ErrEmptyTelemetry = errors.New("telemetry contains no properties")
+)
+
+// maxAttempts bounds the attempts to store a batch whose twin is written
+// concurrently
+const maxAttempts = 3
+
+// Telemetry is a batch of property values reported by a device for a single twin
+type Telemetry struct {
+	TwinID    string                            `json:"twinId,omitempty"`
+	MessageID string                            `json:"messageId,omitempty"` // Client-provided ID used for deduplication
+	Sequence  uint64                            `json:"sequence,omitempty"`  // Client-provided sequence number used when MessageID is empty
+	Timestamp time.Time                         `json:"timestamp,omitempty"` // Time the values were measured
+	Features  map[string]map[string]interface{} `json:"features"`            // Feature ID -> property key -> value
+}
+
+// DedupKey returns the key identifying the message for deduplication, or an
+// empty string if the client provided neither a message ID nor a sequence number
+func (t Telemetry) DedupKey() string {
+	if t.MessageID != "" {
+		return "id:" + t.MessageID
+	}
+	if t.Sequence > 0 {
+		return "seq:" + strconv.FormatUint(t.Sequence, 10)
+	}
+	return ""
+}
+
+// Result reports what happened to an ingested telemetry batch
+type Result struct {
+	TwinID    string `json:"twinId"`
+	Duplicate bool   `json:"duplicate"` // The batch was already applied and was ignored
+	Applied   int    `json:"applied"`   // Number of property values written
+	Late      int    `json:"late"`      // Number of out-of-order values only written to history
+	Dropped   int    `json:"dropped"`   // Number of out-of-order values discarded
+
+	TimestampCorrected bool `json:"timestampCorrected"` // The device timestamp was replaced by server time
+}
+
+// Ingester applies device telemetry to twins. It is the common entry point for
+// the HTTP ingestion endpoint and protocol bridges.
+type Ingester struct {
+	registry          registry.Twins
+	pubsub            eventbus.Publisher
+	history           *history.Store
+	dedup             *Deduplicator
+	defaultLatePolicy LatePolicy
+	latePolicies      map[string]LatePolicy
+	timestampPolicy   TimestampPolicy
+	maxSkew           time.Duration
+	transforms        []namedTransform
+	mirrors           []namedMirror
+	admission         *admission
+	valueSizes        *valuesize.Manager
+	schemas           *schema.Manager
+	clock             clock.Clock
+	mutex             sync.RWMutex
+}
+
+// NewIngester creates a new ingester using the default deduplication window, late and timestamp policies
+// and load limits
+func NewIngester(reg registry.Twins, pubsub eventbus.Publisher, hist *history.Store) *Ingester {
+	return &Ingester{
+		registry:          reg,
+		pubsub:            pubsub,
+		history:           hist,
+		dedup:             NewDeduplicator(DefaultDedupWindow),
+		defaultLatePolicy: DefaultLatePolicy,
+		latePolicies:      make(map[string]LatePolicy),
+		timestampPolicy:   DefaultTimestampPolicy,
+		maxSkew:           DefaultMaxSkew,
+		admission:         newAdmission(DefaultLoadLimits()),
+		clock:             clock.System,
+	}
+}
+
+// SetValueSizes sets the size limits of ingested property values. Values
+// exceeding their limit are rejected with valuesize.ErrTooLarge or offloaded.
+func (in *Ingester) SetValueSizes(m *valuesize.Manager) {
+	in.mutex.Lock()
+	defer in.mutex.Unlock()
+
+	in.valueSizes = m
+}
+
+// ValueSizes returns the size limits of ingested property values, if any
+func (in *Ingester) ValueSizes() *valuesize.Manager {
+	in.mutex.RLock()
+	defer in.mutex.RUnlock()
+
+	return in.valueSizes
+}
+
+// SetSchemas sets the schemas ingested twins are validated against. Batches
+// violating a Strict schema are rejected with schema.ErrViolation; the
+// violations of a Warn schema are recorded on the twin and published.
+func (in *Ingester) SetSchemas(m *schema.Manager) {
+	in.mutex.Lock()
+	defer in.mutex.Unlock()
+
+	in.schemas = m
+}
+
+// Schemas returns the schemas ingested twins are validated against, if any
+func (in *Ingester) Schemas() *schema.Manager {
+	in.mutex.RLock()
+	defer in.mutex.RUnlock()
+
+	return in.schemas
+}
+
+// SetClock sets the clock that server timestamps, and thereby the times
+// recorded in history, and the deduplication window are read from; nil
+// restores the system clock
+func (in *Ingester) SetClock(c clock.Clock) {
+	in.mutex.Lock()
+	in.clock = clock.OrSystem(c)
+	in.mutex.Unlock()
+
+	in.dedup.SetClock(c)
+}
+
+// Clock returns the clock of the ingester
+func (in *Ingester) Clock() clock.Clock {
+	in.mutex.RLock()
+	defer in.mutex.RUnlock()
+
+	return in.clock
+}
+
+// Deduplicator returns the deduplicator used to drop retried messages
+func (in *Ingester) Deduplicator() *Deduplicator {
+	return in.dedup
+}
+
+// Apply writes a telemetry batch to its twin after running it through the
+// transform chain. Features that do not exist yet are
+// created. Batches whose message ID or sequence number was already seen for the
+// twin within the deduplication window are ignored; batches that fail do not
+// count as seen and leave neither the twin, history nor events changed.
+// Values older than the
+// current value of their property are handled according to the property's
+// late policy. Values exceeding their size limit are rejected or offloaded;
+// see SetValueSizes. Twins are validated against their schema; see
+// SetSchemas. When the ingester or the event fan-out is overloaded, batches
+// are rejected with ErrOverloaded or ErrSaturated; see LoadLimits.
+func (in *Ingester) Apply(t Telemetry) (*Result, error) {
+	release, err := in.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	dt, err := in.registry.Get(t.TwinID)
+	if err != nil {
+		return nil, err
+	}
+
+	mirrors := in.mirrorList()
+	var raw Telemetry
+	if len(mirrors) > 0 {
+		raw = t.copy()
+	}
+
+	if err := in.transform(&t); err != nil {
+		return nil, err
+	}
+
+	result := &Result{TwinID: t.TwinID}
+
+	count := 0
+	for _, props := range t.Features {
+		count += len(props)
+	}
+	if count == 0 {
+		return nil, ErrEmptyTelemetry
+	}
+
+	// Oversized values are rejected before the batch counts as seen, so
+	// that a corrected retry is not taken for a duplicate
+	sizes := in.ValueSizes()
+	if sizes != nil {
+		for featureID, props := range t.Features {
+			if err := sizes.Check(featureID, props); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// The key is held while the batch is applied, so that a concurrent
+	// retry is dropped, and released if the batch fails
+	key := t.DedupKey()
+	if in.dedup.Check(t.TwinID, key) {
+		result.Duplicate = true
+		return result, nil
+	}
+
+	if sizes != nil {
+		for featureID, props := range t.Features {
+			if _, err := sizes.Offload(context.Background(), t.TwinID, featureID, props); err != nil {
+				in.dedup.Remove(t.TwinID, key)
+				return nil, err
+			}
+		}
+	}
+
+	// Stamp both clocks so that analytics can reconcile them later
+	policy, maxSkew := in.TimestampPolicy()
+	meta := twin.PropertyMetadata{
+		DeviceTimestamp: t.Timestamp,
+		ServerTimestamp: in.Clock().Now(),
+	}
+	meta.Timestamp, result.TimestampCorrected = ResolveTimestamp(policy, maxSkew, meta.DeviceTimestamp, meta.ServerTimestamp)
+
+	// The batch is staged on a copy of the twin, and recorded in history and
+	// published only once the copy is stored, so that a failed batch leaves
+	// nothing behind for its retry to repeat. A batch that conflicts with a
+	// concurrent write is staged again on the stored twin.
+	schemas := in.Schemas()
+	var b *batch
+	for attempt := 1; ; attempt++ {
+		if b, err = in.stage(dt.Clone(), t, meta); err == nil && schemas != nil {
+			b.warnings, err = schemas.Validate(b.twin)
+		}
+		if err == nil {
+			err = in.registry.Update(b.twin)
+		}
+		if errors.Is(err, registry.ErrRevisionConflict) && attempt < maxAttempts {
+			if dt, err = in.registry.Get(t.TwinID); err == nil {
+				continue
+			}
+		}
+		if err != nil {
+			in.dedup.Remove(t.TwinID, key)
+			return nil, err
+		}
+		break
+	}
+
+	for _, r := range b.records {
+		in.history.Record(t.TwinID, r.featureID, r.key, r.value, meta.Timestamp)
+	}
+	for _, e := range b.events {
+		in.pubsub.Publish("properties.updated", e)
+	}
+	if len(b.warnings) > 0 {
+		in.pubsub.Publish(schema.WarningTopic, schema.Warning(t.TwinID, b.warnings))
+	}
+	result.Applied, result.Late, result.Dropped = b.applied, b.late, b.dropped
+
+	for _, m := range mirrors {
+		m.mirror.Mirror(raw)
+	}
+	return result, nil
+}
+
+// batch is a telemetry batch staged on a copy of its twin, with the values
+// to record in history and the events to publish once the copy is stored
+type batch struct {
+	twin     *twin.DigitalTwin
+	records  []record
+	events   []eventbus.PropertiesUpdated
+	warnings []schema.Violation
+	applied  int
+	late     int
+	dropped  int
+}
+
+// record is a property value to record in history
+type record struct {
+	featureID string
+	key       string
+	value     interface{}
+}
+
+// stage applies the values of a batch to a copy of its twin according to
+// their late policies
+func (in *Ingester) stage(dt *twin.DigitalTwin, t Telemetry, meta twin.PropertyMetadata) (*batch, error) {
+	b := &batch{twin: dt}
+	for featureID, props := range t.Features {
+		if len(props) == 0 {
+			continue
+		}
+
+		feature, exists := dt.GetFeature(featureID)
+		if !exists {
+			feature = twin.NewFeatureStateWithClock(dt.Clock())
+			dt.AddFeature(featureID, feature)
+		}
+
+		applied := make(map[string]interface{}, len(props))
+		for k, v := range props {
+			policy := in.LatePolicy(featureID, k)
+
+			switch {
+			case policy == LateOverwrite:
+				feature.SetPropertyWithMetadata(k, v, meta)
+			case feature.SetPropertyIfNewer(k, v, meta):
+			case policy == LateHistoryOnly:
+				b.records = append(b.records, record{featureID, k, v})
+				b.late++
+				continue
+			default:
+				b.dropped++
+				continue
+			}
+
+			b.records = append(b.records, record{featureID, k, v})
+			applied[k] = v
+			b.applied++
+		}
+
+		if len(applied) == 0 {
+			continue
+		}
+
+		if err := dt.UpdateFeature(featureID, feature); err != nil {
+			return nil, err
+		}
+		b.events = append(b.events, eventbus.PropertiesUpdated{
+			TwinID:     t.TwinID,
+			FeatureID:  featureID,
+			Properties: applied,
+		})
+	}
+
+	dt.SetSystem(twin.SystemLastSeen, meta.ServerTimestamp.UTC().Format(time.RFC3339Nano))
+	return b, nil
+}
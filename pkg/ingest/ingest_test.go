@@ -0,0 +1,557 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/clock"
+	"github.com/aleka07/go-digital-twin/pkg/history"
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+	"github.com/aleka07/go-digital-twin/pkg/valuesize"
+)
+
+func setupIngester() (*Ingester, *registry.Registry) {
+	reg := registry.NewRegistry()
+	reg.Create(twin.NewDigitalTwin("device-1", "sensor"))
+	return NewIngester(reg, messaging_sim.NewPubSub(), history.NewStore(0)), reg
+}
+
+// property returns the stored value of a property of device-1
+func property(reg *registry.Registry, featureID, key string) interface{} {
+	dt, _ := reg.Get("device-1")
+	feature, exists := dt.GetFeature(featureID)
+	if !exists {
+		return nil
+	}
+	value, _ := feature.GetProperty(key)
+	return value
+}
+
+func TestTelemetryDedupKey(t *testing.T) {
+	if key := (Telemetry{MessageID: "m1", Sequence: 7}).DedupKey(); key != "id:m1" {
+		t.Errorf("Expected message ID to take precedence, got %s", key)
+	}
+
+	if key := (Telemetry{Sequence: 7}).DedupKey(); key != "seq:7" {
+		t.Errorf("Expected sequence key, got %s", key)
+	}
+
+	if key := (Telemetry{}).DedupKey(); key != "" {
+		t.Errorf("Expected empty key, got %s", key)
+	}
+}
+
+func TestIngesterApply(t *testing.T) {
+	in, reg := setupIngester()
+
+	result, err := in.Apply(Telemetry{
+		TwinID:    "device-1",
+		MessageID: "msg-1",
+		Features: map[string]map[string]interface{}{
+			"counter": {"count": 1.0},
+			"status":  {"state": "running", "mode": "auto"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to apply telemetry: %v", err)
+	}
+
+	if result.Duplicate || result.Applied != 3 {
+		t.Errorf("Expected 3 applied values, got %+v", result)
+	}
+
+	dt, _ := reg.Get("device-1")
+	feature, exists := dt.GetFeature("counter")
+	if !exists {
+		t.Fatal("Expected counter feature to be created")
+	}
+	if val, _ := feature.GetProperty("count"); val != 1.0 {
+		t.Errorf("Expected count 1, got %v", val)
+	}
+	if seen, _ := dt.GetSystem(twin.SystemLastSeen); seen == nil {
+		t.Error("Expected the twin to be marked as seen")
+	}
+
+	// A retry of the same message is ignored
+	result, err = in.Apply(Telemetry{
+		TwinID:    "device-1",
+		MessageID: "msg-1",
+		Features:  map[string]map[string]interface{}{"counter": {"count": 2.0}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to apply telemetry: %v", err)
+	}
+
+	if !result.Duplicate || result.Applied != 0 {
+		t.Errorf("Expected duplicate result, got %+v", result)
+	}
+
+	if val := property(reg, "counter", "count"); val != 1.0 {
+		t.Errorf("Expected count to remain 1 after duplicate, got %v", val)
+	}
+
+	// Sequence numbers deduplicate when no message ID is given
+	in.Apply(Telemetry{TwinID: "device-1", Sequence: 5, Features: map[string]map[string]interface{}{"counter": {"count": 3.0}}})
+	result, _ = in.Apply(Telemetry{TwinID: "device-1", Sequence: 5, Features: map[string]map[string]interface{}{"counter": {"count": 4.0}}})
+
+	if !result.Duplicate {
+		t.Error("Expected repeated sequence number to be a duplicate")
+	}
+
+	if val := property(reg, "counter", "count"); val != 3.0 {
+		t.Errorf("Expected count 3, got %v", val)
+	}
+}
+
+func TestIngesterApplyErrors(t *testing.T) {
+	in, _ := setupIngester()
+
+	_, err := in.Apply(Telemetry{TwinID: "unknown", Features: map[string]map[string]interface{}{"a": {"b": 1}}})
+	if err != registry.ErrTwinNotFound {
+		t.Errorf("Expected ErrTwinNotFound, got %v", err)
+	}
+
+	_, err = in.Apply(Telemetry{TwinID: "device-1", MessageID: "empty"})
+	if err != ErrEmptyTelemetry {
+		t.Errorf("Expected ErrEmptyTelemetry, got %v", err)
+	}
+
+	// A rejected batch does not consume its message ID
+	result, err := in.Apply(Telemetry{TwinID: "device-1", MessageID: "empty", Features: map[string]map[string]interface{}{"a": {"b": 1}}})
+	if err != nil || result.Duplicate {
+		t.Errorf("Expected batch to be applied after an empty attempt, got %+v, %v", result, err)
+	}
+}
+
+func TestIngesterLateTelemetry(t *testing.T) {
+	in, reg := setupIngester()
+	now := time.Now()
+
+	batch := func(ts time.Time, value float64) Telemetry {
+		return Telemetry{
+			TwinID:    "device-1",
+			Timestamp: ts,
+			Features: map[string]map[string]interface{}{
+				"temperature": {"value": value},
+			},
+		}
+	}
+
+	in.Apply(batch(now, 22.0))
+
+	// By default late values only go to history
+	result, err := in.Apply(batch(now.Add(-time.Minute), 18.0))
+	if err != nil {
+		t.Fatalf("Failed to apply telemetry: %v", err)
+	}
+
+	if result.Applied != 0 || result.Late != 1 {
+		t.Errorf("Expected one late value, got %+v", result)
+	}
+
+	dt, _ := reg.Get("device-1")
+	feature, _ := dt.GetFeature("temperature")
+	if val, _ := feature.GetProperty("value"); val != 22.0 {
+		t.Errorf("Expected current value to remain 22.0, got %v", val)
+	}
+
+	samples := in.history.Query("device-1", "temperature", "value", time.Time{}, time.Time{})
+	if len(samples) != 2 || samples[0].Value != 18.0 || samples[1].Value != 22.0 {
+		t.Errorf("Expected history [18, 22], got %v", samples)
+	}
+
+	// Dropped late values are not recorded anywhere
+	in.SetLatePolicy("temperature", "value", LateDrop)
+	result, _ = in.Apply(batch(now.Add(-2*time.Minute), 17.0))
+	if result.Dropped != 1 {
+		t.Errorf("Expected one dropped value, got %+v", result)
+	}
+
+	if samples := in.history.Query("device-1", "temperature", "value", time.Time{}, time.Time{}); len(samples) != 2 {
+		t.Errorf("Expected dropped value to be absent from history, got %v", samples)
+	}
+
+	// Overwrite restores the old behaviour
+	in.SetLatePolicy("temperature", "value", LateOverwrite)
+	result, _ = in.Apply(batch(now.Add(-3*time.Minute), 16.0))
+	if result.Applied != 1 {
+		t.Errorf("Expected late value to be applied, got %+v", result)
+	}
+
+	if val := property(reg, "temperature", "value"); val != 16.0 {
+		t.Errorf("Expected late value to overwrite, got %v", val)
+	}
+
+	// Newer values are always applied
+	in.SetLatePolicy("temperature", "value", LateDrop)
+	if result, _ := in.Apply(batch(now.Add(time.Minute), 23.0)); result.Applied != 1 {
+		t.Errorf("Expected newer value to be applied, got %+v", result)
+	}
+}
+
+func TestLatePolicies(t *testing.T) {
+	in, _ := setupIngester()
+
+	if p := in.LatePolicy("temperature", "value"); p != DefaultLatePolicy {
+		t.Errorf("Expected default policy, got %s", p)
+	}
+
+	in.SetLatePolicy("temperature", "value", LateDrop)
+	in.SetDefaultLatePolicy(LateOverwrite)
+
+	def, policies := in.LatePolicies()
+	if def != LateOverwrite || policies["temperature/value"] != LateDrop {
+		t.Errorf("Unexpected policies: %s, %v", def, policies)
+	}
+
+	in.RemoveLatePolicy("temperature", "value")
+	if p := in.LatePolicy("temperature", "value"); p != LateOverwrite {
+		t.Errorf("Expected default policy after removal, got %s", p)
+	}
+
+	if _, err := ParseLatePolicy("sometimes"); err == nil {
+		t.Error("Expected error for unknown policy")
+	}
+
+	if p, err := ParseLatePolicy("drop"); err != nil || p != LateDrop {
+		t.Errorf("Expected drop policy, got %s, %v", p, err)
+	}
+}
+
+func TestTimestampPolicies(t *testing.T) {
+	server := time.Now()
+	skewed := server.Add(-time.Hour)
+
+	if ts, corrected := ResolveTimestamp(TimestampDevice, DefaultMaxSkew, skewed, server); !ts.Equal(skewed) || corrected {
+		t.Errorf("Expected device timestamp to be trusted, got %v, %v", ts, corrected)
+	}
+
+	if ts, corrected := ResolveTimestamp(TimestampServer, DefaultMaxSkew, skewed, server); !ts.Equal(server) || !corrected {
+		t.Errorf("Expected server timestamp, got %v, %v", ts, corrected)
+	}
+
+	if ts, corrected := ResolveTimestamp(TimestampBounded, DefaultMaxSkew, skewed, server); !ts.Equal(server) || !corrected {
+		t.Errorf("Expected skewed timestamp to be corrected, got %v, %v", ts, corrected)
+	}
+
+	near := server.Add(-time.Second)
+	if ts, corrected := ResolveTimestamp(TimestampBounded, DefaultMaxSkew, near, server); !ts.Equal(near) || corrected {
+		t.Errorf("Expected timestamp within skew to be trusted, got %v, %v", ts, corrected)
+	}
+
+	if ts, corrected := ResolveTimestamp(TimestampBounded, DefaultMaxSkew, time.Time{}, server); !ts.Equal(server) || corrected {
+		t.Errorf("Expected missing timestamp to use server time, got %v, %v", ts, corrected)
+	}
+
+	if _, err := ParseTimestampPolicy("atomic"); err == nil {
+		t.Error("Expected error for unknown timestamp policy")
+	}
+}
+
+func TestIngesterTimestampMetadata(t *testing.T) {
+	in, reg := setupIngester()
+	in.SetTimestampPolicy(TimestampBounded, time.Minute)
+
+	device := time.Now().Add(24 * time.Hour)
+	result, err := in.Apply(Telemetry{
+		TwinID:    "device-1",
+		Timestamp: device,
+		Features:  map[string]map[string]interface{}{"temperature": {"value": 21.0}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to apply telemetry: %v", err)
+	}
+
+	if !result.TimestampCorrected || result.Applied != 1 {
+		t.Errorf("Expected corrected timestamp, got %+v", result)
+	}
+
+	dt, _ := reg.Get("device-1")
+	feature, _ := dt.GetFeature("temperature")
+	meta, exists := feature.GetPropertyMetadata("value")
+	if !exists {
+		t.Fatal("Expected property metadata")
+	}
+
+	if !meta.DeviceTimestamp.Equal(device) {
+		t.Errorf("Expected device timestamp %v, got %v", device, meta.DeviceTimestamp)
+	}
+
+	if !meta.Timestamp.Equal(meta.ServerTimestamp) {
+		t.Errorf("Expected effective timestamp to be server time, got %v and %v", meta.Timestamp, meta.ServerTimestamp)
+	}
+}
+
+func TestIngesterClock(t *testing.T) {
+	reg := registry.NewRegistry()
+	reg.Create(twin.NewDigitalTwin("device-1", "sensor"))
+	hist := history.NewStore(history.DefaultCapacity)
+	in := NewIngester(reg, messaging_sim.NewPubSub(), hist)
+	in.SetTimestampPolicy(TimestampServer, 0)
+
+	start := time.Date(2026, 5, 1, 8, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(start)
+	in.SetClock(fake)
+
+	batch := Telemetry{TwinID: "device-1", MessageID: "m-1", Features: map[string]map[string]interface{}{"temperature": {"value": 21.0}}}
+	if _, err := in.Apply(batch); err != nil {
+		t.Fatalf("Failed to apply telemetry: %v", err)
+	}
+	if samples := hist.Query("device-1", "temperature", "value", time.Time{}, time.Time{}); len(samples) != 1 || !samples[0].Timestamp.Equal(start) {
+		t.Errorf("Expected a sample recorded at %v, got %v", start, samples)
+	}
+
+	// The deduplication window follows the clock too
+	if result, _ := in.Apply(batch); !result.Duplicate {
+		t.Error("Expected a retry within the window to be a duplicate")
+	}
+	fake.Advance(DefaultDedupWindow + time.Second)
+	if result, _ := in.Apply(batch); result.Duplicate || result.Applied != 1 {
+		t.Errorf("Expected the batch to apply after the window, got %+v", result)
+	}
+}
+
+// failingTwins is a registry whose next updates fail
+type failingTwins struct {
+	*registry.Registry
+	failures int
+}
+
+func (f *failingTwins) Update(dt *twin.DigitalTwin) error {
+	if f.failures > 0 {
+		f.failures--
+		return errors.New("disk full")
+	}
+	return f.Registry.Update(dt)
+}
+
+func TestIngesterApplyFailureNotDuplicate(t *testing.T) {
+	reg := registry.NewRegistry()
+	reg.Create(twin.NewDigitalTwin("device-1", "sensor"))
+	twins := &failingTwins{Registry: reg, failures: 1}
+	pubsub := messaging_sim.NewPubSub()
+	events := pubsub.SubscribeWithBuffer("properties.updated", 10)
+	in := NewIngester(twins, pubsub, history.NewStore(0))
+
+	batch := Telemetry{
+		TwinID:    "device-1",
+		MessageID: "msg-1",
+		Features:  map[string]map[string]interface{}{"temperature": {"value": 21.0}},
+	}
+	if _, err := in.Apply(batch); err == nil {
+		t.Fatal("Expected the batch to fail")
+	}
+
+	// The failed batch left nothing behind
+	if val := property(reg, "temperature", "value"); val != nil {
+		t.Errorf("Expected the twin to be unchanged, got %v", val)
+	}
+	if samples := in.history.Query("device-1", "temperature", "value", time.Time{}, time.Time{}); len(samples) != 0 {
+		t.Errorf("Expected no history, got %v", samples)
+	}
+	if len(events) != 0 {
+		t.Errorf("Expected no events, got %d", len(events))
+	}
+
+	result, err := in.Apply(batch)
+	if err != nil || result.Duplicate || result.Applied != 1 {
+		t.Fatalf("Expected the retry to be applied, got %+v %v", result, err)
+	}
+	if result, _ := in.Apply(batch); !result.Duplicate {
+		t.Error("Expected a second retry to be a duplicate")
+	}
+	if samples := in.history.Query("device-1", "temperature", "value", time.Time{}, time.Time{}); len(samples) != 1 {
+		t.Errorf("Expected a single history entry, got %v", samples)
+	}
+	if len(events) != 1 {
+		t.Errorf("Expected a single event, got %d", len(events))
+	}
+}
+
+func TestIngesterApplyConflict(t *testing.T) {
+	in, reg := setupIngester()
+
+	// Replace the stored twin while the batch is applied, so that storing
+	// it conflicts and it is staged again
+	conflict := true
+	in.AddTransform("conflict", TransformFunc(func(t *Telemetry) error {
+		if conflict {
+			conflict = false
+			dt, _ := reg.Get("device-1")
+			dt = dt.Clone()
+			dt.SetAttribute("site", "north")
+			return reg.Update(dt)
+		}
+		return nil
+	}))
+
+	result, err := in.Apply(Telemetry{
+		TwinID:   "device-1",
+		Features: map[string]map[string]interface{}{"temperature": {"value": 21.0}},
+	})
+	if err != nil || result.Applied != 1 {
+		t.Fatalf("Expected the batch to be applied, got %+v %v", result, err)
+	}
+
+	dt, _ := reg.Get("device-1")
+	if site, _ := dt.GetAttribute("site"); site != "north" || property(reg, "temperature", "value") != 21.0 {
+		t.Errorf("Expected both writes to be kept, got site %v", site)
+	}
+	if samples := in.history.Query("device-1", "temperature", "value", time.Time{}, time.Time{}); len(samples) != 1 {
+		t.Errorf("Expected a single history entry, got %v", samples)
+	}
+}
+
+func TestIngesterTransforms(t *testing.T) {
+	in, reg := setupIngester()
+
+	// Convert Fahrenheit readings and drop the raw value
+	in.AddTransform("fahrenheit", TransformFunc(func(t *Telemetry) error {
+		props := t.Features["temperature"]
+		if f, ok := props["fahrenheit"].(float64); ok {
+			props["celsius"] = (f - 32) * 5 / 9
+			delete(props, "fahrenheit")
+		}
+		return nil
+	}))
+	in.AddTransform("reject", TransformFunc(func(t *Telemetry) error {
+		if _, ok := t.Features["forbidden"]; ok {
+			return errors.New("forbidden feature")
+		}
+		return nil
+	}))
+
+	if names := in.Transforms(); len(names) != 2 || names[0] != "fahrenheit" {
+		t.Errorf("Unexpected transforms: %v", names)
+	}
+
+	result, err := in.Apply(Telemetry{
+		TwinID:   "device-1",
+		Features: map[string]map[string]interface{}{"temperature": {"fahrenheit": 212.0}},
+	})
+	if err != nil || result.Applied != 1 {
+		t.Fatalf("Expected one applied value, got %+v, %v", result, err)
+	}
+
+	dt, _ := reg.Get("device-1")
+	feature, _ := dt.GetFeature("temperature")
+	if val, _ := feature.GetProperty("celsius"); val != 100.0 {
+		t.Errorf("Expected celsius 100, got %v", val)
+	}
+	if _, exists := feature.GetProperty("fahrenheit"); exists {
+		t.Error("Expected raw value to be removed by the transform")
+	}
+
+	_, err = in.Apply(Telemetry{TwinID: "device-1", Features: map[string]map[string]interface{}{"forbidden": {"a": 1}}})
+	if !errors.Is(err, ErrTransformFailed) {
+		t.Errorf("Expected ErrTransformFailed, got %v", err)
+	}
+
+	in.RemoveTransform("reject")
+	if _, err := in.Apply(Telemetry{TwinID: "device-1", Features: map[string]map[string]interface{}{"forbidden": {"a": 1}}}); err != nil {
+		t.Errorf("Expected batch to be applied after removing the transform, got %v", err)
+	}
+}
+
+func TestIngesterMirrors(t *testing.T) {
+	in, _ := setupIngester()
+	in.AddTransform("double", TransformFunc(func(t *Telemetry) error {
+		props := t.Features["climate"]
+		props["temperature"] = props["temperature"].(float64) * 2
+		return nil
+	}))
+
+	var mirrored []Telemetry
+	in.AddMirror("record", mirrorFunc(func(t Telemetry) { mirrored = append(mirrored, t) }))
+
+	batch := Telemetry{
+		TwinID:    "device-1",
+		MessageID: "m1",
+		Features:  map[string]map[string]interface{}{"climate": {"temperature": 20.0}},
+	}
+	in.Apply(batch)
+	// Duplicates and failed batches are not mirrored
+	in.Apply(batch)
+	in.Apply(Telemetry{TwinID: "device-9", Features: batch.Features})
+
+	if len(mirrored) != 1 {
+		t.Fatalf("Expected 1 mirrored batch, got %d", len(mirrored))
+	}
+	if mirrored[0].Features["climate"]["temperature"] != 20.0 {
+		t.Errorf("Expected the batch as it arrived, got %v", mirrored[0].Features)
+	}
+
+	in.RemoveMirror("record")
+	in.Apply(Telemetry{TwinID: "device-1", Features: map[string]map[string]interface{}{"climate": {"temperature": 21.0}}})
+	if len(mirrored) != 1 {
+		t.Errorf("Expected no batches after removing the mirror, got %d", len(mirrored))
+	}
+}
+
+// mirrorFunc adapts a function to the Mirror interface
+type mirrorFunc func(t Telemetry)
+
+func (f mirrorFunc) Mirror(t Telemetry) { f(t) }
+
+func TestIngesterValueSizes(t *testing.T) {
+	in, reg := setupIngester()
+	sizes := valuesize.NewManager(nil)
+	sizes.SetDefault(valuesize.Limit{MaxBytes: 16})
+	in.SetValueSizes(sizes)
+
+	large := Telemetry{
+		TwinID:    "device-1",
+		MessageID: "msg-1",
+		Features:  map[string]map[string]interface{}{"camera": {"frame": strings.Repeat("x", 32)}},
+	}
+	if _, err := in.Apply(large); !errors.Is(err, valuesize.ErrTooLarge) {
+		t.Fatalf("Expected ErrTooLarge, got %v", err)
+	}
+
+	// The rejected batch does not count as seen
+	large.Features = map[string]map[string]interface{}{"camera": {"frame": "small"}}
+	result, err := in.Apply(large)
+	if err != nil || result.Duplicate || result.Applied != 1 {
+		t.Fatalf("Expected the corrected batch to be applied, got %+v %v", result, err)
+	}
+	dt, _ := reg.Get("device-1")
+	feature, _ := dt.GetFeature("camera")
+	if value, _ := feature.GetProperty("frame"); value != "small" {
+		t.Errorf("Expected the frame to be small, got %v", value)
+	}
+}
+
+func TestIngesterOffloadFailure(t *testing.T) {
+	in, _ := setupIngester()
+	failing := true
+	sizes := valuesize.NewManager(valuesize.StoreFunc(func(ctx context.Context, twinID, name string, data []byte) (valuesize.Reference, error) {
+		if failing {
+			return valuesize.Reference{}, errors.New("store unavailable")
+		}
+		return valuesize.Reference{AttachmentID: "att-1", Size: int64(len(data))}, nil
+	}))
+	sizes.SetDefault(valuesize.Limit{MaxBytes: 16, Action: valuesize.Offload})
+	in.SetValueSizes(sizes)
+
+	batch := Telemetry{
+		TwinID:    "device-1",
+		MessageID: "msg-1",
+		Features:  map[string]map[string]interface{}{"camera": {"frame": strings.Repeat("x", 32)}},
+	}
+	if _, err := in.Apply(batch); err == nil {
+		t.Fatal("Expected the failed offload to be reported")
+	}
+
+	// The batch whose offload failed does not count as seen
+	failing = false
+	batch.Features = map[string]map[string]interface{}{"camera": {"frame": strings.Repeat("x", 32)}}
+	result, err := in.Apply(batch)
+	if err != nil || result.Duplicate || result.Applied != 1 {
+		t.Fatalf("Expected the retry to be applied, got %+v %v", result, err)
+	}
+}
@@ -0,0 +1,184 @@
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/eventbus"
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+)
+
+// Load shedding errors
+var (
+	ErrOverloaded = errors.New("too many telemetry batches in progress")
+	ErrSaturated  = errors.New("event fan-out is saturated")
+)
+
+// Defaults for load limits
+const (
+	DefaultMaxInFlight   = 64
+	DefaultMaxQueued     = 1024
+	DefaultMaxSaturation = 0 // Subscribers that stopped reading would block ingestion
+	DefaultRetryAfter    = time.Second
+)
+
+// LoadLimits bound the telemetry the ingester accepts. Up to MaxInFlight
+// batches are applied concurrently and up to MaxQueued more wait for a slot;
+// further batches are rejected with ErrOverloaded. While the fullest event
+// subscriber queue is filled beyond MaxSaturation, batches are rejected with
+// ErrSaturated, since their change events would be dropped; this is disabled
+// by default. RetryAfter is the delay suggested to rejected clients.
+type LoadLimits struct {
+	MaxInFlight   int           `json:"maxInFlight"`
+	MaxQueued     int           `json:"maxQueued"`
+	MaxSaturation float64       `json:"maxSaturation"` // Zero disables fan-out shedding
+	RetryAfter    time.Duration `json:"-"`
+}
+
+// DefaultLoadLimits returns the load limits of a new ingester
+func DefaultLoadLimits() LoadLimits {
+	return LoadLimits{
+		MaxInFlight:   DefaultMaxInFlight,
+		MaxQueued:     DefaultMaxQueued,
+		MaxSaturation: DefaultMaxSaturation,
+		RetryAfter:    DefaultRetryAfter,
+	}
+}
+
+// Validate checks that the limits can be used
+func (l LoadLimits) Validate() error {
+	if l.MaxInFlight <= 0 {
+		return fmt.Errorf("%w: maxInFlight must be positive", ErrInvalidPolicy)
+	}
+	if l.MaxQueued < 0 || l.RetryAfter < 0 {
+		return fmt.Errorf("%w: maxQueued and retryAfter must not be negative", ErrInvalidPolicy)
+	}
+	if l.MaxSaturation < 0 || l.MaxSaturation > 1 {
+		return fmt.Errorf("%w: maxSaturation must be between 0 and 1", ErrInvalidPolicy)
+	}
+	return nil
+}
+
+// Load reports how busy the ingester and the event fan-out are
+type Load struct {
+	Limits    LoadLimits         `json:"limits"`
+	InFlight  int                `json:"inFlight"`  // Batches being applied
+	Queued    int                `json:"queued"`    // Batches waiting for a slot
+	Overloads uint64             `json:"overloads"` // Batches rejected because the queue was full
+	Shed      uint64             `json:"shed"`      // Batches rejected because the fan-out was saturated
+	FanOut    messaging_sim.Load `json:"fanOut"`
+}
+
+// Saturation returns the highest fill ratio of the ingestion queue and the
+// event fan-out, from 0 to 1
+func (l Load) Saturation() float64 {
+	saturation := l.FanOut.Saturation
+	if capacity := l.Limits.MaxInFlight + l.Limits.MaxQueued; capacity > 0 {
+		if s := float64(l.InFlight+l.Queued) / float64(capacity); s > saturation {
+			saturation = s
+		}
+	}
+	return saturation
+}
+
+// admission bounds the telemetry batches applied at the same time
+type admission struct {
+	limits    LoadLimits
+	slots     chan struct{}
+	queued    int
+	overloads uint64
+	shed      uint64
+	mutex     sync.Mutex
+}
+
+// newAdmission creates an admission with the given limits
+func newAdmission(limits LoadLimits) *admission {
+	return &admission{limits: limits, slots: make(chan struct{}, limits.MaxInFlight)}
+}
+
+// acquire waits for a slot to apply a batch, or fails right away when the
+// fan-out is saturated or too many batches wait already. The returned
+// function releases the slot.
+func (in *Ingester) acquire() (func(), error) {
+	a := in.admission
+	a.mutex.Lock()
+	limits, slots := a.limits, a.slots
+	a.mutex.Unlock()
+
+	if limits.MaxSaturation > 0 && eventbus.LoadOf(in.pubsub).Saturation >= limits.MaxSaturation {
+		a.mutex.Lock()
+		a.shed++
+		a.mutex.Unlock()
+		return nil, ErrSaturated
+	}
+
+	a.mutex.Lock()
+
+	release := func() { <-slots }
+	select {
+	case slots <- struct{}{}:
+		a.mutex.Unlock()
+		return release, nil
+	default:
+	}
+
+	if a.queued >= limits.MaxQueued {
+		a.overloads++
+		a.mutex.Unlock()
+		return nil, ErrOverloaded
+	}
+	a.queued++
+	a.mutex.Unlock()
+
+	slots <- struct{}{}
+
+	a.mutex.Lock()
+	a.queued--
+	a.mutex.Unlock()
+	return release, nil
+}
+
+// LoadLimits returns the load limits of the ingester
+func (in *Ingester) LoadLimits() LoadLimits {
+	in.admission.mutex.Lock()
+	defer in.admission.mutex.Unlock()
+
+	return in.admission.limits
+}
+
+// SetLoadLimits changes the load limits. Batches in progress keep the slots
+// they hold; waiting batches are admitted under the old limits.
+func (in *Ingester) SetLoadLimits(limits LoadLimits) error {
+	if err := limits.Validate(); err != nil {
+		return err
+	}
+
+	in.admission.mutex.Lock()
+	defer in.admission.mutex.Unlock()
+
+	if limits.MaxInFlight != in.admission.limits.MaxInFlight {
+		in.admission.slots = make(chan struct{}, limits.MaxInFlight)
+	}
+	in.admission.limits = limits
+	return nil
+}
+
+// Load returns the current queue depths of the ingester and the event fan-out
+func (in *Ingester) Load() Load {
+	fanOut := eventbus.LoadOf(in.pubsub)
+
+	a := in.admission
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return Load{
+		Limits:    a.limits,
+		InFlight:  len(a.slots),
+		Queued:    a.queued,
+		Overloads: a.overloads,
+		Shed:      a.shed,
+		FanOut:    fanOut,
+	}
+}
@@ -0,0 +1,78 @@
+package ingest
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+)
+
+func TestLoadLimits(t *testing.T) {
+	in, _ := setupIngester()
+	batch := Telemetry{TwinID: "device-1", Features: map[string]map[string]interface{}{"status": {"temperature": 21.0}}}
+
+	if err := in.SetLoadLimits(LoadLimits{MaxInFlight: 0}); !errors.Is(err, ErrInvalidPolicy) {
+		t.Errorf("Expected ErrInvalidPolicy, got %v", err)
+	}
+	if err := in.SetLoadLimits(LoadLimits{MaxInFlight: 1, MaxQueued: 1}); err != nil {
+		t.Fatalf("Failed to set load limits: %v", err)
+	}
+
+	// Hold the only slot, so that the next batch waits and the one after is rejected
+	release, err := in.acquire()
+	if err != nil {
+		t.Fatalf("Failed to acquire a slot: %v", err)
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := in.Apply(batch)
+		done <- err
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for in.Load().Queued == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := in.Apply(batch); err != ErrOverloaded {
+		t.Errorf("Expected ErrOverloaded, got %v", err)
+	}
+
+	load := in.Load()
+	if load.InFlight != 1 || load.Queued != 1 || load.Overloads != 1 {
+		t.Errorf("Unexpected load %+v", load)
+	}
+	if load.Saturation() != 1 {
+		t.Errorf("Expected saturation 1, got %v", load.Saturation())
+	}
+
+	release()
+	if err := <-done; err != nil {
+		t.Errorf("Expected the waiting batch to be applied, got %v", err)
+	}
+	if load := in.Load(); load.InFlight != 0 || load.Queued != 0 {
+		t.Errorf("Expected no batches in progress, got %+v", load)
+	}
+}
+
+func TestFanOutSaturation(t *testing.T) {
+	in, _ := setupIngester()
+	batch := Telemetry{TwinID: "device-1", Features: map[string]map[string]interface{}{"status": {"temperature": 21.0}}}
+
+	in.SetLoadLimits(LoadLimits{MaxInFlight: 1, MaxSaturation: 0.5})
+	in.pubsub.(*messaging_sim.PubSub).SubscribeWithBuffer("#", 2)
+
+	if _, err := in.Apply(batch); err != nil {
+		t.Fatalf("Expected the first batch to be applied, got %v", err)
+	}
+
+	// The subscriber does not read, so its queue is now half full
+	if _, err := in.Apply(batch); err != ErrSaturated {
+		t.Errorf("Expected ErrSaturated, got %v", err)
+	}
+	if load := in.Load(); load.Shed != 1 || load.FanOut.Saturation != 0.5 {
+		t.Errorf("Unexpected load %+v", load)
+	}
+}
@@ -0,0 +1,64 @@
+package ingest
+
+// Mirror receives the telemetry batches applied to twins as they arrived,
+// before the transform chain ran. Mirrors are called after a batch was
+// applied, except for duplicates, and may apply copies of it to other twins.
+type Mirror interface {
+	Mirror(t Telemetry)
+}
+
+// namedMirror is a registered mirror
+type namedMirror struct {
+	name   string
+	mirror Mirror
+}
+
+// AddMirror registers a mirror. A mirror with the same name is replaced.
+func (in *Ingester) AddMirror(name string, m Mirror) {
+	in.mutex.Lock()
+	defer in.mutex.Unlock()
+
+	for i, nm := range in.mirrors {
+		if nm.name == name {
+			in.mirrors[i].mirror = m
+			return
+		}
+	}
+	in.mirrors = append(in.mirrors, namedMirror{name: name, mirror: m})
+}
+
+// RemoveMirror removes a mirror
+func (in *Ingester) RemoveMirror(name string) {
+	in.mutex.Lock()
+	defer in.mutex.Unlock()
+
+	for i, nm := range in.mirrors {
+		if nm.name == name {
+			in.mirrors = append(in.mirrors[:i], in.mirrors[i+1:]...)
+			return
+		}
+	}
+}
+
+// mirrorList returns the registered mirrors
+func (in *Ingester) mirrorList() []namedMirror {
+	in.mutex.RLock()
+	defer in.mutex.RUnlock()
+
+	return append([]namedMirror(nil), in.mirrors...)
+}
+
+// copy returns a copy of a telemetry batch that transforms of the original
+// do not affect
+func (t Telemetry) copy() Telemetry {
+	c := t
+	c.Features = make(map[string]map[string]interface{}, len(t.Features))
+	for featureID, props := range t.Features {
+		copied := make(map[string]interface{}, len(props))
+		for k, v := range props {
+			copied[k] = v
+		}
+		c.Features[featureID] = copied
+	}
+	return c
+}
@@ -0,0 +1,86 @@
+package ingest
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Common errors
+var (
+	ErrInvalidPolicy = errors.New("invalid policy")
+)
+
+// LatePolicy decides what happens to a value that is older than the current value of its property
+type LatePolicy string
+
+// Supported late policies
+const (
+	LateHistoryOnly LatePolicy = "historyOnly" // Record the value in history but keep the current value
+	LateOverwrite   LatePolicy = "overwrite"   // Replace the current value regardless of time
+	LateDrop        LatePolicy = "drop"        // Discard the value entirely
+)
+
+// DefaultLatePolicy is applied to properties without an explicit policy
+const DefaultLatePolicy = LateHistoryOnly
+
+// ParseLatePolicy validates a late policy name
+func ParseLatePolicy(s string) (LatePolicy, error) {
+	switch p := LatePolicy(s); p {
+	case LateHistoryOnly, LateOverwrite, LateDrop:
+		return p, nil
+	}
+	return "", fmt.Errorf("%w: unknown late policy %q", ErrInvalidPolicy, s)
+}
+
+// policyKey identifies a property across all twins
+func policyKey(featureID, key string) string {
+	return featureID + "/" + key
+}
+
+// LatePolicy returns the late policy of a property
+func (in *Ingester) LatePolicy(featureID, key string) LatePolicy {
+	in.mutex.RLock()
+	defer in.mutex.RUnlock()
+
+	if p, exists := in.latePolicies[policyKey(featureID, key)]; exists {
+		return p
+	}
+	return in.defaultLatePolicy
+}
+
+// SetLatePolicy sets the late policy of a property for all twins
+func (in *Ingester) SetLatePolicy(featureID, key string, p LatePolicy) {
+	in.mutex.Lock()
+	defer in.mutex.Unlock()
+
+	in.latePolicies[policyKey(featureID, key)] = p
+}
+
+// RemoveLatePolicy reverts a property to the default late policy
+func (in *Ingester) RemoveLatePolicy(featureID, key string) {
+	in.mutex.Lock()
+	defer in.mutex.Unlock()
+
+	delete(in.latePolicies, policyKey(featureID, key))
+}
+
+// SetDefaultLatePolicy sets the late policy of properties without an explicit policy
+func (in *Ingester) SetDefaultLatePolicy(p LatePolicy) {
+	in.mutex.Lock()
+	defer in.mutex.Unlock()
+
+	in.defaultLatePolicy = p
+}
+
+// LatePolicies returns the default policy and a copy of the per-property
+// policies keyed by "featureID/propertyKey"
+func (in *Ingester) LatePolicies() (LatePolicy, map[string]LatePolicy) {
+	in.mutex.RLock()
+	defer in.mutex.RUnlock()
+
+	policies := make(map[string]LatePolicy, len(in.latePolicies))
+	for k, p := range in.latePolicies {
+		policies[k] = p
+	}
+	return in.defaultLatePolicy, policies
+}
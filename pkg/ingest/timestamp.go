@@ -0,0 +1,69 @@
+package ingest
+
+import (
+	"fmt"
+	"time"
+)
+
+// TimestampPolicy decides which clock determines the effective time of ingested values
+type TimestampPolicy string
+
+// Supported timestamp policies
+const (
+	TimestampDevice  TimestampPolicy = "device"  // Trust device timestamps, use server time when none is given
+	TimestampServer  TimestampPolicy = "server"  // Always use the time the server received the values
+	TimestampBounded TimestampPolicy = "bounded" // Trust device timestamps within the maximum skew of server time
+)
+
+// Defaults for the timestamp policy
+const (
+	DefaultTimestampPolicy = TimestampDevice
+	DefaultMaxSkew         = 30 * time.Second
+)
+
+// ParseTimestampPolicy validates a timestamp policy name
+func ParseTimestampPolicy(s string) (TimestampPolicy, error) {
+	switch p := TimestampPolicy(s); p {
+	case TimestampDevice, TimestampServer, TimestampBounded:
+		return p, nil
+	}
+	return "", fmt.Errorf("%w: unknown timestamp policy %q", ErrInvalidPolicy, s)
+}
+
+// ResolveTimestamp returns the effective timestamp of values reported with the
+// given device timestamp and received at the given server time. It reports
+// whether a device timestamp was replaced by server time because of the policy.
+func ResolveTimestamp(policy TimestampPolicy, maxSkew time.Duration, device, server time.Time) (time.Time, bool) {
+	if device.IsZero() {
+		return server, false
+	}
+
+	switch policy {
+	case TimestampServer:
+		return server, true
+	case TimestampBounded:
+		skew := device.Sub(server)
+		if skew > maxSkew || skew < -maxSkew {
+			return server, true
+		}
+	}
+
+	return device, false
+}
+
+// TimestampPolicy returns the timestamp policy and the maximum skew used by the bounded policy
+func (in *Ingester) TimestampPolicy() (TimestampPolicy, time.Duration) {
+	in.mutex.RLock()
+	defer in.mutex.RUnlock()
+
+	return in.timestampPolicy, in.maxSkew
+}
+
+// SetTimestampPolicy sets the timestamp policy and the maximum skew used by the bounded policy
+func (in *Ingester) SetTimestampPolicy(policy TimestampPolicy, maxSkew time.Duration) {
+	in.mutex.Lock()
+	defer in.mutex.Unlock()
+
+	in.timestampPolicy = policy
+	in.maxSkew = maxSkew
+}
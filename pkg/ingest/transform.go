@@ -0,0 +1,84 @@
+package ingest
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrTransformFailed is returned when a transform rejects or fails on a telemetry batch
+var ErrTransformFailed = errors.New("transform failed")
+
+// Transform rewrites a telemetry batch before it is applied. A transform may
+// rename, convert, add or remove properties; removing all of them makes the
+// batch empty so that it is rejected.
+type Transform interface {
+	Transform(t *Telemetry) error
+}
+
+// TransformFunc adapts an ordinary function to the Transform interface
+type TransformFunc func(t *Telemetry) error
+
+// Transform calls f(t)
+func (f TransformFunc) Transform(t *Telemetry) error {
+	return f(t)
+}
+
+// namedTransform is a transform in the ingestion chain
+type namedTransform struct {
+	name      string
+	transform Transform
+}
+
+// AddTransform appends a transform to the ingestion chain. A transform with
+// the same name is replaced in place.
+func (in *Ingester) AddTransform(name string, tr Transform) {
+	in.mutex.Lock()
+	defer in.mutex.Unlock()
+
+	for i, t := range in.transforms {
+		if t.name == name {
+			in.transforms[i].transform = tr
+			return
+		}
+	}
+	in.transforms = append(in.transforms, namedTransform{name: name, transform: tr})
+}
+
+// RemoveTransform removes a transform from the ingestion chain
+func (in *Ingester) RemoveTransform(name string) {
+	in.mutex.Lock()
+	defer in.mutex.Unlock()
+
+	for i, t := range in.transforms {
+		if t.name == name {
+			in.transforms = append(in.transforms[:i], in.transforms[i+1:]...)
+			return
+		}
+	}
+}
+
+// Transforms returns the names of the transforms in the order they are applied
+func (in *Ingester) Transforms() []string {
+	in.mutex.RLock()
+	defer in.mutex.RUnlock()
+
+	names := make([]string, len(in.transforms))
+	for i, t := range in.transforms {
+		names[i] = t.name
+	}
+	return names
+}
+
+// transform runs a telemetry batch through the transform chain
+func (in *Ingester) transform(t *Telemetry) error {
+	in.mutex.RLock()
+	chain := append([]namedTransform(nil), in.transforms...)
+	in.mutex.RUnlock()
+
+	for _, tr := range chain {
+		if err := tr.transform.Transform(t); err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrTransformFailed, tr.name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,502 @@
+package ingest
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrInvalidDatagram is returned for datagrams that are neither JSON nor
+// valid binary telemetry
+var ErrInvalidDatagram = errors.New("invalid telemetry datagram")
+
+// Defaults for UDP options left empty
+const (
+	DefaultUDPQueueSize = 4096 // Decoded batches waiting to be applied
+	DefaultUDPBatchSize = 256  // Batches applied per round
+)
+
+// maxDatagram is the largest UDP payload
+const maxDatagram = 65535
+
+// Binary datagram format, all integers big-endian:
+//
+//	magic "DT", version 1, flags 0
+//	sequence     uint32, 0 when not numbered
+//	timestamp    int64, Unix milliseconds, 0 when not set
+//	twin ID      uint8 length + bytes
+//	features     uint8 count, each: uint8 length + ID, uint8 property count,
+//	             each property: uint8 length + key, type byte, value
+//
+// Property types: 0 float64, 1 int64, 2 false, 3 true, 4 string with uint16
+// length, 5 null. Integers are applied as float64 like JSON numbers.
+const (
+	binaryMagic   = "DT"
+	binaryVersion = 1
+
+	typeFloat  = 0
+	typeInt    = 1
+	typeFalse  = 2
+	typeTrue   = 3
+	typeString = 4
+	typeNull   = 5
+)
+
+// UDPOptions configure a UDP listener
+type UDPOptions struct {
+	QueueSize int  // Batches waiting to be applied, DefaultUDPQueueSize when zero
+	BatchSize int  // Batches applied per round, DefaultUDPBatchSize when zero
+	Coalesce  bool // Merge the batches of a twin within a round, later values winning
+}
+
+// UDPStats count the datagrams handled by a UDP listener
+type UDPStats struct {
+	Received  int    `json:"received"`  // Datagrams read
+	Malformed int    `json:"malformed"` // Datagrams that could not be decoded
+	Dropped   int    `json:"dropped"`   // Batches dropped because the queue was full
+	Applied   int    `json:"applied"`   // Batches applied to twins
+	Failed    int    `json:"failed"`    // Batches the ingester rejected
+	Lost      int    `json:"lost"`      // Gaps in the sequence numbers of a twin
+	Reordered int    `json:"reordered"` // Batches with a sequence number at or below the last one of the twin
+	LastError string `json:"lastError,omitempty"`
+}
+
+// UDPListener receives telemetry datagrams and applies them to twins in
+// batches. Each datagram carries a JSON telemetry document, a JSON array of
+// documents, or one batch in the compact binary format.
+type UDPListener struct {
+	ingester *Ingester
+	conn     net.PacketConn
+	opts     UDPOptions
+	queue    chan Telemetry
+	lastSeq  map[string]uint64 // Twin ID -> highest sequence number seen
+	stats    UDPStats
+	mutex    sync.Mutex
+}
+
+// ListenUDP opens a UDP listener applying telemetry through an ingester
+func ListenUDP(in *Ingester, addr string, opts UDPOptions) (*UDPListener, error) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = DefaultUDPQueueSize
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultUDPBatchSize
+	}
+
+	return &UDPListener{
+		ingester: in,
+		conn:     conn,
+		opts:     opts,
+		queue:    make(chan Telemetry, opts.QueueSize),
+		lastSeq:  make(map[string]uint64),
+	}, nil
+}
+
+// Addr returns the address the listener is bound to
+func (l *UDPListener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
+
+// Serve reads and applies datagrams until the context is cancelled, then
+// closes the listener. Batches still queued are applied before it returns.
+func (l *UDPListener) Serve(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		l.apply()
+	}()
+
+	go func() {
+		<-ctx.Done()
+		l.conn.Close()
+	}()
+
+	buf := make([]byte, maxDatagram)
+	for {
+		n, _, err := l.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				break
+			}
+			l.fail(nil, err)
+			continue
+		}
+		l.receive(buf[:n])
+	}
+
+	close(l.queue)
+	<-done
+}
+
+// receive decodes a datagram and queues its batches
+func (l *UDPListener) receive(datagram []byte) {
+	batches, err := DecodeDatagram(datagram)
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.stats.Received++
+	if err != nil {
+		l.stats.Malformed++
+		l.stats.LastError = err.Error()
+		return
+	}
+
+	for _, t := range batches {
+		if t.Sequence != 0 {
+			last := l.lastSeq[t.TwinID]
+			switch {
+			case last == 0 || t.Sequence == last+1:
+			case t.Sequence <= last:
+				l.stats.Reordered++
+			default:
+				l.stats.Lost += int(t.Sequence - last - 1)
+			}
+			if t.Sequence > last {
+				l.lastSeq[t.TwinID] = t.Sequence
+			}
+		}
+
+		select {
+		case l.queue <- t:
+		default:
+			l.stats.Dropped++
+		}
+	}
+}
+
+// apply applies queued batches in rounds until the queue is closed
+func (l *UDPListener) apply() {
+	for t := range l.queue {
+		round := []Telemetry{t}
+	fill:
+		for len(round) < l.opts.BatchSize {
+			select {
+			case next, ok := <-l.queue:
+				if !ok {
+					break fill
+				}
+				round = append(round, next)
+			default:
+				break fill
+			}
+		}
+
+		if l.opts.Coalesce {
+			round = coalesce(round)
+		}
+		for _, t := range round {
+			if _, err := l.ingester.Apply(t); err != nil {
+				l.fail(&l.stats.Failed, err)
+				continue
+			}
+			l.mutex.Lock()
+			l.stats.Applied++
+			l.mutex.Unlock()
+		}
+	}
+}
+
+// coalesce merges the batches of each twin into one, in order of first
+// appearance. Later values win, and the merged batch carries the latest
+// timestamp and sequence number.
+func coalesce(round []Telemetry) []Telemetry {
+	var result []Telemetry
+	index := make(map[string]int)
+
+	for _, t := range round {
+		i, exists := index[t.TwinID]
+		if !exists {
+			index[t.TwinID] = len(result)
+			result = append(result, t.copy())
+			continue
+		}
+
+		merged := &result[i]
+		for featureID, props := range t.Features {
+			if merged.Features[featureID] == nil {
+				merged.Features[featureID] = make(map[string]interface{}, len(props))
+			}
+			for k, v := range props {
+				merged.Features[featureID][k] = v
+			}
+		}
+		if t.Timestamp.After(merged.Timestamp) {
+			merged.Timestamp = t.Timestamp
+		}
+		if t.Sequence > merged.Sequence {
+			merged.Sequence = t.Sequence
+		}
+		merged.MessageID = ""
+	}
+	return result
+}
+
+// fail records an error and increments a counter, if any
+func (l *UDPListener) fail(counter *int, err error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if counter != nil {
+		*counter++
+	}
+	l.stats.LastError = err.Error()
+}
+
+// Stats returns the datagram counters of the listener
+func (l *UDPListener) Stats() UDPStats {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.stats
+}
+
+// DecodeDatagram decodes the telemetry batches of a datagram
+func DecodeDatagram(datagram []byte) ([]Telemetry, error) {
+	if len(datagram) == 0 {
+		return nil, fmt.Errorf("%w: empty", ErrInvalidDatagram)
+	}
+
+	switch datagram[0] {
+	case '{':
+		var t Telemetry
+		if err := json.Unmarshal(datagram, &t); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidDatagram, err)
+		}
+		return checkTwinIDs([]Telemetry{t})
+	case '[':
+		var batches []Telemetry
+		if err := json.Unmarshal(datagram, &batches); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidDatagram, err)
+		}
+		return checkTwinIDs(batches)
+	}
+
+	t, err := decodeBinary(datagram)
+	if err != nil {
+		return nil, err
+	}
+	return checkTwinIDs([]Telemetry{t})
+}
+
+// checkTwinIDs rejects batches that do not name their twin
+func checkTwinIDs(batches []Telemetry) ([]Telemetry, error) {
+	for _, t := range batches {
+		if t.TwinID == "" {
+			return nil, fmt.Errorf("%w: twinId is required", ErrInvalidDatagram)
+		}
+	}
+	return batches, nil
+}
+
+// binaryReader reads the fields of a binary datagram
+type binaryReader struct {
+	data []byte
+	err  error
+}
+
+func (r *binaryReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.data) < n {
+		r.err = fmt.Errorf("%w: truncated", ErrInvalidDatagram)
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *binaryReader) uint8() int {
+	if b := r.next(1); b != nil {
+		return int(b[0])
+	}
+	return 0
+}
+
+func (r *binaryReader) uint64() uint64 {
+	if b := r.next(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (r *binaryReader) string8() string {
+	return string(r.next(r.uint8()))
+}
+
+// decodeBinary decodes a datagram in the compact binary format
+func decodeBinary(data []byte) (Telemetry, error) {
+	r := &binaryReader{data: data}
+
+	header := r.next(4)
+	if r.err != nil || string(header[:2]) != binaryMagic {
+		return Telemetry{}, fmt.Errorf("%w: not JSON and no binary header", ErrInvalidDatagram)
+	}
+	if header[2] != binaryVersion {
+		return Telemetry{}, fmt.Errorf("%w: unsupported version %d", ErrInvalidDatagram, header[2])
+	}
+
+	var t Telemetry
+	if b := r.next(4); b != nil {
+		t.Sequence = uint64(binary.BigEndian.Uint32(b))
+	}
+	if ms := int64(r.uint64()); ms != 0 {
+		t.Timestamp = time.UnixMilli(ms).UTC()
+	}
+	t.TwinID = r.string8()
+
+	features := r.uint8()
+	t.Features = make(map[string]map[string]interface{}, features)
+	for i := 0; i < features && r.err == nil; i++ {
+		featureID := r.string8()
+		count := r.uint8()
+		props := make(map[string]interface{}, count)
+		for j := 0; j < count && r.err == nil; j++ {
+			key := r.string8()
+			switch kind := r.uint8(); kind {
+			case typeFloat:
+				props[key] = math.Float64frombits(r.uint64())
+			case typeInt:
+				props[key] = float64(int64(r.uint64()))
+			case typeFalse:
+				props[key] = false
+			case typeTrue:
+				props[key] = true
+			case typeString:
+				var n int
+				if b := r.next(2); b != nil {
+					n = int(binary.BigEndian.Uint16(b))
+				}
+				props[key] = string(r.next(n))
+			case typeNull:
+				props[key] = nil
+			default:
+				if r.err == nil {
+					r.err = fmt.Errorf("%w: unknown property type %d", ErrInvalidDatagram, kind)
+				}
+			}
+		}
+		t.Features[featureID] = props
+	}
+
+	if r.err == nil && len(r.data) > 0 {
+		r.err = fmt.Errorf("%w: %d trailing bytes", ErrInvalidDatagram, len(r.data))
+	}
+	if r.err != nil {
+		return Telemetry{}, r.err
+	}
+	return t, nil
+}
+
+// EncodeDatagram encodes a telemetry batch in the compact binary format.
+// Numbers are encoded as float64, and sequence numbers must fit in 32 bits.
+func EncodeDatagram(t Telemetry) ([]byte, error) {
+	if t.Sequence > math.MaxUint32 {
+		return nil, fmt.Errorf("%w: sequence number exceeds 32 bits", ErrInvalidDatagram)
+	}
+	if len(t.Features) > math.MaxUint8 {
+		return nil, fmt.Errorf("%w: too many features", ErrInvalidDatagram)
+	}
+
+	buf := []byte(binaryMagic)
+	buf = append(buf, binaryVersion, 0)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(t.Sequence))
+
+	var ms int64
+	if !t.Timestamp.IsZero() {
+		ms = t.Timestamp.UnixMilli()
+	}
+	buf = binary.BigEndian.AppendUint64(buf, uint64(ms))
+
+	var err error
+	if buf, err = appendString8(buf, t.TwinID); err != nil {
+		return nil, err
+	}
+
+	buf = append(buf, byte(len(t.Features)))
+	for featureID, props := range t.Features {
+		if len(props) > math.MaxUint8 {
+			return nil, fmt.Errorf("%w: too many properties in feature %s", ErrInvalidDatagram, featureID)
+		}
+		if buf, err = appendString8(buf, featureID); err != nil {
+			return nil, err
+		}
+		buf = append(buf, byte(len(props)))
+
+		for key, value := range props {
+			if buf, err = appendString8(buf, key); err != nil {
+				return nil, err
+			}
+
+			switch v := value.(type) {
+			case nil:
+				buf = append(buf, typeNull)
+			case bool:
+				if v {
+					buf = append(buf, typeTrue)
+				} else {
+					buf = append(buf, typeFalse)
+				}
+			case string:
+				if len(v) > math.MaxUint16 {
+					return nil, fmt.Errorf("%w: value of %s is too long", ErrInvalidDatagram, key)
+				}
+				buf = append(buf, typeString)
+				buf = binary.BigEndian.AppendUint16(buf, uint16(len(v)))
+				buf = append(buf, v...)
+			default:
+				f, ok := toFloat(value)
+				if !ok {
+					return nil, fmt.Errorf("%w: unsupported value type %T of %s", ErrInvalidDatagram, value, key)
+				}
+				buf = append(buf, typeFloat)
+				buf = binary.BigEndian.AppendUint64(buf, math.Float64bits(f))
+			}
+		}
+	}
+
+	if len(buf) > maxDatagram {
+		return nil, fmt.Errorf("%w: %d bytes exceed the maximum datagram size", ErrInvalidDatagram, len(buf))
+	}
+	return buf, nil
+}
+
+// appendString8 appends a string with a one-byte length
+func appendString8(buf []byte, s string) ([]byte, error) {
+	if len(s) > math.MaxUint8 {
+		return nil, fmt.Errorf("%w: %q is longer than 255 bytes", ErrInvalidDatagram, s)
+	}
+	buf = append(buf, byte(len(s)))
+	return append(buf, s...), nil
+}
+
+// toFloat converts numeric values to float64
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,140 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestDatagramCodec(t *testing.T) {
+	timestamp := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	batch := Telemetry{
+		TwinID:    "device-1",
+		Sequence:  42,
+		Timestamp: timestamp,
+		Features: map[string]map[string]interface{}{
+			"status": {"temperature": 21.5, "count": 3, "on": true, "mode": "eco", "fault": nil},
+		},
+	}
+
+	datagram, err := EncodeDatagram(batch)
+	if err != nil {
+		t.Fatalf("Failed to encode datagram: %v", err)
+	}
+
+	decoded, err := DecodeDatagram(datagram)
+	if err != nil {
+		t.Fatalf("Failed to decode datagram: %v", err)
+	}
+	d := decoded[0]
+	if d.TwinID != "device-1" || d.Sequence != 42 || !d.Timestamp.Equal(timestamp) {
+		t.Errorf("Unexpected batch %+v", d)
+	}
+	props := d.Features["status"]
+	if props["temperature"] != 21.5 || props["count"] != 3.0 || props["on"] != true || props["mode"] != "eco" || props["fault"] != nil {
+		t.Errorf("Unexpected properties %v", props)
+	}
+
+	if decoded, err := DecodeDatagram([]byte(`[{"twinId": "a", "features": {"f": {"v": 1}}}, {"twinId": "b", "features": {"f": {"v": 2}}}]`)); err != nil || len(decoded) != 2 {
+		t.Errorf("Expected 2 JSON batches, got %v (%v)", decoded, err)
+	}
+
+	invalid := [][]byte{
+		nil,
+		[]byte(`{"features": {"f": {"v": 1}}}`),
+		[]byte(`{"twinId": `),
+		[]byte("XX\x01\x00"),
+		datagram[:len(datagram)-3],
+		append(append([]byte(nil), datagram...), 0),
+	}
+	for _, datagram := range invalid {
+		if _, err := DecodeDatagram(datagram); !errors.Is(err, ErrInvalidDatagram) {
+			t.Errorf("Expected ErrInvalidDatagram for %q, got %v", datagram, err)
+		}
+	}
+
+	if _, err := EncodeDatagram(Telemetry{TwinID: "device-1", Features: map[string]map[string]interface{}{"f": {"v": []int{1}}}}); !errors.Is(err, ErrInvalidDatagram) {
+		t.Errorf("Expected ErrInvalidDatagram for an unsupported value, got %v", err)
+	}
+}
+
+func TestUDPLossCounters(t *testing.T) {
+	in, _ := setupIngester()
+	l := &UDPListener{ingester: in, queue: make(chan Telemetry, 2), lastSeq: make(map[string]uint64)}
+
+	for _, seq := range []uint64{1, 2, 5, 4} {
+		datagram, _ := EncodeDatagram(Telemetry{TwinID: "device-1", Sequence: uint64(seq), Features: map[string]map[string]interface{}{"f": {"v": 1.0}}})
+		l.receive(datagram)
+	}
+	l.receive([]byte("garbage"))
+
+	stats := l.Stats()
+	if stats.Received != 5 || stats.Lost != 2 || stats.Reordered != 1 || stats.Malformed != 1 || stats.Dropped != 2 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestUDPListener(t *testing.T) {
+	in, reg := setupIngester()
+
+	l, err := ListenUDP(in, "127.0.0.1:0", UDPOptions{Coalesce: true})
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan struct{})
+	go func() {
+		l.Serve(ctx)
+		close(served)
+	}()
+
+	conn, err := net.Dial("udp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	datagram, _ := EncodeDatagram(Telemetry{TwinID: "device-1", Sequence: 1, Features: map[string]map[string]interface{}{"status": {"temperature": 20.0}}})
+	conn.Write(datagram)
+	conn.Write([]byte(`{"twinId": "device-1", "sequence": 2, "features": {"status": {"humidity": 40}}}`))
+
+	deadline := time.Now().Add(2 * time.Second)
+	for l.Stats().Received < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-served
+
+	dt, _ := reg.Get("device-1")
+	feature, exists := dt.GetFeature("status")
+	if !exists {
+		t.Fatal("Expected the status feature")
+	}
+	if v, _ := feature.GetProperty("temperature"); v != 20.0 {
+		t.Errorf("Expected temperature 20, got %v", v)
+	}
+	if v, _ := feature.GetProperty("humidity"); v != 40.0 {
+		t.Errorf("Expected humidity 40, got %v", v)
+	}
+	if stats := l.Stats(); stats.Received != 2 || stats.Applied == 0 || stats.Failed != 0 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestCoalesce(t *testing.T) {
+	round := coalesce([]Telemetry{
+		{TwinID: "a", Sequence: 1, Features: map[string]map[string]interface{}{"f": {"x": 1.0, "y": 1.0}}},
+		{TwinID: "b", Sequence: 7, Features: map[string]map[string]interface{}{"f": {"x": 9.0}}},
+		{TwinID: "a", Sequence: 2, Features: map[string]map[string]interface{}{"f": {"x": 2.0}, "g": {"z": true}}},
+	})
+
+	if len(round) != 2 || round[0].TwinID != "a" || round[0].Sequence != 2 {
+		t.Fatalf("Unexpected round %+v", round)
+	}
+	if f := round[0].Features["f"]; f["x"] != 2.0 || f["y"] != 1.0 || round[0].Features["g"]["z"] != true {
+		t.Errorf("Expected later values to win, got %v", round[0].Features)
+	}
+}
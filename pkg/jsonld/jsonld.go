@@ -0,0 +1,165 @@
+package jsonld
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// ErrInvalidAnnotation is returned for semantic annotations that cannot be exported
+var ErrInvalidAnnotation = errors.New("invalid semantic annotation")
+
+// ContentType is the media type of exported documents
+const ContentType = "application/ld+json"
+
+// Defaults used when exporting twins
+const (
+	DefaultBase  = "urn:twin:"       // Prefix of twin and feature node IDs
+	DefaultVocab = "urn:twin:vocab#" // Vocabulary of twin fields, attributes and properties
+)
+
+// WellKnownPrefixes are available to every annotation without declaring them in its context
+var WellKnownPrefixes = map[string]string{
+	"saref": "https://saref.etsi.org/core/",
+	"brick": "https://brickschema.org/schema/Brick#",
+}
+
+// Validate checks that all context IRIs are absolute and that all types are
+// either absolute IRIs or compact IRIs with a declared or well-known prefix
+func Validate(a *twin.SemanticAnnotation) error {
+	if a == nil {
+		return nil
+	}
+
+	for prefix, iri := range a.Context {
+		if prefix == "" || strings.ContainsAny(prefix, ":@") {
+			return fmt.Errorf("%w: invalid prefix %q", ErrInvalidAnnotation, prefix)
+		}
+		if !isAbsolute(iri) {
+			return fmt.Errorf("%w: context IRI of %s must be absolute", ErrInvalidAnnotation, prefix)
+		}
+	}
+
+	for _, t := range a.Types {
+		prefix, _, ok := strings.Cut(t, ":")
+		if !ok {
+			return fmt.Errorf("%w: type %q must be a compact or absolute IRI", ErrInvalidAnnotation, t)
+		}
+		if _, known := a.Context[prefix]; known {
+			continue
+		}
+		if _, known := WellKnownPrefixes[prefix]; known {
+			continue
+		}
+		if !isAbsolute(t) {
+			return fmt.Errorf("%w: type %q uses an unknown prefix", ErrInvalidAnnotation, t)
+		}
+	}
+	return nil
+}
+
+// Export returns the JSON-LD representation of a twin. Nodes are identified
+// below base, DefaultBase if empty. The twin and its features carry the
+// types of their annotations, or Twin and Feature if they have none.
+// Relationships become links to the nodes of their targets.
+func Export(dt *twin.DigitalTwin, base string) map[string]interface{} {
+	if base == "" {
+		base = DefaultBase
+	}
+
+	context := map[string]interface{}{"@vocab": DefaultVocab}
+	for prefix, iri := range WellKnownPrefixes {
+		context[prefix] = iri
+	}
+
+	semantics := dt.GetSemantics()
+	addContext(context, semantics)
+
+	features := dt.GetAllFeatures()
+	ids := make([]string, 0, len(features))
+	for id := range features {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	nodes := make([]interface{}, 0, len(ids))
+	for _, id := range ids {
+		feature := features[id]
+		fs := feature.GetSemantics()
+		addContext(context, fs)
+
+		nodes = append(nodes, map[string]interface{}{
+			"@id":        base + dt.ID + "/features/" + id,
+			"@type":      types(fs, "Feature"),
+			"properties": feature.GetAllProperties(),
+		})
+	}
+
+	doc := map[string]interface{}{
+		"@context":   context,
+		"@id":        base + dt.ID,
+		"@type":      types(semantics, "Twin"),
+		"twinType":   dt.Type,
+		"lifecycle":  string(dt.GetLifecycle()),
+		"attributes": dt.GetAllAttributes(),
+		"hasFeature": nodes,
+	}
+	if definition := dt.GetDefinition(); definition != "" {
+		doc["definition"] = definition
+	}
+
+	// Relationships link to the nodes of their target twins
+	for name, targets := range dt.GetAllRelationships() {
+		if _, reserved := doc[name]; reserved {
+			continue
+		}
+		links := make([]interface{}, len(targets))
+		for i, id := range targets {
+			links[i] = map[string]interface{}{"@id": base + id}
+		}
+		doc[name] = links
+	}
+	return doc
+}
+
+// addContext merges the context of an annotation into a document context.
+// Prefixes declared by the twin take precedence over those of features.
+func addContext(context map[string]interface{}, a *twin.SemanticAnnotation) {
+	if a == nil {
+		return
+	}
+	for prefix, iri := range a.Context {
+		if _, exists := context[prefix]; !exists || WellKnownPrefixes[prefix] == context[prefix] {
+			context[prefix] = iri
+		}
+	}
+}
+
+// types returns the types of an annotation, or the fallback if it has none
+func types(a *twin.SemanticAnnotation, fallback string) []string {
+	if a == nil || len(a.Types) == 0 {
+		return []string{fallback}
+	}
+	return a.Types
+}
+
+// isAbsolute reports whether s is an absolute http, https or urn IRI.
+// Other schemes are not accepted, so that undeclared prefixes are not
+// mistaken for schemes.
+func isAbsolute(s string) bool {
+	u, err := url.Parse(s)
+	if err != nil {
+		return false
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return u.Host != ""
+	case "urn":
+		return u.Opaque != ""
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package jsonld
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestValidate(t *testing.T) {
+	valid := []*twin.SemanticAnnotation{
+		nil,
+		{Types: []string{"brick:AHU", "saref:Device"}},
+		{Types: []string{"https://example.com/ontology#Pump"}},
+		{Context: map[string]string{"ex": "https://example.com/ontology#"}, Types: []string{"ex:Pump"}},
+	}
+	for _, a := range valid {
+		if err := Validate(a); err != nil {
+			t.Errorf("Expected %+v to be valid, got %v", a, err)
+		}
+	}
+
+	invalid := []*twin.SemanticAnnotation{
+		{Types: []string{"Pump"}},
+		{Types: []string{"ex:Pump"}},
+		{Context: map[string]string{"ex": "relative/path"}},
+		{Context: map[string]string{"": "https://example.com/"}},
+	}
+	for _, a := range invalid {
+		if err := Validate(a); !errors.Is(err, ErrInvalidAnnotation) {
+			t.Errorf("Expected ErrInvalidAnnotation for %+v, got %v", a, err)
+		}
+	}
+}
+
+func TestExport(t *testing.T) {
+	dt := twin.NewDigitalTwin("ahu-1", "airHandler")
+	dt.SetAttribute("location", "roof")
+	dt.SetSemantics(&twin.SemanticAnnotation{
+		Context: map[string]string{"ex": "https://example.com/ontology#"},
+		Types:   []string{"brick:AHU"},
+	})
+
+	supply := twin.NewFeatureState()
+	supply.SetProperty("value", 18.5)
+	supply.SetSemantics(&twin.SemanticAnnotation{Types: []string{"brick:Supply_Air_Temperature_Sensor"}})
+	dt.AddFeature("supplyTemp", supply)
+	dt.AddFeature("fan", twin.NewFeatureState())
+	dt.AddRelationship("feeds", "vav-1")
+
+	doc := Export(dt, "")
+
+	// The document must be plain JSON
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatalf("Failed to marshal document: %v", err)
+	}
+
+	var decoded map[string]interface{}
+	json.Unmarshal(data, &decoded)
+
+	if decoded["@id"] != "urn:twin:ahu-1" {
+		t.Errorf("Expected @id urn:twin:ahu-1, got %v", decoded["@id"])
+	}
+
+	if types := decoded["@type"].([]interface{}); len(types) != 1 || types[0] != "brick:AHU" {
+		t.Errorf("Expected type brick:AHU, got %v", types)
+	}
+
+	context := decoded["@context"].(map[string]interface{})
+	if context["ex"] != "https://example.com/ontology#" || context["brick"] != WellKnownPrefixes["brick"] {
+		t.Errorf("Unexpected context: %v", context)
+	}
+
+	feeds := decoded["feeds"].([]interface{})
+	if len(feeds) != 1 || feeds[0].(map[string]interface{})["@id"] != "urn:twin:vav-1" {
+		t.Errorf("Expected link to urn:twin:vav-1, got %v", feeds)
+	}
+
+	features := decoded["hasFeature"].([]interface{})
+	if len(features) != 2 {
+		t.Fatalf("Expected 2 features, got %d", len(features))
+	}
+
+	// Features are sorted by ID and fall back to the Feature type
+	fan := features[0].(map[string]interface{})
+	if fan["@id"] != "urn:twin:ahu-1/features/fan" || fan["@type"].([]interface{})[0] != "Feature" {
+		t.Errorf("Unexpected fan node: %v", fan)
+	}
+
+	sensor := features[1].(map[string]interface{})
+	if sensor["@type"].([]interface{})[0] != "brick:Supply_Air_Temperature_Sensor" {
+		t.Errorf("Unexpected sensor type: %v", sensor["@type"])
+	}
+	if sensor["properties"].(map[string]interface{})["value"] != 18.5 {
+		t.Errorf("Unexpected sensor properties: %v", sensor["properties"])
+	}
+
+	// Twins without annotations are exported as Twin below a custom base
+	plain := Export(twin.NewDigitalTwin("pump-1", "pump"), "https://plant.example.com/twins/")
+	if plain["@id"] != "https://plant.example.com/twins/pump-1" || plain["@type"].([]string)[0] != "Twin" {
+		t.Errorf("Unexpected plain document: %v", plain)
+	}
+}
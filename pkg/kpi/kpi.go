@@ -0,0 +1,366 @@
+package kpi
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/history"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// Common errors
+var (
+	ErrInvalidWindow      = errors.New("invalid time window")
+	ErrInvalidConventions = errors.New("invalid KPI conventions")
+)
+
+// DefaultWindow is the time range KPIs are computed over when none is given
+const DefaultWindow = 24 * time.Hour
+
+// MaxWindows is the largest number of windows a time range is split into
+const MaxWindows = 1000
+
+// Conventions name the features, properties and attributes of machine twins
+// that KPIs are computed from. State and counter values are read from history.
+type Conventions struct {
+	StateFeature            string   `json:"stateFeature"`
+	StateProperty           string   `json:"stateProperty"`
+	RunningStates           []string `json:"runningStates"`               // States counted as run time
+	PlannedStopStates       []string `json:"plannedStopStates,omitempty"` // States excluded from planned production time, such as breaks
+	CounterFeature          string   `json:"counterFeature"`
+	TotalCountProperty      string   `json:"totalCountProperty"`      // Counter of all units produced
+	GoodCountProperty       string   `json:"goodCountProperty"`       // Counter of units produced without defects
+	IdealCycleTimeAttribute string   `json:"idealCycleTimeAttribute"` // Attribute holding the seconds per unit at rated speed
+}
+
+// DefaultConventions are used until other conventions are set
+var DefaultConventions = Conventions{
+	StateFeature:            "machine",
+	StateProperty:           "state",
+	RunningStates:           []string{"running"},
+	PlannedStopStates:       []string{"planned_stop", "maintenance"},
+	CounterFeature:          "counters",
+	TotalCountProperty:      "total",
+	GoodCountProperty:       "good",
+	IdealCycleTimeAttribute: "idealCycleTime",
+}
+
+// Validate checks that all names are set and at least one running state is given
+func (c Conventions) Validate() error {
+	names := []struct{ field, value string }{
+		{"stateFeature", c.StateFeature},
+		{"stateProperty", c.StateProperty},
+		{"counterFeature", c.CounterFeature},
+		{"totalCountProperty", c.TotalCountProperty},
+		{"goodCountProperty", c.GoodCountProperty},
+		{"idealCycleTimeAttribute", c.IdealCycleTimeAttribute},
+	}
+	for _, n := range names {
+		if n.value == "" {
+			return fmt.Errorf("%w: %s is required", ErrInvalidConventions, n.field)
+		}
+	}
+	if len(c.RunningStates) == 0 {
+		return fmt.Errorf("%w: at least one running state is required", ErrInvalidConventions)
+	}
+	for _, state := range c.PlannedStopStates {
+		if contains(c.RunningStates, state) {
+			return fmt.Errorf("%w: %q is both a running and a planned stop state", ErrInvalidConventions, state)
+		}
+	}
+	return nil
+}
+
+// Metrics are the OEE figures of a twin or a group of twins over a time window.
+// Times are in seconds. A ratio is null when its denominator is zero, for
+// example when no units were produced or no ideal cycle time is known.
+type Metrics struct {
+	From         time.Time `json:"from"`
+	To           time.Time `json:"to"`
+	PlannedTime  float64   `json:"plannedTime"` // Time with a known state, less planned stops
+	RunTime      float64   `json:"runTime"`
+	TotalCount   float64   `json:"totalCount"`
+	GoodCount    float64   `json:"goodCount"`
+	IdealTime    float64   `json:"idealTime"` // Time the counted units take at the ideal cycle time
+	Availability *float64  `json:"availability"`
+	Performance  *float64  `json:"performance"`
+	Quality      *float64  `json:"quality"`
+	OEE          *float64  `json:"oee"`
+
+	ratedRunTime float64 // Run time of twins with an ideal cycle time
+}
+
+// Report holds the KPIs of a twin or a group over a time range, and over
+// consecutive windows of it when an interval is given
+type Report struct {
+	TwinID string   `json:"twinId,omitempty"`
+	Twins  []string `json:"twins,omitempty"` // Members of a group
+	Metrics
+	Windows []Metrics `json:"windows,omitempty"`
+}
+
+// Calculator computes KPIs of machine twins from property history
+type Calculator struct {
+	registry    *registry.Registry
+	history     *history.Store
+	conventions Conventions
+	mutex       sync.RWMutex
+	now         func() time.Time
+}
+
+// NewCalculator creates a calculator using DefaultConventions
+func NewCalculator(reg *registry.Registry, hist *history.Store) *Calculator {
+	return &Calculator{
+		registry:    reg,
+		history:     hist,
+		conventions: DefaultConventions,
+		now:         time.Now,
+	}
+}
+
+// Conventions returns the conventions KPIs are computed with
+func (c *Calculator) Conventions() Conventions {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.conventions
+}
+
+// SetConventions replaces the conventions KPIs are computed with
+func (c *Calculator) SetConventions(conv Conventions) error {
+	if err := conv.Validate(); err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.conventions = conv
+	return nil
+}
+
+// windows resolves a time range and splits it into consecutive windows of the
+// given interval; the last window ends at to. A zero to is the current time
+// and a zero from is DefaultWindow before to. A zero interval returns no windows.
+func (c *Calculator) windows(from, to time.Time, interval time.Duration) (time.Time, time.Time, [][2]time.Time, error) {
+	if to.IsZero() {
+		to = c.now()
+	}
+	if from.IsZero() {
+		from = to.Add(-DefaultWindow)
+	}
+	if !from.Before(to) {
+		return from, to, nil, fmt.Errorf("%w: from must be before to", ErrInvalidWindow)
+	}
+	if interval < 0 {
+		return from, to, nil, fmt.Errorf("%w: interval must not be negative", ErrInvalidWindow)
+	}
+	if interval == 0 {
+		return from, to, nil, nil
+	}
+	if (to.Sub(from)+interval-1)/interval > MaxWindows {
+		return from, to, nil, fmt.Errorf("%w: at most %d windows are supported", ErrInvalidWindow, MaxWindows)
+	}
+
+	var windows [][2]time.Time
+	for start := from; start.Before(to); start = start.Add(interval) {
+		end := start.Add(interval)
+		if end.After(to) {
+			end = to
+		}
+		windows = append(windows, [2]time.Time{start, end})
+	}
+	return from, to, windows, nil
+}
+
+// Twin computes the KPIs of a twin
+func (c *Calculator) Twin(twinID string, from, to time.Time, interval time.Duration) (Report, error) {
+	dt, err := c.registry.Get(twinID)
+	if err != nil {
+		return Report{}, err
+	}
+
+	report, err := c.Group([]*twin.DigitalTwin{dt}, from, to, interval)
+	if err != nil {
+		return Report{}, err
+	}
+	report.TwinID = twinID
+	report.Twins = nil
+	return report, nil
+}
+
+// Group computes the KPIs of a group of twins. Times and counts are summed
+// over the twins before the ratios are computed, so that machines weigh in
+// by their planned time and output.
+func (c *Calculator) Group(twins []*twin.DigitalTwin, from, to time.Time, interval time.Duration) (Report, error) {
+	from, to, windows, err := c.windows(from, to, interval)
+	if err != nil {
+		return Report{}, err
+	}
+
+	conv := c.Conventions()
+	now := c.now()
+
+	report := Report{Twins: []string{}}
+	for _, dt := range twins {
+		report.Twins = append(report.Twins, dt.ID)
+	}
+	sort.Strings(report.Twins)
+
+	report.Metrics = c.measure(twins, conv, from, to, now)
+	for _, w := range windows {
+		report.Windows = append(report.Windows, c.measure(twins, conv, w[0], w[1], now))
+	}
+	return report, nil
+}
+
+// measure sums the times and counts of twins over a window and computes the ratios
+func (c *Calculator) measure(twins []*twin.DigitalTwin, conv Conventions, from, to, now time.Time) Metrics {
+	m := Metrics{From: from, To: to}
+
+	// Time that has not happened yet is not accounted
+	end := to
+	if now.Before(end) {
+		end = now
+	}
+
+	for _, dt := range twins {
+		planned, run := c.stateTimes(dt.ID, conv, from, end)
+		total := c.increase(dt.ID, conv.CounterFeature, conv.TotalCountProperty, from, to)
+		good := c.increase(dt.ID, conv.CounterFeature, conv.GoodCountProperty, from, to)
+
+		m.PlannedTime += planned
+		m.RunTime += run
+		m.TotalCount += total
+		m.GoodCount += good
+
+		if value, exists := dt.GetAttribute(conv.IdealCycleTimeAttribute); exists {
+			if cycle, ok := toFloat(value); ok && cycle > 0 {
+				m.IdealTime += total * cycle
+				m.ratedRunTime += run
+			}
+		}
+	}
+
+	m.Availability = ratio(m.RunTime, m.PlannedTime)
+	m.Performance = ratio(m.IdealTime, m.ratedRunTime)
+	m.Quality = ratio(m.GoodCount, m.TotalCount)
+	if m.Availability != nil && m.Performance != nil && m.Quality != nil {
+		oee := *m.Availability * *m.Performance * *m.Quality
+		m.OEE = &oee
+	}
+	return m
+}
+
+// stateTimes returns the planned production time and run time of a twin in
+// seconds. Time before the first known state is not accounted.
+func (c *Calculator) stateTimes(twinID string, conv Conventions, from, to time.Time) (planned, run float64) {
+	if !from.Before(to) {
+		return 0, 0
+	}
+
+	var state interface{}
+	known := false
+	if point, err := c.history.At(twinID, conv.StateFeature, conv.StateProperty, from, history.MethodPrevious); err == nil {
+		state, known = point.Value, true
+	}
+
+	account := func(start, end time.Time) {
+		if !known {
+			return
+		}
+		seconds := end.Sub(start).Seconds()
+		switch s := fmt.Sprint(state); {
+		case contains(conv.RunningStates, s):
+			planned += seconds
+			run += seconds
+		case !contains(conv.PlannedStopStates, s):
+			planned += seconds
+		}
+	}
+
+	cursor := from
+	for _, sample := range c.history.Query(twinID, conv.StateFeature, conv.StateProperty, from, to) {
+		if !sample.Timestamp.After(cursor) {
+			continue
+		}
+		account(cursor, sample.Timestamp)
+		cursor = sample.Timestamp
+		state, known = sample.Value, true
+	}
+	account(cursor, to)
+	return planned, run
+}
+
+// increase returns how much a counter grew within a window. A counter that
+// drops is taken to have been reset to zero. Without a value before the
+// window, the first value within it is the baseline.
+func (c *Calculator) increase(twinID, featureID, key string, from, to time.Time) float64 {
+	var last float64
+	known := false
+	if point, err := c.history.At(twinID, featureID, key, from, history.MethodPrevious); err == nil {
+		last, known = toFloat(point.Value)
+	}
+
+	var sum float64
+	for _, sample := range c.history.Query(twinID, featureID, key, from, to) {
+		if !sample.Timestamp.After(from) {
+			continue
+		}
+		value, ok := toFloat(sample.Value)
+		if !ok {
+			continue
+		}
+
+		switch {
+		case !known:
+		case value >= last:
+			sum += value - last
+		default:
+			sum += value
+		}
+		last, known = value, true
+	}
+	return sum
+}
+
+// ratio divides two sums, returning nil when the denominator is zero
+func ratio(numerator, denominator float64) *float64 {
+	if denominator <= 0 {
+		return nil
+	}
+	r := numerator / denominator
+	return &r
+}
+
+// contains reports whether a list holds a value
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// toFloat converts numeric values to float64
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,170 @@
+package kpi
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/history"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+var base = time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC)
+
+// setup creates a press that runs for 6 of 8 hours with a 1 hour planned
+// break, producing 600 units of which 570 are good at 30 seconds per unit
+func setup() (*Calculator, *history.Store) {
+	reg := registry.NewRegistry()
+	hist := history.NewStore(history.DefaultCapacity)
+
+	press := twin.NewDigitalTwin("press-1", "press")
+	press.SetAttribute("idealCycleTime", 30.0)
+	reg.Create(press)
+
+	states := []struct {
+		at    time.Duration
+		state string
+	}{
+		{0, "running"},
+		{3 * time.Hour, "planned_stop"},
+		{4 * time.Hour, "running"},
+		{7 * time.Hour, "down"},
+	}
+	for _, s := range states {
+		hist.Record("press-1", "machine", "state", s.state, base.Add(s.at))
+	}
+
+	hist.Record("press-1", "counters", "total", 1000.0, base.Add(-time.Minute))
+	hist.Record("press-1", "counters", "good", 900.0, base.Add(-time.Minute))
+	hist.Record("press-1", "counters", "total", 1300.0, base.Add(3*time.Hour))
+	hist.Record("press-1", "counters", "good", 1190.0, base.Add(3*time.Hour))
+	// The counters are reset during the break
+	hist.Record("press-1", "counters", "total", 300.0, base.Add(7*time.Hour))
+	hist.Record("press-1", "counters", "good", 280.0, base.Add(7*time.Hour))
+
+	c := NewCalculator(reg, hist)
+	c.now = func() time.Time { return base.Add(24 * time.Hour) }
+	return c, hist
+}
+
+func approx(t *testing.T, name string, got *float64, want float64) {
+	t.Helper()
+	if got == nil || math.Abs(*got-want) > 1e-9 {
+		t.Errorf("Expected %s %v, got %v", name, want, got)
+	}
+}
+
+func TestTwin(t *testing.T) {
+	c, _ := setup()
+
+	report, err := c.Twin("press-1", base, base.Add(8*time.Hour), 0)
+	if err != nil {
+		t.Fatalf("Failed to compute KPIs: %v", err)
+	}
+
+	if report.PlannedTime != 7*3600 || report.RunTime != 6*3600 {
+		t.Errorf("Expected 7h planned and 6h run time, got %v and %v", report.PlannedTime, report.RunTime)
+	}
+	if report.TotalCount != 600 || report.GoodCount != 570 {
+		t.Errorf("Expected 600 units, 570 good, got %v and %v", report.TotalCount, report.GoodCount)
+	}
+
+	approx(t, "availability", report.Availability, 6.0/7)
+	approx(t, "performance", report.Performance, 600*30.0/(6*3600))
+	approx(t, "quality", report.Quality, 570.0/600)
+	approx(t, "OEE", report.OEE, 6.0/7*(600*30.0/(6*3600))*(570.0/600))
+
+	if _, err := c.Twin("missing", base, base.Add(time.Hour), 0); err != registry.ErrTwinNotFound {
+		t.Errorf("Expected ErrTwinNotFound, got %v", err)
+	}
+}
+
+func TestWindows(t *testing.T) {
+	c, _ := setup()
+
+	report, err := c.Twin("press-1", base, base.Add(8*time.Hour), 4*time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to compute KPIs: %v", err)
+	}
+	if len(report.Windows) != 2 {
+		t.Fatalf("Expected 2 windows, got %d", len(report.Windows))
+	}
+
+	first, second := report.Windows[0], report.Windows[1]
+	if first.RunTime != 3*3600 || first.TotalCount != 300 {
+		t.Errorf("Unexpected first window %+v", first)
+	}
+	if second.RunTime != 3*3600 || second.TotalCount != 300 {
+		t.Errorf("Unexpected second window %+v", second)
+	}
+
+	invalid := []struct {
+		from, to time.Time
+		interval time.Duration
+	}{
+		{base, base, 0},
+		{base, base.Add(time.Hour), -time.Minute},
+		{base, base.Add(time.Hour), time.Millisecond},
+	}
+	for _, w := range invalid {
+		if _, err := c.Twin("press-1", w.from, w.to, w.interval); !errors.Is(err, ErrInvalidWindow) {
+			t.Errorf("Expected ErrInvalidWindow for %+v, got %v", w, err)
+		}
+	}
+}
+
+func TestGroup(t *testing.T) {
+	c, hist := setup()
+
+	// A second press without an ideal cycle time and without output
+	press := twin.NewDigitalTwin("press-2", "press")
+	c.registry.Create(press)
+	hist.Record("press-2", "machine", "state", "down", base)
+
+	press1, _ := c.registry.Get("press-1")
+	report, err := c.Group([]*twin.DigitalTwin{press, press1}, base, base.Add(8*time.Hour), 0)
+	if err != nil {
+		t.Fatalf("Failed to compute KPIs: %v", err)
+	}
+
+	if len(report.Twins) != 2 || report.Twins[0] != "press-1" {
+		t.Errorf("Expected sorted group members, got %v", report.Twins)
+	}
+	approx(t, "availability", report.Availability, 6.0/15)
+	// Performance only considers twins with an ideal cycle time
+	approx(t, "performance", report.Performance, 600*30.0/(6*3600))
+
+	// Ratios without a denominator are null
+	report, _ = c.Twin("press-2", base, base.Add(8*time.Hour), 0)
+	if report.Availability == nil || *report.Availability != 0 || report.Quality != nil || report.OEE != nil {
+		t.Errorf("Unexpected metrics of an idle press %+v", report.Metrics)
+	}
+}
+
+func TestConventions(t *testing.T) {
+	c, _ := setup()
+
+	invalid := []Conventions{
+		{},
+		{StateFeature: "m", StateProperty: "s", CounterFeature: "c", TotalCountProperty: "t", GoodCountProperty: "g", IdealCycleTimeAttribute: "i"},
+		{StateFeature: "m", StateProperty: "s", RunningStates: []string{"on"}, PlannedStopStates: []string{"on"}, CounterFeature: "c", TotalCountProperty: "t", GoodCountProperty: "g", IdealCycleTimeAttribute: "i"},
+	}
+	for _, conv := range invalid {
+		if err := c.SetConventions(conv); !errors.Is(err, ErrInvalidConventions) {
+			t.Errorf("Expected ErrInvalidConventions for %+v, got %v", conv, err)
+		}
+	}
+
+	conv := DefaultConventions
+	conv.RunningStates = []string{"running", "down"}
+	if err := c.SetConventions(conv); err != nil {
+		t.Fatalf("Failed to set conventions: %v", err)
+	}
+
+	report, _ := c.Twin("press-1", base, base.Add(8*time.Hour), 0)
+	if report.RunTime != 7*3600 {
+		t.Errorf("Expected the down state to count as run time, got %v", report.RunTime)
+	}
+}
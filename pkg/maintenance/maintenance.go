@@ -0,0 +1,327 @@
+package maintenance
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/eventbus"
+)
+
+// Common errors
+var (
+	ErrWindowNotFound = errors.New("maintenance window not found")
+	ErrInvalidWindow  = errors.New("invalid maintenance window")
+)
+
+// Event topics published when a window starts and ends
+const (
+	TopicStarted = "maintenance.started"
+	TopicEnded   = "maintenance.ended"
+)
+
+// DefaultCheckInterval is how often windows are checked for starting and ending
+const DefaultCheckInterval = 15 * time.Second
+
+// MaxAudit is the number of suppressed events kept per window; older
+// events are only counted
+const MaxAudit = 1000
+
+// Window is a time range during which alerts about its twins are suppressed
+// and rule actions withheld. Twins are given directly or through groups.
+type Window struct {
+	ID         string    `json:"id"`
+	Twins      []string  `json:"twins,omitempty"`
+	Groups     []string  `json:"groups,omitempty"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	Reason     string    `json:"reason,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+	Suppressed int       `json:"suppressed"` // Number of suppressed events
+}
+
+// Active reports whether the window covers a point in time
+func (w Window) Active(t time.Time) bool {
+	return !t.Before(w.Start) && t.Before(w.End)
+}
+
+// SuppressedEvent is an audit record of an event suppressed by a window
+type SuppressedEvent struct {
+	Time    time.Time   `json:"time"`
+	Topic   string      `json:"topic"`
+	TwinID  string      `json:"twinId"`
+	Payload interface{} `json:"payload,omitempty"`
+}
+
+// Membership tells whether a twin is in a group
+type Membership interface {
+	Contains(group, twinID string) (bool, error)
+}
+
+// window holds a window with its audit and start and end notifications
+type window struct {
+	Window
+	twins   map[string]bool
+	audit   []SuppressedEvent // Oldest first, at most MaxAudit
+	started bool
+	ended   bool
+}
+
+// Manager keeps maintenance windows and decides which events they suppress
+type Manager struct {
+	pubsub  eventbus.Publisher
+	groups  Membership
+	windows map[string]*window
+	mutex   sync.RWMutex
+	now     func() time.Time
+}
+
+// NewManager creates a maintenance window manager resolving groups through
+// the given membership, which may be nil if windows only list twins
+func NewManager(pubsub eventbus.Publisher, groups Membership) *Manager {
+	return &Manager{
+		pubsub:  pubsub,
+		groups:  groups,
+		windows: make(map[string]*window),
+		now:     time.Now,
+	}
+}
+
+// Create adds a window, assigning its ID
+func (m *Manager) Create(w Window) (Window, error) {
+	if len(w.Twins) == 0 && len(w.Groups) == 0 {
+		return Window{}, fmt.Errorf("%w: twins or groups are required", ErrInvalidWindow)
+	}
+	if w.Start.IsZero() || w.End.IsZero() {
+		return Window{}, fmt.Errorf("%w: start and end are required", ErrInvalidWindow)
+	}
+	if !w.End.After(w.Start) {
+		return Window{}, fmt.Errorf("%w: end must be after start", ErrInvalidWindow)
+	}
+	if len(w.Groups) > 0 && m.groups == nil {
+		return Window{}, fmt.Errorf("%w: groups are not available", ErrInvalidWindow)
+	}
+
+	twins := make(map[string]bool)
+	for _, id := range w.Twins {
+		if id == "" {
+			return Window{}, fmt.Errorf("%w: empty twin ID", ErrInvalidWindow)
+		}
+		twins[id] = true
+	}
+	for _, name := range w.Groups {
+		if name == "" {
+			return Window{}, fmt.Errorf("%w: empty group name", ErrInvalidWindow)
+		}
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return Window{}, err
+	}
+
+	w.ID = hex.EncodeToString(id)
+	w.Twins = append([]string(nil), w.Twins...)
+	w.Groups = append([]string(nil), w.Groups...)
+	w.CreatedAt = m.now()
+	w.Suppressed = 0
+
+	m.mutex.Lock()
+	m.windows[w.ID] = &window{Window: w, twins: twins}
+	m.mutex.Unlock()
+
+	m.Check()
+	return w, nil
+}
+
+// Delete removes a window, ending it early if it is active
+func (m *Manager) Delete(id string) error {
+	m.mutex.Lock()
+	w, exists := m.windows[id]
+	if !exists {
+		m.mutex.Unlock()
+		return ErrWindowNotFound
+	}
+	delete(m.windows, id)
+	m.mutex.Unlock()
+
+	if w.started && !w.ended {
+		m.publish(TopicEnded, w.Window)
+	}
+	return nil
+}
+
+// Get returns a window
+func (m *Manager) Get(id string) (Window, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	w, exists := m.windows[id]
+	if !exists {
+		return Window{}, ErrWindowNotFound
+	}
+	return w.Window, nil
+}
+
+// List returns all windows ordered by start time
+func (m *Manager) List() []Window {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	windows := make([]Window, 0, len(m.windows))
+	for _, w := range m.windows {
+		windows = append(windows, w.Window)
+	}
+
+	sort.Slice(windows, func(i, j int) bool {
+		if !windows[i].Start.Equal(windows[j].Start) {
+			return windows[i].Start.Before(windows[j].Start)
+		}
+		return windows[i].ID < windows[j].ID
+	})
+	return windows
+}
+
+// Audit returns the events a window suppressed, oldest first
+func (m *Manager) Audit(id string) ([]SuppressedEvent, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	w, exists := m.windows[id]
+	if !exists {
+		return nil, ErrWindowNotFound
+	}
+	return append([]SuppressedEvent(nil), w.audit...), nil
+}
+
+// Active returns the windows currently covering a twin
+func (m *Manager) Active(twinID string) []Window {
+	now := m.now()
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	var active []Window
+	for _, w := range m.windows {
+		if w.Active(now) && m.covers(w, twinID) {
+			active = append(active, w.Window)
+		}
+	}
+
+	sort.Slice(active, func(i, j int) bool { return active[i].ID < active[j].ID })
+	return active
+}
+
+// Suppress reports whether an event about a twin is suppressed by an active
+// window, recording it in the audit of the window if so
+func (m *Manager) Suppress(topic, twinID string, payload interface{}) bool {
+	if twinID == "" {
+		return false
+	}
+	now := m.now()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var match *window
+	for _, w := range m.windows {
+		if w.Active(now) && m.covers(w, twinID) && (match == nil || w.ID < match.ID) {
+			match = w
+		}
+	}
+	if match == nil {
+		return false
+	}
+
+	match.Suppressed++
+	if len(match.audit) == MaxAudit {
+		match.audit = append(match.audit[:0], match.audit[1:]...)
+	}
+	match.audit = append(match.audit, SuppressedEvent{
+		Time:    now,
+		Topic:   topic,
+		TwinID:  twinID,
+		Payload: payload,
+	})
+	return true
+}
+
+// covers reports whether a window applies to a twin; the caller must hold the mutex
+func (m *Manager) covers(w *window, twinID string) bool {
+	if w.twins[twinID] {
+		return true
+	}
+	for _, name := range w.Groups {
+		if ok, _ := m.groups.Contains(name, twinID); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Check publishes an event for every window that started or ended since the
+// last check. Alerts resume on their own once a window ends; the event
+// tells subscribers that it did.
+func (m *Manager) Check() {
+	now := m.now()
+
+	m.mutex.Lock()
+	var started, ended []Window
+	for _, w := range m.windows {
+		if !w.started && !now.Before(w.Start) && now.Before(w.End) {
+			w.started = true
+			started = append(started, w.Window)
+		}
+		if !w.ended && !now.Before(w.End) {
+			if w.started {
+				ended = append(ended, w.Window)
+			}
+			w.started = true
+			w.ended = true
+		}
+	}
+	m.mutex.Unlock()
+
+	for _, w := range started {
+		m.publish(TopicStarted, w)
+	}
+	for _, w := range ended {
+		m.publish(TopicEnded, w)
+	}
+}
+
+// publish announces the start or end of a window
+func (m *Manager) publish(topic string, w Window) {
+	if m.pubsub == nil {
+		return
+	}
+	m.pubsub.Publish(topic, map[string]interface{}{
+		"windowId":   w.ID,
+		"twins":      w.Twins,
+		"groups":     w.Groups,
+		"start":      w.Start,
+		"end":        w.End,
+		"reason":     w.Reason,
+		"suppressed": w.Suppressed,
+	})
+}
+
+// Run checks windows at the given interval until the context is cancelled
+func (m *Manager) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.Check()
+		}
+	}
+}
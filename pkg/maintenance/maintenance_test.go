@@ -0,0 +1,132 @@
+package maintenance
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+)
+
+// staticGroups is a membership of fixed groups
+type staticGroups map[string][]string
+
+func (g staticGroups) Contains(group, twinID string) (bool, error) {
+	for _, id := range g[group] {
+		if id == twinID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func setupManager(t *testing.T) (*Manager, *time.Time, chan messaging_sim.Message) {
+	t.Helper()
+	pubsub := messaging_sim.NewPubSub()
+	events := pubsub.Subscribe("maintenance.#")
+
+	now := time.Date(2026, 5, 1, 8, 0, 0, 0, time.UTC)
+	m := NewManager(pubsub, staticGroups{"line-a": {"pump-2"}})
+	m.now = func() time.Time { return now }
+	return m, &now, events
+}
+
+func TestCreateValidation(t *testing.T) {
+	m, now, _ := setupManager(t)
+	start, end := *now, now.Add(time.Hour)
+
+	invalid := []Window{
+		{Start: start, End: end},
+		{Twins: []string{"pump-1"}, End: end},
+		{Twins: []string{"pump-1"}, Start: end, End: start},
+		{Twins: []string{""}, Start: start, End: end},
+		{Groups: []string{""}, Start: start, End: end},
+	}
+	for _, w := range invalid {
+		if _, err := m.Create(w); !errors.Is(err, ErrInvalidWindow) {
+			t.Errorf("Expected ErrInvalidWindow for %+v, got %v", w, err)
+		}
+	}
+
+	if _, err := NewManager(nil, nil).Create(Window{Groups: []string{"line-a"}, Start: start, End: end}); !errors.Is(err, ErrInvalidWindow) {
+		t.Errorf("Expected ErrInvalidWindow for groups without a membership, got %v", err)
+	}
+}
+
+func TestSuppress(t *testing.T) {
+	m, now, events := setupManager(t)
+
+	w, err := m.Create(Window{Twins: []string{"pump-1"}, Groups: []string{"line-a"}, Start: now.Add(time.Hour), End: now.Add(2 * time.Hour), Reason: "valve swap"})
+	if err != nil {
+		t.Fatalf("Failed to create window: %v", err)
+	}
+	if w.ID == "" || !w.CreatedAt.Equal(*now) {
+		t.Errorf("Expected an ID and creation time, got %+v", w)
+	}
+
+	// Nothing is suppressed before the window starts
+	if m.Suppress("alarm.raised", "pump-1", nil) {
+		t.Error("Expected no suppression before the window")
+	}
+
+	*now = now.Add(90 * time.Minute)
+	m.Check()
+	if msg := <-events; msg.Topic != TopicStarted {
+		t.Errorf("Expected %s, got %s", TopicStarted, msg.Topic)
+	}
+
+	for _, id := range []string{"pump-1", "pump-2"} {
+		if !m.Suppress("alarm.raised", id, map[string]string{"twinId": id}) {
+			t.Errorf("Expected the alerts of %s to be suppressed", id)
+		}
+	}
+	if m.Suppress("alarm.raised", "pump-3", nil) || m.Suppress("alarm.raised", "", nil) {
+		t.Error("Expected only covered twins to be suppressed")
+	}
+	if active := m.Active("pump-2"); len(active) != 1 || active[0].ID != w.ID {
+		t.Errorf("Expected the window to be active for pump-2, got %v", active)
+	}
+
+	audit, _ := m.Audit(w.ID)
+	if len(audit) != 2 || audit[1].TwinID != "pump-2" || audit[1].Topic != "alarm.raised" {
+		t.Errorf("Unexpected audit %+v", audit)
+	}
+
+	// Alerts resume when the window ends
+	*now = now.Add(time.Hour)
+	m.Check()
+	msg := <-events
+	if payload := msg.Payload.(map[string]interface{}); msg.Topic != TopicEnded || payload["suppressed"] != 2 {
+		t.Errorf("Unexpected event %s %v", msg.Topic, msg.Payload)
+	}
+	if m.Suppress("alarm.raised", "pump-1", nil) {
+		t.Error("Expected no suppression after the window")
+	}
+
+	if err := m.Delete(w.ID); err != nil {
+		t.Errorf("Failed to delete window: %v", err)
+	}
+	if _, err := m.Get(w.ID); err != ErrWindowNotFound {
+		t.Errorf("Expected ErrWindowNotFound, got %v", err)
+	}
+}
+
+func TestDeleteEndsActiveWindow(t *testing.T) {
+	m, now, events := setupManager(t)
+
+	w, _ := m.Create(Window{Twins: []string{"pump-1"}, Start: *now, End: now.Add(time.Hour)})
+	if msg := <-events; msg.Topic != TopicStarted {
+		t.Errorf("Expected %s on creating an active window, got %s", TopicStarted, msg.Topic)
+	}
+
+	m.Delete(w.ID)
+	if msg := <-events; msg.Topic != TopicEnded {
+		t.Errorf("Expected %s on deleting an active window, got %s", TopicEnded, msg.Topic)
+	}
+	if m.Suppress("alarm.raised", "pump-1", nil) {
+		t.Error("Expected no suppression after deleting the window")
+	}
+	if len(m.List()) != 0 {
+		t.Errorf("Expected no windows, got %v", m.List())
+	}
+}
@@ -0,0 +1,308 @@
+package manage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/ngsild"
+	"github.com/aleka07/go-digital-twin/pkg/script"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// ErrInvalidResource is returned for desired states that cannot be applied
+var ErrInvalidResource = errors.New("invalid resource")
+
+// Action is what applying a desired state does to a resource
+type Action string
+
+// Actions
+const (
+	ActionCreate Action = "create"
+	ActionUpdate Action = "update"
+	ActionDelete Action = "delete"
+	ActionNone   Action = "none"
+)
+
+// Change is a difference between the current and the desired state of a
+// resource. Paths are dot-separated member names of the normalized state.
+type Change struct {
+	Path string      `json:"path"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// Result reports the outcome or, for dry runs, the plan of a management request
+type Result struct {
+	Action  Action      `json:"action"`
+	Changes []Change    `json:"changes"`
+	DryRun  bool        `json:"dryRun"`
+	State   interface{} `json:"state,omitempty"` // Normalized state after the request
+}
+
+// Twin is the managed state of a digital twin. Reported properties,
+// lifecycle, relationships and timestamps are maintained by devices and the
+// server, so they are not part of it.
+type Twin struct {
+	ID         string                 `json:"id"`
+	Type       string                 `json:"type"`
+	Definition string                 `json:"definition,omitempty"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+	Features   map[string]Feature     `json:"features,omitempty"`
+}
+
+// Feature is the managed state of a feature
+type Feature struct {
+	Definition        []string               `json:"definition,omitempty"`
+	DesiredProperties map[string]interface{} `json:"desiredProperties,omitempty"`
+}
+
+// Plan compares the normalized current state of a resource with its desired
+// state. A nil current state plans a create, a nil desired state a delete.
+func Plan(current, desired interface{}) Result {
+	result := Result{Action: ActionNone, Changes: Diff(current, desired), State: desired}
+
+	switch {
+	case current == nil && desired == nil:
+	case current == nil:
+		result.Action = ActionCreate
+	case desired == nil:
+		result.Action = ActionDelete
+	case len(result.Changes) > 0:
+		result.Action = ActionUpdate
+	}
+	return result
+}
+
+// NormalizeTwin returns the managed state of a twin. Features without a
+// definition or desired properties are omitted, as are empty maps and the
+// system attributes the server manages, so that the state reads back
+// exactly as it was written.
+func NormalizeTwin(dt *twin.DigitalTwin) Twin {
+	attributes := dt.GetAllAttributes()
+	delete(attributes, twin.SystemAttribute)
+	t := Twin{
+		ID:         dt.ID,
+		Type:       dt.Type,
+		Definition: dt.GetDefinition(),
+		Attributes: normalizeMap(attributes),
+	}
+
+	for featureID, feature := range dt.GetAllFeatures() {
+		f := Feature{
+			Definition:        normalizeDefinition(feature.GetDefinition()),
+			DesiredProperties: normalizeMap(feature.GetAllDesiredProperties()),
+		}
+		if f.Definition == nil && f.DesiredProperties == nil {
+			continue
+		}
+
+		if t.Features == nil {
+			t.Features = make(map[string]Feature)
+		}
+		t.Features[featureID] = f
+	}
+	return t
+}
+
+// ValidateTwin checks the desired state of a twin
+func ValidateTwin(t Twin) error {
+	if t.ID == "" || t.Type == "" {
+		return fmt.Errorf("%w: id and type are required", ErrInvalidResource)
+	}
+	if twin.CheckAttributes(t.Attributes) != nil {
+		return fmt.Errorf("%w: attribute %s is reserved for the server", ErrInvalidResource, twin.SystemAttribute)
+	}
+	return nil
+}
+
+// ApplyTwin brings a twin in line with its desired state. The desired state
+// is authoritative: attributes it does not list are removed, except for the
+// system attributes, and features it does not list lose their definition
+// and desired properties. Such features are removed unless they hold
+// reported properties.
+func ApplyTwin(dt *twin.DigitalTwin, desired Twin) {
+	dt.Type = desired.Type
+	dt.SetDefinition(desired.Definition)
+
+	for key := range dt.GetAllAttributes() {
+		if _, exists := desired.Attributes[key]; !exists && !twin.IsReservedAttribute(key) {
+			dt.RemoveAttribute(key)
+		}
+	}
+	for key, value := range desired.Attributes {
+		dt.SetAttribute(key, value)
+	}
+
+	for featureID, feature := range dt.GetAllFeatures() {
+		if _, exists := desired.Features[featureID]; exists {
+			continue
+		}
+		if len(feature.GetAllProperties()) == 0 {
+			dt.RemoveFeature(featureID)
+			continue
+		}
+		applyFeature(feature, Feature{})
+	}
+
+	for featureID, f := range desired.Features {
+		feature, exists := dt.GetFeature(featureID)
+		if !exists {
+			feature = twin.NewFeatureState()
+			dt.AddFeature(featureID, feature)
+		}
+		applyFeature(feature, f)
+	}
+}
+
+// applyFeature brings a feature in line with its desired state
+func applyFeature(feature *twin.FeatureState, desired Feature) {
+	if !reflect.DeepEqual(normalizeDefinition(feature.GetDefinition()), desired.Definition) {
+		feature.SetDefinition(desired.Definition)
+	}
+
+	for key := range feature.GetAllDesiredProperties() {
+		if _, exists := desired.DesiredProperties[key]; !exists {
+			feature.RemoveDesiredProperty(key)
+		}
+	}
+	for key, value := range desired.DesiredProperties {
+		if current, ok := feature.GetDesiredProperty(key); !ok || !reflect.DeepEqual(current, value) {
+			feature.SetDesiredProperty(key, value)
+		}
+	}
+}
+
+// NormalizeScript returns the managed state of a script. The timeout is
+// written in its canonical form, so "1000ms" reads back as "1s".
+func NormalizeScript(s script.Script) script.Script {
+	if timeout, err := time.ParseDuration(s.Timeout); err == nil {
+		s.Timeout = timeout.String()
+	}
+	return s
+}
+
+// NormalizeSubscription returns the managed state of a subscription without
+// the notification status maintained by the server
+func NormalizeSubscription(sub ngsild.Subscription) ngsild.Subscription {
+	sub.Type = "Subscription"
+	sub.Notification = ngsild.NotificationParams{
+		Attributes: sub.Notification.Attributes,
+		Endpoint:   sub.Notification.Endpoint,
+		Transforms: sub.Notification.Transforms,
+	}
+	if len(sub.Entities) == 0 {
+		sub.Entities = nil
+	}
+	if len(sub.WatchedAttributes) == 0 {
+		sub.WatchedAttributes = nil
+	}
+	if len(sub.Notification.Attributes) == 0 {
+		sub.Notification.Attributes = nil
+	}
+	if len(sub.Notification.Transforms) == 0 {
+		sub.Notification.Transforms = nil
+	}
+	return sub
+}
+
+// ParseDryRun reads the dryRun query parameter. Missing values are false.
+func ParseDryRun(raw string) (bool, error) {
+	if raw == "" {
+		return false, nil
+	}
+	dryRun, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("%w: invalid dryRun %q", ErrInvalidResource, raw)
+	}
+	return dryRun, nil
+}
+
+// Diff lists the differences between two states in path order. States are
+// compared in their JSON form, so numbers compare equal regardless of their
+// Go type. Objects are compared member by member, other values as a whole.
+func Diff(old, new interface{}) []Change {
+	before := flatten(old)
+	after := flatten(new)
+
+	paths := make(map[string]bool, len(before)+len(after))
+	for path := range before {
+		paths[path] = true
+	}
+	for path := range after {
+		paths[path] = true
+	}
+
+	sorted := make([]string, 0, len(paths))
+	for path := range paths {
+		sorted = append(sorted, path)
+	}
+	sort.Strings(sorted)
+
+	changes := []Change{}
+	for _, path := range sorted {
+		o, n := before[path], after[path]
+		if !reflect.DeepEqual(o, n) {
+			changes = append(changes, Change{Path: path, Old: o, New: n})
+		}
+	}
+	return changes
+}
+
+// flatten maps the leaf paths of the JSON form of a value to their values
+func flatten(v interface{}) map[string]interface{} {
+	result := make(map[string]interface{})
+	if v == nil {
+		return result
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return result
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return result
+	}
+
+	flattenInto(result, "", doc)
+	return result
+}
+
+// flattenInto adds the leaves of a decoded JSON value to result
+func flattenInto(result map[string]interface{}, prefix string, v interface{}) {
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		result[prefix] = v
+		return
+	}
+
+	for key, value := range obj {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+		flattenInto(result, path, value)
+	}
+}
+
+// normalizeMap returns nil for empty maps
+func normalizeMap(m map[string]interface{}) map[string]interface{} {
+	if len(m) == 0 {
+		return nil
+	}
+	return m
+}
+
+// normalizeDefinition returns nil for empty definitions
+func normalizeDefinition(definition []string) []string {
+	if len(definition) == 0 {
+		return nil
+	}
+	return definition
+}
@@ -0,0 +1,164 @@
+package manage
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/ngsild"
+	"github.com/aleka07/go-digital-twin/pkg/script"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestNormalizeTwin(t *testing.T) {
+	dt := twin.NewDigitalTwin("pump-1", "pump")
+	dt.SetAttribute("serial", "P-100")
+
+	control := twin.NewFeatureState()
+	control.SetDefinition([]string{"org.example:Control:1.0"})
+	control.SetDesiredProperty("setpoint", 10.0)
+	control.SetProperty("pressure", 2.5)
+	dt.AddFeature("control", control)
+
+	status := twin.NewFeatureState()
+	status.SetProperty("running", true)
+	dt.AddFeature("status", status)
+
+	got := NormalizeTwin(dt)
+	want := Twin{
+		ID:         "pump-1",
+		Type:       "pump",
+		Attributes: map[string]interface{}{"serial": "P-100"},
+		Features: map[string]Feature{
+			"control": {Definition: []string{"org.example:Control:1.0"}, DesiredProperties: map[string]interface{}{"setpoint": 10.0}},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+
+	if got := NormalizeTwin(twin.NewDigitalTwin("valve-1", "valve")); got.Attributes != nil || got.Features != nil {
+		t.Errorf("Expected empty maps to be omitted, got %+v", got)
+	}
+}
+
+func TestApplyTwin(t *testing.T) {
+	dt := twin.NewDigitalTwin("pump-1", "pump")
+	dt.SetAttribute("serial", "P-100")
+	dt.SetAttribute("location", "hall 1")
+
+	control := twin.NewFeatureState()
+	control.SetDesiredProperty("setpoint", 10.0)
+	control.SetDesiredProperty("mode", "auto")
+	dt.AddFeature("control", control)
+
+	legacy := twin.NewFeatureState()
+	legacy.SetDesiredProperty("enabled", true)
+	legacy.SetProperty("temperature", 21.0)
+	dt.AddFeature("legacy", legacy)
+
+	unused := twin.NewFeatureState()
+	unused.SetDefinition([]string{"org.example:Unused:1.0"})
+	dt.AddFeature("unused", unused)
+
+	desired := Twin{
+		ID:         "pump-1",
+		Type:       "pump",
+		Definition: "org.example:Pump:2.0",
+		Attributes: map[string]interface{}{"serial": "P-200"},
+		Features: map[string]Feature{
+			"control": {DesiredProperties: map[string]interface{}{"setpoint": 12.0}},
+			"alarm":   {Definition: []string{"org.example:Alarm:1.0"}},
+		},
+	}
+	ApplyTwin(dt, desired)
+
+	if got := NormalizeTwin(dt); !reflect.DeepEqual(got, desired) {
+		t.Errorf("Expected the desired state %+v, got %+v", desired, got)
+	}
+
+	// System attributes are not managed
+	dt.SetSystem(twin.SystemSource, "api")
+	ApplyTwin(dt, desired)
+	if got := NormalizeTwin(dt); !reflect.DeepEqual(got, desired) {
+		t.Errorf("Expected system attributes to be left out, got %+v", got)
+	}
+	if v, _ := dt.GetSystem(twin.SystemSource); v != "api" {
+		t.Errorf("Expected system attributes to be kept, got %v", v)
+	}
+	desired.Attributes[twin.SystemAttribute] = map[string]interface{}{"owner": "me"}
+	if err := ValidateTwin(desired); !errors.Is(err, ErrInvalidResource) {
+		t.Errorf("Expected ErrInvalidResource, got %v", err)
+	}
+
+	// Reported properties keep their feature
+	if v, _ := legacy.GetProperty("temperature"); v != 21.0 {
+		t.Errorf("Expected the reported temperature to be kept, got %v", v)
+	}
+	if _, exists := dt.GetFeature("unused"); exists {
+		t.Error("Expected the unused feature to be removed")
+	}
+}
+
+func TestPlan(t *testing.T) {
+	current := Twin{ID: "pump-1", Type: "pump", Attributes: map[string]interface{}{"serial": "P-100", "ratedFlow": 40.0}}
+	desired := Twin{ID: "pump-1", Type: "pump", Attributes: map[string]interface{}{"serial": "P-100", "ratedFlow": 40}}
+
+	// Numbers compare by value, not by Go type
+	if result := Plan(current, desired); result.Action != ActionNone || len(result.Changes) != 0 {
+		t.Errorf("Expected no changes, got %+v", result)
+	}
+
+	desired.Attributes = map[string]interface{}{"serial": "P-200", "location": "hall 1"}
+	result := Plan(current, desired)
+	want := []Change{
+		{Path: "attributes.location", New: "hall 1"},
+		{Path: "attributes.ratedFlow", Old: 40.0},
+		{Path: "attributes.serial", Old: "P-100", New: "P-200"},
+	}
+	if result.Action != ActionUpdate || !reflect.DeepEqual(result.Changes, want) {
+		t.Errorf("Expected update %+v, got %+v", want, result)
+	}
+
+	if result := Plan(nil, desired); result.Action != ActionCreate || len(result.Changes) != 4 {
+		t.Errorf("Expected a create with 4 changes, got %+v", result)
+	}
+	if result := Plan(current, nil); result.Action != ActionDelete || result.State != nil {
+		t.Errorf("Expected a delete, got %+v", result)
+	}
+	if result := Plan(nil, nil); result.Action != ActionNone {
+		t.Errorf("Expected no action, got %+v", result)
+	}
+}
+
+func TestNormalizeScriptAndSubscription(t *testing.T) {
+	s := NormalizeScript(script.Script{Name: "rule", Timeout: "1000ms"})
+	if s.Timeout != "1s" {
+		t.Errorf("Expected timeout 1s, got %q", s.Timeout)
+	}
+
+	sub := NormalizeSubscription(ngsild.Subscription{
+		ID:                "urn:ngsi-ld:Subscription:s",
+		WatchedAttributes: []string{},
+		Notification:      ngsild.NotificationParams{Endpoint: ngsild.Endpoint{URI: "http://example.com"}, Status: ngsild.StatusOK, TimesSent: 3},
+	})
+	want := ngsild.Subscription{
+		ID:           "urn:ngsi-ld:Subscription:s",
+		Type:         "Subscription",
+		Notification: ngsild.NotificationParams{Endpoint: ngsild.Endpoint{URI: "http://example.com"}},
+	}
+	if !reflect.DeepEqual(sub, want) {
+		t.Errorf("Expected %+v, got %+v", want, sub)
+	}
+}
+
+func TestParseDryRun(t *testing.T) {
+	for raw, want := range map[string]bool{"": false, "true": true, "1": true, "false": false} {
+		if got, err := ParseDryRun(raw); err != nil || got != want {
+			t.Errorf("Expected %v for %q, got %v (%v)", want, raw, got, err)
+		}
+	}
+	if _, err := ParseDryRun("maybe"); err == nil {
+		t.Error("Expected an error for an invalid value")
+	}
+}
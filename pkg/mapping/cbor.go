@@ -0,0 +1,232 @@
+package mapping
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// maxDepth bounds the nesting of decoded arrays, maps and messages
+const maxDepth = 64
+
+// DecodeCBOR decodes a CBOR data item into a JSON value. Integers and floats
+// become float64, byte strings base64 text, undefined null and tagged items
+// their content; map keys that are not text are formatted as text.
+func DecodeCBOR(payload []byte) (interface{}, error) {
+	d := &cborDecoder{data: payload}
+	value, err := d.item(0)
+	if err != nil {
+		return nil, fmt.Errorf("cbor: %w", err)
+	}
+	if d.pos != len(d.data) {
+		return nil, errors.New("cbor: trailing data after the item")
+	}
+	return value, nil
+}
+
+// errBreak is the break stop code ending indefinite-length items
+var errBreak = errors.New("unexpected break")
+
+type cborDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *cborDecoder) read(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, errors.New("unexpected end of data")
+	}
+	b := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return b, nil
+}
+
+// head reads the initial byte and argument of an item. Indefinite lengths
+// are reported with indefinite set.
+func (d *cborDecoder) head() (major byte, info byte, arg uint64, indefinite bool, err error) {
+	b, err := d.read(1)
+	if err != nil {
+		return 0, 0, 0, false, err
+	}
+	major, info = b[0]>>5, b[0]&0x1f
+
+	switch {
+	case info < 24:
+		return major, info, uint64(info), false, nil
+	case info == 31:
+		return major, info, 0, true, nil
+	case info > 27:
+		return 0, 0, 0, false, fmt.Errorf("reserved additional information %d", info)
+	}
+
+	b, err = d.read(1 << (info - 24))
+	if err != nil {
+		return 0, 0, 0, false, err
+	}
+	switch len(b) {
+	case 1:
+		arg = uint64(b[0])
+	case 2:
+		arg = uint64(binary.BigEndian.Uint16(b))
+	case 4:
+		arg = uint64(binary.BigEndian.Uint32(b))
+	default:
+		arg = binary.BigEndian.Uint64(b)
+	}
+	return major, info, arg, false, nil
+}
+
+func (d *cborDecoder) item(depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, errors.New("items nested too deeply")
+	}
+
+	major, info, arg, indefinite, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	if indefinite && (major < 2 || major == 6) {
+		return nil, fmt.Errorf("invalid indefinite length of major type %d", major)
+	}
+
+	switch major {
+	case 0:
+		return float64(arg), nil
+	case 1:
+		return -1 - float64(arg), nil
+	case 2, 3:
+		b, err := d.bytes(major, arg, indefinite)
+		if err != nil {
+			return nil, err
+		}
+		if major == 2 {
+			return base64.StdEncoding.EncodeToString(b), nil
+		}
+		return string(b), nil
+	case 4:
+		array := []interface{}{}
+		for i := uint64(0); indefinite || i < arg; i++ {
+			value, err := d.item(depth + 1)
+			if indefinite && err == errBreak {
+				break
+			}
+			if err != nil {
+				return nil, unexpected(err)
+			}
+			array = append(array, value)
+		}
+		return array, nil
+	case 5:
+		object := make(map[string]interface{})
+		for i := uint64(0); indefinite || i < arg; i++ {
+			key, err := d.item(depth + 1)
+			if indefinite && err == errBreak {
+				break
+			}
+			if err != nil {
+				return nil, unexpected(err)
+			}
+			value, err := d.item(depth + 1)
+			if err != nil {
+				return nil, unexpected(err)
+			}
+			name, ok := key.(string)
+			if !ok {
+				name = fmt.Sprint(key)
+			}
+			object[name] = value
+		}
+		return object, nil
+	case 6:
+		value, err := d.item(depth + 1)
+		return value, unexpected(err)
+	}
+
+	// Major type 7: simple values and floats
+	switch {
+	case indefinite:
+		return nil, errBreak
+	case info == 20:
+		return false, nil
+	case info == 21:
+		return true, nil
+	case info == 22, info == 23:
+		return nil, nil
+	case info == 25:
+		return finite(halfFloat(uint16(arg))), nil
+	case info == 26:
+		return finite(float64(math.Float32frombits(uint32(arg)))), nil
+	case info == 27:
+		return finite(math.Float64frombits(arg)), nil
+	}
+	return nil, fmt.Errorf("unsupported simple value %d", arg)
+}
+
+// unexpected turns a break stop code inside an item into an error, so that
+// it does not end an enclosing indefinite-length item
+func unexpected(err error) error {
+	if err == errBreak {
+		return errors.New("unexpected break")
+	}
+	return err
+}
+
+// finite returns a float, or null for NaN and infinities, which JSON lacks
+func finite(f float64) interface{} {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil
+	}
+	return f
+}
+
+// bytes reads a byte or text string, joining the chunks of indefinite ones
+func (d *cborDecoder) bytes(major byte, length uint64, indefinite bool) ([]byte, error) {
+	if !indefinite {
+		return d.read(length)
+	}
+
+	var out []byte
+	for {
+		chunkMajor, _, chunkLength, chunkIndefinite, err := d.head()
+		if err != nil {
+			return nil, err
+		}
+		if chunkMajor == 7 && chunkIndefinite {
+			return out, nil
+		}
+		if chunkMajor != major || chunkIndefinite {
+			return nil, errors.New("invalid chunk of an indefinite-length string")
+		}
+		chunk, err := d.read(chunkLength)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, chunk...)
+	}
+}
+
+// halfFloat converts an IEEE 754 half-precision float
+func halfFloat(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+
+	var value float64
+	switch exp {
+	case 0:
+		value = math.Ldexp(mant, -24)
+	case 31:
+		if mant == 0 {
+			value = math.Inf(1)
+		} else {
+			value = math.NaN()
+		}
+	default:
+		value = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		return -value
+	}
+	return value
+}
@@ -0,0 +1,83 @@
+package mapping
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// Codec decodes the payloads of a message format into JSON values, such as
+// map[string]interface{} for objects and float64 for numbers, that rules
+// then map to properties. Codecs for proprietary formats are registered with
+// Manager.RegisterCodec and selected by the codec of a rule.
+type Codec interface {
+	Decode(payload []byte) (interface{}, error)
+}
+
+// CodecFunc adapts an ordinary function to the Codec interface
+type CodecFunc func(payload []byte) (interface{}, error)
+
+// Decode calls f(payload)
+func (f CodecFunc) Decode(payload []byte) (interface{}, error) {
+	return f(payload)
+}
+
+// Built-in codecs
+const (
+	CodecJSON     = "json"     // JSON, or the payload as text if it is not JSON
+	CodecCBOR     = "cbor"     // CBOR as of RFC 8949
+	CodecProtobuf = "protobuf" // Protocol Buffers without a schema, see ProtobufCodec
+)
+
+// decodeJSON decodes JSON payloads and returns others as trimmed text
+func decodeJSON(payload []byte) (interface{}, error) {
+	var value interface{}
+	if err := json.Unmarshal(payload, &value); err != nil {
+		return strings.TrimSpace(string(payload)), nil
+	}
+	return value, nil
+}
+
+// builtinCodecs returns the codecs every manager starts with
+func builtinCodecs() map[string]Codec {
+	return map[string]Codec{
+		CodecJSON:     CodecFunc(decodeJSON),
+		CodecCBOR:     CodecFunc(DecodeCBOR),
+		CodecProtobuf: ProtobufCodec{},
+	}
+}
+
+// RegisterCodec registers a codec under a name, replacing any previous one.
+// Rules naming the codec decode their payloads with it.
+func (m *Manager) RegisterCodec(name string, c Codec) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.codecs[name] = c
+}
+
+// Codecs returns the names of the registered codecs in order
+func (m *Manager) Codecs() []string {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	names := make([]string, 0, len(m.codecs))
+	for name := range m.codecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// codec returns a registered codec, the JSON codec for an empty name
+func (m *Manager) codec(name string) (Codec, bool) {
+	if name == "" {
+		name = CodecJSON
+	}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	c, exists := m.codecs[name]
+	return c, exists
+}
@@ -0,0 +1,118 @@
+package mapping
+
+import (
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeCBOR(t *testing.T) {
+	for _, tc := range []struct {
+		hex  string
+		want interface{}
+	}{
+		// {"t": 21.5, "on": true, "tags": [1, -2], "raw": h'0102'}
+		{"a46174fb4035800000000000626f6ef5647461677382012163726177420102", map[string]interface{}{
+			"t": 21.5, "on": true, "tags": []interface{}{1.0, -2.0}, "raw": "AQI=",
+		}},
+		{"f93c00", 1.0},
+		{"f97c00", nil},
+		{"9f0102ff", []interface{}{1.0, 2.0}},
+		{"7f62616261 63ff", "abc"},
+		{"c11a514b67b0", 1363896240.0},
+		{"a10102", map[string]interface{}{"1": 2.0}},
+	} {
+		data, _ := hex.DecodeString(strings.ReplaceAll(tc.hex, " ", ""))
+		got, err := DecodeCBOR(data)
+		if err != nil {
+			t.Errorf("%s: failed to decode: %v", tc.hex, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: expected %v, got %v", tc.hex, tc.want, got)
+		}
+	}
+
+	for _, s := range []string{"", "ff", "9f01", "8201", "820102ff", "1f", "9f81ffff", "fc"} {
+		data, _ := hex.DecodeString(s)
+		if _, err := DecodeCBOR(data); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
+
+func TestProtobufCodec(t *testing.T) {
+	// rpm=150, name="hi", temperature=21.5, packed deltas=[-1, 2], unknown 5 twice
+	data, _ := hex.DecodeString("08960112026869190000000000803540220201042801" + "2802")
+
+	codec := ProtobufCodec{Fields: map[int]ProtobufField{
+		1: {Name: "rpm", Type: "int32"},
+		2: {Name: "name", Type: "string"},
+		3: {Name: "temperature", Type: "double"},
+		4: {Name: "deltas", Type: "sint32", Repeated: true},
+		6: {Name: "alarms", Type: "string", Repeated: true},
+	}}
+	got, err := codec.Decode(data)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	want := map[string]interface{}{
+		"rpm": 150.0, "name": "hi", "temperature": 21.5,
+		"deltas": []interface{}{-1.0, 2.0}, "alarms": []interface{}{}, "5": []interface{}{1.0, 2.0},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	// Without a schema fields are decoded by their wire type
+	got, _ = ProtobufCodec{}.Decode(data)
+	if object := got.(map[string]interface{}); object["1"] != 150.0 || object["2"] != "hi" || object["3"] != 21.5 {
+		t.Errorf("Unexpected schemaless decoding %v", got)
+	}
+
+	for _, s := range []string{"08", "0a05", "00", "0f", "1900"} {
+		data, _ := hex.DecodeString(s)
+		if _, err := (ProtobufCodec{}).Decode(data); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+	if _, err := codec.Decode([]byte{0x08 | 2, 0}); err == nil {
+		t.Error("Expected an error for a wire type not matching the field")
+	}
+}
+
+func TestMapWithCodecs(t *testing.T) {
+	m := NewManager()
+	m.RegisterCodec("csv", CodecFunc(func(payload []byte) (interface{}, error) {
+		fields := strings.Split(string(payload), ",")
+		if len(fields) != 2 {
+			return nil, errors.New("expected two fields")
+		}
+		return map[string]interface{}{"rpm": fields[0], "state": fields[1]}, nil
+	}))
+	if codecs := m.Codecs(); !reflect.DeepEqual(codecs, []string{"cbor", "csv", "json", "protobuf"}) {
+		t.Errorf("Unexpected codecs %v", codecs)
+	}
+
+	m.Set(Rule{ID: "cbor", Topic: "cbor/{machine}", Twin: "{machine}", Feature: "motor", Codec: CodecCBOR})
+	m.Set(Rule{ID: "csv", Topic: "csv/{machine}", Twin: "{machine}", Feature: "motor", Codec: "csv", Transform: `{rpm: (.rpm | tonumber), state}`})
+
+	data, _ := hex.DecodeString("a16372706d190596")
+	match, err := m.Map("cbor/press-1", data)
+	if err != nil || match.Telemetry.Features["motor"]["rpm"] != 1430.0 {
+		t.Errorf("Unexpected CBOR match %+v %v", match, err)
+	}
+	match, err = m.Map("csv/press-1", []byte("1450,RUN"))
+	if err != nil || !reflect.DeepEqual(match.Telemetry.Features["motor"], map[string]interface{}{"rpm": 1450.0, "state": "RUN"}) {
+		t.Errorf("Unexpected CSV match %+v %v", match, err)
+	}
+
+	if _, err := m.Map("csv/press-1", []byte("1450")); !errors.Is(err, ErrInvalidPayload) {
+		t.Errorf("Expected ErrInvalidPayload, got %v", err)
+	}
+	if err := m.Set(Rule{ID: "x", Topic: "x", Twin: "t", Feature: "f", Codec: "avro"}); !errors.Is(err, ErrInvalidMapping) {
+		t.Errorf("Expected ErrInvalidMapping for an unknown codec, got %v", err)
+	}
+}
@@ -0,0 +1,253 @@
+// Package mapping maps messages received on the topics of brokers such as
+// MQTT or Kafka to telemetry of twins. Rules match topics against templates
+// like factory/{line}/{machine}/temp and fill in the twin, feature and
+// property from the variables, so that devices need not know twin IDs.
+package mapping
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aleka07/go-digital-twin/pkg/ingest"
+	"github.com/aleka07/go-digital-twin/pkg/reshape"
+)
+
+// Common errors
+var (
+	ErrMappingNotFound = errors.New("mapping not found")
+	ErrInvalidMapping  = errors.New("invalid mapping")
+	ErrNoMatch         = errors.New("no mapping matches the topic")
+	ErrInvalidPayload  = errors.New("invalid payload")
+)
+
+// Rule maps the topics matching a template to properties of twins. Variables
+// in braces match a run of characters other than a slash and may be used in
+// the twin, feature and property templates. The payload is decoded by the
+// codec of the rule, JSON by default, and may be reshaped by a transform, a
+// jq-style expression of package reshape. Without a property the payload
+// must then be an object whose members are the properties; otherwise the
+// payload is the value of the property.
+type Rule struct {
+	ID        string `json:"id"`
+	Topic     string `json:"topic"`               // Such as factory/{line}/{machine}/temp
+	Twin      string `json:"twin"`                // Such as {line}-{machine}
+	Feature   string `json:"feature"`             // Such as temperature
+	Property  string `json:"property,omitempty"`  // Such as value
+	Codec     string `json:"codec,omitempty"`     // Such as cbor, see Codec
+	Transform string `json:"transform,omitempty"` // Such as {temperature: (.t / 10)}
+
+	pattern *regexp.Regexp
+	names   []string
+	expr    *reshape.Expression
+}
+
+// Match is a message mapped to the telemetry of a twin
+type Match struct {
+	Rule      string            `json:"rule"`
+	Variables map[string]string `json:"variables,omitempty"`
+	Telemetry ingest.Telemetry  `json:"telemetry"`
+}
+
+// variable matches a variable of a template
+var variable = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// compile checks a rule and compiles its topic template
+func (rule *Rule) compile() error {
+	if rule.ID == "" || rule.Topic == "" || rule.Twin == "" || rule.Feature == "" {
+		return fmt.Errorf("%w: id, topic, twin and feature are required", ErrInvalidMapping)
+	}
+
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	declared := make(map[string]bool)
+	rule.names = nil
+	last := 0
+	for _, loc := range variable.FindAllStringSubmatchIndex(rule.Topic, -1) {
+		name := rule.Topic[loc[2]:loc[3]]
+		if declared[name] {
+			return fmt.Errorf("%w: variable %s is used twice in the topic", ErrInvalidMapping, name)
+		}
+		declared[name] = true
+		rule.names = append(rule.names, name)
+
+		pattern.WriteString(regexp.QuoteMeta(rule.Topic[last:loc[0]]))
+		pattern.WriteString("([^/]+?)")
+		last = loc[1]
+	}
+	pattern.WriteString(regexp.QuoteMeta(rule.Topic[last:]))
+	pattern.WriteString("$")
+	if strings.ContainsAny(rule.Topic[last:], "{}") {
+		return fmt.Errorf("%w: malformed topic template %q", ErrInvalidMapping, rule.Topic)
+	}
+
+	for _, template := range []string{rule.Twin, rule.Feature, rule.Property} {
+		for _, m := range variable.FindAllStringSubmatch(template, -1) {
+			if !declared[m[1]] {
+				return fmt.Errorf("%w: variable %s is not in the topic", ErrInvalidMapping, m[1])
+			}
+		}
+	}
+
+	rule.expr = nil
+	if rule.Transform != "" {
+		expr, err := reshape.Compile(rule.Transform)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidMapping, err)
+		}
+		rule.expr = expr
+	}
+
+	rule.pattern = regexp.MustCompile(pattern.String())
+	return nil
+}
+
+// match returns the variables of a topic matching the rule
+func (rule *Rule) match(topic string) (map[string]string, bool) {
+	values := rule.pattern.FindStringSubmatch(topic)
+	if values == nil {
+		return nil, false
+	}
+
+	vars := make(map[string]string, len(rule.names))
+	for i, name := range rule.names {
+		vars[name] = values[i+1]
+	}
+	return vars, true
+}
+
+// expand fills in the variables of a template
+func expand(template string, vars map[string]string) string {
+	return variable.ReplaceAllStringFunc(template, func(s string) string {
+		return vars[s[1:len(s)-1]]
+	})
+}
+
+// Manager keeps the mapping rules and the codecs they decode payloads with
+type Manager struct {
+	rules  map[string]Rule
+	codecs map[string]Codec
+	mutex  sync.RWMutex
+}
+
+// NewManager creates a new mapping manager with the built-in codecs
+func NewManager() *Manager {
+	return &Manager{
+		rules:  make(map[string]Rule),
+		codecs: builtinCodecs(),
+	}
+}
+
+// Set declares a rule, replacing any previous one with its ID
+func (m *Manager) Set(rule Rule) error {
+	if err := rule.compile(); err != nil {
+		return err
+	}
+	if _, exists := m.codec(rule.Codec); !exists {
+		return fmt.Errorf("%w: unknown codec %q", ErrInvalidMapping, rule.Codec)
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.rules[rule.ID] = rule
+	return nil
+}
+
+// Get returns a rule
+func (m *Manager) Get(id string) (Rule, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	rule, exists := m.rules[id]
+	if !exists {
+		return Rule{}, ErrMappingNotFound
+	}
+	return rule, nil
+}
+
+// List returns all rules sorted by ID, the order in which they are matched
+func (m *Manager) List() []Rule {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	result := make([]Rule, 0, len(m.rules))
+	for _, rule := range m.rules {
+		result = append(result, rule)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// Delete removes a rule
+func (m *Manager) Delete(id string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, exists := m.rules[id]; !exists {
+		return ErrMappingNotFound
+	}
+	delete(m.rules, id)
+	return nil
+}
+
+// Map maps a message to telemetry with the first rule, in order of their
+// IDs, whose topic template matches the topic. It does not apply the
+// telemetry, so it doubles as a dry run of the rules.
+func (m *Manager) Map(topic string, payload []byte) (*Match, error) {
+	for _, rule := range m.List() {
+		vars, ok := rule.match(topic)
+		if !ok {
+			continue
+		}
+
+		codec, exists := m.codec(rule.Codec)
+		if !exists {
+			return nil, fmt.Errorf("rule %s: %w: unknown codec %q", rule.ID, ErrInvalidMapping, rule.Codec)
+		}
+		properties, err := decode(codec, payload, rule.expr, expand(rule.Property, vars))
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", rule.ID, err)
+		}
+
+		twinID, featureID := expand(rule.Twin, vars), expand(rule.Feature, vars)
+		if twinID == "" || featureID == "" {
+			return nil, fmt.Errorf("rule %s: %w: empty twin or feature", rule.ID, ErrInvalidPayload)
+		}
+		return &Match{
+			Rule:      rule.ID,
+			Variables: vars,
+			Telemetry: ingest.Telemetry{
+				TwinID:   twinID,
+				Features: map[string]map[string]interface{}{featureID: properties},
+			},
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNoMatch, topic)
+}
+
+// decode returns the properties of a payload, reshaped by a transform if set
+func decode(codec Codec, payload []byte, transform *reshape.Expression, property string) (map[string]interface{}, error) {
+	value, err := codec.Decode(payload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+	}
+	if transform != nil {
+		if value, err = transform.Eval(value); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+		}
+	}
+
+	if property != "" {
+		return map[string]interface{}{property: value}, nil
+	}
+	properties, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: a JSON object is required without a property", ErrInvalidPayload)
+	}
+	return properties, nil
+}
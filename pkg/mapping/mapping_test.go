@@ -0,0 +1,83 @@
+package mapping
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMap(t *testing.T) {
+	m := NewManager()
+	for _, rule := range []Rule{
+		{ID: "a-temperature", Topic: "factory/{line}/{machine}/temp", Twin: "{line}-{machine}", Feature: "temperature", Property: "value"},
+		{ID: "b-status", Topic: "factory/{line}/{machine}/{feature}", Twin: "{line}-{machine}", Feature: "{feature}"},
+		{ID: "c-kafka", Topic: "plant.{machine}.{property}", Twin: "{machine}", Feature: "sensors", Property: "{property}"},
+		{ID: "d-legacy", Topic: "legacy/{machine}", Twin: "{machine}", Feature: "motor", Transform: `{rpm: .d.s, running: (.d.st == "RUN")}`},
+	} {
+		if err := m.Set(rule); err != nil {
+			t.Fatalf("Failed to set rule %s: %v", rule.ID, err)
+		}
+	}
+
+	for _, tc := range []struct {
+		topic, payload string
+		rule, twin     string
+		features       map[string]map[string]interface{}
+	}{
+		{"factory/line1/m2/temp", "21.5", "a-temperature", "line1-m2", map[string]map[string]interface{}{"temperature": {"value": 21.5}}},
+		{"factory/line1/m2/motor", `{"rpm": 1450, "on": true}`, "b-status", "line1-m2", map[string]map[string]interface{}{"motor": {"rpm": 1450.0, "on": true}}},
+		{"plant.press-1.state", "running", "c-kafka", "press-1", map[string]map[string]interface{}{"sensors": {"state": "running"}}},
+		{"legacy/press-2", `{"d": {"s": 900, "st": "RUN"}}`, "d-legacy", "press-2", map[string]map[string]interface{}{"motor": {"rpm": 900.0, "running": true}}},
+	} {
+		match, err := m.Map(tc.topic, []byte(tc.payload))
+		if err != nil {
+			t.Errorf("%s: failed to map: %v", tc.topic, err)
+			continue
+		}
+		if match.Rule != tc.rule || match.Telemetry.TwinID != tc.twin || !reflect.DeepEqual(match.Telemetry.Features, tc.features) {
+			t.Errorf("%s: unexpected match %+v", tc.topic, match)
+		}
+	}
+
+	for _, tc := range []struct {
+		topic, payload string
+		err            error
+	}{
+		{"factory/line1/temp", "21.5", ErrNoMatch},
+		{"factory/line1/m2/motor/extra", "{}", ErrNoMatch},
+		{"factory/line1/m2/motor", "1450", ErrInvalidPayload},
+		{"legacy/press-2", `{"d": "text"}`, ErrInvalidPayload},
+	} {
+		if _, err := m.Map(tc.topic, []byte(tc.payload)); !errors.Is(err, tc.err) {
+			t.Errorf("%s: expected %v, got %v", tc.topic, tc.err, err)
+		}
+	}
+}
+
+func TestSetInvalidRule(t *testing.T) {
+	m := NewManager()
+	for _, rule := range []Rule{
+		{ID: "r", Topic: "a/{x}", Twin: "{x}"},
+		{ID: "r", Topic: "a/{x}", Twin: "{y}", Feature: "f"},
+		{ID: "r", Topic: "a/{x}/{x}", Twin: "{x}", Feature: "f"},
+		{ID: "r", Topic: "a/{x", Twin: "t", Feature: "f"},
+		{ID: "r", Topic: "a/{x}", Twin: "{x}", Feature: "f", Transform: "{a: "},
+	} {
+		if err := m.Set(rule); !errors.Is(err, ErrInvalidMapping) {
+			t.Errorf("%+v: expected ErrInvalidMapping, got %v", rule, err)
+		}
+	}
+
+	if err := m.Set(Rule{ID: "r", Topic: "a/{x}", Twin: "{x}", Feature: "f"}); err != nil {
+		t.Fatalf("Failed to set rule: %v", err)
+	}
+	if rules := m.List(); len(rules) != 1 || rules[0].Topic != "a/{x}" {
+		t.Errorf("Unexpected rules %v", rules)
+	}
+	if err := m.Delete("r"); err != nil {
+		t.Errorf("Failed to delete rule: %v", err)
+	}
+	if _, err := m.Get("r"); err != ErrMappingNotFound {
+		t.Errorf("Expected ErrMappingNotFound, got %v", err)
+	}
+}
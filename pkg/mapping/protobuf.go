@@ -0,0 +1,244 @@
+package mapping
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"unicode/utf8"
+)
+
+// Protobuf wire types
+const (
+	wireVarint = 0
+	wireI64    = 1
+	wireLen    = 2
+	wireI32    = 5
+)
+
+// ProtobufField describes a field of a protobuf message
+type ProtobufField struct {
+	Name     string                `json:"name"`
+	Type     string                `json:"type"` // Scalar type such as int32, sint64, double, string or bytes, or message
+	Repeated bool                  `json:"repeated,omitempty"`
+	Fields   map[int]ProtobufField `json:"fields,omitempty"` // Fields of a message
+}
+
+// ProtobufCodec decodes protobuf messages into objects. Fields it describes
+// are named and decoded by their type. Other fields are keyed by their
+// number and decoded by their wire type alone: varints as signed integers,
+// 64-bit values as doubles, 32-bit values as floats and length-delimited
+// values as text if valid UTF-8 or base64 otherwise; fields that occur
+// several times become arrays. Without fields it decodes any message
+// without a schema.
+type ProtobufCodec struct {
+	Fields map[int]ProtobufField
+}
+
+// Decode decodes a protobuf message
+func (c ProtobufCodec) Decode(payload []byte) (interface{}, error) {
+	object, err := decodeMessage(payload, c.Fields, 0)
+	if err != nil {
+		return nil, fmt.Errorf("protobuf: %w", err)
+	}
+	return object, nil
+}
+
+// decodeMessage decodes the fields of a message
+func decodeMessage(data []byte, fields map[int]ProtobufField, depth int) (map[string]interface{}, error) {
+	if depth > maxDepth {
+		return nil, errors.New("messages nested too deeply")
+	}
+
+	object := make(map[string]interface{})
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, errors.New("invalid field key")
+		}
+		data = data[n:]
+		number, wire := int(key>>3), int(key&7)
+		if number == 0 {
+			return nil, errors.New("invalid field number 0")
+		}
+
+		var raw uint64
+		var bytes []byte
+		switch wire {
+		case wireVarint:
+			raw, n = binary.Uvarint(data)
+			if n <= 0 {
+				return nil, fmt.Errorf("invalid varint in field %d", number)
+			}
+		case wireI64:
+			if n = 8; len(data) < n {
+				return nil, fmt.Errorf("truncated field %d", number)
+			}
+			raw = binary.LittleEndian.Uint64(data)
+		case wireI32:
+			if n = 4; len(data) < n {
+				return nil, fmt.Errorf("truncated field %d", number)
+			}
+			raw = uint64(binary.LittleEndian.Uint32(data))
+		case wireLen:
+			length, m := binary.Uvarint(data)
+			if m <= 0 || length > uint64(len(data)-m) {
+				return nil, fmt.Errorf("truncated field %d", number)
+			}
+			bytes, n = data[m:m+int(length)], m+int(length)
+		default:
+			return nil, fmt.Errorf("unsupported wire type %d in field %d", wire, number)
+		}
+		data = data[n:]
+
+		field, known := fields[number]
+		if !known {
+			value := unknownValue(wire, raw, bytes)
+			name := strconv.Itoa(number)
+			if previous, exists := object[name]; exists {
+				if array, ok := previous.([]interface{}); ok {
+					object[name] = append(array, value)
+				} else {
+					object[name] = []interface{}{previous, value}
+				}
+			} else {
+				object[name] = value
+			}
+			continue
+		}
+
+		values, err := fieldValues(field, wire, raw, bytes, depth)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		if !field.Repeated {
+			object[field.Name] = values[len(values)-1] // The last value wins
+			continue
+		}
+		array, _ := object[field.Name].([]interface{})
+		object[field.Name] = append(array, values...)
+	}
+
+	// Described repeated fields that did not occur are empty
+	for _, field := range fields {
+		if _, exists := object[field.Name]; !exists && field.Repeated {
+			object[field.Name] = []interface{}{}
+		}
+	}
+	return object, nil
+}
+
+// unknownValue decodes a value of an undescribed field by its wire type
+func unknownValue(wire int, raw uint64, bytes []byte) interface{} {
+	switch wire {
+	case wireVarint:
+		return float64(int64(raw))
+	case wireI64:
+		return finite(math.Float64frombits(raw))
+	case wireI32:
+		return finite(float64(math.Float32frombits(uint32(raw))))
+	}
+	if utf8.Valid(bytes) {
+		return string(bytes)
+	}
+	return base64.StdEncoding.EncodeToString(bytes)
+}
+
+// fieldValues decodes the values of a described field. Repeated scalars may
+// be packed into a single length-delimited value.
+func fieldValues(field ProtobufField, wire int, raw uint64, bytes []byte, depth int) ([]interface{}, error) {
+	switch field.Type {
+	case "string":
+		if wire != wireLen {
+			break
+		}
+		return []interface{}{string(bytes)}, nil
+	case "bytes":
+		if wire != wireLen {
+			break
+		}
+		return []interface{}{base64.StdEncoding.EncodeToString(bytes)}, nil
+	case "message":
+		if wire != wireLen {
+			break
+		}
+		object, err := decodeMessage(bytes, field.Fields, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		return []interface{}{object}, nil
+	default:
+		scalarWire, ok := scalarWireTypes[field.Type]
+		if !ok {
+			return nil, fmt.Errorf("unknown type %q", field.Type)
+		}
+		if wire == scalarWire {
+			return []interface{}{scalar(field.Type, raw)}, nil
+		}
+		if wire == wireLen && field.Repeated {
+			return packed(field.Type, scalarWire, bytes)
+		}
+	}
+	return nil, fmt.Errorf("wire type %d does not match type %s", wire, field.Type)
+}
+
+// scalarWireTypes are the wire types of scalar types
+var scalarWireTypes = map[string]int{
+	"int32": wireVarint, "int64": wireVarint, "uint32": wireVarint, "uint64": wireVarint,
+	"sint32": wireVarint, "sint64": wireVarint, "bool": wireVarint, "enum": wireVarint,
+	"double": wireI64, "fixed64": wireI64, "sfixed64": wireI64,
+	"float": wireI32, "fixed32": wireI32, "sfixed32": wireI32,
+}
+
+// scalar decodes a scalar value of a type from its raw bits
+func scalar(t string, raw uint64) interface{} {
+	switch t {
+	case "int32":
+		return float64(int32(raw))
+	case "int64", "enum":
+		return float64(int64(raw))
+	case "sint32", "sint64":
+		return float64(int64(raw>>1) ^ -int64(raw&1))
+	case "bool":
+		return raw != 0
+	case "double":
+		return finite(math.Float64frombits(raw))
+	case "float":
+		return finite(float64(math.Float32frombits(uint32(raw))))
+	case "sfixed64":
+		return float64(int64(raw))
+	case "sfixed32":
+		return float64(int32(uint32(raw)))
+	}
+	return float64(raw) // uint32, uint64, fixed32 and fixed64
+}
+
+// packed decodes packed repeated scalars
+func packed(t string, wire int, data []byte) ([]interface{}, error) {
+	var values []interface{}
+	for len(data) > 0 {
+		var raw uint64
+		switch wire {
+		case wireVarint:
+			var n int
+			if raw, n = binary.Uvarint(data); n <= 0 {
+				return nil, errors.New("invalid packed varint")
+			}
+			data = data[n:]
+		case wireI64:
+			if len(data) < 8 {
+				return nil, errors.New("truncated packed value")
+			}
+			raw, data = binary.LittleEndian.Uint64(data), data[8:]
+		default:
+			if len(data) < 4 {
+				return nil, errors.New("truncated packed value")
+			}
+			raw, data = uint64(binary.LittleEndian.Uint32(data)), data[4:]
+		}
+		values = append(values, scalar(t, raw))
+	}
+	return values, nil
+}
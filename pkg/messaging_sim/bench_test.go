@@ -0,0 +1,68 @@
+package messaging_sim
+
+import (
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/eventbus"
+)
+
+// BenchmarkPublish measures publishing a property event to the subscribers
+// the API server typically has
+func BenchmarkPublish(b *testing.B) {
+	ps := NewPubSub()
+	patterns := []string{"#", "#", "twin.+", "twin.#", "property.updated", "alarm.#", "rule.triggered", "feature.+"}
+	for _, pattern := range patterns {
+		ch := ps.SubscribeWithBuffer(pattern, 1024)
+		go func() {
+			for range ch {
+			}
+		}()
+	}
+	defer ps.Close()
+
+	payload := map[string]interface{}{"twinId": "pump-1", "featureId": "status", "properties": map[string]interface{}{"pressure": 2.5}}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ps.Publish("properties.updated", payload)
+	}
+}
+
+// BenchmarkPublishPayload compares publishing property events whose payload
+// is built for every event, as a map and as a PropertiesUpdated
+func BenchmarkPublishPayload(b *testing.B) {
+	ps := NewPubSub()
+	for _, pattern := range []string{"#", "properties.updated"} {
+		ch := ps.SubscribeWithBuffer(pattern, 1024)
+		go func() {
+			for range ch {
+			}
+		}()
+	}
+	defer ps.Close()
+
+	twinIDs := []string{"pump-1", "pump-2", "pump-3", "pump-4"}
+	props := map[string]interface{}{"pressure": 2.5}
+
+	b.Run("Map", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			ps.Publish("properties.updated", map[string]interface{}{"twinId": twinIDs[i%len(twinIDs)], "featureId": "status", "properties": props})
+		}
+	})
+	b.Run("Typed", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			ps.Publish("properties.updated", eventbus.PropertiesUpdated{TwinID: twinIDs[i%len(twinIDs)], FeatureID: "status", Properties: props})
+		}
+	})
+}
+
+// BenchmarkTopicMatches measures matching a topic against a wildcard pattern
+func BenchmarkTopicMatches(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		TopicMatches("twin.+.status", "twin.pump-1.status")
+	}
+}
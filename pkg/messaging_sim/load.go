@@ -0,0 +1,40 @@
+package messaging_sim
+
+import "github.com/aleka07/go-digital-twin/pkg/eventbus"
+
+// Load describes how far subscribers are behind on delivered messages
+type Load = eventbus.Load
+
+// Load returns the queue depths of all subscriptions. Saturation follows the
+// slowest subscriber, since it is the first to drop messages.
+func (ps *PubSub) Load() Load {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+
+	load := Load{Dropped: ps.dropped.Load()}
+	add := func(queued, capacity int) {
+		load.Queued += queued
+		load.Capacity += capacity
+		if capacity > 0 {
+			if s := float64(queued) / float64(capacity); s > load.Saturation {
+				load.Saturation = s
+			}
+		}
+	}
+
+	for _, subs := range ps.subscribers {
+		for _, ch := range subs {
+			load.Subscribers++
+			add(len(ch), cap(ch))
+		}
+	}
+	for _, subs := range ps.prioritySubs {
+		for _, sub := range subs {
+			load.Subscribers++
+			for _, lane := range sub.lanes {
+				add(len(lane), cap(lane))
+			}
+		}
+	}
+	return load
+}
@@ -0,0 +1,26 @@
+package messaging_sim
+
+import (
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	ps := NewPubSub()
+	ps.SubscribeWithBuffer("twin.#", 4)
+	ps.SubscribeWithBuffer("alarm.#", 4)
+
+	for i := 0; i < 6; i++ {
+		ps.Publish("twin.updated", map[string]string{"id": "pump-1"})
+	}
+
+	load := ps.Load()
+	if load.Subscribers != 2 || load.Queued != 4 || load.Capacity != 8 {
+		t.Errorf("Unexpected load %+v", load)
+	}
+	if load.Saturation != 1 {
+		t.Errorf("Expected saturation 1, got %v", load.Saturation)
+	}
+	if load.Dropped != 2 {
+		t.Errorf("Expected 2 dropped messages, got %d", load.Dropped)
+	}
+}
@@ -0,0 +1,211 @@
+package messaging_sim
+
+import "github.com/aleka07/go-digital-twin/pkg/eventbus"
+
+// Priority orders messages on contended priority subscriptions
+type Priority = eventbus.Priority
+
+// Message priorities, from bulk traffic to critical events
+const (
+	PriorityLow    = eventbus.PriorityLow
+	PriorityNormal = eventbus.PriorityNormal
+	PriorityHigh   = eventbus.PriorityHigh
+)
+
+// numPriorities is the number of priority lanes per subscription
+const numPriorities = int(PriorityHigh) + 1
+
+// StarvationLimit is the number of consecutive messages a priority subscription
+// delivers from higher lanes before it serves a waiting lower lane
+const StarvationLimit = 8
+
+// validPriority reports whether p is one of the defined priorities
+func validPriority(p Priority) bool {
+	return p >= PriorityLow && p <= PriorityHigh
+}
+
+// topicPriority maps a topic pattern to the priority of messages published on it
+type topicPriority struct {
+	pattern  string
+	priority Priority
+}
+
+// defaultTopicPriorities promotes alarms and commands and demotes bulk telemetry
+var defaultTopicPriorities = []topicPriority{
+	{pattern: "rule.triggered", priority: PriorityHigh},
+	{pattern: "alarm.#", priority: PriorityHigh},
+	{pattern: "command.#", priority: PriorityHigh},
+	{pattern: "properties.updated", priority: PriorityLow},
+	{pattern: "property.updated", priority: PriorityLow},
+}
+
+// SetTopicPriority sets the priority of messages published with Publish on
+// topics matching pattern. When several patterns match a topic the highest
+// priority wins; topics that match no pattern are published with PriorityNormal.
+func (ps *PubSub) SetTopicPriority(pattern string, priority Priority) {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	for i, tp := range ps.priorities {
+		if tp.pattern == pattern {
+			ps.priorities[i].priority = priority
+			return
+		}
+	}
+	ps.priorities = append(ps.priorities, topicPriority{pattern: pattern, priority: priority})
+}
+
+// PriorityOf returns the priority Publish assigns to messages on a topic
+func (ps *PubSub) PriorityOf(topic string) Priority {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+
+	return ps.priorityOf(topic)
+}
+
+// priorityOf returns the priority of a topic; the caller must hold the mutex
+func (ps *PubSub) priorityOf(topic string) Priority {
+	priority, matched := PriorityNormal, false
+	for _, tp := range ps.priorities {
+		if !TopicMatches(tp.pattern, topic) {
+			continue
+		}
+		if !matched || tp.priority > priority {
+			priority, matched = tp.priority, true
+		}
+	}
+	return priority
+}
+
+// SubscribeWithPriority creates a subscription that queues messages in a
+// separate lane of up to size messages per priority. Pending high priority
+// messages are delivered before normal and low priority ones, but a waiting
+// lower lane is served at least once every StarvationLimit messages. The
+// returned channel is unbuffered, so ordering is decided when the subscriber
+// is ready to receive; a lane that fills up drops new messages of its priority.
+// The events of a twin may be reordered across lanes, so messages are not
+// numbered and eventbus.Gaps reports no gaps for them.
+func (ps *PubSub) SubscribeWithPriority(topic string, size int) chan Message {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	if ps.state != eventbus.StateRunning {
+		return closedChannel()
+	}
+
+	sub := newPrioritySub(size)
+	ps.prioritySubs[topic] = append(ps.prioritySubs[topic], sub)
+	ps.workers.Add(1)
+	go func() {
+		defer ps.workers.Done()
+		sub.run()
+	}()
+	return sub.out
+}
+
+// prioritySub is a subscription with one queue per priority
+type prioritySub struct {
+	lanes    [numPriorities]chan Message
+	out      chan Message
+	done     chan struct{}
+	closeOut bool
+	streak   int
+}
+
+// newPrioritySub creates a priority subscription with lanes of the given size
+func newPrioritySub(size int) *prioritySub {
+	sub := &prioritySub{
+		out:  make(chan Message),
+		done: make(chan struct{}),
+	}
+	for i := range sub.lanes {
+		sub.lanes[i] = make(chan Message, size)
+	}
+	return sub
+}
+
+// enqueue adds a message to the lane of its priority without blocking, and
+// reports whether it was queued
+func (s *prioritySub) enqueue(msg Message) bool {
+	return sender(s.lanes[msg.Priority])(msg)
+}
+
+// deliver enqueues a message, dropping it if its lane is full
+func (s *prioritySub) deliver(msg Message) bool {
+	return s.enqueue(msg)
+}
+
+// stop ends delivery, closing the subscriber channel if closeOut is set
+func (s *prioritySub) stop(closeOut bool) {
+	s.closeOut = closeOut
+	close(s.done)
+}
+
+// run forwards queued messages to the subscriber channel until stopped
+func (s *prioritySub) run() {
+	defer func() {
+		if s.closeOut {
+			close(s.out)
+		}
+	}()
+
+	for {
+		msg, ok := s.next()
+		if !ok {
+			return
+		}
+		select {
+		case s.out <- msg:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// next returns the next message to deliver, blocking until one is queued
+func (s *prioritySub) next() (Message, bool) {
+	// Serve the lowest waiting lane once higher lanes have had their turn
+	if s.streak >= StarvationLimit {
+		s.streak = 0
+		for p := PriorityLow; p < PriorityHigh; p++ {
+			select {
+			case msg := <-s.lanes[p]:
+				return msg, true
+			default:
+			}
+		}
+	}
+
+	for p := PriorityHigh; p >= PriorityLow; p-- {
+		select {
+		case msg := <-s.lanes[p]:
+			s.served(p)
+			return msg, true
+		default:
+		}
+	}
+
+	// All lanes are empty, wait for the first message of any priority
+	select {
+	case msg := <-s.lanes[PriorityHigh]:
+		s.served(PriorityHigh)
+		return msg, true
+	case msg := <-s.lanes[PriorityNormal]:
+		s.served(PriorityNormal)
+		return msg, true
+	case msg := <-s.lanes[PriorityLow]:
+		s.served(PriorityLow)
+		return msg, true
+	case <-s.done:
+		return Message{}, false
+	}
+}
+
+// served records a delivery from lane p for starvation protection
+func (s *prioritySub) served(p Priority) {
+	if p == PriorityLow {
+		s.streak = 0
+		return
+	}
+	s.streak++
+}
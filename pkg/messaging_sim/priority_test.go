@@ -0,0 +1,153 @@
+package messaging_sim
+
+import (
+	"testing"
+	"time"
+)
+
+func receive(t *testing.T, ch chan Message) Message {
+	t.Helper()
+	select {
+	case msg := <-ch:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for message")
+		return Message{}
+	}
+}
+
+func TestPriorityOf(t *testing.T) {
+	ps := NewPubSub()
+
+	if p := ps.PriorityOf("rule.triggered"); p != PriorityHigh {
+		t.Errorf("Expected rule.triggered to be high priority, got %s", p)
+	}
+	if p := ps.PriorityOf("property.updated"); p != PriorityLow {
+		t.Errorf("Expected property.updated to be low priority, got %s", p)
+	}
+	if p := ps.PriorityOf("twin.created"); p != PriorityNormal {
+		t.Errorf("Expected twin.created to be normal priority, got %s", p)
+	}
+
+	ps.SetTopicPriority("twin.+", PriorityLow)
+	if p := ps.PriorityOf("twin.created"); p != PriorityLow {
+		t.Errorf("Expected twin.created to be low priority, got %s", p)
+	}
+	ps.SetTopicPriority("twin.created", PriorityHigh)
+	if p := ps.PriorityOf("twin.created"); p != PriorityHigh {
+		t.Errorf("Expected highest matching priority, got %s", p)
+	}
+}
+
+func TestPublishSetsPriority(t *testing.T) {
+	ps := NewPubSub()
+	ch := ps.Subscribe("#")
+
+	ps.Publish("rule.triggered", nil)
+	ps.PublishWithPriority("twin.created", nil, PriorityHigh)
+	ps.PublishWithPriority("twin.updated", nil, Priority(42))
+
+	if msg := receive(t, ch); msg.Priority != PriorityHigh {
+		t.Errorf("Expected high priority, got %s", msg.Priority)
+	}
+	if msg := receive(t, ch); msg.Priority != PriorityHigh {
+		t.Errorf("Expected explicit high priority, got %s", msg.Priority)
+	}
+	if msg := receive(t, ch); msg.Priority != PriorityNormal {
+		t.Errorf("Expected invalid priority to fall back to normal, got %s", msg.Priority)
+	}
+}
+
+func TestSubscribeWithPriorityOrdering(t *testing.T) {
+	ps := NewPubSub()
+	ch := ps.SubscribeWithPriority("#", 10)
+
+	for i := 0; i < 5; i++ {
+		ps.Publish("property.updated", i)
+	}
+	ps.Publish("rule.triggered", "alarm1")
+	ps.Publish("rule.triggered", "alarm2")
+
+	// One message may already be in flight; the alarms must overtake the rest
+	var order []string
+	for i := 0; i < 7; i++ {
+		order = append(order, receive(t, ch).Topic)
+	}
+	high := 0
+	for _, topic := range order[:3] {
+		if topic == "rule.triggered" {
+			high++
+		}
+	}
+	if high != 2 {
+		t.Errorf("Expected both alarms within the first 3 messages, got %v", order)
+	}
+}
+
+func TestSubscribeWithPriorityPreservesOrderWithinLane(t *testing.T) {
+	ps := NewPubSub()
+	ch := ps.SubscribeWithPriority("test", 10)
+
+	for i := 0; i < 5; i++ {
+		ps.Publish("test", i)
+	}
+	for i := 0; i < 5; i++ {
+		if msg := receive(t, ch); msg.Payload != i {
+			t.Errorf("Expected payload %d, got %v", i, msg.Payload)
+		}
+	}
+}
+
+func TestSubscribeWithPriorityStarvation(t *testing.T) {
+	ps := NewPubSub()
+	ch := ps.SubscribeWithPriority("#", 100)
+
+	ps.Publish("property.updated", "bulk")
+	for i := 0; i < 3*StarvationLimit; i++ {
+		ps.Publish("rule.triggered", i)
+	}
+
+	for i := 0; i <= StarvationLimit+1; i++ {
+		if receive(t, ch).Topic == "property.updated" {
+			return
+		}
+	}
+	t.Errorf("Expected low priority message within %d messages", StarvationLimit+2)
+}
+
+func TestSubscribeWithPriorityUnsubscribeAndClose(t *testing.T) {
+	ps := NewPubSub()
+	ch1 := ps.SubscribeWithPriority("test", 10)
+	ch2 := ps.SubscribeWithPriority("test", 10)
+
+	ps.Unsubscribe("test", ch1)
+	if len(ps.prioritySubs["test"]) != 1 {
+		t.Fatalf("Expected 1 priority subscriber, got %d", len(ps.prioritySubs["test"]))
+	}
+
+	ps.Close()
+	select {
+	case _, ok := <-ch2:
+		if ok {
+			t.Error("Expected channel to be closed")
+		}
+	case <-time.After(time.Second):
+		t.Error("Timed out waiting for channel to close")
+	}
+	if len(ps.prioritySubs) != 0 {
+		t.Errorf("Expected priority subscribers to be removed, got %d", len(ps.prioritySubs))
+	}
+}
+
+func TestUnsubscribeKeepsPrioritySubscriptions(t *testing.T) {
+	ps := NewPubSub()
+	priority := ps.SubscribeWithPriority("#", 10)
+	plain := ps.Subscribe("#")
+
+	ps.Unsubscribe("#", plain)
+	ps.Publish("twin.updated", "payload")
+
+	if msg := receive(t, priority); msg.Topic != "twin.updated" {
+		t.Errorf("Expected twin.updated, got %s", msg.Topic)
+	}
+}
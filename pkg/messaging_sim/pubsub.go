@@ -1,36 +1,124 @@
 package messaging_sim
 
 import (
+	"context"
 	"sync"
+	"sync/atomic"
+
+	"github.com/aleka07/go-digital-twin/pkg/eventbus"
 )
 
 // Message represents a message in the pub/sub system
-type Message struct {
-	Topic   string
-	Payload interface{}
-}
+type Message = eventbus.Message
 
-// PubSub provides a simple publish-subscribe mechanism
+// PubSub provides a simple publish-subscribe mechanism. It is the
+// in-process eventbus.Bus.
 type PubSub struct {
-	subscribers map[string][]chan Message
-	mutex       sync.RWMutex
+	subscribers  map[string][]chan Message
+	prioritySubs map[string][]*prioritySub
+	contexts     map[chan Message]func() bool // Stops the cleanup of subscriptions bound to a context
+	sequences    map[chan Message]*eventbus.Sequencer
+	priorities   []topicPriority
+	limiter      rateLimiter
+	dropped      atomic.Uint64 // Messages dropped because a subscriber queue was full
+	state        eventbus.State
+	done         chan struct{}  // Closed once the bus is closed
+	workers      sync.WaitGroup // Goroutines of priority subscriptions
+	mutex        sync.RWMutex
 }
 
 // NewPubSub creates a new pub/sub system
 func NewPubSub() *PubSub {
 	return &PubSub{
-		subscribers: make(map[string][]chan Message),
+		subscribers:  make(map[string][]chan Message),
+		prioritySubs: make(map[string][]*prioritySub),
+		contexts:     make(map[chan Message]func() bool),
+		sequences:    make(map[chan Message]*eventbus.Sequencer),
+		priorities:   append([]topicPriority(nil), defaultTopicPriorities...),
+		limiter:      rateLimiter{twins: make(map[string]*twinLimit)},
+		done:         make(chan struct{}),
+	}
+}
+
+// State returns the lifecycle state of the bus
+func (ps *PubSub) State() eventbus.State {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+
+	return ps.state
+}
+
+// Done returns a channel that is closed once the bus is closed
+func (ps *PubSub) Done() <-chan struct{} {
+	return ps.done
+}
+
+// Err returns eventbus.ErrBusClosed once the bus is closing, nil before
+func (ps *PubSub) Err() error {
+	if ps.State() != eventbus.StateRunning {
+		return eventbus.ErrBusClosed
 	}
+	return nil
+}
+
+// closedChannel returns a closed channel, which subscriptions to a closed
+// bus get
+func closedChannel() chan Message {
+	ch := make(chan Message)
+	close(ch)
+	return ch
 }
 
-// Subscribe creates a subscription to a topic and returns a channel for receiving messages
+// Subscribe creates a subscription to a topic and returns a channel for receiving messages.
+// Topics are dot-separated; a subscription topic may use "+" to match exactly one
+// level and a trailing "#" to match any number of remaining levels.
 func (ps *PubSub) Subscribe(topic string) chan Message {
+	return ps.SubscribeWithBuffer(topic, 10)
+}
+
+// SubscribeWithBuffer creates a subscription whose channel buffers up to size messages.
+// Subscribers that consume bursts of events should use a larger buffer, since
+// messages published to a full channel are dropped.
+func (ps *PubSub) SubscribeWithBuffer(topic string, size int) chan Message {
 	ps.mutex.Lock()
 	defer ps.mutex.Unlock()
 
+	if ps.state != eventbus.StateRunning {
+		return closedChannel()
+	}
+
 	// Create a buffered channel to prevent blocking publishers
-	ch := make(chan Message, 10)
+	ch := make(chan Message, size)
 	ps.subscribers[topic] = append(ps.subscribers[topic], ch)
+	ps.sequences[ch] = eventbus.NewSequencer()
+	return ch
+}
+
+// SubscribeContext creates a subscription whose channel buffers up to size
+// messages and which ends when ctx is done: the subscription is removed and
+// its channel closed, so consumers that return without unsubscribing, such
+// as the handler of a dropped event stream, leak neither.
+func (ps *PubSub) SubscribeContext(ctx context.Context, topic string, size int) chan Message {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	if ps.state != eventbus.StateRunning {
+		return closedChannel()
+	}
+
+	ch := make(chan Message, size)
+	ps.subscribers[topic] = append(ps.subscribers[topic], ch)
+	ps.sequences[ch] = eventbus.NewSequencer()
+	// The cleanup waits for the mutex if ctx is already done
+	ps.contexts[ch] = context.AfterFunc(ctx, func() {
+		ps.mutex.Lock()
+		defer ps.mutex.Unlock()
+
+		delete(ps.contexts, ch)
+		if ps.remove(topic, ch) {
+			close(ch)
+		}
+	})
 	return ch
 }
 
@@ -39,16 +127,41 @@ func (ps *PubSub) Unsubscribe(topic string, ch chan Message) {
 	ps.mutex.Lock()
 	defer ps.mutex.Unlock()
 
+	for i, sub := range ps.prioritySubs[topic] {
+		if sub.out == ch {
+			sub.stop(false)
+			ps.prioritySubs[topic] = append(ps.prioritySubs[topic][:i], ps.prioritySubs[topic][i+1:]...)
+			if len(ps.prioritySubs[topic]) == 0 {
+				delete(ps.prioritySubs, topic)
+			}
+			return
+		}
+	}
+
+	if ps.remove(topic, ch) {
+		if stop, ok := ps.contexts[ch]; ok {
+			stop()
+			delete(ps.contexts, ch)
+		}
+	}
+}
+
+// remove removes a buffered subscription and reports whether it existed;
+// the caller must hold the mutex
+func (ps *PubSub) remove(topic string, ch chan Message) bool {
 	subs, ok := ps.subscribers[topic]
 	if !ok {
-		return
+		return false
 	}
 
 	// Find and remove the channel
+	found := false
 	for i, sub := range subs {
 		if sub == ch {
 			// Remove the channel from the slice
 			ps.subscribers[topic] = append(subs[:i], subs[i+1:]...)
+			delete(ps.sequences, ch)
+			found = true
 			break
 		}
 	}
@@ -57,46 +170,150 @@ func (ps *PubSub) Unsubscribe(topic string, ch chan Message) {
 	if len(ps.subscribers[topic]) == 0 {
 		delete(ps.subscribers, topic)
 	}
+	return found
 }
 
-// Publish sends a message to all subscribers of a topic
-func (ps *PubSub) Publish(topic string, payload interface{}) {
+// Publish sends a message to all subscribers of a topic, with the priority
+// configured for the topic through SetTopicPriority, and returns how many
+// subscriptions it was queued for and dropped by. Publishing to a closed bus
+// does nothing and returns eventbus.ErrBusClosed.
+func (ps *PubSub) Publish(topic string, payload interface{}) (eventbus.Receipt, error) {
 	ps.mutex.RLock()
 	defer ps.mutex.RUnlock()
 
-	// If no subscribers, just return
-	subs, ok := ps.subscribers[topic]
-	if !ok {
-		return
+	if ps.state != eventbus.StateRunning {
+		return eventbus.Receipt{}, eventbus.ErrBusClosed
+	}
+	return ps.publish(topic, payload, ps.priorityOf(topic)), nil
+}
+
+// PublishWithPriority sends a message to all subscribers of a topic with an
+// explicit priority, overriding the priority configured for the topic
+func (ps *PubSub) PublishWithPriority(topic string, payload interface{}, priority Priority) (eventbus.Receipt, error) {
+	if !validPriority(priority) {
+		priority = PriorityNormal
+	}
+
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+
+	if ps.state != eventbus.StateRunning {
+		return eventbus.Receipt{}, eventbus.ErrBusClosed
 	}
+	return ps.publish(topic, payload, priority), nil
+}
 
+// publish sends a message subject to the rate limit of the twin it is
+// about; the caller must hold the mutex
+func (ps *PubSub) publish(topic string, payload interface{}, priority Priority) eventbus.Receipt {
 	// Create the message
 	msg := Message{
-		Topic:   topic,
-		Payload: payload,
+		Topic:    topic,
+		Payload:  payload,
+		Priority: priority,
+	}
+
+	return ps.publishLimited(msg)
+}
+
+// deliver delivers a message to matching subscribers; the caller must hold the mutex
+func (ps *PubSub) deliver(msg Message) eventbus.Receipt {
+	var receipt eventbus.Receipt
+	topic := msg.Topic
+	for pattern, subs := range ps.prioritySubs {
+		if !TopicMatches(pattern, topic) {
+			continue
+		}
+		for _, sub := range subs {
+			if sub.deliver(msg) {
+				receipt.Delivered++
+			} else {
+				receipt.Dropped++
+				ps.dropped.Add(1)
+			}
+		}
 	}
 
-	// Send to all subscribers (non-blocking)
-	for _, ch := range subs {
+	for pattern, subs := range ps.subscribers {
+		if !TopicMatches(pattern, topic) {
+			continue
+		}
+
+		// Send to all subscribers (non-blocking), numbering the message
+		// for each of them
+		for _, ch := range subs {
+			if ps.sequences[ch].Deliver(msg, sender(ch)) {
+				receipt.Delivered++
+			} else {
+				// Channel is full, skip this subscriber
+				receipt.Dropped++
+				ps.dropped.Add(1)
+			}
+		}
+	}
+	return receipt
+}
+
+// sender returns a function queueing messages on a channel without blocking
+func sender(ch chan Message) func(Message) bool {
+	return func(msg Message) bool {
 		select {
 		case ch <- msg:
-			// Message sent successfully
+			return true
 		default:
-			// Channel is full, skip this subscriber
+			return false
 		}
 	}
 }
 
-// Close closes all subscription channels
+// TopicMatches reports whether a topic matches a subscription pattern
+func TopicMatches(pattern, topic string) bool {
+	return eventbus.TopicMatches(pattern, topic)
+}
+
+// Close closes all subscription channels and returns once the goroutines of
+// priority subscriptions have ended. Closing a closed bus does nothing;
+// concurrent calls wait until the bus is closed.
 func (ps *PubSub) Close() {
 	ps.mutex.Lock()
-	defer ps.mutex.Unlock()
+	if ps.state != eventbus.StateRunning {
+		ps.mutex.Unlock()
+		<-ps.done
+		return
+	}
+	ps.state = eventbus.StateClosing
 
 	// Close all channels
 	for topic, subs := range ps.subscribers {
 		for _, ch := range subs {
 			close(ch)
+			delete(ps.sequences, ch)
 		}
 		delete(ps.subscribers, topic)
 	}
+
+	// Channels are closed, so their contexts need no cleanup
+	for ch, stop := range ps.contexts {
+		stop()
+		delete(ps.contexts, ch)
+	}
+
+	// Stop priority subscriptions, closing their channels
+	for topic, subs := range ps.prioritySubs {
+		for _, sub := range subs {
+			sub.stop(true)
+		}
+		delete(ps.prioritySubs, topic)
+	}
+
+	// Drop events held back by rate limits
+	ps.limiter.stop()
+	ps.mutex.Unlock()
+
+	ps.workers.Wait()
+
+	ps.mutex.Lock()
+	ps.state = eventbus.StateClosed
+	ps.mutex.Unlock()
+	close(ps.done)
 }
@@ -1,9 +1,12 @@
 package messaging_sim
 
 import (
+	"context"
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/eventbus"
 )
 
 func TestPubSubCreation(t *testing.T) {
@@ -35,6 +38,24 @@ func TestPubSubSubscribe(t *testing.T) {
 	}
 }
 
+func TestPubSubSubscribeWithBuffer(t *testing.T) {
+	ps := NewPubSub()
+
+	ch := ps.SubscribeWithBuffer("burst-topic", 100)
+	if cap(ch) != 100 {
+		t.Errorf("Expected channel buffer capacity of 100, got %d", cap(ch))
+	}
+
+	// A burst larger than the default buffer is delivered completely
+	for i := 0; i < 50; i++ {
+		ps.Publish("burst-topic", i)
+	}
+
+	if len(ch) != 50 {
+		t.Errorf("Expected 50 buffered messages, got %d", len(ch))
+	}
+}
+
 func TestPubSubPublish(t *testing.T) {
 	ps := NewPubSub()
 	
@@ -108,6 +129,63 @@ func TestPubSubUnsubscribe(t *testing.T) {
 	}
 }
 
+func TestPubSubWildcards(t *testing.T) {
+	ps := NewPubSub()
+
+	single := ps.Subscribe("twin.+")
+	multi := ps.Subscribe("#")
+
+	ps.Publish("twin.created", "created")
+	ps.Publish("feature.updated", "updated")
+
+	// The single-level wildcard only receives twin events
+	select {
+	case msg := <-single:
+		if msg.Topic != "twin.created" {
+			t.Errorf("Expected topic twin.created, got %s", msg.Topic)
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Error("Timed out waiting for message on twin.+")
+	}
+
+	select {
+	case msg := <-single:
+		t.Errorf("Expected no further messages on twin.+, got %s", msg.Topic)
+	default:
+	}
+
+	// The multi-level wildcard receives everything
+	if len(multi) != 2 {
+		t.Errorf("Expected 2 messages on #, got %d", len(multi))
+	}
+
+	// Test pattern matching directly
+	cases := []struct {
+		pattern string
+		topic   string
+		want    bool
+	}{
+		{"twin.created", "twin.created", true},
+		{"twin.+", "twin.created", true},
+		{"twin.+", "twin", false},
+		{"twin.+", "twin.created.extra", false},
+		{"twin.#", "twin.created.extra", true},
+		{"+.updated", "feature.updated", true},
+		{"#", "anything.at.all", true},
+		{"twin.created", "twin.deleted", false},
+		{"twin.#", "twin", true},
+		{"twin.#.extra", "twin.created.extra", false},
+		{"twin.created", "twin.created.extra", false},
+		{"twin.+.extra", "twin.created", false},
+	}
+
+	for _, c := range cases {
+		if got := TopicMatches(c.pattern, c.topic); got != c.want {
+			t.Errorf("TopicMatches(%q, %q) = %v, expected %v", c.pattern, c.topic, got, c.want)
+		}
+	}
+}
+
 func TestPubSubClose(t *testing.T) {
 	ps := NewPubSub()
 	
@@ -216,3 +294,178 @@ func TestPubSubConcurrency(t *testing.T) {
 	
 	wg.Wait()
 }
+
+func TestPubSubIsBus(t *testing.T) {
+	var bus eventbus.Bus = NewPubSub()
+	ch := bus.Subscribe("twin.+")
+	bus.Publish("twin.created", "pump-1")
+
+	if msg := <-ch; msg.Topic != "twin.created" || msg.Priority != eventbus.PriorityNormal {
+		t.Errorf("Unexpected message %+v", msg)
+	}
+	if load := eventbus.LoadOf(bus); load.Subscribers != 1 {
+		t.Errorf("Expected the load of 1 subscriber, got %+v", load)
+	}
+	bus.Close()
+}
+
+func TestPubSubSubscribeContext(t *testing.T) {
+	ps := NewPubSub()
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := ps.SubscribeContext(ctx, "twin.#", 4)
+
+	ps.Publish("twin.created", "pump-1")
+	if msg := <-ch; msg.Topic != "twin.created" {
+		t.Errorf("Unexpected message %+v", msg)
+	}
+
+	cancel()
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Error("Expected the channel to be closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the channel to be closed when the context is cancelled")
+	}
+	if load := ps.Load(); load.Subscribers != 0 || len(ps.contexts) != 0 {
+		t.Errorf("Expected the subscription to be removed, got %d subscribers", load.Subscribers)
+	}
+	ps.Publish("twin.created", "pump-2")
+
+	// Unsubscribing stops the cleanup without closing the channel
+	ctx, cancel = context.WithCancel(context.Background())
+	ch = ps.SubscribeContext(ctx, "twin.#", 4)
+	ps.Unsubscribe("twin.#", ch)
+	cancel()
+	ps.Publish("twin.created", "pump-3")
+	select {
+	case msg, ok := <-ch:
+		t.Errorf("Unexpected receive %+v, open %v", msg, ok)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	// Subscriptions of a done context end right away
+	ch = ps.SubscribeContext(ctx, "twin.#", 4)
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		t.Error("Expected the channel of a done context to be closed")
+	}
+
+	// Closing the bus closes the channels once
+	ctx, cancel = context.WithCancel(context.Background())
+	ps.SubscribeContext(ctx, "twin.#", 4)
+	ps.Close()
+	cancel()
+	if len(ps.contexts) != 0 {
+		t.Errorf("Expected no pending cleanups, got %d", len(ps.contexts))
+	}
+}
+
+func TestPubSubLifecycle(t *testing.T) {
+	ps := NewPubSub()
+	if ps.State() != eventbus.StateRunning || ps.Err() != nil {
+		t.Fatalf("Expected a running bus, got %v and %v", ps.State(), ps.Err())
+	}
+	ch := ps.Subscribe("twin.#")
+	priority := ps.SubscribeWithPriority("twin.#", 4)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ps.Close()
+			if ps.State() != eventbus.StateClosed {
+				t.Errorf("Expected Close to return once closed, got %v", ps.State())
+			}
+		}()
+	}
+	wg.Wait()
+
+	select {
+	case <-ps.Done():
+	default:
+		t.Error("Expected Done to be closed")
+	}
+	if ps.Err() != eventbus.ErrBusClosed {
+		t.Errorf("Expected %v, got %v", eventbus.ErrBusClosed, ps.Err())
+	}
+	if _, ok := <-ch; ok {
+		t.Error("Expected the subscription to be closed")
+	}
+	if _, ok := <-priority; ok {
+		t.Error("Expected the priority subscription to be closed")
+	}
+
+	// Operations on a closed bus do nothing
+	ps.Publish("twin.created", "pump-1")
+	ps.PublishWithPriority("twin.created", "pump-1", PriorityHigh)
+	ps.Unsubscribe("twin.#", ch)
+	for name, sub := range map[string]chan Message{
+		"Subscribe":             ps.Subscribe("twin.#"),
+		"SubscribeWithPriority": ps.SubscribeWithPriority("twin.#", 4),
+		"SubscribeContext":      ps.SubscribeContext(context.Background(), "twin.#", 4),
+	} {
+		if _, ok := <-sub; ok {
+			t.Errorf("Expected %s on a closed bus to return a closed channel", name)
+		}
+	}
+	if load := ps.Load(); load.Subscribers != 0 {
+		t.Errorf("Expected no subscribers, got %d", load.Subscribers)
+	}
+	if err := ps.SetTwinRateLimit("pump-1", RateLimit{Events: 1, Window: time.Second}); err != eventbus.ErrBusClosed {
+		t.Errorf("Expected %v, got %v", eventbus.ErrBusClosed, err)
+	}
+}
+
+func TestPubSubSequences(t *testing.T) {
+	ps := NewPubSub()
+	defer ps.Close()
+
+	fifo := ps.SubscribeWithBuffer("property.#", 1)
+	wide := ps.SubscribeWithBuffer("#", 16)
+	pump := map[string]interface{}{"twinId": "pump-1"}
+
+	ps.Publish("property.updated", pump)
+	ps.Publish("attribute.updated", pump)
+	ps.Publish("property.updated", pump) // Dropped by fifo
+	if msg := <-fifo; msg.Sequence != 1 {
+		t.Errorf("Expected sequence 1, got %d", msg.Sequence)
+	}
+	ps.Publish("property.updated", pump)
+	if msg := <-fifo; msg.Sequence != 3 {
+		t.Errorf("Expected sequence 3 after the dropped event, got %d", msg.Sequence)
+	}
+
+	// Subscriptions are numbered separately, by the events they match
+	for i := uint64(1); i <= 4; i++ {
+		if msg := <-wide; msg.Sequence != i {
+			t.Errorf("Expected sequence %d, got %d", i, msg.Sequence)
+		}
+	}
+
+	// Events of a PublishAndWait that gives up count as dropped
+	ps.Publish("property.updated", pump)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	ps.PublishAndWait(ctx, "property.updated", pump)
+	<-fifo
+	ps.Publish("property.updated", pump)
+	if msg := <-fifo; msg.Sequence != 6 {
+		t.Errorf("Expected sequence 6 after the event given up, got %d", msg.Sequence)
+	}
+
+	// Priority subscriptions may reorder the events of a twin across
+	// lanes, so they are not numbered and show no gaps
+	prio := ps.SubscribeWithPriority("#", 4)
+	ps.Publish("property.updated", pump)
+	ps.Publish("alarm.raised", pump)
+	gaps := eventbus.NewGaps()
+	for i := 0; i < 2; i++ {
+		if msg := <-prio; msg.Sequence != 0 || gaps.Missed(msg) != 0 {
+			t.Errorf("Expected no sequence on the priority subscription, got %d for %s", msg.Sequence, msg.Topic)
+		}
+	}
+}
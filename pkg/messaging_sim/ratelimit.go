@@ -0,0 +1,330 @@
+package messaging_sim
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/eventbus"
+)
+
+// Common errors
+var (
+	ErrInvalidRateLimit = errors.New("invalid rate limit")
+)
+
+// RateLimit bounds the change events published about a single twin. Up to
+// Events messages are published per Window; further messages are held until
+// the window allows more and coalesced while they wait, so subscribers
+// receive the latest values rather than every intermediate one.
+type RateLimit struct {
+	Events int
+	Window time.Duration
+}
+
+// RateStats counts the rate-limited events of a twin
+type RateStats struct {
+	Published  uint64 `json:"published"`  // Change events published, including held events released later
+	Suppressed uint64 `json:"suppressed"` // Change events replaced by a later event while held
+	Pending    int    `json:"pending"`    // Change events currently held
+}
+
+// TwinRateLimit is the rate limit of a twin with its counters
+type TwinRateLimit struct {
+	TwinID string
+	Limit  RateLimit
+	Stats  RateStats
+}
+
+// rateLimitedTopics are the change events subject to twin rate limits. Other
+// events about a twin, such as lifecycle changes and alarms, are never held,
+// but release the held events of the twin first so that order is kept.
+var rateLimitedTopics = map[string]bool{
+	"twin.updated":       true,
+	"feature.updated":    true,
+	"properties.updated": true,
+	"property.updated":   true,
+}
+
+// twinLimit is the rate limit state of a twin
+type twinLimit struct {
+	limit   RateLimit
+	sent    []time.Time // Publish times within the window
+	pending []Message   // Held messages, at most one per coalescing key, oldest first
+	timer   *time.Timer // Releases held messages when the window allows
+	stats   RateStats
+}
+
+// rateLimiter holds the rate limits of all twins. Its mutex is acquired
+// after the mutex of the PubSub and held while limited messages are
+// delivered, so the events of a twin stay in order.
+type rateLimiter struct {
+	twins map[string]*twinLimit
+	mutex sync.Mutex
+}
+
+// SetTwinRateLimit limits the change events published about a twin,
+// replacing any previous limit. Limits are kept when the twin is deleted.
+func (ps *PubSub) SetTwinRateLimit(twinID string, limit RateLimit) error {
+	if twinID == "" || limit.Events <= 0 || limit.Window <= 0 {
+		return ErrInvalidRateLimit
+	}
+	if err := ps.Err(); err != nil {
+		return err
+	}
+
+	l := &ps.limiter
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if tl, exists := l.twins[twinID]; exists {
+		tl.limit = limit
+		return nil
+	}
+	l.twins[twinID] = &twinLimit{limit: limit}
+	return nil
+}
+
+// RemoveTwinRateLimit removes the rate limit of a twin and publishes its held events
+func (ps *PubSub) RemoveTwinRateLimit(twinID string) {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+
+	l := &ps.limiter
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	tl, exists := l.twins[twinID]
+	if !exists {
+		return
+	}
+	ps.release(tl, time.Now(), len(tl.pending))
+	delete(l.twins, twinID)
+}
+
+// TwinRateLimitOf returns the rate limit of a twin and its counters
+func (ps *PubSub) TwinRateLimitOf(twinID string) (TwinRateLimit, bool) {
+	l := &ps.limiter
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	tl, exists := l.twins[twinID]
+	if !exists {
+		return TwinRateLimit{}, false
+	}
+	return tl.status(twinID), true
+}
+
+// TwinRateLimits returns the rate limits of all twins sorted by twin ID
+func (ps *PubSub) TwinRateLimits() []TwinRateLimit {
+	l := &ps.limiter
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	result := make([]TwinRateLimit, 0, len(l.twins))
+	for twinID, tl := range l.twins {
+		result = append(result, tl.status(twinID))
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].TwinID < result[j].TwinID })
+	return result
+}
+
+// status returns the limit and counters of a twin; the caller must hold the limiter mutex
+func (tl *twinLimit) status(twinID string) TwinRateLimit {
+	stats := tl.stats
+	stats.Pending = len(tl.pending)
+	return TwinRateLimit{TwinID: twinID, Limit: tl.limit, Stats: stats}
+}
+
+// publishLimited delivers a message unless the twin it is about is over its
+// rate limit, in which case the message is held; the caller must hold the mutex
+func (ps *PubSub) publishLimited(msg Message) eventbus.Receipt {
+	twinID := msg.TwinID()
+	if twinID == "" {
+		return ps.deliver(msg)
+	}
+
+	l := &ps.limiter
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	tl, limited := l.twins[twinID]
+	if !limited {
+		return ps.deliver(msg)
+	}
+
+	now := time.Now()
+	if !rateLimitedTopics[msg.Topic] {
+		ps.release(tl, now, len(tl.pending))
+		return ps.deliver(msg)
+	}
+
+	if len(tl.pending) > 0 {
+		tl.hold(msg)
+		return eventbus.Receipt{Held: true}
+	}
+
+	tl.prune(now)
+	if len(tl.sent) < tl.limit.Events {
+		tl.sent = append(tl.sent, now)
+		tl.stats.Published++
+		return ps.deliver(msg)
+	}
+
+	tl.hold(msg)
+	ps.schedule(twinID, tl, now)
+	return eventbus.Receipt{Held: true}
+}
+
+// releaseHeld delivers the held events of the twin a message is about, so
+// that the message does not overtake them; the caller must hold the mutex
+func (ps *PubSub) releaseHeld(msg Message) {
+	twinID := msg.TwinID()
+	if twinID == "" {
+		return
+	}
+
+	l := &ps.limiter
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if tl, limited := l.twins[twinID]; limited {
+		ps.release(tl, time.Now(), len(tl.pending))
+	}
+}
+
+// flush publishes the held events of a twin that its window allows
+func (ps *PubSub) flush(twinID string) {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+
+	l := &ps.limiter
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	tl, exists := l.twins[twinID]
+	if !exists || tl.timer == nil {
+		return
+	}
+	tl.timer = nil
+
+	now := time.Now()
+	tl.prune(now)
+	ps.release(tl, now, tl.limit.Events-len(tl.sent))
+
+	if len(tl.pending) > 0 {
+		ps.schedule(twinID, tl, now)
+	}
+}
+
+// release delivers up to n held messages of a twin, oldest first; the caller
+// must hold both mutexes
+func (ps *PubSub) release(tl *twinLimit, now time.Time, n int) {
+	if n > len(tl.pending) {
+		n = len(tl.pending)
+	}
+	if n < 0 {
+		n = 0
+	}
+	for _, msg := range tl.pending[:n] {
+		tl.sent = append(tl.sent, now)
+		tl.stats.Published++
+		ps.deliver(msg)
+	}
+	tl.pending = append(tl.pending[:0], tl.pending[n:]...)
+
+	if len(tl.pending) == 0 && tl.timer != nil {
+		tl.timer.Stop()
+		tl.timer = nil
+	}
+}
+
+// schedule arranges for held messages to be released when the oldest
+// publish leaves the window; the caller must hold the limiter mutex
+func (ps *PubSub) schedule(twinID string, tl *twinLimit, now time.Time) {
+	if tl.timer != nil {
+		return
+	}
+
+	delay := tl.limit.Window
+	if len(tl.sent) > 0 {
+		delay = tl.sent[0].Add(tl.limit.Window).Sub(now)
+	}
+	tl.timer = time.AfterFunc(delay, func() { ps.flush(twinID) })
+}
+
+// prune forgets publish times that left the window
+func (tl *twinLimit) prune(now time.Time) {
+	cutoff := now.Add(-tl.limit.Window)
+	i := 0
+	for i < len(tl.sent) && !tl.sent[i].After(cutoff) {
+		i++
+	}
+	tl.sent = append(tl.sent[:0], tl.sent[i:]...)
+}
+
+// hold queues a message, replacing a held message with the same coalescing
+// key. The replacement moves to the end, since it is the latest change.
+func (tl *twinLimit) hold(msg Message) {
+	key := coalescingKey(msg)
+	for i, held := range tl.pending {
+		if coalescingKey(held) != key {
+			continue
+		}
+		msg = coalesce(held, msg)
+		tl.pending = append(tl.pending[:i], tl.pending[i+1:]...)
+		tl.stats.Suppressed++
+		break
+	}
+	tl.pending = append(tl.pending, msg)
+}
+
+// coalescingKey identifies the value a change event is about: the topic
+// together with the feature and property of its payload, if any
+func coalescingKey(msg Message) string {
+	return msg.Topic + "/" + eventbus.PayloadField(msg.Payload, "featureId") + "/" + eventbus.PayloadField(msg.Payload, "propertyKey")
+}
+
+// coalesce combines a held message with a later one. Changes of several
+// properties are merged so no property is lost, the later value winning;
+// other messages are replaced by the later one.
+func coalesce(held, later Message) Message {
+	if later.Topic != "properties.updated" {
+		return later
+	}
+	heldProps, ok := eventbus.PropertiesOf(held.Payload)
+	if !ok || heldProps.Properties == nil {
+		return later
+	}
+	laterProps, ok := eventbus.PropertiesOf(later.Payload)
+	if !ok || laterProps.Properties == nil {
+		return later
+	}
+
+	merged := make(map[string]interface{}, len(heldProps.Properties)+len(laterProps.Properties))
+	for k, v := range heldProps.Properties {
+		merged[k] = v
+	}
+	for k, v := range laterProps.Properties {
+		merged[k] = v
+	}
+
+	laterProps.Properties = merged
+	later.Payload = laterProps
+	return later
+}
+
+// stop cancels the timers of all twins and drops their held events
+func (l *rateLimiter) stop() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for twinID, tl := range l.twins {
+		if tl.timer != nil {
+			tl.timer.Stop()
+		}
+		delete(l.twins, twinID)
+	}
+}
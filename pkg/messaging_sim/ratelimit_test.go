@@ -0,0 +1,110 @@
+package messaging_sim
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/eventbus"
+)
+
+func TestTwinRateLimit(t *testing.T) {
+	ps := NewPubSub()
+	ch := ps.SubscribeWithBuffer("#", 100)
+
+	if err := ps.SetTwinRateLimit("pump-1", RateLimit{Events: 0, Window: time.Second}); err != ErrInvalidRateLimit {
+		t.Errorf("Expected ErrInvalidRateLimit, got %v", err)
+	}
+	if err := ps.SetTwinRateLimit("pump-1", RateLimit{Events: 2, Window: 100 * time.Millisecond}); err != nil {
+		t.Fatalf("Failed to set rate limit: %v", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		ps.Publish("property.updated", map[string]interface{}{"twinId": "pump-1", "featureId": "status", "propertyKey": "pressure", "value": float64(i)})
+	}
+	// Other twins are not limited
+	ps.Publish("property.updated", map[string]interface{}{"twinId": "pump-2", "featureId": "status", "propertyKey": "pressure", "value": 1.0})
+
+	if len(ch) != 3 {
+		t.Fatalf("Expected 3 messages before the window ends, got %d", len(ch))
+	}
+	for i := 0; i < 3; i++ {
+		<-ch
+	}
+
+	status, ok := ps.TwinRateLimitOf("pump-1")
+	if !ok || status.Stats.Published != 2 || status.Stats.Suppressed != 2 || status.Stats.Pending != 1 {
+		t.Errorf("Unexpected rate limit status %+v", status)
+	}
+
+	// The latest value is published when the window allows
+	select {
+	case msg := <-ch:
+		if msg.Payload.(map[string]interface{})["value"] != 4.0 {
+			t.Errorf("Expected the latest value, got %v", msg.Payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the held message to be published")
+	}
+
+	if status, _ := ps.TwinRateLimitOf("pump-1"); status.Stats.Published != 3 || status.Stats.Pending != 0 {
+		t.Errorf("Unexpected rate limit status %+v", status)
+	}
+}
+
+func TestTwinRateLimitCoalescing(t *testing.T) {
+	ps := NewPubSub()
+	ch := ps.SubscribeWithBuffer("#", 100)
+	ps.SetTwinRateLimit("pump-1", RateLimit{Events: 1, Window: time.Hour})
+
+	ps.Publish("properties.updated", map[string]interface{}{"twinId": "pump-1", "featureId": "status", "properties": map[string]interface{}{"pressure": 1.0}})
+	<-ch
+
+	ps.Publish("properties.updated", map[string]interface{}{"twinId": "pump-1", "featureId": "status", "properties": map[string]interface{}{"pressure": 2.0, "flow": 10.0}})
+	ps.Publish("properties.updated", eventbus.PropertiesUpdated{TwinID: "pump-1", FeatureID: "status", Properties: map[string]interface{}{"pressure": 3.0}})
+	ps.Publish("twin.updated", map[string]string{"id": "pump-1"})
+
+	if len(ch) != 0 {
+		t.Fatalf("Expected changes to be held, got %d messages", len(ch))
+	}
+
+	// Events that are not rate limited release the held events first
+	ps.Publish("twin.deleted", map[string]string{"id": "pump-1"})
+	if len(ch) != 3 {
+		t.Fatalf("Expected 3 messages, got %d", len(ch))
+	}
+
+	msg := <-ch
+	u, _ := eventbus.PropertiesOf(msg.Payload)
+	if msg.Topic != "properties.updated" || u.TwinID != "pump-1" || u.Properties["pressure"] != 3.0 || u.Properties["flow"] != 10.0 {
+		t.Errorf("Expected merged properties with the latest values, got %s %v", msg.Topic, msg.Payload)
+	}
+	if msg := <-ch; msg.Topic != "twin.updated" {
+		t.Errorf("Expected twin.updated, got %s", msg.Topic)
+	}
+	if msg := <-ch; msg.Topic != "twin.deleted" {
+		t.Errorf("Expected twin.deleted last, got %s", msg.Topic)
+	}
+}
+
+func TestRemoveTwinRateLimit(t *testing.T) {
+	ps := NewPubSub()
+	ch := ps.SubscribeWithBuffer("#", 100)
+	ps.SetTwinRateLimit("pump-1", RateLimit{Events: 1, Window: time.Hour})
+
+	ps.Publish("twin.updated", map[string]string{"id": "pump-1"})
+	ps.Publish("feature.updated", map[string]string{"twinId": "pump-1", "featureId": "status"})
+	if len(ch) != 1 {
+		t.Fatalf("Expected 1 message, got %d", len(ch))
+	}
+
+	ps.RemoveTwinRateLimit("pump-1")
+	if len(ch) != 2 {
+		t.Errorf("Expected the held message to be published, got %d messages", len(ch))
+	}
+	if _, ok := ps.TwinRateLimitOf("pump-1"); ok {
+		t.Error("Expected the rate limit to be removed")
+	}
+	if limits := ps.TwinRateLimits(); len(limits) != 0 {
+		t.Errorf("Expected no rate limits, got %+v", limits)
+	}
+}
@@ -0,0 +1,139 @@
+package messaging_sim
+
+import (
+	"context"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/eventbus"
+)
+
+// maxWaitInterval bounds the interval at which PublishAndWait retries
+// subscriptions whose queue was full
+const maxWaitInterval = 10 * time.Millisecond
+
+// target is a subscription an event is waiting to be queued for
+type target struct {
+	pattern string
+	ch      chan Message        // Set for buffered subscriptions
+	sub     *prioritySub        // Set for priority subscriptions
+	seq     *eventbus.Sequencer // Set for buffered subscriptions
+}
+
+// PublishAndWait delivers a message to every subscription of its topic,
+// waiting for room in full queues rather than dropping it, until ctx is
+// done. Rate limits do not hold it, but the held events of its twin are
+// delivered first. Subscriptions whose queue is still full when ctx is done
+// are counted as dropped, and the error of ctx is returned. The mutex is not
+// held while waiting, so slow subscribers can still unsubscribe.
+func (ps *PubSub) PublishAndWait(ctx context.Context, topic string, payload interface{}) (eventbus.Receipt, error) {
+	var receipt eventbus.Receipt
+
+	ps.mutex.RLock()
+	if ps.state != eventbus.StateRunning {
+		ps.mutex.RUnlock()
+		return receipt, eventbus.ErrBusClosed
+	}
+	msg := Message{Topic: topic, Payload: payload, Priority: ps.priorityOf(topic)}
+	ps.releaseHeld(msg)
+	pending := ps.offer(msg, ps.targets(topic), &receipt)
+	ps.mutex.RUnlock()
+
+	interval := 100 * time.Microsecond
+	for len(pending) > 0 {
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			for _, t := range pending {
+				if t.seq != nil {
+					t.seq.Skip(msg)
+				}
+			}
+			receipt.Dropped += len(pending)
+			ps.dropped.Add(uint64(len(pending)))
+			return receipt, ctx.Err()
+		case <-ps.done:
+			timer.Stop()
+			return receipt, eventbus.ErrBusClosed
+		case <-timer.C:
+		}
+		if interval *= 2; interval > maxWaitInterval {
+			interval = maxWaitInterval
+		}
+
+		ps.mutex.RLock()
+		if ps.state != eventbus.StateRunning {
+			ps.mutex.RUnlock()
+			return receipt, eventbus.ErrBusClosed
+		}
+		pending = ps.offer(msg, pending, &receipt)
+		ps.mutex.RUnlock()
+	}
+	return receipt, nil
+}
+
+// targets returns the subscriptions matching a topic; the caller must hold
+// the mutex
+func (ps *PubSub) targets(topic string) []target {
+	var targets []target
+	for pattern, subs := range ps.prioritySubs {
+		if TopicMatches(pattern, topic) {
+			for _, sub := range subs {
+				targets = append(targets, target{pattern: pattern, sub: sub})
+			}
+		}
+	}
+	for pattern, subs := range ps.subscribers {
+		if TopicMatches(pattern, topic) {
+			for _, ch := range subs {
+				targets = append(targets, target{pattern: pattern, ch: ch, seq: ps.sequences[ch]})
+			}
+		}
+	}
+	return targets
+}
+
+// offer queues a message for the targets that are still subscribed and
+// have room, and returns those that are full; the caller must hold the
+// mutex, which keeps the channels of subscribed targets open
+func (ps *PubSub) offer(msg Message, targets []target, receipt *eventbus.Receipt) []target {
+	var full []target
+	for _, t := range targets {
+		if !ps.subscribed(t) {
+			continue
+		}
+
+		var queued bool
+		if t.sub != nil {
+			queued = t.sub.enqueue(msg)
+		} else {
+			queued = t.seq.Queue(msg, sender(t.ch))
+		}
+
+		if queued {
+			receipt.Delivered++
+		} else {
+			full = append(full, t)
+		}
+	}
+	return full
+}
+
+// subscribed reports whether a target is still subscribed; the caller must
+// hold the mutex
+func (ps *PubSub) subscribed(t target) bool {
+	if t.sub != nil {
+		for _, sub := range ps.prioritySubs[t.pattern] {
+			if sub == t.sub {
+				return true
+			}
+		}
+		return false
+	}
+	for _, ch := range ps.subscribers[t.pattern] {
+		if ch == t.ch {
+			return true
+		}
+	}
+	return false
+}
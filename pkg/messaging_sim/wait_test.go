@@ -0,0 +1,97 @@
+package messaging_sim
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/eventbus"
+)
+
+func TestPublishReceipt(t *testing.T) {
+	ps := NewPubSub()
+	full := ps.SubscribeWithBuffer("twin.#", 1)
+	ps.SubscribeWithBuffer("twin.+", 4)
+	ps.SubscribeWithPriority("#", 4)
+	ps.Subscribe("alarm.#")
+
+	if receipt, err := ps.Publish("twin.created", "pump-1"); err != nil || receipt != (eventbus.Receipt{Delivered: 3}) {
+		t.Errorf("Expected 3 deliveries, got %+v (%v)", receipt, err)
+	}
+	if receipt, _ := ps.Publish("twin.updated", "pump-1"); receipt.Delivered != 2 || receipt.Dropped != 1 {
+		t.Errorf("Expected 2 deliveries and 1 drop, got %+v", receipt)
+	}
+	<-full
+
+	ps.SetTwinRateLimit("pump-1", RateLimit{Events: 1, Window: time.Hour})
+	update := map[string]interface{}{"id": "pump-1"}
+	ps.Publish("twin.updated", update)
+	if receipt, _ := ps.Publish("twin.updated", update); !receipt.Held || receipt.Delivered != 0 {
+		t.Errorf("Expected the event to be held, got %+v", receipt)
+	}
+
+	ps.Close()
+	if _, err := ps.Publish("twin.created", "pump-2"); err != eventbus.ErrBusClosed {
+		t.Errorf("Expected %v, got %v", eventbus.ErrBusClosed, err)
+	}
+	if _, err := ps.PublishWithPriority("twin.created", "pump-2", PriorityHigh); err != eventbus.ErrBusClosed {
+		t.Errorf("Expected %v, got %v", eventbus.ErrBusClosed, err)
+	}
+}
+
+func TestPublishAndWait(t *testing.T) {
+	ps := NewPubSub()
+	defer ps.Close()
+	ch := ps.SubscribeWithBuffer("alarm.#", 1)
+	priority := ps.SubscribeWithPriority("alarm.#", 1)
+	ps.Publish("alarm.raised", 1)
+
+	// Both queues are full until the subscribers receive
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		<-ch
+		<-priority
+	}()
+	receipt, err := ps.PublishAndWait(context.Background(), "alarm.raised", 2)
+	if err != nil || receipt != (eventbus.Receipt{Delivered: 2}) {
+		t.Fatalf("Expected 2 deliveries, got %+v (%v)", receipt, err)
+	}
+	if msg := <-ch; msg.Payload != 2 {
+		t.Errorf("Expected the waiting event, got %v", msg.Payload)
+	}
+
+	// Queues that stay full are dropped when the context ends
+	ps.Publish("alarm.raised", 3)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	receipt, err = ps.PublishAndWait(ctx, "alarm.raised", 4)
+	if !errors.Is(err, context.DeadlineExceeded) || receipt.Dropped != 2 {
+		t.Errorf("Expected 2 drops on timeout, got %+v (%v)", receipt, err)
+	}
+
+	// Unsubscribing ends the wait for a subscription
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		ps.Unsubscribe("alarm.#", ch)
+	}()
+	<-priority
+	<-priority
+	if receipt, err = ps.PublishAndWait(context.Background(), "alarm.raised", 5); err != nil || receipt.Delivered != 1 {
+		t.Errorf("Expected delivery to the priority subscription only, got %+v (%v)", receipt, err)
+	}
+
+	// Buses without PublishAndWait publish
+	if receipt, err = eventbus.PublishAndWait(context.Background(), publisherOnly{ps}, "twin.created", 6); err != nil || receipt.Delivered != 0 {
+		t.Errorf("Expected a plain publish, got %+v (%v)", receipt, err)
+	}
+}
+
+// publisherOnly hides PublishAndWait
+type publisherOnly struct {
+	ps *PubSub
+}
+
+func (p publisherOnly) Publish(topic string, payload interface{}) (eventbus.Receipt, error) {
+	return p.ps.Publish(topic, payload)
+}
@@ -0,0 +1,307 @@
+package ngsild
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aleka07/go-digital-twin/pkg/convert"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// Common errors
+var (
+	ErrInvalidEntity             = errors.New("invalid NGSI-LD entity")
+	ErrSubscriptionNotFound      = errors.New("subscription not found")
+	ErrSubscriptionAlreadyExists = errors.New("subscription already exists")
+	ErrInvalidSubscription       = errors.New("invalid subscription")
+)
+
+// CoreContext is the NGSI-LD core @context
+const CoreContext = "https://uri.etsi.org/ngsi-ld/v1/ngsi-ld-core-context.jsonld"
+
+// Attribute types
+const (
+	TypeProperty     = "Property"
+	TypeRelationship = "Relationship"
+	TypeGeoProperty  = "GeoProperty"
+)
+
+// entityPrefix prefixes the entity IDs of twins whose IDs are not URIs
+const entityPrefix = "urn:ngsi-ld:"
+
+// Entity is an NGSI-LD entity in normalized form: id, type and one member per attribute
+type Entity map[string]interface{}
+
+// EntityID returns the entity ID of a twin. Twin IDs that already are URIs
+// are used as they are, others become urn:ngsi-ld:<type>:<id>.
+func EntityID(dt *twin.DigitalTwin) string {
+	if strings.Contains(dt.ID, ":") {
+		return dt.ID
+	}
+	return entityPrefix + dt.Type + ":" + dt.ID
+}
+
+// TwinID returns the twin ID an entity ID of the given type maps to
+func TwinID(entityID, entityType string) string {
+	prefix := entityPrefix + entityType + ":"
+	if id := strings.TrimPrefix(entityID, prefix); id != entityID && id != "" && !strings.Contains(id, ":") {
+		return id
+	}
+	return entityID
+}
+
+// Resolve returns the twin of an entity ID
+func Resolve(reg *registry.Registry, entityID string) (*twin.DigitalTwin, error) {
+	if dt, err := reg.Get(entityID); err == nil {
+		return dt, nil
+	}
+
+	// urn:ngsi-ld:<type>:<id>
+	rest := strings.TrimPrefix(entityID, entityPrefix)
+	if rest == entityID {
+		return nil, registry.ErrTwinNotFound
+	}
+	entityType, id, ok := strings.Cut(rest, ":")
+	if !ok {
+		return nil, registry.ErrTwinNotFound
+	}
+
+	dt, err := reg.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if dt.Type != entityType {
+		return nil, registry.ErrTwinNotFound
+	}
+	return dt, nil
+}
+
+// ToEntity converts a twin to an entity. Twin attributes become properties
+// and twin relationships become relationships. Features become properties
+// whose value is the object of their properties.
+// If attrs is not empty, only the listed attributes are included.
+func ToEntity(reg *registry.Registry, dt *twin.DigitalTwin, attrs []string) Entity {
+	entity := Entity{
+		"id":   EntityID(dt),
+		"type": dt.Type,
+	}
+
+	include := func(name string) bool {
+		if len(attrs) == 0 {
+			return true
+		}
+		for _, a := range attrs {
+			if a == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	for key, value := range dt.GetAllAttributes() {
+		if include(key) {
+			entity[key] = map[string]interface{}{"type": TypeProperty, "value": value}
+		}
+	}
+
+	for name, targets := range dt.GetAllRelationships() {
+		if !include(name) {
+			continue
+		}
+
+		objects := make([]interface{}, len(targets))
+		for i, id := range targets {
+			objects[i] = id
+			if target, err := reg.Get(id); err == nil {
+				objects[i] = EntityID(target)
+			}
+		}
+
+		var object interface{} = objects
+		if len(objects) == 1 {
+			object = objects[0]
+		}
+		entity[name] = map[string]interface{}{"type": TypeRelationship, "object": object}
+	}
+
+	// Features take precedence over attributes and relationships of the same name
+	for id, feature := range dt.GetAllFeatures() {
+		if include(id) {
+			entity[id] = map[string]interface{}{"type": TypeProperty, "value": feature.GetAllProperties()}
+		}
+	}
+
+	return entity
+}
+
+// Transform applies value transforms to the property values of an entity.
+// Transforms with a property convert that member of an object value, such as
+// a property of a feature. The entity is changed in place and returned.
+func Transform(entity Entity, transforms []convert.Transform) Entity {
+	for _, t := range transforms {
+		attr, ok := entity[t.Attribute].(map[string]interface{})
+		if !ok || attr["type"] != TypeProperty {
+			continue
+		}
+
+		value, exists := attr["value"]
+		if !exists {
+			continue
+		}
+
+		if t.Property == "" {
+			value = t.Apply(value)
+		} else {
+			obj, ok := value.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			v, exists := obj[t.Property]
+			if !exists {
+				continue
+			}
+
+			// Copy the object, which may be shared with the twin
+			converted := make(map[string]interface{}, len(obj))
+			for k, v := range obj {
+				converted[k] = v
+			}
+			converted[t.Property] = t.Apply(v)
+			value = converted
+		}
+
+		entity[t.Attribute] = map[string]interface{}{"type": TypeProperty, "value": value}
+	}
+	return entity
+}
+
+// NewTwin creates a twin from an entity
+func NewTwin(entity Entity) (*twin.DigitalTwin, error) {
+	id, _ := entity["id"].(string)
+	entityType, _ := entity["type"].(string)
+	if id == "" || entityType == "" {
+		return nil, fmt.Errorf("%w: id and type are required", ErrInvalidEntity)
+	}
+	if !strings.Contains(id, ":") {
+		return nil, fmt.Errorf("%w: id must be a URI", ErrInvalidEntity)
+	}
+
+	dt := twin.NewDigitalTwin(TwinID(id, entityType), entityType)
+	if _, err := Apply(dt, Attributes(entity)); err != nil {
+		return nil, err
+	}
+	return dt, nil
+}
+
+// Attributes returns the attribute members of an entity, without id, type and @context
+func Attributes(entity Entity) map[string]interface{} {
+	attrs := make(map[string]interface{}, len(entity))
+	for name, value := range entity {
+		if name != "id" && name != "type" && name != "@context" {
+			attrs[name] = value
+		}
+	}
+	return attrs
+}
+
+// Apply updates a twin with NGSI-LD attributes. Properties with an object
+// value update the properties of the feature of the same name, other
+// properties and geo-properties set twin attributes, and relationships
+// replace the twin relationship of the same name.
+// It returns the IDs of the changed features, sorted.
+func Apply(dt *twin.DigitalTwin, attrs map[string]interface{}) ([]string, error) {
+	// Validate all attributes before changing anything
+	names := make([]string, 0, len(attrs))
+	for name, raw := range attrs {
+		if twin.IsReservedAttribute(name) {
+			return nil, fmt.Errorf("%w: attribute %s is reserved for the server", ErrInvalidEntity, name)
+		}
+		attr, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%w: attribute %s must be an object", ErrInvalidEntity, name)
+		}
+
+		switch attr["type"] {
+		case TypeProperty, TypeGeoProperty:
+			if _, ok := attr["value"]; !ok {
+				return nil, fmt.Errorf("%w: property %s requires a value", ErrInvalidEntity, name)
+			}
+		case TypeRelationship:
+			if _, ok := relationshipTargets(attr["object"]); !ok {
+				return nil, fmt.Errorf("%w: relationship %s requires an object", ErrInvalidEntity, name)
+			}
+		default:
+			return nil, fmt.Errorf("%w: attribute %s has unsupported type %v", ErrInvalidEntity, name, attr["type"])
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var changed []string
+	for _, name := range names {
+		attr := attrs[name].(map[string]interface{})
+
+		if attr["type"] == TypeRelationship {
+			targets, _ := relationshipTargets(attr["object"])
+			if err := dt.SetRelationship(name, targets); err != nil {
+				return changed, err
+			}
+			continue
+		}
+
+		props, isObject := attr["value"].(map[string]interface{})
+		if !isObject || attr["type"] == TypeGeoProperty {
+			dt.SetAttribute(name, attr["value"])
+			continue
+		}
+
+		feature, exists := dt.GetFeature(name)
+		if !exists {
+			feature = twin.NewFeatureState()
+			if err := dt.AddFeature(name, feature); err != nil {
+				return changed, err
+			}
+		}
+		for key, value := range props {
+			feature.SetProperty(key, value)
+		}
+		changed = append(changed, name)
+	}
+	return changed, nil
+}
+
+// relationshipTargets returns the twin IDs of a relationship object, which is
+// a single entity ID or a non-empty list of them
+func relationshipTargets(object interface{}) ([]string, bool) {
+	switch o := object.(type) {
+	case string:
+		if o != "" {
+			return []string{relationshipTarget(o)}, true
+		}
+	case []interface{}:
+		targets := make([]string, 0, len(o))
+		for _, item := range o {
+			id, ok := item.(string)
+			if !ok || id == "" {
+				return nil, false
+			}
+			targets = append(targets, relationshipTarget(id))
+		}
+		return targets, len(targets) > 0
+	}
+	return nil, false
+}
+
+// relationshipTarget returns the twin ID a relationship object refers to
+func relationshipTarget(object string) string {
+	// urn:ngsi-ld:<type>:<id>
+	if rest := strings.TrimPrefix(object, entityPrefix); rest != object {
+		if entityType, _, ok := strings.Cut(rest, ":"); ok {
+			return TwinID(object, entityType)
+		}
+	}
+	return object
+}
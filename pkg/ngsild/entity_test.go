@@ -0,0 +1,145 @@
+package ngsild
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/convert"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestEntityIDs(t *testing.T) {
+	dt := twin.NewDigitalTwin("pump-1", "Pump")
+	if id := EntityID(dt); id != "urn:ngsi-ld:Pump:pump-1" {
+		t.Errorf("Expected urn:ngsi-ld:Pump:pump-1, got %s", id)
+	}
+
+	uri := twin.NewDigitalTwin("urn:example:pump-2", "Pump")
+	if id := EntityID(uri); id != "urn:example:pump-2" {
+		t.Errorf("Expected URI twin IDs to be kept, got %s", id)
+	}
+
+	if id := TwinID("urn:ngsi-ld:Pump:pump-1", "Pump"); id != "pump-1" {
+		t.Errorf("Expected pump-1, got %s", id)
+	}
+	if id := TwinID("urn:ngsi-ld:Valve:v-1", "Pump"); id != "urn:ngsi-ld:Valve:v-1" {
+		t.Errorf("Expected IDs of other types to be kept, got %s", id)
+	}
+
+	reg := registry.NewRegistry()
+	reg.Create(dt)
+	reg.Create(uri)
+
+	for _, entityID := range []string{"urn:ngsi-ld:Pump:pump-1", "urn:example:pump-2"} {
+		if _, err := Resolve(reg, entityID); err != nil {
+			t.Errorf("Failed to resolve %s: %v", entityID, err)
+		}
+	}
+	if _, err := Resolve(reg, "urn:ngsi-ld:Valve:pump-1"); err != registry.ErrTwinNotFound {
+		t.Errorf("Expected ErrTwinNotFound for a type mismatch, got %v", err)
+	}
+}
+
+func TestEntityConversion(t *testing.T) {
+	reg := registry.NewRegistry()
+	reg.Create(twin.NewDigitalTwin("building-1", "Building"))
+
+	dt, err := NewTwin(Entity{
+		"id":       "urn:ngsi-ld:Pump:pump-1",
+		"type":     "Pump",
+		"@context": CoreContext,
+		"name":     map[string]interface{}{"type": "Property", "value": "Main pump"},
+		"location": map[string]interface{}{"type": "GeoProperty", "value": map[string]interface{}{"type": "Point", "coordinates": []interface{}{13.4, 52.5}}},
+		"isIn":     map[string]interface{}{"type": "Relationship", "object": "urn:ngsi-ld:Building:building-1"},
+		"motor":    map[string]interface{}{"type": "Property", "value": map[string]interface{}{"rpm": 1450.0}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create twin: %v", err)
+	}
+
+	if dt.ID != "pump-1" || dt.Type != "Pump" {
+		t.Errorf("Unexpected twin %s of type %s", dt.ID, dt.Type)
+	}
+	if isIn := dt.GetRelationship("isIn"); len(isIn) != 1 || isIn[0] != "building-1" {
+		t.Errorf("Expected relationship to the twin building-1, got %v", isIn)
+	}
+	if motor, exists := dt.GetFeature("motor"); !exists {
+		t.Error("Expected object property to become a feature")
+	} else if rpm, _ := motor.GetProperty("rpm"); rpm != 1450.0 {
+		t.Errorf("Expected rpm 1450, got %v", rpm)
+	}
+
+	entity := ToEntity(reg, dt, nil)
+	if entity["id"] != "urn:ngsi-ld:Pump:pump-1" {
+		t.Errorf("Unexpected entity ID: %v", entity["id"])
+	}
+
+	isIn := entity["isIn"].(map[string]interface{})
+	if isIn["type"] != TypeRelationship || isIn["object"] != "urn:ngsi-ld:Building:building-1" {
+		t.Errorf("Unexpected relationship: %v", isIn)
+	}
+
+	name := entity["name"].(map[string]interface{})
+	if name["type"] != TypeProperty || name["value"] != "Main pump" {
+		t.Errorf("Unexpected property: %v", name)
+	}
+
+	// Attributes can be selected
+	selected := ToEntity(reg, dt, []string{"motor"})
+	if _, exists := selected["name"]; exists || selected["motor"] == nil {
+		t.Errorf("Unexpected selected entity: %v", selected)
+	}
+
+	invalid := []Entity{
+		{"type": "Pump"},
+		{"id": "pump-1", "type": "Pump"},
+		{"id": "urn:ngsi-ld:Pump:p", "type": "Pump", "name": "plain"},
+		{"id": "urn:ngsi-ld:Pump:p", "type": "Pump", "name": map[string]interface{}{"type": "Property"}},
+		{"id": "urn:ngsi-ld:Pump:p", "type": "Pump", "isIn": map[string]interface{}{"type": "Relationship"}},
+		{"id": "urn:ngsi-ld:Pump:p", "type": "Pump", "name": map[string]interface{}{"type": "LanguageMap", "value": "x"}},
+	}
+	for _, e := range invalid {
+		if _, err := NewTwin(e); !errors.Is(err, ErrInvalidEntity) {
+			t.Errorf("Expected ErrInvalidEntity for %v, got %v", e, err)
+		}
+	}
+}
+
+func TestTransform(t *testing.T) {
+	reg := registry.NewRegistry()
+	dt := twin.NewDigitalTwin("boiler-1", "Boiler")
+	dt.SetAttribute("capacity", 12.0)
+	dt.SetAttribute("name", "Boiler 1")
+	climate := twin.NewFeatureState()
+	climate.SetProperty("temperature", 21.37)
+	climate.SetProperty("mode", 2.0)
+	dt.AddFeature("climate", climate)
+	reg.Create(dt)
+
+	one := 1
+	entity := Transform(ToEntity(reg, dt, nil), []convert.Transform{
+		{Attribute: "capacity", From: "kW", To: "W"},
+		{Attribute: "name", Precision: &one},
+		{Attribute: "climate", Property: "temperature", From: "degC", To: "degF", Precision: &one},
+		{Attribute: "climate", Property: "mode", Enum: map[string]interface{}{"2": "eco"}},
+		{Attribute: "missing", Precision: &one},
+	})
+
+	if v := entity["capacity"].(map[string]interface{})["value"]; v != 12000.0 {
+		t.Errorf("Expected capacity 12000 W, got %v", v)
+	}
+	if v := entity["name"].(map[string]interface{})["value"]; v != "Boiler 1" {
+		t.Errorf("Expected the name to be kept, got %v", v)
+	}
+
+	value := entity["climate"].(map[string]interface{})["value"].(map[string]interface{})
+	if value["temperature"] != 70.5 || value["mode"] != "eco" {
+		t.Errorf("Unexpected climate %v", value)
+	}
+
+	// The twin is not changed
+	if v, _ := climate.GetProperty("temperature"); v != 21.37 {
+		t.Errorf("Expected the stored temperature to be kept, got %v", v)
+	}
+}
@@ -0,0 +1,439 @@
+package ngsild
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/convert"
+	"github.com/aleka07/go-digital-twin/pkg/eventbus"
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// notificationTimeout bounds a single notification request
+const notificationTimeout = 10 * time.Second
+
+// Notification statuses
+const (
+	StatusOK     = "ok"
+	StatusFailed = "failed"
+)
+
+// EntitySelector selects entities by type and, optionally, ID
+type EntitySelector struct {
+	ID   string `json:"id,omitempty"`
+	Type string `json:"type"`
+}
+
+// Endpoint is where notifications are sent
+type Endpoint struct {
+	URI    string `json:"uri"`
+	Accept string `json:"accept,omitempty"`
+}
+
+// NotificationParams configures the notifications of a subscription and reports their outcome
+type NotificationParams struct {
+	Attributes       []string            `json:"attributes,omitempty"` // Attributes included in notifications, all when empty
+	Endpoint         Endpoint            `json:"endpoint"`
+	Transforms       []convert.Transform `json:"transforms,omitempty"` // Value conversions applied before delivery
+	Status           string              `json:"status,omitempty"`
+	TimesSent        int                 `json:"timesSent,omitempty"`
+	LastNotification *time.Time          `json:"lastNotification,omitempty"`
+	LastSuccess      *time.Time          `json:"lastSuccess,omitempty"`
+	LastFailure      *time.Time          `json:"lastFailure,omitempty"`
+}
+
+// Subscription notifies an endpoint of changes to matching entities
+type Subscription struct {
+	ID                string             `json:"id"`
+	Type              string             `json:"type"`
+	Entities          []EntitySelector   `json:"entities,omitempty"`          // Matching entities, all when empty
+	WatchedAttributes []string           `json:"watchedAttributes,omitempty"` // Attributes whose changes notify, all when empty
+	Notification      NotificationParams `json:"notification"`
+}
+
+// Notification is the payload sent to subscription endpoints.
+// Notifications of a subscription are numbered per twin: Sequence is one more
+// than the sequence of the previous notification about the same twin, and
+// Missed counts the notifications about the twin that could not be delivered
+// since the last one that was, and the events about the twin that the event
+// bus dropped before they could be notified. Consumers that see a gap in the sequence or a
+// non-zero Missed count should fetch the current entity to resynchronize.
+type Notification struct {
+	ID             string    `json:"id"`
+	Type           string    `json:"type"`
+	SubscriptionID string    `json:"subscriptionId"`
+	NotifiedAt     time.Time `json:"notifiedAt"`
+	Sequence       uint64    `json:"sequence"`
+	Missed         uint64    `json:"missed,omitempty"`
+	Data           []Entity  `json:"data"`
+}
+
+// delivery tracks the notification sequence of a subscription per twin.
+// Its mutex is held while a notification is sent, so notifications about a
+// twin are delivered in sequence order.
+type delivery struct {
+	sequences map[string]uint64 // Twin ID -> sequence of the last notification
+	missed    map[string]uint64 // Twin ID -> failed notifications since the last delivered one
+	mutex     sync.Mutex
+}
+
+// Manager stores NGSI-LD subscriptions and sends their notifications
+type Manager struct {
+	registry      *registry.Registry
+	client        *http.Client
+	subscriptions map[string]*Subscription
+	deliveries    map[string]*delivery // Subscription ID -> delivery state
+	gaps          *eventbus.Gaps       // Events dropped by the event bus
+	mutex         sync.RWMutex
+}
+
+// NewManager creates a new subscription manager
+func NewManager(reg *registry.Registry) *Manager {
+	return &Manager{
+		registry:      reg,
+		client:        &http.Client{Timeout: notificationTimeout},
+		subscriptions: make(map[string]*Subscription),
+		deliveries:    make(map[string]*delivery),
+		gaps:          eventbus.NewGaps(),
+	}
+}
+
+// Create registers a subscription and returns it. A URN is generated if it has no ID.
+func (m *Manager) Create(sub Subscription) (Subscription, error) {
+	if err := Validate(&sub); err != nil {
+		return Subscription{}, err
+	}
+
+	if sub.ID == "" {
+		id, err := newURN("Subscription")
+		if err != nil {
+			return Subscription{}, err
+		}
+		sub.ID = id
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, exists := m.subscriptions[sub.ID]; exists {
+		return Subscription{}, ErrSubscriptionAlreadyExists
+	}
+
+	m.subscriptions[sub.ID] = &sub
+	m.deliveries[sub.ID] = &delivery{
+		sequences: make(map[string]uint64),
+		missed:    make(map[string]uint64),
+	}
+	return sub, nil
+}
+
+// Replace replaces the configuration of a subscription and returns it.
+// The notification status and sequences of the subscription are kept.
+func (m *Manager) Replace(sub Subscription) (Subscription, error) {
+	if err := Validate(&sub); err != nil {
+		return Subscription{}, err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	current, exists := m.subscriptions[sub.ID]
+	if !exists {
+		return Subscription{}, ErrSubscriptionNotFound
+	}
+
+	status := current.Notification
+	status.Attributes = sub.Notification.Attributes
+	status.Endpoint = sub.Notification.Endpoint
+	status.Transforms = sub.Notification.Transforms
+	sub.Notification = status
+
+	m.subscriptions[sub.ID] = &sub
+	return sub, nil
+}
+
+// Validate checks a subscription and clears the fields maintained by the manager
+func Validate(sub *Subscription) error {
+	if sub.Type != "" && sub.Type != "Subscription" {
+		return fmt.Errorf("%w: type must be Subscription", ErrInvalidSubscription)
+	}
+
+	u, err := url.Parse(sub.Notification.Endpoint.URI)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: endpoint uri must be an absolute http or https URL", ErrInvalidSubscription)
+	}
+
+	for _, e := range sub.Entities {
+		if e.Type == "" {
+			return fmt.Errorf("%w: entity selectors require a type", ErrInvalidSubscription)
+		}
+	}
+
+	if err := convert.ValidateAll(sub.Notification.Transforms); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSubscription, err)
+	}
+
+	sub.Type = "Subscription"
+
+	// Status fields are maintained by the manager
+	sub.Notification = NotificationParams{
+		Attributes: sub.Notification.Attributes,
+		Endpoint:   sub.Notification.Endpoint,
+		Transforms: sub.Notification.Transforms,
+	}
+	return nil
+}
+
+// Delete removes a subscription
+func (m *Manager) Delete(id string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, exists := m.subscriptions[id]; !exists {
+		return ErrSubscriptionNotFound
+	}
+
+	delete(m.subscriptions, id)
+	delete(m.deliveries, id)
+	return nil
+}
+
+// Get returns a subscription
+func (m *Manager) Get(id string) (Subscription, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	sub, exists := m.subscriptions[id]
+	if !exists {
+		return Subscription{}, ErrSubscriptionNotFound
+	}
+	return *sub, nil
+}
+
+// List returns all subscriptions sorted by ID
+func (m *Manager) List() []Subscription {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	result := make([]Subscription, 0, len(m.subscriptions))
+	for _, sub := range m.subscriptions {
+		result = append(result, *sub)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// HandleEvent notifies the subscriptions matching a twin change.
+// Other messages are ignored, unless their sequence number shows that
+// events about the twin were dropped before reaching the manager: the
+// subscriptions selecting the twin are then notified of its current state,
+// counting the dropped events as missed.
+func (m *Manager) HandleEvent(msg messaging_sim.Message) {
+	twinID, attribute := msg.TwinID(), eventbus.PayloadField(msg.Payload, "featureId")
+	dropped := m.gaps.Missed(msg)
+
+	switch msg.Topic {
+	case "twin.created", "twin.updated":
+	case "feature.updated", "properties.updated", "property.updated", "property.deleted":
+		if attribute == "" && dropped == 0 {
+			return
+		}
+	default:
+		if dropped == 0 {
+			return
+		}
+	}
+	if dropped > 0 {
+		// The dropped events may have changed any attribute
+		attribute = ""
+	}
+
+	dt, err := m.registry.Get(twinID)
+	if err != nil {
+		return
+	}
+
+	m.mutex.RLock()
+	var targets []*Subscription
+	for _, sub := range m.subscriptions {
+		if sub.Matches(dt, attribute) {
+			targets = append(targets, sub)
+		}
+	}
+	m.mutex.RUnlock()
+
+	for _, sub := range targets {
+		m.notify(sub, dt, dropped)
+	}
+}
+
+// RenameTwin points the entity selectors of subscriptions that select a
+// renamed twin by ID at its new entity ID. The new entity is new to
+// consumers, so its notifications are numbered from 1 again.
+func (m *Manager) RenameTwin(oldID string, dt *twin.DigitalTwin) {
+	oldEntityID := EntityID(&twin.DigitalTwin{ID: oldID, Type: dt.Type})
+	newEntityID := EntityID(dt)
+
+	m.mutex.Lock()
+	for _, sub := range m.subscriptions {
+		for i, e := range sub.Entities {
+			if e.ID == oldEntityID {
+				// Copies returned by Get and List share the selectors
+				sub.Entities = append([]EntitySelector(nil), sub.Entities...)
+				sub.Entities[i].ID = newEntityID
+			}
+		}
+	}
+	deliveries := make([]*delivery, 0, len(m.deliveries))
+	for _, d := range m.deliveries {
+		deliveries = append(deliveries, d)
+	}
+	m.mutex.Unlock()
+
+	for _, d := range deliveries {
+		d.mutex.Lock()
+		for _, id := range []string{oldID, dt.ID} {
+			delete(d.sequences, id)
+			delete(d.missed, id)
+		}
+		d.mutex.Unlock()
+	}
+}
+
+// Run sends notifications for events from a subscription until the channel is closed
+func (m *Manager) Run(events <-chan messaging_sim.Message) {
+	for msg := range events {
+		m.HandleEvent(msg)
+	}
+}
+
+// Matches reports whether a change of an attribute of a twin concerns the
+// subscription. An empty attribute stands for a change of the twin itself.
+func (s *Subscription) Matches(dt *twin.DigitalTwin, attribute string) bool {
+	if len(s.Entities) > 0 {
+		selected := false
+		for _, e := range s.Entities {
+			if e.Type == dt.Type && (e.ID == "" || e.ID == EntityID(dt)) {
+				selected = true
+				break
+			}
+		}
+		if !selected {
+			return false
+		}
+	}
+
+	if attribute == "" || len(s.WatchedAttributes) == 0 {
+		return true
+	}
+	for _, a := range s.WatchedAttributes {
+		if a == attribute {
+			return true
+		}
+	}
+	return false
+}
+
+// notify posts a notification with the current entity to the subscription
+// endpoint. Dropped counts the events about the twin that the event bus
+// dropped since the previous notification.
+func (m *Manager) notify(sub *Subscription, dt *twin.DigitalTwin, dropped uint64) {
+	m.mutex.RLock()
+	attrs, endpoint, transforms := sub.Notification.Attributes, sub.Notification.Endpoint, sub.Notification.Transforms
+	d := m.deliveries[sub.ID]
+	m.mutex.RUnlock()
+	if d == nil {
+		return
+	}
+
+	d.mutex.Lock()
+	d.sequences[dt.ID]++
+	sequence, missed := d.sequences[dt.ID], d.missed[dt.ID]+dropped
+
+	err := m.send(Notification{
+		SubscriptionID: sub.ID,
+		Sequence:       sequence,
+		Missed:         missed,
+		Data:           []Entity{Transform(ToEntity(m.registry, dt, attrs), transforms)},
+	}, endpoint)
+
+	if err != nil {
+		d.missed[dt.ID] = missed + 1
+	} else {
+		delete(d.missed, dt.ID)
+	}
+	d.mutex.Unlock()
+
+	now := time.Now()
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	// The subscription may have been replaced while the notification was sent
+	current, exists := m.subscriptions[sub.ID]
+	if !exists {
+		return
+	}
+
+	current.Notification.TimesSent++
+	current.Notification.LastNotification = &now
+	if err != nil {
+		current.Notification.Status = StatusFailed
+		current.Notification.LastFailure = &now
+	} else {
+		current.Notification.Status = StatusOK
+		current.Notification.LastSuccess = &now
+	}
+}
+
+// send delivers a notification to an endpoint
+func (m *Manager) send(n Notification, endpoint Endpoint) error {
+	id, err := newURN("Notification")
+	if err != nil {
+		return err
+	}
+
+	n.ID = id
+	n.Type = "Notification"
+	n.NotifiedAt = time.Now().UTC()
+
+	payload, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	contentType := endpoint.Accept
+	if contentType == "" {
+		contentType = "application/json"
+	}
+
+	resp, err := m.client.Post(endpoint.URI, contentType, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("endpoint returned %s", resp.Status)
+	}
+	return nil
+}
+
+// newURN returns a random urn:ngsi-ld:<kind>:<id>
+func newURN(kind string) (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return entityPrefix + kind + ":" + hex.EncodeToString(id), nil
+}
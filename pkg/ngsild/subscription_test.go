@@ -0,0 +1,283 @@
+package ngsild
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/convert"
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestSubscriptionValidation(t *testing.T) {
+	m := NewManager(registry.NewRegistry())
+
+	invalid := []Subscription{
+		{},
+		{Notification: NotificationParams{Endpoint: Endpoint{URI: "/notify"}}},
+		{Type: "Entity", Notification: NotificationParams{Endpoint: Endpoint{URI: "http://example.com"}}},
+		{Entities: []EntitySelector{{ID: "urn:ngsi-ld:Pump:p"}}, Notification: NotificationParams{Endpoint: Endpoint{URI: "http://example.com"}}},
+	}
+	for _, sub := range invalid {
+		if _, err := m.Create(sub); err == nil {
+			t.Errorf("Expected error for subscription %+v", sub)
+		}
+	}
+
+	sub, err := m.Create(Subscription{Notification: NotificationParams{Endpoint: Endpoint{URI: "http://example.com"}}})
+	if err != nil {
+		t.Fatalf("Failed to create subscription: %v", err)
+	}
+	if sub.ID == "" || sub.Type != "Subscription" {
+		t.Errorf("Expected generated ID and type, got %+v", sub)
+	}
+
+	if _, err := m.Create(sub); err != ErrSubscriptionAlreadyExists {
+		t.Errorf("Expected ErrSubscriptionAlreadyExists, got %v", err)
+	}
+
+	if err := m.Delete(sub.ID); err != nil {
+		t.Errorf("Failed to delete subscription: %v", err)
+	}
+	if _, err := m.Get(sub.ID); err != ErrSubscriptionNotFound {
+		t.Errorf("Expected ErrSubscriptionNotFound, got %v", err)
+	}
+}
+
+func TestReplaceSubscription(t *testing.T) {
+	m := NewManager(registry.NewRegistry())
+
+	sub := Subscription{ID: "urn:ngsi-ld:Subscription:s", Notification: NotificationParams{Endpoint: Endpoint{URI: "http://example.com"}}}
+	if _, err := m.Replace(sub); err != ErrSubscriptionNotFound {
+		t.Errorf("Expected ErrSubscriptionNotFound, got %v", err)
+	}
+
+	m.Create(sub)
+	m.subscriptions[sub.ID].Notification.TimesSent = 3
+
+	sub.WatchedAttributes = []string{"temperature"}
+	sub.Notification.Endpoint.URI = "http://example.org"
+	sub.Notification.TimesSent = 100
+	replaced, err := m.Replace(sub)
+	if err != nil {
+		t.Fatalf("Failed to replace subscription: %v", err)
+	}
+	if replaced.Notification.Endpoint.URI != "http://example.org" || len(replaced.WatchedAttributes) != 1 {
+		t.Errorf("Expected the new configuration, got %+v", replaced)
+	}
+	if replaced.Notification.TimesSent != 3 {
+		t.Errorf("Expected the notification status to be kept, got %d", replaced.Notification.TimesSent)
+	}
+
+	sub.Notification.Transforms = []convert.Transform{{Attribute: "temperature", From: "degC", To: "kg"}}
+	if _, err := m.Replace(sub); err == nil {
+		t.Error("Expected an error for an invalid transform")
+	}
+
+	sub.Notification.Endpoint.URI = "/notify"
+	if _, err := m.Replace(sub); err == nil {
+		t.Error("Expected an error for an invalid replacement")
+	}
+}
+
+func TestNotifications(t *testing.T) {
+	received := make(chan Notification, 10)
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n Notification
+		json.NewDecoder(r.Body).Decode(&n)
+		received <- n
+	}))
+	defer endpoint.Close()
+
+	reg := registry.NewRegistry()
+	pump := twin.NewDigitalTwin("pump-1", "Pump")
+	motor := twin.NewFeatureState()
+	motor.SetProperty("rpm", 1450.0)
+	pump.AddFeature("motor", motor)
+	pump.AddFeature("seal", twin.NewFeatureState())
+	reg.Create(pump)
+	reg.Create(twin.NewDigitalTwin("valve-1", "Valve"))
+
+	m := NewManager(reg)
+	sub, err := m.Create(Subscription{
+		ID:                "urn:ngsi-ld:Subscription:pumps",
+		Entities:          []EntitySelector{{Type: "Pump"}},
+		WatchedAttributes: []string{"motor"},
+		Notification: NotificationParams{
+			Attributes: []string{"motor"},
+			Endpoint:   Endpoint{URI: endpoint.URL},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create subscription: %v", err)
+	}
+
+	// Changes of other types and unwatched attributes do not notify
+	m.HandleEvent(messaging_sim.Message{Topic: "twin.updated", Payload: map[string]string{"id": "valve-1"}})
+	m.HandleEvent(messaging_sim.Message{Topic: "feature.updated", Payload: map[string]string{"twinId": "pump-1", "featureId": "seal"}})
+
+	m.HandleEvent(messaging_sim.Message{Topic: "properties.updated", Payload: map[string]interface{}{
+		"twinId":     "pump-1",
+		"featureId":  "motor",
+		"properties": map[string]interface{}{"rpm": 1450.0},
+	}})
+
+	select {
+	case n := <-received:
+		if n.SubscriptionID != sub.ID || n.Type != "Notification" || len(n.Data) != 1 {
+			t.Fatalf("Unexpected notification: %+v", n)
+		}
+		entity := n.Data[0]
+		if entity["id"] != "urn:ngsi-ld:Pump:pump-1" || entity["motor"] == nil || entity["seal"] != nil {
+			t.Errorf("Unexpected notified entity: %v", entity)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected a notification")
+	}
+
+	select {
+	case n := <-received:
+		t.Errorf("Unexpected extra notification: %+v", n)
+	default:
+	}
+
+	stored, _ := m.Get(sub.ID)
+	if stored.Notification.TimesSent != 1 || stored.Notification.Status != StatusOK {
+		t.Errorf("Unexpected notification status: %+v", stored.Notification)
+	}
+}
+
+func TestNotificationSequences(t *testing.T) {
+	fail := true
+	var received []Notification
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n Notification
+		json.NewDecoder(r.Body).Decode(&n)
+		if fail && n.Sequence == 2 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		received = append(received, n)
+	}))
+	defer endpoint.Close()
+
+	reg := registry.NewRegistry()
+	reg.Create(twin.NewDigitalTwin("pump-1", "Pump"))
+	reg.Create(twin.NewDigitalTwin("pump-2", "Pump"))
+
+	m := NewManager(reg)
+	sub, _ := m.Create(Subscription{Notification: NotificationParams{Endpoint: Endpoint{URI: endpoint.URL}}})
+
+	update := func(id string) {
+		m.HandleEvent(messaging_sim.Message{Topic: "twin.updated", Payload: map[string]string{"id": id}})
+	}
+	update("pump-1")
+	update("pump-2")
+	update("pump-1") // Fails
+	update("pump-1")
+
+	if len(received) != 3 {
+		t.Fatalf("Expected 3 delivered notifications, got %d", len(received))
+	}
+
+	// Sequences are per twin; the failed notification leaves a gap
+	want := []struct {
+		twin     string
+		sequence uint64
+		missed   uint64
+	}{
+		{"urn:ngsi-ld:Pump:pump-1", 1, 0},
+		{"urn:ngsi-ld:Pump:pump-2", 1, 0},
+		{"urn:ngsi-ld:Pump:pump-1", 3, 1},
+	}
+	for i, w := range want {
+		n := received[i]
+		if n.Data[0]["id"] != w.twin || n.Sequence != w.sequence || n.Missed != w.missed {
+			t.Errorf("Notification %d: expected %s sequence %d missed %d, got %v sequence %d missed %d",
+				i, w.twin, w.sequence, w.missed, n.Data[0]["id"], n.Sequence, n.Missed)
+		}
+	}
+
+	// Replacing the subscription keeps its sequences
+	m.Replace(sub)
+	update("pump-1")
+	if last := received[len(received)-1]; last.Sequence != 4 || last.Missed != 0 {
+		t.Errorf("Expected sequence 4 without missed notifications, got %d and %d", last.Sequence, last.Missed)
+	}
+}
+
+func TestNotificationDroppedEvents(t *testing.T) {
+	var received []Notification
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n Notification
+		json.NewDecoder(r.Body).Decode(&n)
+		received = append(received, n)
+	}))
+	defer endpoint.Close()
+
+	reg := registry.NewRegistry()
+	reg.Create(twin.NewDigitalTwin("pump-1", "Pump"))
+	m := NewManager(reg)
+	m.Create(Subscription{Notification: NotificationParams{Endpoint: Endpoint{URI: endpoint.URL}}})
+
+	// Events 2 and 3 were dropped by the bus; event 4 would not notify on
+	// its own, but reveals the gap
+	m.HandleEvent(messaging_sim.Message{Topic: "twin.updated", Payload: map[string]string{"id": "pump-1"}, Sequence: 1})
+	m.HandleEvent(messaging_sim.Message{Topic: "attribute.updated", Payload: map[string]interface{}{"twinId": "pump-1"}, Sequence: 4})
+	m.HandleEvent(messaging_sim.Message{Topic: "twin.updated", Payload: map[string]string{"id": "pump-1"}, Sequence: 5})
+
+	if len(received) != 3 {
+		t.Fatalf("Expected 3 notifications, got %d", len(received))
+	}
+	for i, missed := range []uint64{0, 2, 0} {
+		if n := received[i]; n.Sequence != uint64(i+1) || n.Missed != missed {
+			t.Errorf("Notification %d: expected sequence %d missed %d, got %d and %d", i, i+1, missed, n.Sequence, n.Missed)
+		}
+	}
+}
+
+func TestRenameTwin(t *testing.T) {
+	var received []Notification
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n Notification
+		json.NewDecoder(r.Body).Decode(&n)
+		received = append(received, n)
+	}))
+	defer endpoint.Close()
+
+	reg := registry.NewRegistry()
+	reg.Create(twin.NewDigitalTwin("pump-1", "Pump"))
+
+	m := NewManager(reg)
+	sub, _ := m.Create(Subscription{
+		Entities:     []EntitySelector{{ID: "urn:ngsi-ld:Pump:pump-1", Type: "Pump"}},
+		Notification: NotificationParams{Endpoint: Endpoint{URI: endpoint.URL}},
+	})
+	update := func(id string) {
+		m.HandleEvent(messaging_sim.Message{Topic: "twin.updated", Payload: map[string]string{"id": id}})
+	}
+	update("pump-1")
+	update("pump-1")
+
+	reg.Rename("pump-1", "pump-9")
+	dt, _ := reg.Get("pump-9")
+	m.RenameTwin("pump-1", dt)
+	if stored, _ := m.Get(sub.ID); stored.Entities[0].ID != "urn:ngsi-ld:Pump:pump-9" {
+		t.Errorf("Expected the selector to select the new entity, got %+v", stored.Entities)
+	}
+	if sub.Entities[0].ID != "urn:ngsi-ld:Pump:pump-1" {
+		t.Errorf("Expected the returned subscription to be unchanged, got %+v", sub.Entities)
+	}
+
+	update("pump-9")
+	if len(received) != 3 {
+		t.Fatalf("Expected 3 notifications, got %d", len(received))
+	}
+	if last := received[2]; last.Data[0]["id"] != "urn:ngsi-ld:Pump:pump-9" || last.Sequence != 1 {
+		t.Errorf("Expected the first notification about the new entity, got %v sequence %d", last.Data[0]["id"], last.Sequence)
+	}
+}
@@ -0,0 +1,490 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/secret"
+	"github.com/aleka07/go-digital-twin/pkg/webhook"
+)
+
+// Common errors
+var (
+	ErrChannelNotFound      = errors.New("notification channel not found")
+	ErrChannelAlreadyExists = errors.New("notification channel already exists")
+	ErrInvalidChannel       = errors.New("invalid notification channel")
+	ErrRateLimited          = errors.New("notification rate limit exceeded")
+)
+
+// Kind selects how a channel delivers notifications
+type Kind string
+
+// Built-in channel kinds
+const (
+	KindSlack     Kind = "slack"
+	KindEmail     Kind = "email"
+	KindPagerDuty Kind = "pagerduty"
+)
+
+// DefaultTopics are the alert topics a channel is triggered by when it does not set its own
+var DefaultTopics = []string{"rule.triggered", "alarm.#", "drift.detected", "drift.resolved", "freshness.stale", "freshness.resolved", "anomaly.detected"}
+
+// DefaultTemplate renders the topic, the twin and the event payload
+const DefaultTemplate = `{{.Topic}}{{with .TwinID}} on twin {{.}}{{end}}: {{json .Payload}}`
+
+// DefaultRateLimit is the number of notifications a channel sends per minute
+// when it does not set its own limit
+const DefaultRateLimit = 30
+
+// rateWindow is the period rate limits apply to
+const rateWindow = time.Minute
+
+// sendTimeout bounds a single notification
+const sendTimeout = 10 * time.Second
+
+// Channel configures where and how alerts are sent. Only the settings of the
+// channel's kind are used.
+type Channel struct {
+	Name      string           `json:"name"`
+	Kind      Kind             `json:"kind"`
+	Topics    []string         `json:"topics,omitempty"`    // Topic patterns that trigger the channel, DefaultTopics when empty
+	Template  string           `json:"template,omitempty"`  // Go template for the message, DefaultTemplate when empty
+	RateLimit int              `json:"rateLimit,omitempty"` // Notifications per minute, DefaultRateLimit when zero, unlimited when negative
+	Slack     *SlackConfig     `json:"slack,omitempty"`
+	Email     *EmailConfig     `json:"email,omitempty"`
+	PagerDuty *PagerDutyConfig `json:"pagerduty,omitempty"`
+}
+
+// Notification is a rendered alert passed to a notifier
+type Notification struct {
+	Channel   string
+	Topic     string
+	TwinID    string
+	Text      string
+	Resolved  bool   // The alert condition has cleared
+	DedupKey  string // Identifies the alert across triggering and resolving events
+	Timestamp time.Time
+	Data      TemplateData
+}
+
+// Notifier delivers notifications for a channel
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// Suppressor decides whether an alert about a twin is withheld, e.g. during
+// maintenance
+type Suppressor interface {
+	Suppress(topic, twinID string, payload interface{}) bool
+}
+
+// Factory creates the notifier of a channel, validating its settings
+type Factory func(c Channel) (Notifier, error)
+
+// TemplateData is the data a message template is executed with. Payload and
+// Twin are JSON documents, so templates use their JSON field names, e.g.
+// {{.Payload.rule}} or {{.Twin.attributes.location}}.
+type TemplateData struct {
+	Topic     string
+	Timestamp time.Time
+	TwinID    string
+	Payload   map[string]interface{}
+	Twin      map[string]interface{} // Nil when the event does not refer to an existing twin
+}
+
+// Status reports the deliveries of a channel
+type Status struct {
+	Sent        int        `json:"sent"`
+	Failed      int        `json:"failed"`
+	RateLimited int        `json:"rateLimited"`
+	LastSent    *time.Time `json:"lastSent,omitempty"`
+	LastError   string     `json:"lastError,omitempty"`
+}
+
+// channel is a registered channel with its notifier and delivery state
+type channel struct {
+	Channel
+	notifier Notifier
+	tmpl     *template.Template
+	status   Status
+	sent     []time.Time // Send times within the rate window
+}
+
+// Manager sends notifications to channels for alert events
+type Manager struct {
+	registry   *registry.Registry
+	factories  map[Kind]Factory
+	channels   map[string]*channel
+	suppressor Suppressor
+	secrets    *secret.Manager
+	mutex      sync.RWMutex
+	now        func() time.Time
+}
+
+// NewManager creates a manager with the built-in Slack, email and PagerDuty notifiers
+func NewManager(reg *registry.Registry) *Manager {
+	m := &Manager{
+		registry:  reg,
+		factories: make(map[Kind]Factory),
+		channels:  make(map[string]*channel),
+		secrets:   secret.NewManager(),
+		now:       time.Now,
+	}
+	m.RegisterKind(KindSlack, newSlack)
+	m.RegisterKind(KindEmail, newEmail)
+	m.RegisterKind(KindPagerDuty, newPagerDuty)
+	return m
+}
+
+// RegisterKind adds or replaces the factory of a channel kind
+func (m *Manager) RegisterKind(kind Kind, f Factory) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.factories[kind] = f
+}
+
+// SetSecrets sets the manager resolving secret references in the
+// credentials of channels
+func (m *Manager) SetSecrets(secrets *secret.Manager) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.secrets = secrets
+}
+
+// Create registers a new channel. Its credentials may be secret references,
+// which are resolved for the notifier but kept as references in the channel.
+func (m *Manager) Create(c Channel) error {
+	if c.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidChannel)
+	}
+	for _, topic := range c.Topics {
+		if topic == "" {
+			return fmt.Errorf("%w: empty topic pattern", ErrInvalidChannel)
+		}
+	}
+	if c.Template == "" {
+		c.Template = DefaultTemplate
+	}
+	if c.RateLimit == 0 {
+		c.RateLimit = DefaultRateLimit
+	}
+
+	tmpl, err := webhook.ParseTemplate(c.Name, c.Template)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidChannel, err)
+	}
+
+	m.mutex.RLock()
+	factory, ok := m.factories[c.Kind]
+	secrets := m.secrets
+	m.mutex.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w: unknown kind %q", ErrInvalidChannel, c.Kind)
+	}
+
+	resolved, err := c.resolve(context.Background(), secrets)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidChannel, err)
+	}
+
+	notifier, err := factory(resolved)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidChannel, err)
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, exists := m.channels[c.Name]; exists {
+		return ErrChannelAlreadyExists
+	}
+
+	m.channels[c.Name] = &channel{Channel: c, notifier: notifier, tmpl: tmpl}
+	return nil
+}
+
+// Delete removes a channel
+func (m *Manager) Delete(name string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, exists := m.channels[name]; !exists {
+		return ErrChannelNotFound
+	}
+
+	delete(m.channels, name)
+	return nil
+}
+
+// Get returns a channel with its secrets redacted, and its delivery status
+func (m *Manager) Get(name string) (Channel, Status, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	c, exists := m.channels[name]
+	if !exists {
+		return Channel{}, Status{}, ErrChannelNotFound
+	}
+
+	return c.Redacted(), c.status, nil
+}
+
+// List returns all channels with their secrets redacted, sorted by name
+func (m *Manager) List() []Channel {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	channels := make([]Channel, 0, len(m.channels))
+	for _, c := range m.channels {
+		channels = append(channels, c.Redacted())
+	}
+
+	sort.Slice(channels, func(i, j int) bool { return channels[i].Name < channels[j].Name })
+	return channels
+}
+
+// Test sends a notification for a made-up event to a channel, ignoring its
+// topics but not its rate limit
+func (m *Manager) Test(name string) error {
+	m.mutex.RLock()
+	c, exists := m.channels[name]
+	m.mutex.RUnlock()
+
+	if !exists {
+		return ErrChannelNotFound
+	}
+
+	return m.send(c, messaging_sim.Message{
+		Topic:   "notify.test",
+		Payload: map[string]interface{}{"channel": name, "message": "Test notification"},
+	})
+}
+
+// SetSuppressor sets what decides whether alerts are withheld
+func (m *Manager) SetSuppressor(s Suppressor) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.suppressor = s
+}
+
+// HandleEvent notifies all channels subscribed to the topic of a message,
+// unless the suppressor withholds it
+func (m *Manager) HandleEvent(msg messaging_sim.Message) {
+	m.mutex.RLock()
+	var targets []*channel
+	for _, c := range m.channels {
+		if c.subscribed(msg.Topic) {
+			targets = append(targets, c)
+		}
+	}
+	suppressor := m.suppressor
+	m.mutex.RUnlock()
+
+	if len(targets) == 0 {
+		return
+	}
+	if suppressor != nil && suppressor.Suppress(msg.Topic, msg.TwinID(), msg.Payload) {
+		return
+	}
+
+	for _, c := range targets {
+		m.send(c, msg)
+	}
+}
+
+// Run sends notifications for events from a subscription until the channel is closed
+func (m *Manager) Run(events <-chan messaging_sim.Message) {
+	for msg := range events {
+		m.HandleEvent(msg)
+	}
+}
+
+// subscribed reports whether the channel is triggered by a topic
+func (c *channel) subscribed(topic string) bool {
+	patterns := c.Topics
+	if len(patterns) == 0 {
+		patterns = DefaultTopics
+	}
+	for _, pattern := range patterns {
+		if messaging_sim.TopicMatches(pattern, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// send renders an event and delivers it to a channel within its rate limit
+func (m *Manager) send(c *channel, msg messaging_sim.Message) error {
+	now := m.now()
+
+	m.mutex.Lock()
+	if !c.allow(now) {
+		c.status.RateLimited++
+		m.mutex.Unlock()
+		return ErrRateLimited
+	}
+	m.mutex.Unlock()
+
+	n, err := m.render(c, msg, now)
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		err = c.notifier.Notify(ctx, n)
+		cancel()
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if err != nil {
+		c.status.Failed++
+		c.status.LastError = err.Error()
+		return err
+	}
+	c.status.Sent++
+	c.status.LastSent = &now
+	return nil
+}
+
+// allow records a send if it is within the rate limit; the caller must hold the mutex
+func (c *channel) allow(now time.Time) bool {
+	if c.RateLimit < 0 {
+		return true
+	}
+
+	cutoff := now.Add(-rateWindow)
+	kept := c.sent[:0]
+	for _, t := range c.sent {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	c.sent = kept
+
+	if len(c.sent) >= c.RateLimit {
+		return false
+	}
+	c.sent = append(c.sent, now)
+	return true
+}
+
+// render builds the notification of an event for a channel
+func (m *Manager) render(c *channel, msg messaging_sim.Message, now time.Time) (Notification, error) {
+	data := TemplateData{Topic: msg.Topic, Timestamp: now}
+	if err := convert(msg.Payload, &data.Payload); err != nil || data.Payload == nil {
+		data.Payload = map[string]interface{}{"value": msg.Payload}
+	}
+
+	data.TwinID = msg.TwinID()
+	if dt, err := m.registry.Get(data.TwinID); err == nil {
+		convert(dt, &data.Twin)
+	}
+
+	var buf bytes.Buffer
+	if err := c.tmpl.Execute(&buf, data); err != nil {
+		return Notification{}, fmt.Errorf("render template: %v", err)
+	}
+
+	return Notification{
+		Channel:   c.Name,
+		Topic:     msg.Topic,
+		TwinID:    data.TwinID,
+		Text:      buf.String(),
+		Resolved:  strings.HasSuffix(msg.Topic, ".resolved"),
+		DedupKey:  dedupKey(msg.Topic, data),
+		Timestamp: now,
+		Data:      data,
+	}, nil
+}
+
+// dedupKey identifies an alert by the topic without its last segment, the twin,
+// the rule and the property path, so that e.g. drift.detected and
+// drift.resolved of a twin match
+func dedupKey(topic string, data TemplateData) string {
+	if i := strings.LastIndex(topic, "."); i > 0 {
+		topic = topic[:i]
+	}
+
+	parts := []string{topic}
+	if data.TwinID != "" {
+		parts = append(parts, data.TwinID)
+	}
+	if rule, ok := data.Payload["rule"].(string); ok && rule != "" {
+		parts = append(parts, rule)
+	}
+	if path, ok := data.Payload["path"].(string); ok && path != "" {
+		parts = append(parts, path)
+	}
+	return strings.Join(parts, ":")
+}
+
+// credentials applies f to copies of the credentials of the channel
+func (c Channel) credentials(f func(value string) (string, error)) (Channel, error) {
+	var err error
+	if c.Slack != nil {
+		slack := *c.Slack
+		if slack.WebhookURL, err = f(slack.WebhookURL); err != nil {
+			return c, fmt.Errorf("webhookUrl: %w", err)
+		}
+		c.Slack = &slack
+	}
+	if c.Email != nil {
+		email := *c.Email
+		if email.Username, err = f(email.Username); err != nil {
+			return c, fmt.Errorf("username: %w", err)
+		}
+		if email.Password, err = f(email.Password); err != nil {
+			return c, fmt.Errorf("password: %w", err)
+		}
+		c.Email = &email
+	}
+	if c.PagerDuty != nil {
+		pd := *c.PagerDuty
+		if pd.RoutingKey, err = f(pd.RoutingKey); err != nil {
+			return c, fmt.Errorf("routingKey: %w", err)
+		}
+		c.PagerDuty = &pd
+	}
+	return c, nil
+}
+
+// resolve returns a copy of the channel with secret references in its
+// credentials resolved
+func (c Channel) resolve(ctx context.Context, secrets *secret.Manager) (Channel, error) {
+	return c.credentials(func(value string) (string, error) {
+		return secrets.Resolve(ctx, value)
+	})
+}
+
+// Redacted returns a copy of the channel without credentials. Secret
+// references are kept, as they do not reveal the secrets.
+func (c Channel) Redacted() Channel {
+	redacted, _ := c.credentials(func(value string) (string, error) {
+		return secret.Redact(value), nil
+	})
+	if c.Email != nil {
+		redacted.Email.Username = c.Email.Username
+	}
+	return redacted
+}
+
+// convert converts a value to its JSON document
+func convert(v interface{}, doc *map[string]interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, doc)
+}
@@ -0,0 +1,222 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// recorder is a notifier that records notifications
+type recorder struct {
+	mutex sync.Mutex
+	sent  []Notification
+	err   error
+}
+
+func (r *recorder) Notify(ctx context.Context, n Notification) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.err != nil {
+		return r.err
+	}
+	r.sent = append(r.sent, n)
+	return nil
+}
+
+func setupManager(t *testing.T) (*Manager, *recorder) {
+	t.Helper()
+
+	reg := registry.NewRegistry()
+	dt := twin.NewDigitalTwin("boiler-1", "boiler")
+	dt.SetAttribute("location", "basement")
+	reg.Create(dt)
+
+	rec := &recorder{}
+	m := NewManager(reg)
+	m.RegisterKind("test", func(c Channel) (Notifier, error) { return rec, nil })
+	return m, rec
+}
+
+func TestCreateValidation(t *testing.T) {
+	m, _ := setupManager(t)
+
+	invalid := []Channel{
+		{Kind: "test"},
+		{Name: "unknown", Kind: "sms"},
+		{Name: "template", Kind: "test", Template: "{{.Topic"},
+		{Name: "topics", Kind: "test", Topics: []string{""}},
+		{Name: "slack", Kind: KindSlack},
+		{Name: "slack", Kind: KindSlack, Slack: &SlackConfig{WebhookURL: "hooks.slack.com"}},
+		{Name: "email", Kind: KindEmail, Email: &EmailConfig{Host: "smtp.example.com"}},
+		{Name: "pd", Kind: KindPagerDuty, PagerDuty: &PagerDutyConfig{}},
+		{Name: "pd", Kind: KindPagerDuty, PagerDuty: &PagerDutyConfig{RoutingKey: "key", Severity: "fatal"}},
+	}
+	for _, c := range invalid {
+		if err := m.Create(c); !errors.Is(err, ErrInvalidChannel) {
+			t.Errorf("Expected ErrInvalidChannel for %+v, got %v", c, err)
+		}
+	}
+
+	if err := m.Create(Channel{Name: "ops", Kind: "test"}); err != nil {
+		t.Fatalf("Failed to create channel: %v", err)
+	}
+	if err := m.Create(Channel{Name: "ops", Kind: "test"}); err != ErrChannelAlreadyExists {
+		t.Errorf("Expected ErrChannelAlreadyExists, got %v", err)
+	}
+}
+
+func TestGetListDelete(t *testing.T) {
+	m, _ := setupManager(t)
+
+	m.Create(Channel{Name: "pager", Kind: KindPagerDuty, PagerDuty: &PagerDutyConfig{RoutingKey: "secret"}})
+	m.Create(Channel{Name: "chat", Kind: KindSlack, Slack: &SlackConfig{WebhookURL: "https://hooks.slack.com/services/secret"}})
+
+	c, _, err := m.Get("pager")
+	if err != nil {
+		t.Fatalf("Failed to get channel: %v", err)
+	}
+	if c.PagerDuty.RoutingKey == "secret" || c.RateLimit != DefaultRateLimit || c.Template != DefaultTemplate {
+		t.Errorf("Expected defaults and a redacted routing key, got %+v %+v", c, c.PagerDuty)
+	}
+
+	list := m.List()
+	if len(list) != 2 || list[0].Name != "chat" || strings.Contains(list[0].Slack.WebhookURL, "secret") {
+		t.Errorf("Expected redacted channels sorted by name, got %+v", list)
+	}
+
+	if err := m.Delete("chat"); err != nil {
+		t.Errorf("Failed to delete channel: %v", err)
+	}
+	if _, _, err := m.Get("chat"); err != ErrChannelNotFound {
+		t.Errorf("Expected ErrChannelNotFound, got %v", err)
+	}
+}
+
+func TestHandleEvent(t *testing.T) {
+	m, rec := setupManager(t)
+	m.Create(Channel{Name: "ops", Kind: "test", Template: "{{.Payload.rule}} fired on {{.TwinID}} in {{.Twin.attributes.location}}"})
+
+	m.HandleEvent(messaging_sim.Message{Topic: "property.updated", Payload: map[string]interface{}{"twinId": "boiler-1"}})
+	m.HandleEvent(messaging_sim.Message{Topic: "rule.triggered", Payload: map[string]interface{}{"rule": "overheat", "twinId": "boiler-1", "result": true}})
+
+	if len(rec.sent) != 1 {
+		t.Fatalf("Expected 1 notification for the default topics, got %d", len(rec.sent))
+	}
+
+	n := rec.sent[0]
+	if n.Text != "overheat fired on boiler-1 in basement" {
+		t.Errorf("Unexpected text %q", n.Text)
+	}
+	if n.DedupKey != "rule:boiler-1:overheat" || n.Resolved {
+		t.Errorf("Unexpected notification %+v", n)
+	}
+
+	m.HandleEvent(messaging_sim.Message{Topic: "drift.resolved", Payload: map[string]interface{}{"twinId": "boiler-1"}})
+	if n := rec.sent[1]; !n.Resolved || n.DedupKey != "drift:boiler-1" {
+		t.Errorf("Expected a resolved drift notification, got %+v", n)
+	}
+
+	_, status, _ := m.Get("ops")
+	if status.Sent != 2 || status.LastSent == nil {
+		t.Errorf("Unexpected status %+v", status)
+	}
+
+	// Freshness alerts are told apart by property
+	m.HandleEvent(messaging_sim.Message{Topic: "freshness.stale", Payload: map[string]interface{}{"twinId": "boiler-1", "path": "features.climate.properties.temperature"}})
+	if n := rec.sent[2]; n.Resolved || n.DedupKey != "freshness:boiler-1:features.climate.properties.temperature" {
+		t.Errorf("Expected a stale property notification, got %+v", n)
+	}
+}
+
+func TestTopicsAndFailures(t *testing.T) {
+	m, rec := setupManager(t)
+	m.Create(Channel{Name: "ops", Kind: "test", Topics: []string{"alarm.+"}})
+
+	m.HandleEvent(messaging_sim.Message{Topic: "rule.triggered", Payload: map[string]interface{}{"twinId": "boiler-1"}})
+	m.HandleEvent(messaging_sim.Message{Topic: "alarm.pressure", Payload: "low pressure"})
+
+	if len(rec.sent) != 1 || rec.sent[0].Text != `alarm.pressure: {"value":"low pressure"}` {
+		t.Fatalf("Expected only the alarm to be sent, got %+v", rec.sent)
+	}
+
+	rec.err = errors.New("unavailable")
+	m.HandleEvent(messaging_sim.Message{Topic: "alarm.pressure"})
+
+	_, status, _ := m.Get("ops")
+	if status.Failed != 1 || status.LastError != "unavailable" {
+		t.Errorf("Unexpected status %+v", status)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	m, rec := setupManager(t)
+	now := time.Now()
+	m.now = func() time.Time { return now }
+
+	m.Create(Channel{Name: "ops", Kind: "test", RateLimit: 2})
+	for i := 0; i < 3; i++ {
+		m.HandleEvent(messaging_sim.Message{Topic: "rule.triggered"})
+	}
+	if err := m.Test("ops"); err != ErrRateLimited {
+		t.Errorf("Expected ErrRateLimited, got %v", err)
+	}
+
+	_, status, _ := m.Get("ops")
+	if len(rec.sent) != 2 || status.RateLimited != 2 {
+		t.Errorf("Expected 2 sent and 2 rate limited, got %d and %+v", len(rec.sent), status)
+	}
+
+	// The window moves on
+	now = now.Add(rateWindow)
+	if err := m.Test("ops"); err != nil {
+		t.Errorf("Expected test notification after the window, got %v", err)
+	}
+
+	// Negative limits disable rate limiting
+	m.Create(Channel{Name: "unlimited", Kind: "test", RateLimit: -1})
+	for i := 0; i < 3*DefaultRateLimit; i++ {
+		if err := m.Test("unlimited"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+}
+
+// suppressTwin withholds the alerts of a single twin
+type suppressTwin struct {
+	twinID string
+	topics []string
+}
+
+func (s *suppressTwin) Suppress(topic, twinID string, payload interface{}) bool {
+	if twinID != s.twinID {
+		return false
+	}
+	s.topics = append(s.topics, topic)
+	return true
+}
+
+func TestSuppressor(t *testing.T) {
+	m, rec := setupManager(t)
+	m.Create(Channel{Name: "ops", Kind: "test"})
+	suppressor := &suppressTwin{twinID: "boiler-1"}
+	m.SetSuppressor(suppressor)
+
+	m.HandleEvent(messaging_sim.Message{Topic: "alarm.raised", Payload: map[string]string{"twinId": "boiler-1"}})
+	m.HandleEvent(messaging_sim.Message{Topic: "property.updated", Payload: map[string]string{"twinId": "boiler-1"}})
+	m.HandleEvent(messaging_sim.Message{Topic: "alarm.raised", Payload: map[string]string{"twinId": "boiler-2"}})
+
+	if len(rec.sent) != 1 || rec.sent[0].TwinID != "boiler-2" {
+		t.Errorf("Expected only the alert of boiler-2 to be sent, got %+v", rec.sent)
+	}
+	if len(suppressor.topics) != 1 || suppressor.topics[0] != "alarm.raised" {
+		t.Errorf("Expected only alerts to be offered for suppression, got %v", suppressor.topics)
+	}
+}
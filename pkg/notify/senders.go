@@ -0,0 +1,271 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/webhook"
+)
+
+// maxResponseBody bounds how much of an error response is read
+const maxResponseBody = 1024
+
+// SlackConfig configures a Slack incoming webhook
+type SlackConfig struct {
+	WebhookURL string `json:"webhookUrl"`
+}
+
+// EmailConfig configures delivery over SMTP. Connections are upgraded with
+// STARTTLS when the server supports it.
+type EmailConfig struct {
+	Host     string   `json:"host"`
+	Port     int      `json:"port,omitempty"` // Defaults to 587
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+	Subject  string   `json:"subject,omitempty"` // Go template for the subject, DefaultSubject when empty
+}
+
+// DefaultSubject is the subject template of email notifications
+const DefaultSubject = `[Digital Twin] {{.Topic}}{{with .TwinID}} {{.}}{{end}}`
+
+// PagerDutyConfig configures the PagerDuty Events API v2
+type PagerDutyConfig struct {
+	RoutingKey string `json:"routingKey"`
+	Severity   string `json:"severity,omitempty"` // critical, error, warning or info, defaults to error
+	URL        string `json:"url,omitempty"`      // Defaults to PagerDutyEventsURL
+}
+
+// PagerDutyEventsURL is the endpoint of the PagerDuty Events API v2
+const PagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// severities are the severities PagerDuty accepts
+var severities = map[string]bool{"critical": true, "error": true, "warning": true, "info": true}
+
+// httpClient sends Slack and PagerDuty requests
+var httpClient = &http.Client{Timeout: sendTimeout}
+
+// slack posts notifications to a Slack incoming webhook
+type slack struct {
+	url string
+}
+
+// newSlack creates the notifier of a Slack channel
+func newSlack(c Channel) (Notifier, error) {
+	if c.Slack == nil {
+		return nil, errors.New("slack settings are required")
+	}
+	if err := validateURL(c.Slack.WebhookURL); err != nil {
+		return nil, fmt.Errorf("webhookUrl %v", err)
+	}
+	return &slack{url: c.Slack.WebhookURL}, nil
+}
+
+// Notify posts the message text to Slack
+func (s *slack) Notify(ctx context.Context, n Notification) error {
+	return postJSON(ctx, s.url, map[string]string{"text": n.Text})
+}
+
+// pagerDuty sends notifications as PagerDuty events. Events of resolving
+// topics resolve the incident of the matching triggering event.
+type pagerDuty struct {
+	config PagerDutyConfig
+}
+
+// newPagerDuty creates the notifier of a PagerDuty channel
+func newPagerDuty(c Channel) (Notifier, error) {
+	if c.PagerDuty == nil {
+		return nil, errors.New("pagerduty settings are required")
+	}
+
+	config := *c.PagerDuty
+	if config.RoutingKey == "" {
+		return nil, errors.New("routingKey is required")
+	}
+	if config.Severity == "" {
+		config.Severity = "error"
+	}
+	if !severities[config.Severity] {
+		return nil, fmt.Errorf("unknown severity %q", config.Severity)
+	}
+	if config.URL == "" {
+		config.URL = PagerDutyEventsURL
+	}
+	if err := validateURL(config.URL); err != nil {
+		return nil, fmt.Errorf("url %v", err)
+	}
+	return &pagerDuty{config: config}, nil
+}
+
+// pagerDutyEvent is a PagerDuty Events API v2 event
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key,omitempty"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+}
+
+// pagerDutyPayload describes a triggered PagerDuty event
+type pagerDutyPayload struct {
+	Summary       string                 `json:"summary"`
+	Source        string                 `json:"source"`
+	Severity      string                 `json:"severity"`
+	Timestamp     string                 `json:"timestamp"`
+	Class         string                 `json:"class,omitempty"`
+	CustomDetails map[string]interface{} `json:"custom_details,omitempty"`
+}
+
+// maxSummary is the longest summary PagerDuty accepts
+const maxSummary = 1024
+
+// Notify triggers or resolves a PagerDuty incident
+func (p *pagerDuty) Notify(ctx context.Context, n Notification) error {
+	event := pagerDutyEvent{
+		RoutingKey:  p.config.RoutingKey,
+		EventAction: "trigger",
+		DedupKey:    n.DedupKey,
+	}
+
+	if n.Resolved {
+		event.EventAction = "resolve"
+	} else {
+		summary := n.Text
+		if len(summary) > maxSummary {
+			summary = summary[:maxSummary]
+		}
+
+		source := n.TwinID
+		if source == "" {
+			source = "go-digital-twin"
+		}
+
+		event.Payload = &pagerDutyPayload{
+			Summary:       summary,
+			Source:        source,
+			Severity:      p.config.Severity,
+			Timestamp:     n.Timestamp.UTC().Format(time.RFC3339),
+			Class:         n.Topic,
+			CustomDetails: n.Data.Payload,
+		}
+	}
+
+	return postJSON(ctx, p.config.URL, event)
+}
+
+// sendMail sends an email; replaced in tests
+var sendMail = smtp.SendMail
+
+// email sends notifications over SMTP
+type email struct {
+	config  EmailConfig
+	subject *template.Template
+}
+
+// newEmail creates the notifier of an email channel
+func newEmail(c Channel) (Notifier, error) {
+	if c.Email == nil {
+		return nil, errors.New("email settings are required")
+	}
+
+	config := *c.Email
+	if config.Host == "" || config.From == "" || len(config.To) == 0 {
+		return nil, errors.New("host, from and to are required")
+	}
+	if config.Port == 0 {
+		config.Port = 587
+	}
+	if config.Subject == "" {
+		config.Subject = DefaultSubject
+	}
+	for _, addr := range append([]string{config.From}, config.To...) {
+		if strings.ContainsAny(addr, "\r\n") {
+			return nil, fmt.Errorf("invalid address %q", addr)
+		}
+	}
+
+	subject, err := webhook.ParseTemplate(c.Name+"-subject", config.Subject)
+	if err != nil {
+		return nil, err
+	}
+	return &email{config: config, subject: subject}, nil
+}
+
+// Notify sends the message text as a plain text email
+func (e *email) Notify(ctx context.Context, n Notification) error {
+	var subject bytes.Buffer
+	if err := e.subject.Execute(&subject, n.Data); err != nil {
+		return fmt.Errorf("render subject: %v", err)
+	}
+
+	// Keep header injection out of the subject
+	line := strings.Join(strings.Fields(subject.String()), " ")
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", e.config.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(e.config.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", line)
+	fmt.Fprintf(&msg, "Date: %s\r\n", n.Timestamp.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(n.Text, "\n", "\r\n"))
+	msg.WriteString("\r\n")
+
+	var auth smtp.Auth
+	if e.config.Username != "" {
+		auth = smtp.PlainAuth("", e.config.Username, e.config.Password, e.config.Host)
+	}
+
+	addr := net.JoinHostPort(e.config.Host, strconv.Itoa(e.config.Port))
+	return sendMail(addr, auth, e.config.From, e.config.To, msg.Bytes())
+}
+
+// postJSON posts a JSON document and fails for non-2xx responses
+func postJSON(ctx context.Context, target string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+		if msg := strings.TrimSpace(string(detail)); msg != "" {
+			return fmt.Errorf("%s: %s", resp.Status, msg)
+		}
+		return errors.New(resp.Status)
+	}
+	return nil
+}
+
+// validateURL checks that a URL is an absolute http or https URL
+func validateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("must be an absolute http or https URL")
+	}
+	return nil
+}
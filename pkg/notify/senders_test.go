@@ -0,0 +1,146 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+)
+
+func TestSlack(t *testing.T) {
+	var received map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer server.Close()
+
+	m, _ := setupManager(t)
+	if err := m.Create(Channel{Name: "chat", Kind: KindSlack, Slack: &SlackConfig{WebhookURL: server.URL}}); err != nil {
+		t.Fatalf("Failed to create channel: %v", err)
+	}
+
+	m.HandleEvent(messaging_sim.Message{Topic: "drift.detected", Payload: map[string]interface{}{"twinId": "boiler-1"}})
+	if received["text"] != `drift.detected on twin boiler-1: {"twinId":"boiler-1"}` {
+		t.Errorf("Unexpected Slack message %v", received)
+	}
+}
+
+func TestSlackError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid_token", http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	m, _ := setupManager(t)
+	m.Create(Channel{Name: "chat", Kind: KindSlack, Slack: &SlackConfig{WebhookURL: server.URL}})
+
+	if err := m.Test("chat"); err == nil || !strings.Contains(err.Error(), "invalid_token") {
+		t.Errorf("Expected the Slack error, got %v", err)
+	}
+}
+
+func TestPagerDuty(t *testing.T) {
+	var events []pagerDutyEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event pagerDutyEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		events = append(events, event)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	m, _ := setupManager(t)
+	err := m.Create(Channel{Name: "pager", Kind: KindPagerDuty, PagerDuty: &PagerDutyConfig{RoutingKey: "key", Severity: "critical", URL: server.URL}})
+	if err != nil {
+		t.Fatalf("Failed to create channel: %v", err)
+	}
+
+	m.HandleEvent(messaging_sim.Message{Topic: "drift.detected", Payload: map[string]interface{}{"twinId": "boiler-1"}})
+	m.HandleEvent(messaging_sim.Message{Topic: "drift.resolved", Payload: map[string]interface{}{"twinId": "boiler-1"}})
+
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(events))
+	}
+
+	trigger := events[0]
+	if trigger.EventAction != "trigger" || trigger.RoutingKey != "key" || trigger.DedupKey != "drift:boiler-1" {
+		t.Errorf("Unexpected trigger event %+v", trigger)
+	}
+	if trigger.Payload == nil || trigger.Payload.Severity != "critical" || trigger.Payload.Source != "boiler-1" || trigger.Payload.Class != "drift.detected" {
+		t.Errorf("Unexpected trigger payload %+v", trigger.Payload)
+	}
+
+	resolve := events[1]
+	if resolve.EventAction != "resolve" || resolve.DedupKey != trigger.DedupKey || resolve.Payload != nil {
+		t.Errorf("Unexpected resolve event %+v", resolve)
+	}
+}
+
+func TestPagerDutySecretReference(t *testing.T) {
+	var event pagerDutyEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&event)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	m, _ := setupManager(t)
+	ref := &PagerDutyConfig{RoutingKey: "${env:DT_TEST_ROUTING_KEY}", URL: server.URL}
+	if err := m.Create(Channel{Name: "pager", Kind: KindPagerDuty, PagerDuty: ref}); !errors.Is(err, ErrInvalidChannel) {
+		t.Errorf("Expected an unresolvable reference to be rejected, got %v", err)
+	}
+
+	t.Setenv("DT_TEST_ROUTING_KEY", "key")
+	if err := m.Create(Channel{Name: "pager", Kind: KindPagerDuty, PagerDuty: ref}); err != nil {
+		t.Fatalf("Failed to create channel: %v", err)
+	}
+	if err := m.Test("pager"); err != nil || event.RoutingKey != "key" {
+		t.Errorf("Expected the resolved routing key to be sent, got %q %v", event.RoutingKey, err)
+	}
+
+	// The reference is returned, never the secret
+	if c, _, _ := m.Get("pager"); c.PagerDuty.RoutingKey != "${env:DT_TEST_ROUTING_KEY}" {
+		t.Errorf("Expected the reference, got %q", c.PagerDuty.RoutingKey)
+	}
+}
+
+func TestEmail(t *testing.T) {
+	var addr, from string
+	var to []string
+	var msg []byte
+	sendMail = func(a string, auth smtp.Auth, f string, t []string, m []byte) error {
+		addr, from, to, msg = a, f, t, m
+		return nil
+	}
+	defer func() { sendMail = smtp.SendMail }()
+
+	m, _ := setupManager(t)
+	err := m.Create(Channel{Name: "mail", Kind: KindEmail, Email: &EmailConfig{
+		Host:    "smtp.example.com",
+		From:    "twins@example.com",
+		To:      []string{"ops@example.com", "oncall@example.com"},
+		Subject: "Alert {{.Topic}}\r\nBcc: attacker@example.com",
+	}})
+	if err != nil {
+		t.Fatalf("Failed to create channel: %v", err)
+	}
+
+	m.HandleEvent(messaging_sim.Message{Topic: "rule.triggered", Payload: map[string]interface{}{"twinId": "boiler-1"}})
+
+	if addr != "smtp.example.com:587" || from != "twins@example.com" || len(to) != 2 {
+		t.Errorf("Unexpected envelope %s %s %v", addr, from, to)
+	}
+
+	text := string(msg)
+	if !strings.Contains(text, "Subject: Alert rule.triggered Bcc: attacker@example.com\r\n") {
+		t.Errorf("Expected a single-line subject, got %q", text)
+	}
+	if !strings.Contains(text, "To: ops@example.com, oncall@example.com\r\n") || !strings.HasSuffix(text, "rule.triggered on twin boiler-1: {\"twinId\":\"boiler-1\"}\r\n") {
+		t.Errorf("Unexpected message %q", text)
+	}
+}
@@ -0,0 +1,57 @@
+package objstore
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDir(t *testing.T) {
+	ctx := context.Background()
+	root := filepath.Join(t.TempDir(), "exports")
+
+	d, err := NewDir(root)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	if err := d.Put(ctx, "a/b/one.txt", []byte("one")); err != nil {
+		t.Fatalf("Failed to put object: %v", err)
+	}
+	d.Put(ctx, "a/two.txt", []byte("two"))
+	d.Put(ctx, "c.txt", []byte("three"))
+
+	if data, err := os.ReadFile(filepath.Join(root, "a", "b", "one.txt")); err != nil || string(data) != "one" {
+		t.Errorf("Expected file a/b/one.txt, got %q, %v", data, err)
+	}
+
+	data, err := d.Get(ctx, "a/two.txt")
+	if err != nil || string(data) != "two" {
+		t.Errorf("Expected two, got %q, %v", data, err)
+	}
+	if _, err := d.Get(ctx, "missing"); err != ErrObjectNotFound {
+		t.Errorf("Expected ErrObjectNotFound, got %v", err)
+	}
+
+	keys, _ := d.List(ctx, "a/")
+	if len(keys) != 2 || keys[0] != "a/b/one.txt" || keys[1] != "a/two.txt" {
+		t.Errorf("Expected [a/b/one.txt a/two.txt], got %v", keys)
+	}
+
+	if err := d.Delete(ctx, "a/two.txt"); err != nil {
+		t.Errorf("Failed to delete object: %v", err)
+	}
+	if err := d.Delete(ctx, "a/two.txt"); err != nil {
+		t.Errorf("Expected deleting a missing object to succeed, got %v", err)
+	}
+	if _, err := d.Get(ctx, "a/two.txt"); err != ErrObjectNotFound {
+		t.Errorf("Expected the object to be deleted, got %v", err)
+	}
+
+	for _, key := range []string{"../escape", "a//b", "a/./b"} {
+		if err := d.Put(ctx, key, nil); err != ErrInvalidKey {
+			t.Errorf("Expected ErrInvalidKey for %q, got %v", key, err)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package objstore
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Common errors
+var (
+	ErrObjectNotFound = errors.New("object not found")
+	ErrInvalidKey     = errors.New("invalid object key")
+)
+
+// Store is an object storage bucket addressed by slash-separated keys
+type Store interface {
+	// Put stores an object, replacing any object with the same key
+	Put(ctx context.Context, key string, data []byte) error
+	// Get returns the content of an object or ErrObjectNotFound
+	Get(ctx context.Context, key string) ([]byte, error)
+	// List returns the keys starting with prefix in lexical order
+	List(ctx context.Context, prefix string) ([]string, error)
+	// Delete removes an object; deleting a missing object is not an error
+	Delete(ctx context.Context, key string) error
+}
+
+// validateKey checks that a key can be used with any store
+func validateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || len(key) > 1024 {
+		return ErrInvalidKey
+	}
+	return nil
+}
+
+// MemoryStore keeps objects in memory, mainly for tests and local development
+type MemoryStore struct {
+	objects map[string][]byte
+	mutex   sync.RWMutex
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		objects: make(map[string][]byte),
+	}
+}
+
+// Put stores a copy of data under key
+func (m *MemoryStore) Put(ctx context.Context, key string, data []byte) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.objects[key] = append([]byte(nil), data...)
+	return nil
+}
+
+// Get returns a copy of the object stored under key
+func (m *MemoryStore) Get(ctx context.Context, key string) ([]byte, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	data, exists := m.objects[key]
+	if !exists {
+		return nil, ErrObjectNotFound
+	}
+	return append([]byte(nil), data...), nil
+}
+
+// List returns the keys starting with prefix in lexical order
+func (m *MemoryStore) List(ctx context.Context, prefix string) ([]string, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	keys := []string{}
+	for key := range m.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Delete removes the object stored under key
+func (m *MemoryStore) Delete(ctx context.Context, key string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.objects, key)
+	return nil
+}
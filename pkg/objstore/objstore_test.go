@@ -0,0 +1,44 @@
+package objstore
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryStore()
+
+	data := []byte("hello")
+	if err := m.Put(ctx, "a/2", data); err != nil {
+		t.Fatalf("Failed to put object: %v", err)
+	}
+	m.Put(ctx, "a/1", []byte("first"))
+	m.Put(ctx, "b/1", []byte("other"))
+	data[0] = 'j'
+
+	got, err := m.Get(ctx, "a/2")
+	if err != nil || string(got) != "hello" {
+		t.Errorf("Expected hello, got %q, %v", got, err)
+	}
+
+	if _, err := m.Get(ctx, "missing"); err != ErrObjectNotFound {
+		t.Errorf("Expected ErrObjectNotFound, got %v", err)
+	}
+
+	keys, _ := m.List(ctx, "a/")
+	if len(keys) != 2 || keys[0] != "a/1" || keys[1] != "a/2" {
+		t.Errorf("Expected [a/1 a/2], got %v", keys)
+	}
+
+	m.Delete(ctx, "a/1")
+	if _, err := m.Get(ctx, "a/1"); err != ErrObjectNotFound {
+		t.Errorf("Expected the object to be deleted, got %v", err)
+	}
+
+	for _, key := range []string{"", "/absolute"} {
+		if err := m.Put(ctx, key, nil); err != ErrInvalidKey {
+			t.Errorf("Expected ErrInvalidKey for %q, got %v", key, err)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package objstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultRegion is used when an S3 configuration does not set a region
+const DefaultRegion = "us-east-1"
+
+// maxErrorBody bounds how much of an error response is read
+const maxErrorBody = 4096
+
+// ErrInvalidConfig is returned for incomplete S3 configurations
+var ErrInvalidConfig = errors.New("invalid S3 configuration")
+
+// S3Config configures an S3-compatible bucket. Credentials fall back to the
+// AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables, so they
+// do not have to be written to configuration files.
+type S3Config struct {
+	Endpoint        string `json:"endpoint,omitempty"` // e.g. https://s3.eu-west-1.amazonaws.com or a MinIO URL
+	Region          string `json:"region,omitempty"`
+	Bucket          string `json:"bucket"`
+	PathStyle       bool   `json:"pathStyle,omitempty"` // Address the bucket in the path instead of the host name
+	AccessKeyID     string `json:"accessKeyId,omitempty"`
+	SecretAccessKey string `json:"secretAccessKey,omitempty"`
+}
+
+// S3 stores objects in an S3-compatible bucket using Signature Version 4
+type S3 struct {
+	config   S3Config
+	endpoint *url.URL
+	client   *http.Client
+	now      func() time.Time
+}
+
+// NewS3 creates a client for an S3-compatible bucket
+func NewS3(config S3Config) (*S3, error) {
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("%w: bucket is required", ErrInvalidConfig)
+	}
+	if config.Region == "" {
+		config.Region = DefaultRegion
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = "https://s3." + config.Region + ".amazonaws.com"
+	}
+	if config.AccessKeyID == "" {
+		config.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+	}
+	if config.SecretAccessKey == "" {
+		config.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+	if config.AccessKeyID == "" || config.SecretAccessKey == "" {
+		return nil, fmt.Errorf("%w: credentials are required", ErrInvalidConfig)
+	}
+
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("%w: invalid endpoint %q", ErrInvalidConfig, config.Endpoint)
+	}
+
+	return &S3{
+		config:   config,
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: time.Minute},
+		now:      time.Now,
+	}, nil
+}
+
+// Put uploads an object
+func (s *S3) Put(ctx context.Context, key string, data []byte) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+
+	resp, err := s.do(ctx, http.MethodPut, key, nil, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+	return nil
+}
+
+// Get downloads an object
+func (s *S3) Get(ctx context.Context, key string) ([]byte, error) {
+	if err := validateKey(key); err != nil {
+		return nil, err
+	}
+
+	resp, err := s.do(ctx, http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return io.ReadAll(resp.Body)
+	case http.StatusNotFound:
+		return nil, ErrObjectNotFound
+	default:
+		return nil, responseError(resp)
+	}
+}
+
+// Delete removes an object. S3 reports success for missing objects too.
+func (s *S3) Delete(ctx context.Context, key string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusNotFound:
+		return nil
+	default:
+		return responseError(resp)
+	}
+}
+
+// listResult is the response of a ListObjectsV2 request
+type listResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List returns the keys starting with prefix, following continuation tokens
+func (s *S3) List(ctx context.Context, prefix string) ([]string, error) {
+	keys := []string{}
+	token := ""
+
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		resp, err := s.do(ctx, http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			err := responseError(resp)
+			resp.Body.Close()
+			return nil, err
+		}
+
+		var result listResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid list response: %v", err)
+		}
+
+		for _, c := range result.Contents {
+			keys = append(keys, c.Key)
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return keys, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// do sends a signed request for an object, or for the bucket when key is empty
+func (s *S3) do(ctx context.Context, method, key string, query url.Values, body []byte) (*http.Response, error) {
+	u := *s.endpoint
+	path := strings.TrimSuffix(u.Path, "/")
+	if s.config.PathStyle {
+		path += "/" + s.config.Bucket
+	} else {
+		u.Host = s.config.Bucket + "." + u.Host
+	}
+	if key != "" {
+		path += "/" + key
+	}
+	if path == "" {
+		path = "/"
+	}
+
+	u.Path = path
+	u.RawPath = uriEncode(path, false)
+	u.RawQuery = encodeQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+
+	payloadHash := emptyPayloadHash
+	if len(body) > 0 {
+		payloadHash = sha256Hex(body)
+	}
+	signV4(req, s.config.AccessKeyID, s.config.SecretAccessKey, s.config.Region, payloadHash, s.now())
+
+	return s.client.Do(req)
+}
+
+// responseError converts an unexpected S3 response to an error
+func responseError(resp *http.Response) error {
+	var result struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	if xml.Unmarshal(body, &result) == nil && result.Code != "" {
+		return fmt.Errorf("S3 request failed with status %d: %s: %s", resp.StatusCode, result.Code, result.Message)
+	}
+	return fmt.Errorf("S3 request failed with status %d", resp.StatusCode)
+}
@@ -0,0 +1,170 @@
+package objstore
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeS3 serves a single path-style bucket from memory
+type fakeS3 struct {
+	bucket  string
+	objects map[string][]byte
+	mutex   sync.Mutex
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/") {
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, "<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>")
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/"+f.bucket)
+	key := strings.TrimPrefix(path, "/")
+
+	switch {
+	case r.Method == http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("X-Amz-Content-Sha256") != sha256Hex(body) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.objects[key] = body
+
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.Method == http.MethodGet && key == "":
+		f.list(w, r)
+
+	case r.Method == http.MethodGet:
+		data, exists := f.objects[key]
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	}
+}
+
+// list returns matching keys two at a time
+func (f *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, r.URL.Query().Get("prefix")) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	start, _ := strconv.Atoi(r.URL.Query().Get("continuation-token"))
+	end := start + 2
+	if end > len(keys) {
+		end = len(keys)
+	}
+
+	type content struct {
+		Key string `xml:"Key"`
+	}
+	result := struct {
+		XMLName               xml.Name  `xml:"ListBucketResult"`
+		Contents              []content `xml:"Contents"`
+		IsTruncated           bool      `xml:"IsTruncated"`
+		NextContinuationToken string    `xml:"NextContinuationToken,omitempty"`
+	}{IsTruncated: end < len(keys)}
+	for _, key := range keys[start:end] {
+		result.Contents = append(result.Contents, content{Key: key})
+	}
+	if result.IsTruncated {
+		result.NextContinuationToken = strconv.Itoa(end)
+	}
+
+	xml.NewEncoder(w).Encode(result)
+}
+
+func TestNewS3Validation(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+
+	invalid := []S3Config{
+		{AccessKeyID: "key", SecretAccessKey: "secret"},
+		{Bucket: "b"},
+		{Bucket: "b", AccessKeyID: "key", SecretAccessKey: "secret", Endpoint: "ftp://example.com"},
+	}
+	for _, config := range invalid {
+		if _, err := NewS3(config); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("Expected ErrInvalidConfig for %+v, got %v", config, err)
+		}
+	}
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "env-key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "env-secret")
+	s, err := NewS3(S3Config{Bucket: "b"})
+	if err != nil {
+		t.Fatalf("Expected credentials from the environment, got %v", err)
+	}
+	if s.config.Endpoint != "https://s3.us-east-1.amazonaws.com" || s.config.AccessKeyID != "env-key" {
+		t.Errorf("Unexpected defaults: %+v", s.config)
+	}
+}
+
+func TestS3(t *testing.T) {
+	fake := &fakeS3{bucket: "backups", objects: make(map[string][]byte)}
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	s, err := NewS3(S3Config{Endpoint: ts.URL, Bucket: "backups", PathStyle: true, AccessKeyID: "key", SecretAccessKey: "secret"})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	ctx := context.Background()
+
+	keys := []string{"dt/snapshots/2024/01/01/a.json.gz", "dt/snapshots/2024/01/02/b c.json.gz", "dt/history/x.json.gz", "dt/snapshots/2024/01/03/c.json.gz"}
+	for _, key := range keys {
+		if err := s.Put(ctx, key, []byte(key)); err != nil {
+			t.Fatalf("Failed to put %s: %v", key, err)
+		}
+	}
+
+	data, err := s.Get(ctx, "dt/snapshots/2024/01/02/b c.json.gz")
+	if err != nil || string(data) != "dt/snapshots/2024/01/02/b c.json.gz" {
+		t.Errorf("Unexpected object %q, %v", data, err)
+	}
+
+	if _, err := s.Get(ctx, "missing"); err != ErrObjectNotFound {
+		t.Errorf("Expected ErrObjectNotFound, got %v", err)
+	}
+
+	listed, err := s.List(ctx, "dt/snapshots/")
+	if err != nil {
+		t.Fatalf("Failed to list objects: %v", err)
+	}
+	if len(listed) != 3 || listed[2] != "dt/snapshots/2024/01/03/c.json.gz" {
+		t.Errorf("Expected 3 snapshot keys across pages, got %v", listed)
+	}
+
+	if err := s.Delete(ctx, "dt/history/x.json.gz"); err != nil {
+		t.Errorf("Failed to delete object: %v", err)
+	}
+	if _, err := s.Get(ctx, "dt/history/x.json.gz"); err != ErrObjectNotFound {
+		t.Errorf("Expected the object to be deleted, got %v", err)
+	}
+
+	denied, _ := NewS3(S3Config{Endpoint: ts.URL, Bucket: "backups", PathStyle: true, AccessKeyID: "other", SecretAccessKey: "secret"})
+	if err := denied.Put(ctx, "x", nil); err == nil || !strings.Contains(err.Error(), "AccessDenied") {
+		t.Errorf("Expected AccessDenied error, got %v", err)
+	}
+}
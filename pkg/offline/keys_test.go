@@ -0,0 +1,29 @@
+package offline
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+)
+
+func TestParseKeys(t *testing.T) {
+	public, private, _ := ed25519.GenerateKey(nil)
+	privateDER, _ := x509.MarshalPKCS8PrivateKey(private)
+	parsed, err := ParsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}))
+	if err != nil || !parsed.Equal(private) {
+		t.Errorf("Failed to parse the private key: %v", err)
+	}
+	der, _ := x509.MarshalPKIXPublicKey(public)
+	parsedPublic, err := ParsePublicKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	if err != nil || !parsedPublic.Equal(public) {
+		t.Errorf("Failed to parse the public key: %v", err)
+	}
+
+	if _, err := ParsePrivateKey([]byte("key")); err == nil {
+		t.Error("Expected an error for data that is not PEM")
+	}
+	if _, err := ParsePublicKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER})); err == nil {
+		t.Error("Expected an error for a private key where a public key belongs")
+	}
+}
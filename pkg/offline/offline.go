@@ -0,0 +1,529 @@
+// Package offline moves twins and their history between servers that share no
+// network, e.g. to and from air-gapped sites. Export writes the selected twins
+// and their history into a compressed bundle whose manifest records a SHA-256
+// digest of every file and can be signed with an Ed25519 key. Import verifies
+// the bundle before creating the twins, optionally under new IDs.
+package offline
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/history"
+	"github.com/aleka07/go-digital-twin/pkg/query"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// Common errors
+var (
+	ErrInvalidOptions = errors.New("invalid bundle options")
+	ErrInvalidBundle  = errors.New("invalid bundle")
+	ErrUntrusted      = errors.New("untrusted bundle")
+	ErrConflict       = errors.New("twins already exist")
+)
+
+// Format is the version of the bundle layout written by Export
+const Format = 1
+
+// MaxSize bounds the uncompressed size of a bundle that is imported
+const MaxSize = 1 << 30
+
+// ContentType is the media type of bundles
+const ContentType = "application/gzip"
+
+// Files of a bundle, a gzip-compressed tar archive. The manifest lists the
+// digests of the twins and history; the signature, if any, signs the manifest.
+const (
+	ManifestFile  = "manifest.json"
+	TwinsFile     = "twins.json"
+	HistoryFile   = "history.json"
+	SignatureFile = "signature.json"
+)
+
+// Conflict policies of imports for twins that already exist
+const (
+	ConflictSkip    = "skip"    // Keep the existing twin and its history
+	ConflictReplace = "replace" // Replace the existing twin and add the history
+	ConflictFail    = "fail"    // Import nothing
+)
+
+// Manifest describes the content of a bundle
+type Manifest struct {
+	Format    int               `json:"format"`
+	CreatedAt time.Time         `json:"createdAt"`
+	Source    string            `json:"source,omitempty"` // Name of the exporting server
+	Twins     []string          `json:"twins"`
+	Samples   int               `json:"samples"`
+	From      *time.Time        `json:"from,omitempty"` // History range, if history is included
+	To        *time.Time        `json:"to,omitempty"`
+	Files     map[string]string `json:"files"` // Hex SHA-256 digests by file name
+}
+
+// Signature signs the manifest of a bundle
+type Signature struct {
+	KeyID     string `json:"keyId"`
+	PublicKey []byte `json:"publicKey"`
+	Signature []byte `json:"signature"`
+}
+
+// Keys sign exported bundles and decide which imported bundles are trusted
+type Keys struct {
+	Signing ed25519.PrivateKey  // Bundles are unsigned without a signing key
+	Trusted []ed25519.PublicKey // Without trusted keys any intact bundle is imported
+}
+
+// ExportOptions select what is exported
+type ExportOptions struct {
+	IDs     []string  `json:"ids,omitempty"`     // Twins to export; all when empty
+	Query   string    `json:"query,omitempty"`   // Only twins matching the query
+	History bool      `json:"history,omitempty"` // Include the history of the twins
+	From    time.Time `json:"from,omitempty"`    // History from (inclusive), open when zero
+	To      time.Time `json:"to,omitempty"`      // History up to (exclusive), open when zero
+	Source  string    `json:"source,omitempty"`  // Name of the exporting server, recorded in the manifest
+}
+
+// ImportOptions control how a bundle is imported
+type ImportOptions struct {
+	Prefix     string            `json:"prefix,omitempty"`     // Prepended to the IDs of twins not in Remap
+	Remap      map[string]string `json:"remap,omitempty"`      // New IDs by bundled ID
+	OnConflict string            `json:"onConflict,omitempty"` // One of the Conflict policies, skip by default
+	DryRun     bool              `json:"dryRun,omitempty"`     // Verify and report without importing
+}
+
+// Result reports what an import did, or would do in a dry run
+type Result struct {
+	Manifest Manifest          `json:"manifest"`
+	Signed   bool              `json:"signed"`
+	Trusted  bool              `json:"trusted"` // Signed by one of the trusted keys
+	KeyID    string            `json:"keyId,omitempty"`
+	IDs      map[string]string `json:"ids,omitempty"` // Imported IDs by bundled ID, for remapped twins
+	Created  []string          `json:"created"`
+	Replaced []string          `json:"replaced"`
+	Skipped  []string          `json:"skipped"`
+	Samples  int               `json:"samples"`
+	DryRun   bool              `json:"dryRun,omitempty"`
+}
+
+// KeyID identifies a public key by the start of its SHA-256 digest
+func KeyID(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Export writes a bundle of the selected twins, and their history if
+// requested, and returns its manifest. The bundle is signed if keys has a
+// signing key.
+func Export(w io.Writer, reg *registry.Registry, hist *history.Store, keys Keys, opts ExportOptions) (Manifest, error) {
+	twins, err := selectTwins(reg, opts)
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	manifest := Manifest{
+		Format:    Format,
+		CreatedAt: time.Now().UTC(),
+		Source:    opts.Source,
+		Twins:     make([]string, 0, len(twins)),
+		Files:     make(map[string]string),
+	}
+	selected := make(map[string]bool, len(twins))
+	for _, dt := range twins {
+		manifest.Twins = append(manifest.Twins, dt.ID)
+		selected[dt.ID] = true
+	}
+
+	files := make(map[string][]byte)
+	if files[TwinsFile], err = json.Marshal(twins); err != nil {
+		return Manifest{}, fmt.Errorf("encode twins: %w", err)
+	}
+
+	if opts.History && hist != nil {
+		samples := []history.Entry{}
+		for _, entry := range hist.Range(opts.From, opts.To) {
+			if selected[entry.TwinID] {
+				samples = append(samples, entry)
+			}
+		}
+		if files[HistoryFile], err = json.Marshal(samples); err != nil {
+			return Manifest{}, fmt.Errorf("encode history: %w", err)
+		}
+		manifest.Samples = len(samples)
+		if !opts.From.IsZero() {
+			manifest.From = &opts.From
+		}
+		if !opts.To.IsZero() {
+			manifest.To = &opts.To
+		}
+	}
+
+	for name, data := range files {
+		sum := sha256.Sum256(data)
+		manifest.Files[name] = hex.EncodeToString(sum[:])
+	}
+	if files[ManifestFile], err = json.MarshalIndent(manifest, "", "  "); err != nil {
+		return Manifest{}, fmt.Errorf("encode manifest: %w", err)
+	}
+
+	if keys.Signing != nil {
+		public := keys.Signing.Public().(ed25519.PublicKey)
+		signature := Signature{
+			KeyID:     KeyID(public),
+			PublicKey: public,
+			Signature: ed25519.Sign(keys.Signing, files[ManifestFile]),
+		}
+		if files[SignatureFile], err = json.MarshalIndent(signature, "", "  "); err != nil {
+			return Manifest{}, fmt.Errorf("encode signature: %w", err)
+		}
+	}
+
+	return manifest, writeArchive(w, files, manifest.CreatedAt)
+}
+
+// selectTwins returns copies of the twins selected by the export options, by ID
+func selectTwins(reg *registry.Registry, opts ExportOptions) ([]*twin.DigitalTwin, error) {
+	q, err := query.Parse(opts.Query)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidOptions, err)
+	}
+	if !opts.To.IsZero() && !opts.To.After(opts.From) {
+		return nil, fmt.Errorf("%w: to must be after from", ErrInvalidOptions)
+	}
+
+	var candidates []*twin.DigitalTwin
+	if len(opts.IDs) == 0 {
+		candidates = reg.List()
+	} else {
+		for _, id := range opts.IDs {
+			dt, err := reg.Get(id)
+			if err != nil {
+				return nil, fmt.Errorf("%w: twin %s: %v", ErrInvalidOptions, id, err)
+			}
+			candidates = append(candidates, dt)
+		}
+	}
+
+	twins := []*twin.DigitalTwin{}
+	seen := make(map[string]bool)
+	for _, dt := range candidates {
+		if !seen[dt.ID] && q.Matches(dt) {
+			seen[dt.ID] = true
+			twins = append(twins, dt.Clone())
+		}
+	}
+	sort.Slice(twins, func(i, j int) bool { return twins[i].ID < twins[j].ID })
+	return twins, nil
+}
+
+// writeArchive writes files as a gzip-compressed tar archive, manifest first
+func writeArchive(w io.Writer, files map[string][]byte, modTime time.Time) error {
+	zw := gzip.NewWriter(w)
+	tw := tar.NewWriter(zw)
+	for _, name := range []string{ManifestFile, SignatureFile, TwinsFile, HistoryFile} {
+		data, exists := files[name]
+		if !exists {
+			continue
+		}
+		header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: modTime, Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// Bundle is a verified bundle
+type Bundle struct {
+	Manifest Manifest
+	Signed   bool
+	Trusted  bool
+	KeyID    string
+	Twins    []*twin.DigitalTwin
+	Samples  []history.Entry
+}
+
+// Read reads a bundle and verifies it: every file must match its digest in
+// the manifest, a signature must be valid, and if keys has trusted keys the
+// bundle must be signed by one of them.
+func Read(r io.Reader, keys Keys) (*Bundle, error) {
+	files, err := readArchive(r)
+	if err != nil {
+		return nil, err
+	}
+
+	manifestData, exists := files[ManifestFile]
+	if !exists {
+		return nil, fmt.Errorf("%w: no %s", ErrInvalidBundle, ManifestFile)
+	}
+	b := &Bundle{}
+	if err := json.Unmarshal(manifestData, &b.Manifest); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidBundle, ManifestFile, err)
+	}
+	if b.Manifest.Format != Format {
+		return nil, fmt.Errorf("%w: unsupported format %d", ErrInvalidBundle, b.Manifest.Format)
+	}
+
+	if err := verifySignature(b, files, keys); err != nil {
+		return nil, err
+	}
+
+	for name, data := range files {
+		if name == ManifestFile || name == SignatureFile {
+			continue
+		}
+		digest, listed := b.Manifest.Files[name]
+		if !listed {
+			return nil, fmt.Errorf("%w: %s is not in the manifest", ErrInvalidBundle, name)
+		}
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != digest {
+			return nil, fmt.Errorf("%w: digest mismatch for %s", ErrInvalidBundle, name)
+		}
+	}
+	for name := range b.Manifest.Files {
+		if _, exists := files[name]; !exists {
+			return nil, fmt.Errorf("%w: %s is missing", ErrInvalidBundle, name)
+		}
+	}
+
+	if err := json.Unmarshal(files[TwinsFile], &b.Twins); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidBundle, TwinsFile, err)
+	}
+	if data, exists := files[HistoryFile]; exists {
+		if err := json.Unmarshal(data, &b.Samples); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidBundle, HistoryFile, err)
+		}
+	}
+	for _, dt := range b.Twins {
+		if dt == nil || dt.ID == "" {
+			return nil, fmt.Errorf("%w: twin without ID", ErrInvalidBundle)
+		}
+		if dt.Attributes == nil {
+			dt.Attributes = make(map[string]interface{})
+		}
+		if dt.Features == nil {
+			dt.Features = make(map[string]*twin.FeatureState)
+		}
+	}
+	return b, nil
+}
+
+// verifySignature checks the signature of a bundle, if any, and whether it
+// is trusted
+func verifySignature(b *Bundle, files map[string][]byte, keys Keys) error {
+	data, signed := files[SignatureFile]
+	if !signed {
+		if len(keys.Trusted) > 0 {
+			return fmt.Errorf("%w: bundle is not signed", ErrUntrusted)
+		}
+		return nil
+	}
+
+	var signature Signature
+	if err := json.Unmarshal(data, &signature); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidBundle, SignatureFile, err)
+	}
+	if len(signature.PublicKey) != ed25519.PublicKeySize ||
+		!ed25519.Verify(ed25519.PublicKey(signature.PublicKey), files[ManifestFile], signature.Signature) {
+		return fmt.Errorf("%w: invalid signature", ErrUntrusted)
+	}
+	b.Signed = true
+	b.KeyID = KeyID(signature.PublicKey)
+
+	for _, key := range keys.Trusted {
+		if key.Equal(ed25519.PublicKey(signature.PublicKey)) {
+			b.Trusted = true
+		}
+	}
+	if len(keys.Trusted) > 0 && !b.Trusted {
+		return fmt.Errorf("%w: signed by unknown key %s", ErrUntrusted, b.KeyID)
+	}
+	return nil
+}
+
+// readArchive reads the files of a gzip-compressed tar archive
+func readArchive(r io.Reader) (map[string][]byte, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+	}
+	defer zr.Close()
+
+	files := make(map[string][]byte)
+	tr := tar.NewReader(io.LimitReader(zr, MaxSize+1))
+	size := 0
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("%w: unexpected entry %s", ErrInvalidBundle, header.Name)
+		}
+		if _, exists := files[header.Name]; exists {
+			return nil, fmt.Errorf("%w: duplicate file %s", ErrInvalidBundle, header.Name)
+		}
+
+		var buf bytes.Buffer
+		if _, err := io.Copy(&buf, tr); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidBundle, header.Name, err)
+		}
+		if size += buf.Len(); size > MaxSize {
+			return nil, fmt.Errorf("%w: larger than %d bytes", ErrInvalidBundle, MaxSize)
+		}
+		files[header.Name] = buf.Bytes()
+	}
+}
+
+// Import reads and verifies a bundle and imports its twins and their history
+// under the IDs the options map them to. Twins keep their exported revision
+// when created. Relationships between bundled twins follow their remapped
+// IDs. Samples that already exist are not recorded again.
+func Import(r io.Reader, reg *registry.Registry, hist *history.Store, keys Keys, opts ImportOptions) (Result, error) {
+	switch opts.OnConflict {
+	case "":
+		opts.OnConflict = ConflictSkip
+	case ConflictSkip, ConflictReplace, ConflictFail:
+	default:
+		return Result{}, fmt.Errorf("%w: unknown conflict policy %q", ErrInvalidOptions, opts.OnConflict)
+	}
+
+	b, err := Read(r, keys)
+	if err != nil {
+		return Result{}, err
+	}
+	result := Result{
+		Manifest: b.Manifest,
+		Signed:   b.Signed,
+		Trusted:  b.Trusted,
+		KeyID:    b.KeyID,
+		Created:  []string{},
+		Replaced: []string{},
+		Skipped:  []string{},
+		DryRun:   opts.DryRun,
+	}
+
+	ids := make(map[string]string, len(b.Twins))
+	targets := make(map[string]string, len(b.Twins))
+	for _, dt := range b.Twins {
+		id, remapped := opts.Remap[dt.ID]
+		if !remapped {
+			id = opts.Prefix + dt.ID
+		}
+		if id == "" {
+			return result, fmt.Errorf("%w: twin %s is mapped to an empty ID", ErrInvalidOptions, dt.ID)
+		}
+		if other, taken := targets[id]; taken {
+			return result, fmt.Errorf("%w: twins %s and %s are both mapped to %s", ErrInvalidOptions, other, dt.ID, id)
+		}
+		targets[id] = dt.ID
+		ids[dt.ID] = id
+		if id != dt.ID {
+			if result.IDs == nil {
+				result.IDs = make(map[string]string)
+			}
+			result.IDs[dt.ID] = id
+		}
+	}
+
+	// Decide the fate of each twin before changing anything
+	imported := make(map[string]bool, len(b.Twins))
+	for _, dt := range b.Twins {
+		id := ids[dt.ID]
+		if _, err := reg.Get(id); err == nil {
+			switch opts.OnConflict {
+			case ConflictSkip:
+				result.Skipped = append(result.Skipped, id)
+				continue
+			case ConflictReplace:
+				result.Replaced = append(result.Replaced, id)
+			case ConflictFail:
+				result.Skipped = append(result.Skipped, id)
+			}
+		} else {
+			result.Created = append(result.Created, id)
+		}
+		imported[dt.ID] = true
+	}
+	if opts.OnConflict == ConflictFail && len(result.Skipped) > 0 {
+		return result, fmt.Errorf("%w: %v", ErrConflict, result.Skipped)
+	}
+
+	if !opts.DryRun {
+		for _, dt := range b.Twins {
+			if imported[dt.ID] {
+				if err := importTwin(reg, dt, ids); err != nil {
+					return result, err
+				}
+			}
+		}
+	}
+
+	if hist != nil {
+		for _, entry := range b.Samples {
+			if !imported[entry.TwinID] {
+				continue
+			}
+			id := ids[entry.TwinID]
+			if len(hist.Query(id, entry.FeatureID, entry.Key, entry.Timestamp, entry.Timestamp)) > 0 {
+				continue
+			}
+			if !opts.DryRun {
+				hist.Record(id, entry.FeatureID, entry.Key, entry.Value, entry.Timestamp)
+			}
+			result.Samples++
+		}
+	}
+	return result, nil
+}
+
+// importTwin creates or replaces a bundled twin under its new ID
+func importTwin(reg *registry.Registry, dt *twin.DigitalTwin, ids map[string]string) error {
+	revision := dt.GetRevision()
+	dt.ID = ids[dt.ID]
+	for name, targets := range dt.Relationships {
+		for i, target := range targets {
+			if mapped, exists := ids[target]; exists {
+				targets[i] = mapped
+			}
+		}
+		sort.Strings(targets)
+		dt.Relationships[name] = targets
+	}
+
+	err := reg.Create(dt)
+	if err == registry.ErrTwinAlreadyExists {
+		// Replace unconditionally; the stored revision moves on
+		dt.SetRevision(0)
+		if err := reg.Update(dt); err != nil {
+			return fmt.Errorf("replace twin %s: %w", dt.ID, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("create twin %s: %w", dt.ID, err)
+	}
+	if revision > 0 {
+		dt.SetRevision(revision)
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package offline
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/history"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func newSite(t *testing.T) (*registry.Registry, *history.Store) {
+	reg := registry.NewRegistry()
+	hist := history.NewStore(history.DefaultCapacity)
+	for _, id := range []string{"pump-1", "pump-2", "valve-1"} {
+		dt := twin.NewDigitalTwin(id, id[:len(id)-2])
+		fs := twin.NewFeatureState()
+		fs.SetProperty("value", 1.0)
+		dt.AddFeature("sensor", fs)
+		if err := reg.Create(dt); err != nil {
+			t.Fatalf("Failed to create %s: %v", id, err)
+		}
+	}
+	pump, _ := reg.Get("pump-1")
+	pump.AddRelationship("feeds", "valve-1")
+	pump.AddRelationship("feeds", "tank-9")
+	pump.SetRevision(4)
+
+	base := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		for _, id := range []string{"pump-1", "pump-2", "valve-1"} {
+			hist.Record(id, "sensor", "value", float64(i), base.Add(time.Duration(i)*time.Hour))
+		}
+	}
+	return reg, hist
+}
+
+func newKey(t *testing.T) ed25519.PrivateKey {
+	_, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	return key
+}
+
+func TestExportImport(t *testing.T) {
+	reg, hist := newSite(t)
+	key := newKey(t)
+
+	var bundle bytes.Buffer
+	manifest, err := Export(&bundle, reg, hist, Keys{Signing: key}, ExportOptions{
+		Query:   "type == pump",
+		History: true,
+		From:    time.Date(2024, 1, 2, 1, 0, 0, 0, time.UTC),
+		Source:  "site-a",
+	})
+	if err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+	if len(manifest.Twins) != 2 || manifest.Samples != 4 || len(manifest.Files) != 2 {
+		t.Errorf("Unexpected manifest %+v", manifest)
+	}
+
+	// Import on another site, remapping the IDs
+	dest := registry.NewRegistry()
+	destHist := history.NewStore(history.DefaultCapacity)
+	dest.Create(twin.NewDigitalTwin("b/pump-2", "pump"))
+	keys := Keys{Trusted: []ed25519.PublicKey{key.Public().(ed25519.PublicKey)}}
+	opts := ImportOptions{Prefix: "b/", Remap: map[string]string{"pump-1": "b/main-pump"}}
+
+	result, err := Import(bytes.NewReader(bundle.Bytes()), dest, destHist, keys, opts)
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	if !result.Signed || !result.Trusted || result.KeyID == "" {
+		t.Errorf("Expected a trusted signature, got %+v", result)
+	}
+	if len(result.Created) != 1 || result.Created[0] != "b/main-pump" || len(result.Skipped) != 1 || result.Samples != 2 {
+		t.Errorf("Unexpected result %+v", result)
+	}
+
+	dt, err := dest.Get("b/main-pump")
+	if err != nil {
+		t.Fatalf("Expected the remapped twin: %v", err)
+	}
+	if dt.GetRevision() != 4 {
+		t.Errorf("Expected the exported revision, got %d", dt.GetRevision())
+	}
+	if feeds := dt.GetRelationship("feeds"); len(feeds) != 2 || feeds[0] != "tank-9" || feeds[1] != "valve-1" {
+		t.Errorf("Expected targets outside the bundle to be kept, got %v", feeds)
+	}
+	if samples := destHist.Query("b/main-pump", "sensor", "value", time.Time{}, time.Time{}); len(samples) != 2 {
+		t.Errorf("Expected the history range, got %v", samples)
+	}
+
+	// Importing again replaces the twins but does not duplicate history
+	opts.OnConflict = ConflictReplace
+	result, err = Import(bytes.NewReader(bundle.Bytes()), dest, destHist, keys, opts)
+	if err != nil {
+		t.Fatalf("Failed to import again: %v", err)
+	}
+	if len(result.Replaced) != 2 || result.Samples != 2 {
+		t.Errorf("Unexpected result %+v", result)
+	}
+	if dt, _ := dest.Get("b/main-pump"); dt.GetRevision() != 5 {
+		t.Errorf("Expected the replaced twin to move on, got revision %d", dt.GetRevision())
+	}
+	if samples := destHist.Query("b/pump-2", "sensor", "value", time.Time{}, time.Time{}); len(samples) != 2 {
+		t.Errorf("Expected no duplicate samples, got %v", samples)
+	}
+
+	opts.OnConflict = ConflictFail
+	if _, err := Import(bytes.NewReader(bundle.Bytes()), dest, destHist, keys, opts); !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected ErrConflict, got %v", err)
+	}
+
+	// Dry runs change nothing
+	result, err = Import(bytes.NewReader(bundle.Bytes()), dest, destHist, Keys{}, ImportOptions{Prefix: "c/", DryRun: true})
+	if err != nil || len(result.Created) != 2 || result.Samples != 4 || !result.Signed || result.Trusted {
+		t.Errorf("Unexpected dry run %+v: %v", result, err)
+	}
+	if dest.Count() != 2 {
+		t.Errorf("Expected the dry run to create nothing, got %d twins", dest.Count())
+	}
+
+	if _, err := Import(bytes.NewReader(bundle.Bytes()), dest, destHist, Keys{}, ImportOptions{Remap: map[string]string{"pump-1": "pump-2"}}); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("Expected colliding IDs to be rejected, got %v", err)
+	}
+}
+
+func TestExportOptions(t *testing.T) {
+	reg, hist := newSite(t)
+	for _, opts := range []ExportOptions{
+		{Query: "type =="},
+		{IDs: []string{"pump-9"}},
+		{From: time.Now(), To: time.Now().Add(-time.Hour)},
+	} {
+		if _, err := Export(io.Discard, reg, hist, Keys{}, opts); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("Expected ErrInvalidOptions for %+v, got %v", opts, err)
+		}
+	}
+}
+
+// rewrite replaces a file of a bundle without updating the manifest
+func rewrite(bundle []byte, name string, data []byte) []byte {
+	zr, _ := gzip.NewReader(bytes.NewReader(bundle))
+	tr := tar.NewReader(zr)
+	var out bytes.Buffer
+	zw := gzip.NewWriter(&out)
+	tw := tar.NewWriter(zw)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		content, _ := io.ReadAll(tr)
+		if header.Name == name {
+			content = data
+		}
+		header.Size = int64(len(content))
+		tw.WriteHeader(header)
+		tw.Write(content)
+	}
+	tw.Close()
+	zw.Close()
+	return out.Bytes()
+}
+
+func TestVerify(t *testing.T) {
+	reg, hist := newSite(t)
+	key := newKey(t)
+	var signed, unsigned bytes.Buffer
+	Export(&signed, reg, hist, Keys{Signing: key}, ExportOptions{History: true})
+	Export(&unsigned, reg, hist, Keys{}, ExportOptions{})
+	trusted := Keys{Trusted: []ed25519.PublicKey{key.Public().(ed25519.PublicKey)}}
+
+	if _, err := Read(bytes.NewReader(unsigned.Bytes()), Keys{}); err != nil {
+		t.Errorf("Expected unsigned bundles to be read without trusted keys, got %v", err)
+	}
+
+	for name, test := range map[string]struct {
+		bundle []byte
+		keys   Keys
+		err    error
+	}{
+		"unsigned":     {unsigned.Bytes(), trusted, ErrUntrusted},
+		"unknown key":  {signed.Bytes(), Keys{Trusted: []ed25519.PublicKey{newKey(t).Public().(ed25519.PublicKey)}}, ErrUntrusted},
+		"tampered":     {rewrite(signed.Bytes(), TwinsFile, []byte("[]")), Keys{}, ErrInvalidBundle},
+		"manifest":     {rewrite(signed.Bytes(), ManifestFile, []byte(`{"format":1,"twins":[],"files":{}}`)), Keys{}, ErrUntrusted},
+		"not a bundle": {[]byte("twins"), Keys{}, ErrInvalidBundle},
+	} {
+		if _, err := Read(bytes.NewReader(test.bundle), test.keys); !errors.Is(err, test.err) {
+			t.Errorf("%s: expected %v, got %v", name, test.err, err)
+		}
+	}
+}
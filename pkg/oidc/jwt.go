@@ -0,0 +1,163 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256" // Hashes of the supported algorithms
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// header is the JOSE header of a signed token
+type header struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+// jwt is a parsed, not yet verified, signed token
+type jwt struct {
+	header    header
+	claims    map[string]interface{}
+	signed    []byte // The header and payload the signature is over
+	signature []byte
+}
+
+// parseJWT splits and decodes a token in compact serialization
+func parseJWT(token string) (*jwt, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+
+	var t jwt
+	for i, target := range []interface{}{&t.header, &t.claims} {
+		data, err := base64.RawURLEncoding.DecodeString(parts[i])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+		}
+		if err := json.Unmarshal(data, target); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+		}
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	t.signed = []byte(parts[0] + "." + parts[1])
+	t.signature = signature
+	return &t, nil
+}
+
+// algorithms are the supported signature algorithms and their hashes.
+// Symmetric algorithms and none are deliberately absent.
+var algorithms = map[string]crypto.Hash{
+	"RS256": crypto.SHA256, "RS384": crypto.SHA384, "RS512": crypto.SHA512,
+	"PS256": crypto.SHA256, "PS384": crypto.SHA384, "PS512": crypto.SHA512,
+	"ES256": crypto.SHA256, "ES384": crypto.SHA384, "ES512": crypto.SHA512,
+}
+
+// verify checks the signature of a token with a public key
+func (t *jwt) verify(key crypto.PublicKey) error {
+	hash, ok := algorithms[t.header.Algorithm]
+	if !ok {
+		return fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, t.header.Algorithm)
+	}
+	h := hash.New()
+	h.Write(t.signed)
+	digest := h.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		var err error
+		switch t.header.Algorithm[0] {
+		case 'R':
+			err = rsa.VerifyPKCS1v15(k, hash, digest, t.signature)
+		case 'P':
+			err = rsa.VerifyPSS(k, hash, digest, t.signature, nil)
+		default:
+			err = errors.New("key type does not match the algorithm")
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidToken, err)
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if t.header.Algorithm[0] != 'E' || len(t.signature) != 2*size {
+			return fmt.Errorf("%w: invalid ECDSA signature", ErrInvalidToken)
+		}
+		r := new(big.Int).SetBytes(t.signature[:size])
+		s := new(big.Int).SetBytes(t.signature[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return fmt.Errorf("%w: invalid signature", ErrInvalidToken)
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: unsupported key type", ErrInvalidToken)
+}
+
+// jwk is a JSON Web Key of a key set
+type jwk struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	Curve   string `json:"crv"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+// curves are the supported elliptic curves of EC keys
+var curves = map[string]elliptic.Curve{
+	"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521(),
+}
+
+// publicKey returns the public key of a JWK
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	decode := func(s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil || len(b) == 0 {
+			return nil, fmt.Errorf("invalid key %s", k.KeyID)
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+
+	switch k.KeyType {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil || !e.IsInt64() || e.Int64() > 1<<31 {
+			return nil, fmt.Errorf("invalid exponent of key %s", k.KeyID)
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		curve, ok := curves[k.Curve]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %q of key %s", k.Curve, k.KeyID)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("key %s is not on its curve", k.KeyID)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q of key %s", k.KeyType, k.KeyID)
+}
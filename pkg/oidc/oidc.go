@@ -0,0 +1,354 @@
+// Package oidc signs users in with an OpenID Connect identity provider.
+// The dashboard uses the authorization code flow, and API clients present
+// tokens issued by the provider, which are verified against its published
+// keys. Groups of the provider are mapped to the roles of package auth, so
+// that enterprises manage access in the identity provider they already have.
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/auth"
+)
+
+// Common errors
+var (
+	ErrInvalidOptions = errors.New("invalid OIDC options")
+	ErrInvalidToken   = errors.New("invalid token")
+	ErrExchangeFailed = errors.New("authorization code exchange failed")
+)
+
+// Defaults of the options
+const (
+	DefaultGroupsClaim = "groups"
+	DefaultUserClaim   = "email"
+)
+
+// clockSkew is the leeway given to the expiry and issue times of tokens
+const clockSkew = time.Minute
+
+// keyRefreshInterval bounds how often the keys are fetched again for tokens
+// signed with an unknown key, as after a key rotation
+const keyRefreshInterval = time.Minute
+
+// Options configure a provider
+type Options struct {
+	Issuer       string               // Such as https://login.example.com/realms/plant
+	ClientID     string               // Client of the dashboard, the expected audience of ID tokens
+	ClientSecret string               // Secret of the client for the code exchange
+	RedirectURL  string               // Callback of the dashboard, such as https://dt.example.com/auth/callback
+	Scopes       []string             // Requested scopes besides openid; profile and email when empty
+	Audience     string               // Expected audience of API tokens, the client ID when empty
+	UserClaim    string               // Claim naming the user, DefaultUserClaim when empty; sub if missing
+	GroupsClaim  string               // Claim listing the groups, DefaultGroupsClaim when empty
+	Roles        map[string]auth.Role // Group -> role; the highest role of the groups of a user applies
+	DefaultRole  auth.Role            // Role of users in no mapped group; none when empty
+	HTTPClient   *http.Client         // http.DefaultClient when nil
+}
+
+// Provider verifies tokens of an identity provider and runs the
+// authorization code flow against it
+type Provider struct {
+	options       Options
+	authEndpoint  string
+	tokenEndpoint string
+	jwksURI       string
+	keys          map[string]crypto.PublicKey
+	keysFetched   time.Time
+	now           func() time.Time
+	mutex         sync.Mutex
+}
+
+// discovery is the part of the provider metadata the provider uses
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// NewProvider creates a provider from the metadata the issuer publishes at
+// /.well-known/openid-configuration
+func NewProvider(ctx context.Context, options Options) (*Provider, error) {
+	if options.Issuer == "" || options.ClientID == "" {
+		return nil, fmt.Errorf("%w: issuer and client ID are required", ErrInvalidOptions)
+	}
+	for group, role := range options.Roles {
+		if _, err := auth.ParseRole(string(role)); err != nil {
+			return nil, fmt.Errorf("%w: group %s: %v", ErrInvalidOptions, group, err)
+		}
+	}
+	if options.DefaultRole != "" {
+		if _, err := auth.ParseRole(string(options.DefaultRole)); err != nil {
+			return nil, fmt.Errorf("%w: default role: %v", ErrInvalidOptions, err)
+		}
+	}
+	if options.HTTPClient == nil {
+		options.HTTPClient = http.DefaultClient
+	}
+	if options.Audience == "" {
+		options.Audience = options.ClientID
+	}
+	if options.UserClaim == "" {
+		options.UserClaim = DefaultUserClaim
+	}
+	if options.GroupsClaim == "" {
+		options.GroupsClaim = DefaultGroupsClaim
+	}
+	if len(options.Scopes) == 0 {
+		options.Scopes = []string{"profile", "email"}
+	}
+
+	var meta discovery
+	wellKnown := strings.TrimSuffix(options.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := getJSON(ctx, options.HTTPClient, wellKnown, &meta); err != nil {
+		return nil, fmt.Errorf("failed to discover %s: %w", options.Issuer, err)
+	}
+	if meta.Issuer != options.Issuer {
+		return nil, fmt.Errorf("%w: the provider names itself %q, not %q", ErrInvalidOptions, meta.Issuer, options.Issuer)
+	}
+	if meta.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: the provider publishes no keys", ErrInvalidOptions)
+	}
+
+	return &Provider{
+		options:       options,
+		authEndpoint:  meta.AuthorizationEndpoint,
+		tokenEndpoint: meta.TokenEndpoint,
+		jwksURI:       meta.JWKSURI,
+		now:           time.Now,
+	}, nil
+}
+
+// getJSON fetches and decodes a JSON document
+func getJSON(ctx context.Context, client *http.Client, target string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", target, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// CanLogin reports whether the provider is configured for the authorization
+// code flow of the dashboard, not only for verifying API tokens
+func (p *Provider) CanLogin() bool {
+	return p.authEndpoint != "" && p.tokenEndpoint != "" && p.options.RedirectURL != ""
+}
+
+// AuthCodeURL returns the URL of the provider's login page. The state and
+// nonce are to be remembered and checked when the user returns.
+func (p *Provider) AuthCodeURL(state, nonce string) string {
+	params := url.Values{
+		"response_type": {"code"},
+		"client_id":     {p.options.ClientID},
+		"redirect_uri":  {p.options.RedirectURL},
+		"scope":         {strings.Join(append([]string{"openid"}, p.options.Scopes...), " ")},
+		"state":         {state},
+		"nonce":         {nonce},
+	}
+	separator := "?"
+	if strings.Contains(p.authEndpoint, "?") {
+		separator = "&"
+	}
+	return p.authEndpoint + separator + params.Encode()
+}
+
+// Exchange redeems an authorization code for tokens and returns the ID token
+func (p *Provider) Exchange(ctx context.Context, code string) (string, error) {
+	form := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {p.options.RedirectURL},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.tokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(p.options.ClientID), url.QueryEscape(p.options.ClientSecret))
+
+	resp, err := p.options.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrExchangeFailed, err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken     string `json:"id_token"`
+		Error       string `json:"error"`
+		Description string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return "", fmt.Errorf("%w: %s", ErrExchangeFailed, resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK || body.IDToken == "" {
+		return "", fmt.Errorf("%w: %s %s", ErrExchangeFailed, body.Error, body.Description)
+	}
+	return body.IDToken, nil
+}
+
+// Verify verifies a token presented to the API, such as an access token the
+// provider issued for the API's audience, and returns its identity
+func (p *Provider) Verify(ctx context.Context, token string) (*auth.Identity, error) {
+	return p.verify(ctx, token, p.options.Audience, "")
+}
+
+// VerifyIDToken verifies an ID token of the dashboard login, which must
+// carry the nonce of the login
+func (p *Provider) VerifyIDToken(ctx context.Context, token, nonce string) (*auth.Identity, error) {
+	return p.verify(ctx, token, p.options.ClientID, nonce)
+}
+
+// verify checks the signature and claims of a token
+func (p *Provider) verify(ctx context.Context, token, audience, nonce string) (*auth.Identity, error) {
+	t, err := parseJWT(token)
+	if err != nil {
+		return nil, err
+	}
+	key, err := p.key(ctx, t.header.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.verify(key); err != nil {
+		return nil, err
+	}
+
+	claims := t.claims
+	if iss, _ := claims["iss"].(string); iss != p.options.Issuer {
+		return nil, fmt.Errorf("%w: issued by %q", ErrInvalidToken, iss)
+	}
+	if !hasAudience(claims["aud"], audience) {
+		return nil, fmt.Errorf("%w: not issued for %s", ErrInvalidToken, audience)
+	}
+	now := p.now()
+	exp, ok := claims["exp"].(float64)
+	if !ok || now.After(time.Unix(int64(exp), 0).Add(clockSkew)) {
+		return nil, fmt.Errorf("%w: expired", ErrInvalidToken)
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(clockSkew).Before(time.Unix(int64(nbf), 0)) {
+		return nil, fmt.Errorf("%w: not valid yet", ErrInvalidToken)
+	}
+	if nonce != "" {
+		if given, _ := claims["nonce"].(string); given != nonce {
+			return nil, fmt.Errorf("%w: nonce does not match", ErrInvalidToken)
+		}
+	}
+
+	id := &auth.Identity{Issuer: p.options.Issuer, ExpiresAt: time.Unix(int64(exp), 0).UTC()}
+	id.Subject, _ = claims["sub"].(string)
+	id.Email, _ = claims["email"].(string)
+	if id.Subject == "" {
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidToken)
+	}
+	id.User, _ = claims[p.options.UserClaim].(string)
+	if id.User == "" {
+		id.User = id.Subject
+	}
+	id.Groups = stringList(claims[p.options.GroupsClaim])
+	id.Role = p.role(id.Groups)
+	return id, nil
+}
+
+// role returns the role of a user in groups
+func (p *Provider) role(groups []string) auth.Role {
+	roles := []auth.Role{p.options.DefaultRole}
+	for _, g := range groups {
+		roles = append(roles, p.options.Roles[g])
+	}
+	return auth.Highest(roles...)
+}
+
+// hasAudience reports whether an aud claim, a string or list, names an audience
+func hasAudience(aud interface{}, audience string) bool {
+	for _, a := range stringList(aud) {
+		if a == audience {
+			return true
+		}
+	}
+	return false
+}
+
+// stringList returns the strings of a claim that is a string or a list
+func stringList(claim interface{}) []string {
+	switch v := claim.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+// key returns a signing key of the provider, fetching the keys again for
+// unknown key IDs at most once per keyRefreshInterval
+func (p *Provider) key(ctx context.Context, id string) (crypto.PublicKey, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if key, ok := p.lookup(id); ok {
+		return key, nil
+	}
+	if p.keys != nil && p.now().Sub(p.keysFetched) < keyRefreshInterval {
+		return nil, fmt.Errorf("%w: unknown key %q", ErrInvalidToken, id)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := getJSON(ctx, p.options.HTTPClient, p.jwksURI, &set); err != nil {
+		return nil, fmt.Errorf("failed to fetch the keys of %s: %w", p.options.Issuer, err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			continue // Keys of unsupported types are not used
+		}
+		keys[k.KeyID] = key
+	}
+	p.keys, p.keysFetched = keys, p.now()
+
+	if key, ok := p.lookup(id); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: unknown key %q", ErrInvalidToken, id)
+}
+
+// lookup finds a key by ID; tokens without an ID need a single key
+func (p *Provider) lookup(id string) (crypto.PublicKey, bool) {
+	if id == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[id]
+	return key, ok
+}
@@ -0,0 +1,221 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/auth"
+)
+
+// testIssuer is a fake identity provider signing tokens with an RSA and an
+// EC key
+type testIssuer struct {
+	server   *httptest.Server
+	rsaKey   *rsa.PrivateKey
+	ecKey    *ecdsa.PrivateKey
+	code     string // Authorization code the token endpoint accepts
+	idToken  string // ID token it returns for the code
+	keyFetch int
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ti := &testIssuer{rsaKey: rsaKey, ecKey: ecKey}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 ti.server.URL,
+			"authorization_endpoint": ti.server.URL + "/authorize",
+			"token_endpoint":         ti.server.URL + "/token",
+			"jwks_uri":               ti.server.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		ti.keyFetch++
+		b64 := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa-1", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+			{"kty": "EC", "kid": "ec-1", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+			{"kty": "oct", "kid": "hmac-1", "k": "c2VjcmV0"},
+		}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if user, pass, _ := r.BasicAuth(); user != "dt" || pass != "s3cret" || r.Form.Get("code") != ti.code {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": ti.idToken, "token_type": "Bearer"})
+	})
+	ti.server = httptest.NewServer(mux)
+	t.Cleanup(ti.server.Close)
+	return ti
+}
+
+// sign returns a token with claims, filling in the issuer and expiry
+func (ti *testIssuer) sign(alg, kid string, claims map[string]interface{}) string {
+	if _, ok := claims["iss"]; !ok {
+		claims["iss"] = ti.server.URL
+	}
+	if _, ok := claims["exp"]; !ok {
+		claims["exp"] = time.Now().Add(time.Hour).Unix()
+	}
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	switch alg {
+	case "RS256":
+		signature, _ = rsa.SignPKCS1v15(rand.Reader, ti.rsaKey, crypto.SHA256, digest[:])
+	case "PS256":
+		signature, _ = rsa.SignPSS(rand.Reader, ti.rsaKey, crypto.SHA256, digest[:], nil)
+	case "ES256":
+		r, s, _ := ecdsa.Sign(rand.Reader, ti.ecKey, digest[:])
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func (ti *testIssuer) provider(t *testing.T) *Provider {
+	p, err := NewProvider(context.Background(), Options{
+		Issuer:       ti.server.URL,
+		ClientID:     "dt",
+		ClientSecret: "s3cret",
+		RedirectURL:  "https://dt.example.com/auth/callback",
+		Audience:     "dt-api",
+		Roles:        map[string]auth.Role{"plant-operators": auth.RoleEditor, "plant-admins": auth.RoleAdmin},
+		DefaultRole:  auth.RoleViewer,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+	return p
+}
+
+func TestVerify(t *testing.T) {
+	ti := newTestIssuer(t)
+	p := ti.provider(t)
+	ctx := context.Background()
+
+	for _, alg := range []string{"RS256", "PS256", "ES256"} {
+		kid := "rsa-1"
+		if alg == "ES256" {
+			kid = "ec-1"
+		}
+		token := ti.sign(alg, kid, map[string]interface{}{
+			"sub": "u-42", "email": "alice@example.com", "aud": []string{"dt-api", "other"},
+			"groups": []string{"plant-operators", "visitors"},
+		})
+		id, err := p.Verify(ctx, token)
+		if err != nil {
+			t.Fatalf("%s: failed to verify: %v", alg, err)
+		}
+		if id.User != "alice@example.com" || id.Subject != "u-42" || id.Role != auth.RoleEditor || len(id.Groups) != 2 {
+			t.Errorf("%s: unexpected identity %+v", alg, id)
+		}
+	}
+
+	// Users in no mapped group get the default role, and the subject names
+	// users without an email
+	id, err := p.Verify(ctx, ti.sign("RS256", "rsa-1", map[string]interface{}{"sub": "svc-7", "aud": "dt-api"}))
+	if err != nil || id.Role != auth.RoleViewer || id.User != "svc-7" {
+		t.Errorf("Unexpected identity %+v %v", id, err)
+	}
+
+	valid := ti.sign("RS256", "rsa-1", map[string]interface{}{"sub": "u-42", "aud": "dt-api"})
+	for name, token := range map[string]string{
+		"wrong audience":  ti.sign("RS256", "rsa-1", map[string]interface{}{"sub": "u-42", "aud": "dt"}),
+		"wrong issuer":    ti.sign("RS256", "rsa-1", map[string]interface{}{"sub": "u-42", "aud": "dt-api", "iss": "https://evil.example.com"}),
+		"expired":         ti.sign("RS256", "rsa-1", map[string]interface{}{"sub": "u-42", "aud": "dt-api", "exp": time.Now().Add(-time.Hour).Unix()}),
+		"not yet valid":   ti.sign("RS256", "rsa-1", map[string]interface{}{"sub": "u-42", "aud": "dt-api", "nbf": time.Now().Add(time.Hour).Unix()}),
+		"no subject":      ti.sign("RS256", "rsa-1", map[string]interface{}{"aud": "dt-api"}),
+		"wrong key":       ti.sign("RS256", "ec-1", map[string]interface{}{"sub": "u-42", "aud": "dt-api"}),
+		"symmetric":       strings.Replace(valid, strings.Split(valid, ".")[0], base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","kid":"hmac-1"}`)), 1),
+		"tampered":        valid[:len(valid)-4] + "AAAA",
+		"malformed":       "not-a-token",
+		"unsigned":        strings.Split(valid, ".")[0] + "." + strings.Split(valid, ".")[1] + ".",
+		"unknown key":     ti.sign("RS256", "rsa-2", map[string]interface{}{"sub": "u-42", "aud": "dt-api"}),
+		"no key with alg": ti.sign("ES256", "rsa-1", map[string]interface{}{"sub": "u-42", "aud": "dt-api"}),
+	} {
+		if _, err := p.Verify(ctx, token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: expected ErrInvalidToken, got %v", name, err)
+		}
+	}
+
+	// Unknown keys do not make every request fetch the keys again
+	if ti.keyFetch != 1 {
+		t.Errorf("Expected the keys to be fetched once, got %d", ti.keyFetch)
+	}
+}
+
+func TestCodeFlow(t *testing.T) {
+	ti := newTestIssuer(t)
+	p := ti.provider(t)
+	ctx := context.Background()
+
+	if !p.CanLogin() {
+		t.Fatal("Expected the provider to support login")
+	}
+	login := p.AuthCodeURL("state-1", "nonce-1")
+	for _, part := range []string{ti.server.URL + "/authorize?", "client_id=dt", "scope=openid+profile+email", "state=state-1", "nonce=nonce-1"} {
+		if !strings.Contains(login, part) {
+			t.Errorf("Expected %s in the login URL %s", part, login)
+		}
+	}
+
+	ti.code = "code-1"
+	ti.idToken = ti.sign("RS256", "rsa-1", map[string]interface{}{"sub": "u-42", "aud": "dt", "nonce": "nonce-1", "groups": []string{"plant-admins"}})
+	token, err := p.Exchange(ctx, "code-1")
+	if err != nil {
+		t.Fatalf("Failed to exchange code: %v", err)
+	}
+	id, err := p.VerifyIDToken(ctx, token, "nonce-1")
+	if err != nil || id.Role != auth.RoleAdmin {
+		t.Errorf("Unexpected identity %+v %v", id, err)
+	}
+
+	if _, err := p.VerifyIDToken(ctx, token, "nonce-2"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected a nonce mismatch to be rejected, got %v", err)
+	}
+	if _, err := p.Verify(ctx, token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected the ID token not to be accepted as an API token, got %v", err)
+	}
+	if _, err := p.Exchange(ctx, "code-2"); !errors.Is(err, ErrExchangeFailed) {
+		t.Errorf("Expected ErrExchangeFailed, got %v", err)
+	}
+}
+
+func TestNewProviderInvalid(t *testing.T) {
+	ti := newTestIssuer(t)
+	ctx := context.Background()
+
+	for _, options := range []Options{
+		{ClientID: "dt"},
+		{Issuer: ti.server.URL},
+		{Issuer: ti.server.URL, ClientID: "dt", Roles: map[string]auth.Role{"ops": "root"}},
+		{Issuer: ti.server.URL + "/", ClientID: "dt"},
+	} {
+		if _, err := NewProvider(ctx, options); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("%+v: expected ErrInvalidOptions, got %v", options, err)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	goplugin "plugin"
+	"sync"
+
+	"github.com/aleka07/go-digital-twin/pkg/eventbus"
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// Common errors
+var (
+	ErrUnhandled           = errors.New("command not handled")
+	ErrPluginAlreadyExists = errors.New("plugin already exists")
+	ErrInvalidPlugin       = errors.New("invalid plugin")
+)
+
+// SymbolName is the exported symbol a Go plugin package must define.
+// It must be a variable whose type implements TwinPlugin, e.g.
+//
+//	var Plugin oeePlugin
+const SymbolName = "Plugin"
+
+// PropertyChange describes changed properties of a twin feature
+type PropertyChange struct {
+	FeatureID  string
+	Properties map[string]interface{}
+}
+
+// Command is a request to perform an operation on a twin
+type Command struct {
+	Name      string      `json:"name"`
+	FeatureID string      `json:"featureId,omitempty"`
+	Payload   interface{} `json:"payload,omitempty"`
+}
+
+// TwinPlugin embeds custom domain logic into the server.
+// Hooks are called from a single event loop, so a slow hook delays all plugins.
+// Plugins that change twins from a hook must take care not to trigger themselves endlessly.
+type TwinPlugin interface {
+	// Name identifies the plugin
+	Name() string
+	// OnCreate is called after a twin has been created
+	OnCreate(dt *twin.DigitalTwin) error
+	// OnPropertyChange is called after properties of a twin feature have changed
+	OnPropertyChange(dt *twin.DigitalTwin, change PropertyChange) error
+	// OnCommand handles a command sent to a twin. Plugins return ErrUnhandled
+	// for commands they do not implement.
+	OnCommand(dt *twin.DigitalTwin, cmd Command) (interface{}, error)
+}
+
+// Base is a no-op TwinPlugin implementation to embed in plugins that only need some hooks
+type Base struct{}
+
+// OnCreate does nothing
+func (Base) OnCreate(dt *twin.DigitalTwin) error { return nil }
+
+// OnPropertyChange does nothing
+func (Base) OnPropertyChange(dt *twin.DigitalTwin, change PropertyChange) error { return nil }
+
+// OnCommand handles no commands
+func (Base) OnCommand(dt *twin.DigitalTwin, cmd Command) (interface{}, error) {
+	return nil, ErrUnhandled
+}
+
+// Compile-time registration, in the style of database/sql drivers
+var (
+	registered   []TwinPlugin
+	registeredMu sync.Mutex
+)
+
+// Register makes a plugin available to all servers created afterwards.
+// It is meant to be called from the init function of the package implementing the plugin.
+func Register(p TwinPlugin) {
+	registeredMu.Lock()
+	defer registeredMu.Unlock()
+
+	registered = append(registered, p)
+}
+
+// Registered returns the plugins registered at compile time
+func Registered() []TwinPlugin {
+	registeredMu.Lock()
+	defer registeredMu.Unlock()
+
+	return append([]TwinPlugin(nil), registered...)
+}
+
+// Load opens a Go plugin package built with -buildmode=plugin and returns its TwinPlugin
+func Load(path string) (TwinPlugin, error) {
+	p, err := goplugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	sym, err := p.Lookup(SymbolName)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPlugin, err)
+	}
+
+	// Lookup returns a pointer to the exported variable
+	switch v := sym.(type) {
+	case TwinPlugin:
+		return v, nil
+	case *TwinPlugin:
+		return *v, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s in %s does not implement TwinPlugin", ErrInvalidPlugin, SymbolName, path)
+}
+
+// Error records a failed plugin hook
+type Error struct {
+	Plugin string
+	Hook   string
+	TwinID string
+	Err    error
+}
+
+// Error implements the error interface
+func (e *Error) Error() string {
+	return fmt.Sprintf("plugin %s: %s for twin %s: %v", e.Plugin, e.Hook, e.TwinID, e.Err)
+}
+
+// Unwrap returns the error returned by the hook
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Manager dispatches twin events and commands to plugins
+type Manager struct {
+	registry *registry.Registry
+	plugins  []TwinPlugin
+	errors   chan *Error
+	mutex    sync.RWMutex
+}
+
+// NewManager creates a plugin manager with the plugins registered at compile time
+func NewManager(reg *registry.Registry) *Manager {
+	m := &Manager{
+		registry: reg,
+		errors:   make(chan *Error, 100),
+	}
+	for _, p := range Registered() {
+		m.Add(p)
+	}
+	return m
+}
+
+// Add adds a plugin to the manager
+func (m *Manager) Add(p TwinPlugin) error {
+	if p == nil || p.Name() == "" {
+		return fmt.Errorf("%w: plugin must have a name", ErrInvalidPlugin)
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, existing := range m.plugins {
+		if existing.Name() == p.Name() {
+			return ErrPluginAlreadyExists
+		}
+	}
+
+	m.plugins = append(m.plugins, p)
+	return nil
+}
+
+// Names returns the names of all plugins in the order they are called
+func (m *Manager) Names() []string {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	names := make([]string, len(m.plugins))
+	for i, p := range m.plugins {
+		names[i] = p.Name()
+	}
+	return names
+}
+
+// Errors returns a channel of failed hooks. Errors are dropped when nobody reads them.
+func (m *Manager) Errors() <-chan *Error {
+	return m.errors
+}
+
+// Command sends a command to the plugins in order until one handles it.
+// It returns ErrUnhandled if no plugin handles the command.
+func (m *Manager) Command(twinID string, cmd Command) (interface{}, error) {
+	dt, err := m.registry.Get(twinID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range m.snapshot() {
+		result, err := p.OnCommand(dt, cmd)
+		if errors.Is(err, ErrUnhandled) {
+			continue
+		}
+		if err != nil {
+			return nil, &Error{Plugin: p.Name(), Hook: "OnCommand", TwinID: twinID, Err: err}
+		}
+		return result, nil
+	}
+
+	return nil, ErrUnhandled
+}
+
+// HandleEvent calls the plugin hooks for twin creation and property change events
+func (m *Manager) HandleEvent(msg messaging_sim.Message) {
+	twinID := msg.TwinID()
+	var change PropertyChange
+
+	switch msg.Topic {
+	case "twin.created":
+	case "property.updated":
+		payload, ok := msg.Payload.(map[string]interface{})
+		if !ok {
+			return
+		}
+		change.FeatureID, _ = payload["featureId"].(string)
+		key, _ := payload["propertyKey"].(string)
+		change.Properties = map[string]interface{}{key: payload["value"]}
+	case "properties.updated":
+		u, ok := eventbus.PropertiesOf(msg.Payload)
+		if !ok {
+			return
+		}
+		change.FeatureID, change.Properties = u.FeatureID, u.Properties
+	default:
+		return
+	}
+
+	dt, err := m.registry.Get(twinID)
+	if err != nil {
+		return
+	}
+
+	for _, p := range m.snapshot() {
+		hook := "OnCreate"
+		if msg.Topic == "twin.created" {
+			err = p.OnCreate(dt)
+		} else {
+			hook = "OnPropertyChange"
+			err = p.OnPropertyChange(dt, change)
+		}
+
+		if err != nil {
+			m.report(&Error{Plugin: p.Name(), Hook: hook, TwinID: twinID, Err: err})
+		}
+	}
+}
+
+// Run calls plugin hooks for events from a subscription until the channel is closed
+func (m *Manager) Run(events <-chan messaging_sim.Message) {
+	for msg := range events {
+		m.HandleEvent(msg)
+	}
+}
+
+// snapshot returns the current plugins
+func (m *Manager) snapshot() []TwinPlugin {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return append([]TwinPlugin(nil), m.plugins...)
+}
+
+// report publishes a hook error without blocking
+func (m *Manager) report(err *Error) {
+	select {
+	case m.errors <- err:
+	default:
+	}
+}
@@ -0,0 +1,130 @@
+package plugin
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// counterPlugin counts hook calls and handles the "reset" command
+type counterPlugin struct {
+	Base
+	created int
+	changes []PropertyChange
+}
+
+func (p *counterPlugin) Name() string { return "counter" }
+
+func (p *counterPlugin) OnCreate(dt *twin.DigitalTwin) error {
+	p.created++
+	return nil
+}
+
+func (p *counterPlugin) OnPropertyChange(dt *twin.DigitalTwin, change PropertyChange) error {
+	p.changes = append(p.changes, change)
+	if change.FeatureID == "broken" {
+		return errors.New("cannot handle broken feature")
+	}
+	return nil
+}
+
+func (p *counterPlugin) OnCommand(dt *twin.DigitalTwin, cmd Command) (interface{}, error) {
+	if cmd.Name != "reset" {
+		return nil, ErrUnhandled
+	}
+	p.changes = nil
+	return map[string]string{"status": "reset"}, nil
+}
+
+// namedPlugin only implements the name
+type namedPlugin struct {
+	Base
+	name string
+}
+
+func (p namedPlugin) Name() string { return p.name }
+
+func TestManagerHooks(t *testing.T) {
+	reg := registry.NewRegistry()
+	reg.Create(twin.NewDigitalTwin("machine-1", "machine"))
+
+	m := NewManager(reg)
+	p := &counterPlugin{}
+	if err := m.Add(p); err != nil {
+		t.Fatalf("Failed to add plugin: %v", err)
+	}
+
+	if err := m.Add(&counterPlugin{}); err != ErrPluginAlreadyExists {
+		t.Errorf("Expected ErrPluginAlreadyExists, got %v", err)
+	}
+
+	m.HandleEvent(messaging_sim.Message{Topic: "twin.created", Payload: map[string]string{"id": "machine-1"}})
+	m.HandleEvent(messaging_sim.Message{Topic: "property.updated", Payload: map[string]interface{}{
+		"twinId": "machine-1", "featureId": "counter", "propertyKey": "parts", "value": 10.0,
+	}})
+	m.HandleEvent(messaging_sim.Message{Topic: "properties.updated", Payload: map[string]interface{}{
+		"twinId": "machine-1", "featureId": "broken", "properties": map[string]interface{}{"a": 1.0},
+	}})
+
+	// Events for unknown twins are ignored
+	m.HandleEvent(messaging_sim.Message{Topic: "twin.created", Payload: map[string]string{"id": "unknown"}})
+
+	if p.created != 1 {
+		t.Errorf("Expected OnCreate to be called once, got %d", p.created)
+	}
+
+	if len(p.changes) != 2 || p.changes[0].Properties["parts"] != 10.0 {
+		t.Errorf("Unexpected property changes: %v", p.changes)
+	}
+
+	select {
+	case err := <-m.Errors():
+		if err.Plugin != "counter" || err.Hook != "OnPropertyChange" || err.TwinID != "machine-1" {
+			t.Errorf("Unexpected hook error: %v", err)
+		}
+	default:
+		t.Error("Expected hook error to be reported")
+	}
+}
+
+func TestManagerCommand(t *testing.T) {
+	reg := registry.NewRegistry()
+	reg.Create(twin.NewDigitalTwin("machine-1", "machine"))
+
+	m := NewManager(reg)
+	m.Add(namedPlugin{name: "noop"})
+	m.Add(&counterPlugin{})
+
+	result, err := m.Command("machine-1", Command{Name: "reset"})
+	if err != nil {
+		t.Fatalf("Failed to run command: %v", err)
+	}
+
+	if result.(map[string]string)["status"] != "reset" {
+		t.Errorf("Unexpected command result: %v", result)
+	}
+
+	if _, err := m.Command("machine-1", Command{Name: "explode"}); err != ErrUnhandled {
+		t.Errorf("Expected ErrUnhandled, got %v", err)
+	}
+
+	if _, err := m.Command("unknown", Command{Name: "reset"}); err != registry.ErrTwinNotFound {
+		t.Errorf("Expected ErrTwinNotFound, got %v", err)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	Register(namedPlugin{name: "compiled-in"})
+
+	m := NewManager(registry.NewRegistry())
+	if names := m.Names(); len(names) != 1 || names[0] != "compiled-in" {
+		t.Errorf("Expected registered plugin, got %v", names)
+	}
+
+	if _, err := Load("/nonexistent/plugin.so"); err == nil {
+		t.Error("Expected error loading missing plugin")
+	}
+}
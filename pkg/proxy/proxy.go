@@ -0,0 +1,353 @@
+// Package proxy spreads twins over several dt_server backends. Requests to
+// a twin are routed to the backend its ID hashes to, and twin listings are
+// sent to every backend and merged, so that clients see one server. Each
+// backend stores its share of the twins independently; there is no
+// replication or consensus between them.
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Common errors
+var (
+	ErrInvalidOptions = errors.New("invalid proxy options")
+)
+
+// DefaultTimeout bounds the requests of a merged listing to each backend
+const DefaultTimeout = 30 * time.Second
+
+// maxBody bounds request bodies read to find the ID of a new twin and the
+// listings of each backend kept in memory
+const maxBody = 16 << 20
+
+// apiPrefix is the path prefix of the versioned API; the unversioned legacy
+// paths are routed the same way
+const apiPrefix = "/api/v1"
+
+// listingPaths are paths under /twins that list twins or run across twins,
+// rather than address a twin with that ID
+var listingPaths = map[string]bool{
+	"read-transaction": true,
+	"export.csv":       true,
+	"watch":            true,
+	"query":            true,
+	"by-external-id":   true,
+}
+
+// Router picks the backend, or shard, of a twin ID out of shards backends
+type Router interface {
+	Shard(id string, shards int) int
+}
+
+// RouterFunc adapts a function to a Router
+type RouterFunc func(id string, shards int) int
+
+// Shard calls f
+func (f RouterFunc) Shard(id string, shards int) int {
+	return f(id, shards)
+}
+
+// HashRouter routes twins by the FNV-1a hash of their ID. Changing the
+// number of backends moves most twins, which the proxy does not migrate.
+var HashRouter Router = RouterFunc(func(id string, shards int) int {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return int(h.Sum32() % uint32(shards))
+})
+
+// Options configure a proxy
+type Options struct {
+	Backends []string      // Server URLs of the backends, e.g. http://10.0.0.1:8080
+	Router   Router        // Routes twin IDs to backends, HashRouter when nil
+	Timeout  time.Duration // Bounds the requests of merged listings, DefaultTimeout when zero
+}
+
+// backend is a dt_server instance the proxy routes to
+type backend struct {
+	url     *url.URL
+	reverse *httputil.ReverseProxy
+}
+
+// Proxy routes twin requests to backends
+type Proxy struct {
+	opts     Options
+	backends []*backend
+	client   *http.Client
+}
+
+// New creates a proxy for the backends of the options
+func New(opts Options) (*Proxy, error) {
+	if len(opts.Backends) == 0 {
+		return nil, fmt.Errorf("%w: at least one backend is required", ErrInvalidOptions)
+	}
+	if opts.Timeout < 0 {
+		return nil, fmt.Errorf("%w: timeout must not be negative", ErrInvalidOptions)
+	}
+	if opts.Router == nil {
+		opts.Router = HashRouter
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = DefaultTimeout
+	}
+
+	p := &Proxy{opts: opts, client: &http.Client{Timeout: opts.Timeout}}
+	for _, raw := range opts.Backends {
+		u, err := url.Parse(strings.TrimSuffix(raw, "/"))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("%w: backend %q must be an http or https URL", ErrInvalidOptions, raw)
+		}
+		b := &backend{url: u, reverse: httputil.NewSingleHostReverseProxy(u)}
+		b.reverse.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+			respondError(w, http.StatusBadGateway, fmt.Sprintf("Backend %s is unavailable: %v", u.Host, err))
+		}
+		p.backends = append(p.backends, b)
+	}
+	return p, nil
+}
+
+// Backend returns the URL of the backend serving a twin
+func (p *Proxy) Backend(id string) string {
+	return p.route(id).url.String()
+}
+
+// route returns the backend serving a twin
+func (p *Proxy) route(id string) *backend {
+	shard := p.opts.Router.Shard(id, len(p.backends))
+	if shard < 0 || shard >= len(p.backends) {
+		shard = 0
+	}
+	return p.backends[shard]
+}
+
+// ServeHTTP routes twin requests and rejects all others with
+// 501 Not Implemented
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		respondError(w, http.StatusNotImplemented, "Not supported by the proxy: "+r.Method+" "+r.URL.Path)
+	})).ServeHTTP(w, r)
+}
+
+// Middleware routes twin requests to the backends and passes all other
+// requests to next:
+//
+//   - requests to a twin, /twins/{id} and below, go to the twin's backend
+//   - POST /twins goes to the backend of the ID in the body
+//   - POST /twins/{id}/rename and merge go to the twin's backend if the
+//     new or merged ID routes to it as well; twins are not moved between
+//     backends
+//   - GET /twins goes to every backend and the listings are merged
+//
+// Requests across twins, such as /twins/watch or transactions, are passed
+// to next as well.
+func (p *Proxy) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rest, ok := strings.CutPrefix(strings.TrimPrefix(r.URL.EscapedPath(), apiPrefix), "/twins")
+		if !ok || (rest != "" && rest[0] != '/') {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		segment, below, _ := strings.Cut(strings.Trim(rest, "/"), "/")
+		id, err := url.PathUnescape(segment)
+		switch {
+		case err != nil:
+			respondError(w, http.StatusBadRequest, "Invalid twin ID: "+segment)
+		case id == "" && r.Method == http.MethodPost:
+			p.create(w, r)
+		case below == "rename" && r.Method == http.MethodPost:
+			p.pair(w, r, id, "id", "renaming")
+		case below == "merge" && r.Method == http.MethodPost:
+			p.pair(w, r, id, "source", "merging")
+		case id == "" && r.Method == http.MethodGet:
+			p.list(w, r)
+		case id == "" || listingPaths[id]:
+			next.ServeHTTP(w, r)
+		default:
+			p.route(id).reverse.ServeHTTP(w, r)
+		}
+	})
+}
+
+// create forwards the creation of a twin to the backend of its ID
+func (p *Proxy) create(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBody))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	var req struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	p.route(req.ID).reverse.ServeHTTP(w, r)
+}
+
+// pair forwards a request involving a second twin, named by a field of the
+// body, to the backend of the twin, provided that both twins route to it
+func (p *Proxy) pair(w http.ResponseWriter, r *http.Request, id, field, action string) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBody))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	var req map[string]interface{}
+	if err := json.Unmarshal(body, &req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	b := p.route(id)
+	if other, _ := req[field].(string); other != "" && p.route(other) != b {
+		respondError(w, http.StatusNotImplemented, "Not supported by the proxy: "+action+" "+id+" and "+other+" on different backends")
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	b.reverse.ServeHTTP(w, r)
+}
+
+// listing is the response of a backend to a twin listing
+type listing struct {
+	status int
+	body   []byte
+	twins  []json.RawMessage
+	err    error
+}
+
+// listedTwin holds the fields a merged listing is ordered by
+type listedTwin struct {
+	ID         string    `json:"id"`
+	ModifiedAt time.Time `json:"modifiedAt"`
+}
+
+// list sends a twin listing to every backend and merges the listings. They
+// are ordered by ID, or by modification time when filtered by time like the
+// listings of a single server. Pages cannot be merged, so paginated
+// listings are rejected. If a backend fails, so does the listing, rather
+// than leaving its twins out.
+func (p *Proxy) list(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	if params.Has("limit") || params.Has("cursor") {
+		respondError(w, http.StatusBadRequest, "Paginated listings are not supported by the proxy")
+		return
+	}
+
+	listings := make([]listing, len(p.backends))
+	var wg sync.WaitGroup
+	for i, b := range p.backends {
+		wg.Add(1)
+		go func(i int, b *backend) {
+			defer wg.Done()
+			listings[i] = p.fetchListing(r, b)
+		}(i, b)
+	}
+	wg.Wait()
+
+	var twins []json.RawMessage
+	for i, l := range listings {
+		if l.err != nil {
+			respondError(w, http.StatusBadGateway, fmt.Sprintf("Backend %s is unavailable: %v", p.backends[i].url.Host, l.err))
+			return
+		}
+		if l.status != http.StatusOK {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(l.status)
+			w.Write(l.body)
+			return
+		}
+		twins = append(twins, l.twins...)
+	}
+
+	keys := make([]listedTwin, len(twins))
+	for i, raw := range twins {
+		json.Unmarshal(raw, &keys[i])
+	}
+	byTime := params.Has("modifiedSince") || params.Has("modifiedBefore") || params.Has("createdSince")
+	order := make([]int, len(twins))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		ka, kb := keys[order[a]], keys[order[b]]
+		if byTime && !ka.ModifiedAt.Equal(kb.ModifiedAt) {
+			return ka.ModifiedAt.Before(kb.ModifiedAt)
+		}
+		return ka.ID < kb.ID
+	})
+
+	merged := make([]json.RawMessage, len(twins))
+	for i, j := range order {
+		merged[i] = twins[j]
+	}
+	respondJSON(w, http.StatusOK, merged)
+}
+
+// fetchListing sends a twin listing to a backend
+func (p *Proxy) fetchListing(r *http.Request, b *backend) listing {
+	target := *b.url
+	target.Path = b.url.Path + r.URL.Path
+	target.RawQuery = r.URL.RawQuery
+
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, target.String(), nil)
+	if err != nil {
+		return listing{err: err}
+	}
+	for k, v := range r.Header {
+		if k != "Accept-Encoding" && k != "Connection" {
+			req.Header[k] = v
+		}
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return listing{err: err}
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBody))
+	if err != nil {
+		return listing{err: err}
+	}
+	l := listing{status: resp.StatusCode, body: body}
+	if resp.StatusCode == http.StatusOK {
+		if err := json.Unmarshal(body, &l.twins); err != nil {
+			return listing{err: fmt.Errorf("invalid listing: %v", err)}
+		}
+	}
+	return l
+}
+
+// respondJSON sends a JSON response
+func respondJSON(w http.ResponseWriter, status int, data interface{}) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// respondError sends an error response in the format of the backends
+func respondError(w http.ResponseWriter, status int, message string) {
+	respondJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,170 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/api"
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+)
+
+func TestProxy(t *testing.T) {
+	var registries []*registry.Registry
+	var backends []string
+	for i := 0; i < 3; i++ {
+		reg := registry.NewRegistry()
+		pubsub := messaging_sim.NewPubSub()
+		t.Cleanup(pubsub.Close)
+		backend := httptest.NewServer(api.NewServer(reg, pubsub).Router)
+		t.Cleanup(backend.Close)
+		registries = append(registries, reg)
+		backends = append(backends, backend.URL)
+	}
+	p, err := New(Options{Backends: backends})
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v", err)
+	}
+	ts := httptest.NewServer(p)
+	defer ts.Close()
+
+	do := func(method, path, body string) (*http.Response, string) {
+		req, _ := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp, string(data)
+	}
+
+	ids := []string{"pump-1", "pump-2", "pump-3", "pump-4", "pump-5", "valve-1"}
+	for _, id := range ids {
+		resp, body := do("POST", "/api/v1/twins", `{"id": "`+id+`", "type": "pump"}`)
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("Failed to create %s: %d %s", id, resp.StatusCode, body)
+		}
+	}
+
+	// Each twin is stored by the backend its ID routes to only
+	for _, id := range ids {
+		shard := HashRouter.Shard(id, len(backends))
+		for i, reg := range registries {
+			if _, err := reg.Get(id); (err == nil) != (i == shard) {
+				t.Errorf("%s: expected to be stored on backend %d only, found on %d: %v", id, shard, i, err == nil)
+			}
+		}
+		if p.Backend(id) != backends[shard] {
+			t.Errorf("%s: expected backend %s, got %s", id, backends[shard], p.Backend(id))
+		}
+	}
+
+	if resp, body := do("PUT", "/api/v1/twins/pump-3/attributes/site", `"north"`); resp.StatusCode >= 300 {
+		t.Fatalf("Failed to update pump-3: %d %s", resp.StatusCode, body)
+	}
+	resp, body := do("GET", "/api/v1/twins/pump-3/attributes/site", "")
+	if resp.StatusCode != http.StatusOK || strings.TrimSpace(body) != `"north"` {
+		t.Errorf("Expected the attribute of pump-3, got %d %s", resp.StatusCode, body)
+	}
+
+	// Listings and queries are merged in ID order
+	var twins []api.Twin
+	resp, body = do("GET", "/api/v1/twins", "")
+	json.Unmarshal([]byte(body), &twins)
+	if resp.StatusCode != http.StatusOK || len(twins) != len(ids) {
+		t.Fatalf("Expected %d twins, got %d %s", len(ids), resp.StatusCode, body)
+	}
+	for i, dt := range twins {
+		if dt.ID != ids[i] {
+			t.Errorf("Expected %s at %d, got %s", ids[i], i, dt.ID)
+		}
+	}
+	resp, body = do("GET", "/twins?query=attributes.site+%3D%3D+north", "")
+	twins = nil
+	json.Unmarshal([]byte(body), &twins)
+	if resp.StatusCode != http.StatusOK || len(twins) != 1 || twins[0].ID != "pump-3" {
+		t.Errorf("Expected pump-3, got %d %s", resp.StatusCode, body)
+	}
+
+	for _, tc := range []struct {
+		method, path, body string
+		code               int
+	}{
+		{"GET", "/api/v1/twins?query=type+%3D%3D", "", http.StatusBadRequest},
+		{"GET", "/api/v1/twins?limit=2", "", http.StatusBadRequest},
+		{"POST", "/api/v1/twins", `{"id": `, http.StatusBadRequest},
+		{"POST", "/api/v1/twins", `{"id": "pump-1", "type": "pump"}`, http.StatusConflict},
+		{"GET", "/api/v1/twins/missing", "", http.StatusNotFound},
+		{"GET", "/api/v1/twins/watch", "", http.StatusNotImplemented},
+		{"GET", "/api/v1/twins/by-external-id/erp/4711", "", http.StatusNotImplemented},
+		{"GET", "/api/v1/indexes", "", http.StatusNotImplemented},
+	} {
+		if resp, body := do(tc.method, tc.path, tc.body); resp.StatusCode != tc.code {
+			t.Errorf("%s %s: expected status code %d, got %d %s", tc.method, tc.path, tc.code, resp.StatusCode, body)
+		}
+	}
+
+	// Twins are renamed on their backend, but not moved to another one
+	var same, other string
+	for i := 0; same == "" || other == ""; i++ {
+		id := fmt.Sprintf("pump-1-%d", i)
+		if p.Backend(id) == p.Backend("pump-1") {
+			same = id
+		} else {
+			other = id
+		}
+	}
+	if resp, body := do("POST", "/api/v1/twins/pump-1/rename", `{"id": "`+other+`"}`); resp.StatusCode != http.StatusNotImplemented {
+		t.Errorf("Expected renaming across backends to be rejected, got %d %s", resp.StatusCode, body)
+	}
+	if resp, body := do("POST", "/api/v1/twins/pump-1/rename", `{"id": "`+same+`"}`); resp.StatusCode != http.StatusOK {
+		t.Fatalf("Failed to rename pump-1: %d %s", resp.StatusCode, body)
+	}
+	if resp, body := do("GET", "/api/v1/twins/"+same, ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected %s, got %d %s", same, resp.StatusCode, body)
+	}
+	if resp, body := do("POST", "/api/v1/twins/"+same+"/merge", `{"source": "`+other+`"}`); resp.StatusCode != http.StatusNotImplemented {
+		t.Errorf("Expected merging across backends to be rejected, got %d %s", resp.StatusCode, body)
+	}
+}
+
+func TestProxyBackendDown(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("[]"))
+	}))
+	defer up.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	p, _ := New(Options{
+		Backends: []string{up.URL, down.URL},
+		Router:   RouterFunc(func(id string, shards int) int { return 1 }),
+	})
+	for _, path := range []string{"/api/v1/twins", "/api/v1/twins/pump-1"} {
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusBadGateway {
+			t.Errorf("%s: expected status code %d, got %d", path, http.StatusBadGateway, w.Code)
+		}
+	}
+}
+
+func TestNewInvalidOptions(t *testing.T) {
+	for _, opts := range []Options{
+		{},
+		{Backends: []string{"localhost:8080"}},
+		{Backends: []string{"http://localhost:8080"}, Timeout: -1},
+	} {
+		if _, err := New(opts); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("%+v: expected ErrInvalidOptions, got %v", opts, err)
+		}
+	}
+}
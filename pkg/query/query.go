@@ -0,0 +1,317 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// Common errors
+var (
+	ErrInvalidQuery = errors.New("invalid query")
+)
+
+// Operator is a comparison operator used in a condition
+type Operator string
+
+// Supported operators
+const (
+	OpEqual          Operator = "=="
+	OpNotEqual       Operator = "!="
+	OpGreater        Operator = ">"
+	OpGreaterOrEqual Operator = ">="
+	OpLess           Operator = "<"
+	OpLessOrEqual    Operator = "<="
+)
+
+// operators is ordered so that two-character operators are tried first
+var operators = []Operator{OpEqual, OpNotEqual, OpGreaterOrEqual, OpLessOrEqual, OpGreater, OpLess}
+
+// Condition compares the value at a twin path against a literal
+type Condition struct {
+	Path  string
+	Op    Operator
+	Value interface{}
+}
+
+// Query is a conjunction of conditions evaluated against digital twins
+type Query struct {
+	Conditions []Condition
+}
+
+// Parse parses a query of the form "path op value [and path op value ...]".
+// Values are parsed as numbers or booleans where possible, quoted strings have
+// their quotes removed and anything else is treated as a bare string.
+// An empty query matches every twin.
+func Parse(s string) (*Query, error) {
+	q := &Query{}
+
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return q, nil
+	}
+
+	for _, part := range splitAnd(s) {
+		cond, err := parseCondition(part)
+		if err != nil {
+			return nil, err
+		}
+		q.Conditions = append(q.Conditions, cond)
+	}
+
+	return q, nil
+}
+
+// String returns the query in the syntax accepted by Parse
+func (q *Query) String() string {
+	parts := make([]string, len(q.Conditions))
+	for i, c := range q.Conditions {
+		parts[i] = fmt.Sprintf("%s%s%s", c.Path, c.Op, formatValue(c.Value))
+	}
+	return strings.Join(parts, " and ")
+}
+
+// Matches reports whether a digital twin satisfies every condition of the query
+func (q *Query) Matches(dt *twin.DigitalTwin) bool {
+	for _, c := range q.Conditions {
+		if !c.Matches(dt) {
+			return false
+		}
+	}
+	return true
+}
+
+// Matches reports whether a digital twin satisfies the condition
+func (c Condition) Matches(dt *twin.DigitalTwin) bool {
+	val, exists := Lookup(dt, c.Path)
+	if !exists {
+		return c.Op == OpNotEqual
+	}
+	return Compare(val, c.Op, c.Value)
+}
+
+// Compare applies an operator to two values. Numbers are compared numerically
+// regardless of their Go type, strings lexically and everything else only for
+// equality.
+func Compare(a interface{}, op Operator, b interface{}) bool {
+	if af, ok := toFloat(a); ok {
+		if bf, ok := toFloat(b); ok {
+			switch op {
+			case OpEqual:
+				return af == bf
+			case OpNotEqual:
+				return af != bf
+			case OpGreater:
+				return af > bf
+			case OpGreaterOrEqual:
+				return af >= bf
+			case OpLess:
+				return af < bf
+			case OpLessOrEqual:
+				return af <= bf
+			}
+			return false
+		}
+	}
+
+	if as, ok := a.(string); ok {
+		if bs, ok := b.(string); ok {
+			switch op {
+			case OpEqual:
+				return as == bs
+			case OpNotEqual:
+				return as != bs
+			case OpGreater:
+				return as > bs
+			case OpGreaterOrEqual:
+				return as >= bs
+			case OpLess:
+				return as < bs
+			case OpLessOrEqual:
+				return as <= bs
+			}
+			return false
+		}
+	}
+
+	switch op {
+	case OpEqual:
+		return fmt.Sprint(a) == fmt.Sprint(b)
+	case OpNotEqual:
+		return fmt.Sprint(a) != fmt.Sprint(b)
+	}
+	return false
+}
+
+// Lookup resolves a dot-separated path against a digital twin. Supported paths are
+// id, type, definition, createdAt, modifiedAt, attributes.<key>,
+// features.<feature>.properties.<key> and features.<feature>.desiredProperties.<key>.
+func Lookup(dt *twin.DigitalTwin, path string) (interface{}, bool) {
+	parts := strings.SplitN(path, ".", 4)
+
+	switch parts[0] {
+	case "id":
+		return dt.ID, len(parts) == 1
+	case "type":
+		return dt.Type, len(parts) == 1
+	case "definition":
+		return dt.GetDefinition(), len(parts) == 1
+	case "createdAt":
+		return dt.CreatedAt, len(parts) == 1
+	case "modifiedAt":
+		return dt.ModifiedAt, len(parts) == 1
+	case "attributes":
+		if len(parts) < 2 {
+			return nil, false
+		}
+		key := strings.Join(parts[1:], ".")
+		if parts[1] == twin.SystemAttribute && len(parts) > 2 {
+			return dt.GetSystem(strings.TrimPrefix(key, twin.SystemAttribute+"."))
+		}
+		return dt.GetAttribute(key)
+	case "features":
+		if len(parts) != 4 {
+			return nil, false
+		}
+		feature, exists := dt.GetFeature(parts[1])
+		if !exists {
+			return nil, false
+		}
+		switch parts[2] {
+		case "properties":
+			return feature.GetProperty(parts[3])
+		case "desiredProperties":
+			return feature.GetDesiredProperty(parts[3])
+		}
+	}
+
+	return nil, false
+}
+
+// ValidatePath checks that a path has one of the forms supported by Lookup
+func ValidatePath(path string) error {
+	parts := strings.SplitN(path, ".", 4)
+
+	switch parts[0] {
+	case "id", "type", "definition", "createdAt", "modifiedAt":
+		if len(parts) == 1 {
+			return nil
+		}
+	case "attributes":
+		if len(parts) >= 2 && parts[1] != "" {
+			return nil
+		}
+	case "features":
+		if len(parts) == 4 && parts[1] != "" && parts[3] != "" &&
+			(parts[2] == "properties" || parts[2] == "desiredProperties") {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: unsupported path %q", ErrInvalidQuery, path)
+}
+
+// splitAnd splits a query on the "and" keyword, ignoring keywords inside quotes
+func splitAnd(s string) []string {
+	var parts []string
+	var inQuote rune
+	start := 0
+
+	for i, r := range s {
+		switch {
+		case inQuote != 0:
+			if r == inQuote {
+				inQuote = 0
+			}
+		case r == '"' || r == '\'':
+			inQuote = r
+		case r == ' ' && strings.HasPrefix(strings.ToLower(s[i:]), " and "):
+			parts = append(parts, s[start:i])
+			start = i + len(" and ")
+		}
+	}
+
+	return append(parts, s[start:])
+}
+
+// parseCondition parses a single "path op value" expression
+func parseCondition(s string) (Condition, error) {
+	s = strings.TrimSpace(s)
+
+	for i := 0; i < len(s); i++ {
+		for _, op := range operators {
+			if !strings.HasPrefix(s[i:], string(op)) {
+				continue
+			}
+
+			path := strings.TrimSpace(s[:i])
+			raw := strings.TrimSpace(s[i+len(op):])
+			if path == "" || raw == "" {
+				return Condition{}, fmt.Errorf("%w: incomplete condition %q", ErrInvalidQuery, s)
+			}
+
+			return Condition{Path: path, Op: op, Value: parseValue(raw)}, nil
+		}
+	}
+
+	return Condition{}, fmt.Errorf("%w: missing operator in %q", ErrInvalidQuery, s)
+}
+
+// parseValue converts a literal into a number, boolean or string
+func parseValue(raw string) interface{} {
+	if len(raw) >= 2 && (raw[0] == '"' || raw[0] == '\'') && raw[len(raw)-1] == raw[0] {
+		return raw[1 : len(raw)-1]
+	}
+	if f, err := strconv.ParseFloat(raw, 64); err == nil {
+		return f
+	}
+	if b, err := strconv.ParseBool(raw); err == nil {
+		return b
+	}
+	return raw
+}
+
+// formatValue renders a literal so that parseValue returns it unchanged
+func formatValue(v interface{}) string {
+	if s, ok := v.(string); ok {
+		if _, plain := parseValue(s).(string); plain && !strings.ContainsAny(s, " '\"") {
+			return s
+		}
+		return strconv.Quote(s)
+	}
+	return fmt.Sprint(v)
+}
+
+// toFloat converts numeric values to float64
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	}
+	return 0, false
+}
@@ -0,0 +1,148 @@
+package query
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func newTestTwin() *twin.DigitalTwin {
+	dt := twin.NewDigitalTwin("sensor-1", "sensor")
+	dt.SetAttribute("location", "kitchen")
+	dt.SetAttribute("floor", 2)
+
+	feature := twin.NewFeatureState()
+	feature.SetProperty("value", 22.5)
+	feature.SetDesiredProperty("value", 21.0)
+	dt.AddFeature("temperature", feature)
+
+	return dt
+}
+
+func TestParse(t *testing.T) {
+	q, err := Parse(`type==sensor and attributes.floor >= 2 and attributes.name=="living room"`)
+	if err != nil {
+		t.Fatalf("Failed to parse query: %v", err)
+	}
+
+	if len(q.Conditions) != 3 {
+		t.Fatalf("Expected 3 conditions, got %d", len(q.Conditions))
+	}
+
+	if c := q.Conditions[0]; c.Path != "type" || c.Op != OpEqual || c.Value != "sensor" {
+		t.Errorf("Unexpected first condition: %+v", c)
+	}
+
+	if c := q.Conditions[1]; c.Path != "attributes.floor" || c.Op != OpGreaterOrEqual || c.Value != 2.0 {
+		t.Errorf("Unexpected second condition: %+v", c)
+	}
+
+	if c := q.Conditions[2]; c.Value != "living room" {
+		t.Errorf("Expected quoted value to be unquoted, got %v", c.Value)
+	}
+
+	// Test empty query
+	q, err = Parse("  ")
+	if err != nil || len(q.Conditions) != 0 {
+		t.Errorf("Expected empty query without conditions, got %v, %v", q, err)
+	}
+
+	// Test invalid queries
+	for _, s := range []string{"type", "==sensor", "type=="} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("Expected error parsing %q", s)
+		}
+	}
+}
+
+func TestQueryString(t *testing.T) {
+	q, _ := Parse(`type==sensor and attributes.code=="42" and attributes.floor>1`)
+
+	again, err := Parse(q.String())
+	if err != nil {
+		t.Fatalf("Failed to parse formatted query %q: %v", q.String(), err)
+	}
+
+	for i, c := range again.Conditions {
+		if c != q.Conditions[i] {
+			t.Errorf("Expected condition %+v after round trip, got %+v", q.Conditions[i], c)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	dt := newTestTwin()
+	dt.SetSystem(twin.SystemSource, "api")
+
+	cases := []struct {
+		path   string
+		value  interface{}
+		exists bool
+	}{
+		{"id", "sensor-1", true},
+		{"type", "sensor", true},
+		{"attributes.location", "kitchen", true},
+		{"attributes.missing", nil, false},
+		{"attributes._system.source", "api", true},
+		{"attributes._system.owner", nil, false},
+		{"features.temperature.properties.value", 22.5, true},
+		{"features.temperature.desiredProperties.value", 21.0, true},
+		{"features.humidity.properties.value", nil, false},
+		{"features.temperature", nil, false},
+		{"unknown", nil, false},
+	}
+
+	for _, c := range cases {
+		val, exists := Lookup(dt, c.path)
+		if exists != c.exists || (exists && val != c.value) {
+			t.Errorf("Lookup(%q) = %v, %v; expected %v, %v", c.path, val, exists, c.value, c.exists)
+		}
+	}
+}
+
+func TestValidatePath(t *testing.T) {
+	valid := []string{"id", "modifiedAt", "attributes.location", "attributes.a.b", "features.temperature.properties.value", "features.t.desiredProperties.v"}
+	for _, path := range valid {
+		if err := ValidatePath(path); err != nil {
+			t.Errorf("Expected %q to be valid, got %v", path, err)
+		}
+	}
+
+	invalid := []string{"", "id.x", "attributes", "attributes.", "features.temperature", "features.t.metadata.v", "features..properties.v", "unknown"}
+	for _, path := range invalid {
+		if err := ValidatePath(path); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("Expected ErrInvalidQuery for %q, got %v", path, err)
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	dt := newTestTwin()
+
+	cases := []struct {
+		query string
+		want  bool
+	}{
+		{"", true},
+		{"type==sensor", true},
+		{"type==actuator", false},
+		{"attributes.floor==2", true},
+		{"attributes.floor>2", false},
+		{"features.temperature.properties.value>20", true},
+		{"features.temperature.properties.value<=22.5 and attributes.location==kitchen", true},
+		{"features.temperature.properties.value<=22.5 and attributes.location==garage", false},
+		{"attributes.missing!=x", true},
+		{"attributes.missing==x", false},
+	}
+
+	for _, c := range cases {
+		q, err := Parse(c.query)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", c.query, err)
+		}
+		if got := q.Matches(dt); got != c.want {
+			t.Errorf("Query %q matched = %v, expected %v", c.query, got, c.want)
+		}
+	}
+}
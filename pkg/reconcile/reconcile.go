@@ -0,0 +1,186 @@
+package reconcile
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// ErrInvalidAsset is returned for assets that cannot be reconciled
+var ErrInvalidAsset = errors.New("invalid asset")
+
+// Asset is one entry of the authoritative asset list of an external system
+type Asset struct {
+	ID         string                 `json:"id"`
+	Type       string                 `json:"type"`
+	Definition string                 `json:"definition,omitempty"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// Options control how the registry is reconciled
+type Options struct {
+	DeactivateAbsent bool   `json:"deactivateAbsent"` // Decommission twins missing from the asset list
+	Scope            string `json:"scope,omitempty"`  // Only consider registry twins of this type as absent
+	DryRun           bool   `json:"dryRun"`           // Report the changes without applying them
+	Source           string `json:"-"`                // Recorded as the source of created twins; sync when empty
+}
+
+// Failure records an asset that could not be reconciled
+type Failure struct {
+	ID    string `json:"id"`
+	Error string `json:"error"`
+}
+
+// Report summarizes a reconciliation
+type Report struct {
+	Created     []string  `json:"created"`
+	Updated     []string  `json:"updated"`
+	Unchanged   []string  `json:"unchanged"`
+	Deactivated []string  `json:"deactivated"`
+	Failed      []Failure `json:"failed"`
+	DryRun      bool      `json:"dryRun"`
+}
+
+// Reconcile brings the registry in line with an authoritative asset list.
+// Missing twins are created, twins whose type, definition or attributes differ
+// are updated, and with DeactivateAbsent twins not in the list are decommissioned.
+// Attributes not mentioned by an asset are left untouched.
+func Reconcile(reg *registry.Registry, assets []Asset, opts Options) *Report {
+	report := &Report{
+		Created:     []string{},
+		Updated:     []string{},
+		Unchanged:   []string{},
+		Deactivated: []string{},
+		Failed:      []Failure{},
+		DryRun:      opts.DryRun,
+	}
+
+	seen := make(map[string]bool, len(assets))
+	for _, asset := range assets {
+		if err := validate(asset, seen); err != nil {
+			report.Failed = append(report.Failed, Failure{ID: asset.ID, Error: err.Error()})
+			continue
+		}
+		seen[asset.ID] = true
+
+		dt, err := reg.Get(asset.ID)
+		if err == registry.ErrTwinNotFound {
+			if err := create(reg, asset, opts); err != nil {
+				report.Failed = append(report.Failed, Failure{ID: asset.ID, Error: err.Error()})
+				continue
+			}
+			report.Created = append(report.Created, asset.ID)
+			continue
+		} else if err != nil {
+			report.Failed = append(report.Failed, Failure{ID: asset.ID, Error: err.Error()})
+			continue
+		}
+
+		if !changed(dt, asset) {
+			report.Unchanged = append(report.Unchanged, asset.ID)
+			continue
+		}
+
+		if !opts.DryRun {
+			if err := update(reg, dt, asset); err != nil {
+				report.Failed = append(report.Failed, Failure{ID: asset.ID, Error: err.Error()})
+				continue
+			}
+		}
+		report.Updated = append(report.Updated, asset.ID)
+	}
+
+	if opts.DeactivateAbsent {
+		for _, dt := range reg.List() {
+			if seen[dt.ID] || (opts.Scope != "" && dt.Type != opts.Scope) || dt.GetLifecycle() == twin.LifecycleDecommissioned {
+				continue
+			}
+
+			if !opts.DryRun {
+				if err := dt.SetLifecycle(twin.LifecycleDecommissioned); err != nil {
+					report.Failed = append(report.Failed, Failure{ID: dt.ID, Error: err.Error()})
+					continue
+				}
+				if err := reg.Update(dt); err != nil {
+					report.Failed = append(report.Failed, Failure{ID: dt.ID, Error: err.Error()})
+					continue
+				}
+			}
+			report.Deactivated = append(report.Deactivated, dt.ID)
+		}
+		sort.Strings(report.Deactivated)
+	}
+
+	return report
+}
+
+// validate checks that an asset can be reconciled
+func validate(asset Asset, seen map[string]bool) error {
+	if asset.ID == "" || asset.Type == "" {
+		return fmt.Errorf("%w: id and type are required", ErrInvalidAsset)
+	}
+	if seen[asset.ID] {
+		return fmt.Errorf("%w: duplicate id", ErrInvalidAsset)
+	}
+	if twin.CheckAttributes(asset.Attributes) != nil {
+		return fmt.Errorf("%w: attribute %s is reserved for the server", ErrInvalidAsset, twin.SystemAttribute)
+	}
+	return nil
+}
+
+// create adds a twin for a new asset
+func create(reg *registry.Registry, asset Asset, opts Options) error {
+	if opts.DryRun {
+		return nil
+	}
+
+	dt := twin.NewDigitalTwin(asset.ID, asset.Type)
+	if asset.Definition != "" {
+		dt.SetDefinition(asset.Definition)
+	}
+	for k, v := range asset.Attributes {
+		dt.SetAttribute(k, v)
+	}
+	source := opts.Source
+	if source == "" {
+		source = "sync"
+	}
+	dt.SetSystem(twin.SystemSource, source)
+
+	return reg.Create(dt)
+}
+
+// changed reports whether a twin differs from its asset
+func changed(dt *twin.DigitalTwin, asset Asset) bool {
+	if dt.Type != asset.Type {
+		return true
+	}
+	if asset.Definition != "" && dt.GetDefinition() != asset.Definition {
+		return true
+	}
+
+	for k, v := range asset.Attributes {
+		current, exists := dt.GetAttribute(k)
+		if !exists || !reflect.DeepEqual(current, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// update applies the asset fields to an existing twin
+func update(reg *registry.Registry, dt *twin.DigitalTwin, asset Asset) error {
+	dt.Type = asset.Type
+	if asset.Definition != "" {
+		dt.SetDefinition(asset.Definition)
+	}
+	for k, v := range asset.Attributes {
+		dt.SetAttribute(k, v)
+	}
+
+	return reg.Update(dt)
+}
@@ -0,0 +1,102 @@
+package reconcile
+
+import (
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func setupRegistry() *registry.Registry {
+	reg := registry.NewRegistry()
+
+	pump := twin.NewDigitalTwin("pump-1", "pump")
+	pump.SetAttribute("location", "hall-a")
+	reg.Create(pump)
+
+	valve := twin.NewDigitalTwin("valve-1", "valve")
+	valve.SetAttribute("location", "hall-b")
+	reg.Create(valve)
+
+	reg.Create(twin.NewDigitalTwin("sensor-1", "sensor"))
+	return reg
+}
+
+func TestReconcile(t *testing.T) {
+	reg := setupRegistry()
+
+	assets := []Asset{
+		{ID: "pump-1", Type: "pump", Attributes: map[string]interface{}{"location": "hall-a"}},
+		{ID: "valve-1", Type: "valve", Attributes: map[string]interface{}{"location": "hall-c"}},
+		{ID: "pump-2", Type: "pump", Definition: "org.example:pump:1.0.0"},
+		{ID: "", Type: "pump"},
+		{ID: "pump-2", Type: "pump"},
+	}
+
+	report := Reconcile(reg, assets, Options{DeactivateAbsent: true})
+
+	if len(report.Created) != 1 || report.Created[0] != "pump-2" {
+		t.Errorf("Expected pump-2 to be created, got %v", report.Created)
+	}
+	if len(report.Updated) != 1 || report.Updated[0] != "valve-1" {
+		t.Errorf("Expected valve-1 to be updated, got %v", report.Updated)
+	}
+	if len(report.Unchanged) != 1 || report.Unchanged[0] != "pump-1" {
+		t.Errorf("Expected pump-1 to be unchanged, got %v", report.Unchanged)
+	}
+	if len(report.Deactivated) != 1 || report.Deactivated[0] != "sensor-1" {
+		t.Errorf("Expected sensor-1 to be deactivated, got %v", report.Deactivated)
+	}
+	if len(report.Failed) != 2 {
+		t.Errorf("Expected 2 failures, got %v", report.Failed)
+	}
+
+	valve, _ := reg.Get("valve-1")
+	if val, _ := valve.GetAttribute("location"); val != "hall-c" {
+		t.Errorf("Expected location hall-c, got %v", val)
+	}
+
+	sensor, _ := reg.Get("sensor-1")
+	if state := sensor.GetLifecycle(); state != twin.LifecycleDecommissioned {
+		t.Errorf("Expected sensor-1 to be decommissioned, got %s", state)
+	}
+
+	// A second sync does not deactivate twins again
+	report = Reconcile(reg, assets, Options{DeactivateAbsent: true})
+	if len(report.Deactivated) != 0 || len(report.Unchanged) != 3 {
+		t.Errorf("Expected idempotent sync, got %+v", report)
+	}
+}
+
+func TestReconcileScopeAndDryRun(t *testing.T) {
+	reg := setupRegistry()
+
+	assets := []Asset{
+		{ID: "pump-1", Type: "pump", Attributes: map[string]interface{}{"location": "hall-z"}},
+		{ID: "pump-3", Type: "pump"},
+	}
+
+	report := Reconcile(reg, assets, Options{DeactivateAbsent: true, Scope: "valve", DryRun: true})
+
+	if !report.DryRun || len(report.Created) != 1 || len(report.Updated) != 1 {
+		t.Errorf("Unexpected dry run report: %+v", report)
+	}
+	if len(report.Deactivated) != 1 || report.Deactivated[0] != "valve-1" {
+		t.Errorf("Expected only valve-1 to be in scope, got %v", report.Deactivated)
+	}
+
+	// Nothing was applied
+	if _, err := reg.Get("pump-3"); err != registry.ErrTwinNotFound {
+		t.Errorf("Expected pump-3 not to be created, got %v", err)
+	}
+
+	pump, _ := reg.Get("pump-1")
+	if val, _ := pump.GetAttribute("location"); val != "hall-a" {
+		t.Errorf("Expected location to remain hall-a, got %v", val)
+	}
+
+	valve, _ := reg.Get("valve-1")
+	if state := valve.GetLifecycle(); state != twin.LifecycleProvisioned {
+		t.Errorf("Expected valve-1 to remain provisioned, got %s", state)
+	}
+}
@@ -0,0 +1,214 @@
+package registry
+
+import (
+	"sort"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// DefaultMaxTombstones is the number of deletions the change log keeps.
+// Readers behind the oldest forgotten deletion must read the log from the
+// start again.
+const DefaultMaxTombstones = 10000
+
+// Change operations
+const (
+	OpPut    = "put"
+	OpDelete = "delete"
+)
+
+// Change is an entry of the change log
+type Change struct {
+	Seq       uint64            // Registry version the change was committed at
+	Op        string            // OpPut or OpDelete
+	TwinID    string            // ID of the changed twin
+	Twin      *twin.DigitalTwin // The twin as it is now, for puts
+	Timestamp time.Time         // Commit time
+}
+
+// LogInfo describes the extent of the change log
+type LogInfo struct {
+	Seq        uint64 `json:"seq"`        // Sequence number of the latest change, the registry version
+	Compacted  uint64 `json:"compacted"`  // Readers from an earlier sequence number may have missed deletions
+	Entries    int    `json:"entries"`    // Entries kept, one per twin and retained deletion
+	Tombstones int    `json:"tombstones"` // Retained deletions
+}
+
+// logEntry records a commit or deletion of a twin
+type logEntry struct {
+	seq     uint64
+	id      string
+	deleted bool
+	at      time.Time
+}
+
+// changeLog is the log of registry changes by sequence number. It is
+// compacted by twin: only the latest entry of each twin is kept, so reading
+// it from the start yields every twin once, and puts are served with the
+// current twin. Deletions are kept as tombstones up to a limit.
+type changeLog struct {
+	entries       []logEntry
+	latest        map[string]uint64 // Twin ID -> sequence number of its latest entry
+	stale         int
+	tombstones    []logEntry // Retained deletions, in order
+	maxTombstones int
+	compacted     uint64
+	wake          chan struct{} // Closed and replaced when entries are appended
+}
+
+// append records the changes of a commit at a sequence number; the caller
+// holds the registry lock
+func (l *changeLog) append(seq uint64, at time.Time, puts []string, deletes []string) {
+	if l.latest == nil {
+		l.latest = make(map[string]uint64)
+	}
+	if l.maxTombstones == 0 {
+		l.maxTombstones = DefaultMaxTombstones
+	}
+
+	sort.Strings(puts)
+	sort.Strings(deletes)
+	for _, id := range puts {
+		l.add(logEntry{seq: seq, id: id, at: at})
+	}
+	for _, id := range deletes {
+		e := logEntry{seq: seq, id: id, deleted: true, at: at}
+		l.add(e)
+		l.tombstones = append(l.tombstones, e)
+	}
+
+	// Forget the oldest deletions beyond the limit, unless their twin was
+	// created again since
+	for len(l.tombstones) > l.maxTombstones {
+		e := l.tombstones[0]
+		l.tombstones = l.tombstones[1:]
+		l.compacted = e.seq
+		if l.latest[e.id] == e.seq {
+			delete(l.latest, e.id)
+			l.stale++
+		}
+	}
+	l.compact()
+
+	if l.wake != nil {
+		close(l.wake)
+		l.wake = nil
+	}
+}
+
+// add appends an entry, superseding the previous entry of its twin
+func (l *changeLog) add(e logEntry) {
+	if _, exists := l.latest[e.id]; exists {
+		l.stale++
+	}
+	l.latest[e.id] = e.seq
+	l.entries = append(l.entries, e)
+}
+
+// current reports whether an entry is the latest of its twin, and not a
+// forgotten deletion
+func (l *changeLog) current(e logEntry) bool {
+	seq, exists := l.latest[e.id]
+	return exists && seq == e.seq
+}
+
+// compact drops superseded entries and forgotten deletions once they make up
+// half of the log
+func (l *changeLog) compact() {
+	if l.stale < minCompaction || l.stale*2 < len(l.entries) {
+		return
+	}
+
+	entries := make([]logEntry, 0, len(l.latest))
+	for _, e := range l.entries {
+		if l.current(e) {
+			entries = append(entries, e)
+		}
+	}
+	l.entries = entries
+	l.stale = 0
+}
+
+// since returns the current entries after a sequence number, up to limit
+// entries but never splitting the entries of one sequence number
+func (l *changeLog) since(from uint64, limit int) []logEntry {
+	start := sort.Search(len(l.entries), func(i int) bool { return l.entries[i].seq > from })
+
+	var result []logEntry
+	for _, e := range l.entries[start:] {
+		if limit > 0 && len(result) >= limit && result[len(result)-1].seq != e.seq {
+			break
+		}
+		if l.current(e) {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+// Changes returns the changes after sequence number from, in order, up to
+// limit changes (no limit when zero) but never splitting the changes of one
+// transaction. The log keeps only the latest change of each twin, so reading
+// it from zero yields every twin, and a put carries the twin as it is now.
+// Readers whose position is below the compacted sequence number of the
+// returned info may have missed deletions and should read from zero again.
+func (r *Registry) Changes(from uint64, limit int) ([]Change, LogInfo) {
+	r.mutex.RLock()
+	entries := r.changes.since(from, limit)
+	info := r.logInfo()
+	r.mutex.RUnlock()
+
+	changes := make([]Change, 0, len(entries))
+	for _, e := range entries {
+		change := Change{Seq: e.seq, Op: OpPut, TwinID: e.id, Timestamp: e.at}
+		if e.deleted {
+			change.Op = OpDelete
+		} else {
+			// Twins evicted from memory are loaded again; twins deleted
+			// since are left to their later deletion
+			dt, err := r.Get(e.id)
+			if err != nil {
+				continue
+			}
+			change.Twin = dt
+		}
+		changes = append(changes, change)
+	}
+	return changes, info
+}
+
+// LogInfo returns the extent of the change log
+func (r *Registry) LogInfo() LogInfo {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.logInfo()
+}
+
+// logInfo returns the extent of the change log; the caller holds the lock
+func (r *Registry) logInfo() LogInfo {
+	return LogInfo{
+		Seq:        r.version,
+		Compacted:  r.changes.compacted,
+		Entries:    len(r.changes.latest),
+		Tombstones: len(r.changes.tombstones),
+	}
+}
+
+// WaitChanges returns a channel that is closed once the log has changes
+// after sequence number from
+func (r *Registry) WaitChanges(from uint64) <-chan struct{} {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.version > from {
+		closed := make(chan struct{})
+		close(closed)
+		return closed
+	}
+	if r.changes.wake == nil {
+		r.changes.wake = make(chan struct{})
+	}
+	return r.changes.wake
+}
@@ -0,0 +1,95 @@
+package registry
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// describe lists changes as "seq:op:id"
+func describe(changes []Change) string {
+	result := make([]string, len(changes))
+	for i, c := range changes {
+		result[i] = fmt.Sprintf("%d:%s:%s", c.Seq, c.Op, c.TwinID)
+	}
+	return fmt.Sprint(result)
+}
+
+func TestChanges(t *testing.T) {
+	reg := NewRegistry()
+	reg.Create(twin.NewDigitalTwin("a", "sensor"))
+	reg.Create(twin.NewDigitalTwin("b", "sensor"))
+	reg.Create(twin.NewDigitalTwin("c", "sensor"))
+
+	a, _ := reg.Get("a")
+	a.SetAttribute("room", "lobby")
+	reg.Update(a)
+	reg.Delete("b")
+
+	// Superseded entries are left out and puts carry the current twin
+	changes, info := reg.Changes(0, 0)
+	if got := describe(changes); got != "[3:put:c 4:put:a 5:delete:b]" {
+		t.Errorf("Unexpected changes %s", got)
+	}
+	if room, _ := changes[1].Twin.GetAttribute("room"); room != "lobby" {
+		t.Errorf("Expected the current twin, got %v", room)
+	}
+	if info.Seq != 5 || info.Entries != 3 || info.Tombstones != 1 || info.Compacted != 0 {
+		t.Errorf("Unexpected info %+v", info)
+	}
+	if changes, _ := reg.Changes(3, 0); describe(changes) != "[4:put:a 5:delete:b]" {
+		t.Errorf("Unexpected changes since 3: %s", describe(changes))
+	}
+
+	// Transactions are never split
+	reg.Transaction(func(tx *Tx) error {
+		tx.Create(twin.NewDigitalTwin("d", "sensor"))
+		tx.Create(twin.NewDigitalTwin("e", "sensor"))
+		return tx.Delete("c")
+	})
+	if changes, _ := reg.Changes(4, 2); describe(changes) != "[5:delete:b 6:put:d 6:put:e 6:delete:c]" {
+		t.Errorf("Unexpected changes since 4: %s", describe(changes))
+	}
+	if changes, _ := reg.Changes(4, 1); describe(changes) != "[5:delete:b]" {
+		t.Errorf("Unexpected first change since 4: %s", describe(changes))
+	}
+
+	select {
+	case <-reg.WaitChanges(5):
+	default:
+		t.Error("Expected the wait to end right away")
+	}
+	wait := reg.WaitChanges(6)
+	select {
+	case <-wait:
+		t.Error("Expected the wait to last until the next change")
+	default:
+	}
+	reg.Create(twin.NewDigitalTwin("f", "sensor"))
+	select {
+	case <-wait:
+	default:
+		t.Error("Expected the wait to end with the change")
+	}
+}
+
+func TestChangesTombstones(t *testing.T) {
+	reg := NewRegistry()
+	reg.changes.maxTombstones = 2
+	for i := 0; i < 100; i++ {
+		id := fmt.Sprintf("t-%d", i)
+		reg.Create(twin.NewDigitalTwin(id, "sensor"))
+		if i%2 == 1 {
+			reg.Delete(id)
+		}
+	}
+
+	changes, info := reg.Changes(0, 0)
+	if len(changes) != 52 || info.Tombstones != 2 || info.Compacted != 144 {
+		t.Errorf("Unexpected log of %d changes, info %+v", len(changes), info)
+	}
+	if len(reg.changes.entries) > 2*len(reg.changes.latest)+minCompaction {
+		t.Errorf("Expected the log to be compacted, got %d entries", len(reg.changes.entries))
+	}
+}
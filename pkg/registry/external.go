@@ -0,0 +1,77 @@
+package registry
+
+import (
+	"sort"
+
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// externalKey is an ID of a twin in an external system
+type externalKey struct {
+	system string
+	id     string
+}
+
+// externalIndex maps the IDs of twins in external systems, kept in their
+// twin.ExternalIDsAttribute, to the IDs of the twins. Like the indexes, it
+// is maintained as twins are committed and keeps the twins in the store.
+type externalIndex struct {
+	twins map[externalKey]map[string]struct{} // External ID -> twin IDs
+	keys  map[string][]externalKey            // Twin ID -> external IDs
+}
+
+// update reindexes twins; the caller must hold the mutex
+func (x *externalIndex) update(twins ...*twin.DigitalTwin) {
+	for _, dt := range twins {
+		x.remove(dt.ID)
+
+		var keys []externalKey
+		for system, ids := range dt.ExternalIDs() {
+			for _, id := range ids {
+				keys = append(keys, externalKey{system, id})
+			}
+		}
+		if len(keys) == 0 {
+			continue
+		}
+
+		if x.twins == nil {
+			x.twins = make(map[externalKey]map[string]struct{})
+			x.keys = make(map[string][]externalKey)
+		}
+		for _, k := range keys {
+			if x.twins[k] == nil {
+				x.twins[k] = make(map[string]struct{})
+			}
+			x.twins[k][dt.ID] = struct{}{}
+		}
+		x.keys[dt.ID] = keys
+	}
+}
+
+// remove drops a twin; the caller must hold the mutex
+func (x *externalIndex) remove(id string) {
+	for _, k := range x.keys[id] {
+		delete(x.twins[k], id)
+		if len(x.twins[k]) == 0 {
+			delete(x.twins, k)
+		}
+	}
+	delete(x.keys, id)
+}
+
+// ResolveExternalID returns the IDs of the twins an external system knows
+// by an ID, in order. External IDs are not required to be unique, so
+// callers decide what several twins sharing one mean. Twins loaded lazily
+// are found once WarmUp has read them.
+func (r *Registry) ResolveExternalID(system, id string) []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var ids []string
+	for twinID := range r.external.twins[externalKey{system, id}] {
+		ids = append(ids, twinID)
+	}
+	sort.Strings(ids)
+	return ids
+}
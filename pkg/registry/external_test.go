@@ -0,0 +1,60 @@
+package registry
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/objstore"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestResolveExternalID(t *testing.T) {
+	reg := NewRegistry()
+	reg.SetBudget(Budget{MaxTwins: 1}, NewObjectStore(objstore.NewMemoryStore(), "twins/"))
+
+	pump := twin.NewDigitalTwin("pump-1", "pump")
+	pump.SetAttribute(twin.ExternalIDsAttribute, map[string]interface{}{"erp": "4711", "mac": []interface{}{"aa", "bb"}})
+	reg.Create(pump)
+	valve := twin.NewDigitalTwin("valve-1", "valve")
+	valve.SetAttribute(twin.ExternalIDsAttribute, map[string]interface{}{"erp": "4712"})
+	reg.Create(valve)
+
+	// Evicted twins are found too
+	for _, tc := range []struct {
+		system, id string
+		want       []string
+	}{
+		{"erp", "4711", []string{"pump-1"}},
+		{"mac", "bb", []string{"pump-1"}},
+		{"erp", "4712", []string{"valve-1"}},
+		{"serial", "4711", nil},
+	} {
+		if ids := reg.ResolveExternalID(tc.system, tc.id); !reflect.DeepEqual(ids, tc.want) {
+			t.Errorf("%s/%s: expected %v, got %v", tc.system, tc.id, tc.want, ids)
+		}
+	}
+
+	// Changes are reindexed, and IDs may be shared
+	pump, _ = reg.Get("pump-1")
+	pump.SetAttribute(twin.ExternalIDsAttribute, map[string]interface{}{"erp": "4712"})
+	reg.Update(pump)
+	if ids := reg.ResolveExternalID("erp", "4712"); !reflect.DeepEqual(ids, []string{"pump-1", "valve-1"}) {
+		t.Errorf("Expected both twins, got %v", ids)
+	}
+	if ids := reg.ResolveExternalID("mac", "aa"); ids != nil {
+		t.Errorf("Expected the removed ID not to resolve, got %v", ids)
+	}
+
+	reg.Delete("valve-1")
+	reg.Transaction(func(tx *Tx) error {
+		dt, _ := tx.Get("pump-1")
+		dt.SetAttribute(twin.ExternalIDsAttribute, map[string]interface{}{"serial": "SN-1"})
+		return nil
+	})
+	if ids := reg.ResolveExternalID("erp", "4712"); ids != nil {
+		t.Errorf("Expected no twins, got %v", ids)
+	}
+	if ids := reg.ResolveExternalID("serial", "SN-1"); !reflect.DeepEqual(ids, []string{"pump-1"}) {
+		t.Errorf("Expected pump-1, got %v", ids)
+	}
+}
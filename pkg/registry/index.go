@@ -0,0 +1,223 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/query"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// Index errors
+var (
+	ErrIndexExists   = errors.New("index already exists")
+	ErrIndexNotFound = errors.New("index not found")
+)
+
+// IndexStats describes an index and how it is used
+type IndexStats struct {
+	Path      string    `json:"path"`
+	Keys      int       `json:"keys"`    // Distinct values
+	Entries   int       `json:"entries"` // Twins with a value at the path
+	Lookups   uint64    `json:"lookups"` // Queries the index was used for
+	CreatedAt time.Time `json:"createdAt"`
+	BuildTime string    `json:"buildTime"` // Time it took to index the twins in memory
+	Warm      bool      `json:"warm"`      // The twins in the store are indexed too
+}
+
+// index maps the values at a twin path to the IDs of the twins having them.
+// Values are keyed so that values equal under the query language share a
+// key; lookups may return twins that do not match, which queries filter
+// out, but never miss one.
+type index struct {
+	path      string
+	twins     map[string]map[string]struct{} // Key -> twin IDs
+	keys      map[string]string              // Twin ID -> key
+	lookups   atomic.Uint64
+	createdAt time.Time
+	buildTime time.Duration
+	cold      bool // Twins in the store are not indexed yet
+}
+
+// newIndex creates an empty index of a path
+func newIndex(path string) *index {
+	return &index{
+		path:      path,
+		twins:     make(map[string]map[string]struct{}),
+		keys:      make(map[string]string),
+		createdAt: time.Now(),
+	}
+}
+
+// indexKey returns the key of a value. Numbers are keyed by their float64
+// value, like the query language compares them; everything else by its
+// formatting, which the query language compares otherwise.
+func indexKey(v interface{}) string {
+	switch n := v.(type) {
+	case float64:
+		return strconv.FormatFloat(n, 'g', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(n), 'g', -1, 64)
+	case int:
+		return strconv.FormatFloat(float64(n), 'g', -1, 64)
+	case int8:
+		return strconv.FormatFloat(float64(n), 'g', -1, 64)
+	case int16:
+		return strconv.FormatFloat(float64(n), 'g', -1, 64)
+	case int32:
+		return strconv.FormatFloat(float64(n), 'g', -1, 64)
+	case int64:
+		return strconv.FormatFloat(float64(n), 'g', -1, 64)
+	case uint:
+		return strconv.FormatFloat(float64(n), 'g', -1, 64)
+	case uint8:
+		return strconv.FormatFloat(float64(n), 'g', -1, 64)
+	case uint16:
+		return strconv.FormatFloat(float64(n), 'g', -1, 64)
+	case uint32:
+		return strconv.FormatFloat(float64(n), 'g', -1, 64)
+	case uint64:
+		return strconv.FormatFloat(float64(n), 'g', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// update reindexes a twin
+func (x *index) update(dt *twin.DigitalTwin) {
+	value, exists := query.Lookup(dt, x.path)
+	key := indexKey(value)
+	if old, indexed := x.keys[dt.ID]; indexed {
+		if exists && old == key {
+			return
+		}
+		x.remove(dt.ID)
+	}
+	if !exists {
+		return
+	}
+
+	ids := x.twins[key]
+	if ids == nil {
+		ids = make(map[string]struct{})
+		x.twins[key] = ids
+	}
+	ids[dt.ID] = struct{}{}
+	x.keys[dt.ID] = key
+}
+
+// remove drops a twin from the index
+func (x *index) remove(id string) {
+	key, indexed := x.keys[id]
+	if !indexed {
+		return
+	}
+	delete(x.keys, id)
+	delete(x.twins[key], id)
+	if len(x.twins[key]) == 0 {
+		delete(x.twins, key)
+	}
+}
+
+// stats returns the statistics of the index
+func (x *index) stats() IndexStats {
+	return IndexStats{
+		Path:      x.path,
+		Keys:      len(x.twins),
+		Entries:   len(x.keys),
+		Lookups:   x.lookups.Load(),
+		CreatedAt: x.createdAt,
+		BuildTime: x.buildTime.String(),
+		Warm:      !x.cold,
+	}
+}
+
+// indexSet holds the indexes of a registry by path
+type indexSet map[string]*index
+
+// update reindexes twins in every index; the caller must hold the mutex
+func (s indexSet) update(twins ...*twin.DigitalTwin) {
+	for _, x := range s {
+		for _, dt := range twins {
+			x.update(dt)
+		}
+	}
+}
+
+// remove drops a deleted twin from every index; the caller must hold the mutex
+func (s indexSet) remove(id string) {
+	for _, x := range s {
+		x.remove(id)
+	}
+}
+
+// CreateIndex indexes the values at a twin path, such as
+// attributes.serialNumber, for queries comparing it for equality. The
+// twins in memory are indexed right away, and the index is maintained as
+// twins are committed. Twins in the store are indexed by WarmUp; until then
+// the index is cold.
+func (r *Registry) CreateIndex(path string) (IndexStats, error) {
+	if err := query.ValidatePath(path); err != nil {
+		return IndexStats{}, err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.indexes[path]; exists {
+		return IndexStats{}, ErrIndexExists
+	}
+
+	x := newIndex(path)
+	for _, dt := range r.twins {
+		x.update(dt)
+	}
+	x.buildTime = time.Since(x.createdAt)
+	x.cold = len(r.memory.evicted) > 0
+
+	if r.indexes == nil {
+		r.indexes = make(indexSet)
+	}
+	r.indexes[path] = x
+	return x.stats(), nil
+}
+
+// DropIndex removes the index of a path
+func (r *Registry) DropIndex(path string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.indexes[path]; !exists {
+		return ErrIndexNotFound
+	}
+	delete(r.indexes, path)
+	return nil
+}
+
+// Index returns the statistics of the index of a path
+func (r *Registry) Index(path string) (IndexStats, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	x, exists := r.indexes[path]
+	if !exists {
+		return IndexStats{}, ErrIndexNotFound
+	}
+	return x.stats(), nil
+}
+
+// Indexes returns the statistics of all indexes, by path
+func (r *Registry) Indexes() []IndexStats {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	stats := make([]IndexStats, 0, len(r.indexes))
+	for _, x := range r.indexes {
+		stats = append(stats, x.stats())
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Path < stats[j].Path })
+	return stats
+}
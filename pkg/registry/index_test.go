@@ -0,0 +1,104 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/query"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func find(t *testing.T, reg *Registry, s string) []string {
+	t.Helper()
+	q, err := query.Parse(s)
+	if err != nil {
+		t.Fatalf("Failed to parse %q: %v", s, err)
+	}
+	found := ids(reg.Find(q))
+	sort.Strings(found)
+	return found
+}
+
+func TestIndexes(t *testing.T) {
+	reg := NewRegistry()
+	for i := 0; i < 10; i++ {
+		dt := twin.NewDigitalTwin(fmt.Sprintf("pump-%d", i), "pump")
+		dt.SetAttribute("serialNumber", fmt.Sprintf("SN-%d", i%5))
+		dt.SetAttribute("line", float64(i%2))
+		reg.Create(dt)
+	}
+
+	if _, err := reg.CreateIndex("attributes"); !errors.Is(err, query.ErrInvalidQuery) {
+		t.Errorf("Expected ErrInvalidQuery, got %v", err)
+	}
+	stats, err := reg.CreateIndex("attributes.serialNumber")
+	if err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	if stats.Keys != 5 || stats.Entries != 10 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	if _, err := reg.CreateIndex("attributes.serialNumber"); err != ErrIndexExists {
+		t.Errorf("Expected ErrIndexExists, got %v", err)
+	}
+	reg.CreateIndex("attributes.line")
+
+	if got := fmt.Sprint(find(t, reg, "attributes.serialNumber == SN-3")); got != "[pump-3 pump-8]" {
+		t.Errorf("Unexpected matches %s", got)
+	}
+	if got := fmt.Sprint(find(t, reg, "attributes.line == 1 and attributes.serialNumber == SN-3")); got != "[pump-3]" {
+		t.Errorf("Unexpected matches %s", got)
+	}
+	if got := len(find(t, reg, "attributes.line >= 0")); got != 10 {
+		t.Errorf("Expected range conditions to scan, got %d matches", got)
+	}
+	if stats, _ := reg.Index("attributes.serialNumber"); stats.Lookups != 2 {
+		t.Errorf("Expected the more selective index to be used twice, got %+v", stats)
+	}
+
+	// Indexes follow committed changes
+	dt, _ := reg.Get("pump-3")
+	dt.SetAttribute("serialNumber", "SN-99")
+	reg.Update(dt)
+	reg.Delete("pump-8")
+	reg.Transaction(func(tx *Tx) error {
+		added := twin.NewDigitalTwin("pump-10", "pump")
+		added.SetAttribute("serialNumber", "SN-3")
+		return tx.Create(added)
+	})
+	if got := fmt.Sprint(find(t, reg, "attributes.serialNumber == SN-3")); got != "[pump-10]" {
+		t.Errorf("Unexpected matches after changes %s", got)
+	}
+	if got := fmt.Sprint(find(t, reg, "attributes.serialNumber == 'SN-99'")); got != "[pump-3]" {
+		t.Errorf("Unexpected matches after changes %s", got)
+	}
+
+	if err := reg.DropIndex("attributes.serialNumber"); err != nil {
+		t.Errorf("Failed to drop index: %v", err)
+	}
+	if err := reg.DropIndex("attributes.serialNumber"); err != ErrIndexNotFound {
+		t.Errorf("Expected ErrIndexNotFound, got %v", err)
+	}
+	if indexes := reg.Indexes(); len(indexes) != 1 || indexes[0].Path != "attributes.line" {
+		t.Errorf("Unexpected indexes %+v", indexes)
+	}
+}
+
+func TestIndexKey(t *testing.T) {
+	// Values the query language considers equal share a key
+	for _, pair := range [][2]interface{}{
+		{2000000000.0, int32(2000000000)},
+		{int64(7), 7.0},
+		{"1", 1.0},
+		{true, "true"},
+	} {
+		if !query.Compare(pair[0], query.OpEqual, pair[1]) {
+			t.Fatalf("Expected %v and %v to be equal", pair[0], pair[1])
+		}
+		if indexKey(pair[0]) != indexKey(pair[1]) {
+			t.Errorf("Expected %v (%T) and %v (%T) to share a key", pair[0], pair[0], pair[1], pair[1])
+		}
+	}
+}
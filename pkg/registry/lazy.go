@@ -0,0 +1,135 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrNoStore is returned when twins are to be loaded lazily or checkpointed
+// without a store, or with one that cannot list its twins
+var ErrNoStore = errors.New("no store that can list twins is configured")
+
+// Enumerator is implemented by stores that can list the twins they keep
+type Enumerator interface {
+	IDs() ([]string, error)
+}
+
+// LoadLazily registers the twins kept in the store that are not in memory,
+// such as the twins checkpointed before a restart, without reading them.
+// They are loaded on first access by ID, and the memory budget keeps the
+// least recently used of them in the store again, so startup does not wait
+// for millions of twins to be read. Until WarmUp has read them, their types
+// and sizes are unknown, indexes do not cover them, and like other twins in
+// the store, List and scanning queries do not see them. The twins are put
+// into the change log as one commit. LoadLazily returns the number of twins
+// registered.
+func (r *Registry) LoadLazily() (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	m := &r.memory
+	enumerator, ok := m.store.(Enumerator)
+	if !ok {
+		return 0, ErrNoStore
+	}
+	ids, err := enumerator.IDs()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list stored twins: %w", err)
+	}
+
+	var lazy []string
+	for _, id := range ids {
+		if _, exists := r.twins[id]; exists || r.evictedExists(id) {
+			continue
+		}
+		if m.evicted == nil {
+			m.evicted = make(map[string]evictedTwin)
+		}
+		m.evicted[id] = evictedTwin{}
+		lazy = append(lazy, id)
+	}
+	if len(lazy) == 0 {
+		return 0, nil
+	}
+
+	for _, x := range r.indexes {
+		x.cold = true
+	}
+	r.version++
+	r.changes.append(r.version, r.now(), lazy, nil)
+	return len(lazy), nil
+}
+
+// Checkpoint saves the twins in memory to the store, so that together with
+// the twins already there they can be loaded lazily after a restart. It
+// returns the number of twins saved.
+func (r *Registry) Checkpoint() (int, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	store := r.memory.store
+	if store == nil {
+		return 0, ErrNoStore
+	}
+	for _, dt := range r.twins {
+		if err := store.Save(dt.Clone()); err != nil {
+			return 0, fmt.Errorf("failed to save twin %s: %w", dt.ID, err)
+		}
+	}
+	return len(r.twins), nil
+}
+
+// WarmUp reads the twins in the store in the background, without loading
+// them into memory, to build the indexes that do not cover them yet and to
+// learn the types and sizes of lazily loaded twins. Indexes created while
+// it runs are left cold; WarmUp can be run again for them. It returns the
+// number of twins read.
+func (r *Registry) WarmUp(ctx context.Context) (int, error) {
+	r.mutex.RLock()
+	var cold []*index
+	for _, x := range r.indexes {
+		if x.cold {
+			cold = append(cold, x)
+		}
+	}
+	var ids []string
+	for id, e := range r.memory.evicted {
+		if len(cold) > 0 || e.twinType == "" {
+			ids = append(ids, id)
+		}
+	}
+	store := r.memory.store
+	r.mutex.RUnlock()
+
+	read := 0
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return read, err
+		}
+		dt, err := store.Load(id)
+		if err != nil {
+			return read, fmt.Errorf("failed to read stored twin %s: %w", id, err)
+		}
+		read++
+
+		// Twins loaded or deleted meanwhile were indexed when committed or
+		// restored
+		r.mutex.Lock()
+		if _, evicted := r.memory.evicted[id]; evicted {
+			r.memory.evicted[id] = evictedTwin{twinType: dt.Type, size: sizeOf(dt)}
+			r.external.update(dt)
+			for _, x := range cold {
+				x.update(dt)
+			}
+		}
+		r.mutex.Unlock()
+	}
+
+	r.mutex.Lock()
+	for _, x := range cold {
+		x.cold = false
+	}
+	r.mutex.Unlock()
+	return read, nil
+}
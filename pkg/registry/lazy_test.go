@@ -0,0 +1,77 @@
+package registry
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/objstore"
+	"github.com/aleka07/go-digital-twin/pkg/query"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestLoadLazily(t *testing.T) {
+	store := NewObjectStore(objstore.NewMemoryStore(), "twins/")
+
+	// A registry checkpoints its twins before a restart
+	before := NewRegistry()
+	before.SetBudget(Budget{}, store)
+	for _, id := range []string{"pump-1", "pump-2", "pump/3"} {
+		dt := twin.NewDigitalTwin(id, "pump")
+		dt.SetAttribute("serialNumber", "SN-"+id)
+		before.Create(dt)
+	}
+	if n, err := before.Checkpoint(); err != nil || n != 3 {
+		t.Fatalf("Expected 3 twins to be checkpointed, got %d: %v", n, err)
+	}
+
+	reg := NewRegistry()
+	if _, err := reg.LoadLazily(); err != ErrNoStore {
+		t.Errorf("Expected ErrNoStore, got %v", err)
+	}
+	reg.SetBudget(Budget{MaxTwins: 2}, store)
+	reg.CreateIndex("attributes.serialNumber")
+	n, err := reg.LoadLazily()
+	if err != nil || n != 3 {
+		t.Fatalf("Expected 3 twins to be registered, got %d: %v", n, err)
+	}
+	if reg.Count() != 0 || reg.LogInfo().Seq != 1 {
+		t.Errorf("Expected no twins in memory and one commit, got %d at %d", reg.Count(), reg.LogInfo().Seq)
+	}
+	if changes, _ := reg.Changes(0, 0); len(changes) != 3 {
+		t.Errorf("Expected the stored twins in the change log, got %d changes", len(changes))
+	}
+
+	// Twins are loaded on first access
+	if n, _ := reg.LoadLazily(); n != 0 {
+		t.Errorf("Expected no more twins to be registered, got %d", n)
+	}
+	dt, err := reg.Get("pump/3")
+	if err != nil || dt.GetRevision() != 1 {
+		t.Fatalf("Failed to load pump/3 lazily: %v", err)
+	}
+
+	// Warming up indexes the twins in the store
+	stats, _ := reg.Index("attributes.serialNumber")
+	if stats.Warm {
+		t.Errorf("Expected the index to be cold, got %+v", stats)
+	}
+	if _, err := reg.WarmUp(context.Background()); err != nil {
+		t.Fatalf("Failed to warm up: %v", err)
+	}
+	if stats, _ := reg.Index("attributes.serialNumber"); !stats.Warm || stats.Entries != 3 {
+		t.Errorf("Expected the index to cover every twin, got %+v", stats)
+	}
+	if usage := reg.MemoryUsage(); usage.Types["pump"].Evicted+usage.Types["pump"].Twins != 3 {
+		t.Errorf("Expected the types of stored twins to be known, got %+v", usage.Types)
+	}
+	q, _ := query.Parse("attributes.serialNumber == SN-pump-2")
+	if twins := reg.Find(q); len(twins) != 1 || twins[0].ID != "pump-2" {
+		t.Errorf("Expected pump-2 to be found in the store, got %v", twins)
+	}
+
+	// Deleted twins are removed from the store, even when resident
+	reg.Delete("pump/3")
+	if ids, _ := store.(Enumerator).IDs(); len(ids) != 2 {
+		t.Errorf("Expected 2 twins to remain in the store, got %v", ids)
+	}
+}
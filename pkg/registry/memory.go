@@ -0,0 +1,372 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/objstore"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// ErrMemoryBudgetExceeded is returned by Create when a new twin does not fit
+// into the memory budget and no inactive twins can be evicted
+var ErrMemoryBudgetExceeded = errors.New("memory budget exceeded")
+
+// Budget limits the twins kept in memory. Sizes are measured as the length
+// of a twin's JSON encoding, which tracks its actual footprint closely
+// enough for budgeting.
+type Budget struct {
+	MaxBytes int64         `json:"maxBytes,omitempty"` // Size of resident twins, unlimited when zero
+	MaxTwins int           `json:"maxTwins,omitempty"` // Number of resident twins, unlimited when zero
+	MinIdle  time.Duration `json:"-"`                  // Twins used more recently are never evicted
+}
+
+// enabled reports whether the budget limits anything
+func (b Budget) enabled() bool {
+	return b.MaxBytes > 0 || b.MaxTwins > 0
+}
+
+// Store keeps twins evicted from memory until they are used again. Loading
+// a missing twin fails; removing one does not.
+type Store interface {
+	Save(dt *twin.DigitalTwin) error
+	Load(id string) (*twin.DigitalTwin, error)
+	Remove(id string) error
+}
+
+// TypeUsage is the memory used by the twins of one type
+type TypeUsage struct {
+	Twins   int   `json:"twins"`
+	Bytes   int64 `json:"bytes"`
+	Evicted int   `json:"evicted"`
+}
+
+// MemoryUsage reports the memory used by resident twins against the budget
+type MemoryUsage struct {
+	Budget    Budget               `json:"budget"`
+	Twins     int                  `json:"twins"`     // Resident twins
+	Bytes     int64                `json:"bytes"`     // Size of resident twins
+	Evicted   int                  `json:"evicted"`   // Twins moved to the store
+	Evictions uint64               `json:"evictions"` // Twins evicted since the budget was set
+	Restores  uint64               `json:"restores"`  // Evicted twins loaded again on access
+	Rejected  uint64               `json:"rejected"`  // Creates rejected for lack of memory
+	Types     map[string]TypeUsage `json:"types"`
+}
+
+// usage is the accounting of a resident twin
+type usage struct {
+	twinType string
+	size     int64
+	lastUsed atomic.Int64 // Unix nanoseconds, updated under the read lock
+}
+
+// touch records that the twin was used at a time
+func (u *usage) touch(now time.Time) {
+	u.lastUsed.Store(now.UnixNano())
+}
+
+// evictedTwin is the accounting of a twin in the store
+type evictedTwin struct {
+	twinType string
+	size     int64
+}
+
+// memory tracks resident twins against a budget; it is guarded by the
+// registry's mutex
+type memory struct {
+	budget    Budget
+	store     Store
+	usage     map[string]*usage
+	evicted   map[string]evictedTwin
+	bytes     int64
+	evictions uint64
+	restores  uint64
+	rejected  uint64
+}
+
+// counter is a writer that only counts the bytes written to it
+type counter int64
+
+// Write counts p
+func (c *counter) Write(p []byte) (int, error) {
+	*c += counter(len(p))
+	return len(p), nil
+}
+
+// sizeOf returns the accounted size of a twin. The encoding is counted
+// rather than kept, since sizes are measured on every commit.
+func sizeOf(dt *twin.DigitalTwin) int64 {
+	var c counter
+	if err := json.NewEncoder(&c).Encode(dt.Clone()); err != nil {
+		return 0
+	}
+	return int64(c) - 1 // Without the newline of Encode
+}
+
+// SetBudget limits the twins kept in memory. When a create would exceed the
+// budget, the least recently used twins idle for at least MinIdle are saved
+// to the store and dropped from memory; without a store, or without idle
+// twins, the create fails with ErrMemoryBudgetExceeded. Evicted twins are
+// loaded again when they are accessed by ID, including within transactions,
+// but List and the Find methods only see resident twins. A zero budget
+// removes all limits but keeps evicted twins in the store.
+func (r *Registry) SetBudget(budget Budget, store Store) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	m := &r.memory
+	m.budget, m.store = budget, store
+	if !budget.enabled() {
+		m.usage, m.bytes = nil, 0
+		return
+	}
+
+	if m.usage == nil {
+		m.usage = make(map[string]*usage, len(r.twins))
+		for _, dt := range r.twins {
+			r.account(dt)
+		}
+	}
+	r.evict(0, 0, "")
+}
+
+// account updates the size of a resident twin; the caller must hold the mutex
+func (r *Registry) account(dt *twin.DigitalTwin) {
+	m := &r.memory
+	if m.usage == nil {
+		return
+	}
+
+	u, exists := m.usage[dt.ID]
+	if !exists {
+		u = &usage{}
+		u.touch(r.now())
+		m.usage[dt.ID] = u
+	}
+	size := sizeOf(dt)
+	m.bytes += size - u.size
+	u.twinType, u.size = dt.Type, size
+}
+
+// forget drops the accounting and the stored copy of a deleted twin. Twins
+// loaded from the store or checkpointed keep a copy there, so the copy is
+// removed even if the twin is resident. The caller must hold the mutex.
+func (r *Registry) forget(id string) {
+	m := &r.memory
+	if u, exists := m.usage[id]; exists {
+		m.bytes -= u.size
+		delete(m.usage, id)
+	}
+	delete(m.evicted, id)
+	if m.store != nil {
+		m.store.Remove(id)
+	}
+}
+
+// touch records that a resident twin was used; the caller must hold at least
+// the read lock
+func (r *Registry) touch(id string) {
+	if u, exists := r.memory.usage[id]; exists {
+		u.touch(r.now())
+	}
+}
+
+// over reports whether the resident twins, with room for a twin of the given
+// size if count is 1, exceed the budget; the caller must hold the mutex
+func (r *Registry) over(size int64, count int) bool {
+	m := &r.memory
+	if m.budget.MaxBytes > 0 && m.bytes+size > m.budget.MaxBytes {
+		return true
+	}
+	return m.budget.MaxTwins > 0 && len(m.usage)+count > m.budget.MaxTwins
+}
+
+// evict moves the least recently used idle twins other than keep to the
+// store until there is room for a twin of the given size if count is 1, and
+// reports whether there is; the caller must hold the mutex
+func (r *Registry) evict(size int64, count int, keep string) bool {
+	m := &r.memory
+	if m.usage == nil || !r.over(size, count) {
+		return true
+	}
+	if m.store == nil {
+		return false
+	}
+
+	idleSince := r.now().Add(-m.budget.MinIdle).UnixNano()
+	var candidates []string
+	for id, u := range m.usage {
+		if id != keep && u.lastUsed.Load() <= idleSince {
+			candidates = append(candidates, id)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return m.usage[candidates[i]].lastUsed.Load() < m.usage[candidates[j]].lastUsed.Load()
+	})
+
+	for _, id := range candidates {
+		if !r.over(size, count) {
+			break
+		}
+		if err := m.store.Save(r.twins[id].Clone()); err != nil {
+			// Keep the twin; the store may be available again later
+			continue
+		}
+
+		u := m.usage[id]
+		if m.evicted == nil {
+			m.evicted = make(map[string]evictedTwin)
+		}
+		m.evicted[id] = evictedTwin{twinType: u.twinType, size: u.size}
+		m.bytes -= u.size
+		m.evictions++
+		delete(m.usage, id)
+		delete(r.twins, id)
+	}
+	return !r.over(size, count)
+}
+
+// resident returns a twin, loading it from the store if it was evicted; the
+// caller must hold the mutex
+func (r *Registry) resident(id string) (*twin.DigitalTwin, error) {
+	if dt, exists := r.twins[id]; exists {
+		r.touch(id)
+		return dt, nil
+	}
+
+	m := &r.memory
+	if !r.evictedExists(id) {
+		return nil, ErrTwinNotFound
+	}
+
+	dt, err := m.store.Load(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load evicted twin %s: %w", id, err)
+	}
+
+	delete(m.evicted, id)
+	dt.SetClock(r.clock)
+	r.twins[id] = dt
+	m.restores++
+	r.account(dt)
+	r.indexes.update(dt)
+	r.external.update(dt)
+	r.evict(0, 0, id)
+	return dt, nil
+}
+
+// evictedExists reports whether a twin was evicted; the caller must hold at
+// least the read lock
+func (r *Registry) evictedExists(id string) bool {
+	_, exists := r.memory.evicted[id]
+	return exists && r.memory.store != nil
+}
+
+// MemoryUsage returns the memory used by resident twins, in total and per
+// twin type. Without a budget, sizes are measured on each call.
+func (r *Registry) MemoryUsage() MemoryUsage {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	m := &r.memory
+	result := MemoryUsage{
+		Budget:    m.budget,
+		Twins:     len(r.twins),
+		Evicted:   len(m.evicted),
+		Evictions: m.evictions,
+		Restores:  m.restores,
+		Rejected:  m.rejected,
+		Types:     make(map[string]TypeUsage),
+	}
+
+	for id, dt := range r.twins {
+		var size int64
+		if u, exists := m.usage[id]; exists {
+			size = u.size
+		} else {
+			size = sizeOf(dt)
+		}
+
+		t := result.Types[dt.Type]
+		t.Twins++
+		t.Bytes += size
+		result.Types[dt.Type] = t
+		result.Bytes += size
+	}
+	for _, e := range m.evicted {
+		t := result.Types[e.twinType]
+		t.Evicted++
+		result.Types[e.twinType] = t
+	}
+	return result
+}
+
+// objectStore keeps evicted twins as JSON objects
+type objectStore struct {
+	store  objstore.Store
+	prefix string
+}
+
+// NewObjectStore returns a store keeping evicted twins as JSON objects under
+// prefix
+func NewObjectStore(store objstore.Store, prefix string) Store {
+	return &objectStore{store: store, prefix: prefix}
+}
+
+// key returns the object key of a twin
+func (s *objectStore) key(id string) string {
+	return s.prefix + "twins/" + url.PathEscape(id) + ".json"
+}
+
+// Save writes a twin
+func (s *objectStore) Save(dt *twin.DigitalTwin) error {
+	data, err := json.Marshal(dt)
+	if err != nil {
+		return err
+	}
+	return s.store.Put(context.Background(), s.key(dt.ID), data)
+}
+
+// Load reads a twin
+func (s *objectStore) Load(id string) (*twin.DigitalTwin, error) {
+	data, err := s.store.Get(context.Background(), s.key(id))
+	if err != nil {
+		return nil, err
+	}
+
+	var dt twin.DigitalTwin
+	if err := json.Unmarshal(data, &dt); err != nil {
+		return nil, err
+	}
+	return &dt, nil
+}
+
+// Remove deletes the object of a twin
+func (s *objectStore) Remove(id string) error {
+	return s.store.Delete(context.Background(), s.key(id))
+}
+
+// IDs lists the twins kept in the store
+func (s *objectStore) IDs() ([]string, error) {
+	prefix := s.prefix + "twins/"
+	keys, err := s.store.List(context.Background(), prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(keys))
+	for _, key := range keys {
+		name, ok := strings.CutSuffix(strings.TrimPrefix(key, prefix), ".json")
+		if id, err := url.PathUnescape(name); ok && err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
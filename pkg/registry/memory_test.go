@@ -0,0 +1,146 @@
+package registry
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/clock"
+	"github.com/aleka07/go-digital-twin/pkg/objstore"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestBudgetWithoutStore(t *testing.T) {
+	reg := NewRegistry()
+	reg.SetBudget(Budget{MaxTwins: 2}, nil)
+
+	reg.Create(twin.NewDigitalTwin("pump-1", "pump"))
+	reg.Create(twin.NewDigitalTwin("pump-2", "pump"))
+
+	if err := reg.Create(twin.NewDigitalTwin("pump-3", "pump")); !errors.Is(err, ErrMemoryBudgetExceeded) {
+		t.Errorf("Expected ErrMemoryBudgetExceeded, got %v", err)
+	}
+	if _, err := reg.Get("pump-3"); err != ErrTwinNotFound {
+		t.Errorf("Expected the rejected twin not to exist, got %v", err)
+	}
+
+	// Deleting a twin makes room again
+	reg.Delete("pump-1")
+	if err := reg.Create(twin.NewDigitalTwin("pump-3", "pump")); err != nil {
+		t.Errorf("Failed to create twin: %v", err)
+	}
+
+	if usage := reg.MemoryUsage(); usage.Twins != 2 || usage.Rejected != 1 || usage.Evicted != 0 {
+		t.Errorf("Unexpected usage %+v", usage)
+	}
+}
+
+func TestEviction(t *testing.T) {
+	reg := NewRegistry()
+	store := NewObjectStore(objstore.NewMemoryStore(), "evicted/")
+	reg.SetBudget(Budget{MaxTwins: 2}, store)
+
+	for _, id := range []string{"pump-1", "pump-2"} {
+		dt := twin.NewDigitalTwin(id, "pump")
+		dt.SetAttribute("site", "north")
+		reg.Create(dt)
+		time.Sleep(time.Millisecond)
+	}
+
+	// pump-2 is used more recently, so pump-1 is evicted
+	reg.Get("pump-2")
+	if err := reg.Create(twin.NewDigitalTwin("valve-1", "valve")); err != nil {
+		t.Fatalf("Failed to create twin: %v", err)
+	}
+	if len(reg.List()) != 2 || len(reg.FindByAttribute("site", "north")) != 1 {
+		t.Errorf("Expected pump-1 to be evicted, got %d resident twins", len(reg.List()))
+	}
+
+	usage := reg.MemoryUsage()
+	if usage.Evicted != 1 || usage.Evictions != 1 || usage.Types["pump"].Evicted != 1 || usage.Types["valve"].Twins != 1 {
+		t.Errorf("Unexpected usage %+v", usage)
+	}
+	if usage.Types["pump"].Bytes == 0 || usage.Bytes != usage.Types["pump"].Bytes+usage.Types["valve"].Bytes {
+		t.Errorf("Unexpected sizes %+v", usage)
+	}
+
+	// Evicted twins still exist
+	if err := reg.Create(twin.NewDigitalTwin("pump-1", "pump")); err != ErrTwinAlreadyExists {
+		t.Errorf("Expected ErrTwinAlreadyExists, got %v", err)
+	}
+	twins, _, err := reg.Snapshot([]string{"pump-1"})
+	if err != nil || len(twins) != 1 {
+		t.Fatalf("Failed to snapshot an evicted twin: %v", err)
+	}
+
+	// Accessing an evicted twin loads it again, evicting another one
+	dt, err := reg.Get("pump-1")
+	if err != nil {
+		t.Fatalf("Failed to get evicted twin: %v", err)
+	}
+	if v, _ := dt.GetAttribute("site"); v != "north" || dt.GetRevision() != 1 {
+		t.Errorf("Expected the evicted twin to be restored, got %v at revision %d", v, dt.GetRevision())
+	}
+	if usage := reg.MemoryUsage(); usage.Twins != 2 || usage.Evicted != 1 || usage.Restores != 1 {
+		t.Errorf("Unexpected usage %+v", usage)
+	}
+
+	// Evicted twins can be updated and deleted
+	evicted := ""
+	for _, id := range []string{"pump-2", "valve-1"} {
+		if !hasTwin(reg.List(), id) {
+			evicted = id
+		}
+	}
+	if _, err := reg.Transaction(func(tx *Tx) error {
+		_, err := tx.Get(evicted)
+		return err
+	}); err != nil {
+		t.Errorf("Failed to get evicted twin in a transaction: %v", err)
+	}
+	if err := reg.Delete("pump-1"); err != nil {
+		t.Errorf("Failed to delete twin: %v", err)
+	}
+}
+
+func TestBudgetMinIdle(t *testing.T) {
+	reg := NewRegistry()
+	reg.SetBudget(Budget{MaxTwins: 1, MinIdle: time.Hour}, NewObjectStore(objstore.NewMemoryStore(), ""))
+
+	reg.Create(twin.NewDigitalTwin("pump-1", "pump"))
+	if err := reg.Create(twin.NewDigitalTwin("pump-2", "pump")); !errors.Is(err, ErrMemoryBudgetExceeded) {
+		t.Errorf("Expected ErrMemoryBudgetExceeded while no twin is idle, got %v", err)
+	}
+}
+
+func TestBudgetMinIdleClock(t *testing.T) {
+	fake := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	reg := NewRegistry()
+	reg.SetClock(fake)
+	reg.SetBudget(Budget{MaxTwins: 1, MinIdle: time.Hour}, NewObjectStore(objstore.NewMemoryStore(), ""))
+
+	reg.Create(twin.NewDigitalTwin("pump-1", "pump"))
+	fake.Advance(59 * time.Minute)
+	reg.Get("pump-1")
+	fake.Advance(59 * time.Minute)
+	if err := reg.Create(twin.NewDigitalTwin("pump-2", "pump")); !errors.Is(err, ErrMemoryBudgetExceeded) {
+		t.Errorf("Expected pump-1 to be in use, got %v", err)
+	}
+
+	fake.Advance(time.Minute)
+	if err := reg.Create(twin.NewDigitalTwin("pump-2", "pump")); err != nil {
+		t.Errorf("Expected pump-1 to be evicted once idle for an hour, got %v", err)
+	}
+	if pump, _ := reg.Get("pump-2"); !pump.GetModifiedAt().Equal(fake.Now()) {
+		t.Errorf("Expected the commit time from the clock, got %v", pump.GetModifiedAt())
+	}
+}
+
+func hasTwin(twins []*twin.DigitalTwin, id string) bool {
+	for _, dt := range twins {
+		if dt.ID == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,212 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// ErrInvalidStrategy is returned for unknown merge strategies
+var ErrInvalidStrategy = errors.New("invalid merge strategy")
+
+// MergeStrategy decides which value is kept for an attribute or property
+// set on both twins of a merge
+type MergeStrategy string
+
+// Merge strategies
+const (
+	TargetWins MergeStrategy = "target-wins" // The value of the twin merged into is kept
+	SourceWins MergeStrategy = "source-wins" // The value of the merged twin replaces it
+	NewestWins MergeStrategy = "newest-wins" // The value set last is kept
+)
+
+// ParseMergeStrategy parses a merge strategy, TargetWins when empty
+func ParseMergeStrategy(s string) (MergeStrategy, error) {
+	switch m := MergeStrategy(s); m {
+	case "":
+		return TargetWins, nil
+	case TargetWins, SourceWins, NewestWins:
+		return m, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrInvalidStrategy, s)
+}
+
+// maxRedirects bounds the chain of merges Redirect follows
+const maxRedirects = 16
+
+// Merge merges a duplicate source twin into a target twin and deletes the
+// source, all at a single new version. Attributes, features, properties and
+// relationships the target lacks are copied from the source; values both
+// have are decided by the strategy. Links between the two twins are dropped
+// rather than becoming links of the target to itself, and the relationships
+// of other twins to the source are pointed at the target. The target keeps
+// its ID, type, lifecycle and system attributes. The source is remembered
+// as merged, see Redirect. Merge returns the IDs of the other twins whose
+// relationships were changed, in order.
+func (r *Registry) Merge(targetID, sourceID string, strategy MergeStrategy) ([]string, error) {
+	if _, err := ParseMergeStrategy(string(strategy)); err != nil {
+		return nil, err
+	}
+
+	var referrers []string
+	_, err := r.Transaction(func(tx *Tx) error {
+		target, err := tx.Get(targetID)
+		if err != nil {
+			return err
+		}
+		source, err := tx.Get(sourceID)
+		if err != nil {
+			return err
+		}
+		if targetID == sourceID {
+			return fmt.Errorf("%w: a twin cannot be merged into itself", ErrInvalidID)
+		}
+
+		mergeTwin(target, source, strategy)
+		target.ModifiedAt = r.now()
+		if err := tx.Delete(sourceID); err != nil {
+			return err
+		}
+
+		for id, dt := range r.twins {
+			if id != sourceID && id != targetID && targets(dt, sourceID) {
+				referrers = append(referrers, id)
+			}
+		}
+		for id := range r.memory.evicted {
+			if r.memory.store == nil {
+				break
+			}
+			if id == sourceID || id == targetID {
+				continue
+			}
+			stored, err := r.memory.store.Load(id)
+			if err != nil {
+				return fmt.Errorf("failed to read stored twin %s: %w", id, err)
+			}
+			if targets(stored, sourceID) {
+				referrers = append(referrers, id)
+			}
+		}
+		sort.Strings(referrers)
+
+		for _, id := range referrers {
+			dt, err := tx.Get(id)
+			if err != nil {
+				return err
+			}
+			repoint(dt, sourceID, targetID)
+		}
+
+		// Nothing fails after fn, so the merge is remembered as it commits
+		if r.merged == nil {
+			r.merged = make(map[string]string)
+		}
+		r.merged[sourceID] = targetID
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return referrers, nil
+}
+
+// Redirect returns the twin a twin that no longer exists was merged into,
+// following later merges of that twin. It reports false for twins that
+// exist or were not merged. Merged twins are only remembered in memory.
+func (r *Registry) Redirect(id string) (string, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	target, merged := r.merged[id]
+	if !merged {
+		return "", false
+	}
+	if _, exists := r.twins[id]; exists || r.evictedExists(id) {
+		return "", false
+	}
+	for i := 0; i < maxRedirects; i++ {
+		next, merged := r.merged[target]
+		if !merged {
+			break
+		}
+		if _, exists := r.twins[target]; exists || r.evictedExists(target) {
+			break
+		}
+		target = next
+	}
+	return target, true
+}
+
+// mergeTwin merges the state of a source twin into a target twin. Both must
+// be working copies of a transaction.
+func mergeTwin(target, source *twin.DigitalTwin, strategy MergeStrategy) {
+	newer := source.ModifiedAt.After(target.ModifiedAt)
+	for key, value := range source.Attributes {
+		if key == twin.SystemAttribute {
+			continue
+		}
+		if _, exists := target.Attributes[key]; !exists || wins(strategy, newer) {
+			target.Attributes[key] = value
+		}
+	}
+
+	for id, sf := range source.Features {
+		tf, exists := target.Features[id]
+		if !exists {
+			target.Features[id] = sf.Clone()
+			continue
+		}
+		mergeFeature(tf, sf, strategy)
+	}
+
+	for name, ids := range source.Relationships {
+		for _, id := range ids {
+			if id != source.ID && id != target.ID {
+				target.AddRelationship(name, id)
+			}
+		}
+	}
+	for name, ids := range target.GetAllRelationships() {
+		for _, id := range ids {
+			if id == source.ID {
+				target.RemoveRelationship(name, id)
+			}
+		}
+	}
+}
+
+// mergeFeature merges the properties of a source feature into a target
+// feature. Property timestamps decide which value is newer, and the
+// modification times of the features which desired value is.
+func mergeFeature(target, source *twin.FeatureState, strategy MergeStrategy) {
+	for key, value := range source.Properties {
+		_, exists := target.Properties[key]
+		newer := source.Metadata[key].Timestamp.After(target.Metadata[key].Timestamp)
+		if !exists || wins(strategy, newer) {
+			target.Properties[key] = value
+			if meta, ok := source.Metadata[key]; ok {
+				target.Metadata[key] = meta
+			} else {
+				delete(target.Metadata, key)
+			}
+		}
+	}
+
+	newer := source.LastModified.After(target.LastModified)
+	for key, value := range source.DesiredProps {
+		if _, exists := target.DesiredProps[key]; !exists || wins(strategy, newer) {
+			target.DesiredProps[key] = value
+		}
+	}
+	if newer {
+		target.LastModified = source.LastModified
+	}
+}
+
+// wins reports whether the value of the source replaces a value of the target
+func wins(strategy MergeStrategy, newer bool) bool {
+	return strategy == SourceWins || (strategy == NewestWins && newer)
+}
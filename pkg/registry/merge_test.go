@@ -0,0 +1,134 @@
+package registry
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestMerge(t *testing.T) {
+	setup := func() *Registry {
+		reg := NewRegistry()
+		now := time.Now()
+
+		pump := twin.NewDigitalTwin("pump-1", "pump")
+		pump.SetAttribute("serialNumber", "SN-1")
+		pump.SetAttribute("site", "north")
+		motor := twin.NewFeatureState()
+		motor.SetPropertyAt("rpm", 1450.0, now.Add(-time.Hour))
+		pump.AddFeature("motor", motor)
+		pump.AddRelationship("feeds", "tank-1")
+		pump.AddRelationship("backup", "pump-1b")
+		pump.ModifiedAt = now.Add(-time.Hour)
+		reg.Create(pump)
+
+		duplicate := twin.NewDigitalTwin("pump-1b", "pump")
+		duplicate.SetAttribute("site", "south")
+		duplicate.SetAttribute("vendor", "acme")
+		motor = twin.NewFeatureState()
+		motor.SetPropertyAt("rpm", 1500.0, now)
+		motor.SetProperty("temperature", 60.0)
+		duplicate.AddFeature("motor", motor)
+		duplicate.AddFeature("seal", twin.NewFeatureState())
+		duplicate.AddRelationship("feeds", "tank-2")
+		duplicate.AddRelationship("backup", "pump-1")
+		reg.Create(duplicate)
+
+		line := twin.NewDigitalTwin("line-1", "line")
+		line.SetRelationship("drives", []string{"pump-1", "pump-1b"})
+		reg.Create(line)
+		return reg
+	}
+
+	for _, tc := range []struct {
+		strategy  MergeStrategy
+		site, rpm interface{}
+	}{
+		{TargetWins, "north", 1450.0},
+		{SourceWins, "south", 1500.0},
+		{NewestWins, "south", 1500.0},
+	} {
+		reg := setup()
+		version := reg.Version()
+
+		referrers, err := reg.Merge("pump-1", "pump-1b", tc.strategy)
+		if err != nil {
+			t.Fatalf("%s: merge failed: %v", tc.strategy, err)
+		}
+		if !reflect.DeepEqual(referrers, []string{"line-1"}) || reg.Version() != version+1 {
+			t.Errorf("%s: expected line-1 to be repointed at one new version, got %v at %d", tc.strategy, referrers, reg.Version())
+		}
+		if _, err := reg.Get("pump-1b"); err != ErrTwinNotFound {
+			t.Errorf("%s: expected pump-1b to be gone, got %v", tc.strategy, err)
+		}
+
+		pump, _ := reg.Get("pump-1")
+		site, _ := pump.GetAttribute("site")
+		vendor, _ := pump.GetAttribute("vendor")
+		serial, _ := pump.GetAttribute("serialNumber")
+		if site != tc.site || vendor != "acme" || serial != "SN-1" {
+			t.Errorf("%s: unexpected site %v, vendor %v and serial number %v", tc.strategy, site, vendor, serial)
+		}
+		motor, _ := pump.GetFeature("motor")
+		rpm, _ := motor.GetProperty("rpm")
+		temperature, _ := motor.GetProperty("temperature")
+		if rpm != tc.rpm || temperature != 60.0 {
+			t.Errorf("%s: unexpected motor rpm %v and temperature %v", tc.strategy, rpm, temperature)
+		}
+		if _, exists := pump.GetFeature("seal"); !exists {
+			t.Errorf("%s: expected the seal feature of pump-1b", tc.strategy)
+		}
+		if got := pump.GetAllRelationships(); !reflect.DeepEqual(got, map[string][]string{"feeds": {"tank-1", "tank-2"}}) {
+			t.Errorf("%s: expected the feeds of both twins and no links between them, got %v", tc.strategy, got)
+		}
+		line, _ := reg.Get("line-1")
+		if drives := line.GetRelationship("drives"); !reflect.DeepEqual(drives, []string{"pump-1"}) {
+			t.Errorf("%s: expected line-1 to drive pump-1 only, got %v", tc.strategy, drives)
+		}
+
+		if to, merged := reg.Redirect("pump-1b"); !merged || to != "pump-1" {
+			t.Errorf("%s: expected pump-1b to redirect to pump-1, got %q %v", tc.strategy, to, merged)
+		}
+	}
+}
+
+func TestMergeRedirects(t *testing.T) {
+	reg := NewRegistry()
+	for _, id := range []string{"a", "b", "c"} {
+		reg.Create(twin.NewDigitalTwin(id, "pump"))
+	}
+	reg.Merge("b", "a", TargetWins)
+	reg.Merge("c", "b", TargetWins)
+
+	// Merges are followed to the twin that still exists
+	if to, merged := reg.Redirect("a"); !merged || to != "c" {
+		t.Errorf("Expected a to redirect to c, got %q %v", to, merged)
+	}
+	if _, merged := reg.Redirect("c"); merged {
+		t.Error("Expected no redirect for an existing twin")
+	}
+
+	// A twin created again under a merged ID is no longer redirected
+	reg.Create(twin.NewDigitalTwin("a", "pump"))
+	if _, merged := reg.Redirect("a"); merged {
+		t.Error("Expected no redirect for a twin created again")
+	}
+
+	for _, tc := range []struct {
+		target, source string
+		strategy       MergeStrategy
+		err            error
+	}{
+		{"c", "missing", TargetWins, ErrTwinNotFound},
+		{"missing", "c", TargetWins, ErrTwinNotFound},
+		{"c", "c", TargetWins, ErrInvalidID},
+		{"c", "a", "oldest-wins", ErrInvalidStrategy},
+	} {
+		if _, err := reg.Merge(tc.target, tc.source, tc.strategy); !errors.Is(err, tc.err) {
+			t.Errorf("%s into %s: expected %v, got %v", tc.source, tc.target, tc.err, err)
+		}
+	}
+}
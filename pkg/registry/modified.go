@@ -0,0 +1,115 @@
+package registry
+
+import (
+	"sort"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// minCompaction is the number of stale index entries below which the
+// modification index is not compacted
+const minCompaction = 64
+
+// modEntry records that a twin was committed at a time
+type modEntry struct {
+	at time.Time
+	id string
+}
+
+// modIndex orders twins by the time their last change was committed. Entries
+// are appended in commit order, so the index stays sorted; entries superseded
+// by a later commit or a deletion are skipped and compacted away over time.
+type modIndex struct {
+	entries []modEntry
+	latest  map[string]time.Time // Twin ID -> time of its last commit
+	last    time.Time
+	stale   int
+}
+
+// commit records a commit of twins at a time and stamps their modification
+// time. Commit times never go backwards, even if the clock does.
+func (x *modIndex) commit(now time.Time, twins ...*twin.DigitalTwin) {
+	if x.latest == nil {
+		x.latest = make(map[string]time.Time)
+	}
+
+	now = now.Round(0)
+	if !now.After(x.last) {
+		now = x.last.Add(time.Nanosecond)
+	}
+	x.last = now
+
+	for _, dt := range twins {
+		if _, exists := x.latest[dt.ID]; exists {
+			x.stale++
+		}
+		x.latest[dt.ID] = now
+		x.entries = append(x.entries, modEntry{at: now, id: dt.ID})
+		dt.SetModifiedAt(now)
+	}
+	x.compact()
+}
+
+// remove forgets a deleted twin
+func (x *modIndex) remove(id string) {
+	if _, exists := x.latest[id]; exists {
+		delete(x.latest, id)
+		x.stale++
+		x.compact()
+	}
+}
+
+// between returns the IDs of twins whose last commit is at or after since and
+// before before, in commit order. Zero times leave the range open.
+func (x *modIndex) between(since, before time.Time) []string {
+	start := sort.Search(len(x.entries), func(i int) bool {
+		return !x.entries[i].at.Before(since)
+	})
+
+	var ids []string
+	for _, e := range x.entries[start:] {
+		if !before.IsZero() && !e.at.Before(before) {
+			break
+		}
+		if latest, exists := x.latest[e.id]; exists && latest.Equal(e.at) {
+			ids = append(ids, e.id)
+		}
+	}
+	return ids
+}
+
+// compact drops stale entries once they make up half of the index
+func (x *modIndex) compact() {
+	if x.stale < minCompaction || x.stale*2 < len(x.entries) {
+		return
+	}
+
+	entries := make([]modEntry, 0, len(x.latest))
+	for _, e := range x.entries {
+		if latest, exists := x.latest[e.id]; exists && latest.Equal(e.at) {
+			entries = append(entries, e)
+		}
+	}
+	x.entries = entries
+	x.stale = 0
+}
+
+// ModifiedBetween returns the twins whose last committed change falls in
+// [since, before), ordered by that time. A zero since or before leaves that
+// end of the range open. Each twin's ModifiedAt holds its commit time, so
+// incremental sync jobs can pass the latest ModifiedAt they have seen as
+// the next since.
+func (r *Registry) ModifiedBetween(since, before time.Time) []*twin.DigitalTwin {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	ids := r.modified.between(since, before)
+	twins := make([]*twin.DigitalTwin, 0, len(ids))
+	for _, id := range ids {
+		if dt, exists := r.twins[id]; exists {
+			twins = append(twins, dt)
+		}
+	}
+	return twins
+}
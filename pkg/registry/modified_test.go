@@ -0,0 +1,86 @@
+package registry
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func ids(twins []*twin.DigitalTwin) []string {
+	result := make([]string, len(twins))
+	for i, dt := range twins {
+		result[i] = dt.ID
+	}
+	return result
+}
+
+func TestModifiedBetween(t *testing.T) {
+	reg := NewRegistry()
+
+	reg.Create(twin.NewDigitalTwin("a", "sensor"))
+	reg.Create(twin.NewDigitalTwin("b", "sensor"))
+	reg.Create(twin.NewDigitalTwin("c", "sensor"))
+
+	a, _ := reg.Get("a")
+	b, _ := reg.Get("b")
+	checkpoint := b.GetModifiedAt()
+
+	// Updating a moves it to the end
+	a.SetAttribute("room", "lobby")
+	reg.Update(a)
+
+	if got := ids(reg.ModifiedBetween(time.Time{}, time.Time{})); fmt.Sprint(got) != "[b c a]" {
+		t.Errorf("Expected [b c a], got %v", got)
+	}
+	if got := ids(reg.ModifiedBetween(checkpoint, time.Time{})); fmt.Sprint(got) != "[b c a]" {
+		t.Errorf("Expected [b c a] since b, got %v", got)
+	}
+	if got := ids(reg.ModifiedBetween(checkpoint.Add(time.Nanosecond), time.Time{})); fmt.Sprint(got) != "[c a]" {
+		t.Errorf("Expected [c a] after b, got %v", got)
+	}
+	if got := ids(reg.ModifiedBetween(time.Time{}, a.GetModifiedAt())); fmt.Sprint(got) != "[b c]" {
+		t.Errorf("Expected [b c] before a, got %v", got)
+	}
+
+	// Commit times are unique and stamped on the twins
+	if !a.GetModifiedAt().After(checkpoint) {
+		t.Errorf("Expected a to be modified after b, got %v and %v", a.GetModifiedAt(), checkpoint)
+	}
+
+	reg.Delete("c")
+	if got := ids(reg.ModifiedBetween(time.Time{}, time.Time{})); fmt.Sprint(got) != "[b a]" {
+		t.Errorf("Expected [b a] after deleting c, got %v", got)
+	}
+
+	// Transactions commit all their twins at once
+	reg.Transaction(func(tx *Tx) error {
+		dt, err := tx.Get("b")
+		if err != nil {
+			return err
+		}
+		dt.SetAttribute("room", "office")
+		return tx.Create(twin.NewDigitalTwin("d", "sensor"))
+	})
+	if got := ids(reg.ModifiedBetween(a.GetModifiedAt().Add(time.Nanosecond), time.Time{})); len(got) != 2 {
+		t.Errorf("Expected b and d to be modified by the transaction, got %v", got)
+	}
+}
+
+func TestModifiedIndexCompaction(t *testing.T) {
+	reg := NewRegistry()
+	dt := twin.NewDigitalTwin("a", "sensor")
+	reg.Create(dt)
+
+	for i := 0; i < 1000; i++ {
+		reg.Update(dt)
+	}
+
+	if n := len(reg.modified.entries); n > 2*minCompaction {
+		t.Errorf("Expected the index to be compacted, got %d entries", n)
+	}
+	if got := ids(reg.ModifiedBetween(time.Time{}, time.Time{})); len(got) != 1 {
+		t.Errorf("Expected a single twin, got %v", got)
+	}
+}
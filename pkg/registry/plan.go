@@ -0,0 +1,101 @@
+package registry
+
+import (
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/query"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// Query strategies
+const (
+	StrategyScan  = "scan"  // Every twin in memory is evaluated
+	StrategyIndex = "index" // Only the twins an index returns are evaluated
+)
+
+// IndexUse describes an indexed equality condition of a query
+type IndexUse struct {
+	Path       string      `json:"path"`
+	Value      interface{} `json:"value"`
+	Candidates int         `json:"candidates"` // Twins indexed under the value
+	Used       bool        `json:"used"`
+}
+
+// Explanation describes how a query was run
+type Explanation struct {
+	Strategy  string     `json:"strategy"`
+	Indexes   []IndexUse `json:"indexes"`   // Indexed conditions considered, in query order
+	Estimated int        `json:"estimated"` // Twins the planner expected to evaluate
+	Scanned   int        `json:"scanned"`   // Twins actually evaluated
+	Matched   int        `json:"matched"`
+	PlanTime  string     `json:"planTime"`
+	ExecTime  string     `json:"execTime"`
+}
+
+// Find returns the twins in memory matching a query. If the query compares
+// indexed paths for equality, the twins are looked up in the index with the
+// fewest candidates instead of scanning every twin.
+func (r *Registry) Find(q *query.Query) []*twin.DigitalTwin {
+	twins, _ := r.Explain(q)
+	return twins
+}
+
+// Explain runs a query like Find and describes how it was run. Scans only
+// evaluate the twins in memory, while twins in the store that an index
+// returns are read from the store without loading them.
+func (r *Registry) Explain(q *query.Query) ([]*twin.DigitalTwin, Explanation) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	start := time.Now()
+	e := Explanation{Strategy: StrategyScan, Indexes: []IndexUse{}, Estimated: len(r.twins)}
+	var best *index
+	var candidates map[string]struct{}
+	used := -1
+	for _, c := range q.Conditions {
+		x, indexed := r.indexes[c.Path]
+		if !indexed || c.Op != query.OpEqual {
+			continue
+		}
+		ids := x.twins[indexKey(c.Value)]
+		e.Indexes = append(e.Indexes, IndexUse{Path: c.Path, Value: c.Value, Candidates: len(ids)})
+		if best == nil || len(ids) < len(candidates) {
+			best, candidates = x, ids
+			used = len(e.Indexes) - 1
+		}
+	}
+	if best != nil {
+		best.lookups.Add(1)
+		e.Strategy = StrategyIndex
+		e.Estimated = len(candidates)
+		e.Indexes[used].Used = true
+	}
+	planned := time.Now()
+	e.PlanTime = planned.Sub(start).String()
+
+	result := []*twin.DigitalTwin{}
+	evaluate := func(dt *twin.DigitalTwin) {
+		e.Scanned++
+		if q.Matches(dt) {
+			result = append(result, dt)
+		}
+	}
+	if best == nil {
+		for _, dt := range r.twins {
+			evaluate(dt)
+		}
+	} else {
+		for id := range candidates {
+			if dt, resident := r.twins[id]; resident {
+				evaluate(dt)
+			} else if r.evictedExists(id) {
+				if stored, err := r.memory.store.Load(id); err == nil {
+					evaluate(stored)
+				}
+			}
+		}
+	}
+	e.Matched = len(result)
+	e.ExecTime = time.Since(planned).String()
+	return result, e
+}
@@ -0,0 +1,40 @@
+package registry
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/query"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestExplain(t *testing.T) {
+	reg := NewRegistry()
+	for i := 0; i < 20; i++ {
+		dt := twin.NewDigitalTwin(fmt.Sprintf("pump-%d", i), "pump")
+		dt.SetAttribute("site", fmt.Sprintf("site-%d", i%2))
+		dt.SetAttribute("line", float64(i%10))
+		reg.Create(dt)
+	}
+
+	q, _ := query.Parse("attributes.site == site-1 and attributes.line == 3")
+	twins, e := reg.Explain(q)
+	if e.Strategy != StrategyScan || e.Estimated != 20 || e.Scanned != 20 || e.Matched != 2 || len(twins) != 2 || len(e.Indexes) != 0 {
+		t.Errorf("Unexpected scan %+v", e)
+	}
+
+	reg.CreateIndex("attributes.site")
+	reg.CreateIndex("attributes.line")
+	twins, e = reg.Explain(q)
+	if e.Strategy != StrategyIndex || e.Estimated != 2 || e.Scanned != 2 || e.Matched != 2 || len(twins) != 2 {
+		t.Errorf("Unexpected index lookup %+v", e)
+	}
+	if got := fmt.Sprint(e.Indexes); got != "[{attributes.site site-1 10 false} {attributes.line 3 2 true}]" {
+		t.Errorf("Unexpected indexes %s", got)
+	}
+
+	q, _ = query.Parse("attributes.site == site-9")
+	if twins, e = reg.Explain(q); e.Estimated != 0 || e.Scanned != 0 || len(twins) != 0 {
+		t.Errorf("Expected nothing to be scanned for an unknown value, got %+v", e)
+	}
+}
@@ -2,8 +2,12 @@ package registry
 
 import (
 	"errors"
+	"fmt"
 	"sync"
+	"time"
 
+	"github.com/aleka07/go-digital-twin/pkg/clock"
+	"github.com/aleka07/go-digital-twin/pkg/query"
 	"github.com/aleka07/go-digital-twin/pkg/twin"
 )
 
@@ -11,57 +15,158 @@ import (
 var (
 	ErrTwinNotFound      = errors.New("digital twin not found")
 	ErrTwinAlreadyExists = errors.New("digital twin already exists")
+	ErrRevisionConflict  = errors.New("revision conflict")
+	ErrInvalidID         = errors.New("invalid twin ID")
 )
 
-// Registry provides thread-safe storage for digital twins
+// Twins are the operations on twins the API handlers rely on. Registry
+// implements them; other implementations, such as wrappers injecting
+// failures in tests or registries backed by a database, must pass the
+// conformance suite of package registrytest to behave the same.
+type Twins interface {
+	// Create adds a twin at revision 1, or fails with ErrTwinAlreadyExists
+	Create(dt *twin.DigitalTwin) error
+	// Get returns a twin or ErrTwinNotFound
+	Get(id string) (*twin.DigitalTwin, error)
+	// Update replaces a twin and advances its revision, failing with
+	// ErrRevisionConflict if a copy has a stale revision
+	Update(dt *twin.DigitalTwin) error
+	// Delete removes a twin or fails with ErrTwinNotFound
+	Delete(id string) error
+	// Snapshot returns copies of twins as committed at one version
+	Snapshot(ids []string) ([]*twin.DigitalTwin, uint64, error)
+	// Version returns the logical version, advanced by every commit
+	Version() uint64
+	List() []*twin.DigitalTwin
+	Count() int
+	Find(q *query.Query) []*twin.DigitalTwin
+	// ModifiedBetween returns the twins whose last commit falls in
+	// [since, before), ordered by that time; zero times leave the range open
+	ModifiedBetween(since, before time.Time) []*twin.DigitalTwin
+}
+
+// Registry provides thread-safe storage for digital twins.
+// Changes made to a twin are committed by Create, Update and Delete, each
+// of which advances the logical version of the registry.
 type Registry struct {
-	twins map[string]*twin.DigitalTwin
-	mutex sync.RWMutex
+	twins    map[string]*twin.DigitalTwin
+	version  uint64
+	modified modIndex
+	changes  changeLog
+	indexes  indexSet
+	external externalIndex
+	memory   memory
+	merged   map[string]string // Merged twin ID -> ID of the twin it was merged into
+	clock    clock.Clock
+	mutex    sync.RWMutex
 }
 
 // NewRegistry creates a new registry
 func NewRegistry() *Registry {
 	return &Registry{
 		twins: make(map[string]*twin.DigitalTwin),
+		clock: clock.System,
 	}
 }
 
-// Create adds a new digital twin to the registry
+// SetClock sets the clock that commit times and twin usage are read from;
+// nil restores the system clock. The twins stored in the registry read
+// their modification times from it as well.
+func (r *Registry) SetClock(c clock.Clock) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.clock = clock.OrSystem(c)
+	for _, dt := range r.twins {
+		dt.SetClock(r.clock)
+	}
+}
+
+// now returns the time of the registry clock; the caller must hold at
+// least the read lock
+func (r *Registry) now() time.Time {
+	return clock.OrSystem(r.clock).Now()
+}
+
+// Create adds a new digital twin to the registry. With a memory budget, it
+// fails with ErrMemoryBudgetExceeded if the twin does not fit.
 func (r *Registry) Create(dt *twin.DigitalTwin) error {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
-	if _, exists := r.twins[dt.ID]; exists {
+	if _, exists := r.twins[dt.ID]; exists || r.evictedExists(dt.ID) {
 		return ErrTwinAlreadyExists
 	}
 
+	if r.memory.usage != nil && !r.evict(sizeOf(dt), 1, "") {
+		r.memory.rejected++
+		return fmt.Errorf("%w: no idle twins can be evicted to make room for %s", ErrMemoryBudgetExceeded, dt.ID)
+	}
+
+	dt.SetRevision(1)
+	dt.SetClock(r.clock)
 	r.twins[dt.ID] = dt
+	r.modified.commit(r.now(), dt)
+	r.account(dt)
+	r.version++
+	r.changes.append(r.version, dt.GetModifiedAt(), []string{dt.ID}, nil)
+	r.indexes.update(dt)
+	r.external.update(dt)
 	return nil
 }
 
-// Get retrieves a digital twin by ID
+// Get retrieves a digital twin by ID, loading it from the store if it was
+// evicted from memory
 func (r *Registry) Get(id string) (*twin.DigitalTwin, error) {
 	r.mutex.RLock()
-	defer r.mutex.RUnlock()
-
 	dt, exists := r.twins[id]
-	if !exists {
+	if exists {
+		r.touch(id)
+	}
+	evicted := !exists && r.evictedExists(id)
+	r.mutex.RUnlock()
+
+	if exists {
+		return dt, nil
+	}
+	if !evicted {
 		return nil, ErrTwinNotFound
 	}
 
-	return dt, nil
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.resident(id)
 }
 
-// Update updates an existing digital twin
+// Update updates an existing digital twin and advances its revision.
+// Replacing the stored twin with another copy fails with ErrRevisionConflict
+// if the copy has a revision other than the stored one; copies without a
+// revision replace the stored twin unconditionally.
 func (r *Registry) Update(dt *twin.DigitalTwin) error {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
-	if _, exists := r.twins[dt.ID]; !exists {
-		return ErrTwinNotFound
+	stored, err := r.resident(dt.ID)
+	if err != nil {
+		return err
+	}
+
+	revision := stored.GetRevision()
+	if stored != dt && dt.GetRevision() != 0 && dt.GetRevision() != revision {
+		return fmt.Errorf("%w: %s is at revision %d", ErrRevisionConflict, dt.ID, revision)
 	}
 
+	dt.SetRevision(revision + 1)
+	dt.SetClock(r.clock)
 	r.twins[dt.ID] = dt
+	r.modified.commit(r.now(), dt)
+	r.account(dt)
+	r.evict(0, 0, dt.ID)
+	r.version++
+	r.changes.append(r.version, dt.GetModifiedAt(), []string{dt.ID}, nil)
+	r.indexes.update(dt)
+	r.external.update(dt)
 	return nil
 }
 
@@ -70,14 +175,54 @@ func (r *Registry) Delete(id string) error {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
-	if _, exists := r.twins[id]; !exists {
+	if _, exists := r.twins[id]; !exists && !r.evictedExists(id) {
 		return ErrTwinNotFound
 	}
 
 	delete(r.twins, id)
+	r.modified.remove(id)
+	r.forget(id)
+	r.version++
+	r.changes.append(r.version, r.now(), nil, []string{id})
+	r.indexes.remove(id)
+	r.external.remove(id)
 	return nil
 }
 
+// Version returns the logical version of the registry
+func (r *Registry) Version() uint64 {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.version
+}
+
+// Snapshot returns copies of a set of twins, in the order of their IDs, as
+// committed at a single version of the registry, together with that version
+func (r *Registry) Snapshot(ids []string) ([]*twin.DigitalTwin, uint64, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	twins := make([]*twin.DigitalTwin, len(ids))
+	for i, id := range ids {
+		dt, exists := r.twins[id]
+		if !exists {
+			if !r.evictedExists(id) {
+				return nil, 0, fmt.Errorf("%w: %s", ErrTwinNotFound, id)
+			}
+			// Evicted twins are read from the store without loading them
+			stored, err := r.memory.store.Load(id)
+			if err != nil {
+				return nil, 0, fmt.Errorf("failed to load evicted twin %s: %w", id, err)
+			}
+			dt = stored
+		}
+		twins[i] = dt.Clone()
+	}
+
+	return twins, r.version, nil
+}
+
 // List returns all digital twins in the registry
 func (r *Registry) List() []*twin.DigitalTwin {
 	r.mutex.RLock()
@@ -122,3 +267,11 @@ func (r *Registry) FindByFeature(featureID string) []*twin.DigitalTwin {
 
 	return result
 }
+
+// Count returns the number of twins in memory
+func (r *Registry) Count() int {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return len(r.twins)
+}
@@ -132,7 +132,7 @@ func TestRegistryFind(t *testing.T) {
 	
 	feature1 := twin.NewFeatureState()
 	feature1.SetProperty("temperature", 22.5)
-	dt1.AddFeature("temperature", *feature1)
+	dt1.AddFeature("temperature", feature1)
 	
 	dt2 := twin.NewDigitalTwin("twin-2", "sensor")
 	dt2.SetAttribute("location", "bedroom")
@@ -140,7 +140,7 @@ func TestRegistryFind(t *testing.T) {
 	
 	feature2 := twin.NewFeatureState()
 	feature2.SetProperty("temperature", 20.0)
-	dt2.AddFeature("temperature", *feature2)
+	dt2.AddFeature("temperature", feature2)
 	
 	dt3 := twin.NewDigitalTwin("twin-3", "actuator")
 	dt3.SetAttribute("location", "kitchen")
@@ -148,7 +148,7 @@ func TestRegistryFind(t *testing.T) {
 	
 	feature3 := twin.NewFeatureState()
 	feature3.SetProperty("state", "on")
-	dt3.AddFeature("switch", *feature3)
+	dt3.AddFeature("switch", feature3)
 	
 	// Add twins to registry
 	reg.Create(dt1)
@@ -0,0 +1,357 @@
+// Package registrytest is a conformance suite for implementations of
+// registry.Twins and registry.Store, so that registries kept in memory and
+// registries backed by persistent stores behave the same.
+package registrytest
+
+import (
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/query"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// twinsBehavior is a case of the Twins suite, run on a new registry
+type twinsBehavior struct {
+	name string
+	run  func(t *testing.T, twins registry.Twins)
+}
+
+// storeBehavior is a case of the Store suite, run on a new store
+type storeBehavior struct {
+	name string
+	run  func(t *testing.T, store registry.Store)
+}
+
+// newTwin creates a twin with a site attribute
+func newTwin(id string, site int) *twin.DigitalTwin {
+	dt := twin.NewDigitalTwin(id, "pump")
+	dt.SetAttribute("site", site)
+	return dt
+}
+
+// mustCreate creates twins, failing the test on errors
+func mustCreate(t *testing.T, twins registry.Twins, dts ...*twin.DigitalTwin) {
+	t.Helper()
+	for _, dt := range dts {
+		if err := twins.Create(dt); err != nil {
+			t.Fatalf("Failed to create %s: %v", dt.ID, err)
+		}
+	}
+}
+
+// mustGet gets a twin, failing the test on errors
+func mustGet(t *testing.T, twins registry.Twins, id string) *twin.DigitalTwin {
+	t.Helper()
+	dt, err := twins.Get(id)
+	if err != nil {
+		t.Fatalf("Failed to get %s: %v", id, err)
+	}
+	return dt
+}
+
+// expectError fails the test unless err wraps target
+func expectError(t *testing.T, err, target error) {
+	t.Helper()
+	if !errors.Is(err, target) {
+		t.Errorf("Expected %v, got %v", target, err)
+	}
+}
+
+var twinsBehaviors = []twinsBehavior{
+	{"create and get", func(t *testing.T, twins registry.Twins) {
+		mustCreate(t, twins, newTwin("pump-1", 1))
+		dt := mustGet(t, twins, "pump-1")
+		if dt.ID != "pump-1" || dt.Type != "pump" || dt.GetRevision() != 1 {
+			t.Errorf("Expected pump-1 of type pump at revision 1, got %s of type %s at %d", dt.ID, dt.Type, dt.GetRevision())
+		}
+		if site, _ := dt.GetAttribute("site"); site != 1 {
+			t.Errorf("Expected site 1, got %v", site)
+		}
+	}},
+	{"create existing", func(t *testing.T, twins registry.Twins) {
+		mustCreate(t, twins, newTwin("pump-1", 1))
+		expectError(t, twins.Create(newTwin("pump-1", 2)), registry.ErrTwinAlreadyExists)
+		if site, _ := mustGet(t, twins, "pump-1").GetAttribute("site"); site != 1 {
+			t.Errorf("Expected the existing twin to be kept, got site %v", site)
+		}
+	}},
+	{"get missing", func(t *testing.T, twins registry.Twins) {
+		_, err := twins.Get("missing")
+		expectError(t, err, registry.ErrTwinNotFound)
+	}},
+	{"update advances the revision", func(t *testing.T, twins registry.Twins) {
+		mustCreate(t, twins, newTwin("pump-1", 1))
+		dt := mustGet(t, twins, "pump-1")
+		dt.SetAttribute("site", 2)
+		if err := twins.Update(dt); err != nil {
+			t.Fatal(err)
+		}
+		dt = mustGet(t, twins, "pump-1")
+		if dt.GetRevision() != 2 {
+			t.Errorf("Expected revision 2, got %d", dt.GetRevision())
+		}
+		if site, _ := dt.GetAttribute("site"); site != 2 {
+			t.Errorf("Expected site 2, got %v", site)
+		}
+	}},
+	{"update with a stale revision", func(t *testing.T, twins registry.Twins) {
+		mustCreate(t, twins, newTwin("pump-1", 1))
+		stale := mustGet(t, twins, "pump-1").Clone()
+		if err := twins.Update(mustGet(t, twins, "pump-1")); err != nil {
+			t.Fatal(err)
+		}
+		expectError(t, twins.Update(stale), registry.ErrRevisionConflict)
+
+		// Copies without a revision replace the twin unconditionally
+		if err := twins.Update(newTwin("pump-1", 3)); err != nil {
+			t.Fatalf("Expected an update without revision to succeed, got %v", err)
+		}
+		if dt := mustGet(t, twins, "pump-1"); dt.GetRevision() != 3 {
+			t.Errorf("Expected revision 3, got %d", dt.GetRevision())
+		}
+	}},
+	{"update missing", func(t *testing.T, twins registry.Twins) {
+		expectError(t, twins.Update(newTwin("missing", 1)), registry.ErrTwinNotFound)
+	}},
+	{"delete", func(t *testing.T, twins registry.Twins) {
+		mustCreate(t, twins, newTwin("pump-1", 1))
+		if err := twins.Delete("pump-1"); err != nil {
+			t.Fatal(err)
+		}
+		_, err := twins.Get("pump-1")
+		expectError(t, err, registry.ErrTwinNotFound)
+		expectError(t, twins.Delete("pump-1"), registry.ErrTwinNotFound)
+
+		// Deleted twins can be created again from revision 1
+		mustCreate(t, twins, newTwin("pump-1", 2))
+		if dt := mustGet(t, twins, "pump-1"); dt.GetRevision() != 1 {
+			t.Errorf("Expected revision 1, got %d", dt.GetRevision())
+		}
+	}},
+	{"version advances on commits only", func(t *testing.T, twins registry.Twins) {
+		version := twins.Version()
+		advanced := func(op string, expected bool) {
+			t.Helper()
+			v := twins.Version()
+			if expected && v <= version {
+				t.Errorf("Expected %s to advance the version from %d, got %d", op, version, v)
+			}
+			if !expected && v != version {
+				t.Errorf("Expected %s to keep version %d, got %d", op, version, v)
+			}
+			version = v
+		}
+
+		mustCreate(t, twins, newTwin("pump-1", 1))
+		advanced("create", true)
+		twins.Create(newTwin("pump-1", 1))
+		advanced("a failed create", false)
+		if err := twins.Update(mustGet(t, twins, "pump-1")); err != nil {
+			t.Fatal(err)
+		}
+		advanced("update", true)
+		twins.Update(newTwin("missing", 1))
+		advanced("a failed update", false)
+		if err := twins.Delete("pump-1"); err != nil {
+			t.Fatal(err)
+		}
+		advanced("delete", true)
+		twins.Delete("pump-1")
+		advanced("a failed delete", false)
+	}},
+	{"snapshot", func(t *testing.T, twins registry.Twins) {
+		mustCreate(t, twins, newTwin("pump-1", 1), newTwin("pump-2", 2), newTwin("pump-3", 3))
+		snapshot, version, err := twins.Snapshot([]string{"pump-3", "pump-1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if version != twins.Version() {
+			t.Errorf("Expected version %d, got %d", twins.Version(), version)
+		}
+		if len(snapshot) != 2 || snapshot[0].ID != "pump-3" || snapshot[1].ID != "pump-1" {
+			t.Fatalf("Expected pump-3 and pump-1 in order, got %v", snapshot)
+		}
+
+		// Snapshots are copies
+		snapshot[0].SetAttribute("site", 9)
+		if site, _ := mustGet(t, twins, "pump-3").GetAttribute("site"); site != 3 {
+			t.Errorf("Expected the snapshot to be a copy, got site %v", site)
+		}
+
+		_, _, err = twins.Snapshot([]string{"pump-1", "missing"})
+		expectError(t, err, registry.ErrTwinNotFound)
+	}},
+	{"list, count and find", func(t *testing.T, twins registry.Twins) {
+		mustCreate(t, twins, newTwin("pump-1", 1), newTwin("pump-2", 2), newTwin("pump-3", 1))
+
+		// Registries may keep twins out of memory, which listings omit, so
+		// only their consistency with Get is required
+		listed := twins.List()
+		if twins.Count() != len(listed) {
+			t.Errorf("Expected the count to match %d listed twins, got %d", len(listed), twins.Count())
+		}
+		seen := make(map[string]bool)
+		for _, dt := range listed {
+			if seen[dt.ID] {
+				t.Errorf("Twin %s listed twice", dt.ID)
+			}
+			seen[dt.ID] = true
+			if stored := mustGet(t, twins, dt.ID); stored.GetRevision() != dt.GetRevision() {
+				t.Errorf("Listed %s at revision %d, stored at %d", dt.ID, dt.GetRevision(), stored.GetRevision())
+			}
+		}
+
+		q, err := query.Parse("attributes.site == 1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var found []string
+		for _, dt := range twins.Find(q) {
+			found = append(found, dt.ID)
+			if site, _ := dt.GetAttribute("site"); site != 1 {
+				t.Errorf("Found %s at site %v", dt.ID, site)
+			}
+		}
+		sort.Strings(found)
+		for i := 1; i < len(found); i++ {
+			if found[i] == found[i-1] {
+				t.Errorf("Twin %s found twice", found[i])
+			}
+		}
+	}},
+	{"modified between", func(t *testing.T, twins registry.Twins) {
+		mustCreate(t, twins, newTwin("pump-1", 1), newTwin("pump-2", 2))
+		updated := mustGet(t, twins, "pump-1").Clone()
+		updated.SetAttribute("site", 3)
+		if err := twins.Update(updated); err != nil {
+			t.Fatal(err)
+		}
+
+		// Like listings, the range omits twins kept out of memory
+		modified := twins.ModifiedBetween(time.Time{}, time.Time{})
+		if len(modified) > 2 {
+			t.Fatalf("Expected at most 2 modified twins, got %d", len(modified))
+		}
+		for i := 1; i < len(modified); i++ {
+			if modified[i].GetModifiedAt().Before(modified[i-1].GetModifiedAt()) {
+				t.Errorf("Expected twins ordered by their last commit, got %s before %s", modified[i-1].ID, modified[i].ID)
+			}
+		}
+
+		at := mustGet(t, twins, "pump-1").GetModifiedAt()
+		for _, dt := range twins.ModifiedBetween(at, time.Time{}) {
+			if dt.GetModifiedAt().Before(at) {
+				t.Errorf("Expected %s to be modified since %v", dt.ID, at)
+			}
+		}
+		for _, dt := range twins.ModifiedBetween(time.Time{}, at) {
+			if dt.ID == "pump-1" {
+				t.Error("Expected the range to exclude its end")
+			}
+		}
+	}},
+}
+
+// TestTwins runs the conformance suite for registry.Twins, calling
+// newTwins for an empty registry for each behavior
+func TestTwins(t *testing.T, newTwins func(t *testing.T) registry.Twins) {
+	for _, b := range twinsBehaviors {
+		t.Run(b.name, func(t *testing.T) {
+			b.run(t, newTwins(t))
+		})
+	}
+}
+
+var storeBehaviors = []storeBehavior{
+	{"save and load", func(t *testing.T, store registry.Store) {
+		dt := newTwin("pump-1", 1)
+		dt.SetRevision(4)
+		if err := store.Save(dt); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := store.Load("pump-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if loaded.ID != "pump-1" || loaded.Type != "pump" || loaded.GetRevision() != 4 {
+			t.Errorf("Expected pump-1 of type pump at revision 4, got %s of type %s at %d", loaded.ID, loaded.Type, loaded.GetRevision())
+		}
+		if site, ok := loaded.GetAttribute("site"); !ok || site == nil {
+			t.Errorf("Expected the site attribute, got %v", site)
+		}
+	}},
+	{"save replaces", func(t *testing.T, store registry.Store) {
+		store.Save(newTwin("pump-1", 1))
+		dt := newTwin("pump-1", 1)
+		dt.SetRevision(2)
+		if err := store.Save(dt); err != nil {
+			t.Fatal(err)
+		}
+		if loaded, err := store.Load("pump-1"); err != nil || loaded.GetRevision() != 2 {
+			t.Errorf("Expected revision 2, got %v (%v)", loaded, err)
+		}
+	}},
+	{"load missing", func(t *testing.T, store registry.Store) {
+		if _, err := store.Load("missing"); err == nil {
+			t.Error("Expected an error loading a missing twin")
+		}
+	}},
+	{"remove", func(t *testing.T, store registry.Store) {
+		store.Save(newTwin("pump-1", 1))
+		if err := store.Remove("pump-1"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.Load("pump-1"); err == nil {
+			t.Error("Expected an error loading a removed twin")
+		}
+		if err := store.Remove("pump-1"); err != nil {
+			t.Errorf("Expected removing a missing twin to succeed, got %v", err)
+		}
+	}},
+	{"IDs needing escaping", func(t *testing.T, store registry.Store) {
+		ids := []string{"pump-1", "site/a b", "urn:ngsi-ld:Pump:1"}
+		for _, id := range ids {
+			if err := store.Save(twin.NewDigitalTwin(id, "pump")); err != nil {
+				t.Fatalf("Failed to save %s: %v", id, err)
+			}
+			if loaded, err := store.Load(id); err != nil || loaded.ID != id {
+				t.Errorf("Expected to load %s, got %v (%v)", id, loaded, err)
+			}
+		}
+
+		enumerator, ok := store.(registry.Enumerator)
+		if !ok {
+			return
+		}
+		listed, err := enumerator.IDs()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(listed)
+		sort.Strings(ids)
+		if len(listed) != len(ids) {
+			t.Fatalf("Expected IDs %v, got %v", ids, listed)
+		}
+		for i := range ids {
+			if listed[i] != ids[i] {
+				t.Errorf("Expected IDs %v, got %v", ids, listed)
+				break
+			}
+		}
+	}},
+}
+
+// TestStore runs the conformance suite for registry.Store, calling newStore
+// for an empty store for each behavior. Stores that are Enumerators must
+// also list the twins they keep.
+func TestStore(t *testing.T, newStore func(t *testing.T) registry.Store) {
+	for _, b := range storeBehaviors {
+		t.Run(b.name, func(t *testing.T) {
+			b.run(t, newStore(t))
+		})
+	}
+}
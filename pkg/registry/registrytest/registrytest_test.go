@@ -0,0 +1,53 @@
+package registrytest
+
+import (
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/objstore"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+)
+
+func TestRegistry(t *testing.T) {
+	TestTwins(t, func(t *testing.T) registry.Twins {
+		return registry.NewRegistry()
+	})
+}
+
+// A budget of one twin keeps every other twin in the store, so the suite
+// covers loading, updating and deleting evicted twins
+func TestEvictingRegistry(t *testing.T) {
+	stores := map[string]func(t *testing.T) objstore.Store{
+		"memory": func(t *testing.T) objstore.Store {
+			return objstore.NewMemoryStore()
+		},
+		"dir": func(t *testing.T) objstore.Store {
+			dir, err := objstore.NewDir(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			return dir
+		},
+	}
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			TestTwins(t, func(t *testing.T) registry.Twins {
+				reg := registry.NewRegistry()
+				reg.SetBudget(registry.Budget{MaxTwins: 1}, registry.NewObjectStore(newStore(t), "evicted/"))
+				return reg
+			})
+		})
+	}
+}
+
+func TestObjectStore(t *testing.T) {
+	TestStore(t, func(t *testing.T) registry.Store {
+		return registry.NewObjectStore(objstore.NewMemoryStore(), "")
+	})
+	TestStore(t, func(t *testing.T) registry.Store {
+		dir, err := objstore.NewDir(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return registry.NewObjectStore(dir, "evicted/")
+	})
+}
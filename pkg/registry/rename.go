@@ -0,0 +1,102 @@
+package registry
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// Rename changes the ID of a twin. The twin is created again under the new
+// ID, keeping its creation time, and the relationships of every twin that
+// targets it, its own included, are pointed at the new ID, all at a single
+// new version. Twins in the store are read to find their relationships, so
+// renaming is slow with many evicted twins. Rename returns the IDs of the
+// other twins whose relationships were changed, in order.
+func (r *Registry) Rename(oldID, newID string) ([]string, error) {
+	if newID == "" {
+		return nil, fmt.Errorf("%w: the new ID is empty", ErrInvalidID)
+	}
+
+	var referrers []string
+	_, err := r.Transaction(func(tx *Tx) error {
+		old, err := tx.Get(oldID)
+		if err != nil {
+			return err
+		}
+		if oldID == newID {
+			return fmt.Errorf("%w: the twin already has ID %s", ErrInvalidID, newID)
+		}
+
+		renamed := old.Clone()
+		renamed.ID = newID
+		renamed.ModifiedAt = r.now()
+		if err := tx.Create(renamed); err != nil {
+			return err
+		}
+		if err := tx.Delete(oldID); err != nil {
+			return err
+		}
+		repoint(renamed, oldID, newID)
+
+		for id, dt := range r.twins {
+			if id != oldID && targets(dt, oldID) {
+				referrers = append(referrers, id)
+			}
+		}
+		for id := range r.memory.evicted {
+			if r.memory.store == nil {
+				break
+			}
+			stored, err := r.memory.store.Load(id)
+			if err != nil {
+				return fmt.Errorf("failed to read stored twin %s: %w", id, err)
+			}
+			if id != oldID && targets(stored, oldID) {
+				referrers = append(referrers, id)
+			}
+		}
+		sort.Strings(referrers)
+
+		for _, id := range referrers {
+			dt, err := tx.Get(id)
+			if err != nil {
+				return err
+			}
+			repoint(dt, oldID, newID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return referrers, nil
+}
+
+// targets reports whether a twin has a relationship to a target twin
+func targets(dt *twin.DigitalTwin, targetID string) bool {
+	for _, ids := range dt.GetAllRelationships() {
+		for _, id := range ids {
+			if id == targetID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// repoint replaces a target twin in the relationships of a twin
+func repoint(dt *twin.DigitalTwin, oldID, newID string) {
+	for name, ids := range dt.GetAllRelationships() {
+		changed := false
+		for i, id := range ids {
+			if id == oldID {
+				ids[i] = newID
+				changed = true
+			}
+		}
+		if changed {
+			dt.SetRelationship(name, ids)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package registry
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/objstore"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestRename(t *testing.T) {
+	reg := NewRegistry()
+	reg.SetBudget(Budget{MaxTwins: 2}, NewObjectStore(objstore.NewMemoryStore(), "twins/"))
+
+	pump := twin.NewDigitalTwin("pump-1", "pump")
+	pump.SetAttribute("serialNumber", "SN-1")
+	pump.AddRelationship("backup", "pump-1")
+	reg.Create(pump)
+	for _, id := range []string{"line-1", "line-2", "line-3"} {
+		dt := twin.NewDigitalTwin(id, "line")
+		dt.AddRelationship("feeds", "pump-1")
+		if id == "line-3" {
+			dt.SetRelationship("feeds", []string{"pump-2"})
+		}
+		reg.Create(dt)
+	}
+	if reg.Count() == 4 {
+		t.Fatal("Expected some twins to be evicted")
+	}
+	version := reg.Version()
+
+	referrers, err := reg.Rename("pump-1", "pump-9")
+	if err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	if !reflect.DeepEqual(referrers, []string{"line-1", "line-2"}) {
+		t.Errorf("Expected line-1 and line-2 to be repointed, got %v", referrers)
+	}
+	if reg.Version() != version+1 {
+		t.Errorf("Expected one new version, got %d after %d", reg.Version(), version)
+	}
+
+	if _, err := reg.Get("pump-1"); err != ErrTwinNotFound {
+		t.Errorf("Expected pump-1 to be gone, got %v", err)
+	}
+	renamed, err := reg.Get("pump-9")
+	if err != nil {
+		t.Fatalf("Failed to get pump-9: %v", err)
+	}
+	if serial, _ := renamed.GetAttribute("serialNumber"); serial != "SN-1" || !renamed.CreatedAt.Equal(pump.CreatedAt) {
+		t.Errorf("Expected pump-9 to keep the state of pump-1, got %v created at %v", serial, renamed.CreatedAt)
+	}
+	if backup := renamed.GetRelationship("backup"); !reflect.DeepEqual(backup, []string{"pump-9"}) {
+		t.Errorf("Expected the relationship of pump-9 to itself, got %v", backup)
+	}
+	for id, want := range map[string][]string{"line-1": {"pump-9"}, "line-2": {"pump-9"}, "line-3": {"pump-2"}} {
+		dt, _ := reg.Get(id)
+		if feeds := dt.GetRelationship("feeds"); !reflect.DeepEqual(feeds, want) {
+			t.Errorf("%s: expected to feed %v, got %v", id, want, feeds)
+		}
+	}
+
+	for _, tc := range []struct {
+		oldID, newID string
+		err          error
+	}{
+		{"pump-1", "pump-2", ErrTwinNotFound},
+		{"pump-9", "line-3", ErrTwinAlreadyExists},
+		{"pump-9", "pump-9", ErrInvalidID},
+		{"pump-9", "", ErrInvalidID},
+	} {
+		if _, err := reg.Rename(tc.oldID, tc.newID); !errors.Is(err, tc.err) {
+			t.Errorf("%s to %q: expected %v, got %v", tc.oldID, tc.newID, tc.err, err)
+		}
+	}
+	if reg.Version() != version+1 {
+		t.Error("Expected failed renames not to change the registry")
+	}
+}
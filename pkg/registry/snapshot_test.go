@@ -0,0 +1,42 @@
+package registry
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestSnapshot(t *testing.T) {
+	reg := NewRegistry()
+	reg.Create(twin.NewDigitalTwin("gateway-1", "gateway"))
+	reg.Create(twin.NewDigitalTwin("gateway-2", "gateway"))
+
+	if v := reg.Version(); v != 2 {
+		t.Errorf("Expected version 2 after two creates, got %d", v)
+	}
+
+	twins, version, err := reg.Snapshot([]string{"gateway-2", "gateway-1"})
+	if err != nil {
+		t.Fatalf("Failed to take snapshot: %v", err)
+	}
+	if version != 2 || len(twins) != 2 || twins[0].ID != "gateway-2" {
+		t.Errorf("Unexpected snapshot at version %d: %v", version, twins)
+	}
+
+	// Snapshots are copies
+	original, _ := reg.Get("gateway-1")
+	original.SetAttribute("status", "online")
+	reg.Update(original)
+
+	if _, exists := twins[1].GetAttribute("status"); exists {
+		t.Error("Expected snapshot not to see later changes")
+	}
+	if v := reg.Version(); v != 3 {
+		t.Errorf("Expected version 3 after update, got %d", v)
+	}
+
+	if _, _, err := reg.Snapshot([]string{"gateway-1", "missing"}); !errors.Is(err, ErrTwinNotFound) {
+		t.Errorf("Expected ErrTwinNotFound, got %v", err)
+	}
+}
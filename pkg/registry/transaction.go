@@ -0,0 +1,141 @@
+package registry
+
+import (
+	"fmt"
+
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// Tx gives a transaction access to working copies of twins.
+// Nothing is visible to other readers until the transaction commits.
+type Tx struct {
+	registry *Registry
+	working  map[string]*twin.DigitalTwin // Twin ID -> working copy, nil if deleted
+	created  map[string]bool
+}
+
+// Get returns the working copy of a twin, which the transaction may change
+func (tx *Tx) Get(id string) (*twin.DigitalTwin, error) {
+	if dt, touched := tx.working[id]; touched {
+		if dt == nil {
+			return nil, ErrTwinNotFound
+		}
+		return dt, nil
+	}
+
+	stored, err := tx.registry.resident(id)
+	if err != nil {
+		return nil, err
+	}
+
+	dt := stored.Clone()
+	tx.working[id] = dt
+	return dt, nil
+}
+
+// Exists reports whether a twin exists in the transaction, without taking a working copy
+func (tx *Tx) Exists(id string) bool {
+	if dt, touched := tx.working[id]; touched {
+		return dt != nil
+	}
+	_, exists := tx.registry.twins[id]
+	return exists || tx.registry.evictedExists(id)
+}
+
+// Revision returns the committed revision of a twin, 0 if it does not exist
+func (tx *Tx) Revision(id string) uint64 {
+	if stored, err := tx.registry.resident(id); err == nil {
+		return stored.GetRevision()
+	}
+	return 0
+}
+
+// Create adds a new twin
+func (tx *Tx) Create(dt *twin.DigitalTwin) error {
+	// Twins deleted earlier in the transaction may be created again
+	if existing, touched := tx.working[dt.ID]; touched {
+		if existing != nil {
+			return ErrTwinAlreadyExists
+		}
+	} else if tx.Exists(dt.ID) {
+		return ErrTwinAlreadyExists
+	}
+
+	tx.working[dt.ID] = dt
+	tx.created[dt.ID] = true
+	return nil
+}
+
+// Delete removes a twin
+func (tx *Tx) Delete(id string) error {
+	if _, err := tx.Get(id); err != nil {
+		return err
+	}
+
+	tx.working[id] = nil
+	return nil
+}
+
+// Transaction runs fn on working copies of twins and commits all of its
+// changes atomically at a single new version if fn returns nil. Other
+// registry operations are blocked while fn runs, so fn must not call them.
+// Every twin the transaction got, created or deleted advances its revision.
+func (r *Registry) Transaction(fn func(tx *Tx) error) (uint64, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	tx := &Tx{
+		registry: r,
+		working:  make(map[string]*twin.DigitalTwin),
+		created:  make(map[string]bool),
+	}
+
+	if err := fn(tx); err != nil {
+		return r.version, err
+	}
+
+	for id, dt := range tx.working {
+		if dt != nil && dt.ID != id {
+			return r.version, fmt.Errorf("transaction changed the ID of twin %s", id)
+		}
+	}
+
+	r.version++
+	var committed []*twin.DigitalTwin
+	var puts, deletes []string
+	for id, dt := range tx.working {
+		if dt == nil {
+			deletes = append(deletes, id)
+			delete(r.twins, id)
+			r.modified.remove(id)
+			r.forget(id)
+			r.indexes.remove(id)
+			r.external.remove(id)
+			continue
+		}
+
+		revision := uint64(1)
+		if stored, exists := r.twins[id]; exists && !tx.created[id] {
+			revision = stored.GetRevision() + 1
+		}
+		dt.SetRevision(revision)
+		dt.SetClock(r.clock)
+		r.twins[id] = dt
+		committed = append(committed, dt)
+		puts = append(puts, id)
+	}
+	at := r.now()
+	r.modified.commit(at, committed...)
+	if len(committed) > 0 {
+		at = committed[0].GetModifiedAt()
+	}
+	r.changes.append(r.version, at, puts, deletes)
+	r.indexes.update(committed...)
+	r.external.update(committed...)
+	for _, dt := range committed {
+		r.account(dt)
+	}
+	r.evict(0, 0, "")
+
+	return r.version, nil
+}
@@ -0,0 +1,95 @@
+package registry
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestTransaction(t *testing.T) {
+	reg := NewRegistry()
+	reg.Create(twin.NewDigitalTwin("gateway-1", "gateway"))
+	reg.Create(twin.NewDigitalTwin("gateway-2", "gateway"))
+
+	gateway1, _ := reg.Get("gateway-1")
+	gateway1.AddRelationship("hosts", "sensor-1")
+	reg.Update(gateway1)
+
+	// Move the sensor from one gateway to the other
+	version, err := reg.Transaction(func(tx *Tx) error {
+		from, err := tx.Get("gateway-1")
+		if err != nil {
+			return err
+		}
+		to, err := tx.Get("gateway-2")
+		if err != nil {
+			return err
+		}
+
+		from.RemoveRelationship("hosts", "sensor-1")
+		to.AddRelationship("hosts", "sensor-1")
+		return tx.Create(twin.NewDigitalTwin("sensor-2", "sensor"))
+	})
+	if err != nil {
+		t.Fatalf("Transaction failed: %v", err)
+	}
+	if version != reg.Version() {
+		t.Errorf("Expected version %d, got %d", reg.Version(), version)
+	}
+
+	from, _ := reg.Get("gateway-1")
+	to, _ := reg.Get("gateway-2")
+	if len(from.GetRelationship("hosts")) != 0 || len(to.GetRelationship("hosts")) != 1 {
+		t.Errorf("Expected sensor to move, got %v and %v", from.GetRelationship("hosts"), to.GetRelationship("hosts"))
+	}
+	if from.GetRevision() != 3 || to.GetRevision() != 2 {
+		t.Errorf("Expected revisions 3 and 2, got %d and %d", from.GetRevision(), to.GetRevision())
+	}
+	if _, err := reg.Get("sensor-2"); err != nil {
+		t.Errorf("Expected sensor-2 to be created: %v", err)
+	}
+
+	// The stale copy held before the transaction can no longer be stored
+	if err := reg.Update(gateway1); !errors.Is(err, ErrRevisionConflict) {
+		t.Errorf("Expected ErrRevisionConflict, got %v", err)
+	}
+
+	// Failed transactions change nothing
+	failure := errors.New("abort")
+	before := reg.Version()
+	_, err = reg.Transaction(func(tx *Tx) error {
+		dt, _ := tx.Get("gateway-2")
+		dt.SetAttribute("status", "offline")
+		tx.Delete("sensor-2")
+		return failure
+	})
+	if err != failure {
+		t.Errorf("Expected transaction error, got %v", err)
+	}
+
+	to, _ = reg.Get("gateway-2")
+	if _, exists := to.GetAttribute("status"); exists || reg.Version() != before {
+		t.Error("Expected failed transaction not to change the registry")
+	}
+	if _, err := reg.Get("sensor-2"); err != nil {
+		t.Error("Expected sensor-2 to survive the failed transaction")
+	}
+
+	// Deleted twins can be created again in the same transaction, existing ones cannot
+	_, err = reg.Transaction(func(tx *Tx) error {
+		if err := tx.Create(twin.NewDigitalTwin("gateway-1", "gateway")); err != ErrTwinAlreadyExists {
+			t.Errorf("Expected ErrTwinAlreadyExists, got %v", err)
+		}
+		if err := tx.Delete("gateway-1"); err != nil {
+			return err
+		}
+		return tx.Create(twin.NewDigitalTwin("gateway-1", "gateway"))
+	})
+	if err != nil {
+		t.Fatalf("Transaction failed: %v", err)
+	}
+	if recreated, _ := reg.Get("gateway-1"); recreated.GetRevision() != 1 {
+		t.Errorf("Expected recreated twin at revision 1, got %d", recreated.GetRevision())
+	}
+}
@@ -0,0 +1,412 @@
+// Package replica keeps a read-only copy of the registry of a primary server
+// by following its replication log, so that a server can take GET, query and
+// history traffic off the primary. The replica copies the primary's twins
+// once, then applies their changes as the primary commits them, publishing
+// them as local events and recording changed property values in the local
+// history.
+package replica
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/eventbus"
+	"github.com/aleka07/go-digital-twin/pkg/history"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// Common errors
+var (
+	ErrInvalidOptions = errors.New("invalid replica options")
+)
+
+// errCompacted is returned when the replica fell behind the compaction of
+// the primary's log and has to copy the registry again
+var errCompacted = errors.New("replication log compacted past the replica")
+
+// Limits of requests to the primary
+const (
+	pageLimit      = 1000             // Changes per page of the initial copy
+	requestTimeout = 30 * time.Second // Bounds a page of the initial copy; the change stream stays open
+	maxEventSize   = 16 << 20         // Bounds a single event of the change stream
+)
+
+// Backoff between attempts to reach the primary
+const (
+	minBackoff = time.Second
+	maxBackoff = time.Minute
+)
+
+// Options configure a replica
+type Options struct {
+	Primary string            // API URL of the primary, e.g. http://primary:8080/api/v1
+	Headers map[string]string // Added to every request, e.g. Authorization
+}
+
+// Status reports the progress of a replica
+type Status struct {
+	Primary    string     `json:"primary"`
+	Connected  bool       `json:"connected"`            // Copied the registry and following the change stream
+	Seq        uint64     `json:"seq"`                  // Sequence number of the primary's log applied up to
+	Twins      int        `json:"twins"`                // Twins in the local copy
+	Applied    uint64     `json:"applied"`              // Changes applied since startup
+	Copies     uint64     `json:"copies"`               // Full copies of the primary's registry
+	Failures   uint64     `json:"failures"`             // Failed requests and changes
+	LastError  string     `json:"lastError,omitempty"`  // Error of the last failure
+	LastChange *time.Time `json:"lastChange,omitempty"` // When the primary committed the change applied last
+}
+
+// change is an entry of the primary's replication log
+type change struct {
+	Seq       uint64          `json:"seq"`
+	Op        string          `json:"op"`
+	TwinID    string          `json:"twinId"`
+	Twin      json.RawMessage `json:"twin"`
+	Timestamp time.Time       `json:"timestamp"`
+}
+
+// logPage is a page of the primary's replication log
+type logPage struct {
+	Seq     uint64   `json:"seq"`
+	Next    uint64   `json:"next"`
+	Changes []change `json:"changes"`
+}
+
+// Replica follows the replication log of a primary server
+type Replica struct {
+	opts     Options
+	url      string
+	registry *registry.Registry
+	pubsub   eventbus.Publisher
+	history  *history.Store
+	client   *http.Client
+	stream   *http.Client
+	status   Status
+	mutex    sync.Mutex
+}
+
+// New creates a replica copying the primary into a registry, which should
+// not be written to otherwise
+func New(reg *registry.Registry, pubsub eventbus.Publisher, hist *history.Store, opts Options) (*Replica, error) {
+	u, err := url.Parse(opts.Primary)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%w: primary must be an http or https URL", ErrInvalidOptions)
+	}
+
+	return &Replica{
+		opts:     opts,
+		url:      strings.TrimSuffix(opts.Primary, "/"),
+		registry: reg,
+		pubsub:   pubsub,
+		history:  hist,
+		client:   &http.Client{Timeout: requestTimeout},
+		stream:   &http.Client{},
+		status:   Status{Primary: opts.Primary},
+	}, nil
+}
+
+// Primary returns the API URL of the primary
+func (r *Replica) Primary() string {
+	return r.opts.Primary
+}
+
+// Run copies the primary's registry and follows its changes until the
+// context is canceled, reconnecting with backoff. The registry is copied
+// again when the replica falls behind the compaction of the primary's log.
+func (r *Replica) Run(ctx context.Context) {
+	backoff := minBackoff
+	for {
+		var err error
+		if r.Status().Seq == 0 {
+			err = r.copy(ctx)
+		}
+		if err == nil {
+			err = r.follow(ctx)
+		}
+
+		r.mutex.Lock()
+		r.status.Connected = false
+		if errors.Is(err, errCompacted) {
+			r.status.Seq = 0
+		}
+		r.mutex.Unlock()
+		if ctx.Err() != nil {
+			return
+		}
+		r.fail(err)
+
+		if errors.Is(err, errCompacted) {
+			backoff = minBackoff
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// copy reads the primary's log from the start, which yields every twin, and
+// removes local twins the primary no longer has
+func (r *Replica) copy(ctx context.Context) error {
+	copied := make(map[string]bool)
+	var from uint64
+	for {
+		page, err := r.page(ctx, from)
+		if err != nil {
+			return err
+		}
+		for _, c := range page.Changes {
+			if c.Op == registry.OpPut {
+				copied[c.TwinID] = true
+			}
+			r.apply(c)
+		}
+		from = page.Next
+		if len(page.Changes) < pageLimit {
+			break
+		}
+	}
+
+	for _, dt := range r.registry.List() {
+		if !copied[dt.ID] {
+			r.remove(dt.ID)
+		}
+	}
+
+	r.mutex.Lock()
+	r.status.Seq = from
+	r.status.Copies++
+	r.mutex.Unlock()
+	return nil
+}
+
+// page reads a page of the primary's log
+func (r *Replica) page(ctx context.Context, from uint64) (*logPage, error) {
+	req, err := r.request(ctx, fmt.Sprintf("/replication/log?from=%d&limit=%d", from, pageLimit))
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusGone {
+		return nil, errCompacted
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError(resp)
+	}
+
+	page := &logPage{}
+	if err := json.NewDecoder(resp.Body).Decode(page); err != nil {
+		return nil, fmt.Errorf("invalid replication log: %v", err)
+	}
+	return page, nil
+}
+
+// follow applies the changes of the primary's log after the sequence number
+// applied up to, as they are committed, until the stream ends
+func (r *Replica) follow(ctx context.Context) error {
+	req, err := r.request(ctx, "/replication/log?from="+strconv.FormatUint(r.Status().Seq, 10))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := r.stream.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusGone {
+		return errCompacted
+	}
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+
+	r.mutex.Lock()
+	r.status.Connected = true
+	r.mutex.Unlock()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), maxEventSize)
+	var event string
+	var data []byte
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		switch {
+		case len(line) == 0:
+			switch event {
+			case "reset":
+				return errCompacted
+			case registry.OpPut, registry.OpDelete:
+				var c change
+				if err := json.Unmarshal(data, &c); err != nil {
+					r.fail(fmt.Errorf("invalid change: %v", err))
+				} else {
+					r.apply(c)
+					r.mutex.Lock()
+					r.status.Seq = c.Seq
+					r.mutex.Unlock()
+				}
+			}
+			event, data = "", nil
+		case bytes.HasPrefix(line, []byte(":")):
+			// Keep-alive comment
+		case bytes.HasPrefix(line, []byte("event:")):
+			event = string(bytes.TrimSpace(line[len("event:"):]))
+		case bytes.HasPrefix(line, []byte("data:")):
+			data = append(data, bytes.TrimSpace(line[len("data:"):])...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return errors.New("change stream closed")
+}
+
+// apply applies a change of the primary's log
+func (r *Replica) apply(c change) {
+	switch c.Op {
+	case registry.OpPut:
+		dt, err := twin.Decode(c.Twin)
+		if err != nil {
+			r.fail(fmt.Errorf("twin %s: %v", c.TwinID, err))
+			return
+		}
+		if err := r.store(dt, c.Timestamp); err != nil {
+			r.fail(fmt.Errorf("twin %s: %v", c.TwinID, err))
+			return
+		}
+	case registry.OpDelete:
+		r.remove(c.TwinID)
+	default:
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	at := c.Timestamp
+	r.status.Applied++
+	r.status.LastChange = &at
+}
+
+// store keeps a copy of a twin of the primary and publishes the change. Its
+// revisions are the replica's own.
+func (r *Replica) store(dt *twin.DigitalTwin, at time.Time) error {
+	previous, err := r.registry.Get(dt.ID)
+	dt.SetRevision(0)
+	topic := "twin.updated"
+	switch {
+	case err == nil:
+		err = r.registry.Update(dt)
+	case errors.Is(err, registry.ErrTwinNotFound):
+		topic = "twin.created"
+		err = r.registry.Create(dt)
+	}
+	if err != nil {
+		return err
+	}
+
+	r.record(previous, dt, at)
+	r.pubsub.Publish(topic, map[string]string{"id": dt.ID})
+	return nil
+}
+
+// record adds the property values of a twin that changed since the previous
+// copy to the history, at their effective time or else the commit time.
+// Values the primary went through between two changes applied, e.g. while
+// the replica was disconnected, are not recorded.
+func (r *Replica) record(previous, dt *twin.DigitalTwin, at time.Time) {
+	for featureID, fs := range dt.GetAllFeatures() {
+		var before *twin.FeatureState
+		if previous != nil {
+			before, _ = previous.GetFeature(featureID)
+		}
+		for key, value := range fs.GetAllProperties() {
+			meta, _ := fs.GetPropertyMetadata(key)
+			if before != nil {
+				old, exists := before.GetProperty(key)
+				oldMeta, _ := before.GetPropertyMetadata(key)
+				if exists && oldMeta.Timestamp.Equal(meta.Timestamp) && reflect.DeepEqual(old, value) {
+					continue
+				}
+			}
+			timestamp := meta.Timestamp
+			if timestamp.IsZero() {
+				timestamp = at
+			}
+			r.history.Record(dt.ID, featureID, key, value, timestamp)
+		}
+	}
+}
+
+// remove deletes the copy of a twin the primary deleted
+func (r *Replica) remove(id string) {
+	if err := r.registry.Delete(id); err != nil {
+		return
+	}
+	r.history.DeleteTwin(id)
+	r.pubsub.Publish("twin.deleted", map[string]string{"id": id})
+}
+
+// request creates a request to the primary
+func (r *Replica) request(ctx context.Context, target string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url+target, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range r.opts.Headers {
+		req.Header.Set(k, v)
+	}
+	return req, nil
+}
+
+// fail records a failure
+func (r *Replica) fail(err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.status.Failures++
+	r.status.LastError = err.Error()
+}
+
+// Status reports the progress of the replica
+func (r *Replica) Status() Status {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	status := r.status
+	status.Twins = r.registry.Count()
+	if status.LastChange != nil {
+		at := *status.LastChange
+		status.LastChange = &at
+	}
+	return status
+}
+
+// responseError describes an unexpected response of the primary
+func responseError(resp *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+}
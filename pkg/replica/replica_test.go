@@ -0,0 +1,156 @@
+package replica
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/history"
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// fakePrimary serves a replication log like the API of a primary server
+type fakePrimary struct {
+	seq    uint64
+	twins  map[string]string // Twin ID -> JSON of the twin
+	events chan string       // Events written to change streams, as "event data"
+	copies int
+	mutex  sync.Mutex
+	server *httptest.Server
+}
+
+func newFakePrimary(t *testing.T) *fakePrimary {
+	p := &fakePrimary{twins: make(map[string]string), events: make(chan string, 10)}
+	p.server = httptest.NewServer(http.HandlerFunc(p.serve))
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+func (p *fakePrimary) put(id string, rpm float64) string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.seq++
+	p.twins[id] = fmt.Sprintf(`{"id": %q, "type": "pump", "features": {"motor": {"properties": {"rpm": %v}, "desiredProperties": {"rpm": 1500}}}}`, id, rpm)
+	return fmt.Sprintf(`{"seq": %d, "op": "put", "twinId": %q, "twin": %s}`, p.seq, id, p.twins[id])
+}
+
+func (p *fakePrimary) delete(id string) string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.seq++
+	delete(p.twins, id)
+	return fmt.Sprintf(`{"seq": %d, "op": "delete", "twinId": %q}`, p.seq, id)
+}
+
+func (p *fakePrimary) serve(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/api/v1/replication/log" {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Header.Get("Accept") != "text/event-stream" {
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+
+		var changes []json.RawMessage
+		for id, data := range p.twins {
+			changes = append(changes, json.RawMessage(fmt.Sprintf(`{"seq": %d, "op": "put", "twinId": %q, "twin": %s}`, p.seq, id, data)))
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"seq": p.seq, "next": p.seq, "changes": changes})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(http.StatusOK)
+	w.(http.Flusher).Flush()
+	for {
+		select {
+		case event := <-p.events:
+			fmt.Fprintf(w, "event: %s\n\n", event)
+			w.(http.Flusher).Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// waitFor polls a condition until it holds or a second has passed
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestReplica(t *testing.T) {
+	primary := newFakePrimary(t)
+	primary.put("pump-1", 1400)
+	primary.put("pump-2", 1400)
+
+	reg := registry.NewRegistry()
+	reg.Create(twin.NewDigitalTwin("stale", "pump"))
+	pubsub := messaging_sim.NewPubSub()
+	defer pubsub.Close()
+	hist := history.NewStore(10)
+	r, err := New(reg, pubsub, hist, Options{Primary: primary.server.URL + "/api/v1"})
+	if err != nil {
+		t.Fatalf("Failed to create replica: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Run(ctx)
+
+	// The copy replaces twins the primary does not have
+	waitFor(t, "the copy", func() bool { return r.Status().Connected })
+	if _, err := reg.Get("stale"); err != registry.ErrTwinNotFound {
+		t.Errorf("Expected the stale twin to be removed, got %v", err)
+	}
+	dt, err := reg.Get("pump-1")
+	if err != nil {
+		t.Fatalf("Expected pump-1 to be copied: %v", err)
+	}
+	motor, _ := dt.GetFeature("motor")
+	if desired, _ := motor.GetDesiredProperty("rpm"); desired != 1500.0 {
+		t.Errorf("Expected desired rpm 1500, got %v", desired)
+	}
+
+	// Changes are applied and recorded in the history
+	primary.events <- "put\ndata: " + primary.put("pump-1", 1450)
+	primary.events <- "delete\ndata: " + primary.delete("pump-2")
+	waitFor(t, "the changes", func() bool { return r.Status().Seq == 4 })
+	if _, err := reg.Get("pump-2"); err != registry.ErrTwinNotFound {
+		t.Errorf("Expected pump-2 to be deleted, got %v", err)
+	}
+	if samples := hist.Query("pump-1", "motor", "rpm", time.Time{}, time.Time{}); len(samples) != 2 || samples[1].Value != 1450.0 {
+		t.Errorf("Expected the rpm history 1400, 1450, got %+v", samples)
+	}
+
+	// Falling behind compaction copies the registry again
+	primary.events <- "reset\ndata: {}"
+	waitFor(t, "the second copy", func() bool { return r.Status().Copies == 2 })
+	if status := r.Status(); status.Twins != 1 || status.Applied != 5 {
+		t.Errorf("Unexpected status %+v", status)
+	}
+}
+
+func TestNewInvalidOptions(t *testing.T) {
+	for _, primary := range []string{"", "primary:8080", "ftp://primary"} {
+		if _, err := New(registry.NewRegistry(), messaging_sim.NewPubSub(), history.NewStore(10), Options{Primary: primary}); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("%q: expected ErrInvalidOptions, got %v", primary, err)
+		}
+	}
+}
@@ -0,0 +1,932 @@
+// Package reshape evaluates jq-style expressions that reshape JSON payloads,
+// such as device messages into property maps or twin documents into the
+// payloads of external systems. It implements a subset of jq in which every
+// expression has exactly one result:
+//
+//	.  .a  .a.b  ."key"  .[0]  .a[-1]          paths, null on null input
+//	{a: .x, "b": .y, c, (.k): .v}  [.a, .b]     object and array construction
+//	a | b   a // b                              pipes and defaults for null, false or errors
+//	+ - * / %   == != < <= > >=   and or        arithmetic, comparisons and logic
+//	if c then a elif d then b else e end        conditionals
+//	length keys map(f) add tostring tonumber not floor ceil round type
+//
+// Values are JSON values as decoded by encoding/json; numbers are float64.
+package reshape
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Common errors
+var (
+	ErrInvalidExpression = errors.New("invalid expression")
+	ErrEvaluation        = errors.New("evaluation failed")
+)
+
+// filter evaluates an expression for an input
+type filter func(v interface{}) (interface{}, error)
+
+// Expression is a compiled expression
+type Expression struct {
+	source string
+	eval   filter
+}
+
+// Compile compiles an expression
+func Compile(source string) (*Expression, error) {
+	tokens, err := lex(source)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidExpression, err)
+	}
+
+	p := &parser{tokens: tokens}
+	eval, err := p.parsePipe()
+	if err == nil && p.peek().kind != tokEOF {
+		err = fmt.Errorf("unexpected %s", p.peek())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidExpression, err)
+	}
+	return &Expression{source: source, eval: eval}, nil
+}
+
+// String returns the source of the expression
+func (e *Expression) String() string {
+	return e.source
+}
+
+// Eval evaluates the expression for a JSON value. Inputs that are not
+// decoded JSON, such as structs or ints, are normalized through JSON first.
+func (e *Expression) Eval(input interface{}) (interface{}, error) {
+	input, err := normalize(input)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrEvaluation, err)
+	}
+	out, err := e.eval(input)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrEvaluation, err)
+	}
+	return out, nil
+}
+
+// normalize returns a value as decoded JSON
+func normalize(v interface{}) (interface{}, error) {
+	switch v.(type) {
+	case nil, bool, float64, string:
+		return v, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out interface{}
+	err = json.Unmarshal(data, &out)
+	return out, err
+}
+
+// Lexer
+
+type tokenKind int
+
+const (
+	tokEOF    tokenKind = iota
+	tokField            // .name
+	tokIdent            // name or keyword
+	tokString           // "text"
+	tokNumber           // 1.5
+	tokPunct            // . [ ] { } ( ) , : ; | // and operators
+)
+
+type token struct {
+	kind tokenKind
+	text string      // Name, punctuation or source text
+	val  interface{} // Value of strings and numbers
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of expression"
+	}
+	return strconv.Quote(t.text)
+}
+
+// punctuation in order of length, so that longer operators match first
+var punctuation = []string{"//", "==", "!=", "<=", ">=", ".", "[", "]", "{", "}", "(", ")", ",", ":", ";", "|", "+", "-", "*", "/", "%", "<", ">"}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9')
+}
+
+func lex(s string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+		case c == '.' && i+1 < len(s) && isIdentStart(s[i+1]):
+			j := i + 1
+			for j < len(s) && isIdentChar(s[j]) {
+				j++
+			}
+			tokens = append(tokens, token{kind: tokField, text: s[i+1 : j]})
+			i = j
+
+		case isIdentStart(c):
+			j := i
+			for j < len(s) && isIdentChar(s[j]) {
+				j++
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: s[i:j]})
+			i = j
+
+		case c == '"':
+			j := i + 1
+			for j < len(s) && s[j] != '"' {
+				if s[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(s) {
+				return nil, errors.New("unterminated string")
+			}
+			var text string
+			if err := json.Unmarshal([]byte(s[i:j+1]), &text); err != nil {
+				return nil, fmt.Errorf("invalid string %s", s[i:j+1])
+			}
+			tokens = append(tokens, token{kind: tokString, text: s[i : j+1], val: text})
+			i = j + 1
+
+		case c >= '0' && c <= '9':
+			j := i
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.' || s[j] == 'e' || s[j] == 'E' ||
+				((s[j] == '+' || s[j] == '-') && (s[j-1] == 'e' || s[j-1] == 'E'))) {
+				j++
+			}
+			n, err := strconv.ParseFloat(s[i:j], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %s", s[i:j])
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: s[i:j], val: n})
+			i = j
+
+		default:
+			matched := false
+			for _, p := range punctuation {
+				if strings.HasPrefix(s[i:], p) {
+					tokens = append(tokens, token{kind: tokPunct, text: p})
+					i += len(p)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character %q", c)
+			}
+		}
+	}
+	return append(tokens, token{kind: tokEOF}), nil
+}
+
+// Parser
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// is reports whether the next token is the punctuation or keyword
+func (p *parser) is(text string) bool {
+	t := p.peek()
+	return (t.kind == tokPunct || t.kind == tokIdent) && t.text == text
+}
+
+func (p *parser) expect(text string) error {
+	if !p.is(text) {
+		return fmt.Errorf("expected %q, got %s", text, p.peek())
+	}
+	p.next()
+	return nil
+}
+
+func (p *parser) parsePipe() (filter, error) {
+	left, err := p.parseAlt()
+	if err != nil {
+		return nil, err
+	}
+	for p.is("|") {
+		p.next()
+		right, err := p.parseAlt()
+		if err != nil {
+			return nil, err
+		}
+		left = pipe(left, right)
+	}
+	return left, nil
+}
+
+func pipe(left, right filter) filter {
+	return func(v interface{}) (interface{}, error) {
+		out, err := left(v)
+		if err != nil {
+			return nil, err
+		}
+		return right(out)
+	}
+}
+
+func (p *parser) parseAlt() (filter, error) {
+	left, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	for p.is("//") {
+		p.next()
+		right, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(v interface{}) (interface{}, error) {
+			if out, err := l(v); err == nil && truthy(out) {
+				return out, nil
+			}
+			return right(v)
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) parseOr() (filter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.is("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = logic(left, right, true)
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (filter, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for p.is("and") {
+		p.next()
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		left = logic(left, right, false)
+	}
+	return left, nil
+}
+
+// logic evaluates or, which is decided by a true left side, and and, which
+// is decided by a false one
+func logic(left, right filter, or bool) filter {
+	return func(v interface{}) (interface{}, error) {
+		l, err := left(v)
+		if err != nil {
+			return nil, err
+		}
+		if truthy(l) == or {
+			return or, nil
+		}
+		r, err := right(v)
+		if err != nil {
+			return nil, err
+		}
+		return truthy(r), nil
+	}
+}
+
+func (p *parser) parseComparison() (filter, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"==", "!=", "<", "<=", ">", ">="} {
+		if p.is(op) {
+			p.next()
+			right, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			return binary(left, right, op), nil
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAdditive() (filter, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for p.is("+") || p.is("-") {
+		op := p.next().text
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = binary(left, right, op)
+	}
+	return left, nil
+}
+
+func (p *parser) parseMultiplicative() (filter, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.is("*") || p.is("/") || p.is("%") {
+		op := p.next().text
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = binary(left, right, op)
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (filter, error) {
+	if !p.is("-") {
+		return p.parsePostfix()
+	}
+	p.next()
+	operand, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	return binary(constant(0.0), operand, "-"), nil
+}
+
+func (p *parser) parsePostfix() (filter, error) {
+	f, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch t := p.peek(); {
+		case t.kind == tokField:
+			p.next()
+			f = pipe(f, field(constant(t.text)))
+		case p.is(".") && p.tokens[p.pos+1].kind == tokString:
+			p.next()
+			f = pipe(f, field(constant(p.next().val)))
+		case p.is(".") && p.tokens[p.pos+1].kind == tokPunct && p.tokens[p.pos+1].text == "[":
+			p.next()
+		case p.is("["):
+			p.next()
+			index, err := p.parsePipe()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			f = pipe(f, field(index))
+		default:
+			return f, nil
+		}
+	}
+}
+
+func (p *parser) parseTerm() (filter, error) {
+	t := p.next()
+	switch t.kind {
+	case tokField:
+		return field(constant(t.text)), nil
+	case tokString, tokNumber:
+		return constant(t.val), nil
+	case tokEOF:
+		return nil, errors.New("unexpected end of expression")
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return constant(true), nil
+		case "false":
+			return constant(false), nil
+		case "null":
+			return constant(nil), nil
+		case "if":
+			return p.parseIf()
+		}
+		return p.parseFunction(t.text)
+	}
+
+	switch t.text {
+	case ".":
+		if p.peek().kind == tokString {
+			return field(constant(p.next().val)), nil
+		}
+		return identity, nil
+	case "(":
+		f, err := p.parsePipe()
+		if err != nil {
+			return nil, err
+		}
+		return f, p.expect(")")
+	case "[":
+		return p.parseArray()
+	case "{":
+		return p.parseObject()
+	}
+	return nil, fmt.Errorf("unexpected %s", t)
+}
+
+func (p *parser) parseIf() (filter, error) {
+	cond, err := p.parsePipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("then"); err != nil {
+		return nil, err
+	}
+	then, err := p.parsePipe()
+	if err != nil {
+		return nil, err
+	}
+
+	otherwise := identity
+	switch {
+	case p.is("elif"):
+		p.next()
+		if otherwise, err = p.parseIf(); err != nil {
+			return nil, err
+		}
+		return conditional(cond, then, otherwise), nil
+	case p.is("else"):
+		p.next()
+		if otherwise, err = p.parsePipe(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expect("end"); err != nil {
+		return nil, err
+	}
+	return conditional(cond, then, otherwise), nil
+}
+
+func conditional(cond, then, otherwise filter) filter {
+	return func(v interface{}) (interface{}, error) {
+		c, err := cond(v)
+		if err != nil {
+			return nil, err
+		}
+		if truthy(c) {
+			return then(v)
+		}
+		return otherwise(v)
+	}
+}
+
+func (p *parser) parseArray() (filter, error) {
+	var elements []filter
+	for !p.is("]") {
+		if len(elements) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		f, err := p.parsePipe()
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, f)
+	}
+	p.next()
+
+	return func(v interface{}) (interface{}, error) {
+		out := make([]interface{}, len(elements))
+		for i, f := range elements {
+			value, err := f(v)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = value
+		}
+		return out, nil
+	}, nil
+}
+
+func (p *parser) parseObject() (filter, error) {
+	type entry struct {
+		key, value filter
+	}
+
+	var entries []entry
+	for !p.is("}") {
+		if len(entries) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+
+		var e entry
+		switch t := p.next(); {
+		case t.kind == tokIdent:
+			e.key = constant(t.text)
+			e.value = field(e.key) // Shorthand {a} for {a: .a}
+		case t.kind == tokString:
+			e.key = constant(t.val)
+			e.value = field(e.key)
+		case t.kind == tokPunct && t.text == "(":
+			key, err := p.parsePipe()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			e.key = key
+		default:
+			return nil, fmt.Errorf("unexpected %s in object", t)
+		}
+
+		if p.is(":") {
+			p.next()
+			value, err := p.parsePipe()
+			if err != nil {
+				return nil, err
+			}
+			e.value = value
+		} else if e.value == nil {
+			return nil, errors.New("computed object keys need a value")
+		}
+		entries = append(entries, e)
+	}
+	p.next()
+
+	return func(v interface{}) (interface{}, error) {
+		out := make(map[string]interface{}, len(entries))
+		for _, e := range entries {
+			key, err := e.key(v)
+			if err != nil {
+				return nil, err
+			}
+			name, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("object keys must be strings, got %s", typeOf(key))
+			}
+			value, err := e.value(v)
+			if err != nil {
+				return nil, err
+			}
+			out[name] = value
+		}
+		return out, nil
+	}, nil
+}
+
+func (p *parser) parseFunction(name string) (filter, error) {
+	if name == "map" {
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		f, err := p.parsePipe()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return mapArray(f), nil
+	}
+
+	builtin, exists := builtins[name]
+	if !exists {
+		return nil, fmt.Errorf("unknown function %s", name)
+	}
+	return builtin, nil
+}
+
+// Evaluation
+
+func identity(v interface{}) (interface{}, error) {
+	return v, nil
+}
+
+func constant(c interface{}) filter {
+	return func(interface{}) (interface{}, error) {
+		return c, nil
+	}
+}
+
+// field indexes objects by strings and arrays by numbers
+func field(index filter) filter {
+	return func(v interface{}) (interface{}, error) {
+		i, err := index(v)
+		if err != nil {
+			return nil, err
+		}
+
+		switch container := v.(type) {
+		case nil:
+			return nil, nil
+		case map[string]interface{}:
+			key, ok := i.(string)
+			if !ok {
+				return nil, fmt.Errorf("cannot index object with %s", typeOf(i))
+			}
+			return container[key], nil
+		case []interface{}:
+			n, ok := i.(float64)
+			if !ok {
+				return nil, fmt.Errorf("cannot index array with %s", typeOf(i))
+			}
+			pos := int(n)
+			if pos < 0 {
+				pos += len(container)
+			}
+			if pos < 0 || pos >= len(container) {
+				return nil, nil
+			}
+			return container[pos], nil
+		}
+		return nil, fmt.Errorf("cannot index %s", typeOf(v))
+	}
+}
+
+func mapArray(f filter) filter {
+	return func(v interface{}) (interface{}, error) {
+		array, ok := v.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("cannot map over %s", typeOf(v))
+		}
+		out := make([]interface{}, len(array))
+		for i, element := range array {
+			value, err := f(element)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = value
+		}
+		return out, nil
+	}
+}
+
+func binary(left, right filter, op string) filter {
+	return func(v interface{}) (interface{}, error) {
+		l, err := left(v)
+		if err != nil {
+			return nil, err
+		}
+		r, err := right(v)
+		if err != nil {
+			return nil, err
+		}
+		return apply(op, l, r)
+	}
+}
+
+// apply applies a binary operator
+func apply(op string, l, r interface{}) (interface{}, error) {
+	switch op {
+	case "==":
+		return reflect.DeepEqual(l, r), nil
+	case "!=":
+		return !reflect.DeepEqual(l, r), nil
+	case "<", "<=", ">", ">=":
+		c, err := compare(l, r)
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case "<":
+			return c < 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">":
+			return c > 0, nil
+		}
+		return c >= 0, nil
+	case "+":
+		return add(l, r)
+	}
+
+	a, aok := l.(float64)
+	b, bok := r.(float64)
+	if !aok || !bok {
+		return nil, fmt.Errorf("cannot apply %s to %s and %s", op, typeOf(l), typeOf(r))
+	}
+	switch op {
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	}
+	if b == 0 {
+		return nil, errors.New("division by zero")
+	}
+	if op == "/" {
+		return a / b, nil
+	}
+	return math.Mod(a, b), nil
+}
+
+// add adds numbers, concatenates strings and arrays and merges objects; null
+// is the identity
+func add(l, r interface{}) (interface{}, error) {
+	if l == nil {
+		return r, nil
+	}
+	if r == nil {
+		return l, nil
+	}
+
+	switch a := l.(type) {
+	case float64:
+		if b, ok := r.(float64); ok {
+			return a + b, nil
+		}
+	case string:
+		if b, ok := r.(string); ok {
+			return a + b, nil
+		}
+	case []interface{}:
+		if b, ok := r.([]interface{}); ok {
+			return append(append([]interface{}{}, a...), b...), nil
+		}
+	case map[string]interface{}:
+		if b, ok := r.(map[string]interface{}); ok {
+			out := make(map[string]interface{}, len(a)+len(b))
+			for k, v := range a {
+				out[k] = v
+			}
+			for k, v := range b {
+				out[k] = v
+			}
+			return out, nil
+		}
+	}
+	return nil, fmt.Errorf("cannot add %s and %s", typeOf(l), typeOf(r))
+}
+
+// compare orders two numbers or two strings
+func compare(l, r interface{}) (int, error) {
+	switch a := l.(type) {
+	case float64:
+		if b, ok := r.(float64); ok {
+			switch {
+			case a < b:
+				return -1, nil
+			case a > b:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	case string:
+		if b, ok := r.(string); ok {
+			return strings.Compare(a, b), nil
+		}
+	}
+	return 0, fmt.Errorf("cannot compare %s and %s", typeOf(l), typeOf(r))
+}
+
+// truthy reports whether a value counts as true; only false and null do not
+func truthy(v interface{}) bool {
+	return v != nil && v != false
+}
+
+// typeOf returns the jq type name of a value
+func typeOf(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// builtins are the functions without arguments
+var builtins = map[string]filter{
+	"length": func(v interface{}) (interface{}, error) {
+		switch x := v.(type) {
+		case nil:
+			return 0.0, nil
+		case string:
+			return float64(len([]rune(x))), nil
+		case []interface{}:
+			return float64(len(x)), nil
+		case map[string]interface{}:
+			return float64(len(x)), nil
+		case float64:
+			return math.Abs(x), nil
+		}
+		return nil, fmt.Errorf("%s has no length", typeOf(v))
+	},
+	"keys": func(v interface{}) (interface{}, error) {
+		object, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s has no keys", typeOf(v))
+		}
+		keys := make([]string, 0, len(object))
+		for k := range object {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		out := make([]interface{}, len(keys))
+		for i, k := range keys {
+			out[i] = k
+		}
+		return out, nil
+	},
+	"add": func(v interface{}) (interface{}, error) {
+		array, ok := v.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("cannot add the elements of %s", typeOf(v))
+		}
+		var sum interface{}
+		for _, element := range array {
+			var err error
+			if sum, err = add(sum, element); err != nil {
+				return nil, err
+			}
+		}
+		return sum, nil
+	},
+	"tostring": func(v interface{}) (interface{}, error) {
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"tonumber": func(v interface{}) (interface{}, error) {
+		switch x := v.(type) {
+		case float64:
+			return x, nil
+		case string:
+			n, err := strconv.ParseFloat(strings.TrimSpace(x), 64)
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse %q as a number", x)
+			}
+			return n, nil
+		}
+		return nil, fmt.Errorf("cannot convert %s to a number", typeOf(v))
+	},
+	"not": func(v interface{}) (interface{}, error) {
+		return !truthy(v), nil
+	},
+	"floor": numeric(math.Floor),
+	"ceil":  numeric(math.Ceil),
+	"round": numeric(math.Round),
+	"type": func(v interface{}) (interface{}, error) {
+		return typeOf(v), nil
+	},
+}
+
+// numeric adapts a math function to a builtin
+func numeric(fn func(float64) float64) filter {
+	return func(v interface{}) (interface{}, error) {
+		n, ok := v.(float64)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a number", typeOf(v))
+		}
+		return fn(n), nil
+	}
+}
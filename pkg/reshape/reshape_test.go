@@ -0,0 +1,97 @@
+package reshape
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestEval(t *testing.T) {
+	var input interface{}
+	json.Unmarshal([]byte(`{
+		"id": "m2",
+		"ts": 1718000000,
+		"data": {"t": 215, "unit": "dC", "state": "RUN", "tags": ["a", "b", "c"]},
+		"readings": [{"v": 1}, {"v": 2}, {"v": 3}],
+		"key": "rpm",
+		"my key": 7
+	}`), &input)
+
+	for _, tc := range []struct {
+		expr string
+		want string
+	}{
+		{`.`, `null`},
+		{`.id`, `"m2"`},
+		{`.data.t / 10`, `21.5`},
+		{`.data.tags[-1]`, `"c"`},
+		{`.data.tags.[0]`, `"a"`},
+		{`."my key" + 1`, `8`},
+		{`.missing.deeper`, `null`},
+		{`.data.tags[7]`, `null`},
+		{`{temperature: (.data.t / 10), running: (.data.state == "RUN"), id}`, `{"temperature": 21.5, "running": true, "id": "m2"}`},
+		{`{(.key): .data.t}`, `{"rpm": 215}`},
+		{`[.id, .data.unit]`, `["m2", "dC"]`},
+		{`.readings | map(.v * 2) | add`, `12`},
+		{`.readings | length`, `3`},
+		{`.data | keys`, `["state", "t", "tags", "unit"]`},
+		{`.missing // "default"`, `"default"`},
+		{`.id.x // "recovered"`, `"recovered"`},
+		{`if .data.state == "RUN" then 1 elif .data.state == "IDLE" then 0 else -1 end`, `1`},
+		{`.data | if .missing then 1 end | .unit`, `"dC"`},
+		{`.data.t > 200 and .data.unit != "C" or false`, `true`},
+		{`.data.t | not`, `false`},
+		{`.data.t | tostring`, `"215"`},
+		{`"2.5" | tonumber | round`, `3`},
+		{`-(.data.t % 100)`, `-15`},
+		{`{a: 1} + {b: 2}`, `{"a": 1, "b": 2}`},
+		{`.id | type`, `"string"`},
+	} {
+		e, err := Compile(tc.expr)
+		if err != nil {
+			t.Errorf("%s: failed to compile: %v", tc.expr, err)
+			continue
+		}
+		in := input
+		if tc.expr == "." {
+			in = nil
+		}
+		got, err := e.Eval(in)
+		if err != nil {
+			t.Errorf("%s: failed to evaluate: %v", tc.expr, err)
+			continue
+		}
+		var want interface{}
+		json.Unmarshal([]byte(tc.want), &want)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: expected %v, got %v", tc.expr, want, got)
+		}
+	}
+}
+
+func TestEvalNormalizesInput(t *testing.T) {
+	e, _ := Compile(`.rpm + 1`)
+	if got, err := e.Eval(map[string]interface{}{"rpm": 1450}); err != nil || got != 1451.0 {
+		t.Errorf("Expected 1451, got %v %v", got, err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	for _, expr := range []string{``, `.a |`, `{a: }`, `[.a 1]`, `(.a`, `"open`, `if .a then .b`, `unknown`, `{(.a)}`, `.a @`} {
+		if _, err := Compile(expr); !errors.Is(err, ErrInvalidExpression) {
+			t.Errorf("%q: expected ErrInvalidExpression, got %v", expr, err)
+		}
+	}
+
+	for _, expr := range []string{`.a.b`, `.a + 1`, `1 / 0`, `.[0]`, `"x" | tonumber`, `.a | map(.)`, `{(1): 2}`} {
+		e, err := Compile(expr)
+		if err != nil {
+			t.Errorf("%s: failed to compile: %v", expr, err)
+			continue
+		}
+		if _, err := e.Eval(map[string]interface{}{"a": "text"}); !errors.Is(err, ErrEvaluation) {
+			t.Errorf("%s: expected ErrEvaluation, got %v", expr, err)
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// Common errors
+var (
+	ErrSchemaNotFound = errors.New("schema not found")
+	ErrInvalidSchema  = errors.New("invalid schema")
+	ErrViolation      = errors.New("schema violation")
+)
+
+// WarningTopic is published when a twin is written with violations of a
+// schema in Warn mode
+const WarningTopic = "schema.warning"
+
+// WarningsKey is the system metadata key holding the violations of a twin
+// written in Warn mode, see twin.SystemAttribute
+const WarningsKey = "schemaWarnings"
+
+// Mode decides what a violation of a schema does to a write
+type Mode string
+
+// Validation modes
+const (
+	Strict Mode = "strict" // Writes violating the schema are rejected
+	Warn   Mode = "warn"   // Writes are kept and the violations recorded as warnings
+)
+
+// ParseMode parses a validation mode, Strict when empty
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(s); m {
+	case "":
+		return Strict, nil
+	case Strict, Warn:
+		return m, nil
+	}
+	return "", fmt.Errorf("%w: unknown mode %q", ErrInvalidSchema, s)
+}
+
+// Value types of fields
+const (
+	TypeString  = "string"
+	TypeNumber  = "number"
+	TypeBoolean = "boolean"
+	TypeObject  = "object"
+	TypeArray   = "array"
+)
+
+// Field constrains an attribute or property. Empty constraints allow any value.
+type Field struct {
+	Type     string   `json:"type,omitempty"`
+	Required bool     `json:"required,omitempty"`
+	Min      *float64 `json:"min,omitempty"` // Lowest value of numbers
+	Max      *float64 `json:"max,omitempty"` // Highest value of numbers
+}
+
+// Feature constrains a feature and its properties
+type Feature struct {
+	Required   bool             `json:"required,omitempty"`
+	Properties map[string]Field `json:"properties,omitempty"`
+}
+
+// Schema constrains the attributes and features of the twins of a type.
+// Attributes, features and properties it does not list are allowed.
+type Schema struct {
+	Type       string             `json:"type"`
+	Mode       Mode               `json:"mode,omitempty"`
+	Attributes map[string]Field   `json:"attributes,omitempty"`
+	Features   map[string]Feature `json:"features,omitempty"`
+}
+
+// Violation is a part of a twin that does not match its schema
+type Violation struct {
+	Path    string `json:"path"` // Such as attributes.site or features.motor.properties.rpm
+	Message string `json:"message"`
+}
+
+// Manager keeps the schemas of twin types
+type Manager struct {
+	schemas map[string]Schema // Twin type -> schema
+	mutex   sync.RWMutex
+}
+
+// NewManager creates a new schema manager
+func NewManager() *Manager {
+	return &Manager{schemas: make(map[string]Schema)}
+}
+
+// Set declares the schema of a twin type, replacing any previous one
+func (m *Manager) Set(s Schema) error {
+	if s.Type == "" {
+		return fmt.Errorf("%w: type is required", ErrInvalidSchema)
+	}
+	mode, err := ParseMode(string(s.Mode))
+	if err != nil {
+		return err
+	}
+	s.Mode = mode
+
+	for key, f := range s.Attributes {
+		if err := checkField(f); err != nil {
+			return fmt.Errorf("%w: attribute %s: %v", ErrInvalidSchema, key, err)
+		}
+		if twin.IsReservedAttribute(key) {
+			return fmt.Errorf("%w: %v", ErrInvalidSchema, twin.ErrReservedAttribute)
+		}
+	}
+	for id, feature := range s.Features {
+		for key, f := range feature.Properties {
+			if err := checkField(f); err != nil {
+				return fmt.Errorf("%w: property %s/%s: %v", ErrInvalidSchema, id, key, err)
+			}
+		}
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.schemas[s.Type] = s
+	return nil
+}
+
+// checkField checks the constraints of a field
+func checkField(f Field) error {
+	switch f.Type {
+	case "", TypeString, TypeNumber, TypeBoolean, TypeObject, TypeArray:
+	default:
+		return fmt.Errorf("unknown type %q", f.Type)
+	}
+	if (f.Min != nil || f.Max != nil) && f.Type != "" && f.Type != TypeNumber {
+		return errors.New("min and max only apply to numbers")
+	}
+	if f.Min != nil && f.Max != nil && *f.Min > *f.Max {
+		return errors.New("min is greater than max")
+	}
+	return nil
+}
+
+// Get returns the schema of a twin type
+func (m *Manager) Get(twinType string) (Schema, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	s, exists := m.schemas[twinType]
+	if !exists {
+		return Schema{}, ErrSchemaNotFound
+	}
+	return s, nil
+}
+
+// List returns all schemas sorted by type
+func (m *Manager) List() []Schema {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	result := make([]Schema, 0, len(m.schemas))
+	for _, s := range m.schemas {
+		result = append(result, s)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Type < result[j].Type })
+	return result
+}
+
+// Delete removes the schema of a twin type. Warnings recorded on twins
+// under it are cleared by their next write.
+func (m *Manager) Delete(twinType string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, exists := m.schemas[twinType]; !exists {
+		return ErrSchemaNotFound
+	}
+	delete(m.schemas, twinType)
+	return nil
+}
+
+// Check returns the violations of a twin against the schema of its type,
+// sorted by path, and the mode of the schema. Twins of types without a
+// schema have no violations.
+func (m *Manager) Check(dt *twin.DigitalTwin) ([]Violation, Mode) {
+	m.mutex.RLock()
+	s, exists := m.schemas[dt.Type]
+	m.mutex.RUnlock()
+	if !exists {
+		return nil, Strict
+	}
+
+	var violations []Violation
+	attributes := dt.GetAllAttributes()
+	for key, f := range s.Attributes {
+		value, exists := attributes[key]
+		violations = checkValue(violations, "attributes."+key, f, value, exists)
+	}
+
+	for id, fs := range s.Features {
+		path := "features." + id
+		feature, exists := dt.GetFeature(id)
+		if !exists {
+			if fs.Required {
+				violations = append(violations, Violation{path, "feature is required"})
+			}
+			continue
+		}
+
+		properties := feature.GetAllProperties()
+		for key, f := range fs.Properties {
+			value, exists := properties[key]
+			violations = checkValue(violations, path+".properties."+key, f, value, exists)
+		}
+	}
+
+	sort.Slice(violations, func(i, j int) bool { return violations[i].Path < violations[j].Path })
+	return violations, s.Mode
+}
+
+// Validate checks a twin about to be written against the schema of its
+// type. Violations of a Strict schema are returned with an error wrapping
+// ErrViolation. Those of a Warn schema are recorded on the twin under
+// WarningsKey and returned as warnings; warnings recorded before are
+// cleared once the twin conforms.
+func (m *Manager) Validate(dt *twin.DigitalTwin) ([]Violation, error) {
+	violations, mode := m.Check(dt)
+	if len(violations) > 0 && mode == Strict {
+		return violations, fmt.Errorf("%w: %s %s", ErrViolation, violations[0].Path, violations[0].Message)
+	}
+
+	if len(violations) == 0 {
+		if _, warned := dt.GetSystem(WarningsKey); warned {
+			dt.SetSystem(WarningsKey, nil)
+		}
+		return nil, nil
+	}
+
+	// Attribute values are kept as decoded JSON
+	warnings := make([]interface{}, len(violations))
+	for i, v := range violations {
+		warnings[i] = map[string]interface{}{"path": v.Path, "message": v.Message}
+	}
+	dt.SetSystem(WarningsKey, warnings)
+	return violations, nil
+}
+
+// Warning returns the payload of the WarningTopic event of a twin written
+// with violations of a Warn schema
+func Warning(twinID string, violations []Violation) map[string]interface{} {
+	return map[string]interface{}{
+		"twinId":     twinID,
+		"violations": violations,
+	}
+}
+
+// checkValue appends the violations of a value of a field
+func checkValue(violations []Violation, path string, f Field, value interface{}, exists bool) []Violation {
+	if !exists || value == nil {
+		if f.Required {
+			violations = append(violations, Violation{path, "value is required"})
+		}
+		return violations
+	}
+
+	t := valueType(value)
+	if f.Type != "" && t != f.Type {
+		return append(violations, Violation{path, fmt.Sprintf("expected %s, got %s", f.Type, t)})
+	}
+	if t != TypeNumber {
+		return violations
+	}
+
+	n := number(value)
+	if f.Min != nil && n < *f.Min {
+		violations = append(violations, Violation{path, fmt.Sprintf("%v is less than %v", n, *f.Min)})
+	}
+	if f.Max != nil && n > *f.Max {
+		violations = append(violations, Violation{path, fmt.Sprintf("%v is greater than %v", n, *f.Max)})
+	}
+	return violations
+}
+
+// valueType returns the field type of a value
+func valueType(value interface{}) string {
+	switch value.(type) {
+	case string:
+		return TypeString
+	case bool:
+		return TypeBoolean
+	case float64, float32, int, int32, int64, uint, uint32, uint64:
+		return TypeNumber
+	case map[string]interface{}:
+		return TypeObject
+	case []interface{}, []string, []float64:
+		return TypeArray
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// number returns a numeric value as a float64
+func number(value interface{}) float64 {
+	switch n := value.(type) {
+	case float64:
+		return n
+	case float32:
+		return float64(n)
+	case int:
+		return float64(n)
+	case int32:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case uint:
+		return float64(n)
+	case uint32:
+		return float64(n)
+	case uint64:
+		return float64(n)
+	}
+	return 0
+}
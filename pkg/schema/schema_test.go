@@ -0,0 +1,94 @@
+package schema
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestCheck(t *testing.T) {
+	m := NewManager()
+	max := 3000.0
+	err := m.Set(Schema{
+		Type: "pump",
+		Attributes: map[string]Field{
+			"site":   {Type: TypeString, Required: true},
+			"vendor": {Type: TypeString},
+		},
+		Features: map[string]Feature{
+			"motor": {Required: true, Properties: map[string]Field{"rpm": {Type: TypeNumber, Max: &max}}},
+			"seal":  {Properties: map[string]Field{"worn": {Type: TypeBoolean, Required: true}}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to set schema: %v", err)
+	}
+
+	pump := twin.NewDigitalTwin("pump-1", "pump")
+	pump.SetAttribute("vendor", 42.0)
+	pump.SetAttribute("color", "red")
+	violations, mode := m.Check(pump)
+	if mode != Strict {
+		t.Errorf("Expected the strict mode by default, got %s", mode)
+	}
+	want := []Violation{
+		{"attributes.site", "value is required"},
+		{"attributes.vendor", "expected string, got number"},
+		{"features.motor", "feature is required"},
+	}
+	if !reflect.DeepEqual(violations, want) {
+		t.Errorf("Expected %v, got %v", want, violations)
+	}
+
+	pump.SetAttribute("site", "north")
+	pump.SetAttribute("vendor", "acme")
+	motor := twin.NewFeatureState()
+	motor.SetProperty("rpm", 3500)
+	pump.AddFeature("motor", motor)
+	if violations, _ := m.Check(pump); !reflect.DeepEqual(violations, []Violation{{"features.motor.properties.rpm", "3500 is greater than 3000"}}) {
+		t.Errorf("Unexpected violations %v", violations)
+	}
+
+	motor.SetProperty("rpm", 1450.0)
+	pump.UpdateFeature("motor", motor)
+	if violations, _ := m.Check(pump); violations != nil {
+		t.Errorf("Expected no violations, got %v", violations)
+	}
+
+	// Twins of types without a schema are not checked
+	if violations, _ := m.Check(twin.NewDigitalTwin("valve-1", "valve")); violations != nil {
+		t.Errorf("Expected no violations, got %v", violations)
+	}
+}
+
+func TestSetInvalidSchema(t *testing.T) {
+	m := NewManager()
+	min, max := 10.0, 1.0
+	for _, s := range []Schema{
+		{},
+		{Type: "pump", Mode: "lenient"},
+		{Type: "pump", Attributes: map[string]Field{"site": {Type: "text"}}},
+		{Type: "pump", Attributes: map[string]Field{"site": {Type: TypeString, Min: &min}}},
+		{Type: "pump", Attributes: map[string]Field{twin.SystemAttribute: {}}},
+		{Type: "pump", Features: map[string]Feature{"motor": {Properties: map[string]Field{"rpm": {Min: &min, Max: &max}}}}},
+	} {
+		if err := m.Set(s); !errors.Is(err, ErrInvalidSchema) {
+			t.Errorf("%+v: expected ErrInvalidSchema, got %v", s, err)
+		}
+	}
+
+	if err := m.Set(Schema{Type: "pump", Mode: Warn}); err != nil {
+		t.Fatalf("Failed to set schema: %v", err)
+	}
+	if s, _ := m.Get("pump"); s.Mode != Warn || len(m.List()) != 1 {
+		t.Errorf("Unexpected schemas %v", m.List())
+	}
+	if err := m.Delete("pump"); err != nil {
+		t.Errorf("Failed to delete schema: %v", err)
+	}
+	if err := m.Delete("pump"); err != ErrSchemaNotFound {
+		t.Errorf("Expected ErrSchemaNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,409 @@
+package script
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/ingest"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// Bundle errors
+var (
+	ErrBundleNotFound      = errors.New("script bundle not found")
+	ErrBundleAlreadyExists = errors.New("script bundle already exists")
+	ErrInvalidBundle       = errors.New("invalid script bundle")
+	ErrBundleActive        = errors.New("script bundle is active")
+	ErrNoPreviousBundle    = errors.New("no previous scripts to roll back to")
+)
+
+// RecordedBatches is the number of recently ingested telemetry batches kept
+// for validating bundles
+const RecordedBatches = 1000
+
+// BundleState tells whether a bundle is live
+type BundleState string
+
+// Bundle states
+const (
+	BundleStaged  BundleState = "staged"  // Compiled but never live
+	BundleActive  BundleState = "active"  // The live scripts
+	BundleRetired BundleState = "retired" // Live before, replaced by another bundle
+)
+
+// Bundle is a versioned set of rules, computed properties and transforms
+// that replaces all live scripts at once when activated
+type Bundle struct {
+	Version     string      `json:"version"`
+	Description string      `json:"description,omitempty"`
+	Scripts     []Script    `json:"scripts"`
+	State       BundleState `json:"state"`
+	StagedAt    time.Time   `json:"stagedAt"`
+	ActivatedAt *time.Time  `json:"activatedAt,omitempty"`
+}
+
+// bundle is a staged bundle with its compiled scripts
+type bundle struct {
+	Bundle
+	scripts map[string]*compiled
+}
+
+// liveSet is a set of live scripts and the bundle version it belongs to
+type liveSet struct {
+	version string
+	scripts map[string]*compiled
+	set     bool
+}
+
+// ScriptValidation reports how a script of a bundle ran on recorded telemetry
+type ScriptValidation struct {
+	Name      string `json:"name"`
+	Kind      Kind   `json:"kind"`
+	Runs      int    `json:"runs"`
+	Errors    int    `json:"errors"`
+	LastError string `json:"lastError,omitempty"`
+	Triggered int    `json:"triggered,omitempty"` // Runs of a rule with a truthy result
+	Changed   int    `json:"changed"`             // Runs whose result differs from the live script of the same name
+	New       bool   `json:"new,omitempty"`       // No live script has the same name
+}
+
+// ValidationReport is the result of replaying recorded telemetry through a
+// bundle and through the live scripts
+type ValidationReport struct {
+	Version string             `json:"version"`
+	Batches int                `json:"batches"` // Recorded batches replayed
+	Skipped int                `json:"skipped"` // Recorded batches of twins that no longer exist
+	Valid   bool               `json:"valid"`   // No script of the bundle failed
+	Scripts []ScriptValidation `json:"scripts"`
+	Removed []string           `json:"removed,omitempty"` // Live scripts the bundle does not contain
+}
+
+// Stage compiles a bundle and keeps it for validation and activation. The
+// live scripts are not affected.
+func (m *Manager) Stage(b Bundle) error {
+	if b.Version == "" {
+		return fmt.Errorf("%w: version is required", ErrInvalidBundle)
+	}
+
+	scripts := make(map[string]*compiled, len(b.Scripts))
+	for _, s := range b.Scripts {
+		if _, exists := scripts[s.Name]; exists {
+			return fmt.Errorf("%w: duplicate script %q", ErrInvalidBundle, s.Name)
+		}
+		c, err := compile(s)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+		}
+		scripts[s.Name] = c
+	}
+
+	b.State = BundleStaged
+	b.StagedAt = time.Now()
+	b.ActivatedAt = nil
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, exists := m.bundles[b.Version]; exists {
+		return ErrBundleAlreadyExists
+	}
+	m.bundles[b.Version] = &bundle{Bundle: b, scripts: scripts}
+	return nil
+}
+
+// GetBundle returns a bundle
+func (m *Manager) GetBundle(version string) (Bundle, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	b, exists := m.bundles[version]
+	if !exists {
+		return Bundle{}, ErrBundleNotFound
+	}
+	return b.Bundle, nil
+}
+
+// Bundles returns all bundles in the order they were staged
+func (m *Manager) Bundles() []Bundle {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	result := make([]Bundle, 0, len(m.bundles))
+	for _, b := range m.bundles {
+		result = append(result, b.Bundle)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].StagedAt.Equal(result[j].StagedAt) {
+			return result[i].StagedAt.Before(result[j].StagedAt)
+		}
+		return result[i].Version < result[j].Version
+	})
+	return result
+}
+
+// ActiveBundle returns the version of the live bundle, or an empty string
+// while the live scripts were created one by one
+func (m *Manager) ActiveBundle() string {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return m.active
+}
+
+// DeleteBundle removes a bundle that is not live. A rollback can no longer
+// return to a deleted bundle.
+func (m *Manager) DeleteBundle(version string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, exists := m.bundles[version]; !exists {
+		return ErrBundleNotFound
+	}
+	if version == m.active {
+		return ErrBundleActive
+	}
+	if m.previous.set && m.previous.version == version {
+		m.previous = liveSet{}
+	}
+	delete(m.bundles, version)
+	return nil
+}
+
+// Activate atomically replaces all live scripts with those of a bundle.
+// Events and telemetry are processed either entirely by the old scripts or
+// entirely by the new ones. Scripts created, replaced or deleted one by one
+// afterwards change the live bundle; a rollback restores the scripts that
+// were live before the switch.
+func (m *Manager) Activate(version string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	b, exists := m.bundles[version]
+	if !exists {
+		return ErrBundleNotFound
+	}
+	if version == m.active {
+		return nil
+	}
+
+	// Scripts created or deleted one by one change the live set, not the bundle
+	scripts := make(map[string]*compiled, len(b.scripts))
+	for name, c := range b.scripts {
+		scripts[name] = c
+	}
+	m.switchTo(liveSet{version: version, scripts: scripts, set: true})
+	return nil
+}
+
+// Rollback restores the scripts that were live before the last switch and
+// returns their bundle version. Rolling back twice returns to the newer scripts.
+func (m *Manager) Rollback() (string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if !m.previous.set {
+		return "", ErrNoPreviousBundle
+	}
+
+	restored := m.previous
+	m.switchTo(restored)
+	return restored.version, nil
+}
+
+// switchTo makes a set of scripts live and remembers the current ones; the
+// caller must hold the mutex
+func (m *Manager) switchTo(next liveSet) {
+	if b, exists := m.bundles[m.active]; exists {
+		b.State = BundleRetired
+	}
+	m.previous = liveSet{version: m.active, scripts: m.scripts, set: true}
+
+	m.scripts = next.scripts
+	m.active = next.version
+	if b, exists := m.bundles[next.version]; exists {
+		now := time.Now()
+		b.State = BundleActive
+		b.ActivatedAt = &now
+	}
+}
+
+// record keeps a copy of an ingested telemetry batch for validating bundles
+func (m *Manager) record(t ingest.Telemetry) {
+	c := t
+	c.Features = make(map[string]map[string]interface{}, len(t.Features))
+	for id, props := range t.Features {
+		copied := make(map[string]interface{}, len(props))
+		for k, v := range props {
+			copied[k] = v
+		}
+		c.Features[id] = copied
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.recorded = append(m.recorded, c)
+	if len(m.recorded) > RecordedBatches {
+		m.recorded = m.recorded[len(m.recorded)-RecordedBatches:]
+	}
+}
+
+// Recorded returns the number of telemetry batches available for validation
+func (m *Manager) Recorded() int {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return len(m.recorded)
+}
+
+// outcome is the result of a script on one replayed batch
+type outcome struct {
+	result    string
+	err       error
+	triggered bool
+}
+
+// ValidateBundle replays the recorded telemetry through the scripts of a bundle
+// and through the live scripts, each batch on a copy of the current state
+// of its twin, and compares their results script by script. Nothing is
+// stored or published, and the run statistics of scripts are not affected.
+func (m *Manager) ValidateBundle(version string) (ValidationReport, error) {
+	m.mutex.RLock()
+	b, exists := m.bundles[version]
+	live := m.scripts
+	recorded := append([]ingest.Telemetry(nil), m.recorded...)
+	m.mutex.RUnlock()
+	if !exists {
+		return ValidationReport{}, ErrBundleNotFound
+	}
+
+	report := ValidationReport{Version: version, Valid: true}
+	results := make(map[string]*ScriptValidation, len(b.scripts))
+	for name, c := range b.scripts {
+		_, isLive := live[name]
+		results[name] = &ScriptValidation{Name: name, Kind: c.status.Kind, New: !isLive}
+	}
+	for name := range live {
+		if _, exists := b.scripts[name]; !exists {
+			report.Removed = append(report.Removed, name)
+		}
+	}
+	sort.Strings(report.Removed)
+
+	for _, t := range recorded {
+		dt, err := m.registry.Get(t.TwinID)
+		if err != nil {
+			report.Skipped++
+			continue
+		}
+		report.Batches++
+
+		candidate := replay(b.scripts, t, dt)
+		current := replay(live, t, dt)
+		for name, o := range candidate {
+			r := results[name]
+			r.Runs++
+			if o.err != nil {
+				r.Errors++
+				r.LastError = o.err.Error()
+				report.Valid = false
+			}
+			if o.triggered {
+				r.Triggered++
+			}
+			if c, exists := current[name]; exists && !sameOutcome(o, c) {
+				r.Changed++
+			}
+		}
+	}
+
+	report.Scripts = make([]ScriptValidation, 0, len(results))
+	for _, r := range results {
+		report.Scripts = append(report.Scripts, *r)
+	}
+	sort.Slice(report.Scripts, func(i, j int) bool { return report.Scripts[i].Name < report.Scripts[j].Name })
+	return report, nil
+}
+
+// sameOutcome reports whether two scripts produced the same result
+func sameOutcome(a, b outcome) bool {
+	if (a.err == nil) != (b.err == nil) {
+		return false
+	}
+	return a.result == b.result
+}
+
+// replay runs a telemetry batch through a set of scripts the way ingestion
+// and event handling would: transforms first, then computed properties and
+// rules on a copy of the twin with the batch applied. A failing transform
+// rejects the batch, so later scripts do not run.
+func replay(scripts map[string]*compiled, t ingest.Telemetry, dt *twin.DigitalTwin) map[string]outcome {
+	byKind := func(kind Kind) []*compiled {
+		var result []*compiled
+		for _, c := range scripts {
+			if c.status.Kind != kind {
+				continue
+			}
+			if kind != KindTransform && c.status.TwinType != "" && c.status.TwinType != dt.Type {
+				continue
+			}
+			result = append(result, c)
+		}
+		sort.Slice(result, func(i, j int) bool { return result[i].status.Name < result[j].status.Name })
+		return result
+	}
+
+	outcomes := make(map[string]outcome)
+	features := t.Features
+	for _, c := range byKind(KindTransform) {
+		t.Features = features
+		value, err := run(c.status.Name, c.fn, telemetryDocument(t), c.limits)
+		if err == nil {
+			features, err = transformed(c.status.Name, value)
+		}
+		outcomes[c.status.Name] = outcome{result: fmt.Sprint(value), err: err}
+		if err != nil {
+			return outcomes
+		}
+	}
+
+	clone := dt.Clone()
+	for featureID, props := range features {
+		feature, exists := clone.GetFeature(featureID)
+		if !exists {
+			feature = twin.NewFeatureState()
+			clone.AddFeature(featureID, feature)
+		}
+		for k, v := range props {
+			feature.SetProperty(k, v)
+		}
+	}
+
+	for _, c := range byKind(KindComputed) {
+		value, err := run(c.status.Name, c.fn, twinDocument(clone), c.limits)
+		outcomes[c.status.Name] = outcome{result: fmt.Sprint(value), err: err}
+		if err != nil {
+			continue
+		}
+		feature, exists := clone.GetFeature(c.status.Feature)
+		if !exists {
+			feature = twin.NewFeatureState()
+			clone.AddFeature(c.status.Feature, feature)
+		}
+		feature.SetProperty(c.status.Property, value)
+	}
+
+	for _, c := range byKind(KindRule) {
+		value, err := run(c.status.Name, c.fn, twinDocument(clone), c.limits)
+		sv, _ := toStarlark(value)
+		outcomes[c.status.Name] = outcome{
+			result:    fmt.Sprint(value),
+			err:       err,
+			triggered: err == nil && sv != nil && bool(sv.Truth()),
+		}
+	}
+	return outcomes
+}
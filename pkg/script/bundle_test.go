@@ -0,0 +1,177 @@
+package script
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/history"
+	"github.com/aleka07/go-digital-twin/pkg/ingest"
+)
+
+const yieldSource = `
+def compute(twin):
+    c = twin["features"]["counter"]["properties"]
+    return c["good"] / c["total"]
+`
+
+func TestStageAndActivate(t *testing.T) {
+	m, _, _ := setupManager()
+	m.Create(Script{Name: "legacy", Kind: KindRule, Source: "def evaluate(twin):\n    return False\n"})
+
+	invalid := []Bundle{
+		{Scripts: []Script{{Name: "yield", Kind: KindComputed, Source: yieldSource, Feature: "kpi", Property: "yield"}}},
+		{Version: "v1", Scripts: []Script{{Name: "broken", Kind: KindRule, Source: "def evaluate(twin):\n    return (\n"}}},
+		{Version: "v1", Scripts: []Script{
+			{Name: "twice", Kind: KindRule, Source: "def evaluate(twin):\n    return True\n"},
+			{Name: "twice", Kind: KindRule, Source: "def evaluate(twin):\n    return False\n"},
+		}},
+	}
+	for _, b := range invalid {
+		if err := m.Stage(b); !errors.Is(err, ErrInvalidBundle) {
+			t.Errorf("Expected ErrInvalidBundle for %+v, got %v", b, err)
+		}
+	}
+
+	v1 := Bundle{Version: "v1", Scripts: []Script{{Name: "yield", Kind: KindComputed, Source: yieldSource, Feature: "kpi", Property: "yield"}}}
+	if err := m.Stage(v1); err != nil {
+		t.Fatalf("Failed to stage bundle: %v", err)
+	}
+	if err := m.Stage(v1); err != ErrBundleAlreadyExists {
+		t.Errorf("Expected ErrBundleAlreadyExists, got %v", err)
+	}
+	if _, err := m.Get("yield"); err != ErrScriptNotFound {
+		t.Errorf("Expected a staged bundle not to be live, got %v", err)
+	}
+
+	if err := m.Activate("v1"); err != nil {
+		t.Fatalf("Failed to activate bundle: %v", err)
+	}
+	if _, err := m.Get("legacy"); err != ErrScriptNotFound {
+		t.Errorf("Expected the previous scripts to be replaced, got %v", err)
+	}
+	if b, _ := m.GetBundle("v1"); b.State != BundleActive || b.ActivatedAt == nil || m.ActiveBundle() != "v1" {
+		t.Errorf("Expected v1 to be active, got %+v", b)
+	}
+	if err := m.DeleteBundle("v1"); err != ErrBundleActive {
+		t.Errorf("Expected ErrBundleActive, got %v", err)
+	}
+
+	// Scripts created after the switch do not change the staged bundle
+	m.Create(Script{Name: "extra", Kind: KindRule, Source: "def evaluate(twin):\n    return False\n"})
+	m.Stage(Bundle{Version: "v2"})
+	m.Activate("v2")
+	m.Rollback()
+	if _, err := m.Get("extra"); err != nil {
+		t.Errorf("Expected the rollback to restore the live scripts, got %v", err)
+	}
+	m.Rollback()
+	m.Activate("v1")
+	if _, err := m.Get("extra"); err != ErrScriptNotFound {
+		t.Errorf("Expected the bundle to be unchanged, got %v", err)
+	}
+	if list := m.Bundles(); len(list) != 2 || list[0].Version != "v1" || list[1].State != BundleRetired {
+		t.Errorf("Unexpected bundles %+v", list)
+	}
+}
+
+func TestRollback(t *testing.T) {
+	m, _, _ := setupManager()
+	m.Create(Script{Name: "legacy", Kind: KindRule, Source: "def evaluate(twin):\n    return False\n"})
+
+	if _, err := m.Rollback(); err != ErrNoPreviousBundle {
+		t.Errorf("Expected ErrNoPreviousBundle, got %v", err)
+	}
+
+	m.Stage(Bundle{Version: "v1", Scripts: []Script{{Name: "yield", Kind: KindComputed, Source: yieldSource, Feature: "kpi", Property: "yield"}}})
+	m.Activate("v1")
+
+	version, err := m.Rollback()
+	if err != nil || version != "" {
+		t.Fatalf("Expected a rollback to the scripts created one by one, got %q (%v)", version, err)
+	}
+	if _, err := m.Get("legacy"); err != nil {
+		t.Errorf("Expected the previous scripts to be live again, got %v", err)
+	}
+	if b, _ := m.GetBundle("v1"); b.State != BundleRetired {
+		t.Errorf("Expected v1 to be retired, got %s", b.State)
+	}
+
+	// Rolling back again returns to the bundle
+	if version, _ := m.Rollback(); version != "v1" || m.ActiveBundle() != "v1" {
+		t.Errorf("Expected v1 to be active again, got %q", version)
+	}
+
+	m.Stage(Bundle{Version: "v2"})
+	m.Activate("v2")
+	m.DeleteBundle("v1")
+	if _, err := m.Rollback(); err != ErrNoPreviousBundle {
+		t.Errorf("Expected ErrNoPreviousBundle after deleting the previous bundle, got %v", err)
+	}
+}
+
+func TestValidateBundle(t *testing.T) {
+	m, reg, pubsub := setupManager()
+	m.Create(Script{Name: "yield", Kind: KindComputed, Source: yieldSource, Feature: "kpi", Property: "yield"})
+
+	in := ingest.NewIngester(reg, pubsub, history.NewStore(0))
+	in.AddTransform("scripts", m)
+	for _, good := range []float64{95, 0} {
+		in.Apply(ingest.Telemetry{
+			TwinID:   "machine-1",
+			Features: map[string]map[string]interface{}{"counter": {"good": good, "total": 100.0}},
+		})
+	}
+	// Batches of twins deleted since they were recorded are skipped
+	m.Transform(&ingest.Telemetry{TwinID: "machine-9", Features: map[string]map[string]interface{}{"counter": {"good": 1.0}}})
+	if m.Recorded() != 3 {
+		t.Fatalf("Expected 3 recorded batches, got %d", m.Recorded())
+	}
+
+	m.Stage(Bundle{Version: "v2", Scripts: []Script{
+		{Name: "yield", Kind: KindComputed, Feature: "kpi", Property: "yield", Source: `
+def compute(twin):
+    c = twin["features"]["counter"]["properties"]
+    return int(c["good"] * 100 / c["total"])
+`},
+		{Name: "low-yield", Kind: KindRule, Source: `
+def evaluate(twin):
+    return twin["features"]["kpi"]["properties"]["yield"] < 50
+`},
+		{Name: "ratio", Kind: KindComputed, Feature: "kpi", Property: "scrap", Source: `
+def compute(twin):
+    c = twin["features"]["counter"]["properties"]
+    return (c["total"] - c["good"]) // c["good"]
+`},
+	}})
+
+	report, err := m.ValidateBundle("v2")
+	if err != nil {
+		t.Fatalf("Failed to validate bundle: %v", err)
+	}
+	if report.Batches != 2 || report.Skipped != 1 || report.Valid {
+		t.Errorf("Unexpected report %+v", report)
+	}
+	if len(report.Scripts) != 3 {
+		t.Fatalf("Expected 3 scripts, got %+v", report.Scripts)
+	}
+
+	lowYield, ratio, yield := report.Scripts[0], report.Scripts[1], report.Scripts[2]
+	if lowYield.Runs != 2 || lowYield.Triggered != 1 || !lowYield.New {
+		t.Errorf("Unexpected rule validation %+v", lowYield)
+	}
+	if ratio.Errors != 1 || ratio.LastError == "" {
+		t.Errorf("Expected the division by zero to be reported, got %+v", ratio)
+	}
+	if yield.Runs != 2 || yield.Changed != 1 || yield.Errors != 0 || yield.New {
+		t.Errorf("Unexpected computed validation %+v", yield)
+	}
+
+	// Validation neither changes the twin nor the statistics of live scripts
+	if status, _ := m.Get("yield"); status.Runs != 0 {
+		t.Errorf("Expected the live script not to run, got %d runs", status.Runs)
+	}
+
+	if _, err := m.ValidateBundle("v9"); err != ErrBundleNotFound {
+		t.Errorf("Expected ErrBundleNotFound, got %v", err)
+	}
+}
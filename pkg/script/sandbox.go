@@ -0,0 +1,92 @@
+package script
+
+import (
+	"fmt"
+	"time"
+
+	"go.starlark.net/starlark"
+)
+
+// newThread creates a sandboxed Starlark thread. Loading other modules is not
+// allowed, and print output is discarded.
+func newThread(name string, limits Limits) (*starlark.Thread, func()) {
+	thread := &starlark.Thread{
+		Name:  name,
+		Print: func(*starlark.Thread, string) {},
+		Load: func(*starlark.Thread, string) (starlark.StringDict, error) {
+			return nil, fmt.Errorf("load is not allowed")
+		},
+	}
+	thread.SetMaxExecutionSteps(limits.MaxSteps)
+
+	timer := time.AfterFunc(limits.Timeout, func() {
+		thread.Cancel(fmt.Sprintf("timeout after %s", limits.Timeout))
+	})
+	return thread, func() { timer.Stop() }
+}
+
+// exec executes the top level of a script and returns its globals
+func exec(name, source string, limits Limits) (starlark.StringDict, error) {
+	thread, done := newThread(name, limits)
+	defer done()
+
+	globals, err := starlark.ExecFile(thread, name+".star", source, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Functions may close over globals; freeze them so that calls cannot
+	// carry state from one event to the next
+	globals.Freeze()
+	return globals, nil
+}
+
+// run calls a script function with a single argument within the limits.
+// Results larger than MaxResultSize are rejected rather than written to
+// twins or events.
+func run(name string, fn starlark.Callable, arg interface{}, limits Limits) (interface{}, error) {
+	sv, err := toStarlark(arg)
+	if err != nil {
+		return nil, err
+	}
+
+	thread, done := newThread(name, limits)
+	defer done()
+
+	result, err := starlark.Call(thread, fn, starlark.Tuple{sv}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if size := sizeOf(result, MaxResultSize); size > MaxResultSize {
+		return nil, fmt.Errorf("result exceeds %d bytes", MaxResultSize)
+	}
+	return fromStarlark(result)
+}
+
+// sizeOf estimates the size of a value, counting the bytes of strings and a
+// word for other values. It stops counting once the size exceeds max.
+func sizeOf(v starlark.Value, max int) int {
+	const word = 8
+	switch v := v.(type) {
+	case starlark.String:
+		return len(v)
+	case starlark.Bytes:
+		return len(v)
+	case starlark.Indexable: // Lists and tuples
+		size := word
+		for i := 0; i < v.Len() && size <= max; i++ {
+			size += sizeOf(v.Index(i), max-size)
+		}
+		return size
+	case starlark.IterableMapping: // Dicts
+		size := word
+		for _, item := range v.Items() {
+			if size > max {
+				break
+			}
+			size += sizeOf(item[0], max-size) + sizeOf(item[1], max-size)
+		}
+		return size
+	}
+	return word
+}
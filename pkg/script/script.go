@@ -0,0 +1,562 @@
+package script
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/eventbus"
+	"github.com/aleka07/go-digital-twin/pkg/ingest"
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+	"go.starlark.net/starlark"
+)
+
+// Common errors
+var (
+	ErrScriptNotFound      = errors.New("script not found")
+	ErrScriptAlreadyExists = errors.New("script already exists")
+	ErrInvalidScript       = errors.New("invalid script")
+)
+
+// Kind determines when a script runs and which function it must define
+type Kind string
+
+// Script kinds
+const (
+	// KindRule scripts define evaluate(twin) and run after property changes.
+	// A rule.triggered event is published when the result becomes truthy.
+	KindRule Kind = "rule"
+	// KindComputed scripts define compute(twin) and run after property changes.
+	// The result is written to the target property of the script.
+	KindComputed Kind = "computed"
+	// KindTransform scripts define transform(telemetry) and run on ingested
+	// telemetry before it is applied. They return the new features dict.
+	KindTransform Kind = "transform"
+)
+
+// entryPoints maps script kinds to the function they must define
+var entryPoints = map[Kind]string{
+	KindRule:      "evaluate",
+	KindComputed:  "compute",
+	KindTransform: "transform",
+}
+
+// RuleTopic is the topic published when a rule is triggered
+const RuleTopic = "rule.triggered"
+
+// MaxSourceSize is the maximum size of a script in bytes
+const MaxSourceSize = 64 * 1024
+
+// Limits bound the execution of a single script call. They do not bound
+// its memory: Starlark has no allocation limit of its own, and a single
+// operation such as repeating a string may allocate up to 1 GiB without
+// costing more than a step. Only results are limited, to MaxResultSize.
+type Limits struct {
+	MaxSteps uint64        // Maximum number of Starlark execution steps
+	Timeout  time.Duration // Maximum wall-clock time
+}
+
+// DefaultLimits are applied to scripts that do not set their own limits
+var DefaultLimits = Limits{MaxSteps: 100000, Timeout: 100 * time.Millisecond}
+
+// MaxLimits are the highest limits scripts may set
+var MaxLimits = Limits{MaxSteps: 10000000, Timeout: 5 * time.Second}
+
+// MaxResultSize is the maximum size in bytes of the value a script call
+// returns, counting the bytes of strings and a word for other values
+const MaxResultSize = 1 << 20
+
+// Suppressor decides whether the action of a triggered rule is withheld,
+// e.g. during maintenance
+type Suppressor interface {
+	Suppress(topic, twinID string, payload interface{}) bool
+}
+
+// Script is a Starlark program uploaded through the API
+type Script struct {
+	Name     string `json:"name"`
+	Kind     Kind   `json:"kind"`
+	Source   string `json:"source"`
+	Feature  string `json:"feature,omitempty"`  // Target feature of computed scripts
+	Property string `json:"property,omitempty"` // Target property of computed scripts
+	TwinType string `json:"twinType,omitempty"` // Only run for twins of this type
+	MaxSteps uint64 `json:"maxSteps,omitempty"`
+	Timeout  string `json:"timeout,omitempty"`
+}
+
+// Status reports how a script has been running
+type Status struct {
+	Script
+	Runs      int       `json:"runs"`
+	Errors    int       `json:"errors"`
+	LastError string    `json:"lastError,omitempty"`
+	LastRun   time.Time `json:"lastRun,omitempty"`
+}
+
+// compiled is a registered script with its entry point
+type compiled struct {
+	status    Status
+	limits    Limits
+	fn        starlark.Callable
+	triggered map[string]bool // Twin ID -> last rule result
+}
+
+// Manager runs rule, computed property and transform scripts.
+// Scripts run in a sandbox without load(), file or network access.
+type Manager struct {
+	registry *registry.Registry
+	pubsub   eventbus.Publisher
+	scripts  map[string]*compiled // Live scripts
+	bundles  map[string]*bundle   // Version -> staged, active or retired bundle
+	active   string               // Version of the live scripts, empty before the first switch
+	previous liveSet              // Live scripts before the last switch
+	recorded []ingest.Telemetry   // Recently ingested batches, oldest first
+	suppress Suppressor
+	mutex    sync.RWMutex
+}
+
+// NewManager creates a new script manager
+func NewManager(reg *registry.Registry, pubsub eventbus.Publisher) *Manager {
+	return &Manager{
+		registry: reg,
+		pubsub:   pubsub,
+		scripts:  make(map[string]*compiled),
+		bundles:  make(map[string]*bundle),
+	}
+}
+
+// Create compiles and registers a script. Top-level statements are executed
+// once, within the limits of the script.
+func (m *Manager) Create(s Script) error {
+	c, err := compile(s)
+	if err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, exists := m.scripts[s.Name]; exists {
+		return ErrScriptAlreadyExists
+	}
+
+	m.scripts[s.Name] = c
+	return nil
+}
+
+// Replace compiles a script and replaces the registered script of the same
+// name. The old script keeps running when the new one does not compile.
+// Run statistics and rule states start over.
+func (m *Manager) Replace(s Script) error {
+	c, err := compile(s)
+	if err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, exists := m.scripts[s.Name]; !exists {
+		return ErrScriptNotFound
+	}
+
+	m.scripts[s.Name] = c
+	return nil
+}
+
+// Validate checks that a script compiles without registering it
+func (m *Manager) Validate(s Script) error {
+	_, err := compile(s)
+	return err
+}
+
+// compile validates a script and executes its top-level statements
+func compile(s Script) (*compiled, error) {
+	if s.Name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidScript)
+	}
+
+	entry, ok := entryPoints[s.Kind]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown kind %q", ErrInvalidScript, s.Kind)
+	}
+
+	if s.Kind == KindComputed && (s.Feature == "" || s.Property == "") {
+		return nil, fmt.Errorf("%w: computed scripts require a feature and property", ErrInvalidScript)
+	}
+
+	if len(s.Source) > MaxSourceSize {
+		return nil, fmt.Errorf("%w: source exceeds %d bytes", ErrInvalidScript, MaxSourceSize)
+	}
+
+	limits := DefaultLimits
+	if s.MaxSteps > 0 {
+		if s.MaxSteps > MaxLimits.MaxSteps {
+			return nil, fmt.Errorf("%w: maxSteps exceeds %d", ErrInvalidScript, MaxLimits.MaxSteps)
+		}
+		limits.MaxSteps = s.MaxSteps
+	}
+	if s.Timeout != "" {
+		timeout, err := time.ParseDuration(s.Timeout)
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("%w: invalid timeout %q", ErrInvalidScript, s.Timeout)
+		}
+		if timeout > MaxLimits.Timeout {
+			return nil, fmt.Errorf("%w: timeout exceeds %s", ErrInvalidScript, MaxLimits.Timeout)
+		}
+		limits.Timeout = timeout
+	}
+
+	globals, err := exec(s.Name, s.Source, limits)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidScript, err)
+	}
+
+	fn, ok := globals[entry].(starlark.Callable)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s scripts must define %s()", ErrInvalidScript, s.Kind, entry)
+	}
+
+	return &compiled{
+		status:    Status{Script: s},
+		limits:    limits,
+		fn:        fn,
+		triggered: make(map[string]bool),
+	}, nil
+}
+
+// Delete removes a script
+func (m *Manager) Delete(name string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, exists := m.scripts[name]; !exists {
+		return ErrScriptNotFound
+	}
+
+	delete(m.scripts, name)
+	return nil
+}
+
+// Get returns the status of a script
+func (m *Manager) Get(name string) (Status, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	c, exists := m.scripts[name]
+	if !exists {
+		return Status{}, ErrScriptNotFound
+	}
+	return c.status, nil
+}
+
+// List returns the status of all scripts sorted by name
+func (m *Manager) List() []Status {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	result := make([]Status, 0, len(m.scripts))
+	for _, c := range m.scripts {
+		result = append(result, c.status)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// Transform runs all transform scripts over a telemetry batch in name order.
+// The Manager can be added to an ingest.Ingester as a transform. Batches are
+// recorded as they arrive, so that script bundles can be validated against them.
+func (m *Manager) Transform(t *ingest.Telemetry) error {
+	m.record(*t)
+
+	for _, c := range m.byKind(KindTransform, "") {
+		result, err := m.call(c, telemetryDocument(*t))
+		if err != nil {
+			return fmt.Errorf("script %s: %v", c.status.Name, err)
+		}
+
+		features, err := transformed(c.status.Name, result)
+		if err != nil {
+			return err
+		}
+		t.Features = features
+	}
+	return nil
+}
+
+// telemetryDocument returns the argument of transform scripts
+func telemetryDocument(t ingest.Telemetry) map[string]interface{} {
+	features := make(map[string]interface{}, len(t.Features))
+	for id, props := range t.Features {
+		features[id] = map[string]interface{}(props)
+	}
+
+	return map[string]interface{}{
+		"twinId":    t.TwinID,
+		"messageId": t.MessageID,
+		"features":  features,
+	}
+}
+
+// transformed converts the result of a transform script to features
+func transformed(name string, result interface{}) (map[string]map[string]interface{}, error) {
+	features, ok := result.(map[string]interface{})
+	if !ok && result != nil {
+		return nil, fmt.Errorf("script %s: transform must return a dict of features", name)
+	}
+
+	converted := make(map[string]map[string]interface{}, len(features))
+	for id, props := range features {
+		p, ok := props.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("script %s: feature %s must be a dict of properties", name, id)
+		}
+		converted[id] = p
+	}
+	return converted, nil
+}
+
+// HandleEvent runs rule and computed property scripts after property changes
+func (m *Manager) HandleEvent(msg messaging_sim.Message) {
+	if msg.Topic != "property.updated" && msg.Topic != "properties.updated" {
+		return
+	}
+
+	twinID := eventbus.PayloadField(msg.Payload, "twinId")
+	featureID := eventbus.PayloadField(msg.Payload, "featureId")
+
+	dt, err := m.registry.Get(twinID)
+	if err != nil {
+		return
+	}
+
+	// Changes made by a computed script do not trigger that script again
+	changed := changedKeys(msg)
+
+	for _, c := range m.byKind(KindComputed, dt.Type) {
+		if featureID == c.status.Feature && len(changed) == 1 && changed[0] == c.status.Property {
+			continue
+		}
+		m.compute(c, dt)
+	}
+
+	for _, c := range m.byKind(KindRule, dt.Type) {
+		m.evaluate(c, dt)
+	}
+}
+
+// Reevaluate runs a rule or computed property script for a twin as if its
+// properties had changed. It reports whether a computed value changed or a
+// rule was triggered.
+func (m *Manager) Reevaluate(name string, dt *twin.DigitalTwin) (bool, error) {
+	c, err := m.lookup(name)
+	if err != nil {
+		return false, err
+	}
+
+	switch c.status.Kind {
+	case KindComputed:
+		return m.compute(c, dt)
+	case KindRule:
+		return m.evaluate(c, dt)
+	default:
+		return false, fmt.Errorf("%w: %s scripts cannot be re-evaluated", ErrInvalidScript, c.status.Kind)
+	}
+}
+
+// Value runs a rule or computed property script for a twin and returns its
+// result without storing it or publishing events
+func (m *Manager) Value(name string, dt *twin.DigitalTwin) (interface{}, error) {
+	c, err := m.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.status.Kind != KindComputed && c.status.Kind != KindRule {
+		return nil, fmt.Errorf("%w: %s scripts cannot be re-evaluated", ErrInvalidScript, c.status.Kind)
+	}
+	return m.call(c, twinDocument(dt))
+}
+
+// lookup returns a registered script by name
+func (m *Manager) lookup(name string) (*compiled, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	c, exists := m.scripts[name]
+	if !exists {
+		return nil, ErrScriptNotFound
+	}
+	return c, nil
+}
+
+// Run runs scripts for events from a subscription until the channel is closed
+func (m *Manager) Run(events <-chan messaging_sim.Message) {
+	for msg := range events {
+		m.HandleEvent(msg)
+	}
+}
+
+// compute runs a computed property script and stores its result.
+// It reports whether the stored value changed.
+func (m *Manager) compute(c *compiled, dt *twin.DigitalTwin) (bool, error) {
+	value, err := m.call(c, twinDocument(dt))
+	if err != nil {
+		return false, err
+	}
+
+	feature, exists := dt.GetFeature(c.status.Feature)
+	if !exists {
+		feature = twin.NewFeatureState()
+		if err := dt.AddFeature(c.status.Feature, feature); err == twin.ErrFeatureAlreadyExists {
+			feature, _ = dt.GetFeature(c.status.Feature)
+		}
+	}
+
+	if current, exists := feature.GetProperty(c.status.Property); exists && fmt.Sprint(current) == fmt.Sprint(value) {
+		return false, nil
+	}
+
+	feature.SetProperty(c.status.Property, value)
+	m.registry.Update(dt)
+
+	m.pubsub.Publish("property.updated", map[string]interface{}{
+		"twinId":      dt.ID,
+		"featureId":   c.status.Feature,
+		"propertyKey": c.status.Property,
+		"value":       value,
+	})
+	return true, nil
+}
+
+// evaluate runs a rule script and publishes an event when it becomes truthy.
+// It reports whether the rule was triggered.
+func (m *Manager) evaluate(c *compiled, dt *twin.DigitalTwin) (bool, error) {
+	value, err := m.call(c, twinDocument(dt))
+	if err != nil {
+		return false, err
+	}
+
+	sv, _ := toStarlark(value)
+	triggered := sv != nil && bool(sv.Truth())
+
+	m.mutex.Lock()
+	previous := c.triggered[dt.ID]
+	c.triggered[dt.ID] = triggered
+	m.mutex.Unlock()
+
+	if !triggered || previous {
+		return false, nil
+	}
+
+	payload := map[string]interface{}{
+		"rule":   c.status.Name,
+		"twinId": dt.ID,
+		"result": value,
+	}
+
+	// A withheld rule is not remembered as triggered, so that it triggers
+	// again once the suppression ends
+	if m.suppressed(dt.ID, payload) {
+		m.mutex.Lock()
+		c.triggered[dt.ID] = false
+		m.mutex.Unlock()
+		return false, nil
+	}
+
+	m.pubsub.Publish(RuleTopic, payload)
+	return true, nil
+}
+
+// RenameTwin moves the state rules keep about a twin to its new ID, so that
+// rules triggered for the twin do not trigger again after renaming it
+func (m *Manager) RenameTwin(oldID, newID string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	sets := []map[string]*compiled{m.scripts, m.previous.scripts}
+	for _, b := range m.bundles {
+		sets = append(sets, b.scripts)
+	}
+	for _, scripts := range sets {
+		for _, c := range scripts {
+			if triggered, exists := c.triggered[oldID]; exists {
+				delete(c.triggered, oldID)
+				c.triggered[newID] = triggered
+			}
+		}
+	}
+}
+
+// SetSuppressor sets what decides whether the actions of triggered rules
+// are withheld
+func (m *Manager) SetSuppressor(s Suppressor) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.suppress = s
+}
+
+// suppressed reports whether the action of a rule triggered for a twin is withheld
+func (m *Manager) suppressed(twinID string, payload map[string]interface{}) bool {
+	m.mutex.RLock()
+	s := m.suppress
+	m.mutex.RUnlock()
+
+	return s != nil && s.Suppress(RuleTopic, twinID, payload)
+}
+
+// call runs the entry point of a script with a single argument and records the outcome
+func (m *Manager) call(c *compiled, arg interface{}) (interface{}, error) {
+	result, err := run(c.status.Name, c.fn, arg, c.limits)
+
+	m.mutex.Lock()
+	c.status.Runs++
+	c.status.LastRun = time.Now()
+	if err != nil {
+		c.status.Errors++
+		c.status.LastError = err.Error()
+	}
+	m.mutex.Unlock()
+
+	return result, err
+}
+
+// byKind returns the scripts of a kind that apply to a twin type, sorted by name
+func (m *Manager) byKind(kind Kind, twinType string) []*compiled {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	var result []*compiled
+	for _, c := range m.scripts {
+		if c.status.Kind != kind {
+			continue
+		}
+		if twinType != "" && c.status.TwinType != "" && c.status.TwinType != twinType {
+			continue
+		}
+		result = append(result, c)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].status.Name < result[j].status.Name })
+	return result
+}
+
+// changedKeys returns the property keys changed by a property event
+func changedKeys(msg messaging_sim.Message) []string {
+	if msg.Topic == "property.updated" {
+		return []string{eventbus.PayloadField(msg.Payload, "propertyKey")}
+	}
+
+	u, _ := eventbus.PropertiesOf(msg.Payload)
+	keys := make([]string, 0, len(u.Properties))
+	for k := range u.Properties {
+		keys = append(keys, k)
+	}
+	return keys
+}
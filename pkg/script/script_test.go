@@ -0,0 +1,378 @@
+package script
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/history"
+	"github.com/aleka07/go-digital-twin/pkg/ingest"
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+	"go.starlark.net/starlark"
+)
+
+func setupManager() (*Manager, *registry.Registry, *messaging_sim.PubSub) {
+	reg := registry.NewRegistry()
+	dt := twin.NewDigitalTwin("machine-1", "machine")
+	counter := twin.NewFeatureState()
+	counter.SetProperty("good", 90.0)
+	counter.SetProperty("total", 100.0)
+	dt.AddFeature("counter", counter)
+	reg.Create(dt)
+
+	pubsub := messaging_sim.NewPubSub()
+	return NewManager(reg, pubsub), reg, pubsub
+}
+
+func TestCreateValidation(t *testing.T) {
+	m, _, _ := setupManager()
+
+	invalid := []Script{
+		{Kind: KindRule, Source: "def evaluate(twin): return True"},
+		{Name: "kind", Kind: "macro", Source: "def evaluate(twin): return True"},
+		{Name: "syntax", Kind: KindRule, Source: "def evaluate(twin) return True"},
+		{Name: "entry", Kind: KindRule, Source: "def compute(twin): return 1"},
+		{Name: "target", Kind: KindComputed, Source: "def compute(twin): return 1"},
+		{Name: "load", Kind: KindRule, Source: `load("os.star", "system")`},
+		{Name: "timeout", Kind: KindRule, Source: "def evaluate(twin): return True", Timeout: "soon"},
+		{Name: "large", Kind: KindRule, Source: strings.Repeat(" ", MaxSourceSize+1)},
+	}
+	for _, s := range invalid {
+		if err := m.Create(s); !errors.Is(err, ErrInvalidScript) {
+			t.Errorf("Expected ErrInvalidScript for %s, got %v", s.Name, err)
+		}
+	}
+
+	valid := Script{Name: "ok", Kind: KindRule, Source: "def evaluate(twin): return True"}
+	if err := m.Create(valid); err != nil {
+		t.Fatalf("Failed to create script: %v", err)
+	}
+	if err := m.Create(valid); err != ErrScriptAlreadyExists {
+		t.Errorf("Expected ErrScriptAlreadyExists, got %v", err)
+	}
+	if err := m.Delete("ok"); err != nil {
+		t.Errorf("Failed to delete script: %v", err)
+	}
+	if _, err := m.Get("ok"); err != ErrScriptNotFound {
+		t.Errorf("Expected ErrScriptNotFound, got %v", err)
+	}
+}
+
+func TestReplaceAndValidate(t *testing.T) {
+	m, _, _ := setupManager()
+
+	rule := Script{Name: "rule", Kind: KindRule, Source: "def evaluate(twin): return True"}
+	if err := m.Replace(rule); err != ErrScriptNotFound {
+		t.Errorf("Expected ErrScriptNotFound, got %v", err)
+	}
+	if err := m.Validate(rule); err != nil {
+		t.Errorf("Expected valid script, got %v", err)
+	}
+	if _, err := m.Get("rule"); err != ErrScriptNotFound {
+		t.Errorf("Expected Validate not to register the script, got %v", err)
+	}
+
+	m.Create(rule)
+
+	broken := Script{Name: "rule", Kind: KindRule, Source: "def evaluate(twin) return False"}
+	if err := m.Replace(broken); !errors.Is(err, ErrInvalidScript) {
+		t.Errorf("Expected ErrInvalidScript, got %v", err)
+	}
+	if status, _ := m.Get("rule"); status.Source != rule.Source {
+		t.Errorf("Expected the old script to be kept, got %q", status.Source)
+	}
+
+	rule.Source = "def evaluate(twin): return False"
+	if err := m.Replace(rule); err != nil {
+		t.Fatalf("Failed to replace script: %v", err)
+	}
+	if status, _ := m.Get("rule"); status.Source != rule.Source {
+		t.Errorf("Expected the new source, got %q", status.Source)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	m, _, _ := setupManager()
+
+	// Endless top-level loops are stopped by the step limit
+	err := m.Create(Script{Name: "spin", Kind: KindRule, Source: `
+def loop():
+    for i in range(1000000000):
+        pass
+loop()
+def evaluate(twin):
+    return True
+`})
+	if !errors.Is(err, ErrInvalidScript) {
+		t.Errorf("Expected step limit to reject script, got %v", err)
+	}
+
+	// Calls that exceed the limit fail and are counted
+	err = m.Create(Script{Name: "slow", Kind: KindRule, MaxSteps: 1000, Source: `
+def evaluate(twin):
+    n = 0
+    for i in range(100000):
+        n += i
+    return n > 0
+`})
+	if err != nil {
+		t.Fatalf("Failed to create script: %v", err)
+	}
+
+	m.HandleEvent(messaging_sim.Message{Topic: "property.updated", Payload: map[string]interface{}{
+		"twinId": "machine-1", "featureId": "counter", "propertyKey": "good", "value": 91.0,
+	}})
+
+	status, _ := m.Get("slow")
+	if status.Runs != 1 || status.Errors != 1 || !strings.Contains(status.LastError, "steps") {
+		t.Errorf("Expected step limit error, got %+v", status)
+	}
+
+	// Wall-clock timeouts
+	limits := Limits{MaxSteps: 1 << 40, Timeout: 10 * time.Millisecond}
+	globals, err := exec("busy", "def evaluate(twin):\n    for i in range(1000000000):\n        pass\n", limits)
+	if err != nil {
+		t.Fatalf("Failed to execute script: %v", err)
+	}
+
+	start := time.Now()
+	if _, err := run("busy", globals["evaluate"].(starlark.Callable), nil, limits); err == nil || time.Since(start) > time.Second {
+		t.Errorf("Expected timeout, got %v after %s", err, time.Since(start))
+	}
+
+	// Scripts cannot raise their limits beyond the server's
+	for _, s := range []Script{
+		{Name: "greedy", Kind: KindRule, Source: "def evaluate(twin): return True", MaxSteps: MaxLimits.MaxSteps + 1},
+		{Name: "patient", Kind: KindRule, Source: "def evaluate(twin): return True", Timeout: "1h"},
+	} {
+		if err := m.Create(s); !errors.Is(err, ErrInvalidScript) {
+			t.Errorf("%s: expected ErrInvalidScript, got %v", s.Name, err)
+		}
+	}
+
+	// Large allocations fail, either in the interpreter or as results
+	globals, err = exec("large", `
+def huge(twin):
+    return "x" * (1 << 30)
+def large(twin):
+    return ["x" * (1 << 16) for i in range(32)]
+`, DefaultLimits)
+	if err != nil {
+		t.Fatalf("Failed to execute script: %v", err)
+	}
+	for _, name := range []string{"huge", "large"} {
+		if _, err := run("large", globals[name].(starlark.Callable), nil, DefaultLimits); err == nil {
+			t.Errorf("%s: expected the allocation to fail", name)
+		}
+	}
+}
+
+func TestComputedAndRules(t *testing.T) {
+	m, reg, pubsub := setupManager()
+	events := pubsub.Subscribe(RuleTopic)
+
+	err := m.Create(Script{Name: "quality", Kind: KindComputed, Feature: "oee", Property: "quality", Source: `
+def compute(twin):
+    c = twin["features"]["counter"]["properties"]
+    return c["good"] / c["total"]
+`})
+	if err != nil {
+		t.Fatalf("Failed to create computed script: %v", err)
+	}
+
+	err = m.Create(Script{Name: "low-quality", Kind: KindRule, TwinType: "machine", Source: `
+def evaluate(twin):
+    oee = twin["features"].get("oee")
+    return oee != None and oee["properties"]["quality"] < 0.8
+`})
+	if err != nil {
+		t.Fatalf("Failed to create rule script: %v", err)
+	}
+
+	change := func(good float64) {
+		dt, _ := reg.Get("machine-1")
+		feature, _ := dt.GetFeature("counter")
+		feature.SetProperty("good", good)
+		m.HandleEvent(messaging_sim.Message{Topic: "properties.updated", Payload: map[string]interface{}{
+			"twinId": "machine-1", "featureId": "counter", "properties": map[string]interface{}{"good": good},
+		}})
+	}
+
+	change(90.0)
+
+	dt, _ := reg.Get("machine-1")
+	oee, exists := dt.GetFeature("oee")
+	if !exists {
+		t.Fatal("Expected computed script to create the oee feature")
+	}
+	if val, _ := oee.GetProperty("quality"); val != 0.9 {
+		t.Errorf("Expected quality 0.9, got %v", val)
+	}
+
+	select {
+	case msg := <-events:
+		t.Errorf("Unexpected rule event: %v", msg.Payload)
+	default:
+	}
+
+	// The rule triggers once when quality drops
+	change(70.0)
+	change(60.0)
+
+	select {
+	case msg := <-events:
+		payload := msg.Payload.(map[string]interface{})
+		if payload["rule"] != "low-quality" || payload["twinId"] != "machine-1" {
+			t.Errorf("Unexpected rule event: %v", payload)
+		}
+	default:
+		t.Error("Expected rule.triggered event")
+	}
+
+	select {
+	case msg := <-events:
+		t.Errorf("Expected rule to trigger only once, got %v", msg.Payload)
+	default:
+	}
+
+	// Nor again after renaming the twin
+	reg.Rename("machine-1", "machine-2")
+	m.RenameTwin("machine-1", "machine-2")
+	m.HandleEvent(messaging_sim.Message{Topic: "properties.updated", Payload: map[string]interface{}{
+		"twinId": "machine-2", "featureId": "counter", "properties": map[string]interface{}{"good": 60.0},
+	}})
+	select {
+	case msg := <-events:
+		t.Errorf("Expected rule not to trigger after renaming, got %v", msg.Payload)
+	default:
+	}
+}
+
+func TestReevaluate(t *testing.T) {
+	m, reg, pubsub := setupManager()
+	events := pubsub.Subscribe(RuleTopic)
+
+	m.Create(Script{Name: "quality", Kind: KindComputed, Feature: "oee", Property: "quality", Source: `
+def compute(twin):
+    c = twin["features"]["counter"]["properties"]
+    return c["good"] / c["total"]
+`})
+	m.Create(Script{Name: "high-quality", Kind: KindRule, Source: `
+def evaluate(twin):
+    return twin["features"]["counter"]["properties"]["good"] > 80
+`})
+	m.Create(Script{Name: "clean", Kind: KindTransform, Source: "def transform(t): return t[\"features\"]"})
+
+	dt, _ := reg.Get("machine-1")
+	changed, err := m.Reevaluate("quality", dt)
+	if err != nil || !changed {
+		t.Fatalf("Expected computed value to change, got %v, %v", changed, err)
+	}
+	if changed, _ := m.Reevaluate("quality", dt); changed {
+		t.Error("Expected unchanged computed value on second run")
+	}
+
+	triggered, err := m.Reevaluate("high-quality", dt)
+	if err != nil || !triggered {
+		t.Fatalf("Expected rule to trigger, got %v, %v", triggered, err)
+	}
+	select {
+	case <-events:
+	default:
+		t.Error("Expected rule.triggered event")
+	}
+
+	value, err := m.Value("quality", dt)
+	if err != nil || value != 0.9 {
+		t.Errorf("Expected value 0.9, got %v, %v", value, err)
+	}
+
+	if _, err := m.Reevaluate("clean", dt); !errors.Is(err, ErrInvalidScript) {
+		t.Errorf("Expected ErrInvalidScript for transform, got %v", err)
+	}
+	if _, err := m.Value("missing", dt); err != ErrScriptNotFound {
+		t.Errorf("Expected ErrScriptNotFound, got %v", err)
+	}
+}
+
+func TestTransform(t *testing.T) {
+	m, reg, pubsub := setupManager()
+
+	err := m.Create(Script{Name: "fahrenheit", Kind: KindTransform, Source: `
+def transform(telemetry):
+    features = telemetry["features"]
+    temp = features.get("temperature", {})
+    if "fahrenheit" in temp:
+        temp["celsius"] = (temp.pop("fahrenheit") - 32) * 5 / 9
+    return features
+`})
+	if err != nil {
+		t.Fatalf("Failed to create transform script: %v", err)
+	}
+
+	in := ingest.NewIngester(reg, pubsub, history.NewStore(0))
+	in.AddTransform("scripts", m)
+
+	_, err = in.Apply(ingest.Telemetry{
+		TwinID:   "machine-1",
+		Features: map[string]map[string]interface{}{"temperature": {"fahrenheit": 212.0}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to apply telemetry: %v", err)
+	}
+
+	dt, _ := reg.Get("machine-1")
+	feature, _ := dt.GetFeature("temperature")
+	if val, _ := feature.GetProperty("celsius"); val != 100.0 {
+		t.Errorf("Expected celsius 100, got %v", val)
+	}
+}
+
+// suppressAll withholds every rule action while enabled
+type suppressAll struct {
+	enabled bool
+}
+
+func (s *suppressAll) Suppress(topic, twinID string, payload interface{}) bool {
+	return s.enabled
+}
+
+func TestRuleSuppression(t *testing.T) {
+	m, reg, pubsub := setupManager()
+	events := pubsub.Subscribe(RuleTopic)
+	suppressor := &suppressAll{enabled: true}
+	m.SetSuppressor(suppressor)
+
+	m.Create(Script{Name: "low-good", Kind: KindRule, Source: `
+def evaluate(twin):
+    return twin["features"]["counter"]["properties"]["good"] < 80
+`})
+
+	change := func(good float64) {
+		dt, _ := reg.Get("machine-1")
+		feature, _ := dt.GetFeature("counter")
+		feature.SetProperty("good", good)
+		m.HandleEvent(messaging_sim.Message{Topic: "properties.updated", Payload: map[string]interface{}{
+			"twinId": "machine-1", "featureId": "counter", "properties": map[string]interface{}{"good": good},
+		}})
+	}
+
+	change(70.0)
+	select {
+	case msg := <-events:
+		t.Errorf("Expected the rule action to be withheld, got %v", msg.Payload)
+	default:
+	}
+
+	// The rule triggers once the suppression ends, although it stayed truthy
+	suppressor.enabled = false
+	change(60.0)
+	select {
+	case <-events:
+	default:
+		t.Error("Expected rule.triggered event after the suppression ended")
+	}
+}
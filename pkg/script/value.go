@@ -0,0 +1,143 @@
+package script
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+	"go.starlark.net/starlark"
+)
+
+// toStarlark converts a JSON-like Go value to a Starlark value
+func toStarlark(v interface{}) (starlark.Value, error) {
+	switch v := v.(type) {
+	case nil:
+		return starlark.None, nil
+	case bool:
+		return starlark.Bool(v), nil
+	case string:
+		return starlark.String(v), nil
+	case int:
+		return starlark.MakeInt(v), nil
+	case int64:
+		return starlark.MakeInt64(v), nil
+	case float64:
+		return starlark.Float(v), nil
+	case []interface{}:
+		elems := make([]starlark.Value, len(v))
+		for i, e := range v {
+			sv, err := toStarlark(e)
+			if err != nil {
+				return nil, err
+			}
+			elems[i] = sv
+		}
+		return starlark.NewList(elems), nil
+	case map[string]interface{}:
+		// Insert keys in sorted order so that scripts iterate deterministically
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		dict := starlark.NewDict(len(v))
+		for _, k := range keys {
+			sv, err := toStarlark(v[k])
+			if err != nil {
+				return nil, err
+			}
+			dict.SetKey(starlark.String(k), sv)
+		}
+		return dict, nil
+	}
+
+	// Normalize other types, e.g. structs or sized integers, through JSON
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported value of type %T", v)
+	}
+	var normalized interface{}
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return nil, err
+	}
+	return toStarlark(normalized)
+}
+
+// fromStarlark converts a Starlark value to a JSON-like Go value
+func fromStarlark(v starlark.Value) (interface{}, error) {
+	switch v := v.(type) {
+	case starlark.NoneType:
+		return nil, nil
+	case starlark.Bool:
+		return bool(v), nil
+	case starlark.String:
+		return string(v), nil
+	case starlark.Int:
+		if i, ok := v.Int64(); ok {
+			return float64(i), nil
+		}
+		return nil, fmt.Errorf("integer %s out of range", v)
+	case starlark.Float:
+		return float64(v), nil
+	case *starlark.List:
+		return fromIterable(v, v.Len())
+	case starlark.Tuple:
+		return fromIterable(v, v.Len())
+	case *starlark.Dict:
+		result := make(map[string]interface{}, v.Len())
+		for _, item := range v.Items() {
+			key, ok := item[0].(starlark.String)
+			if !ok {
+				return nil, fmt.Errorf("dict key %s is not a string", item[0])
+			}
+			value, err := fromStarlark(item[1])
+			if err != nil {
+				return nil, err
+			}
+			result[string(key)] = value
+		}
+		return result, nil
+	}
+
+	return nil, fmt.Errorf("unsupported value of type %s", v.Type())
+}
+
+// fromIterable converts a Starlark list or tuple to a slice
+func fromIterable(v starlark.Iterable, n int) ([]interface{}, error) {
+	result := make([]interface{}, 0, n)
+
+	iter := v.Iterate()
+	defer iter.Done()
+
+	var elem starlark.Value
+	for iter.Next(&elem) {
+		value, err := fromStarlark(elem)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, value)
+	}
+	return result, nil
+}
+
+// twinDocument returns the representation of a twin passed to scripts
+func twinDocument(dt *twin.DigitalTwin) map[string]interface{} {
+	features := make(map[string]interface{})
+	for id, feature := range dt.GetAllFeatures() {
+		features[id] = map[string]interface{}{
+			"properties":        feature.GetAllProperties(),
+			"desiredProperties": feature.GetAllDesiredProperties(),
+		}
+	}
+
+	return map[string]interface{}{
+		"id":         dt.ID,
+		"type":       dt.Type,
+		"definition": dt.GetDefinition(),
+		"lifecycle":  string(dt.GetLifecycle()),
+		"attributes": dt.GetAllAttributes(),
+		"features":   features,
+	}
+}
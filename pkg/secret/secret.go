@@ -0,0 +1,200 @@
+// Package secret resolves references to credentials kept outside of
+// configuration, so that passwords and tokens of bridges, exporters and
+// notification channels need not be written to configuration files or
+// returned by the API. A reference such as ${env:MQTT_PASSWORD} names a
+// scheme and a secret within it; each scheme has a pluggable Resolver.
+package secret
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Common errors
+var (
+	ErrInvalidReference = errors.New("invalid secret reference")
+	ErrUnknownScheme    = errors.New("unknown secret scheme")
+	ErrSecretNotFound   = errors.New("secret not found")
+)
+
+// Built-in schemes
+const (
+	SchemeEnv   = "env"   // ${env:NAME}, an environment variable
+	SchemeFile  = "file"  // ${file:/run/secrets/name}, the content of a file
+	SchemeVault = "vault" // ${vault:secret/data/path#field}, a field of a Vault secret
+)
+
+// Redacted replaces secrets returned by the API
+const Redacted = "********"
+
+// reference matches ${scheme:name} references within a value
+var reference = regexp.MustCompile(`\$\{([a-z][a-z0-9]*):([^}]*)\}`)
+
+// Resolver looks up a secret by its name within a scheme
+type Resolver interface {
+	Resolve(ctx context.Context, name string) (string, error)
+}
+
+// ResolverFunc is a function used as a Resolver
+type ResolverFunc func(ctx context.Context, name string) (string, error)
+
+// Resolve calls f
+func (f ResolverFunc) Resolve(ctx context.Context, name string) (string, error) {
+	return f(ctx, name)
+}
+
+// IsReference reports whether a value contains secret references
+func IsReference(value string) bool {
+	return reference.MatchString(value)
+}
+
+// Redact hides a secret, keeping whether it is set. Values made of
+// references are kept, as they name a secret rather than being one.
+func Redact(value string) string {
+	if value == "" || reference.ReplaceAllString(value, "") == "" {
+		return value
+	}
+	return Redacted
+}
+
+// sensitiveHeaderWords mark request headers carrying credentials
+var sensitiveHeaderWords = []string{"auth", "cookie", "key", "password", "secret", "signature", "token"}
+
+// RedactHeaders returns a copy of request headers with the values of those
+// carrying credentials, such as Authorization or X-Api-Key, redacted
+func RedactHeaders(headers map[string]string) map[string]string {
+	if headers == nil {
+		return nil
+	}
+	redacted := make(map[string]string, len(headers))
+	for k, v := range headers {
+		redacted[k] = v
+		name := strings.ToLower(k)
+		for _, word := range sensitiveHeaderWords {
+			if strings.Contains(name, word) {
+				redacted[k] = Redact(v)
+				break
+			}
+		}
+	}
+	return redacted
+}
+
+// Manager resolves references with the resolvers of their schemes
+type Manager struct {
+	resolvers map[string]Resolver
+	mutex     sync.RWMutex
+}
+
+// NewManager creates a manager resolving the env and file schemes
+func NewManager() *Manager {
+	m := &Manager{resolvers: make(map[string]Resolver)}
+	m.Register(SchemeEnv, ResolverFunc(resolveEnv))
+	m.Register(SchemeFile, ResolverFunc(resolveFile))
+	return m
+}
+
+// Register sets the resolver of a scheme, replacing any previous one
+func (m *Manager) Register(scheme string, r Resolver) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.resolvers[scheme] = r
+}
+
+// Schemes returns the registered schemes, sorted
+func (m *Manager) Schemes() []string {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	schemes := make([]string, 0, len(m.resolvers))
+	for scheme := range m.resolvers {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// Resolve replaces the references in a value with their secrets. Values
+// without references are returned unchanged.
+func (m *Manager) Resolve(ctx context.Context, value string) (string, error) {
+	var err error
+	resolved := reference.ReplaceAllStringFunc(value, func(ref string) string {
+		if err != nil {
+			return ""
+		}
+		match := reference.FindStringSubmatch(ref)
+		var secret string
+		secret, err = m.lookup(ctx, match[1], match[2])
+		return secret
+	})
+	if err != nil {
+		return "", err
+	}
+	return resolved, nil
+}
+
+// ResolveMap returns a copy of a map, such as request headers, with the
+// references in its values resolved
+func (m *Manager) ResolveMap(ctx context.Context, values map[string]string) (map[string]string, error) {
+	if values == nil {
+		return nil, nil
+	}
+	resolved := make(map[string]string, len(values))
+	for k, v := range values {
+		secret, err := m.Resolve(ctx, v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", k, err)
+		}
+		resolved[k] = secret
+	}
+	return resolved, nil
+}
+
+// lookup resolves a single reference
+func (m *Manager) lookup(ctx context.Context, scheme, name string) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("%w: ${%s:} names no secret", ErrInvalidReference, scheme)
+	}
+
+	m.mutex.RLock()
+	r, ok := m.resolvers[scheme]
+	m.mutex.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnknownScheme, scheme)
+	}
+
+	secret, err := r.Resolve(ctx, name)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve ${%s:%s}: %w", scheme, name, err)
+	}
+	return secret, nil
+}
+
+// resolveEnv reads an environment variable
+func resolveEnv(ctx context.Context, name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", ErrSecretNotFound
+	}
+	return value, nil
+}
+
+// resolveFile reads a file such as a Docker or Kubernetes secret, without
+// its trailing line break
+func resolveFile(ctx context.Context, name string) (string, error) {
+	data, err := os.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", ErrSecretNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
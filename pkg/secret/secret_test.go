@@ -0,0 +1,138 @@
+package secret
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	m := NewManager()
+	ctx := context.Background()
+	t.Setenv("DT_TEST_PASSWORD", "hunter2")
+	path := filepath.Join(t.TempDir(), "token")
+	os.WriteFile(path, []byte("s3cret\n"), 0600)
+
+	for value, expected := range map[string]string{
+		"plain":                              "plain",
+		"${env:DT_TEST_PASSWORD}":            "hunter2",
+		"${file:" + path + "}":               "s3cret",
+		"Bearer ${file:" + path + "}":        "Bearer s3cret",
+		"amqp://dt:${env:DT_TEST_PASSWORD}@": "amqp://dt:hunter2@",
+		"$DT_TEST_PASSWORD":                  "$DT_TEST_PASSWORD",
+	} {
+		resolved, err := m.Resolve(ctx, value)
+		if err != nil || resolved != expected {
+			t.Errorf("%s: expected %q, got %q %v", value, expected, resolved, err)
+		}
+	}
+
+	for value, expected := range map[string]error{
+		"${env:DT_TEST_MISSING}":     ErrSecretNotFound,
+		"${file:/no/such/file}":      ErrSecretNotFound,
+		"${keyring:mqtt}":            ErrUnknownScheme,
+		"${env:}":                    ErrInvalidReference,
+		"x ${env:DT_TEST_MISSING} y": ErrSecretNotFound,
+	} {
+		if _, err := m.Resolve(ctx, value); !errors.Is(err, expected) {
+			t.Errorf("%s: expected %v, got %v", value, expected, err)
+		}
+	}
+
+	// Resolvers are pluggable
+	m.Register("keyring", ResolverFunc(func(ctx context.Context, name string) (string, error) {
+		return "from-keyring-" + name, nil
+	}))
+	headers, err := m.ResolveMap(ctx, map[string]string{"Authorization": "Bearer ${keyring:mqtt}"})
+	if err != nil || headers["Authorization"] != "Bearer from-keyring-mqtt" {
+		t.Errorf("Unexpected headers %v %v", headers, err)
+	}
+	if schemes := m.Schemes(); len(schemes) != 3 || schemes[1] != "file" {
+		t.Errorf("Unexpected schemes %v", schemes)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	for value, expected := range map[string]string{
+		"":                        "",
+		"hunter2":                 Redacted,
+		"${env:MQTT_PASSWORD}":    "${env:MQTT_PASSWORD}",
+		"Bearer ${vault:kv#tok}":  Redacted,
+		"${env:A}${file:/run/b}":  "${env:A}${file:/run/b}",
+		"${env:MQTT_PASSWORD} !!": Redacted,
+	} {
+		if redacted := Redact(value); redacted != expected {
+			t.Errorf("%s: expected %q, got %q", value, expected, redacted)
+		}
+	}
+	headers := RedactHeaders(map[string]string{"Authorization": "Bearer abc", "X-Api-Key": "${env:API_KEY}", "X-Source": "dt"})
+	if headers["Authorization"] != Redacted || headers["X-Api-Key"] != "${env:API_KEY}" || headers["X-Source"] != "dt" {
+		t.Errorf("Unexpected redacted headers %v", headers)
+	}
+	if !IsReference("Bearer ${vault:kv#tok}") || IsReference("hunter2") {
+		t.Error("Unexpected reference detection")
+	}
+}
+
+func TestVault(t *testing.T) {
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root" || r.Header.Get("X-Vault-Namespace") != "plant" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/mqtt":
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{
+				"data":     map[string]interface{}{"password": "hunter2", "port": 8883},
+				"metadata": map[string]interface{}{"version": 3},
+			}})
+		case "/v1/kv/db":
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"value": "s3cret"}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer vault.Close()
+
+	if _, err := NewVault(VaultOptions{Address: "vault:8200", Token: "root"}); !errors.Is(err, ErrInvalidVault) {
+		t.Errorf("Expected ErrInvalidVault, got %v", err)
+	}
+	if _, err := NewVault(VaultOptions{Address: vault.URL}); !errors.Is(err, ErrInvalidVault) {
+		t.Errorf("Expected ErrInvalidVault without a token, got %v", err)
+	}
+
+	v, err := NewVault(VaultOptions{Address: vault.URL, Token: "root", Namespace: "plant"})
+	if err != nil {
+		t.Fatalf("Failed to create Vault resolver: %v", err)
+	}
+	m := NewManager()
+	m.Register(SchemeVault, v)
+	ctx := context.Background()
+
+	for value, expected := range map[string]string{
+		"${vault:secret/data/mqtt#password}": "hunter2",
+		"${vault:secret/data/mqtt#port}":     "8883",
+		"${vault:/kv/db}":                    "s3cret",
+	} {
+		resolved, err := m.Resolve(ctx, value)
+		if err != nil || resolved != expected {
+			t.Errorf("%s: expected %q, got %q %v", value, expected, resolved, err)
+		}
+	}
+	for _, value := range []string{"${vault:secret/data/mqtt#user}", "${vault:secret/data/missing}"} {
+		if _, err := m.Resolve(ctx, value); !errors.Is(err, ErrSecretNotFound) {
+			t.Errorf("%s: expected ErrSecretNotFound, got %v", value, err)
+		}
+	}
+
+	v, _ = NewVault(VaultOptions{Address: vault.URL, Token: "wrong"})
+	if _, err := v.Resolve(ctx, "kv/db"); err == nil {
+		t.Error("Expected a denied request to fail")
+	}
+}
@@ -0,0 +1,107 @@
+package secret
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrInvalidVault is returned for Vault options that cannot be used
+var ErrInvalidVault = errors.New("invalid vault options")
+
+// vaultTimeout bounds a single Vault request
+const vaultTimeout = 10 * time.Second
+
+// VaultOptions configures access to a HashiCorp Vault server
+type VaultOptions struct {
+	Address    string // Such as https://vault.example.com:8200
+	Token      string
+	Namespace  string       // Vault Enterprise namespace, optional
+	HTTPClient *http.Client // Defaults to a client with a 10 second timeout
+}
+
+// Vault resolves references to fields of secrets of the KV secrets engine,
+// version 1 or 2, named like secret/data/mqtt#password. The field defaults
+// to "value".
+type Vault struct {
+	opts    VaultOptions
+	address *url.URL
+}
+
+// NewVault creates a Vault resolver
+func NewVault(opts VaultOptions) (*Vault, error) {
+	u, err := url.Parse(opts.Address)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%w: address must be an absolute http or https URL", ErrInvalidVault)
+	}
+	if opts.Token == "" {
+		return nil, fmt.Errorf("%w: token is required", ErrInvalidVault)
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = &http.Client{Timeout: vaultTimeout}
+	}
+	return &Vault{opts: opts, address: u}, nil
+}
+
+// Resolve reads a field of a secret
+func (v *Vault) Resolve(ctx context.Context, name string) (string, error) {
+	path, field, _ := strings.Cut(name, "#")
+	if field == "" {
+		field = "value"
+	}
+
+	u := v.address.JoinPath("v1", strings.Trim(path, "/"))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", v.opts.Token)
+	if v.opts.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.opts.Namespace)
+	}
+
+	resp, err := v.opts.HTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return "", ErrSecretNotFound
+	case resp.StatusCode != http.StatusOK:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("vault returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("invalid vault response: %v", err)
+	}
+
+	// Version 2 nests the fields in data.data, next to data.metadata
+	data := body.Data
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data["metadata"]; ok {
+			data = nested
+		}
+	}
+
+	switch value := data[field].(type) {
+	case string:
+		return value, nil
+	case nil:
+		return "", ErrSecretNotFound
+	default:
+		encoded, err := json.Marshal(value)
+		return string(encoded), err
+	}
+}
@@ -0,0 +1,228 @@
+package selfcheck
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/fixtures"
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/objstore"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/script"
+	"github.com/aleka07/go-digital-twin/pkg/twinsdir"
+)
+
+// DefaultTimeout bounds each check that talks to the network
+const DefaultTimeout = 10 * time.Second
+
+// Status is the outcome of a check
+type Status string
+
+// Check outcomes
+const (
+	StatusOK      Status = "ok"
+	StatusFailed  Status = "failed"
+	StatusSkipped Status = "skipped" // The component is not configured
+)
+
+// Check verifies one aspect of the server's setup before it starts. Run
+// returns a short description of what was found, or an error if the server
+// would fail or misbehave. Checks without Run are reported as skipped with
+// their Skip reason.
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) (string, error)
+	Skip string
+}
+
+// Result is the outcome of one check
+type Result struct {
+	Name     string        `json:"name"`
+	Status   Status        `json:"status"`
+	Detail   string        `json:"detail,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Report is the outcome of all checks, in the order they were given
+type Report struct {
+	Results []Result `json:"results"`
+}
+
+// Failed reports whether any check failed
+func (r Report) Failed() bool {
+	for _, result := range r.Results {
+		if result.Status == StatusFailed {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteText writes the report as an aligned table followed by a summary line
+func (r Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	failed := 0
+	for _, result := range r.Results {
+		if result.Status == StatusFailed {
+			failed++
+		}
+		duration := ""
+		if result.Status != StatusSkipped {
+			duration = result.Duration.Round(time.Millisecond).String()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", strings.ToUpper(string(result.Status)), result.Name, duration, result.Detail)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "%d checks, %d failed\n", len(r.Results), failed)
+	return err
+}
+
+// Run runs the checks one after another, each bounded by timeout
+func Run(ctx context.Context, checks []Check, timeout time.Duration) Report {
+	report := Report{Results: make([]Result, 0, len(checks))}
+	for _, check := range checks {
+		if check.Run == nil {
+			report.Results = append(report.Results, Result{Name: check.Name, Status: StatusSkipped, Detail: check.Skip})
+			continue
+		}
+
+		checkCtx, cancel := context.WithTimeout(ctx, timeout)
+		start := time.Now()
+		detail, err := check.Run(checkCtx)
+		cancel()
+
+		result := Result{Name: check.Name, Status: StatusOK, Detail: detail, Duration: time.Since(start)}
+		if err != nil {
+			result.Status, result.Detail = StatusFailed, err.Error()
+		}
+		report.Results = append(report.Results, result)
+	}
+	return report
+}
+
+// Skipped returns a check reported as skipped
+func Skipped(name, reason string) Check {
+	return Check{Name: name, Skip: reason}
+}
+
+// Failed returns a check that fails with err, for setup that could not even
+// be prepared for checking
+func Failed(name string, err error) Check {
+	return Check{Name: name, Run: func(ctx context.Context) (string, error) {
+		return "", err
+	}}
+}
+
+// Port checks that a TCP or UDP address is free to listen on
+func Port(name, network, addr string) Check {
+	return Check{Name: name, Run: func(ctx context.Context) (string, error) {
+		var lc net.ListenConfig
+		switch network {
+		case "udp", "udp4", "udp6":
+			conn, err := lc.ListenPacket(ctx, network, addr)
+			if err != nil {
+				return "", err
+			}
+			conn.Close()
+		default:
+			listener, err := lc.Listen(ctx, network, addr)
+			if err != nil {
+				return "", err
+			}
+			listener.Close()
+		}
+		return network + " " + addr + " is available", nil
+	}}
+}
+
+// Store checks that an object store can be listed under prefix, which needs
+// both connectivity and read permissions
+func Store(name string, store objstore.Store, prefix string) Check {
+	return Check{Name: name, Run: func(ctx context.Context) (string, error) {
+		keys, err := store.List(ctx, prefix)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%d objects under %q", len(keys), prefix), nil
+	}}
+}
+
+// Reachable checks that a TCP connection can be opened to the host of an
+// http or https URL. Nothing is sent, so endpoints with side effects are safe
+// to check.
+func Reachable(name, rawURL string) Check {
+	return Check{Name: name, Run: func(ctx context.Context) (string, error) {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return "", err
+		}
+		port := u.Port()
+		if port == "" {
+			port = "80"
+			if u.Scheme == "https" {
+				port = "443"
+			}
+		}
+		addr := net.JoinHostPort(u.Hostname(), port)
+
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return "", err
+		}
+		conn.Close()
+		return addr + " is reachable", nil
+	}}
+}
+
+// Definitions checks that the twin definitions in a directory load cleanly,
+// by loading them into a scratch registry: every file must parse, twin IDs
+// must be unique and every twin must be valid
+func Definitions(name, dir string) Check {
+	return Check{Name: name, Run: func(ctx context.Context) (string, error) {
+		pubsub := messaging_sim.NewPubSub()
+		defer pubsub.Close()
+
+		report, err := twinsdir.NewLoader(dir, registry.NewRegistry(), pubsub).Load()
+		if err != nil {
+			return "", err
+		}
+		if len(report.Failed) > 0 {
+			messages := make([]string, len(report.Failed))
+			for i, f := range report.Failed {
+				messages[i] = strings.TrimSpace(f.File+" "+f.ID) + ": " + f.Error
+			}
+			return "", fmt.Errorf("%d invalid definitions: %s", len(report.Failed), strings.Join(messages, "; "))
+		}
+		return fmt.Sprintf("%d twin definitions", len(report.Created)), nil
+	}}
+}
+
+// Fixtures checks that seed fixtures parse and that their twins and rules
+// can be created, without touching the real registry
+func Fixtures(name, path string) Check {
+	return Check{Name: name, Run: func(ctx context.Context) (string, error) {
+		f, err := fixtures.Load(path)
+		if err != nil {
+			return "", err
+		}
+
+		pubsub := messaging_sim.NewPubSub()
+		defer pubsub.Close()
+		reg := registry.NewRegistry()
+		report, err := fixtures.Seed(f, reg, nil, script.NewManager(reg, pubsub))
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%d twins, %d rules", len(report.Created), len(report.Rules)), nil
+	}}
+}
@@ -0,0 +1,135 @@
+package selfcheck
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/objstore"
+)
+
+func TestRunReport(t *testing.T) {
+	report := Run(context.Background(), []Check{
+		{Name: "good", Run: func(ctx context.Context) (string, error) { return "fine", nil }},
+		Failed("bad", errors.New("broken")),
+		Skipped("absent", "not configured"),
+	}, time.Second)
+
+	if len(report.Results) != 3 || !report.Failed() {
+		t.Fatalf("Expected 3 results with a failure, got %+v", report)
+	}
+	for i, want := range []Status{StatusOK, StatusFailed, StatusSkipped} {
+		if report.Results[i].Status != want {
+			t.Errorf("Expected status %s for %s, got %s", want, report.Results[i].Name, report.Results[i].Status)
+		}
+	}
+	if report.Results[1].Detail != "broken" {
+		t.Errorf("Expected the error as detail, got %q", report.Results[1].Detail)
+	}
+
+	var buf bytes.Buffer
+	if err := report.WriteText(&buf); err != nil {
+		t.Fatalf("Failed to write report: %v", err)
+	}
+	if !strings.Contains(buf.String(), "FAILED   bad") || !strings.HasSuffix(buf.String(), "3 checks, 1 failed\n") {
+		t.Errorf("Unexpected report:\n%s", buf.String())
+	}
+
+	if report := Run(context.Background(), []Check{Skipped("absent", "")}, time.Second); report.Failed() {
+		t.Errorf("Expected skipped checks not to fail the report")
+	}
+}
+
+func TestPort(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	report := Run(context.Background(), []Check{
+		Port("busy", "tcp", listener.Addr().String()),
+		Port("free", "tcp", "127.0.0.1:0"),
+		Port("udp", "udp", "127.0.0.1:0"),
+	}, time.Second)
+
+	for i, want := range []Status{StatusFailed, StatusOK, StatusOK} {
+		if report.Results[i].Status != want {
+			t.Errorf("Expected status %s for %s, got %s: %s", want, report.Results[i].Name, report.Results[i].Status, report.Results[i].Detail)
+		}
+	}
+}
+
+func TestStoreAndReachable(t *testing.T) {
+	store := objstore.NewMemoryStore()
+	store.Put(context.Background(), "backups/snapshot.json", []byte("{}"))
+
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Expected no request to be sent, got %s %s", r.Method, r.URL)
+	}))
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	defer endpoint.Close()
+
+	report := Run(context.Background(), []Check{
+		Store("store", store, "backups/"),
+		Reachable("endpoint", endpoint.URL+"/changes"),
+		Reachable("closed", closed.URL),
+	}, time.Second)
+
+	if r := report.Results[0]; r.Status != StatusOK || r.Detail != `1 objects under "backups/"` {
+		t.Errorf("Unexpected store result %+v", r)
+	}
+	if r := report.Results[1]; r.Status != StatusOK {
+		t.Errorf("Expected endpoint to be reachable, got %+v", r)
+	}
+	if r := report.Results[2]; r.Status != StatusFailed {
+		t.Errorf("Expected closed endpoint to fail, got %+v", r)
+	}
+}
+
+func TestDefinitions(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	write("pumps.yaml", "- id: pump-1\n  type: pump\n- id: pump-2\n  type: pump\n")
+	report := Run(context.Background(), []Check{Definitions("definitions", dir)}, time.Second)
+	if r := report.Results[0]; r.Status != StatusOK || r.Detail != "2 twin definitions" {
+		t.Errorf("Unexpected result %+v", r)
+	}
+
+	write("more.yaml", "- id: pump-1\n  type: pump\n")
+	write("broken.json", "{")
+	report = Run(context.Background(), []Check{Definitions("definitions", dir)}, time.Second)
+	r := report.Results[0]
+	if r.Status != StatusFailed || !strings.Contains(r.Detail, "broken.json") || !strings.Contains(r.Detail, "pump-1") {
+		t.Errorf("Expected the broken file and duplicate ID to be reported, got %+v", r)
+	}
+}
+
+func TestFixtures(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seed.yaml")
+	os.WriteFile(path, []byte("twins:\n  - id: pump-1\n    type: pump\nrules:\n  - name: on\n    source: \"def evaluate(twin): return True\"\n"), 0644)
+	report := Run(context.Background(), []Check{Fixtures("seed", path)}, time.Second)
+	if r := report.Results[0]; r.Status != StatusOK || r.Detail != "1 twins, 1 rules" {
+		t.Errorf("Unexpected result %+v", r)
+	}
+
+	os.WriteFile(path, []byte("rules:\n  - name: broken\n    source: \"def evaluate(twin) return True\"\n"), 0644)
+	report = Run(context.Background(), []Check{Fixtures("seed", path)}, time.Second)
+	if r := report.Results[0]; r.Status != StatusFailed || !strings.Contains(r.Detail, "broken") {
+		t.Errorf("Expected the broken rule to be reported, got %+v", r)
+	}
+}
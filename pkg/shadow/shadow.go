@@ -0,0 +1,385 @@
+package shadow
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/eventbus"
+	"github.com/aleka07/go-digital-twin/pkg/ingest"
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// Common errors
+var (
+	ErrShadowNotFound = errors.New("shadow twin not found")
+	ErrInvalidShadow  = errors.New("invalid shadow twin")
+)
+
+// SourceAttribute is the attribute naming the source of a shadow twin
+const SourceAttribute = "shadowOf"
+
+// TypeSuffix is appended to the type of the source twin when a shadow does
+// not set its own type, so that rules, computed properties and models scoped
+// to the source type do not apply to the shadow
+const TypeSuffix = "-shadow"
+
+// Shadow is a copy of a twin that receives the same telemetry as its source
+// but is processed under its own type, so a different rule and model
+// configuration can be tried out on live data
+type Shadow struct {
+	ID        string    `json:"id"`
+	SourceID  string    `json:"sourceId"`
+	Type      string    `json:"type,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	Mirrored  int       `json:"mirrored"`            // Telemetry batches applied to the shadow
+	Failed    int       `json:"failed"`              // Telemetry batches the shadow rejected
+	LastError string    `json:"lastError,omitempty"` // Error of the last rejected batch
+}
+
+// Difference is a property whose value differs between a source and its shadow
+type Difference struct {
+	FeatureID string      `json:"featureId"`
+	Property  string      `json:"property"`
+	Source    interface{} `json:"source"`
+	Shadow    interface{} `json:"shadow"`
+	Delta     *float64    `json:"delta,omitempty"` // Shadow minus source for numeric values
+}
+
+// EventCount counts the events of a topic published about a source and its shadow
+type EventCount struct {
+	Source int `json:"source"`
+	Shadow int `json:"shadow"`
+}
+
+// Report compares the current properties of a shadow twin with those of its
+// source, and the events published about each since the shadow was created
+type Report struct {
+	Shadow
+	Properties  int                   `json:"properties"` // Properties present on either twin
+	Differences []Difference          `json:"differences"`
+	Events      map[string]EventCount `json:"events"` // Topic -> event counts
+}
+
+// shadow is a registered shadow with its event counters
+type shadow struct {
+	Shadow
+	events map[string]*EventCount
+}
+
+// Manager creates shadow twins, mirrors the telemetry of their sources to
+// them and compares them with their sources
+type Manager struct {
+	registry *registry.Registry
+	ingester *ingest.Ingester
+	pubsub   eventbus.Publisher
+	shadows  map[string]*shadow  // Shadow ID -> shadow
+	bySource map[string][]string // Source ID -> shadow IDs
+	mutex    sync.RWMutex
+	now      func() time.Time
+}
+
+// NewManager creates a shadow manager and registers it as a telemetry
+// mirror of the ingester
+func NewManager(reg *registry.Registry, ingester *ingest.Ingester, pubsub eventbus.Publisher) *Manager {
+	m := &Manager{
+		registry: reg,
+		ingester: ingester,
+		pubsub:   pubsub,
+		shadows:  make(map[string]*shadow),
+		bySource: make(map[string][]string),
+		now:      time.Now,
+	}
+	ingester.AddMirror("shadows", m)
+	return m
+}
+
+// Create copies a twin into a new shadow twin. The shadow starts with the
+// attributes and features of its source but without relationships, so that
+// analyses along relationships do not count it twice. It is marked with the
+// SourceAttribute attribute.
+func (m *Manager) Create(sourceID string, s Shadow) (Shadow, error) {
+	if s.ID == "" {
+		s.ID = sourceID + TypeSuffix
+	}
+	if s.ID == sourceID {
+		return Shadow{}, fmt.Errorf("%w: the shadow ID must differ from the source ID", ErrInvalidShadow)
+	}
+
+	source, err := m.registry.Get(sourceID)
+	if err != nil {
+		return Shadow{}, err
+	}
+	if _, isShadow := source.GetAttribute(SourceAttribute); isShadow {
+		return Shadow{}, fmt.Errorf("%w: %s is itself a shadow twin", ErrInvalidShadow, sourceID)
+	}
+	if s.Type == "" {
+		s.Type = source.Type + TypeSuffix
+	}
+
+	now := m.now()
+	dt := source.Clone()
+	dt.ID = s.ID
+	dt.Type = s.Type
+	dt.Relationships = nil
+	dt.CreatedAt = now
+	dt.SetAttribute(SourceAttribute, sourceID)
+	dt.SetSystem(twin.SystemSource, "shadow")
+
+	if err := m.registry.Create(dt); err != nil {
+		return Shadow{}, err
+	}
+
+	s.SourceID = sourceID
+	s.CreatedAt = now
+	s.Mirrored, s.Failed, s.LastError = 0, 0, ""
+
+	m.mutex.Lock()
+	m.shadows[s.ID] = &shadow{Shadow: s, events: make(map[string]*EventCount)}
+	m.bySource[sourceID] = append(m.bySource[sourceID], s.ID)
+	m.mutex.Unlock()
+
+	m.pubsub.Publish("twin.created", map[string]string{"id": s.ID})
+	return s, nil
+}
+
+// Delete removes a shadow twin from the registry
+func (m *Manager) Delete(shadowID string) error {
+	if !m.forget(shadowID) {
+		return ErrShadowNotFound
+	}
+	if err := m.registry.Delete(shadowID); err != nil && err != registry.ErrTwinNotFound {
+		return err
+	}
+
+	m.pubsub.Publish("twin.deleted", map[string]string{"id": shadowID})
+	return nil
+}
+
+// forget unregisters a shadow and reports whether it was registered
+func (m *Manager) forget(shadowID string) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	s, exists := m.shadows[shadowID]
+	if !exists {
+		return false
+	}
+	delete(m.shadows, shadowID)
+
+	ids := m.bySource[s.SourceID]
+	for i, id := range ids {
+		if id == shadowID {
+			ids = append(ids[:i], ids[i+1:]...)
+			break
+		}
+	}
+	if len(ids) == 0 {
+		delete(m.bySource, s.SourceID)
+	} else {
+		m.bySource[s.SourceID] = ids
+	}
+	return true
+}
+
+// Get returns a shadow
+func (m *Manager) Get(shadowID string) (Shadow, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	s, exists := m.shadows[shadowID]
+	if !exists {
+		return Shadow{}, ErrShadowNotFound
+	}
+	return s.Shadow, nil
+}
+
+// List returns all shadows sorted by ID
+func (m *Manager) List() []Shadow {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	result := make([]Shadow, 0, len(m.shadows))
+	for _, s := range m.shadows {
+		result = append(result, s.Shadow)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// Mirror implements ingest.Mirror by applying the telemetry of a source twin
+// to its shadows. The shadows run it through the transform chain themselves.
+func (m *Manager) Mirror(t ingest.Telemetry) {
+	m.mutex.RLock()
+	ids := append([]string(nil), m.bySource[t.TwinID]...)
+	m.mutex.RUnlock()
+
+	for _, id := range ids {
+		batch := t
+		batch.TwinID = id
+		batch.Features = make(map[string]map[string]interface{}, len(t.Features))
+		for featureID, props := range t.Features {
+			copied := make(map[string]interface{}, len(props))
+			for k, v := range props {
+				copied[k] = v
+			}
+			batch.Features[featureID] = copied
+		}
+
+		_, err := m.ingester.Apply(batch)
+
+		m.mutex.Lock()
+		if s, exists := m.shadows[id]; exists {
+			if err != nil {
+				s.Failed++
+				s.LastError = err.Error()
+			} else {
+				s.Mirrored++
+			}
+		}
+		m.mutex.Unlock()
+	}
+}
+
+// HandleEvent counts the events published about sources and their shadows,
+// and forgets shadows whose twin was deleted
+func (m *Manager) HandleEvent(msg messaging_sim.Message) {
+	twinID := msg.TwinID()
+	if twinID == "" {
+		return
+	}
+
+	if msg.Topic == "twin.deleted" {
+		m.forget(twinID)
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if s, exists := m.shadows[twinID]; exists {
+		s.count(msg.Topic).Shadow++
+	}
+	for _, id := range m.bySource[twinID] {
+		m.shadows[id].count(msg.Topic).Source++
+	}
+}
+
+// count returns the event counter of a topic; the caller must hold the mutex
+func (s *shadow) count(topic string) *EventCount {
+	c, exists := s.events[topic]
+	if !exists {
+		c = &EventCount{}
+		s.events[topic] = c
+	}
+	return c
+}
+
+// Run counts events from a subscription until the channel is closed
+func (m *Manager) Run(events <-chan messaging_sim.Message) {
+	for msg := range events {
+		m.HandleEvent(msg)
+	}
+}
+
+// Compare reports how the properties of a shadow twin differ from those of
+// its source
+func (m *Manager) Compare(shadowID string) (Report, error) {
+	m.mutex.RLock()
+	s, exists := m.shadows[shadowID]
+	var report Report
+	if exists {
+		report.Shadow = s.Shadow
+		report.Events = make(map[string]EventCount, len(s.events))
+		for topic, c := range s.events {
+			report.Events[topic] = *c
+		}
+	}
+	m.mutex.RUnlock()
+	if !exists {
+		return Report{}, ErrShadowNotFound
+	}
+
+	source, err := m.registry.Get(report.SourceID)
+	if err != nil {
+		return Report{}, err
+	}
+	dt, err := m.registry.Get(shadowID)
+	if err != nil {
+		return Report{}, err
+	}
+
+	sourceProps := properties(source)
+	shadowProps := properties(dt)
+
+	keys := make(map[[2]string]bool)
+	for k := range sourceProps {
+		keys[k] = true
+	}
+	for k := range shadowProps {
+		keys[k] = true
+	}
+
+	report.Properties = len(keys)
+	report.Differences = []Difference{}
+	for k := range keys {
+		sv, inSource := sourceProps[k]
+		hv, inShadow := shadowProps[k]
+		if inSource && inShadow && reflect.DeepEqual(sv, hv) {
+			continue
+		}
+
+		d := Difference{FeatureID: k[0], Property: k[1], Source: sv, Shadow: hv}
+		if a, ok := toFloat(sv); ok {
+			if b, ok := toFloat(hv); ok {
+				delta := b - a
+				d.Delta = &delta
+			}
+		}
+		report.Differences = append(report.Differences, d)
+	}
+
+	sort.Slice(report.Differences, func(i, j int) bool {
+		a, b := report.Differences[i], report.Differences[j]
+		if a.FeatureID != b.FeatureID {
+			return a.FeatureID < b.FeatureID
+		}
+		return a.Property < b.Property
+	})
+	return report, nil
+}
+
+// properties returns the property values of a twin by feature and key
+func properties(dt *twin.DigitalTwin) map[[2]string]interface{} {
+	result := make(map[[2]string]interface{})
+	for featureID, feature := range dt.GetAllFeatures() {
+		for key, value := range feature.GetAllProperties() {
+			result[[2]string{featureID, key}] = value
+		}
+	}
+	return result
+}
+
+// toFloat converts numeric values to float64
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,142 @@
+package shadow
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/history"
+	"github.com/aleka07/go-digital-twin/pkg/ingest"
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func setupManager(t *testing.T) (*Manager, *ingest.Ingester, *registry.Registry) {
+	reg := registry.NewRegistry()
+	pubsub := messaging_sim.NewPubSub()
+	in := ingest.NewIngester(reg, pubsub, history.NewStore(10))
+
+	pump := twin.NewDigitalTwin("pump-1", "pump")
+	pump.SetAttribute("site", "north")
+	pump.AddRelationship("feeds", "tank-1")
+	status := twin.NewFeatureState()
+	status.SetProperty("pressure", 2.0)
+	pump.AddFeature("status", status)
+	if err := reg.Create(pump); err != nil {
+		t.Fatalf("Failed to create twin: %v", err)
+	}
+
+	return NewManager(reg, in, pubsub), in, reg
+}
+
+func TestCreate(t *testing.T) {
+	m, _, reg := setupManager(t)
+
+	s, err := m.Create("pump-1", Shadow{})
+	if err != nil {
+		t.Fatalf("Failed to create shadow: %v", err)
+	}
+	if s.ID != "pump-1-shadow" || s.Type != "pump-shadow" || s.SourceID != "pump-1" {
+		t.Errorf("Unexpected shadow %+v", s)
+	}
+
+	dt, err := reg.Get("pump-1-shadow")
+	if err != nil {
+		t.Fatalf("Expected the shadow twin in the registry: %v", err)
+	}
+	if source, _ := dt.GetAttribute(SourceAttribute); source != "pump-1" {
+		t.Errorf("Expected the source attribute, got %v", source)
+	}
+	if site, _ := dt.GetAttribute("site"); site != "north" {
+		t.Errorf("Expected the attributes of the source, got %v", site)
+	}
+	if rels := dt.GetRelationship("feeds"); len(rels) != 0 {
+		t.Errorf("Expected no relationships, got %v", rels)
+	}
+
+	if _, err := m.Create("pump-1-shadow", Shadow{ID: "nested"}); !errors.Is(err, ErrInvalidShadow) {
+		t.Errorf("Expected ErrInvalidShadow for a shadow of a shadow, got %v", err)
+	}
+	if _, err := m.Create("pump-1", Shadow{ID: "pump-1"}); !errors.Is(err, ErrInvalidShadow) {
+		t.Errorf("Expected ErrInvalidShadow for the source ID, got %v", err)
+	}
+	if _, err := m.Create("pump-9", Shadow{}); err != registry.ErrTwinNotFound {
+		t.Errorf("Expected ErrTwinNotFound, got %v", err)
+	}
+	if _, err := m.Create("pump-1", Shadow{}); err != registry.ErrTwinAlreadyExists {
+		t.Errorf("Expected ErrTwinAlreadyExists, got %v", err)
+	}
+
+	m.Create("pump-1", Shadow{ID: "pump-1-candidate", Type: "pump-v2"})
+	if list := m.List(); len(list) != 2 || list[0].ID != "pump-1-candidate" {
+		t.Errorf("Expected 2 shadows sorted by ID, got %+v", list)
+	}
+
+	if err := m.Delete("pump-1-candidate"); err != nil {
+		t.Errorf("Failed to delete shadow: %v", err)
+	}
+	if _, err := reg.Get("pump-1-candidate"); err != registry.ErrTwinNotFound {
+		t.Errorf("Expected the shadow twin to be deleted, got %v", err)
+	}
+	if err := m.Delete("pump-1-candidate"); err != ErrShadowNotFound {
+		t.Errorf("Expected ErrShadowNotFound, got %v", err)
+	}
+}
+
+func TestMirrorAndCompare(t *testing.T) {
+	m, in, _ := setupManager(t)
+	m.Create("pump-1", Shadow{})
+
+	// The shadow scales pressure readings differently
+	in.AddTransform("calibration", ingest.TransformFunc(func(t *ingest.Telemetry) error {
+		if t.TwinID == "pump-1-shadow" {
+			props := t.Features["status"]
+			props["pressure"] = props["pressure"].(float64) * 1.5
+		}
+		return nil
+	}))
+
+	_, err := in.Apply(ingest.Telemetry{
+		TwinID:   "pump-1",
+		Features: map[string]map[string]interface{}{"status": {"pressure": 4.0, "running": true}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to apply telemetry: %v", err)
+	}
+
+	report, err := m.Compare("pump-1-shadow")
+	if err != nil {
+		t.Fatalf("Failed to compare: %v", err)
+	}
+	if report.Mirrored != 1 || report.Properties != 2 {
+		t.Errorf("Unexpected report %+v", report)
+	}
+	if len(report.Differences) != 1 {
+		t.Fatalf("Expected 1 difference, got %+v", report.Differences)
+	}
+	d := report.Differences[0]
+	if d.Property != "pressure" || d.Source != 4.0 || d.Shadow != 6.0 || d.Delta == nil || *d.Delta != 2 {
+		t.Errorf("Unexpected difference %+v", d)
+	}
+}
+
+func TestHandleEvent(t *testing.T) {
+	m, _, reg := setupManager(t)
+	m.Create("pump-1", Shadow{})
+
+	m.HandleEvent(messaging_sim.Message{Topic: "rule.triggered", Payload: map[string]interface{}{"twinId": "pump-1", "rule": "high"}})
+	m.HandleEvent(messaging_sim.Message{Topic: "rule.triggered", Payload: map[string]interface{}{"twinId": "pump-1", "rule": "high"}})
+	m.HandleEvent(messaging_sim.Message{Topic: "rule.triggered", Payload: map[string]interface{}{"twinId": "pump-1-shadow", "rule": "high"}})
+
+	report, _ := m.Compare("pump-1-shadow")
+	if c := report.Events["rule.triggered"]; c.Source != 2 || c.Shadow != 1 {
+		t.Errorf("Unexpected event counts %+v", c)
+	}
+
+	// Deleting the shadow twin directly forgets the shadow
+	reg.Delete("pump-1-shadow")
+	m.HandleEvent(messaging_sim.Message{Topic: "twin.deleted", Payload: map[string]string{"id": "pump-1-shadow"}})
+	if _, err := m.Get("pump-1-shadow"); err != ErrShadowNotFound {
+		t.Errorf("Expected ErrShadowNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,245 @@
+package share
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Common errors
+var (
+	ErrInvalidToken = errors.New("invalid share token")
+	ErrExpiredToken = errors.New("share token expired")
+	ErrRevokedToken = errors.New("share token revoked")
+	ErrLinkNotFound = errors.New("share link not found")
+	ErrInvalidLink  = errors.New("invalid share link")
+)
+
+// Scope is the access a share link grants
+type Scope string
+
+// Share scopes
+const (
+	ScopeRead  Scope = "read"  // Read the twin, its features and properties
+	ScopeWrite Scope = "write" // Read, and update feature properties
+)
+
+// MaxTTL is the longest lifetime of a share link
+const MaxTTL = 30 * 24 * time.Hour
+
+// Link is a time- and scope-limited grant of access to a single twin
+type Link struct {
+	ID        string    `json:"id"`
+	TwinID    string    `json:"twinId"`
+	Scope     Scope     `json:"scope"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	CreatedAt time.Time `json:"createdAt"`
+	Token     string    `json:"token,omitempty"`
+}
+
+// claims is the signed content of a token
+type claims struct {
+	ID        string `json:"jti"`
+	TwinID    string `json:"sub"`
+	Scope     Scope  `json:"scope"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// Allows reports whether the link grants a scope
+func (l *Link) Allows(scope Scope) bool {
+	return l.Scope == ScopeWrite || scope == ScopeRead
+}
+
+// Manager issues and verifies share tokens. Tokens are signed with HMAC-SHA256,
+// so they can be verified without storage. Issued links are remembered so that
+// they can be listed and revoked; revoked IDs are kept until the link expires.
+type Manager struct {
+	secret  []byte
+	links   map[string]*Link
+	revoked map[string]time.Time // Link ID -> expiry
+	mutex   sync.RWMutex
+}
+
+// NewManager creates a share manager signing tokens with a random secret.
+// Tokens only stay valid across restarts if the secret is set with SetSecret.
+func NewManager() *Manager {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(err)
+	}
+
+	return &Manager{
+		secret:  secret,
+		links:   make(map[string]*Link),
+		revoked: make(map[string]time.Time),
+	}
+}
+
+// SetSecret replaces the signing secret. Tokens signed with the previous secret become invalid.
+func (m *Manager) SetSecret(secret []byte) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.secret = append([]byte(nil), secret...)
+}
+
+// Create issues a share link for a twin that expires after ttl
+func (m *Manager) Create(twinID string, scope Scope, ttl time.Duration) (*Link, error) {
+	if twinID == "" {
+		return nil, fmt.Errorf("%w: twin ID is required", ErrInvalidLink)
+	}
+	if scope != ScopeRead && scope != ScopeWrite {
+		return nil, fmt.Errorf("%w: unknown scope %q", ErrInvalidLink, scope)
+	}
+	if ttl <= 0 || ttl > MaxTTL {
+		return nil, fmt.Errorf("%w: ttl must be positive and at most %s", ErrInvalidLink, MaxTTL)
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	link := &Link{
+		ID:        hex.EncodeToString(id),
+		TwinID:    twinID,
+		Scope:     scope,
+		ExpiresAt: now.Add(ttl).Truncate(time.Second),
+		CreatedAt: now,
+	}
+
+	payload, err := json.Marshal(claims{
+		ID:        link.ID,
+		TwinID:    link.TwinID,
+		Scope:     link.Scope,
+		ExpiresAt: link.ExpiresAt.Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	link.Token = encoded + "." + m.sign(encoded)
+
+	m.pruneExpired(now)
+	m.links[link.ID] = link
+
+	return link, nil
+}
+
+// Verify checks a token and returns the link it grants
+func (m *Manager) Verify(token string) (*Link, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if !hmac.Equal([]byte(signature), []byte(m.sign(encoded))) {
+		return nil, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var c claims
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	expiresAt := time.Unix(c.ExpiresAt, 0)
+	if !time.Now().Before(expiresAt) {
+		return nil, ErrExpiredToken
+	}
+
+	if _, revoked := m.revoked[c.ID]; revoked {
+		return nil, ErrRevokedToken
+	}
+
+	return &Link{ID: c.ID, TwinID: c.TwinID, Scope: c.Scope, ExpiresAt: expiresAt}, nil
+}
+
+// List returns the unexpired links of a twin, oldest first, without their tokens
+func (m *Manager) List(twinID string) []Link {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	now := time.Now()
+	result := make([]Link, 0)
+	for _, link := range m.links {
+		if link.TwinID == twinID && now.Before(link.ExpiresAt) {
+			l := *link
+			l.Token = ""
+			result = append(result, l)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.Before(result[j].CreatedAt) })
+	return result
+}
+
+// Revoke invalidates a link of a twin before it expires
+func (m *Manager) Revoke(twinID, id string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	link, exists := m.links[id]
+	if !exists || link.TwinID != twinID {
+		return ErrLinkNotFound
+	}
+
+	delete(m.links, id)
+	m.revoked[id] = link.ExpiresAt
+	return nil
+}
+
+// RevokeTwin invalidates all links of a twin
+func (m *Manager) RevokeTwin(twinID string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for id, link := range m.links {
+		if link.TwinID == twinID {
+			delete(m.links, id)
+			m.revoked[id] = link.ExpiresAt
+		}
+	}
+}
+
+// sign returns the signature of an encoded payload
+func (m *Manager) sign(encoded string) string {
+	mac := hmac.New(sha256.New, m.secret)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// pruneExpired forgets expired links and revocations
+func (m *Manager) pruneExpired(now time.Time) {
+	for id, link := range m.links {
+		if !now.Before(link.ExpiresAt) {
+			delete(m.links, id)
+		}
+	}
+	for id, expiresAt := range m.revoked {
+		if !now.Before(expiresAt) {
+			delete(m.revoked, id)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package share
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreateAndVerify(t *testing.T) {
+	m := NewManager()
+
+	link, err := m.Create("machine-1", ScopeRead, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create link: %v", err)
+	}
+
+	verified, err := m.Verify(link.Token)
+	if err != nil {
+		t.Fatalf("Failed to verify token: %v", err)
+	}
+
+	if verified.TwinID != "machine-1" || verified.Scope != ScopeRead || verified.ID != link.ID {
+		t.Errorf("Unexpected verified link: %+v", verified)
+	}
+
+	if verified.Allows(ScopeWrite) || !verified.Allows(ScopeRead) {
+		t.Error("Expected read link to allow only reading")
+	}
+
+	// Tampered tokens are rejected
+	payload, signature, _ := strings.Cut(link.Token, ".")
+	if _, err := m.Verify(payload + "x." + signature); err != ErrInvalidToken {
+		t.Errorf("Expected ErrInvalidToken for tampered payload, got %v", err)
+	}
+	if _, err := m.Verify("garbage"); err != ErrInvalidToken {
+		t.Errorf("Expected ErrInvalidToken for garbage, got %v", err)
+	}
+
+	// Tokens survive a restart with the same secret only
+	other := NewManager()
+	if _, err := other.Verify(link.Token); err != ErrInvalidToken {
+		t.Errorf("Expected ErrInvalidToken with another secret, got %v", err)
+	}
+
+	m.SetSecret([]byte("shared-secret"))
+	other.SetSecret([]byte("shared-secret"))
+	link, _ = m.Create("machine-1", ScopeWrite, time.Hour)
+	if _, err := other.Verify(link.Token); err != nil {
+		t.Errorf("Expected token to be valid with the same secret, got %v", err)
+	}
+}
+
+func TestCreateValidation(t *testing.T) {
+	m := NewManager()
+
+	cases := []struct {
+		twinID string
+		scope  Scope
+		ttl    time.Duration
+	}{
+		{"", ScopeRead, time.Hour},
+		{"machine-1", "admin", time.Hour},
+		{"machine-1", ScopeRead, 0},
+		{"machine-1", ScopeRead, MaxTTL + time.Hour},
+	}
+
+	for _, c := range cases {
+		if _, err := m.Create(c.twinID, c.scope, c.ttl); !errors.Is(err, ErrInvalidLink) {
+			t.Errorf("Expected ErrInvalidLink for %+v, got %v", c, err)
+		}
+	}
+}
+
+func TestExpiryAndRevocation(t *testing.T) {
+	m := NewManager()
+
+	short, _ := m.Create("machine-1", ScopeRead, time.Second)
+	long, _ := m.Create("machine-1", ScopeRead, time.Hour)
+	m.Create("machine-2", ScopeRead, time.Hour)
+
+	if links := m.List("machine-1"); len(links) != 2 || links[0].Token != "" {
+		t.Errorf("Expected 2 links without tokens, got %+v", links)
+	}
+
+	if err := m.Revoke("machine-2", long.ID); err != ErrLinkNotFound {
+		t.Errorf("Expected ErrLinkNotFound for another twin, got %v", err)
+	}
+
+	if err := m.Revoke("machine-1", long.ID); err != nil {
+		t.Fatalf("Failed to revoke link: %v", err)
+	}
+
+	if _, err := m.Verify(long.Token); err != ErrRevokedToken {
+		t.Errorf("Expected ErrRevokedToken, got %v", err)
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+	if _, err := m.Verify(short.Token); err != ErrExpiredToken {
+		t.Errorf("Expected ErrExpiredToken, got %v", err)
+	}
+
+	m.RevokeTwin("machine-2")
+	if links := m.List("machine-2"); len(links) != 0 {
+		t.Errorf("Expected no links after revoking the twin, got %v", links)
+	}
+}
@@ -0,0 +1,213 @@
+package testutil
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/eventbus"
+)
+
+// DefaultWait is how long Expect waits for an event
+const DefaultWait = 2 * time.Second
+
+// recorderBuffer is the subscription buffer of a recorder, large enough
+// for the bursts of events a test causes
+const recorderBuffer = 4096
+
+// Matcher selects events
+type Matcher func(msg eventbus.Message) bool
+
+// Recorder keeps the events published to a topic pattern
+type Recorder struct {
+	pubsub  eventbus.Subscriber
+	pattern string
+	ch      chan eventbus.Message
+	events  []eventbus.Message
+	changed chan struct{} // Closed and replaced when an event arrives
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+	mutex   sync.Mutex
+}
+
+// NewRecorder records the events delivered by a bus for a topic pattern,
+// such as "twin.#", until it is closed
+func NewRecorder(pubsub eventbus.Subscriber, pattern string) *Recorder {
+	r := &Recorder{
+		pubsub:  pubsub,
+		pattern: pattern,
+		ch:      pubsub.SubscribeWithBuffer(pattern, recorderBuffer),
+		changed: make(chan struct{}),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+// run collects events until the recorder or the event bus is closed
+func (r *Recorder) run() {
+	defer close(r.done)
+
+	for {
+		select {
+		case msg, ok := <-r.ch:
+			if !ok {
+				return
+			}
+			r.mutex.Lock()
+			r.events = append(r.events, msg)
+			close(r.changed)
+			r.changed = make(chan struct{})
+			r.mutex.Unlock()
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// Close stops recording. Recorded events are kept.
+func (r *Recorder) Close() {
+	r.once.Do(func() {
+		r.pubsub.Unsubscribe(r.pattern, r.ch)
+		close(r.stop)
+		<-r.done
+	})
+}
+
+// Events returns the recorded events matching a topic pattern and all
+// matchers, oldest first
+func (r *Recorder) Events(pattern string, matchers ...Matcher) []eventbus.Message {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.filter(pattern, matchers)
+}
+
+// Reset forgets the recorded events
+func (r *Recorder) Reset() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.events = nil
+}
+
+// filter returns the matching events. The caller holds the mutex.
+func (r *Recorder) filter(pattern string, matchers []Matcher) []eventbus.Message {
+	var matched []eventbus.Message
+	for _, msg := range r.events {
+		if matches(msg, pattern, matchers) {
+			matched = append(matched, msg)
+		}
+	}
+	return matched
+}
+
+// Wait waits until an event matching a topic pattern and all matchers has
+// been recorded, and returns the first one. It returns false on timeout.
+func (r *Recorder) Wait(timeout time.Duration, pattern string, matchers ...Matcher) (eventbus.Message, bool) {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for {
+		r.mutex.Lock()
+		matched := r.filter(pattern, matchers)
+		changed := r.changed
+		r.mutex.Unlock()
+		if len(matched) > 0 {
+			return matched[0], true
+		}
+
+		select {
+		case <-changed:
+		case <-r.done:
+			return eventbus.Message{}, false
+		case <-deadline.C:
+			return eventbus.Message{}, false
+		}
+	}
+}
+
+// Expect waits up to DefaultWait for an event matching a topic pattern and
+// all matchers, failing the test if none is published
+func (r *Recorder) Expect(t testing.TB, pattern string, matchers ...Matcher) eventbus.Message {
+	t.Helper()
+
+	msg, ok := r.Wait(DefaultWait, pattern, matchers...)
+	if !ok {
+		t.Fatalf("Expected an event on %s within %v, got %d events: %s",
+			pattern, DefaultWait, len(r.Events("#")), r.topics())
+	}
+	return msg
+}
+
+// ExpectNone fails the test if an event matching a topic pattern and all
+// matchers is published within a duration
+func (r *Recorder) ExpectNone(t testing.TB, within time.Duration, pattern string, matchers ...Matcher) {
+	t.Helper()
+
+	if msg, ok := r.Wait(within, pattern, matchers...); ok {
+		t.Fatalf("Expected no event on %s, got %s %v", pattern, msg.Topic, msg.Payload)
+	}
+}
+
+// topics lists the recorded topics for failure messages
+func (r *Recorder) topics() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	topics := make([]string, len(r.events))
+	for i, msg := range r.events {
+		topics[i] = msg.Topic
+	}
+	return topics
+}
+
+// matches reports whether an event matches a topic pattern and all matchers
+func matches(msg eventbus.Message, pattern string, matchers []Matcher) bool {
+	if !eventbus.TopicMatches(pattern, msg.Topic) {
+		return false
+	}
+	for _, m := range matchers {
+		if !m(msg) {
+			return false
+		}
+	}
+	return true
+}
+
+// ForTwin matches events about a twin, whose payload names it with an id,
+// twinId or TwinID field
+func ForTwin(id string) Matcher {
+	return Field("id", id)
+}
+
+// Field matches events whose payload has a top-level field with a value,
+// compared after encoding the payload as JSON. The id field also matches
+// twinId and TwinID, as payloads name twins differently.
+func Field(name string, value interface{}) Matcher {
+	names := []string{name}
+	if name == "id" {
+		names = append(names, "twinId", "TwinID")
+	}
+	expected, _ := json.Marshal(value)
+
+	return func(msg eventbus.Message) bool {
+		data, err := json.Marshal(msg.Payload)
+		if err != nil {
+			return false
+		}
+		var fields map[string]json.RawMessage
+		if json.Unmarshal(data, &fields) != nil {
+			return false
+		}
+		for _, n := range names {
+			if raw, ok := fields[n]; ok && string(raw) == string(expected) {
+				return true
+			}
+		}
+		return false
+	}
+}
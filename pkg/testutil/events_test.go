@@ -0,0 +1,44 @@
+package testutil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+)
+
+func TestRecorder(t *testing.T) {
+	pubsub := messaging_sim.NewPubSub()
+	r := NewRecorder(pubsub, "twin.#")
+	defer r.Close()
+
+	pubsub.Publish("twin.created", map[string]string{"id": "pump-1"})
+	pubsub.Publish("alert.raised", map[string]string{"id": "pump-1"})
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		pubsub.Publish("twin.updated", struct{ TwinID string }{"pump-2"})
+	}()
+
+	if msg := r.Expect(t, "twin.updated", ForTwin("pump-2")); msg.Topic != "twin.updated" {
+		t.Errorf("Unexpected event %+v", msg)
+	}
+	if events := r.Events("#"); len(events) != 2 {
+		t.Errorf("Expected 2 recorded events, got %v", events)
+	}
+	if events := r.Events("twin.+", Field("id", "pump-1")); len(events) != 1 {
+		t.Errorf("Expected 1 event about pump-1, got %v", events)
+	}
+	r.ExpectNone(t, 10*time.Millisecond, "twin.deleted")
+
+	r.Reset()
+	if _, ok := r.Wait(10*time.Millisecond, "#"); ok {
+		t.Error("Expected no events after a reset")
+	}
+
+	// Closing the event bus ends waiting
+	pubsub.Close()
+	start := time.Now()
+	if _, ok := r.Wait(time.Second, "#"); ok || time.Since(start) > 500*time.Millisecond {
+		t.Error("Expected waiting to end with the event bus")
+	}
+}
@@ -0,0 +1,169 @@
+// Package testutil runs the full twin server in memory for integration
+// tests, in this module and in projects building on it:
+//
+//	func TestPumpAlarm(t *testing.T) {
+//		ts := testutil.NewTestServer(t)
+//		resp := ts.Request(t, "POST", "/twins", map[string]interface{}{"id": "pump-1", "type": "pump"})
+//		testutil.ExpectStatus(t, resp, http.StatusCreated)
+//		ts.Events.Expect(t, "twin.created", testutil.ForTwin("pump-1"))
+//	}
+package testutil
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/api"
+	"github.com/aleka07/go-digital-twin/pkg/clock"
+	"github.com/aleka07/go-digital-twin/pkg/fixtures"
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+)
+
+// shutdownTimeout bounds waiting for in-flight requests when a test ends
+const shutdownTimeout = 5 * time.Second
+
+// TestServer is an API server listening on an ephemeral local port, with
+// an in-memory registry, event bus, history and object store
+type TestServer struct {
+	URL      string // Base URL, such as http://127.0.0.1:41234
+	APIURL   string // URL of the versioned API, URL + /api/v1
+	Server   *api.Server
+	Registry *registry.Registry
+	PubSub   *messaging_sim.PubSub
+	Events   *Recorder // Events published from the start of the server
+
+	http *httptest.Server
+}
+
+// NewTestServer starts a test server that is shut down when the test and
+// its subtests end
+func NewTestServer(t testing.TB) *TestServer {
+	t.Helper()
+
+	reg := registry.NewRegistry()
+	pubsub := messaging_sim.NewPubSub()
+	events := NewRecorder(pubsub, "#")
+	server := api.NewServer(reg, pubsub)
+	hs := httptest.NewServer(server.Router)
+
+	ts := &TestServer{
+		URL:      hs.URL,
+		APIURL:   hs.URL + api.APIPrefix,
+		Server:   server,
+		Registry: reg,
+		PubSub:   pubsub,
+		Events:   events,
+		http:     hs,
+	}
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// Close shuts the server down. Tests need not call it.
+func (ts *TestServer) Close() {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	ts.http.Close()
+	ts.Server.Shutdown(ctx)
+	ts.Events.Close()
+	ts.PubSub.Close()
+}
+
+// Client returns an HTTP client for the server
+func (ts *TestServer) Client() *http.Client {
+	return ts.http.Client()
+}
+
+// FakeClock makes the server and its twins read the time from a fake clock
+// starting at a time
+func (ts *TestServer) FakeClock(t testing.TB, start time.Time) *clock.Fake {
+	t.Helper()
+
+	fake := clock.NewFake(start)
+	ts.Server.SetClock(fake)
+	return fake
+}
+
+// Seed creates the twins and rules of a fixture, failing the test if they
+// cannot be created
+func (ts *TestServer) Seed(t testing.TB, f *fixtures.Fixture) fixtures.Report {
+	t.Helper()
+
+	report, err := fixtures.Seed(f, ts.Registry, ts.PubSub, ts.Server.Scripts)
+	if err != nil {
+		t.Fatalf("Failed to seed fixture: %v", err)
+	}
+	return report
+}
+
+// Request sends a request to a path of the versioned API, such as
+// /twins/pump-1, failing the test if it cannot be sent. Bodies other than
+// nil, strings and byte slices are encoded as JSON. Full URLs, such as
+// ts.URL + "/health", are sent as they are.
+func (ts *TestServer) Request(t testing.TB, method, path string, body interface{}) *http.Response {
+	t.Helper()
+
+	var reader io.Reader
+	switch b := body.(type) {
+	case nil:
+	case string:
+		reader = strings.NewReader(b)
+	case []byte:
+		reader = bytes.NewReader(b)
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			t.Fatalf("Failed to encode request body: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	url := path
+	if !strings.HasPrefix(path, "http://") && !strings.HasPrefix(path, "https://") {
+		url = ts.APIURL + path
+	}
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	if reader != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, path, err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// ExpectStatus fails the test, with the response body, if a response does
+// not have the expected status
+func ExpectStatus(t testing.TB, resp *http.Response, status int) {
+	t.Helper()
+
+	if resp.StatusCode != status {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("%s %s: expected status %d, got %d: %s",
+			resp.Request.Method, resp.Request.URL.Path, status, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+}
+
+// DecodeJSON decodes a JSON response body, failing the test if it is invalid
+func DecodeJSON(t testing.TB, resp *http.Response, v interface{}) {
+	t.Helper()
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("Failed to decode response of %s %s: %v", resp.Request.Method, resp.Request.URL.Path, err)
+	}
+}
@@ -0,0 +1,77 @@
+package testutil
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/fixtures"
+	"github.com/aleka07/go-digital-twin/pkg/views"
+)
+
+func TestTestServer(t *testing.T) {
+	ts := NewTestServer(t)
+
+	resp := ts.Request(t, "POST", "/twins", map[string]interface{}{"id": "pump-1", "type": "pump"})
+	ExpectStatus(t, resp, http.StatusCreated)
+	ts.Events.Expect(t, "twin.created", ForTwin("pump-1"))
+
+	var created map[string]interface{}
+	resp = ts.Request(t, "GET", "/twins/pump-1", nil)
+	ExpectStatus(t, resp, http.StatusOK)
+	DecodeJSON(t, resp, &created)
+	if created["type"] != "pump" {
+		t.Errorf("Expected a pump, got %v", created)
+	}
+
+	// Unversioned routes are reached with full URLs
+	ExpectStatus(t, ts.Request(t, "GET", ts.URL+"/health", nil), http.StatusOK)
+
+	b := fixtures.NewBuilder()
+	b.Twin("valve-1", "valve").Property("position", "open", true)
+	if report := ts.Seed(t, b.Fixture()); len(report.Created) != 1 {
+		t.Errorf("Unexpected seed report %+v", report)
+	}
+	ExpectStatus(t, ts.Request(t, "GET", "/twins/valve-1", nil), http.StatusOK)
+
+	// Servers are independent
+	other := NewTestServer(t)
+	ExpectStatus(t, other.Request(t, "GET", "/twins/pump-1", nil), http.StatusNotFound)
+	if other.URL == ts.URL {
+		t.Error("Expected each server on its own port")
+	}
+}
+
+func TestFakeClock(t *testing.T) {
+	ts := NewTestServer(t)
+	start := time.Date(2026, 7, 1, 9, 0, 0, 0, time.UTC)
+	fake := ts.FakeClock(t, start)
+
+	ExpectStatus(t, ts.Request(t, "POST", "/twins", map[string]interface{}{"id": "pump-1", "type": "pump"}), http.StatusCreated)
+	fake.Advance(time.Hour)
+	ExpectStatus(t, ts.Request(t, "POST", "/twins/pump-1/telemetry", map[string]interface{}{
+		"features": map[string]interface{}{"status": map[string]interface{}{"rpm": 1200}},
+	}), http.StatusOK)
+
+	dt, _ := ts.Registry.Get("pump-1")
+	if !dt.CreatedAt.Equal(start) || !dt.GetModifiedAt().Equal(start.Add(time.Hour)) {
+		t.Errorf("Expected times from the fake clock, got %v and %v", dt.CreatedAt, dt.GetModifiedAt())
+	}
+	samples := ts.Server.History.Query("pump-1", "status", "rpm", time.Time{}, time.Time{})
+	if len(samples) != 1 || !samples[0].Timestamp.Equal(start.Add(time.Hour)) {
+		t.Errorf("Expected a sample an hour after the start, got %v", samples)
+	}
+
+	// Properties written through the API and views read the same clock
+	fake.Advance(time.Hour)
+	ExpectStatus(t, ts.Request(t, "PUT", "/twins/pump-1/features/status/properties/rpm", 1500), http.StatusOK)
+	dt, _ = ts.Registry.Get("pump-1")
+	status, _ := dt.GetFeature("status")
+	if meta, _ := status.GetPropertyMetadata("rpm"); !meta.Timestamp.Equal(start.Add(2*time.Hour)) || !meta.ServerTimestamp.Equal(start.Add(2*time.Hour)) {
+		t.Errorf("Expected the property written two hours after the start, got %+v", meta)
+	}
+	ts.Server.Views.Create(views.Definition{Name: "pumps", Query: "type==pump"})
+	if result, _ := ts.Server.Views.Get("pumps"); !result.RefreshedAt.Equal(start.Add(2 * time.Hour)) {
+		t.Errorf("Expected the view refreshed two hours after the start, got %v", result.RefreshedAt)
+	}
+}
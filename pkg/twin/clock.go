@@ -0,0 +1,78 @@
+package twin
+
+import (
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/clock"
+)
+
+// NewDigitalTwinWithClock creates a new digital twin whose creation and
+// modification times are read from a clock; nil is the system clock
+func NewDigitalTwinWithClock(id, twinType string, c clock.Clock) *DigitalTwin {
+	created := clock.OrSystem(c).Now()
+	return &DigitalTwin{
+		ID:         id,
+		Type:       twinType,
+		Lifecycle:  LifecycleProvisioned,
+		Attributes: make(map[string]interface{}),
+		Features:   make(map[string]*FeatureState),
+		CreatedAt:  created,
+		ModifiedAt: created,
+		clock:      c,
+	}
+}
+
+// NewFeatureStateWithClock creates a new feature state whose modification
+// and server times are read from a clock; nil is the system clock
+func NewFeatureStateWithClock(c clock.Clock) *FeatureState {
+	return &FeatureState{
+		Properties:   make(map[string]interface{}),
+		DesiredProps: make(map[string]interface{}),
+		Definition:   []string{},
+		Metadata:     make(map[string]PropertyMetadata),
+		LastModified: clock.OrSystem(c).Now(),
+		clock:        c,
+	}
+}
+
+// SetClock sets the clock the modification times of the twin and its
+// features are read from; nil restores the system clock. Clones of the twin
+// and features added to it later read from the same clock.
+func (dt *DigitalTwin) SetClock(c clock.Clock) {
+	dt.mutex.Lock()
+	defer dt.mutex.Unlock()
+
+	dt.clock = c
+	for _, feature := range dt.Features {
+		feature.SetClock(c)
+	}
+}
+
+// Clock returns the clock the twin reads its times from
+func (dt *DigitalTwin) Clock() clock.Clock {
+	dt.mutex.RLock()
+	defer dt.mutex.RUnlock()
+
+	return clock.OrSystem(dt.clock)
+}
+
+// now returns the time of the twin clock; the caller must hold at least the
+// read lock
+func (dt *DigitalTwin) now() time.Time {
+	return clock.OrSystem(dt.clock).Now()
+}
+
+// SetClock sets the clock the modification and server times of the feature
+// are read from; nil restores the system clock
+func (fs *FeatureState) SetClock(c clock.Clock) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	fs.clock = c
+}
+
+// now returns the time of the feature clock; the caller must hold at least
+// the read lock
+func (fs *FeatureState) now() time.Time {
+	return clock.OrSystem(fs.clock).Now()
+}
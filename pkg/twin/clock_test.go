@@ -0,0 +1,48 @@
+package twin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/clock"
+)
+
+func TestClock(t *testing.T) {
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(start)
+
+	dt := NewDigitalTwinWithClock("pump-1", "pump", fake)
+	if !dt.CreatedAt.Equal(start) || !dt.GetModifiedAt().Equal(start) {
+		t.Errorf("Expected creation at %v, got %v %v", start, dt.CreatedAt, dt.GetModifiedAt())
+	}
+
+	// Features added to the twin and clones read from its clock
+	fake.Advance(time.Hour)
+	feature := NewFeatureState()
+	dt.AddFeature("status", feature)
+	feature.SetProperty("rpm", 1200)
+	if !dt.GetModifiedAt().Equal(start.Add(time.Hour)) {
+		t.Errorf("Expected modification an hour later, got %v", dt.GetModifiedAt())
+	}
+	if meta, _ := feature.GetPropertyMetadata("rpm"); !meta.ServerTimestamp.Equal(start.Add(time.Hour)) {
+		t.Errorf("Expected the server timestamp from the clock, got %v", meta.ServerTimestamp)
+	}
+
+	fake.Advance(time.Hour)
+	clone := dt.Clone()
+	clone.SetAttribute("site", "north")
+	if !clone.GetModifiedAt().Equal(start.Add(2 * time.Hour)) {
+		t.Errorf("Expected the clone to read from the clock, got %v", clone.GetModifiedAt())
+	}
+
+	// Other twins are unaffected
+	if dt := NewDigitalTwin("pump-2", "pump"); time.Since(dt.CreatedAt) > time.Minute {
+		t.Errorf("Expected the system clock, got %v", dt.CreatedAt)
+	}
+
+	dt.SetClock(nil)
+	dt.SetAttribute("site", "south")
+	if time.Since(dt.GetModifiedAt()) > time.Minute {
+		t.Errorf("Expected the system clock to be restored, got %v", dt.GetModifiedAt())
+	}
+}
@@ -0,0 +1,67 @@
+package twin
+
+// Clone returns a deep copy of the digital twin and its features.
+// Property and attribute values are copied by reference, so callers must
+// treat them as immutable, as the rest of the package does.
+func (dt *DigitalTwin) Clone() *DigitalTwin {
+	dt.mutex.RLock()
+	defer dt.mutex.RUnlock()
+
+	c := &DigitalTwin{
+		ID:         dt.ID,
+		Type:       dt.Type,
+		Definition: dt.Definition,
+		Lifecycle:  dt.Lifecycle,
+		Semantics:  dt.Semantics.copy(),
+		Scene:      dt.Scene.copy(),
+		Revision:   dt.Revision,
+		Attributes: make(map[string]interface{}, len(dt.Attributes)),
+		Features:   make(map[string]*FeatureState, len(dt.Features)),
+		CreatedAt:  dt.CreatedAt,
+		ModifiedAt: dt.ModifiedAt,
+		clock:      dt.clock,
+	}
+
+	for k, v := range dt.Attributes {
+		c.Attributes[k] = v
+	}
+	for id, feature := range dt.Features {
+		c.Features[id] = feature.Clone()
+	}
+	if dt.Relationships != nil {
+		c.Relationships = make(map[string][]string, len(dt.Relationships))
+		for name, targets := range dt.Relationships {
+			c.Relationships[name] = append([]string(nil), targets...)
+		}
+	}
+	return c
+}
+
+// Clone returns a deep copy of the feature state
+func (fs *FeatureState) Clone() *FeatureState {
+	fs.mutex.RLock()
+	defer fs.mutex.RUnlock()
+
+	c := &FeatureState{
+		Properties:   make(map[string]interface{}, len(fs.Properties)),
+		DesiredProps: make(map[string]interface{}, len(fs.DesiredProps)),
+		Definition:   append([]string{}, fs.Definition...),
+		Metadata:     make(map[string]PropertyMetadata, len(fs.Metadata)),
+		Semantics:    fs.Semantics.copy(),
+		LastModified: fs.LastModified,
+		CreatedBy:    fs.CreatedBy,
+		ModifiedBy:   fs.ModifiedBy,
+		clock:        fs.clock,
+	}
+
+	for k, v := range fs.Properties {
+		c.Properties[k] = v
+	}
+	for k, v := range fs.DesiredProps {
+		c.DesiredProps[k] = v
+	}
+	for k, v := range fs.Metadata {
+		c.Metadata[k] = v
+	}
+	return c
+}
@@ -0,0 +1,41 @@
+package twin
+
+import "testing"
+
+func TestClone(t *testing.T) {
+	dt := NewDigitalTwin("pump-1", "pump")
+	dt.SetAttribute("location", "hall-1")
+	dt.AddRelationship("feeds", "valve-1")
+
+	feature := NewFeatureState()
+	feature.SetProperty("rpm", 1450.0)
+	feature.SetCreatedBy("alice")
+	dt.AddFeature("motor", feature)
+
+	c := dt.Clone()
+
+	// Changes to the original do not reach the clone
+	dt.SetAttribute("location", "hall-2")
+	dt.AddRelationship("feeds", "valve-2")
+	feature.SetProperty("rpm", 0.0)
+	feature.SetModifiedBy("bob")
+	dt.AddFeature("seal", NewFeatureState())
+
+	if location, _ := c.GetAttribute("location"); location != "hall-1" {
+		t.Errorf("Expected location hall-1, got %v", location)
+	}
+	if feeds := c.GetRelationship("feeds"); len(feeds) != 1 {
+		t.Errorf("Expected one relationship target, got %v", feeds)
+	}
+	if _, exists := c.GetFeature("seal"); exists {
+		t.Error("Expected clone not to have the seal feature")
+	}
+
+	motor, _ := c.GetFeature("motor")
+	if rpm, _ := motor.GetProperty("rpm"); rpm != 1450.0 {
+		t.Errorf("Expected rpm 1450, got %v", rpm)
+	}
+	if motor.GetCreatedBy() != "alice" || motor.GetModifiedBy() != "" {
+		t.Errorf("Expected creator alice and no modifier, got %q and %q", motor.GetCreatedBy(), motor.GetModifiedBy())
+	}
+}
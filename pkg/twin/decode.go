@@ -0,0 +1,58 @@
+package twin
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// Decode decodes a twin in the representation of API version 1, as served
+// by federation peers and replication sources. Its desired properties are
+// named differently from the Go fields, and the maps of its features are
+// initialized where the document leaves them out.
+func Decode(data []byte) (*DigitalTwin, error) {
+	dt := &DigitalTwin{}
+	if err := json.Unmarshal(data, dt); err != nil {
+		return nil, err
+	}
+	var desired struct {
+		Features map[string]struct {
+			DesiredProperties map[string]interface{} `json:"desiredProperties"`
+		} `json:"features"`
+	}
+	if err := json.Unmarshal(data, &desired); err != nil {
+		return nil, err
+	}
+	if dt.ID == "" {
+		return nil, errors.New("twin without an ID")
+	}
+
+	if dt.Attributes == nil {
+		dt.Attributes = make(map[string]interface{})
+	}
+	if dt.Features == nil {
+		dt.Features = make(map[string]*FeatureState)
+	}
+	for id, fs := range dt.Features {
+		if fs == nil {
+			fs = NewFeatureState()
+			dt.Features[id] = fs
+		}
+		fs.DesiredProps = desired.Features[id].DesiredProperties
+		if fs.Properties == nil {
+			fs.Properties = make(map[string]interface{})
+		}
+		if fs.DesiredProps == nil {
+			fs.DesiredProps = make(map[string]interface{})
+		}
+		if fs.Definition == nil {
+			fs.Definition = []string{}
+		}
+		if fs.Metadata == nil {
+			fs.Metadata = make(map[string]PropertyMetadata)
+		}
+	}
+	if dt.Lifecycle == "" {
+		dt.Lifecycle = LifecycleProvisioned
+	}
+	return dt, nil
+}
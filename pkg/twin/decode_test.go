@@ -0,0 +1,28 @@
+package twin
+
+import "testing"
+
+func TestDecode(t *testing.T) {
+	dt, err := Decode([]byte(`{"id": "pump-1", "type": "pump", "features": {
+		"status": {"properties": {"state": "running"}, "desiredProperties": {"state": "stopped"}},
+		"empty": null
+	}}`))
+	if err != nil {
+		t.Fatalf("Failed to decode twin: %v", err)
+	}
+
+	if dt.ID != "pump-1" || dt.Lifecycle != LifecycleProvisioned || dt.Attributes == nil {
+		t.Errorf("Unexpected twin %+v", dt)
+	}
+	status, _ := dt.GetFeature("status")
+	if state, _ := status.GetDesiredProperty("state"); state != "stopped" {
+		t.Errorf("Expected the desired state stopped, got %v", state)
+	}
+	if empty, ok := dt.GetFeature("empty"); !ok || empty.Properties == nil || empty.Metadata == nil {
+		t.Errorf("Expected the empty feature to be initialized, got %+v", empty)
+	}
+
+	if _, err := Decode([]byte(`{"type": "pump"}`)); err == nil {
+		t.Error("Expected a twin without an ID to be rejected")
+	}
+}
@@ -0,0 +1,66 @@
+package twin
+
+import (
+	"sort"
+	"strconv"
+)
+
+// ExternalIDsAttribute is the attribute holding the IDs of a twin in
+// external systems, by system, so that integrations can address twins by
+// the IDs they know: {"erp": "4711", "serial": "SN-1", "mac": ["a", "b"]}.
+// A system may list several IDs.
+const ExternalIDsAttribute = "externalIds"
+
+// ExternalIDs returns the IDs of the twin in external systems, by system.
+// IDs are strings, or numbers formatted as strings; lists of them give
+// several IDs. Other values are ignored.
+func (dt *DigitalTwin) ExternalIDs() map[string][]string {
+	value, _ := dt.GetAttribute(ExternalIDsAttribute)
+	systems, ok := value.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	result := make(map[string][]string, len(systems))
+	for system, v := range systems {
+		var ids []string
+		switch list := v.(type) {
+		case []interface{}:
+			for _, item := range list {
+				if id, ok := externalID(item); ok {
+					ids = append(ids, id)
+				}
+			}
+		case []string:
+			for _, id := range list {
+				if id != "" {
+					ids = append(ids, id)
+				}
+			}
+		default:
+			if id, ok := externalID(v); ok {
+				ids = append(ids, id)
+			}
+		}
+		if len(ids) > 0 {
+			sort.Strings(ids)
+			result[system] = ids
+		}
+	}
+	return result
+}
+
+// externalID returns an external ID value as a string
+func externalID(v interface{}) (string, bool) {
+	switch id := v.(type) {
+	case string:
+		return id, id != ""
+	case float64:
+		return strconv.FormatFloat(id, 'f', -1, 64), true
+	case int:
+		return strconv.Itoa(id), true
+	case int64:
+		return strconv.FormatInt(id, 10), true
+	}
+	return "", false
+}
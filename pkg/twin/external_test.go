@@ -0,0 +1,31 @@
+package twin
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExternalIDs(t *testing.T) {
+	dt := NewDigitalTwin("pump-1", "pump")
+	if ids := dt.ExternalIDs(); ids != nil {
+		t.Errorf("Expected no external IDs, got %v", ids)
+	}
+
+	dt.SetAttribute(ExternalIDsAttribute, map[string]interface{}{
+		"erp":    4711.0,
+		"serial": "SN-1",
+		"mac":    []interface{}{"00:1a:2b:3c:4d:5f", "00:1a:2b:3c:4d:5e", 1.5, ""},
+		"asset":  []string{"A-2", "A-1"},
+		"empty":  "",
+		"nested": map[string]interface{}{"id": "x"},
+	})
+	want := map[string][]string{
+		"erp":    {"4711"},
+		"serial": {"SN-1"},
+		"mac":    {"00:1a:2b:3c:4d:5e", "00:1a:2b:3c:4d:5f", "1.5"},
+		"asset":  {"A-1", "A-2"},
+	}
+	if ids := dt.ExternalIDs(); !reflect.DeepEqual(ids, want) {
+		t.Errorf("Expected %v, got %v", want, ids)
+	}
+}
@@ -3,25 +3,35 @@ package twin
 import (
 	"sync"
 	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/clock"
 )
 
+// PropertyMetadata holds bookkeeping information about a property value
+type PropertyMetadata struct {
+	Timestamp       time.Time `json:"timestamp"`       // Effective time of the current value
+	DeviceTimestamp time.Time `json:"deviceTimestamp"` // Time reported by the device, zero if none was reported
+	ServerTimestamp time.Time `json:"serverTimestamp"` // Time the server received the value
+	Stale           bool      `json:"stale,omitempty"` // No value arrived within the expected update interval
+}
+
 // FeatureState represents the state of a feature in a digital twin
 type FeatureState struct {
-	Properties    map[string]interface{} // Current properties
-	DesiredProps  map[string]interface{} // Desired properties (target state)
-	Definition    []string               // Feature definition identifiers
-	LastModified  time.Time              // Last modification timestamp
-	mutex         sync.RWMutex           // For thread safety
+	Properties    map[string]interface{}      // Current properties
+	DesiredProps  map[string]interface{}      // Desired properties (target state)
+	Definition    []string                    // Feature definition identifiers
+	Metadata      map[string]PropertyMetadata // Metadata of the current properties
+	Semantics     *SemanticAnnotation         `json:",omitempty"` // Optional semantic types and context
+	LastModified  time.Time                   // Last modification timestamp
+	CreatedBy     string                      `json:",omitempty"` // Principal that created the feature, if known
+	ModifiedBy    string                      `json:",omitempty"` // Principal that last modified the feature, if known
+	mutex         sync.RWMutex                // For thread safety
+	clock         clock.Clock                 // Clock times are read from, nil for the system clock
 }
 
 // NewFeatureState creates a new feature state
 func NewFeatureState() *FeatureState {
-	return &FeatureState{
-		Properties:   make(map[string]interface{}),
-		DesiredProps: make(map[string]interface{}),
-		Definition:   []string{},
-		LastModified: time.Now(),
-	}
+	return NewFeatureStateWithClock(nil)
 }
 
 // GetProperty returns the value of a property
@@ -33,13 +43,83 @@ func (fs *FeatureState) GetProperty(key string) (interface{}, bool) {
 	return val, exists
 }
 
-// SetProperty sets the value of a property
+// SetProperty sets the value of a property measured now
 func (fs *FeatureState) SetProperty(key string, value interface{}) {
 	fs.mutex.Lock()
 	defer fs.mutex.Unlock()
-	
+
+	now := fs.now()
+	fs.setProperty(key, value, PropertyMetadata{Timestamp: now, ServerTimestamp: now})
+}
+
+// SetPropertyAt sets the value of a property measured at the given time
+func (fs *FeatureState) SetPropertyAt(key string, value interface{}, timestamp time.Time) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	fs.setProperty(key, value, PropertyMetadata{
+		Timestamp:       timestamp,
+		ServerTimestamp: fs.now(),
+	})
+}
+
+// SetPropertyWithMetadata sets the value of a property together with its metadata
+func (fs *FeatureState) SetPropertyWithMetadata(key string, value interface{}, meta PropertyMetadata) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	fs.setProperty(key, value, meta)
+}
+
+// SetPropertyIfNewer sets the value of a property unless the current value has a
+// later effective timestamp. It reports whether the value was set.
+func (fs *FeatureState) SetPropertyIfNewer(key string, value interface{}, meta PropertyMetadata) bool {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	if current, exists := fs.Metadata[key]; exists && meta.Timestamp.Before(current.Timestamp) {
+		return false
+	}
+
+	fs.setProperty(key, value, meta)
+	return true
+}
+
+// GetPropertyMetadata returns the metadata of a property
+func (fs *FeatureState) GetPropertyMetadata(key string) (PropertyMetadata, bool) {
+	fs.mutex.RLock()
+	defer fs.mutex.RUnlock()
+
+	meta, exists := fs.Metadata[key]
+	return meta, exists
+}
+
+// SetPropertyStale flags or clears the staleness of the current value of a
+// property. It reports whether the flag changed; properties without a value
+// cannot be flagged. A new value of the property clears the flag.
+func (fs *FeatureState) SetPropertyStale(key string, stale bool) bool {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	meta, exists := fs.Metadata[key]
+	if !exists || meta.Stale == stale {
+		return false
+	}
+
+	meta.Stale = stale
+	fs.Metadata[key] = meta
+	return true
+}
+
+// setProperty sets a property and its metadata; the caller must hold the lock
+func (fs *FeatureState) setProperty(key string, value interface{}, meta PropertyMetadata) {
+	if fs.Metadata == nil {
+		fs.Metadata = make(map[string]PropertyMetadata)
+	}
+
 	fs.Properties[key] = value
-	fs.LastModified = time.Now()
+	fs.Metadata[key] = meta
+	fs.LastModified = fs.now()
 }
 
 // RemoveProperty removes a property
@@ -48,7 +128,8 @@ func (fs *FeatureState) RemoveProperty(key string) {
 	defer fs.mutex.Unlock()
 	
 	delete(fs.Properties, key)
-	fs.LastModified = time.Now()
+	delete(fs.Metadata, key)
+	fs.LastModified = fs.now()
 }
 
 // GetAllProperties returns a copy of all properties
@@ -78,7 +159,7 @@ func (fs *FeatureState) SetDesiredProperty(key string, value interface{}) {
 	defer fs.mutex.Unlock()
 	
 	fs.DesiredProps[key] = value
-	fs.LastModified = time.Now()
+	fs.LastModified = fs.now()
 }
 
 // RemoveDesiredProperty removes a desired property
@@ -87,7 +168,7 @@ func (fs *FeatureState) RemoveDesiredProperty(key string) {
 	defer fs.mutex.Unlock()
 	
 	delete(fs.DesiredProps, key)
-	fs.LastModified = time.Now()
+	fs.LastModified = fs.now()
 }
 
 // GetAllDesiredProperties returns a copy of all desired properties
@@ -109,7 +190,7 @@ func (fs *FeatureState) SetDefinition(definitions []string) {
 	
 	fs.Definition = make([]string, len(definitions))
 	copy(fs.Definition, definitions)
-	fs.LastModified = time.Now()
+	fs.LastModified = fs.now()
 }
 
 // GetDefinition returns a copy of the definition identifiers
@@ -121,3 +202,36 @@ func (fs *FeatureState) GetDefinition() []string {
 	copy(definitions, fs.Definition)
 	return definitions
 }
+
+// GetCreatedBy returns the principal that created the feature
+func (fs *FeatureState) GetCreatedBy() string {
+	fs.mutex.RLock()
+	defer fs.mutex.RUnlock()
+
+	return fs.CreatedBy
+}
+
+// SetCreatedBy records the principal that created the feature
+func (fs *FeatureState) SetCreatedBy(principal string) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	fs.CreatedBy = principal
+}
+
+// GetModifiedBy returns the principal that last modified the feature
+func (fs *FeatureState) GetModifiedBy() string {
+	fs.mutex.RLock()
+	defer fs.mutex.RUnlock()
+
+	return fs.ModifiedBy
+}
+
+// SetModifiedBy records the principal that last modified the feature; an
+// empty principal records that it is unknown
+func (fs *FeatureState) SetModifiedBy(principal string) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	fs.ModifiedBy = principal
+}
@@ -3,6 +3,7 @@ package twin
 import (
 	"fmt"
 	"testing"
+	"time"
 )
 
 func TestFeatureStateCreation(t *testing.T) {
@@ -123,6 +124,56 @@ func TestFeatureStateDefinition(t *testing.T) {
 	}
 }
 
+func TestFeatureStatePropertyTimestamps(t *testing.T) {
+	fs := NewFeatureState()
+	now := time.Now()
+
+	fs.SetPropertyAt("temperature", 21.0, now)
+
+	meta, exists := fs.GetPropertyMetadata("temperature")
+	if !exists || !meta.Timestamp.Equal(now) {
+		t.Errorf("Expected timestamp %v, got %v", now, meta.Timestamp)
+	}
+
+	if meta.ServerTimestamp.IsZero() {
+		t.Error("Expected server timestamp to be set")
+	}
+
+	// Older values do not replace newer ones
+	if fs.SetPropertyIfNewer("temperature", 19.0, PropertyMetadata{Timestamp: now.Add(-time.Minute)}) {
+		t.Error("Expected older value to be rejected")
+	}
+
+	if val, _ := fs.GetProperty("temperature"); val != 21.0 {
+		t.Errorf("Expected temperature to remain 21.0, got %v", val)
+	}
+
+	// Newer values do
+	device := now.Add(time.Minute)
+	if !fs.SetPropertyIfNewer("temperature", 22.0, PropertyMetadata{Timestamp: device, DeviceTimestamp: device, ServerTimestamp: now}) {
+		t.Error("Expected newer value to be accepted")
+	}
+
+	if val, _ := fs.GetProperty("temperature"); val != 22.0 {
+		t.Errorf("Expected temperature to be 22.0, got %v", val)
+	}
+
+	if meta, _ := fs.GetPropertyMetadata("temperature"); !meta.DeviceTimestamp.Equal(device) || !meta.ServerTimestamp.Equal(now) {
+		t.Errorf("Expected device and server timestamps to be stored, got %+v", meta)
+	}
+
+	// Values for new properties are always accepted
+	if !fs.SetPropertyIfNewer("humidity", 40, PropertyMetadata{}) {
+		t.Error("Expected value for a new property to be accepted")
+	}
+
+	// Removing a property removes its metadata
+	fs.RemoveProperty("temperature")
+	if _, exists := fs.GetPropertyMetadata("temperature"); exists {
+		t.Error("Expected metadata to be removed with the property")
+	}
+}
+
 func TestFeatureStateConcurrency(t *testing.T) {
 	fs := NewFeatureState()
 	
@@ -166,3 +217,28 @@ func TestFeatureStateConcurrency(t *testing.T) {
 		t.Errorf("Expected 10 properties, got %d", len(props))
 	}
 }
+
+func TestFeatureStatePropertyStale(t *testing.T) {
+	fs := NewFeatureState()
+
+	if fs.SetPropertyStale("temperature", true) {
+		t.Error("Expected properties without a value not to be flagged")
+	}
+
+	fs.SetProperty("temperature", 21.0)
+	if !fs.SetPropertyStale("temperature", true) {
+		t.Error("Expected the property to be flagged")
+	}
+	if fs.SetPropertyStale("temperature", true) {
+		t.Error("Expected flagging again not to change the flag")
+	}
+	if meta, _ := fs.GetPropertyMetadata("temperature"); !meta.Stale {
+		t.Error("Expected the metadata to be flagged stale")
+	}
+
+	// A new value clears the flag
+	fs.SetProperty("temperature", 22.0)
+	if meta, _ := fs.GetPropertyMetadata("temperature"); meta.Stale {
+		t.Error("Expected a new value to clear the stale flag")
+	}
+}
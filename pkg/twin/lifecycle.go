@@ -0,0 +1,68 @@
+package twin
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidTransition is returned for lifecycle transitions that are not allowed
+var ErrInvalidTransition = errors.New("invalid lifecycle transition")
+
+// LifecycleState is the provisioning state of a digital twin
+type LifecycleState string
+
+// Lifecycle states
+const (
+	LifecycleProvisioned    LifecycleState = "provisioned"    // Created but not yet in service
+	LifecycleActive         LifecycleState = "active"         // In service
+	LifecycleDecommissioned LifecycleState = "decommissioned" // Permanently out of service
+)
+
+// transitions lists the states each lifecycle state may move to
+var transitions = map[LifecycleState][]LifecycleState{
+	LifecycleProvisioned: {LifecycleActive, LifecycleDecommissioned},
+	LifecycleActive:      {LifecycleDecommissioned},
+}
+
+// ParseLifecycleState validates a lifecycle state name
+func ParseLifecycleState(s string) (LifecycleState, error) {
+	switch state := LifecycleState(s); state {
+	case LifecycleProvisioned, LifecycleActive, LifecycleDecommissioned:
+		return state, nil
+	}
+	return "", fmt.Errorf("%w: unknown lifecycle state %q", ErrInvalidTransition, s)
+}
+
+// GetLifecycle returns the lifecycle state of the digital twin
+func (dt *DigitalTwin) GetLifecycle() LifecycleState {
+	dt.mutex.RLock()
+	defer dt.mutex.RUnlock()
+
+	if dt.Lifecycle == "" {
+		return LifecycleProvisioned
+	}
+	return dt.Lifecycle
+}
+
+// SetLifecycle moves the digital twin to a new lifecycle state.
+// Twins can be activated once and decommissioned from any state but decommissioned.
+func (dt *DigitalTwin) SetLifecycle(state LifecycleState) error {
+	dt.mutex.Lock()
+	defer dt.mutex.Unlock()
+
+	current := dt.Lifecycle
+	if current == "" {
+		current = LifecycleProvisioned
+	}
+
+	for _, next := range transitions[current] {
+		if next == state {
+			dt.Lifecycle = state
+			dt.setSystem(SystemLifecycle, string(state))
+			dt.ModifiedAt = dt.now()
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s to %s", ErrInvalidTransition, current, state)
+}
@@ -0,0 +1,35 @@
+package twin
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLifecycle(t *testing.T) {
+	dt := NewDigitalTwin("pump-1", "pump")
+
+	if state := dt.GetLifecycle(); state != LifecycleProvisioned {
+		t.Errorf("Expected new twin to be provisioned, got %s", state)
+	}
+
+	if err := dt.SetLifecycle(LifecycleActive); err != nil {
+		t.Fatalf("Failed to activate twin: %v", err)
+	}
+
+	if err := dt.SetLifecycle(LifecycleActive); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("Expected ErrInvalidTransition for repeated activation, got %v", err)
+	}
+
+	if err := dt.SetLifecycle(LifecycleDecommissioned); err != nil {
+		t.Fatalf("Failed to decommission twin: %v", err)
+	}
+
+	// Decommissioned is final
+	if err := dt.SetLifecycle(LifecycleActive); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("Expected ErrInvalidTransition after decommissioning, got %v", err)
+	}
+
+	if _, err := ParseLifecycleState("retired"); err == nil {
+		t.Error("Expected error for unknown lifecycle state")
+	}
+}
@@ -0,0 +1,190 @@
+package twin
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidPath is returned for property paths that are malformed or that
+// lead through a value which is neither an object nor an array
+var ErrInvalidPath = errors.New("invalid property path")
+
+// pathEscaper and pathUnescaper escape keys in paths as JSON pointers do
+var (
+	pathEscaper   = strings.NewReplacer("~", "~0", "/", "~1")
+	pathUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+)
+
+// ParsePath splits a slash-separated path into a nested value, such as
+// network/ip, into its keys. As in JSON pointers, "~1" stands for a slash
+// and "~0" for a tilde within a key, and numeric keys index arrays.
+func ParsePath(path string) ([]string, error) {
+	path = strings.TrimPrefix(path, "/")
+	if path == "" {
+		return nil, nil
+	}
+
+	keys := strings.Split(path, "/")
+	for i, key := range keys {
+		if key == "" {
+			return nil, fmt.Errorf("%w: empty key in %q", ErrInvalidPath, path)
+		}
+		if strings.Contains(strings.NewReplacer("~0", "", "~1", "").Replace(key), "~") {
+			return nil, fmt.Errorf("%w: invalid escape in %q", ErrInvalidPath, key)
+		}
+		keys[i] = pathUnescaper.Replace(key)
+	}
+	return keys, nil
+}
+
+// FormatPath joins keys into a path, escaping them
+func FormatPath(keys []string) string {
+	escaped := make([]string, len(keys))
+	for i, key := range keys {
+		escaped[i] = pathEscaper.Replace(key)
+	}
+	return strings.Join(escaped, "/")
+}
+
+// ValueAt returns the value at a path of keys below a value
+func ValueAt(value interface{}, keys []string) (interface{}, bool) {
+	for _, key := range keys {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			next, exists := v[key]
+			if !exists {
+				return nil, false
+			}
+			value = next
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			value = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// WithValueAt returns a copy of a value with the value at a path of keys
+// set. Missing objects along the path are created, and an array index of
+// "-" or of the length of the array appends. The objects and arrays along
+// the path are copied rather than changed, since property values are
+// shared with history and clones.
+func WithValueAt(value interface{}, keys []string, set interface{}) (interface{}, error) {
+	if len(keys) == 0 {
+		return set, nil
+	}
+	key := keys[0]
+
+	switch v := value.(type) {
+	case nil:
+		child, err := WithValueAt(nil, keys[1:], set)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{key: child}, nil
+	case map[string]interface{}:
+		child, err := WithValueAt(v[key], keys[1:], set)
+		if err != nil {
+			return nil, err
+		}
+		c := make(map[string]interface{}, len(v)+1)
+		for k, item := range v {
+			c[k] = item
+		}
+		c[key] = child
+		return c, nil
+	case []interface{}:
+		i, err := arrayIndex(key, len(v))
+		if err != nil {
+			return nil, err
+		}
+		var current interface{}
+		if i < len(v) {
+			current = v[i]
+		}
+		child, err := WithValueAt(current, keys[1:], set)
+		if err != nil {
+			return nil, err
+		}
+		c := make([]interface{}, len(v), len(v)+1)
+		copy(c, v)
+		if i == len(v) {
+			return append(c, child), nil
+		}
+		c[i] = child
+		return c, nil
+	default:
+		return nil, fmt.Errorf("%w: %q is below a value that is neither an object nor an array", ErrInvalidPath, key)
+	}
+}
+
+// WithoutValueAt returns a copy of a value without the value at a path of
+// keys, removing array elements. It returns false if there is no value at
+// the path.
+func WithoutValueAt(value interface{}, keys []string) (interface{}, bool) {
+	if len(keys) == 0 {
+		return nil, false
+	}
+	key := keys[0]
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		current, exists := v[key]
+		if !exists {
+			return nil, false
+		}
+		c := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			c[k] = item
+		}
+		if len(keys) == 1 {
+			delete(c, key)
+			return c, true
+		}
+		child, ok := WithoutValueAt(current, keys[1:])
+		if !ok {
+			return nil, false
+		}
+		c[key] = child
+		return c, true
+	case []interface{}:
+		i, err := strconv.Atoi(key)
+		if err != nil || i < 0 || i >= len(v) {
+			return nil, false
+		}
+		if len(keys) == 1 {
+			c := make([]interface{}, 0, len(v)-1)
+			return append(append(c, v[:i]...), v[i+1:]...), true
+		}
+		child, ok := WithoutValueAt(v[i], keys[1:])
+		if !ok {
+			return nil, false
+		}
+		c := make([]interface{}, len(v))
+		copy(c, v)
+		c[i] = child
+		return c, true
+	default:
+		return nil, false
+	}
+}
+
+// arrayIndex parses an array index for setting a value, where "-" and the
+// length of the array append
+func arrayIndex(key string, length int) (int, error) {
+	if key == "-" {
+		return length, nil
+	}
+	i, err := strconv.Atoi(key)
+	if err != nil || i < 0 || i > length {
+		return 0, fmt.Errorf("%w: %q is not an index of an array of %d elements", ErrInvalidPath, key, length)
+	}
+	return i, nil
+}
@@ -0,0 +1,140 @@
+package twin
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParsePath(t *testing.T) {
+	for _, tc := range []struct {
+		path string
+		keys []string
+		err  bool
+	}{
+		{"", nil, false},
+		{"network/ip", []string{"network", "ip"}, false},
+		{"/network/ip", []string{"network", "ip"}, false},
+		{"a~1b/c~0d", []string{"a/b", "c~d"}, false},
+		{"network//ip", nil, true},
+		{"network/", nil, true},
+		{"a~2b", nil, true},
+	} {
+		keys, err := ParsePath(tc.path)
+		if tc.err {
+			if !errors.Is(err, ErrInvalidPath) {
+				t.Errorf("%q: expected ErrInvalidPath, got %v", tc.path, err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(keys, tc.keys) {
+			t.Errorf("%q: expected %q, got %q %v", tc.path, tc.keys, keys, err)
+		}
+		if path := FormatPath(keys); path != tc.path && "/"+path != tc.path {
+			t.Errorf("%q: formatted as %q", tc.path, path)
+		}
+	}
+}
+
+func TestValueAt(t *testing.T) {
+	config := map[string]interface{}{
+		"network": map[string]interface{}{"ip": "10.0.0.2"},
+		"ports":   []interface{}{80.0, 443.0},
+	}
+
+	for _, tc := range []struct {
+		path  []string
+		value interface{}
+		ok    bool
+	}{
+		{nil, config, true},
+		{[]string{"network", "ip"}, "10.0.0.2", true},
+		{[]string{"ports", "1"}, 443.0, true},
+		{[]string{"ports", "2"}, nil, false},
+		{[]string{"network", "mask"}, nil, false},
+		{[]string{"network", "ip", "octet"}, nil, false},
+	} {
+		value, ok := ValueAt(config, tc.path)
+		if ok != tc.ok || (ok && !reflect.DeepEqual(value, tc.value)) {
+			t.Errorf("%q: expected %v %v, got %v %v", tc.path, tc.value, tc.ok, value, ok)
+		}
+	}
+}
+
+func TestWithValueAt(t *testing.T) {
+	config := map[string]interface{}{
+		"network": map[string]interface{}{"ip": "10.0.0.2"},
+		"ports":   []interface{}{80.0},
+	}
+
+	updated, err := WithValueAt(config, []string{"network", "ip"}, "10.0.0.3")
+	if err != nil {
+		t.Fatalf("Failed to set value: %v", err)
+	}
+	if ip, _ := ValueAt(updated, []string{"network", "ip"}); ip != "10.0.0.3" {
+		t.Errorf("Expected ip 10.0.0.3, got %v", ip)
+	}
+	// The original value is not changed
+	if ip, _ := ValueAt(config, []string{"network", "ip"}); ip != "10.0.0.2" {
+		t.Errorf("Expected the original ip to remain, got %v", ip)
+	}
+
+	// Missing objects are created and arrays appended to
+	updated, err = WithValueAt(updated, []string{"wifi", "ssid"}, "plant")
+	if err != nil {
+		t.Fatalf("Failed to create objects: %v", err)
+	}
+	updated, err = WithValueAt(updated, []string{"ports", "-"}, 443.0)
+	if err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+	expected := map[string]interface{}{
+		"network": map[string]interface{}{"ip": "10.0.0.3"},
+		"ports":   []interface{}{80.0, 443.0},
+		"wifi":    map[string]interface{}{"ssid": "plant"},
+	}
+	if !reflect.DeepEqual(updated, expected) {
+		t.Errorf("Expected %v, got %v", expected, updated)
+	}
+	if ports := config["ports"].([]interface{}); len(ports) != 1 {
+		t.Errorf("Expected the original ports to remain, got %v", ports)
+	}
+
+	for _, path := range [][]string{{"ports", "5"}, {"ports", "x"}, {"network", "ip", "octet"}} {
+		if _, err := WithValueAt(config, path, 1.0); !errors.Is(err, ErrInvalidPath) {
+			t.Errorf("%q: expected ErrInvalidPath, got %v", path, err)
+		}
+	}
+}
+
+func TestWithoutValueAt(t *testing.T) {
+	config := map[string]interface{}{
+		"network": map[string]interface{}{"ip": "10.0.0.2", "mask": "255.0.0.0"},
+		"ports":   []interface{}{80.0, 443.0},
+	}
+
+	updated, ok := WithoutValueAt(config, []string{"network", "mask"})
+	if !ok {
+		t.Fatal("Expected the mask to be removed")
+	}
+	updated, ok = WithoutValueAt(updated, []string{"ports", "0"})
+	if !ok {
+		t.Fatal("Expected the port to be removed")
+	}
+	expected := map[string]interface{}{
+		"network": map[string]interface{}{"ip": "10.0.0.2"},
+		"ports":   []interface{}{443.0},
+	}
+	if !reflect.DeepEqual(updated, expected) {
+		t.Errorf("Expected %v, got %v", expected, updated)
+	}
+	if _, exists := config["network"].(map[string]interface{})["mask"]; !exists {
+		t.Error("Expected the original mask to remain")
+	}
+
+	for _, path := range [][]string{nil, {"gateway"}, {"ports", "2"}, {"network", "ip", "octet"}} {
+		if _, ok := WithoutValueAt(config, path); ok {
+			t.Errorf("%q: expected nothing to remove", path)
+		}
+	}
+}
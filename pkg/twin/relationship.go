@@ -0,0 +1,112 @@
+package twin
+
+import (
+	"errors"
+	"sort"
+)
+
+// Relationship errors
+var (
+	ErrRelationshipNotFound = errors.New("relationship not found")
+	ErrInvalidRelationship  = errors.New("invalid relationship")
+)
+
+// AddRelationship links the digital twin to a target twin under a relationship name.
+// Adding an existing link has no effect.
+func (dt *DigitalTwin) AddRelationship(name, targetID string) error {
+	if name == "" || targetID == "" {
+		return ErrInvalidRelationship
+	}
+
+	dt.mutex.Lock()
+	defer dt.mutex.Unlock()
+
+	for _, id := range dt.Relationships[name] {
+		if id == targetID {
+			return nil
+		}
+	}
+
+	if dt.Relationships == nil {
+		dt.Relationships = make(map[string][]string)
+	}
+	dt.Relationships[name] = append(dt.Relationships[name], targetID)
+	sort.Strings(dt.Relationships[name])
+	dt.ModifiedAt = dt.now()
+	return nil
+}
+
+// SetRelationship replaces all targets of a relationship. No targets removes the relationship.
+func (dt *DigitalTwin) SetRelationship(name string, targetIDs []string) error {
+	if name == "" {
+		return ErrInvalidRelationship
+	}
+
+	targets := make([]string, 0, len(targetIDs))
+	seen := make(map[string]bool, len(targetIDs))
+	for _, id := range targetIDs {
+		if id == "" {
+			return ErrInvalidRelationship
+		}
+		if !seen[id] {
+			seen[id] = true
+			targets = append(targets, id)
+		}
+	}
+	sort.Strings(targets)
+
+	dt.mutex.Lock()
+	defer dt.mutex.Unlock()
+
+	if len(targets) == 0 {
+		delete(dt.Relationships, name)
+	} else {
+		if dt.Relationships == nil {
+			dt.Relationships = make(map[string][]string)
+		}
+		dt.Relationships[name] = targets
+	}
+	dt.ModifiedAt = dt.now()
+	return nil
+}
+
+// RemoveRelationship removes the link to a target twin
+func (dt *DigitalTwin) RemoveRelationship(name, targetID string) error {
+	dt.mutex.Lock()
+	defer dt.mutex.Unlock()
+
+	targets := dt.Relationships[name]
+	for i, id := range targets {
+		if id == targetID {
+			targets = append(targets[:i:i], targets[i+1:]...)
+			if len(targets) == 0 {
+				delete(dt.Relationships, name)
+			} else {
+				dt.Relationships[name] = targets
+			}
+			dt.ModifiedAt = dt.now()
+			return nil
+		}
+	}
+	return ErrRelationshipNotFound
+}
+
+// GetRelationship returns the sorted target twin IDs of a relationship
+func (dt *DigitalTwin) GetRelationship(name string) []string {
+	dt.mutex.RLock()
+	defer dt.mutex.RUnlock()
+
+	return append([]string(nil), dt.Relationships[name]...)
+}
+
+// GetAllRelationships returns a copy of all relationships
+func (dt *DigitalTwin) GetAllRelationships() map[string][]string {
+	dt.mutex.RLock()
+	defer dt.mutex.RUnlock()
+
+	relationships := make(map[string][]string, len(dt.Relationships))
+	for name, targets := range dt.Relationships {
+		relationships[name] = append([]string(nil), targets...)
+	}
+	return relationships
+}
@@ -0,0 +1,46 @@
+package twin
+
+import "testing"
+
+func TestRelationships(t *testing.T) {
+	dt := NewDigitalTwin("building-1", "building")
+
+	if err := dt.AddRelationship("contains", "floor-2"); err != nil {
+		t.Fatalf("Failed to add relationship: %v", err)
+	}
+	dt.AddRelationship("contains", "floor-1")
+	dt.AddRelationship("contains", "floor-1")
+
+	targets := dt.GetRelationship("contains")
+	if len(targets) != 2 || targets[0] != "floor-1" || targets[1] != "floor-2" {
+		t.Errorf("Expected sorted unique targets [floor-1 floor-2], got %v", targets)
+	}
+
+	if err := dt.AddRelationship("", "floor-3"); err != ErrInvalidRelationship {
+		t.Errorf("Expected ErrInvalidRelationship, got %v", err)
+	}
+
+	if err := dt.RemoveRelationship("contains", "floor-1"); err != nil {
+		t.Errorf("Failed to remove relationship: %v", err)
+	}
+	if err := dt.RemoveRelationship("contains", "floor-1"); err != ErrRelationshipNotFound {
+		t.Errorf("Expected ErrRelationshipNotFound, got %v", err)
+	}
+
+	// The copy does not share state with the twin
+	all := dt.GetAllRelationships()
+	all["contains"][0] = "changed"
+	if dt.GetRelationship("contains")[0] != "floor-2" {
+		t.Error("Expected GetAllRelationships to return a copy")
+	}
+
+	dt.SetRelationship("contains", []string{"b", "a", "a"})
+	if targets := dt.GetRelationship("contains"); len(targets) != 2 || targets[0] != "a" {
+		t.Errorf("Expected [a b], got %v", targets)
+	}
+
+	dt.SetRelationship("contains", nil)
+	if len(dt.GetAllRelationships()) != 0 {
+		t.Errorf("Expected relationship to be removed, got %v", dt.GetAllRelationships())
+	}
+}
@@ -0,0 +1,187 @@
+package twin
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+)
+
+// ErrInvalidScene is returned for scene references that frontends could not resolve
+var ErrInvalidScene = errors.New("invalid scene reference")
+
+// Transform places a node relative to its parent, using the translation,
+// rotation and scale conventions of glTF: meters, a unit quaternion
+// [x, y, z, w] and per-axis factors. Missing parts are the identity.
+type Transform struct {
+	Translation []float64 `json:"translation,omitempty"` // [x, y, z]
+	Rotation    []float64 `json:"rotation,omitempty"`    // [x, y, z, w]
+	Scale       []float64 `json:"scale,omitempty"`       // [x, y, z]
+}
+
+// NodeBinding maps a feature to a node of the twin's 3D model
+type NodeBinding struct {
+	Node      string     `json:"node"`                // Name of the node in the model
+	Transform *Transform `json:"transform,omitempty"` // Optional offset from the node
+}
+
+// SceneReference links a twin to a 3D asset so that visualization frontends
+// can bind its live data to geometry
+type SceneReference struct {
+	Model     string                  `json:"model"`               // URL of a glTF or GLB asset
+	Node      string                  `json:"node,omitempty"`      // Node of the twin in the model, the root when empty
+	Transform *Transform              `json:"transform,omitempty"` // Placement of the model in the scene
+	Features  map[string]*NodeBinding `json:"features,omitempty"`  // Feature ID -> node
+}
+
+// Validate checks that the model is an http(s) URL or an absolute path, that
+// every feature is bound to a node and that transforms are well-formed
+func (s *SceneReference) Validate() error {
+	if s == nil {
+		return nil
+	}
+
+	u, err := url.Parse(s.Model)
+	if err != nil || s.Model == "" {
+		return fmt.Errorf("%w: model must be a URL", ErrInvalidScene)
+	}
+	if u.Scheme == "" && (u.Host != "" || len(u.Path) == 0 || u.Path[0] != '/') {
+		return fmt.Errorf("%w: model must be an absolute URL or path", ErrInvalidScene)
+	}
+	if u.Scheme != "" && u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: unsupported model URL scheme %q", ErrInvalidScene, u.Scheme)
+	}
+	if err := s.Transform.validate(); err != nil {
+		return err
+	}
+
+	for id, b := range s.Features {
+		if id == "" || b == nil || b.Node == "" {
+			return fmt.Errorf("%w: feature %q must be bound to a node", ErrInvalidScene, id)
+		}
+		if err := b.Transform.validate(); err != nil {
+			return fmt.Errorf("%w (feature %s)", err, id)
+		}
+	}
+	return nil
+}
+
+// validate checks the lengths of the transform's vectors and that the
+// rotation is a non-zero quaternion
+func (t *Transform) validate() error {
+	if t == nil {
+		return nil
+	}
+
+	for _, part := range []struct {
+		name   string
+		values []float64
+		length int
+	}{
+		{"translation", t.Translation, 3},
+		{"rotation", t.Rotation, 4},
+		{"scale", t.Scale, 3},
+	} {
+		if part.values == nil {
+			continue
+		}
+		if len(part.values) != part.length {
+			return fmt.Errorf("%w: %s must have %d components", ErrInvalidScene, part.name, part.length)
+		}
+		for _, v := range part.values {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				return fmt.Errorf("%w: %s must be finite", ErrInvalidScene, part.name)
+			}
+		}
+	}
+
+	if t.Rotation != nil {
+		r := t.Rotation
+		if r[0]*r[0]+r[1]*r[1]+r[2]*r[2]+r[3]*r[3] == 0 {
+			return fmt.Errorf("%w: rotation must not be zero", ErrInvalidScene)
+		}
+	}
+	return nil
+}
+
+// Matrix returns the transform as a 4x4 matrix in column-major order, as
+// used by glTF, Three.js and Unity. The rotation is normalized; a nil
+// transform is the identity.
+func (t *Transform) Matrix() [16]float64 {
+	tx, ty, tz := 0.0, 0.0, 0.0
+	x, y, z, w := 0.0, 0.0, 0.0, 1.0
+	sx, sy, sz := 1.0, 1.0, 1.0
+
+	if t != nil {
+		if len(t.Translation) == 3 {
+			tx, ty, tz = t.Translation[0], t.Translation[1], t.Translation[2]
+		}
+		if len(t.Rotation) == 4 {
+			n := math.Sqrt(t.Rotation[0]*t.Rotation[0] + t.Rotation[1]*t.Rotation[1] + t.Rotation[2]*t.Rotation[2] + t.Rotation[3]*t.Rotation[3])
+			if n > 0 {
+				x, y, z, w = t.Rotation[0]/n, t.Rotation[1]/n, t.Rotation[2]/n, t.Rotation[3]/n
+			}
+		}
+		if len(t.Scale) == 3 {
+			sx, sy, sz = t.Scale[0], t.Scale[1], t.Scale[2]
+		}
+	}
+
+	return [16]float64{
+		(1 - 2*(y*y+z*z)) * sx, 2 * (x*y + z*w) * sx, 2 * (x*z - y*w) * sx, 0,
+		2 * (x*y - z*w) * sy, (1 - 2*(x*x+z*z)) * sy, 2 * (y*z + x*w) * sy, 0,
+		2 * (x*z + y*w) * sz, 2 * (y*z - x*w) * sz, (1 - 2*(x*x+y*y)) * sz, 0,
+		tx, ty, tz, 1,
+	}
+}
+
+// copy returns a deep copy of the transform
+func (t *Transform) copy() *Transform {
+	if t == nil {
+		return nil
+	}
+	return &Transform{
+		Translation: append([]float64(nil), t.Translation...),
+		Rotation:    append([]float64(nil), t.Rotation...),
+		Scale:       append([]float64(nil), t.Scale...),
+	}
+}
+
+// copy returns a deep copy of the scene reference
+func (s *SceneReference) copy() *SceneReference {
+	if s == nil {
+		return nil
+	}
+
+	c := &SceneReference{
+		Model:     s.Model,
+		Node:      s.Node,
+		Transform: s.Transform.copy(),
+	}
+	if s.Features != nil {
+		c.Features = make(map[string]*NodeBinding, len(s.Features))
+		for id, b := range s.Features {
+			if b != nil {
+				c.Features[id] = &NodeBinding{Node: b.Node, Transform: b.Transform.copy()}
+			}
+		}
+	}
+	return c
+}
+
+// GetScene returns a copy of the scene reference of the digital twin, or nil if it has none
+func (dt *DigitalTwin) GetScene() *SceneReference {
+	dt.mutex.RLock()
+	defer dt.mutex.RUnlock()
+
+	return dt.Scene.copy()
+}
+
+// SetScene sets the scene reference of the digital twin. A nil reference removes it.
+func (dt *DigitalTwin) SetScene(s *SceneReference) {
+	dt.mutex.Lock()
+	defer dt.mutex.Unlock()
+
+	dt.Scene = s.copy()
+	dt.ModifiedAt = dt.now()
+}
@@ -0,0 +1,92 @@
+package twin
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestScene(t *testing.T) {
+	dt := NewDigitalTwin("robot-1", "robot")
+
+	if dt.GetScene() != nil {
+		t.Error("Expected new twin to have no scene")
+	}
+
+	scene := &SceneReference{
+		Model:     "https://assets.example.com/robot.glb",
+		Transform: &Transform{Translation: []float64{1, 0, 2}},
+		Features:  map[string]*NodeBinding{"arm": {Node: "Arm_01"}},
+	}
+	dt.SetScene(scene)
+
+	// The twin keeps its own copy
+	scene.Transform.Translation[0] = 5
+	scene.Features["arm"].Node = "changed"
+
+	got := dt.GetScene()
+	if got.Transform.Translation[0] != 1 || got.Features["arm"].Node != "Arm_01" {
+		t.Errorf("Expected scene to be copied, got %+v", got)
+	}
+	if c := dt.Clone(); c.Scene == nil || c.Scene.Model != scene.Model {
+		t.Errorf("Expected clone to keep the scene, got %+v", c.Scene)
+	}
+
+	dt.SetScene(nil)
+	if dt.GetScene() != nil {
+		t.Error("Expected scene to be removed")
+	}
+}
+
+func TestSceneValidate(t *testing.T) {
+	valid := []*SceneReference{
+		nil,
+		{Model: "https://assets.example.com/robot.gltf"},
+		{Model: "/api/v1/twins/robot-1/attachments/0123456789abcdef/content", Node: "Robot"},
+		{Model: "http://cdn/robot.glb", Transform: &Transform{Rotation: []float64{0, 0.7071, 0, 0.7071}, Scale: []float64{2, 2, 2}}},
+	}
+	for _, s := range valid {
+		if err := s.Validate(); err != nil {
+			t.Errorf("Expected %+v to be valid, got %v", s, err)
+		}
+	}
+
+	invalid := []*SceneReference{
+		{},
+		{Model: "robot.glb"},
+		{Model: "//cdn/robot.glb"},
+		{Model: "file:///etc/robot.glb"},
+		{Model: "https://cdn/robot.glb", Transform: &Transform{Translation: []float64{1, 2}}},
+		{Model: "https://cdn/robot.glb", Transform: &Transform{Rotation: []float64{0, 0, 0, 0}}},
+		{Model: "https://cdn/robot.glb", Transform: &Transform{Scale: []float64{1, math.NaN(), 1}}},
+		{Model: "https://cdn/robot.glb", Features: map[string]*NodeBinding{"arm": {}}},
+		{Model: "https://cdn/robot.glb", Features: map[string]*NodeBinding{"arm": {Node: "Arm", Transform: &Transform{Scale: []float64{1}}}}},
+	}
+	for _, s := range invalid {
+		if err := s.Validate(); !errors.Is(err, ErrInvalidScene) {
+			t.Errorf("Expected %+v to be invalid, got %v", s, err)
+		}
+	}
+}
+
+func TestTransformMatrix(t *testing.T) {
+	var identity *Transform
+	if m := identity.Matrix(); m != [16]float64{1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1} {
+		t.Errorf("Expected the identity, got %v", m)
+	}
+
+	// A quarter turn about Y, given unnormalized, maps X to -Z
+	s := math.Sqrt(0.5)
+	m := (&Transform{
+		Translation: []float64{1, 2, 3},
+		Rotation:    []float64{0, 2 * s, 0, 2 * s},
+		Scale:       []float64{2, 1, 1},
+	}).Matrix()
+
+	expected := [16]float64{0, 0, -2, 0, 0, 1, 0, 0, 1, 0, 0, 0, 1, 2, 3, 1}
+	for i := range expected {
+		if math.Abs(m[i]-expected[i]) > 1e-9 {
+			t.Fatalf("Expected %v, got %v", expected, m)
+		}
+	}
+}
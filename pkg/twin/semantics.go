@@ -0,0 +1,57 @@
+package twin
+
+// SemanticAnnotation links a twin or feature to semantic-web vocabularies such as SAREF or Brick
+type SemanticAnnotation struct {
+	Context map[string]string `json:"context,omitempty"` // Prefix -> namespace IRI
+	Types   []string          `json:"types,omitempty"`   // Compact (brick:AHU) or absolute type IRIs
+}
+
+// copy returns a deep copy of the annotation
+func (a *SemanticAnnotation) copy() *SemanticAnnotation {
+	if a == nil {
+		return nil
+	}
+
+	c := &SemanticAnnotation{Types: append([]string(nil), a.Types...)}
+	if a.Context != nil {
+		c.Context = make(map[string]string, len(a.Context))
+		for k, v := range a.Context {
+			c.Context[k] = v
+		}
+	}
+	return c
+}
+
+// GetSemantics returns a copy of the semantic annotation of the digital twin, or nil if it has none
+func (dt *DigitalTwin) GetSemantics() *SemanticAnnotation {
+	dt.mutex.RLock()
+	defer dt.mutex.RUnlock()
+
+	return dt.Semantics.copy()
+}
+
+// SetSemantics sets the semantic annotation of the digital twin. A nil annotation removes it.
+func (dt *DigitalTwin) SetSemantics(a *SemanticAnnotation) {
+	dt.mutex.Lock()
+	defer dt.mutex.Unlock()
+
+	dt.Semantics = a.copy()
+	dt.ModifiedAt = dt.now()
+}
+
+// GetSemantics returns a copy of the semantic annotation of the feature, or nil if it has none
+func (fs *FeatureState) GetSemantics() *SemanticAnnotation {
+	fs.mutex.RLock()
+	defer fs.mutex.RUnlock()
+
+	return fs.Semantics.copy()
+}
+
+// SetSemantics sets the semantic annotation of the feature. A nil annotation removes it.
+func (fs *FeatureState) SetSemantics(a *SemanticAnnotation) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	fs.Semantics = a.copy()
+	fs.LastModified = fs.now()
+}
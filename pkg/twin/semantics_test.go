@@ -0,0 +1,37 @@
+package twin
+
+import "testing"
+
+func TestSemantics(t *testing.T) {
+	dt := NewDigitalTwin("ahu-1", "airHandler")
+
+	if dt.GetSemantics() != nil {
+		t.Error("Expected new twin to have no semantics")
+	}
+
+	annotation := &SemanticAnnotation{
+		Context: map[string]string{"brick": "https://brickschema.org/schema/Brick#"},
+		Types:   []string{"brick:AHU"},
+	}
+	dt.SetSemantics(annotation)
+
+	// The twin keeps its own copy
+	annotation.Types[0] = "brick:Boiler"
+	annotation.Context["brick"] = "changed"
+
+	semantics := dt.GetSemantics()
+	if semantics.Types[0] != "brick:AHU" || semantics.Context["brick"] != "https://brickschema.org/schema/Brick#" {
+		t.Errorf("Expected annotation to be copied, got %+v", semantics)
+	}
+
+	feature := NewFeatureState()
+	feature.SetSemantics(&SemanticAnnotation{Types: []string{"brick:Supply_Air_Temperature_Sensor"}})
+	if semantics := feature.GetSemantics(); len(semantics.Types) != 1 {
+		t.Errorf("Unexpected feature semantics: %+v", semantics)
+	}
+
+	feature.SetSemantics(nil)
+	if feature.GetSemantics() != nil {
+		t.Error("Expected semantics to be removed")
+	}
+}
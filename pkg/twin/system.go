@@ -0,0 +1,81 @@
+package twin
+
+import (
+	"errors"
+	"strings"
+)
+
+// SystemAttribute is the attribute holding the metadata the server keeps
+// about a twin, such as when it was last seen. Only the server writes it;
+// client writes to it, or to attribute keys under it, are rejected so that
+// devices and integrations cannot clobber it.
+const SystemAttribute = "_system"
+
+// Metadata kept under SystemAttribute
+const (
+	SystemLastSeen   = "lastSeen"   // When telemetry was last ingested, RFC 3339
+	SystemLifecycle  = "lifecycle"  // Lifecycle state
+	SystemOwner      = "owner"      // Principal owning the twin
+	SystemSource     = "source"     // Where the twin was created, such as api, sync or federation
+	SystemCreatedBy  = "createdBy"  // Principal that created the twin through the API
+	SystemModifiedBy = "modifiedBy" // Principal that last changed the twin through the API
+)
+
+// ErrReservedAttribute is returned for client writes to system attributes
+var ErrReservedAttribute = errors.New("attribute " + SystemAttribute + " is reserved for the server")
+
+// IsReservedAttribute reports whether an attribute key is in the system namespace
+func IsReservedAttribute(key string) bool {
+	return key == SystemAttribute || strings.HasPrefix(key, SystemAttribute+".")
+}
+
+// CheckAttributes returns ErrReservedAttribute if attributes written by a
+// client include system attributes
+func CheckAttributes(attributes map[string]interface{}) error {
+	for key := range attributes {
+		if IsReservedAttribute(key) {
+			return ErrReservedAttribute
+		}
+	}
+	return nil
+}
+
+// GetSystem returns system metadata of the digital twin
+func (dt *DigitalTwin) GetSystem(key string) (interface{}, bool) {
+	dt.mutex.RLock()
+	defer dt.mutex.RUnlock()
+
+	system, _ := dt.Attributes[SystemAttribute].(map[string]interface{})
+	value, exists := system[key]
+	return value, exists
+}
+
+// SetSystem sets system metadata of the digital twin; a nil value removes
+// it. It does not count as a modification of the twin.
+func (dt *DigitalTwin) SetSystem(key string, value interface{}) {
+	dt.mutex.Lock()
+	defer dt.mutex.Unlock()
+
+	dt.setSystem(key, value)
+}
+
+// setSystem sets system metadata; the caller must hold the mutex. Attribute
+// values are shared with copies of the twin, so the metadata is copied
+// rather than changed in place.
+func (dt *DigitalTwin) setSystem(key string, value interface{}) {
+	current, _ := dt.Attributes[SystemAttribute].(map[string]interface{})
+	system := make(map[string]interface{}, len(current)+1)
+	for k, v := range current {
+		system[k] = v
+	}
+	if value == nil {
+		delete(system, key)
+	} else {
+		system[key] = value
+	}
+
+	if dt.Attributes == nil {
+		dt.Attributes = make(map[string]interface{})
+	}
+	dt.Attributes[SystemAttribute] = system
+}
@@ -0,0 +1,42 @@
+package twin
+
+import "testing"
+
+func TestSystemAttributes(t *testing.T) {
+	dt := NewDigitalTwin("pump-1", "pump")
+	modifiedAt := dt.GetModifiedAt()
+
+	dt.SetSystem(SystemSource, "api")
+	clone := dt.Clone()
+	dt.SetSystem(SystemOwner, "ops")
+
+	if v, _ := dt.GetSystem(SystemOwner); v != "ops" {
+		t.Errorf("Expected the owner, got %v", v)
+	}
+	if _, exists := clone.GetSystem(SystemOwner); exists {
+		t.Error("Expected copies of the twin to keep their metadata")
+	}
+	if v, _ := clone.GetSystem(SystemSource); v != "api" {
+		t.Errorf("Expected the source on the copy, got %v", v)
+	}
+	if !dt.GetModifiedAt().Equal(modifiedAt) {
+		t.Error("Expected system metadata not to modify the twin")
+	}
+
+	dt.SetLifecycle(LifecycleActive)
+	if v, _ := dt.GetSystem(SystemLifecycle); v != "active" {
+		t.Errorf("Expected the lifecycle state, got %v", v)
+	}
+
+	for key, reserved := range map[string]bool{"_system": true, "_system.owner": true, "_systems": false, "system": false} {
+		if IsReservedAttribute(key) != reserved {
+			t.Errorf("%s: expected reserved %v", key, reserved)
+		}
+	}
+	if err := CheckAttributes(map[string]interface{}{"site": "north", "_system": nil}); err != ErrReservedAttribute {
+		t.Errorf("Expected ErrReservedAttribute, got %v", err)
+	}
+	if err := CheckAttributes(map[string]interface{}{"site": "north"}); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"errors"
 	"sync"
 	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/clock"
 )
 
 // Common errors
@@ -14,29 +16,31 @@ var (
 	ErrInvalidValue         = errors.New("invalid value")
 )
 
-// DigitalTwin represents a digital representation of a physical entity
+// DigitalTwin represents a digital representation of a physical entity.
+// Its JSON field names are the lowerCamelCase ones the twin handlers have
+// always been tested against (id, type, attributes, features, createdAt and
+// modifiedAt); this is also the representation of the legacy routes.
+// Features are held by pointer since a FeatureState carries its own lock.
 type DigitalTwin struct {
-	ID         string                  // Unique identifier
-	Type       string                  // Type of the twin
-	Definition string                  // Optional definition reference
-	Attributes map[string]interface{}  // General attributes
-	Features   map[string]FeatureState // Features of the twin
-	mutex      sync.RWMutex            // For thread safety
-	CreatedAt  time.Time               // Creation timestamp
-	ModifiedAt time.Time               // Last modification timestamp
+	ID            string                   `json:"id"`                      // Unique identifier
+	Type          string                   `json:"type"`                    // Type of the twin
+	Definition    string                   `json:"definition,omitempty"`    // Optional definition reference
+	Lifecycle     LifecycleState           `json:"lifecycle"`               // Lifecycle state
+	Semantics     *SemanticAnnotation      `json:"semantics,omitempty"`     // Optional semantic types and context
+	Scene         *SceneReference          `json:"scene,omitempty"`         // Optional 3D model reference
+	Attributes    map[string]interface{}   `json:"attributes"`              // General attributes
+	Features      map[string]*FeatureState `json:"features"`                // Features of the twin
+	Relationships map[string][]string      `json:"relationships,omitempty"` // Relationship name -> target twin IDs
+	Revision      uint64                   `json:"revision"`                // Revision committed to the registry
+	mutex         sync.RWMutex             // For thread safety
+	clock         clock.Clock              // Clock times are read from, nil for the system clock
+	CreatedAt     time.Time                `json:"createdAt"`  // Creation timestamp
+	ModifiedAt    time.Time                `json:"modifiedAt"` // Last modification timestamp
 }
 
 // NewDigitalTwin creates a new digital twin with the given ID and type
 func NewDigitalTwin(id, twinType string) *DigitalTwin {
-	now := time.Now()
-	return &DigitalTwin{
-		ID:         id,
-		Type:       twinType,
-		Attributes: make(map[string]interface{}),
-		Features:   make(map[string]FeatureState),
-		CreatedAt:  now,
-		ModifiedAt: now,
-	}
+	return NewDigitalTwinWithClock(id, twinType, nil)
 }
 
 // SetDefinition sets the definition of the digital twin
@@ -45,7 +49,7 @@ func (dt *DigitalTwin) SetDefinition(definition string) {
 	defer dt.mutex.Unlock()
 
 	dt.Definition = definition
-	dt.ModifiedAt = time.Now()
+	dt.ModifiedAt = dt.now()
 }
 
 // GetDefinition returns the definition of the digital twin
@@ -56,6 +60,39 @@ func (dt *DigitalTwin) GetDefinition() string {
 	return dt.Definition
 }
 
+// GetRevision returns the revision of the digital twin
+func (dt *DigitalTwin) GetRevision() uint64 {
+	dt.mutex.RLock()
+	defer dt.mutex.RUnlock()
+
+	return dt.Revision
+}
+
+// SetRevision sets the revision of the digital twin. It is called by the registry when changes are committed.
+func (dt *DigitalTwin) SetRevision(revision uint64) {
+	dt.mutex.Lock()
+	defer dt.mutex.Unlock()
+
+	dt.Revision = revision
+}
+
+// SetModifiedAt sets the last modification time of the digital twin.
+// It is called by the registry when changes are committed.
+func (dt *DigitalTwin) SetModifiedAt(t time.Time) {
+	dt.mutex.Lock()
+	defer dt.mutex.Unlock()
+
+	dt.ModifiedAt = t
+}
+
+// GetModifiedAt returns the last modification time of the digital twin
+func (dt *DigitalTwin) GetModifiedAt() time.Time {
+	dt.mutex.RLock()
+	defer dt.mutex.RUnlock()
+
+	return dt.ModifiedAt
+}
+
 // GetAttribute returns the value of an attribute
 func (dt *DigitalTwin) GetAttribute(key string) (interface{}, bool) {
 	dt.mutex.RLock()
@@ -71,7 +108,7 @@ func (dt *DigitalTwin) SetAttribute(key string, value interface{}) {
 	defer dt.mutex.Unlock()
 
 	dt.Attributes[key] = value
-	dt.ModifiedAt = time.Now()
+	dt.ModifiedAt = dt.now()
 }
 
 // RemoveAttribute removes an attribute
@@ -80,7 +117,7 @@ func (dt *DigitalTwin) RemoveAttribute(key string) {
 	defer dt.mutex.Unlock()
 
 	delete(dt.Attributes, key)
-	dt.ModifiedAt = time.Now()
+	dt.ModifiedAt = dt.now()
 }
 
 // GetAllAttributes returns a copy of all attributes
@@ -96,7 +133,7 @@ func (dt *DigitalTwin) GetAllAttributes() map[string]interface{} {
 }
 
 // GetFeature returns a feature by ID
-func (dt *DigitalTwin) GetFeature(id string) (FeatureState, bool) {
+func (dt *DigitalTwin) GetFeature(id string) (*FeatureState, bool) {
 	dt.mutex.RLock()
 	defer dt.mutex.RUnlock()
 
@@ -105,7 +142,7 @@ func (dt *DigitalTwin) GetFeature(id string) (FeatureState, bool) {
 }
 
 // AddFeature adds a new feature
-func (dt *DigitalTwin) AddFeature(id string, feature FeatureState) error {
+func (dt *DigitalTwin) AddFeature(id string, feature *FeatureState) error {
 	dt.mutex.Lock()
 	defer dt.mutex.Unlock()
 
@@ -113,13 +150,14 @@ func (dt *DigitalTwin) AddFeature(id string, feature FeatureState) error {
 		return ErrFeatureAlreadyExists
 	}
 
+	feature.SetClock(dt.clock)
 	dt.Features[id] = feature
-	dt.ModifiedAt = time.Now()
+	dt.ModifiedAt = dt.now()
 	return nil
 }
 
 // UpdateFeature updates an existing feature
-func (dt *DigitalTwin) UpdateFeature(id string, feature FeatureState) error {
+func (dt *DigitalTwin) UpdateFeature(id string, feature *FeatureState) error {
 	dt.mutex.Lock()
 	defer dt.mutex.Unlock()
 
@@ -127,8 +165,9 @@ func (dt *DigitalTwin) UpdateFeature(id string, feature FeatureState) error {
 		return ErrFeatureNotFound
 	}
 
+	feature.SetClock(dt.clock)
 	dt.Features[id] = feature
-	dt.ModifiedAt = time.Now()
+	dt.ModifiedAt = dt.now()
 	return nil
 }
 
@@ -142,16 +181,16 @@ func (dt *DigitalTwin) RemoveFeature(id string) error {
 	}
 
 	delete(dt.Features, id)
-	dt.ModifiedAt = time.Now()
+	dt.ModifiedAt = dt.now()
 	return nil
 }
 
 // GetAllFeatures returns a copy of all features
-func (dt *DigitalTwin) GetAllFeatures() map[string]FeatureState {
+func (dt *DigitalTwin) GetAllFeatures() map[string]*FeatureState {
 	dt.mutex.RLock()
 	defer dt.mutex.RUnlock()
 
-	features := make(map[string]FeatureState, len(dt.Features))
+	features := make(map[string]*FeatureState, len(dt.Features))
 	for k, v := range dt.Features {
 		features[k] = v
 	}
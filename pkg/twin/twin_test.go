@@ -1,6 +1,7 @@
 package twin
 
 import (
+	"encoding/json"
 	"fmt"
 	"testing"
 )
@@ -86,7 +87,7 @@ func TestDigitalTwinFeatures(t *testing.T) {
 	feature.SetDefinition([]string{"org.example:thermostat:1.0.0"})
 	
 	// Test AddFeature
-	err := dt.AddFeature("temperature", *feature)
+	err := dt.AddFeature("temperature", feature)
 	if err != nil {
 		t.Errorf("Failed to add feature: %v", err)
 	}
@@ -120,7 +121,7 @@ func TestDigitalTwinFeatures(t *testing.T) {
 	updatedFeature.SetProperty("temperature", 24.0)
 	updatedFeature.SetProperty("humidity", 45)
 	
-	err = dt.UpdateFeature("temperature", *updatedFeature)
+	err = dt.UpdateFeature("temperature", updatedFeature)
 	if err != nil {
 		t.Errorf("Failed to update feature: %v", err)
 	}
@@ -138,12 +139,12 @@ func TestDigitalTwinFeatures(t *testing.T) {
 	}
 	
 	// Test error cases
-	err = dt.AddFeature("temperature", *feature)
+	err = dt.AddFeature("temperature", feature)
 	if err != ErrFeatureAlreadyExists {
 		t.Errorf("Expected ErrFeatureAlreadyExists, got %v", err)
 	}
 	
-	err = dt.UpdateFeature("nonexistent", *feature)
+	err = dt.UpdateFeature("nonexistent", feature)
 	if err != ErrFeatureNotFound {
 		t.Errorf("Expected ErrFeatureNotFound, got %v", err)
 	}
@@ -219,3 +220,22 @@ func TestDigitalTwinConcurrency(t *testing.T) {
 		t.Errorf("Expected 10 attributes, got %d", len(attrs))
 	}
 }
+
+func TestDigitalTwinJSON(t *testing.T) {
+	dt := NewDigitalTwin("pump-1", "pump")
+	dt.SetAttribute("site", "north")
+
+	data, err := json.Marshal(dt)
+	if err != nil {
+		t.Fatalf("Failed to marshal twin: %v", err)
+	}
+	var fields map[string]interface{}
+	json.Unmarshal(data, &fields)
+
+	// The legacy routes serve this representation, so the names must not change
+	for _, name := range []string{"id", "type", "attributes", "features", "createdAt", "modifiedAt"} {
+		if _, exists := fields[name]; !exists {
+			t.Errorf("Expected field %s in %s", name, data)
+		}
+	}
+}
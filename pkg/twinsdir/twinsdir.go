@@ -0,0 +1,420 @@
+package twinsdir
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/eventbus"
+	"github.com/aleka07/go-digital-twin/pkg/reconcile"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+	"github.com/aleka07/go-digital-twin/pkg/webhook"
+	"github.com/fsnotify/fsnotify"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrInvalidDefinition is returned for definition files that cannot be parsed
+var ErrInvalidDefinition = errors.New("invalid twin definition")
+
+// DebounceDelay is how long Watch waits for further file changes before reloading
+const DebounceDelay = 250 * time.Millisecond
+
+// Definition declares a twin. A definition file holds one definition or a
+// list of definitions, in YAML (.yaml, .yml) or JSON (.json).
+type Definition struct {
+	ID         string                       `json:"id"`
+	Type       string                       `json:"type"`
+	Definition string                       `json:"definition,omitempty"`
+	Attributes map[string]interface{}       `json:"attributes,omitempty"`
+	Features   map[string]FeatureDefinition `json:"features,omitempty"`
+}
+
+// FeatureDefinition declares a feature of a twin. Desired properties are
+// declared state and are kept in line with the file. Properties are reported
+// by devices, so the file only provides initial values for missing ones.
+type FeatureDefinition struct {
+	Definition        []string               `json:"definition,omitempty"`
+	Properties        map[string]interface{} `json:"properties,omitempty"`
+	DesiredProperties map[string]interface{} `json:"desiredProperties,omitempty"`
+}
+
+// Failure records a file or twin that could not be loaded
+type Failure struct {
+	File  string `json:"file,omitempty"`
+	ID    string `json:"id,omitempty"`
+	Error string `json:"error"`
+}
+
+// Report summarizes a load
+type Report struct {
+	Created        []string  `json:"created"`
+	Updated        []string  `json:"updated"`
+	Unchanged      []string  `json:"unchanged"`
+	Decommissioned []string  `json:"decommissioned"`
+	Failed         []Failure `json:"failed"`
+}
+
+// Loader reconciles the registry with the twin definitions in a directory.
+// Twins that were loaded from the directory and have since been removed from
+// it are decommissioned; twins created through the API are never touched.
+type Loader struct {
+	dir      string
+	registry *registry.Registry
+	pubsub   eventbus.Publisher
+	managed  map[string]bool // Twins defined in the directory by the last load
+	mutex    sync.Mutex
+}
+
+// NewLoader creates a loader for a directory
+func NewLoader(dir string, reg *registry.Registry, pubsub eventbus.Publisher) *Loader {
+	return &Loader{
+		dir:      dir,
+		registry: reg,
+		pubsub:   pubsub,
+		managed:  make(map[string]bool),
+	}
+}
+
+// Load reads all definition files and reconciles the registry with them.
+// Twins are only decommissioned when every file could be read, so that a
+// broken file does not take its twins out of service.
+func (l *Loader) Load() (*Report, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	defs, failures, err := ReadDir(l.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{
+		Created:        []string{},
+		Updated:        []string{},
+		Unchanged:      []string{},
+		Decommissioned: []string{},
+		Failed:         failures,
+	}
+	complete := len(failures) == 0
+
+	assets := make([]reconcile.Asset, len(defs))
+	for i, def := range defs {
+		assets[i] = reconcile.Asset{ID: def.ID, Type: def.Type, Definition: def.Definition, Attributes: def.Attributes}
+	}
+
+	result := reconcile.Reconcile(l.registry, assets, reconcile.Options{})
+	for _, f := range result.Failed {
+		report.Failed = append(report.Failed, Failure{ID: f.ID, Error: f.Error})
+	}
+
+	created := toSet(result.Created)
+	updated := toSet(result.Updated)
+	unchanged := toSet(result.Unchanged)
+	defined := make(map[string]bool, len(defs))
+
+	for _, def := range defs {
+		if !created[def.ID] && !updated[def.ID] && !unchanged[def.ID] {
+			continue
+		}
+		defined[def.ID] = true
+
+		dt, err := l.registry.Get(def.ID)
+		if err != nil {
+			report.Failed = append(report.Failed, Failure{ID: def.ID, Error: err.Error()})
+			continue
+		}
+
+		if applyFeatures(dt, def.Features) {
+			if err := l.registry.Update(dt); err != nil {
+				report.Failed = append(report.Failed, Failure{ID: def.ID, Error: err.Error()})
+				continue
+			}
+			updated[def.ID] = !created[def.ID]
+		}
+	}
+
+	for _, id := range sortedKeys(defined) {
+		switch {
+		case created[id]:
+			report.Created = append(report.Created, id)
+			l.pubsub.Publish("twin.created", map[string]string{"id": id})
+		case updated[id]:
+			report.Updated = append(report.Updated, id)
+			l.pubsub.Publish("twin.updated", map[string]string{"id": id})
+		default:
+			report.Unchanged = append(report.Unchanged, id)
+		}
+	}
+
+	if complete {
+		failed := make(map[string]bool)
+		for _, f := range report.Failed {
+			failed[f.ID] = true
+		}
+
+		for _, id := range sortedKeys(l.managed) {
+			if defined[id] || failed[id] {
+				continue
+			}
+			delete(l.managed, id)
+
+			dt, err := l.registry.Get(id)
+			if err != nil || dt.GetLifecycle() == twin.LifecycleDecommissioned {
+				continue
+			}
+			if err := dt.SetLifecycle(twin.LifecycleDecommissioned); err != nil {
+				report.Failed = append(report.Failed, Failure{ID: id, Error: err.Error()})
+				continue
+			}
+			if err := l.registry.Update(dt); err != nil {
+				report.Failed = append(report.Failed, Failure{ID: id, Error: err.Error()})
+				continue
+			}
+			report.Decommissioned = append(report.Decommissioned, id)
+			l.pubsub.Publish(webhook.Topic(webhook.EventDecommissioned), map[string]string{"id": id})
+		}
+	}
+
+	for id := range defined {
+		l.managed[id] = true
+	}
+	return report, nil
+}
+
+// Watch reloads the directory whenever a file in it changes until the
+// context is cancelled. Bursts of changes, such as a git checkout, cause a
+// single reload.
+func (l *Loader) Watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	if err := addDirs(watcher, l.dir); err != nil {
+		return err
+	}
+
+	var reload <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			// Watch directories created after start
+			if event.Op&fsnotify.Create != 0 {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					addDirs(watcher, event.Name)
+				}
+			}
+			reload = time.After(DebounceDelay)
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			log.Printf("Watching twin definitions failed: %v", err)
+
+		case <-reload:
+			reload = nil
+			report, err := l.Load()
+			if err != nil {
+				log.Printf("Failed to reload twin definitions: %v", err)
+				continue
+			}
+			logReport(report)
+		}
+	}
+}
+
+// ReadDir parses all definition files below a directory in lexical order.
+// Files that cannot be parsed and duplicate twin IDs are reported as failures.
+func ReadDir(dir string) ([]Definition, []Failure, error) {
+	var defs []Definition
+	failures := []Failure{}
+	files := make(map[string]string) // Twin ID -> file defining it
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !isDefinitionFile(path) {
+			return nil
+		}
+
+		rel, _ := filepath.Rel(dir, path)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			failures = append(failures, Failure{File: rel, Error: err.Error()})
+			return nil
+		}
+
+		parsed, err := Parse(path, data)
+		if err != nil {
+			failures = append(failures, Failure{File: rel, Error: err.Error()})
+			return nil
+		}
+
+		for _, def := range parsed {
+			if other, exists := files[def.ID]; exists && def.ID != "" {
+				failures = append(failures, Failure{File: rel, ID: def.ID, Error: "already defined in " + other})
+				continue
+			}
+			files[def.ID] = rel
+			defs = append(defs, def)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return defs, failures, nil
+}
+
+// Parse decodes a definition file holding one definition or a list of them.
+// YAML is converted to JSON first, so both formats produce the same values
+// as the JSON API.
+func Parse(name string, data []byte) ([]Definition, error) {
+	if ext := strings.ToLower(filepath.Ext(name)); ext == ".yaml" || ext == ".yml" {
+		var doc interface{}
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidDefinition, err)
+		}
+
+		var err error
+		if data, err = json.Marshal(doc); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidDefinition, err)
+		}
+	}
+
+	trimmed := strings.TrimSpace(string(data))
+	if trimmed == "" || trimmed == "null" {
+		return nil, nil
+	}
+
+	if strings.HasPrefix(trimmed, "[") {
+		var defs []Definition
+		if err := json.Unmarshal(data, &defs); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidDefinition, err)
+		}
+		return defs, nil
+	}
+
+	var def Definition
+	if err := json.Unmarshal(data, &def); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDefinition, err)
+	}
+	return []Definition{def}, nil
+}
+
+// applyFeatures brings the features of a twin in line with their definitions
+// and reports whether anything changed
+func applyFeatures(dt *twin.DigitalTwin, features map[string]FeatureDefinition) bool {
+	changed := false
+
+	for featureID, def := range features {
+		feature, exists := dt.GetFeature(featureID)
+		if !exists {
+			feature = twin.NewFeatureState()
+			changed = true
+		}
+
+		if def.Definition != nil && !reflect.DeepEqual(feature.GetDefinition(), def.Definition) {
+			feature.SetDefinition(def.Definition)
+			changed = true
+		}
+
+		for key, value := range def.DesiredProperties {
+			if current, ok := feature.GetDesiredProperty(key); !ok || !reflect.DeepEqual(current, value) {
+				feature.SetDesiredProperty(key, value)
+				changed = true
+			}
+		}
+
+		for key, value := range def.Properties {
+			if _, ok := feature.GetProperty(key); !ok {
+				feature.SetProperty(key, value)
+				changed = true
+			}
+		}
+
+		if !exists {
+			dt.AddFeature(featureID, feature)
+		}
+	}
+	return changed
+}
+
+// addDirs watches a directory and its subdirectories
+func addDirs(watcher *fsnotify.Watcher, root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != root && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		return watcher.Add(path)
+	})
+}
+
+// logReport logs the outcome of a reload
+func logReport(report *Report) {
+	log.Printf("Reloaded twin definitions: %d created, %d updated, %d decommissioned",
+		len(report.Created), len(report.Updated), len(report.Decommissioned))
+	for _, f := range report.Failed {
+		log.Printf("Twin definition failed: %s %s: %s", f.File, f.ID, f.Error)
+	}
+}
+
+// isDefinitionFile reports whether a file name has a definition file extension
+func isDefinitionFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+// toSet converts a list of IDs to a set
+func toSet(ids []string) map[string]bool {
+	set := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
+
+// sortedKeys returns the keys of a set in order
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
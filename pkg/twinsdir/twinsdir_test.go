@@ -0,0 +1,214 @@
+package twinsdir
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+const pumpsYAML = `
+- id: pump-1
+  type: pump
+  attributes:
+    serial: P-100
+    ratedFlow: 40
+  features:
+    control:
+      definition: ["org.example:Control:1.0"]
+      desiredProperties:
+        setpoint: 10
+      properties:
+        pressure: 0
+- id: pump-2
+  type: pump
+`
+
+const valveJSON = `{"id": "valve-1", "type": "valve", "attributes": {"size": "DN50"}}`
+
+func writeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParse(t *testing.T) {
+	defs, err := Parse("pumps.yaml", []byte(pumpsYAML))
+	if err != nil {
+		t.Fatalf("Failed to parse YAML: %v", err)
+	}
+	if len(defs) != 2 || defs[0].ID != "pump-1" || defs[1].Type != "pump" {
+		t.Fatalf("Unexpected definitions %+v", defs)
+	}
+
+	// YAML numbers are decoded like JSON numbers
+	if v := defs[0].Attributes["ratedFlow"]; v != 40.0 {
+		t.Errorf("Expected ratedFlow 40.0, got %v (%T)", v, v)
+	}
+	if v := defs[0].Features["control"].DesiredProperties["setpoint"]; v != 10.0 {
+		t.Errorf("Expected setpoint 10.0, got %v (%T)", v, v)
+	}
+
+	defs, err = Parse("valve.json", []byte(valveJSON))
+	if err != nil || len(defs) != 1 || defs[0].Attributes["size"] != "DN50" {
+		t.Errorf("Unexpected definitions %+v (%v)", defs, err)
+	}
+
+	if defs, err := Parse("empty.yaml", []byte("# nothing yet\n")); err != nil || len(defs) != 0 {
+		t.Errorf("Expected no definitions for an empty file, got %+v (%v)", defs, err)
+	}
+
+	for name, content := range map[string]string{"bad.yaml": "id: [", "bad.json": "{", "scalar.yaml": "pump"} {
+		if _, err := Parse(name, []byte(content)); !errors.Is(err, ErrInvalidDefinition) {
+			t.Errorf("Expected ErrInvalidDefinition for %s, got %v", name, err)
+		}
+	}
+}
+
+func TestReadDir(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "pumps.yaml", pumpsYAML)
+	writeFile(t, dir, "site/valves.json", valveJSON)
+	writeFile(t, dir, "site/duplicate.yml", "id: pump-2\ntype: pump\n")
+	writeFile(t, dir, "broken.json", "{")
+	writeFile(t, dir, "README.md", "# Twins")
+	writeFile(t, dir, ".git/config.json", "{")
+
+	defs, failures, err := ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to read directory: %v", err)
+	}
+	if len(defs) != 3 {
+		t.Errorf("Expected 3 definitions, got %+v", defs)
+	}
+	if len(failures) != 2 || failures[0].File != "broken.json" || failures[1].ID != "pump-2" {
+		t.Errorf("Unexpected failures %+v", failures)
+	}
+
+	if _, _, err := ReadDir(filepath.Join(dir, "missing")); err == nil {
+		t.Error("Expected an error for a missing directory")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "pumps.yaml", pumpsYAML)
+	writeFile(t, dir, "valves.json", valveJSON)
+
+	reg := registry.NewRegistry()
+	reg.Create(twin.NewDigitalTwin("api-1", "pump"))
+	pubsub := messaging_sim.NewPubSub()
+	events := pubsub.Subscribe("twin.#")
+	loader := NewLoader(dir, reg, pubsub)
+
+	report, err := loader.Load()
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	if len(report.Created) != 3 || len(report.Failed) != 0 {
+		t.Fatalf("Unexpected report %+v", report)
+	}
+	if msg := <-events; msg.Topic != "twin.created" {
+		t.Errorf("Expected twin.created, got %s", msg.Topic)
+	}
+
+	dt, _ := reg.Get("pump-1")
+	control, exists := dt.GetFeature("control")
+	if !exists {
+		t.Fatal("Expected the control feature")
+	}
+	if v, _ := control.GetDesiredProperty("setpoint"); v != 10.0 {
+		t.Errorf("Expected setpoint 10, got %v", v)
+	}
+
+	// Reported properties are only initial values
+	control.SetProperty("pressure", 2.5)
+	report, _ = loader.Load()
+	if len(report.Unchanged) != 3 || len(report.Updated) != 0 {
+		t.Errorf("Expected an unchanged reload, got %+v", report)
+	}
+	if v, _ := control.GetProperty("pressure"); v != 2.5 {
+		t.Errorf("Expected the reported pressure to be kept, got %v", v)
+	}
+
+	// Desired properties follow the files
+	control.SetDesiredProperty("setpoint", 99.0)
+	report, _ = loader.Load()
+	if len(report.Updated) != 1 || report.Updated[0] != "pump-1" {
+		t.Errorf("Expected pump-1 to be updated, got %+v", report)
+	}
+	if v, _ := control.GetDesiredProperty("setpoint"); v != 10.0 {
+		t.Errorf("Expected setpoint to be restored to 10, got %v", v)
+	}
+
+	// A broken file keeps its twins in service
+	writeFile(t, dir, "valves.json", "{")
+	report, _ = loader.Load()
+	if len(report.Failed) != 1 || len(report.Decommissioned) != 0 {
+		t.Errorf("Expected a failure and no decommissioning, got %+v", report)
+	}
+
+	// Removed twins are decommissioned; twins created through the API are not
+	os.Remove(filepath.Join(dir, "valves.json"))
+	report, _ = loader.Load()
+	if len(report.Decommissioned) != 1 || report.Decommissioned[0] != "valve-1" {
+		t.Errorf("Expected valve-1 to be decommissioned, got %+v", report)
+	}
+
+	valve, _ := reg.Get("valve-1")
+	api, _ := reg.Get("api-1")
+	if valve.GetLifecycle() != twin.LifecycleDecommissioned || api.GetLifecycle() == twin.LifecycleDecommissioned {
+		t.Errorf("Unexpected lifecycles valve-1 %s, api-1 %s", valve.GetLifecycle(), api.GetLifecycle())
+	}
+
+	report, _ = loader.Load()
+	if len(report.Decommissioned) != 0 {
+		t.Errorf("Expected no further decommissioning, got %+v", report)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "pumps.yaml", "id: pump-1\ntype: pump\n")
+
+	reg := registry.NewRegistry()
+	loader := NewLoader(dir, reg, messaging_sim.NewPubSub())
+	if _, err := loader.Load(); err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- loader.Watch(ctx) }()
+
+	// Give the watcher time to start
+	time.Sleep(50 * time.Millisecond)
+	writeFile(t, dir, "site/valves.json", valveJSON)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := reg.Get("valve-1"); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the new definition to be loaded")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Watch returned %v", err)
+	}
+}
@@ -0,0 +1,247 @@
+package txn
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// Common errors
+var (
+	ErrInvalidMutation = errors.New("invalid mutation")
+)
+
+// MaxMutations is the largest number of mutations in a single transaction
+const MaxMutations = 1000
+
+// Op is the kind of change a mutation makes
+type Op string
+
+// Mutation operations
+const (
+	OpCreate             Op = "create"             // Create a twin of Type with Attributes
+	OpDelete             Op = "delete"             // Delete a twin
+	OpSetAttribute       Op = "setAttribute"       // Set attribute Key to Value
+	OpRemoveAttribute    Op = "removeAttribute"    // Remove attribute Key
+	OpSetProperties      Op = "setProperties"      // Set Properties of Feature, creating it if needed
+	OpAddRelationship    Op = "addRelationship"    // Add Target to relationship Name
+	OpRemoveRelationship Op = "removeRelationship" // Remove Target from relationship Name
+)
+
+// Mutation is a single change to a twin. If IfRevision is set, the
+// transaction fails unless the twin is committed at that revision, which is
+// 0 for twins that must not exist yet.
+type Mutation struct {
+	Op         Op                     `json:"op"`
+	TwinID     string                 `json:"twinId"`
+	IfRevision *uint64                `json:"ifRevision,omitempty"`
+	Type       string                 `json:"type,omitempty"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+	Key        string                 `json:"key,omitempty"`
+	Value      interface{}            `json:"value,omitempty"`
+	Feature    string                 `json:"feature,omitempty"`
+	Properties map[string]interface{} `json:"properties,omitempty"`
+	Name       string                 `json:"name,omitempty"`
+	Target     string                 `json:"target,omitempty"`
+}
+
+// Change describes the effect of a committed transaction on one twin
+type Change struct {
+	TwinID   string   `json:"twinId"`
+	Created  bool     `json:"created,omitempty"`
+	Deleted  bool     `json:"deleted,omitempty"`
+	Updated  bool     `json:"updated,omitempty"`  // Attributes or relationships changed
+	Features []string `json:"features,omitempty"` // Features whose properties changed
+	Revision uint64   `json:"revision,omitempty"`
+}
+
+// Result reports a committed transaction
+type Result struct {
+	Version uint64   `json:"version"`
+	Changes []Change `json:"changes"`
+}
+
+// ConflictError reports a twin whose committed revision differs from the expected one
+type ConflictError struct {
+	TwinID   string
+	Expected uint64
+	Actual   uint64
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s: twin %s is at revision %d, expected %d", registry.ErrRevisionConflict, e.TwinID, e.Actual, e.Expected)
+}
+
+// Unwrap returns registry.ErrRevisionConflict
+func (e *ConflictError) Unwrap() error {
+	return registry.ErrRevisionConflict
+}
+
+// Validate checks mutations without applying them
+func Validate(mutations []Mutation) error {
+	if len(mutations) == 0 || len(mutations) > MaxMutations {
+		return fmt.Errorf("%w: between 1 and %d mutations are required", ErrInvalidMutation, MaxMutations)
+	}
+
+	for i, m := range mutations {
+		if m.TwinID == "" {
+			return fmt.Errorf("%w: mutation %d requires a twin ID", ErrInvalidMutation, i)
+		}
+
+		var missing string
+		switch m.Op {
+		case OpCreate:
+			if m.Type == "" {
+				missing = "type"
+			}
+			if twin.CheckAttributes(m.Attributes) != nil {
+				return fmt.Errorf("%w: mutation %d sets attribute %s, which is reserved for the server", ErrInvalidMutation, i, twin.SystemAttribute)
+			}
+		case OpDelete:
+		case OpSetAttribute, OpRemoveAttribute:
+			if m.Key == "" {
+				missing = "key"
+			}
+			if twin.IsReservedAttribute(m.Key) {
+				return fmt.Errorf("%w: mutation %d changes attribute %s, which is reserved for the server", ErrInvalidMutation, i, m.Key)
+			}
+		case OpSetProperties:
+			if m.Feature == "" || len(m.Properties) == 0 {
+				missing = "feature and properties"
+			}
+		case OpAddRelationship, OpRemoveRelationship:
+			if m.Name == "" || m.Target == "" {
+				missing = "name and target"
+			}
+		default:
+			return fmt.Errorf("%w: mutation %d has unknown op %q", ErrInvalidMutation, i, m.Op)
+		}
+
+		if missing != "" {
+			return fmt.Errorf("%w: %s mutation %d requires %s", ErrInvalidMutation, m.Op, i, missing)
+		}
+	}
+	return nil
+}
+
+// Apply applies mutations in order as one atomic transaction. Either all
+// mutations are committed at a single registry version or none is.
+func Apply(reg *registry.Registry, mutations []Mutation) (*Result, error) {
+	if err := Validate(mutations); err != nil {
+		return nil, err
+	}
+
+	changes := make(map[string]*Change)
+	change := func(id string) *Change {
+		if changes[id] == nil {
+			changes[id] = &Change{TwinID: id}
+		}
+		return changes[id]
+	}
+
+	version, err := reg.Transaction(func(tx *registry.Tx) error {
+		// Revisions are checked against the state before the transaction
+		for _, m := range mutations {
+			if m.IfRevision != nil {
+				if actual := tx.Revision(m.TwinID); actual != *m.IfRevision {
+					return &ConflictError{TwinID: m.TwinID, Expected: *m.IfRevision, Actual: actual}
+				}
+			}
+		}
+
+		for i, m := range mutations {
+			if err := apply(tx, m, change(m.TwinID)); err != nil {
+				return fmt.Errorf("mutation %d: %w", i, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{Version: version, Changes: make([]Change, 0, len(changes))}
+	for id, c := range changes {
+		if !c.Deleted {
+			if dt, err := reg.Get(id); err == nil {
+				c.Revision = dt.GetRevision()
+			}
+		}
+		sort.Strings(c.Features)
+		result.Changes = append(result.Changes, *c)
+	}
+
+	sort.Slice(result.Changes, func(i, j int) bool { return result.Changes[i].TwinID < result.Changes[j].TwinID })
+	return result, nil
+}
+
+// apply applies a single mutation within a transaction
+func apply(tx *registry.Tx, m Mutation, c *Change) error {
+	switch m.Op {
+	case OpCreate:
+		dt := twin.NewDigitalTwin(m.TwinID, m.Type)
+		for k, v := range m.Attributes {
+			dt.SetAttribute(k, v)
+		}
+		dt.SetSystem(twin.SystemSource, "api")
+		if err := tx.Create(dt); err != nil {
+			return err
+		}
+		c.Created, c.Deleted = true, false
+		return nil
+
+	case OpDelete:
+		if err := tx.Delete(m.TwinID); err != nil {
+			return err
+		}
+		c.Deleted, c.Created, c.Updated, c.Features = true, false, false, nil
+		return nil
+	}
+
+	dt, err := tx.Get(m.TwinID)
+	if err != nil {
+		return err
+	}
+
+	switch m.Op {
+	case OpSetAttribute:
+		dt.SetAttribute(m.Key, m.Value)
+	case OpRemoveAttribute:
+		dt.RemoveAttribute(m.Key)
+	case OpAddRelationship:
+		if !tx.Exists(m.Target) {
+			return fmt.Errorf("target %s: %w", m.Target, registry.ErrTwinNotFound)
+		}
+		if err := dt.AddRelationship(m.Name, m.Target); err != nil {
+			return err
+		}
+	case OpRemoveRelationship:
+		if err := dt.RemoveRelationship(m.Name, m.Target); err != nil {
+			return err
+		}
+	case OpSetProperties:
+		feature, exists := dt.GetFeature(m.Feature)
+		if !exists {
+			feature = twin.NewFeatureState()
+			if err := dt.AddFeature(m.Feature, feature); err != nil {
+				return err
+			}
+		}
+		for k, v := range m.Properties {
+			feature.SetProperty(k, v)
+		}
+		for _, f := range c.Features {
+			if f == m.Feature {
+				return nil
+			}
+		}
+		c.Features = append(c.Features, m.Feature)
+		return nil
+	}
+
+	c.Updated = true
+	return nil
+}
@@ -0,0 +1,114 @@
+package txn
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func revision(r uint64) *uint64 {
+	return &r
+}
+
+func TestApply(t *testing.T) {
+	reg := registry.NewRegistry()
+	reg.Create(twin.NewDigitalTwin("gateway-1", "gateway"))
+	reg.Create(twin.NewDigitalTwin("gateway-2", "gateway"))
+	reg.Create(twin.NewDigitalTwin("device-1", "device"))
+
+	gateway1, _ := reg.Get("gateway-1")
+	gateway1.AddRelationship("hosts", "device-1")
+	reg.Update(gateway1)
+
+	// Swap the device from one gateway to the other
+	result, err := Apply(reg, []Mutation{
+		{Op: OpRemoveRelationship, TwinID: "gateway-1", Name: "hosts", Target: "device-1", IfRevision: revision(2)},
+		{Op: OpAddRelationship, TwinID: "gateway-2", Name: "hosts", Target: "device-1", IfRevision: revision(1)},
+		{Op: OpSetProperties, TwinID: "device-1", Feature: "link", Properties: map[string]interface{}{"gateway": "gateway-2"}},
+		{Op: OpCreate, TwinID: "device-2", Type: "device", Attributes: map[string]interface{}{"serial": "X2"}, IfRevision: revision(0)},
+	})
+	if err != nil {
+		t.Fatalf("Failed to apply transaction: %v", err)
+	}
+
+	if result.Version != reg.Version() || len(result.Changes) != 4 {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+
+	changes := make(map[string]Change)
+	for _, c := range result.Changes {
+		changes[c.TwinID] = c
+	}
+	if !changes["device-2"].Created || !changes["gateway-1"].Updated || changes["gateway-1"].Revision != 3 {
+		t.Errorf("Unexpected changes: %+v", changes)
+	}
+	if features := changes["device-1"].Features; len(features) != 1 || features[0] != "link" {
+		t.Errorf("Expected link feature change, got %v", features)
+	}
+
+	gateway2, _ := reg.Get("gateway-2")
+	if hosts := gateway2.GetRelationship("hosts"); len(hosts) != 1 || hosts[0] != "device-1" {
+		t.Errorf("Expected gateway-2 to host device-1, got %v", hosts)
+	}
+
+	// System attributes are reserved for the server
+	for _, m := range []Mutation{
+		{Op: OpSetAttribute, TwinID: "device-1", Key: twin.SystemAttribute, Value: map[string]interface{}{}},
+		{Op: OpRemoveAttribute, TwinID: "device-1", Key: twin.SystemAttribute},
+		{Op: OpCreate, TwinID: "device-3", Type: "device", Attributes: map[string]interface{}{twin.SystemAttribute + ".owner": "me"}},
+	} {
+		if _, err := Apply(reg, []Mutation{m}); !errors.Is(err, ErrInvalidMutation) {
+			t.Errorf("%s: expected ErrInvalidMutation, got %v", m.Op, err)
+		}
+	}
+}
+
+func TestApplyIsAtomic(t *testing.T) {
+	reg := registry.NewRegistry()
+	reg.Create(twin.NewDigitalTwin("gateway-1", "gateway"))
+	before := reg.Version()
+
+	// A stale revision rejects the whole transaction
+	_, err := Apply(reg, []Mutation{
+		{Op: OpSetAttribute, TwinID: "gateway-1", Key: "status", Value: "offline"},
+		{Op: OpDelete, TwinID: "gateway-1", IfRevision: revision(7)},
+	})
+
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) || !errors.Is(err, registry.ErrRevisionConflict) {
+		t.Fatalf("Expected ConflictError, got %v", err)
+	}
+	if conflict.TwinID != "gateway-1" || conflict.Expected != 7 || conflict.Actual != 1 {
+		t.Errorf("Unexpected conflict: %+v", conflict)
+	}
+
+	// A failing mutation rejects the whole transaction
+	_, err = Apply(reg, []Mutation{
+		{Op: OpSetAttribute, TwinID: "gateway-1", Key: "status", Value: "offline"},
+		{Op: OpAddRelationship, TwinID: "gateway-1", Name: "hosts", Target: "missing"},
+	})
+	if !errors.Is(err, registry.ErrTwinNotFound) {
+		t.Errorf("Expected ErrTwinNotFound, got %v", err)
+	}
+
+	dt, _ := reg.Get("gateway-1")
+	if _, exists := dt.GetAttribute("status"); exists || reg.Version() != before {
+		t.Error("Expected rejected transactions not to change the registry")
+	}
+
+	invalid := [][]Mutation{
+		nil,
+		{{Op: OpDelete}},
+		{{Op: "rename", TwinID: "gateway-1"}},
+		{{Op: OpCreate, TwinID: "gateway-2"}},
+		{{Op: OpSetProperties, TwinID: "gateway-1", Feature: "link"}},
+		{{Op: OpAddRelationship, TwinID: "gateway-1", Name: "hosts"}},
+	}
+	for _, mutations := range invalid {
+		if _, err := Apply(reg, mutations); !errors.Is(err, ErrInvalidMutation) {
+			t.Errorf("Expected ErrInvalidMutation for %+v, got %v", mutations, err)
+		}
+	}
+}
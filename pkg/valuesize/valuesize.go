@@ -0,0 +1,271 @@
+// Package valuesize keeps very large property values, such as images or
+// waveforms reported by devices, from bloating the registry. Each property
+// has a limit on the size of its JSON encoding; larger values are rejected,
+// or offloaded to attachment storage and replaced with a reference.
+package valuesize
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Common errors
+var (
+	ErrTooLarge      = errors.New("property value too large")
+	ErrInvalidLimit  = errors.New("invalid value size limit")
+	ErrLimitNotFound = errors.New("value size limit not found")
+)
+
+// ReferenceKey is the only member of the object replacing an offloaded value
+const ReferenceKey = "$attachment"
+
+// Action decides what happens to a value exceeding its limit
+type Action string
+
+// Supported actions
+const (
+	Reject  Action = "reject"  // Reject the write
+	Offload Action = "offload" // Store the value as an attachment and keep a reference
+)
+
+// Defaults of properties without an explicit limit
+const (
+	DefaultMaxBytes = 1 << 20
+	DefaultAction   = Reject
+)
+
+// ParseAction validates an action name. The empty name is the default action.
+func ParseAction(s string) (Action, error) {
+	switch a := Action(s); a {
+	case "":
+		return DefaultAction, nil
+	case Reject, Offload:
+		return a, nil
+	}
+	return "", fmt.Errorf("%w: unknown action %q", ErrInvalidLimit, s)
+}
+
+// Limit is the size limit of a property
+type Limit struct {
+	MaxBytes int64  `json:"maxBytes"` // Largest JSON encoding of a value
+	Action   Action `json:"action"`
+}
+
+// normalize checks a limit and fills in the default action
+func (l *Limit) normalize() error {
+	if l.MaxBytes <= 0 {
+		return fmt.Errorf("%w: maxBytes must be positive", ErrInvalidLimit)
+	}
+	action, err := ParseAction(string(l.Action))
+	if err != nil {
+		return err
+	}
+	l.Action = action
+	return nil
+}
+
+// Reference describes an offloaded value
+type Reference struct {
+	AttachmentID string `json:"id"`
+	Size         int64  `json:"size"`
+	SHA256       string `json:"sha256,omitempty"`
+}
+
+// Store keeps offloaded values, as JSON documents attached to their twin
+type Store interface {
+	Offload(ctx context.Context, twinID, name string, data []byte) (Reference, error)
+}
+
+// StoreFunc adapts an ordinary function to the Store interface
+type StoreFunc func(ctx context.Context, twinID, name string, data []byte) (Reference, error)
+
+// Offload calls f(ctx, twinID, name, data)
+func (f StoreFunc) Offload(ctx context.Context, twinID, name string, data []byte) (Reference, error) {
+	return f(ctx, twinID, name, data)
+}
+
+// Manager keeps the size limits of properties
+type Manager struct {
+	store        Store
+	defaultLimit Limit
+	limits       map[string]Limit
+	mutex        sync.RWMutex
+}
+
+// NewManager creates a new manager with the default limit, offloading values
+// to a store. Without a store values to offload are rejected.
+func NewManager(store Store) *Manager {
+	return &Manager{
+		store:        store,
+		defaultLimit: Limit{MaxBytes: DefaultMaxBytes, Action: DefaultAction},
+		limits:       make(map[string]Limit),
+	}
+}
+
+// limitKey identifies a property across all twins
+func limitKey(featureID, key string) string {
+	return featureID + "/" + key
+}
+
+// Default returns the limit of properties without an explicit limit
+func (m *Manager) Default() Limit {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return m.defaultLimit
+}
+
+// SetDefault sets the limit of properties without an explicit limit
+func (m *Manager) SetDefault(limit Limit) (Limit, error) {
+	if err := limit.normalize(); err != nil {
+		return Limit{}, err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.defaultLimit = limit
+	return limit, nil
+}
+
+// Limit returns the limit of a property
+func (m *Manager) Limit(featureID, key string) Limit {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if limit, exists := m.limits[limitKey(featureID, key)]; exists {
+		return limit
+	}
+	return m.defaultLimit
+}
+
+// Set sets the limit of a property for all twins
+func (m *Manager) Set(featureID, key string, limit Limit) (Limit, error) {
+	if featureID == "" || key == "" {
+		return Limit{}, fmt.Errorf("%w: feature and property are required", ErrInvalidLimit)
+	}
+	if err := limit.normalize(); err != nil {
+		return Limit{}, err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.limits[limitKey(featureID, key)] = limit
+	return limit, nil
+}
+
+// Delete reverts a property to the default limit
+func (m *Manager) Delete(featureID, key string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, exists := m.limits[limitKey(featureID, key)]; !exists {
+		return ErrLimitNotFound
+	}
+	delete(m.limits, limitKey(featureID, key))
+	return nil
+}
+
+// Limits returns a copy of the per-property limits keyed by
+// "featureID/propertyKey"
+func (m *Manager) Limits() map[string]Limit {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	limits := make(map[string]Limit, len(m.limits))
+	for k, limit := range m.limits {
+		limits[k] = limit
+	}
+	return limits
+}
+
+// Size returns the size of the JSON encoding of a value
+func Size(value interface{}) int64 {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return 0
+	}
+	return int64(len(data))
+}
+
+// Check rejects properties of a feature exceeding their limit unless they
+// are to be offloaded. It changes nothing, so that writes can be checked
+// before anything else happens.
+func (m *Manager) Check(featureID string, properties map[string]interface{}) error {
+	for _, key := range sortedKeys(properties) {
+		limit := m.Limit(featureID, key)
+		size := Size(properties[key])
+		if size <= limit.MaxBytes {
+			continue
+		}
+		if limit.Action == Reject || m.store == nil {
+			return fmt.Errorf("%w: %s/%s has %d bytes, more than the limit of %d", ErrTooLarge, featureID, key, size, limit.MaxBytes)
+		}
+	}
+	return nil
+}
+
+// Offload stores properties of a feature exceeding their limit in the store
+// and replaces them in properties with a reference. It returns the keys of
+// the offloaded properties.
+func (m *Manager) Offload(ctx context.Context, twinID, featureID string, properties map[string]interface{}) ([]string, error) {
+	var offloaded []string
+	for _, key := range sortedKeys(properties) {
+		limit := m.Limit(featureID, key)
+		if limit.Action != Offload || m.store == nil {
+			continue
+		}
+		data, err := json.Marshal(properties[key])
+		if err != nil || int64(len(data)) <= limit.MaxBytes {
+			continue
+		}
+
+		ref, err := m.store.Offload(ctx, twinID, featureID+"."+key+".json", data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to offload %s/%s: %w", featureID, key, err)
+		}
+		properties[key] = map[string]interface{}{
+			ReferenceKey: map[string]interface{}{"id": ref.AttachmentID, "size": ref.Size, "sha256": ref.SHA256},
+		}
+		offloaded = append(offloaded, key)
+	}
+	return offloaded, nil
+}
+
+// Enforce checks and offloads the properties of a feature of a twin
+func (m *Manager) Enforce(ctx context.Context, twinID, featureID string, properties map[string]interface{}) ([]string, error) {
+	if err := m.Check(featureID, properties); err != nil {
+		return nil, err
+	}
+	return m.Offload(ctx, twinID, featureID, properties)
+}
+
+// Offloaded returns the attachment ID of a value replaced with a reference
+func Offloaded(value interface{}) (string, bool) {
+	object, ok := value.(map[string]interface{})
+	if !ok || len(object) != 1 {
+		return "", false
+	}
+	ref, ok := object[ReferenceKey].(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+	id, ok := ref["id"].(string)
+	return id, ok
+}
+
+// sortedKeys returns the keys of properties in order, so that the first
+// violation reported is stable
+func sortedKeys(properties map[string]interface{}) []string {
+	keys := make([]string, 0, len(properties))
+	for k := range properties {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,80 @@
+package valuesize
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLimits(t *testing.T) {
+	m := NewManager(nil)
+	if limit := m.Limit("camera", "frame"); limit.MaxBytes != DefaultMaxBytes || limit.Action != Reject {
+		t.Errorf("Expected the default limit, got %+v", limit)
+	}
+
+	limit, err := m.Set("camera", "frame", Limit{MaxBytes: 100})
+	if err != nil || limit.Action != Reject {
+		t.Fatalf("Failed to set limit: %+v %v", limit, err)
+	}
+	if limit := m.Limit("camera", "frame"); limit.MaxBytes != 100 {
+		t.Errorf("Expected the property limit, got %+v", limit)
+	}
+	if limits := m.Limits(); len(limits) != 1 || limits["camera/frame"].MaxBytes != 100 {
+		t.Errorf("Unexpected limits %v", limits)
+	}
+
+	for _, limit := range []Limit{{MaxBytes: 0}, {MaxBytes: 10, Action: "truncate"}} {
+		if _, err := m.SetDefault(limit); !errors.Is(err, ErrInvalidLimit) {
+			t.Errorf("%+v: expected ErrInvalidLimit, got %v", limit, err)
+		}
+	}
+	if _, err := m.Set("", "frame", Limit{MaxBytes: 10}); !errors.Is(err, ErrInvalidLimit) {
+		t.Errorf("Expected ErrInvalidLimit without a feature, got %v", err)
+	}
+
+	if err := m.Delete("camera", "frame"); err != nil {
+		t.Fatalf("Failed to delete limit: %v", err)
+	}
+	if err := m.Delete("camera", "frame"); err != ErrLimitNotFound {
+		t.Errorf("Expected ErrLimitNotFound, got %v", err)
+	}
+}
+
+func TestEnforce(t *testing.T) {
+	var stored []string
+	m := NewManager(StoreFunc(func(ctx context.Context, twinID, name string, data []byte) (Reference, error) {
+		stored = append(stored, twinID+":"+name+":"+string(data))
+		return Reference{AttachmentID: "a1", Size: int64(len(data))}, nil
+	}))
+	m.SetDefault(Limit{MaxBytes: 10})
+	m.Set("camera", "frame", Limit{MaxBytes: 10, Action: Offload})
+
+	// Rejected writes change nothing, even values that would be offloaded
+	properties := map[string]interface{}{"frame": strings.Repeat("x", 20), "label": strings.Repeat("y", 20)}
+	if _, err := m.Enforce(context.Background(), "cam-1", "camera", properties); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("Expected ErrTooLarge, got %v", err)
+	}
+	if len(stored) != 0 || properties["frame"] != strings.Repeat("x", 20) {
+		t.Errorf("Expected nothing to be offloaded, got %v", stored)
+	}
+
+	properties = map[string]interface{}{"frame": strings.Repeat("x", 20), "fps": 25.0}
+	offloaded, err := m.Enforce(context.Background(), "cam-1", "camera", properties)
+	if err != nil || len(offloaded) != 1 || offloaded[0] != "frame" {
+		t.Fatalf("Failed to offload: %v %v", offloaded, err)
+	}
+	if id, ok := Offloaded(properties["frame"]); !ok || id != "a1" {
+		t.Errorf("Expected a reference to a1, got %v", properties["frame"])
+	}
+	if properties["fps"] != 25.0 || len(stored) != 1 || stored[0] != `cam-1:camera.frame.json:"xxxxxxxxxxxxxxxxxxxx"` {
+		t.Errorf("Unexpected offloading %v %v", properties, stored)
+	}
+
+	// Without a store values to offload are rejected
+	m = NewManager(nil)
+	m.Set("camera", "frame", Limit{MaxBytes: 10, Action: Offload})
+	if err := m.Check("camera", map[string]interface{}{"frame": strings.Repeat("x", 20)}); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Expected ErrTooLarge without a store, got %v", err)
+	}
+}
@@ -0,0 +1,357 @@
+package views
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/clock"
+	"github.com/aleka07/go-digital-twin/pkg/eventbus"
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/query"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// Common errors
+var (
+	ErrViewNotFound      = errors.New("view not found")
+	ErrViewAlreadyExists = errors.New("view already exists")
+	ErrInvalidDefinition = errors.New("invalid view definition")
+)
+
+// RefreshPolicy controls when a view is brought up to date
+type RefreshPolicy string
+
+// Supported refresh policies
+const (
+	RefreshOnChange RefreshPolicy = "onChange" // Incrementally on every twin change event
+	RefreshPeriodic RefreshPolicy = "periodic" // Fully recomputed every Interval
+	RefreshManual   RefreshPolicy = "manual"   // Only recomputed when Refresh is called
+)
+
+// Definition describes a named view: the twins it selects and the paths it projects
+type Definition struct {
+	Name       string        // Unique view name
+	Query      string        // Query selecting the twins in the view
+	Projection []string      // Twin paths copied into each row
+	Refresh    RefreshPolicy // When the view is brought up to date
+	Interval   time.Duration // Refresh interval for periodic views
+}
+
+// Row is the projection of a single twin; it always contains the twin's id
+type Row map[string]interface{}
+
+// Result is the materialized content of a view
+type Result struct {
+	Name        string    `json:"name"`
+	RefreshedAt time.Time `json:"refreshedAt"`
+	Rows        []Row     `json:"rows"`
+}
+
+// view holds the materialized rows of a single definition
+type view struct {
+	def         Definition
+	query       *query.Query
+	rows        map[string]Row
+	sorted      []Row // Rows ordered by twin ID, rebuilt lazily after changes
+	refreshedAt time.Time
+	stale       bool // Change events were missed, so rows are recomputed before the next read
+	stop        chan struct{}
+	mutex       sync.RWMutex
+}
+
+// Manager maintains materialized views over the twins in a registry
+type Manager struct {
+	registry registry.Twins
+	views    map[string]*view
+	gaps     *eventbus.Gaps // Change events dropped by the event bus
+	clock    atomic.Value   // clockBox; views are refreshed with and without the lock held
+	mutex    sync.RWMutex
+}
+
+// clockBox holds the clock, as atomic.Value needs one concrete type
+type clockBox struct {
+	clock clock.Clock
+}
+
+// NewManager creates a new view manager
+func NewManager(reg registry.Twins) *Manager {
+	return &Manager{
+		registry: reg,
+		views:    make(map[string]*view),
+		gaps:     eventbus.NewGaps(),
+	}
+}
+
+// SetClock sets the clock that refresh times are read from; nil restores
+// the system clock
+func (m *Manager) SetClock(c clock.Clock) {
+	m.clock.Store(clockBox{clock.OrSystem(c)})
+}
+
+// now returns the time of the manager clock
+func (m *Manager) now() time.Time {
+	if box, ok := m.clock.Load().(clockBox); ok {
+		return box.clock.Now()
+	}
+	return time.Now()
+}
+
+// Create defines a new view and computes its initial content
+func (m *Manager) Create(def Definition) error {
+	if def.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidDefinition)
+	}
+
+	if def.Refresh == "" {
+		def.Refresh = RefreshOnChange
+	}
+
+	switch def.Refresh {
+	case RefreshOnChange, RefreshManual:
+	case RefreshPeriodic:
+		if def.Interval <= 0 {
+			return fmt.Errorf("%w: periodic views require a positive interval", ErrInvalidDefinition)
+		}
+	default:
+		return fmt.Errorf("%w: unknown refresh policy %q", ErrInvalidDefinition, def.Refresh)
+	}
+
+	q, err := query.Parse(def.Query)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidDefinition, err)
+	}
+
+	projection := make([]string, len(def.Projection))
+	copy(projection, def.Projection)
+	def.Projection = projection
+
+	v := &view{
+		def:   def,
+		query: q,
+		rows:  make(map[string]Row),
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, exists := m.views[def.Name]; exists {
+		return ErrViewAlreadyExists
+	}
+
+	m.refreshView(v)
+	m.views[def.Name] = v
+
+	if def.Refresh == RefreshPeriodic {
+		v.stop = make(chan struct{})
+		go m.refreshPeriodically(v, v.stop)
+	}
+
+	return nil
+}
+
+// Delete removes a view
+func (m *Manager) Delete(name string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	v, exists := m.views[name]
+	if !exists {
+		return ErrViewNotFound
+	}
+
+	if v.stop != nil {
+		close(v.stop)
+	}
+
+	delete(m.views, name)
+	return nil
+}
+
+// Definitions returns the definitions of all views ordered by name
+func (m *Manager) Definitions() []Definition {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	defs := make([]Definition, 0, len(m.views))
+	for _, v := range m.views {
+		defs = append(defs, v.def)
+	}
+
+	sort.Slice(defs, func(i, j int) bool { return defs[i].Name < defs[j].Name })
+	return defs
+}
+
+// Get returns the current content of a view without re-evaluating its query
+func (m *Manager) Get(name string) (*Result, error) {
+	m.mutex.RLock()
+	v, exists := m.views[name]
+	m.mutex.RUnlock()
+
+	if !exists {
+		return nil, ErrViewNotFound
+	}
+
+	v.mutex.RLock()
+	stale := v.stale
+	v.mutex.RUnlock()
+	if stale {
+		m.refreshView(v)
+	}
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if v.sorted == nil {
+		v.sorted = make([]Row, 0, len(v.rows))
+		for _, row := range v.rows {
+			v.sorted = append(v.sorted, row)
+		}
+		sort.Slice(v.sorted, func(i, j int) bool {
+			return v.sorted[i]["id"].(string) < v.sorted[j]["id"].(string)
+		})
+	}
+
+	return &Result{
+		Name:        v.def.Name,
+		RefreshedAt: v.refreshedAt,
+		Rows:        v.sorted,
+	}, nil
+}
+
+// Refresh fully recomputes a view regardless of its refresh policy
+func (m *Manager) Refresh(name string) error {
+	m.mutex.RLock()
+	v, exists := m.views[name]
+	m.mutex.RUnlock()
+
+	if !exists {
+		return ErrViewNotFound
+	}
+
+	m.refreshView(v)
+	return nil
+}
+
+// HandleEvent incrementally updates all onChange views affected by a change
+// event. When the event bus dropped events before it, the changes they
+// carried are unknown, so the views are marked for a full refresh instead.
+func (m *Manager) HandleEvent(msg messaging_sim.Message) {
+	twinID := msg.TwinID()
+	if twinID == "" {
+		return
+	}
+	missed := m.gaps.Missed(msg)
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	for _, v := range m.views {
+		if v.def.Refresh != RefreshOnChange {
+			continue
+		}
+		if missed > 0 {
+			v.mutex.Lock()
+			v.stale = true
+			v.mutex.Unlock()
+		} else {
+			m.updateTwin(v, twinID)
+		}
+	}
+}
+
+// Run applies change events from a subscription until the channel is closed
+func (m *Manager) Run(events <-chan messaging_sim.Message) {
+	for msg := range events {
+		m.HandleEvent(msg)
+	}
+}
+
+// Close stops the background refresh of all periodic views
+func (m *Manager) Close() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, v := range m.views {
+		if v.stop != nil {
+			close(v.stop)
+			v.stop = nil
+		}
+	}
+}
+
+// refreshPeriodically recomputes a view on every tick until it is stopped
+func (m *Manager) refreshPeriodically(v *view, stop <-chan struct{}) {
+	ticker := time.NewTicker(v.def.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.refreshView(v)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// refreshView recomputes all rows of a view from the registry
+func (m *Manager) refreshView(v *view) {
+	// Events missed from here on are not in the rows computed below
+	v.mutex.Lock()
+	v.stale = false
+	v.mutex.Unlock()
+
+	rows := make(map[string]Row)
+	for _, dt := range m.registry.List() {
+		if v.query.Matches(dt) {
+			rows[dt.ID] = project(dt.ID, v.def.Projection, dt)
+		}
+	}
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	v.rows = rows
+	v.sorted = nil
+	v.refreshedAt = m.now()
+}
+
+// updateTwin re-evaluates a single twin against a view
+func (m *Manager) updateTwin(v *view, twinID string) {
+	dt, err := m.registry.Get(twinID)
+
+	var row Row
+	if err == nil && v.query.Matches(dt) {
+		row = project(twinID, v.def.Projection, dt)
+	}
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if row != nil {
+		v.rows[twinID] = row
+	} else if _, exists := v.rows[twinID]; exists {
+		delete(v.rows, twinID)
+	} else {
+		return
+	}
+
+	v.sorted = nil
+	v.refreshedAt = m.now()
+}
+
+// project copies the projected paths of a twin into a row
+func project(twinID string, paths []string, dt *twin.DigitalTwin) Row {
+	row := Row{"id": twinID}
+	for _, path := range paths {
+		if val, exists := query.Lookup(dt, path); exists {
+			row[path] = val
+		}
+	}
+	return row
+}
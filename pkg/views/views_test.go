@@ -0,0 +1,183 @@
+package views
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func setupRegistry() *registry.Registry {
+	reg := registry.NewRegistry()
+
+	for _, id := range []string{"sensor-2", "sensor-1"} {
+		dt := twin.NewDigitalTwin(id, "sensor")
+		dt.SetAttribute("location", "kitchen")
+		reg.Create(dt)
+	}
+
+	reg.Create(twin.NewDigitalTwin("lamp-1", "actuator"))
+	return reg
+}
+
+func TestCreateAndGetView(t *testing.T) {
+	m := NewManager(setupRegistry())
+	defer m.Close()
+
+	err := m.Create(Definition{
+		Name:       "sensors",
+		Query:      "type==sensor",
+		Projection: []string{"attributes.location"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create view: %v", err)
+	}
+
+	result, err := m.Get("sensors")
+	if err != nil {
+		t.Fatalf("Failed to get view: %v", err)
+	}
+
+	if len(result.Rows) != 2 {
+		t.Fatalf("Expected 2 rows, got %d", len(result.Rows))
+	}
+
+	// Rows are ordered by twin ID
+	if result.Rows[0]["id"] != "sensor-1" || result.Rows[1]["id"] != "sensor-2" {
+		t.Errorf("Expected rows ordered by ID, got %v", result.Rows)
+	}
+
+	if result.Rows[0]["attributes.location"] != "kitchen" {
+		t.Errorf("Expected projected location kitchen, got %v", result.Rows[0]["attributes.location"])
+	}
+
+	// Test error cases
+	if err := m.Create(Definition{Name: "sensors"}); err != ErrViewAlreadyExists {
+		t.Errorf("Expected ErrViewAlreadyExists, got %v", err)
+	}
+
+	if err := m.Create(Definition{Name: "broken", Query: "type"}); err == nil {
+		t.Error("Expected error for invalid query")
+	}
+
+	if err := m.Create(Definition{Name: "periodic", Refresh: RefreshPeriodic}); err == nil {
+		t.Error("Expected error for periodic view without interval")
+	}
+
+	if _, err := m.Get("nonexistent"); err != ErrViewNotFound {
+		t.Errorf("Expected ErrViewNotFound, got %v", err)
+	}
+}
+
+func TestViewIncrementalUpdate(t *testing.T) {
+	reg := setupRegistry()
+	m := NewManager(reg)
+	defer m.Close()
+
+	m.Create(Definition{Name: "kitchen", Query: "attributes.location==kitchen"})
+	m.Create(Definition{Name: "manual", Query: "attributes.location==kitchen", Refresh: RefreshManual})
+
+	// Move a twin out of the kitchen
+	dt, _ := reg.Get("sensor-1")
+	dt.SetAttribute("location", "garage")
+	m.HandleEvent(messaging_sim.Message{Topic: "twin.updated", Payload: map[string]string{"id": "sensor-1"}})
+
+	// Move another twin into the kitchen
+	lamp, _ := reg.Get("lamp-1")
+	lamp.SetAttribute("location", "kitchen")
+	m.HandleEvent(messaging_sim.Message{Topic: "twin.updated", Payload: map[string]string{"id": "lamp-1"}})
+
+	// Delete a twin
+	reg.Delete("sensor-2")
+	m.HandleEvent(messaging_sim.Message{Topic: "twin.deleted", Payload: map[string]string{"id": "sensor-2"}})
+
+	result, _ := m.Get("kitchen")
+	if len(result.Rows) != 1 || result.Rows[0]["id"] != "lamp-1" {
+		t.Errorf("Expected only lamp-1 in kitchen view, got %v", result.Rows)
+	}
+
+	// Manual views only change on refresh
+	result, _ = m.Get("manual")
+	if len(result.Rows) != 2 {
+		t.Errorf("Expected manual view to keep 2 rows before refresh, got %d", len(result.Rows))
+	}
+
+	if err := m.Refresh("manual"); err != nil {
+		t.Fatalf("Failed to refresh view: %v", err)
+	}
+
+	result, _ = m.Get("manual")
+	if len(result.Rows) != 1 {
+		t.Errorf("Expected manual view to have 1 row after refresh, got %d", len(result.Rows))
+	}
+}
+
+func TestViewMissedEvents(t *testing.T) {
+	reg := setupRegistry()
+	m := NewManager(reg)
+	defer m.Close()
+
+	m.Create(Definition{Name: "kitchen", Query: "attributes.location==kitchen"})
+	m.HandleEvent(messaging_sim.Message{Topic: "twin.updated", Payload: map[string]string{"id": "sensor-1"}, Sequence: 1})
+
+	// The bus drops the event moving sensor-2 out of the kitchen, and one
+	// of sensor-1, which the next event of sensor-1 reveals
+	dt, _ := reg.Get("sensor-2")
+	dt.SetAttribute("location", "garage")
+	dt, _ = reg.Get("sensor-1")
+	dt.SetAttribute("location", "garage")
+	m.HandleEvent(messaging_sim.Message{Topic: "twin.updated", Payload: map[string]string{"id": "sensor-1"}, Sequence: 3})
+
+	// The gap marks the view for a full refresh, which catches both moves
+	if result, _ := m.Get("kitchen"); len(result.Rows) != 0 {
+		t.Errorf("Expected the view to be refreshed after missed events, got %v", result.Rows)
+	}
+}
+
+func TestPeriodicView(t *testing.T) {
+	reg := setupRegistry()
+	m := NewManager(reg)
+	defer m.Close()
+
+	err := m.Create(Definition{
+		Name:     "actuators",
+		Query:    "type==actuator",
+		Refresh:  RefreshPeriodic,
+		Interval: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create view: %v", err)
+	}
+
+	reg.Create(twin.NewDigitalTwin("lamp-2", "actuator"))
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if result, _ := m.Get("actuators"); len(result.Rows) == 2 {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	t.Error("Expected periodic view to pick up the new twin")
+}
+
+func TestDeleteView(t *testing.T) {
+	m := NewManager(setupRegistry())
+
+	m.Create(Definition{Name: "all", Refresh: RefreshPeriodic, Interval: time.Hour})
+
+	if defs := m.Definitions(); len(defs) != 1 || defs[0].Name != "all" {
+		t.Errorf("Expected a single definition named all, got %v", defs)
+	}
+
+	if err := m.Delete("all"); err != nil {
+		t.Errorf("Failed to delete view: %v", err)
+	}
+
+	if err := m.Delete("all"); err != ErrViewNotFound {
+		t.Errorf("Expected ErrViewNotFound, got %v", err)
+	}
+}
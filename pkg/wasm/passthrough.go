@@ -0,0 +1,24 @@
+package wasm
+
+// Passthrough is a hook module that returns the payload unchanged, for bridges
+// whose messages already are telemetry JSON. In text format:
+//
+//	(module
+//	  (memory (export "memory") 1)
+//	  (global $heap (mut i32) (i32.const 1024))
+//	  (func (export "alloc") (param $size i32) (result i32) (local $p i32)
+//	    global.get $heap  local.set $p
+//	    global.get $heap  local.get $size  i32.add  global.set $heap
+//	    local.get $p)
+//	  (func (export "transform") (param i32 i32 i32 i32) (result i64)
+//	    local.get 2  i64.extend_i32_u  i64.const 32  i64.shl
+//	    local.get 3  i64.extend_i32_u  i64.or))
+var Passthrough = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, 0x01, 0x0e, 0x02, 0x60, 0x01, 0x7f, 0x01, 0x7f,
+	0x60, 0x04, 0x7f, 0x7f, 0x7f, 0x7f, 0x01, 0x7e, 0x03, 0x03, 0x02, 0x00, 0x01, 0x05, 0x03, 0x01,
+	0x00, 0x01, 0x06, 0x07, 0x01, 0x7f, 0x01, 0x41, 0x80, 0x08, 0x0b, 0x07, 0x1e, 0x03, 0x06, 0x6d,
+	0x65, 0x6d, 0x6f, 0x72, 0x79, 0x02, 0x00, 0x05, 0x61, 0x6c, 0x6c, 0x6f, 0x63, 0x00, 0x00, 0x09,
+	0x74, 0x72, 0x61, 0x6e, 0x73, 0x66, 0x6f, 0x72, 0x6d, 0x00, 0x01, 0x0a, 0x20, 0x02, 0x11, 0x01,
+	0x01, 0x7f, 0x23, 0x00, 0x21, 0x01, 0x23, 0x00, 0x20, 0x00, 0x6a, 0x24, 0x00, 0x20, 0x01, 0x0b,
+	0x0c, 0x00, 0x20, 0x02, 0xad, 0x42, 0x20, 0x86, 0x20, 0x03, 0xad, 0x84, 0x0b,
+}
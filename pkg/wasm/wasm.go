@@ -0,0 +1,314 @@
+package wasm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/ingest"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+)
+
+// Common errors
+var (
+	ErrHookNotFound      = errors.New("wasm hook not found")
+	ErrHookAlreadyExists = errors.New("wasm hook already exists")
+	ErrInvalidModule     = errors.New("invalid wasm module")
+	ErrTransformFailed   = errors.New("wasm transform failed")
+)
+
+// Functions a hook module must export, besides its memory:
+//
+//	alloc(size i32) -> i32
+//	transform(topicPtr, topicLen, payloadPtr, payloadLen i32) -> i64
+//
+// alloc returns a buffer of size bytes in the module memory. transform
+// receives the topic and the raw payload of a bridged message and returns the
+// resulting telemetry as JSON, located by the pointer in the upper and the
+// length in the lower 32 bits of its result. A result of 0 skips the message.
+const (
+	allocFunc     = "alloc"
+	transformFunc = "transform"
+)
+
+// Limits bound a single transform call
+type Limits struct {
+	MemoryPages uint32        // Maximum memory in 64 KiB pages
+	Timeout     time.Duration // Maximum wall-clock time
+	MaxOutput   uint32        // Maximum size of the returned JSON in bytes
+}
+
+// DefaultLimits are applied to limits that are not set
+var DefaultLimits = Limits{MemoryPages: 256, Timeout: 100 * time.Millisecond, MaxOutput: 1 << 20}
+
+// Info describes an uploaded hook
+type Info struct {
+	Name      string    `json:"name"`
+	Size      int       `json:"size"`
+	Limits    Limits    `json:"-"`
+	Calls     int       `json:"calls"`
+	Errors    int       `json:"errors"`
+	LastError string    `json:"lastError,omitempty"`
+	Uploaded  time.Time `json:"uploaded"`
+}
+
+// hook is an uploaded module compiled in its own runtime, so that the memory
+// limit applies to this module only
+type hook struct {
+	info     Info
+	runtime  wazero.Runtime
+	compiled wazero.CompiledModule
+}
+
+// Manager runs WASM payload transformation hooks for message bridges.
+// Every call runs in a fresh module instance without any host imports, so
+// hooks cannot keep state between messages or reach the host system.
+type Manager struct {
+	hooks map[string]*hook
+	mutex sync.RWMutex
+}
+
+// NewManager creates a new WASM hook manager
+func NewManager() *Manager {
+	return &Manager{
+		hooks: make(map[string]*hook),
+	}
+}
+
+// Upload compiles and registers a hook module
+func (m *Manager) Upload(ctx context.Context, name string, binary []byte, limits Limits) error {
+	if name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidModule)
+	}
+
+	if limits.MemoryPages == 0 {
+		limits.MemoryPages = DefaultLimits.MemoryPages
+	}
+	if limits.Timeout <= 0 {
+		limits.Timeout = DefaultLimits.Timeout
+	}
+	if limits.MaxOutput == 0 {
+		limits.MaxOutput = DefaultLimits.MaxOutput
+	}
+
+	m.mutex.RLock()
+	_, exists := m.hooks[name]
+	m.mutex.RUnlock()
+	if exists {
+		return ErrHookAlreadyExists
+	}
+
+	config := wazero.NewRuntimeConfig().
+		WithCloseOnContextDone(true).
+		WithMemoryLimitPages(limits.MemoryPages)
+	runtime := wazero.NewRuntimeWithConfig(ctx, config)
+
+	compiled, err := runtime.CompileModule(ctx, binary)
+	if err == nil {
+		err = validate(compiled)
+	}
+	if err != nil {
+		runtime.Close(ctx)
+		return fmt.Errorf("%w: %v", ErrInvalidModule, err)
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, exists := m.hooks[name]; exists {
+		runtime.Close(ctx)
+		return ErrHookAlreadyExists
+	}
+
+	m.hooks[name] = &hook{
+		info:     Info{Name: name, Size: len(binary), Limits: limits, Uploaded: time.Now()},
+		runtime:  runtime,
+		compiled: compiled,
+	}
+	return nil
+}
+
+// Delete removes a hook
+func (m *Manager) Delete(ctx context.Context, name string) error {
+	m.mutex.Lock()
+	h, exists := m.hooks[name]
+	delete(m.hooks, name)
+	m.mutex.Unlock()
+
+	if !exists {
+		return ErrHookNotFound
+	}
+	return h.runtime.Close(ctx)
+}
+
+// Get returns information about a hook
+func (m *Manager) Get(name string) (Info, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	h, exists := m.hooks[name]
+	if !exists {
+		return Info{}, ErrHookNotFound
+	}
+	return h.info, nil
+}
+
+// List returns information about all hooks sorted by name
+func (m *Manager) List() []Info {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	result := make([]Info, 0, len(m.hooks))
+	for _, h := range m.hooks {
+		result = append(result, h.info)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// Close releases all hooks
+func (m *Manager) Close(ctx context.Context) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for name, h := range m.hooks {
+		h.runtime.Close(ctx)
+		delete(m.hooks, name)
+	}
+}
+
+// Transform converts a bridged message to telemetry using a hook.
+// It returns nil telemetry if the hook skipped the message.
+func (m *Manager) Transform(ctx context.Context, name, topic string, payload []byte) (*ingest.Telemetry, error) {
+	m.mutex.RLock()
+	h, exists := m.hooks[name]
+	m.mutex.RUnlock()
+
+	if !exists {
+		return nil, ErrHookNotFound
+	}
+
+	telemetry, err := h.call(ctx, topic, payload)
+
+	m.mutex.Lock()
+	h.info.Calls++
+	if err != nil {
+		h.info.Errors++
+		h.info.LastError = err.Error()
+	}
+	m.mutex.Unlock()
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrTransformFailed, name, err)
+	}
+	return telemetry, nil
+}
+
+// call runs the transform function of a hook in a fresh instance
+func (h *hook) call(ctx context.Context, topic string, payload []byte) (*ingest.Telemetry, error) {
+	ctx, cancel := context.WithTimeout(ctx, h.info.Limits.Timeout)
+	defer cancel()
+
+	// An empty module name allows concurrent instances of the same module
+	mod, err := h.runtime.InstantiateModule(ctx, h.compiled, wazero.NewModuleConfig().WithName(""))
+	if err != nil {
+		return nil, err
+	}
+	defer mod.Close(context.Background())
+
+	topicPtr, err := write(ctx, mod, []byte(topic))
+	if err != nil {
+		return nil, err
+	}
+	payloadPtr, err := write(ctx, mod, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := mod.ExportedFunction(transformFunc).Call(ctx,
+		uint64(topicPtr), uint64(len(topic)), uint64(payloadPtr), uint64(len(payload)))
+	if err != nil {
+		return nil, err
+	}
+
+	if results[0] == 0 {
+		return nil, nil
+	}
+
+	ptr, size := uint32(results[0]>>32), uint32(results[0])
+	if size > h.info.Limits.MaxOutput {
+		return nil, fmt.Errorf("output of %d bytes exceeds the limit of %d", size, h.info.Limits.MaxOutput)
+	}
+
+	output, ok := mod.Memory().Read(ptr, size)
+	if !ok {
+		return nil, fmt.Errorf("output out of memory bounds")
+	}
+
+	var telemetry ingest.Telemetry
+	if err := json.Unmarshal(output, &telemetry); err != nil {
+		return nil, fmt.Errorf("invalid output: %v", err)
+	}
+	return &telemetry, nil
+}
+
+// write copies data into a buffer allocated by the module
+func write(ctx context.Context, mod api.Module, data []byte) (uint32, error) {
+	results, err := mod.ExportedFunction(allocFunc).Call(ctx, uint64(len(data)))
+	if err != nil {
+		return 0, err
+	}
+
+	ptr := uint32(results[0])
+	if !mod.Memory().Write(ptr, data) {
+		return 0, fmt.Errorf("allocated buffer out of memory bounds")
+	}
+	return ptr, nil
+}
+
+// validate checks that a module implements the hook ABI
+func validate(compiled wazero.CompiledModule) error {
+	if len(compiled.ImportedFunctions()) > 0 {
+		return fmt.Errorf("modules must not import host functions")
+	}
+
+	if _, ok := compiled.ExportedMemories()["memory"]; !ok {
+		return fmt.Errorf("module must export its memory as \"memory\"")
+	}
+
+	functions := compiled.ExportedFunctions()
+	signatures := map[string][2][]api.ValueType{
+		allocFunc:     {{api.ValueTypeI32}, {api.ValueTypeI32}},
+		transformFunc: {{api.ValueTypeI32, api.ValueTypeI32, api.ValueTypeI32, api.ValueTypeI32}, {api.ValueTypeI64}},
+	}
+
+	for name, sig := range signatures {
+		fn, ok := functions[name]
+		if !ok {
+			return fmt.Errorf("module must export %s", name)
+		}
+		if !equalTypes(fn.ParamTypes(), sig[0]) || !equalTypes(fn.ResultTypes(), sig[1]) {
+			return fmt.Errorf("function %s has the wrong signature", name)
+		}
+	}
+	return nil
+}
+
+// equalTypes compares two value type lists
+func equalTypes(a, b []api.ValueType) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
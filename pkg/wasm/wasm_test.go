@@ -0,0 +1,119 @@
+package wasm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// loopModule is Passthrough with a transform function that never returns:
+//
+//	(func (export "transform") (param i32 i32 i32 i32) (result i64)
+//	  (loop (br 0))  i64.const 0)
+var loopModule = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, 0x01, 0x0e, 0x02, 0x60, 0x01, 0x7f, 0x01, 0x7f,
+	0x60, 0x04, 0x7f, 0x7f, 0x7f, 0x7f, 0x01, 0x7e, 0x03, 0x03, 0x02, 0x00, 0x01, 0x05, 0x03, 0x01,
+	0x00, 0x01, 0x06, 0x07, 0x01, 0x7f, 0x01, 0x41, 0x80, 0x08, 0x0b, 0x07, 0x1e, 0x03, 0x06, 0x6d,
+	0x65, 0x6d, 0x6f, 0x72, 0x79, 0x02, 0x00, 0x05, 0x61, 0x6c, 0x6c, 0x6f, 0x63, 0x00, 0x00, 0x09,
+	0x74, 0x72, 0x61, 0x6e, 0x73, 0x66, 0x6f, 0x72, 0x6d, 0x00, 0x01, 0x0a, 0x1d, 0x02, 0x11, 0x01,
+	0x01, 0x7f, 0x23, 0x00, 0x21, 0x01, 0x23, 0x00, 0x20, 0x00, 0x6a, 0x24, 0x00, 0x20, 0x01, 0x0b,
+	0x09, 0x00, 0x03, 0x40, 0x0c, 0x00, 0x0b, 0x42, 0x00, 0x0b,
+}
+
+// emptyModule is a valid module without any exports
+var emptyModule = []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+
+func TestUpload(t *testing.T) {
+	ctx := context.Background()
+	m := NewManager()
+	defer m.Close(ctx)
+
+	if err := m.Upload(ctx, "garbage", []byte("not wasm"), Limits{}); !errors.Is(err, ErrInvalidModule) {
+		t.Errorf("Expected ErrInvalidModule for garbage, got %v", err)
+	}
+
+	if err := m.Upload(ctx, "empty", emptyModule, Limits{}); !errors.Is(err, ErrInvalidModule) {
+		t.Errorf("Expected ErrInvalidModule for module without exports, got %v", err)
+	}
+
+	if err := m.Upload(ctx, "echo", Passthrough, Limits{}); err != nil {
+		t.Fatalf("Failed to upload module: %v", err)
+	}
+
+	if err := m.Upload(ctx, "echo", Passthrough, Limits{}); err != ErrHookAlreadyExists {
+		t.Errorf("Expected ErrHookAlreadyExists, got %v", err)
+	}
+
+	info, err := m.Get("echo")
+	if err != nil || info.Size != len(Passthrough) || info.Limits != DefaultLimits {
+		t.Errorf("Unexpected hook info: %+v, %v", info, err)
+	}
+
+	if err := m.Delete(ctx, "echo"); err != nil {
+		t.Errorf("Failed to delete hook: %v", err)
+	}
+
+	if err := m.Delete(ctx, "echo"); err != ErrHookNotFound {
+		t.Errorf("Expected ErrHookNotFound, got %v", err)
+	}
+}
+
+func TestTransform(t *testing.T) {
+	ctx := context.Background()
+	m := NewManager()
+	defer m.Close(ctx)
+
+	m.Upload(ctx, "echo", Passthrough, Limits{})
+
+	payload := []byte(`{"twinId":"sensor-1","features":{"temperature":{"value":21.5}}}`)
+	telemetry, err := m.Transform(ctx, "echo", "plant/sensor-1", payload)
+	if err != nil {
+		t.Fatalf("Failed to transform payload: %v", err)
+	}
+
+	if telemetry.TwinID != "sensor-1" || telemetry.Features["temperature"]["value"] != 21.5 {
+		t.Errorf("Unexpected telemetry: %+v", telemetry)
+	}
+
+	// Output that is not telemetry JSON is an error
+	if _, err := m.Transform(ctx, "echo", "plant/sensor-1", []byte("21.5;22.0")); !errors.Is(err, ErrTransformFailed) {
+		t.Errorf("Expected ErrTransformFailed, got %v", err)
+	}
+
+	if info, _ := m.Get("echo"); info.Calls != 2 || info.Errors != 1 {
+		t.Errorf("Expected 2 calls and 1 error, got %+v", info)
+	}
+
+	if _, err := m.Transform(ctx, "unknown", "", nil); err != ErrHookNotFound {
+		t.Errorf("Expected ErrHookNotFound, got %v", err)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	ctx := context.Background()
+	m := NewManager()
+	defer m.Close(ctx)
+
+	m.Upload(ctx, "loop", loopModule, Limits{Timeout: 10 * time.Millisecond})
+
+	start := time.Now()
+	if _, err := m.Transform(ctx, "loop", "", []byte("{}")); !errors.Is(err, ErrTransformFailed) {
+		t.Errorf("Expected timeout error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected call to be stopped quickly, took %s", elapsed)
+	}
+
+	// Output above the limit is rejected
+	m.Upload(ctx, "small", Passthrough, Limits{MaxOutput: 8})
+	if _, err := m.Transform(ctx, "small", "", []byte(`{"features":{}}`)); !errors.Is(err, ErrTransformFailed) {
+		t.Errorf("Expected output limit error, got %v", err)
+	}
+
+	// Payloads that do not fit into the memory limit fail
+	m.Upload(ctx, "tiny", Passthrough, Limits{MemoryPages: 1})
+	if _, err := m.Transform(ctx, "tiny", "", make([]byte, 128*1024)); !errors.Is(err, ErrTransformFailed) {
+		t.Errorf("Expected memory limit error, got %v", err)
+	}
+}
@@ -0,0 +1,548 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/clock"
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/reshape"
+	"github.com/aleka07/go-digital-twin/pkg/secret"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+// Common errors
+var (
+	ErrHookNotFound      = errors.New("webhook not found")
+	ErrHookAlreadyExists = errors.New("webhook already exists")
+	ErrInvalidHook       = errors.New("invalid webhook")
+)
+
+// Event is a twin lifecycle transition that can trigger a webhook
+type Event string
+
+// Lifecycle events
+const (
+	EventCreated        Event = "created"
+	EventActivated      Event = "activated"
+	EventDecommissioned Event = "decommissioned"
+	EventDeleted        Event = "deleted" // Payloads only carry the twin ID, as the twin is gone
+)
+
+// topics maps the pub/sub topics of lifecycle transitions to their events
+var topics = map[string]Event{
+	"twin.created":        EventCreated,
+	"twin.activated":      EventActivated,
+	"twin.decommissioned": EventDecommissioned,
+	"twin.deleted":        EventDeleted,
+}
+
+// Topic returns the pub/sub topic published for a lifecycle event
+func Topic(e Event) string {
+	return "twin." + string(e)
+}
+
+// DefaultTemplate renders the event and the full twin document as JSON
+const DefaultTemplate = `{"event":{{json .Event}},"timestamp":{{json .Timestamp}},"twin":{{json .Twin}}}`
+
+// deliveryTimeout bounds a single webhook request
+const deliveryTimeout = 10 * time.Second
+
+// Limits of the delivery queue of each webhook
+const (
+	maxPending    = 1000            // Calls queued per webhook; the oldest are dropped beyond it
+	maxAttempts   = 8               // Calls failing this many times are dropped
+	minBackoff    = time.Second     // Delay after the first failed attempt of a call
+	maxBackoff    = 5 * time.Minute // Upper bound of the doubling delay between attempts
+	retryInterval = time.Second     // How often webhooks backing off are checked
+)
+
+// Hook configures a webhook called on twin lifecycle transitions
+type Hook struct {
+	Name        string            `json:"name"`
+	URL         string            `json:"url"`
+	Events      []Event           `json:"events"`                // Events that trigger the hook, all when empty
+	Template    string            `json:"template,omitempty"`    // Go template for the payload, DefaultTemplate when empty
+	Transform   string            `json:"transform,omitempty"`   // jq-style expression for a JSON payload, instead of a template
+	ContentType string            `json:"contentType,omitempty"` // Defaults to application/json
+	Headers     map[string]string `json:"headers,omitempty"`     // Values may be secret references such as ${env:ERP_TOKEN}
+}
+
+// TemplateData is the data a payload template is executed with.
+// Twin is the JSON document of the twin, so templates use its JSON field names,
+// e.g. {{.Twin.id}} or {{.Twin.attributes.serial}}. Transforms are evaluated
+// over an object of the same fields in lower case, e.g. .twin.attributes.serial.
+type TemplateData struct {
+	Event     Event
+	Timestamp time.Time
+	Twin      map[string]interface{}
+}
+
+// Delivery records the outcome of an attempt to call a webhook
+type Delivery struct {
+	Event      Event      `json:"event"`
+	TwinID     string     `json:"twinId"`
+	Time       time.Time  `json:"time"`
+	Attempt    int        `json:"attempt,omitempty"` // Attempts made at the call, including this one
+	StatusCode int        `json:"statusCode,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	RetryAt    *time.Time `json:"retryAt,omitempty"` // Set when the call failed and will be retried
+}
+
+// call is a rendered webhook call waiting in the queue of a hook
+type call struct {
+	seq      uint64
+	event    Event
+	twinID   string
+	payload  []byte
+	attempts int // Failed attempts so far
+}
+
+// hook is a registered webhook with its compiled template or transform and
+// its queue of calls, which the manager lock guards
+type hook struct {
+	Hook
+	headers map[string]string // Headers with secret references resolved
+	tmpl    *template.Template
+	expr    *reshape.Expression
+	last    *Delivery
+	pending []call
+	nextSeq uint64
+	backoff time.Duration
+	retryAt time.Time // Set while backing off after a failed attempt
+}
+
+// Manager delivers webhooks for twin lifecycle transitions. Calls are
+// queued per webhook and delivered in order in the background; failed
+// attempts are retried with exponential backoff.
+type Manager struct {
+	registry *registry.Registry
+	client   *http.Client
+	secrets  *secret.Manager
+	hooks    map[string]*hook
+	clock    clock.Clock
+	queued   chan struct{} // Signals calls queued for delivery
+	mutex    sync.RWMutex
+	sending  sync.Mutex // Serializes deliveries
+}
+
+// NewManager creates a new webhook manager
+func NewManager(reg *registry.Registry) *Manager {
+	return &Manager{
+		registry: reg,
+		client:   &http.Client{Timeout: deliveryTimeout},
+		secrets:  secret.NewManager(),
+		hooks:    make(map[string]*hook),
+		clock:    clock.System,
+		queued:   make(chan struct{}, 1),
+	}
+}
+
+// SetClock sets the clock that delivery and payload times are read from;
+// nil restores the system clock
+func (m *Manager) SetClock(c clock.Clock) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.clock = clock.OrSystem(c)
+}
+
+// now returns the time of the manager clock
+func (m *Manager) now() time.Time {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return m.clock.Now()
+}
+
+// SetSecrets sets the manager resolving secret references in headers
+func (m *Manager) SetSecrets(secrets *secret.Manager) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.secrets = secrets
+}
+
+// Create registers a new webhook
+func (m *Manager) Create(h Hook) error {
+	if h.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidHook)
+	}
+
+	u, err := url.Parse(h.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalidHook)
+	}
+
+	for _, e := range h.Events {
+		if _, ok := topics[Topic(e)]; !ok {
+			return fmt.Errorf("%w: unknown event %q", ErrInvalidHook, e)
+		}
+	}
+
+	if h.Template != "" && h.Transform != "" {
+		return fmt.Errorf("%w: template and transform are exclusive", ErrInvalidHook)
+	}
+	if h.Template == "" && h.Transform == "" {
+		h.Template = DefaultTemplate
+	}
+	if h.ContentType == "" {
+		h.ContentType = "application/json"
+	}
+
+	m.mutex.RLock()
+	secrets := m.secrets
+	m.mutex.RUnlock()
+
+	compiled := &hook{Hook: h}
+	if compiled.headers, err = secrets.ResolveMap(context.Background(), h.Headers); err != nil {
+		return fmt.Errorf("%w: header %v", ErrInvalidHook, err)
+	}
+	if h.Transform != "" {
+		compiled.expr, err = reshape.Compile(h.Transform)
+	} else {
+		compiled.tmpl, err = ParseTemplate(h.Name, h.Template)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidHook, err)
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, exists := m.hooks[h.Name]; exists {
+		return ErrHookAlreadyExists
+	}
+
+	m.hooks[h.Name] = compiled
+	return nil
+}
+
+// Delete removes a webhook
+func (m *Manager) Delete(name string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, exists := m.hooks[name]; !exists {
+		return ErrHookNotFound
+	}
+
+	delete(m.hooks, name)
+	return nil
+}
+
+// Get returns a webhook and its last delivery, if any. Headers carrying
+// credentials are redacted unless they are secret references.
+func (m *Manager) Get(name string) (Hook, *Delivery, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	h, exists := m.hooks[name]
+	if !exists {
+		return Hook{}, nil, ErrHookNotFound
+	}
+
+	return h.redacted(), h.last, nil
+}
+
+// redacted returns the webhook without credentials in its headers
+func (h *hook) redacted() Hook {
+	redacted := h.Hook
+	redacted.Headers = secret.RedactHeaders(h.Headers)
+	return redacted
+}
+
+// List returns all webhooks sorted by name
+func (m *Manager) List() []Hook {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	hooks := make([]Hook, 0, len(m.hooks))
+	for _, h := range m.hooks {
+		hooks = append(hooks, h.redacted())
+	}
+
+	sort.Slice(hooks, func(i, j int) bool { return hooks[i].Name < hooks[j].Name })
+	return hooks
+}
+
+// Render executes the payload template or transform of a webhook for a twin
+func (m *Manager) Render(name string, e Event, dt *twin.DigitalTwin) ([]byte, error) {
+	m.mutex.RLock()
+	h, exists := m.hooks[name]
+	m.mutex.RUnlock()
+
+	if !exists {
+		return nil, ErrHookNotFound
+	}
+
+	doc, err := document(dt)
+	if err != nil {
+		return nil, err
+	}
+	return h.render(e, doc, m.now())
+}
+
+// HandleEvent queues a call of all webhooks subscribed to the lifecycle
+// transition in a message, rendered over the twin as it is now. Deleted
+// twins can no longer be looked up, so their calls are rendered over a
+// document holding only the twin ID from the event. Other messages are
+// ignored.
+func (m *Manager) HandleEvent(msg messaging_sim.Message) {
+	e, ok := topics[msg.Topic]
+	if !ok {
+		return
+	}
+
+	twinID := msg.TwinID()
+	if twinID == "" {
+		return
+	}
+	doc := map[string]interface{}{"id": twinID}
+	if e != EventDeleted {
+		dt, err := m.registry.Get(twinID)
+		if err != nil {
+			return
+		}
+		if doc, err = document(dt); err != nil {
+			return
+		}
+	}
+	now := m.now()
+
+	m.mutex.Lock()
+	queued := false
+	for _, h := range m.hooks {
+		if !h.subscribed(e) {
+			continue
+		}
+		payload, err := h.render(e, doc, now)
+		if err != nil {
+			h.last = &Delivery{Event: e, TwinID: twinID, Time: now, Error: err.Error()}
+			continue
+		}
+		h.enqueue(call{event: e, twinID: twinID, payload: payload})
+		queued = true
+	}
+	m.mutex.Unlock()
+
+	if queued {
+		select {
+		case m.queued <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Run queues webhook calls for events from a subscription until the channel
+// is closed, and delivers them in the background meanwhile
+func (m *Manager) Run(events <-chan messaging_sim.Message) {
+	done := make(chan struct{})
+	defer close(done)
+	go m.deliverQueued(done)
+
+	for msg := range events {
+		m.HandleEvent(msg)
+	}
+}
+
+// deliverQueued delivers calls as they are queued, and those of webhooks
+// backing off once they are due, until done is closed
+func (m *Manager) deliverQueued(done <-chan struct{}) {
+	ticker := time.NewTicker(retryInterval)
+	defer ticker.Stop()
+
+	for {
+		m.Flush()
+		select {
+		case <-done:
+			return
+		case <-m.queued:
+		case <-ticker.C:
+		}
+	}
+}
+
+// Flush delivers the queued calls of all webhooks that are not backing off.
+// The calls of a webhook are delivered in order, so a failed call is
+// retried before the calls queued behind it.
+func (m *Manager) Flush() {
+	m.sending.Lock()
+	defer m.sending.Unlock()
+
+	m.mutex.RLock()
+	hooks := make([]*hook, 0, len(m.hooks))
+	for _, h := range m.hooks {
+		hooks = append(hooks, h)
+	}
+	m.mutex.RUnlock()
+
+	for _, h := range hooks {
+		for m.deliverNext(h) {
+		}
+	}
+}
+
+// deliverNext makes an attempt at the oldest queued call of a hook unless it
+// is backing off, and reports whether the call was done with, so that the
+// next one can follow
+func (m *Manager) deliverNext(h *hook) bool {
+	now := m.now()
+
+	m.mutex.RLock()
+	if len(h.pending) == 0 || now.Before(h.retryAt) {
+		m.mutex.RUnlock()
+		return false
+	}
+	c := h.pending[0]
+	m.mutex.RUnlock()
+
+	delivery := m.deliver(h, c)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	h.last = delivery
+	// The call may have been dropped from a full queue meanwhile
+	if len(h.pending) == 0 || h.pending[0].seq != c.seq {
+		return true
+	}
+
+	if delivery.Error == "" || !retryable(delivery) || delivery.Attempt >= maxAttempts {
+		h.pending = h.pending[1:]
+		h.backoff = 0
+		h.retryAt = time.Time{}
+		return true
+	}
+
+	h.pending[0].attempts++
+	if h.backoff == 0 {
+		h.backoff = minBackoff
+	} else if h.backoff *= 2; h.backoff > maxBackoff {
+		h.backoff = maxBackoff
+	}
+	h.retryAt = delivery.Time.Add(h.backoff)
+	delivery.RetryAt = &h.retryAt
+	return false
+}
+
+// retryable reports whether a failed attempt may succeed when repeated:
+// the request failed or the receiver was unavailable or overloaded
+func retryable(d *Delivery) bool {
+	return d.StatusCode == 0 || d.StatusCode >= 500 || d.StatusCode == http.StatusTooManyRequests
+}
+
+// enqueue adds a call to the queue of the hook, dropping the oldest call if
+// the queue is full; the caller must hold the manager lock
+func (h *hook) enqueue(c call) {
+	if len(h.pending) >= maxPending {
+		h.pending = h.pending[1:]
+	}
+	h.nextSeq++
+	c.seq = h.nextSeq
+	h.pending = append(h.pending, c)
+}
+
+// subscribed reports whether the hook is triggered by an event
+func (h *hook) subscribed(e Event) bool {
+	if len(h.Events) == 0 {
+		return true
+	}
+	for _, ev := range h.Events {
+		if ev == e {
+			return true
+		}
+	}
+	return false
+}
+
+// deliver posts the payload of a call to its hook
+func (m *Manager) deliver(h *hook, c call) *Delivery {
+	delivery := &Delivery{Event: c.event, TwinID: c.twinID, Time: m.now(), Attempt: c.attempts + 1}
+
+	req, err := http.NewRequest(http.MethodPost, h.URL, bytes.NewReader(c.payload))
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+
+	req.Header.Set("Content-Type", h.ContentType)
+	req.Header.Set("X-Twin-Event", string(c.event))
+	for k, v := range h.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+	resp.Body.Close()
+
+	delivery.StatusCode = resp.StatusCode
+	if resp.StatusCode >= 300 {
+		delivery.Error = resp.Status
+	}
+	return delivery
+}
+
+// document returns the JSON document of a twin that payloads are rendered over
+func document(dt *twin.DigitalTwin) (map[string]interface{}, error) {
+	data, err := json.Marshal(dt)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// render executes the payload template or transform of a hook over the JSON
+// document of a twin at a time
+func (h *hook) render(e Event, doc map[string]interface{}, at time.Time) ([]byte, error) {
+	data := TemplateData{Event: e, Timestamp: at, Twin: doc}
+
+	if h.expr != nil {
+		out, err := h.expr.Eval(map[string]interface{}{
+			"event":     string(data.Event),
+			"timestamp": data.Timestamp.Format(time.RFC3339Nano),
+			"twin":      data.Twin,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(out)
+	}
+
+	var buf bytes.Buffer
+	if err := h.tmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ParseTemplate compiles a message template. The json function encodes a
+// value as JSON, and missing keys render as their zero value. Notification
+// channels use the same templates.
+func ParseTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(template.FuncMap{"json": toJSON}).Option("missingkey=zero").Parse(text)
+}
+
+// toJSON is the template function that encodes a value as JSON
+func toJSON(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	return string(data), err
+}
@@ -0,0 +1,260 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aleka07/go-digital-twin/pkg/clock"
+	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
+	"github.com/aleka07/go-digital-twin/pkg/registry"
+	"github.com/aleka07/go-digital-twin/pkg/twin"
+)
+
+func TestHookValidation(t *testing.T) {
+	m := NewManager(registry.NewRegistry())
+
+	invalid := []Hook{
+		{URL: "http://example.com"},
+		{Name: "no-url"},
+		{Name: "relative", URL: "/hooks"},
+		{Name: "bad-event", URL: "http://example.com", Events: []Event{"renamed"}},
+		{Name: "bad-template", URL: "http://example.com", Template: "{{.Twin.id"},
+		{Name: "bad-transform", URL: "http://example.com", Transform: "{asset: .twin.id"},
+		{Name: "both", URL: "http://example.com", Template: "{{.Twin.id}}", Transform: ".twin.id"},
+	}
+	for _, h := range invalid {
+		if err := m.Create(h); err == nil {
+			t.Errorf("Expected error for hook %+v", h)
+		}
+	}
+
+	if err := m.Create(Hook{Name: "erp", URL: "http://example.com"}); err != nil {
+		t.Fatalf("Failed to create hook: %v", err)
+	}
+
+	if err := m.Create(Hook{Name: "erp", URL: "http://example.com"}); err != ErrHookAlreadyExists {
+		t.Errorf("Expected ErrHookAlreadyExists, got %v", err)
+	}
+
+	if err := m.Delete("erp"); err != nil {
+		t.Errorf("Failed to delete hook: %v", err)
+	}
+
+	if err := m.Delete("erp"); err != ErrHookNotFound {
+		t.Errorf("Expected ErrHookNotFound, got %v", err)
+	}
+}
+
+func TestRender(t *testing.T) {
+	reg := registry.NewRegistry()
+	m := NewManager(reg)
+
+	dt := twin.NewDigitalTwin("pump-1", "pump")
+	dt.SetAttribute("serial", "SN-42")
+
+	m.Create(Hook{
+		Name:     "cmms",
+		URL:      "http://example.com",
+		Template: `{"asset":{{json .Twin.id}},"serial":"{{.Twin.attributes.serial}}","event":"{{.Event}}"}`,
+	})
+
+	payload, err := m.Render("cmms", EventActivated, dt)
+	if err != nil {
+		t.Fatalf("Failed to render payload: %v", err)
+	}
+
+	expected := `{"asset":"pump-1","serial":"SN-42","event":"activated"}`
+	if string(payload) != expected {
+		t.Errorf("Expected payload %s, got %s", expected, payload)
+	}
+
+	// The default template contains the whole twin document
+	m.Create(Hook{Name: "default", URL: "http://example.com"})
+	payload, _ = m.Render("default", EventCreated, dt)
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(payload, &doc); err != nil {
+		t.Fatalf("Expected default payload to be JSON: %v", err)
+	}
+
+	if doc["event"] != "created" || doc["twin"].(map[string]interface{})["id"] != "pump-1" {
+		t.Errorf("Unexpected default payload: %s", payload)
+	}
+
+	// Transforms reshape the same data into JSON
+	m.Create(Hook{Name: "erp", URL: "http://example.com", Transform: `{asset: .twin.id, serial: .twin.attributes.serial, active: (.event == "activated")}`})
+	payload, err = m.Render("erp", EventActivated, dt)
+	if err != nil {
+		t.Fatalf("Failed to render payload: %v", err)
+	}
+	if expected := `{"active":true,"asset":"pump-1","serial":"SN-42"}`; string(payload) != expected {
+		t.Errorf("Expected payload %s, got %s", expected, payload)
+	}
+}
+
+func TestHandleEvent(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	bodies := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- string(body)
+	}))
+	defer srv.Close()
+
+	reg := registry.NewRegistry()
+	reg.Create(twin.NewDigitalTwin("pump-1", "pump"))
+
+	m := NewManager(reg)
+	m.Create(Hook{
+		Name:     "erp",
+		URL:      srv.URL,
+		Events:   []Event{EventDecommissioned},
+		Template: `{{.Twin.id}} {{.Event}}`,
+		Headers:  map[string]string{"Authorization": "Bearer token"},
+	})
+
+	// Events the hook is not subscribed to are not delivered
+	m.HandleEvent(messaging_sim.Message{Topic: "twin.created", Payload: map[string]string{"id": "pump-1"}})
+	if _, last, _ := m.Get("erp"); last != nil {
+		t.Errorf("Expected no delivery, got %+v", last)
+	}
+
+	m.HandleEvent(messaging_sim.Message{Topic: "twin.decommissioned", Payload: map[string]string{"id": "pump-1"}})
+	m.Flush()
+
+	req := <-received
+	if req.Header.Get("Authorization") != "Bearer token" || req.Header.Get("X-Twin-Event") != "decommissioned" {
+		t.Errorf("Unexpected headers: %v", req.Header)
+	}
+
+	if body := <-bodies; body != "pump-1 decommissioned" {
+		t.Errorf("Expected rendered payload, got %s", body)
+	}
+
+	_, last, _ := m.Get("erp")
+	if last == nil || last.StatusCode != http.StatusOK || last.Error != "" {
+		t.Errorf("Expected successful delivery, got %+v", last)
+	}
+}
+
+func TestDeliveryRetry(t *testing.T) {
+	var attempts int32
+	bodies := make(chan string, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies <- string(body)
+		if atomic.AddInt32(&attempts, 1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	reg := registry.NewRegistry()
+	reg.Create(twin.NewDigitalTwin("pump-1", "pump"))
+	reg.Create(twin.NewDigitalTwin("pump-2", "pump"))
+
+	m := NewManager(reg)
+	fake := clock.NewFake(time.Date(2026, 5, 1, 8, 0, 0, 0, time.UTC))
+	m.SetClock(fake)
+	m.Create(Hook{Name: "erp", URL: srv.URL, Template: `{{.Twin.id}}`})
+
+	m.HandleEvent(messaging_sim.Message{Topic: "twin.created", Payload: map[string]string{"id": "pump-1"}})
+	m.HandleEvent(messaging_sim.Message{Topic: "twin.created", Payload: map[string]string{"id": "pump-2"}})
+
+	m.Flush()
+	if _, last, _ := m.Get("erp"); last.Attempt != 1 || last.StatusCode != http.StatusServiceUnavailable || last.RetryAt == nil {
+		t.Errorf("Expected the failed attempt to be retried, got %+v", last)
+	}
+
+	// A failed call is retried after a doubling delay, before the calls behind it
+	for i, backoff := range []time.Duration{minBackoff, 2 * minBackoff} {
+		fake.Advance(backoff - time.Millisecond)
+		m.Flush()
+		if n := atomic.LoadInt32(&attempts); n != int32(i+1) {
+			t.Fatalf("Expected %d attempts before the backoff passed, got %d", i+1, n)
+		}
+		fake.Advance(time.Millisecond)
+		m.Flush()
+	}
+
+	var delivered []string
+	for len(bodies) > 0 {
+		delivered = append(delivered, <-bodies)
+	}
+	if len(delivered) != 4 || delivered[2] != "pump-1" || delivered[3] != "pump-2" {
+		t.Errorf("Expected pump-1 to be delivered on the third attempt, then pump-2, got %v", delivered)
+	}
+	if _, last, _ := m.Get("erp"); last.TwinID != "pump-2" || last.Attempt != 1 || last.Error != "" || last.RetryAt != nil {
+		t.Errorf("Expected pump-2 delivered on the first attempt, got %+v", last)
+	}
+}
+
+func TestDeletedEvent(t *testing.T) {
+	bodies := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies <- string(body)
+	}))
+	defer srv.Close()
+
+	m := NewManager(registry.NewRegistry())
+	m.Create(Hook{Name: "erp", URL: srv.URL, Events: []Event{EventDeleted}, Template: `{{.Twin.id}} {{.Event}}`})
+
+	events := make(chan messaging_sim.Message, 1)
+	defer close(events)
+	go m.Run(events)
+
+	// The twin no longer exists when its deletion is delivered
+	events <- messaging_sim.Message{Topic: "twin.deleted", Payload: map[string]string{"id": "pump-1"}}
+	select {
+	case body := <-bodies:
+		if body != "pump-1 deleted" {
+			t.Errorf("Expected a payload rendered from the event, got %s", body)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the deletion to be delivered")
+	}
+}
+
+func TestSecretHeaders(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r
+	}))
+	defer srv.Close()
+
+	reg := registry.NewRegistry()
+	reg.Create(twin.NewDigitalTwin("pump-1", "pump"))
+	m := NewManager(reg)
+
+	hook := Hook{Name: "erp", URL: srv.URL, Headers: map[string]string{"Authorization": "Bearer ${env:DT_TEST_ERP_TOKEN}"}}
+	if err := m.Create(hook); !errors.Is(err, ErrInvalidHook) {
+		t.Errorf("Expected an unresolvable reference to be rejected, got %v", err)
+	}
+
+	t.Setenv("DT_TEST_ERP_TOKEN", "token")
+	hook.Headers["X-Api-Key"] = "k3y"
+	hook.Headers["X-Source"] = "dt"
+	if err := m.Create(hook); err != nil {
+		t.Fatalf("Failed to create webhook: %v", err)
+	}
+
+	m.HandleEvent(messaging_sim.Message{Topic: "twin.created", Payload: map[string]string{"id": "pump-1"}})
+	m.Flush()
+	if req := <-received; req.Header.Get("Authorization") != "Bearer token" || req.Header.Get("X-Api-Key") != "k3y" {
+		t.Errorf("Expected resolved headers, got %v", req.Header)
+	}
+
+	// Credentials are not returned
+	h, _, _ := m.Get("erp")
+	if h.Headers["Authorization"] != "********" || h.Headers["X-Api-Key"] != "********" || h.Headers["X-Source"] != "dt" {
+		t.Errorf("Expected redacted headers, got %v", h.Headers)
+	}
+}
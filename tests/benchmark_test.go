@@ -11,6 +11,7 @@ import (
 	"testing"
 
 	"github.com/aleka07/go-digital-twin/pkg/api"
+	"github.com/aleka07/go-digital-twin/pkg/eventbus"
 	"github.com/aleka07/go-digital-twin/pkg/messaging_sim"
 	"github.com/aleka07/go-digital-twin/pkg/registry"
 	"github.com/aleka07/go-digital-twin/pkg/twin"
@@ -78,7 +79,7 @@ func BenchmarkTwinFeatureOperations(b *testing.B) {
 			featureID := fmt.Sprintf("feature-%d", i)
 			feature := twin.NewFeatureState()
 			feature.SetProperty("value", i)
-			_ = dt.AddFeature(featureID, *feature)
+			_ = dt.AddFeature(featureID, feature)
 		}
 	})
 
@@ -88,7 +89,7 @@ func BenchmarkTwinFeatureOperations(b *testing.B) {
 			featureID := fmt.Sprintf("get-feature-%d", i)
 			feature := twin.NewFeatureState()
 			feature.SetProperty("value", i)
-			dt.AddFeature(featureID, *feature)
+			dt.AddFeature(featureID, feature)
 		}
 
 		b.ResetTimer()
@@ -104,7 +105,7 @@ func BenchmarkTwinFeatureOperations(b *testing.B) {
 			featureID := fmt.Sprintf("update-feature-%d", i)
 			feature := twin.NewFeatureState()
 			feature.SetProperty("value", i)
-			dt.AddFeature(featureID, *feature)
+			dt.AddFeature(featureID, feature)
 		}
 
 		b.ResetTimer()
@@ -238,6 +239,7 @@ func BenchmarkPubSubThroughput(b *testing.B) {
 		}
 
 		// Publisher
+		b.ReportAllocs()
 		b.ResetTimer()
 		for i := 0; i < b.N; i++ {
 			pubsub.Publish("benchmark-topic", i)
@@ -264,6 +266,7 @@ func BenchmarkPubSubThroughput(b *testing.B) {
 		}()
 
 		// Publishers
+		b.ReportAllocs()
 		b.ResetTimer()
 		b.RunParallel(func(pb *testing.PB) {
 			i := 0
@@ -275,6 +278,28 @@ func BenchmarkPubSubThroughput(b *testing.B) {
 
 		wg.Wait()
 	})
+
+	b.Run("PropertyEventsToWildcardSubscribers", func(b *testing.B) {
+		const numSubscribers = 8
+
+		// Subscribers match by wildcard, like the components of the API server
+		for i := 0; i < numSubscribers; i++ {
+			go func(ch chan messaging_sim.Message) {
+				for range ch {
+				}
+			}(pubsub.SubscribeWithBuffer("#", 1024))
+		}
+
+		// Payloads are built for every event, as publishers do
+		twinIDs := []string{"pump-1", "pump-2", "pump-3", "pump-4"}
+		props := map[string]interface{}{"pressure": 2.5}
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			pubsub.Publish("properties.updated", eventbus.PropertiesUpdated{TwinID: twinIDs[i%len(twinIDs)], FeatureID: "status", Properties: props})
+		}
+	})
 }
 
 // BenchmarkAPIEndpoints measures the performance of API endpoints
@@ -285,7 +310,7 @@ func BenchmarkAPIEndpoints(b *testing.B) {
 	dt := twin.NewDigitalTwin("api-twin", "device")
 	feature := twin.NewFeatureState()
 	feature.SetProperty("value", 42)
-	dt.AddFeature("test-feature", *feature)
+	dt.AddFeature("test-feature", feature)
 	server.Registry.Create(dt)
 
 	b.Run("GetTwin", func(b *testing.B) {